@@ -0,0 +1,163 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package admin authenticates the operators running admin tools to the
+// services they call. An operator holds a client certificate, issued by an
+// operator CA, and its key, with which the tool signs a short-lived token
+// that travels with each RPC. Services verify the token against the
+// operator CA, so that administrative actions are attributed to the
+// operator who took them, rather than to whatever name the tool claims.
+package admin
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+const (
+	// DefaultLifetime is how long tokens are valid for unless asked
+	// otherwise.
+	DefaultLifetime = 5 * time.Minute
+
+	// MaxLifetime is the longest validity a Verifier accepts, so that a
+	// token that leaks is soon useless.
+	MaxLifetime = 15 * time.Minute
+
+	// clockSkew is how far ahead of a verifier's clock a token may have
+	// been issued.
+	clockSkew = time.Minute
+)
+
+// claims is the payload of a token.
+type claims struct {
+	Operator string `json:"operator"`
+	// Certificate is the hex SHA-256 fingerprint of the operator's
+	// certificate, binding the signature to it.
+	Certificate string    `json:"certificate"`
+	Issued      time.Time `json:"issued"`
+	Expires     time.Time `json:"expires"`
+}
+
+func fingerprint(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(hash[:])
+}
+
+// SignToken returns a token for the operator holding cert and its key,
+// valid from now for lifetime. The token is the certificate, base64url DER,
+// and a compact JWS of the claims signed with key, joined by a dot.
+func SignToken(key crypto.Signer, cert *x509.Certificate, now time.Time, lifetime time.Duration) (string, error) {
+	if lifetime <= 0 || lifetime > MaxLifetime {
+		return "", fmt.Errorf("Token lifetime %s isn't between 0 and %s", lifetime, MaxLifetime)
+	}
+	alg, err := core.SigningAlgorithm(key)
+	if err != nil {
+		return "", err
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: alg, Key: key}, &jose.SignerOptions{EmbedJWK: true})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims{
+		Operator:    cert.Subject.CommonName,
+		Certificate: fingerprint(cert),
+		Issued:      now.UTC(),
+		Expires:     now.Add(lifetime).UTC(),
+	})
+	if err != nil {
+		return "", err
+	}
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+	compact, err := jws.CompactSerialize()
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(cert.Raw) + "." + compact, nil
+}
+
+// Verifier checks tokens against the CAs that issue operator certificates.
+type Verifier struct {
+	roots *x509.CertPool
+	clk   clock.Clock
+}
+
+// NewVerifier returns a Verifier of tokens whose certificates were issued
+// by roots.
+func NewVerifier(roots *x509.CertPool, clk clock.Clock) *Verifier {
+	return &Verifier{roots: roots, clk: clk}
+}
+
+// ErrNoToken is returned by Verify for an empty token.
+var ErrNoToken = errors.New("No operator token")
+
+// Verify checks that token was signed by the key of a currently valid
+// operator certificate issued by the verifier's CAs, and is itself valid
+// now, returning the operator's name: the certificate's common name.
+func (v *Verifier) Verify(token string) (string, error) {
+	if token == "" {
+		return "", ErrNoToken
+	}
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return "", errors.New("Malformed operator token")
+	}
+	der, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", fmt.Errorf("Malformed operator certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return "", fmt.Errorf("Malformed operator certificate: %s", err)
+	}
+
+	now := v.clk.Now()
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:       v.roots,
+		CurrentTime: now,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return "", fmt.Errorf("Invalid operator certificate for %q: %s", cert.Subject.CommonName, err)
+	}
+
+	jws, err := jose.ParseSigned(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("Malformed operator token: %s", err)
+	}
+	payload, err := jws.Verify(cert.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("Operator token for %q isn't signed by its certificate's key", cert.Subject.CommonName)
+	}
+	var c claims
+	if err = json.Unmarshal(payload, &c); err != nil {
+		return "", fmt.Errorf("Malformed operator token: %s", err)
+	}
+	if c.Certificate != fingerprint(cert) || c.Operator != cert.Subject.CommonName {
+		return "", fmt.Errorf("Operator token for %q doesn't match its certificate", cert.Subject.CommonName)
+	}
+	if c.Expires.Sub(c.Issued) > MaxLifetime {
+		return "", fmt.Errorf("Operator token for %q is valid for longer than %s", c.Operator, MaxLifetime)
+	}
+	if now.Before(c.Issued.Add(-clockSkew)) || !now.Before(c.Expires) {
+		return "", fmt.Errorf("Operator token for %q is valid from %s to %s, not now", c.Operator, c.Issued, c.Expires)
+	}
+	return c.Operator, nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package admin
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+var epoch = time.Date(2015, 11, 20, 0, 0, 0, 0, time.UTC)
+
+// issue returns a certificate for name, signed by parent's key, or
+// self-signed if parent is nil.
+func issue(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(epoch.UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    epoch.Add(-time.Hour),
+		NotAfter:     epoch.Add(24 * time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	test.AssertNotError(t, err, "Failed to create certificate")
+	cert, err := x509.ParseCertificate(der)
+	test.AssertNotError(t, err, "Failed to parse certificate")
+	return cert, key
+}
+
+func TestToken(t *testing.T) {
+	ca, caKey := issue(t, "operator CA", nil, nil)
+	alice, aliceKey := issue(t, "alice", ca, caKey)
+	otherCA, otherCAKey := issue(t, "other CA", nil, nil)
+	mallory, malloryKey := issue(t, "mallory", otherCA, otherCAKey)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	fc := clock.NewFake()
+	fc.Set(epoch)
+	v := NewVerifier(roots, fc)
+
+	token, err := SignToken(aliceKey, alice, fc.Now(), DefaultLifetime)
+	test.AssertNotError(t, err, "Failed to sign token")
+	operator, err := v.Verify(token)
+	test.AssertNotError(t, err, "Valid token rejected")
+	test.AssertEquals(t, operator, "alice")
+
+	_, err = v.Verify("")
+	test.AssertEquals(t, err, ErrNoToken)
+
+	// Tokens expire
+	fc.Add(DefaultLifetime)
+	_, err = v.Verify(token)
+	test.AssertError(t, err, "Expired token accepted")
+	fc.Set(epoch)
+
+	// Certificates must chain to the verifier's CAs
+	token, err = SignToken(malloryKey, mallory, fc.Now(), DefaultLifetime)
+	test.AssertNotError(t, err, "Failed to sign token")
+	_, err = v.Verify(token)
+	test.AssertError(t, err, "Token from another CA accepted")
+
+	// A token must be signed by its certificate's key
+	token, err = SignToken(malloryKey, alice, fc.Now(), DefaultLifetime)
+	test.AssertNotError(t, err, "Failed to sign token")
+	_, err = v.Verify(token)
+	test.AssertError(t, err, "Token signed by the wrong key accepted")
+
+	// Its certificate can't be swapped for another
+	aliceToken, err := SignToken(aliceKey, alice, fc.Now(), DefaultLifetime)
+	test.AssertNotError(t, err, "Failed to sign token")
+	malloryToken, err := SignToken(malloryKey, mallory, fc.Now(), DefaultLifetime)
+	test.AssertNotError(t, err, "Failed to sign token")
+	spliced := strings.SplitN(aliceToken, ".", 2)[0] + "." + strings.SplitN(malloryToken, ".", 2)[1]
+	_, err = v.Verify(spliced)
+	test.AssertError(t, err, "Spliced token accepted")
+
+	// Long lived tokens are neither signed nor accepted
+	_, err = SignToken(aliceKey, alice, fc.Now(), MaxLifetime+time.Second)
+	test.AssertError(t, err, "Signed a token for longer than MaxLifetime")
+	_, err = v.Verify("garbage")
+	test.AssertError(t, err, "Malformed token accepted")
+}
@@ -0,0 +1,140 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package bdns
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
+	"github.com/letsencrypt/boulder/metrics"
+)
+
+// Cacher is implemented by resolvers that can cache their answers.
+type Cacher interface {
+	// WithCache returns a resolver whose answers are cached for as long as
+	// it's used, and no longer than their TTLs.
+	WithCache() DNSResolver
+}
+
+// WithCache returns a resolver that answers repeated lookups from a cache,
+// for their TTL: positive answers for the lowest TTL of their records, and
+// NXDOMAIN and empty answers for the negative TTL of the zone's SOA (RFC
+// 2308). Failures aren't cached. The cache is dropped with the resolver, so
+// it's meant to be used for one validation, whose CAA tree climbing and
+// challenges would otherwise repeat the same queries.
+func (dnsResolver *DNSResolverImpl) WithCache() DNSResolver {
+	return &cachingResolver{
+		resolver: dnsResolver,
+		cache:    &dnsCache{entries: make(map[cacheKey]cacheEntry)},
+	}
+}
+
+type cacheKey struct {
+	name  string
+	qtype uint16
+}
+
+type cacheEntry struct {
+	msg     *dns.Msg
+	expires time.Time
+}
+
+// dnsCache holds a caching resolver's answers, shared with the copies of it
+// returned by WithTimeout.
+type dnsCache struct {
+	mu      sync.Mutex
+	entries map[cacheKey]cacheEntry
+}
+
+type cachingResolver struct {
+	resolver *DNSResolverImpl
+	cache    *dnsCache
+}
+
+var _ DNSResolver = &cachingResolver{}
+
+func (c *cachingResolver) LookupTXT(hostname string) ([]string, error) {
+	return c.resolver.lookupTXT(hostname, c.exchangeOne)
+}
+
+func (c *cachingResolver) LookupHost(hostname string) ([]net.IP, error) {
+	return c.resolver.lookupHost(hostname, c.exchangeOne)
+}
+
+func (c *cachingResolver) LookupCAA(hostname string) ([]*dns.CAA, error) {
+	return c.resolver.lookupCAA(hostname, c.exchangeOne)
+}
+
+func (c *cachingResolver) LookupMX(hostname string) ([]string, error) {
+	return c.resolver.lookupMX(hostname, c.exchangeOne)
+}
+
+// exchangeOne answers from the cache if it can, and otherwise queries the
+// resolver and caches the answer.
+func (c *cachingResolver) exchangeOne(hostname string, qtype uint16, msgStats metrics.Scope) (*dns.Msg, error) {
+	key := cacheKey{name: strings.ToLower(dns.Fqdn(hostname)), qtype: qtype}
+	now := c.resolver.clk.Now()
+
+	c.cache.mu.Lock()
+	entry, ok := c.cache.entries[key]
+	c.cache.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		msgStats.Inc("CacheHits", 1)
+		return entry.msg, nil
+	}
+
+	msg, err := c.resolver.exchangeOne(hostname, qtype, msgStats)
+	if err != nil {
+		return nil, err
+	}
+	if ttl, ok := cacheTTL(msg); ok {
+		c.cache.mu.Lock()
+		c.cache.entries[key] = cacheEntry{msg: msg, expires: now.Add(ttl)}
+		c.cache.mu.Unlock()
+	}
+	return msg, nil
+}
+
+// cacheTTL returns how long msg may be cached for, and false if it mustn't
+// be.
+func cacheTTL(msg *dns.Msg) (time.Duration, bool) {
+	var ttl uint32
+	switch {
+	case msg.Rcode == dns.RcodeSuccess && len(msg.Answer) > 0:
+		ttl = msg.Answer[0].Header().Ttl
+		for _, rr := range msg.Answer[1:] {
+			if rr.Header().Ttl < ttl {
+				ttl = rr.Header().Ttl
+			}
+		}
+	case msg.Rcode == dns.RcodeSuccess || msg.Rcode == dns.RcodeNameError:
+		// A negative answer is cached for the lower of the SOA's TTL and
+		// its minimum field, and not at all without a SOA
+		var soa *dns.SOA
+		for _, rr := range msg.Ns {
+			if s, ok := rr.(*dns.SOA); ok {
+				soa = s
+				break
+			}
+		}
+		if soa == nil {
+			return 0, false
+		}
+		ttl = soa.Hdr.Ttl
+		if soa.Minttl < ttl {
+			ttl = soa.Minttl
+		}
+	default:
+		return 0, false
+	}
+	if ttl == 0 {
+		return 0, false
+	}
+	return time.Duration(ttl) * time.Second, true
+}
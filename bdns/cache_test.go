@@ -0,0 +1,65 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package bdns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestCache(t *testing.T) {
+	obj := NewTestDNSResolverImpl(time.Second*10, []string{dnsLoopbackAddr}, testStats)
+	fc := clock.NewFake()
+	obj.clk = fc
+	cached := obj.WithCache()
+	queries := func(qtype, rcode string) float64 {
+		return obj.metrics.queries.Value(qtype, dnsLoopbackAddr, rcode)
+	}
+
+	// Positive answers are cached for the lowest TTL of their records, and
+	// names are matched case-insensitively
+	for _, name := range []string{"ttl.letsencrypt.org", "TTL.letsencrypt.org."} {
+		addrs, err := cached.LookupHost(name)
+		test.AssertNotError(t, err, "Lookup failed")
+		test.AssertEquals(t, len(addrs), 2)
+	}
+	test.AssertEquals(t, queries("A", "NOERROR"), float64(1))
+	fc.Add(61 * time.Second)
+	_, err := cached.LookupHost("ttl.letsencrypt.org")
+	test.AssertNotError(t, err, "Lookup failed")
+	test.AssertEquals(t, queries("A", "NOERROR"), float64(2))
+
+	// Negative answers are cached for the SOA's negative TTL
+	for i := 0; i < 2; i++ {
+		_, err = cached.LookupTXT("nxdomain.letsencrypt.org")
+		test.AssertError(t, err, "NXDOMAIN lookup succeeded")
+	}
+	test.AssertEquals(t, queries("TXT", "NXDOMAIN"), float64(1))
+	fc.Add(31 * time.Second)
+	_, err = cached.LookupTXT("nxdomain.letsencrypt.org")
+	test.AssertError(t, err, "NXDOMAIN lookup succeeded")
+	test.AssertEquals(t, queries("TXT", "NXDOMAIN"), float64(2))
+
+	// Answers without a TTL, and failures, aren't cached
+	for i := 0; i < 2; i++ {
+		_, err = cached.LookupCAA("bracewel.net")
+		test.AssertNotError(t, err, "Lookup failed")
+		_, err = cached.LookupTXT("servfail.com")
+		test.AssertError(t, err, "SERVFAIL lookup succeeded")
+	}
+	test.AssertEquals(t, queries("CAA", "NOERROR"), float64(2))
+	test.AssertEquals(t, queries("TXT", "SERVFAIL"), float64(4))
+
+	// Each cache starts empty, and the resolver itself doesn't cache
+	_, err = obj.WithCache().LookupHost("ttl.letsencrypt.org")
+	test.AssertNotError(t, err, "Lookup failed")
+	_, err = obj.LookupHost("ttl.letsencrypt.org")
+	test.AssertNotError(t, err, "Lookup failed")
+	test.AssertEquals(t, queries("A", "NOERROR"), float64(4))
+}
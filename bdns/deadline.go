@@ -0,0 +1,110 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package bdns
+
+import (
+	"net"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
+)
+
+// Deadliner is implemented by resolvers whose lookups can be bounded in
+// time.
+type Deadliner interface {
+	// WithTimeout returns a resolver whose lookups give up once timeout has
+	// passed, cutting short the query in flight rather than abandoning it.
+	WithTimeout(timeout time.Duration) DNSResolver
+}
+
+// errDeadlineExceeded is returned by lookups that run past their resolver's
+// deadline. It's a timeout to ProblemDetailsFromDNSError.
+var errDeadlineExceeded = &net.OpError{Op: "read", Net: "udp", Err: deadlineError{}}
+
+type deadlineError struct{}
+
+func (deadlineError) Error() string   { return "lookup deadline exceeded" }
+func (deadlineError) Timeout() bool   { return true }
+func (deadlineError) Temporary() bool { return true }
+
+// WithTimeout returns a copy of the resolver whose lookups fail with a
+// timeout once timeout has passed. Each query's dial, write and read
+// timeouts are cut short to end by then, and servers aren't failed over to
+// after it, so nothing is left running once a lookup returns.
+func (dnsResolver *DNSResolverImpl) WithTimeout(timeout time.Duration) DNSResolver {
+	return dnsResolver.withDeadline(dnsResolver.clk.Now().Add(timeout))
+}
+
+func (dnsResolver *DNSResolverImpl) withDeadline(deadline time.Time) *DNSResolverImpl {
+	bounded := *dnsResolver
+	bounded.deadline = deadline
+	return &bounded
+}
+
+// expired reports whether the resolver's deadline, if it has one, has
+// passed.
+func (dnsResolver *DNSResolverImpl) expired() bool {
+	return !dnsResolver.deadline.IsZero() && !dnsResolver.clk.Now().Before(dnsResolver.deadline)
+}
+
+// boundTimeout returns timeout, cut short to end by the resolver's
+// deadline, or errDeadlineExceeded if that has passed.
+func (dnsResolver *DNSResolverImpl) boundTimeout(timeout time.Duration) (time.Duration, error) {
+	if dnsResolver.deadline.IsZero() {
+		return timeout, nil
+	}
+	left := dnsResolver.deadline.Sub(dnsResolver.clk.Now())
+	if left <= 0 {
+		return 0, errDeadlineExceeded
+	}
+	if timeout <= 0 || left < timeout {
+		return left, nil
+	}
+	return timeout, nil
+}
+
+// boundClient returns client, or a copy of it whose timeouts are cut short
+// to end by the resolver's deadline, or errDeadlineExceeded if that has
+// passed.
+func (dnsResolver *DNSResolverImpl) boundClient(client *dns.Client) (*dns.Client, error) {
+	if dnsResolver.deadline.IsZero() {
+		return client, nil
+	}
+	// The client's zero timeouts mean its defaults
+	timeout := func(t time.Duration) time.Duration {
+		if t == 0 {
+			return 2 * time.Second
+		}
+		return t
+	}
+	var err error
+	bounded := &dns.Client{
+		Net:            client.Net,
+		UDPSize:        client.UDPSize,
+		TsigSecret:     client.TsigSecret,
+		SingleInflight: client.SingleInflight,
+	}
+	if bounded.DialTimeout, err = dnsResolver.boundTimeout(timeout(client.DialTimeout)); err != nil {
+		return nil, err
+	}
+	if bounded.WriteTimeout, err = dnsResolver.boundTimeout(timeout(client.WriteTimeout)); err != nil {
+		return nil, err
+	}
+	if bounded.ReadTimeout, err = dnsResolver.boundTimeout(timeout(client.ReadTimeout)); err != nil {
+		return nil, err
+	}
+	return bounded, nil
+}
+
+// WithTimeout returns a copy of the caching resolver whose lookups fail with
+// a timeout once timeout has passed, as DNSResolverImpl's do. It shares the
+// cache.
+func (c *cachingResolver) WithTimeout(timeout time.Duration) DNSResolver {
+	return &cachingResolver{
+		resolver: c.resolver.withDeadline(c.resolver.clk.Now().Add(timeout)),
+		cache:    c.cache,
+	}
+}
@@ -7,12 +7,13 @@ package bdns
 
 import (
 	"fmt"
-	"math/rand"
 	"net"
 	"strings"
 	"time"
 
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
+	"github.com/letsencrypt/boulder/chaos"
 	"github.com/letsencrypt/boulder/metrics"
 )
 
@@ -122,11 +123,27 @@ type DNSResolver interface {
 	LookupMX(string) ([]string, error)
 }
 
-// DNSResolverImpl represents a client that talks to an external resolver
+// DNSResolverImpl represents a client that talks to a pool of external
+// resolvers. Queries are sent over UDP, and retried over TCP when the answer
+// is truncated. A query that fails with one server is retried with the next,
+// and a server that fails MaxFailures times in a row (default 3) is passed
+// over for DownFor (default 30 seconds), unless every other server fails
+// too. Selection picks the order servers are tried in: RoundRobin (the
+// default) or Failover. Queries are sent from Source's addresses, if set,
+// and over TLS instead of UDP and TCP if TLS is set.
 type DNSResolverImpl struct {
 	DNSClient                *dns.Client
-	Servers                  []string
+	TCPClient                *dns.Client
+	Selection                string
+	MaxFailures              int
+	DownFor                  time.Duration
+	Source                   Source
+	TLS                      *TLSTransport
+	pool                     *serverPool
+	clk                      clock.Clock
+	deadline                 time.Time
 	allowRestrictedAddresses bool
+	metrics                  *dnsMetrics
 	stats                    metrics.Scope
 	txtStats                 metrics.Scope
 	aStats                   metrics.Scope
@@ -139,16 +156,20 @@ var _ DNSResolver = &DNSResolverImpl{}
 // NewDNSResolverImpl constructs a new DNS resolver object that utilizes the
 // provided list of DNS servers for resolution.
 func NewDNSResolverImpl(readTimeout time.Duration, servers []string, stats metrics.Scope) *DNSResolverImpl {
-	dnsClient := new(dns.Client)
-
 	// Set timeout for underlying net.Conn
-	dnsClient.ReadTimeout = readTimeout
-	dnsClient.Net = "tcp"
+	dnsClient := &dns.Client{ReadTimeout: readTimeout}
+	tcpClient := &dns.Client{ReadTimeout: readTimeout, Net: "tcp"}
 
 	return &DNSResolverImpl{
 		DNSClient:                dnsClient,
-		Servers:                  servers,
+		TCPClient:                tcpClient,
+		Selection:                RoundRobin,
+		MaxFailures:              defaultMaxFailures,
+		DownFor:                  defaultDownFor,
+		pool:                     newServerPool(servers),
+		clk:                      clock.Default(),
 		allowRestrictedAddresses: false,
+		metrics:                  newDNSMetrics(),
 		stats:    stats,
 		txtStats: stats.NewScope("TXT"),
 		aStats:   stats.NewScope("A"),
@@ -166,28 +187,134 @@ func NewTestDNSResolverImpl(readTimeout time.Duration, servers []string, stats m
 	return resolver
 }
 
-// exchangeOne performs a single DNS exchange with a randomly chosen server
-// out of the server list, returning the response, time, and error (if any).
-// This method sets the DNSSEC OK bit on the message to true before sending
-// it to the resolver in case validation isn't the resolvers default behaviour.
+// DNSSECError is returned by lookups whose answers failed DNSSEC validation
+// at the resolver, as opposed to a failure of the resolver or the domain's
+// name servers.
+type DNSSECError struct {
+	Hostname string
+	Qtype    uint16
+}
+
+func (e *DNSSECError) Error() string {
+	return fmt.Sprintf("DNSSEC validation failure for %s query for %s", dns.TypeToString[e.Qtype], e.Hostname)
+}
+
+// RcodeError is returned by lookups that were answered with an error
+// response code, such as SERVFAIL or NXDOMAIN.
+type RcodeError struct {
+	Qtype uint16
+	Rcode int
+}
+
+func (e *RcodeError) Error() string {
+	return fmt.Sprintf("DNS failure: %d-%s for %s query", e.Rcode, dns.RcodeToString[e.Rcode], dns.TypeToString[e.Qtype])
+}
+
+// exchangeOne performs a DNS exchange with the first server of the pool that
+// answers, returning the response and error (if any). This method sets the
+// DNSSEC OK and AD bits on the message before sending it, so that a
+// validating resolver validates the answer and reports that it did. A
+// validating resolver answers bogus data with SERVFAIL, so a SERVFAIL is
+// retried with checking disabled on the same server: if that succeeds, the
+// failure was DNSSEC validation and a *DNSSECError is returned.
 func (dnsResolver *DNSResolverImpl) exchangeOne(hostname string, qtype uint16, msgStats metrics.Scope) (rsp *dns.Msg, err error) {
 	m := new(dns.Msg)
 	// Set question type
 	m.SetQuestion(dns.Fqdn(hostname), qtype)
 	// Set DNSSEC OK bit for resolver
 	m.SetEdns0(4096, true)
+	m.AuthenticatedData = true
 
-	if len(dnsResolver.Servers) < 1 {
+	servers := dnsResolver.pool.order(dnsResolver.Selection, dnsResolver.clk.Now())
+	if len(servers) < 1 {
 		err = fmt.Errorf("Not configured with at least one DNS Server")
 		return
 	}
 
 	dnsResolver.stats.Inc("Rate", 1)
 
-	// Randomly pick a server
-	chosenServer := dnsResolver.Servers[rand.Intn(len(dnsResolver.Servers))]
+	for i, server := range servers {
+		if i > 0 {
+			dnsResolver.stats.Inc("Failovers", 1)
+			dnsResolver.metrics.retry(qtype, retryFailover)
+		}
+		var msg *dns.Msg
+		msg, err = dnsResolver.exchange(m, server.addr, msgStats)
+		if err != nil && dnsResolver.expired() {
+			// Cut short by the deadline, which isn't the server's failure
+			return nil, errDeadlineExceeded
+		}
+		if dnsResolver.pool.report(server, err, dnsResolver.maxFailures(), dnsResolver.downFor(), dnsResolver.clk.Now()) {
+			dnsResolver.stats.Inc("ServersMarkedDown", 1)
+		}
+		if err != nil {
+			continue
+		}
+		if msg.Rcode != dns.RcodeServerFailure {
+			return msg, nil
+		}
+
+		checked := *m
+		checked.CheckingDisabled = true
+		dnsResolver.metrics.retry(qtype, retryDNSSEC)
+		unchecked, err := dnsResolver.exchange(&checked, server.addr, msgStats)
+		if err == nil && unchecked.Rcode != dns.RcodeServerFailure {
+			msgStats.Inc("DNSSECFailures", 1)
+			return nil, &DNSSECError{Hostname: hostname, Qtype: qtype}
+		}
+		// An ordinary failure; report the original response
+		return msg, nil
+	}
+	return nil, err
+}
+
+func (dnsResolver *DNSResolverImpl) maxFailures() int {
+	if dnsResolver.MaxFailures <= 0 {
+		return defaultMaxFailures
+	}
+	return dnsResolver.MaxFailures
+}
 
-	msg, rtt, err := dnsResolver.DNSClient.Exchange(m, chosenServer)
+func (dnsResolver *DNSResolverImpl) downFor() time.Duration {
+	if dnsResolver.DownFor <= 0 {
+		return defaultDownFor
+	}
+	return dnsResolver.DownFor
+}
+
+// exchange sends m to server over UDP, retrying over TCP if the answer is
+// truncated, or over TLS if the resolver is configured for it.
+func (dnsResolver *DNSResolverImpl) exchange(m *dns.Msg, server string, msgStats metrics.Scope) (*dns.Msg, error) {
+	qtype := m.Question[0].Qtype
+	client, err := dnsResolver.boundClient(dnsResolver.DNSClient)
+	if err != nil {
+		return nil, err
+	}
+	var msg *dns.Msg
+	var rtt time.Duration
+	err = chaos.Inject(fmt.Sprintf("dns.%s", dns.TypeToString[qtype]))
+	if err == chaos.ErrDropped {
+		// A lost query fails once the answer is given up on
+		time.Sleep(client.ReadTimeout)
+		rtt = client.ReadTimeout
+	}
+	if err == nil && dnsResolver.TLS != nil {
+		var timeout time.Duration
+		if timeout, err = dnsResolver.boundTimeout(dnsResolver.TLS.timeout()); err == nil {
+			msg, rtt, err = dnsResolver.TLS.exchange(m, server, dnsResolver.Source, timeout)
+		}
+	} else if err == nil {
+		msg, rtt, err = dnsResolver.Source.exchangeFrom(client, m, server)
+	}
+	dnsResolver.metrics.observe(qtype, server, msg, rtt, err)
+	if dnsResolver.TLS == nil && (err == dns.ErrTruncated || (err == nil && msg.Truncated)) {
+		msgStats.Inc("Truncated", 1)
+		dnsResolver.metrics.retry(qtype, retryTruncated)
+		if client, err = dnsResolver.boundClient(dnsResolver.TCPClient); err == nil {
+			msg, rtt, err = dnsResolver.Source.exchangeFrom(client, m, server)
+			dnsResolver.metrics.observe(qtype, server, msg, rtt, err)
+		}
+	}
 	msgStats.TimingDuration("RTT", rtt)
 	if err == nil {
 		msgStats.Inc("Successes", 1)
@@ -197,16 +324,23 @@ func (dnsResolver *DNSResolverImpl) exchangeOne(hostname string, qtype uint16, m
 	return msg, err
 }
 
+// exchanger sends a query, as exchangeOne does.
+type exchanger func(hostname string, qtype uint16, msgStats metrics.Scope) (*dns.Msg, error)
+
 // LookupTXT sends a DNS query to find all TXT records associated with
 // the provided hostname.
 func (dnsResolver *DNSResolverImpl) LookupTXT(hostname string) ([]string, error) {
+	return dnsResolver.lookupTXT(hostname, dnsResolver.exchangeOne)
+}
+
+func (dnsResolver *DNSResolverImpl) lookupTXT(hostname string, exchange exchanger) ([]string, error) {
 	var txt []string
-	r, err := dnsResolver.exchangeOne(hostname, dns.TypeTXT, dnsResolver.txtStats)
+	r, err := exchange(hostname, dns.TypeTXT, dnsResolver.txtStats)
 	if err != nil {
 		return nil, err
 	}
 	if r.Rcode != dns.RcodeSuccess {
-		err = fmt.Errorf("DNS failure: %d-%s for TXT query", r.Rcode, dns.RcodeToString[r.Rcode])
+		err = &RcodeError{Qtype: dns.TypeTXT, Rcode: r.Rcode}
 		return nil, err
 	}
 
@@ -234,14 +368,18 @@ func isPrivateV4(ip net.IP) bool {
 // hostname. This method assumes that the external resolver will chase CNAME/DNAME
 // aliases and return relevant A records.
 func (dnsResolver *DNSResolverImpl) LookupHost(hostname string) ([]net.IP, error) {
+	return dnsResolver.lookupHost(hostname, dnsResolver.exchangeOne)
+}
+
+func (dnsResolver *DNSResolverImpl) lookupHost(hostname string, exchange exchanger) ([]net.IP, error) {
 	var addrs []net.IP
 
-	r, err := dnsResolver.exchangeOne(hostname, dns.TypeA, dnsResolver.aStats)
+	r, err := exchange(hostname, dns.TypeA, dnsResolver.aStats)
 	if err != nil {
 		return addrs, err
 	}
 	if r.Rcode != dns.RcodeSuccess {
-		err = fmt.Errorf("DNS failure: %d-%s for A query", r.Rcode, dns.RcodeToString[r.Rcode])
+		err = &RcodeError{Qtype: dns.TypeA, Rcode: r.Rcode}
 		return nil, err
 	}
 
@@ -258,15 +396,19 @@ func (dnsResolver *DNSResolverImpl) LookupHost(hostname string) ([]net.IP, error
 
 // LookupCAA sends a DNS query to find all CAA records associated with
 // the provided hostname. If the response code from the resolver is
-// SERVFAIL an empty slice of CAA records is returned.
+// SERVFAIL an empty slice of CAA records is returned, unless the failure
+// was DNSSEC validation, which is an error.
 func (dnsResolver *DNSResolverImpl) LookupCAA(hostname string) ([]*dns.CAA, error) {
-	r, err := dnsResolver.exchangeOne(hostname, dns.TypeCAA, dnsResolver.caaStats)
+	return dnsResolver.lookupCAA(hostname, dnsResolver.exchangeOne)
+}
+
+func (dnsResolver *DNSResolverImpl) lookupCAA(hostname string, exchange exchanger) ([]*dns.CAA, error) {
+	r, err := exchange(hostname, dns.TypeCAA, dnsResolver.caaStats)
 	if err != nil {
 		return nil, err
 	}
 
-	// On resolver validation failure, or other server failures, return empty an
-	// set and no error.
+	// On other server failures, return an empty set and no error.
 	var CAAs []*dns.CAA
 	if r.Rcode == dns.RcodeServerFailure {
 		return CAAs, nil
@@ -285,12 +427,16 @@ func (dnsResolver *DNSResolverImpl) LookupCAA(hostname string) ([]*dns.CAA, erro
 // LookupMX sends a DNS query to find a MX record associated hostname and returns the
 // record target.
 func (dnsResolver *DNSResolverImpl) LookupMX(hostname string) ([]string, error) {
-	r, err := dnsResolver.exchangeOne(hostname, dns.TypeMX, dnsResolver.mxStats)
+	return dnsResolver.lookupMX(hostname, dnsResolver.exchangeOne)
+}
+
+func (dnsResolver *DNSResolverImpl) lookupMX(hostname string, exchange exchanger) ([]string, error) {
+	r, err := exchange(hostname, dns.TypeMX, dnsResolver.mxStats)
 	if err != nil {
 		return nil, err
 	}
 	if r.Rcode != dns.RcodeSuccess {
-		err = fmt.Errorf("DNS failure: %d-%s for MX query", r.Rcode, dns.RcodeToString[r.Rcode])
+		err = &RcodeError{Qtype: dns.TypeMX, Rcode: r.Rcode}
 		return nil, err
 	}
 
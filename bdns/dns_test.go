@@ -15,6 +15,7 @@ import (
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
+	"github.com/letsencrypt/boulder/chaos"
 	"github.com/letsencrypt/boulder/metrics"
 	"github.com/letsencrypt/boulder/test"
 )
@@ -31,10 +32,32 @@ func mockDNSQuery(w dns.ResponseWriter, r *dns.Msg) {
 	}
 	for _, q := range r.Question {
 		q.Name = strings.ToLower(q.Name)
+		// Answers too big for UDP are truncated, so must be asked over TCP
+		if q.Name == "truncated.letsencrypt.org." && w.RemoteAddr().Network() == "udp" {
+			m.Truncated = true
+			break
+		}
 		if q.Name == "servfail.com." {
 			m.Rcode = dns.RcodeServerFailure
 			break
 		}
+		if q.Name == "nxdomain.letsencrypt.org." {
+			m.Rcode = dns.RcodeNameError
+			record := new(dns.SOA)
+			record.Hdr = dns.RR_Header{Name: "letsencrypt.org.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 60}
+			record.Ns = "ns.letsencrypt.org."
+			record.Mbox = "master.letsencrypt.org."
+			record.Serial = 1
+			record.Minttl = 30
+			m.Ns = append(m.Ns, record)
+			break
+		}
+		// A validating resolver fails bogus answers unless checking is
+		// disabled
+		if q.Name == "bogus.letsencrypt.org." && !r.CheckingDisabled {
+			m.Rcode = dns.RcodeServerFailure
+			break
+		}
 		switch q.Qtype {
 		case dns.TypeSOA:
 			record := new(dns.SOA)
@@ -55,12 +78,20 @@ func mockDNSQuery(w dns.ResponseWriter, r *dns.Msg) {
 				appendAnswer(record)
 			}
 		case dns.TypeA:
-			if q.Name == "cps.letsencrypt.org." {
+			if q.Name == "cps.letsencrypt.org." || q.Name == "truncated.letsencrypt.org." {
 				record := new(dns.A)
 				record.Hdr = dns.RR_Header{Name: "cps.letsencrypt.org.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 0}
 				record.A = net.ParseIP("127.0.0.1")
 				appendAnswer(record)
 			}
+			if q.Name == "ttl.letsencrypt.org." {
+				for _, ttl := range []uint32{300, 60} {
+					record := new(dns.A)
+					record.Hdr = dns.RR_Header{Name: "ttl.letsencrypt.org.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl}
+					record.A = net.ParseIP("127.0.0.1")
+					appendAnswer(record)
+				}
+			}
 		case dns.TypeCNAME:
 			if q.Name == "cname.letsencrypt.org." {
 				record := new(dns.CNAME)
@@ -114,21 +145,33 @@ func mockDNSQuery(w dns.ResponseWriter, r *dns.Msg) {
 
 func serveLoopResolver(stopChan chan bool) chan bool {
 	dns.HandleFunc(".", mockDNSQuery)
-	server := &dns.Server{Addr: dnsLoopbackAddr, Net: "tcp", ReadTimeout: time.Millisecond, WriteTimeout: time.Millisecond}
 	waitChan := make(chan bool, 1)
-	go func() {
-		waitChan <- true
-		err := server.ListenAndServe()
-		if err != nil {
-			fmt.Println(err)
-			return
+	var servers []*dns.Server
+	for _, network := range []string{"udp", "tcp"} {
+		server := &dns.Server{Addr: dnsLoopbackAddr, Net: network, ReadTimeout: time.Millisecond, WriteTimeout: time.Millisecond}
+		servers = append(servers, server)
+		started := make(chan bool)
+		server.NotifyStartedFunc = func() { close(started) }
+		go func() {
+			err := server.ListenAndServe()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+		}()
+		select {
+		case <-started:
+		case <-time.After(time.Second):
 		}
-	}()
+	}
+	waitChan <- true
 	go func() {
 		<-stopChan
-		err := server.Shutdown()
-		if err != nil {
-			fmt.Println(err)
+		for _, server := range servers {
+			err := server.Shutdown()
+			if err != nil {
+				fmt.Println(err)
+			}
 		}
 	}()
 	return waitChan
@@ -166,6 +209,48 @@ func TestDNSOneServer(t *testing.T) {
 	test.AssertNotError(t, err, "No message")
 }
 
+func TestDNSChaos(t *testing.T) {
+	chaos.Enable()
+	defer chaos.Reset()
+	obj := NewTestDNSResolverImpl(time.Millisecond*10, []string{dnsLoopbackAddr}, testStats)
+
+	chaos.Set("dns.A", chaos.Fault{Error: "boom", Count: 1})
+	_, err := obj.LookupHost("letsencrypt.org")
+	test.AssertError(t, err, "Injected error ignored")
+
+	// Dropped queries time out
+	chaos.Set("dns.A", chaos.Fault{Drop: true, Count: 1})
+	_, err = obj.LookupHost("letsencrypt.org")
+	netErr, ok := err.(net.Error)
+	test.Assert(t, ok && netErr.Timeout(), "Dropped query didn't time out")
+
+	_, err = obj.LookupHost("letsencrypt.org")
+	test.AssertNotError(t, err, "Lookup failed after the faults cleared")
+}
+
+func TestDNSWithTimeout(t *testing.T) {
+	chaos.Enable()
+	defer chaos.Reset()
+	obj := NewTestDNSResolverImpl(time.Second*10, []string{dnsLoopbackAddr}, testStats)
+
+	// A dropped query is given up on at the deadline, not after the
+	// resolver's read timeout, and doesn't count against the server
+	chaos.Set("dns.TXT", chaos.Fault{Drop: true, Count: 1})
+	start := time.Now()
+	_, err := obj.WithTimeout(50 * time.Millisecond).LookupTXT("letsencrypt.org")
+	netErr, ok := err.(net.Error)
+	test.Assert(t, ok && netErr.Timeout(), "Lookup past its deadline didn't time out")
+	test.Assert(t, time.Since(start) < time.Second, "Lookup outlasted its deadline")
+	test.AssertEquals(t, obj.pool.servers[0].failures, 0)
+
+	// Nothing is sent once the deadline has passed
+	_, err = obj.WithTimeout(0).LookupTXT("letsencrypt.org")
+	test.AssertEquals(t, err, error(errDeadlineExceeded))
+
+	_, err = obj.WithTimeout(time.Second).LookupTXT("letsencrypt.org")
+	test.AssertNotError(t, err, "Lookup within its deadline failed")
+}
+
 func TestDNSDuplicateServers(t *testing.T) {
 	obj := NewTestDNSResolverImpl(time.Second*10, []string{dnsLoopbackAddr, dnsLoopbackAddr}, testStats)
 
@@ -204,6 +289,26 @@ func TestDNSServFail(t *testing.T) {
 	test.AssertNotError(t, err, "LookupCAA returned an error")
 }
 
+func TestDNSSECFailure(t *testing.T) {
+	obj := NewTestDNSResolverImpl(time.Second*10, []string{dnsLoopbackAddr}, testStats)
+	bogus := "bogus.letsencrypt.org"
+
+	_, err := obj.LookupTXT(bogus)
+	test.AssertError(t, err, "LookupTXT didn't return an error")
+	_, ok := err.(*DNSSECError)
+	test.Assert(t, ok, fmt.Sprintf("LookupTXT returned %#v, not a DNSSECError", err))
+	test.AssertEquals(t, err.Error(), "DNSSEC validation failure for TXT query for bogus.letsencrypt.org")
+
+	_, err = obj.LookupHost(bogus)
+	_, ok = err.(*DNSSECError)
+	test.Assert(t, ok, fmt.Sprintf("LookupHost returned %#v, not a DNSSECError", err))
+
+	// Unlike other server failures, a bogus CAA answer is an error
+	_, err = obj.LookupCAA(bogus)
+	_, ok = err.(*DNSSECError)
+	test.Assert(t, ok, fmt.Sprintf("LookupCAA returned %#v, not a DNSSECError", err))
+}
+
 func TestDNSLookupTXT(t *testing.T) {
 	obj := NewTestDNSResolverImpl(time.Second*10, []string{dnsLoopbackAddr}, testStats)
 
@@ -263,3 +368,50 @@ func TestDNSLookupCAA(t *testing.T) {
 	test.AssertNotError(t, err, "CAA lookup failed")
 	test.Assert(t, len(caas) > 0, "Should follow CNAME to find CAA")
 }
+
+func TestDNSTruncatedRetry(t *testing.T) {
+	obj := NewTestDNSResolverImpl(time.Second*10, []string{dnsLoopbackAddr}, testStats)
+
+	ip, err := obj.LookupHost("truncated.letsencrypt.org")
+	test.AssertNotError(t, err, "Truncated answer wasn't retried over TCP")
+	test.AssertEquals(t, len(ip), 1)
+}
+
+func TestDNSFailover(t *testing.T) {
+	// Nothing listens on the first server
+	deadAddr := "127.0.0.1:1"
+	obj := NewTestDNSResolverImpl(time.Second, []string{deadAddr, dnsLoopbackAddr}, testStats)
+	obj.Selection = Failover
+	obj.MaxFailures = 2
+
+	for i := 0; i < 3; i++ {
+		ip, err := obj.LookupHost("cps.letsencrypt.org")
+		test.AssertNotError(t, err, "Lookup didn't fail over to the working server")
+		test.AssertEquals(t, len(ip), 1)
+	}
+	// After two failures the dead server is tried last
+	servers := obj.pool.order(obj.Selection, obj.clk.Now())
+	test.AssertEquals(t, servers[0].addr, dnsLoopbackAddr)
+
+	obj = NewTestDNSResolverImpl(time.Second, []string{deadAddr}, testStats)
+	_, err := obj.LookupHost("cps.letsencrypt.org")
+	test.AssertError(t, err, "Lookup with no working servers succeeded")
+}
+
+func TestDNSMetrics(t *testing.T) {
+	obj := NewTestDNSResolverImpl(time.Second*10, []string{dnsLoopbackAddr}, testStats)
+
+	_, err := obj.LookupHost("cps.letsencrypt.org")
+	test.AssertNotError(t, err, "Lookup failed")
+	_, err = obj.LookupTXT("servfail.com")
+	test.AssertError(t, err, "SERVFAIL lookup succeeded")
+	_, err = obj.LookupHost("truncated.letsencrypt.org")
+	test.AssertNotError(t, err, "Lookup failed")
+
+	m := obj.metrics
+	test.AssertEquals(t, m.queries.Value("A", dnsLoopbackAddr, "NOERROR"), float64(3))
+	test.AssertEquals(t, m.queries.Value("TXT", dnsLoopbackAddr, "SERVFAIL"), float64(2))
+	test.AssertEquals(t, m.retries.Value("TXT", retryDNSSEC), float64(1))
+	test.AssertEquals(t, m.retries.Value("A", retryTruncated), float64(1))
+	test.AssertEquals(t, m.latency.Count("A", dnsLoopbackAddr), uint64(3))
+}
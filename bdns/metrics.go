@@ -0,0 +1,76 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package bdns
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
+	"github.com/letsencrypt/boulder/metrics"
+)
+
+// Reasons a query is sent again
+const (
+	retryTruncated = "truncated" // over TCP, after a truncated UDP answer
+	retryFailover  = "failover"  // to the next server, after a failure
+	retryDNSSEC    = "dnssec"    // with checking disabled, after a SERVFAIL
+)
+
+// dnsMetrics are the per-resolver query metrics a DNSResolverImpl exposes to
+// Prometheus, so that a degrading resolver shows up before validations start
+// failing.
+type dnsMetrics struct {
+	registry *metrics.Registry
+	queries  *metrics.CounterVec
+	latency  *metrics.HistogramVec
+	retries  *metrics.CounterVec
+	timeouts *metrics.CounterVec
+}
+
+func newDNSMetrics() *dnsMetrics {
+	r := metrics.NewRegistry()
+	return &dnsMetrics{
+		registry: r,
+		queries: r.NewCounterVec("dns_queries_total",
+			`Queries sent, by query type, resolver and response code ("error" if there was no response).`,
+			"qtype", "resolver", "rcode"),
+		latency: r.NewHistogramVec("dns_query_duration_seconds",
+			"Time taken to answer queries, by query type and resolver.",
+			metrics.DefaultLatencyBuckets, "qtype", "resolver"),
+		retries: r.NewCounterVec("dns_retries_total",
+			"Queries sent again, by query type and reason.",
+			"qtype", "reason"),
+		timeouts: r.NewCounterVec("dns_timeouts_total",
+			"Queries that timed out, by query type and resolver.",
+			"qtype", "resolver"),
+	}
+}
+
+// observe records the outcome of an exchange of a qtype query with resolver.
+func (m *dnsMetrics) observe(qtype uint16, resolver string, msg *dns.Msg, rtt time.Duration, err error) {
+	qt := dns.TypeToString[qtype]
+	rcode := "error"
+	if msg != nil {
+		rcode = dns.RcodeToString[msg.Rcode]
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		m.timeouts.Inc(qt, resolver)
+	}
+	m.queries.Inc(qt, resolver, rcode)
+	m.latency.Observe(rtt.Seconds(), qt, resolver)
+}
+
+func (m *dnsMetrics) retry(qtype uint16, reason string) {
+	m.retries.Inc(dns.TypeToString[qtype], reason)
+}
+
+// MetricsHandler serves the resolver's query metrics in the Prometheus text
+// format.
+func (dnsResolver *DNSResolverImpl) MetricsHandler() http.Handler {
+	return dnsResolver.metrics.registry
+}
@@ -0,0 +1,97 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package bdns
+
+import (
+	"sync"
+	"time"
+)
+
+// Selection policies for choosing among a resolver's upstream servers
+const (
+	// RoundRobin spreads queries across the healthy servers in turn
+	RoundRobin = "round-robin"
+	// Failover sends queries to the first healthy server, in the configured
+	// order, so that the others are only used while it is down
+	Failover = "failover"
+)
+
+const (
+	defaultMaxFailures = 3
+	defaultDownFor     = 30 * time.Second
+)
+
+// upstream is one of the servers in a pool, with its health.
+type upstream struct {
+	addr string
+	// Consecutive failed exchanges
+	failures int
+	// While down, the server is only tried once every other server has
+	// failed
+	downUntil time.Time
+}
+
+// serverPool tracks the health of a resolver's upstream servers and orders
+// them for each query.
+type serverPool struct {
+	mu      sync.Mutex
+	servers []*upstream
+	next    int
+}
+
+func newServerPool(addrs []string) *serverPool {
+	p := &serverPool{}
+	for _, addr := range addrs {
+		p.servers = append(p.servers, &upstream{addr: addr})
+	}
+	return p
+}
+
+// order returns the servers in the order a query should try them: the
+// healthy ones first, starting with the next in turn for RoundRobin or with
+// the first configured for Failover, then those that are down.
+func (p *serverPool) order(selection string, now time.Time) []*upstream {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := len(p.servers)
+	start := 0
+	if selection != Failover && n > 0 {
+		start = p.next % n
+		p.next++
+	}
+	var healthy, down []*upstream
+	for i := 0; i < n; i++ {
+		s := p.servers[(start+i)%n]
+		if now.Before(s.downUntil) {
+			down = append(down, s)
+		} else {
+			healthy = append(healthy, s)
+		}
+	}
+	return append(healthy, down...)
+}
+
+// report records the outcome of an exchange with s. After maxFailures
+// consecutive failures s is marked down for downFor, and report returns
+// true.
+func (p *serverPool) report(s *upstream, err error, maxFailures int, downFor time.Duration, now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err == nil {
+		s.failures = 0
+		s.downUntil = time.Time{}
+		return false
+	}
+	s.failures++
+	if s.failures >= maxFailures {
+		s.failures = 0
+		s.downUntil = now.Add(downFor)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package bdns
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+func addrs(servers []*upstream) []string {
+	var a []string
+	for _, s := range servers {
+		a = append(a, s.addr)
+	}
+	return a
+}
+
+func TestServerPool(t *testing.T) {
+	now := time.Now()
+	p := newServerPool([]string{"a", "b", "c"})
+
+	// Round robin starts each query with the next server
+	test.AssertDeepEquals(t, addrs(p.order(RoundRobin, now)), []string{"a", "b", "c"})
+	test.AssertDeepEquals(t, addrs(p.order(RoundRobin, now)), []string{"b", "c", "a"})
+	// Failover always starts with the first
+	test.AssertDeepEquals(t, addrs(p.order(Failover, now)), []string{"a", "b", "c"})
+
+	// Consecutive failures mark a server down, and it's tried last
+	a := p.servers[0]
+	failure := errors.New("timeout")
+	test.Assert(t, !p.report(a, failure, 2, time.Minute, now), "Marked down after one failure")
+	test.Assert(t, !p.report(a, nil, 2, time.Minute, now), "Success marked down")
+	test.Assert(t, !p.report(a, failure, 2, time.Minute, now), "Success didn't reset failures")
+	test.Assert(t, p.report(a, failure, 2, time.Minute, now), "Not marked down after two failures")
+	test.AssertDeepEquals(t, addrs(p.order(Failover, now)), []string{"b", "c", "a"})
+
+	// Until it comes back up
+	test.AssertDeepEquals(t, addrs(p.order(Failover, now.Add(time.Minute))), []string{"a", "b", "c"})
+}
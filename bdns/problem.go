@@ -6,8 +6,10 @@
 package bdns
 
 import (
+	"fmt"
 	"net"
 
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
 	"github.com/letsencrypt/boulder/probs"
 )
 
@@ -16,18 +18,26 @@ const detailDNSNetFailure = "DNS networking error"
 const detailServerFailure = "Server failure at resolver"
 
 // ProblemDetailsFromDNSError checks the error returned from Lookup...
-// methods and tests if the error was an underlying net.OpError or an error
-// caused by resolver returning SERVFAIL or other invalid Rcodes and returns
-// the relevant core.ProblemDetails.
+// methods and tests if the error was a DNSSEC validation failure, an
+// underlying net.OpError or an error caused by resolver returning SERVFAIL or
+// other invalid Rcodes and returns the relevant core.ProblemDetails. Network
+// failures and SERVFAIL answers are marked Transient.
 func ProblemDetailsFromDNSError(err error) *probs.ProblemDetails {
+	if dnssecErr, ok := err.(*DNSSECError); ok {
+		return probs.DNSSEC(dnssecErr.Error())
+	}
 	problem := &probs.ProblemDetails{Type: probs.ConnectionProblem}
 	if netErr, ok := err.(*net.OpError); ok {
+		problem.Transient = true
 		if netErr.Timeout() {
 			problem.Detail = detailDNSTimeout
 		} else {
 			problem.Detail = detailDNSNetFailure
 		}
+	} else if rcodeErr, ok := err.(*RcodeError); ok && rcodeErr.Rcode != dns.RcodeServerFailure {
+		problem.Detail = fmt.Sprintf("DNS problem: %s looking up %s", dns.RcodeToString[rcodeErr.Rcode], dns.TypeToString[rcodeErr.Qtype])
 	} else {
+		_, problem.Transient = err.(*RcodeError)
 		problem.Detail = detailServerFailure
 	}
 	return problem
@@ -10,6 +10,7 @@ import (
 	"net"
 	"testing"
 
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
 	"github.com/letsencrypt/boulder/mocks"
 	"github.com/letsencrypt/boulder/probs"
 )
@@ -28,6 +29,12 @@ func TestProblemDetailsFromDNSError(t *testing.T) {
 		}, {
 			&net.OpError{Err: errors.New("some net error")},
 			detailDNSNetFailure,
+		}, {
+			&RcodeError{Qtype: dns.TypeA, Rcode: dns.RcodeServerFailure},
+			detailServerFailure,
+		}, {
+			&RcodeError{Qtype: dns.TypeTXT, Rcode: dns.RcodeNameError},
+			"DNS problem: NXDOMAIN looking up TXT",
 		},
 	}
 	for _, tc := range testCases {
@@ -40,3 +47,36 @@ func TestProblemDetailsFromDNSError(t *testing.T) {
 		}
 	}
 }
+
+func TestProblemDetailsFromDNSSECError(t *testing.T) {
+	err := &DNSSECError{Hostname: "example.com", Qtype: dns.TypeCAA}
+	prob := ProblemDetailsFromDNSError(err)
+	if prob.Type != probs.DNSSECProblem {
+		t.Errorf("ProblemDetailsFromDNSError(%q).Type = %q, expected %q", err, prob.Type, probs.DNSSECProblem)
+	}
+	if prob.Detail != "DNSSEC validation failure for CAA query for example.com" {
+		t.Errorf("ProblemDetailsFromDNSError(%q).Detail = %q", err, prob.Detail)
+	}
+}
+
+func TestProblemDetailsTransient(t *testing.T) {
+	transient := []error{
+		mocks.TimeoutError(),
+		&net.OpError{Err: errors.New("some net error")},
+		&RcodeError{Qtype: dns.TypeA, Rcode: dns.RcodeServerFailure},
+	}
+	for _, err := range transient {
+		if !ProblemDetailsFromDNSError(err).Transient {
+			t.Errorf("Problem for %q should be transient", err)
+		}
+	}
+	permanent := []error{
+		&RcodeError{Qtype: dns.TypeA, Rcode: dns.RcodeNameError},
+		&DNSSECError{Hostname: "example.com", Qtype: dns.TypeA},
+	}
+	for _, err := range permanent {
+		if ProblemDetailsFromDNSError(err).Transient {
+			t.Errorf("Problem for %q shouldn't be transient", err)
+		}
+	}
+}
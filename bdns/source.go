@@ -0,0 +1,144 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package bdns
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
+)
+
+// Source pins outbound connections to local source addresses, one per
+// address family, so that they leave through dedicated, allowlisted IPs. A
+// nil address leaves the choice of source for that family to the OS.
+type Source struct {
+	IPv4 net.IP
+	IPv6 net.IP
+}
+
+// ParseSource constructs a Source from an IPv4 and an IPv6 setting, each of
+// which is empty, an address of that family, or the name of an interface
+// whose first address of that family is used.
+func ParseSource(ipv4, ipv6 string) (Source, error) {
+	var s Source
+	var err error
+	if s.IPv4, err = parseSourceAddr(ipv4, false); err != nil {
+		return Source{}, err
+	}
+	if s.IPv6, err = parseSourceAddr(ipv6, true); err != nil {
+		return Source{}, err
+	}
+	return s, nil
+}
+
+func isIPv6(ip net.IP) bool {
+	return ip.To4() == nil && len(ip) == net.IPv6len
+}
+
+func parseSourceAddr(value string, v6 bool) (net.IP, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if ip := net.ParseIP(value); ip != nil {
+		if isIPv6(ip) != v6 {
+			return nil, fmt.Errorf("Source address %s is of the wrong address family", value)
+		}
+		return ip, nil
+	}
+
+	iface, err := net.InterfaceByName(value)
+	if err != nil {
+		return nil, fmt.Errorf("Source %q is neither an address nor an interface: %s", value, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't get the addresses of interface %s: %s", value, err)
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		// Link-local addresses can't be used without a zone
+		if !ok || isIPv6(ipNet.IP) != v6 || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		return ipNet.IP, nil
+	}
+	return nil, fmt.Errorf("Interface %s has no usable address of the right family", value)
+}
+
+// For returns the source address for connections to remote, or nil if the
+// OS should choose. Remotes that aren't addresses, i.e. host names, use the
+// IPv4 source if there is one.
+func (s Source) For(remote net.IP) net.IP {
+	if isIPv6(remote) || (remote == nil && s.IPv4 == nil) {
+		return s.IPv6
+	}
+	return s.IPv4
+}
+
+// Dialer returns a dialer with timeout for connections over network to
+// remote, bound to the source address for remote.
+func (s Source) Dialer(network string, remote net.IP, timeout time.Duration) *net.Dialer {
+	d := &net.Dialer{Timeout: timeout}
+	local := s.For(remote)
+	if local == nil {
+		return d
+	}
+	switch network {
+	case "udp", "udp4", "udp6":
+		d.LocalAddr = &net.UDPAddr{IP: local}
+	default:
+		d.LocalAddr = &net.TCPAddr{IP: local}
+	}
+	return d
+}
+
+// exchangeFrom sends m to server with client, bound to s's source address
+// for server. dns.Client can't bind its connections, so when there is a
+// source address the exchange is made here, over a connection dialed
+// ourselves.
+func (s Source) exchangeFrom(client *dns.Client, m *dns.Msg, server string) (*dns.Msg, time.Duration, error) {
+	var remote net.IP
+	if host, _, err := net.SplitHostPort(server); err == nil {
+		remote = net.ParseIP(host)
+	}
+	if s.For(remote) == nil {
+		return client.Exchange(m, server)
+	}
+
+	network := client.Net
+	if network == "" {
+		network = "udp"
+	}
+	timeout := func(t time.Duration) time.Duration {
+		if t == 0 {
+			return 2 * time.Second
+		}
+		return t
+	}
+	conn, err := s.Dialer(network, remote, timeout(client.DialTimeout)).Dial(network, server)
+	if err != nil {
+		return nil, 0, err
+	}
+	co := &dns.Conn{Conn: conn}
+	defer co.Close()
+	if opt := m.IsEdns0(); opt != nil && opt.UDPSize() >= dns.MinMsgSize {
+		co.UDPSize = opt.UDPSize()
+	}
+
+	start := time.Now()
+	co.SetWriteDeadline(start.Add(timeout(client.WriteTimeout)))
+	if err = co.WriteMsg(m); err != nil {
+		return nil, 0, err
+	}
+	co.SetReadDeadline(time.Now().Add(timeout(client.ReadTimeout)))
+	r, err := co.ReadMsg()
+	if err == nil && r.Id != m.Id {
+		err = dns.ErrId
+	}
+	return r, time.Since(start), err
+}
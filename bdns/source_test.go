@@ -0,0 +1,83 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package bdns
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+func loopbackInterface(t *testing.T) string {
+	ifaces, err := net.Interfaces()
+	test.AssertNotError(t, err, "Couldn't list interfaces")
+	for _, iface := range ifaces {
+		addrs, _ := iface.Addrs()
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(net.IPv4(127, 0, 0, 1)) {
+				return iface.Name
+			}
+		}
+	}
+	t.Skip("No interface has 127.0.0.1")
+	return ""
+}
+
+func TestParseSource(t *testing.T) {
+	s, err := ParseSource("", "")
+	test.AssertNotError(t, err, "Empty source should be valid")
+	test.Assert(t, s.IPv4 == nil && s.IPv6 == nil, "Empty source should leave the source to the OS")
+
+	s, err = ParseSource("192.0.2.1", "2001:db8::1")
+	test.AssertNotError(t, err, "Failed to parse source addresses")
+	test.Assert(t, s.IPv4.Equal(net.ParseIP("192.0.2.1")), "Wrong IPv4 source")
+	test.Assert(t, s.IPv6.Equal(net.ParseIP("2001:db8::1")), "Wrong IPv6 source")
+
+	_, err = ParseSource("2001:db8::1", "")
+	test.AssertError(t, err, "IPv6 address accepted as IPv4 source")
+	_, err = ParseSource("", "192.0.2.1")
+	test.AssertError(t, err, "IPv4 address accepted as IPv6 source")
+	_, err = ParseSource("no-such-interface0", "")
+	test.AssertError(t, err, "Unknown interface accepted")
+
+	s, err = ParseSource(loopbackInterface(t), "")
+	test.AssertNotError(t, err, "Failed to take source from interface")
+	test.Assert(t, s.IPv4.Equal(net.IPv4(127, 0, 0, 1)), "Wrong source taken from interface")
+}
+
+func TestSourceFor(t *testing.T) {
+	v4, v6 := net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")
+	s := Source{IPv4: v4, IPv6: v6}
+	test.Assert(t, s.For(net.ParseIP("8.8.8.8")).Equal(v4), "IPv4 remote should use IPv4 source")
+	test.Assert(t, s.For(net.ParseIP("2001:4860:4860::8888")).Equal(v6), "IPv6 remote should use IPv6 source")
+	test.Assert(t, s.For(nil).Equal(v4), "Host name remote should use IPv4 source")
+	test.Assert(t, Source{IPv6: v6}.For(nil).Equal(v6), "Host name remote should fall back to IPv6 source")
+	test.Assert(t, Source{IPv6: v6}.For(net.ParseIP("8.8.8.8")) == nil, "IPv4 remote without IPv4 source should use the OS's choice")
+
+	d := s.Dialer("tcp", net.ParseIP("8.8.8.8"), time.Second)
+	test.AssertEquals(t, d.Timeout, time.Second)
+	tcpAddr, ok := d.LocalAddr.(*net.TCPAddr)
+	test.Assert(t, ok && tcpAddr.IP.Equal(v4), "TCP dialer not bound to source")
+	d = s.Dialer("udp", net.ParseIP("2001:4860:4860::8888"), time.Second)
+	udpAddr, ok := d.LocalAddr.(*net.UDPAddr)
+	test.Assert(t, ok && udpAddr.IP.Equal(v6), "UDP dialer not bound to source")
+	d = Source{}.Dialer("tcp", net.ParseIP("8.8.8.8"), time.Second)
+	test.Assert(t, d.LocalAddr == nil, "Dialer bound without a source")
+}
+
+func TestDNSSource(t *testing.T) {
+	obj := NewTestDNSResolverImpl(time.Second*10, []string{dnsLoopbackAddr}, testStats)
+	obj.Source = Source{IPv4: net.IPv4(127, 0, 0, 1)}
+	addrs, err := obj.LookupHost("cps.letsencrypt.org")
+	test.AssertNotError(t, err, "Lookup from source address failed")
+	test.Assert(t, len(addrs) > 0, "No addresses found")
+
+	obj.Source = Source{IPv4: net.ParseIP("192.0.2.1")}
+	_, err = obj.LookupHost("cps.letsencrypt.org")
+	test.AssertError(t, err, "Lookup from an address that isn't local succeeded")
+}
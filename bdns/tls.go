@@ -0,0 +1,352 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package bdns
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
+)
+
+// TLSServer describes how to authenticate a resolver reached over TLS.
+type TLSServer struct {
+	// ServerName is the name the resolver's certificate must be valid for.
+	// Empty means the host of its address.
+	ServerName string
+	// Pins, if set, are the base64 SHA-256 hashes of SubjectPublicKeyInfos,
+	// one of which must be in the resolver's verified certificate chain.
+	Pins []string
+}
+
+// TLSTransport sends queries to resolvers over TLS (RFC 7858), so that
+// answers can't be tampered with on the path to them. Each resolver has one
+// connection, which is kept open between queries and carries any number of
+// queries at once, their answers matched up by message ID.
+type TLSTransport struct {
+	// Roots are the CAs resolver certificates are verified against. Nil
+	// means the system roots.
+	Roots   *x509.CertPool
+	Servers map[string]TLSServer
+	// Timeout bounds connecting to a resolver and each query.
+	Timeout time.Duration
+
+	mu    sync.Mutex
+	conns map[string]*tlsConn
+}
+
+// NewTLSTransport constructs a TLSTransport for servers, keyed by address,
+// whose certificates are verified against roots.
+func NewTLSTransport(roots *x509.CertPool, servers map[string]TLSServer, timeout time.Duration) *TLSTransport {
+	return &TLSTransport{
+		Roots:   roots,
+		Servers: servers,
+		Timeout: timeout,
+		conns:   make(map[string]*tlsConn),
+	}
+}
+
+// ParsePin checks that pin is a base64 SHA-256 hash, as in TLSServer.Pins.
+func ParsePin(pin string) error {
+	hash, err := base64.StdEncoding.DecodeString(pin)
+	if err != nil || len(hash) != sha256.Size {
+		return fmt.Errorf("Pin %q is not a base64 SHA-256 hash", pin)
+	}
+	return nil
+}
+
+// spkiPin returns the pin of cert's public key.
+func spkiPin(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// Close closes the open connections to resolvers.
+func (t *TLSTransport) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for server, c := range t.conns {
+		c.fail(errors.New("Transport closed"))
+		delete(t.conns, server)
+	}
+}
+
+// exchange sends m to server from source's address for it, over the
+// server's open connection if there is one. A connection the server closed
+// while it was idle is only noticed on use, so if an open connection fails
+// during the query it's sent again over a new one. Connecting and the query
+// are each bounded by timeout.
+func (t *TLSTransport) exchange(m *dns.Msg, server string, source Source, timeout time.Duration) (*dns.Msg, time.Duration, error) {
+	start := time.Now()
+	c, reused, err := t.conn(server, source, timeout)
+	if err != nil {
+		return nil, time.Since(start), err
+	}
+	r, connFailed, err := c.query(m, timeout)
+	if connFailed && reused {
+		t.drop(server, c)
+		if c, _, err = t.conn(server, source, timeout); err != nil {
+			return nil, time.Since(start), err
+		}
+		r, _, err = c.query(m, timeout)
+	}
+	return r, time.Since(start), err
+}
+
+func (t *TLSTransport) timeout() time.Duration {
+	if t.Timeout <= 0 {
+		return 2 * time.Second
+	}
+	return t.Timeout
+}
+
+// conn returns the open connection to server, and true, or a new one.
+func (t *TLSTransport) conn(server string, source Source, timeout time.Duration) (*tlsConn, bool, error) {
+	t.mu.Lock()
+	if t.conns == nil {
+		t.conns = make(map[string]*tlsConn)
+	}
+	if c, ok := t.conns[server]; ok && !c.broken() {
+		t.mu.Unlock()
+		return c, true, nil
+	}
+	t.mu.Unlock()
+
+	c, err := t.dial(server, source, timeout)
+	if err != nil {
+		return nil, false, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if existing, ok := t.conns[server]; ok && !existing.broken() {
+		// Another query connected first
+		c.fail(errors.New("Duplicate connection"))
+		return existing, true, nil
+	}
+	t.conns[server] = c
+	return c, false, nil
+}
+
+// drop forgets c as the connection to server and closes it.
+func (t *TLSTransport) drop(server string, c *tlsConn) {
+	t.mu.Lock()
+	if t.conns[server] == c {
+		delete(t.conns, server)
+	}
+	t.mu.Unlock()
+	c.fail(errors.New("Connection dropped"))
+}
+
+func (t *TLSTransport) dial(server string, source Source, timeout time.Duration) (*tlsConn, error) {
+	host, _, err := net.SplitHostPort(server)
+	if err != nil {
+		return nil, err
+	}
+	settings, ok := t.Servers[server]
+	if !ok {
+		return nil, fmt.Errorf("No TLS settings for DNS server %s", server)
+	}
+	serverName := settings.ServerName
+	if serverName == "" {
+		serverName = host
+	}
+
+	deadline := time.Now().Add(timeout)
+	raw, err := source.Dialer("tcp", net.ParseIP(host), timeout).Dial("tcp", server)
+	if err != nil {
+		return nil, err
+	}
+	conn := tls.Client(raw, &tls.Config{
+		RootCAs:    t.Roots,
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	})
+	conn.SetDeadline(deadline)
+	if err = conn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	if err = checkPins(conn.ConnectionState(), settings.Pins); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("DNS server %s: %s", server, err)
+	}
+
+	c := &tlsConn{
+		conn:    conn,
+		pending: make(map[uint16]chan *dns.Msg),
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+// checkPins checks that one of state's verified chains has a key in pins,
+// if there are any.
+func checkPins(state tls.ConnectionState, pins []string) error {
+	if len(pins) == 0 {
+		return nil
+	}
+	for _, chain := range state.VerifiedChains {
+		for _, cert := range chain {
+			pin := spkiPin(cert)
+			for _, p := range pins {
+				if p == pin {
+					return nil
+				}
+			}
+		}
+	}
+	return errors.New("No pinned key in the certificate chain")
+}
+
+// tlsConn is a connection to a resolver, carrying concurrent queries. Each
+// query is sent under an ID unique among those in flight, and answers are
+// passed back by readLoop.
+type tlsConn struct {
+	conn *tls.Conn
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  uint16
+	pending map[uint16]chan *dns.Msg
+	err     error
+}
+
+func (c *tlsConn) broken() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err != nil
+}
+
+// fail closes the connection and ends the queries in flight with err.
+func (c *tlsConn) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	c.conn.Close()
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+}
+
+// register allocates an ID for a query and the channel its answer arrives
+// on.
+func (c *tlsConn) register() (uint16, chan *dns.Msg, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return 0, nil, c.err
+	}
+	if len(c.pending) >= 0xffff {
+		return 0, nil, errors.New("Too many queries in flight")
+	}
+	for {
+		c.nextID++
+		if _, ok := c.pending[c.nextID]; !ok {
+			break
+		}
+	}
+	ch := make(chan *dns.Msg, 1)
+	c.pending[c.nextID] = ch
+	return c.nextID, ch, nil
+}
+
+func (c *tlsConn) unregister(id uint16) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, id)
+}
+
+// query sends m and waits up to timeout for the answer, which is returned
+// with m's ID. It also returns whether the query failed because the
+// connection did.
+func (c *tlsConn) query(m *dns.Msg, timeout time.Duration) (*dns.Msg, bool, error) {
+	id, ch, err := c.register()
+	if err != nil {
+		return nil, true, err
+	}
+	defer c.unregister(id)
+
+	q := m.Copy()
+	q.Id = id
+	packed, err := q.Pack()
+	if err != nil {
+		return nil, false, err
+	}
+	framed := make([]byte, 2, len(packed)+2)
+	binary.BigEndian.PutUint16(framed, uint16(len(packed)))
+	framed = append(framed, packed...)
+
+	c.writeMu.Lock()
+	c.conn.SetWriteDeadline(time.Now().Add(timeout))
+	_, err = c.conn.Write(framed)
+	c.writeMu.Unlock()
+	if err != nil {
+		c.fail(err)
+		return nil, true, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r, ok := <-ch:
+		if !ok {
+			c.mu.Lock()
+			err = c.err
+			c.mu.Unlock()
+			return nil, true, err
+		}
+		r.Id = m.Id
+		return r, false, nil
+	case <-timer.C:
+		return nil, false, fmt.Errorf("Timed out waiting for answer from %s", c.conn.RemoteAddr())
+	}
+}
+
+// readLoop passes each answer read from the connection to the query waiting
+// for it, until the connection fails.
+func (c *tlsConn) readLoop() {
+	reader := bufio.NewReader(c.conn)
+	var length [2]byte
+	for {
+		if _, err := io.ReadFull(reader, length[:]); err != nil {
+			c.fail(err)
+			return
+		}
+		packed := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(reader, packed); err != nil {
+			c.fail(err)
+			return
+		}
+		r := new(dns.Msg)
+		if err := r.Unpack(packed); err != nil {
+			c.fail(err)
+			return
+		}
+
+		c.mu.Lock()
+		if ch, ok := c.pending[r.Id]; ok {
+			delete(c.pending, r.Id)
+			ch <- r
+		}
+		c.mu.Unlock()
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package bdns
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// tlsTestServer answers A queries over TLS with 127.0.0.1. Queries for names
+// starting with "slow." are answered after those sent after them, to check
+// that answers are matched to queries.
+type tlsTestServer struct {
+	listener net.Listener
+	cert     *x509.Certificate
+
+	mu       sync.Mutex
+	accepted int
+	conns    []net.Conn
+}
+
+func newTLSTestServer(t *testing.T) *tlsTestServer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Couldn't generate key")
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "resolver.example.com"},
+		DNSNames:              []string{"resolver.example.com"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	test.AssertNotError(t, err, "Couldn't create certificate")
+	cert, err := x509.ParseCertificate(der)
+	test.AssertNotError(t, err, "Couldn't parse certificate")
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+	test.AssertNotError(t, err, "Couldn't listen")
+	s := &tlsTestServer{listener: listener, cert: cert}
+	go s.serve()
+	return s
+}
+
+func (s *tlsTestServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *tlsTestServer) roots() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(s.cert)
+	return pool
+}
+
+func (s *tlsTestServer) connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accepted
+}
+
+// closeConns closes the connections made so far, as a resolver does with
+// idle ones.
+func (s *tlsTestServer) closeConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *tlsTestServer) close() {
+	s.listener.Close()
+	s.closeConns()
+}
+
+func (s *tlsTestServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.accepted++
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *tlsTestServer) handle(conn net.Conn) {
+	var writeMu sync.Mutex
+	var length [2]byte
+	for {
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return
+		}
+		packed := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, packed); err != nil {
+			return
+		}
+		go func() {
+			q := new(dns.Msg)
+			if err := q.Unpack(packed); err != nil {
+				return
+			}
+			if strings.HasPrefix(q.Question[0].Name, "slow.") {
+				time.Sleep(50 * time.Millisecond)
+			}
+			r := new(dns.Msg)
+			r.SetReply(q)
+			r.Answer = append(r.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: q.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+				A:   net.IPv4(127, 0, 0, 1),
+			})
+			out, err := r.Pack()
+			if err != nil {
+				return
+			}
+			framed := make([]byte, 2, len(out)+2)
+			binary.BigEndian.PutUint16(framed, uint16(len(out)))
+			writeMu.Lock()
+			conn.Write(append(framed, out...))
+			writeMu.Unlock()
+		}()
+	}
+}
+
+func TestParsePin(t *testing.T) {
+	test.AssertNotError(t, ParsePin("47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="), "Valid pin rejected")
+	test.AssertError(t, ParsePin("not base64!"), "Invalid base64 accepted")
+	test.AssertError(t, ParsePin("AAAA"), "Short hash accepted")
+}
+
+func TestDNSOverTLS(t *testing.T) {
+	s := newTLSTestServer(t)
+	defer s.close()
+
+	obj := NewTestDNSResolverImpl(time.Second, []string{s.addr()}, testStats)
+	obj.TLS = NewTLSTransport(s.roots(), map[string]TLSServer{
+		s.addr(): {ServerName: "resolver.example.com", Pins: []string{spkiPin(s.cert)}},
+	}, time.Second)
+	defer obj.TLS.Close()
+
+	addrs, err := obj.LookupHost("example.com")
+	test.AssertNotError(t, err, "Lookup over TLS failed")
+	test.AssertEquals(t, len(addrs), 1)
+	test.Assert(t, addrs[0].Equal(net.IPv4(127, 0, 0, 1)), "Wrong address")
+
+	// Concurrent queries share the connection, and each gets its own answer
+	// even when they arrive out of order
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		name := "fast.example.com"
+		if i%2 == 0 {
+			name = "slow.example.com"
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := obj.LookupHost(name)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		test.AssertNotError(t, err, "Concurrent lookup over TLS failed")
+	}
+	test.AssertEquals(t, s.connections(), 1)
+
+	// A connection the server closed is replaced
+	s.closeConns()
+	_, err = obj.LookupHost("example.com")
+	test.AssertNotError(t, err, "Lookup after the server closed the connection failed")
+	test.AssertEquals(t, s.connections(), 2)
+}
+
+func TestDNSOverTLSAuthentication(t *testing.T) {
+	s := newTLSTestServer(t)
+	defer s.close()
+
+	lookup := func(roots *x509.CertPool, settings TLSServer) error {
+		obj := NewTestDNSResolverImpl(time.Second, []string{s.addr()}, testStats)
+		obj.TLS = NewTLSTransport(roots, map[string]TLSServer{s.addr(): settings}, time.Second)
+		defer obj.TLS.Close()
+		_, err := obj.LookupHost("example.com")
+		return err
+	}
+
+	err := lookup(s.roots(), TLSServer{})
+	test.AssertNotError(t, err, "Lookup from server with its address in its certificate failed")
+	err = lookup(x509.NewCertPool(), TLSServer{})
+	test.AssertError(t, err, "Lookup from server with untrusted certificate succeeded")
+	err = lookup(s.roots(), TLSServer{ServerName: "other.example.com"})
+	test.AssertError(t, err, "Lookup from server with the wrong name succeeded")
+	err = lookup(s.roots(), TLSServer{Pins: []string{"47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="}})
+	test.AssertError(t, err, "Lookup from server without pinned key succeeded")
+}
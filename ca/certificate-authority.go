@@ -6,9 +6,12 @@
 package ca
 
 import (
+	"context"
 	"crypto"
 	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
@@ -23,12 +26,13 @@ import (
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
 	"github.com/letsencrypt/boulder/cmd"
 	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/identifier"
 	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/probs"
 
 	cfsslConfig "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/config"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/ocsp"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/signer"
-	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/signer/local"
 )
 
 // This map is used to detect algorithms in crypto/x509 that
@@ -60,18 +64,30 @@ const (
 // OCSP responses.
 type CertificateAuthorityImpl struct {
 	profile        string
-	signer         signer.Signer
-	ocspSigner     ocsp.Signer
+	profiles       map[string]time.Duration // Validity of each selectable profile
+	smimeProfiles  map[string]bool          // Profiles that issue for email identifiers
+	mustStaple     map[string]bool          // Profiles that allow must-staple
+	shortLived     map[string]bool          // Profiles without OCSP or CRL URLs
+	defaultIssuer  *issuer
+	issuers        []*issuer            // Added with AddIssuer, in order
+	signingPolicy  *cfsslConfig.Signing // Before any issuer's URLs are filled in
+	lifespanOCSP   time.Duration
 	SA             core.StorageAuthority
 	PA             core.PolicyAuthority
 	Publisher      core.Publisher
-	clk            clock.Clock // TODO(jmhodges): should be private, like log
+	BlockedKeys    core.BlockedKeys // In addition to those blocked in the SA
+	clk            clock.Clock      // TODO(jmhodges): should be private, like log
 	log            *blog.AuditLogger
 	stats          statsd.Statter
 	prefix         int // Prepended to the serial number
 	validityPeriod time.Duration
-	notAfter       time.Time
 	maxNames       int
+	quotas         *issuanceQuotas
+	allowedKeys    map[string]*allowedKeys // Set for profiles that restrict keys
+
+	// The issuer and OCSP URL templates, for issuers added later
+	issuerURLTemplates []string
+	ocspURLTemplate    string
 
 	hsmFaultLock         sync.Mutex
 	hsmFaultLastObserved time.Time
@@ -112,10 +128,32 @@ func NewCertificateAuthorityImpl(
 		return nil, err
 	}
 
-	signer, err := local.NewSigner(privateKey, issuer, x509.SHA256WithRSA, cfsslConfigObj.Signing)
+	urls, err := newIssuerURLs(config)
 	if err != nil {
 		return nil, err
 	}
+	// Clients may select any of config.Profiles in place of config.Profile
+	profiles := make(map[string]time.Duration)
+	for _, name := range config.Profiles {
+		profile, ok := cfsslConfigObj.Signing.Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("Selectable profile %q doesn't exist", name)
+		}
+		if profile.CA {
+			return nil, fmt.Errorf("Selectable profile %q issues CA certificates", name)
+		}
+		profiles[name] = profile.Expiry
+	}
+	smimeProfiles := make(map[string]bool)
+	for _, name := range config.SMIMEProfiles {
+		if _, ok := profiles[name]; !ok {
+			return nil, fmt.Errorf("S/MIME profile %q isn't a selectable profile", name)
+		}
+		if !emailProtection(cfsslConfigObj.Signing.Profiles[name]) {
+			return nil, fmt.Errorf("S/MIME profile %q doesn't have the email protection usage", name)
+		}
+		smimeProfiles[name] = true
+	}
 
 	if config.LifespanOCSP == "" {
 		return nil, errors.New("Config must specify an OCSP lifespan period.")
@@ -125,23 +163,26 @@ func NewCertificateAuthorityImpl(
 		return nil, err
 	}
 
-	// Set up our OCSP signer. Note this calls for both the issuer cert and the
-	// OCSP signing cert, which are the same in our case.
-	ocspSigner, err := ocsp.NewSigner(issuer, issuer, privateKey, lifespanOCSP)
+	defaultIssuer, err := newIssuer(config.IssuerID, issuer, privateKey, cfsslConfigObj.Signing,
+		append([]string{config.Profile}, config.Profiles...), urls, lifespanOCSP)
 	if err != nil {
 		return nil, err
 	}
 
 	ca = &CertificateAuthorityImpl{
-		signer:          signer,
-		ocspSigner:      ocspSigner,
-		profile:         config.Profile,
-		prefix:          config.SerialPrefix,
-		clk:             clk,
-		log:             logger,
-		stats:           stats,
-		notAfter:        issuer.NotAfter,
-		hsmFaultTimeout: config.HSMFaultTimeout.Duration,
+		defaultIssuer:      defaultIssuer,
+		signingPolicy:      cfsslConfigObj.Signing,
+		lifespanOCSP:       lifespanOCSP,
+		issuerURLTemplates: config.IssuerURLs,
+		ocspURLTemplate:    config.OCSPURL,
+		profile:            config.Profile,
+		profiles:           profiles,
+		smimeProfiles:      smimeProfiles,
+		prefix:             config.SerialPrefix,
+		clk:                clk,
+		log:                logger,
+		stats:              stats,
+		hsmFaultTimeout:    config.HSMFaultTimeout.Duration,
 	}
 
 	if config.Expiry == "" {
@@ -151,12 +192,97 @@ func NewCertificateAuthorityImpl(
 	if err != nil {
 		return nil, err
 	}
+	ca.profiles[config.Profile] = ca.validityPeriod
 
 	ca.maxNames = config.MaxNames
 
+	ca.mustStaple = make(map[string]bool)
+	for _, name := range config.MustStapleProfiles {
+		if _, ok := ca.profiles[name]; !ok {
+			return nil, fmt.Errorf("Must-staple configured for unknown profile %q", name)
+		}
+		ca.mustStaple[name] = true
+	}
+
+	ca.shortLived = make(map[string]bool)
+	for _, name := range config.ShortLivedProfiles {
+		validity, ok := ca.profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("Short-lived profile %q isn't a selectable profile", name)
+		}
+		if validity > core.ShortLivedValidity {
+			return nil, fmt.Errorf("Short-lived profile %q is valid for %s, longer than %s", name, validity, core.ShortLivedValidity)
+		}
+		profile := cfsslConfigObj.Signing.Profiles[name]
+		if profile.OCSP != "" || profile.CRL != "" {
+			return nil, fmt.Errorf("Short-lived profile %q has an OCSP or CRL URL", name)
+		}
+		ca.shortLived[name] = true
+	}
+
+	for name := range config.ProfileDailyQuotas {
+		if _, ok := ca.profiles[name]; !ok {
+			return nil, fmt.Errorf("Daily quota configured for unknown profile %q", name)
+		}
+	}
+	ca.quotas, err = newIssuanceQuotas(config.IssuerDailyQuota, config.ProfileDailyQuotas, clk, stats)
+	if err != nil {
+		return nil, err
+	}
+	ca.allowedKeys, err = newAllowedKeys(config.AllowedKeys, ca.profiles)
+	if err != nil {
+		return nil, err
+	}
+
 	return ca, nil
 }
 
+// emailProtection reports whether profile issues certificates for email
+// protection.
+func emailProtection(profile *cfsslConfig.SigningProfile) bool {
+	_, ekus, _ := profile.Usages()
+	for _, eku := range ekus {
+		if eku == x509.ExtKeyUsageEmailProtection {
+			return true
+		}
+	}
+	return false
+}
+
+// oidTLSFeature is the OID of the TLS Feature extension of RFC 7633, which
+// requests must-staple.
+var oidTLSFeature = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+
+// tlsFeatureStatusRequest is the TLS Feature for OCSP stapling.
+const tlsFeatureStatusRequest = 5
+
+// mustStapleExtensions returns the TLS Feature extension of csr, to be copied
+// into the certificate, or nil if it has none. It's an error for the CSR to
+// request must-staple under a profile that doesn't allow it, or to request
+// any TLS Feature other than OCSP stapling.
+func (ca *CertificateAuthorityImpl) mustStapleExtensions(csr x509.CertificateRequest, profile string) ([]pkix.Extension, error) {
+	for _, ext := range csr.Extensions {
+		if !ext.Id.Equal(oidTLSFeature) {
+			continue
+		}
+		if !ca.mustStaple[profile] {
+			return nil, core.MalformedRequestError(fmt.Sprintf("Profile %q doesn't allow must-staple", profile))
+		}
+		var features []int
+		rest, err := asn1.Unmarshal(ext.Value, &features)
+		if err != nil || len(rest) > 0 || len(features) == 0 {
+			return nil, core.MalformedRequestError("Invalid TLS Feature extension in CSR")
+		}
+		for _, feature := range features {
+			if feature != tlsFeatureStatusRequest {
+				return nil, core.MalformedRequestError(fmt.Sprintf("Unsupported TLS Feature %d in CSR", feature))
+			}
+		}
+		return []pkix.Extension{{Id: oidTLSFeature, Value: ext.Value}}, nil
+	}
+	return nil, nil
+}
+
 // checkHSMFault checks whether there has been an HSM fault observed within the
 // timeout window.  CA methods that use the HSM should call this method right
 // away, to minimize the performance impact of HSM outages.
@@ -194,7 +320,8 @@ func (ca *CertificateAuthorityImpl) noteHSMFault(err error) {
 }
 
 // GenerateOCSP produces a new OCSP response and returns it
-func (ca *CertificateAuthorityImpl) GenerateOCSP(xferObj core.OCSPSigningRequest) ([]byte, error) {
+func (ca *CertificateAuthorityImpl) GenerateOCSP(ctx context.Context, xferObj core.OCSPSigningRequest) ([]byte, error) {
+	log := ca.log.WithRequestID(core.RequestID(ctx))
 	if err := ca.checkHSMFault(); err != nil {
 		return nil, err
 	}
@@ -202,7 +329,7 @@ func (ca *CertificateAuthorityImpl) GenerateOCSP(xferObj core.OCSPSigningRequest
 	cert, err := x509.ParseCertificate(xferObj.CertDER)
 	if err != nil {
 		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-		ca.log.AuditErr(err)
+		log.AuditErr(err)
 		return nil, err
 	}
 
@@ -213,21 +340,54 @@ func (ca *CertificateAuthorityImpl) GenerateOCSP(xferObj core.OCSPSigningRequest
 		RevokedAt:   xferObj.RevokedAt,
 	}
 
-	ocspResponse, err := ca.ocspSigner.Sign(signRequest)
+	ocspResponse, err := ca.issuerOf(cert).ocspSigner.Sign(signRequest)
 	ca.noteHSMFault(err)
 	return ocspResponse, err
 }
 
 // RevokeCertificate revokes the trust of the Cert referred to by the provided Serial.
-func (ca *CertificateAuthorityImpl) RevokeCertificate(serial string, reasonCode core.RevocationCode) (err error) {
-	err = ca.SA.MarkCertificateRevoked(serial, reasonCode)
+func (ca *CertificateAuthorityImpl) RevokeCertificate(ctx context.Context, serial string, reasonCode core.RevocationCode) (err error) {
+	err = ca.SA.MarkCertificateRevoked(ctx, serial, reasonCode)
 	return err
 }
 
+// maxValidityBackdate is how far before its issuance a certificate may be
+// requested to be valid from, allowing for clients' clocks being slow.
+const maxValidityBackdate = time.Hour
+
+// requestedValidity returns the validity period requested, with both ends
+// filled in, or a MalformedRequestError if it starts too long before now,
+// doesn't end after it starts, or is longer than the profile's
+// validityPeriod.
+func (ca *CertificateAuthorityImpl) requestedValidity(validity core.Validity, validityPeriod time.Duration) (core.Validity, error) {
+	now := ca.clk.Now()
+	if validity.NotBefore.IsZero() {
+		validity.NotBefore = now
+	}
+	if validity.NotAfter.IsZero() {
+		validity.NotAfter = validity.NotBefore.Add(validityPeriod)
+	}
+	switch {
+	case validity.NotBefore.Before(now.Add(-maxValidityBackdate)):
+		return validity, core.MalformedRequestError(fmt.Sprintf("Requested notBefore %s is more than %s ago",
+			validity.NotBefore.UTC().Format(time.RFC3339), maxValidityBackdate))
+	case !validity.NotAfter.After(validity.NotBefore):
+		return validity, core.MalformedRequestError("Requested notAfter isn't after notBefore")
+	case validity.NotAfter.Sub(validity.NotBefore) > validityPeriod:
+		return validity, core.MalformedRequestError(fmt.Sprintf("Requested validity period of %s is longer than the profile's %s",
+			validity.NotAfter.Sub(validity.NotBefore), validityPeriod))
+	}
+	return validity, nil
+}
+
 // IssueCertificate attempts to convert a CSR into a signed Certificate, while
 // enforcing all policies. Names (domains) in the CertificateRequest will be
-// lowercased before storage.
-func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest, regID int64) (core.Certificate, error) {
+// lowercased before storage. The certificate is issued under the named
+// profile, or the CA's default profile if profile is empty, for the
+// validity period requested, if any, so long as it's no longer than the
+// profile's.
+func (ca *CertificateAuthorityImpl) IssueCertificate(ctx context.Context, csr x509.CertificateRequest, regID int64, profile string, validity core.Validity) (core.Certificate, error) {
+	log := ca.log.WithRequestID(core.RequestID(ctx))
 	emptyCert := core.Certificate{}
 	var err error
 
@@ -235,75 +395,142 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 		return emptyCert, err
 	}
 
+	if profile == "" {
+		profile = ca.profile
+	}
+	validityPeriod, ok := ca.profiles[profile]
+	if !ok {
+		err = core.MalformedRequestError(fmt.Sprintf("Unknown certificate profile %q", profile))
+		log.WarningErr(err)
+		return emptyCert, err
+	}
+
 	key, ok := csr.PublicKey.(crypto.PublicKey)
 	if !ok {
 		err = core.MalformedRequestError("Invalid public key in CSR.")
 		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
-		ca.log.AuditErr(err)
+		log.AuditErr(err)
 		return emptyCert, err
 	}
 	if err = core.GoodKey(key); err != nil {
-		err = core.MalformedRequestError(fmt.Sprintf("Invalid public key in CSR: %s", err.Error()))
+		err = probs.BadPublicKey("Invalid public key in CSR: %s", err)
+		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+		log.AuditErr(err)
+		return emptyCert, err
+	}
+	keyBlocked, err := core.KeyBlocked(ctx, key, ca.BlockedKeys, ca.SA)
+	if err != nil {
+		log.AuditErr(err)
+		return emptyCert, err
+	}
+	if keyBlocked {
+		err = probs.BadPublicKey("Key is blocked because it is known to be compromised")
 		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
-		ca.log.AuditErr(err)
+		log.AuditErr(err)
+		ca.stats.Inc("CA.KeyBlocked", 1, 1.0)
 		return emptyCert, err
 	}
+	if allowed, ok := ca.allowedKeys[profile]; ok {
+		if prob := allowed.check(profile, key); prob != nil {
+			// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+			log.AuditErr(prob)
+			ca.stats.Inc("CA.KeyNotAllowed", 1, 1.0)
+			return emptyCert, prob
+		}
+	}
 	if badSignatureAlgorithms[csr.SignatureAlgorithm] {
 		err = core.MalformedRequestError("Invalid signature algorithm in CSR")
 		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
-		ca.log.AuditErr(err)
+		log.AuditErr(err)
 		return emptyCert, err
 	}
 
-	// Pull hostnames from CSR
+	// Pull hostnames and email addresses from CSR
 	// Authorization is checked by the RA
 	commonName := ""
-	hostNames := make([]string, len(csr.DNSNames))
-	copy(hostNames, csr.DNSNames)
+	identifiers := identifier.FromCSR(&csr)
 	if len(csr.Subject.CommonName) > 0 {
-		commonName = strings.ToLower(csr.Subject.CommonName)
-		hostNames = append(hostNames, commonName)
-	} else if len(hostNames) > 0 {
-		commonName = strings.ToLower(hostNames[0])
+		commonName = identifier.FromValue(csr.Subject.CommonName).Value
+	} else if len(csr.DNSNames) > 0 {
+		commonName = strings.ToLower(csr.DNSNames[0])
+	} else if len(csr.EmailAddresses) > 0 {
+		commonName = identifier.FromValue(csr.EmailAddresses[0]).Value
 	} else {
 		err = core.MalformedRequestError("Cannot issue a certificate without a hostname.")
 		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
-		ca.log.AuditErr(err)
+		log.AuditErr(err)
 		return emptyCert, err
 	}
 
-	// Collapse any duplicate names.  Note that this operation may re-order the names
-	hostNames = core.UniqueLowerNames(hostNames)
+	hostNames := identifier.Values(identifiers)
 	if ca.maxNames > 0 && len(hostNames) > ca.maxNames {
 		err = core.MalformedRequestError(fmt.Sprintf("Certificate request has %d names, maximum is %d.", len(hostNames), ca.maxNames))
-		ca.log.WarningErr(err)
+		log.WarningErr(err)
+		return emptyCert, err
+	}
+
+	// S/MIME profiles issue for email addresses, and only S/MIME profiles do
+	smime := ca.smimeProfiles[profile]
+	for _, id := range identifiers {
+		if smime && id.Type != identifier.Email {
+			err = core.MalformedRequestError(fmt.Sprintf("Profile %q only issues for email addresses, not %s", profile, id.Value))
+		} else if !smime && id.Type == identifier.Email {
+			err = core.MalformedRequestError(fmt.Sprintf("Email address %s needs an S/MIME profile", id.Value))
+		}
+		if err != nil {
+			// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+			log.AuditErr(err)
+			return emptyCert, err
+		}
+	}
+
+	extensions, err := ca.mustStapleExtensions(csr, profile)
+	if err != nil {
+		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+		log.AuditErr(err)
 		return emptyCert, err
 	}
 
 	// Verify that names are allowed by policy
-	identifier := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: commonName}
-	if err = ca.PA.WillingToIssue(identifier, regID); err != nil {
+	if err = ca.PA.WillingToIssue(identifier.FromValue(commonName), regID); err != nil {
 		err = core.MalformedRequestError(fmt.Sprintf("Policy forbids issuing for name %s", commonName))
 		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
-		ca.log.AuditErr(err)
+		log.AuditErr(err)
 		return emptyCert, err
 	}
-	for _, name := range hostNames {
-		identifier = core.AcmeIdentifier{Type: core.IdentifierDNS, Value: name}
-		if err = ca.PA.WillingToIssue(identifier, regID); err != nil {
-			err = core.MalformedRequestError(fmt.Sprintf("Policy forbids issuing for name %s", name))
+	for _, id := range identifiers {
+		if err = ca.PA.WillingToIssue(id, regID); err != nil {
+			err = core.MalformedRequestError(fmt.Sprintf("Policy forbids issuing for name %s", id.Value))
 			// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
-			ca.log.AuditErr(err)
+			log.AuditErr(err)
 			return emptyCert, err
 		}
 	}
 
-	notAfter := ca.clk.Now().Add(ca.validityPeriod)
+	notAfter := ca.clk.Now().Add(validityPeriod)
+	if !validity.IsZero() {
+		validity, err = ca.requestedValidity(validity, validityPeriod)
+		if err != nil {
+			// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+			log.AuditErr(err)
+			return emptyCert, err
+		}
+		notAfter = validity.NotAfter
+	}
 
-	if ca.notAfter.Before(notAfter) {
+	iss := ca.issuerFor(profile, key, identifiers)
+	if iss.notAfter.Before(notAfter) {
 		err = core.InternalServerError("Cannot issue a certificate that expires after the intermediate certificate.")
 		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
-		ca.log.AuditErr(err)
+		log.AuditErr(err)
+		return emptyCert, err
+	}
+
+	// Count the issuance against the daily quotas, giving it back if signing
+	// fails
+	release, err := ca.quotas.reserve(profile)
+	if err != nil {
+		log.WarningErr(err)
 		return emptyCert, err
 	}
 
@@ -319,9 +546,10 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 	serialBytes[0] = byte(ca.prefix)
 	_, err = rand.Read(serialBytes[1:])
 	if err != nil {
+		release()
 		err = core.InternalServerError(err.Error())
 		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-		ca.log.Audit(fmt.Sprintf("Serial randomness failed, err=[%v]", err))
+		log.Audit(fmt.Sprintf("Serial randomness failed, err=[%v]", err))
 		return emptyCert, err
 	}
 	serialHex := hex.EncodeToString(serialBytes)
@@ -331,7 +559,7 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 	// Send the cert off for signing
 	req := signer.SignRequest{
 		Request: csrPEM,
-		Profile: ca.profile,
+		Profile: profile,
 		Hosts:   hostNames,
 		Subject: &signer.Subject{
 			CN: commonName,
@@ -339,19 +567,29 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 		Serial: serialBigInt,
 	}
 
-	certPEM, err := ca.signer.Sign(req)
+	certSigner, err := iss.signerForSerial(serialHex, profile, validity, extensions)
+	if err != nil {
+		release()
+		err = core.InternalServerError(err.Error())
+		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+		log.Audit(fmt.Sprintf("Signer setup failed: serial=[%s] issuer=[%s] err=[%v]", serialHex, iss.name, err))
+		return emptyCert, err
+	}
+
+	certPEM, err := certSigner.Sign(req)
 	ca.noteHSMFault(err)
 	if err != nil {
+		release()
 		err = core.InternalServerError(err.Error())
 		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-		ca.log.Audit(fmt.Sprintf("Signer failed, rolling back: serial=[%s] err=[%v]", serialHex, err))
+		log.Audit(fmt.Sprintf("Signer failed, rolling back: serial=[%s] issuer=[%s] err=[%v]", serialHex, iss.name, err))
 		return emptyCert, err
 	}
 
 	if len(certPEM) == 0 {
 		err = core.InternalServerError("No certificate returned by server")
 		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-		ca.log.Audit(fmt.Sprintf("PEM empty from Signer, rolling back: serial=[%s] err=[%v]", serialHex, err))
+		log.Audit(fmt.Sprintf("PEM empty from Signer, rolling back: serial=[%s] err=[%v]", serialHex, err))
 		return emptyCert, err
 	}
 
@@ -359,7 +597,7 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 	if block == nil || block.Type != "CERTIFICATE" {
 		err = core.InternalServerError("Invalid certificate value returned")
 		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-		ca.log.Audit(fmt.Sprintf("PEM decode error, aborting and rolling back issuance: pem=[%s] err=[%v]", certPEM, err))
+		log.Audit(fmt.Sprintf("PEM decode error, aborting and rolling back issuance: pem=[%s] err=[%v]", certPEM, err))
 		return emptyCert, err
 	}
 	certDER := block.Bytes
@@ -372,21 +610,21 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 	if err != nil {
 		err = core.InternalServerError(err.Error())
 		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-		ca.log.Audit(fmt.Sprintf("Uncaught error, aborting and rolling back issuance: pem=[%s] err=[%v]", certPEM, err))
+		log.Audit(fmt.Sprintf("Uncaught error, aborting and rolling back issuance: pem=[%s] err=[%v]", certPEM, err))
 		return emptyCert, err
 	}
 
 	// Store the cert with the certificate authority, if provided
-	_, err = ca.SA.AddCertificate(certDER, regID)
+	_, err = ca.SA.AddCertificate(ctx, certDER, regID)
 	if err != nil {
 		err = core.InternalServerError(err.Error())
 		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-		ca.log.Audit(fmt.Sprintf("Failed RPC to store at SA, orphaning certificate: pem=[%s] err=[%v]", certPEM, err))
+		log.Audit(fmt.Sprintf("Failed RPC to store at SA, orphaning certificate: pem=[%s] err=[%v]", certPEM, err))
 		return emptyCert, err
 	}
 
 	// Submit the certificate to any configured CT logs
-	go ca.Publisher.SubmitToCT(certDER)
+	go ca.Publisher.SubmitToCT(ctx, certDER)
 
 	// Do not return an err at this point; caller must know that the Certificate
 	// was issued. (Also, it should be impossible for err to be non-nil here)
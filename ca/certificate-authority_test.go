@@ -7,8 +7,12 @@ package ca
 
 import (
 	"bytes"
+	"context"
 	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/asn1"
 	"fmt"
 	"io/ioutil"
@@ -20,9 +24,12 @@ import (
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/helpers"
 	ocspConfig "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/ocsp/config"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
 	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/identifier"
 	"github.com/letsencrypt/boulder/mocks"
 	"github.com/letsencrypt/boulder/policy"
+	"github.com/letsencrypt/boulder/probs"
 	"github.com/letsencrypt/boulder/sa/satest"
 
 	"github.com/letsencrypt/boulder/core"
@@ -218,6 +225,226 @@ func setup(t *testing.T) *testCtx {
 	}
 }
 
+func TestSelectableProfiles(t *testing.T) {
+	config := urlTestConfig()
+	config.IssuerURLs = nil
+	short := *config.CFSSL.Signing.Profiles[profileName]
+	short.ExpiryString = "168h"
+	config.CFSSL.Signing.Profiles["short"] = &short
+	config.Profiles = []string{"short"}
+
+	stats := mocks.NewStatter()
+	ca, err := NewCertificateAuthorityImpl(config, clock.NewFake(), &stats, caCert, caKey)
+	test.AssertNotError(t, err, "Failed to create CA with a selectable profile")
+	test.AssertEquals(t, ca.profiles[profileName], 8760*time.Hour)
+	test.AssertEquals(t, ca.profiles["short"], 168*time.Hour)
+
+	_, err = ca.IssueCertificate(context.Background(), x509.CertificateRequest{}, 1, "long", core.Validity{})
+	test.AssertError(t, err, "Issued for an unknown profile")
+	_, ok := err.(core.MalformedRequestError)
+	test.Assert(t, ok, "Unknown profile wasn't a malformed request")
+
+	config.Profiles = []string{"missing"}
+	_, err = NewCertificateAuthorityImpl(config, clock.NewFake(), &stats, caCert, caKey)
+	test.AssertError(t, err, "CA accepted a missing selectable profile")
+
+	config.Profiles = []string{"short"}
+	config.ProfileDailyQuotas = map[string]int{"long": 10}
+	_, err = NewCertificateAuthorityImpl(config, clock.NewFake(), &stats, caCert, caKey)
+	test.AssertError(t, err, "CA accepted a quota for an unknown profile")
+	config.ProfileDailyQuotas = map[string]int{"short": 10}
+	_, err = NewCertificateAuthorityImpl(config, clock.NewFake(), &stats, caCert, caKey)
+	test.AssertNotError(t, err, "CA rejected a quota for a selectable profile")
+
+	short.CA = true
+	config.Profiles = []string{"short"}
+	_, err = NewCertificateAuthorityImpl(config, clock.NewFake(), &stats, caCert, caKey)
+	test.AssertError(t, err, "CA accepted a selectable CA profile")
+}
+
+// allowingPA is a PolicyAuthority that is willing to issue for anything.
+type allowingPA struct{}
+
+func (allowingPA) WillingToIssue(identifier.ACMEIdentifier, int64) error { return nil }
+func (allowingPA) HighRisk(identifier.ACMEIdentifier) bool               { return false }
+func (allowingPA) ChallengesFor(identifier.ACMEIdentifier, *jose.JSONWebKey) ([]core.Challenge, [][]int, error) {
+	return nil, nil, nil
+}
+
+func TestSMIMEProfiles(t *testing.T) {
+	config := urlTestConfig()
+	config.IssuerURLs = nil
+	smime := *config.CFSSL.Signing.Profiles[profileName]
+	config.CFSSL.Signing.Profiles["smime"] = &smime
+	config.Profiles = []string{"smime"}
+	stats := mocks.NewStatter()
+
+	// S/MIME profiles must be selectable and protect email
+	config.SMIMEProfiles = []string{"smime"}
+	_, err := NewCertificateAuthorityImpl(config, clock.NewFake(), &stats, caCert, caKey)
+	test.AssertError(t, err, "CA accepted an S/MIME profile without email protection")
+	smime.Usage = []string{"digital signature", "email protection"}
+	config.SMIMEProfiles = []string{profileName}
+	_, err = NewCertificateAuthorityImpl(config, clock.NewFake(), &stats, caCert, caKey)
+	test.AssertError(t, err, "CA accepted an S/MIME profile that isn't selectable")
+	config.SMIMEProfiles = []string{"smime"}
+	ca, err := NewCertificateAuthorityImpl(config, clock.NewFake(), &stats, caCert, caKey)
+	test.AssertNotError(t, err, "Failed to create CA with an S/MIME profile")
+	ca.PA = allowingPA{}
+	ca.SA = &mocks.StorageAuthority{}
+	ca.Publisher = &mocks.Publisher{}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	test.AssertNotError(t, err, "Failed to generate key")
+	makeCSR := func(template *x509.CertificateRequest) x509.CertificateRequest {
+		der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+		test.AssertNotError(t, err, "Failed to create CSR")
+		csr, err := x509.ParseCertificateRequest(der)
+		test.AssertNotError(t, err, "Failed to parse CSR")
+		return *csr
+	}
+	emailCSR := makeCSR(&x509.CertificateRequest{EmailAddresses: []string{"alice@EXAMPLE.com"}})
+	dnsCSR := makeCSR(&x509.CertificateRequest{DNSNames: []string{"example.com"}})
+	mixedCSR := makeCSR(&x509.CertificateRequest{
+		Subject:        pkix.Name{CommonName: "example.com"},
+		EmailAddresses: []string{"alice@example.com"},
+	})
+
+	// Only S/MIME profiles issue for email addresses, and they issue for
+	// nothing else
+	_, err = ca.IssueCertificate(context.Background(), emailCSR, 1, "", core.Validity{})
+	test.AssertError(t, err, "Issued for an email address under the default profile")
+	_, err = ca.IssueCertificate(context.Background(), dnsCSR, 1, "smime", core.Validity{})
+	test.AssertError(t, err, "Issued for a DNS name under an S/MIME profile")
+	_, err = ca.IssueCertificate(context.Background(), mixedCSR, 1, "smime", core.Validity{})
+	test.AssertError(t, err, "Issued for a DNS name under an S/MIME profile")
+	_, ok := err.(core.MalformedRequestError)
+	test.Assert(t, ok, "Mismatched profile wasn't a malformed request")
+
+	cert, err := ca.IssueCertificate(context.Background(), emailCSR, 1, "smime", core.Validity{})
+	test.AssertNotError(t, err, "Failed to issue an S/MIME certificate")
+	parsed, err := x509.ParseCertificate(cert.DER)
+	test.AssertNotError(t, err, "Failed to parse S/MIME certificate")
+	test.AssertDeepEquals(t, parsed.EmailAddresses, []string{"alice@example.com"})
+	test.AssertEquals(t, len(parsed.DNSNames), 0)
+	test.AssertEquals(t, parsed.Subject.CommonName, "alice@example.com")
+	test.AssertDeepEquals(t, parsed.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection})
+}
+
+func TestShortLivedProfiles(t *testing.T) {
+	lookupHost = fakeLookupHost
+	config := urlTestConfig()
+	config.OCSPURL = "http://example.com/{issuer-id}/ocsp/{serial}"
+	short := *config.CFSSL.Signing.Profiles[profileName]
+	config.CFSSL.Signing.Profiles["short"] = &short
+	config.Profiles = []string{"short"}
+	stats := mocks.NewStatter()
+
+	// Short-lived profiles must be selectable, last at most 7 days, and
+	// have no OCSP URL of their own
+	config.ShortLivedProfiles = []string{"missing"}
+	_, err := NewCertificateAuthorityImpl(config, clock.NewFake(), &stats, caCert, caKey)
+	test.AssertError(t, err, "CA accepted an unknown short-lived profile")
+	config.ShortLivedProfiles = []string{"short"}
+	short.ExpiryString = "168h"
+	_, err = NewCertificateAuthorityImpl(config, clock.NewFake(), &stats, caCert, caKey)
+	test.AssertError(t, err, "CA accepted a short-lived profile with an OCSP URL")
+	short.OCSP = ""
+	short.ExpiryString = "169h"
+	_, err = NewCertificateAuthorityImpl(config, clock.NewFake(), &stats, caCert, caKey)
+	test.AssertError(t, err, "CA accepted a short-lived profile valid for more than 7 days")
+	short.ExpiryString = "168h"
+	ca, err := NewCertificateAuthorityImpl(config, clock.NewFake(), &stats, caCert, caKey)
+	test.AssertNotError(t, err, "Failed to create CA with a short-lived profile")
+	ca.PA = allowingPA{}
+	ca.SA = &mocks.StorageAuthority{}
+	ca.Publisher = &mocks.Publisher{}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	test.AssertNotError(t, err, "Failed to generate key")
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{"not-example.com"}}, key)
+	test.AssertNotError(t, err, "Failed to create CSR")
+	csr, err := x509.ParseCertificateRequest(der)
+	test.AssertNotError(t, err, "Failed to parse CSR")
+	issue := func(profile string) *x509.Certificate {
+		cert, err := ca.IssueCertificate(context.Background(), *csr, 1, profile, core.Validity{})
+		test.AssertNotError(t, err, "Failed to issue certificate")
+		parsed, err := x509.ParseCertificate(cert.DER)
+		test.AssertNotError(t, err, "Failed to parse certificate")
+		return parsed
+	}
+
+	// The OCSP URL is left out of short-lived certificates only
+	parsed := issue("short")
+	test.AssertEquals(t, len(parsed.OCSPServer), 0)
+	test.AssertEquals(t, len(parsed.IssuingCertificateURL), 1)
+	test.Assert(t, core.IsShortLived(parsed), "Short-lived certificate isn't")
+	parsed = issue("")
+	test.AssertEquals(t, len(parsed.OCSPServer), 1)
+	test.Assert(t, !core.IsShortLived(parsed), "Long-lived certificate is short-lived")
+}
+
+func TestMustStapleProfiles(t *testing.T) {
+	config := urlTestConfig()
+	config.IssuerURLs = nil
+	staple := *config.CFSSL.Signing.Profiles[profileName]
+	config.CFSSL.Signing.Profiles["staple"] = &staple
+	config.Profiles = []string{"staple"}
+	stats := mocks.NewStatter()
+
+	config.MustStapleProfiles = []string{"missing"}
+	_, err := NewCertificateAuthorityImpl(config, clock.NewFake(), &stats, caCert, caKey)
+	test.AssertError(t, err, "CA accepted must-staple for an unknown profile")
+	config.MustStapleProfiles = []string{"staple"}
+	ca, err := NewCertificateAuthorityImpl(config, clock.NewFake(), &stats, caCert, caKey)
+	test.AssertNotError(t, err, "Failed to create CA with a must-staple profile")
+	ca.PA = allowingPA{}
+	ca.SA = &mocks.StorageAuthority{}
+	ca.Publisher = &mocks.Publisher{}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	test.AssertNotError(t, err, "Failed to generate key")
+	makeCSR := func(features ...int) x509.CertificateRequest {
+		template := &x509.CertificateRequest{DNSNames: []string{"not-example.com"}}
+		if len(features) > 0 {
+			value, err := asn1.Marshal(features)
+			test.AssertNotError(t, err, "Failed to marshal TLS Features")
+			template.ExtraExtensions = []pkix.Extension{{Id: oidTLSFeature, Value: value}}
+		}
+		der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+		test.AssertNotError(t, err, "Failed to create CSR")
+		csr, err := x509.ParseCertificateRequest(der)
+		test.AssertNotError(t, err, "Failed to parse CSR")
+		return *csr
+	}
+	hasMustStaple := func(cert core.Certificate) bool {
+		parsed, err := x509.ParseCertificate(cert.DER)
+		test.AssertNotError(t, err, "Failed to parse certificate")
+		for _, ext := range parsed.Extensions {
+			if ext.Id.Equal(oidTLSFeature) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Must-staple is refused under profiles that don't allow it, and only
+	// OCSP stapling may be requested
+	_, err = ca.IssueCertificate(context.Background(), makeCSR(tlsFeatureStatusRequest), 1, "", core.Validity{})
+	test.AssertError(t, err, "Issued a must-staple certificate under the default profile")
+	_, ok := err.(core.MalformedRequestError)
+	test.Assert(t, ok, "Refused must-staple wasn't a malformed request")
+	_, err = ca.IssueCertificate(context.Background(), makeCSR(17), 1, "staple", core.Validity{})
+	test.AssertError(t, err, "Issued a certificate with an unsupported TLS Feature")
+
+	cert, err := ca.IssueCertificate(context.Background(), makeCSR(tlsFeatureStatusRequest), 1, "staple", core.Validity{})
+	test.AssertNotError(t, err, "Failed to issue a must-staple certificate")
+	test.Assert(t, hasMustStaple(cert), "Must-staple wasn't copied into the certificate")
+	cert, err = ca.IssueCertificate(context.Background(), makeCSR(), 1, "staple", core.Validity{})
+	test.AssertNotError(t, err, "Failed to issue under a must-staple profile")
+	test.Assert(t, !hasMustStaple(cert), "Must-staple added to a certificate that didn't request it")
+}
+
 func TestFailNoSerial(t *testing.T) {
 	ctx := setup(t)
 	defer ctx.cleanUp()
@@ -250,7 +477,7 @@ func TestIssueCertificate(t *testing.T) {
 		csr, _ := x509.ParseCertificateRequest(csrDER)
 
 		// Sign CSR
-		issuedCert, err := ca.IssueCertificate(*csr, ctx.reg.ID)
+		issuedCert, err := ca.IssueCertificate(context.Background(), *csr, ctx.reg.ID, "", core.Validity{})
 		test.AssertNotError(t, err, "Failed to sign certificate")
 		if err != nil {
 			continue
@@ -291,12 +518,12 @@ func TestIssueCertificate(t *testing.T) {
 
 		// Verify that the cert got stored in the DB
 		serialString := core.SerialToString(cert.SerialNumber)
-		storedCert, err := ctx.sa.GetCertificate(serialString)
+		storedCert, err := ctx.sa.GetCertificate(context.Background(), serialString)
 		test.AssertNotError(t, err,
 			fmt.Sprintf("Certificate %s not found in database", serialString))
 		test.Assert(t, bytes.Equal(issuedCert.DER, storedCert.DER), "Retrieved cert not equal to issued cert.")
 
-		certStatus, err := ctx.sa.GetCertificateStatus(serialString)
+		certStatus, err := ctx.sa.GetCertificateStatus(context.Background(), serialString)
 		test.AssertNotError(t, err,
 			fmt.Sprintf("Error fetching status for certificate %s", serialString))
 		test.Assert(t, certStatus.Status == core.OCSPStatusGood, "Certificate status was not good")
@@ -315,7 +542,7 @@ func TestRejectNoName(t *testing.T) {
 
 	// Test that the CA rejects CSRs with no names
 	csr, _ := x509.ParseCertificateRequest(NoNameCSR)
-	_, err = ca.IssueCertificate(*csr, ctx.reg.ID)
+	_, err = ca.IssueCertificate(context.Background(), *csr, ctx.reg.ID, "", core.Validity{})
 	test.AssertError(t, err, "CA improperly agreed to create a certificate with no name")
 	_, ok := err.(core.MalformedRequestError)
 	test.Assert(t, ok, "Incorrect error type returned")
@@ -332,7 +559,7 @@ func TestRejectTooManyNames(t *testing.T) {
 
 	// Test that the CA rejects a CSR with too many names
 	csr, _ := x509.ParseCertificateRequest(TooManyNameCSR)
-	_, err = ca.IssueCertificate(*csr, ctx.reg.ID)
+	_, err = ca.IssueCertificate(context.Background(), *csr, ctx.reg.ID, "", core.Validity{})
 	test.AssertError(t, err, "Issued certificate with too many names")
 	_, ok := err.(core.MalformedRequestError)
 	test.Assert(t, ok, "Incorrect error type returned")
@@ -349,7 +576,7 @@ func TestDeduplication(t *testing.T) {
 
 	// Test that the CA collapses duplicate names
 	csr, _ := x509.ParseCertificateRequest(DupeNameCSR)
-	cert, err := ca.IssueCertificate(*csr, ctx.reg.ID)
+	cert, err := ca.IssueCertificate(context.Background(), *csr, ctx.reg.ID, "", core.Validity{})
 	test.AssertNotError(t, err, "Failed to gracefully handle a CSR with duplicate names")
 
 	parsedCert, err := x509.ParseCertificate(cert.DER)
@@ -373,13 +600,48 @@ func TestRejectValidityTooLong(t *testing.T) {
 
 	// Test that the CA rejects CSRs that would expire after the intermediate cert
 	csr, _ := x509.ParseCertificateRequest(NoCNCSR)
-	ca.notAfter = ctx.fc.Now()
-	_, err = ca.IssueCertificate(*csr, 1)
+	ca.defaultIssuer.notAfter = ctx.fc.Now()
+	_, err = ca.IssueCertificate(context.Background(), *csr, 1, "", core.Validity{})
 	test.AssertEquals(t, err.Error(), "Cannot issue a certificate that expires after the intermediate certificate.")
 	_, ok := err.(core.InternalServerError)
 	test.Assert(t, ok, "Incorrect error type returned")
 }
 
+func TestRequestedValidity(t *testing.T) {
+	fc := clock.NewFake()
+	ca := &CertificateAuthorityImpl{clk: fc}
+	now := fc.Now()
+	period := 90 * 24 * time.Hour
+
+	testCases := []struct {
+		requested core.Validity
+		expected  core.Validity
+		valid     bool
+	}{
+		// A missing end is filled in from the profile's period
+		{core.Validity{NotBefore: now.Add(time.Hour)}, core.Validity{NotBefore: now.Add(time.Hour), NotAfter: now.Add(time.Hour + period)}, true},
+		{core.Validity{NotAfter: now.Add(24 * time.Hour)}, core.Validity{NotBefore: now, NotAfter: now.Add(24 * time.Hour)}, true},
+		{core.Validity{NotBefore: now.Add(-time.Hour), NotAfter: now.Add(period - time.Hour)}, core.Validity{NotBefore: now.Add(-time.Hour), NotAfter: now.Add(period - time.Hour)}, true},
+		// Backdated too far
+		{core.Validity{NotBefore: now.Add(-2 * time.Hour)}, core.Validity{}, false},
+		// Ends before it starts
+		{core.Validity{NotBefore: now.Add(time.Hour), NotAfter: now}, core.Validity{}, false},
+		// Longer than the profile allows
+		{core.Validity{NotBefore: now, NotAfter: now.Add(period + time.Second)}, core.Validity{}, false},
+	}
+	for i, tc := range testCases {
+		validity, err := ca.requestedValidity(tc.requested, period)
+		if !tc.valid {
+			_, ok := err.(core.MalformedRequestError)
+			test.Assert(t, ok, fmt.Sprintf("Case %d: expected a MalformedRequestError, got %v", i, err))
+			continue
+		}
+		test.AssertNotError(t, err, fmt.Sprintf("Case %d: rejected requested validity", i))
+		test.Assert(t, validity.NotBefore.Equal(tc.expected.NotBefore), fmt.Sprintf("Case %d: wrong notBefore %s", i, validity.NotBefore))
+		test.Assert(t, validity.NotAfter.Equal(tc.expected.NotAfter), fmt.Sprintf("Case %d: wrong notAfter %s", i, validity.NotAfter))
+	}
+}
+
 func TestShortKey(t *testing.T) {
 	ctx := setup(t)
 	defer ctx.cleanUp()
@@ -390,10 +652,37 @@ func TestShortKey(t *testing.T) {
 
 	// Test that the CA rejects CSRs that would expire after the intermediate cert
 	csr, _ := x509.ParseCertificateRequest(ShortKeyCSR)
-	_, err = ca.IssueCertificate(*csr, ctx.reg.ID)
+	_, err = ca.IssueCertificate(context.Background(), *csr, ctx.reg.ID, "", core.Validity{})
 	test.AssertError(t, err, "Issued a certificate with too short a key.")
-	_, ok := err.(core.MalformedRequestError)
+	prob, ok := err.(*probs.ProblemDetails)
+	test.Assert(t, ok, "Incorrect error type returned")
+	test.AssertEquals(t, prob.Type, probs.BadPublicKeyProblem)
+}
+
+func TestBlockedKey(t *testing.T) {
+	ctx := setup(t)
+	defer ctx.cleanUp()
+	ca, err := NewCertificateAuthorityImpl(ctx.caConfig, ctx.fc, ctx.stats, caCert, caKey)
+	ca.Publisher = &mocks.Publisher{}
+	ca.PA = ctx.pa
+	ca.SA = ctx.sa
+
+	csr, _ := x509.ParseCertificateRequest(CNandSANCSR)
+	keyHash, err := core.KeyDigest(csr.PublicKey)
+	test.AssertNotError(t, err, "Failed to digest CSR key")
+	ca.BlockedKeys = core.BlockedKeys{keyHash: true}
+	_, err = ca.IssueCertificate(context.Background(), *csr, ctx.reg.ID, "", core.Validity{})
+	test.AssertError(t, err, "Issued a certificate for a blocked key")
+	prob, ok := err.(*probs.ProblemDetails)
 	test.Assert(t, ok, "Incorrect error type returned")
+	test.AssertEquals(t, prob.Type, probs.BadPublicKeyProblem)
+
+	// Keys blocked in the SA are refused too
+	ca.BlockedKeys = nil
+	err = ctx.sa.AddBlockedKey(context.Background(), keyHash, "root")
+	test.AssertNotError(t, err, "Failed to block key in the SA")
+	_, err = ca.IssueCertificate(context.Background(), *csr, ctx.reg.ID, "", core.Validity{})
+	test.AssertError(t, err, "Issued a certificate for a key blocked in the SA")
 }
 
 func TestRejectBadAlgorithm(t *testing.T) {
@@ -406,7 +695,7 @@ func TestRejectBadAlgorithm(t *testing.T) {
 
 	// Test that the CA rejects CSRs that would expire after the intermediate cert
 	csr, _ := x509.ParseCertificateRequest(BadAlgorithmCSR)
-	_, err = ca.IssueCertificate(*csr, ctx.reg.ID)
+	_, err = ca.IssueCertificate(context.Background(), *csr, ctx.reg.ID, "", core.Validity{})
 	test.AssertError(t, err, "Issued a certificate based on a CSR with a weak algorithm.")
 	_, ok := err.(core.MalformedRequestError)
 	test.Assert(t, ok, "Incorrect error type returned")
@@ -422,7 +711,7 @@ func TestCapitalizedLetters(t *testing.T) {
 	ca.SA = ctx.sa
 
 	csr, _ := x509.ParseCertificateRequest(CapitalizedCSR)
-	cert, err := ca.IssueCertificate(*csr, ctx.reg.ID)
+	cert, err := ca.IssueCertificate(context.Background(), *csr, ctx.reg.ID, "", core.Validity{})
 	test.AssertNotError(t, err, "Failed to gracefully handle a CSR with capitalized names")
 
 	parsedCert, err := x509.ParseCertificate(cert.DER)
@@ -444,54 +733,54 @@ func TestHSMFaultTimeout(t *testing.T) {
 
 	// Issue a certificate so that we can use it later
 	csr, _ := x509.ParseCertificateRequest(CNandSANCSR)
-	cert, err := ca.IssueCertificate(*csr, ctx.reg.ID)
+	cert, err := ca.IssueCertificate(context.Background(), *csr, ctx.reg.ID, "", core.Validity{})
 	ocspRequest := core.OCSPSigningRequest{
 		CertDER: cert.DER,
 		Status:  "good",
 	}
 
 	// Swap in a bad signer
-	goodSigner := ca.signer
+	goodSigner := ca.defaultIssuer.signer
 	badHSMErrorMessage := "This is really serious.  You should wait"
 	badSigner := mocks.BadHSMSigner(badHSMErrorMessage)
 	badOCSPSigner := mocks.BadHSMOCSPSigner(badHSMErrorMessage)
 
 	// Cause the CA to enter the HSM fault condition
-	ca.signer = badSigner
-	_, err = ca.IssueCertificate(*csr, ctx.reg.ID)
+	ca.defaultIssuer.signer = badSigner
+	_, err = ca.IssueCertificate(context.Background(), *csr, ctx.reg.ID, "", core.Validity{})
 	test.AssertError(t, err, "CA failed to return HSM error")
 	test.AssertEquals(t, err.Error(), badHSMErrorMessage)
 
 	// Check that the CA rejects the next call as the HSM being down
-	_, err = ca.IssueCertificate(*csr, ctx.reg.ID)
+	_, err = ca.IssueCertificate(context.Background(), *csr, ctx.reg.ID, "", core.Validity{})
 	test.AssertError(t, err, "CA failed to persist HSM fault")
 	test.AssertEquals(t, err.Error(), "HSM is unavailable")
 
-	_, err = ca.GenerateOCSP(ocspRequest)
+	_, err = ca.GenerateOCSP(context.Background(), ocspRequest)
 	test.AssertError(t, err, "CA failed to persist HSM fault")
 	test.AssertEquals(t, err.Error(), "HSM is unavailable")
 
 	// Swap in a good signer and move the clock forward to clear the fault
-	ca.signer = goodSigner
+	ca.defaultIssuer.signer = goodSigner
 	ctx.fc.Add(ca.hsmFaultTimeout)
 	ctx.fc.Add(10 * time.Second)
 
 	// Check that the CA has recovered
-	_, err = ca.IssueCertificate(*csr, ctx.reg.ID)
+	_, err = ca.IssueCertificate(context.Background(), *csr, ctx.reg.ID, "", core.Validity{})
 	test.AssertNotError(t, err, "CA failed to recover from HSM fault")
-	_, err = ca.GenerateOCSP(ocspRequest)
+	_, err = ca.GenerateOCSP(context.Background(), ocspRequest)
 
 	// Check that GenerateOCSP can also trigger an HSM failure, in the same way
-	ca.ocspSigner = badOCSPSigner
-	_, err = ca.GenerateOCSP(ocspRequest)
+	ca.defaultIssuer.ocspSigner = badOCSPSigner
+	_, err = ca.GenerateOCSP(context.Background(), ocspRequest)
 	test.AssertError(t, err, "CA failed to return HSM error")
 	test.AssertEquals(t, err.Error(), badHSMErrorMessage)
 
-	_, err = ca.IssueCertificate(*csr, ctx.reg.ID)
+	_, err = ca.IssueCertificate(context.Background(), *csr, ctx.reg.ID, "", core.Validity{})
 	test.AssertError(t, err, "CA failed to persist HSM fault")
 	test.AssertEquals(t, err.Error(), "HSM is unavailable")
 
-	_, err = ca.GenerateOCSP(ocspRequest)
+	_, err = ca.GenerateOCSP(context.Background(), ocspRequest)
 	test.AssertError(t, err, "CA failed to persist HSM fault")
 	test.AssertEquals(t, err.Error(), "HSM is unavailable")
 
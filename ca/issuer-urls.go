@@ -0,0 +1,124 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ca
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	cfsslConfig "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/config"
+	"github.com/letsencrypt/boulder/cmd"
+)
+
+// Placeholders that may appear in the issuer and OCSP URL templates
+const (
+	issuerIDPlaceholder = "{issuer-id}"
+	serialPlaceholder   = "{serial}"
+)
+
+// lookupHost resolves the hosts of the issuer and OCSP URLs at startup. It's a
+// variable so that tests can run without DNS.
+var lookupHost = net.LookupHost
+
+// issuerURLs holds the AIA CA Issuers and OCSP URLs a CA puts in the
+// certificates it issues, with the issuer ID already filled in.
+type issuerURLs struct {
+	issuers []string
+	ocsp    string
+	noOCSP  map[string]bool // Short-lived profiles, which get no OCSP URL
+}
+
+// newIssuerURLs fills the issuer ID into the URL templates in config and
+// checks that the results are usable URLs. It returns nil if config doesn't
+// override the profile's URLs.
+func newIssuerURLs(config cmd.CAConfig) (*issuerURLs, error) {
+	if len(config.IssuerURLs) == 0 && config.OCSPURL == "" {
+		return nil, nil
+	}
+
+	fill := func(template string) (string, error) {
+		if strings.Contains(template, issuerIDPlaceholder) && config.IssuerID == "" {
+			return "", fmt.Errorf("URL template %q uses %s but no IssuerID is configured", template, issuerIDPlaceholder)
+		}
+		filled := strings.Replace(template, issuerIDPlaceholder, config.IssuerID, -1)
+		// Any serial will do for checking the URL
+		if err := validateURL(strings.Replace(filled, serialPlaceholder, "00", -1)); err != nil {
+			return "", err
+		}
+		return filled, nil
+	}
+
+	urls := &issuerURLs{noOCSP: make(map[string]bool)}
+	for _, name := range config.ShortLivedProfiles {
+		urls.noOCSP[name] = true
+	}
+	for _, template := range config.IssuerURLs {
+		u, err := fill(template)
+		if err != nil {
+			return nil, err
+		}
+		urls.issuers = append(urls.issuers, u)
+	}
+	if config.OCSPURL != "" {
+		u, err := fill(config.OCSPURL)
+		if err != nil {
+			return nil, err
+		}
+		urls.ocsp = u
+	}
+	return urls, nil
+}
+
+// validateURL checks that u is an absolute HTTP URL whose host resolves.
+func validateURL(u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("Invalid URL %q: %s", u, err)
+	}
+	if parsed.Scheme != "http" {
+		return fmt.Errorf("URL %q must use the http scheme", u)
+	}
+	host := parsed.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "" {
+		return fmt.Errorf("URL %q has no host", u)
+	}
+	if _, err := lookupHost(host); err != nil {
+		return fmt.Errorf("Host of URL %q doesn't resolve: %s", u, err)
+	}
+	return nil
+}
+
+// perSerial returns true if the URLs differ from one certificate to the next.
+func (urls *issuerURLs) perSerial() bool {
+	if strings.Contains(urls.ocsp, serialPlaceholder) {
+		return true
+	}
+	for _, u := range urls.issuers {
+		if strings.Contains(u, serialPlaceholder) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply sets the URLs of profile, named name, to those for the certificate
+// with the given hex serial number.
+func (urls *issuerURLs) apply(name string, profile *cfsslConfig.SigningProfile, serial string) {
+	if len(urls.issuers) > 0 {
+		profile.IssuerURL = make([]string, len(urls.issuers))
+		for i, u := range urls.issuers {
+			profile.IssuerURL[i] = strings.Replace(u, serialPlaceholder, serial, -1)
+		}
+	}
+	if urls.ocsp != "" && !urls.noOCSP[name] {
+		profile.OCSP = strings.Replace(urls.ocsp, serialPlaceholder, serial, -1)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ca
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	cfsslConfig "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/config"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/signer"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func fakeLookupHost(host string) ([]string, error) {
+	if strings.HasSuffix(host, ".invalid") {
+		return nil, errors.New("no such host")
+	}
+	return []string{"127.0.0.1"}, nil
+}
+
+func TestNewIssuerURLs(t *testing.T) {
+	lookupHost = fakeLookupHost
+
+	urls, err := newIssuerURLs(cmd.CAConfig{})
+	test.AssertNotError(t, err, "Failed with no URLs")
+	test.Assert(t, urls == nil, "Got URLs when none were configured")
+
+	urls, err = newIssuerURLs(cmd.CAConfig{
+		IssuerURLs: []string{"http://example.com/{issuer-id}/cert", "http://example.com:8080/{issuer-id}"},
+		OCSPURL:    "http://ocsp.example.com/{issuer-id}/{serial}",
+		IssuerID:   "x1",
+	})
+	test.AssertNotError(t, err, "Failed with valid URLs")
+	test.AssertEquals(t, len(urls.issuers), 2)
+	test.AssertEquals(t, urls.issuers[0], "http://example.com/x1/cert")
+	test.AssertEquals(t, urls.issuers[1], "http://example.com:8080/x1")
+	test.AssertEquals(t, urls.ocsp, "http://ocsp.example.com/x1/{serial}")
+	test.Assert(t, urls.perSerial(), "OCSP URL should differ per serial")
+
+	var profile cfsslConfig.SigningProfile
+	urls.apply("", &profile, "ff01")
+	test.AssertEquals(t, profile.IssuerURL[0], "http://example.com/x1/cert")
+	test.AssertEquals(t, profile.OCSP, "http://ocsp.example.com/x1/ff01")
+
+	testCases := []struct {
+		config  cmd.CAConfig
+		problem string
+	}{
+		{cmd.CAConfig{OCSPURL: "http://example.com/{issuer-id}"}, "no IssuerID is configured"},
+		{cmd.CAConfig{OCSPURL: "https://example.com/"}, "must use the http scheme"},
+		{cmd.CAConfig{IssuerURLs: []string{"/issuer-cert"}}, "must use the http scheme"},
+		{cmd.CAConfig{IssuerURLs: []string{"http:///issuer-cert"}}, "has no host"},
+		{cmd.CAConfig{OCSPURL: "http://ocsp.example.invalid/"}, "doesn't resolve"},
+	}
+	for _, tc := range testCases {
+		_, err := newIssuerURLs(tc.config)
+		test.AssertError(t, err, "Bad URLs were accepted")
+		test.Assert(t, strings.Contains(err.Error(), tc.problem), "Unexpected error: "+err.Error())
+	}
+}
+
+func urlTestConfig() cmd.CAConfig {
+	return cmd.CAConfig{
+		Profile:      profileName,
+		SerialPrefix: 17,
+		Expiry:       "8760h",
+		LifespanOCSP: "45m",
+		IssuerURLs:   []string{"http://example.com/{issuer-id}/cert"},
+		IssuerID:     "x1",
+		CFSSL: cfsslConfig.Config{
+			Signing: &cfsslConfig.Signing{
+				Profiles: map[string]*cfsslConfig.SigningProfile{
+					profileName: &cfsslConfig.SigningProfile{
+						Usage:        []string{"server auth"},
+						IssuerURL:    []string{"http://not-example.com/issuer-url"},
+						OCSP:         "http://not-example.com/ocsp",
+						ExpiryString: "8760h",
+						Backdate:     time.Hour,
+						CSRWhitelist: &cfsslConfig.CSRWhitelist{
+							PublicKeyAlgorithm: true,
+							PublicKey:          true,
+							SignatureAlgorithm: true,
+						},
+					},
+				},
+				Default: &cfsslConfig.SigningProfile{
+					ExpiryString: "8760h",
+				},
+			},
+		},
+	}
+}
+
+func signWithURLs(t *testing.T, config cmd.CAConfig, serial int64) *x509.Certificate {
+	stats := mocks.NewStatter()
+	ca, err := NewCertificateAuthorityImpl(config, clock.NewFake(), &stats, caCert, caKey)
+	test.AssertNotError(t, err, "Failed to create CA")
+
+	serialBig := big.NewInt(serial)
+	certSigner, err := ca.defaultIssuer.signerForSerial(serialBig.Text(16), profileName, core.Validity{}, nil)
+	test.AssertNotError(t, err, "Failed to get signer")
+	certPEM, err := certSigner.Sign(signer.SignRequest{
+		Request: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: CNandSANCSR})),
+		Profile: profileName,
+		Hosts:   []string{"not-example.com"},
+		Serial:  serialBig,
+	})
+	test.AssertNotError(t, err, "Failed to sign certificate")
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	test.AssertNotError(t, err, "Failed to parse certificate")
+	return cert
+}
+
+func TestIssuerURLTemplates(t *testing.T) {
+	lookupHost = fakeLookupHost
+
+	// URLs without a serial are filled into the profile once
+	cert := signWithURLs(t, urlTestConfig(), 0x1234)
+	test.AssertEquals(t, len(cert.IssuingCertificateURL), 1)
+	test.AssertEquals(t, cert.IssuingCertificateURL[0], "http://example.com/x1/cert")
+	test.AssertEquals(t, len(cert.OCSPServer), 1)
+	test.AssertEquals(t, cert.OCSPServer[0], "http://not-example.com/ocsp")
+
+	// URLs with a serial differ per certificate
+	config := urlTestConfig()
+	config.OCSPURL = "http://ocsp.example.com/{issuer-id}/{serial}"
+	cert = signWithURLs(t, config, 0x1234)
+	test.AssertEquals(t, cert.IssuingCertificateURL[0], "http://example.com/x1/cert")
+	test.AssertEquals(t, cert.OCSPServer[0], "http://ocsp.example.com/x1/1234")
+	cert = signWithURLs(t, config, 0x5678)
+	test.AssertEquals(t, cert.OCSPServer[0], "http://ocsp.example.com/x1/5678")
+
+	// The configured profile must exist
+	config.Profile = "nonexistent"
+	stats := mocks.NewStatter()
+	_, err := NewCertificateAuthorityImpl(config, clock.NewFake(), &stats, caCert, caKey)
+	test.AssertError(t, err, "CA accepted URLs for a missing profile")
+}
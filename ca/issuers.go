@@ -0,0 +1,285 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ca
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"strings"
+	"time"
+
+	cfsslConfig "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/config"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/ocsp"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/signer"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/signer/local"
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/identifier"
+)
+
+// Key types an issuer's KeyTypes may name
+const (
+	keyTypeRSA   = "RSA"
+	keyTypeECDSA = "ECDSA"
+)
+
+// issuer is an intermediate the CA signs certificates and OCSP responses
+// with, and the rules for which certificates it's chosen to sign. A rule
+// that's empty allows anything.
+type issuer struct {
+	name          string // The IssuerID, or subject common name if none
+	cert          *x509.Certificate
+	privateKey    crypto.Signer
+	signer        signer.Signer
+	ocspSigner    ocsp.Signer
+	signingPolicy *cfsslConfig.Signing
+	issuerURLs    *issuerURLs // Set if the URLs differ per certificate
+	notAfter      time.Time
+
+	keyTypes map[string]bool
+	profiles map[string]bool
+	names    []string
+}
+
+// newIssuer makes an issuer of cert and privateKey, signing under a copy of
+// policy whose profiles named by profiles have urls, if set, filled in.
+func newIssuer(name string, cert *x509.Certificate, privateKey crypto.Signer, policy *cfsslConfig.Signing, profiles []string, urls *issuerURLs, lifespanOCSP time.Duration) (*issuer, error) {
+	if name == "" {
+		name = cert.Subject.CommonName
+	}
+	policy = copySigningPolicy(policy)
+	if urls != nil {
+		for _, profileName := range profiles {
+			profile, ok := policy.Profiles[profileName]
+			if !ok {
+				return nil, fmt.Errorf("Issuer URLs are configured, but profile %q doesn't exist", profileName)
+			}
+			// URLs that differ per certificate are filled in by signerForSerial
+			if !urls.perSerial() {
+				urls.apply(profileName, profile, "")
+			}
+		}
+		if !urls.perSerial() {
+			urls = nil
+		}
+	}
+
+	certSigner, err := local.NewSigner(privateKey, cert, signatureAlgorithm(privateKey), policy)
+	if err != nil {
+		return nil, err
+	}
+	// The issuer cert is also the OCSP signing cert
+	ocspSigner, err := ocsp.NewSigner(cert, cert, privateKey, lifespanOCSP)
+	if err != nil {
+		return nil, err
+	}
+	return &issuer{
+		name:          name,
+		cert:          cert,
+		privateKey:    privateKey,
+		signer:        certSigner,
+		ocspSigner:    ocspSigner,
+		signingPolicy: policy,
+		issuerURLs:    urls,
+		notAfter:      cert.NotAfter,
+	}, nil
+}
+
+// copySigningPolicy copies policy and its profiles, so that one issuer's URLs
+// can be filled into them without changing another's.
+func copySigningPolicy(policy *cfsslConfig.Signing) *cfsslConfig.Signing {
+	c := *policy
+	c.Profiles = make(map[string]*cfsslConfig.SigningProfile, len(policy.Profiles))
+	for name, profile := range policy.Profiles {
+		p := *profile
+		c.Profiles[name] = &p
+	}
+	return &c
+}
+
+// signatureAlgorithm returns the algorithm an issuer with privateKey signs
+// with: SHA-256 for RSA keys, whatever their size, and the hash matching the
+// curve for ECDSA keys.
+func signatureAlgorithm(privateKey crypto.Signer) x509.SignatureAlgorithm {
+	if _, ok := privateKey.Public().(*rsa.PublicKey); ok {
+		return x509.SHA256WithRSA
+	}
+	return signer.DefaultSigAlgo(privateKey)
+}
+
+// setRules sets the rules of iss from config, checking that they name key
+// types there are and profiles the CA has.
+func (iss *issuer) setRules(config cmd.IssuerConfig, profiles map[string]time.Duration) error {
+	if len(config.KeyTypes) > 0 {
+		iss.keyTypes = make(map[string]bool)
+	}
+	for _, keyType := range config.KeyTypes {
+		if keyType != keyTypeRSA && keyType != keyTypeECDSA {
+			return fmt.Errorf("Issuer %q has unknown key type %q", iss.name, keyType)
+		}
+		iss.keyTypes[keyType] = true
+	}
+	if len(config.Profiles) > 0 {
+		iss.profiles = make(map[string]bool)
+	}
+	for _, profile := range config.Profiles {
+		if _, ok := profiles[profile]; !ok {
+			return fmt.Errorf("Issuer %q has unknown profile %q", iss.name, profile)
+		}
+		iss.profiles[profile] = true
+	}
+	for _, name := range config.Names {
+		name = strings.TrimSuffix(strings.ToLower(name), ".")
+		if name == "" {
+			return fmt.Errorf("Issuer %q has an empty name", iss.name)
+		}
+		iss.names = append(iss.names, name)
+	}
+	return nil
+}
+
+// selects reports whether the rules of iss allow it to sign a certificate
+// under profile for key and every one of identifiers: the key must be of one
+// of its key types, the profile one of its profiles, and the domain of each
+// identifier one of its names or under one.
+func (iss *issuer) selects(profile string, key crypto.PublicKey, identifiers []identifier.ACMEIdentifier) bool {
+	if iss.keyTypes != nil {
+		var keyType string
+		switch key.(type) {
+		case *rsa.PublicKey:
+			keyType = keyTypeRSA
+		case *ecdsa.PublicKey:
+			keyType = keyTypeECDSA
+		}
+		if !iss.keyTypes[keyType] {
+			return false
+		}
+	}
+	if iss.profiles != nil && !iss.profiles[profile] {
+		return false
+	}
+	if len(iss.names) == 0 {
+		return true
+	}
+	for _, id := range identifiers {
+		if !iss.coversDomain(id.Domain()) {
+			return false
+		}
+	}
+	return true
+}
+
+// coversDomain reports whether domain is one of the names of iss, or under
+// one.
+func (iss *issuer) coversDomain(domain string) bool {
+	for _, name := range iss.names {
+		if domain == name || strings.HasSuffix(domain, "."+name) {
+			return true
+		}
+	}
+	return false
+}
+
+// signerForSerial returns the signer to use for the certificate with the given
+// hex serial number and profile, which differs from iss.signer only in the
+// profile's issuer and OCSP URLs, in the validity period, if one was
+// requested, and in adding extensions.
+func (iss *issuer) signerForSerial(serial, profileName string, validity core.Validity, extensions []pkix.Extension) (signer.Signer, error) {
+	if iss.issuerURLs == nil && validity.IsZero() && len(extensions) == 0 {
+		return iss.signer, nil
+	}
+	profile := *iss.signingPolicy.Profiles[profileName]
+	if iss.issuerURLs != nil {
+		iss.issuerURLs.apply(profileName, &profile, serial)
+	}
+	if !validity.IsZero() {
+		// cfssl takes a profile's fixed validity period as it is, without
+		// backdating it
+		profile.NotBefore, profile.NotAfter = validity.NotBefore, validity.NotAfter
+	}
+	policy := *iss.signingPolicy
+	policy.Profiles = map[string]*cfsslConfig.SigningProfile{profileName: &profile}
+	certSigner, err := local.NewSigner(iss.privateKey, iss.cert, signatureAlgorithm(iss.privateKey), &policy)
+	if err != nil || len(extensions) == 0 {
+		return certSigner, err
+	}
+	return &extensionSigner{
+		Signer:     certSigner,
+		cert:       iss.cert,
+		privateKey: iss.privateKey,
+		extensions: extensions,
+	}, nil
+}
+
+// AddIssuer adds a further issuer, with certificate cert and private key
+// privateKey, that the CA chooses for the certificates the rules of config
+// allow. Issuers are tried in the order they're added, and the CA's own
+// issuer signs the certificates none is chosen for. Every issuer signs the
+// OCSP responses for the certificates it issued.
+func (ca *CertificateAuthorityImpl) AddIssuer(config cmd.IssuerConfig, cert *x509.Certificate, privateKey crypto.Signer) error {
+	var shortLived []string
+	for name := range ca.shortLived {
+		shortLived = append(shortLived, name)
+	}
+	urls, err := newIssuerURLs(cmd.CAConfig{
+		IssuerURLs:         ca.issuerURLTemplates,
+		OCSPURL:            ca.ocspURLTemplate,
+		IssuerID:           config.IssuerID,
+		ShortLivedProfiles: shortLived,
+	})
+	if err != nil {
+		return err
+	}
+	var profiles []string
+	for name := range ca.profiles {
+		profiles = append(profiles, name)
+	}
+	iss, err := newIssuer(config.IssuerID, cert, privateKey, ca.signingPolicy, profiles, urls, ca.lifespanOCSP)
+	if err != nil {
+		return err
+	}
+	if err := iss.setRules(config, ca.profiles); err != nil {
+		return err
+	}
+	if iss.name == ca.defaultIssuer.name {
+		return fmt.Errorf("Issuer %q is already configured", iss.name)
+	}
+	for _, other := range ca.issuers {
+		if other.name == iss.name {
+			return fmt.Errorf("Issuer %q is already configured", iss.name)
+		}
+	}
+	ca.issuers = append(ca.issuers, iss)
+	return nil
+}
+
+// issuerFor returns the issuer to sign a certificate under profile for key
+// and identifiers: the first added whose rules allow it, or else the CA's
+// own.
+func (ca *CertificateAuthorityImpl) issuerFor(profile string, key crypto.PublicKey, identifiers []identifier.ACMEIdentifier) *issuer {
+	for _, iss := range ca.issuers {
+		if iss.selects(profile, key, identifiers) {
+			return iss
+		}
+	}
+	return ca.defaultIssuer
+}
+
+// issuerOf returns the issuer that signed cert, to sign its OCSP responses.
+// A certificate none of them signed is left to the CA's own issuer.
+func (ca *CertificateAuthorityImpl) issuerOf(cert *x509.Certificate) *issuer {
+	for _, iss := range ca.issuers {
+		if bytes.Equal(cert.RawIssuer, iss.cert.RawSubject) && cert.CheckSignatureFrom(iss.cert) == nil {
+			return iss
+		}
+	}
+	return ca.defaultIssuer
+}
@@ -0,0 +1,126 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/signer"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/identifier"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// makeIssuerCert makes a self-signed ECDSA intermediate named cn.
+func makeIssuerCert(t *testing.T, cn string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate issuer key")
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(100 * 365 * 24 * time.Hour),
+		SubjectKeyId:          []byte(cn),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	test.AssertNotError(t, err, "Failed to create issuer certificate")
+	cert, err := x509.ParseCertificate(der)
+	test.AssertNotError(t, err, "Failed to parse issuer certificate")
+	return cert, key
+}
+
+// signWith signs a certificate for not-example.com with iss.
+func signWith(t *testing.T, iss *issuer, serial int64) *x509.Certificate {
+	serialBig := big.NewInt(serial)
+	certSigner, err := iss.signerForSerial(serialBig.Text(16), profileName, core.Validity{}, nil)
+	test.AssertNotError(t, err, "Failed to get signer")
+	certPEM, err := certSigner.Sign(signer.SignRequest{
+		Request: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: CNandSANCSR})),
+		Profile: profileName,
+		Hosts:   []string{"not-example.com"},
+		Serial:  serialBig,
+	})
+	test.AssertNotError(t, err, "Failed to sign certificate")
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	test.AssertNotError(t, err, "Failed to parse certificate")
+	return cert
+}
+
+func TestMultipleIssuers(t *testing.T) {
+	lookupHost = fakeLookupHost
+	config := urlTestConfig()
+	short := *config.CFSSL.Signing.Profiles[profileName]
+	config.CFSSL.Signing.Profiles["short"] = &short
+	config.Profiles = []string{"short"}
+	stats := mocks.NewStatter()
+	ca, err := NewCertificateAuthorityImpl(config, clock.NewFake(), &stats, caCert, caKey)
+	test.AssertNotError(t, err, "Failed to create CA")
+
+	ecdsaCert, ecdsaKey := makeIssuerCert(t, "ECDSA Intermediate")
+	err = ca.AddIssuer(cmd.IssuerConfig{IssuerID: "e1", KeyTypes: []string{"ECDSA"}}, ecdsaCert, ecdsaKey)
+	test.AssertNotError(t, err, "Failed to add ECDSA issuer")
+	internalCert, internalKey := makeIssuerCert(t, "Internal Intermediate")
+	err = ca.AddIssuer(cmd.IssuerConfig{IssuerID: "i1", Profiles: []string{"short"}, Names: []string{"Internal.example"}}, internalCert, internalKey)
+	test.AssertNotError(t, err, "Failed to add internal issuer")
+
+	// Bad rules are refused, as is an issuer added twice
+	testCases := []cmd.IssuerConfig{
+		{IssuerID: "x2", KeyTypes: []string{"DSA"}},
+		{IssuerID: "x2", Profiles: []string{"nonexistent"}},
+		{IssuerID: "x2", Names: []string{""}},
+		{IssuerID: "e1"},
+		{IssuerID: "x1"},
+	}
+	for _, tc := range testCases {
+		err = ca.AddIssuer(tc, ecdsaCert, ecdsaKey)
+		test.AssertError(t, err, "Added an issuer with bad rules")
+	}
+
+	ecdsaSubject, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	rsaSubject := caKey.Public()
+	internal := []identifier.ACMEIdentifier{identifier.DNSName("a.internal.example"), identifier.DNSName("internal.example")}
+	mixed := append(internal, identifier.DNSName("not-example.com"))
+	public := []identifier.ACMEIdentifier{identifier.DNSName("not-example.com")}
+
+	// The first issuer whose rules allow the certificate is chosen, or else
+	// the CA's own
+	test.AssertEquals(t, ca.issuerFor(profileName, rsaSubject, public).name, "x1")
+	test.AssertEquals(t, ca.issuerFor(profileName, &ecdsaSubject.PublicKey, public).name, "e1")
+	test.AssertEquals(t, ca.issuerFor("short", &ecdsaSubject.PublicKey, internal).name, "e1")
+	test.AssertEquals(t, ca.issuerFor("short", rsaSubject, internal).name, "i1")
+	test.AssertEquals(t, ca.issuerFor(profileName, rsaSubject, internal).name, "x1")
+	test.AssertEquals(t, ca.issuerFor("short", rsaSubject, mixed).name, "x1")
+
+	// Each issuer fills in its own issuer ID, and OCSP responses are signed
+	// by the issuer of each certificate
+	ecdsaIssuer := ca.issuerFor(profileName, &ecdsaSubject.PublicKey, public)
+	cert := signWith(t, ecdsaIssuer, 0x1234)
+	test.AssertNotError(t, cert.CheckSignatureFrom(ecdsaCert), "Certificate not signed by the ECDSA issuer")
+	test.AssertEquals(t, cert.SignatureAlgorithm, x509.ECDSAWithSHA256)
+	test.AssertEquals(t, cert.IssuingCertificateURL[0], "http://example.com/e1/cert")
+	test.Assert(t, ca.issuerOf(cert) == ecdsaIssuer, "Wrong issuer for ECDSA-issued certificate")
+
+	cert = signWith(t, ca.defaultIssuer, 0x5678)
+	test.AssertNotError(t, cert.CheckSignatureFrom(caCert), "Certificate not signed by the CA's issuer")
+	test.AssertEquals(t, cert.IssuingCertificateURL[0], "http://example.com/x1/cert")
+	test.Assert(t, ca.issuerOf(cert) == ca.defaultIssuer, "Wrong issuer for certificate of the CA's issuer")
+}
@@ -0,0 +1,103 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/probs"
+)
+
+// keyCurves are the ECDSA curves that may be allowed, by name. core.GoodKey
+// rejects any others.
+var keyCurves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+}
+
+// allowedKeys is the key type, size and curve matrix of one profile.
+type allowedKeys struct {
+	rsaSizes map[int]bool
+	curves   map[string]bool
+}
+
+// newAllowedKeys checks the matrices of config, keyed by profile, against
+// the CA's profiles and what core.GoodKey accepts.
+func newAllowedKeys(config map[string]cmd.AllowedKeyTypes, profiles map[string]time.Duration) (map[string]*allowedKeys, error) {
+	allowed := make(map[string]*allowedKeys)
+	for profile, types := range config {
+		if _, ok := profiles[profile]; !ok {
+			return nil, fmt.Errorf("Allowed keys configured for unknown profile %q", profile)
+		}
+		if len(types.RSA) == 0 && len(types.ECDSA) == 0 {
+			return nil, fmt.Errorf("Profile %q allows no keys", profile)
+		}
+		ak := &allowedKeys{rsaSizes: make(map[int]bool), curves: make(map[string]bool)}
+		for _, size := range types.RSA {
+			if size < 2048 || size > 4096 || size%8 != 0 {
+				return nil, fmt.Errorf("Profile %q allows unacceptable RSA key size %d", profile, size)
+			}
+			ak.rsaSizes[size] = true
+		}
+		for _, curve := range types.ECDSA {
+			if _, ok := keyCurves[curve]; !ok {
+				return nil, fmt.Errorf("Profile %q allows unacceptable ECDSA curve %q", profile, curve)
+			}
+			ak.curves[curve] = true
+		}
+		allowed[profile] = ak
+	}
+	return allowed, nil
+}
+
+// check returns a badPublicKey problem naming the key type, size or curve
+// of key if profile doesn't issue for it.
+func (ak *allowedKeys) check(profile string, key crypto.PublicKey) *probs.ProblemDetails {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if len(ak.rsaSizes) == 0 {
+			return probs.BadPublicKey("Profile %q doesn't issue for RSA keys", profile)
+		}
+		if size := k.N.BitLen(); !ak.rsaSizes[size] {
+			var allowed []int
+			for s := range ak.rsaSizes {
+				allowed = append(allowed, s)
+			}
+			sort.Ints(allowed)
+			var sizes []string
+			for _, s := range allowed {
+				sizes = append(sizes, strconv.Itoa(s))
+			}
+			return probs.BadPublicKey("Profile %q doesn't issue for RSA keys of %d bits; allowed sizes are %s",
+				profile, size, strings.Join(sizes, ", "))
+		}
+	case *ecdsa.PublicKey:
+		if len(ak.curves) == 0 {
+			return probs.BadPublicKey("Profile %q doesn't issue for ECDSA keys", profile)
+		}
+		if curve := k.Params().Name; !ak.curves[curve] {
+			var curves []string
+			for c := range ak.curves {
+				curves = append(curves, c)
+			}
+			sort.Strings(curves)
+			return probs.BadPublicKey("Profile %q doesn't issue for ECDSA keys on curve %s; allowed curves are %s",
+				profile, curve, strings.Join(curves, ", "))
+		}
+	default:
+		return probs.BadPublicKey("Profile %q doesn't issue for %T keys", profile, key)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ca
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"strings"
+	"testing"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/probs"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestAllowedKeysConfig(t *testing.T) {
+	config := urlTestConfig()
+	config.IssuerURLs = nil
+	stats := mocks.NewStatter()
+
+	for _, allowed := range []map[string]cmd.AllowedKeyTypes{
+		{"unknown": {RSA: []int{2048}}},
+		{profileName: {}},
+		{profileName: {RSA: []int{1024}}},
+		{profileName: {RSA: []int{2047}}},
+		{profileName: {ECDSA: []string{"P-521"}}},
+	} {
+		config.AllowedKeys = allowed
+		_, err := NewCertificateAuthorityImpl(config, clock.NewFake(), &stats, caCert, caKey)
+		test.AssertError(t, err, "CA accepted a bad allowed keys matrix")
+	}
+	config.AllowedKeys = map[string]cmd.AllowedKeyTypes{
+		profileName: {RSA: []int{2048, 4096}, ECDSA: []string{"P-256"}},
+	}
+	_, err := NewCertificateAuthorityImpl(config, clock.NewFake(), &stats, caCert, caKey)
+	test.AssertNotError(t, err, "CA rejected a good allowed keys matrix")
+}
+
+func TestAllowedKeys(t *testing.T) {
+	config := urlTestConfig()
+	config.IssuerURLs = nil
+	ecdsaOnly := *config.CFSSL.Signing.Profiles[profileName]
+	config.CFSSL.Signing.Profiles["ecdsa"] = &ecdsaOnly
+	config.Profiles = []string{"ecdsa"}
+	config.AllowedKeys = map[string]cmd.AllowedKeyTypes{
+		profileName: {RSA: []int{2048, 4096}, ECDSA: []string{"P-256"}},
+		"ecdsa":     {ECDSA: []string{"P-256"}},
+	}
+	stats := mocks.NewStatter()
+	ca, err := NewCertificateAuthorityImpl(config, clock.NewFake(), &stats, caCert, caKey)
+	test.AssertNotError(t, err, "Failed to create CA")
+	ca.PA = allowingPA{}
+	ca.SA = &mocks.StorageAuthority{}
+	ca.Publisher = &mocks.Publisher{}
+
+	rsa2048, err := rsa.GenerateKey(rand.Reader, 2048)
+	test.AssertNotError(t, err, "Failed to generate key")
+	rsa3072, err := rsa.GenerateKey(rand.Reader, 3072)
+	test.AssertNotError(t, err, "Failed to generate key")
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	makeCSR := func(key crypto.Signer) x509.CertificateRequest {
+		der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{"example.com"}}, key)
+		test.AssertNotError(t, err, "Failed to create CSR")
+		csr, err := x509.ParseCertificateRequest(der)
+		test.AssertNotError(t, err, "Failed to parse CSR")
+		return *csr
+	}
+
+	for _, tc := range []struct {
+		profile string
+		key     crypto.Signer
+		problem string
+	}{
+		{"", rsa2048, ""},
+		{"", p256, ""},
+		{"", rsa3072, "RSA keys of 3072 bits; allowed sizes are 2048, 4096"},
+		{"", p384, "curve P-384; allowed curves are P-256"},
+		{"ecdsa", p256, ""},
+		{"ecdsa", rsa2048, `Profile "ecdsa" doesn't issue for RSA keys`},
+	} {
+		_, err := ca.IssueCertificate(context.Background(), makeCSR(tc.key), 1, tc.profile, core.Validity{})
+		if tc.problem == "" {
+			test.AssertNotError(t, err, "Failed to issue for an allowed key")
+			continue
+		}
+		prob, ok := err.(*probs.ProblemDetails)
+		test.Assert(t, ok, "Disallowed key wasn't a problem")
+		test.AssertEquals(t, prob.Type, probs.BadPublicKeyProblem)
+		test.Assert(t, strings.Contains(prob.Detail, tc.problem), "Problem doesn't name the offending parameter: "+prob.Detail)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ca
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/probs"
+)
+
+// issuanceQuotas enforces daily caps on the number of certificates issued,
+// both from the CA's issuer as a whole and under each profile, e.g. to limit
+// a new intermediate or profile to a trickle of certificates during rollout.
+// Days are UTC days, and the counts are kept by each CA instance, so with
+// several CAs the caps apply to each of them.
+type issuanceQuotas struct {
+	issuerLimit   int
+	profileLimits map[string]int
+	clk           clock.Clock
+	stats         statsd.Statter
+
+	mu            sync.Mutex
+	day           time.Time
+	issuerCount   int
+	profileCounts map[string]int
+}
+
+func newIssuanceQuotas(issuerLimit int, profileLimits map[string]int, clk clock.Clock, stats statsd.Statter) (*issuanceQuotas, error) {
+	if issuerLimit < 0 {
+		return nil, fmt.Errorf("Issuer daily quota must not be negative")
+	}
+	for profile, limit := range profileLimits {
+		if limit < 0 {
+			return nil, fmt.Errorf("Daily quota for profile %q must not be negative", profile)
+		}
+	}
+	return &issuanceQuotas{
+		issuerLimit:   issuerLimit,
+		profileLimits: profileLimits,
+		clk:           clk,
+		stats:         stats,
+		profileCounts: make(map[string]int),
+	}, nil
+}
+
+// rollover resets the counts when a new day starts. The caller must hold
+// q.mu.
+func (q *issuanceQuotas) rollover() {
+	today := q.clk.Now().UTC().Truncate(24 * time.Hour)
+	if !today.Equal(q.day) {
+		q.day = today
+		q.issuerCount = 0
+		q.profileCounts = make(map[string]int)
+	}
+}
+
+// reserve counts an issuance under profile against the quotas, returning an
+// overQuota problem if either the issuer's or the profile's quota for the day
+// is used up. If the issuance then fails, the caller should call the returned
+// function to give the reservation back.
+func (q *issuanceQuotas) reserve(profile string) (func(), error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rollover()
+
+	if q.issuerLimit > 0 && q.issuerCount >= q.issuerLimit {
+		q.stats.Inc("CA.Quota.Exceeded.Issuer", 1, 1.0)
+		return nil, probs.OverQuota(fmt.Sprintf("Daily issuance quota of %d certificates for this issuer has been reached", q.issuerLimit))
+	}
+	profileLimit := q.profileLimits[profile]
+	if profileLimit > 0 && q.profileCounts[profile] >= profileLimit {
+		q.stats.Inc(fmt.Sprintf("CA.Quota.Exceeded.Profile.%s", profile), 1, 1.0)
+		return nil, probs.OverQuota(fmt.Sprintf("Daily issuance quota of %d certificates for profile %q has been reached", profileLimit, profile))
+	}
+
+	q.issuerCount++
+	q.profileCounts[profile]++
+	q.stats.Gauge("CA.Quota.Used.Issuer", int64(q.issuerCount), 1.0)
+	q.stats.Gauge(fmt.Sprintf("CA.Quota.Used.Profile.%s", profile), int64(q.profileCounts[profile]), 1.0)
+
+	day := q.day
+	return func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		// Reservations from a previous day were reset already
+		if q.day.Equal(day) {
+			q.issuerCount--
+			q.profileCounts[profile]--
+		}
+	}, nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ca
+
+import (
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/probs"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestIssuanceQuotas(t *testing.T) {
+	fc := clock.NewFake()
+	stats := mocks.NewStatter()
+	q, err := newIssuanceQuotas(3, map[string]int{"ecdsa": 1}, fc, &stats)
+	test.AssertNotError(t, err, "Failed to create quotas")
+
+	// The profile quota is reached first
+	_, err = q.reserve("ecdsa")
+	test.AssertNotError(t, err, "First ecdsa issuance refused")
+	_, err = q.reserve("ecdsa")
+	test.AssertError(t, err, "Second ecdsa issuance allowed")
+	prob, ok := err.(*probs.ProblemDetails)
+	test.Assert(t, ok, "Quota error isn't a problem")
+	test.AssertEquals(t, prob.Type, probs.OverQuotaProblem)
+	test.AssertEquals(t, stats.Counters["CA.Quota.Exceeded.Profile.ecdsa"], int64(1))
+
+	// Then the issuer quota, across profiles
+	release, err := q.reserve("rsa")
+	test.AssertNotError(t, err, "rsa issuance refused")
+	_, err = q.reserve("rsa")
+	test.AssertNotError(t, err, "rsa issuance refused")
+	_, err = q.reserve("rsa")
+	test.AssertError(t, err, "Issuance over the issuer quota allowed")
+	test.AssertEquals(t, stats.Counters["CA.Quota.Exceeded.Issuer"], int64(1))
+
+	// Failed issuances give their reservation back
+	release()
+	_, err = q.reserve("rsa")
+	test.AssertNotError(t, err, "Released reservation not reusable")
+
+	// Quotas reset each day
+	fc.Add(24 * time.Hour)
+	_, err = q.reserve("ecdsa")
+	test.AssertNotError(t, err, "ecdsa issuance refused on a new day")
+
+	_, err = newIssuanceQuotas(-1, nil, fc, &stats)
+	test.AssertError(t, err, "Negative quota accepted")
+}
@@ -0,0 +1,117 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ca
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math"
+	"math/big"
+
+	cferr "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/errors"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/signer"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/signer/local"
+)
+
+// extensionSigner signs certificates as cfssl's local signer does, from the
+// CSR fields its profile allows, but adds extensions to each one, which
+// cfssl's SignRequest has no way to carry. It doesn't submit to CT logs
+// from its profiles, which Boulder leaves to the publisher.
+type extensionSigner struct {
+	*local.Signer
+	cert       *x509.Certificate
+	privateKey crypto.Signer
+	extensions []pkix.Extension
+}
+
+// Sign signs a certificate for req with s's extensions.
+func (s *extensionSigner) Sign(req signer.SignRequest) ([]byte, error) {
+	profile, err := signer.Profile(s, req.Profile)
+	if err != nil {
+		return nil, err
+	}
+	if len(profile.CTLogServers) > 0 {
+		return nil, fmt.Errorf("Profile %q submits to CT logs, which isn't supported with extensions", req.Profile)
+	}
+
+	block, _ := pem.Decode([]byte(req.Request))
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, cferr.New(cferr.CSRError, cferr.DecodeFailed)
+	}
+	csrTemplate, err := signer.ParseCertificateRequest(s, block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Copy out only the fields of the CSR the profile allows
+	template := x509.Certificate{}
+	if whitelist := profile.CSRWhitelist; whitelist == nil {
+		template = *csrTemplate
+	} else {
+		if whitelist.Subject {
+			template.Subject = csrTemplate.Subject
+		}
+		if whitelist.PublicKeyAlgorithm {
+			template.PublicKeyAlgorithm = csrTemplate.PublicKeyAlgorithm
+		}
+		if whitelist.PublicKey {
+			template.PublicKey = csrTemplate.PublicKey
+		}
+		if whitelist.SignatureAlgorithm {
+			template.SignatureAlgorithm = csrTemplate.SignatureAlgorithm
+		}
+		if whitelist.DNSNames {
+			template.DNSNames = csrTemplate.DNSNames
+		}
+		if whitelist.IPAddresses {
+			template.IPAddresses = csrTemplate.IPAddresses
+		}
+	}
+	local.OverrideHosts(&template, req.Hosts)
+	template.Subject = local.PopulateSubjectFromCSR(req.Subject, template.Subject)
+
+	if profile.NameWhitelist != nil {
+		names := template.DNSNames
+		if template.Subject.CommonName != "" {
+			names = append([]string{template.Subject.CommonName}, names...)
+		}
+		for _, name := range names {
+			if profile.NameWhitelist.Find([]byte(name)) == nil {
+				return nil, cferr.New(cferr.PolicyError, cferr.InvalidPolicy)
+			}
+		}
+	}
+
+	if profile.ClientProvidesSerialNumbers {
+		if req.Serial == nil {
+			return nil, cferr.New(cferr.CertificateError, cferr.MissingSerial)
+		}
+		template.SerialNumber = req.Serial
+	} else {
+		template.SerialNumber, err = rand.Int(rand.Reader, big.NewInt(math.MaxInt64))
+		if err != nil {
+			return nil, cferr.Wrap(cferr.CertificateError, cferr.Unknown, err)
+		}
+	}
+	template.ExtraExtensions = append(template.ExtraExtensions, s.extensions...)
+
+	if err = signer.FillTemplate(&template, s.Policy().Default, profile); err != nil {
+		return nil, err
+	}
+	if template.IsCA {
+		template.MaxPathLen = 1
+		template.DNSNames = nil
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, s.cert, template.PublicKey, s.privateKey)
+	if err != nil {
+		return nil, cferr.Wrap(cferr.CertificateError, cferr.Unknown, err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
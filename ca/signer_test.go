@@ -0,0 +1,71 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ca
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/signer"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestSignerForSerialValidityAndExtensions(t *testing.T) {
+	lookupHost = fakeLookupHost
+	stats := mocks.NewStatter()
+	ca, err := NewCertificateAuthorityImpl(urlTestConfig(), clock.NewFake(), &stats, caCert, caKey)
+	test.AssertNotError(t, err, "Failed to create CA")
+
+	sign := func(serial int64, validity core.Validity, extensions []pkix.Extension) *x509.Certificate {
+		serialBig := big.NewInt(serial)
+		certSigner, err := ca.defaultIssuer.signerForSerial(serialBig.Text(16), profileName, validity, extensions)
+		test.AssertNotError(t, err, "Failed to get signer")
+		certPEM, err := certSigner.Sign(signer.SignRequest{
+			Request: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: CNandSANCSR})),
+			Profile: profileName,
+			Hosts:   []string{"not-example.com"},
+			Serial:  serialBig,
+		})
+		test.AssertNotError(t, err, "Failed to sign certificate")
+		block, _ := pem.Decode(certPEM)
+		cert, err := x509.ParseCertificate(block.Bytes)
+		test.AssertNotError(t, err, "Failed to parse certificate")
+		return cert
+	}
+	plain := sign(1, core.Validity{}, nil)
+
+	// A requested validity period is used as it is
+	validity := core.Validity{
+		NotBefore: time.Date(2015, 12, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:  time.Date(2015, 12, 8, 0, 0, 0, 0, time.UTC),
+	}
+	cert := sign(2, validity, nil)
+	test.Assert(t, cert.NotBefore.Equal(validity.NotBefore), "Requested NotBefore wasn't used")
+	test.Assert(t, cert.NotAfter.Equal(validity.NotAfter), "Requested NotAfter wasn't used")
+
+	// Extensions are added to those of the profile
+	mustStaple := pkix.Extension{Id: oidTLSFeature, Value: []byte{0x30, 0x03, 0x02, 0x01, 0x05}}
+	cert = sign(3, validity, []pkix.Extension{mustStaple})
+	test.Assert(t, cert.NotAfter.Equal(validity.NotAfter), "Requested NotAfter wasn't used")
+	test.AssertEquals(t, len(cert.Extensions), len(plain.Extensions)+1)
+	found := false
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidTLSFeature) {
+			found = reflect.DeepEqual(ext, mustStaple)
+		}
+	}
+	test.Assert(t, found, "TLS Feature extension wasn't added")
+	test.AssertDeepEquals(t, cert.OCSPServer, plain.OCSPServer)
+	test.AssertDeepEquals(t, cert.DNSNames, plain.DNSNames)
+}
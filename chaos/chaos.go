@@ -0,0 +1,147 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package chaos provides fault points, at which latency, errors and dropped
+// responses can be injected while Boulder is under test, to check that its
+// retries, timeouts and audit logging cope with failing dependencies.
+//
+// Fault points cost nothing until Enable is called, which only test
+// configurations do. Faults are then set and cleared through Handler, served
+// on a component's debug server.
+package chaos
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Fault is a failure injected at a fault point.
+type Fault struct {
+	// Latency is added before the point proceeds or fails.
+	Latency time.Duration
+	// Error, if set, is the message of an error the point fails with.
+	Error string
+	// Drop makes the point lose the request or response it handles, so
+	// that the caller times out.
+	Drop bool
+	// Probability is the chance that each pass through the point is
+	// faulted. Zero means every pass is.
+	Probability float64
+	// Count, if positive, is how many passes are faulted before the fault
+	// clears itself.
+	Count int
+}
+
+// Error is the error returned by a point faulted with an error message.
+type Error struct {
+	Point   string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("chaos: injected fault at %s: %s", e.Point, e.Message)
+}
+
+type droppedError struct{}
+
+func (droppedError) Error() string   { return "chaos: injected drop" }
+func (droppedError) Timeout() bool   { return true }
+func (droppedError) Temporary() bool { return true }
+
+// ErrDropped is returned by a point faulted with Drop. Points that handle
+// requests act as though it was lost; elsewhere it's a timeout: it's a
+// net.Error whose Timeout method returns true.
+var ErrDropped error = droppedError{}
+
+var enabled int32
+
+var points = struct {
+	sync.Mutex
+	faults   map[string]Fault
+	injected map[string]int64
+}{faults: make(map[string]Fault), injected: make(map[string]int64)}
+
+// Enable turns on fault injection for this process.
+func Enable() {
+	atomic.StoreInt32(&enabled, 1)
+}
+
+// Enabled returns whether fault injection is on.
+func Enabled() bool {
+	return atomic.LoadInt32(&enabled) == 1
+}
+
+// Set injects f at point, replacing any fault already there.
+func Set(point string, f Fault) {
+	points.Lock()
+	defer points.Unlock()
+	points.faults[point] = f
+}
+
+// Clear removes the fault at point.
+func Clear(point string) {
+	points.Lock()
+	defer points.Unlock()
+	delete(points.faults, point)
+}
+
+// Reset removes all faults and forgets how many were injected.
+func Reset() {
+	points.Lock()
+	defer points.Unlock()
+	points.faults = make(map[string]Fault)
+	points.injected = make(map[string]int64)
+}
+
+// Inject passes through point, waiting out the latency of its fault and
+// returning its error: an *Error, or ErrDropped. It returns nil straight
+// away if fault injection is off or there is no fault at point.
+func Inject(point string) error {
+	if !Enabled() {
+		return nil
+	}
+
+	points.Lock()
+	f, ok := points.faults[point]
+	if ok && f.Probability > 0 && rand.Float64() >= f.Probability {
+		ok = false
+	}
+	if ok {
+		points.injected[point]++
+		if f.Count > 0 {
+			if f.Count == 1 {
+				delete(points.faults, point)
+			} else {
+				remaining := f
+				remaining.Count--
+				points.faults[point] = remaining
+			}
+		}
+	}
+	points.Unlock()
+	if !ok {
+		return nil
+	}
+
+	time.Sleep(f.Latency)
+	if f.Drop {
+		return ErrDropped
+	}
+	if f.Error != "" {
+		return &Error{Point: point, Message: f.Error}
+	}
+	return nil
+}
+
+// Injected returns how many times a fault has been injected at point since
+// the last Reset.
+func Injected(point string) int64 {
+	points.Lock()
+	defer points.Unlock()
+	return points.injected[point]
+}
@@ -0,0 +1,70 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package chaos
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestInjectDisabled(t *testing.T) {
+	atomic.StoreInt32(&enabled, 0)
+	defer Reset()
+
+	Set("point", Fault{Error: "boom"})
+	test.AssertNotError(t, Inject("point"), "Fault injected while disabled")
+	test.AssertEquals(t, Injected("point"), int64(0))
+}
+
+func TestInject(t *testing.T) {
+	Enable()
+	defer Reset()
+
+	test.AssertNotError(t, Inject("point"), "Fault injected at a point without one")
+
+	Set("point", Fault{Error: "boom"})
+	err := Inject("point")
+	test.AssertError(t, err, "No fault injected")
+	test.AssertEquals(t, err.Error(), "chaos: injected fault at point: boom")
+	test.AssertError(t, Inject("point"), "Fault cleared itself")
+	test.AssertEquals(t, Injected("point"), int64(2))
+
+	Clear("point")
+	test.AssertNotError(t, Inject("point"), "Cleared fault injected")
+
+	// Drops look like timeouts
+	Set("point", Fault{Drop: true})
+	err = Inject("point")
+	test.AssertEquals(t, err, ErrDropped)
+	netErr, ok := err.(net.Error)
+	test.Assert(t, ok && netErr.Timeout(), "Drop isn't a timeout")
+
+	// Faults with a count clear themselves
+	Set("point", Fault{Error: "boom", Count: 2})
+	test.AssertError(t, Inject("point"), "No fault injected")
+	test.AssertError(t, Inject("point"), "No fault injected")
+	test.AssertNotError(t, Inject("point"), "Fault outlived its count")
+
+	// Latency alone delays without failing
+	Set("point", Fault{Latency: 20 * time.Millisecond})
+	start := time.Now()
+	test.AssertNotError(t, Inject("point"), "Latency failed the point")
+	test.Assert(t, time.Since(start) >= 20*time.Millisecond, "No latency injected")
+
+	// Faults with a probability sometimes pass
+	Set("point", Fault{Error: "boom", Probability: 0.5})
+	faulted := 0
+	for i := 0; i < 1000; i++ {
+		if Inject("point") != nil {
+			faulted++
+		}
+	}
+	test.Assert(t, faulted > 0 && faulted < 1000, "Probability ignored")
+}
@@ -0,0 +1,122 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package chaos
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Path is where Handler expects to be served. Faults are managed at
+// Path + point name:
+//
+//	GET    Path          lists the faults and how many were injected
+//	PUT    Path + point  sets the fault in the JSON body at point
+//	DELETE Path + point  clears the fault at point
+//	DELETE Path          clears all faults and counts
+const Path = "/debug/chaos/"
+
+// faultJSON is the form of a Fault in requests and responses.
+type faultJSON struct {
+	Latency     string  `json:"latency,omitempty"`
+	Error       string  `json:"error,omitempty"`
+	Drop        bool    `json:"drop,omitempty"`
+	Probability float64 `json:"probability,omitempty"`
+	Count       int     `json:"count,omitempty"`
+}
+
+type stateJSON struct {
+	Faults   map[string]faultJSON `json:"faults"`
+	Injected map[string]int64     `json:"injected"`
+}
+
+// Handler returns the handler of the fault management API.
+func Handler() http.Handler {
+	return http.HandlerFunc(serveHTTP)
+}
+
+func serveHTTP(w http.ResponseWriter, r *http.Request) {
+	point := strings.TrimPrefix(r.URL.Path, Path)
+	switch {
+	case r.Method == "GET" && point == "":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(state())
+	case r.Method == "PUT" && point != "":
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f, err := parseFault(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		Set(point, f)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "DELETE" && point != "":
+		Clear(point)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "DELETE":
+		Reset()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func parseFault(body []byte) (Fault, error) {
+	var fj faultJSON
+	if err := json.Unmarshal(body, &fj); err != nil {
+		return Fault{}, err
+	}
+	f := Fault{
+		Error:       fj.Error,
+		Drop:        fj.Drop,
+		Probability: fj.Probability,
+		Count:       fj.Count,
+	}
+	if fj.Latency != "" {
+		latency, err := time.ParseDuration(fj.Latency)
+		if err != nil {
+			return Fault{}, err
+		}
+		f.Latency = latency
+	}
+	if f.Probability < 0 || f.Probability > 1 {
+		return Fault{}, fmt.Errorf("Probability %g isn't between 0 and 1", f.Probability)
+	}
+	return f, nil
+}
+
+func state() stateJSON {
+	points.Lock()
+	defer points.Unlock()
+	s := stateJSON{
+		Faults:   make(map[string]faultJSON, len(points.faults)),
+		Injected: make(map[string]int64, len(points.injected)),
+	}
+	for point, f := range points.faults {
+		fj := faultJSON{
+			Error:       f.Error,
+			Drop:        f.Drop,
+			Probability: f.Probability,
+			Count:       f.Count,
+		}
+		if f.Latency > 0 {
+			fj.Latency = f.Latency.String()
+		}
+		s.Faults[point] = fj
+	}
+	for point, n := range points.injected {
+		s.Injected[point] = n
+	}
+	return s
+}
@@ -0,0 +1,57 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package chaos
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+func request(method, point, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, "http://localhost"+Path+point, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, req)
+	return w
+}
+
+func TestHandler(t *testing.T) {
+	Enable()
+	defer Reset()
+
+	w := request("PUT", "sa.AddCertificate", `{"latency": "1ms", "error": "boom", "count": 2}`)
+	test.AssertEquals(t, w.Code, http.StatusNoContent)
+	Inject("sa.AddCertificate")
+
+	w = request("GET", "", "")
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	var s stateJSON
+	test.AssertNotError(t, json.Unmarshal(w.Body.Bytes(), &s), "Couldn't parse state")
+	test.AssertEquals(t, s.Faults["sa.AddCertificate"], faultJSON{Latency: time.Millisecond.String(), Error: "boom", Count: 1})
+	test.AssertEquals(t, s.Injected["sa.AddCertificate"], int64(1))
+
+	w = request("DELETE", "sa.AddCertificate", "")
+	test.AssertEquals(t, w.Code, http.StatusNoContent)
+	test.AssertNotError(t, Inject("sa.AddCertificate"), "Deleted fault injected")
+
+	request("PUT", "dns.A", `{"drop": true}`)
+	w = request("DELETE", "", "")
+	test.AssertEquals(t, w.Code, http.StatusNoContent)
+	test.AssertNotError(t, Inject("dns.A"), "Fault injected after reset")
+	test.AssertEquals(t, Injected("sa.AddCertificate"), int64(0))
+
+	for _, body := range []string{`{"latency": "soon"}`, `{"probability": 2}`, `not json`} {
+		w = request("PUT", "dns.A", body)
+		test.AssertEquals(t, w.Code, http.StatusBadRequest)
+	}
+	w = request("POST", "dns.A", "{}")
+	test.AssertEquals(t, w.Code, http.StatusMethodNotAllowed)
+}
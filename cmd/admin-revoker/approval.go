@@ -0,0 +1,157 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+const (
+	// Dangerous actions need approvals from this many distinct operators
+	minApprovals = 2
+
+	defaultApprovalWindow = 15 * time.Minute
+)
+
+// approval is the payload an operator signs to consent to one run of an
+// action. It names the exact command and arguments, so that it can't be
+// used to approve anything else.
+type approval struct {
+	Command  string    `json:"command"`
+	Args     []string  `json:"args"`
+	Operator string    `json:"operator"`
+	SignedAt time.Time `json:"signedAt"`
+}
+
+// signApproval signs operator's approval of command and args, as a compact
+// JWS to hand to the operator who runs it.
+func signApproval(key crypto.Signer, operator, command string, args []string, now time.Time) (string, error) {
+	alg, err := core.SigningAlgorithm(key)
+	if err != nil {
+		return "", err
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: alg, Key: key}, &jose.SignerOptions{EmbedJWK: true})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(approval{
+		Command:  command,
+		Args:     args,
+		Operator: operator,
+		SignedAt: now.UTC(),
+	})
+	if err != nil {
+		return "", err
+	}
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+	return jws.CompactSerialize()
+}
+
+// approver enforces dual control: it checks that an action has been approved
+// by enough distinct operators, each signing with their own key within the
+// window before the action runs.
+type approver struct {
+	operators map[string]interface{}
+	window    time.Duration
+	clk       clock.Clock
+}
+
+// newApprover loads the public key of each operator from the named files.
+func newApprover(keyFiles map[string]string, window time.Duration, clk clock.Clock) (*approver, error) {
+	if window == 0 {
+		window = defaultApprovalWindow
+	}
+	a := &approver{
+		operators: make(map[string]interface{}),
+		window:    window,
+		clk:       clk,
+	}
+	for operator, file := range keyFiles {
+		keyPEM, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't read key for operator %q: %s", operator, err)
+		}
+		key, err := core.LoadPublicKey(keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't parse key for operator %q: %s", operator, err)
+		}
+		a.operators[operator] = key
+	}
+	return a, nil
+}
+
+// verify checks a single approval of command and args, returning the
+// operator who signed it.
+func (a *approver) verify(signed, command string, args []string) (string, error) {
+	jws, err := jose.ParseSigned(strings.TrimSpace(signed))
+	if err != nil {
+		return "", fmt.Errorf("Malformed approval: %s", err)
+	}
+	var names []string
+	for operator := range a.operators {
+		names = append(names, operator)
+	}
+	sort.Strings(names)
+	for _, operator := range names {
+		payload, err := jws.Verify(a.operators[operator])
+		if err != nil {
+			continue
+		}
+		var ap approval
+		if err = json.Unmarshal(payload, &ap); err != nil {
+			return "", fmt.Errorf("Malformed approval by %s: %s", operator, err)
+		}
+		if ap.Operator != operator {
+			return "", fmt.Errorf("Approval signed by %s claims to be by %s", operator, ap.Operator)
+		}
+		if ap.Command != command || !reflect.DeepEqual(ap.Args, args) {
+			return "", fmt.Errorf("Approval by %s is for %s %s, not this action", operator, ap.Command, strings.Join(ap.Args, " "))
+		}
+		age := a.clk.Now().Sub(ap.SignedAt)
+		if age > a.window || age < -a.window {
+			return "", fmt.Errorf("Approval by %s was signed at %s, outside the %s approval window", operator, ap.SignedAt, a.window)
+		}
+		return operator, nil
+	}
+	return "", fmt.Errorf("Approval isn't signed by a known operator")
+}
+
+// check verifies the approvals of command and args and returns the
+// operators who approved it, failing unless at least minApprovals distinct
+// operators did.
+func (a *approver) check(command string, args []string, approvals []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var operators []string
+	for _, signed := range approvals {
+		operator, err := a.verify(signed, command, args)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[operator] {
+			seen[operator] = true
+			operators = append(operators, operator)
+		}
+	}
+	if len(operators) < minApprovals {
+		return nil, fmt.Errorf("%s needs approvals from %d distinct operators, got %d", command, minApprovals, len(operators))
+	}
+	return operators, nil
+}
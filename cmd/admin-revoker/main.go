@@ -6,8 +6,12 @@
 package main
 
 import (
+	"context"
+	"crypto"
 	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -15,9 +19,11 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/codegangsta/cli"
-	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/admin"
 	"github.com/letsencrypt/boulder/cmd"
 	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
@@ -38,47 +44,107 @@ func loadConfig(c *cli.Context) (config cmd.Config, err error) {
 
 const clientName = "AdminRevoker"
 
-func setupContext(context *cli.Context) (rpc.RegistrationAuthorityClient, *blog.AuditLogger, *gorp.DbMap, rpc.StorageAuthorityClient) {
+func setupContext(context *cli.Context) (rpc.RegistrationAuthorityClient, *blog.AuditLogger, rpc.StorageAuthorityClient, *operator) {
 	c, err := loadConfig(context)
 	cmd.FailOnError(err, "Failed to load Boulder configuration")
 
 	stats, auditlogger := cmd.StatsAndLogging(c.Statsd, c.Syslog)
 
+	op, err := loadOperator(context.GlobalString("cert"), context.GlobalString("key"))
+	cmd.FailOnError(err, "Couldn't load operator credentials")
+
 	amqpConf := c.Revoker.AMQP
 	rac, err := rpc.NewRegistrationAuthorityClient(clientName, amqpConf, stats)
 	cmd.FailOnError(err, "Unable to create CA client")
 
-	dbURL, err := c.Revoker.DBConfig.URL()
-	cmd.FailOnError(err, "Couldn't load DB URL")
-	dbMap, err := sa.NewDbMap(dbURL)
-	cmd.FailOnError(err, "Couldn't setup database connection")
-
 	sac, err := rpc.NewStorageAuthorityClient(clientName, amqpConf, stats)
 	cmd.FailOnError(err, "Failed to create SA client")
 
-	return *rac, auditlogger, dbMap, *sac
+	return *rac, auditlogger, *sac, op
 }
 
-func addDeniedNames(tx *gorp.Transaction, names []string) (err error) {
-	sort.Strings(names)
-	deniedCSR := &core.DeniedCSR{Names: strings.ToLower(strings.Join(names, ","))}
+// operator holds the certificate and key with which the revoker proves to
+// the RA who is running it.
+type operator struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+	clk  clock.Clock
+}
 
-	err = tx.Insert(deniedCSR)
-	return
+func loadOperator(certFile, keyFile string) (*operator, error) {
+	der, err := cmd.LoadCert(certFile)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	priv, err := core.LoadPrivateKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a signing key", priv)
+	}
+	return &operator{cert: cert, key: key, clk: clock.Default()}, nil
+}
+
+// name is the operator name that requests are made on behalf of.
+func (op *operator) name() string {
+	return op.cert.Subject.CommonName
+}
+
+// context returns a context carrying a freshly signed token, so that each
+// request is authenticated however long the whole run takes.
+func (op *operator) context() (context.Context, error) {
+	token, err := admin.SignToken(op.key, op.cert, op.clk.Now(), admin.DefaultLifetime)
+	if err != nil {
+		return nil, err
+	}
+	return core.WithAdminToken(context.Background(), token), nil
 }
 
-func revokeBySerial(serial string, reasonCode core.RevocationCode, deny bool, rac rpc.RegistrationAuthorityClient, auditlogger *blog.AuditLogger, tx *gorp.Transaction) (err error) {
+// requireApprovals fails unless the action named by command and args has
+// been approved by enough operators, and records who approved it.
+func requireApprovals(c *cli.Context, command string, args []string, auditlogger *blog.AuditLogger) {
+	config, err := loadConfig(c)
+	cmd.FailOnError(err, "Failed to load Boulder configuration")
+	a, err := newApprover(config.Revoker.Operators, config.Revoker.ApprovalWindow.Duration, clock.Default())
+	cmd.FailOnError(err, "Couldn't load operator keys")
+
+	var approvals []string
+	for _, file := range c.GlobalStringSlice("approval") {
+		signed, err := ioutil.ReadFile(file)
+		cmd.FailOnError(err, "Couldn't read approval")
+		approvals = append(approvals, string(signed))
+	}
+	operators, err := a.check(command, args, approvals)
+	cmd.FailOnError(err, "Action not approved")
+
+	u, err := user.Current()
+	cmd.FailOnError(err, "Couldn't determine current user")
+	// AUDIT[ Revocation Requests ] 4e85d791-09c0-4ab3-a837-d3d67e945134
+	auditlogger.Audit(fmt.Sprintf("Running %s %s as %s, approved by %s",
+		command, strings.Join(args, " "), u.Username, strings.Join(operators, ", ")))
+}
+
+func revokeBySerial(serial string, reasonCode core.RevocationCode, deny bool, rac rpc.RegistrationAuthorityClient, auditlogger *blog.AuditLogger, sac rpc.StorageAuthorityClient, op *operator) (err error) {
 	if reasonCode < 0 || reasonCode == 7 || reasonCode > 10 {
 		panic(fmt.Sprintf("Invalid reason code: %d", reasonCode))
 	}
 
-	certObj, err := tx.Get(core.Certificate{}, serial)
+	ctx, err := op.context()
 	if err != nil {
 		return
 	}
-	certificate, ok := certObj.(*core.Certificate)
-	if !ok {
-		err = fmt.Errorf("Cast failure")
+	certificate, err := sac.GetCertificate(ctx, serial)
+	if err != nil {
 		return
 	}
 	cert, err := x509.ParseCertificate(certificate.DER)
@@ -86,15 +152,14 @@ func revokeBySerial(serial string, reasonCode core.RevocationCode, deny bool, ra
 		return
 	}
 	if deny {
-		// Retrieve DNS names associated with serial
-		err = addDeniedNames(tx, append(cert.DNSNames, cert.Subject.CommonName))
+		// Deny the DNS names associated with serial
+		err = rac.AdministrativelyDenyNames(ctx, append(cert.DNSNames, cert.Subject.CommonName), op.name())
 		if err != nil {
 			return
 		}
 	}
 
-	u, err := user.Current()
-	err = rac.AdministrativelyRevokeCertificate(*cert, reasonCode, u.Username)
+	err = rac.AdministrativelyRevokeCertificate(ctx, *cert, reasonCode, op.name())
 	if err != nil {
 		return
 	}
@@ -103,15 +168,118 @@ func revokeBySerial(serial string, reasonCode core.RevocationCode, deny bool, ra
 	return
 }
 
-func revokeByReg(regID int64, reasonCode core.RevocationCode, deny bool, rac rpc.RegistrationAuthorityClient, auditlogger *blog.AuditLogger, tx *gorp.Transaction) (err error) {
-	var certs []core.Certificate
-	_, err = tx.Select(&certs, "SELECT serial FROM certificates WHERE registrationID = :regID", map[string]interface{}{"regID": regID})
+// releaseBySerial releases a certificate put on hold with certificateHold.
+func releaseBySerial(serial string, rac rpc.RegistrationAuthorityClient, auditlogger *blog.AuditLogger, sac rpc.StorageAuthorityClient, op *operator) (err error) {
+	ctx, err := op.context()
+	if err != nil {
+		return
+	}
+	certificate, err := sac.GetCertificate(ctx, serial)
+	if err != nil {
+		return
+	}
+	cert, err := x509.ParseCertificate(certificate.DER)
+	if err != nil {
+		return
+	}
+
+	err = rac.AdministrativelyReleaseCertificateHold(ctx, *cert, op.name())
+	if err != nil {
+		return
+	}
+
+	auditlogger.Info(fmt.Sprintf("Released hold on certificate %s", serial))
+	return
+}
+
+// reviewAuthz approves or rejects an authorization held for review because
+// its identifier is high-risk.
+func reviewAuthz(authzID string, approve bool, rac rpc.RegistrationAuthorityClient, auditlogger *blog.AuditLogger, op *operator) (err error) {
+	ctx, err := op.context()
+	if err != nil {
+		return
+	}
+	err = rac.AdministrativelyReviewAuthorization(ctx, authzID, approve, op.name())
 	if err != nil {
 		return
 	}
 
-	for _, cert := range certs {
-		err = revokeBySerial(cert.Serial, reasonCode, deny, rac, auditlogger, tx)
+	decision := "Rejected"
+	if approve {
+		decision = "Approved"
+	}
+	auditlogger.Info(fmt.Sprintf("%s authorization %s", decision, authzID))
+	return
+}
+
+// keyHashFromPEM returns the core.KeyDigest of the key in a compromise
+// report: a PEM public key, certificate or CSR, or the private key itself.
+func keyHashFromPEM(pemBytes []byte) (string, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return "", errors.New("No PEM data found")
+	}
+	var key crypto.PublicKey
+	switch block.Type {
+	case "PUBLIC KEY":
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return "", err
+		}
+		key = pub
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return "", err
+		}
+		key = cert.PublicKey
+	case "CERTIFICATE REQUEST", "NEW CERTIFICATE REQUEST":
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil {
+			return "", err
+		}
+		key = csr.PublicKey
+	default:
+		priv, err := core.LoadPrivateKey(pemBytes)
+		if err != nil {
+			return "", fmt.Errorf("Unsupported PEM type %q", block.Type)
+		}
+		signer, ok := priv.(crypto.Signer)
+		if !ok {
+			return "", fmt.Errorf("Unsupported private key type %T", priv)
+		}
+		key = signer.Public()
+	}
+	return core.KeyDigest(key)
+}
+
+// certificatePageSize is how many of a registration's certificates are
+// fetched from the SA at a time.
+const certificatePageSize = 100
+
+func revokeByReg(regID int64, reasonCode core.RevocationCode, deny bool, rac rpc.RegistrationAuthorityClient, auditlogger *blog.AuditLogger, sac rpc.StorageAuthorityClient, op *operator) (err error) {
+	// Find all the serials before revoking any, so that paging isn't
+	// disturbed by what's revoked
+	var serials []string
+	for offset := 0; ; offset += certificatePageSize {
+		ctx, err := op.context()
+		if err != nil {
+			return err
+		}
+		certs, err := sac.GetCertificatesByRegistration(ctx, regID, offset, certificatePageSize)
+		if err != nil {
+			return err
+		}
+		for _, cert := range certs {
+			serials = append(serials, cert.Serial)
+		}
+		if len(certs) < certificatePageSize {
+			break
+		}
+	}
+
+	for _, serial := range serials {
+		err = revokeBySerial(serial, reasonCode, deny, rac, auditlogger, sac, op)
 		if err != nil {
 			return
 		}
@@ -120,6 +288,50 @@ func revokeByReg(regID int64, reasonCode core.RevocationCode, deny bool, rac rpc
 	return
 }
 
+// parseOverrideTarget parses the limit, key and registration ID arguments of
+// the ratelimit-override commands, where "-" is no key and 0 no registration.
+func parseOverrideTarget(args []string) (limit, key string, regID int64, err error) {
+	if len(args) < 3 {
+		return "", "", 0, fmt.Errorf("Expected a limit, key and registration ID")
+	}
+	limit, key = args[0], args[1]
+	if key == "-" {
+		key = ""
+	}
+	regID, err = strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("Registration ID argument must be a integer")
+	}
+	return limit, key, regID, nil
+}
+
+// parseOverride parses the arguments of ratelimit-override-set: a target,
+// as for parseOverrideTarget, then either a threshold or, as "x2.5", a
+// multiplier of the default threshold.
+func parseOverride(args []string) (core.RateLimitOverride, error) {
+	var o core.RateLimitOverride
+	var err error
+	o.Limit, o.Key, o.RegistrationID, err = parseOverrideTarget(args)
+	if err != nil {
+		return o, err
+	}
+	if len(args) != 4 {
+		return o, fmt.Errorf("Expected a threshold or multiplier")
+	}
+	if strings.HasPrefix(args[3], "x") {
+		o.Multiplier, err = strconv.ParseFloat(args[3][1:], 64)
+		if err != nil || o.Multiplier <= 0 {
+			return o, fmt.Errorf("Invalid multiplier %q", args[3])
+		}
+		return o, nil
+	}
+	o.Threshold, err = strconv.Atoi(args[3])
+	if err != nil {
+		return o, fmt.Errorf("Invalid threshold %q", args[3])
+	}
+	return o, nil
+}
+
 // This abstraction is needed so that we can use sort.Sort below
 type revocationCodes []core.RevocationCode
 
@@ -150,10 +362,25 @@ func main() {
 			EnvVar: "BOULDER_CONFIG",
 			Usage:  "Path to Boulder JSON configuration file",
 		},
+		cli.StringFlag{
+			Name:   "cert",
+			EnvVar: "BOULDER_OPERATOR_CERT",
+			Usage:  "Path to your operator certificate, with which requests to the RA are authenticated",
+		},
+		cli.StringFlag{
+			Name:   "key",
+			EnvVar: "BOULDER_OPERATOR_KEY",
+			Usage:  "Path to your operator private key",
+		},
 		cli.BoolFlag{
 			Name:  "deny",
 			Usage: "Add certificate DNS names to the denied list",
 		},
+		cli.StringSliceFlag{
+			Name:  "approval",
+			Value: &cli.StringSlice{},
+			Usage: "A file holding an operator's approval of the action, made with approve; repeat for each operator",
+		},
 	}
 	app.Commands = []cli.Command{
 		{
@@ -166,22 +393,23 @@ func main() {
 				cmd.FailOnError(err, "Reason code argument must be a integer")
 				deny := c.GlobalBool("deny")
 
-				cac, auditlogger, dbMap, _ := setupContext(c)
-
-				tx, err := dbMap.Begin()
-				if err != nil {
-					tx.Rollback()
-				}
-				cmd.FailOnError(err, "Couldn't begin transaction")
+				cac, auditlogger, sac, op := setupContext(c)
 
-				err = revokeBySerial(serial, core.RevocationCode(reasonCode), deny, cac, auditlogger, tx)
-				if err != nil {
-					tx.Rollback()
-				}
+				err = revokeBySerial(serial, core.RevocationCode(reasonCode), deny, cac, auditlogger, sac, op)
 				cmd.FailOnError(err, "Couldn't revoke certificate")
+			},
+		},
+		{
+			Name:  "serial-release",
+			Usage: "Release a single certificate, by the hex serial number, from a certificateHold (private CAs only)",
+			Action: func(c *cli.Context) {
+				// 1: serial
+				serial := c.Args().First()
+
+				cac, auditlogger, sac, op := setupContext(c)
 
-				err = tx.Commit()
-				cmd.FailOnError(err, "Couldn't cleanly close transaction")
+				err := releaseBySerial(serial, cac, auditlogger, sac, op)
+				cmd.FailOnError(err, "Couldn't release certificate")
 			},
 		},
 		{
@@ -195,29 +423,382 @@ func main() {
 				cmd.FailOnError(err, "Reason code argument must be a integer")
 				deny := c.GlobalBool("deny")
 
-				cac, auditlogger, dbMap, sac := setupContext(c)
+				cac, auditlogger, sac, op := setupContext(c)
 				// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 				defer auditlogger.AuditPanic()
 
-				tx, err := dbMap.Begin()
-				if err != nil {
-					tx.Rollback()
+				// Revoking a whole registration is under dual control
+				requireApprovals(c, "reg-revoke", c.Args(), auditlogger)
+
+				ctx, err := op.context()
+				cmd.FailOnError(err, "Couldn't sign operator token")
+				_, err = sac.GetRegistration(ctx, regID)
+				cmd.FailOnError(err, "Couldn't fetch registration")
+
+				err = revokeByReg(regID, core.RevocationCode(reasonCode), deny, cac, auditlogger, sac, op)
+				cmd.FailOnError(err, "Couldn't revoke certificate")
+			},
+		},
+		{
+			Name:  "key-revoke",
+			Usage: "Block a compromised key and revoke all its unexpired certificates with reason keyCompromise, given a PEM file of the key, or of a certificate or CSR for it",
+			Action: func(c *cli.Context) {
+				// 1: PEM file
+				pemBytes, err := ioutil.ReadFile(c.Args().First())
+				cmd.FailOnError(err, "Couldn't read key file")
+				keyHash, err := keyHashFromPEM(pemBytes)
+				cmd.FailOnError(err, "Couldn't find the key")
+
+				rac, auditlogger, _, op := setupContext(c)
+				// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+				defer auditlogger.AuditPanic()
+
+				// Revoking by key is under dual control, approved by the
+				// key's hash rather than the name of a file
+				fmt.Printf("Key hash: %s\n", keyHash)
+				requireApprovals(c, "key-revoke", []string{keyHash}, auditlogger)
+
+				ctx, err := op.context()
+				cmd.FailOnError(err, "Couldn't sign operator token")
+				err = rac.AdministrativelyRevokeCertificatesByKey(ctx, keyHash, op.name())
+				cmd.FailOnError(err, "Couldn't revoke certificates for key")
+				auditlogger.Info(fmt.Sprintf("Blocked key %s and revoked its certificates", keyHash))
+			},
+		},
+		{
+			Name:  "key-block",
+			Usage: "Block keys from future registrations and certificates, without revoking their certificates, given PEM files of the keys, or of certificates or CSRs for them",
+			Action: func(c *cli.Context) {
+				// 1...: PEM files
+				var keyHashes []string
+				for _, file := range c.Args() {
+					pemBytes, err := ioutil.ReadFile(file)
+					cmd.FailOnError(err, "Couldn't read key file")
+					keyHash, err := keyHashFromPEM(pemBytes)
+					cmd.FailOnError(err, fmt.Sprintf("Couldn't find the key in %s", file))
+					keyHashes = append(keyHashes, keyHash)
 				}
-				cmd.FailOnError(err, "Couldn't begin transaction")
 
-				_, err = sac.GetRegistration(regID)
-				if err != nil {
-					cmd.FailOnError(err, "Couldn't fetch registration")
+				rac, auditlogger, _, op := setupContext(c)
+				// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+				defer auditlogger.AuditPanic()
+
+				// Blocking keys is under dual control, approved by the keys'
+				// hashes
+				fmt.Printf("Key hashes: %s\n", strings.Join(keyHashes, " "))
+				requireApprovals(c, "key-block", keyHashes, auditlogger)
+
+				for _, keyHash := range keyHashes {
+					ctx, err := op.context()
+					cmd.FailOnError(err, "Couldn't sign operator token")
+					err = rac.AdministrativelyBlockKey(ctx, keyHash, op.name())
+					cmd.FailOnError(err, "Couldn't block key")
+					auditlogger.Info(fmt.Sprintf("Blocked key %s", keyHash))
+				}
+			},
+		},
+		{
+			Name:  "reg-set-tier",
+			Usage: "Put a registration in an account tier: default or trusted-integrator",
+			Action: func(c *cli.Context) {
+				// 1: registration ID,  2: tier
+				regID, err := strconv.ParseInt(c.Args().First(), 10, 64)
+				cmd.FailOnError(err, "Registration ID argument must be a integer")
+				tier := core.AccountTier(c.Args().Get(1))
+				if !tier.Known() {
+					cmd.FailOnError(fmt.Errorf("Unknown account tier %q", tier), "Invalid tier argument")
 				}
 
-				err = revokeByReg(regID, core.RevocationCode(reasonCode), deny, cac, auditlogger, tx)
-				if err != nil {
-					tx.Rollback()
+				rac, auditlogger, _, op := setupContext(c)
+
+				ctx, err := op.context()
+				cmd.FailOnError(err, "Couldn't sign operator token")
+				err = rac.AdministrativelySetAccountTier(ctx, regID, tier, op.name())
+				cmd.FailOnError(err, "Couldn't set account tier")
+				auditlogger.Info(fmt.Sprintf("Put registration %d in account tier %s", regID, tier))
+			},
+		},
+		{
+			Name:  "ct-status",
+			Usage: "Show the submissions of a certificate, by the hex serial number, to each CT log",
+			Action: func(c *cli.Context) {
+				// 1: serial
+				serial := c.Args().First()
+
+				_, _, sac, op := setupContext(c)
+
+				ctx, err := op.context()
+				cmd.FailOnError(err, "Couldn't sign operator token")
+				submissions, err := sac.GetCTSubmissions(ctx, serial)
+				cmd.FailOnError(err, "Couldn't get CT submissions")
+				for _, s := range submissions {
+					fmt.Printf("%s: %s after %d attempts, last %s", s.LogID, s.Status, s.Attempts, s.LastAttempt.Format(time.RFC3339))
+					if s.Status == core.CTSubmissionSubmitted {
+						fmt.Printf(", inclusion %s\n", s.InclusionStatus)
+					} else {
+						fmt.Printf(": %s\n", s.LastError)
+					}
+				}
+			},
+		},
+		{
+			Name:  "ratelimit-override-set",
+			Usage: "Override a rate limit for a key, a registration ID (or 0) or both, e.g. certificatesPerName example.com 0 100, or certificatesPerName - 123 x2",
+			Action: func(c *cli.Context) {
+				// 1: limit, 2: key or -, 3: registration ID or 0, 4: threshold or xMULTIPLIER
+				override, err := parseOverride(c.Args())
+				cmd.FailOnError(err, "Invalid override arguments")
+
+				rac, auditlogger, _, op := setupContext(c)
+
+				ctx, err := op.context()
+				cmd.FailOnError(err, "Couldn't sign operator token")
+				err = rac.AdministrativelySetRateLimitOverride(ctx, override, op.name())
+				cmd.FailOnError(err, "Couldn't set rate limit override")
+				auditlogger.Info(fmt.Sprintf("Set %s override for key %q, registration %d",
+					override.Limit, override.Key, override.RegistrationID))
+			},
+		},
+		{
+			Name:  "ratelimit-override-remove",
+			Usage: "Remove a rate limit override, by limit, key (or -) and registration ID (or 0)",
+			Action: func(c *cli.Context) {
+				// 1: limit, 2: key or -, 3: registration ID or 0
+				limit, key, regID, err := parseOverrideTarget(c.Args())
+				cmd.FailOnError(err, "Invalid override arguments")
+
+				rac, auditlogger, _, op := setupContext(c)
+
+				ctx, err := op.context()
+				cmd.FailOnError(err, "Couldn't sign operator token")
+				err = rac.AdministrativelyRemoveRateLimitOverride(ctx, limit, key, regID, op.name())
+				cmd.FailOnError(err, "Couldn't remove rate limit override")
+				auditlogger.Info(fmt.Sprintf("Removed %s override for key %q, registration %d", limit, key, regID))
+			},
+		},
+		{
+			Name:  "ratelimit-override-list",
+			Usage: "List the rate limit overrides",
+			Action: func(c *cli.Context) {
+				_, _, sac, op := setupContext(c)
+
+				ctx, err := op.context()
+				cmd.FailOnError(err, "Couldn't sign operator token")
+				overrides, err := sac.GetRateLimitOverrides(ctx)
+				cmd.FailOnError(err, "Couldn't get rate limit overrides")
+				for _, o := range overrides {
+					threshold := strconv.Itoa(o.Threshold)
+					if o.Multiplier != 0 {
+						threshold = fmt.Sprintf("x%g", o.Multiplier)
+					}
+					key := o.Key
+					if key == "" {
+						key = "-"
+					}
+					fmt.Printf("%s %s %d %s (set by %s at %s)\n", o.Limit, key, o.RegistrationID,
+						threshold, o.CreatedBy, o.Created.Format(time.RFC3339))
+				}
+			},
+		},
+		{
+			Name:  "authz-review-list",
+			Usage: "List the unexpired authorizations held for review because their identifiers are high-risk",
+			Action: func(c *cli.Context) {
+				_, _, sac, op := setupContext(c)
+
+				ctx, err := op.context()
+				cmd.FailOnError(err, "Couldn't sign operator token")
+				authzs, err := sac.GetPendingReviewAuthorizations(ctx, clock.Default().Now())
+				cmd.FailOnError(err, "Couldn't get authorizations held for review")
+				for _, authz := range authzs {
+					fmt.Printf("%s %s registration %d, expires %s\n", authz.ID, authz.Identifier.Value,
+						authz.RegistrationID, authz.Expires.Format(time.RFC3339))
+				}
+			},
+		},
+		{
+			Name:  "authz-approve",
+			Usage: "Approve an authorization held for review, by ID, making it valid",
+			Action: func(c *cli.Context) {
+				// 1: authorization ID
+				authzID := c.Args().First()
+
+				rac, auditlogger, _, op := setupContext(c)
+
+				err := reviewAuthz(authzID, true, rac, auditlogger, op)
+				cmd.FailOnError(err, "Couldn't approve authorization")
+			},
+		},
+		{
+			Name:  "authz-reject",
+			Usage: "Reject an authorization held for review, by ID, making it invalid",
+			Action: func(c *cli.Context) {
+				// 1: authorization ID
+				authzID := c.Args().First()
+
+				rac, auditlogger, _, op := setupContext(c)
+
+				err := reviewAuthz(authzID, false, rac, auditlogger, op)
+				cmd.FailOnError(err, "Couldn't reject authorization")
+			},
+		},
+		{
+			Name:  "plan-revoke",
+			Usage: "Plan revoking the unexpired certificates matching the flags given, with a reason code, writing the plan to a file and showing its impact, e.g. plan-revoke --issuer \"Happy Hacker Fake CA\" 4 plan.json",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "issuer",
+					Usage: "Common name of the issuer of the certificates",
+				},
+				cli.StringFlag{
+					Name:  "issued-after",
+					Usage: "Earliest issuance date of the certificates, as 2006-01-02 or RFC 3339",
+				},
+				cli.StringFlag{
+					Name:  "issued-before",
+					Usage: "Issuance date the certificates were issued before, as 2006-01-02 or RFC 3339",
+				},
+				cli.StringSliceFlag{
+					Name:  "key-hash",
+					Value: &cli.StringSlice{},
+					Usage: "Key digest of the certificates, as shown by key-revoke; repeat for each key",
+				},
+				cli.StringFlag{
+					Name:  "lint-report",
+					Usage: "A cert-checker report, of whose invalid certificates to revoke",
+				},
+				cli.StringFlag{
+					Name:  "lint-problem",
+					Usage: "Only revoke the certificates of the lint report with a problem containing this text",
+				},
+				cli.IntFlag{
+					Name:  "batch-size",
+					Value: defaultPlanBatchSize,
+					Usage: "How many certificates to revoke in each batch",
+				},
+				cli.IntFlag{
+					Name:  "max-ocsp-per-hour",
+					Value: defaultMaxOCSPSignsPerHour,
+					Usage: "How many OCSP responses the CA may sign an hour for the revocations, which paces the batches",
+				},
+			},
+			Action: func(c *cli.Context) {
+				// 1: reasonCode, 2: plan file
+				reasonCode, err := strconv.Atoi(c.Args().First())
+				cmd.FailOnError(err, "Reason code argument must be a integer")
+				if _, ok := core.RevocationReasons[core.RevocationCode(reasonCode)]; !ok || reasonCode == 7 {
+					cmd.FailOnError(fmt.Errorf("Invalid reason code: %d", reasonCode), "Bad reason code")
+				}
+				planFile := c.Args().Get(1)
+				if planFile == "" {
+					cmd.FailOnError(fmt.Errorf("No plan file given"), "Nowhere to write the plan")
+				}
+				criteria := planCriteria{
+					Issuer:      c.String("issuer"),
+					KeyHashes:   c.StringSlice("key-hash"),
+					LintReport:  c.String("lint-report"),
+					LintProblem: c.String("lint-problem"),
+				}
+				criteria.IssuedAfter, err = parsePlanDate(c.String("issued-after"))
+				cmd.FailOnError(err, "Invalid --issued-after")
+				criteria.IssuedBefore, err = parsePlanDate(c.String("issued-before"))
+				cmd.FailOnError(err, "Invalid --issued-before")
+				selector, err := newCertSelector(criteria)
+				cmd.FailOnError(err, "Invalid selection criteria")
+
+				config, err := loadConfig(c)
+				cmd.FailOnError(err, "Failed to load Boulder configuration")
+				dbURL, err := config.Revoker.DBConfig.URL()
+				cmd.FailOnError(err, "Couldn't load DB URL")
+				dbMap, err := sa.NewDbMap(dbURL)
+				cmd.FailOnError(err, "Couldn't connect to SA database")
+
+				_, auditlogger, sac, op := setupContext(c)
+				now := clock.Default().Now()
+				certs, err := selectCertificates(dbMap, selector, now)
+				cmd.FailOnError(err, "Couldn't select certificates")
+				ctx, err := op.context()
+				cmd.FailOnError(err, "Couldn't sign operator token")
+				plan, err := newRevocationPlan(ctx, certs, criteria, core.RevocationCode(reasonCode),
+					c.Int("batch-size"), c.Int("max-ocsp-per-hour"), sac, now)
+				cmd.FailOnError(err, "Couldn't plan revocation")
+				cmd.FailOnError(plan.save(planFile), "Couldn't write plan")
+
+				auditlogger.Info(fmt.Sprintf("Planned revoking %d certificates, plan digest %s, in %s",
+					plan.Impact.Certificates, plan.digest(), planFile))
+				fmt.Println(plan.summary())
+				fmt.Printf("Run with: plan-execute %s, approved with: approve plan-execute %s\n", planFile, plan.digest())
+			},
+		},
+		{
+			Name:  "plan-execute",
+			Usage: "Run a revocation plan made with plan-revoke, in its batches, resuming where an earlier run stopped",
+			Action: func(c *cli.Context) {
+				// 1: plan file
+				planFile := c.Args().First()
+				plan, err := loadRevocationPlan(planFile)
+				cmd.FailOnError(err, "Couldn't load plan")
+
+				rac, auditlogger, sac, op := setupContext(c)
+				// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+				defer auditlogger.AuditPanic()
+
+				// Bulk revocation is under dual control, approved by the
+				// digest of what the plan revokes
+				requireApprovals(c, "plan-execute", []string{plan.digest()}, auditlogger)
+				fmt.Println(plan.summary())
+
+				revoke := func(serial string) error {
+					ctx, err := op.context()
+					if err != nil {
+						return err
+					}
+					// Certificates revoked by an interrupted batch, or since
+					// planning, are skipped
+					status, err := sac.GetCertificateStatus(ctx, serial)
+					if err != nil {
+						return err
+					}
+					if status.Status == core.OCSPStatusRevoked {
+						return nil
+					}
+					return revokeBySerial(serial, plan.Reason, false, rac, auditlogger, sac, op)
+				}
+				err = plan.execute(revoke, func() error { return plan.save(planFile) }, time.Sleep)
+				cmd.FailOnError(err, fmt.Sprintf("Revocation plan stopped after %d of %d certificates", plan.Revoked, len(plan.Serials)))
+				auditlogger.Info(fmt.Sprintf("Finished revocation plan %s: revoked %d certificates", plan.digest(), plan.Revoked))
+			},
+		},
+		{
+			Name:  "approve",
+			Usage: "Sign your approval of an action under dual control, e.g. approve reg-revoke 123 1",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "operator",
+					Usage: "Your operator name, as configured in revoker.operators",
+				},
+				cli.StringFlag{
+					Name:  "key",
+					Usage: "Path to your operator private key",
+				},
+			},
+			Action: func(c *cli.Context) {
+				// 1: command, 2...: its arguments
+				if len(c.Args()) == 0 {
+					cmd.FailOnError(fmt.Errorf("No command given"), "Nothing to approve")
+				}
+				keyPEM, err := ioutil.ReadFile(c.String("key"))
+				cmd.FailOnError(err, "Couldn't read operator key")
+				priv, err := core.LoadPrivateKey(keyPEM)
+				cmd.FailOnError(err, "Couldn't parse operator key")
+				key, ok := priv.(crypto.Signer)
+				if !ok {
+					cmd.FailOnError(fmt.Errorf("%T is not a signing key", priv), "Couldn't parse operator key")
 				}
-				cmd.FailOnError(err, "Couldn't revoke certificate")
 
-				err = tx.Commit()
-				cmd.FailOnError(err, "Couldn't cleanly close transaction")
+				signed, err := signApproval(key, c.String("operator"), c.Args().First(), c.Args().Tail(), clock.Default().Now())
+				cmd.FailOnError(err, "Couldn't sign approval")
+				fmt.Println(signed)
 			},
 		},
 		{
@@ -1 +1,138 @@
 package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func writeOperatorKey(t *testing.T, dir, operator string) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	test.AssertNotError(t, err, "Failed to marshal public key")
+	file := filepath.Join(dir, operator+".pem")
+	err = ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600)
+	test.AssertNotError(t, err, "Failed to write public key")
+	return key
+}
+
+func TestApprovals(t *testing.T) {
+	dir, err := ioutil.TempDir("", "admin-revoker")
+	test.AssertNotError(t, err, "Failed to create temp dir")
+	defer os.RemoveAll(dir)
+
+	alice := writeOperatorKey(t, dir, "alice")
+	bob := writeOperatorKey(t, dir, "bob")
+	mallory, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+
+	fc := clock.NewFake()
+	a, err := newApprover(map[string]string{
+		"alice": filepath.Join(dir, "alice.pem"),
+		"bob":   filepath.Join(dir, "bob.pem"),
+	}, time.Hour, fc)
+	test.AssertNotError(t, err, "Failed to load operator keys")
+
+	args := []string{"123", "1"}
+	sign := func(key *ecdsa.PrivateKey, operator string, args []string, at time.Time) string {
+		signed, err := signApproval(key, operator, "reg-revoke", args, at)
+		test.AssertNotError(t, err, "Failed to sign approval")
+		return signed
+	}
+	byAlice := sign(alice, "alice", args, fc.Now())
+	byBob := sign(bob, "bob", args, fc.Now().Add(-30*time.Minute))
+
+	operators, err := a.check("reg-revoke", args, []string{byAlice, byBob})
+	test.AssertNotError(t, err, "Dual approval rejected")
+	test.AssertEquals(t, len(operators), 2)
+
+	// One operator can't approve twice
+	_, err = a.check("reg-revoke", args, []string{byAlice, byAlice})
+	test.AssertError(t, err, "Approvals by one operator accepted")
+
+	// Approvals only cover the exact action
+	_, err = a.check("reg-revoke", []string{"124", "1"}, []string{byAlice, byBob})
+	test.AssertError(t, err, "Approvals for another registration accepted")
+	_, err = a.check("serial-revoke", args, []string{byAlice, byBob})
+	test.AssertError(t, err, "Approvals for another command accepted")
+
+	// Keys must belong to the named operator
+	_, err = a.check("reg-revoke", args, []string{byAlice, sign(mallory, "bob", args, fc.Now())})
+	test.AssertError(t, err, "Approval with an unknown key accepted")
+	_, err = a.check("reg-revoke", args, []string{byAlice, sign(bob, "alice", args, fc.Now())})
+	test.AssertError(t, err, "Approval claiming another operator accepted")
+
+	// Approvals expire
+	fc.Add(45 * time.Minute)
+	_, err = a.check("reg-revoke", args, []string{byAlice, byBob})
+	test.AssertError(t, err, "Stale approval accepted")
+}
+
+func TestParseOverride(t *testing.T) {
+	o, err := parseOverride([]string{"certificatesPerName", "example.com", "0", "100"})
+	test.AssertNotError(t, err, "Failed to parse threshold override")
+	test.AssertEquals(t, o.Limit, "certificatesPerName")
+	test.AssertEquals(t, o.Key, "example.com")
+	test.AssertEquals(t, o.RegistrationID, int64(0))
+	test.AssertEquals(t, o.Threshold, 100)
+
+	o, err = parseOverride([]string{"certificatesPerName", "-", "123", "x2.5"})
+	test.AssertNotError(t, err, "Failed to parse multiplier override")
+	test.AssertEquals(t, o.Key, "")
+	test.AssertEquals(t, o.RegistrationID, int64(123))
+	test.AssertEquals(t, o.Multiplier, 2.5)
+	test.AssertEquals(t, o.Threshold, 0)
+
+	for _, args := range [][]string{
+		{"certificatesPerName", "example.com", "0"},
+		{"certificatesPerName", "example.com", "abc", "1"},
+		{"certificatesPerName", "example.com", "0", "many"},
+		{"certificatesPerName", "example.com", "0", "x0"},
+		{"certificatesPerName", "example.com", "0", "x-1"},
+	} {
+		_, err = parseOverride(args)
+		test.AssertError(t, err, fmt.Sprintf("Parsed invalid override arguments %v", args))
+	}
+}
+
+func TestKeyHashFromPEM(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	expected, err := core.KeyDigest(&key.PublicKey)
+	test.AssertNotError(t, err, "Failed to digest key")
+
+	pubDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	test.AssertNotError(t, err, "Failed to marshal public key")
+	privDER, err := x509.MarshalECPrivateKey(key)
+	test.AssertNotError(t, err, "Failed to marshal private key")
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{"example.com"}}, key)
+	test.AssertNotError(t, err, "Failed to create CSR")
+	for _, block := range []*pem.Block{
+		{Type: "PUBLIC KEY", Bytes: pubDER},
+		{Type: "EC PRIVATE KEY", Bytes: privDER},
+		{Type: "CERTIFICATE REQUEST", Bytes: csrDER},
+	} {
+		keyHash, err := keyHashFromPEM(pem.EncodeToMemory(block))
+		test.AssertNotError(t, err, "Failed to find key in "+block.Type)
+		test.AssertEquals(t, keyHash, expected)
+	}
+
+	_, err = keyHashFromPEM([]byte("not PEM"))
+	test.AssertError(t, err, "Found a key without PEM")
+	_, err = keyHashFromPEM(pem.EncodeToMemory(&pem.Block{Type: "SOMETHING", Bytes: []byte{1}}))
+	test.AssertError(t, err, "Found a key in an unknown PEM type")
+}
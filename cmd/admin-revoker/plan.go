@@ -0,0 +1,386 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+)
+
+// Defaults of the plan-revoke flags that shape the batch schedule.
+const (
+	defaultPlanBatchSize       = 500
+	defaultMaxOCSPSignsPerHour = 10000
+)
+
+// planCriteria select the unexpired, unrevoked certificates a revocation
+// plan revokes. Each criterion given must match; none matches every
+// certificate.
+type planCriteria struct {
+	// Issuer is the common name of the issuing intermediate
+	Issuer       string    `json:"issuer,omitempty"`
+	IssuedAfter  time.Time `json:"issuedAfter,omitempty"`
+	IssuedBefore time.Time `json:"issuedBefore,omitempty"`
+	// KeyHashes are the core.KeyDigest of the certificates' keys
+	KeyHashes []string `json:"keyHashes,omitempty"`
+	// LintReport is a cert-checker report, of whose invalid certificates
+	// only those with a problem containing LintProblem, if set, match
+	LintReport  string `json:"lintReport,omitempty"`
+	LintProblem string `json:"lintProblem,omitempty"`
+}
+
+// certSelector matches certificates against planCriteria.
+type certSelector struct {
+	criteria  planCriteria
+	keyHashes map[string]bool
+	linted    map[string]bool
+}
+
+// newCertSelector returns a selector of the certificates matching criteria,
+// of which there must be at least one, so that a plan never revokes every
+// certificate by omission.
+func newCertSelector(criteria planCriteria) (*certSelector, error) {
+	if criteria.Issuer == "" && criteria.IssuedAfter.IsZero() && criteria.IssuedBefore.IsZero() &&
+		len(criteria.KeyHashes) == 0 && criteria.LintReport == "" {
+		return nil, fmt.Errorf("No selection criteria given; at least one of --issuer, --issued-after, --issued-before, --key-hash and --lint-report is required")
+	}
+	s := &certSelector{criteria: criteria}
+	if len(criteria.KeyHashes) > 0 {
+		s.keyHashes = make(map[string]bool, len(criteria.KeyHashes))
+		for _, keyHash := range criteria.KeyHashes {
+			s.keyHashes[keyHash] = true
+		}
+	}
+	if criteria.LintReport != "" {
+		var err error
+		if s.linted, err = loadLintReport(criteria.LintReport, criteria.LintProblem); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// loadLintReport returns the serials of the certificates a cert-checker
+// report found invalid with a problem containing problem.
+func loadLintReport(filename, problem string) (map[string]bool, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var report struct {
+		Entries map[string]struct {
+			Valid    bool     `json:"valid"`
+			Problems []string `json:"problem"`
+		}
+	}
+	if err = json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("Couldn't parse cert-checker report %s: %s", filename, err)
+	}
+	linted := make(map[string]bool)
+	for serial, entry := range report.Entries {
+		if entry.Valid {
+			continue
+		}
+		for _, p := range entry.Problems {
+			if strings.Contains(p, problem) {
+				linted[serial] = true
+				break
+			}
+		}
+	}
+	return linted, nil
+}
+
+// selects returns whether cert matches the criteria.
+func (s *certSelector) selects(cert core.Certificate) (bool, error) {
+	c := s.criteria
+	if !c.IssuedAfter.IsZero() && cert.Issued.Before(c.IssuedAfter) {
+		return false, nil
+	}
+	if !c.IssuedBefore.IsZero() && !cert.Issued.Before(c.IssuedBefore) {
+		return false, nil
+	}
+	if s.linted != nil && !s.linted[cert.Serial] {
+		return false, nil
+	}
+	if c.Issuer == "" && s.keyHashes == nil {
+		return true, nil
+	}
+	parsed, err := x509.ParseCertificate(cert.DER)
+	if err != nil {
+		return false, fmt.Errorf("Couldn't parse certificate %s: %s", cert.Serial, err)
+	}
+	if c.Issuer != "" && parsed.Issuer.CommonName != c.Issuer {
+		return false, nil
+	}
+	if s.keyHashes != nil {
+		keyHash, err := core.KeyDigest(parsed.PublicKey)
+		if err != nil {
+			return false, fmt.Errorf("Couldn't hash key of certificate %s: %s", cert.Serial, err)
+		}
+		if !s.keyHashes[keyHash] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// selectCertificates returns the unexpired, unrevoked certificates in the
+// database that s selects, oldest first.
+func selectCertificates(dbMap *gorp.DbMap, s *certSelector, now time.Time) ([]core.Certificate, error) {
+	issuedBefore := s.criteria.IssuedBefore
+	if issuedBefore.IsZero() {
+		issuedBefore = now
+	}
+	var selected []core.Certificate
+	for offset := 0; ; offset += certificatePageSize {
+		var certs []core.Certificate
+		_, err := dbMap.Select(&certs,
+			`SELECT c.* FROM certificates c JOIN certificateStatus cs ON cs.serial = c.serial
+			 WHERE c.expires > :now AND cs.status != :revoked AND c.issued >= :issuedAfter AND c.issued < :issuedBefore
+			 ORDER BY c.issued, c.serial LIMIT :limit OFFSET :offset`,
+			map[string]interface{}{
+				"now":          now,
+				"revoked":      string(core.OCSPStatusRevoked),
+				"issuedAfter":  s.criteria.IssuedAfter,
+				"issuedBefore": issuedBefore,
+				"limit":        certificatePageSize,
+				"offset":       offset,
+			})
+		if err != nil {
+			return nil, err
+		}
+		for _, cert := range certs {
+			ok, err := s.selects(cert)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				selected = append(selected, cert)
+			}
+		}
+		if len(certs) < certificatePageSize {
+			return selected, nil
+		}
+	}
+}
+
+// planImpact is what revoking a plan's certificates would affect.
+type planImpact struct {
+	Certificates int `json:"certificates"`
+	Accounts     int `json:"accounts"`
+	Contacts     int `json:"contacts"`
+	// OCSPSignatures is how many OCSP responses the CA signs: one for each
+	// certificate as it's revoked. Boulder publishes no CRLs.
+	OCSPSignatures        int `json:"ocspSignatures"`
+	OCSPSignaturesPerHour int `json:"ocspSignaturesPerHour"`
+}
+
+// revocationPlan is a bulk revocation, previewed by plan-revoke and run by
+// plan-execute, which records in Revoked how far it has got so that an
+// interrupted run can be resumed.
+type revocationPlan struct {
+	Created  time.Time           `json:"created"`
+	Criteria planCriteria        `json:"criteria"`
+	Reason   core.RevocationCode `json:"reason"`
+	Impact   planImpact          `json:"impact"`
+
+	Serials  []string `json:"serials"`
+	Accounts []int64  `json:"accounts"`
+	Contacts []string `json:"contacts"`
+
+	BatchSize     int                `json:"batchSize"`
+	BatchInterval cmd.ConfigDuration `json:"batchInterval"`
+	Batches       int                `json:"batches"`
+	// Duration is how long running the plan takes at its pace
+	Duration cmd.ConfigDuration `json:"duration"`
+
+	Revoked int `json:"revoked"`
+}
+
+// registrationGetter is the part of the SA a plan finds contacts with.
+type registrationGetter interface {
+	GetRegistration(context.Context, int64) (core.Registration, error)
+}
+
+// newRevocationPlan plans to revoke certs with reason, in batches of
+// batchSize paced so that the CA signs at most maxSignsPerHour OCSP
+// responses an hour.
+func newRevocationPlan(ctx context.Context, certs []core.Certificate, criteria planCriteria, reason core.RevocationCode,
+	batchSize, maxSignsPerHour int, regs registrationGetter, now time.Time) (*revocationPlan, error) {
+	if batchSize <= 0 {
+		batchSize = defaultPlanBatchSize
+	}
+	if maxSignsPerHour <= 0 {
+		maxSignsPerHour = defaultMaxOCSPSignsPerHour
+	}
+	if batchSize > maxSignsPerHour {
+		batchSize = maxSignsPerHour
+	}
+	plan := &revocationPlan{
+		Created:   now,
+		Criteria:  criteria,
+		Reason:    reason,
+		BatchSize: batchSize,
+	}
+
+	accounts := make(map[int64]bool)
+	for _, cert := range certs {
+		plan.Serials = append(plan.Serials, cert.Serial)
+		if !accounts[cert.RegistrationID] {
+			accounts[cert.RegistrationID] = true
+			plan.Accounts = append(plan.Accounts, cert.RegistrationID)
+		}
+	}
+	sort.Sort(regIDs(plan.Accounts))
+
+	contacts := make(map[string]bool)
+	for _, regID := range plan.Accounts {
+		reg, err := regs.GetRegistration(ctx, regID)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't fetch registration %d: %s", regID, err)
+		}
+		for _, contact := range reg.Contact {
+			if contact != nil && contact.Scheme == "mailto" && !contacts[contact.Opaque] {
+				contacts[contact.Opaque] = true
+				plan.Contacts = append(plan.Contacts, contact.Opaque)
+			}
+		}
+	}
+	sort.Strings(plan.Contacts)
+
+	n := len(plan.Serials)
+	plan.Batches = (n + batchSize - 1) / batchSize
+	plan.BatchInterval.Duration = time.Duration(int64(time.Hour) * int64(batchSize) / int64(maxSignsPerHour))
+	if plan.Batches > 1 {
+		plan.Duration.Duration = time.Duration(plan.Batches-1) * plan.BatchInterval.Duration
+	}
+	plan.Impact = planImpact{
+		Certificates:          n,
+		Accounts:              len(plan.Accounts),
+		Contacts:              len(plan.Contacts),
+		OCSPSignatures:        n,
+		OCSPSignaturesPerHour: n,
+	}
+	if n > maxSignsPerHour {
+		plan.Impact.OCSPSignaturesPerHour = maxSignsPerHour
+	}
+	return plan, nil
+}
+
+type regIDs []int64
+
+func (r regIDs) Len() int           { return len(r) }
+func (r regIDs) Less(i, j int) bool { return r[i] < r[j] }
+func (r regIDs) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+// digest identifies what the plan revokes, and why, for operators to
+// approve it by.
+func (p *revocationPlan) digest() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n", p.Reason)
+	for _, serial := range p.Serials {
+		fmt.Fprintf(h, "%s\n", serial)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func loadRevocationPlan(filename string) (*revocationPlan, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var plan revocationPlan
+	if err = json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("Couldn't parse revocation plan %s: %s", filename, err)
+	}
+	if plan.Revoked < 0 || plan.Revoked > len(plan.Serials) || plan.BatchSize <= 0 {
+		return nil, fmt.Errorf("Invalid revocation plan %s", filename)
+	}
+	return &plan, nil
+}
+
+// save writes the plan to filename, replacing it whole so that an
+// interruption never leaves it half written.
+func (p *revocationPlan) save(filename string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filename + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// execute revokes the plan's certificates not yet revoked, in its batches,
+// saving its progress after each batch and when revoke fails, and sleeping
+// its BatchInterval between batches.
+func (p *revocationPlan) execute(revoke func(serial string) error, save func() error, sleep func(time.Duration)) error {
+	for p.Revoked < len(p.Serials) {
+		end := p.Revoked + p.BatchSize
+		if end > len(p.Serials) {
+			end = len(p.Serials)
+		}
+		for p.Revoked < end {
+			if err := revoke(p.Serials[p.Revoked]); err != nil {
+				if saveErr := save(); saveErr != nil {
+					return fmt.Errorf("%s; also couldn't save progress: %s", err, saveErr)
+				}
+				return err
+			}
+			p.Revoked++
+		}
+		if err := save(); err != nil {
+			return err
+		}
+		if p.Revoked < len(p.Serials) {
+			sleep(p.BatchInterval.Duration)
+		}
+	}
+	return nil
+}
+
+// parsePlanDate parses a date given as 2006-01-02 or RFC 3339, or none.
+func parsePlanDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// summary describes the plan's impact and schedule for operators.
+func (p *revocationPlan) summary() string {
+	return fmt.Sprintf(`Revoke %d certificates with reason '%s'
+Accounts affected: %d, with %d email contacts
+OCSP responses to sign: %d, at most %d an hour
+Schedule: %d batches of up to %d, every %s, taking %s
+Revoked so far: %d
+Plan digest: %s`,
+		p.Impact.Certificates, core.RevocationReasons[p.Reason],
+		p.Impact.Accounts, p.Impact.Contacts,
+		p.Impact.OCSPSignatures, p.Impact.OCSPSignaturesPerHour,
+		p.Batches, p.BatchSize, p.BatchInterval.Duration, p.Duration.Duration,
+		p.Revoked, p.digest())
+}
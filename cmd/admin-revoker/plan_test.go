@@ -0,0 +1,208 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// makeCert makes a certificate self-issued by issuer, for key.
+func makeCert(t *testing.T, serial int64, issuer string, key *ecdsa.PrivateKey, issued time.Time, regID int64) core.Certificate {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: issuer},
+		NotBefore:    issued,
+		NotAfter:     issued.Add(90 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	test.AssertNotError(t, err, "Failed to create certificate")
+	return core.Certificate{
+		RegistrationID: regID,
+		Serial:         core.SerialToString(template.SerialNumber),
+		DER:            der,
+		Issued:         issued,
+		Expires:        template.NotAfter,
+	}
+}
+
+func TestCertSelector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "admin-revoker")
+	test.AssertNotError(t, err, "Failed to create temp dir")
+	defer os.RemoveAll(dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	keyHash, err := core.KeyDigest(&key.PublicKey)
+	test.AssertNotError(t, err, "Failed to digest key")
+
+	day := time.Date(2015, 11, 1, 0, 0, 0, 0, time.UTC)
+	old := makeCert(t, 1, "Old CA", key, day, 1)
+	recent := makeCert(t, 2, "New CA", key, day.Add(48*time.Hour), 1)
+	otherKeys := makeCert(t, 3, "New CA", otherKey, day.Add(48*time.Hour), 2)
+
+	report := filepath.Join(dir, "report.json")
+	err = ioutil.WriteFile(report, []byte(`{"Entries": {
+		"`+old.Serial+`": {"valid": false, "problem": ["Certificate has common name >64 characters long"]},
+		"`+recent.Serial+`": {"valid": false, "problem": ["Stored issuance date is outside of 6 hour window"]},
+		"`+otherKeys.Serial+`": {"valid": true}
+	}}`), 0600)
+	test.AssertNotError(t, err, "Failed to write report")
+
+	testCases := []struct {
+		criteria planCriteria
+		selected []core.Certificate
+	}{
+		{planCriteria{Issuer: "New CA"}, []core.Certificate{recent, otherKeys}},
+		{planCriteria{IssuedAfter: day.Add(time.Hour)}, []core.Certificate{recent, otherKeys}},
+		{planCriteria{IssuedBefore: day.Add(time.Hour)}, []core.Certificate{old}},
+		{planCriteria{KeyHashes: []string{keyHash}}, []core.Certificate{old, recent}},
+		{planCriteria{Issuer: "New CA", KeyHashes: []string{keyHash}}, []core.Certificate{recent}},
+		{planCriteria{LintReport: report}, []core.Certificate{old, recent}},
+		{planCriteria{LintReport: report, LintProblem: "common name"}, []core.Certificate{old}},
+	}
+	for i, tc := range testCases {
+		s, err := newCertSelector(tc.criteria)
+		test.AssertNotError(t, err, "Failed to make selector")
+		var selected []core.Certificate
+		for _, cert := range []core.Certificate{old, recent, otherKeys} {
+			ok, err := s.selects(cert)
+			test.AssertNotError(t, err, "Failed to match certificate")
+			if ok {
+				selected = append(selected, cert)
+			}
+		}
+		if len(selected) != len(tc.selected) {
+			t.Errorf("Case %d: selected %d certificates, expected %d", i, len(selected), len(tc.selected))
+			continue
+		}
+		for j := range selected {
+			test.AssertEquals(t, selected[j].Serial, tc.selected[j].Serial)
+		}
+	}
+
+	_, err = newCertSelector(planCriteria{LintReport: filepath.Join(dir, "missing.json")})
+	test.AssertError(t, err, "Loaded a missing lint report")
+
+	// A selector needs at least one criterion, which LintProblem alone isn't
+	_, err = newCertSelector(planCriteria{})
+	test.AssertError(t, err, "Made a selector without criteria")
+	_, err = newCertSelector(planCriteria{LintProblem: "common name"})
+	test.AssertError(t, err, "Made a selector without criteria")
+}
+
+// contactsSA has registrations with one contact each, shared by registrations
+// 1 and 2.
+type contactsSA struct{}
+
+func (contactsSA) GetRegistration(ctx context.Context, id int64) (core.Registration, error) {
+	address := "mailto:shared@example.com"
+	if id > 2 {
+		address = "mailto:other@example.com"
+	}
+	contact, err := core.ParseAcmeURL(address)
+	if err != nil {
+		return core.Registration{}, err
+	}
+	return core.Registration{ID: id, Contact: []*core.AcmeURL{contact}}, nil
+}
+
+func TestNewRevocationPlan(t *testing.T) {
+	var certs []core.Certificate
+	for i := 0; i < 25; i++ {
+		certs = append(certs, core.Certificate{Serial: core.SerialToString(big.NewInt(int64(i))), RegistrationID: int64(3 - i%3)})
+	}
+	now := time.Date(2015, 12, 1, 0, 0, 0, 0, time.UTC)
+	plan, err := newRevocationPlan(context.Background(), certs, planCriteria{Issuer: "Some CA"}, 4, 10, 20, contactsSA{}, now)
+	test.AssertNotError(t, err, "Failed to plan")
+
+	test.AssertEquals(t, len(plan.Serials), 25)
+	test.AssertDeepEquals(t, plan.Accounts, []int64{1, 2, 3})
+	test.AssertDeepEquals(t, plan.Contacts, []string{"other@example.com", "shared@example.com"})
+	test.AssertEquals(t, plan.Impact, planImpact{
+		Certificates:          25,
+		Accounts:              3,
+		Contacts:              2,
+		OCSPSignatures:        25,
+		OCSPSignaturesPerHour: 20,
+	})
+	// 20 signatures an hour in batches of 10 is a batch every half hour
+	test.AssertEquals(t, plan.Batches, 3)
+	test.AssertEquals(t, plan.BatchInterval.Duration, 30*time.Minute)
+	test.AssertEquals(t, plan.Duration.Duration, time.Hour)
+
+	// The digest covers what's revoked, and why
+	digest := plan.digest()
+	plan.Reason = 1
+	test.Assert(t, plan.digest() != digest, "Digest ignores the reason")
+	plan.Reason = 4
+	plan.Serials = plan.Serials[1:]
+	test.Assert(t, plan.digest() != digest, "Digest ignores the serials")
+}
+
+func TestExecuteRevocationPlan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "admin-revoker")
+	test.AssertNotError(t, err, "Failed to create temp dir")
+	defer os.RemoveAll(dir)
+	planFile := filepath.Join(dir, "plan.json")
+
+	plan := &revocationPlan{
+		Serials:   []string{"a", "b", "c", "d", "e"},
+		Reason:    1,
+		BatchSize: 2,
+	}
+	plan.BatchInterval.Duration = time.Minute
+	test.AssertNotError(t, plan.save(planFile), "Failed to save plan")
+
+	var revoked []string
+	var slept time.Duration
+	failAt := "d"
+	revoke := func(serial string) error {
+		if serial == failAt {
+			return errors.New("RA unavailable")
+		}
+		revoked = append(revoked, serial)
+		return nil
+	}
+	save := func() error { return plan.save(planFile) }
+	sleep := func(d time.Duration) { slept += d }
+
+	// A failure stops the run, with its progress saved
+	err = plan.execute(revoke, save, sleep)
+	test.AssertError(t, err, "Failed revocation didn't stop the plan")
+	test.AssertDeepEquals(t, revoked, []string{"a", "b", "c"})
+	test.AssertEquals(t, slept, time.Minute)
+	saved, err := loadRevocationPlan(planFile)
+	test.AssertNotError(t, err, "Failed to load plan")
+	test.AssertEquals(t, saved.Revoked, 3)
+
+	// Resuming carries on from there
+	failAt = ""
+	err = saved.execute(revoke, func() error { return saved.save(planFile) }, sleep)
+	test.AssertNotError(t, err, "Failed to resume plan")
+	test.AssertDeepEquals(t, revoked, []string{"a", "b", "c", "d", "e"})
+	// The rest of the plan fits in one batch
+	test.AssertEquals(t, slept, time.Minute)
+	saved, err = loadRevocationPlan(planFile)
+	test.AssertNotError(t, err, "Failed to load plan")
+	test.AssertEquals(t, saved.Revoked, 5)
+}
@@ -0,0 +1,50 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/codegangsta/cli"
+
+	"github.com/letsencrypt/boulder/cmd"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/sa"
+)
+
+func main() {
+	app := cmd.NewAppShell("backfill-fqdn-sets", "Records the name sets of unexpired certificates issued before the fqdnSets table existed")
+	app.App.Flags = append(app.App.Flags, cli.IntFlag{
+		Name:  "batch-size",
+		Value: 1000,
+		Usage: "The number of certificates to read from the database at a time",
+	})
+
+	batchSize := 0
+	app.Config = func(c *cli.Context, config cmd.Config) cmd.Config {
+		batchSize = c.GlobalInt("batch-size")
+		return config
+	}
+
+	app.Action = func(c cmd.Config, stats statsd.Statter, auditlogger *blog.AuditLogger) {
+		dbURL, err := c.SA.DBConfig.URL()
+		cmd.FailOnError(err, "Couldn't load DB URL")
+		dbMap, err := sa.NewDbMap(dbURL)
+		cmd.FailOnError(err, "Could not connect to database")
+
+		clk := cmd.Clock()
+		ssa, err := sa.NewSQLStorageAuthority(dbMap, clk)
+		cmd.FailOnError(err, "Failed to create SA impl")
+
+		backfilled, err := ssa.BackfillFQDNSets(context.Background(), clk.Now(), batchSize)
+		auditlogger.Info(fmt.Sprintf("Backfilled %d FQDN sets", backfilled))
+		cmd.FailOnError(err, "Failed to backfill FQDN sets")
+	}
+
+	app.Run()
+}
@@ -6,15 +6,16 @@
 package main
 
 import (
+	"bytes"
 	"crypto"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/crypto/pkcs11key"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/helpers"
-	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
 	"github.com/letsencrypt/boulder/ca"
 	"github.com/letsencrypt/boulder/cmd"
 	"github.com/letsencrypt/boulder/core"
@@ -33,6 +34,20 @@ func loadPrivateKey(keyConfig cmd.KeyConfig) (crypto.Signer, error) {
 			return nil, fmt.Errorf("Could not read key file %s", keyConfig.File)
 		}
 
+		block, _ := pem.Decode(keyBytes)
+		if block != nil && block.Type == "ENCRYPTED PRIVATE KEY" {
+			if keyConfig.PassphraseFile == "" {
+				return nil, fmt.Errorf("Key file %s is encrypted, but no PassphraseFile is configured", keyConfig.File)
+			}
+			passphrase, err := ioutil.ReadFile(keyConfig.PassphraseFile)
+			if err != nil {
+				return nil, fmt.Errorf("Could not read passphrase file %s", keyConfig.PassphraseFile)
+			}
+			return decryptPKCS8PrivateKey(block.Bytes, bytes.TrimRight(passphrase, "\n"))
+		}
+		if !keyConfig.InsecurePlaintextKey {
+			return nil, fmt.Errorf("Key file %s isn't encrypted; encrypt it as PKCS#8, or set InsecurePlaintextKey", keyConfig.File)
+		}
 		return helpers.ParsePrivateKeyPEM(keyBytes)
 	}
 
@@ -79,6 +94,8 @@ func main() {
 		cmd.FailOnError(err, "Couldn't connect to policy database")
 		pa, err := policy.NewPolicyAuthorityImpl(paDbMap, c.PA.EnforcePolicyWhitelist, c.PA.Challenges)
 		cmd.FailOnError(err, "Couldn't create PA")
+		cmd.FailOnError(c.CheckEmailIdentifiers(), "Invalid email identifier configuration")
+		pa.EmailIdentifiers = c.PA.EmailIdentifiers
 
 		priv, err := loadPrivateKey(c.CA.Key)
 		cmd.FailOnError(err, "Couldn't load private key")
@@ -86,14 +103,29 @@ func main() {
 		issuer, err := core.LoadCert(c.Common.IssuerCert)
 		cmd.FailOnError(err, "Couldn't load issuer cert")
 
+		if c.CA.MaxNames == 0 {
+			c.CA.MaxNames = c.RA.MaxNames
+		}
 		cai, err := ca.NewCertificateAuthorityImpl(
 			c.CA,
-			clock.Default(),
+			cmd.Clock(),
 			stats,
 			issuer,
 			priv)
 		cmd.FailOnError(err, "Failed to create CA impl")
+		for _, ic := range c.CA.Issuers {
+			issuerKey, err := loadPrivateKey(ic.Key)
+			cmd.FailOnError(err, fmt.Sprintf("Couldn't load private key of issuer %s", ic.CertFile))
+			issuerCert, err := core.LoadCert(ic.CertFile)
+			cmd.FailOnError(err, fmt.Sprintf("Couldn't load issuer cert %s", ic.CertFile))
+			err = cai.AddIssuer(ic, issuerCert, issuerKey)
+			cmd.FailOnError(err, fmt.Sprintf("Couldn't add issuer %s", ic.CertFile))
+		}
 		cai.PA = pa
+		if c.Common.BlockedKeysFile != "" {
+			cai.BlockedKeys, err = core.LoadBlockedKeys(c.Common.BlockedKeysFile)
+			cmd.FailOnError(err, "Couldn't load blocked keys")
+		}
 
 		go cmd.ProfileCmd("CA", stats)
 
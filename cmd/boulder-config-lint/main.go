@@ -0,0 +1,530 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// boulder-config-lint loads the configuration files of every component in a
+// deployment and checks that they agree with each other: every RPC client
+// talks to a queue some service listens on, all components use the same
+// issuer certificate, the RAs enforce the same rate limits and no rate limit
+// override is silently ignored, and each WFE has a nonce prefix of its own
+// that its peers know how to redeem. Rate limit policies files can also be
+// checked on their own, with --rate-limits. It prints one line per problem
+// found and exits non-zero if there were any, so it can gate a deploy.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/codegangsta/cli"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/net/publicsuffix"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+)
+
+// namedConfig is a deployment's configuration file and the name it was
+// loaded from, which prefixes every problem found in it.
+type namedConfig struct {
+	name   string
+	config cmd.Config
+}
+
+func loadConfig(filename string) (namedConfig, error) {
+	configJSON, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return namedConfig{}, err
+	}
+	var config cmd.Config
+	if err = json.Unmarshal(configJSON, &config); err != nil {
+		return namedConfig{}, err
+	}
+	config.SetAMQPDefaults()
+	return namedConfig{name: filename, config: config}, nil
+}
+
+// The RPC services a component may call, by the name used for them in
+// AMQPConfig.
+var rpcServices = map[string]func(*cmd.AMQPConfig) *cmd.RPCServerConfig{
+	"RA":        func(a *cmd.AMQPConfig) *cmd.RPCServerConfig { return a.RA },
+	"VA":        func(a *cmd.AMQPConfig) *cmd.RPCServerConfig { return a.VA },
+	"SA":        func(a *cmd.AMQPConfig) *cmd.RPCServerConfig { return a.SA },
+	"CA":        func(a *cmd.AMQPConfig) *cmd.RPCServerConfig { return a.CA },
+	"Publisher": func(a *cmd.AMQPConfig) *cmd.RPCServerConfig { return a.Publisher },
+}
+
+// component describes how to find one Boulder component in a config file.
+type component struct {
+	name string
+	// present reports whether the config file deploys this component.
+	present func(cmd.Config) bool
+	amqp    func(cmd.Config) *cmd.AMQPConfig
+	// clientOf lists the RPC services the component calls.
+	clientOf []string
+	// usesIssuer is true for components that load Common.IssuerCert.
+	usesIssuer bool
+}
+
+func servesQueue(a *cmd.AMQPConfig) bool {
+	return a != nil && a.ServiceQueue != ""
+}
+
+var components = []component{
+	{
+		name:       "WFE",
+		present:    func(c cmd.Config) bool { return c.WFE.ListenAddress != "" },
+		amqp:       func(c cmd.Config) *cmd.AMQPConfig { return c.WFE.AMQP },
+		clientOf:   []string{"RA", "SA"},
+		usesIssuer: true,
+	},
+	{
+		name:     "RA",
+		present:  func(c cmd.Config) bool { return servesQueue(c.RA.AMQP) },
+		amqp:     func(c cmd.Config) *cmd.AMQPConfig { return c.RA.AMQP },
+		clientOf: []string{"VA", "CA", "SA"},
+	},
+	{
+		name:    "SA",
+		present: func(c cmd.Config) bool { return servesQueue(c.SA.AMQP) },
+		amqp:    func(c cmd.Config) *cmd.AMQPConfig { return c.SA.AMQP },
+	},
+	{
+		name:     "VA",
+		present:  func(c cmd.Config) bool { return servesQueue(c.VA.AMQP) },
+		amqp:     func(c cmd.Config) *cmd.AMQPConfig { return c.VA.AMQP },
+		clientOf: []string{"RA"},
+	},
+	{
+		name:       "CA",
+		present:    func(c cmd.Config) bool { return servesQueue(c.CA.AMQP) },
+		amqp:       func(c cmd.Config) *cmd.AMQPConfig { return c.CA.AMQP },
+		clientOf:   []string{"SA", "Publisher"},
+		usesIssuer: true,
+	},
+	{
+		name:     "Publisher",
+		present:  func(c cmd.Config) bool { return servesQueue(c.Publisher.AMQP) },
+		amqp:     func(c cmd.Config) *cmd.AMQPConfig { return c.Publisher.AMQP },
+		clientOf: []string{"SA"},
+	},
+	{
+		name: "OCSPUpdater",
+		present: func(c cmd.Config) bool {
+			return c.OCSPUpdater.DBConnect != "" || c.OCSPUpdater.DBConnectFile != ""
+		},
+		amqp:     func(c cmd.Config) *cmd.AMQPConfig { return c.OCSPUpdater.AMQP },
+		clientOf: []string{"CA", "SA", "Publisher"},
+	},
+	{
+		name:       "OCSPResponder",
+		present:    func(c cmd.Config) bool { return c.OCSPResponder.ListenAddress != "" },
+		amqp:       func(c cmd.Config) *cmd.AMQPConfig { return c.OCSPResponder.AMQP },
+		usesIssuer: true,
+	},
+}
+
+// lint runs every check over the deployment's configs and returns the
+// problems found, sorted.
+func lint(configs []namedConfig) []string {
+	var problems []string
+	for _, check := range []func([]namedConfig) []string{
+		checkServiceQueues,
+		checkIssuers,
+		checkRateLimits,
+		checkNoncePrefixes,
+	} {
+		problems = append(problems, check(configs)...)
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// checkServiceQueues checks that every RPC client sends requests to a queue
+// that an instance of the service it calls listens on.
+func checkServiceQueues(configs []namedConfig) []string {
+	var problems []string
+	served := make(map[string]map[string]bool)
+	for _, nc := range configs {
+		for _, comp := range components {
+			if _, ok := rpcServices[comp.name]; !ok || !comp.present(nc.config) {
+				continue
+			}
+			if served[comp.name] == nil {
+				served[comp.name] = make(map[string]bool)
+			}
+			served[comp.name][comp.amqp(nc.config).ServiceQueue] = true
+		}
+	}
+
+	for _, nc := range configs {
+		for _, comp := range components {
+			if !comp.present(nc.config) {
+				continue
+			}
+			amqp := comp.amqp(nc.config)
+			if amqp == nil {
+				if len(comp.clientOf) > 0 {
+					problems = append(problems, fmt.Sprintf("%s: %s has no AMQP section", nc.name, comp.name))
+				}
+				continue
+			}
+			for _, service := range comp.clientOf {
+				rpcConf := rpcServices[service](amqp)
+				switch {
+				case rpcConf == nil || rpcConf.Server == "":
+					problems = append(problems, fmt.Sprintf(
+						"%s: %s calls the %s, but its AMQP section has no %s server queue",
+						nc.name, comp.name, service, service))
+				case len(served[service]) == 0:
+					problems = append(problems, fmt.Sprintf(
+						"%s: %s calls the %s, but none of the configs runs a %s",
+						nc.name, comp.name, service, service))
+				case !served[service][rpcConf.Server]:
+					problems = append(problems, fmt.Sprintf(
+						"%s: %s sends %s requests to queue %q, but the %s listens on %s",
+						nc.name, comp.name, service, rpcConf.Server, service, quotedKeys(served[service])))
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// checkIssuers checks that the components that load the issuer certificate
+// all load the same one.
+func checkIssuers(configs []namedConfig) []string {
+	var problems []string
+	// Certificates by DER, and the config files and components using each
+	var issuers []string
+	usedBy := make(map[string][]string)
+	for _, nc := range configs {
+		var users []string
+		for _, comp := range components {
+			if comp.usesIssuer && comp.present(nc.config) {
+				users = append(users, comp.name)
+			}
+		}
+		if len(users) == 0 {
+			continue
+		}
+		issuerPath := nc.config.Common.IssuerCert
+		der, err := cmd.LoadCert(issuerPath)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf(
+				"%s: %s cannot load issuer certificate %q: %s",
+				nc.name, strings.Join(users, ", "), issuerPath, err))
+			continue
+		}
+		key := string(der)
+		if _, ok := usedBy[key]; !ok {
+			issuers = append(issuers, key)
+		}
+		usedBy[key] = append(usedBy[key], fmt.Sprintf("%s (%s in %s)", issuerPath, strings.Join(users, ", "), nc.name))
+	}
+	if len(issuers) > 1 {
+		var descriptions []string
+		for _, key := range issuers {
+			descriptions = append(descriptions, strings.Join(usedBy[key], ", "))
+		}
+		problems = append(problems, fmt.Sprintf(
+			"components use %d different issuer certificates: %s",
+			len(issuers), strings.Join(descriptions, " vs. ")))
+	}
+	return problems
+}
+
+// checkRateLimits checks that every RA enforces the same rate limits, and that
+// no configured override, in the policies of RAs and WFEs, will be silently
+// ignored.
+func checkRateLimits(configs []namedConfig) []string {
+	var problems []string
+	var first *cmd.RateLimitConfig
+	var firstName string
+	linted := make(map[string]bool)
+	load := func(nc namedConfig, component, filename string) (cmd.RateLimitConfig, bool) {
+		policies, err := cmd.LoadRateLimitPolicies(filename)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s cannot load rate limit policies %q: %s", nc.name, component, filename, err))
+			return policies, false
+		}
+		// Components sharing a file have its problems reported once
+		if !linted[nc.name+"\x00"+filename] {
+			linted[nc.name+"\x00"+filename] = true
+			for _, problem := range lintRateLimits(policies) {
+				problems = append(problems, fmt.Sprintf("%s: %s: %s", nc.name, filename, problem))
+			}
+		}
+		return policies, true
+	}
+	for _, nc := range configs {
+		if nc.config.WFE.ListenAddress != "" && nc.config.WFE.RateLimitPoliciesFilename != "" {
+			load(nc, "WFE", nc.config.WFE.RateLimitPoliciesFilename)
+		}
+		if !servesQueue(nc.config.RA.AMQP) {
+			continue
+		}
+		filename := nc.config.RA.RateLimitPoliciesFilename
+		if filename == "" {
+			problems = append(problems, fmt.Sprintf("%s: RA has no rateLimitPoliciesFilename", nc.name))
+			continue
+		}
+		policies, ok := load(nc, "RA", filename)
+		if !ok {
+			continue
+		}
+		if first == nil {
+			first, firstName = &policies, fmt.Sprintf("%s (%s)", filename, nc.name)
+		} else if !reflect.DeepEqual(*first, policies) {
+			problems = append(problems, fmt.Sprintf(
+				"%s: RA enforces rate limits from %s that differ from those in %s",
+				nc.name, filename, firstName))
+		}
+	}
+	return problems
+}
+
+// lintPolicyFile checks a rate limit policies file on its own.
+func lintPolicyFile(filename string) []string {
+	policies, err := cmd.LoadRateLimitPolicies(filename)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: cannot load rate limit policies: %s", filename, err)}
+	}
+	var problems []string
+	for _, problem := range lintRateLimits(policies) {
+		problems = append(problems, fmt.Sprintf("%s: %s", filename, problem))
+	}
+	return problems
+}
+
+// lintRateLimits finds overrides in policies that can never take effect.
+func lintRateLimits(policies cmd.RateLimitConfig) []string {
+	var problems []string
+	named := policies.Policies()
+	for _, name := range sortedKeys(named) {
+		policy := named[name]
+		if !policy.Enabled() && (len(policy.Overrides) > 0 || len(policy.RegistrationOverrides) > 0 || len(policy.RegistrationKeyOverrides) > 0) {
+			problems = append(problems, fmt.Sprintf("%s has overrides, but they have no effect while its threshold is 0", name))
+		}
+	}
+
+	// certificatesPerName counts by base domain, so an override for any other
+	// name never matches.
+	checkBaseDomain := func(scope, name string) {
+		base, err := publicsuffix.EffectiveTLDPlusOne(name)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("certificatesPerName %s %q is not a valid domain: %s", scope, name, err))
+		} else if base != name {
+			problems = append(problems, fmt.Sprintf(
+				"certificatesPerName %s %q never applies because limits are counted by base domain; use %q",
+				scope, name, base))
+		}
+	}
+	for _, name := range sortedKeys(policies.CertificatesPerName.Overrides) {
+		checkBaseDomain("override", name)
+	}
+	for _, regID := range sortedRegIDs(policies.CertificatesPerName.RegistrationKeyOverrides) {
+		for _, name := range sortedKeys(policies.CertificatesPerName.RegistrationKeyOverrides[regID]) {
+			checkBaseDomain(fmt.Sprintf("override for registration %d on", regID), name)
+		}
+	}
+
+	// certificatesPerFQDNSet keys are sets of names in canonical form
+	checkSet := func(scope, key string) {
+		set := core.UniqueLowerNames(strings.Split(key, ","))
+		sort.Strings(set)
+		if canonical := strings.Join(set, ","); canonical != key {
+			problems = append(problems, fmt.Sprintf(
+				"certificatesPerFQDNSet %s %q never applies because sets of names are lowercased, sorted and deduplicated; use %q",
+				scope, key, canonical))
+		}
+	}
+	for _, key := range sortedKeys(policies.CertificatesPerFQDNSet.Overrides) {
+		checkSet("override", key)
+	}
+	for _, regID := range sortedRegIDs(policies.CertificatesPerFQDNSet.RegistrationKeyOverrides) {
+		for _, key := range sortedKeys(policies.CertificatesPerFQDNSet.RegistrationKeyOverrides[regID]) {
+			checkSet(fmt.Sprintf("override for registration %d on", regID), key)
+		}
+	}
+
+	// The total is never overridden, registrations are limited before they
+	// exist, and pending authorizations and polls are only counted per
+	// registration.
+	total := policies.TotalCertificates
+	if len(total.Overrides) > 0 || len(total.RegistrationOverrides) > 0 || len(total.RegistrationKeyOverrides) > 0 {
+		problems = append(problems, "totalCertificates overrides never apply because the limit is for all certificates")
+	}
+	if len(policies.RegistrationsPerIP.RegistrationOverrides) > 0 {
+		problems = append(problems, "registrationsPerIP registrationOverrides never apply because the limit is checked before the registration exists")
+	}
+	if len(policies.RegistrationsPerIP.RegistrationKeyOverrides) > 0 {
+		problems = append(problems, "registrationsPerIP registrationKeyOverrides never apply because the limit is checked before the registration exists")
+	}
+	for _, name := range []string{"pendingAuthorizationsPerAccount", "pollsPerAccount"} {
+		if len(named[name].Overrides) > 0 {
+			problems = append(problems, fmt.Sprintf("%s overrides never apply; use registrationOverrides", name))
+		}
+		if len(named[name].RegistrationKeyOverrides) > 0 {
+			problems = append(problems, fmt.Sprintf("%s registrationKeyOverrides never apply; use registrationOverrides", name))
+		}
+	}
+	return problems
+}
+
+// checkNoncePrefixes checks that, when a deployment runs several WFEs, each
+// has its own nonce prefix and can redeem the nonces of all the others.
+func checkNoncePrefixes(configs []namedConfig) []string {
+	var problems []string
+	var wfes []namedConfig
+	for _, nc := range configs {
+		if nc.config.WFE.ListenAddress != "" {
+			wfes = append(wfes, nc)
+		}
+	}
+	if len(wfes) < 2 {
+		return nil
+	}
+
+	owners := make(map[string]namedConfig)
+	for _, nc := range wfes {
+		prefix := nc.config.WFE.NoncePrefix
+		if prefix == "" {
+			problems = append(problems, fmt.Sprintf(
+				"%s: WFE has no noncePrefix, but the deployment runs %d WFEs", nc.name, len(wfes)))
+			continue
+		}
+		if other, ok := owners[prefix]; ok {
+			problems = append(problems, fmt.Sprintf(
+				"%s: WFE nonce prefix %q is also used by the WFE in %s", nc.name, prefix, other.name))
+			continue
+		}
+		owners[prefix] = nc
+		if !servesQueue(nc.config.WFE.AMQP) {
+			problems = append(problems, fmt.Sprintf(
+				"%s: WFE has no AMQP serviceQueue, so its peers cannot redeem its nonces", nc.name))
+		}
+	}
+
+	for _, nc := range wfes {
+		own := nc.config.WFE.NoncePrefix
+		peers := nc.config.WFE.NoncePeers
+		for _, prefix := range sortedKeys(owners) {
+			if prefix == own {
+				continue
+			}
+			peer, ok := peers[prefix]
+			if !ok || peer == nil {
+				problems = append(problems, fmt.Sprintf(
+					"%s: WFE cannot redeem nonces with prefix %q issued by the WFE in %s; add it to noncePeers",
+					nc.name, prefix, owners[prefix].name))
+				continue
+			}
+			owner := owners[prefix].config.WFE.AMQP
+			if servesQueue(owner) && peer.Server != owner.ServiceQueue {
+				problems = append(problems, fmt.Sprintf(
+					"%s: WFE redeems nonces with prefix %q on queue %q, but the WFE in %s listens on %q",
+					nc.name, prefix, peer.Server, owners[prefix].name, owner.ServiceQueue))
+			}
+		}
+		for prefix := range peers {
+			if prefix == own {
+				problems = append(problems, fmt.Sprintf(
+					"%s: WFE lists its own nonce prefix %q in noncePeers", nc.name, prefix))
+			} else if _, ok := owners[prefix]; !ok {
+				problems = append(problems, fmt.Sprintf(
+					"%s: WFE noncePeers names prefix %q, which no WFE uses", nc.name, prefix))
+			}
+		}
+	}
+	return problems
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	for _, k := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedRegIDs(m map[int64]map[string]int) []int64 {
+	var regIDs []int64
+	for regID := range m {
+		regIDs = append(regIDs, regID)
+	}
+	sort.Sort(int64Slice(regIDs))
+	return regIDs
+}
+
+type int64Slice []int64
+
+func (s int64Slice) Len() int           { return len(s) }
+func (s int64Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s int64Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func quotedKeys(m map[string]bool) string {
+	var buf bytes.Buffer
+	for i, k := range sortedKeys(m) {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		fmt.Fprintf(&buf, "%q", k)
+	}
+	return buf.String()
+}
+
+func main() {
+	app := cli.NewApp()
+	app.Name = "boulder-config-lint"
+	app.Usage = "Cross-checks the configuration files of a Boulder deployment, given as arguments, and checks rate limit policies files"
+	app.Version = cmd.Version()
+	app.Author = "Boulder contributors"
+	app.Email = "ca-dev@letsencrypt.org"
+
+	app.Flags = []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  "rate-limits",
+			Value: &cli.StringSlice{},
+			Usage: "A rate limit policies file to check on its own; repeat for each file",
+		},
+	}
+
+	app.Action = func(c *cli.Context) {
+		policyFiles := c.StringSlice("rate-limits")
+		if len(c.Args()) == 0 && len(policyFiles) == 0 {
+			fmt.Fprintln(os.Stderr, "At least one config or rate limit policies file is required")
+			os.Exit(2)
+		}
+		var configs []namedConfig
+		for _, filename := range c.Args() {
+			nc, err := loadConfig(filename)
+			cmd.FailOnError(err, fmt.Sprintf("Couldn't load config %s", filename))
+			configs = append(configs, nc)
+		}
+
+		var problems []string
+		if len(configs) > 0 {
+			problems = lint(configs)
+		}
+		for _, filename := range policyFiles {
+			problems = append(problems, lintPolicyFile(filename)...)
+		}
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		if len(problems) > 0 {
+			fmt.Fprintf(os.Stderr, "%d problems found\n", len(problems))
+			os.Exit(1)
+		}
+	}
+
+	app.Run(os.Args)
+}
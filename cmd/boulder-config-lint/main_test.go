@@ -0,0 +1,171 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// testConfig loads the integration test config, which describes a complete,
+// consistent deployment in a single file.
+func testConfig(t *testing.T, name string) namedConfig {
+	nc, err := loadConfig("../../test/boulder-config.json")
+	test.AssertNotError(t, err, "Failed to load test config")
+	nc.name = name
+	nc.config.Common.IssuerCert = "../../test/test-ca.pem"
+	nc.config.RA.RateLimitPoliciesFilename = "../../test/rate-limit-policies.yml"
+	nc.config.WFE.RateLimitPoliciesFilename = "../../test/rate-limit-policies.yml"
+	return nc
+}
+
+func assertProblem(t *testing.T, problems []string, substr string) {
+	for _, p := range problems {
+		if strings.Contains(p, substr) {
+			return
+		}
+	}
+	t.Errorf("No problem containing %q in %q", substr, problems)
+}
+
+func TestConsistentDeployment(t *testing.T) {
+	problems := lint([]namedConfig{testConfig(t, "all.json")})
+	test.AssertEquals(t, len(problems), 0)
+}
+
+func TestServiceQueueMismatch(t *testing.T) {
+	nc := testConfig(t, "all.json")
+	ra := *nc.config.WFE.AMQP.RA
+	ra.Server = "RA.typo"
+	nc.config.WFE.AMQP.RA = &ra
+	problems := lint([]namedConfig{nc})
+	test.AssertEquals(t, len(problems), 1)
+	test.AssertEquals(t, problems[0], `all.json: WFE sends RA requests to queue "RA.typo", but the RA listens on "RA.server"`)
+}
+
+func TestIssuerMismatch(t *testing.T) {
+	wfe := testConfig(t, "wfe.json")
+	ca := testConfig(t, "ca.json")
+	ca.config.Common.IssuerCert = "../../test/test-root.pem"
+	problems := checkIssuers([]namedConfig{wfe, ca})
+	test.AssertEquals(t, len(problems), 1)
+	assertProblem(t, problems, "components use 2 different issuer certificates")
+}
+
+func TestRateLimits(t *testing.T) {
+	policies := cmd.RateLimitConfig{
+		CertificatesPerName: cmd.RateLimitPolicy{
+			Threshold: 2,
+			Overrides: map[string]int{"example.com": 10, "www.example.com": 10},
+		},
+		RegistrationsPerIP: cmd.RateLimitPolicy{
+			RegistrationOverrides: map[int64]int{1: 10},
+		},
+		PendingAuthorizationsPerAccount: cmd.RateLimitPolicy{
+			Threshold: 3,
+			Overrides: map[string]int{"1": 10},
+		},
+		CertificatesPerFQDNSet: cmd.RateLimitPolicy{
+			Threshold: 5,
+			Overrides: map[string]int{"a.com,b.com": 10, "b.com,A.com": 10},
+		},
+	}
+	problems := lintRateLimits(policies)
+	test.AssertEquals(t, len(problems), 5)
+	assertProblem(t, problems, `certificatesPerFQDNSet override "b.com,A.com" never applies`)
+	assertProblem(t, problems, `registrationsPerIP has overrides, but they have no effect`)
+	assertProblem(t, problems, `certificatesPerName override "www.example.com" never applies`)
+	assertProblem(t, problems, `registrationsPerIP registrationOverrides never apply`)
+	assertProblem(t, problems, `pendingAuthorizationsPerAccount overrides never apply`)
+
+	// RAs disagreeing on their policies are reported
+	f, err := ioutil.TempFile("", "rate-limits")
+	test.AssertNotError(t, err, "Failed to create temp file")
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("totalCertificates:\n  window: 2160h\n  threshold: 5\n")
+	test.AssertNotError(t, err, "Failed to write temp file")
+	f.Close()
+	ra1 := testConfig(t, "ra1.json")
+	ra2 := testConfig(t, "ra2.json")
+	ra2.config.RA.RateLimitPoliciesFilename = f.Name()
+	problems = checkRateLimits([]namedConfig{ra1, ra2})
+	test.AssertEquals(t, len(problems), 1)
+	assertProblem(t, problems, "ra2.json: RA enforces rate limits from")
+
+	// Overrides for an account on a domain only apply to certificatesPerName
+	policies = cmd.RateLimitConfig{
+		CertificatesPerName: cmd.RateLimitPolicy{
+			Threshold: 2,
+			RegistrationKeyOverrides: map[int64]map[string]int{
+				1: {"example.com": cmd.Unlimited, "www.example.com": cmd.Unlimited},
+			},
+		},
+		PollsPerAccount: cmd.RateLimitPolicy{
+			Threshold:                10,
+			RegistrationKeyOverrides: map[int64]map[string]int{1: {"example.com": 20}},
+		},
+	}
+	problems = lintRateLimits(policies)
+	test.AssertEquals(t, len(problems), 2)
+	assertProblem(t, problems, `certificatesPerName override for registration 1 on "www.example.com" never applies`)
+	assertProblem(t, problems, `pollsPerAccount registrationKeyOverrides never apply`)
+
+	// Policies files are checked on their own too, and must be valid
+	test.AssertEquals(t, len(lintPolicyFile("../../test/rate-limit-policies.yml")), 0)
+	bad, err := ioutil.TempFile("", "rate-limits")
+	test.AssertNotError(t, err, "Failed to create temp file")
+	defer os.Remove(bad.Name())
+	_, err = bad.WriteString("pollsPerAccount:\n  window: 1m\n  threshold: 10\n  registrationOverrides:\n    1: -5\n")
+	test.AssertNotError(t, err, "Failed to write temp file")
+	bad.Close()
+	problems = lintPolicyFile(bad.Name())
+	test.AssertEquals(t, len(problems), 1)
+	assertProblem(t, problems, "pollsPerAccount: override for registration 1 is -5")
+}
+
+func wfeConfig(t *testing.T, name, prefix, queue string, peers map[string]string) namedConfig {
+	nc := testConfig(t, name)
+	amqp := *nc.config.WFE.AMQP
+	amqp.ServiceQueue = queue
+	nc.config.WFE.AMQP = &amqp
+	nc.config.WFE.NoncePrefix = prefix
+	nc.config.WFE.NoncePeers = make(map[string]*cmd.RPCServerConfig)
+	for p, q := range peers {
+		nc.config.WFE.NoncePeers[p] = &cmd.RPCServerConfig{Server: q}
+	}
+	return nc
+}
+
+func TestNoncePrefixes(t *testing.T) {
+	// A single WFE needs no prefix
+	problems := checkNoncePrefixes([]namedConfig{testConfig(t, "wfe.json")})
+	test.AssertEquals(t, len(problems), 0)
+
+	problems = checkNoncePrefixes([]namedConfig{
+		wfeConfig(t, "wfe1.json", "a", "WFE.a", map[string]string{"b": "WFE.b"}),
+		wfeConfig(t, "wfe2.json", "b", "WFE.b", map[string]string{"a": "WFE.a"}),
+	})
+	test.AssertEquals(t, len(problems), 0)
+
+	problems = checkNoncePrefixes([]namedConfig{
+		wfeConfig(t, "wfe1.json", "a", "WFE.a", map[string]string{"b": "WFE.b"}),
+		wfeConfig(t, "wfe2.json", "a", "WFE.b", map[string]string{"a": "WFE.a"}),
+	})
+	assertProblem(t, problems, `wfe2.json: WFE nonce prefix "a" is also used by the WFE in wfe1.json`)
+
+	problems = checkNoncePrefixes([]namedConfig{
+		wfeConfig(t, "wfe1.json", "a", "WFE.a", nil),
+		wfeConfig(t, "wfe2.json", "b", "WFE.b", map[string]string{"a": "WFE.x"}),
+	})
+	test.AssertEquals(t, len(problems), 2)
+	assertProblem(t, problems, `wfe1.json: WFE cannot redeem nonces with prefix "b"`)
+	assertProblem(t, problems, `wfe2.json: WFE redeems nonces with prefix "a" on queue "WFE.x"`)
+}
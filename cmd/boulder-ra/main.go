@@ -6,19 +6,28 @@
 package main
 
 import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"text/template"
 	"time"
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/admin"
 	"github.com/letsencrypt/boulder/bdns"
 	"github.com/letsencrypt/boulder/metrics"
 	"github.com/letsencrypt/boulder/policy"
 	"github.com/letsencrypt/boulder/sa"
 
 	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/mail"
 	"github.com/letsencrypt/boulder/ra"
 	"github.com/letsencrypt/boulder/rpc"
+	"github.com/letsencrypt/boulder/tsa"
 )
 
 const clientName = "RA"
@@ -28,6 +37,7 @@ func main() {
 	app.Action = func(c cmd.Config, stats statsd.Statter, auditlogger *blog.AuditLogger) {
 		// Validate PA config and set defaults if needed
 		cmd.FailOnError(c.PA.CheckChallenges(), "Invalid PA configuration")
+		cmd.FailOnError(c.CheckEmailIdentifiers(), "Invalid email identifier configuration")
 
 		go cmd.DebugServer(c.RA.DebugAddr)
 
@@ -37,6 +47,8 @@ func main() {
 		cmd.FailOnError(err, "Couldn't connect to policy database")
 		pa, err := policy.NewPolicyAuthorityImpl(paDbMap, c.PA.EnforcePolicyWhitelist, c.PA.Challenges)
 		cmd.FailOnError(err, "Couldn't create PA")
+		pa.EmailIdentifiers = c.PA.EmailIdentifiers
+		pa.HighRiskNames = c.PA.HighRiskNames
 
 		rateLimitPolicies, err := cmd.LoadRateLimitPolicies(c.RA.RateLimitPoliciesFilename)
 		cmd.FailOnError(err, "Couldn't load rate limit policies file")
@@ -58,9 +70,72 @@ func main() {
 			dc = &ra.DomainCheck{VA: vac}
 		}
 
-		rai := ra.NewRegistrationAuthorityImpl(clock.Default(), auditlogger, stats,
+		rai := ra.NewRegistrationAuthorityImpl(cmd.Clock(), auditlogger, stats,
 			dc, rateLimitPolicies, c.RA.MaxContactsPerRegistration)
 		rai.PA = pa
+		rai.BannedContactDomains = c.RA.BannedContactDomains
+		rai.MaxNames = c.RA.MaxNames
+		rai.PrivateCA = c.RA.PrivateCA
+		rai.ReuseValidAuthz = c.RA.ReuseValidAuthz
+		rai.ReuseValidAuthzMinLifetime = c.RA.ReuseValidAuthzMinLifetime.Duration
+		rai.ReusePendingAuthz = c.RA.ReusePendingAuthz
+		rai.CAARecheckAfter = c.RA.CAARecheckAfter.Duration
+		rai.CAARecheckTimeout = c.RA.CAARecheckTimeout.Duration
+		rai.OrderWorkers = c.RA.OrderWorkers
+		rai.OrderStaleAfter = c.RA.OrderStaleAfter.Duration
+		rai.OrderMaxAttempts = c.RA.OrderMaxAttempts
+		rai.Ed25519AccountKeys = c.Common.Ed25519AccountKeys
+		if c.Common.BlockedKeysFile != "" {
+			rai.BlockedKeys, err = core.LoadBlockedKeys(c.Common.BlockedKeysFile)
+			cmd.FailOnError(err, "Couldn't load blocked keys")
+		}
+		if ts := c.RA.Timestamping; ts.URL != "" {
+			timeout := ts.Timeout.Duration
+			if timeout == 0 {
+				timeout = 10 * time.Second
+			}
+			client := tsa.New(ts.URL, timeout)
+			if ts.Policy != "" {
+				client.Policy, err = tsa.ParsePolicy(ts.Policy)
+				cmd.FailOnError(err, "Invalid timestamping configuration")
+			}
+			rai.Timestamper = client
+			rai.TimestampQueueSize = ts.QueueSize
+		}
+		rai.Tiers = make(map[core.AccountTier]ra.TierPolicy)
+		for name, tc := range c.RA.AccountTiers {
+			tier := core.AccountTier(name)
+			if !tier.Known() {
+				cmd.FailOnError(fmt.Errorf("Unknown account tier %q", name), "Invalid account tiers")
+			}
+			rai.Tiers[tier] = ra.TierPolicy{
+				AuthorizationLifetime:        tc.AuthorizationLifetime.Duration,
+				PendingAuthorizationLifetime: tc.PendingAuthorizationLifetime.Duration,
+				MaxPendingAuthorizations:     tc.MaxPendingAuthorizations,
+				OrderLifetime:                tc.OrderLifetime.Duration,
+			}
+		}
+		rai.ProfilePolicies = make(map[string]ra.ProfilePolicy)
+		for profile, pc := range c.RA.ProfilePolicies {
+			policy := ra.ProfilePolicy{Registrations: pc.Registrations, Default: pc.Default}
+			for _, name := range pc.Tiers {
+				tier := core.AccountTier(name)
+				if !tier.Known() {
+					cmd.FailOnError(fmt.Errorf("Unknown account tier %q for profile %q", name, profile), "Invalid profile policies")
+				}
+				policy.Tiers = append(policy.Tiers, tier)
+			}
+			rai.ProfilePolicies[profile] = policy
+		}
+		if c.RA.AdminCACertFile != "" {
+			der, err := cmd.LoadCert(c.RA.AdminCACertFile)
+			cmd.FailOnError(err, "Couldn't load operator CA certificate")
+			adminCA, err := x509.ParseCertificate(der)
+			cmd.FailOnError(err, "Couldn't parse operator CA certificate")
+			roots := x509.NewCertPool()
+			roots.AddCert(adminCA)
+			rai.AdminVerifier = admin.NewVerifier(roots, clock.Default())
+		}
 		raDNSTimeout, err := time.ParseDuration(c.Common.DNSTimeout)
 		cmd.FailOnError(err, "Couldn't parse RA DNS timeout")
 		scoped := metrics.NewStatsdScope(stats, "RA", "DNS")
@@ -74,10 +149,37 @@ func main() {
 		rai.CA = cac
 		rai.SA = sac
 
+		rai.ContactVerifier, err = c.ContactVerifier(cmd.Clock())
+		cmd.FailOnError(err, "Couldn't set up contact verification")
+		if rai.ContactVerifier != nil {
+			emailTmpl, err := ioutil.ReadFile(c.ContactVerification.EmailTemplate)
+			cmd.FailOnError(err, fmt.Sprintf("Could not read email template file [%s]", c.ContactVerification.EmailTemplate))
+			rai.VerificationEmail, err = template.New("verification-email").Parse(string(emailTmpl))
+			cmd.FailOnError(err, "Could not parse email template")
+		}
+		rai.MailboxTokens, err = c.MailboxTokens()
+		cmd.FailOnError(err, "Couldn't set up mailbox validation")
+		if rai.ContactVerifier != nil || rai.MailboxTokens != nil {
+			mailClient := mail.New(c.Mailer.Server, c.Mailer.Port, c.Mailer.Username, c.Mailer.Password)
+			rai.Mailer = &mailClient
+		}
+
 		ras, err := rpc.NewAmqpRPCServer(amqpConf, c.RA.MaxConcurrentRPCServerRequests, stats)
 		cmd.FailOnError(err, "Unable to create RA RPC server")
 		rpc.NewRegistrationAuthorityServer(ras, rai)
 
+		sweepInterval := c.RA.OrderSweepInterval.Duration
+		if sweepInterval == 0 {
+			sweepInterval = time.Minute
+		}
+		go func() {
+			for range time.Tick(sweepInterval) {
+				if err := rai.ResumeCertificateOrders(context.Background()); err != nil {
+					auditlogger.Warning(fmt.Sprintf("Failed to resume stale certificate orders: %s", err))
+				}
+			}
+		}()
+
 		err = ras.Start(amqpConf)
 		cmd.FailOnError(err, "Unable to run RA RPC server")
 	}
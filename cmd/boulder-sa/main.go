@@ -6,14 +6,66 @@
 package main
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
 	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
 	"github.com/letsencrypt/boulder/rpc"
 	"github.com/letsencrypt/boulder/sa"
 )
 
+// checkQueryPlans logs and counts each of the SA's hot queries that MySQL
+// would not run with the expected index.
+func checkQueryPlans(sai *sa.SQLStorageAuthority, stats statsd.Statter, auditlogger *blog.AuditLogger) {
+	errs := sai.CheckQueryPlans()
+	for _, err := range errs {
+		auditlogger.Err(fmt.Sprintf("Bad query plan: %s", err))
+	}
+	stats.Gauge("SA.QueryPlans.Bad", int64(len(errs)), 1.0)
+}
+
+// checkSchema reloads the SA's schema capabilities, and logs and counts
+// each schema change that has run for longer than maxDDL on a table other
+// than expectedTables.
+func checkSchema(sai *sa.SQLStorageAuthority, maxDDL time.Duration, expectedTables []string, stats statsd.Statter, auditlogger *blog.AuditLogger) {
+	if _, err := sai.LoadSchemaCapabilities(); err != nil {
+		auditlogger.Err(fmt.Sprintf("Unable to reload schema capabilities: %s", err))
+	}
+	errs := sai.CheckSchemaChanges(maxDDL, expectedTables)
+	for _, err := range errs {
+		auditlogger.Err(fmt.Sprintf("Unexpected schema change: %s", err))
+	}
+	stats.Gauge("SA.SchemaChanges.Unexpected", int64(len(errs)), 1.0)
+}
+
+// idempotencyKeyCleanupBatch is how many expired idempotency keys are
+// deleted at a time, keeping each delete's locks short.
+const idempotencyKeyCleanupBatch = 1000
+
+// deleteExpiredIdempotencyKeys deletes the idempotency keys that have
+// expired, in batches, and counts them. Schemas without idempotency key
+// expiry are left alone.
+func deleteExpiredIdempotencyKeys(sai *sa.SQLStorageAuthority, clk clock.Clock, stats statsd.Statter, auditlogger *blog.AuditLogger) {
+	for {
+		deleted, err := sai.DeleteExpiredIdempotencyKeys(clk.Now(), idempotencyKeyCleanupBatch)
+		if _, ok := err.(core.NotSupportedError); ok {
+			return
+		}
+		if err != nil {
+			auditlogger.Err(fmt.Sprintf("Unable to delete expired idempotency keys: %s", err))
+			return
+		}
+		stats.Inc("SA.IdempotencyKeys.Deleted", deleted, 1.0)
+		if deleted < idempotencyKeyCleanupBatch {
+			return
+		}
+	}
+}
+
 func main() {
 	app := cmd.NewAppShell("boulder-sa", "Handles SQL operations")
 	app.Action = func(c cmd.Config, stats statsd.Statter, auditlogger *blog.AuditLogger) {
@@ -25,10 +77,49 @@ func main() {
 		dbMap, err := sa.NewDbMap(dbURL)
 		cmd.FailOnError(err, "Couldn't connect to SA database")
 
-		sai, err := sa.NewSQLStorageAuthority(dbMap, clock.Default())
+		clk := cmd.Clock()
+		sai, err := sa.NewSQLStorageAuthority(dbMap, clk)
 		cmd.FailOnError(err, "Failed to create SA impl")
 		sai.SetSQLDebug(c.SQL.SQLDebug)
 
+		checkQueryPlans(sai, stats, auditlogger)
+		if interval := saConf.QueryPlanCheckInterval.Duration; interval > 0 {
+			go func() {
+				for range time.Tick(interval) {
+					func() {
+						defer auditlogger.RecoverPanic("SA.QueryPlanCheck", nil)
+						checkQueryPlans(sai, stats, auditlogger)
+					}()
+				}
+			}()
+		}
+
+		if interval := saConf.SchemaCheckInterval.Duration; interval > 0 {
+			maxDDL := saConf.MaxDDLDuration.Duration
+			if maxDDL == 0 {
+				maxDDL = time.Minute
+			}
+			go func() {
+				for range time.Tick(interval) {
+					func() {
+						defer auditlogger.RecoverPanic("SA.SchemaCheck", nil)
+						checkSchema(sai, maxDDL, saConf.ExpectedDDLTables, stats, auditlogger)
+					}()
+				}
+			}()
+		}
+
+		if interval := saConf.IdempotencyKeyCleanupInterval.Duration; interval > 0 {
+			go func() {
+				for range time.Tick(interval) {
+					func() {
+						defer auditlogger.RecoverPanic("SA.IdempotencyKeyCleanup", nil)
+						deleteExpiredIdempotencyKeys(sai, clk, stats, auditlogger)
+					}()
+				}
+			}()
+		}
+
 		go cmd.ProfileCmd("SA", stats)
 
 		amqpConf := saConf.AMQP
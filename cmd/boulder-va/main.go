@@ -6,14 +6,20 @@
 package main
 
 import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
 	"time"
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
-	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
 	"github.com/letsencrypt/boulder/bdns"
 	"github.com/letsencrypt/boulder/metrics"
 
 	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
 	"github.com/letsencrypt/boulder/rpc"
 	"github.com/letsencrypt/boulder/va"
@@ -43,17 +49,71 @@ func main() {
 			pc.TLSPort = c.VA.PortConfig.TLSPort
 		}
 		sbc := newGoogleSafeBrowsing(c.VA.GoogleSafeBrowsing)
-		vai := va.NewValidationAuthorityImpl(pc, sbc, stats, clock.Default())
+		vai := va.NewValidationAuthorityImpl(pc, sbc, stats, cmd.Clock())
 		dnsTimeout, err := time.ParseDuration(c.Common.DNSTimeout)
 		cmd.FailOnError(err, "Couldn't parse DNS timeout")
 		scoped := metrics.NewStatsdScope(stats, "VA", "DNS")
+		resolvers := c.VA.DNSResolvers
+		if len(resolvers) == 0 {
+			resolvers = []string{c.Common.DNSResolver}
+		}
+		var resolver *bdns.DNSResolverImpl
 		if !c.Common.DNSAllowLoopbackAddresses {
-			vai.DNSResolver = bdns.NewDNSResolverImpl(dnsTimeout, []string{c.Common.DNSResolver}, scoped)
+			resolver = bdns.NewDNSResolverImpl(dnsTimeout, resolvers, scoped)
 		} else {
-			vai.DNSResolver = bdns.NewTestDNSResolverImpl(dnsTimeout, []string{c.Common.DNSResolver}, scoped)
+			resolver = bdns.NewTestDNSResolverImpl(dnsTimeout, resolvers, scoped)
+		}
+		switch c.VA.DNSSelection {
+		case "":
+		case bdns.RoundRobin, bdns.Failover:
+			resolver.Selection = c.VA.DNSSelection
+		default:
+			cmd.FailOnError(fmt.Errorf("%q isn't %q or %q", c.VA.DNSSelection, bdns.RoundRobin, bdns.Failover), "Bad DNS resolver selection")
+		}
+		resolver.MaxFailures = c.VA.DNSMaxFailures
+		resolver.DownFor = c.VA.DNSDownFor.Duration
+		source, err := bdns.ParseSource(c.VA.SourceAddresses.IPv4, c.VA.SourceAddresses.IPv6)
+		cmd.FailOnError(err, "Invalid validation source addresses")
+		resolver.Source = source
+		if dot := c.VA.DNSOverTLS; dot != nil {
+			var roots *x509.CertPool
+			if dot.CACertFile != "" {
+				pemBytes, err := ioutil.ReadFile(dot.CACertFile)
+				cmd.FailOnError(err, "Couldn't read DNS-over-TLS CA certificates")
+				roots = x509.NewCertPool()
+				if !roots.AppendCertsFromPEM(pemBytes) {
+					cmd.FailOnError(fmt.Errorf("No certificates in %s", dot.CACertFile), "Bad DNS-over-TLS CA certificates")
+				}
+			}
+			for _, r := range resolvers {
+				server, ok := dot.Resolvers[r]
+				if !ok {
+					cmd.FailOnError(fmt.Errorf("No settings for resolver %s", r), "Bad DNS-over-TLS config")
+				}
+				for _, pin := range server.Pins {
+					cmd.FailOnError(bdns.ParsePin(pin), "Bad DNS-over-TLS config")
+				}
+			}
+			resolver.TLS = bdns.NewTLSTransport(roots, dot.Resolvers, dnsTimeout)
+		}
+		vai.Source = source
+		vai.DNSResolver = resolver
+
+		if c.VA.MetricsAddr != "" {
+			metricsMux := http.NewServeMux()
+			metricsMux.Handle("/metrics", resolver.MetricsHandler())
+			metricsMux.Handle("/metrics/validations", vai.MetricsHandler())
+			go func() {
+				err := http.ListenAndServe(c.VA.MetricsAddr, metricsMux)
+				cmd.FailOnError(err, "Error serving metrics")
+			}()
 		}
 		vai.UserAgent = c.VA.UserAgent
+		vai.UserAgentIdentifiers = c.VA.UserAgentIdentifiers
+		cmd.FailOnError(va.CheckHeaders(c.VA.Headers), "Invalid validation request headers")
+		vai.Headers = c.VA.Headers
 		vai.IssuerDomain = c.VA.IssuerDomain
+		vai.AccountURIPrefix = c.VA.AccountURIPrefix
 
 		amqpConf := c.VA.AMQP
 		rac, err := rpc.NewRegistrationAuthorityClient(clientName, amqpConf, stats)
@@ -61,9 +121,74 @@ func main() {
 
 		vai.RA = rac
 
+		for _, remoteConf := range c.VA.RemoteVAs {
+			rvc, err := rpc.NewRemoteVAClient(clientName, amqpConf, remoteConf, stats)
+			cmd.FailOnError(err, fmt.Sprintf("Unable to create remote VA client for %q", remoteConf.Server))
+			vai.RemoteVAs = append(vai.RemoteVAs, rvc)
+		}
+		vai.RemoteQuorum = c.VA.RemoteVAQuorum
+		vai.RedirectPolicy = c.VA.RedirectPolicy
+		cmd.FailOnError(c.VA.AddressPolicy.Check(), "Invalid address policy")
+		vai.AddressPolicy = c.VA.AddressPolicy
+		vai.TargetPolicy = c.VA.TargetPolicy
+		cmd.FailOnError(c.VA.Proxy.Check(), "Invalid validation proxy policy")
+		vai.Proxy = c.VA.Proxy
+		vai.RetryPolicy = va.RetryPolicy{
+			MaxAttempts: c.VA.ValidationRetries.MaxAttempts,
+			Backoff:     c.VA.ValidationRetries.Backoff.Duration,
+			MaxBackoff:  c.VA.ValidationRetries.MaxBackoff.Duration,
+		}
+		vai.Deadline = c.VA.ValidationDeadline.Duration
+		vai.Challenges = make(map[string]va.ChallengeConfig, len(c.VA.Challenges))
+		for challengeType, cc := range c.VA.Challenges {
+			var err error
+			v, ok := va.ValidatorFor(challengeType)
+			switch {
+			case !ok || !v.Configurable():
+				err = fmt.Errorf("Unknown challenge type")
+			case v.DefaultPort(vai) != 0:
+				if cc.Port < 0 || cc.Port > 65535 {
+					err = fmt.Errorf("Port %d is out of range", cc.Port)
+				}
+			default:
+				if cc.Port != 0 || cc.ConnectTimeout.Duration != 0 {
+					err = fmt.Errorf("Only a timeout can be set")
+				}
+			}
+			cmd.FailOnError(err, fmt.Sprintf("Invalid configuration for %q challenges", challengeType))
+			vai.Challenges[challengeType] = va.ChallengeConfig{
+				Port:           cc.Port,
+				Timeout:        cc.Timeout.Duration,
+				ConnectTimeout: cc.ConnectTimeout.Duration,
+			}
+		}
+		vai.MailboxTokens, err = c.MailboxTokens()
+		cmd.FailOnError(err, "Couldn't set up mailbox validation")
+
+		if c.VA.TranscriptKeyFile != "" {
+			keyPEM, err := ioutil.ReadFile(c.VA.TranscriptKeyFile)
+			cmd.FailOnError(err, "Couldn't read transcript key")
+			priv, err := core.LoadPrivateKey(keyPEM)
+			cmd.FailOnError(err, "Couldn't parse transcript key")
+			key, ok := priv.(crypto.Signer)
+			if !ok {
+				cmd.FailOnError(fmt.Errorf("%T is not a signing key", priv), "Bad transcript key")
+			}
+			sac, err := rpc.NewStorageAuthorityClient(clientName, amqpConf, stats)
+			cmd.FailOnError(err, "Unable to create SA client")
+			vai.SA = sac
+			vai.TranscriptKey = key
+			vai.Perspective = c.VA.Perspective
+			if vai.Perspective == "" {
+				vai.Perspective, err = os.Hostname()
+				cmd.FailOnError(err, "Couldn't get hostname for transcript perspective")
+			}
+		}
+
 		vas, err := rpc.NewAmqpRPCServer(amqpConf, c.VA.MaxConcurrentRPCServerRequests, stats)
 		cmd.FailOnError(err, "Unable to create VA RPC server")
 		rpc.NewValidationAuthorityServer(vas, vai)
+		rpc.NewRemoteVAServer(vas, vai)
 
 		err = vas.Start(amqpConf)
 		cmd.FailOnError(err, "Unable to run VA RPC server")
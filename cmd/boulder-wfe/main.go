@@ -7,6 +7,7 @@ package main
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 
@@ -16,6 +17,7 @@ import (
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
 
 	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
 	"github.com/letsencrypt/boulder/metrics"
 	"github.com/letsencrypt/boulder/rpc"
@@ -35,6 +37,62 @@ func setupWFE(c cmd.Config, logger *blog.AuditLogger, stats statsd.Statter) (*rp
 	return rac, sac
 }
 
+// certificateProfiles describes the CA's default and selectable profiles for
+// publication in the directory, taking their validity from the CA's CFSSL
+// config.
+func certificateProfiles(c cmd.Config) (map[string]wfe.CertificateProfile, error) {
+	profiles := make(map[string]wfe.CertificateProfile)
+	if c.CA.Profile == "" || c.CA.CFSSL.Signing == nil {
+		return profiles, nil
+	}
+	for _, name := range append([]string{c.CA.Profile}, c.CA.Profiles...) {
+		profile, ok := c.CA.CFSSL.Signing.Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("CA profile %q doesn't exist", name)
+		}
+		validity, err := time.ParseDuration(profile.ExpiryString)
+		if err != nil {
+			return nil, fmt.Errorf("CA profile %q has an invalid expiry: %s", name, err)
+		}
+		profiles[name] = wfe.CertificateProfile{
+			Description: c.WFE.ProfileDescriptions[name],
+			Validity:    int64(validity.Seconds()),
+		}
+	}
+	return profiles, nil
+}
+
+// setupNonces gives the WFE its nonce prefix, connects to the peer instances
+// that can redeem foreign nonces, and serves redemption of this instance's
+// nonces to those peers.
+func setupNonces(c cmd.Config, wfe *wfe.WebFrontEndImpl, stats statsd.Statter) {
+	if c.WFE.NoncePrefix == "" {
+		return
+	}
+	err := wfe.SetNoncePrefix(c.WFE.NoncePrefix)
+	cmd.FailOnError(err, "Unable to set nonce prefix")
+	wfe.NonceAuditSampleRate = c.WFE.NonceAuditSampleRate
+
+	amqpConf := c.WFE.AMQP
+	wfe.NoncePeers = make(map[string]core.NonceRedeemer)
+	for prefix, peerConf := range c.WFE.NoncePeers {
+		nc, err := rpc.NewNonceClient(clientName, amqpConf, peerConf, stats)
+		cmd.FailOnError(err, fmt.Sprintf("Unable to create nonce client for peer %q", prefix))
+		wfe.NoncePeers[prefix] = nc
+	}
+
+	if amqpConf.ServiceQueue == "" {
+		return
+	}
+	ns, err := rpc.NewAmqpRPCServer(amqpConf, c.WFE.MaxConcurrentRPCServerRequests, stats)
+	cmd.FailOnError(err, "Unable to create nonce RPC server")
+	rpc.NewNonceServer(ns, wfe.NonceService())
+	go func() {
+		err := ns.Start(amqpConf)
+		cmd.FailOnError(err, "Unable to run nonce RPC server")
+	}()
+}
+
 func main() {
 	app := cmd.NewAppShell("boulder-wfe", "Handles HTTP API requests")
 	addrFlag := cli.StringFlag{
@@ -53,14 +111,20 @@ func main() {
 	app.Action = func(c cmd.Config, stats statsd.Statter, auditlogger *blog.AuditLogger) {
 		go cmd.DebugServer(c.WFE.DebugAddr)
 
-		wfe, err := wfe.NewWebFrontEndImpl(stats, clock.Default())
+		wfe, err := wfe.NewWebFrontEndImpl(stats, cmd.Clock())
 		cmd.FailOnError(err, "Unable to create WFE")
 		rac, sac := setupWFE(c, auditlogger, stats)
 		wfe.RA = rac
 		wfe.SA = sac
 		wfe.SubscriberAgreementURL = c.SubscriberAgreementURL
 
+		setupNonces(c, &wfe, stats)
+
+		wfe.Profiles, err = certificateProfiles(c)
+		cmd.FailOnError(err, "Couldn't load certificate profiles")
+
 		wfe.AllowOrigins = c.WFE.AllowOrigins
+		wfe.EndpointAllowOrigins = c.WFE.EndpointAllowOrigins
 
 		wfe.CertCacheDuration, err = time.ParseDuration(c.WFE.CertCacheDuration)
 		cmd.FailOnError(err, "Couldn't parse certificate caching duration")
@@ -70,14 +134,66 @@ func main() {
 		cmd.FailOnError(err, "Couldn't parse index caching duration")
 		wfe.IssuerCacheDuration, err = time.ParseDuration(c.WFE.IssuerCacheDuration)
 		cmd.FailOnError(err, "Couldn't parse issuer caching duration")
+		if c.WFE.DirectoryCacheDuration != "" {
+			wfe.DirectoryCacheDuration, err = time.ParseDuration(c.WFE.DirectoryCacheDuration)
+			cmd.FailOnError(err, "Couldn't parse directory caching duration")
+		}
 
 		wfe.ShutdownStopTimeout, err = time.ParseDuration(c.WFE.ShutdownStopTimeout)
 		cmd.FailOnError(err, "Couldn't parse shutdown stop timeout")
 		wfe.ShutdownKillTimeout, err = time.ParseDuration(c.WFE.ShutdownKillTimeout)
 		cmd.FailOnError(err, "Couldn't parse shutdown kill timeout")
 
+		wfe.RequestTimeout = c.WFE.RequestTimeout.Duration
+		wfe.EndpointRequestTimeouts = make(map[string]time.Duration)
+		for path, timeout := range c.WFE.EndpointRequestTimeouts {
+			wfe.EndpointRequestTimeouts[path] = timeout.Duration
+		}
+		wfe.MaxRequestBodySize = c.WFE.MaxRequestBodySize
+		wfe.MaxNames = c.WFE.MaxNames
+		if wfe.MaxNames == 0 {
+			wfe.MaxNames = c.RA.MaxNames
+		}
+		wfe.EnforceJWSHeaders = c.WFE.EnforceJWSHeaders
+		wfe.Ed25519AccountKeys = c.Common.Ed25519AccountKeys
+		wfe.AsyncIssuance = c.WFE.AsyncIssuance
+		wfe.PollPolicy.ValidationLatency = c.WFE.ValidationLatency.Duration
+		wfe.PollPolicy.MaxRetryAfter = c.WFE.MaxRetryAfter.Duration
+		if c.WFE.RateLimitPoliciesFilename != "" {
+			rateLimitPolicies, err := cmd.LoadRateLimitPolicies(c.WFE.RateLimitPoliciesFilename)
+			cmd.FailOnError(err, "Couldn't load rate limit policies file")
+			polls := rateLimitPolicies.PollsPerAccount
+			wfe.PollPolicy.Window = polls.Window.Duration
+			wfe.PollPolicy.MaxPolls = polls.Threshold
+			wfe.PollPolicy.AccountOverrides = polls.RegistrationOverrides
+		} else {
+			wfe.PollPolicy.Window = c.WFE.PollRateLimit.Window.Duration
+			wfe.PollPolicy.MaxPolls = c.WFE.PollRateLimit.MaxPolls
+		}
+		wfe.ClientPolicy.Window = c.WFE.ClientWindow.Duration
+		wfe.ClientPolicy.MinRequests = c.WFE.ClientMinRequests
+		wfe.ClientPolicy.MaxErrorRatio = c.WFE.ClientMaxErrorRatio
+
+		wfe.ValidationUserAgents = c.WFE.ValidationInfo.UserAgents
+		if len(wfe.ValidationUserAgents) == 0 && c.VA.UserAgent != "" {
+			wfe.ValidationUserAgents = []string{c.VA.UserAgent}
+		}
+		for _, cidr := range c.WFE.ValidationInfo.SourceRanges {
+			_, _, err := net.ParseCIDR(cidr)
+			cmd.FailOnError(err, fmt.Sprintf("Invalid validation source range [%s]", cidr))
+		}
+		wfe.ValidationSourceRanges = c.WFE.ValidationInfo.SourceRanges
+
+		wfe.ContactVerifier, err = c.ContactVerifier(cmd.Clock())
+		cmd.FailOnError(err, "Couldn't set up contact verification")
+
 		wfe.IssuerCert, err = cmd.LoadCert(c.Common.IssuerCert)
 		cmd.FailOnError(err, fmt.Sprintf("Couldn't read issuer cert [%s]", c.Common.IssuerCert))
+		for _, issuer := range c.CA.Issuers {
+			issuerCert, err := cmd.LoadCert(issuer.CertFile)
+			cmd.FailOnError(err, fmt.Sprintf("Couldn't read issuer cert [%s]", issuer.CertFile))
+			wfe.FurtherIssuerCerts = append(wfe.FurtherIssuerCerts, issuerCert)
+		}
 
 		go cmd.ProfileCmd("WFE", stats)
 
@@ -86,6 +202,16 @@ func main() {
 		h, err := wfe.Handler()
 		cmd.FailOnError(err, "Problem setting up HTTP handlers")
 
+		if c.WFE.MetricsAddr != "" {
+			metricsMux := http.NewServeMux()
+			metricsMux.Handle("/metrics", wfe.MetricsHandler())
+			metricsMux.Handle("/clients", wfe.ClientReportHandler())
+			go func() {
+				err := http.ListenAndServe(c.WFE.MetricsAddr, metricsMux)
+				cmd.FailOnError(err, "Error serving metrics")
+			}()
+		}
+
 		httpMonitor := metrics.NewHTTPMonitor(stats, h, "WFE")
 
 		auditlogger.Info(fmt.Sprintf("Server running, listening on %s...\n", c.WFE.ListenAddress))
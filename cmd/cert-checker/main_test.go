@@ -6,6 +6,7 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -29,6 +30,8 @@ import (
 	"github.com/letsencrypt/boulder/test/vars"
 )
 
+var ctx = context.Background()
+
 func BenchmarkCheckCert(b *testing.B) {
 	saDbMap, err := sa.NewDbMap(vars.DBConnSA)
 	if err != nil {
@@ -207,7 +210,7 @@ func TestGetAndProcessCerts(t *testing.T) {
 		rawCert.SerialNumber = big.NewInt(i)
 		certDER, err := x509.CreateCertificate(rand.Reader, &rawCert, &rawCert, &testKey.PublicKey, testKey)
 		test.AssertNotError(t, err, "Couldn't create certificate")
-		_, err = sa.AddCertificate(certDER, reg.ID)
+		_, err = sa.AddCertificate(ctx, certDER, reg.ID)
 		test.AssertNotError(t, err, "Couldn't add certificate")
 	}
 
@@ -6,6 +6,7 @@
 package cmd
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -15,7 +16,10 @@ import (
 
 	cfsslConfig "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/config"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/crypto/pkcs11key"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/bdns"
 	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/mail"
 	"github.com/letsencrypt/boulder/va"
 )
 
@@ -39,14 +43,106 @@ type Config struct {
 		ListenAddress string
 
 		AllowOrigins []string
+		// EndpointAllowOrigins overrides AllowOrigins for the paths it
+		// names, e.g. "/directory" or "/acme/new-nonce".
+		EndpointAllowOrigins map[string][]string
 
 		CertCacheDuration           string
 		CertNoCacheExpirationWindow string
 		IndexCacheDuration          string
 		IssuerCacheDuration         string
+		// DirectoryCacheDuration is optional; unset means the directory is
+		// sent without a Cache-Control header.
+		DirectoryCacheDuration string
 
+		// On SIGTERM the WFE stops accepting connections and gives in-flight
+		// requests ShutdownStopTimeout to finish, then closes any remaining
+		// connections and waits up to ShutdownKillTimeout before exiting.
 		ShutdownStopTimeout string
 		ShutdownKillTimeout string
+
+		// RequestTimeout bounds how long the WFE takes to answer a request.
+		// EndpointRequestTimeouts overrides it for the paths it names, e.g.
+		// "/acme/new-cert". Unset means no bound.
+		RequestTimeout          ConfigDuration
+		EndpointRequestTimeouts map[string]ConfigDuration
+
+		// Address to serve Prometheus metrics on, at /metrics. If empty,
+		// metrics aren't served.
+		MetricsAddr string
+
+		// MaxRequestBodySize is the largest POST body, in bytes, the WFE will
+		// read. Zero means no limit.
+		MaxRequestBodySize int64
+
+		// MaxNames is the most identifiers a new-cert request may name.
+		// Zero means no limit.
+		MaxNames int
+
+		// EnforceJWSHeaders rejects POSTs whose JWS headers repeat a
+		// parameter, leave "alg", "nonce" or "url" unprotected, or carry a
+		// "url" other than the one requested. While false, such POSTs are
+		// counted under WFE.Errors.*.Unenforced but still served.
+		EnforceJWSHeaders bool
+
+		// Polls of an authorization or challenge being validated get a
+		// Retry-After of ValidationLatency, doubling with each further poll
+		// up to MaxRetryAfter (default 5m). How often each account may
+		// poll its authorizations and challenges is limited by
+		// pollsPerAccount in the rate limit policies at
+		// RateLimitPoliciesFilename.
+		ValidationLatency         ConfigDuration
+		MaxRetryAfter             ConfigDuration
+		RateLimitPoliciesFilename string
+
+		// AsyncIssuance answers new-cert requests with a certificate order
+		// for clients to poll, paced like validations, once the RA has
+		// accepted them, rather than with the certificate once issued.
+		AsyncIssuance bool
+
+		// Deprecated: PollRateLimit, allowing MaxPolls per Window (default
+		// one minute), is only used without RateLimitPoliciesFilename.
+		PollRateLimit struct {
+			Window   ConfigDuration
+			MaxPolls int
+		}
+
+		// A client version, as named by its User-Agent, is logged and
+		// reported as misbehaving when, within ClientWindow (default one
+		// hour), it makes at least ClientMinRequests requests (default 100)
+		// of which more than ClientMaxErrorRatio (default 0.5) get badNonce
+		// or malformed problems. The worst are listed at /clients on
+		// MetricsAddr.
+		ClientWindow        ConfigDuration
+		ClientMinRequests   int
+		ClientMaxErrorRatio float64
+
+		// ProfileDescriptions, keyed by CA profile name, are published with
+		// the profiles in the directory's meta object.
+		ProfileDescriptions map[string]string
+
+		// NoncePrefix is prepended to every nonce this instance issues. When
+		// several WFEs sit behind one load balancer, each needs a distinct
+		// prefix and a ServiceQueue in its AMQP config on which peers can
+		// redeem its nonces.
+		NoncePrefix string
+		// NoncePeers maps the nonce prefixes of peer WFE instances to the RPC
+		// queues on which they redeem their nonces.
+		NoncePeers map[string]*RPCServerConfig
+		// NonceAuditSampleRate is the fraction, from 0 to 1, of nonce
+		// redemptions logged with the prefix of the instance that issued
+		// the nonce and how long redeeming it took.
+		NonceAuditSampleRate float64
+
+		// ValidationInfo is published at /acme/validation-info so that site
+		// operators can let validation requests through their firewalls. If
+		// UserAgents is empty, the VA's UserAgent is published.
+		ValidationInfo struct {
+			UserAgents   []string
+			SourceRanges []string
+		}
+
+		MaxConcurrentRPCServerRequests int64
 	}
 
 	CA CAConfig
@@ -59,9 +155,102 @@ type Config struct {
 		MaxConcurrentRPCServerRequests int64
 
 		MaxContactsPerRegistration int
+		// BannedContactDomains may not be used, nor may their subdomains,
+		// in the email addresses of registrations' contacts, e.g.
+		// example.com, which no one can receive expiration mail at.
+		BannedContactDomains []string
+
+		// MaxNames is the most names, after normalizing and removing
+		// duplicates, that a certificate may be requested for. The WFE and
+		// CA take it as their own MaxNames when theirs is unset, and the WFE
+		// publishes it in the directory.
+		MaxNames int
 
 		// UseIsSafeDomain determines whether to call VA.IsSafeDomain
 		UseIsSafeDomain bool // TODO(jmhodges): remove after va IsSafeDomain deploy
+
+		// PrivateCA allows certificates to be put on hold with the
+		// certificateHold reason, and released with admin-revoker
+		// serial-release, and new-cert requests to give notBefore and
+		// notAfter, within their profile's validity period. The public CA
+		// profile forbids both.
+		PrivateCA bool
+
+		// AdminCACertFile, if set, is the CA that issues operator
+		// certificates. Administrative requests, from admin-revoker, must
+		// then carry a token signed with one, and are attributed to its
+		// operator.
+		AdminCACertFile string
+
+		// AccountTiers overrides, for the registrations in each account
+		// tier ("default" or "trusted-integrator"), how long their
+		// authorizations last, pending and once valid, how many may be
+		// pending at once, and how long their certificate orders may take
+		// to process; see ra.TierPolicy. Registrations are put in
+		// a tier with admin-revoker reg-set-tier.
+		AccountTiers map[string]struct {
+			AuthorizationLifetime        ConfigDuration
+			PendingAuthorizationLifetime ConfigDuration
+			MaxPendingAuthorizations     int
+			OrderLifetime                ConfigDuration
+		}
+
+		// ReuseValidAuthz returns a registration's existing valid
+		// authorization for an identifier from new-authz, rather than a
+		// new pending one, if it has one lasting at least
+		// ReuseValidAuthzMinLifetime longer.
+		ReuseValidAuthz            bool
+		ReuseValidAuthzMinLifetime ConfigDuration
+
+		// ReusePendingAuthz likewise returns a registration's existing
+		// unexpired pending authorization for an identifier when it has no
+		// valid one to reuse.
+		ReusePendingAuthz bool
+
+		// CAARecheckAfter, if set, rechecks CAA at issuance for the names
+		// last checked longer ago than it, when their authorizations were
+		// validated or by an earlier issuance. The rechecks run in
+		// parallel, and fail issuance if they take longer than
+		// CAARecheckTimeout (10s if unset).
+		CAARecheckAfter   ConfigDuration
+		CAARecheckTimeout ConfigDuration
+
+		// OrderWorkers is how many certificate orders the RA processes at
+		// once (10 if unset). Orders left processing longer than
+		// OrderStaleAfter (10m if unset), by an RA that stopped or had no
+		// room for them, are looked for every OrderSweepInterval (1m if
+		// unset) and resumed, unless they've been begun OrderMaxAttempts
+		// times (3 if unset), when they're failed.
+		OrderWorkers       int
+		OrderStaleAfter    ConfigDuration
+		OrderSweepInterval ConfigDuration
+		OrderMaxAttempts   int
+
+		// ProfilePolicies restricts each named certificate profile to the
+		// listed registrations and those in the listed account tiers, e.g.
+		// to keep a client authentication profile to the accounts of a
+		// private deployment. Profiles not named may be selected by any
+		// registration; see ra.ProfilePolicy.
+		ProfilePolicies map[string]struct {
+			Registrations []int64
+			Tiers         []string
+			// Default uses the profile for the requests of the
+			// registrations allowed it that don't select a profile.
+			Default bool
+		}
+
+		// Timestamping, if its URL is set, has each certificate issued
+		// timestamped by an RFC 3161 time-stamping authority: a token
+		// over the hash of the issuance audit event is audit logged after
+		// it. Policy is the dotted OID of the TSA policy to request, if
+		// not the TSA's default. QueueSize is how many events may wait
+		// to be timestamped in the background.
+		Timestamping struct {
+			URL       string
+			Policy    string
+			Timeout   ConfigDuration
+			QueueSize int
+		}
 	}
 
 	SA struct {
@@ -69,17 +258,144 @@ type Config struct {
 		DBConfig
 
 		MaxConcurrentRPCServerRequests int64
+
+		// How often to re-check that MySQL uses the expected indexes for the
+		// SA's hottest queries. The check always runs at startup; zero
+		// disables the periodic re-check.
+		QueryPlanCheckInterval ConfigDuration
+
+		// How often to reload the schema capabilities recorded by
+		// migrations, so that the SA starts using new tables and columns
+		// without a restart, and to look for schema changes running longer
+		// than MaxDDLDuration on tables other than ExpectedDDLTables, the
+		// ones under an announced online schema change. Zero disables both.
+		SchemaCheckInterval ConfigDuration
+		MaxDDLDuration      ConfigDuration
+		ExpectedDDLTables   []string
+
+		// How often to delete expired idempotency keys. Zero leaves them.
+		IdempotencyKeyCleanupInterval ConfigDuration
 	}
 
 	VA struct {
 		ServiceConfig
 
 		UserAgent string
+		// UserAgentIdentifiers follows the UserAgent of HTTP validation
+		// requests with the account and authorization being validated,
+		// e.g. "boulder (account 42; authorization abc)".
+		UserAgentIdentifiers bool
+		// Headers are sent, with static values, with every HTTP
+		// validation request, so that site operators can allowlist
+		// validation traffic. Host, User-Agent, Accept and the other
+		// headers the VA or Go set can't be configured.
+		Headers map[string]string
 
 		IssuerDomain string
+		// AccountURIPrefix, followed by a registration ID, is the URI of an
+		// account, as named by the accounturi parameter of CAA records
+		// (e.g. "https://acme.example.com/acme/reg/"), and as scoping the
+		// record of dns-account-01 challenges. The experimental
+		// dns-account-01 is offered only if enabled in PA.Challenges.
+		AccountURIPrefix string
 
 		PortConfig va.PortConfig
 
+		// Challenges configures the probes of each challenge type, keyed
+		// by "http-01", "tls-sni-01", "dns-01" or "dns-account-01": the
+		// Port they connect to, the Timeout of each probe and the
+		// ConnectTimeout of each of its connections. Zero values take
+		// PortConfig's port and 5s; the DNS challenges take only a Timeout.
+		Challenges map[string]struct {
+			Port           int
+			Timeout        ConfigDuration
+			ConnectTimeout ConfigDuration
+		}
+
+		// DNSResolvers, if set, replaces Common.DNSResolver with a pool of
+		// resolvers for the VA. DNSSelection is "round-robin" (the default)
+		// or "failover". A resolver that fails DNSMaxFailures queries in a
+		// row (default 3) is passed over for DNSDownFor (default 30s).
+		DNSResolvers   []string
+		DNSSelection   string
+		DNSMaxFailures int
+		DNSDownFor     ConfigDuration
+
+		// DNSOverTLS, if set, sends DNS queries to the resolvers over TLS,
+		// keeping a connection open to each. Every resolver needs an entry
+		// in Resolvers, keyed by address, giving the name its certificate
+		// must be valid for and optionally pins of keys its chain must
+		// contain. Certificates are verified against the PEM CAs in
+		// CACertFile, or the system roots if it's empty.
+		DNSOverTLS *struct {
+			CACertFile string
+			Resolvers  map[string]bdns.TLSServer
+		}
+
+		// Address to serve Prometheus metrics of the VA's DNS queries on,
+		// at /metrics, and of validation outcomes, by challenge type, at
+		// /metrics/validations. If empty, metrics aren't served.
+		MetricsAddr string
+
+		// RedirectPolicy bounds the redirects followed during HTTP
+		// validation; see va.RedirectPolicy for the defaults.
+		RedirectPolicy va.RedirectPolicy
+
+		// AddressPolicy bounds the addresses validation connects to; see
+		// va.AddressPolicy for the ranges blocked by default.
+		AddressPolicy va.AddressPolicy
+
+		// TargetPolicy bounds the connections validation makes to each
+		// hostname and each IP address, concurrently and over time; see
+		// va.TargetPolicy. Unset limits are unlimited.
+		TargetPolicy va.TargetPolicy
+
+		// Proxy sends http-01 validation traffic through a forward proxy,
+		// except to the names and ranges in its NoProxy; see
+		// va.ProxyPolicy. If its URL is empty, validation connects
+		// directly.
+		Proxy va.ProxyPolicy
+
+		// SourceAddresses pins outbound validation traffic, HTTP, TLS and
+		// DNS, to local source addresses so that it leaves through
+		// dedicated, allowlisted IPs. Each of IPv4 and IPv6 is an address
+		// of that family or the name of an interface to take one from;
+		// empty leaves the source to the OS.
+		SourceAddresses struct {
+			IPv4 string
+			IPv6 string
+		}
+
+		// ValidationRetries lets validations that fail with a transient
+		// network error be attempted up to MaxAttempts times, waiting from
+		// Backoff, doubling up to MaxBackoff, between attempts.
+		ValidationRetries struct {
+			MaxAttempts int
+			Backoff     ConfigDuration
+			MaxBackoff  ConfigDuration
+		}
+
+		// ValidationDeadline bounds each validation as a whole, including
+		// retries, the CAA check and remote validations. Zero means no
+		// bound.
+		ValidationDeadline ConfigDuration
+
+		// RemoteVAs are the RPC queues of VA instances in other networks,
+		// which repeat each validation from their own network perspective.
+		// At least RemoteVAQuorum of them must succeed for a validation to
+		// pass; zero requires all of them.
+		RemoteVAs      []*RPCServerConfig
+		RemoteVAQuorum int
+
+		// TranscriptKeyFile is a PEM RSA or ECDSA private key that signs a
+		// transcript of each successful validation, which is stored with
+		// the SA (configured as AMQP.SA). If empty, no transcripts are
+		// kept. It also signs the audit log's record of each request made
+		// during validation. Perspective names this VA's network vantage
+		// point in its transcripts, defaulting to its hostname.
+		TranscriptKeyFile string
+		Perspective       string
+
 		MaxConcurrentRPCServerRequests int64
 
 		GoogleSafeBrowsing *GoogleSafeBrowsingConfig
@@ -94,10 +410,28 @@ type Config struct {
 	Syslog SyslogConfig
 
 	Revoker struct {
-		DBConfig
 		// The revoker isn't a long running service, so doesn't get a full
 		// ServiceConfig, just an AMQPConfig.
 		AMQP *AMQPConfig
+
+		// Operators maps the names of the operators who may approve
+		// dangerous actions, like reg-revoke, to files holding their public
+		// keys. Such actions only run with approvals signed by two of them
+		// within ApprovalWindow (default 15 minutes).
+		Operators      map[string]string
+		ApprovalWindow ConfigDuration
+
+		// DBConfig is only used by plan-revoke, to select the certificates
+		// a bulk revocation plan revokes.
+		DBConfig
+	}
+
+	// ValidationBundle configures the validation-bundle tool, which
+	// exports validation attempts for support. It reads authorizations
+	// through the SA, and finds those for a domain in the database.
+	ValidationBundle struct {
+		DBConfig
+		AMQP *AMQPConfig
 	}
 
 	Mailer struct {
@@ -117,6 +451,19 @@ type Config struct {
 		NagCheckInterval string
 		// Path to a text/template email template
 		EmailTemplate string
+
+		// Preflight checks, before any mail is sent, that receivers can
+		// tell our mail from spam, and refuses to send if they can't: that
+		// the SPF record of the domain of Username, the envelope sender,
+		// passes Server's addresses, that the DKIM keys of DKIMSelectors
+		// are published under DKIMDomain (by default, the From domain),
+		// and that the DMARC policy of the domain of From, the address in
+		// the email template's From header (by default, Username), aligns
+		// with both.
+		Preflight     bool
+		From          string
+		DKIMDomain    string
+		DKIMSelectors []string
 	}
 
 	OCSPResponder struct {
@@ -164,10 +511,66 @@ type Config struct {
 		DNSTimeout                string
 		DNSAllowLoopbackAddresses bool
 
+		// ChaosTesting turns on fault injection, managed through the
+		// chaos package's API on each component's debug server. It's for
+		// integration tests only: anyone who can reach a debug server can
+		// then break the component.
+		ChaosTesting bool
+
+		// ClockSkewTesting lets the clocks of components be shifted,
+		// starting at the duration in the BOULDER_CLOCK_OFFSET environment
+		// variable and managed through the skew package's API on each
+		// component's debug server. It's for integration tests only.
+		ClockSkewTesting bool
+
+		// BlockedKeysFile, if set, is a JSON list of keys, by the base64
+		// SHA-256 hash of their SPKI, that the RA and CA refuse for
+		// registrations and certificates, in addition to the keys blocked
+		// in the SA with admin-revoker.
+		BlockedKeysFile string
+
 		CT struct {
 			Logs                       []LogDescription
 			IntermediateBundleFilename string
 		}
+
+		// Rollouts limits features, by name, to some accounts while they're
+		// tried out, e.g. {"reuseValidAuthz": {"percent": 1, "accounts":
+		// [101]}}. Features without a rollout are enabled for every
+		// account; see core.Rollout.
+		Rollouts map[string]core.Rollout
+
+		// Ed25519AccountKeys lets new registrations use Ed25519 account
+		// keys, signing their requests with EdDSA. It's read by the WFE and
+		// RA, which must agree; certificate keys still can't be Ed25519.
+		Ed25519AccountKeys bool
+	}
+
+	// ContactVerification configures the optional double opt-in of
+	// registration email contacts. When enabled, the RA mails each new
+	// contact a signed link (through the SMTP server in the Mailer config),
+	// the WFE marks the contact verified when the link is followed, and the
+	// expiration mailer only mails verified contacts.
+	ContactVerification struct {
+		Enabled bool
+		// Path to a file holding the secret that links are signed with. The
+		// RA and WFE must use the same secret.
+		SecretFile string
+		// How long a verification link can be followed for
+		LinkLifetime ConfigDuration
+		// Path to a text/template email template, which is given the
+		// Contact and the Link
+		EmailTemplate string
+	}
+
+	// MailboxValidation configures the email-reply-00 challenge for email
+	// identifiers, when PA.EmailIdentifiers enables them. The RA mails half
+	// of each challenge's token, through the SMTP server in the Mailer
+	// config, to the address being validated.
+	MailboxValidation struct {
+		// Path to a file holding the secret that the mailed tokens are
+		// derived from. The RA and VA must use the same secret.
+		SecretFile string
 	}
 
 	CertChecker struct {
@@ -177,9 +580,167 @@ type Config struct {
 		ReportDirectoryPath string
 	}
 
+	OCSPVerifier struct {
+		DBConfig
+
+		// ResponderURL is the public OCSP responder URL, as it appears in
+		// issued certificates, so that responses are fetched through any CDN.
+		ResponderURL string
+		// SampleSize is the number of unexpired certificates checked per run.
+		SampleSize int
+		// ThisUpdateTolerance is how far a response's thisUpdate may lag the
+		// SA's ocspLastUpdated before the response is reported as stale.
+		ThisUpdateTolerance ConfigDuration
+		// Timeout bounds each request to the responder.
+		Timeout ConfigDuration
+	}
+
+	RevocationStream struct {
+		ServiceConfig
+		DBConfig
+
+		ListenAddress string
+		// SigningKeyFile is a PEM RSA or ECDSA private key that signs each
+		// event. Its public key is served at /key.
+		SigningKeyFile string
+		// BatchSize is the most revocations read from the database at once.
+		BatchSize int
+		// PollInterval is how often the database is checked for new
+		// revocations once a consumer has caught up.
+		PollInterval ConfigDuration
+
+		ShutdownStopTimeout ConfigDuration
+		ShutdownKillTimeout ConfigDuration
+	}
+
 	SubscriberAgreementURL string
 }
 
+// SetAMQPDefaults provides default values for each service's AMQP config
+// section from the top-level AMQP section.
+func (config *Config) SetAMQPDefaults() {
+	if config.ActivityMonitor.AMQP == nil {
+		config.ActivityMonitor.AMQP = config.AMQP
+	}
+	if config.WFE.AMQP == nil {
+		config.WFE.AMQP = config.AMQP
+	}
+	if config.CA.AMQP == nil {
+		config.CA.AMQP = config.AMQP
+		if config.CA.AMQP != nil && config.AMQP.CA != nil {
+			config.CA.AMQP.ServiceQueue = config.AMQP.CA.Server
+		}
+	}
+	if config.RA.AMQP == nil {
+		config.RA.AMQP = config.AMQP
+		if config.RA.AMQP != nil && config.AMQP.RA != nil {
+			config.RA.AMQP.ServiceQueue = config.AMQP.RA.Server
+		}
+	}
+	if config.SA.AMQP == nil {
+		config.SA.AMQP = config.AMQP
+		if config.SA.AMQP != nil && config.AMQP.SA != nil {
+			config.SA.AMQP.ServiceQueue = config.AMQP.SA.Server
+		}
+	}
+	if config.VA.AMQP == nil {
+		config.VA.AMQP = config.AMQP
+		if config.VA.AMQP != nil && config.AMQP.VA != nil {
+			config.VA.AMQP.ServiceQueue = config.AMQP.VA.Server
+		}
+	}
+	if config.Mailer.AMQP == nil {
+		config.Mailer.AMQP = config.AMQP
+	}
+	if config.OCSPUpdater.AMQP == nil {
+		config.OCSPUpdater.AMQP = config.AMQP
+	}
+	if config.OCSPResponder.AMQP == nil {
+		config.OCSPResponder.AMQP = config.AMQP
+	}
+	if config.Publisher.AMQP == nil {
+		config.Publisher.AMQP = config.AMQP
+		if config.Publisher.AMQP != nil && config.AMQP.Publisher != nil {
+			config.Publisher.AMQP.ServiceQueue = config.AMQP.Publisher.Server
+		}
+	}
+}
+
+// ContactVerifier loads the secret for contact verification and returns a
+// verifier whose links point at the configured BaseURL, or nil if contact
+// verification isn't enabled.
+func (config *Config) ContactVerifier(clk clock.Clock) (*mail.ContactVerifier, error) {
+	cv := config.ContactVerification
+	if !cv.Enabled {
+		return nil, nil
+	}
+	secret, err := ioutil.ReadFile(cv.SecretFile)
+	if err != nil {
+		return nil, err
+	}
+	return mail.NewContactVerifier(bytes.TrimSpace(secret), config.Common.BaseURL, cv.LinkLifetime.Duration, clk)
+}
+
+// EnableFeatures records the optional features that the configuration
+// enables, which components advertise to each other in RPC messages.
+func (config *Config) EnableFeatures() {
+	if config.PA.EmailIdentifiers {
+		core.EnableFeature("emailIdentifiers")
+	}
+	if len(config.CA.SMIMEProfiles) > 0 {
+		core.EnableFeature("smimeProfiles")
+	}
+	if config.MailboxValidation.SecretFile != "" {
+		core.EnableFeature("mailboxValidation")
+	}
+	if config.ContactVerification.Enabled {
+		core.EnableFeature("contactVerification")
+	}
+	if len(config.VA.RemoteVAs) > 0 {
+		core.EnableFeature("remoteValidation")
+	}
+	if config.Common.Ed25519AccountKeys {
+		core.EnableFeature("ed25519AccountKeys")
+	}
+}
+
+// SetRollouts limits the features being rolled out to the accounts their
+// rollouts pick.
+func (config *Config) SetRollouts() error {
+	for name, rollout := range config.Common.Rollouts {
+		if err := core.SetRollout(name, rollout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckEmailIdentifiers checks that email identifiers are only enabled for a
+// private CA, and that S/MIME profiles are only configured with them.
+func (config *Config) CheckEmailIdentifiers() error {
+	if config.PA.EmailIdentifiers && !config.RA.PrivateCA {
+		return errors.New("Email identifiers can only be enabled with RA.PrivateCA")
+	}
+	if len(config.CA.SMIMEProfiles) > 0 && !config.PA.EmailIdentifiers {
+		return errors.New("S/MIME profiles need PA.EmailIdentifiers")
+	}
+	return nil
+}
+
+// MailboxTokens loads the secret for email-reply-00 validation and returns
+// the MailboxTokens that the RA and VA share, or nil if email identifiers
+// aren't enabled.
+func (config *Config) MailboxTokens() (*mail.MailboxTokens, error) {
+	if !config.PA.EmailIdentifiers {
+		return nil, nil
+	}
+	secret, err := ioutil.ReadFile(config.MailboxValidation.SecretFile)
+	if err != nil {
+		return nil, err
+	}
+	return mail.NewMailboxTokens(bytes.TrimSpace(secret))
+}
+
 // ServiceConfig contains config items that are common to all our services, to
 // be embedded in other config structs.
 type ServiceConfig struct {
@@ -265,11 +826,85 @@ type CAConfig struct {
 	MaxNames int
 	CFSSL    cfsslConfig.Config
 
+	// Profiles names further CFSSL profiles that clients may select in place
+	// of Profile, e.g. for short-lived certificates.
+	Profiles []string
+	// SMIMEProfiles names those of Profiles that issue S/MIME certificates.
+	// They must have the "email protection" usage, and only issue for email
+	// identifiers, which no other profile issues for. They need
+	// PA.EmailIdentifiers.
+	SMIMEProfiles []string
+	// MustStapleProfiles names those of Profile and Profiles under which a
+	// CSR may request the TLS Feature (must-staple) extension, which is
+	// then copied into the certificate. Other profiles refuse such CSRs.
+	// Validity, usages, policy OIDs and embedded SCTs (ct_log_servers)
+	// are set in each profile's CFSSL configuration.
+	MustStapleProfiles []string
+	// ShortLivedProfiles names those of Profile and Profiles whose
+	// certificates are valid for at most 7 days, and so, as the Baseline
+	// Requirements allow, carry no OCSP or CRL URLs: OCSPURL isn't applied
+	// to them, and no OCSP responses are generated for their certificates.
+	ShortLivedProfiles []string
+
+	// IssuerURLs and OCSPURL, if set, replace the issuer_urls and ocsp_url of
+	// the CFSSL profile. They are templates in which "{issuer-id}" is
+	// replaced with IssuerID and "{serial}" with the hex serial number of the
+	// certificate being issued. The CA refuses to start if the URLs aren't
+	// absolute HTTP URLs whose hosts resolve.
+	IssuerURLs []string
+	OCSPURL    string
+	IssuerID   string
+
+	// Issuers are further intermediates, each with its own certificate and
+	// key, that the CA chooses between for each certificate: the first
+	// whose rules allow it signs it, and Common.IssuerCert with Key signs
+	// those no issuer is chosen for. Each signs the OCSP responses for the
+	// certificates it issued. To rotate intermediates without downtime, add
+	// the new one here without rules, and the old one keeps signing OCSP
+	// until it's removed.
+	Issuers []IssuerConfig
+
+	// IssuerDailyQuota caps the certificates issued from this CA's issuers
+	// per UTC day, and ProfileDailyQuotas those issued under each named
+	// profile, e.g. during the rollout of a new intermediate or profile.
+	// Zero or absent means no cap.
+	IssuerDailyQuota   int
+	ProfileDailyQuotas map[string]int
+
+	// AllowedKeys restricts the subject public keys each named profile
+	// issues for, beyond the checks all keys get. Profiles not named issue
+	// for any acceptable key.
+	AllowedKeys map[string]AllowedKeyTypes
+
 	MaxConcurrentRPCServerRequests int64
 
 	HSMFaultTimeout ConfigDuration
 }
 
+// IssuerConfig is one of the further issuers of a CA. Its IssuerID fills
+// "{issuer-id}" in the CA's IssuerURLs and OCSPURL for the certificates it
+// issues. It's chosen for certificates whose subject public keys are of one
+// of KeyTypes ("RSA" or "ECDSA"), under one of Profiles, and only for names
+// that are, or are under, one of Names. Rules left empty allow anything.
+type IssuerConfig struct {
+	CertFile string
+	Key      KeyConfig
+	IssuerID string
+
+	KeyTypes []string
+	Profiles []string
+	Names    []string
+}
+
+// AllowedKeyTypes lists the subject public keys a CA profile issues for: RSA
+// keys with one of the RSA modulus sizes, in bits, and ECDSA keys on one of
+// the ECDSA curves, named as in "P-256". A key type with an empty list isn't
+// allowed at all.
+type AllowedKeyTypes struct {
+	RSA   []int
+	ECDSA []string
+}
+
 // PAConfig specifies how a policy authority should connect to its
 // database, what policies it should enforce, and what challenges
 // it should offer.
@@ -277,6 +912,14 @@ type PAConfig struct {
 	DBConfig
 	EnforcePolicyWhitelist bool
 	Challenges             map[string]bool
+	// EmailIdentifiers allows issuance of S/MIME certificates for email
+	// identifiers, validated with email-reply-00. It needs RA.PrivateCA.
+	EmailIdentifiers bool
+	// HighRiskNames, and names under them, are only issued for once an
+	// operator approves each validated authorization with admin-revoker;
+	// until then it's held as pending-review. Email identifiers are held
+	// by their domain.
+	HighRiskNames []string
 }
 
 // CheckChallenges checks whether the list of challenges in the PA config
@@ -299,7 +942,11 @@ type KeyConfig struct {
 	// A file from which a pkcs11key.Config will be read and parsed, if present
 	ConfigFile string
 	File       string
-	PKCS11     *pkcs11key.Config
+	// A File key must be encrypted as PKCS#8 with the passphrase held in
+	// PassphraseFile, unless InsecurePlaintextKey is set.
+	PassphraseFile       string
+	InsecurePlaintextKey bool
+	PKCS11               *pkcs11key.Config
 }
 
 // TLSConfig reprents certificates and a key for authenticated TLS.
@@ -332,8 +979,29 @@ type OCSPUpdaterConfig struct {
 	MissingSCTBatchSize         int
 	RevokedCertificateBatchSize int
 
+	// ArchiveStatusAfter, if set along with ArchiveStatusWindow and
+	// ArchiveStatusBatchSize, moves the certificateStatus rows of
+	// certificates that expired longer ago than it to the
+	// certificateStatusArchive table, where they're no longer updated or
+	// served by the OCSP responder, but can still be looked up by the SA.
+	ArchiveStatusAfter     ConfigDuration
+	ArchiveStatusWindow    ConfigDuration
+	ArchiveStatusBatchSize int
+
+	// CTInclusionDelay, if set along with CTInclusionWindow and
+	// CTInclusionBatchSize, is how long after a CT log issues an SCT the
+	// publisher starts checking that the log includes the certificate. It
+	// should be at least the logs' maximum merge delay.
+	CTInclusionDelay     ConfigDuration
+	CTInclusionWindow    ConfigDuration
+	CTInclusionBatchSize int
+
 	OCSPMinTimeToExpiry ConfigDuration
 	OldestIssuedSCT     ConfigDuration
+	// MaxSCTAttempts is how many failed attempts to submit a certificate to
+	// a CT log are made before the missing SCT loop gives up on it. Zero
+	// never gives up.
+	MaxSCTAttempts int
 
 	AkamaiBaseURL           string
 	AkamaiClientToken       string
@@ -364,6 +1032,14 @@ type SyslogConfig struct {
 type StatsdConfig struct {
 	Server string
 	Prefix string
+
+	// While dashboards move from StatsD to Prometheus, the metrics sent to
+	// StatsD are also served to Prometheus, at /metrics on each service's
+	// debug address, under the names that metrics-report lists.
+	// DisableStatsd stops sending them to StatsD, once nothing reads them
+	// there, and DisablePrometheus stops serving them.
+	DisableStatsd     bool
+	DisablePrometheus bool
 }
 
 // ConfigDuration is just an alias for time.Duration that allows
@@ -393,9 +1069,9 @@ func (d *ConfigDuration) UnmarshalJSON(b []byte) error {
 	return err
 }
 
-// MarshalJSON returns the string form of the duration, as a byte array.
+// MarshalJSON returns the string form of the duration, as a JSON string.
 func (d ConfigDuration) MarshalJSON() ([]byte, error) {
-	return []byte(d.Duration.String()), nil
+	return json.Marshal(d.Duration.String())
 }
 
 // UnmarshalYAML uses the same frmat as JSON, but is called by the YAML
@@ -7,7 +7,9 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"sort"
@@ -19,15 +21,25 @@ import (
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/codegangsta/cli"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
+	"github.com/letsencrypt/boulder/bdns"
 	"github.com/letsencrypt/boulder/cmd"
 	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
 	"github.com/letsencrypt/boulder/mail"
+	"github.com/letsencrypt/boulder/metrics"
 	"github.com/letsencrypt/boulder/rpc"
 	"github.com/letsencrypt/boulder/sa"
 )
 
-const defaultNagCheckInterval = 24 * time.Hour
+const (
+	defaultNagCheckInterval = 24 * time.Hour
+
+	// Certificates are read from the database this many at a time
+	certBatchSize = 1000
+)
+
+// errCertLimit stops the certificate stream once limit have been processed
+var errCertLimit = errors.New("certificate limit reached")
 
 type emailContent struct {
 	ExpirationDate   time.Time
@@ -36,7 +48,11 @@ type emailContent struct {
 }
 
 type regStore interface {
-	GetRegistration(int64) (core.Registration, error)
+	GetRegistration(context.Context, int64) (core.Registration, error)
+}
+
+type certStore interface {
+	StreamExpiringCertificates(ctx context.Context, earliest, latest time.Time, nagCutoff time.Duration, batchSize int, fn func([]core.Certificate) error) error
 }
 
 type mailer struct {
@@ -44,11 +60,24 @@ type mailer struct {
 	log           *blog.AuditLogger
 	dbMap         *gorp.DbMap
 	rs            regStore
+	cs            certStore
 	mailer        mail.Mailer
 	emailTemplate *template.Template
 	nagTimes      []time.Duration
 	limit         int
 	clk           clock.Clock
+	// If set, only contacts that have been verified are mailed
+	requireVerifiedContacts bool
+	// If set, the mail that would be sent is audit logged instead
+	dryRun bool
+}
+
+// nagContacts returns the contacts of reg that should be sent nags.
+func (m *mailer) nagContacts(reg core.Registration) []*core.AcmeURL {
+	if m.requireVerifiedContacts {
+		return reg.VerifiedContacts
+	}
+	return reg.Contact
 }
 
 func (m *mailer) sendNags(parsedCert *x509.Certificate, contacts []*core.AcmeURL) error {
@@ -71,6 +100,12 @@ func (m *mailer) sendNags(parsedCert *x509.Certificate, contacts []*core.AcmeURL
 			m.stats.Inc("Mailer.Expiration.Errors.SendingNag.TemplateFailure", 1, 1.0)
 			return err
 		}
+		if m.dryRun {
+			m.log.Audit(fmt.Sprintf("expiration-mailer: Dry run: would nag %s about certificate %s for %s, expiring in %d days",
+				strings.Join(emails, ", "), core.SerialToString(parsedCert.SerialNumber), email.DNSNames, expiresIn))
+			m.stats.Inc("Mailer.Expiration.DryRun", int64(len(emails)), 1.0)
+			return nil
+		}
 		startSending := m.clk.Now()
 		err = m.mailer.SendMail(emails, msgBuf.String())
 		if err != nil {
@@ -122,7 +157,7 @@ func (m *mailer) processCerts(certs []core.Certificate) {
 	m.log.Info(fmt.Sprintf("expiration-mailer: Found %d certificates, starting sending messages", len(certs)))
 
 	for _, cert := range certs {
-		reg, err := m.rs.GetRegistration(cert.RegistrationID)
+		reg, err := m.rs.GetRegistration(context.Background(), cert.RegistrationID)
 		if err != nil {
 			m.log.Err(fmt.Sprintf("Error fetching registration %d: %s", cert.RegistrationID, err))
 			m.stats.Inc("Mailer.Expiration.Errors.GetRegistration", 1, 1.0)
@@ -134,11 +169,14 @@ func (m *mailer) processCerts(certs []core.Certificate) {
 			m.stats.Inc("Mailer.Expiration.Errors.ParseCertificate", 1, 1.0)
 			continue
 		}
-		err = m.sendNags(parsedCert, reg.Contact)
+		err = m.sendNags(parsedCert, m.nagContacts(reg))
 		if err != nil {
 			m.log.Err(fmt.Sprintf("Error sending nag emails: %s", err))
 			continue
 		}
+		if m.dryRun {
+			continue
+		}
 		err = m.updateCertStatus(cert.Serial)
 		if err != nil {
 			m.log.Err(fmt.Sprintf("Error updating certificate status for %s: %s", cert.Serial, err))
@@ -161,32 +199,28 @@ func (m *mailer) findExpiringCertificates() error {
 		right := now.Add(expiresIn)
 
 		m.log.Info(fmt.Sprintf("expiration-mailer: Searching for certificates that expire between %s and %s and had last nag >%s before expiry", left, right, expiresIn))
-		var certs []core.Certificate
-		_, err := m.dbMap.Select(
-			&certs,
-			`SELECT cert.* FROM certificates AS cert
-			 JOIN certificateStatus AS cs
-			 ON cs.serial = cert.serial
-			 AND cert.expires > :cutoffA
-			 AND cert.expires <= :cutoffB
-			 AND cs.status != "revoked"
-			 AND COALESCE(TIMESTAMPDIFF(SECOND, cs.lastExpirationNagSent, cert.expires) > :nagCutoff, 1)
-			 ORDER BY cert.expires ASC
-			 LIMIT :limit`,
-			map[string]interface{}{
-				"cutoffA":   left,
-				"cutoffB":   right,
-				"nagCutoff": expiresIn.Seconds(),
-				"limit":     m.limit,
-			},
-		)
-		if err != nil {
+		batchSize := certBatchSize
+		if m.limit < batchSize {
+			batchSize = m.limit
+		}
+		processed := 0
+		processingStarted := m.clk.Now()
+		err := m.cs.StreamExpiringCertificates(context.Background(), left, right, expiresIn, batchSize, func(certs []core.Certificate) error {
+			if remaining := m.limit - processed; len(certs) > remaining {
+				certs = certs[:remaining]
+			}
+			m.processCerts(certs)
+			processed += len(certs)
+			if processed >= m.limit {
+				return errCertLimit
+			}
+			return nil
+		})
+		if err != nil && err != errCertLimit {
 			m.log.Err(fmt.Sprintf("expiration-mailer: Error loading certificates: %s", err))
 			return err // fatal
 		}
-		if len(certs) > 0 {
-			processingStarted := m.clk.Now()
-			m.processCerts(certs)
+		if processed > 0 {
 			m.stats.TimingDuration("Mailer.Expiration.ProcessingCertificatesLatency", time.Since(processingStarted), 1.0)
 		}
 	}
@@ -194,6 +228,20 @@ func (m *mailer) findExpiringCertificates() error {
 	return nil
 }
 
+// preflight audit logs each problem CheckSenderAlignment finds with mail
+// sent as sender, and returns an error if there are any.
+func preflight(resolver bdns.DNSResolver, sender mail.Sender, log *blog.AuditLogger) error {
+	problems := mail.CheckSenderAlignment(resolver, sender)
+	for _, problem := range problems {
+		log.Audit(fmt.Sprintf("expiration-mailer: Preflight: %s", problem))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems with the DNS records of %s", len(problems), sender.From)
+	}
+	log.Info(fmt.Sprintf("expiration-mailer: Preflight: SPF, DKIM and DMARC records of %s are in place", sender.From))
+	return nil
+}
+
 type durationSlice []time.Duration
 
 func (ds durationSlice) Len() int {
@@ -220,10 +268,17 @@ func main() {
 		Usage:  "Count of certificates to process per expiration period",
 	})
 
+	app.App.Flags = append(app.App.Flags, cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Check the From domain's DNS records and audit log the mail that would be sent, without sending it",
+	})
+
+	var dryRun bool
 	app.Config = func(c *cli.Context, config cmd.Config) cmd.Config {
 		if c.GlobalInt("cert_limit") > 0 {
 			config.Mailer.CertLimit = c.GlobalInt("cert_limit")
 		}
+		dryRun = c.GlobalBool("dry-run")
 		return config
 	}
 
@@ -236,6 +291,9 @@ func main() {
 		dbMap, err := sa.NewDbMap(dbURL)
 		cmd.FailOnError(err, "Could not connect to database")
 
+		ssa, err := sa.NewSQLStorageAuthority(dbMap, cmd.Clock())
+		cmd.FailOnError(err, "Could not create SA")
+
 		amqpConf := c.Mailer.AMQP
 		sac, err := rpc.NewStorageAuthorityClient(clientName, amqpConf, stats)
 		cmd.FailOnError(err, "Failed to create SA client")
@@ -248,6 +306,32 @@ func main() {
 
 		mailClient := mail.New(c.Mailer.Server, c.Mailer.Port, c.Mailer.Username, c.Mailer.Password)
 
+		if c.Mailer.Preflight || dryRun {
+			dnsTimeout, err := time.ParseDuration(c.Common.DNSTimeout)
+			cmd.FailOnError(err, "Couldn't parse DNS timeout")
+			scoped := metrics.NewStatsdScope(stats, "Mailer", "DNS")
+			var resolver bdns.DNSResolver
+			if !c.Common.DNSAllowLoopbackAddresses {
+				resolver = bdns.NewDNSResolverImpl(dnsTimeout, []string{c.Common.DNSResolver}, scoped)
+			} else {
+				resolver = bdns.NewTestDNSResolverImpl(dnsTimeout, []string{c.Common.DNSResolver}, scoped)
+			}
+			sender := mail.Sender{
+				From:          c.Mailer.From,
+				Envelope:      c.Mailer.Username,
+				Relay:         c.Mailer.Server,
+				DKIMDomain:    c.Mailer.DKIMDomain,
+				DKIMSelectors: c.Mailer.DKIMSelectors,
+			}
+			if sender.From == "" {
+				sender.From = c.Mailer.Username
+			}
+			err = preflight(resolver, sender, auditlogger)
+			if !dryRun {
+				cmd.FailOnError(err, "Refusing to send mail that receivers can't authenticate")
+			}
+		}
+
 		nagCheckInterval := defaultNagCheckInterval
 		if s := c.Mailer.NagCheckInterval; s != "" {
 			nagCheckInterval, err = time.ParseDuration(s)
@@ -274,11 +358,15 @@ func main() {
 			log:           auditlogger,
 			dbMap:         dbMap,
 			rs:            sac,
+			cs:            ssa,
 			mailer:        &mailClient,
 			emailTemplate: tmpl,
 			nagTimes:      nags,
 			limit:         c.Mailer.CertLimit,
-			clk:           clock.Default(),
+			clk:           cmd.Clock(),
+
+			requireVerifiedContacts: c.ContactVerification.Enabled,
+			dryRun:                  dryRun,
 		}
 
 		auditlogger.Info("expiration-mailer: Starting")
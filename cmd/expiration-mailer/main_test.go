@@ -6,6 +6,7 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -21,10 +22,11 @@ import (
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
-	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
 	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/mail"
 	"github.com/letsencrypt/boulder/mocks"
 	"github.com/letsencrypt/boulder/sa"
 	"github.com/letsencrypt/boulder/test"
@@ -61,7 +63,7 @@ type fakeRegStore struct {
 	RegByID map[int64]core.Registration
 }
 
-func (f fakeRegStore) GetRegistration(id int64) (core.Registration, error) {
+func (f fakeRegStore) GetRegistration(ctx context.Context, id int64) (core.Registration, error) {
 	r, ok := f.RegByID[id]
 	if !ok {
 		msg := fmt.Sprintf("no such registration %d", id)
@@ -145,6 +147,23 @@ func TestSendNags(t *testing.T) {
 	test.AssertEquals(t, len(mc.Messages), 0)
 }
 
+func TestNagContacts(t *testing.T) {
+	email, _ := core.ParseAcmeURL("mailto:rolandshoemaker@gmail.com")
+	emailB, _ := core.ParseAcmeURL("mailto:test@gmail.com")
+	reg := core.Registration{
+		Contact:          []*core.AcmeURL{email, emailB},
+		VerifiedContacts: []*core.AcmeURL{emailB},
+	}
+
+	m := mailer{}
+	test.AssertEquals(t, len(m.nagContacts(reg)), 2)
+
+	m.requireVerifiedContacts = true
+	contacts := m.nagContacts(reg)
+	test.AssertEquals(t, len(contacts), 1)
+	test.AssertEquals(t, contacts[0].String(), emailB.String())
+}
+
 var n = bigIntFromB64("n4EPtAOCc9AlkeQHPzHStgAbgs7bTZLwUBZdR8_KuKPEHLd4rHVTeT-O-XV2jRojdNhxJWTDvNd7nqQ0VEiZQHz_AJmSCpMaJMRBSFKrKb2wqVwGU_NsYOYL-QtiWN2lbzcEe6XC0dApr5ydQLrHqkHHig3RBordaZ6Aj-oBHqFEHYpPe7Tpe-OfVfHd1E6cS6M1FZcD1NNLYD5lFHpPI9bTwJlsde3uhGqC0ZCuEHg8lhzwOHrtIQbS0FVbb9k3-tVTU4fg_3L_vniUFAKwuCLqKnS2BYwdq_mzSnbLY7h_qixoR7jig3__kRhuaxwUkRz5iaiQkqgc5gHdrNP5zw==")
 var e = intFromB64("AQAB")
 var d = bigIntFromB64("bWUC9B-EFRIo8kpGfh0ZuyGPvMNKvYWNtB_ikiH9k20eT-O1q_I78eiZkpXxXQ0UTEs2LsNRS-8uJbvQ-A1irkwMSMkK1J3XTGgdrhCku9gRldY7sNA_AKZGh-Q661_42rINLRCe8W-nZ34ui_qOfkLnK9QWDDqpaIsA-bMwWWSDFu2MUBYwkHTMEzLYGqOe04noqeq1hExBTHBOBdkMXiuFhUq1BU6l-DqEiWxqg82sXt2h-LMnT3046AOYJoRioz75tSUQfGCshWTBnP5uDjd18kKhyv07lhfSJdrPdM5Plyl21hsFf4L_mHCuoFau7gdsPfHPxxjVOcOpBrQzwQ==")
@@ -157,6 +176,60 @@ var testKey = rsa.PrivateKey{
 	Primes:    []*big.Int{p, q},
 }
 
+func TestSendNagsDryRun(t *testing.T) {
+	stats, _ := statsd.NewNoopClient(nil)
+	mc := mockMail{}
+	fc := newFakeClock(t)
+	m := mailer{
+		stats:         stats,
+		log:           blog.GetAuditLogger(),
+		mailer:        &mc,
+		emailTemplate: tmpl,
+		clk:           fc,
+		dryRun:        true,
+	}
+	cert := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotAfter:     fc.Now().AddDate(0, 0, 2),
+		DNSNames:     []string{"example.com"},
+	}
+	email, _ := core.ParseAcmeURL("mailto:rolandshoemaker@gmail.com")
+
+	log.Clear()
+	err := m.sendNags(cert, []*core.AcmeURL{email})
+	test.AssertNotError(t, err, "Dry run failed")
+	test.AssertEquals(t, len(mc.Messages), 0)
+	test.AssertEquals(t, len(log.GetAllMatching("Dry run: would nag rolandshoemaker@gmail.com about certificate 000000000000000000000000000000000001 for example.com, expiring in 2 days")), 1)
+}
+
+type txtRecords struct {
+	mocks.DNSResolver
+	records map[string][]string
+}
+
+func (r *txtRecords) LookupTXT(name string) ([]string, error) {
+	return r.records[name], nil
+}
+
+func TestPreflight(t *testing.T) {
+	resolver := &txtRecords{records: map[string][]string{
+		"example.com":               {"v=spf1 ip4:192.0.2.25 -all"},
+		"s1._domainkey.example.com": {"v=DKIM1; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQC"},
+		"_dmarc.example.com":        {"v=DMARC1; p=quarantine"},
+	}}
+	sender := mail.Sender{From: "certs@example.com", Relay: "192.0.2.25", DKIMSelectors: []string{"s1"}}
+	err := preflight(resolver, sender, blog.GetAuditLogger())
+	test.AssertNotError(t, err, "Aligned domain failed preflight")
+
+	log.Clear()
+	sender.DKIMSelectors = []string{"s1", "s2"}
+	sender.Relay = "192.0.2.26"
+	err = preflight(resolver, sender, blog.GetAuditLogger())
+	test.AssertError(t, err, "Missing DKIM key passed preflight")
+	test.AssertEquals(t, len(log.GetAllMatching("Preflight: No DKIM key published at s2._domainkey.example.com")), 1)
+	test.AssertEquals(t, len(log.GetAllMatching("Preflight: SPF of example.com gives fail for relay 192.0.2.26")), 1)
+}
+
 func TestFindExpiringCertificates(t *testing.T) {
 	ctx := setup(t, []time.Duration{time.Hour * 24, time.Hour * 24 * 4, time.Hour * 24 * 7})
 
@@ -168,8 +241,8 @@ func TestFindExpiringCertificates(t *testing.T) {
 	// Add some expiring certificates and registrations
 	emailA, _ := core.ParseAcmeURL("mailto:one@mail.com")
 	emailB, _ := core.ParseAcmeURL("mailto:twp@mail.com")
-	var keyA jose.JsonWebKey
-	var keyB jose.JsonWebKey
+	var keyA jose.JSONWebKey
+	var keyB jose.JSONWebKey
 	err = json.Unmarshal(jsonKeyA, &keyA)
 	test.AssertNotError(t, err, "Failed to unmarshal public JWK")
 	err = json.Unmarshal(jsonKeyB, &keyB)
@@ -190,11 +263,11 @@ func TestFindExpiringCertificates(t *testing.T) {
 		Key:       keyB,
 		InitialIP: net.ParseIP("2.3.2.3"),
 	}
-	regA, err = ctx.ssa.NewRegistration(regA)
+	regA, err = ctx.ssa.NewRegistration(context.Background(), regA)
 	if err != nil {
 		t.Fatalf("Couldn't store regA: %s", err)
 	}
-	regB, err = ctx.ssa.NewRegistration(regB)
+	regB, err = ctx.ssa.NewRegistration(context.Background(), regB)
 	if err != nil {
 		t.Fatalf("Couldn't store regB: %s", err)
 	}
@@ -299,7 +372,7 @@ func TestLifetimeOfACert(t *testing.T) {
 	ctx := setup(t, []time.Duration{time.Hour * 24, time.Hour * 24 * 4, time.Hour * 24 * 7})
 	defer ctx.cleanUp()
 
-	var keyA jose.JsonWebKey
+	var keyA jose.JSONWebKey
 	err := json.Unmarshal(jsonKeyA, &keyA)
 	test.AssertNotError(t, err, "Failed to unmarshal public JWK")
 
@@ -313,7 +386,7 @@ func TestLifetimeOfACert(t *testing.T) {
 		Key:       keyA,
 		InitialIP: net.ParseIP("1.2.2.1"),
 	}
-	regA, err = ctx.ssa.NewRegistration(regA)
+	regA, err = ctx.ssa.NewRegistration(context.Background(), regA)
 	if err != nil {
 		t.Fatalf("Couldn't store regA: %s", err)
 	}
@@ -404,7 +477,7 @@ func TestDontFindRevokedCert(t *testing.T) {
 	expiresIn := 24 * time.Hour
 	ctx := setup(t, []time.Duration{expiresIn})
 
-	var keyA jose.JsonWebKey
+	var keyA jose.JSONWebKey
 	err := json.Unmarshal(jsonKeyA, &keyA)
 	test.AssertNotError(t, err, "Failed to unmarshal public JWK")
 
@@ -418,7 +491,7 @@ func TestDontFindRevokedCert(t *testing.T) {
 		Key:       keyA,
 		InitialIP: net.ParseIP("6.5.5.6"),
 	}
-	regA, err = ctx.ssa.NewRegistration(regA)
+	regA, err = ctx.ssa.NewRegistration(context.Background(), regA)
 	if err != nil {
 		t.Fatalf("Couldn't store regA: %s", err)
 	}
@@ -496,6 +569,7 @@ func setup(t *testing.T, nagTimes []time.Duration) *testCtx {
 		emailTemplate: tmpl,
 		dbMap:         dbMap,
 		rs:            ssa,
+		cs:            ssa,
 		nagTimes:      offsetNags,
 		limit:         100,
 		clk:           fc,
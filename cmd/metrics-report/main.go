@@ -0,0 +1,145 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// metrics-report shows the Prometheus metric that each StatsD metric is
+// bridged to, so that dashboards can be moved from one to the other. It
+// reads StatsD metric names, one per line, from the files given or stdin,
+// each optionally followed by its StatsD type ("RA.NewCertificates|c",
+// "VA.Validations.http-01.valid|ms"), as in the StatsD protocol, and
+// defaulting to a counter. Whole StatsD lines, with a value, can be fed in
+// as captured. With --mappings, it lists the mappings of the StatsD metrics
+// whose names embed a variable instead.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/codegangsta/cli"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/metrics"
+)
+
+// statsdKinds are the kinds of metric of the StatsD types that are bridged.
+var statsdKinds = map[string]string{
+	"c":  metrics.KindCounter,
+	"g":  metrics.KindGauge,
+	"ms": metrics.KindTiming,
+}
+
+// parseLine returns the name and kind of the StatsD metric on line, or an
+// empty kind if its type isn't bridged.
+func parseLine(line, prefix string) (name, kind string, err error) {
+	name, statsdType := line, "c"
+	if i := strings.Index(line, "|"); i >= 0 {
+		name, statsdType = line[:i], line[i+1:]
+		// Drop the sample rate
+		if j := strings.Index(statsdType, "|"); j >= 0 {
+			statsdType = statsdType[:j]
+		}
+	}
+	// Drop the value
+	if i := strings.Index(name, ":"); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.TrimPrefix(name, prefix)
+	if name == "" {
+		return "", "", fmt.Errorf("No metric name in %q", line)
+	}
+	return name, statsdKinds[statsdType], nil
+}
+
+// report writes the Prometheus metric each StatsD metric read from r is
+// bridged to, once per metric.
+func report(w io.Writer, r io.Reader, prefix string) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATSD\tKIND\tPROMETHEUS\tBY")
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, kind, err := parseLine(line, prefix)
+		if err != nil {
+			return err
+		}
+		if seen[name+"|"+kind] {
+			continue
+		}
+		seen[name+"|"+kind] = true
+		if kind == "" {
+			fmt.Fprintf(tw, "%s\t-\t-\tnot bridged\n", name)
+			continue
+		}
+		b := metrics.Bridge(metrics.DefaultMappings, kind, name)
+		by := "converted name"
+		if b.Mapped {
+			by = "mapping"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", name, kind, b, by)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return tw.Flush()
+}
+
+// listMappings writes the default mappings.
+func listMappings(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATSD\tKIND\tPROMETHEUS\tLABELS")
+	for _, m := range metrics.DefaultMappings {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", m.Pattern, m.Kind, m.Name, strings.Join(m.Labels, ","))
+	}
+	return tw.Flush()
+}
+
+func main() {
+	app := cli.NewApp()
+	app.Name = "metrics-report"
+	app.Usage = "Shows the Prometheus metrics that StatsD metrics, named in the files given or on stdin, are bridged to"
+	app.Version = cmd.Version()
+	app.Author = "Boulder contributors"
+	app.Email = "ca-dev@letsencrypt.org"
+
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "prefix",
+			Usage: "The StatsD prefix to strip from names, as in the statsd config (e.g. \"Boulder.\")",
+		},
+		cli.BoolFlag{
+			Name:  "mappings",
+			Usage: "List the mappings of StatsD metrics whose names embed a variable",
+		},
+	}
+
+	app.Action = func(c *cli.Context) {
+		if c.Bool("mappings") {
+			cmd.FailOnError(listMappings(os.Stdout), "Couldn't list mappings")
+			return
+		}
+		var inputs []io.Reader
+		for _, filename := range c.Args() {
+			f, err := os.Open(filename)
+			cmd.FailOnError(err, "Couldn't open metric names")
+			defer f.Close()
+			inputs = append(inputs, f)
+		}
+		if len(inputs) == 0 {
+			inputs = append(inputs, os.Stdin)
+		}
+		err := report(os.Stdout, io.MultiReader(inputs...), c.String("prefix"))
+		cmd.FailOnError(err, "Couldn't report metrics")
+	}
+
+	app.Run(os.Args)
+}
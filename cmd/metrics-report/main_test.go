@@ -0,0 +1,46 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestReport(t *testing.T) {
+	input := `# captured from statsd
+Boulder.RA.NewCertificates:1|c
+Boulder.RA.NewCertificates:1|c
+Boulder.VA.Validations.http-01.valid:212|ms|@0.5
+Boulder.WFE.Gostats.Goroutines|g
+Boulder.RA.Users:alice|s
+RA.NewRegistrations
+`
+	var out bytes.Buffer
+	err := report(&out, strings.NewReader(input), "Boulder.")
+	test.AssertNotError(t, err, "Report failed")
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	test.AssertEquals(t, len(lines), 6)
+	test.AssertEquals(t, strings.Fields(lines[1])[2], "ra_new_certificates_total")
+	test.AssertEquals(t, strings.Fields(lines[1])[3], "converted")
+	test.AssertEquals(t, strings.Fields(lines[2])[2], `va_validation_duration_seconds{challenge_type="http-01",status="valid"}`)
+	test.AssertEquals(t, strings.Fields(lines[2])[3], "mapping")
+	test.AssertEquals(t, strings.Fields(lines[3])[2], `go_goroutines{service="WFE"}`)
+	test.AssertContains(t, lines[4], "not bridged")
+	test.AssertEquals(t, strings.Fields(lines[5])[1], "counter")
+
+	err = report(&out, strings.NewReader("Boulder.:1|c\n"), "Boulder.")
+	test.AssertError(t, err, "Reported a metric without a name")
+}
+
+func TestListMappings(t *testing.T) {
+	var out bytes.Buffer
+	test.AssertNotError(t, listMappings(&out), "Listing mappings failed")
+	test.AssertContains(t, out.String(), "RPC.ClientCallLatency.*.*")
+}
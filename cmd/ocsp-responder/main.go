@@ -14,6 +14,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
@@ -45,9 +46,9 @@ serialNumber field, since we will always query on it.
 
 */
 type DBSource struct {
-	dbMap     dbSelector
-	caKeyHash []byte
-	log       *blog.AuditLogger
+	dbMap       dbSelector
+	caKeyHashes [][]byte
+	log         *blog.AuditLogger
 }
 
 // Since the only thing we use from gorp is the SelectOne method on the
@@ -59,16 +60,23 @@ type dbSelector interface {
 }
 
 // NewSourceFromDatabase produces a DBSource representing the binding of a
-// given DB schema to a CA key.
-func NewSourceFromDatabase(dbMap dbSelector, caKeyHash []byte, log *blog.AuditLogger) (src *DBSource, err error) {
-	src = &DBSource{dbMap: dbMap, caKeyHash: caKeyHash, log: log}
+// given DB schema to the keys of the CA's issuers.
+func NewSourceFromDatabase(dbMap dbSelector, caKeyHashes [][]byte, log *blog.AuditLogger) (src *DBSource, err error) {
+	src = &DBSource{dbMap: dbMap, caKeyHashes: caKeyHashes, log: log}
 	return
 }
 
 // Response is called by the HTTP server to handle a new OCSP request.
 func (src *DBSource) Response(req *ocsp.Request) ([]byte, bool) {
-	// Check that this request is for the proper CA
-	if bytes.Compare(req.IssuerKeyHash, src.caKeyHash) != 0 {
+	// Check that this request is for one of the CA's issuers
+	issued := false
+	for _, caKeyHash := range src.caKeyHashes {
+		if bytes.Equal(req.IssuerKeyHash, caKeyHash) {
+			issued = true
+			break
+		}
+	}
+	if !issued {
 		src.log.Debug(fmt.Sprintf("Request intended for CA Cert ID: %s", hex.EncodeToString(req.IssuerKeyHash)))
 		return nil, false
 	}
@@ -79,7 +87,7 @@ func (src *DBSource) Response(req *ocsp.Request) ([]byte, bool) {
 	var response []byte
 	defer func() {
 		if len(response) != 0 {
-			src.log.Info(fmt.Sprintf("OCSP Response sent for CA=%s, Serial=%s", hex.EncodeToString(src.caKeyHash), serialString))
+			src.log.Info(fmt.Sprintf("OCSP Response sent for CA=%s, Serial=%s", hex.EncodeToString(req.IssuerKeyHash), serialString))
 		}
 	}()
 	// Note: we first check for an OCSP response in the certificateStatus table (
@@ -114,22 +122,28 @@ func (src *DBSource) Response(req *ocsp.Request) ([]byte, bool) {
 	return response, true
 }
 
-func makeDBSource(dbMap dbSelector, issuerCert string, log *blog.AuditLogger) (*DBSource, error) {
-	// Load the CA's key so we can store its SubjectKey in the DB
-	caCertDER, err := cmd.LoadCert(issuerCert)
-	if err != nil {
-		return nil, fmt.Errorf("Could not read issuer cert %s: %s", issuerCert, err)
-	}
-	caCert, err := x509.ParseCertificate(caCertDER)
-	if err != nil {
-		return nil, fmt.Errorf("Could not parse issuer cert %s: %s", issuerCert, err)
-	}
-	if len(caCert.SubjectKeyId) == 0 {
-		return nil, fmt.Errorf("Empty subjectKeyID")
+// makeDBSource makes a DBSource that answers for the certificates of each of
+// the issuers whose certificate files are issuerCerts.
+func makeDBSource(dbMap dbSelector, issuerCerts []string, log *blog.AuditLogger) (*DBSource, error) {
+	// Load the CA's keys so we can store their SubjectKeys in the DB
+	var caKeyHashes [][]byte
+	for _, issuerCert := range issuerCerts {
+		caCertDER, err := cmd.LoadCert(issuerCert)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read issuer cert %s: %s", issuerCert, err)
+		}
+		caCert, err := x509.ParseCertificate(caCertDER)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse issuer cert %s: %s", issuerCert, err)
+		}
+		if len(caCert.SubjectKeyId) == 0 {
+			return nil, fmt.Errorf("Empty subjectKeyID in issuer cert %s", issuerCert)
+		}
+		caKeyHashes = append(caKeyHashes, caCert.SubjectKeyId)
 	}
 
 	// Construct source from DB
-	return NewSourceFromDatabase(dbMap, caCert.SubjectKeyId, log)
+	return NewSourceFromDatabase(dbMap, caKeyHashes, log)
 }
 
 func main() {
@@ -152,13 +166,19 @@ func main() {
 		cmd.FailOnError(err, fmt.Sprintf("Source was not a URL: %s", config.Source))
 
 		if url.Scheme == "mysql+tcp" {
-			auditlogger.Info(fmt.Sprintf("Loading OCSP Database for CA Cert: %s", c.Common.IssuerCert))
+			// The CA's further issuers sign the OCSP responses for the
+			// certificates they issue, so the responder answers for them too
+			issuerCerts := []string{c.Common.IssuerCert}
+			for _, issuer := range c.CA.Issuers {
+				issuerCerts = append(issuerCerts, issuer.CertFile)
+			}
+			auditlogger.Info(fmt.Sprintf("Loading OCSP Database for CA Certs: %s", strings.Join(issuerCerts, ", ")))
 			dbMap, err := sa.NewDbMap(config.Source)
 			cmd.FailOnError(err, "Could not connect to database")
 			if c.SQL.SQLDebug {
 				sa.SetSQLDebug(dbMap, true)
 			}
-			source, err = makeDBSource(dbMap, c.Common.IssuerCert, auditlogger)
+			source, err = makeDBSource(dbMap, issuerCerts, auditlogger)
 			cmd.FailOnError(err, "Couldn't load OCSP DB")
 		} else if url.Scheme == "file" {
 			filename := url.Path
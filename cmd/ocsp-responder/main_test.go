@@ -52,7 +52,7 @@ func TestHandler(t *testing.T) {
 func TestDBHandler(t *testing.T) {
 	dbMap, err := sa.NewDbMap(vars.DBConnSAOcspResp)
 	test.AssertNotError(t, err, "Could not connect to database")
-	src, err := makeDBSource(dbMap, "./testdata/test-ca.der.pem", blog.GetAuditLogger())
+	src, err := makeDBSource(dbMap, []string{"./testdata/test-ca.der.pem"}, blog.GetAuditLogger())
 	if err != nil {
 		t.Fatalf("makeDBSource: %s", err)
 	}
@@ -101,7 +101,7 @@ func (bs brokenSelector) SelectOne(_ interface{}, _ string, _ ...interface{}) er
 }
 
 func TestErrorLog(t *testing.T) {
-	src, err := makeDBSource(brokenSelector{}, "./testdata/test-ca.der.pem", blog.GetAuditLogger())
+	src, err := makeDBSource(brokenSelector{}, []string{"./testdata/test-ca.der.pem"}, blog.GetAuditLogger())
 	test.AssertNotError(t, err, "Failed to create broken dbMap")
 
 	src.log.SyslogWriter = mocks.NewSyslogWriter()
@@ -117,6 +117,32 @@ func TestErrorLog(t *testing.T) {
 	test.AssertEquals(t, len(mockLog.GetAllMatching("Failed to retrieve response from ocspResponses table")), 1)
 }
 
+// responseSelector returns resp for every query
+type responseSelector struct{}
+
+func (rs responseSelector) SelectOne(holder interface{}, _ string, _ ...interface{}) error {
+	*holder.(*[]byte) = resp
+	return nil
+}
+
+func TestSeveralIssuers(t *testing.T) {
+	ocspReq, err := ocsp.ParseRequest(req)
+	test.AssertNotError(t, err, "Failed to parse OCSP request")
+
+	// Requests for either issuer are answered
+	src, err := makeDBSource(responseSelector{}, []string{"../../test/test-root.pem", "./testdata/test-ca.der.pem"}, blog.GetAuditLogger())
+	test.AssertNotError(t, err, "Failed to make source for several issuers")
+	response, found := src.Response(ocspReq)
+	test.Assert(t, found, "Response for second issuer not found")
+	test.AssertByteEquals(t, response, resp)
+
+	// Requests for no configured issuer aren't
+	src, err = makeDBSource(responseSelector{}, []string{"../../test/test-root.pem"}, blog.GetAuditLogger())
+	test.AssertNotError(t, err, "Failed to make source")
+	_, found = src.Response(ocspReq)
+	test.Assert(t, !found, "Response found for unconfigured issuer")
+}
+
 func mustRead(path string) []byte {
 	f, err := os.Open(path)
 	if err != nil {
@@ -6,6 +6,7 @@
 package main
 
 import (
+	"context"
 	"crypto/x509"
 	"database/sql"
 	"encoding/base64"
@@ -45,6 +46,14 @@ type OCSPUpdater struct {
 	oldestIssuedSCT time.Duration
 	// Number of CT logs we expect to have receipts from
 	numLogs int
+	// Failed attempts after which a certificate is no longer resubmitted
+	// to a CT log; zero retries forever
+	maxSCTAttempts int
+	// How long after expiry certificate statuses are archived
+	archiveStatusAfter time.Duration
+	// How long after an SCT is issued its log's inclusion of the
+	// certificate is checked
+	ctInclusionDelay time.Duration
 
 	loops []*looper
 
@@ -89,6 +98,9 @@ func newUpdater(
 		numLogs:             numLogs,
 		ocspMinTimeToExpiry: config.OCSPMinTimeToExpiry.Duration,
 		oldestIssuedSCT:     config.OldestIssuedSCT.Duration,
+		maxSCTAttempts:      config.MaxSCTAttempts,
+		archiveStatusAfter:  config.ArchiveStatusAfter.Duration,
+		ctInclusionDelay:    config.CTInclusionDelay.Duration,
 	}
 
 	// Setup loops
@@ -138,6 +150,32 @@ func newUpdater(
 		})
 	}
 
+	if config.ArchiveStatusAfter.Duration != 0 &&
+		config.ArchiveStatusBatchSize != 0 &&
+		config.ArchiveStatusWindow.Duration != 0 {
+		updater.loops = append(updater.loops, &looper{
+			clk:       clk,
+			stats:     stats,
+			batchSize: config.ArchiveStatusBatchSize,
+			tickDur:   config.ArchiveStatusWindow.Duration,
+			tickFunc:  updater.archiveStatusesTick,
+			name:      "ArchiveStatuses",
+		})
+	}
+
+	if config.CTInclusionDelay.Duration != 0 &&
+		config.CTInclusionBatchSize != 0 &&
+		config.CTInclusionWindow.Duration != 0 {
+		updater.loops = append(updater.loops, &looper{
+			clk:       clk,
+			stats:     stats,
+			batchSize: config.CTInclusionBatchSize,
+			tickDur:   config.CTInclusionWindow.Duration,
+			tickFunc:  updater.ctInclusionTick,
+			name:      "CTInclusion",
+		})
+	}
+
 	// TODO(#1050): Remove this gate and the nil ccu checks below
 	if config.AkamaiBaseURL != "" {
 		issuer, err := core.LoadCert(issuerPath)
@@ -193,9 +231,25 @@ func (updater *OCSPUpdater) sendPurge(der []byte) {
 	}
 }
 
+// notShortLived returns the condition leaving the statuses of short-lived
+// certificates, which get no OCSP responses, out of a query, with column
+// naming their isShortLived column. Until the schema has that column, none
+// is needed: they're left out by an ocspLastUpdated of their expiry.
+func (updater *OCSPUpdater) notShortLived(column string) (string, error) {
+	marked, err := sa.SchemaCapable(updater.dbMap, sa.CapabilityCertificateStatusIsShortLived)
+	if err != nil || !marked {
+		return "", err
+	}
+	return "AND NOT " + column, nil
+}
+
 func (updater *OCSPUpdater) findStaleOCSPResponses(oldestLastUpdatedTime time.Time, batchSize int) ([]core.CertificateStatus, error) {
+	notShortLived, err := updater.notShortLived("cs.isShortLived")
+	if err != nil {
+		return nil, err
+	}
 	var statuses []core.CertificateStatus
-	_, err := updater.dbMap.Select(
+	_, err = updater.dbMap.Select(
 		&statuses,
 		`SELECT cs.*
 			 FROM certificateStatus AS cs
@@ -203,6 +257,7 @@ func (updater *OCSPUpdater) findStaleOCSPResponses(oldestLastUpdatedTime time.Ti
 			 ON cs.serial = cert.serial
 			 WHERE cs.ocspLastUpdated < :lastUpdate
 			 AND cert.expires > now()
+			 `+notShortLived+`
 			 ORDER BY cs.ocspLastUpdated ASC
 			 LIMIT :limit`,
 		map[string]interface{}{
@@ -217,11 +272,16 @@ func (updater *OCSPUpdater) findStaleOCSPResponses(oldestLastUpdatedTime time.Ti
 }
 
 func (updater *OCSPUpdater) getCertificatesWithMissingResponses(batchSize int) ([]core.CertificateStatus, error) {
+	notShortLived, err := updater.notShortLived("isShortLived")
+	if err != nil {
+		return nil, err
+	}
 	var statuses []core.CertificateStatus
-	_, err := updater.dbMap.Select(
+	_, err = updater.dbMap.Select(
 		&statuses,
 		`SELECT * FROM certificateStatus
 			 WHERE ocspLastUpdated = 0
+			 `+notShortLived+`
 			 LIMIT :limit`,
 		map[string]interface{}{
 			"limit": batchSize,
@@ -261,7 +321,7 @@ func (updater *OCSPUpdater) generateResponse(status core.CertificateStatus) (*co
 		RevokedAt: status.RevokedDate,
 	}
 
-	ocspResponse, err := updater.cac.GenerateOCSP(signRequest)
+	ocspResponse, err := updater.cac.GenerateOCSP(context.Background(), signRequest)
 	if err != nil {
 		return nil, err
 	}
@@ -278,7 +338,7 @@ func (updater *OCSPUpdater) generateResponse(status core.CertificateStatus) (*co
 }
 
 func (updater *OCSPUpdater) generateRevokedResponse(status core.CertificateStatus) (*core.CertificateStatus, error) {
-	cert, err := updater.sac.GetCertificate(status.Serial)
+	cert, err := updater.sac.GetCertificate(context.Background(), status.Serial)
 	if err != nil {
 		return nil, err
 	}
@@ -290,7 +350,7 @@ func (updater *OCSPUpdater) generateRevokedResponse(status core.CertificateStatu
 		RevokedAt: status.RevokedDate,
 	}
 
-	ocspResponse, err := updater.cac.GenerateOCSP(signRequest)
+	ocspResponse, err := updater.cac.GenerateOCSP(context.Background(), signRequest)
 	if err != nil {
 		return nil, err
 	}
@@ -341,12 +401,17 @@ func (updater *OCSPUpdater) newCertificateTick(batchSize int) error {
 }
 
 func (updater *OCSPUpdater) findRevokedCertificatesToUpdate(batchSize int) ([]core.CertificateStatus, error) {
+	notShortLived, err := updater.notShortLived("isShortLived")
+	if err != nil {
+		return nil, err
+	}
 	var statuses []core.CertificateStatus
-	_, err := updater.dbMap.Select(
+	_, err = updater.dbMap.Select(
 		&statuses,
 		`SELECT * FROM certificateStatus
 		 WHERE status = :revoked
 		 AND ocspLastUpdated <= revokedDate
+		 `+notShortLived+`
 		 LIMIT :limit`,
 		map[string]interface{}{
 			"revoked": string(core.OCSPStatusRevoked),
@@ -434,18 +499,46 @@ func (updater *OCSPUpdater) getSerialsIssuedSince(since time.Time, batchSize int
 	return serials, err
 }
 
-func (updater *OCSPUpdater) getNumberOfReceipts(serial string) (int, error) {
-	var count int
-	err := updater.dbMap.SelectOne(
-		&count,
-		"SELECT COUNT(id) FROM sctReceipts WHERE certificateSerial = :serial",
+// getSubmissionCounts returns how many CT logs have issued an SCT for the
+// certificate with the given serial, and how many more it won't be
+// resubmitted to because every attempt has failed maxSCTAttempts times.
+// Until ctSubmissions replaces sctReceipts failed attempts aren't recorded,
+// so none are exhausted.
+func (updater *OCSPUpdater) getSubmissionCounts(serial string) (submitted, exhausted int, err error) {
+	capable, err := sa.SchemaCapable(updater.dbMap, sa.CapabilityCTSubmissions)
+	if err != nil {
+		return
+	}
+	query := "SELECT status, attempts FROM ctSubmissions WHERE certificateSerial = :serial"
+	if !capable {
+		query = "SELECT 'submitted' AS status, 1 AS attempts FROM sctReceipts WHERE certificateSerial = :serial"
+	}
+	var submissions []struct {
+		Status   core.CTSubmissionStatus `db:"status"`
+		Attempts int                     `db:"attempts"`
+	}
+	_, err = updater.dbMap.Select(
+		&submissions,
+		query,
 		map[string]interface{}{"serial": serial},
 	)
-	return count, err
+	if err != nil {
+		return
+	}
+	for _, submission := range submissions {
+		switch {
+		case submission.Status == core.CTSubmissionSubmitted:
+			submitted++
+		case updater.maxSCTAttempts > 0 && submission.Attempts >= updater.maxSCTAttempts:
+			exhausted++
+		}
+	}
+	return
 }
 
-// missingReceiptsTick looks for certificates without the correct number of SCT
-// receipts and retrieves them
+// missingReceiptsTick looks for certificates without an SCT from each CT
+// log and resubmits them, giving up on logs that have failed maxSCTAttempts
+// times, which admin-revoker ct-status then shows.
 func (updater *OCSPUpdater) missingReceiptsTick(batchSize int) error {
 	now := updater.clk.Now()
 	since := now.Add(-updater.oldestIssuedSCT)
@@ -456,21 +549,25 @@ func (updater *OCSPUpdater) missingReceiptsTick(batchSize int) error {
 	}
 
 	for _, serial := range serials {
-		count, err := updater.getNumberOfReceipts(serial)
+		submitted, exhausted, err := updater.getSubmissionCounts(serial)
 		if err != nil {
-			updater.log.AuditErr(fmt.Errorf("Failed to get number of SCT receipts for certificate: %s", err))
+			updater.log.AuditErr(fmt.Errorf("Failed to get CT submissions of certificate: %s", err))
 			continue
 		}
-		if count == updater.numLogs {
+		if submitted == updater.numLogs {
 			continue
 		}
-		cert, err := updater.sac.GetCertificate(serial)
+		if submitted+exhausted >= updater.numLogs {
+			updater.stats.Inc("OCSP.MissingSCTReceipts.GaveUp", 1, 1.0)
+			continue
+		}
+		cert, err := updater.sac.GetCertificate(context.Background(), serial)
 		if err != nil {
 			updater.log.AuditErr(fmt.Errorf("Failed to get certificate: %s", err))
 			continue
 		}
 
-		err = updater.pubc.SubmitToCT(cert.DER)
+		err = updater.pubc.SubmitToCT(context.Background(), cert.DER)
 		if err != nil {
 			updater.log.AuditErr(fmt.Errorf("Failed to submit certificate to CT log: %s", err))
 			continue
@@ -479,6 +576,138 @@ func (updater *OCSPUpdater) missingReceiptsTick(batchSize int) error {
 	return nil
 }
 
+// findStatusesToArchive returns the serials of up to batchSize certificates
+// that expired before expiredBefore and still have a certificateStatus row.
+func (updater *OCSPUpdater) findStatusesToArchive(expiredBefore time.Time, batchSize int) ([]string, error) {
+	var serials []string
+	_, err := updater.dbMap.Select(
+		&serials,
+		`SELECT cs.serial
+			 FROM certificateStatus AS cs
+			 JOIN certificates AS cert
+			 ON cs.serial = cert.serial
+			 WHERE cert.expires < :expiredBefore
+			 LIMIT :limit`,
+		map[string]interface{}{
+			"expiredBefore": expiredBefore,
+			"limit":         batchSize,
+		},
+	)
+	if err == sql.ErrNoRows {
+		return serials, nil
+	}
+	return serials, err
+}
+
+// archiveStatus moves the certificateStatus row of serial to the
+// certificateStatusArchive table, in one transaction so that the status is
+// always in exactly one of them.
+func (updater *OCSPUpdater) archiveStatus(serial string) error {
+	tx, err := updater.dbMap.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		`INSERT INTO certificateStatusArchive
+			 SELECT * FROM certificateStatus WHERE serial = ?`,
+		serial,
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM certificateStatus WHERE serial = ?", serial)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// archiveStatusesTick moves the statuses of certificates that expired more
+// than archiveStatusAfter ago out of the certificateStatus table, which the
+// other loops and the OCSP responder work from, into the archive.
+func (updater *OCSPUpdater) archiveStatusesTick(batchSize int) error {
+	serials, err := updater.findStatusesToArchive(updater.clk.Now().Add(-updater.archiveStatusAfter), batchSize)
+	if err != nil {
+		updater.stats.Inc("OCSP.Errors.FindStatusesToArchive", 1, 1.0)
+		updater.log.AuditErr(fmt.Errorf("Failed to find certificate statuses to archive: %s", err))
+		return err
+	}
+
+	for _, serial := range serials {
+		err = updater.archiveStatus(serial)
+		if err != nil {
+			updater.stats.Inc("OCSP.Errors.ArchiveStatus", 1, 1.0)
+			updater.log.AuditErr(fmt.Errorf("Failed to archive certificate status of %s: %s", serial, err))
+			continue
+		}
+		updater.stats.Inc("OCSP.ArchivedStatuses", 1, 1.0)
+	}
+	return nil
+}
+
+// findUnverifiedInclusions returns the serials of up to batchSize
+// certificates with an SCT issued before issuedBefore by a CT log that
+// hasn't yet been seen to include them, oldest SCT first. There are none
+// until ctSubmissions, which records inclusion, replaces sctReceipts.
+func (updater *OCSPUpdater) findUnverifiedInclusions(issuedBefore time.Time, batchSize int) ([]string, error) {
+	capable, err := sa.SchemaCapable(updater.dbMap, sa.CapabilityCTSubmissions)
+	if err != nil || !capable {
+		return nil, err
+	}
+	var serials []string
+	_, err = updater.dbMap.Select(
+		&serials,
+		`SELECT certificateSerial FROM ctSubmissions
+			 WHERE status = :status
+			 AND inclusionStatus = :inclusionStatus
+			 AND timestamp < :issuedBefore
+			 GROUP BY certificateSerial
+			 ORDER BY MIN(timestamp) ASC
+			 LIMIT :limit`,
+		map[string]interface{}{
+			"status":          string(core.CTSubmissionSubmitted),
+			"inclusionStatus": string(core.CTInclusionUnverified),
+			// SCT timestamps are in milliseconds
+			"issuedBefore": issuedBefore.UnixNano() / int64(time.Millisecond),
+			"limit":        batchSize,
+		},
+	)
+	if err == sql.ErrNoRows {
+		return serials, nil
+	}
+	return serials, err
+}
+
+// ctInclusionTick has the publisher check that the CT logs that issued
+// SCTs more than ctInclusionDelay ago include their certificates. Those a
+// log hasn't yet signed a tree head for since its maximum merge delay, or
+// that couldn't be checked, stay unverified and are checked again.
+func (updater *OCSPUpdater) ctInclusionTick(batchSize int) error {
+	serials, err := updater.findUnverifiedInclusions(updater.clk.Now().Add(-updater.ctInclusionDelay), batchSize)
+	if err != nil {
+		updater.stats.Inc("OCSP.Errors.FindUnverifiedInclusions", 1, 1.0)
+		updater.log.AuditErr(fmt.Errorf("Failed to find unverified CT inclusions: %s", err))
+		return err
+	}
+
+	for _, serial := range serials {
+		cert, err := updater.sac.GetCertificate(context.Background(), serial)
+		if err != nil {
+			updater.log.AuditErr(fmt.Errorf("Failed to get certificate: %s", err))
+			continue
+		}
+		err = updater.pubc.CheckCTInclusion(context.Background(), cert.DER)
+		if err != nil {
+			updater.stats.Inc("OCSP.Errors.CheckCTInclusion", 1, 1.0)
+			updater.log.AuditErr(fmt.Errorf("Failed to check CT inclusion of %s: %s", serial, err))
+			continue
+		}
+	}
+	return nil
+}
+
 type looper struct {
 	clk                  clock.Clock
 	stats                statsd.Statter
@@ -491,9 +720,18 @@ type looper struct {
 	failures             int
 }
 
+// runTick runs tickFunc, turning a panic into a failed tick so that one bad
+// batch doesn't stop the updater.
+func (l *looper) runTick() (err error) {
+	defer blog.GetAuditLogger().RecoverPanic(fmt.Sprintf("OCSP.%s", l.name), func(p interface{}) {
+		err = core.InternalServerError(fmt.Sprintf("Tick panicked: %v", p))
+	})
+	return l.tickFunc(l.batchSize)
+}
+
 func (l *looper) tick() {
 	tickStart := l.clk.Now()
-	err := l.tickFunc(l.batchSize)
+	err := l.runTick()
 	l.stats.TimingDuration(fmt.Sprintf("OCSP.%s.TickDuration", l.name), time.Since(tickStart), 1.0)
 	l.stats.Inc(fmt.Sprintf("OCSP.%s.Ticks", l.name), 1, 1.0)
 	tickEnd := tickStart.Add(time.Since(tickStart))
@@ -569,7 +807,7 @@ func main() {
 
 		updater, err := newUpdater(
 			stats,
-			clock.Default(),
+			cmd.Clock(),
 			dbMap,
 			cac,
 			pubc,
@@ -1,7 +1,12 @@
 package main
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/x509"
+	"math/big"
 	"testing"
 	"time"
 
@@ -18,36 +23,53 @@ import (
 	"github.com/letsencrypt/boulder/test/vars"
 )
 
+var ctx = context.Background()
+
 type mockCA struct{}
 
-func (ca *mockCA) IssueCertificate(csr x509.CertificateRequest, regID int64) (core.Certificate, error) {
+func (ca *mockCA) IssueCertificate(ctx context.Context, csr x509.CertificateRequest, regID int64, profile string, validity core.Validity) (core.Certificate, error) {
 	return core.Certificate{}, nil
 }
 
-func (ca *mockCA) GenerateOCSP(xferObj core.OCSPSigningRequest) (ocsp []byte, err error) {
+func (ca *mockCA) GenerateOCSP(ctx context.Context, xferObj core.OCSPSigningRequest) (ocsp []byte, err error) {
 	ocsp = []byte{1, 2, 3}
 	return
 }
 
-func (ca *mockCA) RevokeCertificate(serial string, reasonCode core.RevocationCode) (err error) {
+func (ca *mockCA) RevokeCertificate(ctx context.Context, serial string, reasonCode core.RevocationCode) (err error) {
 	return
 }
 
 type mockPub struct {
 	sa core.StorageAuthority
+	// failing makes submissions fail
+	failing bool
 }
 
-func (p *mockPub) SubmitToCT(_ []byte) error {
-	return p.sa.AddSCTReceipt(core.SignedCertificateTimestamp{
-		SCTVersion:        0,
+func (p *mockPub) SubmitToCT(ctx context.Context, _ []byte) error {
+	if p.failing {
+		return p.sa.RecordCTSubmission(ctx, core.CTSubmission{
+			CertificateSerial: "00",
+			LogID:             "id",
+			Status:            core.CTSubmissionPending,
+			LastError:         "log unavailable",
+		})
+	}
+	return p.sa.RecordCTSubmission(ctx, core.CTSubmission{
+		CertificateSerial: "00",
 		LogID:             "id",
+		Status:            core.CTSubmissionSubmitted,
+		SCTVersion:        0,
 		Timestamp:         0,
 		Extensions:        []byte{},
 		Signature:         []byte{0},
-		CertificateSerial: "00",
 	})
 }
 
+func (p *mockPub) CheckCTInclusion(ctx context.Context, _ []byte) error {
+	return p.sa.RecordCTInclusion(ctx, "00", "id", core.CTInclusionVerified)
+}
+
 var log = mocks.UseMockLog()
 
 func setup(t *testing.T) (*OCSPUpdater, core.StorageAuthority, *gorp.DbMap, clock.FakeClock, func()) {
@@ -69,7 +91,7 @@ func setup(t *testing.T) (*OCSPUpdater, core.StorageAuthority, *gorp.DbMap, cloc
 		fc,
 		dbMap,
 		&mockCA{},
-		&mockPub{sa},
+		&mockPub{sa: sa},
 		sa,
 		cmd.OCSPUpdaterConfig{
 			NewCertificateBatchSize: 1,
@@ -93,10 +115,10 @@ func TestGenerateAndStoreOCSPResponse(t *testing.T) {
 	reg := satest.CreateWorkingRegistration(t, sa)
 	parsedCert, err := core.LoadCert("test-cert.pem")
 	test.AssertNotError(t, err, "Couldn't read test certificate")
-	_, err = sa.AddCertificate(parsedCert.Raw, reg.ID)
+	_, err = sa.AddCertificate(ctx, parsedCert.Raw, reg.ID)
 	test.AssertNotError(t, err, "Couldn't add www.eff.org.der")
 
-	status, err := sa.GetCertificateStatus(core.SerialToString(parsedCert.SerialNumber))
+	status, err := sa.GetCertificateStatus(ctx, core.SerialToString(parsedCert.SerialNumber))
 	test.AssertNotError(t, err, "Couldn't get the core.CertificateStatus from the database")
 
 	meta, err := updater.generateResponse(status)
@@ -109,7 +131,7 @@ func TestGenerateAndStoreOCSPResponse(t *testing.T) {
 	err = updater.storeResponse(secondMeta)
 	test.AssertNotError(t, err, "Couldn't store certificate status")
 
-	newStatus, err := sa.GetCertificateStatus(status.Serial)
+	newStatus, err := sa.GetCertificateStatus(ctx, status.Serial)
 	test.AssertNotError(t, err, "Couldn't retrieve certificate status")
 	test.AssertByteEquals(t, meta.OCSPResponse, newStatus.OCSPResponse)
 }
@@ -121,11 +143,11 @@ func TestGenerateOCSPResponses(t *testing.T) {
 	reg := satest.CreateWorkingRegistration(t, sa)
 	parsedCert, err := core.LoadCert("test-cert.pem")
 	test.AssertNotError(t, err, "Couldn't read test certificate")
-	_, err = sa.AddCertificate(parsedCert.Raw, reg.ID)
+	_, err = sa.AddCertificate(ctx, parsedCert.Raw, reg.ID)
 	test.AssertNotError(t, err, "Couldn't add test-cert.pem")
 	parsedCert, err = core.LoadCert("test-cert-b.pem")
 	test.AssertNotError(t, err, "Couldn't read test certificate")
-	_, err = sa.AddCertificate(parsedCert.Raw, reg.ID)
+	_, err = sa.AddCertificate(ctx, parsedCert.Raw, reg.ID)
 	test.AssertNotError(t, err, "Couldn't add test-cert-b.pem")
 
 	earliest := fc.Now().Add(-time.Hour)
@@ -147,7 +169,7 @@ func TestFindStaleOCSPResponses(t *testing.T) {
 	reg := satest.CreateWorkingRegistration(t, sa)
 	parsedCert, err := core.LoadCert("test-cert.pem")
 	test.AssertNotError(t, err, "Couldn't read test certificate")
-	_, err = sa.AddCertificate(parsedCert.Raw, reg.ID)
+	_, err = sa.AddCertificate(ctx, parsedCert.Raw, reg.ID)
 	test.AssertNotError(t, err, "Couldn't add www.eff.org.der")
 
 	earliest := fc.Now().Add(-time.Hour)
@@ -155,7 +177,7 @@ func TestFindStaleOCSPResponses(t *testing.T) {
 	test.AssertNotError(t, err, "Couldn't find certificate")
 	test.AssertEquals(t, len(certs), 1)
 
-	status, err := sa.GetCertificateStatus(core.SerialToString(parsedCert.SerialNumber))
+	status, err := sa.GetCertificateStatus(ctx, core.SerialToString(parsedCert.SerialNumber))
 	test.AssertNotError(t, err, "Couldn't get the core.Certificate from the database")
 
 	meta, err := updater.generateResponse(status)
@@ -175,12 +197,31 @@ func TestGetCertificatesWithMissingResponses(t *testing.T) {
 	reg := satest.CreateWorkingRegistration(t, sa)
 	cert, err := core.LoadCert("test-cert.pem")
 	test.AssertNotError(t, err, "Couldn't read test certificate")
-	_, err = sa.AddCertificate(cert.Raw, reg.ID)
+	_, err = sa.AddCertificate(ctx, cert.Raw, reg.ID)
 	test.AssertNotError(t, err, "Couldn't add www.eff.org.der")
 
 	statuses, err := updater.getCertificatesWithMissingResponses(10)
 	test.AssertNotError(t, err, "Couldn't get status")
 	test.AssertEquals(t, len(statuses), 1)
+
+	// Short-lived certificates get no responses
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Couldn't generate key")
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    updater.clk.Now(),
+		NotAfter:     updater.clk.Now().Add(core.ShortLivedValidity),
+	}
+	shortLivedDER, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	test.AssertNotError(t, err, "Couldn't create short-lived certificate")
+	_, err = sa.AddCertificate(ctx, shortLivedDER, reg.ID)
+	test.AssertNotError(t, err, "Couldn't add short-lived certificate")
+	status, err := sa.GetCertificateStatus(ctx, core.SerialToString(template.SerialNumber))
+	test.AssertNotError(t, err, "Couldn't get short-lived certificate status")
+	test.Assert(t, status.IsShortLived, "Short-lived certificate status isn't marked")
+	statuses, err = updater.getCertificatesWithMissingResponses(10)
+	test.AssertNotError(t, err, "Couldn't get status")
+	test.AssertEquals(t, len(statuses), 1)
 }
 
 func TestFindRevokedCertificatesToUpdate(t *testing.T) {
@@ -190,14 +231,14 @@ func TestFindRevokedCertificatesToUpdate(t *testing.T) {
 	reg := satest.CreateWorkingRegistration(t, sa)
 	cert, err := core.LoadCert("test-cert.pem")
 	test.AssertNotError(t, err, "Couldn't read test certificate")
-	_, err = sa.AddCertificate(cert.Raw, reg.ID)
+	_, err = sa.AddCertificate(ctx, cert.Raw, reg.ID)
 	test.AssertNotError(t, err, "Couldn't add www.eff.org.der")
 
 	statuses, err := updater.findRevokedCertificatesToUpdate(10)
 	test.AssertNotError(t, err, "Failed to find revoked certificates")
 	test.AssertEquals(t, len(statuses), 0)
 
-	err = sa.MarkCertificateRevoked(core.SerialToString(cert.SerialNumber), core.RevocationCode(1))
+	err = sa.MarkCertificateRevoked(ctx, core.SerialToString(cert.SerialNumber), core.RevocationCode(1))
 	test.AssertNotError(t, err, "Failed to revoke certificate")
 
 	statuses, err = updater.findRevokedCertificatesToUpdate(10)
@@ -212,7 +253,7 @@ func TestNewCertificateTick(t *testing.T) {
 	reg := satest.CreateWorkingRegistration(t, sa)
 	parsedCert, err := core.LoadCert("test-cert.pem")
 	test.AssertNotError(t, err, "Couldn't read test certificate")
-	_, err = sa.AddCertificate(parsedCert.Raw, reg.ID)
+	_, err = sa.AddCertificate(ctx, parsedCert.Raw, reg.ID)
 	test.AssertNotError(t, err, "Couldn't add www.eff.org.der")
 
 	prev := fc.Now().Add(-time.Hour)
@@ -230,7 +271,7 @@ func TestOldOCSPResponsesTick(t *testing.T) {
 	reg := satest.CreateWorkingRegistration(t, sa)
 	parsedCert, err := core.LoadCert("test-cert.pem")
 	test.AssertNotError(t, err, "Couldn't read test certificate")
-	_, err = sa.AddCertificate(parsedCert.Raw, reg.ID)
+	_, err = sa.AddCertificate(ctx, parsedCert.Raw, reg.ID)
 	test.AssertNotError(t, err, "Couldn't add www.eff.org.der")
 
 	updater.ocspMinTimeToExpiry = 1 * time.Hour
@@ -248,16 +289,66 @@ func TestMissingReceiptsTick(t *testing.T) {
 	reg := satest.CreateWorkingRegistration(t, sa)
 	parsedCert, err := core.LoadCert("test-cert.pem")
 	test.AssertNotError(t, err, "Couldn't read test certificate")
-	_, err = sa.AddCertificate(parsedCert.Raw, reg.ID)
+	_, err = sa.AddCertificate(ctx, parsedCert.Raw, reg.ID)
 	test.AssertNotError(t, err, "Couldn't add www.eff.org.der")
 
 	updater.numLogs = 1
 	updater.oldestIssuedSCT = 1 * time.Hour
+	updater.maxSCTAttempts = 2
+
+	// Failed submissions are retried until they've failed maxSCTAttempts
+	// times
+	pub := updater.pubc.(*mockPub)
+	pub.failing = true
+	for i := 0; i < 3; i++ {
+		updater.missingReceiptsTick(10)
+	}
+	submitted, exhausted, err := updater.getSubmissionCounts("00")
+	test.AssertNotError(t, err, "Couldn't get CT submissions")
+	test.AssertEquals(t, submitted, 0)
+	test.AssertEquals(t, exhausted, 1)
+	submissions, err := sa.GetCTSubmissions(ctx, "00")
+	test.AssertNotError(t, err, "Couldn't get CT submissions")
+	test.AssertEquals(t, submissions[0].Attempts, 2)
+
+	pub.failing = false
+	updater.maxSCTAttempts = 0
 	updater.missingReceiptsTick(10)
+	submitted, _, err = updater.getSubmissionCounts("00")
+	test.AssertNotError(t, err, "Couldn't get CT submissions")
+	test.AssertEquals(t, submitted, 1)
+}
+
+func TestCTInclusionTick(t *testing.T) {
+	updater, sa, _, _, cleanUp := setup(t)
+	defer cleanUp()
 
-	count, err := updater.getNumberOfReceipts("00")
-	test.AssertNotError(t, err, "Couldn't get number of receipts")
-	test.AssertEquals(t, count, 1)
+	reg := satest.CreateWorkingRegistration(t, sa)
+	parsedCert, err := core.LoadCert("test-cert.pem")
+	test.AssertNotError(t, err, "Couldn't read test certificate")
+	_, err = sa.AddCertificate(ctx, parsedCert.Raw, reg.ID)
+	test.AssertNotError(t, err, "Couldn't add test-cert.pem")
+	err = updater.pubc.SubmitToCT(ctx, parsedCert.Raw)
+	test.AssertNotError(t, err, "Couldn't submit test-cert.pem")
+
+	// mockPub's SCT is timestamped at the epoch, so only later cutoffs
+	// find it
+	serials, err := updater.findUnverifiedInclusions(time.Unix(0, 0), 10)
+	test.AssertNotError(t, err, "Couldn't find unverified CT inclusions")
+	test.AssertEquals(t, len(serials), 0)
+	serials, err = updater.findUnverifiedInclusions(time.Unix(1, 0), 10)
+	test.AssertNotError(t, err, "Couldn't find unverified CT inclusions")
+	test.AssertDeepEquals(t, serials, []string{"00"})
+
+	updater.ctInclusionDelay = time.Minute
+	err = updater.ctInclusionTick(10)
+	test.AssertNotError(t, err, "CT inclusion tick failed")
+	submissions, err := sa.GetCTSubmissions(ctx, "00")
+	test.AssertNotError(t, err, "Couldn't get CT submissions")
+	test.AssertEquals(t, submissions[0].InclusionStatus, core.CTInclusionVerified)
+	serials, err = updater.findUnverifiedInclusions(updater.clk.Now(), 10)
+	test.AssertNotError(t, err, "Couldn't find unverified CT inclusions")
+	test.AssertEquals(t, len(serials), 0)
 }
 
 func TestRevokedCertificatesTick(t *testing.T) {
@@ -267,10 +358,10 @@ func TestRevokedCertificatesTick(t *testing.T) {
 	reg := satest.CreateWorkingRegistration(t, sa)
 	parsedCert, err := core.LoadCert("test-cert.pem")
 	test.AssertNotError(t, err, "Couldn't read test certificate")
-	_, err = sa.AddCertificate(parsedCert.Raw, reg.ID)
+	_, err = sa.AddCertificate(ctx, parsedCert.Raw, reg.ID)
 	test.AssertNotError(t, err, "Couldn't add www.eff.org.der")
 
-	err = sa.MarkCertificateRevoked(core.SerialToString(parsedCert.SerialNumber), core.RevocationCode(1))
+	err = sa.MarkCertificateRevoked(ctx, core.SerialToString(parsedCert.SerialNumber), core.RevocationCode(1))
 	test.AssertNotError(t, err, "Failed to revoke certificate")
 
 	statuses, err := updater.findRevokedCertificatesToUpdate(10)
@@ -279,12 +370,48 @@ func TestRevokedCertificatesTick(t *testing.T) {
 
 	updater.revokedCertificatesTick(10)
 
-	status, err := sa.GetCertificateStatus(core.SerialToString(parsedCert.SerialNumber))
+	status, err := sa.GetCertificateStatus(ctx, core.SerialToString(parsedCert.SerialNumber))
 	test.AssertNotError(t, err, "Failed to get certificate status")
 	test.AssertEquals(t, status.Status, core.OCSPStatusRevoked)
 	test.Assert(t, len(status.OCSPResponse) != 0, "Certificate status doesn't contain OCSP response")
 }
 
+func TestArchiveStatusesTick(t *testing.T) {
+	updater, sa, _, fc, cleanUp := setup(t)
+	defer cleanUp()
+	updater.archiveStatusAfter = 90 * 24 * time.Hour
+
+	reg := satest.CreateWorkingRegistration(t, sa)
+	parsedCert, err := core.LoadCert("test-cert.pem")
+	test.AssertNotError(t, err, "Couldn't read test certificate")
+	_, err = sa.AddCertificate(ctx, parsedCert.Raw, reg.ID)
+	test.AssertNotError(t, err, "Couldn't add www.eff.org.der")
+	serial := core.SerialToString(parsedCert.SerialNumber)
+
+	// Certificates are kept until archiveStatusAfter past their expiry
+	fc.Set(parsedCert.NotAfter.Add(30 * 24 * time.Hour))
+	serials, err := updater.findStatusesToArchive(fc.Now().Add(-updater.archiveStatusAfter), 10)
+	test.AssertNotError(t, err, "Failed to find statuses to archive")
+	test.AssertEquals(t, len(serials), 0)
+
+	fc.Set(parsedCert.NotAfter.Add(91 * 24 * time.Hour))
+	err = updater.archiveStatusesTick(10)
+	test.AssertNotError(t, err, "Failed to archive statuses")
+
+	// The status is no longer found by the other loops, but the SA still
+	// finds it in the archive
+	statuses, err := updater.getCertificatesWithMissingResponses(10)
+	test.AssertNotError(t, err, "Couldn't get statuses")
+	test.AssertEquals(t, len(statuses), 0)
+	serials, err = updater.findStatusesToArchive(fc.Now().Add(-updater.archiveStatusAfter), 10)
+	test.AssertNotError(t, err, "Failed to find statuses to archive")
+	test.AssertEquals(t, len(serials), 0)
+	status, err := sa.GetCertificateStatus(ctx, serial)
+	test.AssertNotError(t, err, "Failed to get archived certificate status")
+	test.AssertEquals(t, status.Serial, serial)
+	test.AssertEquals(t, status.Status, core.OCSPStatusGood)
+}
+
 func TestStoreResponseGuard(t *testing.T) {
 	updater, sa, _, _, cleanUp := setup(t)
 	defer cleanUp()
@@ -292,13 +419,13 @@ func TestStoreResponseGuard(t *testing.T) {
 	reg := satest.CreateWorkingRegistration(t, sa)
 	parsedCert, err := core.LoadCert("test-cert.pem")
 	test.AssertNotError(t, err, "Couldn't read test certificate")
-	_, err = sa.AddCertificate(parsedCert.Raw, reg.ID)
+	_, err = sa.AddCertificate(ctx, parsedCert.Raw, reg.ID)
 	test.AssertNotError(t, err, "Couldn't add www.eff.org.der")
 
-	status, err := sa.GetCertificateStatus(core.SerialToString(parsedCert.SerialNumber))
+	status, err := sa.GetCertificateStatus(ctx, core.SerialToString(parsedCert.SerialNumber))
 	test.AssertNotError(t, err, "Failed to get certificate status")
 
-	err = sa.MarkCertificateRevoked(core.SerialToString(parsedCert.SerialNumber), 0)
+	err = sa.MarkCertificateRevoked(ctx, core.SerialToString(parsedCert.SerialNumber), 0)
 	test.AssertNotError(t, err, "Failed to revoked certificate")
 
 	// Attempt to update OCSP response where status.Status is good but stored status
@@ -308,7 +435,7 @@ func TestStoreResponseGuard(t *testing.T) {
 	test.AssertNotError(t, err, "Failed to update certificate status")
 
 	// Make sure the OCSP response hasn't actually changed
-	unchangedStatus, err := sa.GetCertificateStatus(core.SerialToString(parsedCert.SerialNumber))
+	unchangedStatus, err := sa.GetCertificateStatus(ctx, core.SerialToString(parsedCert.SerialNumber))
 	test.AssertNotError(t, err, "Failed to get certificate status")
 	test.AssertEquals(t, len(unchangedStatus.OCSPResponse), 0)
 
@@ -318,7 +445,7 @@ func TestStoreResponseGuard(t *testing.T) {
 	test.AssertNotError(t, err, "Failed to updated certificate status")
 
 	// Make sure the OCSP response has been updated
-	changedStatus, err := sa.GetCertificateStatus(core.SerialToString(parsedCert.SerialNumber))
+	changedStatus, err := sa.GetCertificateStatus(ctx, core.SerialToString(parsedCert.SerialNumber))
 	test.AssertNotError(t, err, "Failed to get certificate status")
 	test.AssertEquals(t, len(changedStatus.OCSPResponse), 3)
 }
@@ -363,3 +490,21 @@ func TestLoopTickBackoff(t *testing.T) {
 	test.AssertEquals(t, l.failures, 0)
 	test.AssertEquals(t, l.clk.Now(), start)
 }
+
+func TestLoopTickPanic(t *testing.T) {
+	fc := clock.NewFake()
+	stats, _ := statsd.NewNoopClient(nil)
+	l := looper{
+		clk:      fc,
+		stats:    stats,
+		tickDur:  time.Minute,
+		name:     "Panicky",
+		tickFunc: func(_ int) error { panic("bad batch") },
+	}
+
+	// The panic fails the tick instead of killing the updater
+	err := l.runTick()
+	test.AssertError(t, err, "Panicking tick didn't fail")
+	test.AssertEquals(t, err.Error(), "Tick panicked: bad batch")
+	l.tick()
+}
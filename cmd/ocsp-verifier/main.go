@@ -0,0 +1,231 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/codegangsta/cli"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/crypto/ocsp"
+	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/sa"
+)
+
+const (
+	defaultSampleSize          = 100
+	defaultThisUpdateTolerance = time.Hour
+	defaultTimeout             = 10 * time.Second
+)
+
+// sampledCert is a certificate picked for checking, along with the status the
+// SA holds for it.
+type sampledCert struct {
+	Serial          string              `db:"serial"`
+	DER             []byte              `db:"der"`
+	Status          core.OCSPStatus     `db:"status"`
+	OCSPLastUpdated time.Time           `db:"ocspLastUpdated"`
+	RevokedDate     time.Time           `db:"revokedDate"`
+	RevokedReason   core.RevocationCode `db:"revokedReason"`
+}
+
+// verifier compares the OCSP responses served to the public with the
+// certificate statuses in the SA's database, to catch responses that a CDN
+// has cached for too long or that the signing pipeline got wrong.
+type verifier struct {
+	dbMap        *gorp.DbMap
+	issuer       *x509.Certificate
+	responderURL string
+	client       *http.Client
+	clk          clock.Clock
+	stats        statsd.Statter
+	log          *blog.AuditLogger
+
+	// A response's thisUpdate may lag the SA's ocspLastUpdated by this much
+	// before the response is considered stale
+	thisUpdateTolerance time.Duration
+}
+
+// sample picks up to n unexpired certificates at random, leaving out
+// short-lived ones, which get no OCSP responses, once the schema marks them.
+func (v *verifier) sample(n int) ([]sampledCert, error) {
+	marked, err := sa.SchemaCapable(v.dbMap, sa.CapabilityCertificateStatusIsShortLived)
+	if err != nil {
+		return nil, err
+	}
+	notShortLived := ""
+	if marked {
+		notShortLived = "AND NOT cs.isShortLived"
+	}
+	var certs []sampledCert
+	_, err = v.dbMap.Select(
+		&certs,
+		`SELECT c.serial, c.der, cs.status, cs.ocspLastUpdated, cs.revokedDate, cs.revokedReason
+		 FROM certificates AS c JOIN certificateStatus AS cs ON cs.serial = c.serial
+		 WHERE c.expires > :now
+		 `+notShortLived+`
+		 ORDER BY RAND() LIMIT :limit`,
+		map[string]interface{}{"now": v.clk.Now(), "limit": n},
+	)
+	return certs, err
+}
+
+// fetch asks the responder for the status of cert with a GET request, so that
+// the response comes through any cache in front of the responder.
+func (v *verifier) fetch(cert *x509.Certificate) ([]byte, error) {
+	req, err := ocsp.CreateRequest(cert, v.issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+	reqURL := strings.TrimSuffix(v.responderURL, "/") + "/" + url.QueryEscape(base64.StdEncoding.EncodeToString(req))
+	resp, err := v.client.Get(reqURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Responder returned HTTP status %d", resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// check fetches the response for sc and returns any ways in which it
+// diverges from what the SA holds.
+func (v *verifier) check(sc sampledCert) (problems []string) {
+	cert, err := x509.ParseCertificate(sc.DER)
+	if err != nil {
+		return []string{fmt.Sprintf("Couldn't parse stored certificate: %s", err)}
+	}
+	body, err := v.fetch(cert)
+	if err != nil {
+		return []string{fmt.Sprintf("Couldn't fetch OCSP response: %s", err)}
+	}
+	// ParseResponse checks the response signature against the issuer
+	resp, err := ocsp.ParseResponse(body, v.issuer)
+	if err != nil {
+		return []string{fmt.Sprintf("Invalid OCSP response: %s", err)}
+	}
+
+	if resp.SerialNumber == nil || resp.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+		problems = append(problems, "Response is for another serial")
+	}
+	switch {
+	case sc.Status == core.OCSPStatusGood && resp.Status != ocsp.Good:
+		problems = append(problems, fmt.Sprintf("Response status is %d, SA status is good", resp.Status))
+	case sc.Status == core.OCSPStatusRevoked && resp.Status != ocsp.Revoked:
+		problems = append(problems, fmt.Sprintf("Response status is %d, SA status is revoked", resp.Status))
+	case sc.Status == core.OCSPStatusRevoked && resp.RevocationReason != int(sc.RevokedReason):
+		problems = append(problems, fmt.Sprintf("Response revocation reason is %d, SA reason is %d", resp.RevocationReason, sc.RevokedReason))
+	}
+	if resp.ThisUpdate.Before(sc.OCSPLastUpdated.Add(-v.thisUpdateTolerance)) {
+		problems = append(problems, fmt.Sprintf("Response thisUpdate %s is older than SA ocspLastUpdated %s", resp.ThisUpdate, sc.OCSPLastUpdated))
+	}
+	if !resp.NextUpdate.IsZero() && resp.NextUpdate.Before(v.clk.Now()) {
+		problems = append(problems, fmt.Sprintf("Response expired at %s", resp.NextUpdate))
+	}
+	return problems
+}
+
+// verify checks a sample of n certificates and returns how many diverged.
+func (v *verifier) verify(n int) (int, error) {
+	certs, err := v.sample(n)
+	if err != nil {
+		return 0, err
+	}
+	bad := 0
+	for _, sc := range certs {
+		problems := v.check(sc)
+		if len(problems) == 0 {
+			v.stats.Inc("OCSPVerifier.Good", 1, 1.0)
+			continue
+		}
+		bad++
+		v.stats.Inc("OCSPVerifier.Divergent", 1, 1.0)
+		v.log.Err(fmt.Sprintf("OCSP response for %s diverges from SA: %s", sc.Serial, strings.Join(problems, "; ")))
+	}
+	v.log.Info(fmt.Sprintf("Checked OCSP responses, sample: %d, divergent: %d", len(certs), bad))
+	return bad, nil
+}
+
+func main() {
+	app := cmd.NewAppShell("ocsp-verifier", "Compares a sample of served OCSP responses against the SA's certificate statuses")
+	app.App.Flags = append(app.App.Flags, cli.IntFlag{
+		Name:  "sample-size",
+		Usage: "The number of certificates to check",
+	}, cli.StringFlag{
+		Name:  "responder-url",
+		Usage: "The OCSP responder URL if not provided in the configuration file",
+	})
+
+	app.Config = func(c *cli.Context, config cmd.Config) cmd.Config {
+		if n := c.GlobalInt("sample-size"); n != 0 {
+			config.OCSPVerifier.SampleSize = n
+		}
+		if u := c.GlobalString("responder-url"); u != "" {
+			config.OCSPVerifier.ResponderURL = u
+		}
+		return config
+	}
+
+	app.Action = func(c cmd.Config, stats statsd.Statter, auditlogger *blog.AuditLogger) {
+		dbURL, err := c.OCSPVerifier.DBConfig.URL()
+		cmd.FailOnError(err, "Couldn't load DB URL")
+		dbMap, err := sa.NewDbMap(dbURL)
+		cmd.FailOnError(err, "Could not connect to database")
+
+		issuer, err := core.LoadCert(c.Common.IssuerCert)
+		cmd.FailOnError(err, "Couldn't load issuer certificate")
+
+		if c.OCSPVerifier.ResponderURL == "" {
+			cmd.FailOnError(fmt.Errorf("No responder URL"), "OCSPVerifier.ResponderURL must be set")
+		}
+
+		sampleSize := c.OCSPVerifier.SampleSize
+		if sampleSize == 0 {
+			sampleSize = defaultSampleSize
+		}
+		tolerance := c.OCSPVerifier.ThisUpdateTolerance.Duration
+		if tolerance == 0 {
+			tolerance = defaultThisUpdateTolerance
+		}
+		timeout := c.OCSPVerifier.Timeout.Duration
+		if timeout == 0 {
+			timeout = defaultTimeout
+		}
+
+		v := &verifier{
+			dbMap:               dbMap,
+			issuer:              issuer,
+			responderURL:        c.OCSPVerifier.ResponderURL,
+			client:              &http.Client{Timeout: timeout},
+			clk:                 clock.Default(),
+			stats:               stats,
+			log:                 auditlogger,
+			thisUpdateTolerance: tolerance,
+		}
+		bad, err := v.verify(sampleSize)
+		cmd.FailOnError(err, "Couldn't sample certificates")
+		if bad > 0 {
+			// Exit non-zero so that whatever runs the verifier raises an alert
+			os.Exit(1)
+		}
+	}
+
+	app.Run()
+}
@@ -0,0 +1,131 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/test"
+)
+
+var log = mocks.UseMockLog()
+
+func makeCert(t *testing.T, serial int64, isCA bool, parent *x509.Certificate, signer *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "ocsp-verifier test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		parent, signer = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	test.AssertNotError(t, err, "Failed to create certificate")
+	cert, err := x509.ParseCertificate(der)
+	test.AssertNotError(t, err, "Failed to parse certificate")
+	return cert, key
+}
+
+func TestCheck(t *testing.T) {
+	issuer, issuerKey := makeCert(t, 1, true, nil, nil)
+	_, otherKey := makeCert(t, 2, true, nil, nil)
+	cert, _ := makeCert(t, 3, false, issuer, issuerKey)
+
+	fc := clock.NewFake()
+	fc.Add(time.Since(fc.Now()))
+	now := fc.Now()
+
+	// The responder serves whatever template and key the test last set
+	var template ocsp.Response
+	signingKey := issuerKey
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, err := ocsp.CreateResponse(issuer, issuer, template, signingKey)
+		test.AssertNotError(t, err, "Failed to create OCSP response")
+		w.Write(resp)
+	}))
+	defer server.Close()
+
+	stats, _ := statsd.NewNoopClient(nil)
+	v := &verifier{
+		issuer:              issuer,
+		responderURL:        server.URL + "/",
+		client:              http.DefaultClient,
+		clk:                 fc,
+		stats:               stats,
+		log:                 blog.GetAuditLogger(),
+		thisUpdateTolerance: time.Hour,
+	}
+	sc := sampledCert{
+		Serial:          core.SerialToString(cert.SerialNumber),
+		DER:             cert.Raw,
+		Status:          core.OCSPStatusGood,
+		OCSPLastUpdated: now,
+	}
+
+	template = ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: cert.SerialNumber,
+		ThisUpdate:   now.Add(-time.Minute),
+		NextUpdate:   now.Add(time.Hour),
+	}
+	test.AssertEquals(t, len(v.check(sc)), 0)
+
+	// The SA has revoked the certificate but the response says good
+	revoked := sc
+	revoked.Status = core.OCSPStatusRevoked
+	problems := v.check(revoked)
+	test.AssertEquals(t, len(problems), 1)
+	test.AssertContains(t, problems[0], "SA status is revoked")
+
+	// A cached response from before the SA's last update
+	template.ThisUpdate = now.Add(-3 * time.Hour)
+	problems = v.check(sc)
+	test.AssertEquals(t, len(problems), 1)
+	test.AssertContains(t, problems[0], "older than SA ocspLastUpdated")
+
+	// An expired response
+	template.ThisUpdate = now.Add(-time.Minute)
+	template.NextUpdate = now.Add(-time.Second)
+	problems = v.check(sc)
+	test.AssertEquals(t, len(problems), 1)
+	test.AssertContains(t, problems[0], "Response expired")
+
+	// A response for another certificate
+	template.NextUpdate = now.Add(time.Hour)
+	template.SerialNumber = big.NewInt(4)
+	problems = v.check(sc)
+	test.AssertEquals(t, len(problems), 1)
+	test.AssertEquals(t, problems[0], "Response is for another serial")
+
+	// A response not signed by the issuer
+	template.SerialNumber = cert.SerialNumber
+	signingKey = otherKey
+	problems = v.check(sc)
+	test.AssertEquals(t, len(problems), 1)
+	test.Assert(t, strings.HasPrefix(problems[0], "Invalid OCSP response"), problems[0])
+}
@@ -1,12 +1,33 @@
 package cmd
 
 import (
-	"github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/yaml.v2"
+	"fmt"
 	"io/ioutil"
+	"math"
+	"sort"
 	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/yaml.v2"
+
+	"github.com/letsencrypt/boulder/core"
 )
 
-// RateLimitConfig contains all application layer rate limiting policies
+// Unlimited, as an override, exempts whatever it overrides the limit for.
+const Unlimited = -1
+
+// RateLimitConfig contains all application layer rate limiting policies. It
+// is loaded by the RA and, for pollsPerAccount, the WFE, from a single YAML
+// file, so that every limit is configured in one place.
+//
+// Each limit has a default threshold, which can be overridden per key (e.g.
+// per base domain), per registration, and per registration for a key, with
+// the most specific override taking priority. So "unlimited for account 101
+// on example.com" is:
+//
+//	certificatesPerName:
+//	  registrationKeyOverrides:
+//	    101:
+//	      example.com: -1
 type RateLimitConfig struct {
 	// Total number of certificates that can be extant at any given time.
 	// The 2160h window, 90 days, is chosen to match certificate lifetime, since the
@@ -17,6 +38,12 @@ type RateLimitConfig struct {
 	// These are counted by "base domain" aka eTLD+1, so any entries in the
 	// overrides section must be an eTLD+1 according to the publicsuffix package.
 	CertificatesPerName RateLimitPolicy `yaml:"certificatesPerName"`
+	// Number of certificates that can be issued for exactly the same set of
+	// names. A request for a set of names that has been issued for before is
+	// a renewal: it's exempt from certificatesPerName, and counted against
+	// this instead. Keys of the overrides are the set's names, lowercased,
+	// sorted and joined with commas.
+	CertificatesPerFQDNSet RateLimitPolicy `yaml:"certificatesPerFQDNSet"`
 	// Number of registrations that can be created per IP.
 	// Note: Since this is checked before a registration is created, setting a
 	// RegistrationOverride on it has no effect.
@@ -24,6 +51,74 @@ type RateLimitConfig struct {
 	// Number of pending authorizations that can exist per account. Overrides by
 	// key are not applied, but overrides by registration are.
 	PendingAuthorizationsPerAccount RateLimitPolicy `yaml:"pendingAuthorizationsPerAccount"`
+	// Number of times an account may poll its authorizations and challenges,
+	// counted by each WFE. Overrides by key are not applied, but overrides by
+	// registration are.
+	PollsPerAccount RateLimitPolicy `yaml:"pollsPerAccount"`
+}
+
+// Policies returns the config's policies by the names used for them in YAML.
+func (rlc *RateLimitConfig) Policies() map[string]*RateLimitPolicy {
+	return map[string]*RateLimitPolicy{
+		"totalCertificates":               &rlc.TotalCertificates,
+		"certificatesPerName":             &rlc.CertificatesPerName,
+		"certificatesPerFQDNSet":          &rlc.CertificatesPerFQDNSet,
+		"registrationsPerIP":              &rlc.RegistrationsPerIP,
+		"pendingAuthorizationsPerAccount": &rlc.PendingAuthorizationsPerAccount,
+		"pollsPerAccount":                 &rlc.PollsPerAccount,
+	}
+}
+
+// Validate returns an error for the first policy, in name order, with a
+// setting that can't be enforced.
+func (rlc *RateLimitConfig) Validate() error {
+	policies := rlc.Policies()
+	var names []string
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := policies[name].validate(); err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// WithOverrides returns the config with overrides, managed with
+// admin-revoker rather than configured, in place of the configured
+// overrides for the same keys and registrations. Overrides of unknown
+// limits are ignored.
+func (rlc RateLimitConfig) WithOverrides(overrides []core.RateLimitOverride) RateLimitConfig {
+	policies := rlc.Policies()
+	copied := make(map[string]bool)
+	for _, o := range overrides {
+		policy, ok := policies[o.Limit]
+		if !ok {
+			continue
+		}
+		if !copied[o.Limit] {
+			policy.copyOverrides()
+			copied[o.Limit] = true
+		}
+		threshold := o.Threshold
+		if o.Multiplier != 0 {
+			threshold = int(math.Ceil(float64(policy.Threshold) * o.Multiplier))
+		}
+		switch {
+		case o.RegistrationID != 0 && o.Key != "":
+			if policy.RegistrationKeyOverrides[o.RegistrationID] == nil {
+				policy.RegistrationKeyOverrides[o.RegistrationID] = make(map[string]int)
+			}
+			policy.RegistrationKeyOverrides[o.RegistrationID][o.Key] = threshold
+		case o.RegistrationID != 0:
+			policy.RegistrationOverrides[o.RegistrationID] = threshold
+		case o.Key != "":
+			policy.Overrides[o.Key] = threshold
+		}
+	}
+	return rlc
 }
 
 // RateLimitPolicy describes a general limiting policy
@@ -39,13 +134,71 @@ type RateLimitPolicy struct {
 	// a key, while a rate limit on the number of registrations per IP subnet would
 	// use subnet as a key.
 	// Note that a zero entry in the overrides map does not mean "not limit," it
-	// means a limit of zero.
+	// means a limit of zero. Unlimited means no limit, in any of the overrides.
 	Overrides map[string]int `yaml:"overrides"`
 	// A per-registration override setting. This can be used, e.g. if there are
 	// hosting providers that we would like to grant a higher rate of issuance
 	// than the default. If both key-based and registration-based overrides are
 	// available, the registration-based on takes priority.
 	RegistrationOverrides map[int64]int `yaml:"registrationOverrides"`
+	// A per-registration override for particular keys, e.g. for a hosting
+	// provider only on the domains it hosts. It takes priority over the other
+	// overrides.
+	RegistrationKeyOverrides map[int64]map[string]int `yaml:"registrationKeyOverrides"`
+}
+
+func (rlp *RateLimitPolicy) validate() error {
+	if rlp.Window.Duration < 0 {
+		return fmt.Errorf("window %s is negative", rlp.Window.Duration)
+	}
+	if rlp.Threshold < 0 {
+		return fmt.Errorf("threshold %d is negative; use 0 for no limit", rlp.Threshold)
+	}
+	check := func(scope string, override int) error {
+		if override < Unlimited {
+			return fmt.Errorf("override for %s is %d; use %d for unlimited", scope, override, Unlimited)
+		}
+		return nil
+	}
+	for key, override := range rlp.Overrides {
+		if err := check(fmt.Sprintf("%q", key), override); err != nil {
+			return err
+		}
+	}
+	for regID, override := range rlp.RegistrationOverrides {
+		if err := check(fmt.Sprintf("registration %d", regID), override); err != nil {
+			return err
+		}
+	}
+	for regID, overrides := range rlp.RegistrationKeyOverrides {
+		for key, override := range overrides {
+			if err := check(fmt.Sprintf("registration %d on %q", regID, key), override); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// copyOverrides replaces the override maps of rlp, which may be shared with
+// other copies of it, with copies of their own.
+func (rlp *RateLimitPolicy) copyOverrides() {
+	overrides := make(map[string]int, len(rlp.Overrides))
+	for key, threshold := range rlp.Overrides {
+		overrides[key] = threshold
+	}
+	regOverrides := make(map[int64]int, len(rlp.RegistrationOverrides))
+	for regID, threshold := range rlp.RegistrationOverrides {
+		regOverrides[regID] = threshold
+	}
+	regKeyOverrides := make(map[int64]map[string]int, len(rlp.RegistrationKeyOverrides))
+	for regID, keys := range rlp.RegistrationKeyOverrides {
+		regKeyOverrides[regID] = make(map[string]int, len(keys))
+		for key, threshold := range keys {
+			regKeyOverrides[regID][key] = threshold
+		}
+	}
+	rlp.Overrides, rlp.RegistrationOverrides, rlp.RegistrationKeyOverrides = overrides, regOverrides, regKeyOverrides
 }
 
 // Enabled returns true iff the RateLimitPolicy is enabled.
@@ -54,8 +207,11 @@ func (rlp *RateLimitPolicy) Enabled() bool {
 }
 
 // GetThreshold returns the threshold for this rate limit, taking into account
-// any overrides for `key`.
+// any overrides for `key`. It returns Unlimited if key or regID is exempt.
 func (rlp *RateLimitPolicy) GetThreshold(key string, regID int64) int {
+	if override, ok := rlp.RegistrationKeyOverrides[regID][key]; ok {
+		return override
+	}
 	if override, ok := rlp.RegistrationOverrides[regID]; ok {
 		return override
 	}
@@ -83,5 +239,8 @@ func LoadRateLimitPolicies(filename string) (RateLimitConfig, error) {
 	if err != nil {
 		return RateLimitConfig{}, err
 	}
+	if err = rlc.Validate(); err != nil {
+		return RateLimitConfig{}, err
+	}
 	return rlc, nil
 }
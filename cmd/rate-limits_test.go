@@ -3,6 +3,8 @@ package cmd
 import (
 	"testing"
 	"time"
+
+	"github.com/letsencrypt/boulder/core"
 )
 
 func TestEnabled(t *testing.T) {
@@ -58,3 +60,84 @@ func TestWindowBegin(t *testing.T) {
 		t.Errorf("Incorrect WindowBegin: %s, expected %s", actual, expected)
 	}
 }
+
+func TestRegistrationKeyOverrides(t *testing.T) {
+	policy := RateLimitPolicy{
+		Threshold: 1,
+		Overrides: map[string]int{
+			"example.com": 2,
+		},
+		RegistrationOverrides: map[int64]int{
+			101: 3,
+		},
+		RegistrationKeyOverrides: map[int64]map[string]int{
+			101: {"example.com": Unlimited},
+		},
+	}
+	if policy.GetThreshold("example.com", 101) != Unlimited {
+		t.Errorf("threshold should have been unlimited")
+	}
+	if policy.GetThreshold("example.net", 101) != 3 {
+		t.Errorf("threshold should have been 3")
+	}
+	if policy.GetThreshold("example.com", 11) != 2 {
+		t.Errorf("threshold should have been 2")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var config RateLimitConfig
+	config.CertificatesPerName = RateLimitPolicy{
+		Threshold:                2,
+		RegistrationKeyOverrides: map[int64]map[string]int{101: {"example.com": Unlimited}},
+	}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Valid config rejected: %s", err)
+	}
+
+	config.PollsPerAccount.Threshold = -1
+	if err := config.Validate(); err == nil {
+		t.Errorf("Negative threshold accepted")
+	}
+	config.PollsPerAccount.Threshold = 0
+
+	config.CertificatesPerName.RegistrationKeyOverrides[101]["example.com"] = -2
+	if err := config.Validate(); err == nil {
+		t.Errorf("Override below Unlimited accepted")
+	}
+}
+
+func TestWithOverrides(t *testing.T) {
+	var config RateLimitConfig
+	config.CertificatesPerName = RateLimitPolicy{
+		Threshold: 4,
+		Overrides: map[string]int{"example.com": 10},
+	}
+	overridden := config.WithOverrides([]core.RateLimitOverride{
+		{Limit: "certificatesPerName", Key: "example.com", Threshold: 20},
+		{Limit: "certificatesPerName", RegistrationID: 101, Multiplier: 2.5},
+		{Limit: "certificatesPerName", Key: "example.net", RegistrationID: 102, Threshold: Unlimited},
+		{Limit: "noSuchLimit", Key: "example.com", Threshold: 1},
+	})
+	policy := overridden.CertificatesPerName
+	if threshold := policy.GetThreshold("example.com", 1); threshold != 20 {
+		t.Errorf("Override replacing a configured one gave threshold %d, expected 20", threshold)
+	}
+	if threshold := policy.GetThreshold("example.org", 101); threshold != 10 {
+		t.Errorf("Multiplier gave threshold %d, expected 10", threshold)
+	}
+	if threshold := policy.GetThreshold("example.net", 102); threshold != Unlimited {
+		t.Errorf("Registration override on a key gave threshold %d, expected unlimited", threshold)
+	}
+	if threshold := policy.GetThreshold("example.org", 1); threshold != 4 {
+		t.Errorf("Default threshold changed to %d", threshold)
+	}
+
+	// The configured policies are left as they were
+	if threshold := config.CertificatesPerName.GetThreshold("example.com", 1); threshold != 10 {
+		t.Errorf("Configured override changed to %d", threshold)
+	}
+	if len(config.CertificatesPerName.RegistrationOverrides) != 0 {
+		t.Errorf("Configured registration overrides changed")
+	}
+}
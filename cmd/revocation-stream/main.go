@@ -0,0 +1,312 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/facebookgo/httpdown"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/sa"
+)
+
+const (
+	defaultBatchSize    = 1000
+	defaultPollInterval = 5 * time.Second
+
+	eventsPath = "/events"
+	keyPath    = "/key"
+)
+
+// revocation is a revoked certificate, as stored in certificateStatus.
+type revocation struct {
+	Serial        string              `db:"serial"`
+	RevokedDate   time.Time           `db:"revokedDate"`
+	RevokedReason core.RevocationCode `db:"revokedReason"`
+}
+
+// cursor is the position of a revocation in the stream. Revocations are
+// streamed in (revokedDate, serial) order, so a cursor names the last one a
+// consumer has seen.
+type cursor struct {
+	revoked time.Time
+	serial  string
+}
+
+func (c cursor) String() string {
+	if c.serial == "" {
+		return ""
+	}
+	return fmt.Sprintf("%d.%s", c.revoked.Unix(), c.serial)
+}
+
+// parseCursor parses a cursor sent back by a consumer. The empty string is
+// the start of the stream.
+func parseCursor(s string) (cursor, error) {
+	if s == "" {
+		return cursor{}, nil
+	}
+	parts := strings.SplitN(s, ".", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return cursor{}, fmt.Errorf("Malformed cursor %q", s)
+	}
+	secs, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return cursor{}, fmt.Errorf("Malformed cursor %q", s)
+	}
+	return cursor{revoked: time.Unix(secs, 0).UTC(), serial: parts[1]}, nil
+}
+
+// revocationSource lists revocations after a cursor.
+type revocationSource interface {
+	revokedAfter(after cursor, limit int) ([]revocation, error)
+}
+
+type dbSource struct {
+	dbMap *gorp.DbMap
+}
+
+func (s dbSource) revokedAfter(after cursor, limit int) ([]revocation, error) {
+	var revs []revocation
+	_, err := s.dbMap.Select(
+		&revs,
+		`SELECT serial, revokedDate, revokedReason FROM certificateStatus
+		 WHERE status = :status
+		 AND (revokedDate > :revoked OR (revokedDate = :revoked AND serial > :serial))
+		 ORDER BY revokedDate, serial
+		 LIMIT :limit`,
+		map[string]interface{}{
+			"status":  string(core.OCSPStatusRevoked),
+			"revoked": after.revoked,
+			"serial":  after.serial,
+			"limit":   limit,
+		},
+	)
+	return revs, err
+}
+
+// revocationEvent is the payload of each event in the stream.
+type revocationEvent struct {
+	Serial string `json:"serial"`
+	// Issuer identifies the issuing CA by the unpadded base64url SHA-256
+	// digest of its SubjectPublicKeyInfo
+	Issuer    string              `json:"issuer"`
+	Reason    core.RevocationCode `json:"reason"`
+	RevokedAt time.Time           `json:"revokedAt"`
+}
+
+// streamer publishes revocations as server-sent events. Each event's data is
+// a compact JWS over a revocationEvent, signed with a key published at
+// keyPath, and each event's ID is the cursor a consumer that falls behind
+// sends back, in Last-Event-ID or the cursor parameter, to resume from it.
+type streamer struct {
+	source       revocationSource
+	issuerID     string
+	signer       jose.Signer
+	publicKey    []byte
+	stats        statsd.Statter
+	log          *blog.AuditLogger
+	batchSize    int
+	pollInterval time.Duration
+}
+
+func newStreamer(source revocationSource, issuer *x509.Certificate, key crypto.Signer, stats statsd.Statter, log *blog.AuditLogger) (*streamer, error) {
+	alg, err := core.SigningAlgorithm(key)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: alg, Key: key}, &jose.SignerOptions{EmbedJWK: true})
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := json.Marshal(&jose.JSONWebKey{Key: key.Public(), Algorithm: string(alg)})
+	if err != nil {
+		return nil, err
+	}
+	return &streamer{
+		source:       source,
+		issuerID:     core.Fingerprint256(issuer.RawSubjectPublicKeyInfo),
+		signer:       signer,
+		publicKey:    publicKey,
+		stats:        stats,
+		log:          log,
+		batchSize:    defaultBatchSize,
+		pollInterval: defaultPollInterval,
+	}, nil
+}
+
+// event signs rev and formats it as a server-sent event.
+func (s *streamer) event(rev revocation) (string, error) {
+	payload, err := json.Marshal(revocationEvent{
+		Serial:    rev.Serial,
+		Issuer:    s.issuerID,
+		Reason:    rev.RevokedReason,
+		RevokedAt: rev.RevokedDate.UTC(),
+	})
+	if err != nil {
+		return "", err
+	}
+	jws, err := s.signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+	data, err := jws.CompactSerialize()
+	if err != nil {
+		return "", err
+	}
+	id := cursor{revoked: rev.RevokedDate, serial: rev.Serial}
+	return fmt.Sprintf("id: %s\nevent: revocation\ndata: %s\n\n", id, data), nil
+}
+
+// Key serves the public key that event signatures verify with, as a JWK.
+func (s *streamer) Key(response http.ResponseWriter, request *http.Request) {
+	response.Header().Set("Content-Type", "application/jwk+json")
+	response.Write(s.publicKey)
+}
+
+// Events streams revocations from the requested cursor on, first replaying
+// any the consumer has missed and then polling for new ones until the
+// consumer goes away.
+func (s *streamer) Events(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		http.Error(response, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := response.(http.Flusher)
+	if !ok {
+		http.Error(response, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	start := request.Header.Get("Last-Event-ID")
+	if start == "" {
+		start = request.URL.Query().Get("cursor")
+	}
+	pos, err := parseCursor(start)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response.Header().Set("Content-Type", "text/event-stream")
+	response.Header().Set("Cache-Control", "no-cache")
+	response.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	s.stats.Inc("RevocationStream.Consumers", 1, 1.0)
+
+	ctx := request.Context()
+	for {
+		revs, err := s.source.revokedAfter(pos, s.batchSize)
+		if err != nil {
+			s.stats.Inc("RevocationStream.Errors.Source", 1, 1.0)
+			s.log.Err(fmt.Sprintf("Failed to list revocations after %q: %s", pos, err))
+			// The consumer resumes from its last event ID
+			return
+		}
+		for _, rev := range revs {
+			ev, err := s.event(rev)
+			if err != nil {
+				s.stats.Inc("RevocationStream.Errors.Sign", 1, 1.0)
+				s.log.Err(fmt.Sprintf("Failed to sign revocation event for %s: %s", rev.Serial, err))
+				return
+			}
+			if _, err = fmt.Fprint(response, ev); err != nil {
+				return
+			}
+			pos = cursor{revoked: rev.RevokedDate, serial: rev.Serial}
+		}
+		if len(revs) > 0 {
+			flusher.Flush()
+			s.stats.Inc("RevocationStream.Events", int64(len(revs)), 1.0)
+		}
+		if len(revs) == s.batchSize {
+			// Still replaying; carry on without waiting
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.pollInterval):
+		}
+		// A comment line, which consumers ignore, so that dropped
+		// connections are noticed while the stream is quiet
+		if _, err = fmt.Fprint(response, ": keepalive\n\n"); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func main() {
+	app := cmd.NewAppShell("revocation-stream", "Streams signed revocation events to relying parties")
+
+	app.Action = func(c cmd.Config, stats statsd.Statter, auditlogger *blog.AuditLogger) {
+		go cmd.DebugServer(c.RevocationStream.DebugAddr)
+		go cmd.ProfileCmd("RevocationStream", stats)
+
+		dbURL, err := c.RevocationStream.DBConfig.URL()
+		cmd.FailOnError(err, "Couldn't load DB URL")
+		dbMap, err := sa.NewDbMap(dbURL)
+		cmd.FailOnError(err, "Could not connect to database")
+
+		issuer, err := core.LoadCert(c.Common.IssuerCert)
+		cmd.FailOnError(err, "Couldn't load issuer certificate")
+
+		keyPEM, err := ioutil.ReadFile(c.RevocationStream.SigningKeyFile)
+		cmd.FailOnError(err, "Couldn't read signing key")
+		priv, err := core.LoadPrivateKey(keyPEM)
+		cmd.FailOnError(err, "Couldn't parse signing key")
+		key, ok := priv.(crypto.Signer)
+		if !ok {
+			cmd.FailOnError(fmt.Errorf("%T is not a signing key", priv), "Couldn't parse signing key")
+		}
+
+		s, err := newStreamer(dbSource{dbMap}, issuer, key, stats, auditlogger)
+		cmd.FailOnError(err, "Couldn't set up revocation stream")
+		if c.RevocationStream.BatchSize > 0 {
+			s.batchSize = c.RevocationStream.BatchSize
+		}
+		if c.RevocationStream.PollInterval.Duration > 0 {
+			s.pollInterval = c.RevocationStream.PollInterval.Duration
+		}
+
+		m := http.NewServeMux()
+		m.HandleFunc(eventsPath, s.Events)
+		m.HandleFunc(keyPath, s.Key)
+
+		httpMonitor := metrics.NewHTTPMonitor(stats, m, "RevocationStream")
+		srv := &http.Server{
+			Addr:    c.RevocationStream.ListenAddress,
+			Handler: httpMonitor.Handle(),
+		}
+
+		hd := &httpdown.HTTP{
+			StopTimeout: c.RevocationStream.ShutdownStopTimeout.Duration,
+			KillTimeout: c.RevocationStream.ShutdownKillTimeout.Duration,
+			Stats:       metrics.NewFBAdapter(stats, "RevocationStream", clock.Default()),
+		}
+		auditlogger.Info(fmt.Sprintf("Server running, listening on %s...", c.RevocationStream.ListenAddress))
+		err = httpdown.ListenAndServe(srv, hd)
+		cmd.FailOnError(err, "Error starting HTTP server")
+	}
+
+	app.Run()
+}
@@ -0,0 +1,173 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
+
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/test"
+)
+
+var log = mocks.UseMockLog()
+
+// memorySource holds revocations in stream order.
+type memorySource []revocation
+
+func (m memorySource) revokedAfter(after cursor, limit int) ([]revocation, error) {
+	var revs []revocation
+	for _, rev := range m {
+		if rev.RevokedDate.Before(after.revoked) ||
+			(rev.RevokedDate.Equal(after.revoked) && rev.Serial <= after.serial) {
+			continue
+		}
+		if len(revs) == limit {
+			break
+		}
+		revs = append(revs, rev)
+	}
+	return revs, nil
+}
+
+func TestCursor(t *testing.T) {
+	c := cursor{revoked: time.Unix(1447000000, 0).UTC(), serial: "00ff"}
+	test.AssertEquals(t, c.String(), "1447000000.00ff")
+	parsed, err := parseCursor(c.String())
+	test.AssertNotError(t, err, "Failed to parse cursor")
+	test.AssertEquals(t, parsed, c)
+
+	parsed, err = parseCursor("")
+	test.AssertNotError(t, err, "Failed to parse empty cursor")
+	test.AssertEquals(t, parsed, cursor{})
+
+	for _, bad := range []string{"00ff", "abc.00ff", "1447000000."} {
+		_, err = parseCursor(bad)
+		test.AssertError(t, err, "Parsed malformed cursor "+bad)
+	}
+}
+
+func setupStreamer(t *testing.T, source revocationSource) (*streamer, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "revocation-stream test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	test.AssertNotError(t, err, "Failed to create certificate")
+	issuer, err := x509.ParseCertificate(der)
+	test.AssertNotError(t, err, "Failed to parse certificate")
+
+	stats, _ := statsd.NewNoopClient(nil)
+	s, err := newStreamer(source, issuer, key, stats, blog.GetAuditLogger())
+	test.AssertNotError(t, err, "Failed to create streamer")
+	s.batchSize = 2
+	s.pollInterval = 10 * time.Millisecond
+	return s, key
+}
+
+// readEvents reads n events from the stream, returning each one's ID and
+// data.
+func readEvents(t *testing.T, r *bufio.Reader, n int) (ids, data []string) {
+	for len(data) < n {
+		line, err := r.ReadString('\n')
+		test.AssertNotError(t, err, "Failed to read stream")
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			ids = append(ids, strings.TrimPrefix(line, "id: "))
+		case strings.HasPrefix(line, "data: "):
+			data = append(data, strings.TrimPrefix(line, "data: "))
+		}
+	}
+	return ids, data
+}
+
+func TestEvents(t *testing.T) {
+	base := time.Unix(1447000000, 0).UTC()
+	source := memorySource{
+		{Serial: "01", RevokedDate: base, RevokedReason: core.RevocationCode(1)},
+		{Serial: "02", RevokedDate: base, RevokedReason: core.RevocationCode(0)},
+		{Serial: "03", RevokedDate: base.Add(time.Second), RevokedReason: core.RevocationCode(4)},
+	}
+	s, key := setupStreamer(t, source)
+
+	m := http.NewServeMux()
+	m.HandleFunc(eventsPath, s.Events)
+	m.HandleFunc(keyPath, s.Key)
+	server := httptest.NewServer(m)
+	defer server.Close()
+
+	// Consumers verify events with the published key
+	resp, err := http.Get(server.URL + keyPath)
+	test.AssertNotError(t, err, "Failed to fetch key")
+	keyJSON, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	test.AssertNotError(t, err, "Failed to read key")
+	var jwk jose.JSONWebKey
+	test.AssertNotError(t, json.Unmarshal(keyJSON, &jwk), "Failed to parse key")
+	test.Assert(t, core.KeyDigestEquals(jwk, &key.PublicKey), "Published key isn't the signing key")
+
+	// Replay from just after the first revocation, across more than one batch
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequest("GET", server.URL+eventsPath, nil)
+	req.Header.Set("Last-Event-ID", cursor{revoked: base, serial: "01"}.String())
+	resp, err = http.DefaultClient.Do(req.WithContext(ctx))
+	test.AssertNotError(t, err, "Failed to open stream")
+	defer resp.Body.Close()
+	test.AssertEquals(t, resp.StatusCode, http.StatusOK)
+	test.AssertEquals(t, resp.Header.Get("Content-Type"), "text/event-stream")
+
+	ids, data := readEvents(t, bufio.NewReader(resp.Body), 2)
+	test.AssertEquals(t, ids[0], "1447000000.02")
+	test.AssertEquals(t, ids[1], "1447000001.03")
+
+	jws, err := jose.ParseSigned(data[1])
+	test.AssertNotError(t, err, "Failed to parse event")
+	payload, err := jws.Verify(&jwk)
+	test.AssertNotError(t, err, "Event signature didn't verify")
+	var ev revocationEvent
+	test.AssertNotError(t, json.Unmarshal(payload, &ev), "Failed to parse event payload")
+	test.AssertEquals(t, ev.Serial, "03")
+	test.AssertEquals(t, ev.Issuer, s.issuerID)
+	test.AssertEquals(t, ev.Reason, core.RevocationCode(4))
+	test.Assert(t, ev.RevokedAt.Equal(base.Add(time.Second)), "Wrong revocation time")
+}
+
+func TestEventsBadCursor(t *testing.T) {
+	s, _ := setupStreamer(t, memorySource{})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", eventsPath+"?cursor=nonsense", nil)
+	s.Events(w, req)
+	test.AssertEquals(t, w.Code, http.StatusBadRequest)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", eventsPath, nil)
+	s.Events(w, req)
+	test.AssertEquals(t, w.Code, http.StatusMethodNotAllowed)
+}
@@ -41,9 +41,13 @@ import (
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
 	cfsslLog "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/log"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/codegangsta/cli"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
 
+	"github.com/letsencrypt/boulder/chaos"
 	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/skew"
 )
 
 // AppShell contains CLI Metadata
@@ -96,56 +100,30 @@ func (as *AppShell) Run() {
 			config = as.Config(c, config)
 		}
 
-		// Provide default values for each service's AMQP config section.
-		if config.ActivityMonitor.AMQP == nil {
-			config.ActivityMonitor.AMQP = config.AMQP
-		}
-		if config.WFE.AMQP == nil {
-			config.WFE.AMQP = config.AMQP
-		}
-		if config.CA.AMQP == nil {
-			config.CA.AMQP = config.AMQP
-			if config.CA.AMQP != nil && config.AMQP.CA != nil {
-				config.CA.AMQP.ServiceQueue = config.AMQP.CA.Server
-			}
-		}
-		if config.RA.AMQP == nil {
-			config.RA.AMQP = config.AMQP
-			if config.RA.AMQP != nil && config.AMQP.RA != nil {
-				config.RA.AMQP.ServiceQueue = config.AMQP.RA.Server
-			}
-		}
-		if config.SA.AMQP == nil {
-			config.SA.AMQP = config.AMQP
-			if config.SA.AMQP != nil && config.AMQP.SA != nil {
-				config.SA.AMQP.ServiceQueue = config.AMQP.SA.Server
-			}
-		}
-		if config.VA.AMQP == nil {
-			config.VA.AMQP = config.AMQP
-			if config.VA.AMQP != nil && config.AMQP.VA != nil {
-				config.VA.AMQP.ServiceQueue = config.AMQP.VA.Server
-			}
-		}
-		if config.Mailer.AMQP == nil {
-			config.Mailer.AMQP = config.AMQP
-		}
-		if config.OCSPUpdater.AMQP == nil {
-			config.OCSPUpdater.AMQP = config.AMQP
-		}
-		if config.OCSPResponder.AMQP == nil {
-			config.OCSPResponder.AMQP = config.AMQP
-		}
-		if config.Publisher.AMQP == nil {
-			config.Publisher.AMQP = config.AMQP
-			if config.Publisher.AMQP != nil && config.AMQP.Publisher != nil {
-				config.Publisher.AMQP.ServiceQueue = config.AMQP.Publisher.Server
-			}
-		}
+		config.SetAMQPDefaults()
+		config.EnableFeatures()
+		FailOnError(config.SetRollouts(), "Invalid feature rollouts")
 
 		stats, auditlogger := StatsAndLogging(config.Statsd, config.Syslog)
 		auditlogger.Info(as.VersionString())
 
+		if config.Common.ChaosTesting {
+			chaos.Enable()
+			http.Handle(chaos.Path, chaos.Handler())
+			auditlogger.Warning(fmt.Sprintf("Chaos testing enabled: faults can be injected at %s on the debug server", chaos.Path))
+		}
+
+		if config.Common.ClockSkewTesting {
+			var initial time.Duration
+			if env := os.Getenv("BOULDER_CLOCK_OFFSET"); env != "" {
+				initial, err = time.ParseDuration(env)
+				FailOnError(err, "Invalid BOULDER_CLOCK_OFFSET")
+			}
+			skew.Enable(initial)
+			http.Handle(skew.Path, skew.Handler())
+			auditlogger.Warning(fmt.Sprintf("Clock skew testing enabled: clocks are %s off, and can be shifted at %s on the debug server", initial, skew.Path))
+		}
+
 		// If as.Action generates a panic, this will log it to syslog.
 		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 		defer auditlogger.AuditPanic()
@@ -157,12 +135,33 @@ func (as *AppShell) Run() {
 	FailOnError(err, "Failed to run application")
 }
 
+// Clock returns the clock components should keep time by: the system
+// clock, unless clock skew testing shifts it.
+func Clock() clock.Clock {
+	if skew.Enabled() {
+		return skew.Clock(clock.Default())
+	}
+	return clock.Default()
+}
+
 // StatsAndLogging constructs a Statter and and AuditLogger based on its config
 // parameters, and return them both. Crashes if any setup fails.
-// Also sets the constructed AuditLogger as the default logger.
+// Also sets the constructed AuditLogger as the default logger. Unless
+// disabled, the Statter's metrics are served to Prometheus at /metrics on
+// the default HTTP mux, which the debug server serves.
 func StatsAndLogging(statConf StatsdConfig, logConf SyslogConfig) (statsd.Statter, *blog.AuditLogger) {
-	stats, err := statsd.NewClient(statConf.Server, statConf.Prefix)
-	FailOnError(err, "Couldn't connect to statsd")
+	var legacy statsd.Statter
+	if !statConf.DisableStatsd {
+		var err error
+		legacy, err = statsd.NewClient(statConf.Server, statConf.Prefix)
+		FailOnError(err, "Couldn't connect to statsd")
+	}
+	var registry *metrics.Registry
+	if !statConf.DisablePrometheus {
+		registry = metrics.NewRegistry()
+		http.Handle("/metrics", registry)
+	}
+	stats := metrics.NewBridgeStatter(legacy, registry, metrics.DefaultMappings)
 
 	tag := path.Base(os.Args[0])
 	syslogger, err := syslog.Dial(
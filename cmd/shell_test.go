@@ -3,6 +3,7 @@ package cmd
 import (
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/letsencrypt/boulder/test"
 )
@@ -51,3 +52,13 @@ func TestPAConfigUnmarshal(t *testing.T) {
 	test.AssertNotError(t, err, "Failed to unmarshal PAConfig")
 	test.AssertError(t, pc4.CheckChallenges(), "Disallow empty challenges map")
 }
+
+func TestConfigDurationRoundTrip(t *testing.T) {
+	encoded, err := json.Marshal(ConfigDuration{Duration: 90 * time.Minute})
+	test.AssertNotError(t, err, "Failed to marshal ConfigDuration")
+	test.AssertEquals(t, string(encoded), `"1h30m0s"`)
+
+	var d ConfigDuration
+	test.AssertNotError(t, json.Unmarshal(encoded, &d), "Failed to unmarshal ConfigDuration")
+	test.AssertEquals(t, d.Duration, 90*time.Minute)
+}
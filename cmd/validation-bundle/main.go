@@ -0,0 +1,474 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/codegangsta/cli"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/net/publicsuffix"
+	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/identifier"
+	"github.com/letsencrypt/boulder/probs"
+	"github.com/letsencrypt/boulder/ra"
+	"github.com/letsencrypt/boulder/rpc"
+	"github.com/letsencrypt/boulder/sa"
+)
+
+const clientName = "ValidationBundle"
+
+// bundle is everything known about the validation attempts for an
+// authorization ID or a domain, exported for support escalations.
+type bundle struct {
+	Generated time.Time `json:"generated"`
+	Query     query     `json:"query"`
+
+	Authorizations []authzBundle    `json:"authorizations"`
+	RateLimits     []rateLimitState `json:"rateLimits,omitempty"`
+	Errors         []string         `json:"errors,omitempty"`
+	LogFiles       []string         `json:"logFiles,omitempty"`
+}
+
+type query struct {
+	AuthzID string     `json:"authzID,omitempty"`
+	Domain  string     `json:"domain,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+	Until   *time.Time `json:"until,omitempty"`
+}
+
+// authzBundle is an authorization, with its challenges, and what was seen
+// while validating it.
+type authzBundle struct {
+	Authorization core.Authorization `json:"authorization"`
+	// DNSAnswers are the addresses each hostname resolved to during
+	// validation, from the challenges' validation records.
+	DNSAnswers map[string][]net.IP `json:"dnsAnswers,omitempty"`
+	// Problems are the problem documents of the failed challenges and
+	// attempts.
+	Problems []*probs.ProblemDetails `json:"problems,omitempty"`
+	// Validations are the VA's audit log events for the authorization,
+	// found in the log files given.
+	Validations []loggedValidation `json:"validations,omitempty"`
+	// Transcripts are the signed transcripts the VA stored of the
+	// authorization's successful validations, as compact JWS.
+	Transcripts []string `json:"transcripts,omitempty"`
+}
+
+// loggedValidation is a "Validation result" audit event.
+type loggedValidation struct {
+	RequestID string          `json:"requestID,omitempty"`
+	Event     json.RawMessage `json:"event"`
+}
+
+// rateLimitState is the current count of a rate limit against a key.
+type rateLimitState struct {
+	Limit     string `json:"limit"`
+	Key       string `json:"key"`
+	Count     int    `json:"count"`
+	Threshold int    `json:"threshold,omitempty"`
+	Window    string `json:"window,omitempty"`
+}
+
+// authzFinder finds the IDs of the authorizations for a name that were live
+// at some time in a range.
+type authzFinder interface {
+	findAuthorizations(name string, since, until time.Time) ([]string, error)
+}
+
+// dbFinder finds authorizations in the database. Only their expiry is
+// stored, so those created before until are found by the RA's default
+// lifetimes: the validation lifetime for valid authorizations, and the
+// pending lifetime for the rest.
+type dbFinder struct {
+	dbMap *gorp.DbMap
+}
+
+func (f dbFinder) findAuthorizations(name string, since, until time.Time) ([]string, error) {
+	ident, err := json.Marshal(identifier.FromValue(name))
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	_, err = f.dbMap.Select(&ids,
+		`SELECT id FROM authz
+		 WHERE identifier = :identifier AND expires > :since
+		 AND ((status = :valid AND expires <= :validUntil) OR (status <> :valid AND expires <= :pendingUntil))
+		 UNION ALL
+		 SELECT id FROM pendingAuthorizations
+		 WHERE identifier = :identifier AND expires > :since AND expires <= :pendingUntil`,
+		map[string]interface{}{
+			"identifier":   string(ident),
+			"since":        since,
+			"valid":        string(core.StatusValid),
+			"validUntil":   until.Add(ra.DefaultAuthorizationLifetime),
+			"pendingUntil": until.Add(ra.DefaultPendingAuthorizationLifetime),
+		})
+	return ids, err
+}
+
+// exporter builds bundles.
+type exporter struct {
+	sa       core.StorageGetter
+	finder   authzFinder
+	policies cmd.RateLimitConfig
+	logFiles []string
+	clk      clock.Clock
+}
+
+// export builds the bundle for q. Failures to read parts of it are recorded
+// in the bundle rather than ending the export, so that support gets as much
+// as there is.
+func (e *exporter) export(ctx context.Context, q query) (*bundle, error) {
+	b := &bundle{Generated: e.clk.Now(), Query: q, LogFiles: e.logFiles}
+
+	var ids []string
+	if q.AuthzID != "" {
+		ids = []string{q.AuthzID}
+	} else {
+		var err error
+		ids, err = e.finder.findAuthorizations(q.Domain, *q.Since, *q.Until)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	byID := make(map[string]int)
+	for _, id := range ids {
+		authz, err := e.sa.GetAuthorization(ctx, id)
+		if err != nil {
+			if q.AuthzID != "" {
+				return nil, err
+			}
+			b.Errors = append(b.Errors, fmt.Sprintf("Couldn't get authorization %s: %s", id, err))
+			continue
+		}
+		ab := newAuthzBundle(authz)
+		transcripts, err := e.sa.GetValidationTranscripts(ctx, authz.ID)
+		if err != nil {
+			b.Errors = append(b.Errors, fmt.Sprintf("Couldn't get validation transcripts of %s: %s", authz.ID, err))
+		}
+		for _, t := range transcripts {
+			ab.Transcripts = append(ab.Transcripts, string(t))
+		}
+		byID[authz.ID] = len(b.Authorizations)
+		b.Authorizations = append(b.Authorizations, ab)
+	}
+
+	for _, file := range e.logFiles {
+		if err := addLoggedValidations(b, byID, file); err != nil {
+			b.Errors = append(b.Errors, fmt.Sprintf("Couldn't read log file %s: %s", file, err))
+		}
+	}
+
+	b.RateLimits, b.Errors = e.rateLimits(ctx, b.Authorizations, b.Errors)
+	return b, nil
+}
+
+func newAuthzBundle(authz core.Authorization) authzBundle {
+	ab := authzBundle{Authorization: authz}
+	for _, chall := range authz.Challenges {
+		if chall.Error != nil {
+			ab.Problems = append(ab.Problems, chall.Error)
+		}
+		for _, record := range chall.ValidationRecord {
+			if record.Error != nil && record.Error != chall.Error {
+				ab.Problems = append(ab.Problems, record.Error)
+			}
+			if len(record.AddressesResolved) == 0 {
+				continue
+			}
+			if ab.DNSAnswers == nil {
+				ab.DNSAnswers = make(map[string][]net.IP)
+			}
+			for _, addr := range record.AddressesResolved {
+				if !containsIP(ab.DNSAnswers[record.Hostname], addr) {
+					ab.DNSAnswers[record.Hostname] = append(ab.DNSAnswers[record.Hostname], addr)
+				}
+			}
+		}
+	}
+	return ab
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, i := range ips {
+		if i.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+const validationResultTag = "Validation result JSON="
+
+var requestIDPattern = regexp.MustCompile(`\[Request ID: ([^\]]+)\]`)
+
+// addLoggedValidations adds the VA's audit events in the syslog file for
+// the authorizations in b, indexed by byID.
+func addLoggedValidations(b *bundle, byID map[string]int, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return scanLoggedValidations(f, func(authzID, requestID string, event json.RawMessage) {
+		if i, ok := byID[authzID]; ok {
+			b.Authorizations[i].Validations = append(b.Authorizations[i].Validations, loggedValidation{
+				RequestID: requestID,
+				Event:     event,
+			})
+		}
+	})
+}
+
+// scanLoggedValidations calls found with each "Validation result" audit
+// event in r.
+func scanLoggedValidations(r io.Reader, found func(authzID, requestID string, event json.RawMessage)) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if line == "" && err == io.EOF {
+			return nil
+		}
+		line = strings.TrimRight(line, "\r\n")
+		i := strings.Index(line, validationResultTag)
+		if i < 0 {
+			continue
+		}
+		event := json.RawMessage(line[i+len(validationResultTag):])
+		var parsed struct {
+			ID string
+		}
+		if err := json.Unmarshal(event, &parsed); err != nil {
+			// Lines cut short by syslog are passed over
+			continue
+		}
+		var requestID string
+		if m := requestIDPattern.FindStringSubmatch(line[:i]); m != nil {
+			requestID = m[1]
+		}
+		found(parsed.ID, requestID, event)
+	}
+}
+
+// rateLimits returns the state of the rate limits the authorizations' names
+// and registrations count against, adding failures to errs.
+func (e *exporter) rateLimits(ctx context.Context, authzs []authzBundle, errs []string) ([]rateLimitState, []string) {
+	var states []rateLimitState
+
+	regIDs := make(map[int64]bool)
+	var names []string
+	for _, ab := range authzs {
+		regIDs[ab.Authorization.RegistrationID] = true
+		names = append(names, ab.Authorization.Identifier.Value)
+	}
+
+	pending := e.policies.PendingAuthorizationsPerAccount
+	var sortedRegIDs []int64
+	for regID := range regIDs {
+		sortedRegIDs = append(sortedRegIDs, regID)
+	}
+	sort.Sort(regIDSlice(sortedRegIDs))
+	for _, regID := range sortedRegIDs {
+		count, err := e.sa.CountPendingAuthorizations(ctx, regID)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("Couldn't count pending authorizations of registration %d: %s", regID, err))
+			continue
+		}
+		states = append(states, rateLimitState{
+			Limit:     "pendingAuthorizationsPerAccount",
+			Key:       fmt.Sprintf("%d", regID),
+			Count:     count,
+			Threshold: pending.GetThreshold("", regID),
+		})
+	}
+
+	domains := eTLDPlusOnes(names)
+	if len(domains) > 0 {
+		perName := e.policies.CertificatesPerName
+		now := e.clk.Now()
+		counts, err := e.sa.CountCertificatesByNames(ctx, domains, perName.WindowBegin(now), now)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("Couldn't count certificates by name: %s", err))
+			return states, errs
+		}
+		for _, domain := range domains {
+			state := rateLimitState{
+				Limit:     "certificatesPerName",
+				Key:       domain,
+				Count:     counts[domain],
+				Threshold: perName.GetThreshold(domain, 0),
+			}
+			if perName.Window.Duration > 0 {
+				state.Window = perName.Window.Duration.String()
+			}
+			states = append(states, state)
+		}
+	}
+	return states, errs
+}
+
+type regIDSlice []int64
+
+func (s regIDSlice) Len() int           { return len(s) }
+func (s regIDSlice) Less(i, j int) bool { return s[i] < s[j] }
+func (s regIDSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// eTLDPlusOnes returns the distinct registered domains of names, which
+// issuance is rate limited by, in order of appearance.
+func eTLDPlusOnes(names []string) []string {
+	seen := make(map[string]bool)
+	var domains []string
+	for _, name := range names {
+		domain, err := publicsuffix.EffectiveTLDPlusOne(identifier.FromValue(name).Domain())
+		if err != nil || seen[domain] {
+			continue
+		}
+		seen[domain] = true
+		domains = append(domains, domain)
+	}
+	return domains
+}
+
+func loadConfig(c *cli.Context) (config cmd.Config, err error) {
+	configJSON, err := ioutil.ReadFile(c.GlobalString("config"))
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(configJSON, &config)
+	return
+}
+
+func setupExporter(c *cli.Context) *exporter {
+	config, err := loadConfig(c)
+	cmd.FailOnError(err, "Failed to load Boulder configuration")
+
+	stats, _ := cmd.StatsAndLogging(config.Statsd, config.Syslog)
+
+	dbURL, err := config.ValidationBundle.DBConfig.URL()
+	cmd.FailOnError(err, "Couldn't load DB URL")
+	dbMap, err := sa.NewDbMap(dbURL)
+	cmd.FailOnError(err, "Couldn't setup database connection")
+
+	sac, err := rpc.NewStorageAuthorityClient(clientName, config.ValidationBundle.AMQP, stats)
+	cmd.FailOnError(err, "Failed to create SA client")
+
+	var policies cmd.RateLimitConfig
+	if config.RA.RateLimitPoliciesFilename != "" {
+		policies, err = cmd.LoadRateLimitPolicies(config.RA.RateLimitPoliciesFilename)
+		cmd.FailOnError(err, "Couldn't load rate limit policies")
+	}
+
+	return &exporter{
+		sa:       sac,
+		finder:   dbFinder{dbMap},
+		policies: policies,
+		logFiles: c.GlobalStringSlice("log"),
+		clk:      clock.Default(),
+	}
+}
+
+// writeBundle writes b to the file named by the output flag, or stdout.
+func writeBundle(c *cli.Context, b *bundle) {
+	out, err := json.MarshalIndent(b, "", "  ")
+	cmd.FailOnError(err, "Couldn't marshal bundle")
+	out = append(out, '\n')
+	if file := c.GlobalString("output"); file != "" {
+		err = ioutil.WriteFile(file, out, 0600)
+		cmd.FailOnError(err, "Couldn't write bundle")
+		return
+	}
+	os.Stdout.Write(out)
+}
+
+func main() {
+	app := cli.NewApp()
+	app.Name = "validation-bundle"
+	app.Usage = "Exports what Boulder knows about validation attempts, for support escalations"
+	app.Version = cmd.Version()
+	app.Author = "Boulder contributors"
+	app.Email = "ca-dev@letsencrypt.org"
+
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Value:  "config.json",
+			EnvVar: "BOULDER_CONFIG",
+			Usage:  "Path to Boulder JSON configuration file",
+		},
+		cli.StringFlag{
+			Name:  "output",
+			Usage: "File to write the JSON bundle to, instead of stdout",
+		},
+		cli.StringSliceFlag{
+			Name:  "log",
+			Value: &cli.StringSlice{},
+			Usage: "A syslog file of the VA to search for validation events; repeat for each file",
+		},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name:  "authz",
+			Usage: "Export the validation attempts for an authorization ID",
+			Action: func(c *cli.Context) {
+				// 1: authorization ID
+				id := c.Args().First()
+				if id == "" {
+					cmd.FailOnError(fmt.Errorf("No authorization ID given"), "Nothing to export")
+				}
+
+				e := setupExporter(c)
+				b, err := e.export(context.Background(), query{AuthzID: id})
+				cmd.FailOnError(err, "Couldn't export bundle")
+				writeBundle(c, b)
+			},
+		},
+		{
+			Name:  "domain",
+			Usage: "Export the validation attempts for a domain, e.g. domain example.com 2015-11-20T00:00:00Z 2015-11-21T00:00:00Z",
+			Action: func(c *cli.Context) {
+				// 1: domain, 2: since, 3: until (RFC 3339, default now)
+				domain := c.Args().First()
+				if domain == "" {
+					cmd.FailOnError(fmt.Errorf("No domain given"), "Nothing to export")
+				}
+				since, err := time.Parse(time.RFC3339, c.Args().Get(1))
+				cmd.FailOnError(err, "Start of range must be an RFC 3339 time")
+				until := time.Now()
+				if c.Args().Get(2) != "" {
+					until, err = time.Parse(time.RFC3339, c.Args().Get(2))
+					cmd.FailOnError(err, "End of range must be an RFC 3339 time")
+				}
+
+				e := setupExporter(c)
+				b, err := e.export(context.Background(), query{Domain: domain, Since: &since, Until: &until})
+				cmd.FailOnError(err, "Couldn't export bundle")
+				writeBundle(c, b)
+			},
+		},
+	}
+
+	err := app.Run(os.Args)
+	cmd.FailOnError(err, "Failed to run application")
+}
@@ -0,0 +1,191 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/identifier"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/probs"
+	"github.com/letsencrypt/boulder/test"
+)
+
+type bundleSA struct {
+	mocks.StorageAuthority
+	authzs      map[string]core.Authorization
+	transcripts map[string][][]byte
+}
+
+func (sa *bundleSA) GetValidationTranscripts(_ context.Context, authzID string) ([][]byte, error) {
+	return sa.transcripts[authzID], nil
+}
+
+func (sa *bundleSA) GetAuthorization(_ context.Context, id string) (core.Authorization, error) {
+	authz, ok := sa.authzs[id]
+	if !ok {
+		return core.Authorization{}, fmt.Errorf("No authorization %s", id)
+	}
+	return authz, nil
+}
+
+func (sa *bundleSA) CountPendingAuthorizations(_ context.Context, regID int64) (int, error) {
+	return int(regID) * 2, nil
+}
+
+func (sa *bundleSA) CountCertificatesByNames(_ context.Context, names []string, _, _ time.Time) (map[string]int, error) {
+	counts := make(map[string]int)
+	for _, name := range names {
+		counts[name] = 4
+	}
+	return counts, nil
+}
+
+type staticFinder []string
+
+func (f staticFinder) findAuthorizations(string, time.Time, time.Time) ([]string, error) {
+	return f, nil
+}
+
+var failed = core.Authorization{
+	ID:             "failed",
+	RegistrationID: 1,
+	Status:         core.StatusInvalid,
+	Identifier:     identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: "www.example.com"},
+	Challenges: []core.Challenge{
+		{
+			Type:   core.ChallengeTypeHTTP01,
+			Status: core.StatusInvalid,
+			Error:  probs.Unauthorized("The key authorization file from the server did not match this challenge"),
+			ValidationRecord: []core.ValidationRecord{
+				{
+					Hostname:          "www.example.com",
+					Port:              "80",
+					AddressesResolved: []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")},
+					AddressUsed:       net.ParseIP("2001:db8::1"),
+					Attempt:           1,
+					Error:             &probs.ProblemDetails{Type: probs.ConnectionProblem, Detail: "Connection refused"},
+				},
+				{
+					Hostname:          "www.example.com",
+					Port:              "80",
+					AddressesResolved: []net.IP{net.ParseIP("192.0.2.1")},
+					AddressUsed:       net.ParseIP("192.0.2.1"),
+					Attempt:           2,
+				},
+			},
+		},
+	},
+}
+
+var pending = core.Authorization{
+	ID:             "pending",
+	RegistrationID: 2,
+	Status:         core.StatusPending,
+	Identifier:     identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: "example.com"},
+}
+
+func newTestExporter(finder authzFinder, logs ...string) *exporter {
+	var policies cmd.RateLimitConfig
+	policies.CertificatesPerName.Threshold = 5
+	policies.CertificatesPerName.Window.Duration = 7 * 24 * time.Hour
+	policies.PendingAuthorizationsPerAccount.Threshold = 3
+	return &exporter{
+		sa: &bundleSA{
+			authzs: map[string]core.Authorization{
+				failed.ID:  failed,
+				pending.ID: pending,
+			},
+			transcripts: map[string][][]byte{
+				failed.ID: {[]byte("eyJhbGciOiJFUzI1NiJ9.e30.c2ln")},
+			},
+		},
+		finder:   finder,
+		policies: policies,
+		logFiles: logs,
+		clk:      clock.NewFake(),
+	}
+}
+
+func TestExportAuthz(t *testing.T) {
+	logFile, err := ioutil.TempFile("", "validation-bundle")
+	test.AssertNotError(t, err, "Failed to create log file")
+	defer os.Remove(logFile.Name())
+	fmt.Fprintln(logFile, `Nov 20 12:00:00 va boulder-va[1]: [AUDIT] [Request ID: f00f] Validation result JSON={"ID":"failed","Requester":1}`)
+	fmt.Fprintln(logFile, `Nov 20 12:00:01 va boulder-va[1]: [AUDIT] Validation result JSON={"ID":"other","Requester":3}`)
+	fmt.Fprintln(logFile, `Nov 20 12:00:02 va boulder-va[1]: [AUDIT] Validation result JSON={"ID":"failed","Requ`)
+	fmt.Fprintln(logFile, `Nov 20 12:00:03 va boulder-va[1]: Attempting to validate failed`)
+	logFile.Close()
+
+	e := newTestExporter(staticFinder(nil), logFile.Name(), "/does/not/exist")
+	b, err := e.export(context.Background(), query{AuthzID: "failed"})
+	test.AssertNotError(t, err, "Export failed")
+
+	test.AssertEquals(t, len(b.Authorizations), 1)
+	ab := b.Authorizations[0]
+	test.AssertEquals(t, ab.Authorization.ID, "failed")
+	test.AssertEquals(t, len(ab.DNSAnswers["www.example.com"]), 2)
+	test.AssertEquals(t, len(ab.Problems), 2)
+	test.AssertEquals(t, ab.Problems[1].Detail, "Connection refused")
+	test.AssertEquals(t, len(ab.Transcripts), 1)
+	test.AssertEquals(t, ab.Transcripts[0], "eyJhbGciOiJFUzI1NiJ9.e30.c2ln")
+
+	// Only complete events for the authorization are found
+	test.AssertEquals(t, len(ab.Validations), 1)
+	test.AssertEquals(t, ab.Validations[0].RequestID, "f00f")
+	test.AssertEquals(t, string(ab.Validations[0].Event), `{"ID":"failed","Requester":1}`)
+
+	// A missing log file doesn't stop the export
+	test.AssertEquals(t, len(b.Errors), 1)
+	test.AssertContains(t, b.Errors[0], "/does/not/exist")
+
+	test.AssertEquals(t, len(b.RateLimits), 2)
+	test.AssertEquals(t, b.RateLimits[0], rateLimitState{
+		Limit: "pendingAuthorizationsPerAccount", Key: "1", Count: 2, Threshold: 3,
+	})
+	test.AssertEquals(t, b.RateLimits[1], rateLimitState{
+		Limit: "certificatesPerName", Key: "example.com", Count: 4, Threshold: 5, Window: "168h0m0s",
+	})
+
+	// The bundle is a single JSON document
+	out, err := json.Marshal(b)
+	test.AssertNotError(t, err, "Failed to marshal bundle")
+	test.Assert(t, strings.Contains(string(out), `"requestID":"f00f"`), "Request ID missing from bundle")
+
+	_, err = e.export(context.Background(), query{AuthzID: "missing"})
+	test.AssertError(t, err, "Export of missing authorization succeeded")
+}
+
+func TestExportDomain(t *testing.T) {
+	e := newTestExporter(staticFinder{"failed", "pending", "missing"})
+	since := time.Date(2015, 11, 20, 0, 0, 0, 0, time.UTC)
+	until := since.Add(24 * time.Hour)
+	b, err := e.export(context.Background(), query{Domain: "example.com", Since: &since, Until: &until})
+	test.AssertNotError(t, err, "Export failed")
+
+	test.AssertEquals(t, len(b.Authorizations), 2)
+	test.AssertEquals(t, len(b.Errors), 1)
+	test.AssertContains(t, b.Errors[0], "missing")
+
+	// Each registration is counted once, and both names count against the
+	// same registered domain
+	test.AssertEquals(t, len(b.RateLimits), 3)
+	test.AssertEquals(t, b.RateLimits[0].Key, "1")
+	test.AssertEquals(t, b.RateLimits[1].Key, "2")
+	test.AssertEquals(t, b.RateLimits[2].Key, "example.com")
+}
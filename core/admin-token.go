@@ -0,0 +1,29 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package core
+
+import "context"
+
+// AdminTokenHeader is the AMQP message header that carries the signed token
+// of the operator running an admin tool to the services it calls.
+const AdminTokenHeader = "Boulder-Admin-Token"
+
+type adminTokenKey struct{}
+
+// WithAdminToken returns a copy of ctx carrying the operator token token.
+func WithAdminToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, adminTokenKey{}, token)
+}
+
+// AdminToken returns the operator token carried by ctx, or "" if there is
+// none.
+func AdminToken(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	token, _ := ctx.Value(adminTokenKey{}).(string)
+	return token
+}
@@ -0,0 +1,58 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// BlockedKeys are keys, by the KeyDigest of their SPKI, that may not be
+// used for accounts or certificates, such as a published list of keys known
+// to be compromised. Keys blocked since, with admin-revoker, are held by the
+// SA.
+type BlockedKeys map[string]bool
+
+// LoadBlockedKeys reads a JSON list of key digests, as made by KeyDigest.
+func LoadBlockedKeys(filename string) (BlockedKeys, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var digests []string
+	if err = json.Unmarshal(data, &digests); err != nil {
+		return nil, fmt.Errorf("Couldn't parse blocked keys file %s: %s", filename, err)
+	}
+	blocked := make(BlockedKeys, len(digests))
+	for _, digest := range digests {
+		if raw, err := base64.StdEncoding.DecodeString(digest); err != nil || len(raw) != sha256.Size {
+			return nil, fmt.Errorf("Invalid key digest %q in blocked keys file %s", digest, filename)
+		}
+		blocked[digest] = true
+	}
+	return blocked, nil
+}
+
+// KeyBlocked returns whether key is in blocked, or has been blocked in the
+// SA with sa. sa may be nil to check blocked alone.
+func KeyBlocked(ctx context.Context, key crypto.PublicKey, blocked BlockedKeys, sa StorageGetter) (bool, error) {
+	digest, err := KeyDigest(key)
+	if err != nil {
+		return false, err
+	}
+	if blocked[digest] {
+		return true, nil
+	}
+	if sa == nil {
+		return false, nil
+	}
+	return sa.KeyBlocked(ctx, digest)
+}
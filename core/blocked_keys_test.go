@@ -0,0 +1,68 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+// blockingSA blocks the one key whose digest is blocked.
+type blockingSA struct {
+	StorageGetter
+	blocked string
+}
+
+func (sa blockingSA) KeyBlocked(ctx context.Context, keyHash string) (bool, error) {
+	return keyHash == sa.blocked, nil
+}
+
+func TestBlockedKeys(t *testing.T) {
+	var keys [3]*ecdsa.PrivateKey
+	var digests [3]string
+	for i := range keys {
+		var err error
+		keys[i], err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		test.AssertNotError(t, err, "Failed to generate key")
+		digests[i], err = KeyDigest(&keys[i].PublicKey)
+		test.AssertNotError(t, err, "Failed to digest key")
+	}
+
+	f, err := ioutil.TempFile("", "blocked-keys")
+	test.AssertNotError(t, err, "Failed to create temp file")
+	defer os.Remove(f.Name())
+	fmt.Fprintf(f, `["%s"]`, digests[0])
+	f.Close()
+	blocked, err := LoadBlockedKeys(f.Name())
+	test.AssertNotError(t, err, "Failed to load blocked keys")
+	test.AssertEquals(t, len(blocked), 1)
+
+	// Keys are blocked by the list or in the SA
+	sa := blockingSA{blocked: digests[1]}
+	for i, expected := range []bool{true, true, false} {
+		isBlocked, err := KeyBlocked(context.Background(), &keys[i].PublicKey, blocked, sa)
+		test.AssertNotError(t, err, "KeyBlocked failed")
+		test.AssertEquals(t, isBlocked, expected)
+	}
+	isBlocked, err := KeyBlocked(context.Background(), &keys[1].PublicKey, blocked, nil)
+	test.AssertNotError(t, err, "KeyBlocked failed without an SA")
+	test.Assert(t, !isBlocked, "Key blocked in the SA was blocked without one")
+
+	for _, contents := range []string{`{}`, `["not a digest"]`, `["AAAA"]`} {
+		err = ioutil.WriteFile(f.Name(), []byte(contents), 0600)
+		test.AssertNotError(t, err, "Failed to write blocked keys")
+		_, err = LoadBlockedKeys(f.Name())
+		test.AssertError(t, err, "Loaded invalid blocked keys "+contents)
+	}
+}
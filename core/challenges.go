@@ -6,10 +6,159 @@
 package core
 
 import (
-	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
+	"fmt"
+	"sync"
+
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
+	"github.com/letsencrypt/boulder/identifier"
 )
 
-func newChallenge(challengeType string, accountKey *jose.JsonWebKey) Challenge {
+// ChallengeType is what Boulder knows about one type of challenge, apart
+// from how the VA validates it. Each type is registered with
+// RegisterChallengeType, and the PA offers, and the RA, VA and WFE check,
+// challenges through the registered types, so that a new type can be added
+// by registering it here and its validator with the VA.
+type ChallengeType interface {
+	// Name is the type of the challenges, as named in the PA's
+	// configuration.
+	Name() string
+	// Offers reports whether challenges of the type can validate id.
+	Offers(id identifier.ACMEIdentifier) bool
+	// ResponseToken returns the token that the key authorization of ch, a
+	// completed challenge of the type, must match, or false if the
+	// response is malformed.
+	ResponseToken(ch Challenge) (string, bool)
+	// RecordsSane reports whether records, those of the attempts of a
+	// validation that succeeded, are complete.
+	RecordsSane(records []ValidationRecord) bool
+}
+
+// challengeTypes are the registered challenge types, by name and in the
+// order they were registered.
+var challengeTypes = struct {
+	sync.RWMutex
+	byName  map[string]ChallengeType
+	ordered []ChallengeType
+}{byName: make(map[string]ChallengeType)}
+
+// RegisterChallengeType registers ct. It panics if a type of the same name
+// is already registered.
+func RegisterChallengeType(ct ChallengeType) {
+	challengeTypes.Lock()
+	defer challengeTypes.Unlock()
+	if _, ok := challengeTypes.byName[ct.Name()]; ok {
+		panic(fmt.Sprintf("Challenge type %q registered twice", ct.Name()))
+	}
+	challengeTypes.byName[ct.Name()] = ct
+	challengeTypes.ordered = append(challengeTypes.ordered, ct)
+}
+
+// LookupChallengeType returns the registered challenge type of the given
+// name, if there is one.
+func LookupChallengeType(name string) (ChallengeType, bool) {
+	challengeTypes.RLock()
+	defer challengeTypes.RUnlock()
+	ct, ok := challengeTypes.byName[name]
+	return ct, ok
+}
+
+// ChallengeTypes returns the registered challenge types, in the order they
+// were registered.
+func ChallengeTypes() []ChallengeType {
+	challengeTypes.RLock()
+	defer challengeTypes.RUnlock()
+	return append([]ChallengeType(nil), challengeTypes.ordered...)
+}
+
+func init() {
+	for _, ct := range []ChallengeType{
+		http01{dnsChallengeType{ChallengeTypeHTTP01}},
+		tlsSNI01{dnsChallengeType{ChallengeTypeTLSSNI01}},
+		dnsChallengeType{ChallengeTypeDNS01},
+		dnsChallengeType{ChallengeTypeDNSAccount01},
+		emailReply00{},
+	} {
+		RegisterChallengeType(ct)
+	}
+}
+
+// dnsChallengeType is a challenge type for DNS identifiers whose key
+// authorization is of the challenge's own token. Its records need nothing,
+// as for dns-01 and dns-account-01, which query the VA's resolvers.
+type dnsChallengeType struct {
+	name string
+}
+
+func (ct dnsChallengeType) Name() string { return ct.name }
+
+func (ct dnsChallengeType) Offers(id identifier.ACMEIdentifier) bool {
+	return id.Type != IdentifierEmail
+}
+
+func (ct dnsChallengeType) ResponseToken(ch Challenge) (string, bool) {
+	return ch.Token, true
+}
+
+func (ct dnsChallengeType) RecordsSane(records []ValidationRecord) bool {
+	return true
+}
+
+// http01 needs a complete record of every successful request, including
+// those redirected.
+type http01 struct {
+	dnsChallengeType
+}
+
+func (http01) RecordsSane(records []ValidationRecord) bool {
+	if len(records) == 0 {
+		return false
+	}
+	for _, rec := range records {
+		if rec.URL == "" || rec.Hostname == "" || rec.Port == "" || rec.AddressUsed == nil ||
+			len(rec.AddressesResolved) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// tlsSNI01 needs a record of exactly one connection, which has no URL.
+type tlsSNI01 struct {
+	dnsChallengeType
+}
+
+func (tlsSNI01) RecordsSane(records []ValidationRecord) bool {
+	if len(records) != 1 || records[0].URL != "" {
+		return false
+	}
+	return records[0].Hostname != "" && records[0].Port != "" &&
+		records[0].AddressUsed != nil && len(records[0].AddressesResolved) != 0
+}
+
+// emailReply00 validates email identifiers. The response's token starts
+// with the half that was mailed.
+type emailReply00 struct{}
+
+func (emailReply00) Name() string { return ChallengeTypeEmailReply00 }
+
+func (emailReply00) Offers(id identifier.ACMEIdentifier) bool {
+	return id.Type == IdentifierEmail
+}
+
+func (emailReply00) ResponseToken(ch Challenge) (string, bool) {
+	if !LooksLikeATokenPair(ch.KeyAuthorization.Token) {
+		return "", false
+	}
+	return ch.KeyAuthorization.Token[:tokenLength] + ch.Token, true
+}
+
+func (emailReply00) RecordsSane(records []ValidationRecord) bool {
+	return true
+}
+
+// NewChallenge constructs a random pending challenge of the given type for
+// accountKey.
+func NewChallenge(challengeType string, accountKey *jose.JSONWebKey) Challenge {
 	return Challenge{
 		Type:       challengeType,
 		Status:     StatusPending,
@@ -19,16 +168,26 @@ func newChallenge(challengeType string, accountKey *jose.JsonWebKey) Challenge {
 }
 
 // HTTPChallenge01 constructs a random http-01 challenge
-func HTTPChallenge01(accountKey *jose.JsonWebKey) Challenge {
-	return newChallenge(ChallengeTypeHTTP01, accountKey)
+func HTTPChallenge01(accountKey *jose.JSONWebKey) Challenge {
+	return NewChallenge(ChallengeTypeHTTP01, accountKey)
 }
 
 // TLSSNIChallenge01 constructs a random tls-sni-00 challenge
-func TLSSNIChallenge01(accountKey *jose.JsonWebKey) Challenge {
-	return newChallenge(ChallengeTypeTLSSNI01, accountKey)
+func TLSSNIChallenge01(accountKey *jose.JSONWebKey) Challenge {
+	return NewChallenge(ChallengeTypeTLSSNI01, accountKey)
 }
 
 // DNSChallenge01 constructs a random DNS challenge
-func DNSChallenge01(accountKey *jose.JsonWebKey) Challenge {
-	return newChallenge(ChallengeTypeDNS01, accountKey)
+func DNSChallenge01(accountKey *jose.JSONWebKey) Challenge {
+	return NewChallenge(ChallengeTypeDNS01, accountKey)
+}
+
+// EmailReplyChallenge00 constructs a random email-reply-00 challenge
+func EmailReplyChallenge00(accountKey *jose.JSONWebKey) Challenge {
+	return NewChallenge(ChallengeTypeEmailReply00, accountKey)
+}
+
+// DNSAccountChallenge01 constructs a random dns-account-01 challenge
+func DNSAccountChallenge01(accountKey *jose.JSONWebKey) Challenge {
+	return NewChallenge(ChallengeTypeDNSAccount01, accountKey)
 }
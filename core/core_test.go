@@ -6,14 +6,17 @@
 package core
 
 import (
+	"context"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
-	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
+	"github.com/letsencrypt/boulder/identifier"
 	"github.com/letsencrypt/boulder/test"
 )
 
@@ -26,7 +29,7 @@ var accountKeyJSON = `{
 }`
 
 func TestChallenges(t *testing.T) {
-	var accountKey *jose.JsonWebKey
+	var accountKey *jose.JSONWebKey
 	err := json.Unmarshal([]byte(accountKeyJSON), &accountKey)
 	if err != nil {
 		t.Errorf("Error unmarshaling JWK: %v", err)
@@ -47,12 +50,74 @@ func TestChallenges(t *testing.T) {
 		t.Errorf("New dns-01 challenge is not sane: %v", dns01)
 	}
 
+	dnsAccount01 := DNSAccountChallenge01(accountKey)
+	if !dnsAccount01.IsSane(false) {
+		t.Errorf("New dns-account-01 challenge is not sane: %v", dnsAccount01)
+	}
+
 	test.Assert(t, ValidChallenge(ChallengeTypeHTTP01), "Refused valid challenge")
 	test.Assert(t, ValidChallenge(ChallengeTypeTLSSNI01), "Refused valid challenge")
 	test.Assert(t, ValidChallenge(ChallengeTypeDNS01), "Refused valid challenge")
+	test.Assert(t, ValidChallenge(ChallengeTypeDNSAccount01), "Refused valid challenge")
 	test.Assert(t, !ValidChallenge("nonsense-71"), "Accepted invalid challenge")
 }
 
+// onionChallenge is a challenge type for a made up .onion identifier type,
+// whose responses key-authorize the token reversed.
+type onionChallenge struct{}
+
+func (onionChallenge) Name() string                                { return "onion-test-00" }
+func (onionChallenge) Offers(id identifier.ACMEIdentifier) bool    { return id.Type == "onion" }
+func (onionChallenge) RecordsSane(records []ValidationRecord) bool { return len(records) == 1 }
+func (onionChallenge) ResponseToken(ch Challenge) (string, bool) {
+	reversed := []byte(ch.Token)
+	for i, j := 0, len(reversed)-1; i < j; i, j = i+1, j-1 {
+		reversed[i], reversed[j] = reversed[j], reversed[i]
+	}
+	return string(reversed), true
+}
+
+func TestRegisterChallengeType(t *testing.T) {
+	var accountKey *jose.JSONWebKey
+	err := json.Unmarshal([]byte(accountKeyJSON), &accountKey)
+	test.AssertNotError(t, err, "Failed to unmarshal JWK")
+
+	// The built in types are registered in order
+	var names []string
+	for _, ct := range ChallengeTypes() {
+		names = append(names, ct.Name())
+	}
+	test.AssertDeepEquals(t, names, []string{ChallengeTypeHTTP01, ChallengeTypeTLSSNI01, ChallengeTypeDNS01, ChallengeTypeDNSAccount01, ChallengeTypeEmailReply00})
+
+	test.Assert(t, !ValidChallenge("onion-test-00"), "Accepted unregistered challenge")
+	RegisterChallengeType(onionChallenge{})
+	test.Assert(t, ValidChallenge("onion-test-00"), "Refused registered challenge")
+	ct, ok := LookupChallengeType("onion-test-00")
+	test.Assert(t, ok, "Failed to look up registered challenge")
+	test.Assert(t, ct.Offers(identifier.ACMEIdentifier{Type: "onion"}), "Challenge doesn't offer its identifier type")
+
+	// Sanity checks defer to the registered type
+	chall := NewChallenge("onion-test-00", accountKey)
+	test.Assert(t, chall.IsSane(false), "New challenge isn't sane")
+	token, _ := ct.ResponseToken(chall)
+	ka, err := NewKeyAuthorization(chall.Token, accountKey)
+	test.AssertNotError(t, err, "Failed to make key authorization")
+	chall.KeyAuthorization = &ka
+	test.Assert(t, !chall.IsSane(true), "Accepted key authorization of the unreversed token")
+	ka, err = NewKeyAuthorization(token, accountKey)
+	test.AssertNotError(t, err, "Failed to make key authorization")
+	chall.KeyAuthorization = &ka
+	test.Assert(t, chall.IsSane(true), "Refused key authorization of the reversed token")
+	test.Assert(t, !chall.RecordsSane(), "Accepted no records")
+	chall.ValidationRecord = []ValidationRecord{{Hostname: "example.onion"}}
+	test.Assert(t, chall.RecordsSane(), "Refused one record")
+
+	defer func() {
+		test.Assert(t, recover() != nil, "Registered a challenge type twice")
+	}()
+	RegisterChallengeType(onionChallenge{})
+}
+
 // objects.go
 
 var testCertificateRequestBadCSR = []byte(`{"csr":"AAAA"}`)
@@ -88,6 +153,45 @@ func TestCertificateRequest(t *testing.T) {
 	if err != nil {
 		t.Errorf("Marshalled certificate request failed to unmarshal: %v", err)
 	}
+
+	// The selected profile survives a round trip
+	goodCR.Profile = "short"
+	jsonCR, err = json.Marshal(goodCR)
+	test.AssertNotError(t, err, "Failed to marshal certificate request with a profile")
+	var profileCR CertificateRequest
+	err = json.Unmarshal(jsonCR, &profileCR)
+	test.AssertNotError(t, err, "Failed to unmarshal certificate request with a profile")
+	test.AssertEquals(t, profileCR.Profile, "short")
+
+	// So does the serial of the certificate it replaces
+	goodCR.Replaces = "0000000000000000000000000000000000ee"
+	jsonCR, err = json.Marshal(goodCR)
+	test.AssertNotError(t, err, "Failed to marshal certificate request with a replaced serial")
+	var renewalCR CertificateRequest
+	err = json.Unmarshal(jsonCR, &renewalCR)
+	test.AssertNotError(t, err, "Failed to unmarshal certificate request with a replaced serial")
+	test.AssertEquals(t, renewalCR.Replaces, "0000000000000000000000000000000000ee")
+
+	// And the idempotency key
+	goodCR.IdempotencyKey = "retry-1"
+	jsonCR, err = json.Marshal(goodCR)
+	test.AssertNotError(t, err, "Failed to marshal certificate request with an idempotency key")
+	var retryCR CertificateRequest
+	err = json.Unmarshal(jsonCR, &retryCR)
+	test.AssertNotError(t, err, "Failed to unmarshal certificate request with an idempotency key")
+	test.AssertEquals(t, retryCR.IdempotencyKey, "retry-1")
+
+	// And the requested validity period
+	notBefore := time.Date(2015, 12, 1, 0, 0, 0, 0, time.UTC)
+	goodCR.Validity = Validity{NotBefore: notBefore, NotAfter: notBefore.Add(24 * time.Hour)}
+	jsonCR, err = json.Marshal(goodCR)
+	test.AssertNotError(t, err, "Failed to marshal certificate request with a validity period")
+	var validityCR CertificateRequest
+	err = json.Unmarshal(jsonCR, &validityCR)
+	test.AssertNotError(t, err, "Failed to unmarshal certificate request with a validity period")
+	test.Assert(t, validityCR.Validity.NotBefore.Equal(notBefore), "Wrong notBefore after round trip")
+	test.Assert(t, validityCR.Validity.NotAfter.Equal(notBefore.Add(24*time.Hour)), "Wrong notAfter after round trip")
+	test.Assert(t, retryCR.Validity.IsZero(), "Validity period set without being requested")
 }
 
 // util.go
@@ -196,3 +300,11 @@ func TestVerifyCSR(t *testing.T) {
 		}
 	}
 }
+
+// request-id.go
+
+func TestRequestID(t *testing.T) {
+	test.AssertEquals(t, RequestID(context.Background()), "")
+	ctx := WithRequestID(context.Background(), "f00f")
+	test.AssertEquals(t, RequestID(ctx), "f00f")
+}
@@ -0,0 +1,89 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// features are the names of the optional features enabled in this process,
+// which are advertised to the components it talks to.
+var features = struct {
+	sync.Mutex
+	names map[string]bool
+}{names: make(map[string]bool)}
+
+// EnableFeature records that the optional feature name is enabled.
+func EnableFeature(name string) {
+	features.Lock()
+	defer features.Unlock()
+	features.names[name] = true
+}
+
+// EnabledFeatures returns the names of the enabled optional features, sorted.
+func EnabledFeatures() []string {
+	features.Lock()
+	defer features.Unlock()
+	names := make([]string, 0, len(features.names))
+	for name := range features.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Rollout activates a feature, request by request, for only some accounts:
+// those in Accounts, and Percent percent of the rest. Which accounts get a
+// percentage depends on a hash of the account ID and feature name, so that
+// an account consistently gets the feature or doesn't, and different
+// features are tried on different accounts.
+type Rollout struct {
+	Percent  float64
+	Accounts []int64
+}
+
+// rolloutBuckets is how finely Rollout.Percent picks accounts
+const rolloutBuckets = 10000
+
+var rollouts = struct {
+	sync.RWMutex
+	byName map[string]Rollout
+}{byName: make(map[string]Rollout)}
+
+// SetRollout limits the feature name to the accounts rollout picks.
+func SetRollout(name string, rollout Rollout) error {
+	if rollout.Percent < 0 || rollout.Percent > 100 {
+		return fmt.Errorf("Rollout of %s to %g%% of accounts isn't a percentage", name, rollout.Percent)
+	}
+	rollouts.Lock()
+	defer rollouts.Unlock()
+	rollouts.byName[name] = rollout
+	return nil
+}
+
+// FeatureEnabledFor returns whether the feature name, where it's otherwise
+// enabled, is enabled for requests by the account regID. Features that
+// aren't being rolled out are enabled for every account.
+func FeatureEnabledFor(name string, regID int64) bool {
+	rollouts.RLock()
+	rollout, ok := rollouts.byName[name]
+	rollouts.RUnlock()
+	if !ok {
+		return true
+	}
+	for _, id := range rollout.Accounts {
+		if id == regID {
+			return true
+		}
+	}
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s:%d", name, regID)))
+	bucket := binary.BigEndian.Uint64(hash[:8]) % rolloutBuckets
+	return float64(bucket) < rollout.Percent*rolloutBuckets/100
+}
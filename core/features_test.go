@@ -0,0 +1,47 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestFeatureEnabledFor(t *testing.T) {
+	test.Assert(t, FeatureEnabledFor("notRolledOut", 1), "Feature without a rollout not enabled")
+
+	err := SetRollout("allowlisted", Rollout{Accounts: []int64{5}})
+	test.AssertNotError(t, err, "Failed to set rollout")
+	test.Assert(t, FeatureEnabledFor("allowlisted", 5), "Feature not enabled for listed account")
+	test.Assert(t, !FeatureEnabledFor("allowlisted", 6), "Feature enabled for unlisted account")
+
+	err = SetRollout("everyone", Rollout{Percent: 100})
+	test.AssertNotError(t, err, "Failed to set rollout")
+	err = SetRollout("tenth", Rollout{Percent: 10})
+	test.AssertNotError(t, err, "Failed to set rollout")
+	err = SetRollout("otherTenth", Rollout{Percent: 10})
+	test.AssertNotError(t, err, "Failed to set rollout")
+	var tenth, both int
+	for regID := int64(1); regID <= 10000; regID++ {
+		test.Assert(t, FeatureEnabledFor("everyone", regID), fmt.Sprintf("Feature not enabled for %d", regID))
+		enabled := FeatureEnabledFor("tenth", regID)
+		test.AssertEquals(t, FeatureEnabledFor("tenth", regID), enabled)
+		if enabled {
+			tenth++
+			if FeatureEnabledFor("otherTenth", regID) {
+				both++
+			}
+		}
+	}
+	test.Assert(t, tenth > 800 && tenth < 1200, fmt.Sprintf("10%% rollout enabled for %d of 10000 accounts", tenth))
+	// Features are rolled out to different accounts
+	test.Assert(t, both < 200, fmt.Sprintf("Two 10%% rollouts share %d of %d accounts", both, tenth))
+
+	test.AssertError(t, SetRollout("bad", Rollout{Percent: 101}), "Accepted a rollout over 100%")
+	test.AssertError(t, SetRollout("bad", Rollout{Percent: -1}), "Accepted a negative rollout")
+}
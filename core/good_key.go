@@ -8,12 +8,15 @@ package core
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rsa"
 	"fmt"
 	blog "github.com/letsencrypt/boulder/log"
 	"math/big"
 	"reflect"
 	"sync"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/crypto/ed25519"
 )
 
 // To generate, run: primes 2 752 | tr '\n' ,
@@ -60,12 +63,56 @@ func GoodKey(key crypto.PublicKey) error {
 	}
 }
 
-// GoodKeyECDSA determines if an ECDSA pubkey meets our requirements
+// GoodAccountKey returns nil iff key is acceptable as an account key: a key
+// GoodKey accepts or, if allowEd25519 is set, an Ed25519 key. Ed25519 keys
+// only sign JWS requests, so are never accepted for certificates.
+func GoodAccountKey(key crypto.PublicKey, allowEd25519 bool) error {
+	switch t := key.(type) {
+	case ed25519.PublicKey:
+		if !allowEd25519 {
+			return MalformedRequestError("Ed25519 account keys are not supported")
+		}
+		if len(t) != ed25519.PublicKeySize {
+			return MalformedRequestError(fmt.Sprintf("Ed25519 key is %d bytes, not %d", len(t), ed25519.PublicKeySize))
+		}
+		return nil
+	default:
+		return GoodKey(key)
+	}
+}
+
+// GoodKeyECDSA determines if an ECDSA pubkey meets our requirements: it must
+// be a valid point on the NIST P-256 or P-384 curve.
 func GoodKeyECDSA(key ecdsa.PublicKey) (err error) {
 	log := blog.GetAuditLogger()
-	err = NotSupportedError("ECDSA keys not yet supported")
-	log.Debug(err.Error())
-	return
+	if key.Curve == nil || key.X == nil || key.Y == nil {
+		err = MalformedRequestError("Key is missing its curve or point")
+		log.Debug(err.Error())
+		return err
+	}
+	switch key.Curve {
+	case elliptic.P256(), elliptic.P384():
+	default:
+		err = MalformedRequestError(fmt.Sprintf("Key curve not allowed: %s", key.Params().Name))
+		log.Debug(err.Error())
+		return err
+	}
+	// SP 800-56A, 5.6.2.3.2: the coordinates must be field elements, and the
+	// point must lie on the curve. Both allowed curves have cofactor 1, so any
+	// such point other than the identity (which has no affine coordinates) has
+	// the full prime order and the remaining order check is unnecessary.
+	p := key.Params().P
+	if key.X.Sign() < 0 || key.X.Cmp(p) >= 0 || key.Y.Sign() < 0 || key.Y.Cmp(p) >= 0 {
+		err = MalformedRequestError("Key point coordinates out of range")
+		log.Debug(err.Error())
+		return err
+	}
+	if !key.Curve.IsOnCurve(key.X, key.Y) {
+		err = MalformedRequestError("Key point is not on the curve")
+		log.Debug(err.Error())
+		return err
+	}
+	return nil
 }
 
 // GoodKeyRSA determines if a RSA pubkey meets our requirements
@@ -7,11 +7,13 @@ package core
 
 import (
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"math/big"
 	"testing"
 
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/crypto/ed25519"
 	"github.com/letsencrypt/boulder/test"
 )
 
@@ -20,10 +22,43 @@ func TestUnknownKeyType(t *testing.T) {
 	test.AssertError(t, GoodKey(notAKey), "Should have rejected a key of unknown type")
 }
 
-func TestWrongKeyType(t *testing.T) {
+func TestEmptyECDSAKey(t *testing.T) {
 	ecdsaKey := ecdsa.PublicKey{}
-	test.AssertError(t, GoodKey(&ecdsaKey), "Should have rejected ECDSA key.")
-	test.AssertError(t, GoodKey(ecdsaKey), "Should have rejected ECDSA key.")
+	test.AssertError(t, GoodKey(&ecdsaKey), "Should have rejected empty ECDSA key.")
+	test.AssertError(t, GoodKey(ecdsaKey), "Should have rejected empty ECDSA key.")
+}
+
+func TestGoodKeyECDSA(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384()} {
+		private, err := ecdsa.GenerateKey(curve, rand.Reader)
+		test.AssertNotError(t, err, "Error generating key")
+		test.AssertNotError(t, GoodKey(&private.PublicKey), "Should have accepted "+curve.Params().Name+" key.")
+		test.AssertNotError(t, GoodKey(private.PublicKey), "Should have accepted "+curve.Params().Name+" key.")
+	}
+}
+
+func TestWrongCurve(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P224(), elliptic.P521()} {
+		private, err := ecdsa.GenerateKey(curve, rand.Reader)
+		test.AssertNotError(t, err, "Error generating key")
+		test.AssertError(t, GoodKey(&private.PublicKey), "Should have rejected "+curve.Params().Name+" key.")
+	}
+}
+
+func TestECDSAPointNotOnCurve(t *testing.T) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Error generating key")
+	key := private.PublicKey
+	key.Y = new(big.Int).Add(key.Y, big.NewInt(1))
+	test.AssertError(t, GoodKey(&key), "Should have rejected point off the curve.")
+
+	key = private.PublicKey
+	key.X = new(big.Int).Add(key.X, key.Params().P)
+	test.AssertError(t, GoodKey(&key), "Should have rejected out of range coordinate.")
+
+	key = private.PublicKey
+	key.X, key.Y = big.NewInt(0), big.NewInt(0)
+	test.AssertError(t, GoodKey(&key), "Should have rejected the point at infinity.")
 }
 
 func TestSmallModulus(t *testing.T) {
@@ -84,3 +119,20 @@ func TestGoodKey(t *testing.T) {
 	test.AssertNotError(t, err, "Error generating key")
 	test.AssertNotError(t, GoodKey(&private.PublicKey), "Should have accepted good key.")
 }
+
+func TestGoodAccountKey(t *testing.T) {
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	test.AssertNotError(t, err, "Error generating key")
+	test.AssertError(t, GoodAccountKey(public, false), "Should have rejected Ed25519 key without the feature")
+	test.AssertNotError(t, GoodAccountKey(public, true), "Should have accepted Ed25519 key")
+	test.AssertError(t, GoodAccountKey(public[:16], true), "Should have rejected truncated Ed25519 key")
+	// Certificate keys are held to GoodKey alone
+	test.AssertError(t, GoodKey(public), "Should have rejected Ed25519 certificate key")
+
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Error generating key")
+	test.AssertNotError(t, GoodAccountKey(&private.PublicKey, false), "Should have accepted P-256 key")
+	private, err = ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	test.AssertNotError(t, err, "Error generating key")
+	test.AssertError(t, GoodAccountKey(&private.PublicKey, true), "Should have rejected P-224 key")
+}
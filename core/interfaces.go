@@ -6,13 +6,15 @@
 package core
 
 import (
+	"context"
 	"crypto/x509"
 	"net"
 	"net/http"
 	"time"
 
-	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
 	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
+	"github.com/letsencrypt/boulder/identifier"
 )
 
 // A WebFrontEnd object supplies methods that can be hooked into
@@ -55,74 +57,142 @@ type WebFrontEnd interface {
 // RegistrationAuthority defines the public interface for the Boulder RA
 type RegistrationAuthority interface {
 	// [WebFrontEnd]
-	NewRegistration(Registration) (Registration, error)
+	NewRegistration(context.Context, Registration) (Registration, error)
 
 	// [WebFrontEnd]
-	NewAuthorization(Authorization, int64) (Authorization, error)
+	NewAuthorization(context.Context, Authorization, int64) (Authorization, error)
 
 	// [WebFrontEnd]
-	NewCertificate(CertificateRequest, int64) (Certificate, error)
+	NewAuthorizations(context.Context, []Authorization, int64) ([]Authorization, error)
 
 	// [WebFrontEnd]
-	UpdateRegistration(Registration, Registration) (Registration, error)
+	NewCertificate(context.Context, CertificateRequest, int64) (Certificate, error)
 
 	// [WebFrontEnd]
-	UpdateAuthorization(Authorization, int, Challenge) (Authorization, error)
+	NewCertificateOrder(context.Context, CertificateRequest, int64) (CertificateOrder, error)
 
 	// [WebFrontEnd]
-	RevokeCertificateWithReg(x509.Certificate, RevocationCode, int64) error
+	UpdateRegistration(context.Context, Registration, Registration) (Registration, error)
+
+	// [WebFrontEnd]
+	UpdateAuthorization(context.Context, Authorization, int, Challenge) (Authorization, error)
+
+	// [WebFrontEnd]
+	RevokeCertificateWithReg(context.Context, x509.Certificate, RevocationCode, int64) error
+
+	// [WebFrontEnd]
+	DeactivateAuthorization(context.Context, Authorization) error
+
+	// [WebFrontEnd]
+	VerifyContact(context.Context, int64, string) error
 
 	// [AdminRevoker]
-	AdministrativelyRevokeCertificate(x509.Certificate, RevocationCode, string) error
+	AdministrativelyRevokeCertificate(context.Context, x509.Certificate, RevocationCode, string) error
+
+	// [AdminRevoker]
+	AdministrativelyReleaseCertificateHold(context.Context, x509.Certificate, string) error
+
+	// [AdminRevoker]
+	AdministrativelyRevokeCertificatesByKey(ctx context.Context, keyHash string, user string) error
+
+	// [AdminRevoker]
+	AdministrativelyBlockKey(ctx context.Context, keyHash string, user string) error
+
+	// [AdminRevoker]
+	AdministrativelyDenyNames(context.Context, []string, string) error
+
+	// [AdminRevoker]
+	AdministrativelySetAccountTier(context.Context, int64, AccountTier, string) error
+
+	// [AdminRevoker]
+	AdministrativelySetRateLimitOverride(context.Context, RateLimitOverride, string) error
+
+	// [AdminRevoker]
+	AdministrativelyRemoveRateLimitOverride(ctx context.Context, limit, key string, regID int64, user string) error
+
+	// [AdminRevoker]
+	AdministrativelyReviewAuthorization(ctx context.Context, authzID string, approve bool, user string) error
 
 	// [ValidationAuthority]
-	OnValidationUpdate(Authorization) error
+	OnValidationUpdate(context.Context, Authorization) error
 }
 
 // CertificateAuthority defines the public interface for the Boulder CA
 type CertificateAuthority interface {
 	// [RegistrationAuthority]
-	IssueCertificate(x509.CertificateRequest, int64) (Certificate, error)
-	RevokeCertificate(string, RevocationCode) error
-	GenerateOCSP(OCSPSigningRequest) ([]byte, error)
+	IssueCertificate(ctx context.Context, csr x509.CertificateRequest, regID int64, profile string, validity Validity) (Certificate, error)
+	RevokeCertificate(context.Context, string, RevocationCode) error
+	GenerateOCSP(context.Context, OCSPSigningRequest) ([]byte, error)
 }
 
 // PolicyAuthority defines the public interface for the Boulder PA
 type PolicyAuthority interface {
-	WillingToIssue(id AcmeIdentifier, regID int64) error
-	ChallengesFor(AcmeIdentifier, *jose.JsonWebKey) ([]Challenge, [][]int, error)
+	WillingToIssue(id identifier.ACMEIdentifier, regID int64) error
+	ChallengesFor(identifier.ACMEIdentifier, *jose.JSONWebKey) ([]Challenge, [][]int, error)
+	HighRisk(identifier.ACMEIdentifier) bool
 }
 
 // StorageGetter are the Boulder SA's read-only methods
 type StorageGetter interface {
-	GetRegistration(int64) (Registration, error)
-	GetRegistrationByKey(jose.JsonWebKey) (Registration, error)
-	GetAuthorization(string) (Authorization, error)
-	GetLatestValidAuthorization(int64, AcmeIdentifier) (Authorization, error)
-	GetCertificate(string) (Certificate, error)
-	GetCertificateStatus(string) (CertificateStatus, error)
-	AlreadyDeniedCSR([]string) (bool, error)
-	CountCertificatesRange(time.Time, time.Time) (int64, error)
-	CountCertificatesByNames([]string, time.Time, time.Time) (map[string]int, error)
-	CountRegistrationsByIP(net.IP, time.Time, time.Time) (int, error)
-	CountPendingAuthorizations(regID int64) (int, error)
-	GetSCTReceipt(string, string) (SignedCertificateTimestamp, error)
+	GetRegistration(context.Context, int64) (Registration, error)
+	GetRegistrationByKey(context.Context, jose.JSONWebKey) (Registration, error)
+	GetAuthorization(context.Context, string) (Authorization, error)
+	GetLatestValidAuthorization(context.Context, int64, identifier.ACMEIdentifier) (Authorization, error)
+	GetAuthorizations(ctx context.Context, regID int64, names []string, now time.Time) (map[string]*Authorization, error)
+	GetReusableAuthorizations(ctx context.Context, regID int64, names []string, now time.Time) (map[string]*Authorization, error)
+	GetCertificate(context.Context, string) (Certificate, error)
+	GetCertificatesByRegistration(ctx context.Context, regID int64, offset, limit int) ([]Certificate, error)
+	GetCertificateStatus(context.Context, string) (CertificateStatus, error)
+	GetCertificateIssuer(ctx context.Context, serial string) (string, error)
+	GetCertificateOrder(ctx context.Context, id string) (CertificateOrder, error)
+	AlreadyDeniedCSR(context.Context, []string) (bool, error)
+	GetSerialsByKeyHash(ctx context.Context, keyHash string) ([]string, error)
+	KeyBlocked(ctx context.Context, keyHash string) (bool, error)
+	GetRateLimitOverrides(context.Context) ([]RateLimitOverride, error)
+	GetPendingReviewAuthorizations(ctx context.Context, now time.Time) ([]Authorization, error)
+	GetCAAChecks(ctx context.Context, names []string) (map[string]time.Time, error)
+	ReplacementIssued(ctx context.Context, serial string) (bool, error)
+	GetValidationTranscripts(ctx context.Context, authzID string) ([][]byte, error)
+	CountCertificatesRange(context.Context, time.Time, time.Time) (int64, error)
+	CountCertificatesByNames(context.Context, []string, time.Time, time.Time) (map[string]int, error)
+	CountFQDNSets(ctx context.Context, names []string, earliest, latest time.Time) (int64, error)
+	FQDNSetExists(ctx context.Context, names []string) (bool, error)
+	CountRegistrationsByIP(context.Context, net.IP, time.Time, time.Time) (int, error)
+	CountPendingAuthorizations(ctx context.Context, regID int64) (int, error)
+	GetSCTReceipt(context.Context, string, string) (SignedCertificateTimestamp, error)
+	GetCTSubmissions(ctx context.Context, serial string) ([]CTSubmission, error)
 }
 
 // StorageAdder are the Boulder SA's write/update methods
 type StorageAdder interface {
-	NewRegistration(Registration) (Registration, error)
-	UpdateRegistration(Registration) error
-
-	NewPendingAuthorization(Authorization) (Authorization, error)
-	UpdatePendingAuthorization(Authorization) error
-	FinalizeAuthorization(Authorization) error
-	MarkCertificateRevoked(serial string, reasonCode RevocationCode) error
-	UpdateOCSP(serial string, ocspResponse []byte) error
-
-	AddCertificate([]byte, int64) (string, error)
-
-	AddSCTReceipt(SignedCertificateTimestamp) error
+	NewRegistration(context.Context, Registration) (Registration, error)
+	UpdateRegistration(context.Context, Registration) error
+
+	NewPendingAuthorization(context.Context, Authorization) (Authorization, error)
+	NewPendingAuthorizations(context.Context, []Authorization) ([]Authorization, error)
+	UpdatePendingAuthorization(context.Context, Authorization) error
+	FinalizeAuthorization(context.Context, Authorization) error
+	DeactivateAuthorization(ctx context.Context, id string) error
+	MarkCertificateRevoked(ctx context.Context, serial string, reasonCode RevocationCode) error
+	ReleaseCertificateHold(ctx context.Context, serial string) error
+	UpdateOCSP(ctx context.Context, serial string, ocspResponse []byte) error
+
+	AddCertificate(context.Context, []byte, int64) (string, error)
+	AddReplacementOrder(ctx context.Context, serial, replacedSerial string) error
+	NewCertificateOrder(context.Context, CertificateOrder, CertificateRequest) (CertificateOrder, error)
+	FinalizeCertificateOrder(context.Context, CertificateOrder) error
+	ClaimCertificateOrders(ctx context.Context, staleBefore, now time.Time, limit int) ([]ClaimedCertificateOrder, error)
+	ReserveIdempotencyKey(ctx context.Context, key IdempotencyKey, staleBefore time.Time) (IdempotencyKey, error)
+	FinalizeIdempotencyKey(context.Context, IdempotencyKey) error
+	AddCAAChecks(ctx context.Context, names []string, checked time.Time) error
+	AddDeniedCSR(ctx context.Context, names []string) error
+	AddBlockedKey(ctx context.Context, keyHash, addedBy string) error
+	SetRateLimitOverride(context.Context, RateLimitOverride) error
+	RemoveRateLimitOverride(ctx context.Context, limit, key string, regID int64) error
+	AddValidationTranscript(ctx context.Context, authzID, challengeType string, signed []byte) error
+
+	RecordCTSubmission(context.Context, CTSubmission) error
+	RecordCTInclusion(ctx context.Context, serial, logID string, status CTInclusionStatus) error
 }
 
 // StorageAuthority interface represents a simple key/value
@@ -141,5 +211,12 @@ type CertificateAuthorityDatabase interface {
 
 // Publisher defines the public interface for the Boulder Publisher
 type Publisher interface {
-	SubmitToCT([]byte) error
+	SubmitToCT(context.Context, []byte) error
+	CheckCTInclusion(context.Context, []byte) error
+}
+
+// NonceRedeemer checks and consumes an anti-replay nonce. It is implemented
+// locally by NonceService and remotely by peer WFE instances over RPC.
+type NonceRedeemer interface {
+	Redeem(nonce string) (bool, error)
 }
@@ -11,7 +11,10 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"math/big"
+	"regexp"
+	"strings"
 	"sync"
 )
 
@@ -20,10 +23,22 @@ import (
 const MaxUsed = 65536
 const nonceLen = 32
 
+// encodedNonceLen is the length of the encrypted portion of a nonce once it has
+// been base64url encoded. Anything before it is the issuing instance's prefix.
+const encodedNonceLen = (nonceLen*8 + 5) / 6
+
 var errInvalidNonceLength = errors.New("invalid nonce length")
+var errWrongNoncePrefix = errors.New("nonce was issued by another instance")
+
+var noncePrefixFormat = regexp.MustCompile("^[\\w-]*$")
 
 // NonceService generates, cancels, and tracks Nonces.
+//
+// Nonces produced by a NonceService carry the service's prefix, which lets a
+// group of WFE instances behind a load balancer route a nonce back to the
+// instance that issued it for redemption.
 type NonceService struct {
+	prefix   string
 	mu       sync.Mutex
 	latest   int64
 	earliest int64
@@ -34,6 +49,16 @@ type NonceService struct {
 
 // NewNonceService constructs a NonceService with defaults
 func NewNonceService() (*NonceService, error) {
+	return NewPrefixedNonceService("")
+}
+
+// NewPrefixedNonceService constructs a NonceService whose nonces all begin
+// with the given prefix. The prefix must use the URL-safe base64 alphabet.
+func NewPrefixedNonceService(prefix string) (*NonceService, error) {
+	if !noncePrefixFormat.MatchString(prefix) {
+		return nil, fmt.Errorf("Invalid nonce prefix %q", prefix)
+	}
+
 	key := make([]byte, 16)
 	if _, err := rand.Read(key); err != nil {
 		return nil, err
@@ -49,6 +74,7 @@ func NewNonceService() (*NonceService, error) {
 	}
 
 	return &NonceService{
+		prefix:   prefix,
 		earliest: 0,
 		latest:   0,
 		used:     make(map[int64]bool, MaxUsed),
@@ -78,10 +104,14 @@ func (ns *NonceService) encrypt(counter int64) (string, error) {
 	ct := ns.gcm.Seal(nil, nonce, pt, nil)
 	copy(ret, nonce[4:])
 	copy(ret[8:], ct)
-	return base64.RawURLEncoding.EncodeToString(ret), nil
+	return ns.prefix + base64.RawURLEncoding.EncodeToString(ret), nil
 }
 
 func (ns *NonceService) decrypt(nonce string) (int64, error) {
+	if !strings.HasPrefix(nonce, ns.prefix) {
+		return 0, errWrongNoncePrefix
+	}
+	nonce = nonce[len(ns.prefix):]
 	decoded, err := base64.RawURLEncoding.DecodeString(nonce)
 	if err != nil {
 		return 0, err
@@ -106,6 +136,20 @@ func (ns *NonceService) decrypt(nonce string) (int64, error) {
 	return ctr.Int64(), nil
 }
 
+// Prefix returns the prefix attached to every nonce issued by this service.
+func (ns *NonceService) Prefix() string {
+	return ns.prefix
+}
+
+// NoncePrefix extracts the issuing instance's prefix from a nonce. It returns
+// false if the nonce is too short to contain an encrypted counter.
+func NoncePrefix(nonce string) (string, bool) {
+	if len(nonce) < encodedNonceLen {
+		return "", false
+	}
+	return nonce[:len(nonce)-encodedNonceLen], true
+}
+
 // Nonce provides a new Nonce.
 func (ns *NonceService) Nonce() (string, error) {
 	ns.mu.Lock()
@@ -157,3 +201,9 @@ func (ns *NonceService) Valid(nonce string) bool {
 
 	return true
 }
+
+// Redeem implements NonceRedeemer for the local service, so that a
+// NonceService can be exposed to peer instances over RPC.
+func (ns *NonceService) Redeem(nonce string) (bool, error) {
+	return ns.Valid(nonce), nil
+}
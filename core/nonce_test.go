@@ -83,3 +83,38 @@ func TestRejectTooEarly(t *testing.T) {
 	test.Assert(t, ns.Valid(n1), "Rejected a valid nonce")
 	test.Assert(t, !ns.Valid(n0), "Accepted a nonce that we should have forgotten")
 }
+
+func TestPrefixedNonce(t *testing.T) {
+	ns, err := NewPrefixedNonceService("wfe1")
+	test.AssertNotError(t, err, "Could not create nonce service")
+	n, err := ns.Nonce()
+	test.AssertNotError(t, err, "Could not create nonce")
+	prefix, ok := NoncePrefix(n)
+	test.Assert(t, ok, "Could not extract prefix from nonce")
+	test.AssertEquals(t, prefix, "wfe1")
+	test.Assert(t, ns.Valid(n), "Did not recognize fresh prefixed nonce")
+
+	valid, err := ns.Redeem(n)
+	test.AssertNotError(t, err, "Redeem failed")
+	test.Assert(t, !valid, "Redeemed the same nonce twice")
+}
+
+func TestRejectWrongPrefix(t *testing.T) {
+	ns1, err := NewPrefixedNonceService("wfe1")
+	test.AssertNotError(t, err, "Could not create nonce service")
+	ns2, err := NewPrefixedNonceService("wfe2")
+	test.AssertNotError(t, err, "Could not create nonce service")
+
+	n, err := ns1.Nonce()
+	test.AssertNotError(t, err, "Could not create nonce")
+	test.Assert(t, !ns2.Valid(n), "Accepted a nonce with another instance's prefix")
+	test.Assert(t, !ns2.Valid("wfe2"+n[len("wfe1"):]), "Accepted a nonce with a forged prefix")
+}
+
+func TestRejectBadPrefix(t *testing.T) {
+	_, err := NewPrefixedNonceService("wfe/1")
+	test.AssertError(t, err, "Accepted a prefix outside the base64url alphabet")
+
+	_, ok := NoncePrefix("short")
+	test.Assert(t, !ok, "Extracted a prefix from a too-short nonce")
+}
@@ -6,9 +6,9 @@
 package core
 
 import (
-	"crypto"
-	"crypto/subtle"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/base32"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -16,7 +16,8 @@ import (
 	"strings"
 	"time"
 
-	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
+	"github.com/letsencrypt/boulder/identifier"
 	"github.com/letsencrypt/boulder/probs"
 )
 
@@ -29,25 +30,29 @@ type AcmeResource string
 // Buffer is a variable-length collection of bytes
 type Buffer []byte
 
-// IdentifierType defines the available identification mechanisms for domains
-type IdentifierType string
-
 // OCSPStatus defines the state of OCSP for a domain
 type OCSPStatus string
 
 // These statuses are the states of authorizations
 const (
-	StatusUnknown    = AcmeStatus("unknown")    // Unknown status; the default
-	StatusPending    = AcmeStatus("pending")    // In process; client has next action
-	StatusProcessing = AcmeStatus("processing") // In process; server has next action
-	StatusValid      = AcmeStatus("valid")      // Validation succeeded
-	StatusInvalid    = AcmeStatus("invalid")    // Validation failed
-	StatusRevoked    = AcmeStatus("revoked")    // Object no longer valid
+	StatusUnknown     = AcmeStatus("unknown")     // Unknown status; the default
+	StatusPending     = AcmeStatus("pending")     // In process; client has next action
+	StatusProcessing  = AcmeStatus("processing")  // In process; server has next action
+	StatusValid       = AcmeStatus("valid")       // Validation succeeded
+	StatusInvalid     = AcmeStatus("invalid")     // Validation failed
+	StatusRevoked     = AcmeStatus("revoked")     // Object no longer valid
+	StatusDeactivated = AcmeStatus("deactivated") // Object deactivated by its owner
+
+	// StatusPendingReview is of an authorization that passed validation but
+	// is for a high-risk identifier, so is held until an operator approves
+	// or rejects it
+	StatusPendingReview = AcmeStatus("pending-review")
 )
 
 // These types are the available identification mechanisms
 const (
-	IdentifierDNS = IdentifierType("dns")
+	IdentifierDNS   = identifier.DNS
+	IdentifierEmail = identifier.Email
 )
 
 // The types of ACME resources
@@ -56,8 +61,10 @@ const (
 	ResourceNewAuthz     = AcmeResource("new-authz")
 	ResourceNewCert      = AcmeResource("new-cert")
 	ResourceRevokeCert   = AcmeResource("revoke-cert")
+	ResourceFetchCert    = AcmeResource("fetch-cert")
 	ResourceRegistration = AcmeResource("reg")
 	ResourceChallenge    = AcmeResource("challenge")
+	ResourceAuthz        = AcmeResource("authz")
 )
 
 // These status are the states of OCSP
@@ -71,21 +78,22 @@ const (
 	ChallengeTypeHTTP01   = "http-01"
 	ChallengeTypeTLSSNI01 = "tls-sni-01"
 	ChallengeTypeDNS01    = "dns-01"
+	// ChallengeTypeDNSAccount01 is an experimental dns-01 whose TXT record
+	// is under a label scoped to the account, so that several accounts,
+	// e.g. of one operator's regions, can validate a name through CNAMEs
+	// without sharing a record. See DNSAccountLabel.
+	ChallengeTypeDNSAccount01 = "dns-account-01"
+	// ChallengeTypeEmailReply00 validates email identifiers. Half of the
+	// token is mailed to the address, and the response prefixes the
+	// challenge's token with it.
+	ChallengeTypeEmailReply00 = "email-reply-00"
 )
 
-// ValidChallenge tests whether the provided string names a known challenge
+// ValidChallenge tests whether the provided string names a registered
+// challenge type
 func ValidChallenge(name string) bool {
-	switch name {
-	case ChallengeTypeHTTP01:
-		fallthrough
-	case ChallengeTypeTLSSNI01:
-		fallthrough
-	case ChallengeTypeDNS01:
-		return true
-
-	default:
-		return false
-	}
+	_, ok := LookupChallengeType(name)
+	return ok
 }
 
 // TLSSNISuffix is appended to pseudo-domain names in DVSNI challenges
@@ -94,14 +102,12 @@ const TLSSNISuffix = "acme.invalid"
 // DNSPrefix is attached to DNS names in DNS challenges
 const DNSPrefix = "_acme-challenge"
 
-// An AcmeIdentifier encodes an identifier that can
-// be validated by ACME.  The protocol allows for different
-// types of identifier to be supported (DNS names, IP
-// addresses, etc.), but currently we only support
-// domain names.
-type AcmeIdentifier struct {
-	Type  IdentifierType `json:"type"`  // The type of identifier being encoded
-	Value string         `json:"value"` // The identifier itself
+// DNSAccountLabel is the label that precedes DNSPrefix in dns-account-01
+// challenges for the account at accountURI: an underscore and the first 10
+// characters of the lowercased base32 SHA-256 digest of the URI.
+func DNSAccountLabel(accountURI string) string {
+	digest := sha256.Sum256([]byte(accountURI))
+	return "_" + strings.ToLower(base32.StdEncoding.EncodeToString(digest[:])[:10])
 }
 
 // CertificateRequest is just a CSR
@@ -111,10 +117,46 @@ type AcmeIdentifier struct {
 type CertificateRequest struct {
 	CSR   *x509.CertificateRequest // The CSR
 	Bytes []byte                   // The original bytes of the CSR, for logging.
+
+	// Profile names the certificate profile the client selected. Empty means
+	// the CA's default profile.
+	Profile string
+
+	// Replaces is the serial of an earlier certificate the requested one
+	// renews, if any.
+	Replaces string
+
+	// IdempotencyKey is a token chosen by the client so that retrying the
+	// request, with the same CSR, returns the certificate already issued
+	// for it rather than issuing another. Empty means every request issues.
+	// Certificate orders, which clients poll rather than retry, ignore it.
+	IdempotencyKey string
+
+	// Validity is the validity period the client asked for, which only a
+	// private CA grants.
+	Validity Validity
+}
+
+// Validity is the validity period a certificate request asks for in place
+// of its profile's. A zero NotBefore means the time of issuance, and a zero
+// NotAfter the profile's lifetime after NotBefore.
+type Validity struct {
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// IsZero returns whether v leaves the validity period to the profile.
+func (v Validity) IsZero() bool {
+	return v.NotBefore.IsZero() && v.NotAfter.IsZero()
 }
 
 type rawCertificateRequest struct {
-	CSR JSONBuffer `json:"csr"` // The encoded CSR
+	CSR            JSONBuffer `json:"csr"` // The encoded CSR
+	Profile        string     `json:"profile,omitempty"`
+	Replaces       string     `json:"replaces,omitempty"`
+	IdempotencyKey string     `json:"idempotencyKey,omitempty"`
+	NotBefore      *time.Time `json:"notBefore,omitempty"`
+	NotAfter       *time.Time `json:"notAfter,omitempty"`
 }
 
 // UnmarshalJSON provides an implementation for decoding CertificateRequest objects.
@@ -131,14 +173,33 @@ func (cr *CertificateRequest) UnmarshalJSON(data []byte) error {
 
 	cr.CSR = csr
 	cr.Bytes = raw.CSR
+	cr.Profile = raw.Profile
+	cr.Replaces = raw.Replaces
+	cr.IdempotencyKey = raw.IdempotencyKey
+	if raw.NotBefore != nil {
+		cr.Validity.NotBefore = *raw.NotBefore
+	}
+	if raw.NotAfter != nil {
+		cr.Validity.NotAfter = *raw.NotAfter
+	}
 	return nil
 }
 
 // MarshalJSON provides an implementation for encoding CertificateRequest objects.
 func (cr CertificateRequest) MarshalJSON() ([]byte, error) {
-	return json.Marshal(rawCertificateRequest{
-		CSR: cr.CSR.Raw,
-	})
+	raw := rawCertificateRequest{
+		CSR:            cr.CSR.Raw,
+		Profile:        cr.Profile,
+		Replaces:       cr.Replaces,
+		IdempotencyKey: cr.IdempotencyKey,
+	}
+	if !cr.Validity.NotBefore.IsZero() {
+		raw.NotBefore = &cr.Validity.NotBefore
+	}
+	if !cr.Validity.NotAfter.IsZero() {
+		raw.NotAfter = &cr.Validity.NotAfter
+	}
+	return json.Marshal(raw)
 }
 
 // Registration objects represent non-public metadata attached
@@ -148,11 +209,15 @@ type Registration struct {
 	ID int64 `json:"id" db:"id"`
 
 	// Account key to which the details are attached
-	Key jose.JsonWebKey `json:"key"`
+	Key jose.JSONWebKey `json:"key"`
 
 	// Contact URIs
 	Contact []*AcmeURL `json:"contact,omitempty"`
 
+	// The contacts that have followed a verification link, when contact
+	// verification is enabled. Not updatable by the end user.
+	VerifiedContacts []*AcmeURL `json:"verifiedContacts,omitempty"`
+
 	// Agreement with terms of service
 	Agreement string `json:"agreement,omitempty"`
 
@@ -161,6 +226,39 @@ type Registration struct {
 
 	// CreatedAt is the time the registration was created.
 	CreatedAt time.Time `json:"createdAt"`
+
+	// Orders is the URL at which the registration's orders are listed. It
+	// is filled in by the WFE and not stored.
+	Orders string `json:"orders,omitempty"`
+
+	// Tier is the account tier the registration is in, empty meaning
+	// TierDefault. Not updatable by the end user; only administrators set
+	// it.
+	Tier AccountTier `json:"tier,omitempty"`
+}
+
+// AccountTier groups registrations that get their own authorization
+// lifetimes and pending authorization limits, such as large integrators
+// whose DNS changes are slow to propagate.
+type AccountTier string
+
+// These are the account tiers.
+const (
+	TierDefault           = AccountTier("default")
+	TierTrustedIntegrator = AccountTier("trusted-integrator")
+)
+
+// Known returns whether t is one of the account tiers.
+func (t AccountTier) Known() bool {
+	return t == TierDefault || t == TierTrustedIntegrator
+}
+
+// EffectiveTier returns the account tier the registration is in.
+func (r Registration) EffectiveTier() AccountTier {
+	if r.Tier == "" {
+		return TierDefault
+	}
+	return r.Tier
 }
 
 // MergeUpdate copies a subset of information from the input Registration
@@ -186,6 +284,19 @@ type ValidationRecord struct {
 	Port              string   `json:"port"`
 	AddressesResolved []net.IP `json:"addressesResolved"`
 	AddressUsed       net.IP   `json:"addressUsed"`
+
+	// SimpleHTTP only. Set if the request was answered with 403 Forbidden,
+	// which usually means a firewall or WAF blocked the validation request.
+	Forbidden bool `json:"forbidden,omitempty"`
+
+	// SimpleHTTP only. The start of the response body, sanitized, if it
+	// didn't hold the expected key authorization.
+	ResponseBody string `json:"responseBody,omitempty"`
+
+	// Set when the validation was retried: Attempt numbers the attempt the
+	// record belongs to, from 1, and Error is why it failed, if it did.
+	Attempt int                   `json:"attempt,omitempty"`
+	Error   *probs.ProblemDetails `json:"error,omitempty"`
 }
 
 // KeyAuthorization represents a domain holder's authorization for a
@@ -196,19 +307,19 @@ type KeyAuthorization struct {
 }
 
 // NewKeyAuthorization computes the thumbprint and assembles the object
-func NewKeyAuthorization(token string, key *jose.JsonWebKey) (KeyAuthorization, error) {
+func NewKeyAuthorization(token string, key *jose.JSONWebKey) (KeyAuthorization, error) {
 	if key == nil {
 		return KeyAuthorization{}, fmt.Errorf("Cannot authorize a nil key")
 	}
 
-	thumbprint, err := key.Thumbprint(crypto.SHA256)
+	thumbprint, err := KeyThumbprint(key)
 	if err != nil {
 		return KeyAuthorization{}, err
 	}
 
 	return KeyAuthorization{
 		Token:      token,
-		Thumbprint: base64.RawURLEncoding.EncodeToString(thumbprint),
+		Thumbprint: thumbprint,
 	}, nil
 }
 
@@ -218,12 +329,10 @@ func NewKeyAuthorizationFromString(input string) (ka KeyAuthorization, err error
 	if len(parts) != 2 {
 		err = fmt.Errorf("Invalid key authorization: %d parts", len(parts))
 		return
-	} else if !LooksLikeAToken(parts[0]) {
+	} else if !LooksLikeAToken(parts[0]) && !LooksLikeATokenPair(parts[0]) {
 		err = fmt.Errorf("Invalid key authorization: malformed token")
 		return
-	} else if !LooksLikeAToken(parts[1]) {
-		// Thumbprints have the same syntax as tokens in boulder
-		// Both are base64-encoded and 32 octets
+	} else if !LooksLikeAThumbprint(parts[1]) {
 		err = fmt.Errorf("Invalid key authorization: malformed key thumbprint")
 		return
 	}
@@ -241,21 +350,20 @@ func (ka KeyAuthorization) String() string {
 }
 
 // Match determines whether this KeyAuthorization matches the given token and key
-func (ka KeyAuthorization) Match(token string, key *jose.JsonWebKey) bool {
+func (ka KeyAuthorization) Match(token string, key *jose.JSONWebKey) bool {
 	if key == nil {
 		return false
 	}
 
-	thumbprintBytes, err := key.Thumbprint(crypto.SHA256)
+	thumbprint, err := KeyThumbprint(key)
 	if err != nil {
 		return false
 	}
-	thumbprint := base64.RawURLEncoding.EncodeToString(thumbprintBytes)
 
-	tokensEqual := subtle.ConstantTimeCompare([]byte(token), []byte(ka.Token))
-	thumbprintsEqual := subtle.ConstantTimeCompare([]byte(thumbprint), []byte(ka.Thumbprint))
+	tokensEqual := ConstantTimeEquals(token, ka.Token)
+	thumbprintsEqual := ConstantTimeEquals(thumbprint, ka.Thumbprint)
 
-	return tokensEqual == 1 && thumbprintsEqual == 1
+	return tokensEqual && thumbprintsEqual
 }
 
 // MarshalJSON packs a key authorization into its string representation
@@ -322,42 +430,24 @@ type Challenge struct {
 	// to prevent an attacker from re-using a validation signature with a different,
 	// unauthorized key. See:
 	//   https://mailarchive.ietf.org/arch/msg/acme/F71iz6qq1o_QPVhJCV4dqWf-4Yc
-	AccountKey *jose.JsonWebKey `json:"accountKey,omitempty"`
+	AccountKey *jose.JSONWebKey `json:"accountKey,omitempty"`
 }
 
 // RecordsSane checks the sanity of a ValidationRecord object before sending it
 // back to the RA to be stored.
 func (ch Challenge) RecordsSane() bool {
-	if ch.Type != ChallengeTypeDNS01 && (ch.ValidationRecord == nil || len(ch.ValidationRecord) == 0) {
-		return false
-	}
-
-	switch ch.Type {
-	case ChallengeTypeHTTP01:
-		for _, rec := range ch.ValidationRecord {
-			if rec.URL == "" || rec.Hostname == "" || rec.Port == "" || rec.AddressUsed == nil ||
-				len(rec.AddressesResolved) == 0 {
-				return false
-			}
-		}
-	case ChallengeTypeTLSSNI01:
-		if len(ch.ValidationRecord) > 1 {
-			return false
-		}
-		if ch.ValidationRecord[0].URL != "" {
-			return false
+	// Only the records of the attempt that succeeded need be complete
+	var records []ValidationRecord
+	for _, rec := range ch.ValidationRecord {
+		if rec.Error == nil {
+			records = append(records, rec)
 		}
-		if ch.ValidationRecord[0].Hostname == "" || ch.ValidationRecord[0].Port == "" ||
-			ch.ValidationRecord[0].AddressUsed == nil || len(ch.ValidationRecord[0].AddressesResolved) == 0 {
-			return false
-		}
-	case ChallengeTypeDNS01:
-		return true
-	default: // Unsupported challenge type
+	}
+	ct, ok := LookupChallengeType(ch.Type)
+	if !ok { // Unsupported challenge type
 		return false
 	}
-
-	return true
+	return ct.RecordsSane(records)
 }
 
 // IsSane checks the sanity of a challenge object before issued to the client
@@ -384,7 +474,14 @@ func (ch Challenge) IsSane(completed bool) bool {
 			return false
 		}
 
-		if !ch.KeyAuthorization.Match(ch.Token, ch.AccountKey) {
+		token := ch.Token
+		if ct, ok := LookupChallengeType(ch.Type); ok {
+			token, ok = ct.ResponseToken(ch)
+			if !ok {
+				return false
+			}
+		}
+		if !ch.KeyAuthorization.Match(token, ch.AccountKey) {
 			return false
 		}
 	}
@@ -402,7 +499,7 @@ type Authorization struct {
 	ID string `json:"id,omitempty" db:"id"`
 
 	// The identifier for which authorization is being given
-	Identifier AcmeIdentifier `json:"identifier,omitempty" db:"identifier"`
+	Identifier identifier.ACMEIdentifier `json:"identifier,omitempty" db:"identifier"`
 
 	// The registration ID associated with the authorization
 	RegistrationID int64 `json:"regId,omitempty" db:"registrationID"`
@@ -441,6 +538,30 @@ func (authz *Authorization) FindChallenge(challengeID int64) int {
 	return -1
 }
 
+// RespondedCombination returns the first of the authorization's combinations
+// that includes the challenge at index and whose other challenges have all
+// been responded to and are still pending, or nil if there is none. The
+// challenges of such a combination can be validated together.
+func (authz *Authorization) RespondedCombination(index int) []int {
+	for _, combo := range authz.Combinations {
+		included, responded := false, true
+		for _, i := range combo {
+			if i == index {
+				included = true
+				continue
+			}
+			if i < 0 || i >= len(authz.Challenges) ||
+				authz.Challenges[i].Status != StatusPending || authz.Challenges[i].KeyAuthorization == nil {
+				responded = false
+			}
+		}
+		if included && responded {
+			return combo
+		}
+	}
+	return nil
+}
+
 // JSONBuffer fields get encoded and decoded JOSE-style, in base64url encoding
 // with stripped padding.
 type JSONBuffer []byte
@@ -486,6 +607,45 @@ type Certificate struct {
 	Expires time.Time `db:"expires"`
 }
 
+// CertificateOrder is a certificate request the RA accepted to complete in
+// the background. It's StatusProcessing until the certificate is issued,
+// when it's StatusValid and has the certificate's Serial, or issuance fails,
+// when it's StatusInvalid and Error says why. An order still processing
+// when it Expires is failed.
+type CertificateOrder struct {
+	ID             string                `json:"id"`
+	RegistrationID int64                 `json:"registrationID"`
+	Status         AcmeStatus            `json:"status"`
+	Serial         string                `json:"serial,omitempty"`
+	Error          *probs.ProblemDetails `json:"error,omitempty"`
+	Created        time.Time             `json:"created"`
+	Expires        time.Time             `json:"expires"`
+}
+
+// ClaimedCertificateOrder is a processing certificate order claimed to be
+// resumed, with the request it's to issue a certificate for, and how many
+// times its processing has been begun, counting this one. Request is nil
+// for orders whose requests weren't stored.
+type ClaimedCertificateOrder struct {
+	Order    CertificateOrder    `json:"order"`
+	Request  *CertificateRequest `json:"request,omitempty"`
+	Attempts int                 `json:"attempts"`
+}
+
+// IdempotencyKey records a certificate request made with an idempotency
+// key by a registration: Digest is the hex SHA-256 digest of the request
+// and the key. Until the certificate is issued, Serial is empty and
+// RequestID identifies the request issuing it. From Expires, the key is
+// forgotten and a request repeating it issues anew.
+type IdempotencyKey struct {
+	RegistrationID int64     `db:"registrationID"`
+	Digest         string    `db:"digest"`
+	RequestID      string    `db:"requestID"`
+	Serial         string    `db:"serial"`
+	Created        time.Time `db:"created"`
+	Expires        time.Time `db:"expires"`
+}
+
 // IdentifierData holds information about what certificates are known for a
 // given identifier. This is used to present Proof of Posession challenges in
 // the case where a certificate already exists. The DB table holding
@@ -542,6 +702,10 @@ type CertificateStatus struct {
 	// The encoded and signed OCSP response.
 	OCSPResponse []byte `db:"ocspResponse"`
 
+	// isShortLived: true for short-lived certificates, which get no OCSP
+	//   responses.
+	IsShortLived bool `db:"isShortLived"`
+
 	LockCol int64 `json:"-"`
 }
 
@@ -583,6 +747,22 @@ type DeniedCSR struct {
 	Names string `db:"names"`
 }
 
+// RateLimitOverride sets the threshold of the rate limit named Limit (e.g.
+// "certificatesPerName") for a key (e.g. a base domain), a registration,
+// or a registration on a key, in place of any configured override. It is
+// either an absolute Threshold, which may be Unlimited (-1), or, if
+// Multiplier is set, a multiple of the limit's default threshold.
+type RateLimitOverride struct {
+	ID             int64     `db:"id"`
+	Limit          string    `db:"limitName"`
+	Key            string    `db:"limitKey"`
+	RegistrationID int64     `db:"registrationID"`
+	Threshold      int       `db:"threshold"`
+	Multiplier     float64   `db:"multiplier"`
+	Created        time.Time `db:"created"`
+	CreatedBy      string    `db:"createdBy"`
+}
+
 // OCSPSigningRequest is a transfer object representing an OCSP Signing Request
 type OCSPSigningRequest struct {
 	CertDER   []byte
@@ -613,9 +793,83 @@ type SignedCertificateTimestamp struct {
 	LockCol int64
 }
 
+// CTSubmissionStatus is how far the submission of a certificate to a CT log
+// has got.
+type CTSubmissionStatus string
+
+// CTInclusionStatus is whether a CT log has been seen to include a
+// certificate it issued an SCT for.
+type CTInclusionStatus string
+
+// These are the CTSubmissionStatus and CTInclusionStatus values.
+const (
+	// CTSubmissionPending submissions haven't yet got an SCT; LastError
+	// says why the last attempt failed.
+	CTSubmissionPending = CTSubmissionStatus("pending")
+	// CTSubmissionSubmitted submissions got an SCT.
+	CTSubmissionSubmitted = CTSubmissionStatus("submitted")
+
+	// CTInclusionUnverified SCTs haven't yet been checked against a tree
+	// head the log signed after their timestamp.
+	CTInclusionUnverified = CTInclusionStatus("unverified")
+	// CTInclusionVerified SCTs' certificates have an inclusion proof.
+	CTInclusionVerified = CTInclusionStatus("verified")
+	// CTInclusionMissing SCTs' certificates aren't in a tree the log signed
+	// after its maximum merge delay, as it promised they would be.
+	CTInclusionMissing = CTInclusionStatus("missing")
+)
+
+// CTSubmission records the submission of a certificate to one CT log: how
+// many attempts were made, and how the last one failed, until an SCT is
+// obtained, and then the SCT and whether the log has been seen to include
+// the certificate.
+type CTSubmission struct {
+	ID                int64              `db:"id"`
+	CertificateSerial string             `db:"certificateSerial"`
+	LogID             string             `db:"logID"`
+	Status            CTSubmissionStatus `db:"status"`
+	Attempts          int                `db:"attempts"`
+	LastAttempt       time.Time          `db:"lastAttempt"`
+	LastError         string             `db:"lastError"`
+
+	// The SCT, once Status is CTSubmissionSubmitted
+	SCTVersion uint8  `db:"sctVersion"`
+	Timestamp  uint64 `db:"timestamp"`
+	Extensions []byte `db:"extensions"`
+	Signature  []byte `db:"signature"`
+
+	InclusionStatus CTInclusionStatus `db:"inclusionStatus"`
+
+	LockCol int64
+}
+
+// SCT returns the SCT of a submission that got one.
+func (s CTSubmission) SCT() SignedCertificateTimestamp {
+	return SignedCertificateTimestamp{
+		SCTVersion:        s.SCTVersion,
+		LogID:             s.LogID,
+		Timestamp:         s.Timestamp,
+		Extensions:        s.Extensions,
+		Signature:         s.Signature,
+		CertificateSerial: s.CertificateSerial,
+	}
+}
+
 // RevocationCode is used to specify a certificate revocation reason
 type RevocationCode int
 
+const (
+	// RevocationKeyCompromise is given for certificates whose key is known
+	// to be compromised.
+	RevocationKeyCompromise = RevocationCode(1)
+	// RevocationCertificateHold suspends a certificate, which may later be
+	// released. Only a private CA accepts it.
+	RevocationCertificateHold = RevocationCode(6)
+	// RevocationRemoveFromCRL is not a revocation reason: it is recorded
+	// when a held certificate is released.
+	RevocationRemoveFromCRL = RevocationCode(8)
+)
+
 // RevocationReasons provides a map from reason code to string explaining the
 // code
 var RevocationReasons = map[RevocationCode]string{
@@ -627,7 +881,17 @@ var RevocationReasons = map[RevocationCode]string{
 	5: "cessationOfOperation",
 	6: "certificateHold",
 	// 7 is unused
-	8:  "removeFromCRL", // needed?
+	8:  "removeFromCRL",
 	9:  "privilegeWithdrawn",
 	10: "aAcompromise",
 }
+
+// AdminRevocationReasons are the reasons only given for revocations made by
+// the CA's operators, since a subscriber can't know them to be true or
+// shouldn't be able to undo them.
+var AdminRevocationReasons = map[RevocationCode]bool{
+	2:                         true, // cACompromise
+	RevocationCertificateHold: true,
+	9:                         true, // privilegeWithdrawn
+	10:                        true, // aAcompromise
+}
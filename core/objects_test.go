@@ -12,8 +12,9 @@ import (
 	"net"
 	"testing"
 
-	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
 
+	"github.com/letsencrypt/boulder/probs"
 	"github.com/letsencrypt/boulder/test"
 )
 
@@ -39,8 +40,8 @@ var testKey1, _ = rsa.GenerateKey(rand.Reader, 2048)
 var testKey2, _ = rsa.GenerateKey(rand.Reader, 2048)
 
 func TestKeyAuthorization(t *testing.T) {
-	jwk1 := &jose.JsonWebKey{Key: testKey1.Public()}
-	jwk2 := &jose.JsonWebKey{Key: testKey2.Public()}
+	jwk1 := &jose.JSONWebKey{Key: testKey1.Public()}
+	jwk2 := &jose.JSONWebKey{Key: testKey2.Public()}
 
 	ka1, err := NewKeyAuthorization("99DrlWuy-4Nc82olAy0cK7Shnm4uV32pJovyucGEWME", jwk1)
 	test.AssertNotError(t, err, "Failed to create a new key authorization")
@@ -53,6 +54,22 @@ func TestKeyAuthorization(t *testing.T) {
 	test.Assert(t, !ka1.Match(ka2.Token, jwk2), "Authorized key should not match a completely different key")
 }
 
+func TestKeyAuthorizationEd25519(t *testing.T) {
+	// The key and thumbprint from RFC 8037, appendix A.3
+	var jwk jose.JSONWebKey
+	err := json.Unmarshal([]byte(`{"kty":"OKP","crv":"Ed25519","x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}`), &jwk)
+	test.AssertNotError(t, err, "Failed to unmarshal Ed25519 JWK")
+
+	ka, err := NewKeyAuthorization("99DrlWuy-4Nc82olAy0cK7Shnm4uV32pJovyucGEWME", &jwk)
+	test.AssertNotError(t, err, "Failed to create a new key authorization")
+	test.AssertEquals(t, ka.Thumbprint, "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k")
+	test.Assert(t, ka.Match(ka.Token, &jwk), "Authorized key should match itself")
+
+	encoded, err := json.Marshal(jwk)
+	test.AssertNotError(t, err, "Failed to marshal Ed25519 JWK")
+	test.AssertEquals(t, string(encoded), `{"kty":"OKP","crv":"Ed25519","x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}`)
+}
+
 func TestRecordSanityCheckOnUnsupportChallengeType(t *testing.T) {
 	rec := []ValidationRecord{
 		ValidationRecord{
@@ -68,9 +85,37 @@ func TestRecordSanityCheckOnUnsupportChallengeType(t *testing.T) {
 	test.Assert(t, !chall.RecordsSane(), "Record with unsupported challenge type should not be sane")
 }
 
+func TestRecordSanityCheckWithRetries(t *testing.T) {
+	good := ValidationRecord{
+		URL:               "http://localhost/test",
+		Hostname:          "localhost",
+		Port:              "80",
+		AddressesResolved: []net.IP{net.IP{127, 0, 0, 1}},
+		AddressUsed:       net.IP{127, 0, 0, 1},
+		Attempt:           2,
+	}
+	// A first attempt that failed before resolving the host
+	failed := ValidationRecord{
+		URL:      "http://localhost/test",
+		Hostname: "localhost",
+		Port:     "80",
+		Attempt:  1,
+		Error:    &probs.ProblemDetails{Type: probs.ConnectionProblem, Detail: "DNS query timed out"},
+	}
+
+	chall := Challenge{Type: ChallengeTypeHTTP01, ValidationRecord: []ValidationRecord{failed, good}}
+	test.Assert(t, chall.RecordsSane(), "Records of failed attempts should be ignored")
+	chall.ValidationRecord = []ValidationRecord{failed}
+	test.Assert(t, !chall.RecordsSane(), "Records of failed attempts alone should not be sane")
+
+	good.URL = ""
+	chall = Challenge{Type: ChallengeTypeTLSSNI01, ValidationRecord: []ValidationRecord{failed, good}}
+	test.Assert(t, chall.RecordsSane(), "Records of failed attempts should be ignored")
+}
+
 func TestChallengeSanityCheck(t *testing.T) {
 	// Make a temporary account key
-	var accountKey *jose.JsonWebKey
+	var accountKey *jose.JSONWebKey
 	err := json.Unmarshal([]byte(`{
     "kty":"RSA",
     "n":"yNWVhtYEKJR21y9xsHV-PD_bYwbXSeNuFal46xYxVfRL5mqha7vttvjB_vc7Xg2RvgCxHPCqoxgMPTzHrZT75LjCwIW2K_klBYN8oYvTwwmeSkAz6ut7ZxPv-nZaT5TJhGk0NT2kh_zSpdriEJ_3vW-mqxYbbBmpvHqsa1_zx9fSuHYctAZJWzxzUZXykbWMWQZpEiE0J4ajj51fInEzVn7VxV-mzfMyboQjujPh7aNJxAWSq4oQEJJDgWwSh9leyoJoPpONHxh5nEE5AjE01FkGICSxjpZsF-w8hOTI3XXohUdu29Se26k2B0PolDSuj0GIQU6-W9TdLXSjBb2SpQ",
@@ -81,7 +126,7 @@ func TestChallengeSanityCheck(t *testing.T) {
 	ka, err := NewKeyAuthorization("KQqLsiS5j0CONR_eUXTUSUDNVaHODtc-0pD6ACif7U4", accountKey)
 	test.AssertNotError(t, err, "Error creating key authorization")
 
-	types := []string{ChallengeTypeHTTP01, ChallengeTypeTLSSNI01, ChallengeTypeDNS01}
+	types := []string{ChallengeTypeHTTP01, ChallengeTypeTLSSNI01, ChallengeTypeDNS01, ChallengeTypeDNSAccount01}
 	for _, challengeType := range types {
 		chall := Challenge{
 			Type:       challengeType,
@@ -103,6 +148,56 @@ func TestChallengeSanityCheck(t *testing.T) {
 	chall := Challenge{Type: "bogus", Status: StatusPending}
 	test.Assert(t, !chall.IsSane(false), "IsSane should be false")
 	test.Assert(t, !chall.IsSane(true), "IsSane should be false")
+
+	// An email-reply-00 response prefixes the token with the mailed half
+	reply := Challenge{
+		Type:       ChallengeTypeEmailReply00,
+		Status:     StatusPending,
+		AccountKey: accountKey,
+		Token:      ka.Token,
+	}
+	test.Assert(t, reply.IsSane(false), "IsSane should be true")
+	reply.KeyAuthorization = &ka
+	test.Assert(t, !reply.IsSane(true), "Response without the mailed half should not be sane")
+	replyKA, err := NewKeyAuthorizationFromString(NewToken() + ka.Token + "." + ka.Thumbprint)
+	test.AssertNotError(t, err, "Error parsing email-reply-00 key authorization")
+	reply.KeyAuthorization = &replyKA
+	test.Assert(t, reply.IsSane(true), "IsSane should be true")
+	otherKA, err := NewKeyAuthorizationFromString(ka.Token + NewToken() + "." + ka.Thumbprint)
+	test.AssertNotError(t, err, "Error parsing email-reply-00 key authorization")
+	reply.KeyAuthorization = &otherKA
+	test.Assert(t, !reply.IsSane(true), "Response for another token should not be sane")
+	test.Assert(t, reply.RecordsSane(), "email-reply-00 needs no records")
+
+	// Only email-reply-00 responses carry two tokens
+	chall = Challenge{Type: ChallengeTypeHTTP01, Status: StatusPending, AccountKey: accountKey, Token: ka.Token, KeyAuthorization: &replyKA}
+	test.Assert(t, !chall.IsSane(true), "IsSane should be false")
+}
+
+func TestRespondedCombination(t *testing.T) {
+	ka := &KeyAuthorization{Token: "token"}
+	authz := Authorization{
+		Challenges: []Challenge{
+			{Status: StatusPending, KeyAuthorization: ka},
+			{Status: StatusPending},
+			{Status: StatusPending, KeyAuthorization: ka},
+		},
+		Combinations: [][]int{{0, 1}, {0, 2}},
+	}
+	// Challenge 1 hasn't been responded to
+	test.AssertDeepEquals(t, authz.RespondedCombination(0), []int{0, 2})
+	test.AssertDeepEquals(t, authz.RespondedCombination(2), []int{0, 2})
+	authz.Combinations = [][]int{{0, 1}, {2}}
+	test.Assert(t, authz.RespondedCombination(0) == nil, "Combination with an unanswered challenge returned")
+	test.AssertDeepEquals(t, authz.RespondedCombination(2), []int{2})
+
+	// Challenges that were already validated aren't validated again
+	authz.Combinations = [][]int{{0, 2}}
+	authz.Challenges[2].Status = StatusInvalid
+	test.Assert(t, authz.RespondedCombination(0) == nil, "Combination with a finished challenge returned")
+
+	authz.Combinations = nil
+	test.Assert(t, authz.RespondedCombination(0) == nil, "Combination returned without combinations")
 }
 
 func TestJSONBufferUnmarshal(t *testing.T) {
@@ -114,3 +209,9 @@ func TestJSONBufferUnmarshal(t *testing.T) {
 	err := json.Unmarshal(notValidBase64, &testStruct)
 	test.Assert(t, err != nil, "Should have choked on invalid base64")
 }
+
+func TestDNSAccountLabel(t *testing.T) {
+	test.AssertEquals(t, DNSAccountLabel("https://example.com/acme/reg/1"), "_kjre2ghbcq")
+	test.Assert(t, DNSAccountLabel("https://example.com/acme/reg/2") != DNSAccountLabel("https://example.com/acme/reg/1"),
+		"Accounts share a label")
+}
@@ -0,0 +1,62 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"regexp"
+)
+
+// TokenBytes is the number of random octets in a challenge token. Tokens
+// carry 256 bits of entropy, comfortably above the 128 bits required by the
+// ACME specification.
+const TokenBytes = 32
+
+// tokenLength is the length of a token once it has been encoded in unpadded
+// URL-safe base64.
+const tokenLength = (TokenBytes*8 + 5) / 6
+
+var tokenFormat = regexp.MustCompile(fmt.Sprintf("^[\\w-]{%d}$", tokenLength))
+
+// tokenPairFormat matches two tokens run together, as in the responses to
+// email-reply-00 challenges.
+var tokenPairFormat = regexp.MustCompile(fmt.Sprintf("^[\\w-]{%d}$", 2*tokenLength))
+
+// thumbprintFormat matches an unpadded, URL-safe base64 SHA-256 JWK
+// thumbprint, which is independent of the token size.
+var thumbprintFormat = regexp.MustCompile("^[\\w-]{43}$")
+
+// NewToken produces a random string for Challenges, etc.
+func NewToken() string {
+	return RandomString(TokenBytes)
+}
+
+// LooksLikeAToken checks whether a string represents a TokenBytes-octet value
+// in the URL-safe base64 alphabet.
+func LooksLikeAToken(token string) bool {
+	return tokenFormat.MatchString(token)
+}
+
+// LooksLikeATokenPair checks whether a string is two tokens run together, as
+// LooksLikeAToken would accept each of them.
+func LooksLikeATokenPair(token string) bool {
+	return tokenPairFormat.MatchString(token)
+}
+
+// LooksLikeAThumbprint checks whether a string represents a SHA-256 key
+// thumbprint in the URL-safe base64 alphabet.
+func LooksLikeAThumbprint(thumbprint string) bool {
+	return thumbprintFormat.MatchString(thumbprint)
+}
+
+// ConstantTimeEquals compares two secret values (tokens, key thumbprints, key
+// authorizations, or digests of them) without leaking timing information
+// about where they first differ. All comparisons of values derived from
+// challenge tokens must go through this function rather than ==.
+func ConstantTimeEquals(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,110 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestTokenEntropy(t *testing.T) {
+	test.Assert(t, TokenBytes*8 >= 128, "Challenge tokens carry less than 128 bits of entropy")
+	test.AssertEquals(t, len(NewToken()), tokenLength)
+	test.Assert(t, LooksLikeAToken(NewToken()), "Generated token failed format check")
+}
+
+func TestLooksLikeAThumbprint(t *testing.T) {
+	test.Assert(t, LooksLikeAThumbprint(JWK1Thumbprint), "Rejected valid thumbprint")
+	test.Assert(t, !LooksLikeAThumbprint(JWK1Thumbprint[1:]), "Accepted short thumbprint")
+	test.Assert(t, !LooksLikeAThumbprint(JWK1Thumbprint[1:]+"%"), "Accepted invalid thumbprint")
+}
+
+func TestConstantTimeEquals(t *testing.T) {
+	token := NewToken()
+	test.Assert(t, ConstantTimeEquals(token, token), "Equal tokens compared unequal")
+	test.Assert(t, !ConstantTimeEquals(token, NewToken()), "Different tokens compared equal")
+	test.Assert(t, !ConstantTimeEquals(token, token[1:]), "Tokens of different length compared equal")
+	test.Assert(t, ConstantTimeEquals("", ""), "Empty strings compared unequal")
+}
+
+// secretNames are identifiers whose values are derived from challenge tokens
+// and must only be compared with ConstantTimeEquals.
+var secretNames = map[string]bool{
+	"Token":                true,
+	"token":                true,
+	"Thumbprint":           true,
+	"thumbprint":           true,
+	"KeyAuthorization":     true,
+	"authorizedKeysDigest": true,
+	"zName":                true,
+	"ZName":                true,
+}
+
+func isSecretExpr(e ast.Expr) bool {
+	switch v := e.(type) {
+	case *ast.Ident:
+		return secretNames[v.Name]
+	case *ast.SelectorExpr:
+		return secretNames[v.Sel.Name]
+	case *ast.CallExpr:
+		// ka.String() and friends
+		if sel, ok := v.Fun.(*ast.SelectorExpr); ok {
+			return sel.Sel.Name == "String" && isSecretExpr(sel.X)
+		}
+	}
+	return false
+}
+
+func isNilOrEmpty(e ast.Expr) bool {
+	if id, ok := e.(*ast.Ident); ok && id.Name == "nil" {
+		return true
+	}
+	if lit, ok := e.(*ast.BasicLit); ok && lit.Value == `""` {
+		return true
+	}
+	return false
+}
+
+// TestNoDirectSecretComparison walks the sources that handle challenge tokens
+// and fails if any of them compares a secret value with == or !=.
+func TestNoDirectSecretComparison(t *testing.T) {
+	var files []string
+	for _, dir := range []string{".", "../va", "../ra", "../wfe"} {
+		matches, err := filepath.Glob(filepath.Join(dir, "*.go"))
+		test.AssertNotError(t, err, "Failed to list source files")
+		for _, m := range matches {
+			if !strings.HasSuffix(m, "_test.go") {
+				files = append(files, m)
+			}
+		}
+	}
+	test.Assert(t, len(files) > 0, "No source files found")
+
+	fset := token.NewFileSet()
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		test.AssertNotError(t, err, "Failed to parse "+file)
+		ast.Inspect(f, func(n ast.Node) bool {
+			bin, ok := n.(*ast.BinaryExpr)
+			if !ok || (bin.Op != token.EQL && bin.Op != token.NEQ) {
+				return true
+			}
+			if isNilOrEmpty(bin.X) || isNilOrEmpty(bin.Y) {
+				return true
+			}
+			if isSecretExpr(bin.X) || isSecretExpr(bin.Y) {
+				t.Errorf("%s: secret compared with %s; use ConstantTimeEquals", fset.Position(bin.Pos()), bin.Op)
+			}
+			return true
+		})
+	}
+}
@@ -8,12 +8,14 @@ package core
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/base64"
 	"encoding/hex"
@@ -29,11 +31,13 @@ import (
 	mrand "math/rand"
 	"net/http"
 	"net/url"
-	"regexp"
+	"sort"
 	"strings"
 	"time"
 
-	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/crypto/ed25519"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
+	berrors "github.com/letsencrypt/boulder/errors"
 	blog "github.com/letsencrypt/boulder/log"
 	"github.com/letsencrypt/boulder/probs"
 )
@@ -132,6 +136,8 @@ func ProblemDetailsForError(err error, msg string) *probs.ProblemDetails {
 	switch e := err.(type) {
 	case *probs.ProblemDetails:
 		return e
+	case *berrors.BoulderError:
+		return problemDetailsForBoulderError(e, msg)
 	case MalformedRequestError:
 		return probs.Malformed(fmt.Sprintf("%s :: %s", msg, err))
 	case NotSupportedError:
@@ -142,7 +148,7 @@ func ProblemDetailsForError(err error, msg string) *probs.ProblemDetails {
 		}
 	case UnauthorizedError:
 		return probs.Unauthorized(fmt.Sprintf("%s :: %s", msg, err))
-	case NotFoundError:
+	case NotFoundError, NoSuchRegistrationError:
 		return probs.NotFound(fmt.Sprintf("%s :: %s", msg, err))
 	case LengthRequiredError:
 		prob := probs.Malformed("missing Content-Length header")
@@ -165,6 +171,27 @@ func ProblemDetailsForError(err error, msg string) *probs.ProblemDetails {
 	}
 }
 
+// problemDetailsForBoulderError chooses the problem for a BoulderError by its
+// category.
+func problemDetailsForBoulderError(err *berrors.BoulderError, msg string) *probs.ProblemDetails {
+	detail := fmt.Sprintf("%s :: %s", msg, err)
+	switch err.Type {
+	case berrors.NotFound:
+		return probs.NotFound(detail)
+	case berrors.Malformed:
+		return probs.Malformed(detail)
+	case berrors.Unauthorized:
+		return probs.Unauthorized(detail)
+	case berrors.RateLimit:
+		return probs.RateLimited(detail)
+	case berrors.RejectedIdentifier:
+		return probs.RejectedIdentifier(detail)
+	default:
+		// As with other internal errors, the detail isn't included
+		return probs.ServerInternal(msg)
+	}
+}
+
 // Random stuff
 
 // RandomString returns a randomly generated string of the requested length.
@@ -179,19 +206,6 @@ func RandomString(byteLength int) string {
 	return base64.RawURLEncoding.EncodeToString(b)
 }
 
-// NewToken produces a random string for Challenges, etc.
-func NewToken() string {
-	return RandomString(32)
-}
-
-var tokenFormat = regexp.MustCompile("^[\\w-]{43}$")
-
-// LooksLikeAToken checks whether a string represents a 32-octet value in
-// the URL-safe base64 alphabet.
-func LooksLikeAToken(token string) bool {
-	return tokenFormat.MatchString(token)
-}
-
 // Fingerprints
 
 // Fingerprint256 produces an unpadded, URL-safe Base64-encoded SHA256 digest
@@ -206,13 +220,24 @@ func Fingerprint256(data []byte) string {
 // provided public key.
 func KeyDigest(key crypto.PublicKey) (string, error) {
 	switch t := key.(type) {
-	case *jose.JsonWebKey:
+	case *jose.JSONWebKey:
 		if t == nil {
 			return "", fmt.Errorf("Cannot compute digest of nil key")
 		}
 		return KeyDigest(t.Key)
-	case jose.JsonWebKey:
+	case jose.JSONWebKey:
 		return KeyDigest(t.Key)
+	case ed25519.PublicKey:
+		// crypto/x509 can't marshal Ed25519 keys
+		keyDER, err := asn1.Marshal(ed25519SubjectPublicKeyInfo{
+			Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidEd25519},
+			PublicKey: asn1.BitString{Bytes: t, BitLength: 8 * len(t)},
+		})
+		if err != nil {
+			return "", err
+		}
+		spkiDigest := sha256.Sum256(keyDER)
+		return base64.StdEncoding.EncodeToString(spkiDigest[0:32]), nil
 	default:
 		keyDER, err := x509.MarshalPKIXPublicKey(key)
 		if err != nil {
@@ -225,6 +250,38 @@ func KeyDigest(key crypto.PublicKey) (string, error) {
 	}
 }
 
+// KeyThumbprint returns the base64url-encoded SHA-256 JWK thumbprint of key
+// (RFC 7638). go-jose gets the thumbprint of Ed25519 keys wrong, dropping a
+// quote from its input, so those are computed here (RFC 8037, section 2).
+func KeyThumbprint(key *jose.JSONWebKey) (string, error) {
+	var digest []byte
+	switch t := key.Key.(type) {
+	case ed25519.PublicKey:
+		if len(t) != ed25519.PublicKeySize {
+			return "", fmt.Errorf("Ed25519 key is %d bytes, not %d", len(t), ed25519.PublicKeySize)
+		}
+		input := fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":"%s"}`, base64.RawURLEncoding.EncodeToString(t))
+		sum := sha256.Sum256([]byte(input))
+		digest = sum[:]
+	default:
+		var err error
+		if digest, err = key.Thumbprint(crypto.SHA256); err != nil {
+			return "", err
+		}
+	}
+	return base64.RawURLEncoding.EncodeToString(digest), nil
+}
+
+// oidEd25519 identifies Ed25519 keys (RFC 8410)
+var oidEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+
+// ed25519SubjectPublicKeyInfo is the SubjectPublicKeyInfo of an Ed25519
+// key, whose algorithm has no parameters.
+type ed25519SubjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
 // KeyDigestEquals determines whether two public keys have the same digest.
 func KeyDigestEquals(j, k crypto.PublicKey) bool {
 	digestJ, errJ := KeyDigest(j)
@@ -237,6 +294,38 @@ func KeyDigestEquals(j, k crypto.PublicKey) bool {
 	return digestJ == digestK
 }
 
+// SigningAlgorithm picks the JWS algorithm with which key signs: RS256 for
+// RSA keys, ES256 or ES384 for P-256 and P-384 keys, and EdDSA for Ed25519
+// keys.
+func SigningAlgorithm(key crypto.Signer) (jose.SignatureAlgorithm, error) {
+	switch k := key.Public().(type) {
+	case *rsa.PublicKey:
+		return jose.RS256, nil
+	case ed25519.PublicKey:
+		return jose.EdDSA, nil
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return jose.ES256, nil
+		case elliptic.P384():
+			return jose.ES384, nil
+		}
+	}
+	return "", fmt.Errorf("Unsupported signing key type %T", key)
+}
+
+// CheckCSRKeyNotAccountKey returns a badCSR problem if the CSR's public key is
+// the account key. A key that signs ACME requests must not also be a
+// certificate key: certificate keys sit on the servers the certificates are
+// deployed to, and whoever obtained one there could then take over the
+// account, revoking its certificates or issuing more.
+func CheckCSRKeyNotAccountKey(csr *x509.CertificateRequest, accountKey jose.JSONWebKey) *probs.ProblemDetails {
+	if KeyDigestEquals(csr.PublicKey, accountKey) {
+		return probs.BadCSR("Certificate public key must be different than account key, so that a compromised certificate key can't be used to control the account")
+	}
+	return nil
+}
+
 // AcmeURL is a URL that automatically marshal/unmarshal to JSON strings
 type AcmeURL url.URL
 
@@ -429,6 +518,15 @@ func UniqueLowerNames(names []string) (unique []string) {
 	return
 }
 
+// HashNames returns the SHA-256 hash identifying the set of names, which is
+// the same whatever their case, order or duplication.
+func HashNames(names []string) []byte {
+	names = UniqueLowerNames(names)
+	sort.Strings(names)
+	hash := sha256.Sum256([]byte(strings.Join(names, ",")))
+	return hash[:]
+}
+
 // LoadCertBundle loads a PEM bundle of certificates from disk
 func LoadCertBundle(filename string) ([]*x509.Certificate, error) {
 	bundleBytes, err := ioutil.ReadFile(filename)
@@ -460,6 +558,18 @@ func LoadCertBundle(filename string) ([]*x509.Certificate, error) {
 	return bundle, nil
 }
 
+// ShortLivedValidity is the longest validity period of a short-lived
+// certificate, which the Baseline Requirements allow to carry no OCSP or CRL
+// URLs.
+const ShortLivedValidity = 7 * 24 * time.Hour
+
+// IsShortLived returns whether cert is a short-lived certificate without
+// OCSP or CRL URLs, for which no OCSP responses are generated.
+func IsShortLived(cert *x509.Certificate) bool {
+	return cert.NotAfter.Sub(cert.NotBefore) <= ShortLivedValidity &&
+		len(cert.OCSPServer) == 0 && len(cert.CRLDistributionPoints) == 0
+}
+
 // LoadCert loads a PEM certificate specified by filename or returns a error
 func LoadCert(filename string) (cert *x509.Certificate, err error) {
 	certPEM, err := ioutil.ReadFile(filename)
@@ -474,6 +584,48 @@ func LoadCert(filename string) (cert *x509.Certificate, err error) {
 	return
 }
 
+// LoadPublicKey loads a public key from PEM or DER data, either a
+// SubjectPublicKeyInfo or a certificate.
+func LoadPublicKey(data []byte) (interface{}, error) {
+	input := data
+	if block, _ := pem.Decode(data); block != nil {
+		input = block.Bytes
+	}
+
+	pub, errPKIX := x509.ParsePKIXPublicKey(input)
+	if errPKIX == nil {
+		return pub, nil
+	}
+	cert, errCert := x509.ParseCertificate(input)
+	if errCert == nil {
+		return cert.PublicKey, nil
+	}
+	return nil, fmt.Errorf("Couldn't parse public key, got '%s' and '%s'", errPKIX, errCert)
+}
+
+// LoadPrivateKey loads a private key from PEM or DER data, in PKCS #1,
+// PKCS #8 or SEC 1 form.
+func LoadPrivateKey(data []byte) (interface{}, error) {
+	input := data
+	if block, _ := pem.Decode(data); block != nil {
+		input = block.Bytes
+	}
+
+	priv, errPKCS1 := x509.ParsePKCS1PrivateKey(input)
+	if errPKCS1 == nil {
+		return priv, nil
+	}
+	pkcs8, errPKCS8 := x509.ParsePKCS8PrivateKey(input)
+	if errPKCS8 == nil {
+		return pkcs8, nil
+	}
+	ec, errEC := x509.ParseECPrivateKey(input)
+	if errEC == nil {
+		return ec, nil
+	}
+	return nil, fmt.Errorf("Couldn't parse private key, got '%s', '%s' and '%s'", errPKCS1, errPKCS8, errEC)
+}
+
 // retryJitter is used to prevent bunched retried queries from falling into lockstep
 const retryJitter = 0.2
 
@@ -6,16 +6,27 @@
 package core
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"math"
 	"math/big"
 	"net/url"
 	"reflect"
 	"sort"
 	"testing"
+	"time"
 
-	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/crypto/ed25519"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
+	berrors "github.com/letsencrypt/boulder/errors"
 	"github.com/letsencrypt/boulder/probs"
 	"github.com/letsencrypt/boulder/test"
 )
@@ -76,7 +87,7 @@ const JWK2JSON = `{
 
 func TestKeyDigest(t *testing.T) {
 	// Test with JWK (value, reference, and direct)
-	var jwk jose.JsonWebKey
+	var jwk jose.JSONWebKey
 	json.Unmarshal([]byte(JWK1JSON), &jwk)
 	digest, err := KeyDigest(jwk)
 	test.Assert(t, err == nil && digest == JWK1Digest, "Failed to digest JWK by value")
@@ -91,7 +102,7 @@ func TestKeyDigest(t *testing.T) {
 }
 
 func TestKeyDigestEquals(t *testing.T) {
-	var jwk1, jwk2 jose.JsonWebKey
+	var jwk1, jwk2 jose.JSONWebKey
 	json.Unmarshal([]byte(JWK1JSON), &jwk1)
 	json.Unmarshal([]byte(JWK2JSON), &jwk2)
 
@@ -101,6 +112,39 @@ func TestKeyDigestEquals(t *testing.T) {
 	test.Assert(t, !KeyDigestEquals(struct{}{}, struct{}{}), "Unknown key types should not match anything")
 }
 
+func TestCheckCSRKeyNotAccountKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	test.AssertNotError(t, err, "Failed to generate RSA key")
+	otherRSAKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	test.AssertNotError(t, err, "Failed to generate RSA key")
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate ECDSA key")
+	otherECKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate ECDSA key")
+
+	testCases := []struct {
+		csrKey, accountKey crypto.PublicKey
+		same               bool
+	}{
+		{&rsaKey.PublicKey, &rsaKey.PublicKey, true},
+		{&rsaKey.PublicKey, &otherRSAKey.PublicKey, false},
+		{&ecKey.PublicKey, &ecKey.PublicKey, true},
+		{&ecKey.PublicKey, &otherECKey.PublicKey, false},
+		{&rsaKey.PublicKey, &ecKey.PublicKey, false},
+	}
+	for i, tc := range testCases {
+		csr := &x509.CertificateRequest{PublicKey: tc.csrKey}
+		prob := CheckCSRKeyNotAccountKey(csr, jose.JSONWebKey{Key: tc.accountKey})
+		if !tc.same {
+			test.Assert(t, prob == nil, fmt.Sprintf("Case %d: rejected a CSR key that isn't the account key", i))
+			continue
+		}
+		test.Assert(t, prob != nil, fmt.Sprintf("Case %d: accepted the account key as CSR key", i))
+		test.AssertEquals(t, prob.Type, probs.BadCSRProblem)
+		test.AssertEquals(t, prob.HTTPStatus, 400)
+	}
+}
+
 func TestAcmeURL(t *testing.T) {
 	s := "http://example.invalid"
 	u, _ := url.Parse(s)
@@ -114,6 +158,13 @@ func TestUniqueLowerNames(t *testing.T) {
 	test.AssertDeepEquals(t, []string{"bar.com", "baz.com", "foobar.com"}, u)
 }
 
+func TestHashNames(t *testing.T) {
+	hash := HashNames([]string{"a.com", "B.com", "a.com"})
+	test.AssertByteEquals(t, hash, HashNames([]string{"b.com", "A.com"}))
+	test.AssertEquals(t, len(hash), 32)
+	test.Assert(t, !bytes.Equal(hash, HashNames([]string{"a.com"})), "Different sets hashed the same")
+}
+
 func TestUnmarshalAcmeURL(t *testing.T) {
 	var u AcmeURL
 	err := u.UnmarshalJSON([]byte(`":"`))
@@ -133,6 +184,13 @@ func TestProblemDetailsFromError(t *testing.T) {
 		{MalformedRequestError("foo"), 400, probs.MalformedProblem},
 		{UnauthorizedError("foo"), 403, probs.UnauthorizedProblem},
 		{NotFoundError("foo"), 404, probs.MalformedProblem},
+		{NoSuchRegistrationError("foo"), 404, probs.MalformedProblem},
+		{berrors.InternalServerError("foo"), 500, probs.ServerInternalProblem},
+		{berrors.NotFoundError("foo"), 404, probs.MalformedProblem},
+		{berrors.MalformedError("foo"), 400, probs.MalformedProblem},
+		{berrors.UnauthorizedError("foo"), 403, probs.UnauthorizedProblem},
+		{berrors.RateLimitError("foo"), 429, probs.RateLimitedProblem},
+		{berrors.RejectedIdentifierError("foo"), 400, probs.RejectedIdentifierProblem},
 		{SignatureValidationError("foo"), 400, probs.MalformedProblem},
 		{RateLimitedError("foo"), 429, probs.RateLimitedProblem},
 		{LengthRequiredError("foo"), 411, probs.MalformedProblem},
@@ -156,3 +214,63 @@ func TestProblemDetailsFromError(t *testing.T) {
 	p := ProblemDetailsForError(expected, "k")
 	test.AssertDeepEquals(t, expected, p)
 }
+
+func TestIsShortLived(t *testing.T) {
+	now := time.Now()
+	cert := &x509.Certificate{NotBefore: now, NotAfter: now.Add(ShortLivedValidity)}
+	test.Assert(t, IsShortLived(cert), "7 day certificate isn't short-lived")
+	cert.OCSPServer = []string{"http://example.com/ocsp"}
+	test.Assert(t, !IsShortLived(cert), "Certificate with an OCSP URL is short-lived")
+	cert.OCSPServer = nil
+	cert.CRLDistributionPoints = []string{"http://example.com/crl"}
+	test.Assert(t, !IsShortLived(cert), "Certificate with a CRL URL is short-lived")
+	cert.CRLDistributionPoints = nil
+	cert.NotAfter = cert.NotAfter.Add(time.Second)
+	test.Assert(t, !IsShortLived(cert), "Certificate valid for over 7 days is short-lived")
+}
+
+func TestLoadKeys(t *testing.T) {
+	for _, file := range []string{"../test/admin-operator.key", "../test/test-ca.key"} {
+		keyPEM, err := ioutil.ReadFile(file)
+		test.AssertNotError(t, err, "Failed to read key")
+		priv, err := LoadPrivateKey(keyPEM)
+		test.AssertNotError(t, err, "Failed to load private key from "+file)
+		_, ok := priv.(crypto.Signer)
+		test.Assert(t, ok, "Private key isn't a signer")
+	}
+	_, err := LoadPrivateKey([]byte("not a key"))
+	test.AssertError(t, err, "Loaded a private key from garbage")
+
+	certPEM, err := ioutil.ReadFile("../test/admin-operator.pem")
+	test.AssertNotError(t, err, "Failed to read certificate")
+	pub, err := LoadPublicKey(certPEM)
+	test.AssertNotError(t, err, "Failed to load public key from certificate")
+	_, ok := pub.(*ecdsa.PublicKey)
+	test.Assert(t, ok, "Certificate's key isn't ECDSA")
+}
+
+func TestSigningAlgorithm(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	test.AssertNotError(t, err, "Error generating key")
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Error generating key")
+	p224Key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	test.AssertNotError(t, err, "Error generating key")
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	test.AssertNotError(t, err, "Error generating key")
+
+	for _, tc := range []struct {
+		key      crypto.Signer
+		expected jose.SignatureAlgorithm
+	}{
+		{rsaKey, jose.RS256},
+		{p256Key, jose.ES256},
+		{edKey, jose.EdDSA},
+	} {
+		alg, err := SigningAlgorithm(tc.key)
+		test.AssertNotError(t, err, "No algorithm for key")
+		test.AssertEquals(t, alg, tc.expected)
+	}
+	_, err = SigningAlgorithm(p224Key)
+	test.AssertError(t, err, "Found an algorithm for a P-224 key")
+}
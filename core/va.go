@@ -5,12 +5,20 @@
 
 package core
 
+import (
+	"context"
+	"time"
+
+	"github.com/letsencrypt/boulder/identifier"
+	"github.com/letsencrypt/boulder/probs"
+)
+
 // ValidationAuthority defines the public interface for the Boulder VA
 type ValidationAuthority interface {
 	// [RegistrationAuthority]
-	UpdateValidations(Authorization, int) error
-	CheckCAARecords(AcmeIdentifier) (bool, bool, error)
-	IsSafeDomain(*IsSafeDomainRequest) (*IsSafeDomainResponse, error)
+	UpdateValidations(context.Context, Authorization, int) error
+	CheckCAARecords(context.Context, identifier.ACMEIdentifier, int64, string) (bool, bool, error)
+	IsSafeDomain(context.Context, *IsSafeDomainRequest) (*IsSafeDomainResponse, error)
 }
 
 // IsSafeDomainRequest is the request struct for the IsSafeDomain call. The Domain field
@@ -25,3 +33,65 @@ type IsSafeDomainRequest struct {
 type IsSafeDomainResponse struct {
 	IsSafe bool
 }
+
+// RemoteValidator validates a challenge and checks CAA from a network
+// perspective other than the primary VA's. It is implemented locally by
+// the VA and remotely by VA instances in other networks, over RPC.
+type RemoteValidator interface {
+	PerformValidation(context.Context, *PerformValidationRequest) (*PerformValidationResponse, error)
+}
+
+// PerformValidationRequest is the request struct for the PerformValidation
+// call. The Challenge must carry its key authorization.
+type PerformValidationRequest struct {
+	Identifier      identifier.ACMEIdentifier
+	Challenge       Challenge
+	RegistrationID  int64
+	AuthorizationID string
+}
+
+// PerformValidationResponse is the response struct for the PerformValidation
+// call. Problem is nil if and only if the validation succeeded.
+type PerformValidationResponse struct {
+	Records    []ValidationRecord
+	Problem    *probs.ProblemDetails
+	Transcript *ValidationTranscript
+}
+
+// ValidationTranscript records the evidence that a validation was decided on:
+// the DNS queries made and their answers, and the content fetched, from the
+// network perspective of the VA that made them. A primary VA's transcript
+// includes those of the remote VAs that agreed with it. VAs sign and store
+// the transcripts of successful validations, so that auditors can later
+// reconstruct what supported an issuance.
+type ValidationTranscript struct {
+	AuthorizationID string                    `json:"authorizationID,omitempty"`
+	RegistrationID  int64                     `json:"registrationID"`
+	Identifier      identifier.ACMEIdentifier `json:"identifier"`
+	ChallengeType   string                    `json:"challengeType"`
+	Perspective     string                    `json:"perspective"`
+	Started         time.Time                 `json:"started"`
+	Finished        time.Time                 `json:"finished"`
+	Queries         []TranscriptQuery         `json:"queries,omitempty"`
+	Fetches         []TranscriptFetch         `json:"fetches,omitempty"`
+	Records         []ValidationRecord        `json:"records,omitempty"`
+
+	Remote []ValidationTranscript `json:"remote,omitempty"`
+}
+
+// TranscriptQuery is a DNS lookup made during a validation.
+type TranscriptQuery struct {
+	Name    string    `json:"name"`
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Answers []string  `json:"answers,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// TranscriptFetch is content retrieved during a validation: the body of an
+// HTTP response, or the certificate presented in a TLS handshake.
+type TranscriptFetch struct {
+	Source string    `json:"source"`
+	Time   time.Time `json:"time"`
+	Body   []byte    `json:"body"`
+}
@@ -0,0 +1,104 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package errors defines the categories of error Boulder's components return
+// to one another. A BoulderError keeps its category and detail across the
+// RPC layer, so that the WFE can choose the problem document to send from
+// what went wrong, rather than from the wording of an error message. It's
+// imported as berrors, to keep it apart from the standard library's errors.
+package errors
+
+import "fmt"
+
+// ErrorType is the category of a BoulderError.
+type ErrorType int
+
+// The categories of BoulderError
+const (
+	InternalServer ErrorType = iota
+	NotFound
+	Malformed
+	Unauthorized
+	RateLimit
+	RejectedIdentifier
+)
+
+var errorTypeNames = map[ErrorType]string{
+	InternalServer:     "InternalServer",
+	NotFound:           "NotFound",
+	Malformed:          "Malformed",
+	Unauthorized:       "Unauthorized",
+	RateLimit:          "RateLimit",
+	RejectedIdentifier: "RejectedIdentifier",
+}
+
+func (t ErrorType) String() string {
+	if name, ok := errorTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("ErrorType(%d)", int(t))
+}
+
+// BoulderError is an error of a known category, with a detail that's safe to
+// show to the subscriber whose request caused it, unless its Type is
+// InternalServer.
+type BoulderError struct {
+	Type   ErrorType
+	Detail string
+}
+
+func (be *BoulderError) Error() string {
+	return be.Detail
+}
+
+// New returns a BoulderError of type errType, with its detail formatted from
+// msg and args as by fmt.Sprintf.
+func New(errType ErrorType, msg string, args ...interface{}) error {
+	if len(args) > 0 {
+		msg = fmt.Sprintf(msg, args...)
+	}
+	return &BoulderError{Type: errType, Detail: msg}
+}
+
+// Is returns whether err is a BoulderError of type errType.
+func Is(err error, errType ErrorType) bool {
+	be, ok := err.(*BoulderError)
+	return ok && be.Type == errType
+}
+
+// InternalServerError returns an InternalServer BoulderError.
+func InternalServerError(msg string, args ...interface{}) error {
+	return New(InternalServer, msg, args...)
+}
+
+// NotFoundError returns a NotFound BoulderError, for an object that doesn't
+// exist.
+func NotFoundError(msg string, args ...interface{}) error {
+	return New(NotFound, msg, args...)
+}
+
+// MalformedError returns a Malformed BoulderError, for a request that doesn't
+// make sense.
+func MalformedError(msg string, args ...interface{}) error {
+	return New(Malformed, msg, args...)
+}
+
+// UnauthorizedError returns an Unauthorized BoulderError, for a request its
+// account isn't allowed to make.
+func UnauthorizedError(msg string, args ...interface{}) error {
+	return New(Unauthorized, msg, args...)
+}
+
+// RateLimitError returns a RateLimit BoulderError, for a request that would
+// exceed a rate limit.
+func RateLimitError(msg string, args ...interface{}) error {
+	return New(RateLimit, msg, args...)
+}
+
+// RejectedIdentifierError returns a RejectedIdentifier BoulderError, for an
+// identifier that policy forbids issuing for.
+func RejectedIdentifierError(msg string, args ...interface{}) error {
+	return New(RejectedIdentifier, msg, args...)
+}
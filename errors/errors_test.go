@@ -0,0 +1,40 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package errors
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestBoulderErrors(t *testing.T) {
+	testCases := []struct {
+		err     error
+		errType ErrorType
+	}{
+		{InternalServerError("foo"), InternalServer},
+		{NotFoundError("foo"), NotFound},
+		{MalformedError("foo"), Malformed},
+		{UnauthorizedError("foo"), Unauthorized},
+		{RateLimitError("foo"), RateLimit},
+		{RejectedIdentifierError("foo"), RejectedIdentifier},
+	}
+	for _, tc := range testCases {
+		test.Assert(t, Is(tc.err, tc.errType), fmt.Sprintf("%s isn't a %s error", tc.err, tc.errType))
+		test.AssertEquals(t, tc.err.Error(), "foo")
+	}
+
+	err := NotFoundError("No certificate with serial %s", "ff")
+	test.AssertEquals(t, err.Error(), "No certificate with serial ff")
+	test.Assert(t, !Is(err, Malformed), "NotFound error is Malformed")
+	test.Assert(t, !Is(fmt.Errorf("not found"), NotFound), "Plain error is NotFound")
+
+	// Details with a verb but no arguments are left alone
+	test.AssertEquals(t, MalformedError("100% wrong").Error(), "100% wrong")
+	test.AssertEquals(t, ErrorType(42).String(), "ErrorType(42)")
+}
@@ -0,0 +1,199 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package identifier holds the identifiers that certificates are issued
+// for, and what is specific to each type of identifier: how values are
+// normalized and compared, and how they're found in CSRs and certificates.
+// Adding a type of identifier starts here, and with a policy for it in the
+// PA.
+package identifier
+
+import (
+	"crypto/x509"
+	"sort"
+	"strings"
+)
+
+// Type is a type of identifier, as named in ACME
+type Type string
+
+// The types of identifier
+const (
+	DNS = Type("dns")
+	// Email identifiers are mailbox addresses, for S/MIME certificates
+	Email = Type("email")
+)
+
+// ACMEIdentifier is an identifier that can be validated by ACME.
+type ACMEIdentifier struct {
+	Type  Type   `json:"type"`  // The type of identifier being encoded
+	Value string `json:"value"` // The identifier itself
+}
+
+// kind is what the handling of identifiers differs in by type.
+type kind struct {
+	// normalize returns a value in canonical form, so that values naming
+	// the same thing compare equal
+	normalize func(string) string
+}
+
+var kinds = map[Type]kind{
+	DNS:   {normalize: strings.ToLower},
+	Email: {normalize: normalizeEmail},
+}
+
+// normalizeEmail lowercases the domain of an address. The local part is
+// left as it is, since mail servers may treat it case-sensitively.
+func normalizeEmail(address string) string {
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return address
+	}
+	return address[:at+1] + strings.ToLower(address[at+1:])
+}
+
+// Supported reports whether identifiers of type t are known.
+func Supported(t Type) bool {
+	_, ok := kinds[t]
+	return ok
+}
+
+// DNSName returns the identifier for a DNS name, normalized.
+func DNSName(name string) ACMEIdentifier {
+	return ACMEIdentifier{Type: DNS, Value: name}.Normalized()
+}
+
+// FromValue returns the identifier, normalized, for a name as it appears in
+// a certificate or CSR: an email identifier for a mailbox address, and a DNS
+// identifier otherwise.
+func FromValue(value string) ACMEIdentifier {
+	if strings.Contains(value, "@") {
+		return ACMEIdentifier{Type: Email, Value: value}.Normalized()
+	}
+	return DNSName(value)
+}
+
+// Domain returns the domain name that id is under: the value of a DNS
+// identifier, or the domain of an email identifier.
+func (id ACMEIdentifier) Domain() string {
+	if id.Type == Email {
+		return id.Value[strings.LastIndex(id.Value, "@")+1:]
+	}
+	return id.Value
+}
+
+// Normalized returns id with its value in canonical form. Identifiers of
+// unknown types are returned as they are.
+func (id ACMEIdentifier) Normalized() ACMEIdentifier {
+	if k, ok := kinds[id.Type]; ok {
+		id.Value = k.normalize(id.Value)
+	}
+	return id
+}
+
+// Equal reports whether id and other identify the same thing.
+func (id ACMEIdentifier) Equal(other ACMEIdentifier) bool {
+	return id.Normalized() == other.Normalized()
+}
+
+// Unique returns ids normalized, without duplicates, and sorted by type
+// then value.
+func Unique(ids []ACMEIdentifier) []ACMEIdentifier {
+	seen := make(map[ACMEIdentifier]bool, len(ids))
+	unique := make([]ACMEIdentifier, 0, len(ids))
+	for _, id := range ids {
+		id = id.Normalized()
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	sort.Sort(byTypeAndValue(unique))
+	return unique
+}
+
+type byTypeAndValue []ACMEIdentifier
+
+func (ids byTypeAndValue) Len() int      { return len(ids) }
+func (ids byTypeAndValue) Swap(i, j int) { ids[i], ids[j] = ids[j], ids[i] }
+func (ids byTypeAndValue) Less(i, j int) bool {
+	if ids[i].Type != ids[j].Type {
+		return ids[i].Type < ids[j].Type
+	}
+	return ids[i].Value < ids[j].Value
+}
+
+// Values returns the values of ids, in order.
+func Values(ids []ACMEIdentifier) []string {
+	values := make([]string, len(ids))
+	for i, id := range ids {
+		values[i] = id.Value
+	}
+	return values
+}
+
+// ValuesOfType returns the values of those of ids that are of type t, in
+// order, or nil if there are none.
+func ValuesOfType(ids []ACMEIdentifier, t Type) []string {
+	var values []string
+	for _, id := range ids {
+		if id.Type == t {
+			values = append(values, id.Value)
+		}
+	}
+	return values
+}
+
+// fromNames returns the unique identifiers for a subject common name, DNS
+// SANs and email SANs, skipping an empty common name.
+func fromNames(commonName string, dnsNames, emailAddresses []string) []ACMEIdentifier {
+	var ids []ACMEIdentifier
+	if commonName != "" {
+		ids = append(ids, FromValue(commonName))
+	}
+	for _, name := range dnsNames {
+		ids = append(ids, DNSName(name))
+	}
+	for _, address := range emailAddresses {
+		ids = append(ids, ACMEIdentifier{Type: Email, Value: address}.Normalized())
+	}
+	return Unique(ids)
+}
+
+// FromCSR returns the identifiers a CSR asks for, normalized and unique:
+// its DNS names and email addresses, including the subject common name.
+func FromCSR(csr *x509.CertificateRequest) []ACMEIdentifier {
+	return fromNames(csr.Subject.CommonName, csr.DNSNames, csr.EmailAddresses)
+}
+
+// FromCert returns the identifiers a certificate is for, normalized and
+// unique: its DNS names and email addresses, including the subject common
+// name.
+func FromCert(cert *x509.Certificate) []ACMEIdentifier {
+	return fromNames(cert.Subject.CommonName, cert.DNSNames, cert.EmailAddresses)
+}
+
+// CoveredByWildcard returns those of ids that are DNS names a wildcard among
+// ids also covers, in order: *.example.com covers www.example.com, but not
+// example.com or a.b.example.com.
+func CoveredByWildcard(ids []ACMEIdentifier) []ACMEIdentifier {
+	wildcards := make(map[string]bool)
+	for _, id := range ids {
+		if id.Type == DNS && strings.HasPrefix(id.Value, "*.") {
+			wildcards[strings.ToLower(id.Value)] = true
+		}
+	}
+	var covered []ACMEIdentifier
+	for _, id := range ids {
+		if id.Type != DNS || strings.HasPrefix(id.Value, "*.") {
+			continue
+		}
+		dot := strings.Index(id.Value, ".")
+		if dot > 0 && wildcards["*"+strings.ToLower(id.Value[dot:])] {
+			covered = append(covered, id)
+		}
+	}
+	return covered
+}
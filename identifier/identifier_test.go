@@ -0,0 +1,83 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package identifier
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"testing"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestNormalization(t *testing.T) {
+	test.AssertEquals(t, DNSName("WWW.Example.COM"), ACMEIdentifier{Type: DNS, Value: "www.example.com"})
+	test.Assert(t, DNSName("example.com").Equal(ACMEIdentifier{Type: DNS, Value: "EXAMPLE.com"}), "Names differing in case should be equal")
+	test.Assert(t, !DNSName("example.com").Equal(ACMEIdentifier{Type: "other", Value: "example.com"}), "Identifiers of different types should differ")
+
+	// Unknown types are left alone
+	other := ACMEIdentifier{Type: "other", Value: "MiXeD"}
+	test.AssertEquals(t, other.Normalized(), other)
+	test.Assert(t, Supported(DNS), "DNS should be supported")
+	test.Assert(t, !Supported("other"), "Unknown types shouldn't be supported")
+}
+
+func TestFromCSR(t *testing.T) {
+	csr := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "Example.com"},
+		DNSNames: []string{"www.example.com", "example.COM", "a.example.com"},
+	}
+	ids := FromCSR(csr)
+	test.AssertDeepEquals(t, Values(ids), []string{"a.example.com", "example.com", "www.example.com"})
+	for _, id := range ids {
+		test.AssertEquals(t, id.Type, DNS)
+	}
+
+	// An empty common name isn't an identifier
+	cert := &x509.Certificate{DNSNames: []string{"example.com"}}
+	test.AssertDeepEquals(t, Values(FromCert(cert)), []string{"example.com"})
+}
+
+func TestEmail(t *testing.T) {
+	// Only the domain of an address is case-insensitive
+	id := FromValue("Alice@Example.COM")
+	test.AssertEquals(t, id, ACMEIdentifier{Type: Email, Value: "Alice@example.com"})
+	test.Assert(t, !id.Equal(FromValue("alice@example.com")), "Local parts differing in case should differ")
+	test.AssertEquals(t, id.Domain(), "example.com")
+	test.AssertEquals(t, FromValue("Example.com"), DNSName("example.com"))
+	test.AssertEquals(t, DNSName("example.com").Domain(), "example.com")
+
+	csr := &x509.CertificateRequest{
+		Subject:        pkix.Name{CommonName: "bob@example.com"},
+		EmailAddresses: []string{"alice@example.com", "bob@EXAMPLE.com"},
+		DNSNames:       []string{"example.com"},
+	}
+	ids := FromCSR(csr)
+	test.AssertEquals(t, len(ids), 3)
+	test.AssertDeepEquals(t, ValuesOfType(ids, Email), []string{"alice@example.com", "bob@example.com"})
+	test.AssertDeepEquals(t, ValuesOfType(ids, DNS), []string{"example.com"})
+	test.Assert(t, ValuesOfType(FromCSR(&x509.CertificateRequest{}), Email) == nil, "No values should be nil")
+}
+
+func TestJSON(t *testing.T) {
+	encoded, err := json.Marshal(DNSName("example.com"))
+	test.AssertNotError(t, err, "Couldn't marshal identifier")
+	test.AssertEquals(t, string(encoded), `{"type":"dns","value":"example.com"}`)
+}
+
+func TestCoveredByWildcard(t *testing.T) {
+	ids := Unique([]ACMEIdentifier{
+		DNSName("*.example.com"),
+		DNSName("WWW.example.com"),
+		DNSName("example.com"),
+		DNSName("a.b.example.com"),
+		DNSName("www.example.net"),
+		FromValue("www@example.com"),
+	})
+	test.AssertDeepEquals(t, CoveredByWildcard(ids), []ACMEIdentifier{DNSName("www.example.com")})
+	test.Assert(t, CoveredByWildcard([]ACMEIdentifier{DNSName("www.example.com")}) == nil, "Nothing should be covered without a wildcard")
+}
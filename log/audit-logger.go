@@ -13,6 +13,7 @@ import (
 	"os"
 	"path"
 	"runtime"
+	"runtime/debug"
 	"strings"
 	"sync"
 	"time"
@@ -66,6 +67,7 @@ type AuditLogger struct {
 	Stats          statsd.Statter
 	exitFunction   exitFunction
 	stdoutLogLevel int
+	requestID      string
 }
 
 const defaultPriority = syslog.LOG_INFO | syslog.LOG_LOCAL0
@@ -77,10 +79,10 @@ func NewAuditLogger(log SyslogWriter, stats statsd.Statter, stdoutLogLevel int)
 		return nil, errors.New("Attempted to use a nil System Logger.")
 	}
 	audit := &AuditLogger{
-		log,
-		stats,
-		defaultEmergencyExit,
-		stdoutLogLevel,
+		SyslogWriter:   log,
+		Stats:          stats,
+		exitFunction:   defaultEmergencyExit,
+		stdoutLogLevel: stdoutLogLevel,
 	}
 	return audit, nil
 }
@@ -170,9 +172,25 @@ func (log *AuditLogger) auditAtLevel(level syslog.Priority, msg string) (err err
 	log.Stats.Inc("Logging.Audit", 1, 1.0)
 
 	text := fmt.Sprintf("%s %s", auditTag, msg)
+	if log.requestID != "" {
+		text = fmt.Sprintf("%s [Request ID: %s] %s", auditTag, log.requestID, msg)
+	}
 	return log.logAtLevel(level, text)
 }
 
+// WithRequestID returns a copy of the logger that tags its audit messages
+// with the ID of the request being handled, so that the messages each
+// component logs for one request can be found together. An empty id returns
+// the logger unchanged.
+func (log *AuditLogger) WithRequestID(id string) *AuditLogger {
+	if id == "" {
+		return log
+	}
+	tagged := *log
+	tagged.requestID = id
+	return &tagged
+}
+
 // Return short format caller info for panic events, skipping to before the
 // panic handler.
 func caller(level int) string {
@@ -198,6 +216,41 @@ func (log *AuditLogger) AuditPanic() {
 	}
 }
 
+// panicEvent is the record RecoverPanic logs of a recovered panic.
+type panicEvent struct {
+	Handler string
+	Panic   string
+	Stack   string
+}
+
+// RecoverPanic recovers a panic in a request, message or job handler so that
+// the process survives it, and must be deferred directly for recover to see
+// the panic. The panic is audit logged at ALERT level with the panicking
+// goroutine's stack and counted under Crashes.<handler>, then passed to
+// onPanic, if not nil, so the handler can still answer with an internal
+// error.
+// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+func (log *AuditLogger) RecoverPanic(handler string, onPanic func(p interface{})) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	log.Stats.Inc(fmt.Sprintf("Crashes.%s", handler), 1, 1.0)
+	event := panicEvent{
+		Handler: handler,
+		Panic:   fmt.Sprintf("%v", p),
+		Stack:   string(debug.Stack()),
+	}
+	msg, err := log.formatObjectMessage("Recovered panic", event)
+	if err != nil {
+		msg = fmt.Sprintf("Recovered panic in %s: %v", handler, p)
+	}
+	log.auditAtLevel(syslog.LOG_ALERT, msg)
+	if onPanic != nil {
+		onPanic(p)
+	}
+}
+
 // WarningErr formats an error for the Warn level.
 func (log *AuditLogger) WarningErr(msg error) (err error) {
 	return log.logAtLevel(syslog.LOG_WARNING, msg.Error())
@@ -113,6 +113,41 @@ func TestPanic(t *testing.T) {
 	// Can't assert anything here or golint gets angry
 }
 
+func TestRecoverPanic(t *testing.T) {
+	t.Parallel()
+
+	l, err := newUDPListener("127.0.0.1:0")
+	test.AssertNotError(t, err, "Failed to open log server")
+	defer l.Close()
+
+	stats, _ := statsd.NewNoopClient(nil)
+	writer, err := syslog.Dial("udp", l.LocalAddr().String(), syslog.LOG_INFO|syslog.LOG_LOCAL0, "")
+	test.AssertNotError(t, err, "Failed to find connect to log server")
+	audit, err := NewAuditLogger(writer, stats, stdoutLevel)
+	test.AssertNotError(t, err, "Failed to construct audit logger")
+
+	var recovered interface{}
+	func() {
+		defer audit.RecoverPanic("Test", func(p interface{}) { recovered = p })
+		panic("Test panic")
+	}()
+	test.AssertEquals(t, recovered, "Test panic")
+
+	data := make([]byte, 65536)
+	n, _, err := l.ReadFrom(data)
+	test.AssertNotError(t, err, "Failed to find packet")
+	msg := string(data[:n])
+	test.AssertContains(t, msg, `[AUDIT] Recovered panic JSON={"Handler":"Test","Panic":"Test panic","Stack":"goroutine`)
+	test.AssertContains(t, msg, "TestRecoverPanic")
+
+	// Without a panic, nothing is logged and onPanic isn't called
+	func() {
+		defer audit.RecoverPanic("Test", func(p interface{}) { t.Error("onPanic called without a panic") })
+	}()
+	_, _, err = l.ReadFrom(data)
+	test.AssertError(t, err, "Logged without a panic")
+}
+
 func TestAuditObject(t *testing.T) {
 	t.Parallel()
 	audit := setup(t)
@@ -215,6 +250,35 @@ func TestTransmission(t *testing.T) {
 	test.AssertNotError(t, err, "Failed to find packet")
 }
 
+func TestWithRequestID(t *testing.T) {
+	t.Parallel()
+
+	l, err := newUDPListener("127.0.0.1:0")
+	test.AssertNotError(t, err, "Failed to open log server")
+	defer l.Close()
+
+	stats, _ := statsd.NewNoopClient(nil)
+	writer, err := syslog.Dial("udp", l.LocalAddr().String(), syslog.LOG_INFO|syslog.LOG_LOCAL0, "")
+	test.AssertNotError(t, err, "Failed to find connect to log server")
+
+	audit, err := NewAuditLogger(writer, stats, stdoutLevel)
+	test.AssertNotError(t, err, "Failed to construct audit logger")
+	test.AssertEquals(t, audit.WithRequestID(""), audit)
+
+	data := make([]byte, 256)
+
+	audit.WithRequestID("f00f").Audit("tagged")
+	n, _, err := l.ReadFrom(data)
+	test.AssertNotError(t, err, "Failed to find packet")
+	test.AssertContains(t, string(data[:n]), "[AUDIT] [Request ID: f00f] tagged")
+
+	// The original logger is left untagged
+	audit.Audit("untagged")
+	n, _, err = l.ReadFrom(data)
+	test.AssertNotError(t, err, "Failed to find packet")
+	test.AssertContains(t, string(data[:n]), "[AUDIT] untagged")
+}
+
 func newUDPListener(addr string) (*net.UDPConn, error) {
 	l, err := net.ListenPacket("udp", addr)
 	if err != nil {
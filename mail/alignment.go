@@ -0,0 +1,218 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mail
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/net/publicsuffix"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
+	"github.com/letsencrypt/boulder/bdns"
+)
+
+// A Sender is how mail is sent: with the address From in its From header,
+// and Envelope (by default, From) as its envelope sender, through the SMTP
+// relay Relay, which hands it to receivers and signs it as DKIMDomain (by
+// default, the domain of From) with keys of DKIMSelectors.
+type Sender struct {
+	From          string
+	Envelope      string
+	Relay         string
+	DKIMDomain    string
+	DKIMSelectors []string
+}
+
+// CheckSenderAlignment returns a problem for each way in which receivers
+// could fail to authenticate mail from sender, and so treat it as spam: the
+// SPF record of the envelope domain must pass each of the relay's addresses
+// (IPv4, as the resolver finds no others), a DKIM key must be published for
+// each selector, and the From domain, or its organizational domain, must
+// publish a DMARC policy under whose alignment modes the envelope and DKIM
+// domains both align with the From domain. A failed lookup is a problem
+// too, since receivers may see the same failure.
+func CheckSenderAlignment(resolver bdns.DNSResolver, sender Sender) []string {
+	domain, ok := addressDomain(sender.From)
+	if !ok {
+		return []string{fmt.Sprintf("From address %q has no domain", sender.From)}
+	}
+	envelopeDomain := domain
+	if sender.Envelope != "" {
+		if envelopeDomain, ok = addressDomain(sender.Envelope); !ok {
+			return []string{fmt.Sprintf("Envelope sender %q has no domain", sender.Envelope)}
+		}
+	}
+	dkimDomain := strings.ToLower(sender.DKIMDomain)
+	if dkimDomain == "" {
+		dkimDomain = domain
+	}
+
+	var problems []string
+	relayIPs, err := relayAddresses(resolver, sender.Relay)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("Couldn't look up addresses of relay %s: %s", sender.Relay, err))
+	}
+	// Addresses failing the same way, as they all do when the record is
+	// missing, are one problem
+	type spfFailure struct {
+		result spfResult
+		detail string
+	}
+	var failures []spfFailure
+	failedIPs := make(map[spfFailure][]string)
+	for _, ip := range relayIPs {
+		if result, detail := checkSPF(resolver, ip, envelopeDomain); result != spfPass {
+			failure := spfFailure{result, detail}
+			if failedIPs[failure] == nil {
+				failures = append(failures, failure)
+			}
+			failedIPs[failure] = append(failedIPs[failure], ip.String())
+		}
+	}
+	for _, f := range failures {
+		problems = append(problems, fmt.Sprintf("SPF of %s gives %s for relay %s: %s",
+			envelopeDomain, f.result, strings.Join(failedIPs[f], ", "), f.detail))
+	}
+
+	for _, selector := range sender.DKIMSelectors {
+		name := fmt.Sprintf("%s._domainkey.%s", selector, dkimDomain)
+		keys, err := recordsWithPrefix(resolver, name, "")
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Couldn't look up DKIM key at %s: %s", name, err))
+			continue
+		}
+		if !hasDKIMKey(keys) {
+			problems = append(problems, fmt.Sprintf("No DKIM key published at %s", name))
+		}
+	}
+
+	dmarcDomain := domain
+	dmarc, err := recordsWithPrefix(resolver, "_dmarc."+domain, "v=DMARC1")
+	if err == nil && len(dmarc) == 0 {
+		// Receivers fall back to the policy of the organizational domain
+		if org, orgErr := publicsuffix.EffectiveTLDPlusOne(domain); orgErr == nil && org != domain {
+			dmarcDomain = org
+			dmarc, err = recordsWithPrefix(resolver, "_dmarc."+org, "v=DMARC1")
+		}
+	}
+	switch {
+	case err != nil:
+		problems = append(problems, fmt.Sprintf("Couldn't look up DMARC policy of %s: %s", dmarcDomain, err))
+	case len(dmarc) == 0:
+		problems = append(problems, fmt.Sprintf("%s has no DMARC policy", domain))
+	case len(dmarc) > 1:
+		problems = append(problems, fmt.Sprintf("%s has %d DMARC policies, which receivers treat as none", dmarcDomain, len(dmarc)))
+	default:
+		tags := dmarcTags(dmarc[0])
+		if !aligned(envelopeDomain, domain, tags["aspf"]) {
+			problems = append(problems, fmt.Sprintf("Envelope domain %s isn't aligned with %s under the %s SPF alignment of the DMARC policy of %s",
+				envelopeDomain, domain, alignmentMode(tags["aspf"]), dmarcDomain))
+		}
+		if len(sender.DKIMSelectors) > 0 && !aligned(dkimDomain, domain, tags["adkim"]) {
+			problems = append(problems, fmt.Sprintf("DKIM domain %s isn't aligned with %s under the %s DKIM alignment of the DMARC policy of %s",
+				dkimDomain, domain, alignmentMode(tags["adkim"]), dmarcDomain))
+		}
+	}
+	return problems
+}
+
+// addressDomain returns the domain of a mailbox address, lowercased.
+func addressDomain(address string) (string, bool) {
+	at := strings.LastIndex(address, "@")
+	if at < 0 || at == len(address)-1 {
+		return "", false
+	}
+	return strings.ToLower(address[at+1:]), true
+}
+
+// relayAddresses returns the addresses of relay, which may be an address
+// itself.
+func relayAddresses(resolver bdns.DNSResolver, relay string) ([]net.IP, error) {
+	if ip := net.ParseIP(relay); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	ips, err := resolver.LookupHost(relay)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no addresses")
+	}
+	return ips, nil
+}
+
+// dmarcTags returns the tags of a DMARC record by name, with their values
+// lowercased.
+func dmarcTags(record string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(record, ";") {
+		if eq := strings.Index(tag, "="); eq >= 0 {
+			tags[strings.ToLower(strings.TrimSpace(tag[:eq]))] = strings.ToLower(strings.TrimSpace(tag[eq+1:]))
+		}
+	}
+	return tags
+}
+
+// alignmentMode names a DMARC alignment mode.
+func alignmentMode(mode string) string {
+	if mode == "s" {
+		return "strict"
+	}
+	return "relaxed"
+}
+
+// aligned returns whether domain is aligned with the From domain under mode,
+// a DMARC alignment mode: under strict ("s") alignment the domains must be
+// the same, and under relaxed, the default, their organizational domains.
+func aligned(domain, from, mode string) bool {
+	if domain == from {
+		return true
+	}
+	if mode == "s" {
+		return false
+	}
+	org, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		return false
+	}
+	fromOrg, err := publicsuffix.EffectiveTLDPlusOne(from)
+	return err == nil && org == fromOrg
+}
+
+// recordsWithPrefix returns the TXT records of name that start with prefix,
+// ignoring case. A name that doesn't exist has none.
+func recordsWithPrefix(resolver bdns.DNSResolver, name, prefix string) ([]string, error) {
+	txts, err := resolver.LookupTXT(name)
+	if rcodeErr, ok := err.(*bdns.RcodeError); ok && rcodeErr.Rcode == dns.RcodeNameError {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []string
+	for _, txt := range txts {
+		fields := strings.Fields(txt)
+		if prefix == "" || (len(fields) > 0 && strings.EqualFold(strings.TrimSuffix(fields[0], ";"), prefix)) {
+			records = append(records, txt)
+		}
+	}
+	return records, nil
+}
+
+// hasDKIMKey returns whether one of records is a DKIM key record with a
+// key: an empty p= tag means the key was revoked.
+func hasDKIMKey(records []string) bool {
+	for _, record := range records {
+		for _, tag := range strings.Split(record, ";") {
+			tag = strings.TrimSpace(tag)
+			if strings.HasPrefix(tag, "p=") && strings.TrimSpace(tag[2:]) != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
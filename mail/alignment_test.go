@@ -0,0 +1,136 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mail
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
+	"github.com/letsencrypt/boulder/bdns"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// txtResolver answers TXT, A and MX queries from records, hosts and mxs,
+// with NXDOMAIN for names it doesn't have and SERVFAIL for names in broken.
+type txtResolver struct {
+	mocks.DNSResolver
+	records map[string][]string
+	hosts   map[string][]net.IP
+	mxs     map[string][]string
+	broken  map[string]bool
+}
+
+func (r *txtResolver) LookupTXT(name string) ([]string, error) {
+	if r.broken[name] {
+		return nil, errors.New("SERVFAIL")
+	}
+	txts, ok := r.records[name]
+	if !ok {
+		return nil, &bdns.RcodeError{Qtype: dns.TypeTXT, Rcode: dns.RcodeNameError}
+	}
+	return txts, nil
+}
+
+func (r *txtResolver) LookupHost(name string) ([]net.IP, error) {
+	if r.broken[name] {
+		return nil, errors.New("SERVFAIL")
+	}
+	ips, ok := r.hosts[name]
+	if !ok {
+		return nil, &bdns.RcodeError{Qtype: dns.TypeA, Rcode: dns.RcodeNameError}
+	}
+	return ips, nil
+}
+
+func (r *txtResolver) LookupMX(name string) ([]string, error) {
+	if r.broken[name] {
+		return nil, errors.New("SERVFAIL")
+	}
+	return r.mxs[name], nil
+}
+
+func alignedResolver() *txtResolver {
+	return &txtResolver{
+		records: map[string][]string{
+			"mail.example.com":                    {"v=spf1 ip4:192.0.2.1 include:_spf.example.com -all", "google-site-verification=abc"},
+			"_spf.example.com":                    {"v=spf1 a:relay.example.com/30 -all"},
+			"s1._domainkey.mail.example.com":      {"v=DKIM1; k=rsa; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQC"},
+			"_dmarc.example.com":                  {"v=DMARC1; p=reject; rua=mailto:dmarc@example.com"},
+			"revoked._domainkey.mail.example.com": {"v=DKIM1; p="},
+		},
+		hosts: map[string][]net.IP{
+			"smtp.example.com":  {net.ParseIP("192.0.2.1"), net.ParseIP("198.51.100.6")},
+			"relay.example.com": {net.ParseIP("198.51.100.5")},
+		},
+		broken: make(map[string]bool),
+	}
+}
+
+func sender() Sender {
+	return Sender{From: "certs@mail.example.com", Relay: "smtp.example.com", DKIMSelectors: []string{"s1"}}
+}
+
+func TestCheckSenderAlignment(t *testing.T) {
+	// The organizational domain's DMARC policy covers subdomains
+	problems := CheckSenderAlignment(alignedResolver(), sender())
+	test.AssertEquals(t, len(problems), 0)
+
+	for _, c := range []struct {
+		change  func(*txtResolver, *Sender)
+		problem string
+	}{
+		{func(r *txtResolver, s *Sender) { delete(r.records, "mail.example.com") }, "gives none"},
+		{func(r *txtResolver, s *Sender) {
+			r.records["mail.example.com"] = []string{"v=spf1 -all", "v=spf1 a -all"}
+		}, "2 SPF records"},
+		{func(r *txtResolver, s *Sender) { r.broken["mail.example.com"] = true }, "gives temperror"},
+		{func(r *txtResolver, s *Sender) { s.Relay = "192.0.2.9" }, "gives fail for relay 192.0.2.9"},
+		{func(r *txtResolver, s *Sender) { r.broken["smtp.example.com"] = true }, "Couldn't look up addresses of relay"},
+		{func(r *txtResolver, s *Sender) { s.DKIMSelectors = append(s.DKIMSelectors, "s2") }, "No DKIM key published at s2._domainkey.mail.example.com"},
+		{func(r *txtResolver, s *Sender) { s.DKIMSelectors = append(s.DKIMSelectors, "revoked") }, "No DKIM key published"},
+		{func(r *txtResolver, s *Sender) { delete(r.records, "_dmarc.example.com") }, "has no DMARC policy"},
+		{func(r *txtResolver, s *Sender) { r.broken["_dmarc.mail.example.com"] = true }, "Couldn't look up DMARC"},
+		{func(r *txtResolver, s *Sender) { s.From = "certs" }, "has no domain"},
+		{func(r *txtResolver, s *Sender) {
+			r.records["_dmarc.example.com"] = []string{"v=DMARC1; p=reject; adkim=s"}
+			r.records["s1._domainkey.example.com"] = []string{"v=DKIM1; p=MIGf"}
+			s.DKIMDomain = "example.com"
+		}, "DKIM domain example.com isn't aligned with mail.example.com under the strict DKIM alignment"},
+		{func(r *txtResolver, s *Sender) {
+			r.records["s1._domainkey.example.net"] = []string{"v=DKIM1; p=MIGf"}
+			s.DKIMDomain = "example.net"
+		}, "DKIM domain example.net isn't aligned with mail.example.com under the relaxed DKIM alignment"},
+		{func(r *txtResolver, s *Sender) {
+			r.records["_dmarc.example.com"] = []string{"v=DMARC1; p=reject; aspf=s"}
+			r.records["bounces.example.com"] = r.records["mail.example.com"]
+			s.Envelope = "bounces@bounces.example.com"
+		}, "Envelope domain bounces.example.com isn't aligned with mail.example.com under the strict SPF alignment"},
+	} {
+		r := alignedResolver()
+		s := sender()
+		c.change(r, &s)
+		problems := CheckSenderAlignment(r, s)
+		if len(problems) != 1 {
+			t.Errorf("Expected problem containing %s, got %q", c.problem, problems)
+			continue
+		}
+		test.Assert(t, strings.Contains(problems[0], c.problem), "Expected problem containing "+c.problem+", got "+problems[0])
+	}
+
+	// Under relaxed alignment, a subdomain of the same organizational
+	// domain is aligned
+	r := alignedResolver()
+	s := sender()
+	r.records["s1._domainkey.example.com"] = []string{"v=DKIM1; p=MIGf"}
+	r.records["bounces.example.com"] = r.records["mail.example.com"]
+	s.DKIMDomain = "example.com"
+	s.Envelope = "bounces@bounces.example.com"
+	test.AssertEquals(t, len(CheckSenderAlignment(r, s)), 0)
+}
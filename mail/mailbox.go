@@ -0,0 +1,40 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mail
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// MailboxTokens derives the half of an email-reply-00 challenge's token that
+// is mailed to the address being validated. Deriving it, rather than storing
+// it with the challenge, keeps it out of the ACME API: only someone who
+// receives mail at the address learns it. The RA mails the tokens and the VA
+// checks them, so both need the same secret.
+type MailboxTokens struct {
+	secret []byte
+}
+
+// NewMailboxTokens constructs a MailboxTokens that derives tokens with
+// secret.
+func NewMailboxTokens(secret []byte) (*MailboxTokens, error) {
+	if len(secret) < 16 {
+		return nil, errors.New("Mailbox token secret must be at least 16 bytes")
+	}
+	return &MailboxTokens{secret: secret}, nil
+}
+
+// Token returns the token mailed to address for the challenge with the
+// given token. It is the size of a challenge token.
+func (mt *MailboxTokens) Token(address, challengeToken string) string {
+	mac := hmac.New(sha256.New, mt.secret)
+	fmt.Fprintf(mac, "%s\n%s", address, challengeToken)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,28 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mail
+
+import (
+	"testing"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestMailboxTokens(t *testing.T) {
+	_, err := NewMailboxTokens([]byte("short"))
+	test.AssertError(t, err, "Accepted a short secret")
+
+	mt, err := NewMailboxTokens([]byte("0123456789abcdef"))
+	test.AssertNotError(t, err, "Failed to create mailbox tokens")
+	token := mt.Token("alice@example.com", "challenge-token")
+	test.AssertEquals(t, len(token), 43)
+	test.AssertEquals(t, mt.Token("alice@example.com", "challenge-token"), token)
+	test.Assert(t, mt.Token("bob@example.com", "challenge-token") != token, "Tokens for different addresses should differ")
+	test.Assert(t, mt.Token("alice@example.com", "other-token") != token, "Tokens for different challenges should differ")
+
+	other, _ := NewMailboxTokens([]byte("fedcba9876543210"))
+	test.Assert(t, other.Token("alice@example.com", "challenge-token") != token, "Tokens with different secrets should differ")
+}
@@ -0,0 +1,252 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mail
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
+	"github.com/letsencrypt/boulder/bdns"
+)
+
+// spfMaxLookups is the most terms that query DNS, such as include and mx,
+// that evaluating an SPF record may take, counting those of the records it
+// includes (RFC 7208 section 4.6.4).
+const spfMaxLookups = 10
+
+// spfResult is the result of evaluating an SPF record (RFC 7208 section 2.6)
+type spfResult string
+
+// The results of evaluating an SPF record
+const (
+	spfPass      = spfResult("pass")
+	spfFail      = spfResult("fail")
+	spfSoftFail  = spfResult("softfail")
+	spfNeutral   = spfResult("neutral")
+	spfNone      = spfResult("none")
+	spfPermError = spfResult("permerror")
+	spfTempError = spfResult("temperror")
+)
+
+// spfChecker evaluates SPF records as receivers do, except that macros and
+// the exists and ptr mechanisms, which senders seldom need, are permanent
+// errors.
+type spfChecker struct {
+	resolver bdns.DNSResolver
+	lookups  int
+}
+
+// checkSPF returns the result of evaluating the SPF record of domain for
+// mail relayed from ip, and for any result but pass, why.
+func checkSPF(resolver bdns.DNSResolver, ip net.IP, domain string) (spfResult, string) {
+	c := &spfChecker{resolver: resolver}
+	return c.check(ip, domain)
+}
+
+func (c *spfChecker) check(ip net.IP, domain string) (spfResult, string) {
+	records, err := recordsWithPrefix(c.resolver, domain, "v=spf1")
+	switch {
+	case err != nil:
+		return spfTempError, fmt.Sprintf("couldn't look up SPF record of %s: %s", domain, err)
+	case len(records) == 0:
+		return spfNone, fmt.Sprintf("%s has no SPF record", domain)
+	case len(records) > 1:
+		return spfPermError, fmt.Sprintf("%s has %d SPF records, which receivers treat as an error", domain, len(records))
+	}
+
+	var redirect string
+	for _, term := range strings.Fields(records[0])[1:] {
+		if strings.Contains(term, "%") {
+			return spfPermError, fmt.Sprintf("SPF record of %s uses macros, which aren't checked", domain)
+		}
+		if eq := strings.Index(term, "="); eq >= 0 && strings.IndexAny(term[:eq], ":/") < 0 {
+			// A modifier. Those other than redirect don't affect the result.
+			if strings.EqualFold(term[:eq], "redirect") {
+				redirect = term[eq+1:]
+			}
+			continue
+		}
+
+		qualifier := spfPass
+		switch term[0] {
+		case '+':
+			term = term[1:]
+		case '-':
+			qualifier, term = spfFail, term[1:]
+		case '~':
+			qualifier, term = spfSoftFail, term[1:]
+		case '?':
+			qualifier, term = spfNeutral, term[1:]
+		}
+		matched, result, detail := c.matches(ip, domain, term)
+		if result != "" {
+			return result, detail
+		}
+		if matched {
+			return qualifier, fmt.Sprintf("%s matches %q in the SPF record of %s", ip, term, domain)
+		}
+	}
+
+	if redirect != "" {
+		if result, detail := c.countLookup(domain); result != "" {
+			return result, detail
+		}
+		result, detail := c.check(ip, redirect)
+		if result == spfNone {
+			return spfPermError, fmt.Sprintf("SPF record of %s redirects to %s, which has none", domain, redirect)
+		}
+		return result, detail
+	}
+	return spfNeutral, fmt.Sprintf("%s matches nothing in the SPF record of %s", ip, domain)
+}
+
+// countLookup counts a term of domain's record that queries DNS, returning
+// a permanent error if there are too many.
+func (c *spfChecker) countLookup(domain string) (spfResult, string) {
+	c.lookups++
+	if c.lookups > spfMaxLookups {
+		return spfPermError, fmt.Sprintf("SPF record of %s takes more than %d DNS lookups", domain, spfMaxLookups)
+	}
+	return "", ""
+}
+
+// matches returns whether ip matches the mechanism term of the SPF record of
+// domain or, if the mechanism can't be evaluated, the result and why.
+func (c *spfChecker) matches(ip net.IP, domain, term string) (bool, spfResult, string) {
+	name, arg := term, ""
+	if i := strings.IndexAny(term, ":/"); i >= 0 {
+		name, arg = term[:i], term[i:]
+	}
+	invalid := fmt.Sprintf("SPF record of %s has invalid term %q", domain, term)
+
+	switch strings.ToLower(name) {
+	case "all":
+		return true, "", ""
+
+	case "ip4", "ip6":
+		spec := strings.TrimPrefix(arg, ":")
+		if !strings.Contains(spec, "/") {
+			if strings.EqualFold(name, "ip4") {
+				spec += "/32"
+			} else {
+				spec += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(spec)
+		if err != nil {
+			return false, spfPermError, invalid
+		}
+		return network.Contains(ip), "", ""
+
+	case "a", "mx":
+		target, prefix4, prefix6, ok := parseDomainSpec(arg, domain)
+		if !ok {
+			return false, spfPermError, invalid
+		}
+		if result, detail := c.countLookup(domain); result != "" {
+			return false, result, detail
+		}
+		hosts := []string{target}
+		if strings.EqualFold(name, "mx") {
+			var err error
+			hosts, err = c.resolver.LookupMX(target)
+			if err != nil && !isNameError(err) {
+				return false, spfTempError, fmt.Sprintf("couldn't look up MX of %s: %s", target, err)
+			}
+			if len(hosts) > spfMaxLookups {
+				return false, spfPermError, fmt.Sprintf("%s has more than %d MX records", target, spfMaxLookups)
+			}
+		}
+		for _, host := range hosts {
+			addrs, err := c.resolver.LookupHost(strings.TrimSuffix(host, "."))
+			if err != nil && !isNameError(err) {
+				return false, spfTempError, fmt.Sprintf("couldn't look up addresses of %s: %s", host, err)
+			}
+			for _, addr := range addrs {
+				prefix, bits := prefix6, 128
+				if addr.To4() != nil {
+					prefix, bits = prefix4, 32
+				}
+				network := net.IPNet{IP: addr, Mask: net.CIDRMask(prefix, bits)}
+				if (addr.To4() != nil) == (ip.To4() != nil) && network.Contains(ip) {
+					return true, "", ""
+				}
+			}
+		}
+		return false, "", ""
+
+	case "include":
+		target := strings.TrimPrefix(arg, ":")
+		if target == "" || target == arg {
+			return false, spfPermError, invalid
+		}
+		if result, detail := c.countLookup(domain); result != "" {
+			return false, result, detail
+		}
+		switch result, detail := c.check(ip, target); result {
+		case spfPass:
+			return true, "", ""
+		case spfFail, spfSoftFail, spfNeutral:
+			return false, "", ""
+		case spfNone:
+			return false, spfPermError, fmt.Sprintf("SPF record of %s includes %s, which has none", domain, target)
+		default:
+			return false, result, detail
+		}
+
+	case "exists", "ptr":
+		return false, spfPermError, fmt.Sprintf("SPF record of %s uses %s, which isn't checked", domain, name)
+	}
+	return false, spfPermError, invalid
+}
+
+// parseDomainSpec parses the argument of an a or mx mechanism: an optional
+// ":domain", which defaults to domain, and optional "/prefix4" and
+// "//prefix6" lengths, which default to whole addresses.
+func parseDomainSpec(arg, domain string) (target string, prefix4, prefix6 int, ok bool) {
+	target, prefix4, prefix6 = domain, 32, 128
+	if strings.HasPrefix(arg, ":") {
+		end := strings.Index(arg, "/")
+		if end < 0 {
+			end = len(arg)
+		}
+		target, arg = arg[1:end], arg[end:]
+		if target == "" {
+			return "", 0, 0, false
+		}
+	}
+	cidr4, cidr6 := arg, ""
+	if i := strings.Index(arg, "//"); i >= 0 {
+		cidr4, cidr6 = arg[:i], arg[i+2:]
+		if !validPrefix(cidr6, 128, &prefix6) {
+			return "", 0, 0, false
+		}
+	}
+	if cidr4 != "" && !validPrefix(strings.TrimPrefix(cidr4, "/"), 32, &prefix4) {
+		return "", 0, 0, false
+	}
+	return target, prefix4, prefix6, true
+}
+
+// validPrefix parses a prefix length of at most max into prefix.
+func validPrefix(s string, max int, prefix *int) bool {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > max {
+		return false
+	}
+	*prefix = n
+	return true
+}
+
+// isNameError returns whether err is from a name not existing, which SPF
+// treats as a name with no records.
+func isNameError(err error) bool {
+	rcodeErr, ok := err.(*bdns.RcodeError)
+	return ok && rcodeErr.Rcode == dns.RcodeNameError
+}
@@ -0,0 +1,87 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mail
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestCheckSPF(t *testing.T) {
+	r := &txtResolver{
+		records: map[string][]string{
+			"example.com":          {"v=spf1 mx a:web.example.com/24 ip6:2001:db8::/32 include:_spf.example.net ~all"},
+			"_spf.example.net":     {"v=spf1 ip4:203.0.113.0/24 ?ip4:203.0.114.1 -all"},
+			"redirect.example":     {"v=spf1 redirect=example.com"},
+			"neutral.example":      {"v=spf1 ip4:192.0.2.1"},
+			"macro.example":        {"v=spf1 exists:%{i}.spf.example -all"},
+			"ptr.example":          {"v=spf1 ptr -all"},
+			"dangling.example":     {"v=spf1 include:nothing.example -all"},
+			"badcidr.example":      {"v=spf1 a/33 -all"},
+			"brokeninc.example":    {"v=spf1 include:broken.example -all"},
+			"loop.example":         {"v=spf1 include:loop.example -all"},
+			"dualcidr.example":     {"v=spf1 a:web.example.com//64 a:web.example.com/28//64 -all"},
+			"nxmx.example":         {"v=spf1 mx a:gone.example -all"},
+			"web.example.com":      {},
+			"broken.example":       {},
+			"nothing.example":      {},
+			"twospf.example":       {"v=spf1 -all", "v=spf1 +all"},
+			"casing.example":       {"V=SPF1 IP4:192.0.2.7 -ALL"},
+			"modifier.example":     {"v=spf1 exp=explain.example ip4:192.0.2.8 -all"},
+			"plus.example":         {"v=spf1 +ip4:192.0.2.9 -all"},
+			"emptyinclude.example": {"v=spf1 include: -all"},
+		},
+		hosts: map[string][]net.IP{
+			"mx1.example.com": {net.ParseIP("192.0.2.10")},
+			"web.example.com": {net.ParseIP("198.51.100.1")},
+		},
+		mxs:    map[string][]string{"example.com": {"mx1.example.com."}},
+		broken: map[string]bool{"broken.example": true},
+	}
+	delete(r.records, "nothing.example")
+
+	for _, c := range []struct {
+		ip     string
+		domain string
+		result spfResult
+	}{
+		{"192.0.2.10", "example.com", spfPass},
+		{"198.51.100.77", "example.com", spfPass},
+		{"2001:db8::1", "example.com", spfPass},
+		{"203.0.113.9", "example.com", spfPass},
+		{"203.0.114.1", "example.com", spfSoftFail},
+		{"192.0.2.11", "example.com", spfSoftFail},
+		{"192.0.2.10", "redirect.example", spfPass},
+		{"192.0.2.11", "redirect.example", spfSoftFail},
+		{"192.0.2.2", "neutral.example", spfNeutral},
+		{"192.0.2.1", "neutral.example", spfPass},
+		{"192.0.2.1", "macro.example", spfPermError},
+		{"192.0.2.1", "ptr.example", spfPermError},
+		{"192.0.2.1", "dangling.example", spfPermError},
+		{"192.0.2.1", "badcidr.example", spfPermError},
+		{"192.0.2.1", "brokeninc.example", spfTempError},
+		{"192.0.2.1", "loop.example", spfPermError},
+		{"198.51.100.1", "dualcidr.example", spfPass},
+		{"198.51.100.14", "dualcidr.example", spfPass},
+		{"198.51.100.16", "dualcidr.example", spfFail},
+		{"192.0.2.1", "nxmx.example", spfFail},
+		{"192.0.2.1", "nothing.example", spfNone},
+		{"192.0.2.1", "twospf.example", spfPermError},
+		{"192.0.2.7", "casing.example", spfPass},
+		{"192.0.2.8", "modifier.example", spfPass},
+		{"192.0.2.9", "plus.example", spfPass},
+		{"192.0.2.9", "emptyinclude.example", spfPermError},
+	} {
+		result, detail := checkSPF(r, net.ParseIP(c.ip), c.domain)
+		test.AssertEquals(t, result, c.result)
+		if result != c.result {
+			t.Log(fmt.Sprintf("%s for %s: %s", c.domain, c.ip, detail))
+		}
+	}
+}
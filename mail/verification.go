@@ -0,0 +1,94 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mail
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+)
+
+// VerificationPath is the path, relative to the ACME server's base URL, at
+// which the WFE serves verification links.
+const VerificationPath = "/acme/verify-contact"
+
+// ErrInvalidVerificationLink is returned for verification links that were not
+// made by a ContactVerifier with the same secret, or that have been altered.
+var ErrInvalidVerificationLink = errors.New("Invalid verification link")
+
+// ErrExpiredVerificationLink is returned for verification links past their
+// expiry.
+var ErrExpiredVerificationLink = errors.New("Expired verification link")
+
+// ContactVerifier makes and checks the signed links that registration
+// contacts follow to show that they receive mail at their address. The RA
+// makes the links and the WFE checks them, so both need the same secret.
+type ContactVerifier struct {
+	secret   []byte
+	linkBase string
+	lifetime time.Duration
+	clk      clock.Clock
+}
+
+// NewContactVerifier constructs a ContactVerifier whose links point at the
+// ACME server with the given base URL and stay valid for lifetime.
+func NewContactVerifier(secret []byte, baseURL string, lifetime time.Duration, clk clock.Clock) (*ContactVerifier, error) {
+	if len(secret) < 16 {
+		return nil, errors.New("Contact verification secret must be at least 16 bytes")
+	}
+	return &ContactVerifier{
+		secret:   secret,
+		linkBase: baseURL + VerificationPath,
+		lifetime: lifetime,
+		clk:      clk,
+	}, nil
+}
+
+func (cv *ContactVerifier) signature(regID int64, contact string, expires int64) string {
+	mac := hmac.New(sha256.New, cv.secret)
+	fmt.Fprintf(mac, "%d\n%s\n%d", regID, contact, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Link returns a link that verifies contact for the registration regID.
+func (cv *ContactVerifier) Link(regID int64, contact string) string {
+	expires := cv.clk.Now().Add(cv.lifetime).Unix()
+	query := url.Values{}
+	query.Set("reg", strconv.FormatInt(regID, 10))
+	query.Set("contact", contact)
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("sig", cv.signature(regID, contact, expires))
+	return cv.linkBase + "?" + query.Encode()
+}
+
+// Verify checks the query of a link made by Link, and returns the
+// registration ID and contact it verifies.
+func (cv *ContactVerifier) Verify(query url.Values) (int64, string, error) {
+	regID, err := strconv.ParseInt(query.Get("reg"), 10, 64)
+	if err != nil {
+		return 0, "", ErrInvalidVerificationLink
+	}
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return 0, "", ErrInvalidVerificationLink
+	}
+	contact := query.Get("contact")
+	expected := cv.signature(regID, contact, expires)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("sig"))) {
+		return 0, "", ErrInvalidVerificationLink
+	}
+	if cv.clk.Now().Unix() > expires {
+		return 0, "", ErrExpiredVerificationLink
+	}
+	return regID, contact, nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mail
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestContactVerifier(t *testing.T) {
+	fc := clock.NewFake()
+	_, err := NewContactVerifier([]byte("short"), "", time.Hour, fc)
+	test.AssertError(t, err, "Accepted a short secret")
+
+	cv, err := NewContactVerifier([]byte("0123456789abcdef"), "https://example.com", time.Hour, fc)
+	test.AssertNotError(t, err, "Failed to create verifier")
+
+	link := cv.Link(42, "mailto:person@example.com")
+	test.Assert(t, strings.HasPrefix(link, "https://example.com/acme/verify-contact?"), "Link has the wrong base: "+link)
+	parsed, err := url.Parse(link)
+	test.AssertNotError(t, err, "Failed to parse link")
+
+	regID, contact, err := cv.Verify(parsed.Query())
+	test.AssertNotError(t, err, "Failed to verify link")
+	test.AssertEquals(t, regID, int64(42))
+	test.AssertEquals(t, contact, "mailto:person@example.com")
+
+	// Altered links are rejected
+	for _, field := range []string{"reg", "contact", "expires", "sig"} {
+		query := parsed.Query()
+		query.Set(field, query.Get(field)+"1")
+		_, _, err = cv.Verify(query)
+		test.AssertEquals(t, err, ErrInvalidVerificationLink)
+	}
+
+	// So are links signed with another secret
+	other, _ := NewContactVerifier([]byte("fedcba9876543210"), "https://example.com", time.Hour, fc)
+	_, _, err = other.Verify(parsed.Query())
+	test.AssertEquals(t, err, ErrInvalidVerificationLink)
+
+	// And expired links
+	fc.Add(2 * time.Hour)
+	_, _, err = cv.Verify(parsed.Query())
+	test.AssertEquals(t, err, ErrExpiredVerificationLink)
+}
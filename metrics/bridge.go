@@ -0,0 +1,386 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+)
+
+// The kinds of StatsD metric that are bridged to Prometheus: counters
+// become counters, gauges gauges, and timings histograms in seconds.
+const (
+	KindCounter = "counter"
+	KindGauge   = "gauge"
+	KindTiming  = "timing"
+)
+
+// Mapping names the Prometheus metric that a family of StatsD metrics is
+// bridged to. Pattern matches StatsD names a dot-separated segment at a
+// time, "*" matching any one segment, and the segments matched by each "*"
+// become the values of Labels, in order.
+type Mapping struct {
+	Kind    string
+	Pattern string
+	Name    string
+	Labels  []string
+	Help    string
+}
+
+// match returns the label values of name if it matches the mapping.
+func (m Mapping) match(kind string, segments []string) ([]string, bool) {
+	if kind != m.Kind {
+		return nil, false
+	}
+	pattern := strings.Split(m.Pattern, ".")
+	if len(pattern) != len(segments) {
+		return nil, false
+	}
+	var values []string
+	for i, p := range pattern {
+		if p == "*" {
+			values = append(values, segments[i])
+		} else if p != segments[i] {
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+// DefaultMappings turn the StatsD metrics whose names embed a variable, like
+// an RPC method or a challenge type, into Prometheus metrics labelled with
+// it. Every other StatsD metric is bridged under its converted name; see
+// ConvertName.
+var DefaultMappings = []Mapping{
+	{KindTiming, "VA.Validations.*.*", "va_validation_duration_seconds", []string{"challenge_type", "status"},
+		"Time taken to validate challenges, by challenge type and outcome."},
+	{KindCounter, "VA.Validations.Retries.*", "va_validation_retries_total", []string{"challenge_type"},
+		"Validation attempts retried after transient network errors, by challenge type."},
+	{KindTiming, "RPC.ClientCallLatency.*.*", "rpc_client_call_duration_seconds", []string{"method", "result"},
+		"Time taken by RPC calls, by method and whether they succeeded or timed out."},
+	{KindCounter, "RPC.ClientCallLatency.*.Error", "rpc_client_call_errors_total", []string{"method"},
+		"RPC calls that failed to be sent, by method."},
+	{KindTiming, "RPC.ServerProcessingLatency.*", "rpc_server_processing_duration_seconds", []string{"method"},
+		"Time taken to handle RPC requests, by method."},
+	{KindTiming, "RPC.MessageLag.*", "rpc_message_lag_seconds", []string{"queue"},
+		"Time RPC requests waited in the queue before being handled, by queue."},
+	{KindCounter, "RPC.Traffic.Rx.*", "rpc_received_bytes_total", []string{"queue"},
+		"Bytes of RPC requests received, by queue."},
+	{KindCounter, "RPC.Traffic.Tx.*", "rpc_sent_bytes_total", []string{"queue"},
+		"Bytes of RPC requests sent, by the sender's queue."},
+	{KindCounter, "RPC.CallsDropped.*", "rpc_calls_dropped_total", []string{"queue"},
+		"RPC requests dropped for arriving after their deadline, by queue."},
+	{KindCounter, "RPC.AfterTimeoutResponseArrivals.*", "rpc_late_responses_total", []string{"queue"},
+		"RPC responses that arrived after the call timed out, by client queue."},
+	{KindCounter, "OCSP.*.Ticks", "ocsp_updater_ticks_total", []string{"loop"},
+		"Runs of each OCSP updater loop."},
+	{KindCounter, "OCSP.*.LongTicks", "ocsp_updater_long_ticks_total", []string{"loop"},
+		"Runs of each OCSP updater loop that took longer than their interval."},
+	{KindCounter, "OCSP.*.FailedTicks", "ocsp_updater_failed_ticks_total", []string{"loop"},
+		"Runs of each OCSP updater loop that failed."},
+	{KindTiming, "OCSP.*.TickDuration", "ocsp_updater_tick_duration_seconds", []string{"loop"},
+		"Time taken by runs of each OCSP updater loop."},
+	{KindCounter, "CA.Quota.Exceeded.Profile.*", "ca_quota_exceeded_total", []string{"profile"},
+		"Issuance refused for exceeding a profile's quota, by profile."},
+	{KindCounter, "*.HTTP.Rate", "http_requests_total", []string{"service"},
+		"HTTP requests received, by service."},
+	{KindGauge, "*.HTTP.OpenConnections", "http_open_connections", []string{"service"},
+		"HTTP connections being served, by service, as of the latest request."},
+	{KindGauge, "*.HTTP.ConnectionsInFlight", "http_connections_in_flight", []string{"service"},
+		"HTTP connections being served, by service, as of the latest response."},
+	{KindGauge, "*.Gostats.Goroutines", "go_goroutines", []string{"service"},
+		"Goroutines that exist, by service."},
+	{KindGauge, "*.Gostats.Heap.*", "go_memstats_heap", []string{"service", "stat"},
+		"Heap statistics from runtime.MemStats, by service and statistic."},
+	{KindGauge, "*.Gostats.Gc.*", "go_memstats_gc", []string{"service", "stat"},
+		"Garbage collector statistics from runtime.MemStats, by service and statistic."},
+	{KindCounter, "*.Gostats.Gc.Rate", "go_gc_total", []string{"service"},
+		"Garbage collections run, by service."},
+}
+
+// Bridged is the Prometheus metric a StatsD metric is bridged to.
+type Bridged struct {
+	Name        string
+	Help        string
+	Labels      []string
+	LabelValues []string
+	// Mapped is whether one of the mappings named the metric, rather than
+	// its name being converted from the StatsD one.
+	Mapped bool
+}
+
+// String formats the metric as a Prometheus series.
+func (b Bridged) String() string {
+	var pairs []string
+	for i, label := range b.Labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", label, quoteLabel(b.LabelValues[i])))
+	}
+	if len(pairs) == 0 {
+		return b.Name
+	}
+	return b.Name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Bridge returns the Prometheus metric that the StatsD metric name, of kind,
+// is bridged to: that of the first of mappings it matches, or otherwise its
+// converted name.
+func Bridge(mappings []Mapping, kind, name string) Bridged {
+	segments := strings.Split(name, ".")
+	for _, m := range mappings {
+		if values, ok := m.match(kind, segments); ok {
+			return Bridged{
+				Name:        m.Name,
+				Help:        m.Help,
+				Labels:      m.Labels,
+				LabelValues: values,
+				Mapped:      true,
+			}
+		}
+	}
+	return Bridged{
+		Name: ConvertName(kind, name),
+		Help: fmt.Sprintf("Bridged from the StatsD %s %s.", kind, name),
+	}
+}
+
+// ConvertName converts a StatsD metric name to the Prometheus convention:
+// CamelCase segments become snake_case, joined with underscores, with a
+// suffix for the kind of metric. "RA.NewCertificates" becomes
+// "ra_new_certificates_total" and the timing "WFE.HTTP.Latency"
+// "wfe_http_latency_seconds".
+func ConvertName(kind, name string) string {
+	var out []rune
+	runes := []rune(name)
+	for i, r := range runes {
+		switch {
+		case r < unicode.MaxASCII && unicode.IsUpper(r):
+			// A word starts at an upper case letter after a lower case one
+			// or a digit, or at the last upper case letter of an acronym
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				out = append(out, '_')
+			}
+			out = append(out, unicode.ToLower(r))
+		case r < unicode.MaxASCII && (unicode.IsLower(r) || unicode.IsDigit(r)):
+			out = append(out, r)
+		default:
+			out = append(out, '_')
+		}
+	}
+	converted := string(out)
+	for strings.Contains(converted, "__") {
+		converted = strings.Replace(converted, "__", "_", -1)
+	}
+	converted = strings.Trim(converted, "_")
+	if converted == "" || unicode.IsDigit(rune(converted[0])) {
+		converted = "statsd_" + converted
+	}
+	switch kind {
+	case KindCounter:
+		converted += "_total"
+	case KindTiming:
+		converted += "_seconds"
+	}
+	return converted
+}
+
+// BridgeStatter is a statsd.Statter that, while dashboards move from StatsD
+// to Prometheus, sends metrics to a StatsD Statter, a Prometheus Registry or
+// both. StatsD sets and raw values have no Prometheus equivalent, so are
+// only sent to StatsD, as are decrements of counters.
+type BridgeStatter struct {
+	statter  statsd.Statter
+	registry *Registry
+	mappings []Mapping
+
+	mu         sync.Mutex
+	counters   map[string]*CounterVec
+	gauges     map[string]*GaugeVec
+	histograms map[string]*HistogramVec
+}
+
+var _ statsd.Statter = &BridgeStatter{}
+
+// NewBridgeStatter returns a BridgeStatter that sends metrics to statter,
+// unless it's nil, and registers them, named by mappings, with registry,
+// unless it's nil.
+func NewBridgeStatter(statter statsd.Statter, registry *Registry, mappings []Mapping) *BridgeStatter {
+	return &BridgeStatter{
+		statter:    statter,
+		registry:   registry,
+		mappings:   mappings,
+		counters:   make(map[string]*CounterVec),
+		gauges:     make(map[string]*GaugeVec),
+		histograms: make(map[string]*HistogramVec),
+	}
+}
+
+// The metrics below are registered on first use, and return nil if there's
+// no registry, or if the name a metric is bridged to is already taken by one
+// with other labels.
+
+func (bs *BridgeStatter) counter(stat string) (*CounterVec, []string) {
+	if bs.registry == nil {
+		return nil, nil
+	}
+	b := Bridge(bs.mappings, KindCounter, stat)
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	c, ok := bs.counters[b.Name]
+	if !ok {
+		c = bs.registry.NewCounterVec(b.Name, b.Help, b.Labels...)
+		bs.counters[b.Name] = c
+	}
+	if len(c.labels) != len(b.Labels) {
+		return nil, nil
+	}
+	return c, b.LabelValues
+}
+
+func (bs *BridgeStatter) gauge(stat string) (*GaugeVec, []string) {
+	if bs.registry == nil {
+		return nil, nil
+	}
+	b := Bridge(bs.mappings, KindGauge, stat)
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	g, ok := bs.gauges[b.Name]
+	if !ok {
+		g = bs.registry.NewGaugeVec(b.Name, b.Help, b.Labels...)
+		bs.gauges[b.Name] = g
+	}
+	if len(g.labels) != len(b.Labels) {
+		return nil, nil
+	}
+	return g, b.LabelValues
+}
+
+func (bs *BridgeStatter) histogram(stat string) (*HistogramVec, []string) {
+	if bs.registry == nil {
+		return nil, nil
+	}
+	b := Bridge(bs.mappings, KindTiming, stat)
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	h, ok := bs.histograms[b.Name]
+	if !ok {
+		h = bs.registry.NewHistogramVec(b.Name, b.Help, DefaultLatencyBuckets, b.Labels...)
+		bs.histograms[b.Name] = h
+	}
+	if len(h.labels) != len(b.Labels) {
+		return nil, nil
+	}
+	return h, b.LabelValues
+}
+
+// Inc increments a counter.
+func (bs *BridgeStatter) Inc(stat string, value int64, rate float32) error {
+	if c, labels := bs.counter(stat); c != nil && value > 0 {
+		c.Add(float64(value), labels...)
+	}
+	if bs.statter == nil {
+		return nil
+	}
+	return bs.statter.Inc(stat, value, rate)
+}
+
+// Dec decrements a counter in StatsD only, since Prometheus counters only go
+// up.
+func (bs *BridgeStatter) Dec(stat string, value int64, rate float32) error {
+	if bs.statter == nil {
+		return nil
+	}
+	return bs.statter.Dec(stat, value, rate)
+}
+
+// Gauge sets a gauge.
+func (bs *BridgeStatter) Gauge(stat string, value int64, rate float32) error {
+	if g, labels := bs.gauge(stat); g != nil {
+		g.Set(float64(value), labels...)
+	}
+	if bs.statter == nil {
+		return nil
+	}
+	return bs.statter.Gauge(stat, value, rate)
+}
+
+// GaugeDelta changes a gauge by value.
+func (bs *BridgeStatter) GaugeDelta(stat string, value int64, rate float32) error {
+	if g, labels := bs.gauge(stat); g != nil {
+		g.Add(float64(value), labels...)
+	}
+	if bs.statter == nil {
+		return nil
+	}
+	return bs.statter.GaugeDelta(stat, value, rate)
+}
+
+// Timing records a duration in milliseconds.
+func (bs *BridgeStatter) Timing(stat string, delta int64, rate float32) error {
+	if h, labels := bs.histogram(stat); h != nil {
+		h.Observe(float64(delta)/1000, labels...)
+	}
+	if bs.statter == nil {
+		return nil
+	}
+	return bs.statter.Timing(stat, delta, rate)
+}
+
+// TimingDuration records a duration.
+func (bs *BridgeStatter) TimingDuration(stat string, delta time.Duration, rate float32) error {
+	if h, labels := bs.histogram(stat); h != nil {
+		h.Observe(delta.Seconds(), labels...)
+	}
+	if bs.statter == nil {
+		return nil
+	}
+	return bs.statter.TimingDuration(stat, delta, rate)
+}
+
+// Set adds value to a StatsD set.
+func (bs *BridgeStatter) Set(stat string, value string, rate float32) error {
+	if bs.statter == nil {
+		return nil
+	}
+	return bs.statter.Set(stat, value, rate)
+}
+
+// SetInt adds value to a StatsD set.
+func (bs *BridgeStatter) SetInt(stat string, value int64, rate float32) error {
+	if bs.statter == nil {
+		return nil
+	}
+	return bs.statter.SetInt(stat, value, rate)
+}
+
+// Raw sends a StatsD value without interpretation.
+func (bs *BridgeStatter) Raw(stat string, value string, rate float32) error {
+	if bs.statter == nil {
+		return nil
+	}
+	return bs.statter.Raw(stat, value, rate)
+}
+
+// SetPrefix sets the prefix of StatsD names. Prometheus names are never
+// prefixed.
+func (bs *BridgeStatter) SetPrefix(prefix string) {
+	if bs.statter != nil {
+		bs.statter.SetPrefix(prefix)
+	}
+}
+
+// Close closes the StatsD Statter.
+func (bs *BridgeStatter) Close() error {
+	if bs.statter == nil {
+		return nil
+	}
+	return bs.statter.Close()
+}
@@ -0,0 +1,107 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/golang/mock/gomock"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestConvertName(t *testing.T) {
+	testCases := []struct {
+		kind, name, converted string
+	}{
+		{KindCounter, "RA.NewCertificates", "ra_new_certificates_total"},
+		{KindCounter, "VA.IsSafeDomain.Status.Good", "va_is_safe_domain_status_good_total"},
+		{KindCounter, "OCSPVerifier.Divergent", "ocsp_verifier_divergent_total"},
+		{KindTiming, "WFE.HTTP.Latency", "wfe_http_latency_seconds"},
+		{KindGauge, "SA.Gostats.Heap.InUse", "sa_gostats_heap_in_use"},
+		{KindCounter, "CA.Profile.tls-server.Issued", "ca_profile_tls_server_issued_total"},
+		{KindCounter, "Rate", "rate_total"},
+		{KindGauge, "2xx..Responses", "statsd_2xx_responses"},
+	}
+	for _, tc := range testCases {
+		test.AssertEquals(t, ConvertName(tc.kind, tc.name), tc.converted)
+	}
+}
+
+func TestBridge(t *testing.T) {
+	b := Bridge(DefaultMappings, KindTiming, "VA.Validations.http-01.valid")
+	test.Assert(t, b.Mapped, "Validation timing wasn't mapped")
+	test.AssertEquals(t, b.String(), `va_validation_duration_seconds{challenge_type="http-01",status="valid"}`)
+
+	// Mappings only apply to their kind of metric
+	b = Bridge(DefaultMappings, KindCounter, "VA.Validations.Retries.dns-01")
+	test.AssertEquals(t, b.String(), `va_validation_retries_total{challenge_type="dns-01"}`)
+	b = Bridge(DefaultMappings, KindCounter, "VA.Validations.DeadlineExceeded")
+	test.Assert(t, !b.Mapped, "Unmapped counter was mapped")
+	test.AssertEquals(t, b.String(), "va_validations_deadline_exceeded_total")
+
+	// Every default mapping names a metric of its own, with a label per
+	// wildcard
+	seen := make(map[string]bool)
+	for _, m := range DefaultMappings {
+		test.Assert(t, !seen[m.Name], "Two mappings to "+m.Name)
+		seen[m.Name] = true
+		test.AssertEquals(t, strings.Count(m.Pattern, "*"), len(m.Labels))
+		test.Assert(t, m.Help != "", "No help for "+m.Name)
+	}
+}
+
+func TestBridgeStatter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	statter := NewMockStatter(ctrl)
+	registry := NewRegistry()
+	bs := NewBridgeStatter(statter, registry, DefaultMappings)
+
+	statter.EXPECT().Inc("RA.NewCertificates", int64(2), float32(1.0)).Return(nil)
+	bs.Inc("RA.NewCertificates", 2, 1.0)
+	statter.EXPECT().Inc("RA.NewCertificates", int64(1), float32(1.0)).Return(nil)
+	bs.Inc("RA.NewCertificates", 1, 1.0)
+	statter.EXPECT().Gauge("WFE.Gostats.Goroutines", int64(12), float32(1.0)).Return(nil)
+	bs.Gauge("WFE.Gostats.Goroutines", 12, 1.0)
+	statter.EXPECT().GaugeDelta("WFE.Gostats.Goroutines", int64(-2), float32(1.0)).Return(nil)
+	bs.GaugeDelta("WFE.Gostats.Goroutines", -2, 1.0)
+	statter.EXPECT().TimingDuration("VA.Validations.dns-01.valid", 200*time.Millisecond, float32(1.0)).Return(nil)
+	bs.TimingDuration("VA.Validations.dns-01.valid", 200*time.Millisecond, 1.0)
+	statter.EXPECT().Timing("VA.Validations.dns-01.valid", int64(2000), float32(1.0)).Return(nil)
+	bs.Timing("VA.Validations.dns-01.valid", 2000, 1.0)
+	statter.EXPECT().Set("RA.Users", "alice", float32(1.0)).Return(nil)
+	bs.Set("RA.Users", "alice", 1.0)
+
+	rw := httptest.NewRecorder()
+	registry.ServeHTTP(rw, &http.Request{Method: "GET"})
+	body := rw.Body.String()
+	for _, line := range []string{
+		"ra_new_certificates_total 3\n",
+		`go_goroutines{service="WFE"} 10` + "\n",
+		`va_validation_duration_seconds_bucket{challenge_type="dns-01",status="valid",le="0.25"} 1` + "\n",
+		`va_validation_duration_seconds_bucket{challenge_type="dns-01",status="valid",le="2.5"} 2` + "\n",
+		`va_validation_duration_seconds_count{challenge_type="dns-01",status="valid"} 2` + "\n",
+	} {
+		test.AssertContains(t, body, line)
+	}
+	test.Assert(t, !strings.Contains(body, "users"), "StatsD set was bridged")
+
+	// With StatsD disabled, metrics only go to Prometheus
+	registry = NewRegistry()
+	bs = NewBridgeStatter(nil, registry, DefaultMappings)
+	test.AssertNotError(t, bs.Inc("RA.NewCertificates", 1, 1.0), "Inc failed")
+	test.AssertNotError(t, bs.Close(), "Close failed")
+
+	// With Prometheus disabled, only to StatsD
+	bs = NewBridgeStatter(statter, nil, DefaultMappings)
+	statter.EXPECT().Inc("RA.NewCertificates", int64(1), float32(1.0)).Return(nil)
+	bs.Inc("RA.NewCertificates", 1, 1.0)
+}
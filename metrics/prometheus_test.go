@@ -0,0 +1,49 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("requests_total", "Requests served.", "endpoint", "code")
+	latency := r.NewHistogramVec("latency_seconds", "Request latency.", []float64{0.1, 1}, "endpoint")
+
+	requests.Inc("/b", "200")
+	requests.Inc("/a", "404")
+	requests.Inc("/b", "200")
+	requests.Inc(`/"q"`, "200")
+	latency.Observe(0.05, "/a")
+	latency.Observe(0.5, "/a")
+	latency.Observe(5, "/a")
+
+	test.AssertEquals(t, requests.Value("/b", "200"), float64(2))
+	test.AssertEquals(t, requests.Value("/c", "200"), float64(0))
+	test.AssertEquals(t, latency.Count("/a"), uint64(3))
+
+	rw := httptest.NewRecorder()
+	r.ServeHTTP(rw, &http.Request{Method: "GET"})
+	test.AssertEquals(t, rw.Header().Get("Content-Type"), "text/plain; version=0.0.4")
+	test.AssertEquals(t, rw.Body.String(), `# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{endpoint="/\"q\"",code="200"} 1
+requests_total{endpoint="/a",code="404"} 1
+requests_total{endpoint="/b",code="200"} 2
+# HELP latency_seconds Request latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{endpoint="/a",le="0.1"} 1
+latency_seconds_bucket{endpoint="/a",le="1"} 2
+latency_seconds_bucket{endpoint="/a",le="+Inf"} 3
+latency_seconds_sum{endpoint="/a"} 5.55
+latency_seconds_count{endpoint="/a"} 3
+`)
+}
@@ -6,6 +6,7 @@
 package mocks
 
 import (
+	"context"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
@@ -22,10 +23,13 @@ import (
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/ocsp"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cloudflare/cfssl/signer"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
-	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
 
 	"github.com/letsencrypt/boulder/core"
+	berrors "github.com/letsencrypt/boulder/errors"
+	"github.com/letsencrypt/boulder/identifier"
+	"github.com/letsencrypt/boulder/probs"
 )
 
 // DNSResolver is a mock
@@ -98,6 +102,14 @@ func (mock *DNSResolver) LookupCAA(domain string) ([]*dns.CAA, error) {
 		record.Tag = "issue"
 		record.Value = "letsencrypt.org"
 		results = append(results, &record)
+	case "accounturi.com":
+		record.Tag = "issue"
+		record.Value = "letsencrypt.org; accounturi=https://letsencrypt.org/acme/reg/123"
+		results = append(results, &record)
+	case "validationmethods.com":
+		record.Tag = "issue"
+		record.Value = "letsencrypt.org; validationmethods=dns-01,tls-sni-01"
+		results = append(results, &record)
 	case "com":
 		// Nothing should ever call this, since CAA checking should stop when it
 		// reaches a public suffix.
@@ -155,10 +167,10 @@ const (
 )
 
 // GetRegistration is a mock
-func (sa *StorageAuthority) GetRegistration(id int64) (core.Registration, error) {
+func (sa *StorageAuthority) GetRegistration(ctx context.Context, id int64) (core.Registration, error) {
 	if id == 100 {
 		// Tag meaning "Missing"
-		return core.Registration{}, errors.New("missing")
+		return core.Registration{}, core.NoSuchRegistrationError("missing")
 	}
 	if id == 101 {
 		// Tag meaning "Malformed"
@@ -166,7 +178,7 @@ func (sa *StorageAuthority) GetRegistration(id int64) (core.Registration, error)
 	}
 
 	keyJSON := []byte(test1KeyPublicJSON)
-	var parsedKey jose.JsonWebKey
+	var parsedKey jose.JSONWebKey
 	parsedKey.UnmarshalJSON(keyJSON)
 
 	return core.Registration{
@@ -179,9 +191,9 @@ func (sa *StorageAuthority) GetRegistration(id int64) (core.Registration, error)
 }
 
 // GetRegistrationByKey is a mock
-func (sa *StorageAuthority) GetRegistrationByKey(jwk jose.JsonWebKey) (core.Registration, error) {
-	var test1KeyPublic jose.JsonWebKey
-	var test2KeyPublic jose.JsonWebKey
+func (sa *StorageAuthority) GetRegistrationByKey(ctx context.Context, jwk jose.JSONWebKey) (core.Registration, error) {
+	var test1KeyPublic jose.JSONWebKey
+	var test2KeyPublic jose.JSONWebKey
 	test1KeyPublic.UnmarshalJSON([]byte(test1KeyPublicJSON))
 	test2KeyPublic.UnmarshalJSON([]byte(test2KeyPublicJSON))
 
@@ -199,12 +211,12 @@ func (sa *StorageAuthority) GetRegistrationByKey(jwk jose.JsonWebKey) (core.Regi
 }
 
 // GetAuthorization is a mock
-func (sa *StorageAuthority) GetAuthorization(id string) (core.Authorization, error) {
+func (sa *StorageAuthority) GetAuthorization(ctx context.Context, id string) (core.Authorization, error) {
 	authz := core.Authorization{
 		ID:             "valid",
 		Status:         core.StatusValid,
 		RegistrationID: 1,
-		Identifier:     core.AcmeIdentifier{Type: "dns", Value: "not-an-example.com"},
+		Identifier:     identifier.ACMEIdentifier{Type: "dns", Value: "not-an-example.com"},
 		Challenges: []core.Challenge{
 			core.Challenge{
 				ID:   23,
@@ -223,13 +235,23 @@ func (sa *StorageAuthority) GetAuthorization(id string) (core.Authorization, err
 		authz.Expires = &exp
 		authz.Challenges[0].URI = "http://localhost:4300/acme/challenge/expired/23"
 		return authz, nil
+	} else if id == "processing" {
+		// A response has been submitted and is being validated
+		exp := sa.clk.Now().AddDate(100, 0, 0)
+		authz.ID = id
+		authz.Expires = &exp
+		authz.Status = core.StatusPending
+		authz.Challenges[0].Status = core.StatusPending
+		authz.Challenges[0].KeyAuthorization = &core.KeyAuthorization{Token: "token", Thumbprint: "thumbprint"}
+		authz.Challenges[0].URI = "http://localhost:4300/acme/challenge/processing/23"
+		return authz, nil
 	}
 
-	return core.Authorization{}, fmt.Errorf("authz not found")
+	return core.Authorization{}, berrors.NotFoundError("authz not found")
 }
 
 // GetCertificate is a mock
-func (sa *StorageAuthority) GetCertificate(serial string) (core.Certificate, error) {
+func (sa *StorageAuthority) GetCertificate(ctx context.Context, serial string) (core.Certificate, error) {
 	// Serial ee == 238.crt
 	if serial == "0000000000000000000000000000000000ee" {
 		certPemBytes, _ := ioutil.ReadFile("test/238.crt")
@@ -246,12 +268,38 @@ func (sa *StorageAuthority) GetCertificate(serial string) (core.Certificate, err
 			DER:            certBlock.Bytes,
 		}, nil
 	} else {
-		return core.Certificate{}, errors.New("No cert")
+		return core.Certificate{}, berrors.NotFoundError("No cert")
+	}
+}
+
+// GetCertificatesByRegistration is a mock
+func (sa *StorageAuthority) GetCertificatesByRegistration(ctx context.Context, regID int64, offset, limit int) ([]core.Certificate, error) {
+	if regID != 1 {
+		return nil, nil
+	}
+	var certs []core.Certificate
+	for _, serial := range []string{"0000000000000000000000000000000000ee", "0000000000000000000000000000000000b2"} {
+		cert, _ := sa.GetCertificate(ctx, serial)
+		cert.Serial = serial
+		certs = append(certs, cert)
+	}
+	if offset >= len(certs) {
+		return nil, nil
+	}
+	certs = certs[offset:]
+	if len(certs) > limit {
+		certs = certs[:limit]
 	}
+	return certs, nil
+}
+
+// GetCertificateIssuer is a mock, recording no certificate's issuer
+func (sa *StorageAuthority) GetCertificateIssuer(ctx context.Context, serial string) (string, error) {
+	return "", berrors.NotFoundError("No issuer recorded")
 }
 
 // GetCertificateStatus is a mock
-func (sa *StorageAuthority) GetCertificateStatus(serial string) (core.CertificateStatus, error) {
+func (sa *StorageAuthority) GetCertificateStatus(ctx context.Context, serial string) (core.CertificateStatus, error) {
 	// Serial ee == 238.crt
 	if serial == "0000000000000000000000000000000000ee" {
 		return core.CertificateStatus{
@@ -262,96 +310,270 @@ func (sa *StorageAuthority) GetCertificateStatus(serial string) (core.Certificat
 			Status: core.OCSPStatusRevoked,
 		}, nil
 	} else {
-		return core.CertificateStatus{}, errors.New("No cert status")
+		return core.CertificateStatus{}, berrors.NotFoundError("No cert status")
 	}
 }
 
 // AlreadyDeniedCSR is a mock
-func (sa *StorageAuthority) AlreadyDeniedCSR([]string) (bool, error) {
+func (sa *StorageAuthority) AlreadyDeniedCSR(context.Context, []string) (bool, error) {
+	return false, nil
+}
+
+// GetRateLimitOverrides is a mock
+func (sa *StorageAuthority) GetRateLimitOverrides(context.Context) ([]core.RateLimitOverride, error) {
+	return nil, nil
+}
+
+// GetPendingReviewAuthorizations is a mock
+func (sa *StorageAuthority) GetPendingReviewAuthorizations(context.Context, time.Time) ([]core.Authorization, error) {
+	return nil, nil
+}
+
+// SetRateLimitOverride is a mock
+func (sa *StorageAuthority) SetRateLimitOverride(context.Context, core.RateLimitOverride) error {
+	return nil
+}
+
+// RemoveRateLimitOverride is a mock
+func (sa *StorageAuthority) RemoveRateLimitOverride(context.Context, string, string, int64) error {
+	return nil
+}
+
+// AddDeniedCSR is a mock
+func (sa *StorageAuthority) AddDeniedCSR(context.Context, []string) error {
+	return nil
+}
+
+// GetSerialsByKeyHash is a mock
+func (sa *StorageAuthority) GetSerialsByKeyHash(ctx context.Context, keyHash string) ([]string, error) {
+	return nil, nil
+}
+
+// AddBlockedKey is a mock
+func (sa *StorageAuthority) AddBlockedKey(ctx context.Context, keyHash, addedBy string) error {
+	return nil
+}
+
+// KeyBlocked is a mock
+func (sa *StorageAuthority) KeyBlocked(ctx context.Context, keyHash string) (bool, error) {
 	return false, nil
 }
 
+// AddValidationTranscript is a mock
+func (sa *StorageAuthority) AddValidationTranscript(ctx context.Context, authzID, challengeType string, signed []byte) error {
+	return nil
+}
+
+// GetValidationTranscripts is a mock
+func (sa *StorageAuthority) GetValidationTranscripts(ctx context.Context, authzID string) ([][]byte, error) {
+	return nil, nil
+}
+
+// ReplacementIssued is a mock
+func (sa *StorageAuthority) ReplacementIssued(ctx context.Context, serial string) (bool, error) {
+	return false, nil
+}
+
+// AddReplacementOrder is a mock
+func (sa *StorageAuthority) AddReplacementOrder(ctx context.Context, serial, replacedSerial string) (err error) {
+	return
+}
+
+// NewCertificateOrder is a mock
+func (sa *StorageAuthority) NewCertificateOrder(ctx context.Context, order core.CertificateOrder, req core.CertificateRequest) (core.CertificateOrder, error) {
+	order.ID = "processing"
+	return order, nil
+}
+
+// FinalizeCertificateOrder is a mock
+func (sa *StorageAuthority) FinalizeCertificateOrder(ctx context.Context, order core.CertificateOrder) error {
+	return nil
+}
+
+// ClaimCertificateOrders is a mock, claiming no orders
+func (sa *StorageAuthority) ClaimCertificateOrders(ctx context.Context, staleBefore, now time.Time, limit int) ([]core.ClaimedCertificateOrder, error) {
+	return nil, nil
+}
+
+// ReserveIdempotencyKey is a mock, always reserving key
+func (sa *StorageAuthority) ReserveIdempotencyKey(ctx context.Context, key core.IdempotencyKey, staleBefore time.Time) (core.IdempotencyKey, error) {
+	return key, nil
+}
+
+// GetCAAChecks is a mock, with no checks recorded
+func (sa *StorageAuthority) GetCAAChecks(ctx context.Context, names []string) (map[string]time.Time, error) {
+	return map[string]time.Time{}, nil
+}
+
+// AddCAAChecks is a mock
+func (sa *StorageAuthority) AddCAAChecks(ctx context.Context, names []string, checked time.Time) error {
+	return nil
+}
+
+// FinalizeIdempotencyKey is a mock
+func (sa *StorageAuthority) FinalizeIdempotencyKey(ctx context.Context, key core.IdempotencyKey) error {
+	return nil
+}
+
+// GetCertificateOrder is a mock, returning an order with the status named
+// by id
+func (sa *StorageAuthority) GetCertificateOrder(ctx context.Context, id string) (core.CertificateOrder, error) {
+	order := core.CertificateOrder{ID: id, RegistrationID: 1, Created: sa.clk.Now(), Expires: sa.clk.Now().Add(24 * time.Hour)}
+	switch id {
+	case "processing":
+		order.Status = core.StatusProcessing
+	case "valid":
+		order.Status = core.StatusValid
+		order.Serial = "0000000000000000000000000000000000ee"
+	case "invalid":
+		order.Status = core.StatusInvalid
+		order.Error = probs.ServerInternal("Error creating new cert")
+	default:
+		return core.CertificateOrder{}, berrors.NotFoundError("No certificate order with ID %s", id)
+	}
+	return order, nil
+}
+
 // AddCertificate is a mock
-func (sa *StorageAuthority) AddCertificate(certDER []byte, regID int64) (digest string, err error) {
+func (sa *StorageAuthority) AddCertificate(ctx context.Context, certDER []byte, regID int64) (digest string, err error) {
 	return
 }
 
 // FinalizeAuthorization is a mock
-func (sa *StorageAuthority) FinalizeAuthorization(authz core.Authorization) (err error) {
+func (sa *StorageAuthority) FinalizeAuthorization(ctx context.Context, authz core.Authorization) (err error) {
+	return
+}
+
+// DeactivateAuthorization is a mock
+func (sa *StorageAuthority) DeactivateAuthorization(ctx context.Context, id string) (err error) {
 	return
 }
 
 // MarkCertificateRevoked is a mock
-func (sa *StorageAuthority) MarkCertificateRevoked(serial string, reasonCode core.RevocationCode) (err error) {
+func (sa *StorageAuthority) MarkCertificateRevoked(ctx context.Context, serial string, reasonCode core.RevocationCode) (err error) {
+	return
+}
+
+// ReleaseCertificateHold is a mock
+func (sa *StorageAuthority) ReleaseCertificateHold(ctx context.Context, serial string) (err error) {
 	return
 }
 
 // UpdateOCSP is a mock
-func (sa *StorageAuthority) UpdateOCSP(serial string, ocspResponse []byte) (err error) {
+func (sa *StorageAuthority) UpdateOCSP(ctx context.Context, serial string, ocspResponse []byte) (err error) {
 	return
 }
 
 // NewPendingAuthorization is a mock
-func (sa *StorageAuthority) NewPendingAuthorization(authz core.Authorization) (output core.Authorization, err error) {
+func (sa *StorageAuthority) NewPendingAuthorization(ctx context.Context, authz core.Authorization) (output core.Authorization, err error) {
+	return
+}
+
+// NewPendingAuthorizations is a mock
+func (sa *StorageAuthority) NewPendingAuthorizations(ctx context.Context, authzs []core.Authorization) (output []core.Authorization, err error) {
 	return
 }
 
 // NewRegistration is a mock
-func (sa *StorageAuthority) NewRegistration(reg core.Registration) (regR core.Registration, err error) {
+func (sa *StorageAuthority) NewRegistration(ctx context.Context, reg core.Registration) (regR core.Registration, err error) {
 	return
 }
 
 // UpdatePendingAuthorization is a mock
-func (sa *StorageAuthority) UpdatePendingAuthorization(authz core.Authorization) (err error) {
+func (sa *StorageAuthority) UpdatePendingAuthorization(ctx context.Context, authz core.Authorization) (err error) {
 	return
 }
 
 // UpdateRegistration is a mock
-func (sa *StorageAuthority) UpdateRegistration(reg core.Registration) (err error) {
+func (sa *StorageAuthority) UpdateRegistration(ctx context.Context, reg core.Registration) (err error) {
 	return
 }
 
 // GetSCTReceipt  is a mock
-func (sa *StorageAuthority) GetSCTReceipt(serial string, logID string) (sct core.SignedCertificateTimestamp, err error) {
+func (sa *StorageAuthority) GetSCTReceipt(ctx context.Context, serial string, logID string) (sct core.SignedCertificateTimestamp, err error) {
 	return
 }
 
-// AddSCTReceipt is a mock
-func (sa *StorageAuthority) AddSCTReceipt(sct core.SignedCertificateTimestamp) (err error) {
-	if sct.Signature == nil {
+// GetCTSubmissions is a mock
+func (sa *StorageAuthority) GetCTSubmissions(ctx context.Context, serial string) (submissions []core.CTSubmission, err error) {
+	return
+}
+
+// RecordCTSubmission is a mock
+func (sa *StorageAuthority) RecordCTSubmission(ctx context.Context, submission core.CTSubmission) (err error) {
+	if submission.Status == core.CTSubmissionSubmitted && submission.Signature == nil {
 		err = fmt.Errorf("Bad times")
 	}
 	return
 }
 
+// RecordCTInclusion is a mock
+func (sa *StorageAuthority) RecordCTInclusion(ctx context.Context, serial, logID string, status core.CTInclusionStatus) error {
+	return nil
+}
+
 // GetLatestValidAuthorization is a mock
-func (sa *StorageAuthority) GetLatestValidAuthorization(registrationID int64, identifier core.AcmeIdentifier) (authz core.Authorization, err error) {
+func (sa *StorageAuthority) GetLatestValidAuthorization(ctx context.Context, registrationID int64, identifier identifier.ACMEIdentifier) (authz core.Authorization, err error) {
 	if registrationID == 1 && identifier.Type == "dns" {
 		if sa.authorizedDomains[identifier.Value] || identifier.Value == "not-an-example.com" {
 			exp := sa.clk.Now().AddDate(100, 0, 0)
 			return core.Authorization{Status: core.StatusValid, RegistrationID: 1, Expires: &exp, Identifier: identifier}, nil
 		}
 	}
-	return core.Authorization{}, errors.New("no authz")
+	return core.Authorization{}, berrors.NotFoundError("no authz")
+}
+
+// GetAuthorizations is a mock
+func (sa *StorageAuthority) GetAuthorizations(ctx context.Context, registrationID int64, names []string, now time.Time) (map[string]*core.Authorization, error) {
+	authzs := make(map[string]*core.Authorization)
+	for _, name := range names {
+		authz, err := sa.GetLatestValidAuthorization(ctx, registrationID, identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: name})
+		if err == nil {
+			authzs[name] = &authz
+		}
+	}
+	return authzs, nil
+}
+
+// GetReusableAuthorizations is a mock
+func (sa *StorageAuthority) GetReusableAuthorizations(ctx context.Context, registrationID int64, names []string, now time.Time) (map[string]*core.Authorization, error) {
+	authzs := make(map[string]*core.Authorization)
+	for _, name := range names {
+		authz, err := sa.GetLatestValidAuthorization(ctx, registrationID, identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: name})
+		if err == nil && authz.Expires.After(now) {
+			authzs[name] = &authz
+		}
+	}
+	return authzs, nil
 }
 
 // CountCertificatesRange is a mock
-func (sa *StorageAuthority) CountCertificatesRange(_, _ time.Time) (int64, error) {
+func (sa *StorageAuthority) CountCertificatesRange(ctx context.Context, _, _ time.Time) (int64, error) {
 	return 0, nil
 }
 
 // CountCertificatesByNames is a mock
-func (sa *StorageAuthority) CountCertificatesByNames(_ []string, _, _ time.Time) (ret map[string]int, err error) {
+func (sa *StorageAuthority) CountCertificatesByNames(ctx context.Context, _ []string, _, _ time.Time) (ret map[string]int, err error) {
 	return
 }
 
+// CountFQDNSets is a mock
+func (sa *StorageAuthority) CountFQDNSets(ctx context.Context, _ []string, _, _ time.Time) (int64, error) {
+	return 0, nil
+}
+
+// FQDNSetExists is a mock
+func (sa *StorageAuthority) FQDNSetExists(ctx context.Context, _ []string) (bool, error) {
+	return false, nil
+}
+
 // CountRegistrationsByIP is a mock
-func (sa *StorageAuthority) CountRegistrationsByIP(_ net.IP, _, _ time.Time) (int, error) {
+func (sa *StorageAuthority) CountRegistrationsByIP(ctx context.Context, _ net.IP, _, _ time.Time) (int, error) {
 	return 0, nil
 }
 
 // CountPendingAuthorizations is a mock
-func (sa *StorageAuthority) CountPendingAuthorizations(_ int64) (int, error) {
+func (sa *StorageAuthority) CountPendingAuthorizations(ctx context.Context, _ int64) (int, error) {
 	return 0, nil
 }
 
@@ -361,7 +583,12 @@ type Publisher struct {
 }
 
 // SubmitToCT is a mock
-func (*Publisher) SubmitToCT([]byte) error {
+func (*Publisher) SubmitToCT(context.Context, []byte) error {
+	return nil
+}
+
+// CheckCTInclusion is a mock
+func (*Publisher) CheckCTInclusion(context.Context, []byte) error {
 	return nil
 }
 
@@ -8,13 +8,16 @@ package policy
 import (
 	"math/rand"
 	"net"
+	"net/mail"
 	"regexp"
 	"strings"
 
-	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/net/publicsuffix"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
 	"github.com/letsencrypt/boulder/core"
+	berrors "github.com/letsencrypt/boulder/errors"
+	"github.com/letsencrypt/boulder/identifier"
 	blog "github.com/letsencrypt/boulder/log"
 )
 
@@ -23,7 +26,13 @@ type PolicyAuthorityImpl struct {
 	log *blog.AuditLogger
 	DB  *PolicyAuthorityDatabaseImpl
 
-	EnforceWhitelist  bool
+	EnforceWhitelist bool
+	// EmailIdentifiers allows issuance for email identifiers, validated
+	// with email-reply-00. It is only for private CAs.
+	EmailIdentifiers bool
+	// HighRiskNames, and the names under them, have their authorizations
+	// held for review; see HighRisk
+	HighRiskNames     []string
 	enabledChallenges map[string]bool
 	pseudoRNG         *rand.Rand
 }
@@ -94,29 +103,47 @@ func suffixMatch(labels []string, suffixSet map[string]bool, properSuffix bool)
 }
 
 var (
-	errInvalidIdentifier   = core.MalformedRequestError("Invalid identifier type")
-	errNonPublic           = core.MalformedRequestError("Name does not end in a public suffix")
-	errICANNTLD            = core.MalformedRequestError("Name is an ICANN TLD")
-	errBlacklisted         = core.MalformedRequestError("Name is blacklisted")
-	errNotWhitelisted      = core.MalformedRequestError("Name is not whitelisted")
-	errInvalidDNSCharacter = core.MalformedRequestError("Invalid character in DNS name")
-	errNameTooLong         = core.MalformedRequestError("DNS name too long")
-	errIPAddress           = core.MalformedRequestError("Issuance for IP addresses not supported")
-	errTooManyLabels       = core.MalformedRequestError("DNS name has too many labels")
-	errEmptyName           = core.MalformedRequestError("DNS name was empty")
-	errTooFewLabels        = core.MalformedRequestError("DNS name does not have enough labels")
-	errLabelTooShort       = core.MalformedRequestError("DNS label is too short")
-	errLabelTooLong        = core.MalformedRequestError("DNS label is too long")
-	errIDNNotSupported     = core.MalformedRequestError("Internationalized domain names (starting with xn--) not yet supported")
+	errInvalidIdentifier   = berrors.MalformedError("Invalid identifier type")
+	errNonPublic           = berrors.RejectedIdentifierError("Name does not end in a public suffix")
+	errICANNTLD            = berrors.RejectedIdentifierError("Name is an ICANN TLD")
+	errBlacklisted         = berrors.RejectedIdentifierError("Name is blacklisted")
+	errNotWhitelisted      = berrors.RejectedIdentifierError("Name is not whitelisted")
+	errInvalidDNSCharacter = berrors.RejectedIdentifierError("Invalid character in DNS name")
+	errNameTooLong         = berrors.RejectedIdentifierError("DNS name too long")
+	errIPAddress           = berrors.RejectedIdentifierError("Issuance for IP addresses not supported")
+	errTooManyLabels       = berrors.RejectedIdentifierError("DNS name has too many labels")
+	errEmptyName           = berrors.RejectedIdentifierError("DNS name was empty")
+	errTooFewLabels        = berrors.RejectedIdentifierError("DNS name does not have enough labels")
+	errLabelTooShort       = berrors.RejectedIdentifierError("DNS label is too short")
+	errLabelTooLong        = berrors.RejectedIdentifierError("DNS label is too long")
+	errIDNNotSupported     = berrors.RejectedIdentifierError("Internationalized domain names (starting with xn--) not yet supported")
+	errEmailNotSupported   = berrors.RejectedIdentifierError("Issuance for email addresses not supported")
+	errInvalidEmail        = berrors.RejectedIdentifierError("Invalid email address")
 )
 
+// identifierPolicies holds, for each type of identifier the CA issues for,
+// the checks that identifiers of that type must pass.
+var identifierPolicies = map[identifier.Type]func(PolicyAuthorityImpl, identifier.ACMEIdentifier, int64) error{
+	identifier.DNS:   PolicyAuthorityImpl.willingToIssueDNS,
+	identifier.Email: PolicyAuthorityImpl.willingToIssueEmail,
+}
+
 // WillingToIssue determines whether the CA is willing to issue for the provided
-// identifier. It expects domains in id to be lowercase to prevent mismatched
-// cases breaking queries.
+// identifier, which must be of a type with a policy. It expects id to be
+// normalized to prevent mismatched cases breaking queries.
+func (pa PolicyAuthorityImpl) WillingToIssue(id identifier.ACMEIdentifier, regID int64) error {
+	policy, ok := identifierPolicies[id.Type]
+	if !ok {
+		return errInvalidIdentifier
+	}
+	return policy(pa, id, regID)
+}
+
+// willingToIssueDNS determines whether the CA is willing to issue for a DNS
+// identifier.
 //
-// We place several criteria on identifiers we are willing to issue for:
+// We place several criteria on DNS identifiers we are willing to issue for:
 //
-//  * MUST self-identify as DNS identifiers
 //  * MUST contain only bytes in the DNS hostname character set
 //  * MUST NOT have more than maxLabels labels
 //  * MUST follow the DNS hostname syntax rules in RFC 1035 and RFC 2181
@@ -129,11 +156,9 @@ var (
 //  * MUST NOT be a label-wise suffix match for a name on the black list,
 //    where comparison is case-independent (normalized to lower case)
 //
-// If WillingToIssue returns an error, it will be of type MalformedRequestError.
-func (pa PolicyAuthorityImpl) WillingToIssue(id core.AcmeIdentifier, regID int64) error {
-	if id.Type != core.IdentifierDNS {
-		return errInvalidIdentifier
-	}
+// If willingToIssueDNS returns an error, it will be a RejectedIdentifier
+// BoulderError.
+func (pa PolicyAuthorityImpl) willingToIssueDNS(id identifier.ACMEIdentifier, regID int64) error {
 	domain := id.Value
 
 	if domain == "" {
@@ -204,23 +229,50 @@ func (pa PolicyAuthorityImpl) WillingToIssue(id core.AcmeIdentifier, regID int64
 	return nil
 }
 
-// ChallengesFor makes a decision of what challenges, and combinations, are
-// acceptable for the given identifier.
-//
-// Note: Current implementation is static, but future versions may not be.
-func (pa PolicyAuthorityImpl) ChallengesFor(identifier core.AcmeIdentifier, accountKey *jose.JsonWebKey) ([]core.Challenge, [][]int, error) {
-	challenges := []core.Challenge{}
+// willingToIssueEmail determines whether the CA is willing to issue for an
+// email identifier. Email identifiers must be enabled, and must be a bare
+// address, without a display name, whose domain the CA would issue for as a
+// DNS identifier.
+func (pa PolicyAuthorityImpl) willingToIssueEmail(id identifier.ACMEIdentifier, regID int64) error {
+	if !pa.EmailIdentifiers {
+		return errEmailNotSupported
+	}
+	parsed, err := mail.ParseAddress(id.Value)
+	if err != nil || parsed.Name != "" || parsed.Address != id.Value {
+		return errInvalidEmail
+	}
+	return pa.willingToIssueDNS(identifier.DNSName(id.Domain()), regID)
+}
 
-	if pa.enabledChallenges[core.ChallengeTypeHTTP01] {
-		challenges = append(challenges, core.HTTPChallenge01(accountKey))
+// HighRisk returns whether authorizations for id are held for an operator's
+// review once validated: whether its domain is one of HighRiskNames, or under
+// one.
+func (pa PolicyAuthorityImpl) HighRisk(id identifier.ACMEIdentifier) bool {
+	domain := strings.TrimSuffix(strings.ToLower(id.Domain()), ".")
+	for _, name := range pa.HighRiskNames {
+		name = strings.TrimSuffix(strings.ToLower(name), ".")
+		if domain == name || strings.HasSuffix(domain, "."+name) {
+			return true
+		}
 	}
+	return false
+}
 
-	if pa.enabledChallenges[core.ChallengeTypeTLSSNI01] {
-		challenges = append(challenges, core.TLSSNIChallenge01(accountKey))
+// ChallengesFor makes a decision of what challenges, and combinations, are
+// acceptable for the given identifier: one of each enabled challenge type
+// that offers to validate it.
+func (pa PolicyAuthorityImpl) ChallengesFor(id identifier.ACMEIdentifier, accountKey *jose.JSONWebKey) ([]core.Challenge, [][]int, error) {
+	// Email identifiers can only be validated by mail, which is enabled
+	// along with them rather than as a challenge
+	if id.Type == core.IdentifierEmail {
+		return []core.Challenge{core.EmailReplyChallenge00(accountKey)}, [][]int{{0}}, nil
 	}
 
-	if pa.enabledChallenges[core.ChallengeTypeDNS01] {
-		challenges = append(challenges, core.DNSChallenge01(accountKey))
+	challenges := []core.Challenge{}
+	for _, ct := range core.ChallengeTypes() {
+		if pa.enabledChallenges[ct.Name()] && ct.Offers(id) {
+			challenges = append(challenges, core.NewChallenge(ct.Name(), accountKey))
+		}
 	}
 
 	// We shuffle the challenges and combinations to prevent ACME clients from
@@ -7,12 +7,14 @@ package policy
 
 import (
 	"encoding/json"
+	"fmt"
 	"testing"
 
-	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
 	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/identifier"
 	"github.com/letsencrypt/boulder/mocks"
 	"github.com/letsencrypt/boulder/sa"
 	"github.com/letsencrypt/boulder/test"
@@ -139,16 +141,16 @@ func TestWillingToIssue(t *testing.T) {
 	test.AssertNotError(t, err, "Couldn't load rules")
 
 	// Test for invalid identifier type
-	identifier := core.AcmeIdentifier{Type: "ip", Value: "example.com"}
-	err = pa.WillingToIssue(identifier, 100)
+	id := identifier.ACMEIdentifier{Type: "ip", Value: "example.com"}
+	err = pa.WillingToIssue(id, 100)
 	if err != errInvalidIdentifier {
-		t.Error("Identifier was not correctly forbidden: ", identifier)
+		t.Error("Identifier was not correctly forbidden: ", id)
 	}
 
 	// Test syntax errors
 	for _, tc := range testCases {
-		identifier := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: tc.domain}
-		err := pa.WillingToIssue(identifier, 100)
+		id := identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: tc.domain}
+		err := pa.WillingToIssue(id, 100)
 		if err != tc.err {
 			t.Errorf("WillingToIssue(%q) = %q, expected %q", tc.domain, err, tc.err)
 		}
@@ -156,27 +158,27 @@ func TestWillingToIssue(t *testing.T) {
 
 	// Test domains that are equal to public suffixes
 	for _, domain := range shouldBeTLDError {
-		identifier := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: domain}
-		err := pa.WillingToIssue(identifier, 100)
+		id := identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: domain}
+		err := pa.WillingToIssue(id, 100)
 		if err != errICANNTLD {
-			t.Error("Identifier was not correctly forbidden: ", identifier, err)
+			t.Error("Identifier was not correctly forbidden: ", id, err)
 		}
 	}
 
 	// Test blacklisting
 	for _, domain := range shouldBeBlacklisted {
-		identifier := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: domain}
-		err := pa.WillingToIssue(identifier, 100)
+		id := identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: domain}
+		err := pa.WillingToIssue(id, 100)
 		if err != errBlacklisted {
-			t.Error("Identifier was not correctly forbidden: ", identifier, err)
+			t.Error("Identifier was not correctly forbidden: ", id, err)
 		}
 	}
 
 	// Test acceptance of good names
 	for _, domain := range shouldBeAccepted {
-		identifier := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: domain}
-		if err := pa.WillingToIssue(identifier, 100); err != nil {
-			t.Error("Identifier was incorrectly forbidden: ", identifier, err)
+		id := identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: domain}
+		if err := pa.WillingToIssue(id, 100); err != nil {
+			t.Error("Identifier was incorrectly forbidden: ", id, err)
 		}
 	}
 }
@@ -191,13 +193,13 @@ func TestChallengesFor(t *testing.T) {
 	pa, cleanup := paImpl(t)
 	defer cleanup()
 
-	var accountKey *jose.JsonWebKey
+	var accountKey *jose.JSONWebKey
 	err := json.Unmarshal([]byte(accountKeyJSON), &accountKey)
 	if err != nil {
 		t.Errorf("Error unmarshaling JWK: %v", err)
 	}
 
-	challenges, combinations, err := pa.ChallengesFor(core.AcmeIdentifier{}, accountKey)
+	challenges, combinations, err := pa.ChallengesFor(identifier.ACMEIdentifier{}, accountKey)
 	if err != nil {
 		t.Errorf("Error generating challenges: %v", err)
 	}
@@ -216,6 +218,41 @@ func TestChallengesFor(t *testing.T) {
 	}
 	test.AssertEquals(t, len(seenChalls), len(enabledChallenges))
 	test.AssertDeepEquals(t, expectedCombos, combinations)
+
+	// Email identifiers are only offered email-reply-00
+	challenges, combinations, err = pa.ChallengesFor(identifier.ACMEIdentifier{Type: core.IdentifierEmail, Value: "alice@example.com"}, accountKey)
+	test.AssertNotError(t, err, "Error generating challenges")
+	test.AssertEquals(t, len(challenges), 1)
+	test.AssertEquals(t, challenges[0].Type, core.ChallengeTypeEmailReply00)
+	test.AssertDeepEquals(t, combinations, [][]int{{0}})
+}
+
+func TestWillingToIssueEmail(t *testing.T) {
+	pa, cleanup := paImpl(t)
+	defer cleanup()
+
+	alice := identifier.ACMEIdentifier{Type: core.IdentifierEmail, Value: "alice@example.com"}
+	test.AssertEquals(t, pa.WillingToIssue(alice, 100), errEmailNotSupported)
+
+	pa.EmailIdentifiers = true
+	test.AssertNotError(t, pa.WillingToIssue(alice, 100), "Refused a valid address")
+
+	for _, address := range []string{
+		"alice",
+		"@example.com",
+		"Alice <alice@example.com>",
+		"<alice@example.com>",
+		"alice@example.com, bob@example.com",
+	} {
+		err := pa.WillingToIssue(identifier.ACMEIdentifier{Type: core.IdentifierEmail, Value: address}, 100)
+		test.AssertEquals(t, err, errInvalidEmail)
+	}
+
+	// The domain of the address must pass the DNS policy
+	err := pa.WillingToIssue(identifier.ACMEIdentifier{Type: core.IdentifierEmail, Value: "alice@localhost"}, 100)
+	test.AssertEquals(t, err, errTooFewLabels)
+	err = pa.WillingToIssue(identifier.ACMEIdentifier{Type: core.IdentifierEmail, Value: "alice@com"}, 100)
+	test.AssertEquals(t, err, errTooFewLabels)
 }
 
 func TestWillingToIssueWithWhitelist(t *testing.T) {
@@ -223,18 +260,18 @@ func TestWillingToIssueWithWhitelist(t *testing.T) {
 	defer cleanUp()
 	pa, err := NewPolicyAuthorityImpl(dbMap, true, nil)
 	test.AssertNotError(t, err, "Couldn't create policy implementation")
-	googID := core.AcmeIdentifier{
+	googID := identifier.ACMEIdentifier{
 		Type:  core.IdentifierDNS,
 		Value: "www.google.com",
 	}
-	zomboID := core.AcmeIdentifier{
+	zomboID := identifier.ACMEIdentifier{
 		Type:  core.IdentifierDNS,
 		Value: "www.zombo.com",
 	}
 
 	type listTestCase struct {
 		regID int64
-		id    core.AcmeIdentifier
+		id    identifier.ACMEIdentifier
 		err   error
 	}
 	pa.DB.LoadRules(RuleSet{
@@ -267,7 +304,7 @@ func TestWillingToIssueWithWhitelist(t *testing.T) {
 		},
 	})
 
-	exampleID := core.AcmeIdentifier{
+	exampleID := identifier.ACMEIdentifier{
 		Type:  core.IdentifierDNS,
 		Value: "www.example.com",
 	}
@@ -314,3 +351,24 @@ func TestWillingToIssueWithWhitelist(t *testing.T) {
 		}
 	}
 }
+
+func TestHighRisk(t *testing.T) {
+	pa := PolicyAuthorityImpl{HighRiskNames: []string{"Bank.example", "login.example.com."}}
+
+	for _, id := range []identifier.ACMEIdentifier{
+		identifier.DNSName("bank.example"),
+		identifier.DNSName("www.BANK.example"),
+		identifier.DNSName("login.example.com"),
+		identifier.FromValue("alice@mail.bank.example"),
+	} {
+		test.Assert(t, pa.HighRisk(id), fmt.Sprintf("%s should be high-risk", id.Value))
+	}
+	for _, id := range []identifier.ACMEIdentifier{
+		identifier.DNSName("notbank.example"),
+		identifier.DNSName("example.com"),
+		identifier.DNSName("www.example.com"),
+		identifier.FromValue("alice@example.com"),
+	} {
+		test.Assert(t, !pa.HighRisk(id), fmt.Sprintf("%s shouldn't be high-risk", id.Value))
+	}
+}
@@ -16,6 +16,13 @@ const (
 	RateLimitedProblem    = ProblemType("urn:acme:error:rateLimited")
 	BadNonceProblem       = ProblemType("urn:acme:error:badNonce")
 	InvalidEmailProblem   = ProblemType("urn:acme:error:invalidEmail")
+	BadCSRProblem         = ProblemType("urn:acme:error:badCSR")
+	DNSSECProblem         = ProblemType("urn:acme:error:dnssec")
+	OverQuotaProblem      = ProblemType("urn:acme:error:overQuota")
+	BadPublicKeyProblem   = ProblemType("urn:acme:error:badPublicKey")
+	// RejectedIdentifierProblem is for identifiers the CA's policy forbids
+	// issuing for
+	RejectedIdentifierProblem = ProblemType("urn:acme:error:rejectedIdentifier")
 )
 
 // ProblemType defines the error types in the ACME protocol
@@ -29,6 +36,26 @@ type ProblemDetails struct {
 	// HTTPStatus is the HTTP status code the ProblemDetails should probably be sent
 	// as.
 	HTTPStatus int `json:"status,omitempty"`
+	// SubProblems break a problem with a request covering several identifiers
+	// down into the problem with each of them.
+	SubProblems []SubProblemDetails `json:"subproblems,omitempty"`
+	// Transient marks problems caused by a passing failure of the network or
+	// a resolver, such as a timeout, rather than by what was looked up or
+	// fetched, so that it's worth trying again. It isn't sent to clients.
+	Transient bool `json:"-"`
+}
+
+// SubProblemDetails is a problem document about one identifier of a request.
+type SubProblemDetails struct {
+	ProblemDetails
+	Identifier Identifier `json:"identifier"`
+}
+
+// Identifier names the subject of a SubProblemDetails. It mirrors
+// core.AcmeIdentifier, which this package cannot import.
+type Identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
 }
 
 func (pd *ProblemDetails) Error() string {
@@ -47,13 +74,13 @@ func ProblemDetailsToStatusCode(prob *ProblemDetails) int {
 		return prob.HTTPStatus
 	}
 	switch prob.Type {
-	case ConnectionProblem, MalformedProblem, TLSProblem, UnknownHostProblem, BadNonceProblem:
+	case ConnectionProblem, MalformedProblem, TLSProblem, UnknownHostProblem, BadNonceProblem, BadCSRProblem, DNSSECProblem, BadPublicKeyProblem:
 		return http.StatusBadRequest
 	case ServerInternalProblem:
 		return http.StatusInternalServerError
 	case UnauthorizedProblem:
 		return http.StatusForbidden
-	case RateLimitedProblem:
+	case RateLimitedProblem, OverQuotaProblem:
 		return statusTooManyRequests
 	default:
 		return http.StatusInternalServerError
@@ -70,6 +97,72 @@ func BadNonce(detail string) *ProblemDetails {
 	}
 }
 
+// BadCSR returns a ProblemDetails with a BadCSRProblem and a 400 Bad Request
+// status code.
+func BadCSR(detail string, args ...interface{}) *ProblemDetails {
+	if len(args) > 0 {
+		detail = fmt.Sprintf(detail, args...)
+	}
+	return &ProblemDetails{
+		Type:       BadCSRProblem,
+		Detail:     detail,
+		HTTPStatus: http.StatusBadRequest,
+	}
+}
+
+// BadPublicKey returns a ProblemDetails with a BadPublicKeyProblem and a 400
+// Bad Request status code.
+func BadPublicKey(detail string, args ...interface{}) *ProblemDetails {
+	if len(args) > 0 {
+		detail = fmt.Sprintf(detail, args...)
+	}
+	return &ProblemDetails{
+		Type:       BadPublicKeyProblem,
+		Detail:     detail,
+		HTTPStatus: http.StatusBadRequest,
+	}
+}
+
+// DNSSEC returns a ProblemDetails with a DNSSECProblem and a 400 Bad Request
+// status code.
+func DNSSEC(detail string) *ProblemDetails {
+	return &ProblemDetails{
+		Type:       DNSSECProblem,
+		Detail:     detail,
+		HTTPStatus: http.StatusBadRequest,
+	}
+}
+
+// RateLimited returns a ProblemDetails with a RateLimitedProblem and a 429
+// Too Many Requests status code.
+func RateLimited(detail string) *ProblemDetails {
+	return &ProblemDetails{
+		Type:       RateLimitedProblem,
+		Detail:     detail,
+		HTTPStatus: statusTooManyRequests,
+	}
+}
+
+// OverQuota returns a ProblemDetails with an OverQuotaProblem and a 429 Too
+// Many Requests status code.
+func OverQuota(detail string) *ProblemDetails {
+	return &ProblemDetails{
+		Type:       OverQuotaProblem,
+		Detail:     detail,
+		HTTPStatus: statusTooManyRequests,
+	}
+}
+
+// RejectedIdentifier returns a ProblemDetails with a
+// RejectedIdentifierProblem and a 400 Bad Request status code.
+func RejectedIdentifier(detail string) *ProblemDetails {
+	return &ProblemDetails{
+		Type:       RejectedIdentifierProblem,
+		Detail:     detail,
+		HTTPStatus: http.StatusBadRequest,
+	}
+}
+
 // Conflict returns a ProblemDetails with a MalformedProblem and a 409 Conflict
 // status code.
 func Conflict(detail string) *ProblemDetails {
@@ -142,3 +235,23 @@ func ContentLengthRequired() *ProblemDetails {
 		HTTPStatus: http.StatusLengthRequired,
 	}
 }
+
+// RequestEntityTooLarge returns a ProblemDetails representing a request body
+// larger than the server accepts.
+func RequestEntityTooLarge(detail string) *ProblemDetails {
+	return &ProblemDetails{
+		Type:       MalformedProblem,
+		Detail:     detail,
+		HTTPStatus: http.StatusRequestEntityTooLarge,
+	}
+}
+
+// Timeout returns a ProblemDetails representing a request the server could
+// not complete in time.
+func Timeout(detail string) *ProblemDetails {
+	return &ProblemDetails{
+		Type:       ServerInternalProblem,
+		Detail:     detail,
+		HTTPStatus: http.StatusServiceUnavailable,
+	}
+}
@@ -1,6 +1,7 @@
 package probs
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/letsencrypt/boulder/test"
@@ -14,3 +15,18 @@ func TestProblemDetails(t *testing.T) {
 	}
 	test.AssertEquals(t, pd.Error(), "urn:acme:error:malformed :: Wat? o.O")
 }
+
+func TestSubProblemsJSON(t *testing.T) {
+	pd := Unauthorized("Authorizations for these names not found or expired: example.com")
+	pd.SubProblems = []SubProblemDetails{{
+		ProblemDetails: *Unauthorized("No authorization found for example.com"),
+		Identifier:     Identifier{Type: "dns", Value: "example.com"},
+	}}
+	body, err := json.Marshal(pd)
+	test.AssertNotError(t, err, "Failed to marshal problem")
+	test.AssertEquals(t, string(body), `{"type":"urn:acme:error:unauthorized","detail":"Authorizations for these names not found or expired: example.com","status":403,"subproblems":[{"type":"urn:acme:error:unauthorized","detail":"No authorization found for example.com","status":403,"identifier":{"type":"dns","value":"example.com"}}]}`)
+
+	body, err = json.Marshal(Unauthorized("hm"))
+	test.AssertNotError(t, err, "Failed to marshal problem")
+	test.AssertEquals(t, string(body), `{"type":"urn:acme:error:unauthorized","detail":"hm","status":403}`)
+}
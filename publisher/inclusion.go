@@ -0,0 +1,202 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	ct "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/google/certificate-transparency/go"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+// getProofByHashPath is the RFC 6962 endpoint returning a Merkle audit
+// path for a leaf hash, which the vendored CT client doesn't implement.
+const getProofByHashPath = "/ct/v1/get-proof-by-hash"
+
+// maximumMergeDelay is how long after issuing an SCT a CT log promises to
+// include its certificate in the tree heads it signs. RFC 6962 leaves it
+// to each log, and the logs we submit to all promise 24 hours.
+const maximumMergeDelay = 24 * time.Hour
+
+type getProofByHashResponse struct {
+	LeafIndex int64    `json:"leaf_index"`
+	AuditPath [][]byte `json:"audit_path"`
+}
+
+// CheckCTInclusion checks whether the configured CT logs that issued SCTs
+// for the certificate represented by der, and haven't yet been seen to
+// include it, now do, and records what it finds with the SA. Logs without
+// a tree head signed after their maximum merge delay passed are left
+// unverified, to be checked again later.
+func (pub *PublisherImpl) CheckCTInclusion(ctx context.Context, der []byte) error {
+	log := pub.log.WithRequestID(core.RequestID(ctx))
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		log.Audit(fmt.Sprintf("Failed to parse certificate: %s", err))
+		return err
+	}
+	serial := core.SerialToString(cert.SerialNumber)
+
+	submissions, err := pub.SA.GetCTSubmissions(ctx, serial)
+	if err != nil {
+		return err
+	}
+	for _, submission := range submissions {
+		if submission.Status != core.CTSubmissionSubmitted ||
+			submission.InclusionStatus != core.CTInclusionUnverified {
+			continue
+		}
+		var ctLog *Log
+		for _, l := range pub.ctLogs {
+			if l.logID == submission.LogID {
+				ctLog = l
+			}
+		}
+		if ctLog == nil {
+			continue
+		}
+
+		status, err := ctLog.checkInclusion(ctx, der, submission)
+		if err != nil {
+			log.Warning(fmt.Sprintf("Failed to check inclusion of %s in CT log %s: %s", serial, ctLog.logID, err))
+			continue
+		}
+		if status == core.CTInclusionUnverified {
+			continue
+		}
+		if status == core.CTInclusionMissing {
+			log.Audit(fmt.Sprintf("CT log %s didn't include %s within its maximum merge delay", ctLog.logID, serial))
+		}
+		err = pub.SA.RecordCTInclusion(ctx, serial, submission.LogID, status)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			log.Audit(fmt.Sprintf("Failed to store CT inclusion in database: %s", err))
+		}
+	}
+	return nil
+}
+
+// checkInclusion looks for der, with the SCT of submission, in ctLog's
+// latest tree head, verifying the audit path the log returns for it.
+func (ctLog *Log) checkInclusion(ctx context.Context, der []byte, submission core.CTSubmission) (core.CTInclusionStatus, error) {
+	sth, err := ctLog.client.GetSTH()
+	if err != nil {
+		return "", fmt.Errorf("Failed to get STH: %s", err)
+	}
+	if err = ctLog.verifier.VerifySTHSignature(*sth); err != nil {
+		return "", fmt.Errorf("Failed to verify STH: %s", err)
+	}
+
+	leafHash := merkleLeafHash(der, submission.Timestamp, submission.Extensions)
+	proof, found, err := ctLog.getProofByHash(ctx, leafHash, sth.TreeSize)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		sctTime := time.Unix(0, int64(submission.Timestamp)*int64(time.Millisecond))
+		sthTime := time.Unix(0, int64(sth.Timestamp)*int64(time.Millisecond))
+		if sthTime.Sub(sctTime) > maximumMergeDelay {
+			return core.CTInclusionMissing, nil
+		}
+		return core.CTInclusionUnverified, nil
+	}
+	if !verifyInclusionProof(leafHash, proof.LeafIndex, sth.TreeSize, proof.AuditPath, sth.SHA256RootHash) {
+		return "", fmt.Errorf("Audit path for leaf %d doesn't match STH of size %d", proof.LeafIndex, sth.TreeSize)
+	}
+	return core.CTInclusionVerified, nil
+}
+
+// getProofByHash gets the audit path of leafHash in ctLog's tree of the
+// given size, reporting whether the log has the leaf at all.
+func (ctLog *Log) getProofByHash(ctx context.Context, leafHash [sha256.Size]byte, treeSize uint64) (getProofByHashResponse, bool, error) {
+	var proof getProofByHashResponse
+	if treeSize == 0 {
+		return proof, false, nil
+	}
+	uri := fmt.Sprintf("%s%s?hash=%s&tree_size=%d", ctLog.uri, getProofByHashPath,
+		url.QueryEscape(base64.StdEncoding.EncodeToString(leafHash[:])), treeSize)
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return proof, false, err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return proof, false, fmt.Errorf("Failed to get inclusion proof: %s", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusBadRequest, http.StatusNotFound:
+		// Logs answer a hash they don't have with one of these
+		return proof, false, nil
+	default:
+		return proof, false, fmt.Errorf("Failed to get inclusion proof: %s", resp.Status)
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&proof); err != nil {
+		return proof, false, fmt.Errorf("Failed to parse inclusion proof: %s", err)
+	}
+	return proof, true, nil
+}
+
+// merkleLeafHash returns the RFC 6962 hash of the Merkle tree leaf a CT log
+// adds for the X.509 certificate der when it issues an SCT with the given
+// timestamp and extensions.
+func merkleLeafHash(der []byte, timestamp uint64, extensions []byte) [sha256.Size]byte {
+	var leaf bytes.Buffer
+	leaf.WriteByte(0) // Leaf hash prefix
+	leaf.WriteByte(byte(ct.V1))
+	leaf.WriteByte(byte(ct.TimestampedEntryLeafType))
+	binary.Write(&leaf, binary.BigEndian, timestamp)
+	binary.Write(&leaf, binary.BigEndian, uint16(ct.X509LogEntryType))
+	leaf.Write([]byte{byte(len(der) >> 16), byte(len(der) >> 8), byte(len(der))})
+	leaf.Write(der)
+	binary.Write(&leaf, binary.BigEndian, uint16(len(extensions)))
+	leaf.Write(extensions)
+	return sha256.Sum256(leaf.Bytes())
+}
+
+// hashChildren returns the RFC 6962 hash of a Merkle tree node.
+func hashChildren(left, right []byte) [sha256.Size]byte {
+	return sha256.Sum256(append(append([]byte{1}, left...), right...))
+}
+
+// verifyInclusionProof checks that auditPath leads from leafHash, at index
+// in a Merkle tree of treeSize leaves, to root, as in RFC 6962 section 2.1.1.
+func verifyInclusionProof(leafHash [sha256.Size]byte, index int64, treeSize uint64, auditPath [][]byte, root ct.SHA256Hash) bool {
+	if index < 0 || uint64(index) >= treeSize {
+		return false
+	}
+	fn, sn := uint64(index), treeSize-1
+	hash := leafHash
+	for _, sibling := range auditPath {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			hash = hashChildren(sibling, hash[:])
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			hash = hashChildren(hash[:], sibling)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && bytes.Equal(hash[:], root[:])
+}
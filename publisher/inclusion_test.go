@@ -0,0 +1,135 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package publisher
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ct "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/google/certificate-transparency/go"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// inclusionLogSrv serves an STH, signed by k with the given timestamp, of
+// a three leaf tree with leafHash in the middle, and the audit paths of
+// its leaves.
+func inclusionLogSrv(k *ecdsa.PrivateKey, timestamp uint64, leafHash [sha256.Size]byte) *httptest.Server {
+	leaves := [][sha256.Size]byte{sha256.Sum256([]byte("a")), leafHash, sha256.Sum256([]byte("c"))}
+	left := hashChildren(leaves[0][:], leaves[1][:])
+	root := hashChildren(left[:], leaves[2][:])
+	auditPaths := [][][]byte{
+		{leaves[1][:], leaves[2][:]},
+		{leaves[0][:], leaves[2][:]},
+		{left[:]},
+	}
+
+	sth := ct.SignedTreeHead{Version: ct.V1, TreeSize: 3, Timestamp: timestamp, SHA256RootHash: root}
+	serialized, _ := ct.SerializeSTHSignatureInput(sth)
+	hashed := sha256.Sum256(serialized)
+	var ecdsaSig struct {
+		R, S *big.Int
+	}
+	ecdsaSig.R, ecdsaSig.S, _ = ecdsa.Sign(rand.Reader, k, hashed[:])
+	sig, _ := asn1.Marshal(ecdsaSig)
+	ds := ct.DigitallySigned{
+		HashAlgorithm:      ct.SHA256,
+		SignatureAlgorithm: ct.ECDSA,
+		Signature:          sig,
+	}
+	b64Sig, _ := ds.Base64String()
+
+	m := http.NewServeMux()
+	m.HandleFunc("/ct/v1/get-sth", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"tree_size":3,"timestamp":%d,"sha256_root_hash":"%s","tree_head_signature":"%s"}`,
+			timestamp, base64.StdEncoding.EncodeToString(root[:]), b64Sig)
+	})
+	m.HandleFunc(getProofByHashPath, func(w http.ResponseWriter, r *http.Request) {
+		hash, _ := base64.StdEncoding.DecodeString(r.URL.Query().Get("hash"))
+		for i, leaf := range leaves {
+			if string(leaf[:]) == string(hash) {
+				json.NewEncoder(w).Encode(getProofByHashResponse{LeafIndex: int64(i), AuditPath: auditPaths[i]})
+				return
+			}
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	})
+
+	server := httptest.NewUnstartedServer(m)
+	server.Start()
+	return server
+}
+
+func TestVerifyInclusionProof(t *testing.T) {
+	var leaves [][sha256.Size]byte
+	for _, s := range []string{"a", "b", "c"} {
+		leaves = append(leaves, sha256.Sum256([]byte(s)))
+	}
+	left := hashChildren(leaves[0][:], leaves[1][:])
+	root := ct.SHA256Hash(hashChildren(left[:], leaves[2][:]))
+
+	test.Assert(t, verifyInclusionProof(leaves[0], 0, 3, [][]byte{leaves[1][:], leaves[2][:]}, root), "First leaf wasn't verified")
+	test.Assert(t, verifyInclusionProof(leaves[1], 1, 3, [][]byte{leaves[0][:], leaves[2][:]}, root), "Second leaf wasn't verified")
+	test.Assert(t, verifyInclusionProof(leaves[2], 2, 3, [][]byte{left[:]}, root), "Last leaf wasn't verified")
+
+	test.Assert(t, !verifyInclusionProof(leaves[0], 1, 3, [][]byte{leaves[0][:], leaves[2][:]}, root), "Wrong leaf was verified")
+	test.Assert(t, !verifyInclusionProof(leaves[2], 2, 3, [][]byte{left[:], leaves[0][:]}, root), "Overlong audit path was verified")
+	test.Assert(t, !verifyInclusionProof(leaves[2], 3, 3, [][]byte{left[:]}, root), "Index beyond the tree was verified")
+}
+
+func TestCheckCTInclusion(t *testing.T) {
+	pub, leaf, k := setup(t)
+	sa := &recordingSA{StorageAuthority: mocks.NewStorageAuthority(clock.NewFake())}
+	pub.SA = sa
+
+	const sctTimestamp = 1337
+	leafHash := merkleLeafHash(leaf.Raw, sctTimestamp, nil)
+	otherHash := sha256.Sum256([]byte("b"))
+	afterMMD := uint64(sctTimestamp + (maximumMergeDelay+time.Hour)/time.Millisecond)
+	beforeMMD := uint64(sctTimestamp + time.Hour/time.Millisecond)
+
+	// A log that includes the certificate, one that doesn't after its
+	// maximum merge delay, and one that doesn't yet
+	for _, srv := range []*httptest.Server{
+		inclusionLogSrv(k, beforeMMD, leafHash),
+		inclusionLogSrv(k, afterMMD, otherHash),
+		inclusionLogSrv(k, beforeMMD, otherHash),
+	} {
+		defer srv.Close()
+		port, err := getPort(srv)
+		test.AssertNotError(t, err, "Failed to get test server port")
+		addLog(t, pub, port, &k.PublicKey)
+	}
+	for i, ctLog := range pub.ctLogs {
+		sa.submissions = append(sa.submissions, core.CTSubmission{
+			CertificateSerial: core.SerialToString(leaf.SerialNumber),
+			LogID:             fmt.Sprintf("%s-%d", ctLog.logID, i),
+			Status:            core.CTSubmissionSubmitted,
+			Timestamp:         sctTimestamp,
+			InclusionStatus:   core.CTInclusionUnverified,
+		})
+		ctLog.logID = sa.submissions[i].LogID
+	}
+
+	err := pub.CheckCTInclusion(ctx, leaf.Raw)
+	test.AssertNotError(t, err, "Failed to check CT inclusion")
+	test.AssertEquals(t, len(sa.inclusions), 2)
+	test.AssertEquals(t, sa.inclusions[pub.ctLogs[0].logID], core.CTInclusionVerified)
+	test.AssertEquals(t, sa.inclusions[pub.ctLogs[1].logID], core.CTInclusionMissing)
+}
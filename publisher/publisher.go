@@ -6,6 +6,8 @@
 package publisher
 
 import (
+	"context"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
 	"fmt"
@@ -15,6 +17,7 @@ import (
 	ct "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/google/certificate-transparency/go"
 	ctClient "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/google/certificate-transparency/go/client"
 
+	"github.com/letsencrypt/boulder/chaos"
 	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
 )
@@ -23,6 +26,10 @@ import (
 type Log struct {
 	client   *ctClient.LogClient
 	verifier *ct.SignatureVerifier
+	// logID is the base64 SHA-256 hash of the log's public key, as in the
+	// SCTs it issues
+	logID string
+	uri   string
 }
 
 // NewLog returns a initialized Log struct
@@ -46,7 +53,8 @@ func NewLog(uri, b64PK string) (*Log, error) {
 		return nil, err
 	}
 
-	return &Log{client, verifier}, nil
+	logID := sha256.Sum256(pkBytes)
+	return &Log{client, verifier, base64.StdEncoding.EncodeToString(logID[:]), uri}, nil
 }
 
 type ctSubmissionRequest struct {
@@ -77,56 +85,94 @@ func NewPublisherImpl(bundle []ct.ASN1Cert, logs []*Log) (pub PublisherImpl) {
 }
 
 // SubmitToCT will submit the certificate represented by certDER to any CT
-// logs configured in pub.CT.Logs
-func (pub *PublisherImpl) SubmitToCT(der []byte) error {
+// logs configured in pub.CT.Logs that haven't already issued an SCT for it.
+// Each attempt, and the SCT or error it ends with, is recorded with the SA.
+func (pub *PublisherImpl) SubmitToCT(ctx context.Context, der []byte) error {
+	log := pub.log.WithRequestID(core.RequestID(ctx))
 	cert, err := x509.ParseCertificate(der)
 	if err != nil {
-		pub.log.Audit(fmt.Sprintf("Failed to parse certificate: %s", err))
+		log.Audit(fmt.Sprintf("Failed to parse certificate: %s", err))
 		return err
 	}
+	serial := core.SerialToString(cert.SerialNumber)
+
+	submitted := make(map[string]bool)
+	submissions, err := pub.SA.GetCTSubmissions(ctx, serial)
+	if err != nil {
+		// Resubmitting to a log that already issued an SCT is harmless
+		log.Warning(fmt.Sprintf("Failed to get CT submissions of %s: %s", serial, err))
+	}
+	for _, submission := range submissions {
+		if submission.Status == core.CTSubmissionSubmitted {
+			submitted[submission.LogID] = true
+		}
+	}
 
 	chain := append([]ct.ASN1Cert{der}, pub.issuerBundle...)
 	for _, ctLog := range pub.ctLogs {
-		sct, err := ctLog.client.AddChain(chain)
-		if err != nil {
-			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			pub.log.Audit(fmt.Sprintf("Failed to submit certificate to CT log: %s", err))
+		if submitted[ctLog.logID] {
 			continue
 		}
-
-		err = ctLog.verifier.VerifySCTSignature(*sct, ct.LogEntry{
-			Leaf: ct.MerkleTreeLeaf{
-				LeafType: ct.TimestampedEntryLeafType,
-				TimestampedEntry: ct.TimestampedEntry{
-					X509Entry: ct.ASN1Cert(der),
-					EntryType: ct.X509LogEntryType,
-				},
-			},
-		})
-		if err != nil {
-			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			pub.log.Audit(fmt.Sprintf("Failed to verify SCT receipt: %s", err))
-			continue
+		internalSCT, err := pub.submitToLog(ctLog, chain, serial)
+		submission := core.CTSubmission{
+			CertificateSerial: serial,
+			LogID:             ctLog.logID,
+			Status:            core.CTSubmissionPending,
 		}
-
-		internalSCT, err := sctToInternal(sct, core.SerialToString(cert.SerialNumber))
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			pub.log.Audit(fmt.Sprintf("Failed to convert SCT receipt: %s", err))
-			continue
+			log.Audit(err.Error())
+			submission.LastError = err.Error()
+		} else {
+			submission.Status = core.CTSubmissionSubmitted
+			submission.SCTVersion = internalSCT.SCTVersion
+			submission.Timestamp = internalSCT.Timestamp
+			submission.Extensions = internalSCT.Extensions
+			submission.Signature = internalSCT.Signature
 		}
 
-		err = pub.SA.AddSCTReceipt(internalSCT)
+		err = pub.SA.RecordCTSubmission(ctx, submission)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			pub.log.Audit(fmt.Sprintf("Failed to store SCT receipt in database: %s", err))
-			continue
+			log.Audit(fmt.Sprintf("Failed to store CT submission in database: %s", err))
 		}
 	}
 
 	return nil
 }
 
+// submitToLog submits chain to ctLog, returning the SCT it issues once its
+// signature is verified.
+func (pub *PublisherImpl) submitToLog(ctLog *Log, chain []ct.ASN1Cert, serial string) (core.SignedCertificateTimestamp, error) {
+	var sct *ct.SignedCertificateTimestamp
+	err := chaos.Inject("publisher.AddChain")
+	if err == nil {
+		sct, err = ctLog.client.AddChain(chain)
+	}
+	if err != nil {
+		return core.SignedCertificateTimestamp{}, fmt.Errorf("Failed to submit certificate to CT log: %s", err)
+	}
+
+	err = ctLog.verifier.VerifySCTSignature(*sct, ct.LogEntry{
+		Leaf: ct.MerkleTreeLeaf{
+			LeafType: ct.TimestampedEntryLeafType,
+			TimestampedEntry: ct.TimestampedEntry{
+				X509Entry: chain[0],
+				EntryType: ct.X509LogEntryType,
+			},
+		},
+	})
+	if err != nil {
+		return core.SignedCertificateTimestamp{}, fmt.Errorf("Failed to verify SCT receipt: %s", err)
+	}
+
+	internalSCT, err := sctToInternal(sct, serial)
+	if err != nil {
+		return core.SignedCertificateTimestamp{}, fmt.Errorf("Failed to convert SCT receipt: %s", err)
+	}
+	return internalSCT, nil
+}
+
 func sctToInternal(sct *ct.SignedCertificateTimestamp, serial string) (core.SignedCertificateTimestamp, error) {
 	sig, err := ct.MarshalDigitallySigned(sct.Signature)
 	if err != nil {
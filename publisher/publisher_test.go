@@ -6,6 +6,7 @@
 package publisher
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
@@ -29,10 +30,13 @@ import (
 	ctClient "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/google/certificate-transparency/go/client"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
 
+	"github.com/letsencrypt/boulder/core"
 	"github.com/letsencrypt/boulder/mocks"
 	"github.com/letsencrypt/boulder/test"
 )
 
+var ctx = context.Background()
+
 var testLeaf = `-----BEGIN CERTIFICATE-----
 MIIHAjCCBeqgAwIBAgIQfwAAAQAAAUtRVNy9a8fMcDANBgkqhkiG9w0BAQsFADBa
 MQswCQYDVQQGEwJVUzESMBAGA1UEChMJSWRlblRydXN0MRcwFQYDVQQLEw5UcnVz
@@ -274,9 +278,16 @@ func addLog(t *testing.T, pub *PublisherImpl, port int, pubKey *ecdsa.PublicKey)
 	verifier, err := ct.NewSignatureVerifier(pubKey)
 	test.AssertNotError(t, err, "Couldn't create signature verifier")
 
+	rawKey, err := x509.MarshalPKIXPublicKey(pubKey)
+	test.AssertNotError(t, err, "Couldn't marshal log public key")
+	logID := sha256.Sum256(rawKey)
+
+	uri := fmt.Sprintf("http://localhost:%d", port)
 	pub.ctLogs = append(pub.ctLogs, &Log{
-		client:   ctClient.New(fmt.Sprintf("http://localhost:%d", port)),
+		client:   ctClient.New(uri),
 		verifier: verifier,
+		logID:    base64.StdEncoding.EncodeToString(logID[:]),
+		uri:      uri,
 	})
 }
 
@@ -290,14 +301,14 @@ func TestBasicSuccessful(t *testing.T) {
 	addLog(t, pub, port, &k.PublicKey)
 
 	log.Clear()
-	err = pub.SubmitToCT(leaf.Raw)
+	err = pub.SubmitToCT(ctx, leaf.Raw)
 	test.AssertNotError(t, err, "Certificate submission failed")
 	test.AssertEquals(t, len(log.GetAllMatching("Failed to.*")), 0)
 
 	// No Intermediate
 	pub.issuerBundle = []ct.ASN1Cert{}
 	log.Clear()
-	err = pub.SubmitToCT(leaf.Raw)
+	err = pub.SubmitToCT(ctx, leaf.Raw)
 	test.AssertNotError(t, err, "Certificate submission failed")
 	test.AssertEquals(t, len(log.GetAllMatching("Failed to.*")), 0)
 }
@@ -312,7 +323,7 @@ func TestGoodRetry(t *testing.T) {
 	addLog(t, pub, port, &k.PublicKey)
 
 	log.Clear()
-	err = pub.SubmitToCT(leaf.Raw)
+	err = pub.SubmitToCT(ctx, leaf.Raw)
 	test.AssertNotError(t, err, "Certificate submission failed")
 	test.AssertEquals(t, len(log.GetAllMatching("Failed to.*")), 0)
 }
@@ -327,7 +338,7 @@ func TestUnexpectedError(t *testing.T) {
 	addLog(t, pub, port, &k.PublicKey)
 
 	log.Clear()
-	err = pub.SubmitToCT(leaf.Raw)
+	err = pub.SubmitToCT(ctx, leaf.Raw)
 	test.AssertNotError(t, err, "Certificate submission failed")
 }
 
@@ -343,7 +354,7 @@ func TestRetryAfter(t *testing.T) {
 
 	log.Clear()
 	startedWaiting := time.Now()
-	err = pub.SubmitToCT(leaf.Raw)
+	err = pub.SubmitToCT(ctx, leaf.Raw)
 	test.AssertNotError(t, err, "Certificate submission failed")
 	test.AssertEquals(t, len(log.GetAllMatching("Failed to.*")), 0)
 
@@ -365,7 +376,7 @@ func TestMultiLog(t *testing.T) {
 	addLog(t, pub, portB, &k.PublicKey)
 
 	log.Clear()
-	err = pub.SubmitToCT(leaf.Raw)
+	err = pub.SubmitToCT(ctx, leaf.Raw)
 	test.AssertNotError(t, err, "Certificate submission failed")
 	test.AssertEquals(t, len(log.GetAllMatching("Failed to.*")), 0)
 }
@@ -380,7 +391,65 @@ func TestBadServer(t *testing.T) {
 	addLog(t, pub, port, &k.PublicKey)
 
 	log.Clear()
-	err = pub.SubmitToCT(leaf.Raw)
+	err = pub.SubmitToCT(ctx, leaf.Raw)
 	test.AssertNotError(t, err, "Certificate submission failed")
 	test.AssertEquals(t, len(log.GetAllMatching("Failed to verify SCT receipt")), 1)
 }
+
+type recordingSA struct {
+	*mocks.StorageAuthority
+	submissions []core.CTSubmission
+	inclusions  map[string]core.CTInclusionStatus
+}
+
+func (sa *recordingSA) GetCTSubmissions(ctx context.Context, serial string) ([]core.CTSubmission, error) {
+	return sa.submissions, nil
+}
+
+func (sa *recordingSA) RecordCTSubmission(ctx context.Context, submission core.CTSubmission) error {
+	sa.submissions = append(sa.submissions, submission)
+	return nil
+}
+
+func (sa *recordingSA) RecordCTInclusion(ctx context.Context, serial, logID string, status core.CTInclusionStatus) error {
+	if sa.inclusions == nil {
+		sa.inclusions = make(map[string]core.CTInclusionStatus)
+	}
+	sa.inclusions[logID] = status
+	return nil
+}
+
+func TestSubmissionsRecorded(t *testing.T) {
+	pub, leaf, k := setup(t)
+	sa := &recordingSA{StorageAuthority: mocks.NewStorageAuthority(clock.NewFake())}
+	pub.SA = sa
+
+	srv := logSrv(leaf.Raw, k)
+	defer srv.Close()
+	port, err := getPort(srv)
+	test.AssertNotError(t, err, "Failed to get test server port")
+	addLog(t, pub, port, &k.PublicKey)
+	badSrv := errorLogSrv()
+	defer badSrv.Close()
+	badPort, err := getPort(badSrv)
+	test.AssertNotError(t, err, "Failed to get test server port")
+	badKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Couldn't generate test key")
+	addLog(t, pub, badPort, &badKey.PublicKey)
+
+	err = pub.SubmitToCT(ctx, leaf.Raw)
+	test.AssertNotError(t, err, "Certificate submission failed")
+	test.AssertEquals(t, len(sa.submissions), 2)
+	test.AssertEquals(t, sa.submissions[0].Status, core.CTSubmissionSubmitted)
+	test.AssertEquals(t, sa.submissions[0].LogID, pub.ctLogs[0].logID)
+	test.AssertEquals(t, sa.submissions[0].Timestamp, uint64(1337))
+	test.AssertEquals(t, sa.submissions[1].Status, core.CTSubmissionPending)
+	test.AssertEquals(t, sa.submissions[1].LogID, pub.ctLogs[1].logID)
+	test.Assert(t, sa.submissions[1].LastError != "", "Failure wasn't recorded")
+
+	// Only the log without an SCT is submitted to again
+	err = pub.SubmitToCT(ctx, leaf.Raw)
+	test.AssertNotError(t, err, "Certificate submission failed")
+	test.AssertEquals(t, len(sa.submissions), 3)
+	test.AssertEquals(t, sa.submissions[2].LogID, pub.ctLogs[1].logID)
+}
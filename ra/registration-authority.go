@@ -6,7 +6,13 @@
 package ra
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
@@ -15,6 +21,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
@@ -22,10 +29,15 @@ import (
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/net/publicsuffix"
 	"github.com/letsencrypt/boulder/probs"
 
+	"github.com/letsencrypt/boulder/admin"
 	"github.com/letsencrypt/boulder/bdns"
 	"github.com/letsencrypt/boulder/cmd"
 	"github.com/letsencrypt/boulder/core"
+	berrors "github.com/letsencrypt/boulder/errors"
+	"github.com/letsencrypt/boulder/identifier"
 	blog "github.com/letsencrypt/boulder/log"
+	bmail "github.com/letsencrypt/boulder/mail"
+	"github.com/letsencrypt/boulder/tsa"
 )
 
 // DefaultAuthorizationLifetime is the 10 month default authorization lifetime.
@@ -39,6 +51,72 @@ const DefaultAuthorizationLifetime = 300 * 24 * time.Hour
 // TODO(rlb): Read from a config file
 const DefaultPendingAuthorizationLifetime = 7 * 24 * time.Hour
 
+// DefaultCAARecheckTimeout is how long the CAA rechecks of a certificate
+// request may take, all together, when CAARecheckTimeout isn't set.
+const DefaultCAARecheckTimeout = 10 * time.Second
+
+// DefaultOrderWorkers is how many certificate orders are processed at once
+// when OrderWorkers isn't set.
+const DefaultOrderWorkers = 10
+
+// DefaultTimestampQueueSize is how many issuance audit events may wait to
+// be timestamped when TimestampQueueSize isn't set.
+const DefaultTimestampQueueSize = 1000
+
+// DefaultOrderStaleAfter is how long processing of a certificate order may
+// take, when OrderStaleAfter isn't set, before it's presumed to have
+// stopped and another RA may resume the order.
+const DefaultOrderStaleAfter = 10 * time.Minute
+
+// DefaultOrderMaxAttempts is how many times processing of a certificate
+// order may begin, when OrderMaxAttempts isn't set, before it's failed.
+const DefaultOrderMaxAttempts = 3
+
+// DefaultOrderLifetime is how long a certificate order may stay processing
+// before it expires and is failed, for registrations whose tier doesn't
+// set an OrderLifetime.
+const DefaultOrderLifetime = 24 * time.Hour
+
+// TierPolicy overrides, for the registrations in one account tier, how long
+// authorizations and certificate orders last and how many authorizations
+// may be pending at once. Zero values keep the RA's defaults; a
+// per-registration override of the pendingAuthorizationsPerAccount rate
+// limit still takes priority over MaxPendingAuthorizations, which may be
+// cmd.Unlimited.
+type TierPolicy struct {
+	AuthorizationLifetime        time.Duration
+	PendingAuthorizationLifetime time.Duration
+	MaxPendingAuthorizations     int
+	OrderLifetime                time.Duration
+}
+
+// ProfilePolicy restricts which registrations may select a certificate
+// profile: those in Registrations, and those whose effective tier is one of
+// Tiers. If Default is set, the profile is also used for their requests
+// that don't select one, e.g. to move an account to short-lived
+// certificates without changing its client.
+type ProfilePolicy struct {
+	Registrations []int64
+	Tiers         []core.AccountTier
+	Default       bool
+}
+
+// allows returns whether the policy lets reg select its profile.
+func (pp ProfilePolicy) allows(reg core.Registration) bool {
+	for _, id := range pp.Registrations {
+		if id == reg.ID {
+			return true
+		}
+	}
+	tier := reg.EffectiveTier()
+	for _, t := range pp.Tiers {
+		if t == tier {
+			return true
+		}
+	}
+	return false
+}
+
 // RegistrationAuthorityImpl defines an RA.
 //
 // NOTE: All of the fields in RegistrationAuthorityImpl need to be
@@ -61,6 +139,209 @@ type RegistrationAuthorityImpl struct {
 	totalIssuedCache             int
 	lastIssuedCount              *time.Time
 	maxContactsPerReg            int
+
+	// rateLimitConfig is rlPolicies with the rate limit overrides set with
+	// admin-revoker, as last loaded from the SA, at overridesLoaded, or nil
+	// until they first are. overridesLoading is closed once the load in
+	// progress, if any, is done.
+	overridesMu      sync.Mutex
+	rateLimitConfig  *cmd.RateLimitConfig
+	overridesLoaded  time.Time
+	overridesLoading chan struct{}
+
+	// Optional. If set, new email contacts are mailed a link, made by
+	// ContactVerifier and rendered with VerificationEmail, that verifies
+	// them.
+	ContactVerifier   *bmail.ContactVerifier
+	Mailer            bmail.Mailer
+	VerificationEmail *template.Template
+
+	// PrivateCA allows certificates to be suspended with certificateHold,
+	// and later released, and to be requested with their own notBefore and
+	// notAfter, which the public CA profile forbids.
+	PrivateCA bool
+
+	// MailboxTokens, if set, derives the half of each email-reply-00
+	// challenge token that is mailed, with Mailer, to the address being
+	// validated. It must be set if the PA allows email identifiers.
+	MailboxTokens *bmail.MailboxTokens
+
+	// AdminVerifier, if set, requires the administrative methods to be
+	// called with a token signed by an operator, who they're attributed
+	// to, rather than the user the caller names.
+	AdminVerifier *admin.Verifier
+
+	// Tiers overrides authorization lifetimes and limits for the
+	// registrations in each account tier. Tiers without a policy, and
+	// registrations without a tier, get the defaults.
+	Tiers map[core.AccountTier]TierPolicy
+
+	// ProfilePolicies restricts the certificate profiles named in it to
+	// the registrations their policies allow. Profiles not named, and the
+	// CA's default profile, may be selected by any registration.
+	ProfilePolicies map[string]ProfilePolicy
+
+	// ReuseValidAuthz makes new authorization requests return the
+	// registration's existing valid authorization for the identifier, if
+	// it has one that lasts at least ReuseValidAuthzMinLifetime longer,
+	// rather than creating a pending one to be validated again. It can be
+	// rolled out to some registrations as the "reuseValidAuthz" feature.
+	ReuseValidAuthz            bool
+	ReuseValidAuthzMinLifetime time.Duration
+	// ReusePendingAuthz likewise returns an unexpired pending
+	// authorization when there's no valid one to reuse. It can be rolled
+	// out as the "reusePendingAuthz" feature.
+	ReusePendingAuthz bool
+
+	// Ed25519AccountKeys accepts Ed25519 keys for new registrations
+	Ed25519AccountKeys bool
+
+	// Timestamper, if set, obtains an RFC 3161 timestamp token over the
+	// hash of the audit event of each certificate issued, which is audit
+	// logged after the event, so that its time can be shown to others.
+	Timestamper tsa.Timestamper
+	// TimestampQueueSize is how many events may wait for their tokens, or
+	// DefaultTimestampQueueSize if zero. They're timestamped in the
+	// background, one at a time, so that issuance doesn't wait for the
+	// TSA; events that arrive when the queue is full aren't timestamped.
+	TimestampQueueSize int
+
+	// BannedContactDomains, and their subdomains, may not be the domains
+	// of email contacts, such as example.com, which can't receive mail.
+	BannedContactDomains []string
+
+	// MaxNames is the most names, once normalized and made unique, that a
+	// certificate may be requested for. Zero means no limit.
+	MaxNames int
+
+	// BlockedKeys, in addition to the keys blocked in the SA, may not be
+	// used for new registrations or certificates.
+	BlockedKeys core.BlockedKeys
+
+	// CAARecheckAfter, if set, has CAA rechecked at issuance for the DNS
+	// names whose last successful check, recorded in the SA when their
+	// authorizations were validated or they were last rechecked, is older
+	// than it. The rechecks are made in parallel, and must all finish
+	// within CAARecheckTimeout, or DefaultCAARecheckTimeout if that's
+	// zero.
+	CAARecheckAfter   time.Duration
+	CAARecheckTimeout time.Duration
+
+	// OrderWorkers is how many certificate orders are processed at once,
+	// and how many more may wait for them, or DefaultOrderWorkers if
+	// zero. Orders accepted when none may wait are left for
+	// ResumeCertificateOrders. OrderStaleAfter, or DefaultOrderStaleAfter,
+	// is how long an order's processing may take before it's cut short and
+	// the order may be resumed, at most OrderMaxAttempts times all told,
+	// or DefaultOrderMaxAttempts.
+	OrderWorkers     int
+	OrderStaleAfter  time.Duration
+	OrderMaxAttempts int
+
+	orderWorkersOnce sync.Once
+	orderWork        chan certificateOrderJob
+
+	timestampOnce  sync.Once
+	timestampQueue chan timestampJob
+}
+
+// certificateOrderJob is a processing certificate order waiting for an
+// order worker, with the request it's to issue a certificate for and the
+// audit log event of its checks.
+type certificateOrderJob struct {
+	requestID string
+	order     core.CertificateOrder
+	req       core.CertificateRequest
+	logEvent  certificateRequestEvent
+}
+
+// timestampJob is an issuance audit event waiting to be timestamped, with
+// the ID of the request it was logged for.
+type timestampJob struct {
+	requestID string
+	event     certificateRequestEvent
+}
+
+// reusableAuthorizations returns, by identifier value, the existing
+// authorizations of regID that new requests for identifiers can be given in
+// place of new ones: valid ones lasting at least ReuseValidAuthzMinLifetime
+// longer and, with ReusePendingAuthz, unexpired pending ones. They're found
+// with a single SA request, failure of which isn't fatal: new ones are
+// created.
+func (ra *RegistrationAuthorityImpl) reusableAuthorizations(ctx context.Context, regID int64, identifiers []identifier.ACMEIdentifier) map[string]core.Authorization {
+	reuseValid := ra.ReuseValidAuthz && core.FeatureEnabledFor("reuseValidAuthz", regID)
+	reusePending := ra.ReusePendingAuthz && core.FeatureEnabledFor("reusePendingAuthz", regID)
+	if (!reuseValid && !reusePending) || len(identifiers) == 0 {
+		return nil
+	}
+	names := make([]string, len(identifiers))
+	for i, identifier := range identifiers {
+		names[i] = identifier.Value
+	}
+	now := ra.clk.Now()
+	authzs, err := ra.SA.GetReusableAuthorizations(ctx, regID, names, now)
+	if err != nil {
+		ra.log.Warning(fmt.Sprintf("Failed to look up reusable authorizations: %s", err))
+		return nil
+	}
+
+	minExpiry := now.Add(ra.ReuseValidAuthzMinLifetime)
+	reusable := make(map[string]core.Authorization)
+	for name, authz := range authzs {
+		if authz.Expires == nil {
+			continue
+		}
+		if (reuseValid && authz.Status == core.StatusValid && authz.Expires.After(minExpiry)) ||
+			(reusePending && authz.Status == core.StatusPending && authz.Expires.After(now)) {
+			reusable[name] = *authz
+		}
+	}
+	return reusable
+}
+
+// countReuse counts authz being returned for a new authorization request.
+func (ra *RegistrationAuthorityImpl) countReuse(authz core.Authorization) {
+	if authz.Status == core.StatusValid {
+		ra.stats.Inc("RA.ReusedValidAuthz", 1, 1.0)
+	} else {
+		ra.stats.Inc("RA.ReusedPendingAuthz", 1, 1.0)
+	}
+}
+
+// authzLifetime returns how long authorizations of reg last once
+// valid.
+func (ra *RegistrationAuthorityImpl) authzLifetime(reg core.Registration) time.Duration {
+	if lifetime := ra.Tiers[reg.EffectiveTier()].AuthorizationLifetime; lifetime > 0 {
+		return lifetime
+	}
+	return ra.authorizationLifetime
+}
+
+// pendingAuthzLifetime returns how long authorizations of reg last while
+// pending.
+func (ra *RegistrationAuthorityImpl) pendingAuthzLifetime(reg core.Registration) time.Duration {
+	if lifetime := ra.Tiers[reg.EffectiveTier()].PendingAuthorizationLifetime; lifetime > 0 {
+		return lifetime
+	}
+	return ra.pendingAuthorizationLifetime
+}
+
+// orderLifetime returns how long certificate orders of reg may stay
+// processing.
+func (ra *RegistrationAuthorityImpl) orderLifetime(reg core.Registration) time.Duration {
+	if lifetime := ra.Tiers[reg.EffectiveTier()].OrderLifetime; lifetime > 0 {
+		return lifetime
+	}
+	return DefaultOrderLifetime
+}
+
+// pendingAuthzLimit returns the limit on reg's pending authorizations.
+func (ra *RegistrationAuthorityImpl) pendingAuthzLimit(ctx context.Context, reg core.Registration) *cmd.RateLimitPolicy {
+	limit := ra.rateLimits(ctx).PendingAuthorizationsPerAccount
+	if max := ra.Tiers[reg.EffectiveTier()].MaxPendingAuthorizations; max != 0 {
+		limit.Threshold = max
+	}
+	return &limit
 }
 
 // NewRegistrationAuthorityImpl constructs a new RA object.
@@ -82,6 +363,7 @@ func NewRegistrationAuthorityImpl(clk clock.Clock, logger *blog.AuditLogger, sta
 const (
 	unparseableEmailDetail = "not a valid e-mail address"
 	emptyDNSResponseDetail = "empty DNS response"
+	bannedDomainDetail     = "forbidden domain %s"
 )
 
 func validateEmail(address string, resolver bdns.DNSResolver) (prob *probs.ProblemDetails) {
@@ -129,11 +411,22 @@ type certificateRequestEvent struct {
 	Names               []string  `json:",omitempty"`
 	NotBefore           time.Time `json:",omitempty"`
 	NotAfter            time.Time `json:",omitempty"`
+	Profile             string    `json:",omitempty"`
 	RequestTime         time.Time `json:",omitempty"`
 	ResponseTime        time.Time `json:",omitempty"`
 	Error               string    `json:",omitempty"`
 }
 
+// certificateRequestTimestamp is audit logged after a successful
+// certificateRequestEvent, with a timestamp token over the SHA-256 hash of
+// the event's JSON as it was logged.
+type certificateRequestTimestamp struct {
+	ID          string
+	EventSHA256 string
+	Time        time.Time
+	Token       []byte
+}
+
 var issuanceCountCacheLife = 1 * time.Minute
 
 // issuanceCountInvalid checks if the current issuance count is invalid either
@@ -143,24 +436,25 @@ func (ra *RegistrationAuthorityImpl) issuanceCountInvalid(now time.Time) bool {
 	return ra.lastIssuedCount == nil || ra.lastIssuedCount.Add(issuanceCountCacheLife).Before(now)
 }
 
-func (ra *RegistrationAuthorityImpl) getIssuanceCount() (int, error) {
+func (ra *RegistrationAuthorityImpl) getIssuanceCount(ctx context.Context) (int, error) {
 	ra.tiMu.RLock()
 	if ra.issuanceCountInvalid(ra.clk.Now()) {
 		ra.tiMu.RUnlock()
-		return ra.setIssuanceCount()
+		return ra.setIssuanceCount(ctx)
 	}
 	count := ra.totalIssuedCache
 	ra.tiMu.RUnlock()
 	return count, nil
 }
 
-func (ra *RegistrationAuthorityImpl) setIssuanceCount() (int, error) {
+func (ra *RegistrationAuthorityImpl) setIssuanceCount(ctx context.Context) (int, error) {
 	ra.tiMu.Lock()
 	defer ra.tiMu.Unlock()
 
 	now := ra.clk.Now()
 	if ra.issuanceCountInvalid(now) {
 		count, err := ra.SA.CountCertificatesRange(
+			ctx,
 			now.Add(-ra.rlPolicies.TotalCertificates.Window.Duration),
 			now,
 		)
@@ -173,31 +467,92 @@ func (ra *RegistrationAuthorityImpl) setIssuanceCount() (int, error) {
 	return ra.totalIssuedCache, nil
 }
 
+var rateLimitOverridesCacheLife = 1 * time.Minute
+
+// rateLimits returns the configured rate limits with the overrides set with
+// admin-revoker, which are reloaded from the SA at most once per
+// rateLimitOverridesCacheLife. One request reloads them, without holding
+// overridesMu, while the others carry on with the limits last loaded, or
+// wait for the first ones. If they can't be loaded, the overrides last
+// loaded are kept.
+func (ra *RegistrationAuthorityImpl) rateLimits(ctx context.Context) cmd.RateLimitConfig {
+	ra.overridesMu.Lock()
+	limits, loading := ra.rateLimitConfig, ra.overridesLoading
+	stale := ra.overridesLoaded.IsZero() || !ra.clk.Now().Before(ra.overridesLoaded.Add(rateLimitOverridesCacheLife))
+	if limits != nil && (!stale || loading != nil) {
+		ra.overridesMu.Unlock()
+		return *limits
+	}
+	if loading != nil {
+		ra.overridesMu.Unlock()
+		select {
+		case <-loading:
+		case <-ctx.Done():
+			return ra.rlPolicies
+		}
+		ra.overridesMu.Lock()
+		defer ra.overridesMu.Unlock()
+		return *ra.rateLimitConfig
+	}
+	loading = make(chan struct{})
+	ra.overridesLoading = loading
+	ra.overridesMu.Unlock()
+
+	overrides, err := ra.SA.GetRateLimitOverrides(ctx)
+	if err != nil {
+		ra.log.Warning(fmt.Sprintf("Failed to load rate limit overrides: %s", err))
+		ra.stats.Inc("RA.RateLimitOverrides.LoadFailed", 1, 1.0)
+	}
+	// WithOverrides copies the policies it overrides, so the merged limits
+	// are kept rather than merged again for each request
+	merged := ra.rlPolicies.WithOverrides(overrides)
+
+	ra.overridesMu.Lock()
+	defer ra.overridesMu.Unlock()
+	if err == nil || ra.rateLimitConfig == nil {
+		ra.rateLimitConfig = &merged
+	}
+	// Failures are retried with the next reload, not on every request
+	ra.overridesLoaded = ra.clk.Now()
+	ra.overridesLoading = nil
+	close(loading)
+	return *ra.rateLimitConfig
+}
+
 // noRegistrationID is used for the regID parameter to GetThreshold when no
 // registration-based overrides are necessary.
 const noRegistrationID = -1
 
-func (ra *RegistrationAuthorityImpl) checkRegistrationLimit(ip net.IP) error {
-	limit := ra.rlPolicies.RegistrationsPerIP
+func (ra *RegistrationAuthorityImpl) checkRegistrationLimit(ctx context.Context, ip net.IP) error {
+	limit := ra.rateLimits(ctx).RegistrationsPerIP
 	if limit.Enabled() {
 		now := ra.clk.Now()
-		count, err := ra.SA.CountRegistrationsByIP(ip, limit.WindowBegin(now), now)
+		count, err := ra.SA.CountRegistrationsByIP(ctx, ip, limit.WindowBegin(now), now)
 		if err != nil {
 			return err
 		}
-		if count >= limit.GetThreshold(ip.String(), noRegistrationID) {
-			return core.RateLimitedError("Too many registrations from this IP")
+		threshold := limit.GetThreshold(ip.String(), noRegistrationID)
+		if threshold != cmd.Unlimited && count >= threshold {
+			return berrors.RateLimitError("Too many registrations from this IP")
 		}
 	}
 	return nil
 }
 
 // NewRegistration constructs a new Registration from a request.
-func (ra *RegistrationAuthorityImpl) NewRegistration(init core.Registration) (reg core.Registration, err error) {
-	if err = core.GoodKey(init.Key.Key); err != nil {
-		return core.Registration{}, core.MalformedRequestError(fmt.Sprintf("Invalid public key: %s", err.Error()))
+func (ra *RegistrationAuthorityImpl) NewRegistration(ctx context.Context, init core.Registration) (reg core.Registration, err error) {
+	if err = core.GoodAccountKey(init.Key.Key, ra.Ed25519AccountKeys); err != nil {
+		return core.Registration{}, berrors.MalformedError("Invalid public key: %s", err)
+	}
+	keyBlocked, err := core.KeyBlocked(ctx, init.Key.Key, ra.BlockedKeys, ra.SA)
+	if err != nil {
+		return core.Registration{}, err
+	}
+	if keyBlocked {
+		ra.stats.Inc("RA.BlockedKeys.Registration", 1, 1.0)
+		return core.Registration{}, probs.BadPublicKey("Key is blocked because it is known to be compromised")
 	}
-	if err = ra.checkRegistrationLimit(init.InitialIP); err != nil {
+	if err = ra.checkRegistrationLimit(ctx, init.InitialIP); err != nil {
 		return core.Registration{}, err
 	}
 
@@ -216,11 +571,13 @@ func (ra *RegistrationAuthorityImpl) NewRegistration(init core.Registration) (re
 	}
 
 	// Store the authorization object, then return it
-	reg, err = ra.SA.NewRegistration(reg)
+	reg, err = ra.SA.NewRegistration(ctx, reg)
 	if err != nil {
 		// InternalServerError since the user-data was validated before being
 		// passed to the SA.
 		err = core.InternalServerError(err.Error())
+	} else {
+		ra.sendContactVerifications(reg.ID, reg.Contact)
 	}
 
 	ra.stats.Inc("RA.NewRegistrations", 1, 1.0)
@@ -229,18 +586,22 @@ func (ra *RegistrationAuthorityImpl) NewRegistration(init core.Registration) (re
 
 func (ra *RegistrationAuthorityImpl) validateContacts(contacts []*core.AcmeURL) (err error) {
 	if ra.maxContactsPerReg > 0 && len(contacts) > ra.maxContactsPerReg {
-		return core.MalformedRequestError(fmt.Sprintf("Too many contacts provided: %d > %d",
-			len(contacts), ra.maxContactsPerReg))
+		return berrors.MalformedError("Too many contacts provided: %d > %d",
+			len(contacts), ra.maxContactsPerReg)
 	}
 
 	for _, contact := range contacts {
 		if contact == nil {
-			return core.MalformedRequestError("Invalid contact")
+			return berrors.MalformedError("Invalid contact")
 		}
 		switch contact.Scheme {
 		case "tel":
 			continue
 		case "mailto":
+			if problem := ra.checkContactDomain(contact.Opaque); problem != nil {
+				ra.stats.Inc("RA.ValidateEmail.Banned", 1, 1.0)
+				return problem
+			}
 			start := ra.clk.Now()
 			ra.stats.Inc("RA.ValidateEmail.Calls", 1, 1.0)
 			problem := validateEmail(contact.Opaque, ra.DNSResolver)
@@ -251,7 +612,7 @@ func (ra *RegistrationAuthorityImpl) validateContacts(contacts []*core.AcmeURL)
 			}
 			ra.stats.Inc("RA.ValidateEmail.Successes", 1, 1.0)
 		default:
-			err = core.MalformedRequestError(fmt.Sprintf("Contact method %s is not supported", contact.Scheme))
+			err = berrors.MalformedError("Contact method %s is not supported", contact.Scheme)
 			return
 		}
 	}
@@ -259,17 +620,94 @@ func (ra *RegistrationAuthorityImpl) validateContacts(contacts []*core.AcmeURL)
 	return
 }
 
-func checkPendingAuthorizationLimit(sa core.StorageGetter, limit *cmd.RateLimitPolicy, regID int64) error {
-	if limit.Enabled() {
-		count, err := sa.CountPendingAuthorizations(regID)
+// checkContactDomain returns a problem if the domain of the email address
+// is one of the BannedContactDomains or a subdomain of one.
+func (ra *RegistrationAuthorityImpl) checkContactDomain(address string) *probs.ProblemDetails {
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		// validateEmail finds it unparseable
+		return nil
+	}
+	domain := strings.TrimSuffix(strings.ToLower(address[at+1:]), ".")
+	for _, banned := range ra.BannedContactDomains {
+		banned = strings.ToLower(banned)
+		if domain == banned || strings.HasSuffix(domain, "."+banned) {
+			return &probs.ProblemDetails{
+				Type:   probs.InvalidEmailProblem,
+				Detail: fmt.Sprintf(bannedDomainDetail, domain),
+			}
+		}
+	}
+	return nil
+}
+
+// checkPendingAuthorizationLimit returns an error if creating newAuthzs more
+// pending authorizations would put regID over its limit.
+func checkPendingAuthorizationLimit(ctx context.Context, sa core.StorageGetter, limit *cmd.RateLimitPolicy, regID int64, newAuthzs int) error {
+	if newAuthzs > 0 && limit.Enabled() {
+		count, err := sa.CountPendingAuthorizations(ctx, regID)
 		if err != nil {
 			return err
 		}
 		// Most rate limits have a key for overrides, but there is no meaningful key
 		// here.
 		noKey := ""
-		if count > limit.GetThreshold(noKey, regID) {
-			return core.RateLimitedError("Too many currently pending authorizations.")
+		threshold := limit.GetThreshold(noKey, regID)
+		if threshold != cmd.Unlimited && count+newAuthzs > threshold {
+			return berrors.RateLimitError("Too many currently pending authorizations.")
+		}
+	}
+	return nil
+}
+
+// checkSafeDomain returns an error if identifier is a domain that the
+// third-party safe browsing API considers unsafe.
+func (ra *RegistrationAuthorityImpl) checkSafeDomain(ctx context.Context, identifier identifier.ACMEIdentifier) error {
+	if identifier.Type != core.IdentifierDNS {
+		return nil
+	}
+	isSafe, err := ra.dc.IsSafe(ctx, identifier.Value)
+	if err != nil {
+		outErr := core.InternalServerError("unable to determine if domain was safe")
+		ra.log.Warning(fmt.Sprintf("%s: %s", string(outErr), err))
+		return outErr
+	}
+	if !isSafe {
+		return berrors.UnauthorizedError("%#v was considered an unsafe domain by a third-party API", identifier.Value)
+	}
+	return nil
+}
+
+// pendingAuthorization returns a pending authorization, with challenges, for
+// identifier, ready to be stored.
+func (ra *RegistrationAuthorityImpl) pendingAuthorization(reg core.Registration, identifier identifier.ACMEIdentifier) (core.Authorization, error) {
+	// Create validations. The WFE will  update them with URIs before sending them out.
+	challenges, combinations, err := ra.PA.ChallengesFor(identifier, &reg.Key)
+	if err != nil {
+		return core.Authorization{}, err
+	}
+
+	expires := ra.clk.Now().Add(ra.pendingAuthzLifetime(reg))
+
+	// Partially-filled object
+	return core.Authorization{
+		Identifier:     identifier,
+		RegistrationID: reg.ID,
+		Status:         core.StatusPending,
+		Combinations:   combinations,
+		Challenges:     challenges,
+		Expires:        &expires,
+	}, nil
+}
+
+// checkChallengesSane returns an error if any of the challenges of a stored
+// authorization fails its sanity check.
+func checkChallengesSane(authz core.Authorization) error {
+	for _, challenge := range authz.Challenges {
+		if !challenge.IsSane(false) {
+			// InternalServerError because we generated these challenges, they should
+			// be OK.
+			return core.InternalServerError(fmt.Sprintf("Challenge didn't pass sanity check: %+v", challenge))
 		}
 	}
 	return nil
@@ -277,55 +715,45 @@ func checkPendingAuthorizationLimit(sa core.StorageGetter, limit *cmd.RateLimitP
 
 // NewAuthorization constuct a new Authz from a request. Values (domains) in
 // request.Identifier will be lowercased before storage.
-func (ra *RegistrationAuthorityImpl) NewAuthorization(request core.Authorization, regID int64) (authz core.Authorization, err error) {
-	reg, err := ra.SA.GetRegistration(regID)
+func (ra *RegistrationAuthorityImpl) NewAuthorization(ctx context.Context, request core.Authorization, regID int64) (authz core.Authorization, err error) {
+	reg, err := ra.SA.GetRegistration(ctx, regID)
+	if _, ok := err.(core.NoSuchRegistrationError); ok {
+		err = berrors.MalformedError("Invalid registration ID: %d", regID)
+		return authz, err
+	}
 	if err != nil {
-		err = core.MalformedRequestError(fmt.Sprintf("Invalid registration ID: %d", regID))
 		return authz, err
 	}
 
-	identifier := request.Identifier
-	identifier.Value = strings.ToLower(identifier.Value)
+	id := request.Identifier.Normalized()
 
 	// Check that the identifier is present and appropriate
-	if err = ra.PA.WillingToIssue(identifier, regID); err != nil {
+	if err = ra.PA.WillingToIssue(id, regID); err != nil {
 		return authz, err
 	}
 
-	limit := &ra.rlPolicies.PendingAuthorizationsPerAccount
-	if err = checkPendingAuthorizationLimit(ra.SA, limit, regID); err != nil {
-		return authz, err
+	reusable := ra.reusableAuthorizations(ctx, regID, []identifier.ACMEIdentifier{id})
+	if existing, ok := reusable[id.Value]; ok {
+		ra.countReuse(existing)
+		return existing, nil
 	}
 
-	if identifier.Type == core.IdentifierDNS {
-		isSafe, err := ra.dc.IsSafe(identifier.Value)
-		if err != nil {
-			outErr := core.InternalServerError("unable to determine if domain was safe")
-			ra.log.Warning(fmt.Sprintf("%s: %s", string(outErr), err))
-			return authz, outErr
-		}
-		if !isSafe {
-			return authz, core.UnauthorizedError(fmt.Sprintf("%#v was considered an unsafe domain by a third-party API", identifier.Value))
-		}
+	limit := ra.pendingAuthzLimit(ctx, reg)
+	if err = checkPendingAuthorizationLimit(ctx, ra.SA, limit, regID, 1); err != nil {
+		return authz, err
 	}
 
-	// Create validations. The WFE will  update them with URIs before sending them out.
-	challenges, combinations, err := ra.PA.ChallengesFor(identifier, &reg.Key)
-
-	expires := ra.clk.Now().Add(ra.pendingAuthorizationLifetime)
+	if err = ra.checkSafeDomain(ctx, id); err != nil {
+		return authz, err
+	}
 
-	// Partially-filled object
-	authz = core.Authorization{
-		Identifier:     identifier,
-		RegistrationID: regID,
-		Status:         core.StatusPending,
-		Combinations:   combinations,
-		Challenges:     challenges,
-		Expires:        &expires,
+	authz, err = ra.pendingAuthorization(reg, id)
+	if err != nil {
+		return authz, err
 	}
 
 	// Get a pending Auth first so we can get our ID back, then update with challenges
-	authz, err = ra.SA.NewPendingAuthorization(authz)
+	authz, err = ra.SA.NewPendingAuthorization(ctx, authz)
 	if err != nil {
 		// InternalServerError since the user-data was validated before being
 		// passed to the SA.
@@ -333,17 +761,165 @@ func (ra *RegistrationAuthorityImpl) NewAuthorization(request core.Authorization
 		return core.Authorization{}, err
 	}
 
-	// Check each challenge for sanity.
+	if err = checkChallengesSane(authz); err != nil {
+		return core.Authorization{}, err
+	}
+
+	if err = ra.sendMailboxTokens(authz); err != nil {
+		return core.Authorization{}, err
+	}
+
+	return authz, err
+}
+
+// mailboxChallengeEmail is the message that carries the mailed half of an
+// email-reply-00 token, in its subject, to the address being validated.
+const mailboxChallengeEmail = "To: %s\r\n" +
+	"Subject: ACME: %s\r\n" +
+	"\r\n" +
+	"A certificate has been requested for this address. If you requested it,\r\n" +
+	"your ACME client needs the token in the subject of this message to\r\n" +
+	"complete the request. If you didn't, you can ignore this message.\r\n"
+
+// sendMailboxTokens mails the first half of the token of each email-reply-00
+// challenge of authz to the address being validated. Unlike contact
+// verification, failures are returned: the challenge can't be completed
+// without the mail.
+func (ra *RegistrationAuthorityImpl) sendMailboxTokens(authz core.Authorization) error {
+	if authz.Identifier.Type != core.IdentifierEmail {
+		return nil
+	}
+	if ra.MailboxTokens == nil || ra.Mailer == nil {
+		return core.InternalServerError("Email identifiers are allowed, but mailbox validation isn't configured")
+	}
+	address := authz.Identifier.Value
 	for _, challenge := range authz.Challenges {
-		if !challenge.IsSane(false) {
-			// InternalServerError because we generated these challenges, they should
-			// be OK.
-			err = core.InternalServerError(fmt.Sprintf("Challenge didn't pass sanity check: %+v", challenge))
-			return core.Authorization{}, err
+		if challenge.Type != core.ChallengeTypeEmailReply00 {
+			continue
+		}
+		token := ra.MailboxTokens.Token(address, challenge.Token)
+		if err := ra.Mailer.SendMail([]string{address}, fmt.Sprintf(mailboxChallengeEmail, address, token)); err != nil {
+			ra.log.Warning(fmt.Sprintf("Failed to mail challenge token for authorization %s: %s", authz.ID, err))
+			ra.stats.Inc("RA.MailboxTokens.Errors", 1, 1.0)
+			return core.InternalServerError("Couldn't mail the challenge token to the address")
 		}
+		ra.stats.Inc("RA.MailboxTokens.Sent", 1, 1.0)
 	}
+	return nil
+}
 
-	return authz, err
+// authorizationBatchSize is the most authorizations NewAuthorizations stores
+// with one call to the SA.
+const authorizationBatchSize = 20
+
+// NewAuthorizations constructs new Authzs for several requests at once, as
+// NewAuthorization does for one. The identifiers are checked in parallel, and
+// the authorizations are stored in parallel batches, so that requests for many
+// names don't take many round trips. If any request is refused, no
+// authorizations are created. Reused valid authorizations don't count toward
+// the pending authorization limit.
+func (ra *RegistrationAuthorityImpl) NewAuthorizations(ctx context.Context, requests []core.Authorization, regID int64) ([]core.Authorization, error) {
+	reg, err := ra.SA.GetRegistration(ctx, regID)
+	if _, ok := err.(core.NoSuchRegistrationError); ok {
+		return nil, berrors.MalformedError("Invalid registration ID: %d", regID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	identifiers := make([]identifier.ACMEIdentifier, len(requests))
+	for i, request := range requests {
+		identifiers[i] = request.Identifier.Normalized()
+	}
+	// The existing authorizations to reuse are looked up all at once,
+	// rather than one request to the SA per identifier
+	reusable := ra.reusableAuthorizations(ctx, regID, identifiers)
+
+	authzs := make([]core.Authorization, len(requests))
+	reused := make([]bool, len(requests))
+	errs := make([]error, len(requests))
+	var wg sync.WaitGroup
+	for i, id := range identifiers {
+		wg.Add(1)
+		go func(i int, id identifier.ACMEIdentifier) {
+			defer wg.Done()
+			if errs[i] = ra.PA.WillingToIssue(id, regID); errs[i] != nil {
+				return
+			}
+			if authzs[i], reused[i] = reusable[id.Value]; reused[i] {
+				return
+			}
+			if errs[i] = ra.checkSafeDomain(ctx, id); errs[i] != nil {
+				return
+			}
+			authzs[i], errs[i] = ra.pendingAuthorization(reg, id)
+		}(i, id)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i, authz := range authzs {
+		if reused[i] {
+			ra.countReuse(authz)
+		}
+	}
+
+	var pending []core.Authorization
+	var pendingIndexes []int
+	for i, authz := range authzs {
+		if !reused[i] {
+			pending = append(pending, authz)
+			pendingIndexes = append(pendingIndexes, i)
+		}
+	}
+
+	limit := ra.pendingAuthzLimit(ctx, reg)
+	if err = checkPendingAuthorizationLimit(ctx, ra.SA, limit, regID, len(pending)); err != nil {
+		return nil, err
+	}
+
+	// Store the batches. A failed batch leaves the others' authorizations
+	// pending, which is harmless: they expire unused.
+	batchErrs := make([]error, (len(pending)+authorizationBatchSize-1)/authorizationBatchSize)
+	for start := 0; start < len(pending); start += authorizationBatchSize {
+		end := start + authorizationBatchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		wg.Add(1)
+		go func(batch int, authzs []core.Authorization) {
+			defer wg.Done()
+			stored, err := ra.SA.NewPendingAuthorizations(ctx, authzs)
+			if err != nil {
+				// InternalServerError since the user-data was validated before being
+				// passed to the SA.
+				batchErrs[batch] = core.InternalServerError(fmt.Sprintf("Invalid authorization request: %s", err))
+				return
+			}
+			copy(authzs, stored)
+		}(start/authorizationBatchSize, pending[start:end])
+	}
+	wg.Wait()
+	for _, err := range batchErrs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, authz := range pending {
+		if err = checkChallengesSane(authz); err != nil {
+			return nil, err
+		}
+		if err = ra.sendMailboxTokens(authz); err != nil {
+			return nil, err
+		}
+		authzs[pendingIndexes[i]] = authz
+	}
+	ra.stats.Inc("RA.NewAuthorizations.Batched", int64(len(pending)), 1.0)
+	return authzs, nil
 }
 
 // MatchesCSR tests the contents of a generated certificate to make sure
@@ -353,7 +929,9 @@ func (ra *RegistrationAuthorityImpl) NewAuthorization(request core.Authorization
 //		* notBefore is not more than 24 hours ago
 //		* BasicConstraintsValid is true
 //		* IsCA is false
-//		* ExtKeyUsage only contains ExtKeyUsageServerAuth & ExtKeyUsageClientAuth
+//		* ExtKeyUsage only contains ExtKeyUsageServerAuth & ExtKeyUsageClientAuth,
+//		  or for S/MIME certificates contains ExtKeyUsageEmailProtection and
+//		  at most ExtKeyUsageClientAuth besides
 //		* Subject only contains CommonName & Names
 func (ra *RegistrationAuthorityImpl) MatchesCSR(cert core.Certificate, csr *x509.CertificateRequest) (err error) {
 	parsedCertificate, err := x509.ParseCertificate([]byte(cert.DER))
@@ -362,26 +940,22 @@ func (ra *RegistrationAuthorityImpl) MatchesCSR(cert core.Certificate, csr *x509
 	}
 
 	// Check issued certificate matches what was expected from the CSR
-	hostNames := make([]string, len(csr.DNSNames))
-	copy(hostNames, csr.DNSNames)
-	if len(csr.Subject.CommonName) > 0 {
-		hostNames = append(hostNames, csr.Subject.CommonName)
-	}
-	hostNames = core.UniqueLowerNames(hostNames)
+	identifiers := identifier.FromCSR(csr)
+	hostNames := identifier.ValuesOfType(identifiers, identifier.DNS)
+	emailAddresses := identifier.ValuesOfType(identifiers, identifier.Email)
 
 	if !core.KeyDigestEquals(parsedCertificate.PublicKey, csr.PublicKey) {
 		err = core.InternalServerError("Generated certificate public key doesn't match CSR public key")
 		return
 	}
 	if len(csr.Subject.CommonName) > 0 &&
-		parsedCertificate.Subject.CommonName != strings.ToLower(csr.Subject.CommonName) {
+		parsedCertificate.Subject.CommonName != identifier.FromValue(csr.Subject.CommonName).Value {
 		err = core.InternalServerError("Generated certificate CommonName doesn't match CSR CommonName")
 		return
 	}
-	// Sort both slices of names before comparison.
+	// Sort the certificate's names before comparison; the CSR's are sorted.
 	parsedNames := parsedCertificate.DNSNames
 	sort.Strings(parsedNames)
-	sort.Strings(hostNames)
 	if !reflect.DeepEqual(parsedNames, hostNames) {
 		err = core.InternalServerError("Generated certificate DNSNames don't match CSR DNSNames")
 		return
@@ -390,7 +964,8 @@ func (ra *RegistrationAuthorityImpl) MatchesCSR(cert core.Certificate, csr *x509
 		err = core.InternalServerError("Generated certificate IPAddresses don't match CSR IPAddresses")
 		return
 	}
-	if !reflect.DeepEqual(parsedCertificate.EmailAddresses, csr.EmailAddresses) {
+	parsedAddresses := identifier.ValuesOfType(identifier.FromCert(parsedCertificate), identifier.Email)
+	if !reflect.DeepEqual(parsedAddresses, emailAddresses) {
 		err = core.InternalServerError("Generated certificate EmailAddresses don't match CSR EmailAddresses")
 		return
 	}
@@ -414,7 +989,12 @@ func (ra *RegistrationAuthorityImpl) MatchesCSR(cert core.Certificate, csr *x509
 		err = core.InternalServerError("Generated certificate can sign other certificates")
 		return
 	}
-	if !reflect.DeepEqual(parsedCertificate.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}) {
+	if len(emailAddresses) > 0 {
+		if !smimeExtKeyUsage(parsedCertificate.ExtKeyUsage) {
+			err = core.InternalServerError("Generated certificate doesn't have correct key usage extensions")
+			return
+		}
+	} else if !reflect.DeepEqual(parsedCertificate.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}) {
 		err = core.InternalServerError("Generated certificate doesn't have correct key usage extensions")
 		return
 	}
@@ -422,119 +1002,691 @@ func (ra *RegistrationAuthorityImpl) MatchesCSR(cert core.Certificate, csr *x509
 	return
 }
 
+// smimeExtKeyUsage reports whether ekus are those of an S/MIME certificate:
+// email protection, and possibly client authentication.
+func smimeExtKeyUsage(ekus []x509.ExtKeyUsage) bool {
+	emailProtection := false
+	for _, eku := range ekus {
+		switch eku {
+		case x509.ExtKeyUsageEmailProtection:
+			emailProtection = true
+		case x509.ExtKeyUsageClientAuth:
+		default:
+			return false
+		}
+	}
+	return emailProtection
+}
+
 // checkAuthorizations checks that each requested name has a valid authorization
-// that won't expire before the certificate expires. Returns an error otherwise.
-func (ra *RegistrationAuthorityImpl) checkAuthorizations(names []string, registration *core.Registration) error {
+// that won't expire before the certificate expires. Otherwise it returns an
+// Unauthorized problem with a subproblem for each name that is not covered,
+// saying whether its authorization is missing, expired, or not yet valid. The
+// authorizations are returned by name, without their challenges.
+func (ra *RegistrationAuthorityImpl) checkAuthorizations(ctx context.Context, names []string, registration *core.Registration) (map[string]*core.Authorization, error) {
 	now := ra.clk.Now()
+	authzs, err := ra.SA.GetAuthorizations(ctx, registration.ID, names, now)
+	if err != nil {
+		return nil, err
+	}
+
 	var badNames []string
+	var subProblems []probs.SubProblemDetails
 	for _, name := range names {
-		authz, err := ra.SA.GetLatestValidAuthorization(registration.ID, core.AcmeIdentifier{Type: core.IdentifierDNS, Value: name})
-		if err != nil || authz.Expires.Before(now) {
-			badNames = append(badNames, name)
+		var detail string
+		authz := authzs[name]
+		switch {
+		case authz == nil:
+			detail = fmt.Sprintf("No authorization found for %s", name)
+		case authz.Expires == nil || authz.Expires.Before(now):
+			detail = fmt.Sprintf("Authorization for %s expired", name)
+		case authz.Status != core.StatusValid:
+			detail = fmt.Sprintf("Authorization for %s is %s", name, authz.Status)
+		default:
+			continue
 		}
+		badNames = append(badNames, name)
+		subProblems = append(subProblems, probs.SubProblemDetails{
+			ProblemDetails: *probs.Unauthorized(detail),
+			Identifier:     probs.Identifier{Type: string(identifier.FromValue(name).Type), Value: name},
+		})
 	}
 
 	if len(badNames) > 0 {
-		return core.UnauthorizedError(fmt.Sprintf(
+		prob := probs.Unauthorized(fmt.Sprintf(
 			"Authorizations for these names not found or expired: %s",
 			strings.Join(badNames, ", ")))
+		prob.SubProblems = subProblems
+		return nil, prob
 	}
-	return nil
+	return authzs, nil
 }
 
-// NewCertificate requests the issuance of a certificate.
-func (ra *RegistrationAuthorityImpl) NewCertificate(req core.CertificateRequest, regID int64) (cert core.Certificate, err error) {
-	emptyCert := core.Certificate{}
-	var logEventResult string
-
-	// Assume the worst
-	logEventResult = "error"
-
-	// Construct the log event
-	logEvent := certificateRequestEvent{
-		ID:            core.NewToken(),
-		Requester:     regID,
-		RequestMethod: "online",
-		RequestTime:   ra.clk.Now(),
+// validatedChallengeType returns the type of the challenge that was validated
+// for authz, fetching its challenges if it doesn't have them.
+func (ra *RegistrationAuthorityImpl) validatedChallengeType(ctx context.Context, authz *core.Authorization) (string, error) {
+	if len(authz.Challenges) == 0 {
+		full, err := ra.SA.GetAuthorization(ctx, authz.ID)
+		if err != nil {
+			return "", err
+		}
+		authz = &full
 	}
-
-	// No matter what, log the request
-	defer func() {
-		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
-		ra.log.AuditObject(fmt.Sprintf("Certificate request - %s", logEventResult), logEvent)
-	}()
-
-	if regID <= 0 {
-		err = core.MalformedRequestError(fmt.Sprintf("Invalid registration ID: %d", regID))
-		return emptyCert, err
+	for _, challenge := range authz.Challenges {
+		if challenge.Status == core.StatusValid {
+			return challenge.Type, nil
+		}
 	}
+	return "", fmt.Errorf("Authorization %s has no valid challenge", authz.ID)
+}
 
-	registration, err := ra.SA.GetRegistration(regID)
-	if err != nil {
-		logEvent.Error = err.Error()
-		return emptyCert, err
+// recheckCAA rechecks CAA for those of names whose last successful check is
+// older than CAARecheckAfter, or unknown, and records the time of those that
+// pass. A database schema lacking CAA checks has every name rechecked. Each
+// name is checked for regID and the challenge type its valid authorization in
+// authzs was validated with, so that records restricting issuance to an
+// account or validation method are honored.
+func (ra *RegistrationAuthorityImpl) recheckCAA(ctx context.Context, regID int64, authzs map[string]*core.Authorization, names []string) error {
+	if ra.CAARecheckAfter <= 0 || len(names) == 0 {
+		return nil
+	}
+	now := ra.clk.Now()
+	checks, err := ra.SA.GetCAAChecks(ctx, names)
+	if _, ok := err.(core.NotSupportedError); ok {
+		checks = nil
+	} else if err != nil {
+		return err
 	}
 
-	// Verify the CSR
-	csr := req.CSR
-	if err = core.VerifyCSR(csr); err != nil {
-		logEvent.Error = err.Error()
-		err = core.UnauthorizedError("Invalid signature on CSR")
-		return emptyCert, err
+	stale := now.Add(-ra.CAARecheckAfter)
+	var recheck []string
+	for _, name := range names {
+		if checked, ok := checks[name]; ok && checked.After(stale) {
+			ra.stats.Inc("RA.CAACacheHits", 1, 1.0)
+			continue
+		}
+		recheck = append(recheck, name)
 	}
+	if len(recheck) == 0 {
+		return nil
+	}
+	ra.stats.Inc("RA.CAARechecks", int64(len(recheck)), 1.0)
 
-	logEvent.CommonName = csr.Subject.CommonName
-	logEvent.Names = csr.DNSNames
+	challengeTypes := make(map[string]string, len(recheck))
+	for _, name := range recheck {
+		authz, ok := authzs[name]
+		if !ok {
+			return berrors.InternalServerError("No authorization to recheck CAA records for %s with", name)
+		}
+		challengeType, err := ra.validatedChallengeType(ctx, authz)
+		if err != nil {
+			return berrors.InternalServerError("Failed to recheck CAA records for %s: %s", name, err)
+		}
+		challengeTypes[name] = challengeType
+	}
+
+	timeout := ra.CAARecheckTimeout
+	if timeout <= 0 {
+		timeout = DefaultCAARecheckTimeout
+	}
+	recheckCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// The results channel is buffered so that checks still running when
+	// the deadline passes don't block once they finish
+	type caaResult struct {
+		name           string
+		present, valid bool
+		err            error
+	}
+	results := make(chan caaResult, len(recheck))
+	for _, name := range recheck {
+		go func(name, challengeType string) {
+			ident := identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: name}
+			present, valid, err := ra.VA.CheckCAARecords(recheckCtx, ident, regID, challengeType)
+			results <- caaResult{name, present, valid, err}
+		}(name, challengeTypes[name])
+	}
+
+	var forbidden []string
+	for range recheck {
+		select {
+		case <-recheckCtx.Done():
+			ra.stats.Inc("RA.CAARecheckTimeouts", 1, 1.0)
+			return berrors.InternalServerError("Timed out rechecking CAA records")
+		case result := <-results:
+			if result.err != nil {
+				return berrors.InternalServerError("Failed to recheck CAA records for %s: %s", result.name, result.err)
+			}
+			if result.present && !result.valid {
+				forbidden = append(forbidden, result.name)
+			}
+		}
+	}
+	if len(forbidden) > 0 {
+		sort.Strings(forbidden)
+		return berrors.UnauthorizedError("CAA records forbid issuance for %s", strings.Join(forbidden, ", "))
+	}
 
-	// Validate that authorization key is authorized for all domains
-	names := make([]string, len(csr.DNSNames))
-	copy(names, csr.DNSNames)
-	if len(csr.Subject.CommonName) > 0 {
-		names = append(names, csr.Subject.CommonName)
+	if err := ra.SA.AddCAAChecks(ctx, recheck, now); err != nil {
+		if _, ok := err.(core.NotSupportedError); !ok {
+			ra.log.WithRequestID(core.RequestID(ctx)).Warning(fmt.Sprintf("Failed to record CAA checks: %s", err))
+		}
 	}
+	return nil
+}
 
-	if len(names) == 0 {
-		err = core.UnauthorizedError("CSR has no names in it")
-		logEvent.Error = err.Error()
-		return emptyCert, err
+// NewCertificate requests the issuance of a certificate. A request with an
+// IdempotencyKey that repeats one regID made before, asking for the same
+// certificate, gets the certificate issued for that one, without the checks
+// of a new request, until the key expires.
+func (ra *RegistrationAuthorityImpl) NewCertificate(ctx context.Context, req core.CertificateRequest, regID int64) (core.Certificate, error) {
+	var key *core.IdempotencyKey
+	if req.IdempotencyKey != "" {
+		var issued core.Certificate
+		var err error
+		key, issued, err = ra.reserveIdempotencyKey(ctx, req, regID)
+		if err != nil || issued.DER != nil {
+			return issued, err
+		}
 	}
 
-	csrPreviousDenied, err := ra.SA.AlreadyDeniedCSR(names)
-	if err != nil {
-		logEvent.Error = err.Error()
-		return emptyCert, err
+	logEvent := ra.newCertificateRequestEvent(regID)
+	err := ra.checkCertificateRequest(ctx, req, regID, &logEvent)
+	var cert core.Certificate
+	if err == nil {
+		cert, err = ra.issueCertificate(ctx, req, regID, &logEvent)
 	}
-	if csrPreviousDenied {
-		err = core.UnauthorizedError("CSR has already been revoked/denied")
-		logEvent.Error = err.Error()
-		return emptyCert, err
+	ra.auditCertificateRequest(ctx, logEvent, err)
+	if key != nil {
+		if err == nil {
+			key.Serial = logEvent.SerialNumber
+		}
+		if ferr := ra.SA.FinalizeIdempotencyKey(ctx, *key); ferr != nil {
+			ra.log.WithRequestID(core.RequestID(ctx)).Warning(fmt.Sprintf("Failed to finalize idempotency key %s: %s", key.Digest, ferr))
+		}
 	}
-
-	if core.KeyDigestEquals(csr.PublicKey, registration.Key) {
-		err = core.MalformedRequestError("Certificate public key must be different than account key")
-		return emptyCert, err
+	if err != nil {
+		return core.Certificate{}, err
 	}
+	return cert, nil
+}
 
-	// Check rate limits before checking authorizations. If someone is unable to
-	// issue a cert due to rate limiting, we don't want to tell them to go get the
-	// necessary authorizations, only to later fail the rate limit check.
-	err = ra.checkLimits(names, registration.ID)
+// idempotencyReservationTimeout is how long a request may take to issue its
+// certificate before a retry with the same idempotency key takes over.
+const idempotencyReservationTimeout = 5 * time.Minute
+
+// idempotencyKeyLifetime is how long a request's idempotency key is kept,
+// after which repeating it issues anew.
+const idempotencyKeyLifetime = 24 * time.Hour
+
+// reserveIdempotencyKey reserves the idempotency key of req, by regID, for
+// it to issue its certificate. If an earlier request with the key issued a
+// certificate, that's returned instead, without a reservation; if one is
+// still issuing, it's a Conflict. A database schema lacking idempotency keys
+// has the request issue without a reservation.
+func (ra *RegistrationAuthorityImpl) reserveIdempotencyKey(ctx context.Context, req core.CertificateRequest, regID int64) (*core.IdempotencyKey, core.Certificate, error) {
+	digest, err := idempotencyDigest(req)
 	if err != nil {
-		logEvent.Error = err.Error()
-		return emptyCert, err
+		return nil, core.Certificate{}, err
+	}
+	now := ra.clk.Now()
+	key := core.IdempotencyKey{
+		RegistrationID: regID,
+		Digest:         digest,
+		RequestID:      core.NewToken(),
+		Created:        now,
+		Expires:        now.Add(idempotencyKeyLifetime),
+	}
+	stored, err := ra.SA.ReserveIdempotencyKey(ctx, key, now.Add(-idempotencyReservationTimeout))
+	if _, ok := err.(core.NotSupportedError); ok {
+		ra.stats.Inc("RA.IdempotencyKeys.Unsupported", 1, 1.0)
+		return nil, core.Certificate{}, nil
 	}
-
-	err = ra.checkAuthorizations(names, &registration)
 	if err != nil {
-		logEvent.Error = err.Error()
-		return emptyCert, err
+		return nil, core.Certificate{}, err
+	}
+	if stored.Serial != "" {
+		ra.stats.Inc("RA.IdempotencyKeys.Replayed", 1, 1.0)
+		cert, err := ra.SA.GetCertificate(ctx, stored.Serial)
+		return nil, cert, err
+	}
+	if stored.RequestID != key.RequestID {
+		ra.stats.Inc("RA.IdempotencyKeys.InProgress", 1, 1.0)
+		return nil, core.Certificate{}, probs.Conflict("A certificate request with this idempotency key is still being processed; retry later")
+	}
+	return &key, core.Certificate{}, nil
+}
+
+// idempotencyRequest is what identifies a certificate request made with an
+// idempotency key: everything that decides what certificate it gets, and
+// the key. Repeating the key while asking for something else is a new
+// request.
+type idempotencyRequest struct {
+	CSR            []byte
+	Profile        string
+	Replaces       string
+	NotBefore      time.Time
+	NotAfter       time.Time
+	IdempotencyKey string
+}
+
+// idempotencyDigest returns the hex SHA-256 digest identifying req. Its
+// fields are marshaled in a fixed order, with times in UTC, so the same
+// request always has the same digest.
+func idempotencyDigest(req core.CertificateRequest) (string, error) {
+	canonical, err := json.Marshal(idempotencyRequest{
+		CSR:            req.CSR.Raw,
+		Profile:        req.Profile,
+		Replaces:       req.Replaces,
+		NotBefore:      req.Validity.NotBefore.UTC(),
+		NotAfter:       req.Validity.NotAfter.UTC(),
+		IdempotencyKey: req.IdempotencyKey,
+	})
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(canonical)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+// NewCertificateOrder makes the same checks of a certificate request as
+// NewCertificate, but then stores the request with a new processing order,
+// returns the order at once and issues the certificate on one of the order
+// workers, recording the outcome in the order for the WFE to find. Clients
+// then needn't wait on the CA, and the logs it submits to, to hear their
+// request was accepted. An order the workers have no room for, or whose
+// processing is cut short by the RA stopping, is resumed by
+// ResumeCertificateOrders once stale, unless by then it's expired, after
+// its registration tier's OrderLifetime.
+func (ra *RegistrationAuthorityImpl) NewCertificateOrder(ctx context.Context, req core.CertificateRequest, regID int64) (core.CertificateOrder, error) {
+	logEvent := ra.newCertificateRequestEvent(regID)
+	if err := ra.checkCertificateRequest(ctx, req, regID, &logEvent); err != nil {
+		ra.auditCertificateRequest(ctx, logEvent, err)
+		return core.CertificateOrder{}, err
+	}
+
+	reg, err := ra.SA.GetRegistration(ctx, regID)
+	if err != nil {
+		logEvent.Error = err.Error()
+		ra.auditCertificateRequest(ctx, logEvent, err)
+		return core.CertificateOrder{}, err
+	}
+	now := ra.clk.Now()
+	order, err := ra.SA.NewCertificateOrder(ctx, core.CertificateOrder{
+		RegistrationID: regID,
+		Status:         core.StatusProcessing,
+		Created:        now,
+		Expires:        now.Add(ra.orderLifetime(reg)),
+	}, req)
+	if err != nil {
+		logEvent.Error = err.Error()
+		ra.auditCertificateRequest(ctx, logEvent, err)
+		return core.CertificateOrder{}, err
+	}
+	ra.stats.Inc("RA.CertificateOrders", 1, 1.0)
+
+	// Issuance outlives the request, but keeps its ID for the logs
+	ra.queueCertificateOrder(certificateOrderJob{
+		requestID: core.RequestID(ctx),
+		order:     order,
+		req:       req,
+		logEvent:  logEvent,
+	})
+	return order, nil
+}
+
+// ResumeCertificateOrders claims the certificate orders whose processing
+// began longer than OrderStaleAfter ago without finishing, because the RA
+// processing them stopped or had no room for them, and queues them for
+// this RA's order workers, as many as there's room for. Their requests are
+// checked again first. Orders that have expired, whose requests weren't
+// stored, or that have been begun OrderMaxAttempts times, are failed
+// instead. It's to be called periodically.
+func (ra *RegistrationAuthorityImpl) ResumeCertificateOrders(ctx context.Context) error {
+	ra.startOrderWorkers()
+	room := cap(ra.orderWork) - len(ra.orderWork)
+	if room <= 0 {
+		return nil
+	}
+	now := ra.clk.Now()
+	claimed, err := ra.SA.ClaimCertificateOrders(ctx, now.Add(-ra.orderStaleAfter()), now, room)
+	for _, c := range claimed {
+		logEvent := ra.newCertificateRequestEvent(c.Order.RegistrationID)
+		var checkErr error
+		if orderExpired(c.Order, now) {
+			checkErr = errOrderExpired
+		} else if c.Request == nil || c.Attempts > ra.orderMaxAttempts() {
+			checkErr = core.InternalServerError("Certificate order processing was interrupted; submit a new request")
+		} else {
+			checkErr = ra.checkCertificateRequest(ctx, *c.Request, c.Order.RegistrationID, &logEvent)
+		}
+		if checkErr != nil {
+			logEvent.Error = checkErr.Error()
+			ra.auditCertificateRequest(ctx, logEvent, checkErr)
+			ra.finalizeCertificateOrder(ctx, c.Order, "", checkErr)
+			continue
+		}
+		ra.stats.Inc("RA.CertificateOrders.Resumed", 1, 1.0)
+		ra.queueCertificateOrder(certificateOrderJob{
+			requestID: core.RequestID(ctx),
+			order:     c.Order,
+			req:       *c.Request,
+			logEvent:  logEvent,
+		})
+	}
+	return err
+}
+
+// queueCertificateOrder queues job for the order workers, unless they have
+// no room for it, when it's left for ResumeCertificateOrders.
+func (ra *RegistrationAuthorityImpl) queueCertificateOrder(job certificateOrderJob) {
+	ra.startOrderWorkers()
+	select {
+	case ra.orderWork <- job:
+	default:
+		ra.stats.Inc("RA.CertificateOrders.Deferred", 1, 1.0)
+	}
+}
+
+// startOrderWorkers starts the order workers, and their queue, if they
+// haven't been started.
+func (ra *RegistrationAuthorityImpl) startOrderWorkers() {
+	ra.orderWorkersOnce.Do(func() {
+		workers := ra.OrderWorkers
+		if workers <= 0 {
+			workers = DefaultOrderWorkers
+		}
+		ra.orderWork = make(chan certificateOrderJob, workers)
+		for i := 0; i < workers; i++ {
+			go func() {
+				for job := range ra.orderWork {
+					ctx, cancel := context.WithTimeout(core.WithRequestID(context.Background(), job.requestID), ra.orderStaleAfter())
+					ra.finishCertificateOrder(ctx, job.order, job.req, job.logEvent)
+					cancel()
+				}
+			}()
+		}
+	})
+}
+
+func (ra *RegistrationAuthorityImpl) orderStaleAfter() time.Duration {
+	if ra.OrderStaleAfter > 0 {
+		return ra.OrderStaleAfter
+	}
+	return DefaultOrderStaleAfter
+}
+
+func (ra *RegistrationAuthorityImpl) orderMaxAttempts() int {
+	if ra.OrderMaxAttempts > 0 {
+		return ra.OrderMaxAttempts
+	}
+	return DefaultOrderMaxAttempts
+}
+
+// errOrderExpired fails certificate orders not finished before they
+// expire.
+var errOrderExpired = berrors.MalformedError("Certificate order expired before it could be processed; submit a new request")
+
+// orderExpired returns whether order, if still processing at now, is to be
+// failed as expired. Orders stored without an expiry don't expire.
+func orderExpired(order core.CertificateOrder, now time.Time) bool {
+	return !order.Expires.IsZero() && !now.Before(order.Expires)
+}
+
+// finishCertificateOrder issues the certificate for order, which was
+// requested with req, unless it's expired, and records in the order
+// whether it was.
+func (ra *RegistrationAuthorityImpl) finishCertificateOrder(ctx context.Context, order core.CertificateOrder, req core.CertificateRequest, logEvent certificateRequestEvent) {
+	var err error
+	if orderExpired(order, ra.clk.Now()) {
+		err = errOrderExpired
+		logEvent.Error = err.Error()
+	} else {
+		_, err = ra.issueCertificate(ctx, req, order.RegistrationID, &logEvent)
+	}
+	ra.auditCertificateRequest(ctx, logEvent, err)
+	// Recorded even if issuance ran out of time
+	ra.finalizeCertificateOrder(core.WithRequestID(context.Background(), core.RequestID(ctx)), order, logEvent.SerialNumber, err)
+}
+
+// finalizeCertificateOrder records in order that the certificate with
+// serial was issued for it or, if err is set, that issuance failed.
+func (ra *RegistrationAuthorityImpl) finalizeCertificateOrder(ctx context.Context, order core.CertificateOrder, serial string, err error) {
+	if err != nil {
+		order.Status = core.StatusInvalid
+		order.Error = core.ProblemDetailsForError(err, "Error creating new cert")
+		ra.stats.Inc("RA.CertificateOrders.Invalid", 1, 1.0)
+	} else {
+		order.Status = core.StatusValid
+		order.Serial = serial
+		ra.stats.Inc("RA.CertificateOrders.Valid", 1, 1.0)
+	}
+	if err = ra.SA.FinalizeCertificateOrder(ctx, order); err != nil {
+		// The order stays processing, to be resumed once stale, whether
+		// or not the certificate was issued
+		ra.log.WithRequestID(core.RequestID(ctx)).Warning(fmt.Sprintf("Failed to finalize certificate order %s as %s: %s", order.ID, order.Status, err))
+	}
+}
+
+// newCertificateRequestEvent starts the audit log event of a certificate
+// request by regID.
+func (ra *RegistrationAuthorityImpl) newCertificateRequestEvent(regID int64) certificateRequestEvent {
+	return certificateRequestEvent{
+		ID:            core.NewToken(),
+		Requester:     regID,
+		RequestMethod: "online",
+		RequestTime:   ra.clk.Now(),
+	}
+}
+
+// auditCertificateRequest logs the outcome of a certificate request, err
+// being why it failed.
+func (ra *RegistrationAuthorityImpl) auditCertificateRequest(ctx context.Context, logEvent certificateRequestEvent, err error) {
+	result := "successful"
+	if err != nil {
+		result = "error"
+	}
+	// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+	ra.log.WithRequestID(core.RequestID(ctx)).AuditObject(fmt.Sprintf("Certificate request - %s", result), logEvent)
+	if err == nil && ra.Timestamper != nil {
+		ra.queueTimestamp(timestampJob{requestID: core.RequestID(ctx), event: logEvent})
+	}
+}
+
+// queueTimestamp queues job for the timestamp worker, starting it if it
+// hasn't been. If the queue is full, the event isn't timestamped.
+func (ra *RegistrationAuthorityImpl) queueTimestamp(job timestampJob) {
+	ra.timestampOnce.Do(func() {
+		size := ra.TimestampQueueSize
+		if size <= 0 {
+			size = DefaultTimestampQueueSize
+		}
+		ra.timestampQueue = make(chan timestampJob, size)
+		go func() {
+			for job := range ra.timestampQueue {
+				ra.timestampEvent(core.WithRequestID(context.Background(), job.requestID), job.event)
+			}
+		}()
+	})
+	select {
+	case ra.timestampQueue <- job:
+	default:
+		ra.log.Warning(fmt.Sprintf("Failed to timestamp certificate request %s: timestamp queue full", job.event.ID))
+		ra.stats.Inc("RA.Timestamp.Dropped", 1, 1.0)
+	}
+}
+
+// checkNames checks that the unique identifiers a CSR asks for are no more
+// than MaxNames, and that none is a DNS name a wildcard among them covers.
+func (ra *RegistrationAuthorityImpl) checkNames(ids []identifier.ACMEIdentifier) error {
+	if ra.MaxNames > 0 && len(ids) > ra.MaxNames {
+		ra.stats.Inc("RA.CheckNames.TooMany", 1, 1.0)
+		return berrors.MalformedError("Certificate request has %d names, maximum is %d", len(ids), ra.MaxNames)
+	}
+	if covered := identifier.CoveredByWildcard(ids); len(covered) > 0 {
+		ra.stats.Inc("RA.CheckNames.CoveredByWildcard", 1, 1.0)
+		return berrors.MalformedError("Certificate request names %s alongside a wildcard covering it",
+			strings.Join(identifier.Values(covered), ", "))
+	}
+	return nil
+}
+
+// defaultProfile returns the certificate profile for the requests of reg
+// that don't select one: that of the policy marked Default that allows reg,
+// or else the CA's default. If several policies marked Default allow reg,
+// the first by name is used.
+func (ra *RegistrationAuthorityImpl) defaultProfile(reg core.Registration) string {
+	var profiles []string
+	for profile, policy := range ra.ProfilePolicies {
+		if policy.Default && policy.allows(reg) {
+			profiles = append(profiles, profile)
+		}
+	}
+	if len(profiles) == 0 {
+		return ""
+	}
+	sort.Strings(profiles)
+	return profiles[0]
+}
+
+// checkCertificateRequest checks that req may be issued to regID, noting in
+// logEvent what it finds, including the profile to issue under.
+func (ra *RegistrationAuthorityImpl) checkCertificateRequest(ctx context.Context, req core.CertificateRequest, regID int64, logEvent *certificateRequestEvent) error {
+	if regID <= 0 {
+		return berrors.MalformedError("Invalid registration ID: %d", regID)
+	}
+
+	// The CA checks the period against the profile's
+	if !req.Validity.IsZero() && !ra.PrivateCA {
+		err := berrors.MalformedError("This CA doesn't issue certificates for a requested notBefore or notAfter")
+		logEvent.Error = err.Error()
+		return err
+	}
+
+	registration, err := ra.SA.GetRegistration(ctx, regID)
+	if err != nil {
+		logEvent.Error = err.Error()
+		return err
+	}
+
+	if policy, ok := ra.ProfilePolicies[req.Profile]; ok && req.Profile != "" && !policy.allows(registration) {
+		ra.stats.Inc("RA.ProfileNotAllowed", 1, 1.0)
+		err := berrors.UnauthorizedError("Registration %d may not select certificate profile %q", regID, req.Profile)
+		logEvent.Error = err.Error()
+		return err
+	}
+	logEvent.Profile = req.Profile
+	if req.Profile == "" {
+		logEvent.Profile = ra.defaultProfile(registration)
+	}
+
+	if req.Replaces != "" {
+		if err := ra.checkReplaces(ctx, req.Replaces, regID); err != nil {
+			logEvent.Error = err.Error()
+			return err
+		}
+	}
+
+	// Verify the CSR
+	csr := req.CSR
+	if err := core.VerifyCSR(csr); err != nil {
+		logEvent.Error = err.Error()
+		return berrors.UnauthorizedError("Invalid signature on CSR")
+	}
+
+	logEvent.CommonName = csr.Subject.CommonName
+	logEvent.Names = csr.DNSNames
+
+	// Validate that authorization key is authorized for all domains and
+	// email addresses, each counted once however it's cased or repeated
+	ids := identifier.FromCSR(csr)
+	names := identifier.Values(ids)
+
+	if len(names) == 0 {
+		err := berrors.UnauthorizedError("CSR has no names in it")
+		logEvent.Error = err.Error()
+		return err
+	}
+
+	if err := ra.checkNames(ids); err != nil {
+		logEvent.Error = err.Error()
+		return err
+	}
+
+	csrPreviousDenied, err := ra.SA.AlreadyDeniedCSR(ctx, names)
+	if err != nil {
+		logEvent.Error = err.Error()
+		return err
+	}
+	if csrPreviousDenied {
+		err := berrors.UnauthorizedError("CSR has already been revoked/denied")
+		logEvent.Error = err.Error()
+		return err
+	}
+
+	if prob := core.CheckCSRKeyNotAccountKey(csr, registration.Key); prob != nil {
+		logEvent.Error = prob.Detail
+		return prob
+	}
+
+	// Weak keys are refused here, rather than only once the CA is asked to
+	// sign for them
+	if err := core.GoodKey(csr.PublicKey); err != nil {
+		ra.stats.Inc("RA.BadKeys.Certificate", 1, 1.0)
+		prob := probs.BadPublicKey("Invalid public key in CSR: %s", err)
+		logEvent.Error = prob.Detail
+		return prob
+	}
+
+	keyBlocked, err := core.KeyBlocked(ctx, csr.PublicKey, ra.BlockedKeys, ra.SA)
+	if err != nil {
+		logEvent.Error = err.Error()
+		return err
+	}
+	if keyBlocked {
+		ra.stats.Inc("RA.BlockedKeys.Certificate", 1, 1.0)
+		prob := probs.BadPublicKey("Key is blocked because it is known to be compromised")
+		logEvent.Error = prob.Detail
+		return prob
+	}
+
+	// Check rate limits before checking authorizations. If someone is unable to
+	// issue a cert due to rate limiting, we don't want to tell them to go get the
+	// necessary authorizations, only to later fail the rate limit check.
+	err = ra.checkLimits(ctx, names, registration.ID)
+	if err != nil {
+		logEvent.Error = err.Error()
+		return err
+	}
+
+	authzs, err := ra.checkAuthorizations(ctx, names, &registration)
+	if err != nil {
+		logEvent.Error = err.Error()
+		return err
+	}
+
+	err = ra.recheckCAA(ctx, registration.ID, authzs, identifier.ValuesOfType(ids, identifier.DNS))
+	if err != nil {
+		logEvent.Error = err.Error()
+		return err
 	}
 
 	// Mark that we verified the CN and SANs
 	logEvent.VerifiedFields = []string{"subject.commonName", "subjectAltName"}
 
+	return nil
+}
+
+// issueCertificate has the CA issue the certificate requested by req, which
+// has passed checkCertificateRequest, noting it in logEvent.
+func (ra *RegistrationAuthorityImpl) issueCertificate(ctx context.Context, req core.CertificateRequest, regID int64, logEvent *certificateRequestEvent) (core.Certificate, error) {
+	emptyCert := core.Certificate{}
+	csr := req.CSR
+
 	// Create the certificate and log the result
-	if cert, err = ra.CA.IssueCertificate(*csr, regID); err != nil {
+	cert, err := ra.CA.IssueCertificate(ctx, *csr, regID, logEvent.Profile, req.Validity)
+	if err != nil {
 		logEvent.Error = err.Error()
 		return emptyCert, err
 	}
@@ -560,12 +1712,78 @@ func (ra *RegistrationAuthorityImpl) NewCertificate(req core.CertificateRequest,
 	logEvent.NotAfter = parsedCertificate.NotAfter
 	logEvent.ResponseTime = ra.clk.Now()
 
-	logEventResult = "successful"
+	if req.Replaces != "" {
+		// The certificate is issued by now, so failing to record what it
+		// replaces only means the subscriber may be nagged about the old one.
+		// A concurrent request replacing the same certificate may have
+		// been recorded first.
+		err = ra.SA.AddReplacementOrder(ctx, logEvent.SerialNumber, req.Replaces)
+		if berrors.Is(err, berrors.Malformed) {
+			ra.log.Warning(fmt.Sprintf("Certificate %s replaces %s, which was already replaced: %s", logEvent.SerialNumber, req.Replaces, err))
+			ra.stats.Inc("RA.NewCertificates.AlreadyReplaced", 1, 1.0)
+		} else if err != nil {
+			ra.log.Warning(fmt.Sprintf("Failed to record certificate %s as replacing %s: %s", logEvent.SerialNumber, req.Replaces, err))
+		}
+	}
 
 	ra.stats.Inc("RA.NewCertificates", 1, 1.0)
 	return cert, nil
 }
 
+// timestampEvent audit logs a timestamp token over event, which has already
+// been logged. The certificate is already issued, so failing to get one is
+// only logged.
+func (ra *RegistrationAuthorityImpl) timestampEvent(ctx context.Context, event certificateRequestEvent) {
+	// This is the JSON AuditObject logged
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		ra.log.Warning(fmt.Sprintf("Failed to timestamp certificate request %s: %s", event.ID, err))
+		return
+	}
+	digest := sha256.Sum256(eventJSON)
+	token, err := ra.Timestamper.Timestamp(ctx, digest[:])
+	if err != nil {
+		ra.log.Warning(fmt.Sprintf("Failed to timestamp certificate request %s: %s", event.ID, err))
+		ra.stats.Inc("RA.Timestamp.Failed", 1, 1.0)
+		return
+	}
+	ra.stats.Inc("RA.Timestamp.Granted", 1, 1.0)
+	// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+	ra.log.WithRequestID(core.RequestID(ctx)).AuditObject("Certificate request timestamp", certificateRequestTimestamp{
+		ID:          event.ID,
+		EventSHA256: hex.EncodeToString(digest[:]),
+		Time:        token.Time,
+		Token:       token.DER,
+	})
+}
+
+// checkReplaces checks that the certificate with serial, which a new
+// certificate request says it replaces, was issued to regID and hasn't
+// already been replaced.
+func (ra *RegistrationAuthorityImpl) checkReplaces(ctx context.Context, serial string, regID int64) error {
+	if !core.ValidSerial(serial) {
+		return berrors.MalformedError("Invalid serial of replaced certificate: %s", serial)
+	}
+	replaced, err := ra.SA.GetCertificate(ctx, serial)
+	if berrors.Is(err, berrors.NotFound) {
+		return berrors.MalformedError("No certificate to replace with serial %s", serial)
+	}
+	if err != nil {
+		return err
+	}
+	if replaced.RegistrationID != regID {
+		return berrors.UnauthorizedError("Certificate %s wasn't issued to this account", serial)
+	}
+	issued, err := ra.SA.ReplacementIssued(ctx, serial)
+	if err != nil {
+		return err
+	}
+	if issued {
+		return berrors.MalformedError("Certificate %s has already been replaced", serial)
+	}
+	return nil
+}
+
 // domainsForRateLimiting transforms a list of FQDNs into a list of eTLD+1's
 // for the purpose of rate limiting. It also de-duplicates the output
 // domains.
@@ -573,7 +1791,8 @@ func domainsForRateLimiting(names []string) ([]string, error) {
 	domainsMap := make(map[string]struct{}, len(names))
 	var domains []string
 	for _, name := range names {
-		eTLDPlusOne, err := publicsuffix.EffectiveTLDPlusOne(name)
+		// Email addresses count against their domain
+		eTLDPlusOne, err := publicsuffix.EffectiveTLDPlusOne(identifier.FromValue(name).Domain())
 		if err != nil {
 			return nil, err
 		}
@@ -585,14 +1804,14 @@ func domainsForRateLimiting(names []string) ([]string, error) {
 	return domains, nil
 }
 
-func (ra *RegistrationAuthorityImpl) checkCertificatesPerNameLimit(names []string, limit cmd.RateLimitPolicy, regID int64) error {
+func (ra *RegistrationAuthorityImpl) checkCertificatesPerNameLimit(ctx context.Context, names []string, limit cmd.RateLimitPolicy, regID int64) error {
 	names, err := domainsForRateLimiting(names)
 	if err != nil {
 		return err
 	}
 	now := ra.clk.Now()
 	windowBegin := limit.WindowBegin(now)
-	counts, err := ra.SA.CountCertificatesByNames(names, windowBegin, now)
+	counts, err := ra.SA.CountCertificatesByNames(ctx, names, windowBegin, now)
 	if err != nil {
 		return err
 	}
@@ -603,31 +1822,49 @@ func (ra *RegistrationAuthorityImpl) checkCertificatesPerNameLimit(names []strin
 			// Shouldn't happen, but let's be careful anyhow.
 			return errors.New("StorageAuthority failed to return a count for every name")
 		}
-		if count >= limit.GetThreshold(name, regID) {
+		threshold := limit.GetThreshold(name, regID)
+		if threshold != cmd.Unlimited && count >= threshold {
 			badNames = append(badNames, name)
 		}
 	}
 	if len(badNames) > 0 {
-		return core.RateLimitedError(fmt.Sprintf(
+		return berrors.RateLimitError(
 			"Too many certificates already issued for: %s",
-			strings.Join(badNames, ", ")))
+			strings.Join(badNames, ", "))
 	}
 	return nil
 }
 
-func (ra *RegistrationAuthorityImpl) checkLimits(names []string, regID int64) error {
-	limits := ra.rlPolicies
+func (ra *RegistrationAuthorityImpl) checkLimits(ctx context.Context, names []string, regID int64) error {
+	limits := ra.rateLimits(ctx)
 	if limits.TotalCertificates.Enabled() {
-		totalIssued, err := ra.getIssuanceCount()
+		totalIssued, err := ra.getIssuanceCount(ctx)
 		if err != nil {
 			return err
 		}
-		if totalIssued >= ra.rlPolicies.TotalCertificates.Threshold {
-			return core.RateLimitedError("Certificate issuance limit reached")
+		if totalIssued >= limits.TotalCertificates.Threshold {
+			return berrors.RateLimitError("Certificate issuance limit reached")
 		}
 	}
 	if limits.CertificatesPerName.Enabled() {
-		err := ra.checkCertificatesPerNameLimit(names, limits.CertificatesPerName, regID)
+		// Renewals, for a set of names issued for before, don't take
+		// certificates for new names away from anyone, so only
+		// certificatesPerFQDNSet limits them
+		renewal, err := ra.SA.FQDNSetExists(ctx, names)
+		if err != nil {
+			return err
+		}
+		if renewal {
+			ra.stats.Inc("RA.RateLimit.RenewalExempt", 1, 1.0)
+		} else {
+			err = ra.checkCertificatesPerNameLimit(ctx, names, limits.CertificatesPerName, regID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if limits.CertificatesPerFQDNSet.Enabled() {
+		err := ra.checkCertificatesPerFQDNSetLimit(ctx, names, limits.CertificatesPerFQDNSet, regID)
 		if err != nil {
 			return err
 		}
@@ -635,8 +1872,32 @@ func (ra *RegistrationAuthorityImpl) checkLimits(names []string, regID int64) er
 	return nil
 }
 
+// checkCertificatesPerFQDNSetLimit limits the certificates issued for
+// exactly the set of names, so that renewals, which certificatesPerName
+// exempts, are still limited.
+func (ra *RegistrationAuthorityImpl) checkCertificatesPerFQDNSetLimit(ctx context.Context, names []string, limit cmd.RateLimitPolicy, regID int64) error {
+	set := core.UniqueLowerNames(names)
+	sort.Strings(set)
+	key := strings.Join(set, ",")
+	threshold := limit.GetThreshold(key, regID)
+	if threshold == cmd.Unlimited {
+		return nil
+	}
+	now := ra.clk.Now()
+	count, err := ra.SA.CountFQDNSets(ctx, names, limit.WindowBegin(now), now)
+	if err != nil {
+		return err
+	}
+	if count >= int64(threshold) {
+		return berrors.RateLimitError(
+			"Too many certificates already issued for exact set of names: %s", key)
+	}
+	return nil
+}
+
 // UpdateRegistration updates an existing Registration with new values.
-func (ra *RegistrationAuthorityImpl) UpdateRegistration(base core.Registration, update core.Registration) (reg core.Registration, err error) {
+func (ra *RegistrationAuthorityImpl) UpdateRegistration(ctx context.Context, base core.Registration, update core.Registration) (reg core.Registration, err error) {
+	oldContacts := base.Contact
 	base.MergeUpdate(update)
 
 	err = ra.validateContacts(base.Contact)
@@ -644,30 +1905,123 @@ func (ra *RegistrationAuthorityImpl) UpdateRegistration(base core.Registration,
 		return
 	}
 
+	// Contacts that have been removed are no longer verified, and ones that
+	// have been added need verifying.
+	var verified, added []*core.AcmeURL
+	for _, contact := range base.Contact {
+		if containsContact(base.VerifiedContacts, contact) {
+			verified = append(verified, contact)
+		}
+		if !containsContact(oldContacts, contact) {
+			added = append(added, contact)
+		}
+	}
+	base.VerifiedContacts = verified
+
 	reg = base
-	err = ra.SA.UpdateRegistration(base)
+	err = ra.SA.UpdateRegistration(ctx, base)
 	if err != nil {
 		// InternalServerError since the user-data was validated before being
 		// passed to the SA.
 		err = core.InternalServerError(fmt.Sprintf("Could not update registration: %s", err))
+	} else {
+		ra.sendContactVerifications(reg.ID, added)
 	}
 
 	ra.stats.Inc("RA.UpdatedRegistrations", 1, 1.0)
 	return
 }
 
+func containsContact(contacts []*core.AcmeURL, contact *core.AcmeURL) bool {
+	for _, c := range contacts {
+		if c.String() == contact.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// verificationEmail holds the fields available to the contact verification
+// email template.
+type verificationEmail struct {
+	Contact string
+	Link    string
+}
+
+// sendContactVerifications mails a verification link to each of the given
+// email contacts of a registration, if contact verification is enabled.
+// Failures are logged rather than returned: the registration has already been
+// stored, and the account holder can update their contacts to try again.
+func (ra *RegistrationAuthorityImpl) sendContactVerifications(regID int64, contacts []*core.AcmeURL) {
+	if ra.ContactVerifier == nil {
+		return
+	}
+	for _, contact := range contacts {
+		if contact.Scheme != "mailto" {
+			continue
+		}
+		msgBuf := new(bytes.Buffer)
+		err := ra.VerificationEmail.Execute(msgBuf, verificationEmail{
+			Contact: contact.Opaque,
+			Link:    ra.ContactVerifier.Link(regID, contact.String()),
+		})
+		if err == nil {
+			err = ra.Mailer.SendMail([]string{contact.Opaque}, msgBuf.String())
+		}
+		if err != nil {
+			ra.log.Warning(fmt.Sprintf("Failed to send contact verification for registration %d: %s", regID, err))
+			ra.stats.Inc("RA.ContactVerification.Errors", 1, 1.0)
+			continue
+		}
+		ra.stats.Inc("RA.ContactVerification.Sent", 1, 1.0)
+	}
+}
+
+// VerifyContact marks contact as verified on the registration regID, once the
+// contact has followed the link they were mailed.
+func (ra *RegistrationAuthorityImpl) VerifyContact(ctx context.Context, regID int64, contact string) error {
+	reg, err := ra.SA.GetRegistration(ctx, regID)
+	if err != nil {
+		return err
+	}
+	var found *core.AcmeURL
+	for _, c := range reg.Contact {
+		if c.String() == contact {
+			found = c
+		}
+	}
+	if found == nil {
+		return berrors.MalformedError("Contact is no longer on the registration")
+	}
+	if containsContact(reg.VerifiedContacts, found) {
+		return nil
+	}
+	reg.VerifiedContacts = append(reg.VerifiedContacts, found)
+	if err = ra.SA.UpdateRegistration(ctx, reg); err != nil {
+		return core.InternalServerError(fmt.Sprintf("Could not update registration: %s", err))
+	}
+	ra.stats.Inc("RA.ContactVerification.Verified", 1, 1.0)
+	return nil
+}
+
 // UpdateAuthorization updates an authorization with new values.
-func (ra *RegistrationAuthorityImpl) UpdateAuthorization(base core.Authorization, challengeIndex int, response core.Challenge) (authz core.Authorization, err error) {
+func (ra *RegistrationAuthorityImpl) UpdateAuthorization(ctx context.Context, base core.Authorization, challengeIndex int, response core.Challenge) (authz core.Authorization, err error) {
 	// Refuse to update expired authorizations
 	if base.Expires == nil || base.Expires.Before(ra.clk.Now()) {
 		err = core.NotFoundError("Expired authorization")
 		return
 	}
+	// Only authorizations awaiting the client's response can be responded
+	// to: not ones that are final, or held for an operator's review
+	if base.Status != core.StatusPending {
+		err = berrors.MalformedError("Authorization is %s, not pending", base.Status)
+		return
+	}
 
 	// Copy information over that the client is allowed to supply
 	authz = base
 	if challengeIndex >= len(authz.Challenges) {
-		err = core.MalformedRequestError(fmt.Sprintf("Invalid challenge index: %d", challengeIndex))
+		err = berrors.MalformedError("Invalid challenge index: %d", challengeIndex)
 		return
 	}
 
@@ -675,21 +2029,21 @@ func (ra *RegistrationAuthorityImpl) UpdateAuthorization(base core.Authorization
 
 	// At this point, the challenge should be sane as a complete challenge
 	if !authz.Challenges[challengeIndex].IsSane(true) {
-		err = core.MalformedRequestError("Response does not complete challenge")
+		err = berrors.MalformedError("Response does not complete challenge")
 		return
 	}
 
 	// Store the updated version
-	if err = ra.SA.UpdatePendingAuthorization(authz); err != nil {
+	if err = ra.SA.UpdatePendingAuthorization(ctx, authz); err != nil {
 		// This can pretty much only happen when the client corrupts the Challenge
 		// data.
-		err = core.MalformedRequestError("Challenge data was corrupted")
+		err = berrors.MalformedError("Challenge data was corrupted")
 		return
 	}
 	ra.stats.Inc("RA.NewPendingAuthorizations", 1, 1.0)
 
 	// Look up the account key for this authorization
-	reg, err := ra.SA.GetRegistration(authz.RegistrationID)
+	reg, err := ra.SA.GetRegistration(ctx, authz.RegistrationID)
 	if err != nil {
 		err = core.InternalServerError(err.Error())
 		return
@@ -698,12 +2052,19 @@ func (ra *RegistrationAuthorityImpl) UpdateAuthorization(base core.Authorization
 	// Reject the update if the challenge in question was created
 	// with a different account key
 	if !core.KeyDigestEquals(reg.Key, authz.Challenges[challengeIndex].AccountKey) {
-		err = core.UnauthorizedError("Challenge cannot be updated with a different key")
+		err = berrors.UnauthorizedError("Challenge cannot be updated with a different key")
+		return
+	}
+
+	// Challenges that must be completed together are validated together, in
+	// parallel, once the client has responded to all of them
+	if len(authz.Combinations) > 0 && authz.RespondedCombination(challengeIndex) == nil {
+		ra.stats.Inc("RA.UpdatedPendingAuthorizations", 1, 1.0)
 		return
 	}
 
 	// Dispatch to the VA for service
-	ra.VA.UpdateValidations(authz, challengeIndex)
+	ra.VA.UpdateValidations(ctx, authz, challengeIndex)
 
 	ra.stats.Inc("RA.UpdatedPendingAuthorizations", 1, 1.0)
 	return
@@ -720,10 +2081,34 @@ func revokeEvent(state, serial, cn string, names []string, revocationCode core.R
 	)
 }
 
+// checkRevocationReason returns an error if certificates can't be revoked
+// with revocationCode, by an administrator if admin is set or otherwise by
+// their subscriber.
+func (ra *RegistrationAuthorityImpl) checkRevocationReason(revocationCode core.RevocationCode, admin bool) error {
+	if _, ok := core.RevocationReasons[revocationCode]; !ok {
+		return berrors.MalformedError("Invalid revocation reason code %d", revocationCode)
+	}
+	if !admin && core.AdminRevocationReasons[revocationCode] {
+		return berrors.UnauthorizedError("Only the CA may revoke for reason %s", core.RevocationReasons[revocationCode])
+	}
+	switch revocationCode {
+	case core.RevocationRemoveFromCRL:
+		return berrors.MalformedError("removeFromCRL is not a revocation reason, release the certificate's hold instead")
+	case core.RevocationCertificateHold:
+		if !ra.PrivateCA {
+			return berrors.MalformedError("Certificates can't be put on hold by this CA")
+		}
+	}
+	return nil
+}
+
 // RevokeCertificateWithReg terminates trust in the certificate provided.
-func (ra *RegistrationAuthorityImpl) RevokeCertificateWithReg(cert x509.Certificate, revocationCode core.RevocationCode, regID int64) (err error) {
+func (ra *RegistrationAuthorityImpl) RevokeCertificateWithReg(ctx context.Context, cert x509.Certificate, revocationCode core.RevocationCode, regID int64) (err error) {
 	serialString := core.SerialToString(cert.SerialNumber)
-	err = ra.SA.MarkCertificateRevoked(serialString, revocationCode)
+	err = ra.checkRevocationReason(revocationCode, false)
+	if err == nil {
+		err = ra.SA.MarkCertificateRevoked(ctx, serialString, revocationCode)
+	}
 
 	state := "Failure"
 	defer func() {
@@ -735,7 +2120,7 @@ func (ra *RegistrationAuthorityImpl) RevokeCertificateWithReg(cert x509.Certific
 		//   Revocation reason
 		//   Registration ID of requester
 		//   Error (if there was one)
-		ra.log.Audit(fmt.Sprintf(
+		ra.log.WithRequestID(core.RequestID(ctx)).Audit(fmt.Sprintf(
 			"%s, Request by registration ID: %d",
 			revokeEvent(state, serialString, cert.Subject.CommonName, cert.DNSNames, revocationCode),
 			regID,
@@ -751,12 +2136,72 @@ func (ra *RegistrationAuthorityImpl) RevokeCertificateWithReg(cert x509.Certific
 	return nil
 }
 
+// DeactivateAuthorization deactivates a pending or valid authorization at the
+// request of the account that owns it, so that it can no longer be used for
+// issuance.
+func (ra *RegistrationAuthorityImpl) DeactivateAuthorization(ctx context.Context, authz core.Authorization) error {
+	if authz.Status != core.StatusValid && authz.Status != core.StatusPending {
+		return berrors.MalformedError("Only valid and pending authorizations can be deactivated, not %s ones", authz.Status)
+	}
+	if err := ra.SA.DeactivateAuthorization(ctx, authz.ID); err != nil {
+		return err
+	}
+	ra.stats.Inc("RA.DeactivatedAuthorizations", 1, 1.0)
+	return nil
+}
+
+// regenerateOCSP has the CA sign, and the SA store, an OCSP response for
+// the current status of the certificate with serial, so that a change made
+// by an administrator is served at once rather than after the OCSP updater
+// next gets to it. Failure isn't fatal, since the OCSP updater will still.
+func (ra *RegistrationAuthorityImpl) regenerateOCSP(ctx context.Context, serial string) {
+	if ra.CA == nil {
+		return
+	}
+	err := func() error {
+		cert, err := ra.SA.GetCertificate(ctx, serial)
+		if err != nil {
+			return err
+		}
+		status, err := ra.SA.GetCertificateStatus(ctx, serial)
+		if err != nil {
+			return err
+		}
+		ocspResponse, err := ra.CA.GenerateOCSP(ctx, core.OCSPSigningRequest{
+			CertDER:   cert.DER,
+			Status:    string(status.Status),
+			Reason:    status.RevokedReason,
+			RevokedAt: status.RevokedDate,
+		})
+		if err != nil {
+			return err
+		}
+		return ra.SA.UpdateOCSP(ctx, serial, ocspResponse)
+	}()
+	if err != nil {
+		ra.log.Warning(fmt.Sprintf("Failed to regenerate OCSP response for %s: %s", serial, err))
+		ra.stats.Inc("RA.OCSPRegeneration.Failed", 1, 1.0)
+		return
+	}
+	ra.stats.Inc("RA.OCSPRegeneration.Succeeded", 1, 1.0)
+}
+
 // AdministrativelyRevokeCertificate terminates trust in the certificate provided and
 // does not require the registration ID of the requester since this method is only
-// called from the admin-revoker tool.
-func (ra *RegistrationAuthorityImpl) AdministrativelyRevokeCertificate(cert x509.Certificate, revocationCode core.RevocationCode, user string) error {
+// called from the admin-revoker tool. It may use the reasons reserved for
+// administrators, and the certificate's OCSP response is regenerated at once.
+func (ra *RegistrationAuthorityImpl) AdministrativelyRevokeCertificate(ctx context.Context, cert x509.Certificate, revocationCode core.RevocationCode, user string) error {
 	serialString := core.SerialToString(cert.SerialNumber)
-	err := ra.SA.MarkCertificateRevoked(serialString, revocationCode)
+	user, err := ra.adminOperator(ctx, user)
+	if err == nil {
+		err = ra.checkRevocationReason(revocationCode, true)
+	}
+	if err == nil {
+		err = ra.SA.MarkCertificateRevoked(ctx, serialString, revocationCode)
+	}
+	if err == nil {
+		ra.regenerateOCSP(ctx, serialString)
+	}
 
 	state := "Failure"
 	defer func() {
@@ -768,7 +2213,7 @@ func (ra *RegistrationAuthorityImpl) AdministrativelyRevokeCertificate(cert x509
 		//   Revocation reason
 		//   Name of admin-revoker user
 		//   Error (if there was one)
-		ra.log.Audit(fmt.Sprintf(
+		ra.log.WithRequestID(core.RequestID(ctx)).Audit(fmt.Sprintf(
 			"%s, admin-revoker user: %s",
 			revokeEvent(state, serialString, cert.Subject.CommonName, cert.DNSNames, revocationCode),
 			user,
@@ -785,8 +2230,375 @@ func (ra *RegistrationAuthorityImpl) AdministrativelyRevokeCertificate(cert x509
 	return nil
 }
 
+// AdministrativelyRevokeCertificatesByKey handles a report that the key whose
+// core.KeyDigest is keyHash is compromised: the key is blocked, so that no
+// certificate is issued for it again, and then every unexpired certificate
+// for it is revoked with reason keyCompromise. It is only called from the
+// admin-revoker tool.
+func (ra *RegistrationAuthorityImpl) AdministrativelyRevokeCertificatesByKey(ctx context.Context, keyHash string, user string) error {
+	user, err := ra.adminOperator(ctx, user)
+	if err == nil {
+		err = checkKeyHash(keyHash)
+	}
+	if err == nil {
+		err = ra.SA.AddBlockedKey(ctx, keyHash, user)
+	}
+	var serials []string
+	if err == nil {
+		serials, err = ra.SA.GetSerialsByKeyHash(ctx, keyHash)
+	}
+
+	state := "Success"
+	if err != nil {
+		state = fmt.Sprintf("Failure -- %s", err)
+	}
+	// AUDIT[ Revocation Requests ] 4e85d791-09c0-4ab3-a837-d3d67e945134
+	ra.log.WithRequestID(core.RequestID(ctx)).Audit(fmt.Sprintf(
+		"Key block - State: %s, Key: %s, Unexpired certificates: %d, admin-revoker user: %s",
+		state, keyHash, len(serials), user,
+	))
+	if err != nil {
+		return err
+	}
+	ra.stats.Inc("RA.BlockedKeys", 1, 1.0)
+
+	var failed int
+	for _, serial := range serials {
+		if err := ra.revokeForKeyCompromise(ctx, serial, user); err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("Failed to revoke %d of the %d certificates for key %s", failed, len(serials), keyHash)
+	}
+	return nil
+}
+
+// AdministrativelyBlockKey blocks the key whose core.KeyDigest is keyHash,
+// so that no registration or certificate is made for it, without revoking
+// the certificates already issued for it. It is only called from the
+// admin-revoker tool.
+func (ra *RegistrationAuthorityImpl) AdministrativelyBlockKey(ctx context.Context, keyHash string, user string) error {
+	user, err := ra.adminOperator(ctx, user)
+	if err == nil {
+		err = checkKeyHash(keyHash)
+	}
+	if err == nil {
+		err = ra.SA.AddBlockedKey(ctx, keyHash, user)
+	}
+
+	state := "Success"
+	if err != nil {
+		state = fmt.Sprintf("Failure -- %s", err)
+	}
+	ra.log.WithRequestID(core.RequestID(ctx)).Audit(fmt.Sprintf(
+		"Key block - State: %s, Key: %s, admin-revoker user: %s",
+		state, keyHash, user,
+	))
+	if err == nil {
+		ra.stats.Inc("RA.BlockedKeys", 1, 1.0)
+	}
+	return err
+}
+
+// checkKeyHash returns an error if keyHash isn't a key digest, as made by
+// core.KeyDigest.
+func checkKeyHash(keyHash string) error {
+	if digest, err := base64.StdEncoding.DecodeString(keyHash); err != nil || len(digest) != sha256.Size {
+		return berrors.MalformedError("Invalid key hash %q", keyHash)
+	}
+	return nil
+}
+
+// revokeForKeyCompromise revokes the certificate with serial with reason
+// keyCompromise, unless it's already revoked other than by a hold.
+func (ra *RegistrationAuthorityImpl) revokeForKeyCompromise(ctx context.Context, serial string, user string) error {
+	// The certificate is only looked up for its names to be audited
+	var cn string
+	var names []string
+	if stored, err := ra.SA.GetCertificate(ctx, serial); err == nil {
+		if cert, err := x509.ParseCertificate(stored.DER); err == nil {
+			cn, names = cert.Subject.CommonName, cert.DNSNames
+		}
+	}
+
+	status, err := ra.SA.GetCertificateStatus(ctx, serial)
+	alreadyRevoked := err == nil && status.Status == core.OCSPStatusRevoked &&
+		status.RevokedReason != core.RevocationCertificateHold
+	if err == nil && !alreadyRevoked {
+		err = ra.SA.MarkCertificateRevoked(ctx, serial, core.RevocationKeyCompromise)
+		if err == nil {
+			ra.regenerateOCSP(ctx, serial)
+		}
+	}
+
+	state := "Success"
+	switch {
+	case err != nil:
+		state = fmt.Sprintf("Failure -- %s", err)
+	case alreadyRevoked:
+		state = "Skipped -- already revoked"
+	}
+	// AUDIT[ Revocation Requests ] 4e85d791-09c0-4ab3-a837-d3d67e945134
+	ra.log.WithRequestID(core.RequestID(ctx)).Audit(fmt.Sprintf(
+		"%s, admin-revoker user: %s",
+		revokeEvent(state, serial, cn, names, core.RevocationKeyCompromise),
+		user,
+	))
+	if err == nil && !alreadyRevoked {
+		ra.stats.Inc("RA.RevokedCertificates", 1, 1.0)
+	}
+	return err
+}
+
+// AdministrativelyReleaseCertificateHold restores trust in a certificate put
+// on hold with certificateHold. It is only called from the admin-revoker
+// tool, and only allowed for a private CA.
+func (ra *RegistrationAuthorityImpl) AdministrativelyReleaseCertificateHold(ctx context.Context, cert x509.Certificate, user string) error {
+	serialString := core.SerialToString(cert.SerialNumber)
+	user, err := ra.adminOperator(ctx, user)
+	if err == nil {
+		if !ra.PrivateCA {
+			err = berrors.MalformedError("Certificates can't be put on hold by this CA")
+		} else {
+			err = ra.SA.ReleaseCertificateHold(ctx, serialString)
+		}
+	}
+	if err == nil {
+		ra.regenerateOCSP(ctx, serialString)
+	}
+
+	state := "Failure"
+	defer func() {
+		// AUDIT[ Revocation Requests ] 4e85d791-09c0-4ab3-a837-d3d67e945134
+		// Needed:
+		//   Serial
+		//   CN
+		//   DNS names
+		//   Revocation reason
+		//   Name of admin-revoker user
+		//   Error (if there was one)
+		ra.log.WithRequestID(core.RequestID(ctx)).Audit(fmt.Sprintf(
+			"%s, admin-revoker user: %s",
+			revokeEvent(state, serialString, cert.Subject.CommonName, cert.DNSNames, core.RevocationRemoveFromCRL),
+			user,
+		))
+	}()
+
+	if err != nil {
+		state = fmt.Sprintf("Failure -- %s", err)
+		return err
+	}
+
+	state = "Success"
+	ra.stats.Inc("RA.ReleasedCertificateHolds", 1, 1.0)
+	return nil
+}
+
+// AdministrativelyDenyNames refuses future issuance for exactly the set of
+// names given. It is only called from the admin-revoker tool.
+func (ra *RegistrationAuthorityImpl) AdministrativelyDenyNames(ctx context.Context, names []string, user string) error {
+	user, err := ra.adminOperator(ctx, user)
+	if err == nil && len(names) == 0 {
+		err = berrors.MalformedError("No names to deny")
+	}
+	if err == nil {
+		err = ra.SA.AddDeniedCSR(ctx, names)
+	}
+
+	state := "Success"
+	if err != nil {
+		state = fmt.Sprintf("Failure -- %s", err)
+	}
+	// AUDIT[ Revocation Requests ] 4e85d791-09c0-4ab3-a837-d3d67e945134
+	ra.log.WithRequestID(core.RequestID(ctx)).Audit(fmt.Sprintf(
+		"Denial - State: %s, DNS Names: %s, admin-revoker user: %s",
+		state, names, user,
+	))
+	return err
+}
+
+// AdministrativelySetAccountTier puts the registration regID in tier. It is
+// only called from the admin-revoker tool.
+func (ra *RegistrationAuthorityImpl) AdministrativelySetAccountTier(ctx context.Context, regID int64, tier core.AccountTier, user string) error {
+	user, err := ra.adminOperator(ctx, user)
+	if err == nil && !tier.Known() {
+		err = berrors.MalformedError("Unknown account tier %q", tier)
+	}
+	var reg core.Registration
+	if err == nil {
+		reg, err = ra.SA.GetRegistration(ctx, regID)
+	}
+	oldTier := reg.EffectiveTier()
+	if err == nil {
+		reg.Tier = tier
+		err = ra.SA.UpdateRegistration(ctx, reg)
+	}
+
+	state := "Success"
+	if err != nil {
+		state = fmt.Sprintf("Failure -- %s", err)
+	}
+	ra.log.WithRequestID(core.RequestID(ctx)).Audit(fmt.Sprintf(
+		"Account tier change - State: %s, Registration: %d, Tier: %s -> %s, admin-revoker user: %s",
+		state, regID, oldTier, tier, user,
+	))
+	if err == nil {
+		ra.stats.Inc("RA.AccountTierChanges", 1, 1.0)
+	}
+	return err
+}
+
+// AdministrativelySetRateLimitOverride sets override, in place of any of
+// the same limit for the same key and registration. It is attributed to
+// user, and applies on each RA once it next reloads overrides.
+func (ra *RegistrationAuthorityImpl) AdministrativelySetRateLimitOverride(ctx context.Context, override core.RateLimitOverride, user string) error {
+	user, err := ra.adminOperator(ctx, user)
+	if err == nil {
+		err = checkRateLimitOverride(override)
+	}
+	if err == nil {
+		override.CreatedBy = user
+		err = ra.SA.SetRateLimitOverride(ctx, override)
+	}
+
+	state := "Success"
+	if err != nil {
+		state = fmt.Sprintf("Failure -- %s", err)
+	}
+	threshold := fmt.Sprintf("%d", override.Threshold)
+	if override.Multiplier != 0 {
+		threshold = fmt.Sprintf("%g times the default", override.Multiplier)
+	}
+	ra.log.WithRequestID(core.RequestID(ctx)).Audit(fmt.Sprintf(
+		"Rate limit override - State: %s, Limit: %s, Key: %q, Registration: %d, Threshold: %s, admin-revoker user: %s",
+		state, override.Limit, override.Key, override.RegistrationID, threshold, user,
+	))
+	if err == nil {
+		ra.stats.Inc("RA.RateLimitOverrideChanges", 1, 1.0)
+		ra.reloadRateLimitOverrides()
+	}
+	return err
+}
+
+// AdministrativelyRemoveRateLimitOverride removes the override of limit for
+// key and regID, attributing the removal to user.
+func (ra *RegistrationAuthorityImpl) AdministrativelyRemoveRateLimitOverride(ctx context.Context, limit, key string, regID int64, user string) error {
+	user, err := ra.adminOperator(ctx, user)
+	if err == nil {
+		err = ra.SA.RemoveRateLimitOverride(ctx, limit, key, regID)
+	}
+
+	state := "Success"
+	if err != nil {
+		state = fmt.Sprintf("Failure -- %s", err)
+	}
+	ra.log.WithRequestID(core.RequestID(ctx)).Audit(fmt.Sprintf(
+		"Rate limit override removal - State: %s, Limit: %s, Key: %q, Registration: %d, admin-revoker user: %s",
+		state, limit, key, regID, user,
+	))
+	if err == nil {
+		ra.stats.Inc("RA.RateLimitOverrideChanges", 1, 1.0)
+		ra.reloadRateLimitOverrides()
+	}
+	return err
+}
+
+// AdministrativelyReviewAuthorization approves or rejects the authorization
+// with ID authzID, which OnValidationUpdate held for review because its
+// identifier is high-risk. An approved authorization becomes valid, with a
+// lifetime starting now, and a rejected one invalid.
+func (ra *RegistrationAuthorityImpl) AdministrativelyReviewAuthorization(ctx context.Context, authzID string, approve bool, user string) error {
+	user, err := ra.adminOperator(ctx, user)
+	var authz core.Authorization
+	if err == nil {
+		authz, err = ra.SA.GetAuthorization(ctx, authzID)
+	}
+	if err == nil && authz.Status != core.StatusPendingReview {
+		err = berrors.MalformedError("Authorization %s is %s, not held for review", authzID, authz.Status)
+	}
+	if err == nil && (authz.Expires == nil || !authz.Expires.After(ra.clk.Now())) {
+		err = berrors.MalformedError("Authorization %s expired before it was reviewed", authzID)
+	}
+	if err == nil {
+		if approve {
+			var exp time.Time
+			exp, err = ra.validAuthzExpiry(ctx, authz.RegistrationID)
+			authz.Status = core.StatusValid
+			authz.Expires = &exp
+		} else {
+			authz.Status = core.StatusInvalid
+		}
+	}
+	if err == nil {
+		err = ra.SA.FinalizeAuthorization(ctx, authz)
+	}
+
+	state := "Success"
+	if err != nil {
+		state = fmt.Sprintf("Failure -- %s", err)
+	}
+	decision := "rejected"
+	if approve {
+		decision = "approved"
+	}
+	ra.log.WithRequestID(core.RequestID(ctx)).Audit(fmt.Sprintf(
+		"Authorization review - State: %s, ID: %s, Identifier: %s, Registration: %d, Decision: %s, admin-revoker user: %s",
+		state, authzID, authz.Identifier.Value, authz.RegistrationID, decision, user,
+	))
+	if err == nil {
+		ra.stats.Inc("RA.ReviewedAuthorizations", 1, 1.0)
+	}
+	return err
+}
+
+// reloadRateLimitOverrides has the overrides reloaded when next needed.
+func (ra *RegistrationAuthorityImpl) reloadRateLimitOverrides() {
+	ra.overridesMu.Lock()
+	defer ra.overridesMu.Unlock()
+	ra.overridesLoaded = time.Time{}
+}
+
+// checkRateLimitOverride returns an error if override isn't of a known
+// limit, for a key or registration, with either a threshold or a positive
+// multiplier.
+func checkRateLimitOverride(override core.RateLimitOverride) error {
+	var limits cmd.RateLimitConfig
+	if _, ok := limits.Policies()[override.Limit]; !ok {
+		return berrors.MalformedError("Unknown rate limit %q", override.Limit)
+	}
+	if override.Key == "" && override.RegistrationID <= 0 {
+		return berrors.MalformedError("Rate limit overrides must be for a key, a registration, or both")
+	}
+	if override.Multiplier < 0 || (override.Multiplier > 0 && override.Threshold != 0) {
+		return berrors.MalformedError("Rate limit overrides must have either a threshold or a positive multiplier")
+	}
+	if override.Threshold < cmd.Unlimited {
+		return berrors.MalformedError("Rate limit override threshold %d is below %d, unlimited", override.Threshold, cmd.Unlimited)
+	}
+	return nil
+}
+
+// adminOperator returns who an administrative request should be attributed
+// to. Without an AdminVerifier that's the user the caller names; with one,
+// it's the operator who signed the request's token, and requests without a
+// valid token are refused (and attributed to the user they name).
+func (ra *RegistrationAuthorityImpl) adminOperator(ctx context.Context, user string) (string, error) {
+	if ra.AdminVerifier == nil {
+		return user, nil
+	}
+	operator, err := ra.AdminVerifier.Verify(core.AdminToken(ctx))
+	if err != nil {
+		return user, berrors.UnauthorizedError("%s", err)
+	}
+	if operator != user {
+		ra.log.Warning(fmt.Sprintf("Admin request from %s claimed to be from %s", operator, user))
+	}
+	return operator, nil
+}
+
 // OnValidationUpdate is called when a given Authorization is updated by the VA.
-func (ra *RegistrationAuthorityImpl) OnValidationUpdate(authz core.Authorization) error {
+func (ra *RegistrationAuthorityImpl) OnValidationUpdate(ctx context.Context, authz core.Authorization) error {
 	// Consider validation successful if any of the combinations
 	// specified in the authorization has been fulfilled
 	validated := map[int]bool{}
@@ -809,20 +2621,69 @@ func (ra *RegistrationAuthorityImpl) OnValidationUpdate(authz core.Authorization
 	}
 
 	// If no validation succeeded, then the authorization is invalid
-	// NOTE: This only works because we only ever do one validation
+	// NOTE: This only works because the challenges of a combination are
+	// validated together, so the VA reports each combination only once
 	if authz.Status != core.StatusValid {
 		authz.Status = core.StatusInvalid
+	} else if ra.PA.HighRisk(authz.Identifier) {
+		// Hold the authorization, with its pending expiry, until an operator
+		// approves or rejects it with AdministrativelyReviewAuthorization
+		authz.Status = core.StatusPendingReview
+		err := ra.SA.UpdatePendingAuthorization(ctx, authz)
+		if err != nil {
+			return err
+		}
+		ra.log.WithRequestID(core.RequestID(ctx)).Audit(fmt.Sprintf(
+			"Authorization held for review - ID: %s, Identifier: %s, Registration: %d",
+			authz.ID, authz.Identifier.Value, authz.RegistrationID,
+		))
+		ra.stats.Inc("RA.HeldAuthorizations", 1, 1.0)
+		return nil
 	} else {
-		exp := ra.clk.Now().Add(ra.authorizationLifetime)
+		exp, err := ra.validAuthzExpiry(ctx, authz.RegistrationID)
+		if err != nil {
+			return err
+		}
 		authz.Expires = &exp
 	}
 
 	// Finalize the authorization
-	err := ra.SA.FinalizeAuthorization(authz)
+	err := ra.SA.FinalizeAuthorization(ctx, authz)
 	if err != nil {
 		return err
 	}
 
 	ra.stats.Inc("RA.FinalizedAuthorizations", 1, 1.0)
+	if authz.Status == core.StatusValid {
+		ra.recordCAACheck(ctx, authz)
+	}
 	return nil
 }
+
+// recordCAACheck records that CAA was checked, and allowed issuance, for the
+// identifier of authz, which the VA has just validated, so that issuance
+// needn't recheck it for CAARecheckAfter. Failing to isn't fatal: the name
+// is just rechecked at issuance.
+func (ra *RegistrationAuthorityImpl) recordCAACheck(ctx context.Context, authz core.Authorization) {
+	if ra.CAARecheckAfter <= 0 || authz.Identifier.Type != core.IdentifierDNS {
+		return
+	}
+	err := ra.SA.AddCAAChecks(ctx, []string{authz.Identifier.Value}, ra.clk.Now())
+	if _, ok := err.(core.NotSupportedError); err != nil && !ok {
+		ra.log.WithRequestID(core.RequestID(ctx)).Warning(fmt.Sprintf("Failed to record CAA check for %s: %s", authz.Identifier.Value, err))
+	}
+}
+
+// validAuthzExpiry returns when an authorization of regID that becomes
+// valid now expires.
+func (ra *RegistrationAuthorityImpl) validAuthzExpiry(ctx context.Context, regID int64) (time.Time, error) {
+	lifetime := ra.authorizationLifetime
+	if len(ra.Tiers) > 0 {
+		reg, err := ra.SA.GetRegistration(ctx, regID)
+		if err != nil {
+			return time.Time{}, err
+		}
+		lifetime = ra.authzLifetime(reg)
+	}
+	return ra.clk.Now().Add(lifetime), nil
+}
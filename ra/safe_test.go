@@ -10,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/letsencrypt/boulder/core"
+	berrors "github.com/letsencrypt/boulder/errors"
 	"github.com/letsencrypt/boulder/test"
 )
 
@@ -19,11 +20,11 @@ func TestChecksVASafeDomain(t *testing.T) {
 
 	va.IsNotSafe = true
 
-	_, err := ra.NewAuthorization(AuthzRequest, Registration.ID)
+	_, err := ra.NewAuthorization(ctx, AuthzRequest, Registration.ID)
 	if err == nil {
-		t.Errorf("want UnauthorizedError, got nil")
-	} else if _, ok := err.(core.UnauthorizedError); !ok {
-		t.Errorf("want UnauthorizedError, got %T", err)
+		t.Errorf("want an Unauthorized error, got nil")
+	} else if !berrors.Is(err, berrors.Unauthorized) {
+		t.Errorf("want an Unauthorized error, got %v", err)
 	}
 }
 
@@ -32,7 +33,7 @@ func TestHandlesVASafeDomainError(t *testing.T) {
 	defer cleanUp()
 	va.IsSafeDomainErr = errors.New("welp")
 
-	_, err := ra.NewAuthorization(AuthzRequest, Registration.ID)
+	_, err := ra.NewAuthorization(ctx, AuthzRequest, Registration.ID)
 	if err == nil {
 		t.Errorf("want InternalServerError, got nil")
 	} else if _, ok := err.(core.InternalServerError); !ok {
@@ -45,10 +46,10 @@ func TestAllowsNullSafeDomainCheck(t *testing.T) {
 	defer cleanUp()
 	ra.dc = nil
 
-	authz, err := ra.NewAuthorization(AuthzRequest, Registration.ID)
+	authz, err := ra.NewAuthorization(ctx, AuthzRequest, Registration.ID)
 	test.AssertNotError(t, err, "NewAuthorization failed")
 
-	dbAuthz, err := sa.GetAuthorization(authz.ID)
+	dbAuthz, err := sa.GetAuthorization(ctx, authz.ID)
 	test.AssertNotError(t, err, "Could not fetch authorization from database")
 	assertAuthzEqual(t, authz, dbAuthz)
 }
@@ -6,6 +6,7 @@
 package rpc
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
@@ -27,8 +28,10 @@ import (
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/streadway/amqp"
 	"github.com/letsencrypt/boulder/probs"
 
+	"github.com/letsencrypt/boulder/chaos"
 	"github.com/letsencrypt/boulder/cmd"
 	"github.com/letsencrypt/boulder/core"
+	berrors "github.com/letsencrypt/boulder/errors"
 	blog "github.com/letsencrypt/boulder/log"
 )
 
@@ -103,7 +106,7 @@ func amqpSubscribe(ch amqpChannel, name, routingKey string) (<-chan amqp.Deliver
 
 // DeliveryHandler is a function that will process an amqp.DeliveryHandler
 type DeliveryHandler func(amqp.Delivery)
-type messageHandler func([]byte) ([]byte, error)
+type messageHandler func(context.Context, []byte) ([]byte, error)
 
 // AmqpRPCServer listens on a specified queue within an AMQP channel.
 // When messages arrive on that queue, it dispatches them based on type,
@@ -187,9 +190,12 @@ func (rpc *AmqpRPCServer) HandleDeliveries(handler DeliveryHandler) {
 // rpcError is a JSON wrapper for error as it cannot be un/marshalled
 // due to type interface{}.
 type rpcError struct {
-	Value      string `json:"value"`
-	Type       string `json:"type,omitempty"`
-	HTTPStatus int    `json:"status,omitempty"`
+	Value       string                    `json:"value"`
+	Type        string                    `json:"type,omitempty"`
+	HTTPStatus  int                       `json:"status,omitempty"`
+	SubProblems []probs.SubProblemDetails `json:"subproblems,omitempty"`
+	// ErrorType is the category of a BoulderError
+	ErrorType berrors.ErrorType `json:"errorType,omitempty"`
 }
 
 // Wraps a error in a rpcError so it can be marshalled to
@@ -222,10 +228,14 @@ func wrapError(err error) *rpcError {
 			wrapped.Type = "RateLimitedError"
 		case core.ServiceUnavailableError:
 			wrapped.Type = "ServiceUnavailableError"
+		case *berrors.BoulderError:
+			wrapped.Type = "BoulderError"
+			wrapped.ErrorType = terr.Type
 		case *probs.ProblemDetails:
 			wrapped.Type = string(terr.Type)
 			wrapped.Value = terr.Detail
 			wrapped.HTTPStatus = terr.HTTPStatus
+			wrapped.SubProblems = terr.SubProblems
 		}
 		return wrapped
 	}
@@ -258,12 +268,15 @@ func unwrapError(rpcError *rpcError) error {
 			return core.RateLimitedError(rpcError.Value)
 		case "ServiceUnavailableError":
 			return core.ServiceUnavailableError(rpcError.Value)
+		case "BoulderError":
+			return &berrors.BoulderError{Type: rpcError.ErrorType, Detail: rpcError.Value}
 		default:
 			if strings.HasPrefix(rpcError.Type, "urn:") {
 				return &probs.ProblemDetails{
-					Type:       probs.ProblemType(rpcError.Type),
-					Detail:     rpcError.Value,
-					HTTPStatus: rpcError.HTTPStatus,
+					Type:        probs.ProblemType(rpcError.Type),
+					Detail:      rpcError.Value,
+					HTTPStatus:  rpcError.HTTPStatus,
+					SubProblems: rpcError.SubProblems,
 				}
 			}
 			return errors.New(rpcError.Value)
@@ -371,32 +384,67 @@ func makeAmqpChannel(conf *cmd.AMQPConfig) (*amqp.Channel, error) {
 	return conn.Channel()
 }
 
+// deliveryRequestID returns the request ID carried in the headers of msg, or
+// "" if it has none.
+func deliveryRequestID(msg amqp.Delivery) string {
+	id, _ := msg.Headers[core.RequestIDHeader].(string)
+	return id
+}
+
+// deliveryAdminToken returns the operator token carried in the headers of
+// msg, or "" if it has none.
+func deliveryAdminToken(msg amqp.Delivery) string {
+	token, _ := msg.Headers[core.AdminTokenHeader].(string)
+	return token
+}
+
 func (rpc *AmqpRPCServer) processMessage(msg amqp.Delivery) {
 	// XXX-JWS: jws.Verify(body)
 	cb, present := rpc.dispatchTable[msg.Type]
-	rpc.log.Debug(fmt.Sprintf(" [s<][%s][%s] received %s(%s) [%s]", rpc.serverQueue, msg.ReplyTo, msg.Type, safeDER(msg.Body), msg.CorrelationId))
+	requestID := deliveryRequestID(msg)
+	rpc.log.Debug(fmt.Sprintf(" [s<][%s][%s] received %s(%s) [%s] [%s]", rpc.serverQueue, msg.ReplyTo, msg.Type, safeDER(msg.Body), msg.CorrelationId, requestID))
 	if !present {
 		// AUDIT[ Misrouted Messages ] f523f21f-12d2-4c31-b2eb-ee4b7d96d60e
-		rpc.log.Audit(fmt.Sprintf(" [s<][%s][%s] Misrouted message: %s - %s - %s", rpc.serverQueue, msg.ReplyTo, msg.Type, safeDER(msg.Body), msg.CorrelationId))
+		rpc.log.WithRequestID(requestID).Audit(fmt.Sprintf(" [s<][%s][%s] Misrouted message: %s - %s - %s", rpc.serverQueue, msg.ReplyTo, msg.Type, safeDER(msg.Body), msg.CorrelationId))
 		return
 	}
+	checkPeerVersion(rpc.log, rpc.stats, rpc.serverQueue, msg)
+	// Answer a panicking call with an error, rather than leaving the client
+	// to time out
+	defer rpc.log.RecoverPanic(fmt.Sprintf("RPC.%s", msg.Type), func(interface{}) {
+		rpc.replyPanic(msg)
+	})
+	ctx := context.Background()
+	if requestID != "" {
+		ctx = core.WithRequestID(ctx, requestID)
+	}
+	if token := deliveryAdminToken(msg); token != "" {
+		ctx = core.WithAdminToken(ctx, token)
+	}
 	var response rpcResponse
-	var err error
-	response.ReturnVal, err = cb(msg.Body)
+	err := chaos.Inject(fmt.Sprintf("rpc.server.%s", msg.Type))
+	if err == chaos.ErrDropped {
+		return
+	}
+	if err == nil {
+		response.ReturnVal, err = cb(ctx, msg.Body)
+	}
 	response.Error = wrapError(err)
 	jsonResponse, err := json.Marshal(response)
 	if err != nil {
 		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-		rpc.log.Audit(fmt.Sprintf(" [s>][%s][%s] Error condition marshalling RPC response %s [%s]", rpc.serverQueue, msg.ReplyTo, msg.Type, msg.CorrelationId))
+		rpc.log.WithRequestID(requestID).Audit(fmt.Sprintf(" [s>][%s][%s] Error condition marshalling RPC response %s [%s]", rpc.serverQueue, msg.ReplyTo, msg.Type, msg.CorrelationId))
 		return
 	}
-	rpc.log.Debug(fmt.Sprintf(" [s>][%s][%s] replying %s: %s [%s]", rpc.serverQueue, msg.ReplyTo, msg.Type, response.debugString(), msg.CorrelationId))
+	rpc.log.Debug(fmt.Sprintf(" [s>][%s][%s] replying %s: %s [%s] [%s]", rpc.serverQueue, msg.ReplyTo, msg.Type, response.debugString(), msg.CorrelationId, requestID))
 	rpc.connection.publish(
 		msg.ReplyTo,
 		msg.CorrelationId,
 		"30000",
 		"",
 		msg.Type,
+		requestID,
+		"",
 		jsonResponse)
 }
 
@@ -407,9 +455,29 @@ func (rpc *AmqpRPCServer) replyTooManyRequests(msg amqp.Delivery) error {
 		"1000",
 		"",
 		msg.Type,
+		deliveryRequestID(msg),
+		"",
 		rpc.tooManyRequestsResponse)
 }
 
+func (rpc *AmqpRPCServer) replyPanic(msg amqp.Delivery) error {
+	response, err := json.Marshal(rpcResponse{
+		Error: wrapError(core.InternalServerError("RPC server failed to handle the request")),
+	})
+	if err != nil {
+		return err
+	}
+	return rpc.connection.publish(
+		msg.ReplyTo,
+		msg.CorrelationId,
+		"30000",
+		"",
+		msg.Type,
+		deliveryRequestID(msg),
+		"",
+		response)
+}
+
 // Start starts the AMQP-RPC server and handles reconnections, this will block
 // until a fatal error is returned or AmqpRPCServer.Stop() is called and all
 // remaining messages are processed.
@@ -587,6 +655,7 @@ func NewAmqpRPCClient(
 			select {
 			case msg, ok := <-rpc.connection.messages():
 				if ok {
+					checkPeerVersion(rpc.log, stats, rpc.serverQueue, msg)
 					corrID := msg.CorrelationId
 					rpc.mu.RLock()
 					responseChan, present := rpc.pending[corrID]
@@ -621,7 +690,7 @@ func NewAmqpRPCClient(
 // dispatch sends a body to the destination, and returns the id for the request
 // that can be used to correlate it with responses, and a response channel that
 // can be used to monitor for responses, or discarded for one-shot actions.
-func (rpc *AmqpRPCCLient) dispatch(method string, body []byte) (string, chan []byte) {
+func (rpc *AmqpRPCCLient) dispatch(ctx context.Context, method string, body []byte) (string, chan []byte) {
 	// Create a channel on which to direct the response
 	// At least in some cases, it's important that this channel
 	// be buffered to avoid deadlock
@@ -637,23 +706,36 @@ func (rpc *AmqpRPCCLient) dispatch(method string, body []byte) (string, chan []b
 	rpc.mu.Unlock()
 
 	// Send the request
-	rpc.log.Debug(fmt.Sprintf(" [c>][%s] requesting %s(%s) [%s]", rpc.clientQueue, method, safeDER(body), corrID))
+	requestID := core.RequestID(ctx)
+	rpc.log.Debug(fmt.Sprintf(" [c>][%s] requesting %s(%s) [%s] [%s]", rpc.clientQueue, method, safeDER(body), corrID, requestID))
 	rpc.connection.publish(
 		rpc.serverQueue,
 		corrID,
 		"30000",
 		rpc.clientQueue,
 		method,
+		requestID,
+		core.AdminToken(ctx),
 		body)
 
 	return corrID, responseChan
 }
 
 // DispatchSync sends a body to the destination, and blocks waiting on a response.
-func (rpc *AmqpRPCCLient) DispatchSync(method string, body []byte) (response []byte, err error) {
+// The request ID carried by ctx, if any, travels with the request.
+func (rpc *AmqpRPCCLient) DispatchSync(ctx context.Context, method string, body []byte) (response []byte, err error) {
 	rpc.stats.Inc(fmt.Sprintf("RPC.Traffic.Tx.%s", rpc.serverQueue), int64(len(body)), 1.0)
 	callStarted := time.Now()
-	corrID, responseChan := rpc.dispatch(method, body)
+	var corrID string
+	var responseChan chan []byte
+	err = chaos.Inject(fmt.Sprintf("rpc.client.%s", method))
+	if err != nil && err != chaos.ErrDropped {
+		return
+	}
+	if err == nil {
+		corrID, responseChan = rpc.dispatch(ctx, method, body)
+	}
+	// A dropped request is never answered, and so times out
 	select {
 	case jsonResponse := <-responseChan:
 		var rpcResponse rpcResponse
@@ -672,11 +754,20 @@ func (rpc *AmqpRPCCLient) DispatchSync(method string, body []byte) (response []b
 		return
 	case <-time.After(rpc.timeout):
 		rpc.stats.TimingDuration(fmt.Sprintf("RPC.ClientCallLatency.%s.Timeout", method), time.Since(callStarted), 1.0)
-		rpc.log.Warning(fmt.Sprintf(" [c!][%s] AMQP-RPC timeout [%s]", rpc.clientQueue, method))
+		rpc.log.Warning(fmt.Sprintf(" [c!][%s] AMQP-RPC timeout [%s] [%s]", rpc.clientQueue, method, core.RequestID(ctx)))
 		rpc.mu.Lock()
 		delete(rpc.pending, corrID)
 		rpc.mu.Unlock()
 		err = errors.New("AMQP-RPC timeout")
 		return
+	case <-ctx.Done():
+		// The caller gave up, e.g. on a request that timed out, so the
+		// response is no longer wanted
+		rpc.stats.TimingDuration(fmt.Sprintf("RPC.ClientCallLatency.%s.Cancelled", method), time.Since(callStarted), 1.0)
+		rpc.mu.Lock()
+		delete(rpc.pending, corrID)
+		rpc.mu.Unlock()
+		err = ctx.Err()
+		return
 	}
 }
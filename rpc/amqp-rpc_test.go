@@ -6,11 +6,20 @@
 package rpc
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/streadway/amqp"
+	"github.com/letsencrypt/boulder/chaos"
 	"github.com/letsencrypt/boulder/core"
+	berrors "github.com/letsencrypt/boulder/errors"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/mocks"
 	"github.com/letsencrypt/boulder/probs"
 	"github.com/letsencrypt/boulder/test"
 )
@@ -54,10 +63,42 @@ func TestWrapError(t *testing.T) {
 				HTTPStatus: 417,
 			},
 		},
+		{
+			&probs.ProblemDetails{
+				Type:       probs.UnauthorizedProblem,
+				Detail:     "not authorized",
+				HTTPStatus: 403,
+				SubProblems: []probs.SubProblemDetails{{
+					ProblemDetails: *probs.Unauthorized("Authorization for example.com expired"),
+					Identifier:     probs.Identifier{Type: "dns", Value: "example.com"},
+				}},
+			},
+			&probs.ProblemDetails{
+				Type:       probs.UnauthorizedProblem,
+				Detail:     "not authorized",
+				HTTPStatus: 403,
+				SubProblems: []probs.SubProblemDetails{{
+					ProblemDetails: *probs.Unauthorized("Authorization for example.com expired"),
+					Identifier:     probs.Identifier{Type: "dns", Value: "example.com"},
+				}},
+			},
+		},
 		{
 			&probs.ProblemDetails{Type: "invalid", Detail: "hm"},
 			errors.New("hm"),
 		},
+		{
+			berrors.NotFoundError("No certificate with serial %s", "ff"),
+			&berrors.BoulderError{Type: berrors.NotFound, Detail: "No certificate with serial ff"},
+		},
+		{
+			berrors.InternalServerError("oops"),
+			&berrors.BoulderError{Type: berrors.InternalServer, Detail: "oops"},
+		},
+		{
+			berrors.RejectedIdentifierError("Name is blacklisted"),
+			&berrors.BoulderError{Type: berrors.RejectedIdentifier, Detail: "Name is blacklisted"},
+		},
 		{
 			errors.New(""),
 			errors.New(""),
@@ -71,3 +112,200 @@ func TestWrapError(t *testing.T) {
 
 	}
 }
+
+func TestProcessMessageRequestID(t *testing.T) {
+	ac, mockChannel, finish := setup(t)
+	defer finish()
+	ac.channel = mockChannel
+
+	var handledID, handledToken string
+	server := &AmqpRPCServer{
+		serverQueue: "fooqueue",
+		connection:  ac,
+		log:         blog.GetAuditLogger(),
+		dispatchTable: map[string]messageHandler{
+			"testMsg": func(ctx context.Context, req []byte) ([]byte, error) {
+				handledID = core.RequestID(ctx)
+				handledToken = core.AdminToken(ctx)
+				return req, nil
+			},
+		},
+	}
+
+	response, _ := json.Marshal(rpcResponse{ReturnVal: []byte("body")})
+	mockChannel.EXPECT().Publish(
+		AmqpExchange,
+		"replyTo",
+		AmqpMandatory,
+		AmqpImmediate,
+		amqp.Publishing{
+			Headers:       messageHeaders("f00f", ""),
+			Body:          response,
+			CorrelationId: "03c52e",
+			Expiration:    "30000",
+			Type:          "testMsg",
+			Timestamp:     ac.clk.Now(),
+		})
+	server.processMessage(amqp.Delivery{
+		Headers:       amqp.Table{core.RequestIDHeader: "f00f", core.AdminTokenHeader: "t0ken"},
+		Body:          []byte("body"),
+		CorrelationId: "03c52e",
+		ReplyTo:       "replyTo",
+		Type:          "testMsg",
+	})
+	test.AssertEquals(t, handledID, "f00f")
+	test.AssertEquals(t, handledToken, "t0ken")
+}
+
+func TestProcessMessagePanic(t *testing.T) {
+	ac, mockChannel, finish := setup(t)
+	defer finish()
+	ac.channel = mockChannel
+
+	server := &AmqpRPCServer{
+		serverQueue: "fooqueue",
+		connection:  ac,
+		log:         blog.GetAuditLogger(),
+		dispatchTable: map[string]messageHandler{
+			"testMsg": func(ctx context.Context, req []byte) ([]byte, error) {
+				panic("handler bug")
+			},
+		},
+	}
+
+	// The caller gets an internal error rather than waiting out its timeout
+	response, _ := json.Marshal(rpcResponse{
+		Error: wrapError(core.InternalServerError("RPC server failed to handle the request")),
+	})
+	mockChannel.EXPECT().Publish(
+		AmqpExchange,
+		"replyTo",
+		AmqpMandatory,
+		AmqpImmediate,
+		amqp.Publishing{
+			Headers:       messageHeaders("", ""),
+			Body:          response,
+			CorrelationId: "03c52e",
+			Expiration:    "30000",
+			Type:          "testMsg",
+			Timestamp:     ac.clk.Now(),
+		})
+	server.processMessage(amqp.Delivery{
+		Body:          []byte("body"),
+		CorrelationId: "03c52e",
+		ReplyTo:       "replyTo",
+		Type:          "testMsg",
+	})
+}
+
+func TestProcessMessageChaos(t *testing.T) {
+	ac, mockChannel, finish := setup(t)
+	defer finish()
+	ac.channel = mockChannel
+	chaos.Enable()
+	defer chaos.Reset()
+
+	handled := 0
+	server := &AmqpRPCServer{
+		serverQueue: "fooqueue",
+		connection:  ac,
+		log:         blog.GetAuditLogger(),
+		dispatchTable: map[string]messageHandler{
+			"testMsg": func(ctx context.Context, req []byte) ([]byte, error) {
+				handled++
+				return req, nil
+			},
+		},
+	}
+	delivery := amqp.Delivery{
+		Body:          []byte("body"),
+		CorrelationId: "03c52e",
+		ReplyTo:       "replyTo",
+		Type:          "testMsg",
+	}
+
+	// An injected error is the reply, in place of the handler's
+	chaos.Set("rpc.server.testMsg", chaos.Fault{Error: "boom", Count: 1})
+	response, _ := json.Marshal(rpcResponse{
+		Error: wrapError(&chaos.Error{Point: "rpc.server.testMsg", Message: "boom"}),
+	})
+	mockChannel.EXPECT().Publish(
+		AmqpExchange,
+		"replyTo",
+		AmqpMandatory,
+		AmqpImmediate,
+		amqp.Publishing{
+			Headers:       messageHeaders("", ""),
+			Body:          response,
+			CorrelationId: "03c52e",
+			Expiration:    "30000",
+			Type:          "testMsg",
+			Timestamp:     ac.clk.Now(),
+		})
+	server.processMessage(delivery)
+	test.AssertEquals(t, handled, 0)
+
+	// A dropped message gets no reply at all
+	chaos.Set("rpc.server.testMsg", chaos.Fault{Drop: true, Count: 1})
+	server.processMessage(delivery)
+	test.AssertEquals(t, handled, 0)
+	test.AssertEquals(t, chaos.Injected("rpc.server.testMsg"), int64(2))
+}
+
+func TestDispatchSyncCancelled(t *testing.T) {
+	chaos.Enable()
+	defer chaos.Reset()
+	stats := mocks.NewStatter()
+	client := &AmqpRPCCLient{
+		clientQueue: "client",
+		timeout:     time.Hour,
+		log:         blog.GetAuditLogger(),
+		pending:     make(map[string]chan []byte),
+		stats:       &stats,
+	}
+
+	// A caller that gives up isn't kept waiting for the response
+	chaos.Set("rpc.client.testMsg", chaos.Fault{Drop: true, Count: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := client.DispatchSync(ctx, "testMsg", []byte("body"))
+	test.AssertEquals(t, err, context.Canceled)
+	test.AssertEquals(t, len(client.pending), 0)
+}
+
+func TestMessageHeaders(t *testing.T) {
+	core.EnableFeature("testFeature")
+	headers := messageHeaders("f00f", "")
+	test.AssertEquals(t, headers[buildIDHeader], core.GetBuildID())
+	test.AssertEquals(t, headers[rpcVersionHeader], int32(rpcVersion))
+	test.Assert(t, strings.Contains(headers[featuresHeader].(string), "testFeature"), "Enabled feature not advertised")
+	test.AssertEquals(t, headers[core.RequestIDHeader], "f00f")
+
+	_, present := messageHeaders("", "")[core.RequestIDHeader]
+	test.Assert(t, !present, "Empty request ID sent")
+
+	test.AssertEquals(t, messageHeaders("", "t0ken")[core.AdminTokenHeader], "t0ken")
+	_, present = messageHeaders("", "")[core.AdminTokenHeader]
+	test.Assert(t, !present, "Empty operator token sent")
+}
+
+func TestCheckPeerVersion(t *testing.T) {
+	stats := mocks.NewStatter()
+	logger := blog.GetAuditLogger()
+	log.Clear()
+
+	// Peers that predate the headers, and peers of the same version, pass
+	checkPeerVersion(logger, &stats, "fooqueue", amqp.Delivery{})
+	checkPeerVersion(logger, &stats, "fooqueue", amqp.Delivery{Headers: messageHeaders("", "")})
+	test.AssertEquals(t, stats.Counters["RPC.VersionMismatch.fooqueue"], int64(0))
+
+	// Mismatched peers are counted every time but warned about once
+	mismatched := amqp.Delivery{Headers: amqp.Table{
+		buildIDHeader:    "0ldbu1ld",
+		rpcVersionHeader: int32(rpcVersion - 1),
+	}}
+	checkPeerVersion(logger, &stats, "fooqueue", mismatched)
+	checkPeerVersion(logger, &stats, "fooqueue", mismatched)
+	test.AssertEquals(t, stats.Counters["RPC.VersionMismatch.fooqueue"], int64(2))
+	test.AssertEquals(t, len(log.GetAllMatching("Peer build 0ldbu1ld speaks RPC version")), 1)
+}
@@ -117,17 +117,21 @@ func (ac *amqpConnector) cancel() {
 }
 
 // publish publishes a message onto the provided queue. We provide this wrapper
-// because it requires locking around the read of ac.channel.
-func (ac *amqpConnector) publish(queueName, corrId, expiration, replyTo, msgType string, body []byte) error {
+// because it requires locking around the read of ac.channel. The message's
+// headers describe this build and carry a non-empty requestID and
+// adminToken.
+func (ac *amqpConnector) publish(queueName, corrId, expiration, replyTo, msgType, requestID, adminToken string, body []byte) error {
 	ac.mu.RLock()
 	channel := ac.channel
 	ac.mu.RUnlock()
+	headers := messageHeaders(requestID, adminToken)
 	return channel.Publish(
 		AmqpExchange,
 		queueName,
 		AmqpMandatory,
 		AmqpImmediate,
 		amqp.Publishing{
+			Headers:       headers,
 			Body:          body,
 			CorrelationId: corrId,
 			Expiration:    expiration,
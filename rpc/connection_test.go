@@ -122,6 +122,7 @@ func TestPublish(t *testing.T) {
 		AmqpMandatory,
 		AmqpImmediate,
 		amqp.Publishing{
+			Headers:       messageHeaders("", ""),
 			Body:          []byte("body"),
 			CorrelationId: "03c52e",
 			Expiration:    "3000",
@@ -129,5 +130,26 @@ func TestPublish(t *testing.T) {
 			Type:          "testMsg",
 			Timestamp:     ac.clk.Now(),
 		})
-	ac.publish("fooqueue", "03c52e", "3000", "replyTo", "testMsg", []byte("body"))
+	ac.publish("fooqueue", "03c52e", "3000", "replyTo", "testMsg", "", "", []byte("body"))
+}
+
+func TestPublishRequestID(t *testing.T) {
+	ac, mockChannel, finish := setup(t)
+	defer finish()
+	ac.channel = mockChannel
+	mockChannel.EXPECT().Publish(
+		AmqpExchange,
+		"fooqueue",
+		AmqpMandatory,
+		AmqpImmediate,
+		amqp.Publishing{
+			Headers:       messageHeaders("f00f", ""),
+			Body:          []byte("body"),
+			CorrelationId: "03c52e",
+			Expiration:    "3000",
+			ReplyTo:       "replyTo",
+			Type:          "testMsg",
+			Timestamp:     ac.clk.Now(),
+		})
+	ac.publish("fooqueue", "03c52e", "3000", "replyTo", "testMsg", "f00f", "", []byte("body"))
 }
@@ -5,9 +5,11 @@
 
 package rpc
 
+import "context"
+
 // Client describes the functions an RPC Client performs
 type Client interface {
-	DispatchSync(string, []byte) ([]byte, error)
+	DispatchSync(context.Context, string, []byte) ([]byte, error)
 }
 
 // Server describes the functions an RPC Server performs
@@ -6,6 +6,7 @@
 package rpc
 
 import (
+	"context"
 	"crypto/x509"
 	"encoding/json"
 	"errors"
@@ -14,9 +15,10 @@ import (
 	"time"
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
-	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
 	"github.com/letsencrypt/boulder/cmd"
 	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/identifier"
 	blog "github.com/letsencrypt/boulder/log"
 )
 
@@ -32,45 +34,89 @@ import (
 // or less stand-alone component.  ${ROLE}Client is loaded by the
 // code making use of the functionality.
 //
-// The WebFrontEnd role does not expose any functionality over RPC,
-// so it doesn't need wrappers.
+// The WebFrontEnd role only exposes nonce redemption over RPC, so that
+// a nonce issued by one WFE instance can be redeemed by its peers.
 
 // These strings are used by the RPC layer to identify function points.
 const (
-	MethodNewRegistration                   = "NewRegistration"                   // RA, SA
-	MethodNewAuthorization                  = "NewAuthorization"                  // RA
-	MethodNewCertificate                    = "NewCertificate"                    // RA
-	MethodUpdateRegistration                = "UpdateRegistration"                // RA, SA
-	MethodUpdateAuthorization               = "UpdateAuthorization"               // RA
-	MethodRevokeCertificate                 = "RevokeCertificate"                 // CA
-	MethodRevokeCertificateWithReg          = "RevokeCertificateWithReg"          // RA
-	MethodAdministrativelyRevokeCertificate = "AdministrativelyRevokeCertificate" // RA
-	MethodOnValidationUpdate                = "OnValidationUpdate"                // RA
-	MethodUpdateValidations                 = "UpdateValidations"                 // VA
-	MethodCheckCAARecords                   = "CheckCAARecords"                   // VA
-	MethodIsSafeDomain                      = "IsSafeDomain"                      // VA
-	MethodIssueCertificate                  = "IssueCertificate"                  // CA
-	MethodGenerateOCSP                      = "GenerateOCSP"                      // CA
-	MethodGetRegistration                   = "GetRegistration"                   // SA
-	MethodGetRegistrationByKey              = "GetRegistrationByKey"              // RA, SA
-	MethodGetAuthorization                  = "GetAuthorization"                  // SA
-	MethodGetLatestValidAuthorization       = "GetLatestValidAuthorization"       // SA
-	MethodGetCertificate                    = "GetCertificate"                    // SA
-	MethodGetCertificateStatus              = "GetCertificateStatus"              // SA
-	MethodMarkCertificateRevoked            = "MarkCertificateRevoked"            // SA
-	MethodUpdateOCSP                        = "UpdateOCSP"                        // SA
-	MethodNewPendingAuthorization           = "NewPendingAuthorization"           // SA
-	MethodUpdatePendingAuthorization        = "UpdatePendingAuthorization"        // SA
-	MethodFinalizeAuthorization             = "FinalizeAuthorization"             // SA
-	MethodAddCertificate                    = "AddCertificate"                    // SA
-	MethodAlreadyDeniedCSR                  = "AlreadyDeniedCSR"                  // SA
-	MethodCountCertificatesRange            = "CountCertificatesRange"            // SA
-	MethodCountCertificatesByNames          = "CountCertificatesByNames"          // SA
-	MethodCountRegistrationsByIP            = "CountRegistrationsByIP"            // SA
-	MethodCountPendingAuthorizations        = "CountPendingAuthorizations"        // SA
-	MethodGetSCTReceipt                     = "GetSCTReceipt"                     // SA
-	MethodAddSCTReceipt                     = "AddSCTReceipt"                     // SA
-	MethodSubmitToCT                        = "SubmitToCT"                        // Pub
+	MethodNewRegistration                         = "NewRegistration"                         // RA, SA
+	MethodNewAuthorization                        = "NewAuthorization"                        // RA
+	MethodNewAuthorizations                       = "NewAuthorizations"                       // RA
+	MethodNewCertificate                          = "NewCertificate"                          // RA
+	MethodNewCertificateOrder                     = "NewCertificateOrder"                     // RA, SA
+	MethodUpdateRegistration                      = "UpdateRegistration"                      // RA, SA
+	MethodUpdateAuthorization                     = "UpdateAuthorization"                     // RA
+	MethodRevokeCertificate                       = "RevokeCertificate"                       // CA
+	MethodRevokeCertificateWithReg                = "RevokeCertificateWithReg"                // RA
+	MethodAdministrativelyRevokeCertificate       = "AdministrativelyRevokeCertificate"       // RA
+	MethodAdministrativelyReleaseCertificateHold  = "AdministrativelyReleaseCertificateHold"  // RA
+	MethodAdministrativelyRevokeCertificatesByKey = "AdministrativelyRevokeCertificatesByKey" // RA
+	MethodAdministrativelyBlockKey                = "AdministrativelyBlockKey"                // RA
+	MethodAdministrativelyDenyNames               = "AdministrativelyDenyNames"               // RA
+	MethodAdministrativelySetAccountTier          = "AdministrativelySetAccountTier"          // RA
+	MethodAdministrativelySetRateLimitOverride    = "AdministrativelySetRateLimitOverride"    // RA
+	MethodAdministrativelyRemoveRateLimitOverride = "AdministrativelyRemoveRateLimitOverride" // RA
+	MethodAdministrativelyReviewAuthorization     = "AdministrativelyReviewAuthorization"     // RA
+	MethodOnValidationUpdate                      = "OnValidationUpdate"                      // RA
+	MethodDeactivateAuthorization                 = "DeactivateAuthorization"                 // RA, SA
+	MethodVerifyContact                           = "VerifyContact"                           // RA
+	MethodUpdateValidations                       = "UpdateValidations"                       // VA
+	MethodCheckCAARecords                         = "CheckCAARecords"                         // VA
+	MethodIsSafeDomain                            = "IsSafeDomain"                            // VA
+	MethodPerformValidation                       = "PerformValidation"                       // VA
+	MethodIssueCertificate                        = "IssueCertificate"                        // CA
+	MethodGenerateOCSP                            = "GenerateOCSP"                            // CA
+	MethodGetRegistration                         = "GetRegistration"                         // SA
+	MethodGetRegistrationByKey                    = "GetRegistrationByKey"                    // RA, SA
+	MethodGetAuthorization                        = "GetAuthorization"                        // SA
+	MethodGetLatestValidAuthorization             = "GetLatestValidAuthorization"             // SA
+	MethodGetAuthorizations                       = "GetAuthorizations"                       // SA
+	MethodGetReusableAuthorizations               = "GetReusableAuthorizations"               // SA
+	MethodGetCertificate                          = "GetCertificate"                          // SA
+	MethodGetCertificatesByRegistration           = "GetCertificatesByRegistration"           // SA
+	MethodGetCertificateStatus                    = "GetCertificateStatus"                    // SA
+	MethodGetCertificateIssuer                    = "GetCertificateIssuer"                    // SA
+	MethodMarkCertificateRevoked                  = "MarkCertificateRevoked"                  // SA
+	MethodReleaseCertificateHold                  = "ReleaseCertificateHold"                  // SA
+	MethodUpdateOCSP                              = "UpdateOCSP"                              // SA
+	MethodNewPendingAuthorization                 = "NewPendingAuthorization"                 // SA
+	MethodNewPendingAuthorizations                = "NewPendingAuthorizations"                // SA
+	MethodUpdatePendingAuthorization              = "UpdatePendingAuthorization"              // SA
+	MethodFinalizeAuthorization                   = "FinalizeAuthorization"                   // SA
+	MethodAddCertificate                          = "AddCertificate"                          // SA
+	MethodAlreadyDeniedCSR                        = "AlreadyDeniedCSR"                        // SA
+	MethodGetSerialsByKeyHash                     = "GetSerialsByKeyHash"                     // SA
+	MethodAddBlockedKey                           = "AddBlockedKey"                           // SA
+	MethodKeyBlocked                              = "KeyBlocked"                              // SA
+	MethodAddDeniedCSR                            = "AddDeniedCSR"                            // SA
+	MethodGetRateLimitOverrides                   = "GetRateLimitOverrides"                   // SA
+	MethodGetPendingReviewAuthorizations          = "GetPendingReviewAuthorizations"          // SA
+	MethodSetRateLimitOverride                    = "SetRateLimitOverride"                    // SA
+	MethodRemoveRateLimitOverride                 = "RemoveRateLimitOverride"                 // SA
+	MethodAddReplacementOrder                     = "AddReplacementOrder"                     // SA
+	MethodFinalizeCertificateOrder                = "FinalizeCertificateOrder"                // SA
+	MethodClaimCertificateOrders                  = "ClaimCertificateOrders"                  // SA
+	MethodGetCertificateOrder                     = "GetCertificateOrder"                     // SA
+	MethodReserveIdempotencyKey                   = "ReserveIdempotencyKey"                   // SA
+	MethodFinalizeIdempotencyKey                  = "FinalizeIdempotencyKey"                  // SA
+	MethodGetCAAChecks                            = "GetCAAChecks"                            // SA
+	MethodAddCAAChecks                            = "AddCAAChecks"                            // SA
+	MethodReplacementIssued                       = "ReplacementIssued"                       // SA
+	MethodAddValidationTranscript                 = "AddValidationTranscript"                 // SA
+	MethodGetValidationTranscripts                = "GetValidationTranscripts"                // SA
+	MethodCountCertificatesRange                  = "CountCertificatesRange"                  // SA
+	MethodCountCertificatesByNames                = "CountCertificatesByNames"                // SA
+	MethodCountFQDNSets                           = "CountFQDNSets"                           // SA
+	MethodFQDNSetExists                           = "FQDNSetExists"                           // SA
+	MethodCountRegistrationsByIP                  = "CountRegistrationsByIP"                  // SA
+	MethodCountPendingAuthorizations              = "CountPendingAuthorizations"              // SA
+	MethodGetSCTReceipt                           = "GetSCTReceipt"                           // SA
+	MethodGetCTSubmissions                        = "GetCTSubmissions"                        // SA
+	MethodRecordCTSubmission                      = "RecordCTSubmission"                      // SA
+	MethodRecordCTInclusion                       = "RecordCTInclusion"                       // SA
+	MethodSubmitToCT                              = "SubmitToCT"                              // Pub
+	MethodCheckCTInclusion                        = "CheckCTInclusion"                        // Pub
+	MethodRedeemNonce                             = "RedeemNonce"                             // WFE
 )
 
 // Request structs
@@ -78,6 +124,11 @@ type registrationRequest struct {
 	Reg core.Registration
 }
 
+type verifyContactRequest struct {
+	RegID   int64
+	Contact string
+}
+
 type getRegistrationRequest struct {
 	ID int64
 }
@@ -91,6 +142,11 @@ type authorizationRequest struct {
 	RegID int64
 }
 
+type authorizationsRequest struct {
+	Authzs []core.Authorization
+	RegID  int64
+}
+
 type updateAuthorizationRequest struct {
 	Authz    core.Authorization
 	Index    int
@@ -99,7 +155,19 @@ type updateAuthorizationRequest struct {
 
 type latestValidAuthorizationRequest struct {
 	RegID      int64
-	Identifier core.AcmeIdentifier
+	Identifier identifier.ACMEIdentifier
+}
+
+type getAuthorizationsRequest struct {
+	RegID int64
+	Names []string
+	Now   time.Time
+}
+
+type getCertificatesByRegistrationRequest struct {
+	RegID  int64
+	Offset int
+	Limit  int
 }
 
 type certificateRequest struct {
@@ -108,8 +176,10 @@ type certificateRequest struct {
 }
 
 type issueCertificateRequest struct {
-	Bytes []byte
-	RegID int64
+	Bytes    []byte
+	RegID    int64
+	Profile  string
+	Validity core.Validity
 }
 
 type addCertificateRequest struct {
@@ -128,7 +198,9 @@ type markCertificateRevokedRequest struct {
 }
 
 type caaRequest struct {
-	Ident core.AcmeIdentifier
+	Ident         identifier.ACMEIdentifier
+	RegID         int64  `json:",omitempty"`
+	ChallengeType string `json:",omitempty"`
 }
 
 type validationRequest struct {
@@ -140,6 +212,22 @@ type alreadyDeniedCSRReq struct {
 	Names []string
 }
 
+type addBlockedKeyRequest struct {
+	KeyHash string
+	AddedBy string
+}
+
+type replacementOrderRequest struct {
+	Serial         string
+	ReplacedSerial string
+}
+
+type validationTranscriptRequest struct {
+	AuthzID       string
+	ChallengeType string
+	Signed        []byte
+}
+
 type updateOCSPRequest struct {
 	Serial       string
 	OCSPResponse []byte
@@ -156,6 +244,10 @@ type countCertificatesByNamesRequest struct {
 	Latest   time.Time
 }
 
+type fqdnSetExistsRequest struct {
+	Names []string
+}
+
 type countRegistrationsByIPRequest struct {
 	IP       net.IP
 	Earliest time.Time
@@ -166,19 +258,52 @@ type countPendingAuthorizationsRequest struct {
 	RegID int64
 }
 
+type pendingReviewAuthorizationsRequest struct {
+	Now time.Time
+}
+
+type newCertificateOrderRequest struct {
+	Order core.CertificateOrder
+	Req   core.CertificateRequest
+}
+
+type claimCertificateOrdersRequest struct {
+	StaleBefore time.Time
+	Now         time.Time
+	Limit       int
+}
+
+type reserveIdempotencyKeyRequest struct {
+	Key         core.IdempotencyKey
+	StaleBefore time.Time
+}
+
+type addCAAChecksRequest struct {
+	Names   []string
+	Checked time.Time
+}
+
+type redeemNonceRequest struct {
+	Nonce string
+}
+
 // Response structs
+type redeemNonceResponse struct {
+	Valid bool
+}
+
 type caaResponse struct {
 	Present bool
 	Valid   bool
 	Err     error
 }
 
-func improperMessage(method string, err error, obj interface{}) {
-	log := blog.GetAuditLogger()
+func improperMessage(ctx context.Context, method string, err error, obj interface{}) {
+	log := blog.GetAuditLogger().WithRequestID(core.RequestID(ctx))
 	log.Audit(fmt.Sprintf("Improper message. method: %s err: %s data: %+v", method, err, obj))
 }
-func errorCondition(method string, err error, obj interface{}) {
-	log := blog.GetAuditLogger()
+func errorCondition(ctx context.Context, method string, err error, obj interface{}) {
+	log := blog.GetAuditLogger().WithRequestID(core.RequestID(ctx))
 	log.Audit(fmt.Sprintf("Error condition. method: %s err: %s data: %+v", method, err, obj))
 }
 
@@ -186,15 +311,15 @@ func errorCondition(method string, err error, obj interface{}) {
 func NewRegistrationAuthorityServer(rpc Server, impl core.RegistrationAuthority) error {
 	log := blog.GetAuditLogger()
 
-	rpc.Handle(MethodNewRegistration, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodNewRegistration, func(ctx context.Context, req []byte) (response []byte, err error) {
 		var rr registrationRequest
 		if err = json.Unmarshal(req, &rr); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodNewRegistration, err, req)
+			improperMessage(ctx, MethodNewRegistration, err, req)
 			return
 		}
 
-		reg, err := impl.NewRegistration(rr.Reg)
+		reg, err := impl.NewRegistration(ctx, rr.Reg)
 		if err != nil {
 			return
 		}
@@ -202,21 +327,21 @@ func NewRegistrationAuthorityServer(rpc Server, impl core.RegistrationAuthority)
 		response, err = json.Marshal(reg)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodNewRegistration, err, req)
+			errorCondition(ctx, MethodNewRegistration, err, req)
 			return
 		}
 		return
 	})
 
-	rpc.Handle(MethodNewAuthorization, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodNewAuthorization, func(ctx context.Context, req []byte) (response []byte, err error) {
 		var ar authorizationRequest
 		if err = json.Unmarshal(req, &ar); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodNewAuthorization, err, req)
+			improperMessage(ctx, MethodNewAuthorization, err, req)
 			return
 		}
 
-		authz, err := impl.NewAuthorization(ar.Authz, ar.RegID)
+		authz, err := impl.NewAuthorization(ctx, ar.Authz, ar.RegID)
 		if err != nil {
 			return
 		}
@@ -224,23 +349,45 @@ func NewRegistrationAuthorityServer(rpc Server, impl core.RegistrationAuthority)
 		response, err = json.Marshal(authz)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodNewAuthorization, err, req)
+			errorCondition(ctx, MethodNewAuthorization, err, req)
+			return
+		}
+		return
+	})
+
+	rpc.Handle(MethodNewAuthorizations, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var ar authorizationsRequest
+		if err = json.Unmarshal(req, &ar); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodNewAuthorizations, err, req)
+			return
+		}
+
+		authzs, err := impl.NewAuthorizations(ctx, ar.Authzs, ar.RegID)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(authzs)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(ctx, MethodNewAuthorizations, err, req)
 			return
 		}
 		return
 	})
 
-	rpc.Handle(MethodNewCertificate, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodNewCertificate, func(ctx context.Context, req []byte) (response []byte, err error) {
 		log.Info(fmt.Sprintf(" [.] Entering MethodNewCertificate"))
 		var cr certificateRequest
 		if err = json.Unmarshal(req, &cr); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodNewCertificate, err, req)
+			improperMessage(ctx, MethodNewCertificate, err, req)
 			return
 		}
 		log.Info(fmt.Sprintf(" [.] No problem unmarshaling request"))
 
-		cert, err := impl.NewCertificate(cr.Req, cr.RegID)
+		cert, err := impl.NewCertificate(ctx, cr.Req, cr.RegID)
 		if err != nil {
 			return
 		}
@@ -249,22 +396,44 @@ func NewRegistrationAuthorityServer(rpc Server, impl core.RegistrationAuthority)
 		response, err = json.Marshal(cert)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodNewCertificate, err, req)
+			errorCondition(ctx, MethodNewCertificate, err, req)
+			return
+		}
+		return
+	})
+
+	rpc.Handle(MethodNewCertificateOrder, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var cr certificateRequest
+		if err = json.Unmarshal(req, &cr); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodNewCertificateOrder, err, req)
+			return
+		}
+
+		order, err := impl.NewCertificateOrder(ctx, cr.Req, cr.RegID)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(order)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(ctx, MethodNewCertificateOrder, err, req)
 			return
 		}
 		return
 	})
 
-	rpc.Handle(MethodUpdateRegistration, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodUpdateRegistration, func(ctx context.Context, req []byte) (response []byte, err error) {
 		var urReq updateRegistrationRequest
 		err = json.Unmarshal(req, &urReq)
 		if err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodUpdateRegistration, err, req)
+			improperMessage(ctx, MethodUpdateRegistration, err, req)
 			return
 		}
 
-		reg, err := impl.UpdateRegistration(urReq.Base, urReq.Update)
+		reg, err := impl.UpdateRegistration(ctx, urReq.Base, urReq.Update)
 		if err != nil {
 			return
 		}
@@ -272,22 +441,22 @@ func NewRegistrationAuthorityServer(rpc Server, impl core.RegistrationAuthority)
 		response, err = json.Marshal(reg)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodUpdateRegistration, err, req)
+			errorCondition(ctx, MethodUpdateRegistration, err, req)
 			return
 		}
 		return
 	})
 
-	rpc.Handle(MethodUpdateAuthorization, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodUpdateAuthorization, func(ctx context.Context, req []byte) (response []byte, err error) {
 		var uaReq updateAuthorizationRequest
 		err = json.Unmarshal(req, &uaReq)
 		if err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodUpdateAuthorization, err, req)
+			improperMessage(ctx, MethodUpdateAuthorization, err, req)
 			return
 		}
 
-		newAuthz, err := impl.UpdateAuthorization(uaReq.Authz, uaReq.Index, uaReq.Response)
+		newAuthz, err := impl.UpdateAuthorization(ctx, uaReq.Authz, uaReq.Index, uaReq.Response)
 		if err != nil {
 			return
 		}
@@ -295,13 +464,13 @@ func NewRegistrationAuthorityServer(rpc Server, impl core.RegistrationAuthority)
 		response, err = json.Marshal(newAuthz)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodUpdateAuthorization, err, req)
+			errorCondition(ctx, MethodUpdateAuthorization, err, req)
 			return
 		}
 		return
 	})
 
-	rpc.Handle(MethodRevokeCertificateWithReg, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodRevokeCertificateWithReg, func(ctx context.Context, req []byte) (response []byte, err error) {
 		var revReq struct {
 			Cert   []byte
 			Reason core.RevocationCode
@@ -309,7 +478,7 @@ func NewRegistrationAuthorityServer(rpc Server, impl core.RegistrationAuthority)
 		}
 		if err = json.Unmarshal(req, &revReq); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodRevokeCertificateWithReg, err, req)
+			improperMessage(ctx, MethodRevokeCertificateWithReg, err, req)
 			return
 		}
 		cert, err := x509.ParseCertificate(revReq.Cert)
@@ -318,11 +487,11 @@ func NewRegistrationAuthorityServer(rpc Server, impl core.RegistrationAuthority)
 			return
 		}
 
-		err = impl.RevokeCertificateWithReg(*cert, revReq.Reason, revReq.RegID)
+		err = impl.RevokeCertificateWithReg(ctx, *cert, revReq.Reason, revReq.RegID)
 		return
 	})
 
-	rpc.Handle(MethodAdministrativelyRevokeCertificate, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodAdministrativelyRevokeCertificate, func(ctx context.Context, req []byte) (response []byte, err error) {
 		var revReq struct {
 			Cert   []byte
 			Reason core.RevocationCode
@@ -330,7 +499,7 @@ func NewRegistrationAuthorityServer(rpc Server, impl core.RegistrationAuthority)
 		}
 		if err = json.Unmarshal(req, &revReq); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodAdministrativelyRevokeCertificate, err, req)
+			improperMessage(ctx, MethodAdministrativelyRevokeCertificate, err, req)
 			return
 		}
 		cert, err := x509.ParseCertificate(revReq.Cert)
@@ -339,19 +508,150 @@ func NewRegistrationAuthorityServer(rpc Server, impl core.RegistrationAuthority)
 			return
 		}
 
-		err = impl.AdministrativelyRevokeCertificate(*cert, revReq.Reason, revReq.User)
+		err = impl.AdministrativelyRevokeCertificate(ctx, *cert, revReq.Reason, revReq.User)
+		return
+	})
+
+	rpc.Handle(MethodAdministrativelyReleaseCertificateHold, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var releaseReq struct {
+			Cert []byte
+			User string
+		}
+		if err = json.Unmarshal(req, &releaseReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodAdministrativelyReleaseCertificateHold, err, req)
+			return
+		}
+		cert, err := x509.ParseCertificate(releaseReq.Cert)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			return
+		}
+
+		err = impl.AdministrativelyReleaseCertificateHold(ctx, *cert, releaseReq.User)
+		return
+	})
+
+	rpc.Handle(MethodAdministrativelyRevokeCertificatesByKey, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var revokeReq revokeByKeyRequest
+		if err = json.Unmarshal(req, &revokeReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodAdministrativelyRevokeCertificatesByKey, err, req)
+			return
+		}
+
+		err = impl.AdministrativelyRevokeCertificatesByKey(ctx, revokeReq.KeyHash, revokeReq.User)
+		return
+	})
+
+	rpc.Handle(MethodAdministrativelyBlockKey, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var blockReq revokeByKeyRequest
+		if err = json.Unmarshal(req, &blockReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodAdministrativelyBlockKey, err, req)
+			return
+		}
+
+		err = impl.AdministrativelyBlockKey(ctx, blockReq.KeyHash, blockReq.User)
+		return
+	})
+
+	rpc.Handle(MethodAdministrativelyDenyNames, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var denyReq struct {
+			Names []string
+			User  string
+		}
+		if err = json.Unmarshal(req, &denyReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodAdministrativelyDenyNames, err, req)
+			return
+		}
+
+		err = impl.AdministrativelyDenyNames(ctx, denyReq.Names, denyReq.User)
+		return
+	})
+
+	rpc.Handle(MethodAdministrativelySetAccountTier, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var tierReq setAccountTierRequest
+		if err = json.Unmarshal(req, &tierReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodAdministrativelySetAccountTier, err, req)
+			return
+		}
+
+		err = impl.AdministrativelySetAccountTier(ctx, tierReq.RegID, tierReq.Tier, tierReq.User)
+		return
+	})
+
+	rpc.Handle(MethodAdministrativelySetRateLimitOverride, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var overrideReq setRateLimitOverrideRequest
+		if err = json.Unmarshal(req, &overrideReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodAdministrativelySetRateLimitOverride, err, req)
+			return
+		}
+
+		err = impl.AdministrativelySetRateLimitOverride(ctx, overrideReq.Override, overrideReq.User)
+		return
+	})
+
+	rpc.Handle(MethodAdministrativelyRemoveRateLimitOverride, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var removeReq removeRateLimitOverrideRequest
+		if err = json.Unmarshal(req, &removeReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodAdministrativelyRemoveRateLimitOverride, err, req)
+			return
+		}
+
+		err = impl.AdministrativelyRemoveRateLimitOverride(ctx, removeReq.Limit, removeReq.Key, removeReq.RegID, removeReq.User)
+		return
+	})
+
+	rpc.Handle(MethodAdministrativelyReviewAuthorization, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var reviewReq reviewAuthorizationRequest
+		if err = json.Unmarshal(req, &reviewReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodAdministrativelyReviewAuthorization, err, req)
+			return
+		}
+
+		err = impl.AdministrativelyReviewAuthorization(ctx, reviewReq.ID, reviewReq.Approve, reviewReq.User)
+		return
+	})
+
+	rpc.Handle(MethodOnValidationUpdate, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var authz core.Authorization
+		if err = json.Unmarshal(req, &authz); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodOnValidationUpdate, err, req)
+			return
+		}
+
+		err = impl.OnValidationUpdate(ctx, authz)
 		return
 	})
 
-	rpc.Handle(MethodOnValidationUpdate, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodDeactivateAuthorization, func(ctx context.Context, req []byte) (response []byte, err error) {
 		var authz core.Authorization
 		if err = json.Unmarshal(req, &authz); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodOnValidationUpdate, err, req)
+			improperMessage(ctx, MethodDeactivateAuthorization, err, req)
+			return
+		}
+
+		err = impl.DeactivateAuthorization(ctx, authz)
+		return
+	})
+
+	rpc.Handle(MethodVerifyContact, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var vcReq verifyContactRequest
+		if err = json.Unmarshal(req, &vcReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodVerifyContact, err, req)
 			return
 		}
 
-		err = impl.OnValidationUpdate(authz)
+		err = impl.VerifyContact(ctx, vcReq.RegID, vcReq.Contact)
 		return
 	})
 
@@ -370,13 +670,13 @@ func NewRegistrationAuthorityClient(clientName string, amqpConf *cmd.AMQPConfig,
 }
 
 // NewRegistration sends a New Registration request
-func (rac RegistrationAuthorityClient) NewRegistration(reg core.Registration) (newReg core.Registration, err error) {
+func (rac RegistrationAuthorityClient) NewRegistration(ctx context.Context, reg core.Registration) (newReg core.Registration, err error) {
 	data, err := json.Marshal(registrationRequest{reg})
 	if err != nil {
 		return
 	}
 
-	newRegData, err := rac.rpc.DispatchSync(MethodNewRegistration, data)
+	newRegData, err := rac.rpc.DispatchSync(ctx, MethodNewRegistration, data)
 	if err != nil {
 		return
 	}
@@ -386,13 +686,13 @@ func (rac RegistrationAuthorityClient) NewRegistration(reg core.Registration) (n
 }
 
 // NewAuthorization sends a New Authorization request
-func (rac RegistrationAuthorityClient) NewAuthorization(authz core.Authorization, regID int64) (newAuthz core.Authorization, err error) {
+func (rac RegistrationAuthorityClient) NewAuthorization(ctx context.Context, authz core.Authorization, regID int64) (newAuthz core.Authorization, err error) {
 	data, err := json.Marshal(authorizationRequest{authz, regID})
 	if err != nil {
 		return
 	}
 
-	newAuthzData, err := rac.rpc.DispatchSync(MethodNewAuthorization, data)
+	newAuthzData, err := rac.rpc.DispatchSync(ctx, MethodNewAuthorization, data)
 	if err != nil {
 		return
 	}
@@ -401,14 +701,30 @@ func (rac RegistrationAuthorityClient) NewAuthorization(authz core.Authorization
 	return
 }
 
+// NewAuthorizations sends a request for several new Authorizations
+func (rac RegistrationAuthorityClient) NewAuthorizations(ctx context.Context, authzs []core.Authorization, regID int64) (newAuthzs []core.Authorization, err error) {
+	data, err := json.Marshal(authorizationsRequest{authzs, regID})
+	if err != nil {
+		return
+	}
+
+	newAuthzsData, err := rac.rpc.DispatchSync(ctx, MethodNewAuthorizations, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(newAuthzsData, &newAuthzs)
+	return
+}
+
 // NewCertificate sends a New Certificate request
-func (rac RegistrationAuthorityClient) NewCertificate(cr core.CertificateRequest, regID int64) (cert core.Certificate, err error) {
+func (rac RegistrationAuthorityClient) NewCertificate(ctx context.Context, cr core.CertificateRequest, regID int64) (cert core.Certificate, err error) {
 	data, err := json.Marshal(certificateRequest{cr, regID})
 	if err != nil {
 		return
 	}
 
-	certData, err := rac.rpc.DispatchSync(MethodNewCertificate, data)
+	certData, err := rac.rpc.DispatchSync(ctx, MethodNewCertificate, data)
 	if err != nil {
 		return
 	}
@@ -417,8 +733,25 @@ func (rac RegistrationAuthorityClient) NewCertificate(cr core.CertificateRequest
 	return
 }
 
+// NewCertificateOrder sends a request for a certificate to be issued in the
+// background
+func (rac RegistrationAuthorityClient) NewCertificateOrder(ctx context.Context, cr core.CertificateRequest, regID int64) (order core.CertificateOrder, err error) {
+	data, err := json.Marshal(certificateRequest{cr, regID})
+	if err != nil {
+		return
+	}
+
+	orderData, err := rac.rpc.DispatchSync(ctx, MethodNewCertificateOrder, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(orderData, &order)
+	return
+}
+
 // UpdateRegistration sends an Update Registration request
-func (rac RegistrationAuthorityClient) UpdateRegistration(base core.Registration, update core.Registration) (newReg core.Registration, err error) {
+func (rac RegistrationAuthorityClient) UpdateRegistration(ctx context.Context, base core.Registration, update core.Registration) (newReg core.Registration, err error) {
 	var urReq updateRegistrationRequest
 	urReq.Base = base
 	urReq.Update = update
@@ -428,7 +761,7 @@ func (rac RegistrationAuthorityClient) UpdateRegistration(base core.Registration
 		return
 	}
 
-	newRegData, err := rac.rpc.DispatchSync(MethodUpdateRegistration, data)
+	newRegData, err := rac.rpc.DispatchSync(ctx, MethodUpdateRegistration, data)
 	if err != nil {
 		return
 	}
@@ -438,7 +771,7 @@ func (rac RegistrationAuthorityClient) UpdateRegistration(base core.Registration
 }
 
 // UpdateAuthorization sends an Update Authorization request
-func (rac RegistrationAuthorityClient) UpdateAuthorization(authz core.Authorization, index int, response core.Challenge) (newAuthz core.Authorization, err error) {
+func (rac RegistrationAuthorityClient) UpdateAuthorization(ctx context.Context, authz core.Authorization, index int, response core.Challenge) (newAuthz core.Authorization, err error) {
 	var uaReq updateAuthorizationRequest
 	uaReq.Authz = authz
 	uaReq.Index = index
@@ -449,7 +782,7 @@ func (rac RegistrationAuthorityClient) UpdateAuthorization(authz core.Authorizat
 		return
 	}
 
-	newAuthzData, err := rac.rpc.DispatchSync(MethodUpdateAuthorization, data)
+	newAuthzData, err := rac.rpc.DispatchSync(ctx, MethodUpdateAuthorization, data)
 	if err != nil {
 		return
 	}
@@ -460,7 +793,7 @@ func (rac RegistrationAuthorityClient) UpdateAuthorization(authz core.Authorizat
 
 // RevokeCertificateWithReg sends a Revoke Certificate request initiated by the
 // WFE
-func (rac RegistrationAuthorityClient) RevokeCertificateWithReg(cert x509.Certificate, reason core.RevocationCode, regID int64) (err error) {
+func (rac RegistrationAuthorityClient) RevokeCertificateWithReg(ctx context.Context, cert x509.Certificate, reason core.RevocationCode, regID int64) (err error) {
 	var revReq struct {
 		Cert   []byte
 		Reason core.RevocationCode
@@ -473,13 +806,13 @@ func (rac RegistrationAuthorityClient) RevokeCertificateWithReg(cert x509.Certif
 	if err != nil {
 		return
 	}
-	_, err = rac.rpc.DispatchSync(MethodRevokeCertificateWithReg, data)
+	_, err = rac.rpc.DispatchSync(ctx, MethodRevokeCertificateWithReg, data)
 	return
 }
 
 // AdministrativelyRevokeCertificate sends a Revoke Certificate request initiated by the
 // admin-revoker
-func (rac RegistrationAuthorityClient) AdministrativelyRevokeCertificate(cert x509.Certificate, reason core.RevocationCode, user string) (err error) {
+func (rac RegistrationAuthorityClient) AdministrativelyRevokeCertificate(ctx context.Context, cert x509.Certificate, reason core.RevocationCode, user string) (err error) {
 	var revReq struct {
 		Cert   []byte
 		Reason core.RevocationCode
@@ -492,18 +825,170 @@ func (rac RegistrationAuthorityClient) AdministrativelyRevokeCertificate(cert x5
 	if err != nil {
 		return
 	}
-	_, err = rac.rpc.DispatchSync(MethodAdministrativelyRevokeCertificate, data)
+	_, err = rac.rpc.DispatchSync(ctx, MethodAdministrativelyRevokeCertificate, data)
+	return
+}
+
+// AdministrativelyReleaseCertificateHold sends a request initiated by the
+// admin-revoker to release a certificate from certificateHold
+func (rac RegistrationAuthorityClient) AdministrativelyReleaseCertificateHold(ctx context.Context, cert x509.Certificate, user string) (err error) {
+	var releaseReq struct {
+		Cert []byte
+		User string
+	}
+	releaseReq.Cert = cert.Raw
+	releaseReq.User = user
+	data, err := json.Marshal(releaseReq)
+	if err != nil {
+		return
+	}
+	_, err = rac.rpc.DispatchSync(ctx, MethodAdministrativelyReleaseCertificateHold, data)
+	return
+}
+
+type revokeByKeyRequest struct {
+	KeyHash string
+	User    string
+}
+
+// AdministrativelyRevokeCertificatesByKey sends a request initiated by the
+// admin-revoker to revoke every certificate for a compromised key and block
+// the key
+func (rac RegistrationAuthorityClient) AdministrativelyRevokeCertificatesByKey(ctx context.Context, keyHash string, user string) (err error) {
+	data, err := json.Marshal(revokeByKeyRequest{KeyHash: keyHash, User: user})
+	if err != nil {
+		return
+	}
+	_, err = rac.rpc.DispatchSync(ctx, MethodAdministrativelyRevokeCertificatesByKey, data)
+	return
+}
+
+// AdministrativelyBlockKey sends a request initiated by the admin-revoker
+// to block a key from future registrations and certificates
+func (rac RegistrationAuthorityClient) AdministrativelyBlockKey(ctx context.Context, keyHash string, user string) (err error) {
+	data, err := json.Marshal(revokeByKeyRequest{KeyHash: keyHash, User: user})
+	if err != nil {
+		return
+	}
+	_, err = rac.rpc.DispatchSync(ctx, MethodAdministrativelyBlockKey, data)
+	return
+}
+
+// AdministrativelyDenyNames sends a request initiated by the admin-revoker
+// to deny future issuance for a set of names
+func (rac RegistrationAuthorityClient) AdministrativelyDenyNames(ctx context.Context, names []string, user string) (err error) {
+	var denyReq struct {
+		Names []string
+		User  string
+	}
+	denyReq.Names = names
+	denyReq.User = user
+	data, err := json.Marshal(denyReq)
+	if err != nil {
+		return
+	}
+	_, err = rac.rpc.DispatchSync(ctx, MethodAdministrativelyDenyNames, data)
+	return
+}
+
+type setAccountTierRequest struct {
+	RegID int64
+	Tier  core.AccountTier
+	User  string
+}
+
+// AdministrativelySetAccountTier sends a request initiated by the
+// admin-revoker to put a registration in an account tier
+func (rac RegistrationAuthorityClient) AdministrativelySetAccountTier(ctx context.Context, regID int64, tier core.AccountTier, user string) (err error) {
+	data, err := json.Marshal(setAccountTierRequest{RegID: regID, Tier: tier, User: user})
+	if err != nil {
+		return
+	}
+	_, err = rac.rpc.DispatchSync(ctx, MethodAdministrativelySetAccountTier, data)
+	return
+}
+
+type setRateLimitOverrideRequest struct {
+	Override core.RateLimitOverride
+	User     string
+}
+
+// AdministrativelySetRateLimitOverride sends a request initiated by the
+// admin-revoker to set a rate limit override
+func (rac RegistrationAuthorityClient) AdministrativelySetRateLimitOverride(ctx context.Context, override core.RateLimitOverride, user string) (err error) {
+	data, err := json.Marshal(setRateLimitOverrideRequest{Override: override, User: user})
+	if err != nil {
+		return
+	}
+	_, err = rac.rpc.DispatchSync(ctx, MethodAdministrativelySetRateLimitOverride, data)
+	return
+}
+
+type removeRateLimitOverrideRequest struct {
+	Limit string
+	Key   string
+	RegID int64
+	User  string
+}
+
+// AdministrativelyRemoveRateLimitOverride sends a request initiated by the
+// admin-revoker to remove a rate limit override
+func (rac RegistrationAuthorityClient) AdministrativelyRemoveRateLimitOverride(ctx context.Context, limit, key string, regID int64, user string) (err error) {
+	data, err := json.Marshal(removeRateLimitOverrideRequest{Limit: limit, Key: key, RegID: regID, User: user})
+	if err != nil {
+		return
+	}
+	_, err = rac.rpc.DispatchSync(ctx, MethodAdministrativelyRemoveRateLimitOverride, data)
+	return
+}
+
+type reviewAuthorizationRequest struct {
+	ID      string
+	Approve bool
+	User    string
+}
+
+// AdministrativelyReviewAuthorization sends a request initiated by the
+// admin-revoker to approve or reject an authorization held for review
+func (rac RegistrationAuthorityClient) AdministrativelyReviewAuthorization(ctx context.Context, authzID string, approve bool, user string) (err error) {
+	data, err := json.Marshal(reviewAuthorizationRequest{ID: authzID, Approve: approve, User: user})
+	if err != nil {
+		return
+	}
+	_, err = rac.rpc.DispatchSync(ctx, MethodAdministrativelyReviewAuthorization, data)
 	return
 }
 
 // OnValidationUpdate senda a notice that a validation has updated
-func (rac RegistrationAuthorityClient) OnValidationUpdate(authz core.Authorization) (err error) {
+func (rac RegistrationAuthorityClient) OnValidationUpdate(ctx context.Context, authz core.Authorization) (err error) {
+	data, err := json.Marshal(authz)
+	if err != nil {
+		return
+	}
+
+	_, err = rac.rpc.DispatchSync(ctx, MethodOnValidationUpdate, data)
+	return
+}
+
+// DeactivateAuthorization sends a request to deactivate an authorization
+func (rac RegistrationAuthorityClient) DeactivateAuthorization(ctx context.Context, authz core.Authorization) (err error) {
 	data, err := json.Marshal(authz)
 	if err != nil {
 		return
 	}
 
-	_, err = rac.rpc.DispatchSync(MethodOnValidationUpdate, data)
+	_, err = rac.rpc.DispatchSync(ctx, MethodDeactivateAuthorization, data)
+	return
+}
+
+// VerifyContact sends a request to mark a registration's contact as verified
+func (rac RegistrationAuthorityClient) VerifyContact(ctx context.Context, regID int64, contact string) (err error) {
+	data, err := json.Marshal(verifyContactRequest{RegID: regID, Contact: contact})
+	if err != nil {
+		return
+	}
+
+	_, err = rac.rpc.DispatchSync(ctx, MethodVerifyContact, data)
 	return
 }
 
@@ -512,27 +997,27 @@ func (rac RegistrationAuthorityClient) OnValidationUpdate(authz core.Authorizati
 // ValidationAuthorityClient / Server
 //  -> UpdateValidations
 func NewValidationAuthorityServer(rpc Server, impl core.ValidationAuthority) (err error) {
-	rpc.Handle(MethodUpdateValidations, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodUpdateValidations, func(ctx context.Context, req []byte) (response []byte, err error) {
 		var vaReq validationRequest
 		if err = json.Unmarshal(req, &vaReq); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodUpdateValidations, err, req)
+			improperMessage(ctx, MethodUpdateValidations, err, req)
 			return
 		}
 
-		err = impl.UpdateValidations(vaReq.Authz, vaReq.Index)
+		err = impl.UpdateValidations(ctx, vaReq.Authz, vaReq.Index)
 		return
 	})
 
-	rpc.Handle(MethodCheckCAARecords, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodCheckCAARecords, func(ctx context.Context, req []byte) (response []byte, err error) {
 		var caaReq caaRequest
 		if err = json.Unmarshal(req, &caaReq); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodCheckCAARecords, err, req)
+			improperMessage(ctx, MethodCheckCAARecords, err, req)
 			return
 		}
 
-		present, valid, err := impl.CheckCAARecords(caaReq.Ident)
+		present, valid, err := impl.CheckCAARecords(ctx, caaReq.Ident, caaReq.RegID, caaReq.ChallengeType)
 		if err != nil {
 			return
 		}
@@ -544,20 +1029,20 @@ func NewValidationAuthorityServer(rpc Server, impl core.ValidationAuthority) (er
 		response, err = json.Marshal(caaResp)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodCheckCAARecords, err, caaReq)
+			errorCondition(ctx, MethodCheckCAARecords, err, caaReq)
 			return
 		}
 		return
 	})
 
-	rpc.Handle(MethodIsSafeDomain, func(req []byte) ([]byte, error) {
+	rpc.Handle(MethodIsSafeDomain, func(ctx context.Context, req []byte) ([]byte, error) {
 		r := &core.IsSafeDomainRequest{}
 		if err := json.Unmarshal(req, r); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodIsSafeDomain, err, req)
+			improperMessage(ctx, MethodIsSafeDomain, err, req)
 			return nil, err
 		}
-		resp, err := impl.IsSafeDomain(r)
+		resp, err := impl.IsSafeDomain(ctx, r)
 		if err != nil {
 			return nil, err
 		}
@@ -583,7 +1068,7 @@ func NewValidationAuthorityClient(clientName string, amqpConf *cmd.AMQPConfig, s
 }
 
 // UpdateValidations sends an Update Validations request
-func (vac ValidationAuthorityClient) UpdateValidations(authz core.Authorization, index int) error {
+func (vac ValidationAuthorityClient) UpdateValidations(ctx context.Context, authz core.Authorization, index int) error {
 	vaReq := validationRequest{
 		Authz: authz,
 		Index: index,
@@ -593,20 +1078,23 @@ func (vac ValidationAuthorityClient) UpdateValidations(authz core.Authorization,
 		return err
 	}
 
-	_, err = vac.rpc.DispatchSync(MethodUpdateValidations, data)
+	_, err = vac.rpc.DispatchSync(ctx, MethodUpdateValidations, data)
 	return nil
 }
 
 // CheckCAARecords sends a request to check CAA records
-func (vac ValidationAuthorityClient) CheckCAARecords(ident core.AcmeIdentifier) (present bool, valid bool, err error) {
-	var caaReq caaRequest
-	caaReq.Ident = ident
+func (vac ValidationAuthorityClient) CheckCAARecords(ctx context.Context, ident identifier.ACMEIdentifier, regID int64, challengeType string) (present bool, valid bool, err error) {
+	caaReq := caaRequest{
+		Ident:         ident,
+		RegID:         regID,
+		ChallengeType: challengeType,
+	}
 	data, err := json.Marshal(caaReq)
 	if err != nil {
 		return
 	}
 
-	jsonResp, err := vac.rpc.DispatchSync(MethodCheckCAARecords, data)
+	jsonResp, err := vac.rpc.DispatchSync(ctx, MethodCheckCAARecords, data)
 	if err != nil {
 		return
 	}
@@ -624,12 +1112,12 @@ func (vac ValidationAuthorityClient) CheckCAARecords(ident core.AcmeIdentifier)
 
 // IsSafeDomain returns true if the domain given is determined to be safe by an
 // third-party safe browsing API.
-func (vac ValidationAuthorityClient) IsSafeDomain(req *core.IsSafeDomainRequest) (*core.IsSafeDomainResponse, error) {
+func (vac ValidationAuthorityClient) IsSafeDomain(ctx context.Context, req *core.IsSafeDomainRequest) (*core.IsSafeDomainResponse, error) {
 	data, err := json.Marshal(req)
 	if err != nil {
 		return nil, err
 	}
-	jsonResp, err := vac.rpc.DispatchSync(MethodIsSafeDomain, data)
+	jsonResp, err := vac.rpc.DispatchSync(ctx, MethodIsSafeDomain, data)
 	if err != nil {
 		return nil, err
 	}
@@ -641,14 +1129,77 @@ func (vac ValidationAuthorityClient) IsSafeDomain(req *core.IsSafeDomainRequest)
 	return resp, nil
 }
 
-// NewPublisherServer creates a new server that wraps a CT publisher
-func NewPublisherServer(rpc Server, impl core.Publisher) (err error) {
-	rpc.Handle(MethodSubmitToCT, func(req []byte) (response []byte, err error) {
-		err = impl.SubmitToCT(req)
-		return
-	})
-
-	return nil
+// NewRemoteVAServer constructs an RPC server that lets a primary VA run
+// validations from this VA's network perspective.
+func NewRemoteVAServer(rpc Server, impl core.RemoteValidator) error {
+	rpc.Handle(MethodPerformValidation, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var pvReq core.PerformValidationRequest
+		if err = json.Unmarshal(req, &pvReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodPerformValidation, err, req)
+			return
+		}
+
+		pvResp, err := impl.PerformValidation(ctx, &pvReq)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(pvResp)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(ctx, MethodPerformValidation, err, pvReq)
+			return
+		}
+		return
+	})
+
+	return nil
+}
+
+// RemoteVAClient is a client to run validations on a VA in another network
+type RemoteVAClient struct {
+	rpc Client
+}
+
+// NewRemoteVAClient constructs an RPC client for the remote VA listening on
+// the given queue
+func NewRemoteVAClient(clientName string, amqpConf *cmd.AMQPConfig, remoteConf *cmd.RPCServerConfig, stats statsd.Statter) (*RemoteVAClient, error) {
+	client, err := NewAmqpRPCClient(clientName+"->RemoteVA", amqpConf, remoteConf, stats)
+	return &RemoteVAClient{rpc: client}, err
+}
+
+// PerformValidation sends a request to validate a challenge and check CAA
+func (rvc RemoteVAClient) PerformValidation(ctx context.Context, req *core.PerformValidationRequest) (*core.PerformValidationResponse, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	jsonResp, err := rvc.rpc.DispatchSync(ctx, MethodPerformValidation, data)
+	if err != nil {
+		return nil, err
+	}
+	resp := &core.PerformValidationResponse{}
+	err = json.Unmarshal(jsonResp, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// NewPublisherServer creates a new server that wraps a CT publisher
+func NewPublisherServer(rpc Server, impl core.Publisher) (err error) {
+	rpc.Handle(MethodSubmitToCT, func(ctx context.Context, req []byte) (response []byte, err error) {
+		err = impl.SubmitToCT(ctx, req)
+		return
+	})
+
+	rpc.Handle(MethodCheckCTInclusion, func(ctx context.Context, req []byte) (response []byte, err error) {
+		err = impl.CheckCTInclusion(ctx, req)
+		return
+	})
+
+	return nil
 }
 
 // PublisherClient is a client to communicate with the Publisher Authority
@@ -663,8 +1214,76 @@ func NewPublisherClient(clientName string, amqpConf *cmd.AMQPConfig, stats stats
 }
 
 // SubmitToCT sends a request to submit a certifcate to CT logs
-func (pub PublisherClient) SubmitToCT(der []byte) (err error) {
-	_, err = pub.rpc.DispatchSync(MethodSubmitToCT, der)
+func (pub PublisherClient) SubmitToCT(ctx context.Context, der []byte) (err error) {
+	_, err = pub.rpc.DispatchSync(ctx, MethodSubmitToCT, der)
+	return
+}
+
+// CheckCTInclusion sends a request to check that the CT logs that issued
+// SCTs for a certificate include it
+func (pub PublisherClient) CheckCTInclusion(ctx context.Context, der []byte) (err error) {
+	_, err = pub.rpc.DispatchSync(ctx, MethodCheckCTInclusion, der)
+	return
+}
+
+// NewNonceServer constructs an RPC server that lets peer WFE instances
+// redeem nonces issued by this one.
+func NewNonceServer(rpc Server, impl core.NonceRedeemer) error {
+	rpc.Handle(MethodRedeemNonce, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var rnReq redeemNonceRequest
+		if err = json.Unmarshal(req, &rnReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodRedeemNonce, err, req)
+			return
+		}
+
+		valid, err := impl.Redeem(rnReq.Nonce)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(redeemNonceResponse{Valid: valid})
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(ctx, MethodRedeemNonce, err, req)
+			return
+		}
+		return
+	})
+
+	return nil
+}
+
+// NonceClient is a client to redeem nonces issued by a peer WFE instance
+type NonceClient struct {
+	rpc Client
+}
+
+// NewNonceClient constructs an RPC client for the peer WFE listening on the
+// given queue
+func NewNonceClient(clientName string, amqpConf *cmd.AMQPConfig, peerConf *cmd.RPCServerConfig, stats statsd.Statter) (*NonceClient, error) {
+	client, err := NewAmqpRPCClient(clientName+"->Nonce", amqpConf, peerConf, stats)
+	return &NonceClient{rpc: client}, err
+}
+
+// Redeem sends a request to check and consume a nonce issued by the peer
+func (nc NonceClient) Redeem(nonce string) (valid bool, err error) {
+	data, err := json.Marshal(redeemNonceRequest{Nonce: nonce})
+	if err != nil {
+		return
+	}
+
+	jsonResp, err := nc.rpc.DispatchSync(context.Background(), MethodRedeemNonce, data)
+	if err != nil {
+		return
+	}
+
+	var rnResp redeemNonceResponse
+	err = json.Unmarshal(jsonResp, &rnResp)
+	if err != nil {
+		return
+	}
+	valid = rnResp.Valid
 	return
 }
 
@@ -673,23 +1292,23 @@ func (pub PublisherClient) SubmitToCT(der []byte) (err error) {
 // CertificateAuthorityClient / Server
 //  -> IssueCertificate
 func NewCertificateAuthorityServer(rpc Server, impl core.CertificateAuthority) (err error) {
-	rpc.Handle(MethodIssueCertificate, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodIssueCertificate, func(ctx context.Context, req []byte) (response []byte, err error) {
 		var icReq issueCertificateRequest
 		err = json.Unmarshal(req, &icReq)
 		if err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodIssueCertificate, err, req)
+			improperMessage(ctx, MethodIssueCertificate, err, req)
 			return
 		}
 
 		csr, err := x509.ParseCertificateRequest(icReq.Bytes)
 		if err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodIssueCertificate, err, req)
+			improperMessage(ctx, MethodIssueCertificate, err, req)
 			return
 		}
 
-		cert, err := impl.IssueCertificate(*csr, icReq.RegID)
+		cert, err := impl.IssueCertificate(ctx, *csr, icReq.RegID, icReq.Profile, icReq.Validity)
 		if err != nil {
 			return
 		}
@@ -697,36 +1316,36 @@ func NewCertificateAuthorityServer(rpc Server, impl core.CertificateAuthority) (
 		response, err = json.Marshal(cert)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodGetRegistration, err, req)
+			errorCondition(ctx, MethodGetRegistration, err, req)
 			return
 		}
 
 		return
 	})
 
-	rpc.Handle(MethodRevokeCertificate, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodRevokeCertificate, func(ctx context.Context, req []byte) (response []byte, err error) {
 		var revokeReq revokeCertificateRequest
 		err = json.Unmarshal(req, &revokeReq)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodRevokeCertificate, err, req)
+			errorCondition(ctx, MethodRevokeCertificate, err, req)
 			return
 		}
 
-		err = impl.RevokeCertificate(revokeReq.Serial, revokeReq.ReasonCode)
+		err = impl.RevokeCertificate(ctx, revokeReq.Serial, revokeReq.ReasonCode)
 		return
 	})
 
-	rpc.Handle(MethodGenerateOCSP, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodGenerateOCSP, func(ctx context.Context, req []byte) (response []byte, err error) {
 		var xferObj core.OCSPSigningRequest
 		err = json.Unmarshal(req, &xferObj)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodGenerateOCSP, err, req)
+			errorCondition(ctx, MethodGenerateOCSP, err, req)
 			return
 		}
 
-		response, err = impl.GenerateOCSP(xferObj)
+		response, err = impl.GenerateOCSP(ctx, xferObj)
 		if err != nil {
 			return
 		}
@@ -749,16 +1368,18 @@ func NewCertificateAuthorityClient(clientName string, amqpConf *cmd.AMQPConfig,
 }
 
 // IssueCertificate sends a request to issue a certificate
-func (cac CertificateAuthorityClient) IssueCertificate(csr x509.CertificateRequest, regID int64) (cert core.Certificate, err error) {
+func (cac CertificateAuthorityClient) IssueCertificate(ctx context.Context, csr x509.CertificateRequest, regID int64, profile string, validity core.Validity) (cert core.Certificate, err error) {
 	var icReq issueCertificateRequest
 	icReq.Bytes = csr.Raw
 	icReq.RegID = regID
+	icReq.Profile = profile
+	icReq.Validity = validity
 	data, err := json.Marshal(icReq)
 	if err != nil {
 		return
 	}
 
-	jsonResponse, err := cac.rpc.DispatchSync(MethodIssueCertificate, data)
+	jsonResponse, err := cac.rpc.DispatchSync(ctx, MethodIssueCertificate, data)
 	if err != nil {
 		return
 	}
@@ -768,7 +1389,7 @@ func (cac CertificateAuthorityClient) IssueCertificate(csr x509.CertificateReque
 }
 
 // RevokeCertificate sends a request to revoke a certificate
-func (cac CertificateAuthorityClient) RevokeCertificate(serial string, reasonCode core.RevocationCode) (err error) {
+func (cac CertificateAuthorityClient) RevokeCertificate(ctx context.Context, serial string, reasonCode core.RevocationCode) (err error) {
 	var revokeReq revokeCertificateRequest
 	revokeReq.Serial = serial
 	revokeReq.ReasonCode = reasonCode
@@ -776,24 +1397,24 @@ func (cac CertificateAuthorityClient) RevokeCertificate(serial string, reasonCod
 	data, err := json.Marshal(revokeReq)
 	if err != nil {
 		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-		errorCondition(MethodRevokeCertificate, err, revokeReq)
+		errorCondition(ctx, MethodRevokeCertificate, err, revokeReq)
 		return
 	}
 
-	_, err = cac.rpc.DispatchSync(MethodRevokeCertificate, data)
+	_, err = cac.rpc.DispatchSync(ctx, MethodRevokeCertificate, data)
 	return
 }
 
 // GenerateOCSP sends a request to generate an OCSP response
-func (cac CertificateAuthorityClient) GenerateOCSP(signRequest core.OCSPSigningRequest) (resp []byte, err error) {
+func (cac CertificateAuthorityClient) GenerateOCSP(ctx context.Context, signRequest core.OCSPSigningRequest) (resp []byte, err error) {
 	data, err := json.Marshal(signRequest)
 	if err != nil {
 		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-		errorCondition(MethodGenerateOCSP, err, signRequest)
+		errorCondition(ctx, MethodGenerateOCSP, err, signRequest)
 		return
 	}
 
-	resp, err = cac.rpc.DispatchSync(MethodGenerateOCSP, data)
+	resp, err = cac.rpc.DispatchSync(ctx, MethodGenerateOCSP, data)
 	if err != nil {
 		return
 	}
@@ -806,28 +1427,28 @@ func (cac CertificateAuthorityClient) GenerateOCSP(signRequest core.OCSPSigningR
 
 // NewStorageAuthorityServer constructs an RPC server
 func NewStorageAuthorityServer(rpc Server, impl core.StorageAuthority) error {
-	rpc.Handle(MethodUpdateRegistration, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodUpdateRegistration, func(ctx context.Context, req []byte) (response []byte, err error) {
 		var reg core.Registration
 		if err = json.Unmarshal(req, &reg); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodUpdateRegistration, err, req)
+			improperMessage(ctx, MethodUpdateRegistration, err, req)
 			return
 		}
 
-		err = impl.UpdateRegistration(reg)
+		err = impl.UpdateRegistration(ctx, reg)
 		return
 	})
 
-	rpc.Handle(MethodGetRegistration, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodGetRegistration, func(ctx context.Context, req []byte) (response []byte, err error) {
 		var grReq getRegistrationRequest
 		err = json.Unmarshal(req, &grReq)
 		if err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodGetRegistration, err, req)
+			improperMessage(ctx, MethodGetRegistration, err, req)
 			return
 		}
 
-		reg, err := impl.GetRegistration(grReq.ID)
+		reg, err := impl.GetRegistration(ctx, grReq.ID)
 		if err != nil {
 			return
 		}
@@ -835,21 +1456,21 @@ func NewStorageAuthorityServer(rpc Server, impl core.StorageAuthority) error {
 		response, err = json.Marshal(reg)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodGetRegistration, err, req)
+			errorCondition(ctx, MethodGetRegistration, err, req)
 			return
 		}
 		return
 	})
 
-	rpc.Handle(MethodGetRegistrationByKey, func(req []byte) (response []byte, err error) {
-		var jwk jose.JsonWebKey
+	rpc.Handle(MethodGetRegistrationByKey, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var jwk jose.JSONWebKey
 		if err = json.Unmarshal(req, &jwk); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodGetRegistrationByKey, err, req)
+			improperMessage(ctx, MethodGetRegistrationByKey, err, req)
 			return
 		}
 
-		reg, err := impl.GetRegistrationByKey(jwk)
+		reg, err := impl.GetRegistrationByKey(ctx, jwk)
 		if err != nil {
 			return
 		}
@@ -857,14 +1478,14 @@ func NewStorageAuthorityServer(rpc Server, impl core.StorageAuthority) error {
 		response, err = json.Marshal(reg)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodGetRegistrationByKey, err, req)
+			errorCondition(ctx, MethodGetRegistrationByKey, err, req)
 			return
 		}
 		return
 	})
 
-	rpc.Handle(MethodGetAuthorization, func(req []byte) (response []byte, err error) {
-		authz, err := impl.GetAuthorization(string(req))
+	rpc.Handle(MethodGetAuthorization, func(ctx context.Context, req []byte) (response []byte, err error) {
+		authz, err := impl.GetAuthorization(ctx, string(req))
 		if err != nil {
 			return
 		}
@@ -872,21 +1493,21 @@ func NewStorageAuthorityServer(rpc Server, impl core.StorageAuthority) error {
 		response, err = json.Marshal(authz)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodGetAuthorization, err, req)
+			errorCondition(ctx, MethodGetAuthorization, err, req)
 			return
 		}
 		return
 	})
 
-	rpc.Handle(MethodGetLatestValidAuthorization, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodGetLatestValidAuthorization, func(ctx context.Context, req []byte) (response []byte, err error) {
 		var lvar latestValidAuthorizationRequest
 		if err = json.Unmarshal(req, &lvar); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodNewAuthorization, err, req)
+			improperMessage(ctx, MethodNewAuthorization, err, req)
 			return
 		}
 
-		authz, err := impl.GetLatestValidAuthorization(lvar.RegID, lvar.Identifier)
+		authz, err := impl.GetLatestValidAuthorization(ctx, lvar.RegID, lvar.Identifier)
 		if err != nil {
 			return
 		}
@@ -894,22 +1515,88 @@ func NewStorageAuthorityServer(rpc Server, impl core.StorageAuthority) error {
 		response, err = json.Marshal(authz)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodGetLatestValidAuthorization, err, req)
+			errorCondition(ctx, MethodGetLatestValidAuthorization, err, req)
+			return
+		}
+		return
+	})
+
+	rpc.Handle(MethodGetAuthorizations, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var gaReq getAuthorizationsRequest
+		if err = json.Unmarshal(req, &gaReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodGetAuthorizations, err, req)
+			return
+		}
+
+		authzs, err := impl.GetAuthorizations(ctx, gaReq.RegID, gaReq.Names, gaReq.Now)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(authzs)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(ctx, MethodGetAuthorizations, err, req)
+			return
+		}
+		return
+	})
+
+	rpc.Handle(MethodGetReusableAuthorizations, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var gaReq getAuthorizationsRequest
+		if err = json.Unmarshal(req, &gaReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodGetReusableAuthorizations, err, req)
+			return
+		}
+
+		authzs, err := impl.GetReusableAuthorizations(ctx, gaReq.RegID, gaReq.Names, gaReq.Now)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(authzs)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(ctx, MethodGetReusableAuthorizations, err, req)
+			return
+		}
+		return
+	})
+
+	rpc.Handle(MethodGetCertificatesByRegistration, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var gcReq getCertificatesByRegistrationRequest
+		if err = json.Unmarshal(req, &gcReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodGetCertificatesByRegistration, err, req)
+			return
+		}
+
+		certs, err := impl.GetCertificatesByRegistration(ctx, gcReq.RegID, gcReq.Offset, gcReq.Limit)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(certs)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(ctx, MethodGetCertificatesByRegistration, err, req)
 			return
 		}
 		return
 	})
 
-	rpc.Handle(MethodAddCertificate, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodAddCertificate, func(ctx context.Context, req []byte) (response []byte, err error) {
 		var acReq addCertificateRequest
 		err = json.Unmarshal(req, &acReq)
 		if err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodAddCertificate, err, req)
+			improperMessage(ctx, MethodAddCertificate, err, req)
 			return
 		}
 
-		id, err := impl.AddCertificate(acReq.Bytes, acReq.RegID)
+		id, err := impl.AddCertificate(ctx, acReq.Bytes, acReq.RegID)
 		if err != nil {
 			return
 		}
@@ -917,16 +1604,16 @@ func NewStorageAuthorityServer(rpc Server, impl core.StorageAuthority) error {
 		return
 	})
 
-	rpc.Handle(MethodNewRegistration, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodNewRegistration, func(ctx context.Context, req []byte) (response []byte, err error) {
 		var registration core.Registration
 		err = json.Unmarshal(req, &registration)
 		if err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodNewRegistration, err, req)
+			improperMessage(ctx, MethodNewRegistration, err, req)
 			return
 		}
 
-		output, err := impl.NewRegistration(registration)
+		output, err := impl.NewRegistration(ctx, registration)
 		if err != nil {
 			return
 		}
@@ -934,21 +1621,43 @@ func NewStorageAuthorityServer(rpc Server, impl core.StorageAuthority) error {
 		response, err = json.Marshal(output)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodNewRegistration, err, req)
+			errorCondition(ctx, MethodNewRegistration, err, req)
 			return
 		}
 		return
 	})
 
-	rpc.Handle(MethodNewPendingAuthorization, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodNewPendingAuthorization, func(ctx context.Context, req []byte) (response []byte, err error) {
 		var authz core.Authorization
 		if err = json.Unmarshal(req, &authz); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodNewPendingAuthorization, err, req)
+			improperMessage(ctx, MethodNewPendingAuthorization, err, req)
+			return
+		}
+
+		output, err := impl.NewPendingAuthorization(ctx, authz)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(output)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(ctx, MethodNewPendingAuthorization, err, req)
+			return
+		}
+		return
+	})
+
+	rpc.Handle(MethodNewPendingAuthorizations, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var authzs []core.Authorization
+		if err = json.Unmarshal(req, &authzs); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodNewPendingAuthorizations, err, req)
 			return
 		}
 
-		output, err := impl.NewPendingAuthorization(authz)
+		output, err := impl.NewPendingAuthorizations(ctx, authzs)
 		if err != nil {
 			return
 		}
@@ -956,38 +1665,43 @@ func NewStorageAuthorityServer(rpc Server, impl core.StorageAuthority) error {
 		response, err = json.Marshal(output)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodNewPendingAuthorization, err, req)
+			errorCondition(ctx, MethodNewPendingAuthorizations, err, req)
 			return
 		}
 		return
 	})
 
-	rpc.Handle(MethodUpdatePendingAuthorization, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodUpdatePendingAuthorization, func(ctx context.Context, req []byte) (response []byte, err error) {
 		var authz core.Authorization
 		if err = json.Unmarshal(req, &authz); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodUpdatePendingAuthorization, err, req)
+			improperMessage(ctx, MethodUpdatePendingAuthorization, err, req)
 			return
 		}
 
-		err = impl.UpdatePendingAuthorization(authz)
+		err = impl.UpdatePendingAuthorization(ctx, authz)
 		return
 	})
 
-	rpc.Handle(MethodFinalizeAuthorization, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodFinalizeAuthorization, func(ctx context.Context, req []byte) (response []byte, err error) {
 		var authz core.Authorization
 		if err = json.Unmarshal(req, &authz); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodFinalizeAuthorization, err, req)
+			improperMessage(ctx, MethodFinalizeAuthorization, err, req)
 			return
 		}
 
-		err = impl.FinalizeAuthorization(authz)
+		err = impl.FinalizeAuthorization(ctx, authz)
+		return
+	})
+
+	rpc.Handle(MethodDeactivateAuthorization, func(ctx context.Context, req []byte) (response []byte, err error) {
+		err = impl.DeactivateAuthorization(ctx, string(req))
 		return
 	})
 
-	rpc.Handle(MethodGetCertificate, func(req []byte) (response []byte, err error) {
-		cert, err := impl.GetCertificate(string(req))
+	rpc.Handle(MethodGetCertificate, func(ctx context.Context, req []byte) (response []byte, err error) {
+		cert, err := impl.GetCertificate(ctx, string(req))
 		if err != nil {
 			return
 		}
@@ -995,15 +1709,15 @@ func NewStorageAuthorityServer(rpc Server, impl core.StorageAuthority) error {
 		jsonResponse, err := json.Marshal(cert)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodGetCertificate, err, req)
+			errorCondition(ctx, MethodGetCertificate, err, req)
 			return
 		}
 
 		return jsonResponse, nil
 	})
 
-	rpc.Handle(MethodGetCertificateStatus, func(req []byte) (response []byte, err error) {
-		status, err := impl.GetCertificateStatus(string(req))
+	rpc.Handle(MethodGetCertificateStatus, func(ctx context.Context, req []byte) (response []byte, err error) {
+		status, err := impl.GetCertificateStatus(ctx, string(req))
 		if err != nil {
 			return
 		}
@@ -1011,49 +1725,63 @@ func NewStorageAuthorityServer(rpc Server, impl core.StorageAuthority) error {
 		response, err = json.Marshal(status)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodGetCertificateStatus, err, req)
+			errorCondition(ctx, MethodGetCertificateStatus, err, req)
+			return
+		}
+		return
+	})
+
+	rpc.Handle(MethodGetCertificateIssuer, func(ctx context.Context, req []byte) (response []byte, err error) {
+		issuerKeyID, err := impl.GetCertificateIssuer(ctx, string(req))
+		if err != nil {
 			return
 		}
+		response = []byte(issuerKeyID)
 		return
 	})
 
-	rpc.Handle(MethodMarkCertificateRevoked, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodMarkCertificateRevoked, func(ctx context.Context, req []byte) (response []byte, err error) {
 		var mcrReq markCertificateRevokedRequest
 
 		if err = json.Unmarshal(req, &mcrReq); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodMarkCertificateRevoked, err, req)
+			improperMessage(ctx, MethodMarkCertificateRevoked, err, req)
 			return
 		}
 
-		err = impl.MarkCertificateRevoked(mcrReq.Serial, mcrReq.ReasonCode)
+		err = impl.MarkCertificateRevoked(ctx, mcrReq.Serial, mcrReq.ReasonCode)
 		return
 	})
 
-	rpc.Handle(MethodUpdateOCSP, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodReleaseCertificateHold, func(ctx context.Context, req []byte) (response []byte, err error) {
+		err = impl.ReleaseCertificateHold(ctx, string(req))
+		return
+	})
+
+	rpc.Handle(MethodUpdateOCSP, func(ctx context.Context, req []byte) (response []byte, err error) {
 		var updateOCSPReq updateOCSPRequest
 
 		if err = json.Unmarshal(req, &updateOCSPReq); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodUpdateOCSP, err, req)
+			improperMessage(ctx, MethodUpdateOCSP, err, req)
 			return
 		}
 
-		err = impl.UpdateOCSP(updateOCSPReq.Serial, updateOCSPReq.OCSPResponse)
+		err = impl.UpdateOCSP(ctx, updateOCSPReq.Serial, updateOCSPReq.OCSPResponse)
 		return
 	})
 
-	rpc.Handle(MethodAlreadyDeniedCSR, func(req []byte) (response []byte, err error) {
+	rpc.Handle(MethodAlreadyDeniedCSR, func(ctx context.Context, req []byte) (response []byte, err error) {
 		var adcReq alreadyDeniedCSRReq
 
 		err = json.Unmarshal(req, &adcReq)
 		if err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodAlreadyDeniedCSR, err, req)
+			improperMessage(ctx, MethodAlreadyDeniedCSR, err, req)
 			return
 		}
 
-		exists, err := impl.AlreadyDeniedCSR(adcReq.Names)
+		exists, err := impl.AlreadyDeniedCSR(ctx, adcReq.Names)
 		if err != nil {
 			return
 		}
@@ -1066,130 +1794,476 @@ func NewStorageAuthorityServer(rpc Server, impl core.StorageAuthority) error {
 		return
 	})
 
-	rpc.Handle(MethodCountCertificatesRange, func(req []byte) (response []byte, err error) {
-		var cReq countRequest
-		err = json.Unmarshal(req, &cReq)
-		if err != nil {
+	rpc.Handle(MethodAddDeniedCSR, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var adcReq alreadyDeniedCSRReq
+
+		if err = json.Unmarshal(req, &adcReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodAddDeniedCSR, err, req)
 			return
 		}
 
-		count, err := impl.CountCertificatesRange(cReq.Start, cReq.End)
+		err = impl.AddDeniedCSR(ctx, adcReq.Names)
+		return
+	})
+
+	rpc.Handle(MethodGetRateLimitOverrides, func(ctx context.Context, req []byte) (response []byte, err error) {
+		overrides, err := impl.GetRateLimitOverrides(ctx)
 		if err != nil {
 			return
 		}
-		return json.Marshal(count)
+		return json.Marshal(overrides)
 	})
 
-	rpc.Handle(MethodCountCertificatesByNames, func(req []byte) (response []byte, err error) {
-		var cReq countCertificatesByNamesRequest
-		err = json.Unmarshal(req, &cReq)
-		if err != nil {
+	rpc.Handle(MethodGetPendingReviewAuthorizations, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var reviewReq pendingReviewAuthorizationsRequest
+		if err = json.Unmarshal(req, &reviewReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodGetPendingReviewAuthorizations, err, req)
 			return
 		}
 
-		counts, err := impl.CountCertificatesByNames(cReq.Names, cReq.Earliest, cReq.Latest)
+		authzs, err := impl.GetPendingReviewAuthorizations(ctx, reviewReq.Now)
 		if err != nil {
 			return
 		}
-		return json.Marshal(counts)
+		return json.Marshal(authzs)
 	})
 
-	rpc.Handle(MethodCountRegistrationsByIP, func(req []byte) (response []byte, err error) {
-		var cReq countRegistrationsByIPRequest
-		err = json.Unmarshal(req, &cReq)
-		if err != nil {
+	rpc.Handle(MethodSetRateLimitOverride, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var override core.RateLimitOverride
+		if err = json.Unmarshal(req, &override); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodSetRateLimitOverride, err, req)
 			return
 		}
 
-		count, err := impl.CountRegistrationsByIP(cReq.IP, cReq.Earliest, cReq.Latest)
-		if err != nil {
+		err = impl.SetRateLimitOverride(ctx, override)
+		return
+	})
+
+	rpc.Handle(MethodRemoveRateLimitOverride, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var removeReq removeRateLimitOverrideRequest
+		if err = json.Unmarshal(req, &removeReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodRemoveRateLimitOverride, err, req)
 			return
 		}
-		return json.Marshal(count)
+
+		err = impl.RemoveRateLimitOverride(ctx, removeReq.Limit, removeReq.Key, removeReq.RegID)
+		return
 	})
 
-	rpc.Handle(MethodCountPendingAuthorizations, func(req []byte) (response []byte, err error) {
-		var cReq countPendingAuthorizationsRequest
-		err = json.Unmarshal(req, &cReq)
+	rpc.Handle(MethodGetSerialsByKeyHash, func(ctx context.Context, req []byte) (response []byte, err error) {
+		serials, err := impl.GetSerialsByKeyHash(ctx, string(req))
 		if err != nil {
 			return
 		}
 
-		count, err := impl.CountPendingAuthorizations(cReq.RegID)
+		response, err = json.Marshal(serials)
 		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(ctx, MethodGetSerialsByKeyHash, err, req)
 			return
 		}
-		return json.Marshal(count)
+		return
 	})
 
-	rpc.Handle(MethodGetSCTReceipt, func(req []byte) (response []byte, err error) {
-		var gsctReq struct {
-			Serial string
-			LogID  string
+	rpc.Handle(MethodAddBlockedKey, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var bkReq addBlockedKeyRequest
+		if err = json.Unmarshal(req, &bkReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodAddBlockedKey, err, req)
+			return
 		}
 
-		err = json.Unmarshal(req, &gsctReq)
+		err = impl.AddBlockedKey(ctx, bkReq.KeyHash, bkReq.AddedBy)
+		return
+	})
+
+	rpc.Handle(MethodKeyBlocked, func(ctx context.Context, req []byte) (response []byte, err error) {
+		blocked, err := impl.KeyBlocked(ctx, string(req))
 		if err != nil {
-			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodGetSCTReceipt, err, req)
 			return
 		}
 
-		sct, err := impl.GetSCTReceipt(gsctReq.Serial, gsctReq.LogID)
-		jsonResponse, err := json.Marshal(sct)
-		if err != nil {
-			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodGetSCTReceipt, err, req)
+		if blocked {
+			response = []byte{1}
+		} else {
+			response = []byte{0}
+		}
+		return
+	})
+
+	rpc.Handle(MethodAddReplacementOrder, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var roReq replacementOrderRequest
+
+		if err = json.Unmarshal(req, &roReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodAddReplacementOrder, err, req)
 			return
 		}
 
-		return jsonResponse, nil
+		err = impl.AddReplacementOrder(ctx, roReq.Serial, roReq.ReplacedSerial)
+		return
 	})
 
-	rpc.Handle(MethodAddSCTReceipt, func(req []byte) (response []byte, err error) {
-		var sct core.SignedCertificateTimestamp
-		err = json.Unmarshal(req, &sct)
-		if err != nil {
+	rpc.Handle(MethodNewCertificateOrder, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var orderReq newCertificateOrderRequest
+		if err = json.Unmarshal(req, &orderReq); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodAddSCTReceipt, err, req)
+			improperMessage(ctx, MethodNewCertificateOrder, err, req)
 			return
 		}
 
-		err = impl.AddSCTReceipt(core.SignedCertificateTimestamp(sct))
+		order, err := impl.NewCertificateOrder(ctx, orderReq.Order, orderReq.Req)
 		if err != nil {
-			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodAddSCTReceipt, err, req)
 			return
 		}
 
-		return nil, nil
+		response, err = json.Marshal(order)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(ctx, MethodNewCertificateOrder, err, req)
+			return
+		}
+		return
 	})
 
-	return nil
-}
+	rpc.Handle(MethodFinalizeCertificateOrder, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var order core.CertificateOrder
+		if err = json.Unmarshal(req, &order); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodFinalizeCertificateOrder, err, req)
+			return
+		}
 
-// StorageAuthorityClient is a client to communicate with the Storage Authority
-type StorageAuthorityClient struct {
-	rpc Client
-}
+		err = impl.FinalizeCertificateOrder(ctx, order)
+		return
+	})
 
-// NewStorageAuthorityClient constructs an RPC client
-func NewStorageAuthorityClient(clientName string, amqpConf *cmd.AMQPConfig, stats statsd.Statter) (*StorageAuthorityClient, error) {
-	client, err := NewAmqpRPCClient(clientName+"->SA", amqpConf, amqpConf.SA, stats)
-	return &StorageAuthorityClient{rpc: client}, err
-}
+	rpc.Handle(MethodClaimCertificateOrders, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var claimReq claimCertificateOrdersRequest
+		if err = json.Unmarshal(req, &claimReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodClaimCertificateOrders, err, req)
+			return
+		}
 
-// GetRegistration sends a request to get a registration by ID
-func (cac StorageAuthorityClient) GetRegistration(id int64) (reg core.Registration, err error) {
-	var grReq getRegistrationRequest
-	grReq.ID = id
+		claimed, err := impl.ClaimCertificateOrders(ctx, claimReq.StaleBefore, claimReq.Now, claimReq.Limit)
+		if err != nil {
+			return
+		}
 
-	data, err := json.Marshal(grReq)
-	if err != nil {
+		response, err = json.Marshal(claimed)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(ctx, MethodClaimCertificateOrders, err, req)
+			return
+		}
 		return
-	}
+	})
 
-	jsonReg, err := cac.rpc.DispatchSync(MethodGetRegistration, data)
+	rpc.Handle(MethodReserveIdempotencyKey, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var reserveReq reserveIdempotencyKeyRequest
+		if err = json.Unmarshal(req, &reserveReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodReserveIdempotencyKey, err, req)
+			return
+		}
+
+		key, err := impl.ReserveIdempotencyKey(ctx, reserveReq.Key, reserveReq.StaleBefore)
+		if err != nil {
+			return
+		}
+		return json.Marshal(key)
+	})
+
+	rpc.Handle(MethodFinalizeIdempotencyKey, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var key core.IdempotencyKey
+		if err = json.Unmarshal(req, &key); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodFinalizeIdempotencyKey, err, req)
+			return
+		}
+
+		err = impl.FinalizeIdempotencyKey(ctx, key)
+		return
+	})
+
+	rpc.Handle(MethodGetCAAChecks, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var names []string
+		if err = json.Unmarshal(req, &names); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodGetCAAChecks, err, req)
+			return
+		}
+
+		checks, err := impl.GetCAAChecks(ctx, names)
+		if err != nil {
+			return
+		}
+		return json.Marshal(checks)
+	})
+
+	rpc.Handle(MethodAddCAAChecks, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var addReq addCAAChecksRequest
+		if err = json.Unmarshal(req, &addReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodAddCAAChecks, err, req)
+			return
+		}
+
+		err = impl.AddCAAChecks(ctx, addReq.Names, addReq.Checked)
+		return
+	})
+
+	rpc.Handle(MethodGetCertificateOrder, func(ctx context.Context, req []byte) (response []byte, err error) {
+		order, err := impl.GetCertificateOrder(ctx, string(req))
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(order)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(ctx, MethodGetCertificateOrder, err, req)
+			return
+		}
+		return
+	})
+
+	rpc.Handle(MethodReplacementIssued, func(ctx context.Context, req []byte) (response []byte, err error) {
+		issued, err := impl.ReplacementIssued(ctx, string(req))
+		if err != nil {
+			return
+		}
+
+		if issued {
+			response = []byte{1}
+		} else {
+			response = []byte{0}
+		}
+		return
+	})
+
+	rpc.Handle(MethodAddValidationTranscript, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var vtReq validationTranscriptRequest
+		if err = json.Unmarshal(req, &vtReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodAddValidationTranscript, err, req)
+			return
+		}
+
+		err = impl.AddValidationTranscript(ctx, vtReq.AuthzID, vtReq.ChallengeType, vtReq.Signed)
+		return
+	})
+
+	rpc.Handle(MethodGetValidationTranscripts, func(ctx context.Context, req []byte) (response []byte, err error) {
+		transcripts, err := impl.GetValidationTranscripts(ctx, string(req))
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(transcripts)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(ctx, MethodGetValidationTranscripts, err, req)
+			return
+		}
+		return
+	})
+
+	rpc.Handle(MethodCountCertificatesRange, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var cReq countRequest
+		err = json.Unmarshal(req, &cReq)
+		if err != nil {
+			return
+		}
+
+		count, err := impl.CountCertificatesRange(ctx, cReq.Start, cReq.End)
+		if err != nil {
+			return
+		}
+		return json.Marshal(count)
+	})
+
+	rpc.Handle(MethodCountCertificatesByNames, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var cReq countCertificatesByNamesRequest
+		err = json.Unmarshal(req, &cReq)
+		if err != nil {
+			return
+		}
+
+		counts, err := impl.CountCertificatesByNames(ctx, cReq.Names, cReq.Earliest, cReq.Latest)
+		if err != nil {
+			return
+		}
+		return json.Marshal(counts)
+	})
+
+	rpc.Handle(MethodCountFQDNSets, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var cReq countCertificatesByNamesRequest
+		err = json.Unmarshal(req, &cReq)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodCountFQDNSets, err, req)
+			return
+		}
+
+		count, err := impl.CountFQDNSets(ctx, cReq.Names, cReq.Earliest, cReq.Latest)
+		if err != nil {
+			return
+		}
+		return json.Marshal(count)
+	})
+
+	rpc.Handle(MethodFQDNSetExists, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var fReq fqdnSetExistsRequest
+		err = json.Unmarshal(req, &fReq)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodFQDNSetExists, err, req)
+			return
+		}
+
+		exists, err := impl.FQDNSetExists(ctx, fReq.Names)
+		if err != nil {
+			return
+		}
+		return json.Marshal(exists)
+	})
+
+	rpc.Handle(MethodCountRegistrationsByIP, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var cReq countRegistrationsByIPRequest
+		err = json.Unmarshal(req, &cReq)
+		if err != nil {
+			return
+		}
+
+		count, err := impl.CountRegistrationsByIP(ctx, cReq.IP, cReq.Earliest, cReq.Latest)
+		if err != nil {
+			return
+		}
+		return json.Marshal(count)
+	})
+
+	rpc.Handle(MethodCountPendingAuthorizations, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var cReq countPendingAuthorizationsRequest
+		err = json.Unmarshal(req, &cReq)
+		if err != nil {
+			return
+		}
+
+		count, err := impl.CountPendingAuthorizations(ctx, cReq.RegID)
+		if err != nil {
+			return
+		}
+		return json.Marshal(count)
+	})
+
+	rpc.Handle(MethodGetSCTReceipt, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var gsctReq struct {
+			Serial string
+			LogID  string
+		}
+
+		err = json.Unmarshal(req, &gsctReq)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodGetSCTReceipt, err, req)
+			return
+		}
+
+		sct, err := impl.GetSCTReceipt(ctx, gsctReq.Serial, gsctReq.LogID)
+		jsonResponse, err := json.Marshal(sct)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(ctx, MethodGetSCTReceipt, err, req)
+			return
+		}
+
+		return jsonResponse, nil
+	})
+
+	rpc.Handle(MethodGetCTSubmissions, func(ctx context.Context, req []byte) (response []byte, err error) {
+		submissions, err := impl.GetCTSubmissions(ctx, string(req))
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(submissions)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(ctx, MethodGetCTSubmissions, err, req)
+			return
+		}
+		return
+	})
+
+	rpc.Handle(MethodRecordCTSubmission, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var submission core.CTSubmission
+		err = json.Unmarshal(req, &submission)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodRecordCTSubmission, err, req)
+			return
+		}
+
+		err = impl.RecordCTSubmission(ctx, submission)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(ctx, MethodRecordCTSubmission, err, req)
+			return
+		}
+
+		return nil, nil
+	})
+
+	rpc.Handle(MethodRecordCTInclusion, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var inclusionReq recordCTInclusionRequest
+		err = json.Unmarshal(req, &inclusionReq)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(ctx, MethodRecordCTInclusion, err, req)
+			return
+		}
+
+		err = impl.RecordCTInclusion(ctx, inclusionReq.Serial, inclusionReq.LogID, inclusionReq.Status)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(ctx, MethodRecordCTInclusion, err, req)
+			return
+		}
+
+		return nil, nil
+	})
+
+	return nil
+}
+
+// StorageAuthorityClient is a client to communicate with the Storage Authority
+type StorageAuthorityClient struct {
+	rpc Client
+}
+
+// NewStorageAuthorityClient constructs an RPC client
+func NewStorageAuthorityClient(clientName string, amqpConf *cmd.AMQPConfig, stats statsd.Statter) (*StorageAuthorityClient, error) {
+	client, err := NewAmqpRPCClient(clientName+"->SA", amqpConf, amqpConf.SA, stats)
+	return &StorageAuthorityClient{rpc: client}, err
+}
+
+// GetRegistration sends a request to get a registration by ID
+func (cac StorageAuthorityClient) GetRegistration(ctx context.Context, id int64) (reg core.Registration, err error) {
+	var grReq getRegistrationRequest
+	grReq.ID = id
+
+	data, err := json.Marshal(grReq)
+	if err != nil {
+		return
+	}
+
+	jsonReg, err := cac.rpc.DispatchSync(ctx, MethodGetRegistration, data)
 	if err != nil {
 		return
 	}
@@ -1199,13 +2273,13 @@ func (cac StorageAuthorityClient) GetRegistration(id int64) (reg core.Registrati
 }
 
 // GetRegistrationByKey sends a request to get a registration by JWK
-func (cac StorageAuthorityClient) GetRegistrationByKey(key jose.JsonWebKey) (reg core.Registration, err error) {
+func (cac StorageAuthorityClient) GetRegistrationByKey(ctx context.Context, key jose.JSONWebKey) (reg core.Registration, err error) {
 	jsonKey, err := key.MarshalJSON()
 	if err != nil {
 		return
 	}
 
-	jsonReg, err := cac.rpc.DispatchSync(MethodGetRegistrationByKey, jsonKey)
+	jsonReg, err := cac.rpc.DispatchSync(ctx, MethodGetRegistrationByKey, jsonKey)
 	if err != nil {
 		return
 	}
@@ -1215,8 +2289,8 @@ func (cac StorageAuthorityClient) GetRegistrationByKey(key jose.JsonWebKey) (reg
 }
 
 // GetAuthorization sends a request to get an Authorization by ID
-func (cac StorageAuthorityClient) GetAuthorization(id string) (authz core.Authorization, err error) {
-	jsonAuthz, err := cac.rpc.DispatchSync(MethodGetAuthorization, []byte(id))
+func (cac StorageAuthorityClient) GetAuthorization(ctx context.Context, id string) (authz core.Authorization, err error) {
+	jsonAuthz, err := cac.rpc.DispatchSync(ctx, MethodGetAuthorization, []byte(id))
 	if err != nil {
 		return
 	}
@@ -1226,7 +2300,7 @@ func (cac StorageAuthorityClient) GetAuthorization(id string) (authz core.Author
 }
 
 // GetLatestValidAuthorization sends a request to get an Authorization by RegID, Identifier
-func (cac StorageAuthorityClient) GetLatestValidAuthorization(registrationID int64, identifier core.AcmeIdentifier) (authz core.Authorization, err error) {
+func (cac StorageAuthorityClient) GetLatestValidAuthorization(ctx context.Context, registrationID int64, identifier identifier.ACMEIdentifier) (authz core.Authorization, err error) {
 
 	var lvar latestValidAuthorizationRequest
 	lvar.RegID = registrationID
@@ -1237,7 +2311,7 @@ func (cac StorageAuthorityClient) GetLatestValidAuthorization(registrationID int
 		return
 	}
 
-	jsonAuthz, err := cac.rpc.DispatchSync(MethodGetLatestValidAuthorization, data)
+	jsonAuthz, err := cac.rpc.DispatchSync(ctx, MethodGetLatestValidAuthorization, data)
 	if err != nil {
 		return
 	}
@@ -1246,9 +2320,72 @@ func (cac StorageAuthorityClient) GetLatestValidAuthorization(registrationID int
 	return
 }
 
+// GetAuthorizations sends a request to get the most relevant Authorization of
+// a registration for each of several names
+func (cac StorageAuthorityClient) GetAuthorizations(ctx context.Context, registrationID int64, names []string, now time.Time) (authzs map[string]*core.Authorization, err error) {
+	data, err := json.Marshal(getAuthorizationsRequest{
+		RegID: registrationID,
+		Names: names,
+		Now:   now,
+	})
+	if err != nil {
+		return
+	}
+
+	response, err := cac.rpc.DispatchSync(ctx, MethodGetAuthorizations, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(response, &authzs)
+	return
+}
+
+// GetReusableAuthorizations sends a request to get the valid or pending
+// Authorization of a registration, if any, for each of several names
+func (cac StorageAuthorityClient) GetReusableAuthorizations(ctx context.Context, registrationID int64, names []string, now time.Time) (authzs map[string]*core.Authorization, err error) {
+	data, err := json.Marshal(getAuthorizationsRequest{
+		RegID: registrationID,
+		Names: names,
+		Now:   now,
+	})
+	if err != nil {
+		return
+	}
+
+	response, err := cac.rpc.DispatchSync(ctx, MethodGetReusableAuthorizations, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(response, &authzs)
+	return
+}
+
+// GetCertificatesByRegistration sends a request to list a page of the
+// certificates issued to a registration
+func (cac StorageAuthorityClient) GetCertificatesByRegistration(ctx context.Context, regID int64, offset, limit int) (certs []core.Certificate, err error) {
+	data, err := json.Marshal(getCertificatesByRegistrationRequest{
+		RegID:  regID,
+		Offset: offset,
+		Limit:  limit,
+	})
+	if err != nil {
+		return
+	}
+
+	response, err := cac.rpc.DispatchSync(ctx, MethodGetCertificatesByRegistration, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(response, &certs)
+	return
+}
+
 // GetCertificate sends a request to get a Certificate by ID
-func (cac StorageAuthorityClient) GetCertificate(id string) (cert core.Certificate, err error) {
-	jsonCert, err := cac.rpc.DispatchSync(MethodGetCertificate, []byte(id))
+func (cac StorageAuthorityClient) GetCertificate(ctx context.Context, id string) (cert core.Certificate, err error) {
+	jsonCert, err := cac.rpc.DispatchSync(ctx, MethodGetCertificate, []byte(id))
 	if err != nil {
 		return
 	}
@@ -1259,8 +2396,8 @@ func (cac StorageAuthorityClient) GetCertificate(id string) (cert core.Certifica
 
 // GetCertificateStatus sends a request to obtain the current status of a
 // certificate by ID
-func (cac StorageAuthorityClient) GetCertificateStatus(id string) (status core.CertificateStatus, err error) {
-	jsonStatus, err := cac.rpc.DispatchSync(MethodGetCertificateStatus, []byte(id))
+func (cac StorageAuthorityClient) GetCertificateStatus(ctx context.Context, id string) (status core.CertificateStatus, err error) {
+	jsonStatus, err := cac.rpc.DispatchSync(ctx, MethodGetCertificateStatus, []byte(id))
 	if err != nil {
 		return
 	}
@@ -1269,8 +2406,19 @@ func (cac StorageAuthorityClient) GetCertificateStatus(id string) (status core.C
 	return
 }
 
+// GetCertificateIssuer sends a request for the hex subject key ID of the
+// issuer of the certificate with serial
+func (cac StorageAuthorityClient) GetCertificateIssuer(ctx context.Context, serial string) (issuerKeyID string, err error) {
+	response, err := cac.rpc.DispatchSync(ctx, MethodGetCertificateIssuer, []byte(serial))
+	if err != nil {
+		return
+	}
+	issuerKeyID = string(response)
+	return
+}
+
 // MarkCertificateRevoked sends a request to mark a certificate as revoked
-func (cac StorageAuthorityClient) MarkCertificateRevoked(serial string, reasonCode core.RevocationCode) (err error) {
+func (cac StorageAuthorityClient) MarkCertificateRevoked(ctx context.Context, serial string, reasonCode core.RevocationCode) (err error) {
 	var mcrReq markCertificateRevokedRequest
 
 	mcrReq.Serial = serial
@@ -1281,12 +2429,19 @@ func (cac StorageAuthorityClient) MarkCertificateRevoked(serial string, reasonCo
 		return
 	}
 
-	_, err = cac.rpc.DispatchSync(MethodMarkCertificateRevoked, data)
+	_, err = cac.rpc.DispatchSync(ctx, MethodMarkCertificateRevoked, data)
+	return
+}
+
+// ReleaseCertificateHold sends a request to release a certificate from
+// certificateHold
+func (cac StorageAuthorityClient) ReleaseCertificateHold(ctx context.Context, serial string) (err error) {
+	_, err = cac.rpc.DispatchSync(ctx, MethodReleaseCertificateHold, []byte(serial))
 	return
 }
 
 // UpdateOCSP sends a request to store an updated OCSP response
-func (cac StorageAuthorityClient) UpdateOCSP(serial string, ocspResponse []byte) (err error) {
+func (cac StorageAuthorityClient) UpdateOCSP(ctx context.Context, serial string, ocspResponse []byte) (err error) {
 	var updateOCSPReq updateOCSPRequest
 
 	updateOCSPReq.Serial = serial
@@ -1297,29 +2452,29 @@ func (cac StorageAuthorityClient) UpdateOCSP(serial string, ocspResponse []byte)
 		return
 	}
 
-	_, err = cac.rpc.DispatchSync(MethodUpdateOCSP, data)
+	_, err = cac.rpc.DispatchSync(ctx, MethodUpdateOCSP, data)
 	return
 }
 
 // UpdateRegistration sends a request to store an updated registration
-func (cac StorageAuthorityClient) UpdateRegistration(reg core.Registration) (err error) {
+func (cac StorageAuthorityClient) UpdateRegistration(ctx context.Context, reg core.Registration) (err error) {
 	jsonReg, err := json.Marshal(reg)
 	if err != nil {
 		return
 	}
 
-	_, err = cac.rpc.DispatchSync(MethodUpdateRegistration, jsonReg)
+	_, err = cac.rpc.DispatchSync(ctx, MethodUpdateRegistration, jsonReg)
 	return
 }
 
 // NewRegistration sends a request to store a new registration
-func (cac StorageAuthorityClient) NewRegistration(reg core.Registration) (output core.Registration, err error) {
+func (cac StorageAuthorityClient) NewRegistration(ctx context.Context, reg core.Registration) (output core.Registration, err error) {
 	jsonReg, err := json.Marshal(reg)
 	if err != nil {
 		err = errors.New("NewRegistration RPC failed")
 		return
 	}
-	response, err := cac.rpc.DispatchSync(MethodNewRegistration, jsonReg)
+	response, err := cac.rpc.DispatchSync(ctx, MethodNewRegistration, jsonReg)
 	if err != nil {
 		return
 	}
@@ -1332,12 +2487,12 @@ func (cac StorageAuthorityClient) NewRegistration(reg core.Registration) (output
 }
 
 // NewPendingAuthorization sends a request to store a pending authorization
-func (cac StorageAuthorityClient) NewPendingAuthorization(authz core.Authorization) (output core.Authorization, err error) {
+func (cac StorageAuthorityClient) NewPendingAuthorization(ctx context.Context, authz core.Authorization) (output core.Authorization, err error) {
 	jsonAuthz, err := json.Marshal(authz)
 	if err != nil {
 		return
 	}
-	response, err := cac.rpc.DispatchSync(MethodNewPendingAuthorization, jsonAuthz)
+	response, err := cac.rpc.DispatchSync(ctx, MethodNewPendingAuthorization, jsonAuthz)
 	if err != nil {
 		return
 	}
@@ -1349,32 +2504,57 @@ func (cac StorageAuthorityClient) NewPendingAuthorization(authz core.Authorizati
 	return
 }
 
+// NewPendingAuthorizations sends a request to store several pending
+// authorizations
+func (cac StorageAuthorityClient) NewPendingAuthorizations(ctx context.Context, authzs []core.Authorization) (output []core.Authorization, err error) {
+	jsonAuthzs, err := json.Marshal(authzs)
+	if err != nil {
+		return
+	}
+	response, err := cac.rpc.DispatchSync(ctx, MethodNewPendingAuthorizations, jsonAuthzs)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(response, &output)
+	if err != nil {
+		err = errors.New("NewPendingAuthorizations RPC failed")
+		return
+	}
+	return
+}
+
 // UpdatePendingAuthorization sends a request to update the data in a pending
 // authorization
-func (cac StorageAuthorityClient) UpdatePendingAuthorization(authz core.Authorization) (err error) {
+func (cac StorageAuthorityClient) UpdatePendingAuthorization(ctx context.Context, authz core.Authorization) (err error) {
 	jsonAuthz, err := json.Marshal(authz)
 	if err != nil {
 		return
 	}
 
-	_, err = cac.rpc.DispatchSync(MethodUpdatePendingAuthorization, jsonAuthz)
+	_, err = cac.rpc.DispatchSync(ctx, MethodUpdatePendingAuthorization, jsonAuthz)
 	return
 }
 
 // FinalizeAuthorization sends a request to finalize an authorization (convert
 // from pending)
-func (cac StorageAuthorityClient) FinalizeAuthorization(authz core.Authorization) (err error) {
+func (cac StorageAuthorityClient) FinalizeAuthorization(ctx context.Context, authz core.Authorization) (err error) {
 	jsonAuthz, err := json.Marshal(authz)
 	if err != nil {
 		return
 	}
 
-	_, err = cac.rpc.DispatchSync(MethodFinalizeAuthorization, jsonAuthz)
+	_, err = cac.rpc.DispatchSync(ctx, MethodFinalizeAuthorization, jsonAuthz)
+	return
+}
+
+// DeactivateAuthorization sends a request to deactivate an authorization
+func (cac StorageAuthorityClient) DeactivateAuthorization(ctx context.Context, id string) (err error) {
+	_, err = cac.rpc.DispatchSync(ctx, MethodDeactivateAuthorization, []byte(id))
 	return
 }
 
 // AddCertificate sends a request to record the issuance of a certificate
-func (cac StorageAuthorityClient) AddCertificate(cert []byte, regID int64) (id string, err error) {
+func (cac StorageAuthorityClient) AddCertificate(ctx context.Context, cert []byte, regID int64) (id string, err error) {
 	var acReq addCertificateRequest
 	acReq.Bytes = cert
 	acReq.RegID = regID
@@ -1383,7 +2563,7 @@ func (cac StorageAuthorityClient) AddCertificate(cert []byte, regID int64) (id s
 		return
 	}
 
-	response, err := cac.rpc.DispatchSync(MethodAddCertificate, data)
+	response, err := cac.rpc.DispatchSync(ctx, MethodAddCertificate, data)
 	if err != nil {
 		return
 	}
@@ -1391,8 +2571,69 @@ func (cac StorageAuthorityClient) AddCertificate(cert []byte, regID int64) (id s
 	return
 }
 
+// AddDeniedCSR sends a request to deny issuance for a set of names
+func (cac StorageAuthorityClient) AddDeniedCSR(ctx context.Context, names []string) (err error) {
+	var adcReq alreadyDeniedCSRReq
+	adcReq.Names = names
+
+	data, err := json.Marshal(adcReq)
+	if err != nil {
+		return
+	}
+
+	_, err = cac.rpc.DispatchSync(ctx, MethodAddDeniedCSR, data)
+	return
+}
+
+// GetRateLimitOverrides calls GetRateLimitOverrides on the remote
+// StorageAuthority.
+func (cac StorageAuthorityClient) GetRateLimitOverrides(ctx context.Context) (overrides []core.RateLimitOverride, err error) {
+	response, err := cac.rpc.DispatchSync(ctx, MethodGetRateLimitOverrides, nil)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(response, &overrides)
+	return
+}
+
+// GetPendingReviewAuthorizations calls GetPendingReviewAuthorizations on the
+// remote StorageAuthority.
+func (cac StorageAuthorityClient) GetPendingReviewAuthorizations(ctx context.Context, now time.Time) (authzs []core.Authorization, err error) {
+	data, err := json.Marshal(pendingReviewAuthorizationsRequest{Now: now})
+	if err != nil {
+		return
+	}
+	response, err := cac.rpc.DispatchSync(ctx, MethodGetPendingReviewAuthorizations, data)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(response, &authzs)
+	return
+}
+
+// StorageAuthority.
+func (cac StorageAuthorityClient) SetRateLimitOverride(ctx context.Context, override core.RateLimitOverride) (err error) {
+	data, err := json.Marshal(override)
+	if err != nil {
+		return
+	}
+	_, err = cac.rpc.DispatchSync(ctx, MethodSetRateLimitOverride, data)
+	return
+}
+
+// RemoveRateLimitOverride calls RemoveRateLimitOverride on the remote
+// StorageAuthority.
+func (cac StorageAuthorityClient) RemoveRateLimitOverride(ctx context.Context, limit, key string, regID int64) (err error) {
+	data, err := json.Marshal(removeRateLimitOverrideRequest{Limit: limit, Key: key, RegID: regID})
+	if err != nil {
+		return
+	}
+	_, err = cac.rpc.DispatchSync(ctx, MethodRemoveRateLimitOverride, data)
+	return
+}
+
 // AlreadyDeniedCSR sends a request to search for denied names
-func (cac StorageAuthorityClient) AlreadyDeniedCSR(names []string) (exists bool, err error) {
+func (cac StorageAuthorityClient) AlreadyDeniedCSR(ctx context.Context, names []string) (exists bool, err error) {
 	var adcReq alreadyDeniedCSRReq
 	adcReq.Names = names
 
@@ -1401,7 +2642,7 @@ func (cac StorageAuthorityClient) AlreadyDeniedCSR(names []string) (exists bool,
 		return
 	}
 
-	response, err := cac.rpc.DispatchSync(MethodAlreadyDeniedCSR, data)
+	response, err := cac.rpc.DispatchSync(ctx, MethodAlreadyDeniedCSR, data)
 	if err != nil {
 		return
 	}
@@ -1415,16 +2656,225 @@ func (cac StorageAuthorityClient) AlreadyDeniedCSR(names []string) (exists bool,
 	return
 }
 
+// GetSerialsByKeyHash sends a request to find the serials of the unexpired
+// certificates for a key
+func (cac StorageAuthorityClient) GetSerialsByKeyHash(ctx context.Context, keyHash string) (serials []string, err error) {
+	response, err := cac.rpc.DispatchSync(ctx, MethodGetSerialsByKeyHash, []byte(keyHash))
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(response, &serials)
+	return
+}
+
+// AddBlockedKey sends a request to block issuance for a key
+func (cac StorageAuthorityClient) AddBlockedKey(ctx context.Context, keyHash, addedBy string) (err error) {
+	data, err := json.Marshal(addBlockedKeyRequest{KeyHash: keyHash, AddedBy: addedBy})
+	if err != nil {
+		return
+	}
+
+	_, err = cac.rpc.DispatchSync(ctx, MethodAddBlockedKey, data)
+	return
+}
+
+// KeyBlocked sends a request to find if issuance for a key is blocked
+func (cac StorageAuthorityClient) KeyBlocked(ctx context.Context, keyHash string) (blocked bool, err error) {
+	response, err := cac.rpc.DispatchSync(ctx, MethodKeyBlocked, []byte(keyHash))
+	if err != nil {
+		return
+	}
+
+	if len(response) != 1 {
+		err = fmt.Errorf("Unexpected KeyBlocked response: %v", response)
+		return
+	}
+	blocked = response[0] == 1
+	return
+}
+
+// AddReplacementOrder sends a request to record that a certificate was issued
+// to replace another
+func (cac StorageAuthorityClient) AddReplacementOrder(ctx context.Context, serial, replacedSerial string) (err error) {
+	data, err := json.Marshal(replacementOrderRequest{
+		Serial:         serial,
+		ReplacedSerial: replacedSerial,
+	})
+	if err != nil {
+		return
+	}
+
+	_, err = cac.rpc.DispatchSync(ctx, MethodAddReplacementOrder, data)
+	return
+}
+
+// NewCertificateOrder sends a request to store a new certificate order
+// with the request it's to issue a certificate for
+func (cac StorageAuthorityClient) NewCertificateOrder(ctx context.Context, order core.CertificateOrder, req core.CertificateRequest) (created core.CertificateOrder, err error) {
+	data, err := json.Marshal(newCertificateOrderRequest{Order: order, Req: req})
+	if err != nil {
+		return
+	}
+
+	response, err := cac.rpc.DispatchSync(ctx, MethodNewCertificateOrder, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(response, &created)
+	return
+}
+
+// FinalizeCertificateOrder sends a request to record the outcome of a
+// certificate order
+func (cac StorageAuthorityClient) FinalizeCertificateOrder(ctx context.Context, order core.CertificateOrder) (err error) {
+	data, err := json.Marshal(order)
+	if err != nil {
+		return
+	}
+
+	_, err = cac.rpc.DispatchSync(ctx, MethodFinalizeCertificateOrder, data)
+	return
+}
+
+// ClaimCertificateOrders sends a request to claim stale processing
+// certificate orders to resume
+func (cac StorageAuthorityClient) ClaimCertificateOrders(ctx context.Context, staleBefore, now time.Time, limit int) (claimed []core.ClaimedCertificateOrder, err error) {
+	data, err := json.Marshal(claimCertificateOrdersRequest{StaleBefore: staleBefore, Now: now, Limit: limit})
+	if err != nil {
+		return
+	}
+
+	response, err := cac.rpc.DispatchSync(ctx, MethodClaimCertificateOrders, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(response, &claimed)
+	return
+}
+
+// ReserveIdempotencyKey sends a request to reserve an idempotency key for
+// the request issuing its certificate
+func (cac StorageAuthorityClient) ReserveIdempotencyKey(ctx context.Context, key core.IdempotencyKey, staleBefore time.Time) (stored core.IdempotencyKey, err error) {
+	data, err := json.Marshal(reserveIdempotencyKeyRequest{Key: key, StaleBefore: staleBefore})
+	if err != nil {
+		return
+	}
+
+	response, err := cac.rpc.DispatchSync(ctx, MethodReserveIdempotencyKey, data)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(response, &stored)
+	return
+}
+
+// FinalizeIdempotencyKey sends a request to record the certificate issued
+// for an idempotency key, or release its reservation
+func (cac StorageAuthorityClient) FinalizeIdempotencyKey(ctx context.Context, key core.IdempotencyKey) (err error) {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return
+	}
+
+	_, err = cac.rpc.DispatchSync(ctx, MethodFinalizeIdempotencyKey, data)
+	return
+}
+
+// GetCAAChecks sends a request for when CAA last allowed issuance for names
+func (cac StorageAuthorityClient) GetCAAChecks(ctx context.Context, names []string) (checks map[string]time.Time, err error) {
+	data, err := json.Marshal(names)
+	if err != nil {
+		return
+	}
+
+	response, err := cac.rpc.DispatchSync(ctx, MethodGetCAAChecks, data)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(response, &checks)
+	return
+}
+
+// AddCAAChecks sends a request to record that CAA allowed issuance for names
+// at checked
+func (cac StorageAuthorityClient) AddCAAChecks(ctx context.Context, names []string, checked time.Time) (err error) {
+	data, err := json.Marshal(addCAAChecksRequest{Names: names, Checked: checked})
+	if err != nil {
+		return
+	}
+
+	_, err = cac.rpc.DispatchSync(ctx, MethodAddCAAChecks, data)
+	return
+}
+
+// GetCertificateOrder sends a request to obtain a certificate order by ID
+func (cac StorageAuthorityClient) GetCertificateOrder(ctx context.Context, id string) (order core.CertificateOrder, err error) {
+	response, err := cac.rpc.DispatchSync(ctx, MethodGetCertificateOrder, []byte(id))
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(response, &order)
+	return
+}
+
+// ReplacementIssued sends a request to find if a certificate has already been
+// replaced
+func (cac StorageAuthorityClient) ReplacementIssued(ctx context.Context, serial string) (issued bool, err error) {
+	response, err := cac.rpc.DispatchSync(ctx, MethodReplacementIssued, []byte(serial))
+	if err != nil {
+		return
+	}
+
+	if len(response) != 1 {
+		err = fmt.Errorf("Unexpected ReplacementIssued response: %v", response)
+		return
+	}
+	issued = response[0] == 1
+	return
+}
+
+// AddValidationTranscript sends a request to store the signed transcript of
+// a validation
+func (cac StorageAuthorityClient) AddValidationTranscript(ctx context.Context, authzID, challengeType string, signed []byte) (err error) {
+	data, err := json.Marshal(validationTranscriptRequest{
+		AuthzID:       authzID,
+		ChallengeType: challengeType,
+		Signed:        signed,
+	})
+	if err != nil {
+		return
+	}
+
+	_, err = cac.rpc.DispatchSync(ctx, MethodAddValidationTranscript, data)
+	return
+}
+
+// GetValidationTranscripts sends a request to get the signed transcripts of
+// an authorization's validations
+func (cac StorageAuthorityClient) GetValidationTranscripts(ctx context.Context, authzID string) (transcripts [][]byte, err error) {
+	response, err := cac.rpc.DispatchSync(ctx, MethodGetValidationTranscripts, []byte(authzID))
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(response, &transcripts)
+	return
+}
+
 // CountCertificatesRange sends a request to count the number of certificates
 // issued in  a certain time range
-func (cac StorageAuthorityClient) CountCertificatesRange(start, end time.Time) (count int64, err error) {
+func (cac StorageAuthorityClient) CountCertificatesRange(ctx context.Context, start, end time.Time) (count int64, err error) {
 	var cReq countRequest
 	cReq.Start, cReq.End = start, end
 	data, err := json.Marshal(cReq)
 	if err != nil {
 		return
 	}
-	response, err := cac.rpc.DispatchSync(MethodCountCertificatesRange, data)
+	response, err := cac.rpc.DispatchSync(ctx, MethodCountCertificatesRange, data)
 	if err != nil {
 		return
 	}
@@ -1434,14 +2884,14 @@ func (cac StorageAuthorityClient) CountCertificatesRange(start, end time.Time) (
 
 // CountCertificatesByNames calls CountCertificatesRange on the remote
 // StorageAuthority.
-func (cac StorageAuthorityClient) CountCertificatesByNames(names []string, earliest, latest time.Time) (counts map[string]int, err error) {
+func (cac StorageAuthorityClient) CountCertificatesByNames(ctx context.Context, names []string, earliest, latest time.Time) (counts map[string]int, err error) {
 	var cReq countCertificatesByNamesRequest
 	cReq.Names, cReq.Earliest, cReq.Latest = names, earliest, latest
 	data, err := json.Marshal(cReq)
 	if err != nil {
 		return
 	}
-	response, err := cac.rpc.DispatchSync(MethodCountCertificatesByNames, data)
+	response, err := cac.rpc.DispatchSync(ctx, MethodCountCertificatesByNames, data)
 	if err != nil {
 		return
 	}
@@ -1449,16 +2899,46 @@ func (cac StorageAuthorityClient) CountCertificatesByNames(names []string, earli
 	return
 }
 
+// CountFQDNSets calls CountFQDNSets on the remote StorageAuthority.
+func (cac StorageAuthorityClient) CountFQDNSets(ctx context.Context, names []string, earliest, latest time.Time) (count int64, err error) {
+	var cReq countCertificatesByNamesRequest
+	cReq.Names, cReq.Earliest, cReq.Latest = names, earliest, latest
+	data, err := json.Marshal(cReq)
+	if err != nil {
+		return
+	}
+	response, err := cac.rpc.DispatchSync(ctx, MethodCountFQDNSets, data)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(response, &count)
+	return
+}
+
+// FQDNSetExists calls FQDNSetExists on the remote StorageAuthority.
+func (cac StorageAuthorityClient) FQDNSetExists(ctx context.Context, names []string) (exists bool, err error) {
+	data, err := json.Marshal(fqdnSetExistsRequest{Names: names})
+	if err != nil {
+		return
+	}
+	response, err := cac.rpc.DispatchSync(ctx, MethodFQDNSetExists, data)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(response, &exists)
+	return
+}
+
 // CountRegistrationsByIP calls CountRegistrationsByIP on the remote
 // StorageAuthority.
-func (cac StorageAuthorityClient) CountRegistrationsByIP(ip net.IP, earliest, latest time.Time) (count int, err error) {
+func (cac StorageAuthorityClient) CountRegistrationsByIP(ctx context.Context, ip net.IP, earliest, latest time.Time) (count int, err error) {
 	var cReq countRegistrationsByIPRequest
 	cReq.IP, cReq.Earliest, cReq.Latest = ip, earliest, latest
 	data, err := json.Marshal(cReq)
 	if err != nil {
 		return
 	}
-	response, err := cac.rpc.DispatchSync(MethodCountRegistrationsByIP, data)
+	response, err := cac.rpc.DispatchSync(ctx, MethodCountRegistrationsByIP, data)
 	if err != nil {
 		return
 	}
@@ -1468,14 +2948,14 @@ func (cac StorageAuthorityClient) CountRegistrationsByIP(ip net.IP, earliest, la
 
 // CountPendingAuthorizations calls CountPendingAuthorizations on the remote
 // StorageAuthority.
-func (cac StorageAuthorityClient) CountPendingAuthorizations(regID int64) (count int, err error) {
+func (cac StorageAuthorityClient) CountPendingAuthorizations(ctx context.Context, regID int64) (count int, err error) {
 	var cReq countPendingAuthorizationsRequest
 	cReq.RegID = regID
 	data, err := json.Marshal(cReq)
 	if err != nil {
 		return
 	}
-	response, err := cac.rpc.DispatchSync(MethodCountPendingAuthorizations, data)
+	response, err := cac.rpc.DispatchSync(ctx, MethodCountPendingAuthorizations, data)
 	if err != nil {
 		return
 	}
@@ -1485,7 +2965,7 @@ func (cac StorageAuthorityClient) CountPendingAuthorizations(regID int64) (count
 
 // GetSCTReceipt retrieves an SCT according to the serial number of a certificate
 // and the logID of the log to which it was submitted.
-func (cac StorageAuthorityClient) GetSCTReceipt(serial string, logID string) (receipt core.SignedCertificateTimestamp, err error) {
+func (cac StorageAuthorityClient) GetSCTReceipt(ctx context.Context, serial string, logID string) (receipt core.SignedCertificateTimestamp, err error) {
 	var gsctReq struct {
 		Serial string
 		LogID  string
@@ -1498,7 +2978,7 @@ func (cac StorageAuthorityClient) GetSCTReceipt(serial string, logID string) (re
 		return
 	}
 
-	response, err := cac.rpc.DispatchSync(MethodGetSCTReceipt, data)
+	response, err := cac.rpc.DispatchSync(ctx, MethodGetSCTReceipt, data)
 	if err != nil {
 		return
 	}
@@ -1507,13 +2987,44 @@ func (cac StorageAuthorityClient) GetSCTReceipt(serial string, logID string) (re
 	return
 }
 
-// AddSCTReceipt adds a new SCT to the database.
-func (cac StorageAuthorityClient) AddSCTReceipt(sct core.SignedCertificateTimestamp) (err error) {
-	data, err := json.Marshal(sct)
+// GetCTSubmissions sends a request to get the submissions of a certificate
+// to each CT log
+func (cac StorageAuthorityClient) GetCTSubmissions(ctx context.Context, serial string) (submissions []core.CTSubmission, err error) {
+	response, err := cac.rpc.DispatchSync(ctx, MethodGetCTSubmissions, []byte(serial))
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(response, &submissions)
+	return
+}
+
+// RecordCTSubmission sends a request to record an attempt to submit a
+// certificate to a CT log.
+func (cac StorageAuthorityClient) RecordCTSubmission(ctx context.Context, submission core.CTSubmission) (err error) {
+	data, err := json.Marshal(submission)
+	if err != nil {
+		return
+	}
+
+	_, err = cac.rpc.DispatchSync(ctx, MethodRecordCTSubmission, data)
+	return
+}
+
+type recordCTInclusionRequest struct {
+	Serial string
+	LogID  string
+	Status core.CTInclusionStatus
+}
+
+// RecordCTInclusion sends a request to record whether a CT log includes a
+// certificate it issued an SCT for.
+func (cac StorageAuthorityClient) RecordCTInclusion(ctx context.Context, serial, logID string, status core.CTInclusionStatus) (err error) {
+	data, err := json.Marshal(recordCTInclusionRequest{Serial: serial, LogID: logID, Status: status})
 	if err != nil {
 		return
 	}
 
-	_, err = cac.rpc.DispatchSync(MethodAddSCTReceipt, data)
+	_, err = cac.rpc.DispatchSync(ctx, MethodRecordCTInclusion, data)
 	return
 }
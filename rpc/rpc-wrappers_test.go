@@ -6,11 +6,13 @@
 package rpc
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
 
-	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
 	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/identifier"
 	"github.com/letsencrypt/boulder/mocks"
 	"github.com/letsencrypt/boulder/test"
 )
@@ -24,10 +26,11 @@ const JWK1JSON = `{
 }`
 
 type MockRPCClient struct {
-	LastMethod string
-	LastBody   []byte
-	NextResp   []byte
-	NextErr    error
+	LastMethod    string
+	LastBody      []byte
+	LastRequestID string
+	NextResp      []byte
+	NextErr       error
 }
 
 func (rpc *MockRPCClient) Dispatch(method string, body []byte) chan []byte {
@@ -39,9 +42,10 @@ func (rpc *MockRPCClient) Dispatch(method string, body []byte) chan []byte {
 	return rsp
 }
 
-func (rpc *MockRPCClient) DispatchSync(method string, body []byte) (response []byte, err error) {
+func (rpc *MockRPCClient) DispatchSync(ctx context.Context, method string, body []byte) (response []byte, err error) {
 	rpc.LastMethod = method
 	rpc.LastBody = body
+	rpc.LastRequestID = core.RequestID(ctx)
 	response = body
 
 	if rpc.NextResp != nil {
@@ -61,7 +65,7 @@ func TestRANewRegistration(t *testing.T) {
 	mock := &MockRPCClient{}
 	client := RegistrationAuthorityClient{mock}
 
-	var jwk jose.JsonWebKey
+	var jwk jose.JSONWebKey
 	json.Unmarshal([]byte(JWK1JSON), &jwk)
 
 	reg := core.Registration{
@@ -69,10 +73,12 @@ func TestRANewRegistration(t *testing.T) {
 		Key: jwk,
 	}
 
-	_, err := client.NewRegistration(reg)
+	ctx := core.WithRequestID(context.Background(), "f00f")
+	_, err := client.NewRegistration(ctx, reg)
 	test.AssertNotError(t, err, "Updated Registration")
 	test.Assert(t, len(mock.LastBody) > 0, "Didn't send Registration")
 	test.AssertEquals(t, "NewRegistration", mock.LastMethod)
+	test.AssertEquals(t, "f00f", mock.LastRequestID)
 
 	t.Logf("LastMethod: %v", mock.LastMethod)
 	t.Logf("LastBody: %v", mock.LastBody)
@@ -88,6 +94,38 @@ func TestGenerateOCSP(t *testing.T) {
 	}
 
 	mock.NextResp = []byte{}
-	_, err := client.GenerateOCSP(req)
+	_, err := client.GenerateOCSP(context.Background(), req)
 	test.AssertError(t, err, "Should have failed at signer")
 }
+
+func TestNonceRedeem(t *testing.T) {
+	mock := &MockRPCClient{}
+	client := NonceClient{mock}
+
+	mock.NextResp = []byte(`{"Valid":true}`)
+	valid, err := client.Redeem("wfe1nonce")
+	test.AssertNotError(t, err, "Redeem failed")
+	test.Assert(t, valid, "Valid nonce reported invalid")
+	test.AssertEquals(t, MethodRedeemNonce, mock.LastMethod)
+	test.AssertEquals(t, `{"Nonce":"wfe1nonce"}`, string(mock.LastBody))
+
+	mock.NextResp = []byte(`{"Valid":false}`)
+	valid, err = client.Redeem("wfe1nonce")
+	test.AssertNotError(t, err, "Redeem failed")
+	test.Assert(t, !valid, "Invalid nonce reported valid")
+}
+
+func TestRemoteVAPerformValidation(t *testing.T) {
+	mock := &MockRPCClient{}
+	client := RemoteVAClient{mock}
+
+	mock.NextResp = []byte(`{"Records":null,"Problem":{"type":"urn:acme:error:unauthorized","detail":"Invalid response"}}`)
+	resp, err := client.PerformValidation(context.Background(), &core.PerformValidationRequest{
+		Identifier:     identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: "example.com"},
+		RegistrationID: 1,
+	})
+	test.AssertNotError(t, err, "PerformValidation failed")
+	test.AssertEquals(t, MethodPerformValidation, mock.LastMethod)
+	test.AssertNotNil(t, resp.Problem, "Problem wasn't passed through")
+	test.AssertEquals(t, resp.Problem.Detail, "Invalid response")
+}
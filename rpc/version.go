@@ -0,0 +1,91 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package rpc
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/streadway/amqp"
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+)
+
+// rpcVersion is the version of the RPC messages this build sends and
+// understands. Bump it with any change to them that components of other
+// versions can't handle, so that a partial deploy mixing the two is noticed.
+const rpcVersion = 1
+
+// AMQP message headers that describe the build of the sending component
+const (
+	buildIDHeader    = "Boulder-Build-Id"
+	rpcVersionHeader = "Boulder-Rpc-Version"
+	featuresHeader   = "Boulder-Features"
+)
+
+// messageHeaders returns the headers of a message: the sender's build ID, RPC
+// version and enabled features, and requestID and adminToken, if not empty.
+func messageHeaders(requestID, adminToken string) amqp.Table {
+	headers := amqp.Table{
+		buildIDHeader:    core.GetBuildID(),
+		rpcVersionHeader: int32(rpcVersion),
+		featuresHeader:   strings.Join(core.EnabledFeatures(), ","),
+	}
+	if requestID != "" {
+		headers[core.RequestIDHeader] = requestID
+	}
+	if adminToken != "" {
+		headers[core.AdminTokenHeader] = adminToken
+	}
+	return headers
+}
+
+// deliveryRPCVersion returns the RPC version in the headers of msg, and
+// whether it had one. Messages from builds that predate the header have none.
+func deliveryRPCVersion(msg amqp.Delivery) (int64, bool) {
+	switch v := msg.Headers[rpcVersionHeader].(type) {
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	}
+	return 0, false
+}
+
+// mismatchedPeers are the builds of peers found to send an incompatible RPC
+// version, so that each is warned about once rather than on every message.
+var mismatchedPeers = struct {
+	sync.Mutex
+	builds map[string]bool
+}{builds: make(map[string]bool)}
+
+// checkPeerVersion counts msg, received on queue, if it comes from a
+// component with an incompatible RPC version, and warns the first time each
+// such build is seen.
+func checkPeerVersion(log *blog.AuditLogger, stats statsd.Statter, queue string, msg amqp.Delivery) {
+	version, ok := deliveryRPCVersion(msg)
+	if !ok || version == rpcVersion {
+		return
+	}
+	stats.Inc(fmt.Sprintf("RPC.VersionMismatch.%s", queue), 1, 1.0)
+
+	buildID, _ := msg.Headers[buildIDHeader].(string)
+	peerFeatures, _ := msg.Headers[featuresHeader].(string)
+	mismatchedPeers.Lock()
+	warned := mismatchedPeers.builds[buildID]
+	mismatchedPeers.builds[buildID] = true
+	mismatchedPeers.Unlock()
+	if !warned {
+		log.Warning(fmt.Sprintf(" [!][%s] Peer build %s speaks RPC version %d, not %d (build %s); features [%s]",
+			queue, buildID, version, rpcVersion, core.GetBuildID(), peerFeatures))
+	}
+}
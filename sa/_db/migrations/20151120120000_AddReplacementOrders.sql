@@ -0,0 +1,15 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE `replacementOrders` (
+  `serial` varchar(255) NOT NULL,
+  `replacedSerial` varchar(255) NOT NULL,
+  `created` datetime NOT NULL,
+  PRIMARY KEY (`serial`),
+  KEY `replacedSerial_idx` (`replacedSerial`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE `replacementOrders`;
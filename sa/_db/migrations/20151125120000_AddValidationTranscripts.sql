@@ -0,0 +1,17 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE `validationTranscripts` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `authzID` varchar(255) NOT NULL,
+  `challengeType` varchar(255) NOT NULL,
+  `transcript` mediumblob NOT NULL,
+  `created` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `authzID_idx` (`authzID`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE `validationTranscripts`;
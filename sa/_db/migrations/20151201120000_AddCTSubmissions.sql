@@ -0,0 +1,36 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE `ctSubmissions` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `certificateSerial` varchar(255) NOT NULL,
+  `logID` varchar(255) NOT NULL,
+  `status` varchar(32) NOT NULL,
+  `attempts` int(11) NOT NULL,
+  `lastAttempt` datetime NOT NULL,
+  `lastError` varchar(1024) NOT NULL DEFAULT '',
+  `sctVersion` tinyint(1) NOT NULL DEFAULT 0,
+  `timestamp` bigint(20) NOT NULL DEFAULT 0,
+  `extensions` blob,
+  `signature` blob,
+  `inclusionStatus` varchar(32) NOT NULL DEFAULT '',
+  `LockCol` bigint(20) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `certificateSerial_logID` (`certificateSerial`, `logID`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- sctReceipts is still written by the SA deployed before this migration, so
+-- it's left in place and dropped by a later release's migration, which copies
+-- over whatever was written to it after this backfill.
+INSERT INTO `ctSubmissions`
+  (`certificateSerial`, `logID`, `status`, `attempts`, `lastAttempt`,
+   `sctVersion`, `timestamp`, `extensions`, `signature`, `inclusionStatus`, `LockCol`)
+  SELECT `certificateSerial`, `logID`, 'submitted', 1, FROM_UNIXTIME(`timestamp` DIV 1000),
+         `sctVersion`, `timestamp`, `extensions`, `signature`, 'unverified', 0
+  FROM `sctReceipts`;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE `ctSubmissions`;
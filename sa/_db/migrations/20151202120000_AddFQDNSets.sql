@@ -0,0 +1,25 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE `fqdnSets` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  -- SHA-256 of the certificate's sorted, lowercased names; see
+  -- core.HashNames
+  `setHash` binary(32) NOT NULL,
+  `serial` varchar(255) NOT NULL,
+  `issued` datetime NOT NULL,
+  `expires` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `setHash_issued_idx` (`setHash`, `issued`),
+  UNIQUE KEY `serial` (`serial`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- The sets are hashed from parsed certificates, which SQL can't do, so
+-- those of the unexpired certificates already stored are recorded by
+-- running cmd/backfill-fqdn-sets after this migration. Until then, the
+-- certificates per FQDN set rate limit doesn't count them.
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE `fqdnSets`;
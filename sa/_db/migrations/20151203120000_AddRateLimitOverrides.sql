@@ -0,0 +1,22 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE `rateLimitOverrides` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `limitName` varchar(255) NOT NULL,
+  -- Empty for an override of every key for a registration
+  `limitKey` varchar(255) NOT NULL,
+  -- Zero for an override of a key for every registration
+  `registrationID` bigint(20) NOT NULL,
+  `threshold` int(11) NOT NULL,
+  `multiplier` double NOT NULL,
+  `created` datetime NOT NULL,
+  `createdBy` varchar(255) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `limitName_limitKey_registrationID` (`limitName`, `limitKey`, `registrationID`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE `rateLimitOverrides`;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE INDEX `registrationID_identifier_status_expires_idx` on `pendingAuthorizations` (`registrationID`, `identifier`, `status`, `expires`);
+
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP INDEX `registrationID_identifier_status_expires_idx` on `pendingAuthorizations`;
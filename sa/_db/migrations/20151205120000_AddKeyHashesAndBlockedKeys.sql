@@ -0,0 +1,26 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE `keyHashToSerial` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `keyHash` varchar(255) NOT NULL,
+  `certNotAfter` datetime NOT NULL,
+  `certSerial` varchar(255) NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `keyHash_certNotAfter_idx` (`keyHash`, `certNotAfter`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `blockedKeys` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `keyHash` varchar(255) NOT NULL,
+  `added` datetime NOT NULL,
+  `addedBy` varchar(255) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `keyHash` (`keyHash`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE `keyHashToSerial`;
+DROP TABLE `blockedKeys`;
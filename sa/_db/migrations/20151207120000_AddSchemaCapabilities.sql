@@ -0,0 +1,22 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Each row records a schema change the SA may rely on. A migration that adds
+-- tables or columns the SA uses inserts its capability here after its DDL,
+-- so that an SA deployed first keeps working without them until it's run.
+CREATE TABLE `schemaCapabilities` (
+  `name` varchar(255) NOT NULL,
+  `added` datetime NOT NULL,
+  PRIMARY KEY (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+INSERT INTO `schemaCapabilities` (`name`, `added`) VALUES
+  ('keyHashToSerial', NOW()),
+  ('blockedKeys', NOW()),
+  ('certificateOrders', NOW()),
+  ('ctSubmissions', NOW());
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE `schemaCapabilities`;
@@ -0,0 +1,22 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE `idempotencyKeys` (
+  `registrationID` bigint(20) NOT NULL,
+  -- Hex SHA-256 of the certificate request and the client's idempotency
+  -- key
+  `digest` varchar(64) NOT NULL,
+  `requestID` varchar(255) NOT NULL,
+  -- Empty until the certificate is issued
+  `serial` varchar(255) NOT NULL,
+  `created` datetime NOT NULL,
+  PRIMARY KEY (`registrationID`, `digest`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+INSERT INTO `schemaCapabilities` (`name`, `added`) VALUES ('idempotencyKeys', NOW());
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DELETE FROM `schemaCapabilities` WHERE `name` = 'idempotencyKeys';
+DROP TABLE `idempotencyKeys`;
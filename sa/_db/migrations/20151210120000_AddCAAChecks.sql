@@ -0,0 +1,17 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE `caaChecks` (
+  `name` varchar(255) NOT NULL,
+  -- When CAA last allowed issuance for the name
+  `checked` datetime NOT NULL,
+  PRIMARY KEY (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+INSERT INTO `schemaCapabilities` (`name`, `added`) VALUES ('caaChecks', NOW());
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DELETE FROM `schemaCapabilities` WHERE `name` = 'caaChecks';
+DROP TABLE `caaChecks`;
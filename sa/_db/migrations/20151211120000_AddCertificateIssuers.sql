@@ -0,0 +1,18 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE `certificateIssuers` (
+  `serial` varchar(255) NOT NULL,
+  -- The hex subject key ID of the issuer that signed the certificate
+  `issuerKeyID` varchar(255) NOT NULL,
+  PRIMARY KEY (`serial`),
+  KEY `issuerKeyID_idx` (`issuerKeyID`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+INSERT INTO `schemaCapabilities` (`name`, `added`) VALUES ('certificateIssuers', NOW());
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DELETE FROM `schemaCapabilities` WHERE `name` = 'certificateIssuers';
+DROP TABLE `certificateIssuers`;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Rows of certificateStatus whose certificates expired long ago are moved
+-- here by the OCSP updater, out of the way of OCSP updates and lookups
+CREATE TABLE `certificateStatusArchive` LIKE `certificateStatus`;
+
+INSERT INTO `schemaCapabilities` (`name`, `added`) VALUES ('certificateStatusArchive', NOW());
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DELETE FROM `schemaCapabilities` WHERE `name` = 'certificateStatusArchive';
+DROP TABLE `certificateStatusArchive`;
@@ -0,0 +1,24 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- The requests of processing certificate orders, kept until the orders are
+-- finalized so that an RA can resume the orders another stopped processing
+CREATE TABLE `certificateOrderRequests` (
+  `orderID` varchar(255) NOT NULL,
+  `request` mediumblob NOT NULL,
+  `attempted` datetime NOT NULL,
+  `attempts` int(11) NOT NULL,
+  PRIMARY KEY (`orderID`),
+  KEY `attempted_idx` (`attempted`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+ALTER TABLE `certificateOrders` ADD KEY `status_created_idx` (`status`, `created`);
+
+INSERT INTO `schemaCapabilities` (`name`, `added`) VALUES ('certificateOrderRequests', NOW());
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DELETE FROM `schemaCapabilities` WHERE `name` = 'certificateOrderRequests';
+ALTER TABLE `certificateOrders` DROP KEY `status_created_idx`;
+DROP TABLE `certificateOrderRequests`;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Orders not finished by when they expire are failed. Those already
+-- stored get the default order lifetime.
+ALTER TABLE `certificateOrders` ADD COLUMN `expires` datetime DEFAULT NULL;
+UPDATE `certificateOrders` SET `expires` = `created` + INTERVAL 1 DAY;
+ALTER TABLE `certificateOrders` MODIFY `expires` datetime NOT NULL;
+
+INSERT INTO `schemaCapabilities` (`name`, `added`) VALUES ('certificateOrderExpiry', NOW());
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DELETE FROM `schemaCapabilities` WHERE `name` = 'certificateOrderExpiry';
+ALTER TABLE `certificateOrders` DROP COLUMN `expires`;
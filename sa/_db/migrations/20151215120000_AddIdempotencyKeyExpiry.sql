@@ -0,0 +1,18 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Idempotency keys expire, after which the SA deletes them and the same key
+-- issues anew. Those already stored get the default lifetime.
+ALTER TABLE `idempotencyKeys` ADD COLUMN `expires` datetime DEFAULT NULL;
+UPDATE `idempotencyKeys` SET `expires` = `created` + INTERVAL 1 DAY;
+ALTER TABLE `idempotencyKeys` MODIFY `expires` datetime NOT NULL;
+ALTER TABLE `idempotencyKeys` ADD INDEX `expires_idx` (`expires`);
+
+INSERT INTO `schemaCapabilities` (`name`, `added`) VALUES ('idempotencyKeyExpiry', NOW());
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DELETE FROM `schemaCapabilities` WHERE `name` = 'idempotencyKeyExpiry';
+ALTER TABLE `idempotencyKeys` DROP INDEX `expires_idx`;
+ALTER TABLE `idempotencyKeys` DROP COLUMN `expires`;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- A certificate is replaced at most once. Of replacements already recorded
+-- for the same certificate, the first is kept.
+DELETE later FROM `replacementOrders` AS later
+  JOIN `replacementOrders` AS earlier
+  ON earlier.`replacedSerial` = later.`replacedSerial`
+  AND (earlier.`created` < later.`created`
+       OR (earlier.`created` = later.`created` AND earlier.`serial` < later.`serial`));
+ALTER TABLE `replacementOrders` DROP INDEX `replacedSerial_idx`;
+ALTER TABLE `replacementOrders` ADD UNIQUE INDEX `replacedSerial_idx` (`replacedSerial`);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE `replacementOrders` DROP INDEX `replacedSerial_idx`;
+ALTER TABLE `replacementOrders` ADD INDEX `replacedSerial_idx` (`replacedSerial`);
@@ -0,0 +1,29 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Short-lived certificates get no OCSP responses. They were kept out of the
+-- OCSP updater's work by an ocspLastUpdated of their expiry, without a
+-- response, and are now marked instead.
+ALTER TABLE `certificateStatus` ADD COLUMN `isShortLived` tinyint(1) NOT NULL DEFAULT 0;
+ALTER TABLE `certificateStatusArchive` ADD COLUMN `isShortLived` tinyint(1) NOT NULL DEFAULT 0;
+
+-- The column is recorded before the backfill, so that the OCSP updater
+-- leaves out the marked statuses as soon as their ocspLastUpdated is reset
+INSERT INTO `schemaCapabilities` (`name`, `added`) VALUES ('certificateStatusIsShortLived', NOW());
+
+UPDATE `certificateStatus` AS cs
+  JOIN `certificates` AS cert ON cert.`serial` = cs.`serial`
+  SET cs.`isShortLived` = 1, cs.`ocspLastUpdated` = 0
+  WHERE cs.`ocspLastUpdated` = cert.`expires`
+  AND COALESCE(LENGTH(cs.`ocspResponse`), 0) = 0;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+UPDATE `certificateStatus` AS cs
+  JOIN `certificates` AS cert ON cert.`serial` = cs.`serial`
+  SET cs.`ocspLastUpdated` = cert.`expires`
+  WHERE cs.`isShortLived` = 1;
+DELETE FROM `schemaCapabilities` WHERE `name` = 'certificateStatusIsShortLived';
+ALTER TABLE `certificateStatusArchive` DROP COLUMN `isShortLived`;
+ALTER TABLE `certificateStatus` DROP COLUMN `isShortLived`;
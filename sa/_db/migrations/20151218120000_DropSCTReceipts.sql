@@ -0,0 +1,35 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Once every SA and publisher records CT submissions in ctSubmissions, copy
+-- over any receipts written to sctReceipts since ctSubmissions was backfilled
+-- and drop it.
+INSERT IGNORE INTO `ctSubmissions`
+  (`certificateSerial`, `logID`, `status`, `attempts`, `lastAttempt`,
+   `sctVersion`, `timestamp`, `extensions`, `signature`, `inclusionStatus`, `LockCol`)
+  SELECT `certificateSerial`, `logID`, 'submitted', 1, FROM_UNIXTIME(`timestamp` DIV 1000),
+         `sctVersion`, `timestamp`, `extensions`, `signature`, 'unverified', 0
+  FROM `sctReceipts`;
+
+DROP TABLE `sctReceipts`;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+CREATE TABLE `sctReceipts` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `sctVersion` tinyint(1) NOT NULL,
+  `logID` varchar(255) NOT NULL,
+  `timestamp` bigint(20) NOT NULL,
+  `extensions` blob,
+  `signature` blob,
+  `certificateSerial` varchar(255) NOT NULL,
+  `LockCol` bigint(20) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `certificateSerial_logID` (`certificateSerial`, `logID`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+INSERT INTO `sctReceipts`
+  (`sctVersion`, `logID`, `timestamp`, `extensions`, `signature`, `certificateSerial`, `LockCol`)
+  SELECT `sctVersion`, `logID`, `timestamp`, `extensions`, `signature`, `certificateSerial`, 0
+  FROM `ctSubmissions` WHERE `status` = 'submitted';
@@ -0,0 +1,67 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package sa
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+// BackfillFQDNSets records the name sets of the certificates that expire
+// after now and were stored before the fqdnSets table existed, at most
+// batchSize at a time, and returns how many it recorded. Until they're
+// recorded, the certificates per FQDN set rate limit doesn't count them.
+// Like the streaming methods, it's for tools that connect to the database
+// directly.
+func (ssa *SQLStorageAuthority) BackfillFQDNSets(ctx context.Context, now time.Time, batchSize int) (int, error) {
+	backfilled, afterSerial := 0, ""
+	for {
+		var certs []core.Certificate
+		_, err := ssa.dbMap.Select(
+			&certs,
+			`SELECT cert.* FROM certificates AS cert
+			 LEFT JOIN fqdnSets AS fs
+			 ON fs.serial = cert.serial
+			 WHERE fs.serial IS NULL
+			 AND cert.expires > :now
+			 AND cert.serial > :afterSerial
+			 ORDER BY cert.serial ASC
+			 LIMIT :limit`,
+			map[string]interface{}{
+				"now":         now,
+				"afterSerial": afterSerial,
+				"limit":       batchSize,
+			},
+		)
+		if err != nil {
+			return backfilled, err
+		}
+		for _, cert := range certs {
+			parsedCertificate, err := x509.ParseCertificate(cert.DER)
+			if err != nil {
+				return backfilled, fmt.Errorf("parsing certificate %s: %s", cert.Serial, err)
+			}
+			err = ssa.dbMap.Insert(&fqdnSetModel{
+				SetHash: core.HashNames(fqdnSetNames(parsedCertificate)),
+				Serial:  cert.Serial,
+				Issued:  cert.Issued,
+				Expires: cert.Expires,
+			})
+			if err != nil {
+				return backfilled, err
+			}
+			backfilled++
+		}
+		if len(certs) < batchSize {
+			return backfilled, nil
+		}
+		afterSerial = certs[len(certs)-1].Serial
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package sa
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/sa/satest"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestBackfillFQDNSets(t *testing.T) {
+	sa, _, cleanUp := initSA(t)
+	defer cleanUp()
+
+	reg := satest.CreateWorkingRegistration(t, sa)
+	certDER, err := ioutil.ReadFile("test-cert.der")
+	test.AssertNotError(t, err, "Couldn't read test-cert.der")
+	parsed, err := x509.ParseCertificate(certDER)
+	test.AssertNotError(t, err, "Couldn't parse test-cert.der")
+	_, err = sa.AddCertificate(ctx, certDER, reg.ID)
+	test.AssertNotError(t, err, "Couldn't add test-cert.der")
+
+	// As if the certificate was stored before the fqdnSets table existed
+	_, err = sa.dbMap.Exec("DELETE FROM fqdnSets")
+	test.AssertNotError(t, err, "Couldn't delete FQDN sets")
+	exists, err := sa.FQDNSetExists(ctx, parsed.DNSNames)
+	test.AssertNotError(t, err, "FQDNSetExists failed")
+	test.Assert(t, !exists, "FQDN set exists before being backfilled")
+
+	// Expired certificates aren't backfilled
+	backfilled, err := sa.BackfillFQDNSets(ctx, parsed.NotAfter, 1)
+	test.AssertNotError(t, err, "Couldn't backfill FQDN sets")
+	test.AssertEquals(t, backfilled, 0)
+
+	backfilled, err = sa.BackfillFQDNSets(ctx, parsed.NotAfter.Add(-time.Hour), 1)
+	test.AssertNotError(t, err, "Couldn't backfill FQDN sets")
+	test.AssertEquals(t, backfilled, 1)
+	exists, err = sa.FQDNSetExists(ctx, parsed.DNSNames)
+	test.AssertNotError(t, err, "FQDNSetExists failed")
+	test.Assert(t, exists, "FQDN set wasn't backfilled")
+
+	// Certificates with a recorded set are left alone
+	backfilled, err = sa.BackfillFQDNSets(ctx, parsed.NotAfter.Add(-time.Hour), 1)
+	test.AssertNotError(t, err, "Couldn't backfill FQDN sets")
+	test.AssertEquals(t, backfilled, 0)
+}
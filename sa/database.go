@@ -144,9 +144,24 @@ func initTables(dbMap *gorp.DbMap) {
 	dbMap.AddTableWithName(authzModel{}, "authz").SetKeys(false, "ID")
 	dbMap.AddTableWithName(challModel{}, "challenges").SetKeys(true, "ID").SetVersionCol("LockCol")
 	dbMap.AddTableWithName(issuedNameModel{}, "issuedNames").SetKeys(true, "ID")
+	dbMap.AddTableWithName(fqdnSetModel{}, "fqdnSets").SetKeys(true, "ID")
 	dbMap.AddTableWithName(core.Certificate{}, "certificates").SetKeys(false, "Serial")
-	dbMap.AddTableWithName(core.CertificateStatus{}, "certificateStatus").SetKeys(false, "Serial").SetVersionCol("LockCol")
+	certStatusTable := dbMap.AddTableWithName(core.CertificateStatus{}, "certificateStatus").SetKeys(false, "Serial")
+	certStatusTable.SetVersionCol("LockCol")
+	// isShortLived is only written, and read with SELECT *, once its
+	// schema capability is recorded
+	certStatusTable.ColMap("IsShortLived").SetTransient(true)
 	dbMap.AddTableWithName(core.CRL{}, "crls").SetKeys(false, "Serial")
 	dbMap.AddTableWithName(core.DeniedCSR{}, "deniedCSRs").SetKeys(true, "ID")
+	dbMap.AddTableWithName(core.RateLimitOverride{}, "rateLimitOverrides").SetKeys(true, "ID")
+	dbMap.AddTableWithName(core.CTSubmission{}, "ctSubmissions").SetKeys(true, "ID").SetVersionCol("LockCol")
 	dbMap.AddTableWithName(core.SignedCertificateTimestamp{}, "sctReceipts").SetKeys(true, "ID").SetVersionCol("LockCol")
+	dbMap.AddTableWithName(replacementOrderModel{}, "replacementOrders").SetKeys(false, "Serial")
+	dbMap.AddTableWithName(certificateOrderModel{}, "certificateOrders").SetKeys(false, "ID")
+	dbMap.AddTableWithName(certificateOrderRequestModel{}, "certificateOrderRequests").SetKeys(false, "OrderID")
+	dbMap.AddTableWithName(core.IdempotencyKey{}, "idempotencyKeys").SetKeys(false, "RegistrationID", "Digest")
+	dbMap.AddTableWithName(transcriptModel{}, "validationTranscripts").SetKeys(true, "ID")
+	dbMap.AddTableWithName(keyHashModel{}, "keyHashToSerial").SetKeys(true, "ID")
+	dbMap.AddTableWithName(blockedKeyModel{}, "blockedKeys").SetKeys(true, "ID")
+	dbMap.AddTableWithName(certificateIssuerModel{}, "certificateIssuers").SetKeys(false, "Serial")
 }
@@ -12,7 +12,7 @@ import (
 	"net"
 	"time"
 
-	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
 	"github.com/letsencrypt/boulder/core"
 	"github.com/letsencrypt/boulder/probs"
 )
@@ -26,6 +26,120 @@ type issuedNameModel struct {
 	Serial       string    `db:"serial"`
 }
 
+// fqdnSetModel records the exact set of names, by core.HashNames, that the
+// certificate with Serial was issued for.
+type fqdnSetModel struct {
+	ID      int64     `db:"id"`
+	SetHash []byte    `db:"setHash"`
+	Serial  string    `db:"serial"`
+	Issued  time.Time `db:"issued"`
+	Expires time.Time `db:"expires"`
+}
+
+// replacementOrderModel records that the certificate with Serial was
+// requested as the replacement of the one with ReplacedSerial.
+type replacementOrderModel struct {
+	Serial         string    `db:"serial"`
+	ReplacedSerial string    `db:"replacedSerial"`
+	Created        time.Time `db:"created"`
+}
+
+// certificateOrderModel is the description of a core.CertificateOrder in
+// the database, with its Error as JSON.
+type certificateOrderModel struct {
+	ID             string          `db:"id"`
+	RegistrationID int64           `db:"registrationID"`
+	Status         core.AcmeStatus `db:"status"`
+	Serial         string          `db:"serial"`
+	Error          []byte          `db:"error"`
+	Created        time.Time       `db:"created"`
+	Expires        time.Time       `db:"expires"`
+}
+
+func certificateOrderToModel(order core.CertificateOrder) (*certificateOrderModel, error) {
+	om := &certificateOrderModel{
+		ID:             order.ID,
+		RegistrationID: order.RegistrationID,
+		Status:         order.Status,
+		Serial:         order.Serial,
+		Created:        order.Created,
+		Expires:        order.Expires,
+	}
+	if order.Error != nil {
+		errJSON, err := json.Marshal(order.Error)
+		if err != nil {
+			return nil, err
+		}
+		om.Error = errJSON
+	}
+	return om, nil
+}
+
+func modelToCertificateOrder(om *certificateOrderModel) (core.CertificateOrder, error) {
+	order := core.CertificateOrder{
+		ID:             om.ID,
+		RegistrationID: om.RegistrationID,
+		Status:         om.Status,
+		Serial:         om.Serial,
+		Created:        om.Created,
+		Expires:        om.Expires,
+	}
+	if len(om.Error) > 0 {
+		var prob probs.ProblemDetails
+		if err := json.Unmarshal(om.Error, &prob); err != nil {
+			return core.CertificateOrder{}, err
+		}
+		order.Error = &prob
+	}
+	return order, nil
+}
+
+// certificateOrderRequestModel is the request of a processing certificate
+// order, as JSON, with when an RA last began processing it and how many
+// times one has.
+type certificateOrderRequestModel struct {
+	OrderID   string    `db:"orderID"`
+	Request   []byte    `db:"request"`
+	Attempted time.Time `db:"attempted"`
+	Attempts  int       `db:"attempts"`
+}
+
+// transcriptModel is a signed core.ValidationTranscript of a successful
+// validation of one of an authorization's challenges.
+type transcriptModel struct {
+	ID            int64     `db:"id"`
+	AuthzID       string    `db:"authzID"`
+	ChallengeType string    `db:"challengeType"`
+	Transcript    []byte    `db:"transcript"`
+	Created       time.Time `db:"created"`
+}
+
+// keyHashModel records that the certificate with CertSerial, valid until
+// CertNotAfter, is for the public key whose core.KeyDigest is KeyHash.
+type keyHashModel struct {
+	ID           int64     `db:"id"`
+	KeyHash      string    `db:"keyHash"`
+	CertNotAfter time.Time `db:"certNotAfter"`
+	CertSerial   string    `db:"certSerial"`
+}
+
+// certificateIssuerModel records that the certificate with Serial was signed
+// by the issuer whose hex subject key ID is IssuerKeyID, so that certificates
+// can be told apart by intermediate once several are in use.
+type certificateIssuerModel struct {
+	Serial      string `db:"serial"`
+	IssuerKeyID string `db:"issuerKeyID"`
+}
+
+// blockedKeyModel records that no certificate may be issued for the public
+// key whose core.KeyDigest is KeyHash.
+type blockedKeyModel struct {
+	ID      int64     `db:"id"`
+	KeyHash string    `db:"keyHash"`
+	Added   time.Time `db:"added"`
+	AddedBy string    `db:"addedBy"`
+}
+
 // regModel is the description of a core.Registration in the database.
 type regModel struct {
 	ID        int64           `db:"id"`
@@ -33,10 +147,13 @@ type regModel struct {
 	KeySHA256 string          `db:"jwk_sha256"`
 	Contact   []*core.AcmeURL `db:"contact"`
 	Agreement string          `db:"agreement"`
+
+	VerifiedContacts []*core.AcmeURL `db:"verifiedContacts"`
 	// InitialIP is stored as sixteen binary bytes, regardless of whether it
 	// represents a v4 or v6 IP address.
-	InitialIP []byte    `db:"initialIp"`
-	CreatedAt time.Time `db:"createdAt"`
+	InitialIP []byte           `db:"initialIp"`
+	CreatedAt time.Time        `db:"createdAt"`
+	Tier      core.AccountTier `db:"tier"`
 	LockCol   int64
 }
 
@@ -86,12 +203,15 @@ func registrationToModel(r *core.Registration) (*regModel, error) {
 		Agreement: r.Agreement,
 		InitialIP: []byte(r.InitialIP.To16()),
 		CreatedAt: r.CreatedAt,
+		Tier:      r.Tier,
+
+		VerifiedContacts: r.VerifiedContacts,
 	}
 	return rm, nil
 }
 
 func modelToRegistration(rm *regModel) (core.Registration, error) {
-	k := &jose.JsonWebKey{}
+	k := &jose.JSONWebKey{}
 	err := json.Unmarshal(rm.Key, k)
 	if err != nil {
 		err = fmt.Errorf("unable to unmarshal JsonWebKey in db: %s", err)
@@ -104,6 +224,9 @@ func modelToRegistration(rm *regModel) (core.Registration, error) {
 		Agreement: rm.Agreement,
 		InitialIP: net.IP(rm.InitialIP),
 		CreatedAt: rm.CreatedAt,
+		Tier:      rm.Tier,
+
+		VerifiedContacts: rm.VerifiedContacts,
 	}
 	return r, nil
 }
@@ -189,7 +312,7 @@ func modelToChallenge(cm *challModel) (core.Challenge, error) {
 		c.ValidationRecord = vr
 	}
 	if len(cm.AccountKey) > 0 {
-		var ak jose.JsonWebKey
+		var ak jose.JSONWebKey
 		err := json.Unmarshal(cm.AccountKey, &ak)
 		if err != nil {
 			return core.Challenge{}, err
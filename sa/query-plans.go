@@ -0,0 +1,188 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package sa
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
+)
+
+// hotQuery is one of the SA's most frequently run queries, along with the
+// index MySQL is expected to use when running it. The args are only sample
+// values so that the query can be EXPLAINed.
+type hotQuery struct {
+	name  string
+	query string
+	args  map[string]interface{}
+	table string
+	index string
+}
+
+var hotQueries = []hotQuery{
+	{
+		name:  "GetRegistrationByKey",
+		query: getRegistrationByKeyQuery,
+		args:  map[string]interface{}{"key": "queryPlanCheck"},
+		table: "registrations",
+		index: "jwk_sha256",
+	},
+	{
+		name:  "CountRegistrationsByIP",
+		query: countRegistrationsByIPQuery,
+		args: map[string]interface{}{
+			"beginIP":  []byte{127, 0, 0, 0},
+			"endIP":    []byte{127, 0, 0, 255},
+			"earliest": time.Unix(0, 0),
+			"latest":   time.Unix(86400, 0),
+		},
+		table: "registrations",
+		index: "initialIP_createdAt",
+	},
+	{
+		name:  "GetLatestValidAuthorization",
+		query: getLatestValidAuthorizationQuery,
+		args: map[string]interface{}{
+			"identifier":     `{"type":"dns","value":"example.com"}`,
+			"registrationID": 1,
+		},
+		table: "authz",
+		index: "registrationID_identifier_status_expires_authz_idx",
+	},
+	{
+		name:  "GetReusableAuthorizations",
+		query: reusableAuthzQuery(1),
+		args: map[string]interface{}{
+			"identifier0":    `{"type":"dns","value":"example.com"}`,
+			"registrationID": 1,
+			"now":            time.Unix(0, 0),
+		},
+		table: "authz",
+		index: "registrationID_identifier_status_expires_authz_idx",
+	},
+	{
+		name:  "GetReusablePendingAuthorizations",
+		query: reusableAuthzQuery(1),
+		args: map[string]interface{}{
+			"identifier0":    `{"type":"dns","value":"example.com"}`,
+			"registrationID": 1,
+			"now":            time.Unix(0, 0),
+		},
+		table: "pendingAuthorizations",
+		index: "registrationID_identifier_status_expires_idx",
+	},
+	{
+		name:  "CountPendingAuthorizations",
+		query: countPendingAuthorizationsQuery,
+		args:  map[string]interface{}{"regID": 1, "now": time.Unix(0, 0)},
+		table: "pendingAuthorizations",
+		index: "regId_expires_idx",
+	},
+	{
+		name:  "GetChallenges",
+		query: getChallengesQuery,
+		args:  map[string]interface{}{"authID": "queryPlanCheck"},
+		table: "challenges",
+		index: "authorizationID_challenges_idx",
+	},
+	{
+		name:  "CountCertificatesByName",
+		query: countCertificatesByNameQuery,
+		args: map[string]interface{}{
+			"reversedDomain": "com.example",
+			"earliest":       time.Unix(0, 0),
+			"latest":         time.Unix(86400, 0),
+			"limit":          1,
+		},
+		table: "issuedNames",
+		index: "reversedName_notBefore_Idx",
+	},
+	{
+		name:  "CountFQDNSets",
+		query: countFQDNSetsQuery,
+		args: map[string]interface{}{
+			"setHash":  make([]byte, 32),
+			"earliest": time.Unix(0, 0),
+			"latest":   time.Unix(86400, 0),
+		},
+		table: "fqdnSets",
+		index: "setHash_issued_idx",
+	},
+	{
+		name:  "GetSerialsByKeyHash",
+		query: getSerialsByKeyHashQuery,
+		args:  map[string]interface{}{"keyHash": "queryPlanCheck", "now": time.Unix(0, 0)},
+		table: "keyHashToSerial",
+		index: "keyHash_certNotAfter_idx",
+	},
+	{
+		name:  "GetCTSubmission",
+		query: getCTSubmissionQuery,
+		args:  map[string]interface{}{"serial": "queryPlanCheck", "logID": "queryPlanCheck"},
+		table: "ctSubmissions",
+		index: "certificateSerial_logID",
+	},
+}
+
+// queryPlanRow holds the columns of MySQL's EXPLAIN output that the plan
+// check looks at.
+type queryPlanRow struct {
+	Table sql.NullString `db:"table"`
+	Type  sql.NullString `db:"type"`
+	Key   sql.NullString `db:"key"`
+	Extra sql.NullString `db:"Extra"`
+}
+
+// checkPlan returns an error if the EXPLAIN output for q shows MySQL scanning
+// the whole of q's table or using an index other than the expected one.
+func checkPlan(q hotQuery, rows []queryPlanRow) error {
+	for _, row := range rows {
+		if !row.Table.Valid || row.Table.String != q.table {
+			continue
+		}
+		if row.Type.String == "ALL" {
+			return fmt.Errorf("%s: full table scan of %s, expected index %s", q.name, q.table, q.index)
+		}
+		if !row.Key.Valid || row.Key.String == "" {
+			return fmt.Errorf("%s: no index used on %s, expected index %s", q.name, q.table, q.index)
+		}
+		if row.Key.String != q.index {
+			return fmt.Errorf("%s: index %s used on %s, expected index %s", q.name, row.Key.String, q.table, q.index)
+		}
+		return nil
+	}
+	// MySQL leaves the table out of the plan when it can tell from the
+	// indexes alone that no rows match, which doesn't say which index it
+	// would use otherwise.
+	for _, row := range rows {
+		if strings.Contains(row.Extra.String, "Impossible WHERE") ||
+			strings.Contains(row.Extra.String, "no matching row in const table") {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: %s does not appear in the query plan", q.name, q.table)
+}
+
+// CheckQueryPlans EXPLAINs the SA's hottest queries and returns an error for
+// each one MySQL would not run with the expected index, for instance after a
+// schema change or a change in table statistics.
+func (ssa *SQLStorageAuthority) CheckQueryPlans() (errs []error) {
+	for _, q := range hotQueries {
+		var rows []queryPlanRow
+		_, err := ssa.dbMap.Select(&rows, "EXPLAIN "+q.query, q.args)
+		if err != nil && !gorp.NonFatalError(err) {
+			errs = append(errs, fmt.Errorf("%s: unable to EXPLAIN query: %s", q.name, err))
+			continue
+		}
+		if err = checkPlan(q, rows); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return
+}
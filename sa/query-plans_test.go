@@ -0,0 +1,59 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package sa
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+func str(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: true}
+}
+
+func TestCheckPlan(t *testing.T) {
+	q := hotQuery{name: "GetThing", table: "things", index: "thing_idx"}
+
+	testCases := []struct {
+		rows    []queryPlanRow
+		problem string
+	}{
+		{[]queryPlanRow{{Table: str("things"), Type: str("ref"), Key: str("thing_idx")}}, ""},
+		{[]queryPlanRow{{Table: str("things"), Type: str("ALL")}}, "full table scan of things"},
+		{[]queryPlanRow{{Table: str("things"), Type: str("index_merge")}}, "no index used on things"},
+		{[]queryPlanRow{{Table: str("things"), Type: str("ref"), Key: str("PRIMARY")}}, "index PRIMARY used on things"},
+		{[]queryPlanRow{
+			{Table: str("others"), Type: str("ALL")},
+			{Table: str("things"), Type: str("range"), Key: str("thing_idx")},
+		}, ""},
+		{[]queryPlanRow{{Extra: str("Impossible WHERE noticed after reading const tables")}}, ""},
+		{[]queryPlanRow{{Extra: str("no matching row in const table")}}, ""},
+		{[]queryPlanRow{{Table: str("others"), Type: str("ref"), Key: str("other_idx")}}, "things does not appear in the query plan"},
+		{nil, "things does not appear in the query plan"},
+	}
+	for _, tc := range testCases {
+		err := checkPlan(q, tc.rows)
+		if tc.problem == "" {
+			test.AssertNotError(t, err, "Expected plan was rejected")
+			continue
+		}
+		test.AssertError(t, err, "Bad plan was accepted")
+		test.Assert(t, strings.Contains(err.Error(), tc.problem),
+			"Unexpected problem: "+err.Error())
+	}
+}
+
+func TestHotQueryPlans(t *testing.T) {
+	sa, _, cleanUp := initSA(t)
+	defer cleanUp()
+
+	for _, err := range sa.CheckQueryPlans() {
+		t.Error(err)
+	}
+}
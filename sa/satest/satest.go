@@ -1,12 +1,13 @@
 package satest
 
 import (
+	"context"
 	"encoding/json"
 	"net"
 	"testing"
 	"time"
 
-	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
 	"github.com/letsencrypt/boulder/core"
 )
 
@@ -22,8 +23,8 @@ var theKey = `{
 // SQLSAImpl. Long term, when the CA tests no longer need
 // CreateWorkingRegistration, this and CreateWorkingRegistration can
 // be pushed back into the SA tests proper.
-func GoodJWK() jose.JsonWebKey {
-	var jwk jose.JsonWebKey
+func GoodJWK() jose.JSONWebKey {
+	var jwk jose.JSONWebKey
 	err := json.Unmarshal([]byte(theKey), &jwk)
 	if err != nil {
 		panic("known-good theKey is no longer known-good")
@@ -43,7 +44,7 @@ func CreateWorkingRegistration(t *testing.T, sa core.StorageAuthority) core.Regi
 		t.Fatalf("unable to parse contact link: %s", err)
 	}
 	contacts := []*core.AcmeURL{contact}
-	reg, err := sa.NewRegistration(core.Registration{
+	reg, err := sa.NewRegistration(context.Background(), core.Registration{
 		Key:       GoodJWK(),
 		Contact:   contacts,
 		InitialIP: net.ParseIP("88.77.66.11"),
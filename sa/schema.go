@@ -0,0 +1,240 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package sa
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/go-sql-driver/mysql"
+	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
+	"github.com/letsencrypt/boulder/core"
+)
+
+// Schema capabilities are recorded in the schemaCapabilities table by the
+// migration that makes the schema change they name, in the same migration,
+// once the change is complete. The SA only uses the tables and columns
+// behind a capability once it's recorded, so that it can be deployed before
+// the migration as well as after.
+const (
+	// CapabilityKeyHashes is the keyHashToSerial table
+	CapabilityKeyHashes = "keyHashToSerial"
+	// CapabilityBlockedKeys is the blockedKeys table
+	CapabilityBlockedKeys = "blockedKeys"
+	// CapabilityCertificateOrders is the certificateOrders table
+	CapabilityCertificateOrders = "certificateOrders"
+	// CapabilityCTSubmissions is the ctSubmissions table, which replaces
+	// sctReceipts
+	CapabilityCTSubmissions = "ctSubmissions"
+	// CapabilityIdempotencyKeys is the idempotencyKeys table
+	CapabilityIdempotencyKeys = "idempotencyKeys"
+	// CapabilityCAAChecks is the caaChecks table
+	CapabilityCAAChecks = "caaChecks"
+	// CapabilityCertificateIssuers is the certificateIssuers table
+	CapabilityCertificateIssuers = "certificateIssuers"
+	// CapabilityCertificateStatusArchive is the certificateStatusArchive
+	// table
+	CapabilityCertificateStatusArchive = "certificateStatusArchive"
+	// CapabilityCertificateOrderRequests is the certificateOrderRequests
+	// table
+	CapabilityCertificateOrderRequests = "certificateOrderRequests"
+	// CapabilityCertificateOrderExpiry is the expires column of
+	// certificateOrders
+	CapabilityCertificateOrderExpiry = "certificateOrderExpiry"
+	// CapabilityIdempotencyKeyExpiry is the expires column of
+	// idempotencyKeys
+	CapabilityIdempotencyKeyExpiry = "idempotencyKeyExpiry"
+	// CapabilityCertificateStatusIsShortLived is the isShortLived column of
+	// certificateStatus and certificateStatusArchive
+	CapabilityCertificateStatusIsShortLived = "certificateStatusIsShortLived"
+)
+
+// mysqlNoSuchTable is the MySQL error number for a missing table
+const mysqlNoSuchTable = 1146
+
+// mysqlDuplicateEntry is the MySQL error number for an insert of a row with
+// the same primary or unique key as another
+const mysqlDuplicateEntry = 1062
+
+// schemaCapabilities are the capabilities last read from the database.
+// Until they've been read, names is nil and no capability is known to be
+// either present or missing.
+type schemaCapabilities struct {
+	mu    sync.RWMutex
+	names map[string]bool
+}
+
+func (sc *schemaCapabilities) has(name string) (has, known bool) {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.names[name], sc.names != nil
+}
+
+func (sc *schemaCapabilities) set(names []string) {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	sc.mu.Lock()
+	sc.names = set
+	sc.mu.Unlock()
+}
+
+// LoadSchemaCapabilities reads the schema capabilities recorded by the
+// migrations run so far, returning their names. Until the migration adding
+// the schemaCapabilities table itself is run, there are none. The SA loads
+// them when created, and should reload them periodically to pick up
+// migrations run while it's up. A failed reload leaves the capabilities
+// last read in place.
+func (ssa *SQLStorageAuthority) LoadSchemaCapabilities() ([]string, error) {
+	var names []string
+	_, err := ssa.dbMap.Select(&names, "SELECT name FROM schemaCapabilities")
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == mysqlNoSuchTable {
+		names, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ssa.capabilities.set(names)
+	return names, nil
+}
+
+// SchemaCapable returns whether the schema capability name has been
+// recorded in the database behind dbMap, for the tools that query it
+// directly rather than through the SA. Until the migration adding the
+// schemaCapabilities table is run, none has been.
+func SchemaCapable(dbMap *gorp.DbMap, name string) (bool, error) {
+	count, err := dbMap.SelectInt("SELECT COUNT(*) FROM schemaCapabilities WHERE name = ?", name)
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == mysqlNoSuchTable {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// capable returns whether the schema capability name has been recorded. It
+// returns an error rather than false if the capabilities have never been
+// read, so that tables that may exist aren't taken to be missing; only a
+// capability confirmed missing is reported as such.
+func (ssa *SQLStorageAuthority) capable(name string) (bool, error) {
+	has, known := ssa.capabilities.has(name)
+	if !known {
+		return false, core.InternalServerError("Database schema capabilities haven't been loaded")
+	}
+	return has, nil
+}
+
+// requireCapability returns a NotSupportedError if the schema capability
+// name hasn't been recorded yet.
+func (ssa *SQLStorageAuthority) requireCapability(name string) error {
+	has, err := ssa.capable(name)
+	if err != nil {
+		return err
+	}
+	if !has {
+		return core.NotSupportedError(fmt.Sprintf("Database schema lacks %s; its migration hasn't been run", name))
+	}
+	return nil
+}
+
+// ddlStatements are the first words of the statements that change the
+// schema.
+var ddlStatements = map[string]bool{
+	"ALTER":    true,
+	"CREATE":   true,
+	"DROP":     true,
+	"RENAME":   true,
+	"TRUNCATE": true,
+	"OPTIMIZE": true,
+}
+
+// ddlTable returns the table a DDL statement changes, or false if the
+// statement isn't DDL on a table.
+func ddlTable(statement string) (string, bool) {
+	words := strings.Fields(statement)
+	if len(words) < 2 || !ddlStatements[strings.ToUpper(words[0])] {
+		return "", false
+	}
+	// The table follows TABLE, or ON for CREATE and DROP INDEX; TABLE is
+	// optional after TRUNCATE
+	i := 1
+	for i < len(words) && !strings.EqualFold(words[i], "TABLE") && !strings.EqualFold(words[i], "ON") {
+		i++
+	}
+	if i == len(words) {
+		if !strings.EqualFold(words[0], "TRUNCATE") {
+			return "", false
+		}
+		i = 0
+	}
+	rest := words[i+1:]
+	for len(rest) > 0 && (strings.EqualFold(rest[0], "IF") || strings.EqualFold(rest[0], "NOT") || strings.EqualFold(rest[0], "EXISTS")) {
+		rest = rest[1:]
+	}
+	if len(rest) == 0 {
+		return "", false
+	}
+	table := rest[0]
+	if end := strings.IndexAny(table, "(;"); end >= 0 {
+		table = table[:end]
+	}
+	// Drop the database name
+	if dot := strings.LastIndex(table, "."); dot >= 0 {
+		table = table[dot+1:]
+	}
+	table = strings.Trim(table, "`")
+	return table, table != ""
+}
+
+// runningStatement is a statement MySQL is running, from its process list.
+type runningStatement struct {
+	ID   int64          `db:"ID"`
+	Time int64          `db:"TIME"`
+	Info sql.NullString `db:"INFO"`
+}
+
+// unexpectedDDL returns an error for each of running that is DDL, has run
+// for longer than maxDuration, and isn't on one of expectedTables.
+func unexpectedDDL(running []runningStatement, maxDuration time.Duration, expectedTables []string) (errs []error) {
+	expected := make(map[string]bool, len(expectedTables))
+	for _, table := range expectedTables {
+		expected[strings.ToLower(table)] = true
+	}
+	for _, s := range running {
+		if !s.Info.Valid || time.Duration(s.Time)*time.Second <= maxDuration {
+			continue
+		}
+		table, ok := ddlTable(s.Info.String)
+		if !ok || expected[strings.ToLower(table)] {
+			continue
+		}
+		errs = append(errs, fmt.Errorf("Unexpected schema change of %s running for %ds (process %d): %.200s",
+			table, s.Time, s.ID, s.Info.String))
+	}
+	return
+}
+
+// CheckSchemaChanges returns an error for each DDL statement that has run
+// for longer than maxDuration on a table other than expectedTables, which
+// are those an operator has announced an online schema change of. Long DDL
+// can lock tables the SA needs; an unannounced one is likely a mistake. The
+// SA's database user needs the PROCESS privilege to see statements run by
+// other users.
+func (ssa *SQLStorageAuthority) CheckSchemaChanges(maxDuration time.Duration, expectedTables []string) []error {
+	var running []runningStatement
+	_, err := ssa.dbMap.Select(&running,
+		"SELECT ID, TIME, INFO FROM information_schema.PROCESSLIST WHERE COMMAND = 'Query' AND TIME > :seconds",
+		map[string]interface{}{"seconds": int64(maxDuration / time.Second)})
+	if err != nil {
+		return []error{fmt.Errorf("Unable to list running statements: %s", err)}
+	}
+	return unexpectedDDL(running, maxDuration, expectedTables)
+}
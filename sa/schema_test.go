@@ -0,0 +1,106 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package sa
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestDDLTable(t *testing.T) {
+	testCases := []struct {
+		statement string
+		table     string
+	}{
+		{"ALTER TABLE certificates ADD COLUMN foo int", "certificates"},
+		{"alter table `boulder_sa`.`certificates` add index foo (bar)", "certificates"},
+		{"CREATE TABLE IF NOT EXISTS `things` (`id` int)", "things"},
+		{"CREATE TABLE things(id int)", "things"},
+		{"CREATE INDEX foo ON authz (expires)", "authz"},
+		{"DROP INDEX foo ON authz;", "authz"},
+		{"DROP TABLE IF EXISTS things;", "things"},
+		{"TRUNCATE things", "things"},
+		{"OPTIMIZE TABLE certificateStatus", "certificateStatus"},
+		{"SELECT * FROM certificates", ""},
+		{"CREATE DATABASE foo", ""},
+		{"ALTER TABLE", ""},
+	}
+	for _, tc := range testCases {
+		table, ok := ddlTable(tc.statement)
+		test.AssertEquals(t, ok, tc.table != "")
+		test.AssertEquals(t, table, tc.table)
+	}
+}
+
+func TestUnexpectedDDL(t *testing.T) {
+	running := []runningStatement{
+		{ID: 1, Time: 3600, Info: str("ALTER TABLE certificates ADD COLUMN foo int")},
+		{ID: 2, Time: 3600, Info: str("ALTER TABLE authz ADD INDEX bar (baz)")},
+		{ID: 3, Time: 30, Info: str("ALTER TABLE registrations ADD COLUMN foo int")},
+		{ID: 4, Time: 3600, Info: str("SELECT SLEEP(3600)")},
+		{ID: 5, Time: 3600},
+	}
+	errs := unexpectedDDL(running, time.Minute, []string{"Authz"})
+	test.AssertEquals(t, len(errs), 1)
+	test.Assert(t, strings.Contains(errs[0].Error(), "of certificates"), "Wrong table reported")
+	test.Assert(t, strings.Contains(errs[0].Error(), "process 1"), "Wrong process reported")
+
+	test.AssertEquals(t, len(unexpectedDDL(running, 2*time.Hour, nil)), 0)
+}
+
+func TestRequireCapability(t *testing.T) {
+	// Capabilities that haven't been loaded are neither present nor missing
+	ssa := &SQLStorageAuthority{}
+	err := ssa.requireCapability(CapabilityCertificateOrders)
+	_, ok := err.(core.InternalServerError)
+	test.Assert(t, ok, "Unknown capability wasn't an InternalServerError")
+	_, err = ssa.KeyBlocked(ctx, "digest")
+	test.AssertError(t, err, "KeyBlocked succeeded without capabilities")
+
+	ssa.capabilities.set(nil)
+	err = ssa.requireCapability(CapabilityCertificateOrders)
+	_, ok = err.(core.NotSupportedError)
+	test.Assert(t, ok, "Missing capability wasn't a NotSupportedError")
+
+	ssa.capabilities.set([]string{CapabilityCertificateOrders})
+	test.AssertNotError(t, ssa.requireCapability(CapabilityCertificateOrders), "Capability not found")
+	capable, err := ssa.capable(CapabilityBlockedKeys)
+	test.AssertNotError(t, err, "Loaded capabilities unknown")
+	test.Assert(t, !capable, "Unrecorded capability found")
+
+	blocked, err := ssa.KeyBlocked(ctx, "digest")
+	test.AssertNotError(t, err, "KeyBlocked failed without blockedKeys")
+	test.Assert(t, !blocked, "Key blocked without blockedKeys")
+
+	err = ssa.RecordCTInclusion(ctx, "serial", "log", core.CTInclusionVerified)
+	_, ok = err.(core.NotSupportedError)
+	test.Assert(t, ok, "RecordCTInclusion without ctSubmissions wasn't a NotSupportedError")
+}
+
+func TestLoadSchemaCapabilities(t *testing.T) {
+	sa, _, cleanUp := initSA(t)
+	defer cleanUp()
+
+	names, err := sa.LoadSchemaCapabilities()
+	test.AssertNotError(t, err, "LoadSchemaCapabilities failed")
+	for _, name := range []string{CapabilityKeyHashes, CapabilityBlockedKeys, CapabilityCertificateOrders, CapabilityCTSubmissions, CapabilityIdempotencyKeys, CapabilityCAAChecks, CapabilityCertificateIssuers, CapabilityCertificateStatusArchive, CapabilityCertificateOrderRequests, CapabilityCertificateOrderExpiry, CapabilityIdempotencyKeyExpiry, CapabilityCertificateStatusIsShortLived} {
+		capable, err := sa.capable(name)
+		test.AssertNotError(t, err, "Loaded capabilities unknown")
+		test.Assert(t, capable, "Missing capability "+name)
+	}
+	test.AssertEquals(t, len(names), 12)
+
+	capable, err := SchemaCapable(sa.dbMap, CapabilityCertificateStatusIsShortLived)
+	test.AssertNotError(t, err, "SchemaCapable failed")
+	test.Assert(t, capable, "Missing capability "+CapabilityCertificateStatusIsShortLived)
+	capable, err = SchemaCapable(sa.dbMap, "nonexistent")
+	test.AssertNotError(t, err, "SchemaCapable failed")
+	test.Assert(t, !capable, "Unrecorded capability found")
+}
@@ -6,9 +6,11 @@
 package sa
 
 import (
+	"context"
 	"crypto/sha256"
 	"crypto/x509"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -18,20 +20,70 @@ import (
 	"strings"
 	"time"
 
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/go-sql-driver/mysql"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
-	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
 	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
+	"github.com/letsencrypt/boulder/chaos"
 	"github.com/letsencrypt/boulder/core"
+	berrors "github.com/letsencrypt/boulder/errors"
+	"github.com/letsencrypt/boulder/identifier"
 	blog "github.com/letsencrypt/boulder/log"
 )
 
-const getChallengesQuery = "SELECT * FROM challenges WHERE authorizationID = :authID ORDER BY id ASC"
+// The queries the SA runs most often. CheckQueryPlans verifies that MySQL
+// runs each of them using an index.
+const (
+	getChallengesQuery = "SELECT * FROM challenges WHERE authorizationID = :authID ORDER BY id ASC"
+
+	getRegistrationByKeyQuery = "SELECT * FROM registrations WHERE jwk_sha256 = :key"
+
+	getLatestValidAuthorizationQuery = "SELECT id FROM authz " +
+		"WHERE identifier = :identifier AND registrationID = :registrationID AND status = 'valid' " +
+		"ORDER BY expires DESC LIMIT 1"
+
+	countRegistrationsByIPQuery = `SELECT COUNT(1) FROM registrations
+		 WHERE 
+		 :beginIP <= initialIP AND
+		 initialIP < :endIP AND
+		 :earliest < createdAt AND
+		 createdAt <= :latest`
+
+	countCertificatesByNameQuery = `SELECT serial from issuedNames
+		 WHERE (reversedName = :reversedDomain OR
+			      reversedName LIKE CONCAT(:reversedDomain, ".%"))
+		 AND notBefore > :earliest AND notBefore <= :latest
+		 LIMIT :limit;`
+
+	countFQDNSetsQuery = `SELECT COUNT(1) FROM fqdnSets
+		 WHERE setHash = :setHash
+		 AND issued > :earliest AND issued <= :latest`
+
+	// Authorizations held for an operator's review aren't counted: the
+	// client is done with them
+	countPendingAuthorizationsQuery = `SELECT count(1) FROM pendingAuthorizations
+		 WHERE registrationID = :regID AND
+				expires > :now AND
+				status != 'pending-review'`
+
+	getPendingReviewAuthorizationsQuery = `SELECT id, identifier, registrationID, status, expires FROM pendingAuthorizations
+		 WHERE status = 'pending-review' AND expires > :now
+		 ORDER BY expires`
+
+	getSerialsByKeyHashQuery = `SELECT certSerial FROM keyHashToSerial
+		 WHERE keyHash = :keyHash AND certNotAfter > :now`
+
+	getCTSubmissionQuery = "SELECT * FROM ctSubmissions WHERE certificateSerial = :serial AND logID = :logID"
+	getSCTReceiptQuery   = "SELECT * FROM sctReceipts WHERE certificateSerial = :serial AND logID = :logID"
+)
 
 // SQLStorageAuthority defines a Storage Authority
 type SQLStorageAuthority struct {
 	dbMap *gorp.DbMap
 	clk   clock.Clock
 	log   *blog.AuditLogger
+
+	capabilities schemaCapabilities
 }
 
 func digest256(data []byte) []byte {
@@ -64,6 +116,13 @@ func NewSQLStorageAuthority(dbMap *gorp.DbMap, clk clock.Clock) (*SQLStorageAuth
 		log:   logger,
 	}
 
+	// Without the schema capabilities the SA can't tell a missing table
+	// from one it failed to ask about, so it refuses to start rather than
+	// skip the tables behind them
+	if _, err := ssa.LoadSchemaCapabilities(); err != nil {
+		return nil, fmt.Errorf("Unable to load schema capabilities: %s", err)
+	}
+
 	return ssa, nil
 }
 
@@ -73,7 +132,8 @@ func (ssa *SQLStorageAuthority) SetSQLDebug(state bool) {
 }
 
 func statusIsPending(status core.AcmeStatus) bool {
-	return status == core.StatusPending || status == core.StatusProcessing || status == core.StatusUnknown
+	return status == core.StatusPending || status == core.StatusProcessing ||
+		status == core.StatusPendingReview || status == core.StatusUnknown
 }
 
 func existingPending(tx *gorp.Transaction, id string) bool {
@@ -88,10 +148,19 @@ func existingFinal(tx *gorp.Transaction, id string) bool {
 	return count > 0
 }
 
-func existingRegistration(tx *gorp.Transaction, id int64) bool {
+// checkRegistrationExists returns a NoSuchRegistrationError if there's no
+// registration with the given ID, so that rows referring to one fail with a
+// typed error before the database's foreign key constraints reject them.
+func checkRegistrationExists(tx *gorp.Transaction, id int64) error {
 	var count int64
-	_ = tx.SelectOne(&count, "SELECT count(*) FROM registrations WHERE id = :id", map[string]interface{}{"id": id})
-	return count > 0
+	err := tx.SelectOne(&count, "SELECT count(*) FROM registrations WHERE id = :id", map[string]interface{}{"id": id})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return core.NoSuchRegistrationError(fmt.Sprintf("No registrations with ID %d", id))
+	}
+	return nil
 }
 
 func updateChallenges(authID string, challenges []core.Challenge, tx *gorp.Transaction) error {
@@ -122,7 +191,7 @@ func updateChallenges(authID string, challenges []core.Challenge, tx *gorp.Trans
 }
 
 // GetRegistration obtains a Registration by ID
-func (ssa *SQLStorageAuthority) GetRegistration(id int64) (core.Registration, error) {
+func (ssa *SQLStorageAuthority) GetRegistration(ctx context.Context, id int64) (core.Registration, error) {
 	regObj, err := ssa.dbMap.Get(regModel{}, id)
 	if err != nil {
 		return core.Registration{}, err
@@ -139,13 +208,13 @@ func (ssa *SQLStorageAuthority) GetRegistration(id int64) (core.Registration, er
 }
 
 // GetRegistrationByKey obtains a Registration by JWK
-func (ssa *SQLStorageAuthority) GetRegistrationByKey(key jose.JsonWebKey) (core.Registration, error) {
+func (ssa *SQLStorageAuthority) GetRegistrationByKey(ctx context.Context, key jose.JSONWebKey) (core.Registration, error) {
 	reg := &regModel{}
 	sha, err := core.KeyDigest(key.Key)
 	if err != nil {
 		return core.Registration{}, err
 	}
-	err = ssa.dbMap.SelectOne(reg, "SELECT * FROM registrations WHERE jwk_sha256 = :key", map[string]interface{}{"key": sha})
+	err = ssa.dbMap.SelectOne(reg, getRegistrationByKeyQuery, map[string]interface{}{"key": sha})
 
 	if err == sql.ErrNoRows {
 		msg := fmt.Sprintf("No registrations with public key sha256 %s", sha)
@@ -159,7 +228,7 @@ func (ssa *SQLStorageAuthority) GetRegistrationByKey(key jose.JsonWebKey) (core.
 }
 
 // GetAuthorization obtains an Authorization by ID
-func (ssa *SQLStorageAuthority) GetAuthorization(id string) (authz core.Authorization, err error) {
+func (ssa *SQLStorageAuthority) GetAuthorization(ctx context.Context, id string) (authz core.Authorization, err error) {
 	tx, err := ssa.dbMap.Begin()
 	if err != nil {
 		return
@@ -180,7 +249,7 @@ func (ssa *SQLStorageAuthority) GetAuthorization(id string) (authz core.Authoriz
 			return
 		}
 		if authObj == nil {
-			err = fmt.Errorf("No pendingAuthorization or authz with ID %s", id)
+			err = berrors.NotFoundError("No pendingAuthorization or authz with ID %s", id)
 			tx.Rollback()
 			return
 		}
@@ -214,21 +283,168 @@ func (ssa *SQLStorageAuthority) GetAuthorization(id string) (authz core.Authoriz
 }
 
 // GetLatestValidAuthorization gets the valid authorization with biggest expire date for a given domain and registrationId
-func (ssa *SQLStorageAuthority) GetLatestValidAuthorization(registrationID int64, identifier core.AcmeIdentifier) (authz core.Authorization, err error) {
+func (ssa *SQLStorageAuthority) GetLatestValidAuthorization(ctx context.Context, registrationID int64, identifier identifier.ACMEIdentifier) (authz core.Authorization, err error) {
 	ident, err := json.Marshal(identifier)
 	if err != nil {
 		return
 	}
 	var auth core.Authorization
-	err = ssa.dbMap.SelectOne(&auth, "SELECT id FROM authz "+
-		"WHERE identifier = :identifier AND registrationID = :registrationID AND status = 'valid' "+
-		"ORDER BY expires DESC LIMIT 1",
+	err = ssa.dbMap.SelectOne(&auth, getLatestValidAuthorizationQuery,
 		map[string]interface{}{"identifier": string(ident), "registrationID": registrationID})
+	if err == sql.ErrNoRows {
+		err = berrors.NotFoundError("No valid authorization for %s", identifier.Value)
+		return
+	}
 	if err != nil {
 		return
 	}
 
-	return ssa.GetAuthorization(auth.ID)
+	return ssa.GetAuthorization(ctx, auth.ID)
+}
+
+// GetAuthorizations returns, for each of the given DNS names and email
+// addresses, the authorization of the given registration that matters most
+// for issuance at time now: the valid, unexpired authorization that expires
+// last if there is one, otherwise whichever authorization in any state
+// expires last. Names without any authorization are absent from the result.
+// Both the final and pending tables are searched in a single query, and
+// challenges are not loaded.
+func (ssa *SQLStorageAuthority) GetAuthorizations(ctx context.Context, registrationID int64, names []string, now time.Time) (map[string]*core.Authorization, error) {
+	if len(names) == 0 {
+		return map[string]*core.Authorization{}, nil
+	}
+	params := map[string]interface{}{"registrationID": registrationID}
+	var qmarks []string
+	for i, name := range names {
+		ident, err := json.Marshal(identifier.FromValue(name))
+		if err != nil {
+			return nil, err
+		}
+		param := fmt.Sprintf("identifier%d", i)
+		params[param] = string(ident)
+		qmarks = append(qmarks, ":"+param)
+	}
+	in := strings.Join(qmarks, ", ")
+
+	var authzs []core.Authorization
+	_, err := ssa.dbMap.Select(&authzs,
+		`SELECT id, identifier, registrationID, status, expires FROM authz
+		 WHERE registrationID = :registrationID AND identifier IN (`+in+`)
+		 UNION ALL
+		 SELECT id, identifier, registrationID, status, expires FROM pendingAuthorizations
+		 WHERE registrationID = :registrationID AND identifier IN (`+in+`)`,
+		params)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*core.Authorization)
+	for i := range authzs {
+		authz := &authzs[i]
+		current, ok := byName[authz.Identifier.Value]
+		if !ok || moreRelevantAuthz(authz, current, now) {
+			byName[authz.Identifier.Value] = authz
+		}
+	}
+	return byName, nil
+}
+
+// reusableAuthzQuery selects the valid and pending authorizations of
+// :registrationID that are unexpired at :now, for n identifiers given as
+// :identifier0 onward.
+func reusableAuthzQuery(n int) string {
+	var qmarks []string
+	for i := 0; i < n; i++ {
+		qmarks = append(qmarks, fmt.Sprintf(":identifier%d", i))
+	}
+	in := strings.Join(qmarks, ", ")
+	return `SELECT id, identifier, registrationID, status, expires, combinations FROM authz
+		 WHERE registrationID = :registrationID AND identifier IN (` + in + `)
+		 AND status = 'valid' AND expires > :now
+		 UNION ALL
+		 SELECT id, identifier, registrationID, status, expires, combinations FROM pendingAuthorizations
+		 WHERE registrationID = :registrationID AND identifier IN (` + in + `)
+		 AND status = 'pending' AND expires > :now`
+}
+
+// GetReusableAuthorizations returns, for each of the given DNS names and
+// email addresses, the authorization of the given registration that a new
+// request for it could be given instead of a new one: the valid authorization
+// that expires last if there is one unexpired at time now, otherwise the
+// unexpired pending authorization that expires last. Names without one are
+// absent from the result. The authorizations are found in a single query,
+// and their challenges loaded in another.
+func (ssa *SQLStorageAuthority) GetReusableAuthorizations(ctx context.Context, registrationID int64, names []string, now time.Time) (map[string]*core.Authorization, error) {
+	if len(names) == 0 {
+		return map[string]*core.Authorization{}, nil
+	}
+	params := map[string]interface{}{"registrationID": registrationID, "now": now}
+	for i, name := range names {
+		ident, err := json.Marshal(identifier.FromValue(name))
+		if err != nil {
+			return nil, err
+		}
+		params[fmt.Sprintf("identifier%d", i)] = string(ident)
+	}
+
+	var authzs []core.Authorization
+	_, err := ssa.dbMap.Select(&authzs, reusableAuthzQuery(len(names)), params)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*core.Authorization)
+	byID := make(map[string]*core.Authorization)
+	for i := range authzs {
+		authz := &authzs[i]
+		current, ok := byName[authz.Identifier.Value]
+		if !ok || moreRelevantAuthz(authz, current, now) {
+			byName[authz.Identifier.Value] = authz
+		}
+	}
+	if len(byName) == 0 {
+		return byName, nil
+	}
+
+	challParams := make(map[string]interface{})
+	var qmarks []string
+	for _, authz := range byName {
+		byID[authz.ID] = authz
+		param := fmt.Sprintf("authID%d", len(qmarks))
+		challParams[param] = authz.ID
+		qmarks = append(qmarks, ":"+param)
+	}
+	var challObjs []challModel
+	_, err = ssa.dbMap.Select(&challObjs,
+		"SELECT * FROM challenges WHERE authorizationID IN ("+strings.Join(qmarks, ", ")+") ORDER BY id ASC",
+		challParams)
+	if err != nil {
+		return nil, err
+	}
+	for i := range challObjs {
+		chall, err := modelToChallenge(&challObjs[i])
+		if err != nil {
+			return nil, err
+		}
+		authz := byID[challObjs[i].AuthorizationID]
+		authz.Challenges = append(authz.Challenges, chall)
+	}
+	return byName, nil
+}
+
+// moreRelevantAuthz reports whether a is a better basis for issuance at time
+// now than b: usable authorizations beat unusable ones, and otherwise the one
+// that expires last wins.
+func moreRelevantAuthz(a, b *core.Authorization, now time.Time) bool {
+	aUsable := a.Status == core.StatusValid && a.Expires != nil && a.Expires.After(now)
+	bUsable := b.Status == core.StatusValid && b.Expires != nil && b.Expires.After(now)
+	if aUsable != bUsable {
+		return aUsable
+	}
+	if a.Expires == nil || b.Expires == nil {
+		return b.Expires == nil && a.Expires != nil
+	}
+	return a.Expires.After(*b.Expires)
 }
 
 // incrementIP returns a copy of `ip` incremented at a bit index `index`,
@@ -281,17 +497,12 @@ func ipRange(ip net.IP) (net.IP, net.IP) {
 // time range in an IP range. For IPv4 addresses, that range is limited to the
 // single IP. For IPv6 addresses, that range is a /48, since it's not uncommon
 // for one person to have a /48 to themselves.
-func (ssa *SQLStorageAuthority) CountRegistrationsByIP(ip net.IP, earliest time.Time, latest time.Time) (int, error) {
+func (ssa *SQLStorageAuthority) CountRegistrationsByIP(ctx context.Context, ip net.IP, earliest time.Time, latest time.Time) (int, error) {
 	var count int64
 	beginIP, endIP := ipRange(ip)
 	err := ssa.dbMap.SelectOne(
 		&count,
-		`SELECT COUNT(1) FROM registrations
-		 WHERE 
-		 :beginIP <= initialIP AND
-		 initialIP < :endIP AND
-		 :earliest < createdAt AND
-		 createdAt <= :latest`,
+		countRegistrationsByIPQuery,
 		map[string]interface{}{
 			"ip":       ip.String(),
 			"earliest": earliest,
@@ -317,14 +528,16 @@ func (t TooManyCertificatesError) Error() string {
 // certificates issued in the given time range for that domain and its
 // subdomains. It returns a map from domains to counts, which is guaranteed to
 // contain an entry for each input domain, so long as err is nil.
-// The highest count this function can return is 10,000. If there are more
-// certificates than that matching one ofthe provided domain names, it will return
-// TooManyCertificatesError.
-func (ssa *SQLStorageAuthority) CountCertificatesByNames(domains []string, earliest, latest time.Time) (map[string]int, error) {
+// The highest count this function can return is 10,000: domains with more
+// certificates than that are counted as 10,000, which is over any
+// certificatesPerName threshold the RA can enforce.
+func (ssa *SQLStorageAuthority) CountCertificatesByNames(ctx context.Context, domains []string, earliest, latest time.Time) (map[string]int, error) {
 	ret := make(map[string]int, len(domains))
 	for _, domain := range domains {
 		currentCount, err := ssa.countCertificatesByName(domain, earliest, latest)
-		if err != nil {
+		if _, ok := err.(TooManyCertificatesError); ok {
+			ssa.log.Info(err.Error())
+		} else if err != nil {
 			return ret, err
 		}
 		ret[domain] = currentCount
@@ -339,18 +552,13 @@ func (ssa *SQLStorageAuthority) CountCertificatesByNames(domains []string, earli
 // certificates than that matching one ofthe provided domain names, it will return
 // TooManyCertificatesError.
 func (ssa *SQLStorageAuthority) countCertificatesByName(domain string, earliest, latest time.Time) (int, error) {
-	var count int64
 	const max = 10000
 	var serials []struct {
 		Serial string
 	}
 	_, err := ssa.dbMap.Select(
 		&serials,
-		`SELECT serial from issuedNames
-		 WHERE (reversedName = :reversedDomain OR
-			      reversedName LIKE CONCAT(:reversedDomain, ".%"))
-		 AND notBefore > :earliest AND notBefore <= :latest
-		 LIMIT :limit;`,
+		countCertificatesByNameQuery,
 		map[string]interface{}{
 			"reversedDomain": core.ReverseName(domain),
 			"earliest":       earliest,
@@ -361,7 +569,7 @@ func (ssa *SQLStorageAuthority) countCertificatesByName(domain string, earliest,
 		return 0, nil
 	} else if err != nil {
 		return -1, err
-	} else if count > max {
+	} else if len(serials) > max {
 		return max, TooManyCertificatesError(fmt.Sprintf("More than %d issuedName entries for %s.", max, domain))
 	}
 	serialMap := make(map[string]struct{}, len(serials))
@@ -372,9 +580,36 @@ func (ssa *SQLStorageAuthority) countCertificatesByName(domain string, earliest,
 	return len(serialMap), nil
 }
 
+// CountFQDNSets returns the number of certificates issued in the given
+// time range for exactly the set of names.
+func (ssa *SQLStorageAuthority) CountFQDNSets(ctx context.Context, names []string, earliest, latest time.Time) (int64, error) {
+	var count int64
+	err := ssa.dbMap.SelectOne(
+		&count,
+		countFQDNSetsQuery,
+		map[string]interface{}{
+			"setHash":  core.HashNames(names),
+			"earliest": earliest,
+			"latest":   latest,
+		})
+	return count, err
+}
+
+// FQDNSetExists returns whether a certificate has ever been issued for
+// exactly the set of names.
+func (ssa *SQLStorageAuthority) FQDNSetExists(ctx context.Context, names []string) (bool, error) {
+	var count int64
+	err := ssa.dbMap.SelectOne(
+		&count,
+		"SELECT COUNT(1) FROM fqdnSets WHERE setHash = :setHash LIMIT 1",
+		map[string]interface{}{"setHash": core.HashNames(names)},
+	)
+	return count > 0, err
+}
+
 // GetCertificate takes a serial number and returns the corresponding
 // certificate, or error if it does not exist.
-func (ssa *SQLStorageAuthority) GetCertificate(serial string) (core.Certificate, error) {
+func (ssa *SQLStorageAuthority) GetCertificate(ctx context.Context, serial string) (core.Certificate, error) {
 	if !core.ValidSerial(serial) {
 		err := fmt.Errorf("Invalid certificate serial %s", serial)
 		return core.Certificate{}, err
@@ -386,7 +621,7 @@ func (ssa *SQLStorageAuthority) GetCertificate(serial string) (core.Certificate,
 	}
 	if certObj == nil {
 		ssa.log.Debug(fmt.Sprintf("Nil cert for %s", serial))
-		return core.Certificate{}, fmt.Errorf("Certificate does not exist for %s", serial)
+		return core.Certificate{}, berrors.NotFoundError("Certificate does not exist for %s", serial)
 	}
 
 	certPtr, ok := certObj.(*core.Certificate)
@@ -397,25 +632,79 @@ func (ssa *SQLStorageAuthority) GetCertificate(serial string) (core.Certificate,
 	return *certPtr, err
 }
 
+// GetCertificatesByRegistration returns up to limit of the certificates issued
+// to a registration, newest first, skipping the first offset of them.
+func (ssa *SQLStorageAuthority) GetCertificatesByRegistration(ctx context.Context, regID int64, offset, limit int) ([]core.Certificate, error) {
+	var certs []core.Certificate
+	_, err := ssa.dbMap.Select(&certs,
+		`SELECT registrationID, serial, digest, der, issued, expires FROM certificates
+		 WHERE registrationID = :regID
+		 ORDER BY issued DESC, serial DESC
+		 LIMIT :limit OFFSET :offset`,
+		map[string]interface{}{"regID": regID, "limit": limit, "offset": offset})
+	if err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
+
 // GetCertificateStatus takes a hexadecimal string representing the full 128-bit serial
 // number of a certificate and returns data about that certificate's current
 // validity.
-func (ssa *SQLStorageAuthority) GetCertificateStatus(serial string) (status core.CertificateStatus, err error) {
+func (ssa *SQLStorageAuthority) GetCertificateStatus(ctx context.Context, serial string) (status core.CertificateStatus, err error) {
 	if !core.ValidSerial(serial) {
 		err := fmt.Errorf("Invalid certificate serial %s", serial)
 		return core.CertificateStatus{}, err
 	}
 
-	certificateStats, err := ssa.dbMap.Get(core.CertificateStatus{}, serial)
+	// SELECT * reads isShortLived once its migration has added it
+	err = ssa.dbMap.SelectOne(&status, "SELECT * FROM certificateStatus WHERE serial = ?", serial)
+	if err != sql.ErrNoRows {
+		return
+	}
+	// The statuses of certificates that expired long ago may have been
+	// archived by the OCSP updater
+	archived, err := ssa.capable(CapabilityCertificateStatusArchive)
 	if err != nil {
 		return
 	}
-	status = *certificateStats.(*core.CertificateStatus)
+	if !archived {
+		err = berrors.NotFoundError("No certificate status for %s", serial)
+		return
+	}
+	err = ssa.dbMap.SelectOne(&status, "SELECT * FROM certificateStatusArchive WHERE serial = ?", serial)
+	if err == sql.ErrNoRows {
+		err = berrors.NotFoundError("No certificate status for %s", serial)
+	}
 	return
 }
 
+// GetCertificateIssuer returns the hex subject key ID of the issuer of the
+// certificate with serial, as recorded when it was added. Certificates added
+// before the certificateIssuers table, or without an authority key ID, have
+// none recorded.
+func (ssa *SQLStorageAuthority) GetCertificateIssuer(ctx context.Context, serial string) (string, error) {
+	if err := ssa.requireCapability(CapabilityCertificateIssuers); err != nil {
+		return "", err
+	}
+	issuerKeyID, err := ssa.dbMap.SelectStr(
+		"SELECT issuerKeyID FROM certificateIssuers WHERE serial = ?",
+		serial,
+	)
+	if err != nil {
+		return "", err
+	}
+	if issuerKeyID == "" {
+		return "", berrors.NotFoundError("No issuer recorded for %s", serial)
+	}
+	return issuerKeyID, nil
+}
+
 // NewRegistration stores a new Registration
-func (ssa *SQLStorageAuthority) NewRegistration(reg core.Registration) (core.Registration, error) {
+func (ssa *SQLStorageAuthority) NewRegistration(ctx context.Context, reg core.Registration) (core.Registration, error) {
+	if err := chaos.Inject("sa.NewRegistration"); err != nil {
+		return reg, err
+	}
 	rm, err := registrationToModel(&reg)
 	if err != nil {
 		return reg, err
@@ -429,11 +718,13 @@ func (ssa *SQLStorageAuthority) NewRegistration(reg core.Registration) (core.Reg
 }
 
 // UpdateOCSP stores an updated OCSP response.
-func (ssa *SQLStorageAuthority) UpdateOCSP(serial string, ocspResponse []byte) (err error) {
-	status, err := ssa.GetCertificateStatus(serial)
+func (ssa *SQLStorageAuthority) UpdateOCSP(ctx context.Context, serial string, ocspResponse []byte) (err error) {
+	status, err := ssa.GetCertificateStatus(ctx, serial)
 	if err != nil {
-		return fmt.Errorf(
-			"Unable to update OCSP for certificate %s: cert status not found.", serial)
+		if berrors.Is(err, berrors.NotFound) {
+			err = berrors.NotFoundError("Unable to update OCSP for certificate %s: cert status not found.", serial)
+		}
+		return err
 	}
 
 	status.OCSPResponse = ocspResponse
@@ -444,15 +735,19 @@ func (ssa *SQLStorageAuthority) UpdateOCSP(serial string, ocspResponse []byte) (
 
 // MarkCertificateRevoked stores the fact that a certificate is revoked, along
 // with a timestamp and a reason.
-func (ssa *SQLStorageAuthority) MarkCertificateRevoked(serial string, reasonCode core.RevocationCode) (err error) {
-	if _, err = ssa.GetCertificate(serial); err != nil {
-		return fmt.Errorf(
-			"Unable to mark certificate %s revoked: cert not found.", serial)
+func (ssa *SQLStorageAuthority) MarkCertificateRevoked(ctx context.Context, serial string, reasonCode core.RevocationCode) (err error) {
+	if _, err = ssa.GetCertificate(ctx, serial); err != nil {
+		if berrors.Is(err, berrors.NotFound) {
+			err = berrors.NotFoundError("Unable to mark certificate %s revoked: cert not found.", serial)
+		}
+		return err
 	}
 
-	if _, err = ssa.GetCertificateStatus(serial); err != nil {
-		return fmt.Errorf(
-			"Unable to mark certificate %s revoked: cert status not found.", serial)
+	if _, err = ssa.GetCertificateStatus(ctx, serial); err != nil {
+		if berrors.Is(err, berrors.NotFound) {
+			err = berrors.NotFoundError("Unable to mark certificate %s revoked: cert status not found.", serial)
+		}
+		return err
 	}
 
 	tx, err := ssa.dbMap.Begin()
@@ -466,12 +761,19 @@ func (ssa *SQLStorageAuthority) MarkCertificateRevoked(serial string, reasonCode
 		return
 	}
 	if statusObj == nil {
-		err = fmt.Errorf("No certificate with serial %s", serial)
+		err = berrors.NotFoundError("No certificate with serial %s", serial)
 		tx.Rollback()
 		return
 	}
 	now := ssa.clk.Now()
 	status := statusObj.(*core.CertificateStatus)
+	// A hold may be made permanent, but not the other way around
+	if reasonCode == core.RevocationCertificateHold && status.Status == core.OCSPStatusRevoked &&
+		status.RevokedReason != core.RevocationCertificateHold {
+		err = fmt.Errorf("Certificate %s is already revoked and can't be put on hold", serial)
+		tx.Rollback()
+		return
+	}
 	status.Status = core.OCSPStatusRevoked
 	status.RevokedDate = now
 	status.RevokedReason = reasonCode
@@ -491,8 +793,54 @@ func (ssa *SQLStorageAuthority) MarkCertificateRevoked(serial string, reasonCode
 	return
 }
 
+// ReleaseCertificateHold returns a certificate revoked with certificateHold
+// to good. Its OCSP response is marked stale, so that the ocsp-updater signs a
+// good one on its next run, and it no longer appears among the revoked
+// certificates listed on CRLs.
+func (ssa *SQLStorageAuthority) ReleaseCertificateHold(ctx context.Context, serial string) (err error) {
+	tx, err := ssa.dbMap.Begin()
+	if err != nil {
+		return
+	}
+
+	statusObj, err := tx.Get(core.CertificateStatus{}, serial)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	if statusObj == nil {
+		err = berrors.NotFoundError("No certificate with serial %s", serial)
+		tx.Rollback()
+		return
+	}
+	status := statusObj.(*core.CertificateStatus)
+	if status.Status != core.OCSPStatusRevoked || status.RevokedReason != core.RevocationCertificateHold {
+		err = fmt.Errorf("Certificate %s is not on hold", serial)
+		tx.Rollback()
+		return
+	}
+	status.Status = core.OCSPStatusGood
+	status.RevokedDate = time.Time{}
+	status.RevokedReason = 0
+	status.OCSPLastUpdated = time.Time{}
+
+	n, err := tx.Update(status)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	if n == 0 {
+		tx.Rollback()
+		err = errors.New("No certificate updated. Maybe the lock column was off?")
+		return
+	}
+	err = tx.Commit()
+
+	return
+}
+
 // UpdateRegistration stores an updated Registration
-func (ssa *SQLStorageAuthority) UpdateRegistration(reg core.Registration) error {
+func (ssa *SQLStorageAuthority) UpdateRegistration(ctx context.Context, reg core.Registration) error {
 	lookupResult, err := ssa.dbMap.Get(regModel{}, reg.ID)
 	if err != nil {
 		return err
@@ -526,58 +874,152 @@ func (ssa *SQLStorageAuthority) UpdateRegistration(reg core.Registration) error
 }
 
 // NewPendingAuthorization stores a new Pending Authorization
-func (ssa *SQLStorageAuthority) NewPendingAuthorization(authz core.Authorization) (output core.Authorization, err error) {
+func (ssa *SQLStorageAuthority) NewPendingAuthorization(ctx context.Context, authz core.Authorization) (output core.Authorization, err error) {
+	outputs, err := ssa.NewPendingAuthorizations(ctx, []core.Authorization{authz})
+	if err != nil {
+		return
+	}
+	return outputs[0], nil
+}
+
+// NewPendingAuthorizations stores several new Pending Authorizations in one
+// transaction, inserting all of their rows, and then all of their challenges'
+// rows, with a single statement each.
+func (ssa *SQLStorageAuthority) NewPendingAuthorizations(ctx context.Context, authzs []core.Authorization) (output []core.Authorization, err error) {
 	tx, err := ssa.dbMap.Begin()
 	if err != nil {
 		return
 	}
 
-	// Check that it doesn't exist already
-	authz.ID = core.NewToken()
-	for existingPending(tx, authz.ID) || existingFinal(tx, authz.ID) {
+	output = make([]core.Authorization, len(authzs))
+	authzRows := make([][]interface{}, len(authzs))
+	var challRows [][]interface{}
+	authzIDs := make([]interface{}, len(authzs))
+	checked := make(map[int64]bool)
+	for i, authz := range authzs {
+		if !checked[authz.RegistrationID] {
+			if err = checkRegistrationExists(tx, authz.RegistrationID); err != nil {
+				tx.Rollback()
+				return
+			}
+			checked[authz.RegistrationID] = true
+		}
+
+		// Check that it doesn't exist already
 		authz.ID = core.NewToken()
+		for existingPending(tx, authz.ID) || existingFinal(tx, authz.ID) {
+			authz.ID = core.NewToken()
+		}
+		// Don't fill in the caller's challenges
+		authz.Challenges = append([]core.Challenge(nil), authz.Challenges...)
+		output[i] = authz
+		authzIDs[i] = authz.ID
+		authzRows[i] = []interface{}{
+			authz.ID, authz.Identifier, authz.RegistrationID, authz.Status,
+			authz.Expires, authz.Combinations, 1,
+		}
+
+		for _, c := range authz.Challenges {
+			cm, err := challengeToModel(&c, authz.ID)
+			if err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			challRows = append(challRows, []interface{}{
+				cm.AuthorizationID, cm.Type, cm.Status, cm.Error, cm.Validated,
+				cm.Token, cm.KeyAuthorization, cm.ValidationRecord, cm.AccountKey, 1,
+			})
+		}
 	}
 
-	// Insert a stub row in pending
-	pendingAuthz := pendingauthzModel{Authorization: authz}
-	err = tx.Insert(&pendingAuthz)
+	_, err = multiInsert(tx, "pendingAuthorizations", []string{
+		"id", "identifier", "registrationID", "status", "expires", "combinations", "LockCol",
+	}, authzRows)
 	if err != nil {
 		tx.Rollback()
+		return nil, err
+	}
+	if len(challRows) == 0 {
+		err = tx.Commit()
 		return
 	}
+	_, err = multiInsert(tx, "challenges", []string{
+		"authorizationID", "type", "status", "error", "validated", "token",
+		"keyAuthorization", "validationRecord", "accountKey", "LockCol",
+	}, challRows)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
 
-	for i, c := range authz.Challenges {
-		challModel, err := challengeToModel(&c, pendingAuthz.ID)
-		if err != nil {
-			tx.Rollback()
-			return core.Authorization{}, err
-		}
-		// Magic happens here: Gorp will modify challModel, setting challModel.ID
-		// to the auto-increment primary key. This is important because we want
-		// the challenge objects inside the Authorization we return to know their
-		// IDs, so they can have proper URLs.
-		// See https://godoc.org/github.com/coopernurse/gorp#DbMap.Insert
-		err = tx.Insert(challModel)
+	// The challenges' IDs are auto-incremented, and a multi-row INSERT only
+	// reports the first, which needn't be followed by the others. So they're
+	// read back: each authorization's come in the order they were inserted,
+	// which is the order of its challenges, so that the objects we return
+	// know their IDs and can have proper URLs.
+	var challObjs []challModel
+	_, err = tx.Select(&challObjs,
+		"SELECT * FROM challenges WHERE authorizationID IN ("+placeholders(len(authzIDs))+") ORDER BY id ASC",
+		authzIDs...)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	byAuthz := make(map[string][]core.Challenge)
+	for i := range challObjs {
+		challenge, err := modelToChallenge(&challObjs[i])
 		if err != nil {
 			tx.Rollback()
-			return core.Authorization{}, err
+			return nil, err
 		}
-		challenge, err := modelToChallenge(challModel)
-		if err != nil {
+		byAuthz[challObjs[i].AuthorizationID] = append(byAuthz[challObjs[i].AuthorizationID], challenge)
+	}
+	for i := range output {
+		if len(byAuthz[output[i].ID]) != len(output[i].Challenges) {
 			tx.Rollback()
-			return core.Authorization{}, err
+			return nil, fmt.Errorf("Stored %d challenges for authorization %s, but read back %d",
+				len(output[i].Challenges), output[i].ID, len(byAuthz[output[i].ID]))
 		}
-		authz.Challenges[i] = challenge
+		output[i].Challenges = byAuthz[output[i].ID]
 	}
 
 	err = tx.Commit()
-	output = pendingAuthz.Authorization
-	output.Challenges = authz.Challenges
 	return
 }
 
+// placeholders returns n comma-separated placeholders, for a query's IN list or
+// VALUES row.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// multiInsert inserts rows, each of which has a value for each of columns,
+// into table with a single INSERT statement. The values are converted as gorp
+// would convert them on an Insert().
+func multiInsert(tx *gorp.Transaction, table string, columns []string, rows [][]interface{}) (sql.Result, error) {
+	var tc BoulderTypeConverter
+	values := make([]string, len(rows))
+	args := make([]interface{}, 0, len(rows)*len(columns))
+	for i, row := range rows {
+		if len(row) != len(columns) {
+			return nil, fmt.Errorf("Row %d has %d values for %d columns of %s", i, len(row), len(columns), table)
+		}
+		values[i] = "(" + placeholders(len(row)) + ")"
+		for _, v := range row {
+			dbValue, err := tc.ToDb(v)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, dbValue)
+		}
+	}
+	return tx.Exec(
+		"INSERT INTO "+table+" ("+strings.Join(columns, ", ")+") VALUES "+strings.Join(values, ", "),
+		args...)
+}
+
 // UpdatePendingAuthorization updates a Pending Authorization
-func (ssa *SQLStorageAuthority) UpdatePendingAuthorization(authz core.Authorization) (err error) {
+func (ssa *SQLStorageAuthority) UpdatePendingAuthorization(ctx context.Context, authz core.Authorization) (err error) {
 	tx, err := ssa.dbMap.Begin()
 	if err != nil {
 		return
@@ -596,7 +1038,7 @@ func (ssa *SQLStorageAuthority) UpdatePendingAuthorization(authz core.Authorizat
 	}
 
 	if !existingPending(tx, authz.ID) {
-		err = errors.New("Requested authorization not found " + authz.ID)
+		err = berrors.NotFoundError("Requested authorization not found %s", authz.ID)
 		tx.Rollback()
 		return
 	}
@@ -625,7 +1067,10 @@ func (ssa *SQLStorageAuthority) UpdatePendingAuthorization(authz core.Authorizat
 }
 
 // FinalizeAuthorization converts a Pending Authorization to a final one
-func (ssa *SQLStorageAuthority) FinalizeAuthorization(authz core.Authorization) (err error) {
+func (ssa *SQLStorageAuthority) FinalizeAuthorization(ctx context.Context, authz core.Authorization) (err error) {
+	if err = chaos.Inject("sa.FinalizeAuthorization"); err != nil {
+		return
+	}
 	tx, err := ssa.dbMap.Begin()
 	if err != nil {
 		return
@@ -634,6 +1079,9 @@ func (ssa *SQLStorageAuthority) FinalizeAuthorization(authz core.Authorization)
 	// Check that a pending authz exists
 	if !existingPending(tx, authz.ID) {
 		err = errors.New("Cannot finalize a authorization that is not pending")
+		if !existingFinal(tx, authz.ID) {
+			err = berrors.NotFoundError("Requested authorization not found %s", authz.ID)
+		}
 		tx.Rollback()
 		return
 	}
@@ -673,8 +1121,101 @@ func (ssa *SQLStorageAuthority) FinalizeAuthorization(authz core.Authorization)
 	return
 }
 
+// DeactivateAuthorization marks a pending or valid authorization as
+// deactivated. A pending authorization becomes final, as if it had been
+// passed to FinalizeAuthorization.
+func (ssa *SQLStorageAuthority) DeactivateAuthorization(ctx context.Context, id string) (err error) {
+	tx, err := ssa.dbMap.Begin()
+	if err != nil {
+		return
+	}
+
+	if existingPending(tx, id) {
+		authObj, err := tx.Get(pendingauthzModel{}, id)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		oldAuth := authObj.(*pendingauthzModel)
+		auth := &authzModel{oldAuth.Authorization}
+		auth.Status = core.StatusDeactivated
+
+		if err = tx.Insert(auth); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err = tx.Delete(oldAuth); err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	}
+
+	if !existingFinal(tx, id) {
+		err = berrors.NotFoundError("No authorization with ID %s", id)
+		tx.Rollback()
+		return
+	}
+
+	authObj, err := tx.Get(authzModel{}, id)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	auth := authObj.(*authzModel)
+	if auth.Status != core.StatusValid {
+		err = berrors.MalformedError("Cannot deactivate a %s authorization", auth.Status)
+		tx.Rollback()
+		return
+	}
+	auth.Status = core.StatusDeactivated
+	if _, err = tx.Update(auth); err != nil {
+		tx.Rollback()
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// fqdnSetNames returns the names of cert that its FQDN set is hashed from.
+// Email addresses are hashed as the RA names them, by their identifiers.
+func fqdnSetNames(cert *x509.Certificate) []string {
+	names := append([]string{}, cert.DNSNames...)
+	for _, address := range cert.EmailAddresses {
+		names = append(names, identifier.FromValue(address).Value)
+	}
+	return names
+}
+
+// issuedNameDomains returns the names of cert that count toward the
+// certificatesPerName limit: its DNS names, and the domains of its email
+// addresses, which count against them as the RA names them, without
+// duplicates.
+func issuedNameDomains(cert *x509.Certificate) []string {
+	seen := make(map[string]bool, len(cert.DNSNames))
+	var names []string
+	for _, name := range cert.DNSNames {
+		if !seen[strings.ToLower(name)] {
+			seen[strings.ToLower(name)] = true
+			names = append(names, name)
+		}
+	}
+	for _, address := range cert.EmailAddresses {
+		domain := identifier.FromValue(address).Domain()
+		if !seen[strings.ToLower(domain)] {
+			seen[strings.ToLower(domain)] = true
+			names = append(names, domain)
+		}
+	}
+	return names
+}
+
 // AddCertificate stores an issued certificate.
-func (ssa *SQLStorageAuthority) AddCertificate(certDER []byte, regID int64) (digest string, err error) {
+func (ssa *SQLStorageAuthority) AddCertificate(ctx context.Context, certDER []byte, regID int64) (digest string, err error) {
+	if err = chaos.Inject("sa.AddCertificate"); err != nil {
+		return
+	}
 	var parsedCertificate *x509.Certificate
 	parsedCertificate, err = x509.ParseCertificate(certDER)
 	if err != nil {
@@ -699,10 +1240,25 @@ func (ssa *SQLStorageAuthority) AddCertificate(certDER []byte, regID int64) (dig
 		Serial:             serial,
 		RevokedDate:        time.Time{},
 		RevokedReason:      0,
+		IsShortLived:       core.IsShortLived(parsedCertificate),
 		LockCol:            0,
 	}
-	issuedNames := make([]issuedNameModel, len(parsedCertificate.DNSNames))
-	for i, name := range parsedCertificate.DNSNames {
+	// Short-lived certificates get no OCSP responses, which their statuses
+	// are marked for. Until the schema has the isShortLived column they
+	// instead count as updated until they expire, which also keeps them out
+	// of the OCSP updater's work, and the column's migration marks them.
+	markShortLived := false
+	if certStatus.IsShortLived {
+		if markShortLived, err = ssa.capable(CapabilityCertificateStatusIsShortLived); err != nil {
+			return
+		}
+		if !markShortLived {
+			certStatus.OCSPLastUpdated = parsedCertificate.NotAfter
+		}
+	}
+	names := issuedNameDomains(parsedCertificate)
+	issuedNames := make([]issuedNameModel, len(names))
+	for i, name := range names {
 		issuedNames[i] = issuedNameModel{
 			ReversedName: core.ReverseName(name),
 			Serial:       serial,
@@ -710,11 +1266,41 @@ func (ssa *SQLStorageAuthority) AddCertificate(certDER []byte, regID int64) (dig
 		}
 	}
 
+	fqdnSet := &fqdnSetModel{
+		SetHash: core.HashNames(fqdnSetNames(parsedCertificate)),
+		Serial:  serial,
+		Issued:  cert.Issued,
+		Expires: cert.Expires,
+	}
+	keyHash, err := core.KeyDigest(parsedCertificate.PublicKey)
+	if err != nil {
+		return
+	}
+	keyHashEntry := &keyHashModel{
+		KeyHash:      keyHash,
+		CertNotAfter: cert.Expires,
+		CertSerial:   serial,
+	}
+	// The issuer is known by its key ID, which the certificate names as its
+	// authority key ID. Certificates without one aren't recorded.
+	var issuerEntry *certificateIssuerModel
+	if len(parsedCertificate.AuthorityKeyId) > 0 {
+		issuerEntry = &certificateIssuerModel{
+			Serial:      serial,
+			IssuerKeyID: hex.EncodeToString(parsedCertificate.AuthorityKeyId),
+		}
+	}
+
 	tx, err := ssa.dbMap.Begin()
 	if err != nil {
 		return
 	}
 
+	if err = checkRegistrationExists(tx, regID); err != nil {
+		tx.Rollback()
+		return
+	}
+
 	// TODO Verify that the serial number doesn't yet exist
 	err = tx.Insert(cert)
 	if err != nil {
@@ -727,8 +1313,15 @@ func (ssa *SQLStorageAuthority) AddCertificate(certDER []byte, regID int64) (dig
 		tx.Rollback()
 		return
 	}
-
-	for _, issuedName := range issuedNames {
+	if markShortLived {
+		_, err = tx.Exec("UPDATE certificateStatus SET isShortLived = true WHERE serial = ?", serial)
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+	}
+
+	for _, issuedName := range issuedNames {
 		err = tx.Insert(&issuedName)
 		if err != nil {
 			tx.Rollback()
@@ -736,12 +1329,99 @@ func (ssa *SQLStorageAuthority) AddCertificate(certDER []byte, regID int64) (dig
 		}
 	}
 
+	err = tx.Insert(fqdnSet)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	var keyHashes, issuers bool
+	if keyHashes, err = ssa.capable(CapabilityKeyHashes); err != nil {
+		tx.Rollback()
+		return
+	}
+	if issuers, err = ssa.capable(CapabilityCertificateIssuers); err != nil {
+		tx.Rollback()
+		return
+	}
+
+	if keyHashes {
+		err = tx.Insert(keyHashEntry)
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+	}
+
+	if issuerEntry != nil && issuers {
+		err = tx.Insert(issuerEntry)
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+	}
+
 	err = tx.Commit()
 	return
 }
 
+// AddDeniedCSR records the name list as denied, so that no certificate is
+// issued for it again.
+func (ssa *SQLStorageAuthority) AddDeniedCSR(ctx context.Context, names []string) error {
+	sort.Strings(names)
+	return ssa.dbMap.Insert(&core.DeniedCSR{Names: strings.ToLower(strings.Join(names, ","))})
+}
+
+// GetRateLimitOverrides returns every rate limit override set with
+// SetRateLimitOverride.
+func (ssa *SQLStorageAuthority) GetRateLimitOverrides(ctx context.Context) ([]core.RateLimitOverride, error) {
+	var overrides []core.RateLimitOverride
+	_, err := ssa.dbMap.Select(&overrides, "SELECT * FROM rateLimitOverrides ORDER BY id")
+	return overrides, err
+}
+
+// SetRateLimitOverride stores override, replacing any override of the same
+// limit for the same key and registration.
+func (ssa *SQLStorageAuthority) SetRateLimitOverride(ctx context.Context, override core.RateLimitOverride) error {
+	tx, err := ssa.dbMap.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"DELETE FROM rateLimitOverrides WHERE limitName = ? AND limitKey = ? AND registrationID = ?",
+		override.Limit, override.Key, override.RegistrationID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	override.ID = 0
+	override.Created = ssa.clk.Now()
+	if err = tx.Insert(&override); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemoveRateLimitOverride deletes the override of limit for key and
+// regID, returning a NotFoundError if there isn't one.
+func (ssa *SQLStorageAuthority) RemoveRateLimitOverride(ctx context.Context, limit, key string, regID int64) error {
+	result, err := ssa.dbMap.Exec(
+		"DELETE FROM rateLimitOverrides WHERE limitName = ? AND limitKey = ? AND registrationID = ?",
+		limit, key, regID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return berrors.NotFoundError("No %s override for key %q and registration %d", limit, key, regID)
+	}
+	return nil
+}
+
 // AlreadyDeniedCSR queries to find if the name list has already been denied.
-func (ssa *SQLStorageAuthority) AlreadyDeniedCSR(names []string) (already bool, err error) {
+func (ssa *SQLStorageAuthority) AlreadyDeniedCSR(ctx context.Context, names []string) (already bool, err error) {
 	sort.Strings(names)
 
 	var denied int64
@@ -760,9 +1440,500 @@ func (ssa *SQLStorageAuthority) AlreadyDeniedCSR(names []string) (already bool,
 	return
 }
 
+// GetSerialsByKeyHash returns the serials of the unexpired certificates for
+// the public key whose core.KeyDigest is keyHash. Certificates are only
+// found by key if they were added since keys were recorded.
+func (ssa *SQLStorageAuthority) GetSerialsByKeyHash(ctx context.Context, keyHash string) ([]string, error) {
+	if err := ssa.requireCapability(CapabilityKeyHashes); err != nil {
+		return nil, err
+	}
+	var serials []string
+	_, err := ssa.dbMap.Select(
+		&serials,
+		getSerialsByKeyHashQuery,
+		map[string]interface{}{"keyHash": keyHash, "now": ssa.clk.Now()},
+	)
+	return serials, err
+}
+
+// AddBlockedKey records that no certificate may be issued for the public key
+// whose core.KeyDigest is keyHash. Blocking a key twice isn't an error, and
+// the key stays attributed to whoever blocked it first.
+func (ssa *SQLStorageAuthority) AddBlockedKey(ctx context.Context, keyHash, addedBy string) error {
+	if err := ssa.requireCapability(CapabilityBlockedKeys); err != nil {
+		return err
+	}
+	blocked, err := ssa.KeyBlocked(ctx, keyHash)
+	if err != nil || blocked {
+		return err
+	}
+	return ssa.dbMap.Insert(&blockedKeyModel{
+		KeyHash: keyHash,
+		Added:   ssa.clk.Now(),
+		AddedBy: addedBy,
+	})
+}
+
+// KeyBlocked queries to find if the public key whose core.KeyDigest is
+// keyHash has been blocked. No key has been blocked before the blockedKeys
+// table is added.
+func (ssa *SQLStorageAuthority) KeyBlocked(ctx context.Context, keyHash string) (blocked bool, err error) {
+	capable, err := ssa.capable(CapabilityBlockedKeys)
+	if err != nil || !capable {
+		return
+	}
+	var count int64
+	err = ssa.dbMap.SelectOne(
+		&count,
+		"SELECT count(*) FROM blockedKeys WHERE keyHash = :keyHash",
+		map[string]interface{}{"keyHash": keyHash},
+	)
+	if err != nil {
+		return
+	}
+	blocked = count > 0
+	return
+}
+
+// AddReplacementOrder records that the certificate with serial was issued to
+// replace the one with replacedSerial, so that the subscriber isn't nagged
+// about the expiry of the replaced certificate. A certificate is replaced
+// at most once: recording another replacement for it is refused, as when a
+// request names it as replaced, though recording the same one again isn't.
+func (ssa *SQLStorageAuthority) AddReplacementOrder(ctx context.Context, serial, replacedSerial string) error {
+	err := ssa.dbMap.Insert(&replacementOrderModel{
+		Serial:         serial,
+		ReplacedSerial: replacedSerial,
+		Created:        ssa.clk.Now(),
+	})
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == mysqlDuplicateEntry {
+		replacement, err := ssa.dbMap.SelectStr(
+			"SELECT serial FROM replacementOrders WHERE replacedSerial = ?",
+			replacedSerial,
+		)
+		if err != nil {
+			return err
+		}
+		switch replacement {
+		case serial:
+			return nil
+		case "":
+			return berrors.MalformedError("Certificate %s already replaces another", serial)
+		}
+		return berrors.MalformedError("Certificate %s has already been replaced", replacedSerial)
+	}
+	return err
+}
+
+// ReplacementIssued queries to find if a replacement has already been issued
+// for the certificate with serial.
+func (ssa *SQLStorageAuthority) ReplacementIssued(ctx context.Context, serial string) (issued bool, err error) {
+	var count int64
+	err = ssa.dbMap.SelectOne(
+		&count,
+		"SELECT count(*) FROM replacementOrders WHERE replacedSerial = :serial",
+		map[string]interface{}{"serial": serial},
+	)
+	if err != nil {
+		return
+	}
+	issued = count > 0
+	return
+}
+
+// NewCertificateOrder stores a new certificate order, which must be
+// processing, under a new random ID, together with req, the request it's
+// to issue a certificate for. The request is kept until the order is
+// finalized, and recorded as first attempted when the order was created.
+func (ssa *SQLStorageAuthority) NewCertificateOrder(ctx context.Context, order core.CertificateOrder, req core.CertificateRequest) (core.CertificateOrder, error) {
+	if err := ssa.requireCapability(CapabilityCertificateOrders); err != nil {
+		return core.CertificateOrder{}, err
+	}
+	if err := ssa.requireCapability(CapabilityCertificateOrderRequests); err != nil {
+		return core.CertificateOrder{}, err
+	}
+	if err := ssa.requireCapability(CapabilityCertificateOrderExpiry); err != nil {
+		return core.CertificateOrder{}, err
+	}
+	if order.Status != core.StatusProcessing {
+		return core.CertificateOrder{}, fmt.Errorf("Cannot create a certificate order with status %s", order.Status)
+	}
+	if !order.Expires.After(order.Created) {
+		return core.CertificateOrder{}, fmt.Errorf("Cannot create a certificate order expiring at %s", order.Expires)
+	}
+	order.ID = core.NewToken()
+	om, err := certificateOrderToModel(order)
+	if err != nil {
+		return core.CertificateOrder{}, err
+	}
+	reqJSON, err := json.Marshal(req)
+	if err != nil {
+		return core.CertificateOrder{}, err
+	}
+	rm := &certificateOrderRequestModel{
+		OrderID:   order.ID,
+		Request:   reqJSON,
+		Attempted: order.Created,
+		Attempts:  1,
+	}
+
+	tx, err := ssa.dbMap.Begin()
+	if err != nil {
+		return core.CertificateOrder{}, err
+	}
+	if err = tx.Insert(om, rm); err != nil {
+		tx.Rollback()
+		return core.CertificateOrder{}, err
+	}
+	if err = tx.Commit(); err != nil {
+		return core.CertificateOrder{}, err
+	}
+	return order, nil
+}
+
+// FinalizeCertificateOrder records the outcome of a certificate order that
+// is still processing: valid, with the serial of the certificate issued, or
+// invalid, with the problem that stopped it. The order's request is
+// deleted with it.
+func (ssa *SQLStorageAuthority) FinalizeCertificateOrder(ctx context.Context, order core.CertificateOrder) error {
+	if err := ssa.requireCapability(CapabilityCertificateOrders); err != nil {
+		return err
+	}
+	switch {
+	case order.Status == core.StatusValid && !core.ValidSerial(order.Serial):
+		return fmt.Errorf("Invalid certificate serial %s", order.Serial)
+	case order.Status != core.StatusValid && order.Status != core.StatusInvalid:
+		return fmt.Errorf("Cannot finalize a certificate order to status %s", order.Status)
+	}
+	requests, err := ssa.capable(CapabilityCertificateOrderRequests)
+	if err != nil {
+		return err
+	}
+	om, err := certificateOrderToModel(order)
+	if err != nil {
+		return err
+	}
+
+	tx, err := ssa.dbMap.Begin()
+	if err != nil {
+		return err
+	}
+	result, err := tx.Exec(
+		`UPDATE certificateOrders SET status = ?, serial = ?, error = ?
+		 WHERE id = ? AND status = ?`,
+		om.Status, om.Serial, om.Error, om.ID, string(core.StatusProcessing))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		tx.Rollback()
+		return err
+	} else if n == 0 {
+		tx.Rollback()
+		return berrors.NotFoundError("No processing certificate order with ID %s", order.ID)
+	}
+	if requests {
+		if _, err = tx.Exec("DELETE FROM certificateOrderRequests WHERE orderID = ?", om.ID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ClaimCertificateOrders claims up to limit processing certificate orders
+// that an RA last began processing before staleBefore, and presumably
+// stopped without finishing, recording that processing begins again at now.
+// An order whose processing is begun again by another caller between being
+// found and claimed is left to it. Orders created before their requests
+// were stored are also returned, unclaimed, with a nil Request: they can't
+// be resumed, only finalized as invalid.
+func (ssa *SQLStorageAuthority) ClaimCertificateOrders(ctx context.Context, staleBefore, now time.Time, limit int) ([]core.ClaimedCertificateOrder, error) {
+	if err := ssa.requireCapability(CapabilityCertificateOrders); err != nil {
+		return nil, err
+	}
+	if err := ssa.requireCapability(CapabilityCertificateOrderRequests); err != nil {
+		return nil, err
+	}
+	if err := ssa.requireCapability(CapabilityCertificateOrderExpiry); err != nil {
+		return nil, err
+	}
+
+	var rms []certificateOrderRequestModel
+	_, err := ssa.dbMap.Select(
+		&rms,
+		`SELECT orderID, request, attempted, attempts FROM certificateOrderRequests
+		 WHERE attempted < ? ORDER BY attempted LIMIT ?`,
+		staleBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	var claimed []core.ClaimedCertificateOrder
+	for _, rm := range rms {
+		result, err := ssa.dbMap.Exec(
+			`UPDATE certificateOrderRequests SET attempted = ?, attempts = ?
+			 WHERE orderID = ? AND attempts = ?`,
+			now, rm.Attempts+1, rm.OrderID, rm.Attempts)
+		if err != nil {
+			return claimed, err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return claimed, err
+		} else if n == 0 {
+			continue
+		}
+		obj, err := ssa.dbMap.Get(certificateOrderModel{}, rm.OrderID)
+		if err != nil {
+			return claimed, err
+		}
+		if obj == nil {
+			continue
+		}
+		order, err := modelToCertificateOrder(obj.(*certificateOrderModel))
+		if err != nil {
+			return claimed, err
+		}
+		if order.Status != core.StatusProcessing {
+			continue
+		}
+		var req core.CertificateRequest
+		if err = json.Unmarshal(rm.Request, &req); err != nil {
+			return claimed, err
+		}
+		claimed = append(claimed, core.ClaimedCertificateOrder{Order: order, Request: &req, Attempts: rm.Attempts + 1})
+	}
+	if len(claimed) >= limit {
+		return claimed, nil
+	}
+
+	var oms []certificateOrderModel
+	_, err = ssa.dbMap.Select(
+		&oms,
+		`SELECT id, registrationID, status, serial, error, created, expires FROM certificateOrders o
+		 WHERE status = ? AND created < ?
+		 AND NOT EXISTS (SELECT 1 FROM certificateOrderRequests r WHERE r.orderID = o.id)
+		 ORDER BY created LIMIT ?`,
+		string(core.StatusProcessing), staleBefore, limit-len(claimed))
+	if err != nil {
+		return claimed, err
+	}
+	for i := range oms {
+		order, err := modelToCertificateOrder(&oms[i])
+		if err != nil {
+			return claimed, err
+		}
+		claimed = append(claimed, core.ClaimedCertificateOrder{Order: order})
+	}
+	return claimed, nil
+}
+
+// GetCertificateOrder returns the certificate order with id, or a
+// NotFoundError if there isn't one.
+func (ssa *SQLStorageAuthority) GetCertificateOrder(ctx context.Context, id string) (core.CertificateOrder, error) {
+	if err := ssa.requireCapability(CapabilityCertificateOrders); err != nil {
+		return core.CertificateOrder{}, err
+	}
+	if err := ssa.requireCapability(CapabilityCertificateOrderExpiry); err != nil {
+		return core.CertificateOrder{}, err
+	}
+	obj, err := ssa.dbMap.Get(certificateOrderModel{}, id)
+	if err != nil {
+		return core.CertificateOrder{}, err
+	}
+	if obj == nil {
+		return core.CertificateOrder{}, berrors.NotFoundError("No certificate order with ID %s", id)
+	}
+	return modelToCertificateOrder(obj.(*certificateOrderModel))
+}
+
+// ReserveIdempotencyKey stores key, whose Serial must be empty, for the
+// request issuing its certificate, unless another request's key of the same
+// registration and digest is stored. That one is replaced only if it has
+// expired by when key was created, or if it's still without a certificate
+// and was created before staleBefore, its request having presumably failed
+// without saying so. It returns the key stored: the caller holds the
+// reservation if it has key's RequestID.
+func (ssa *SQLStorageAuthority) ReserveIdempotencyKey(ctx context.Context, key core.IdempotencyKey, staleBefore time.Time) (core.IdempotencyKey, error) {
+	if err := ssa.requireCapability(CapabilityIdempotencyKeys); err != nil {
+		return core.IdempotencyKey{}, err
+	}
+	if err := ssa.requireCapability(CapabilityIdempotencyKeyExpiry); err != nil {
+		return core.IdempotencyKey{}, err
+	}
+	if key.Serial != "" {
+		return core.IdempotencyKey{}, fmt.Errorf("Cannot reserve an idempotency key for issued certificate %s", key.Serial)
+	}
+	if !key.Expires.After(key.Created) {
+		return core.IdempotencyKey{}, fmt.Errorf("Cannot reserve an idempotency key expiring at %s", key.Expires)
+	}
+	err := ssa.dbMap.Insert(&key)
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == mysqlDuplicateEntry {
+		// Take over an expired key or a stale reservation, or else return
+		// what's stored
+		var result sql.Result
+		result, err = ssa.dbMap.Exec(
+			`UPDATE idempotencyKeys SET requestID = ?, serial = '', created = ?, expires = ?
+			 WHERE registrationID = ? AND digest = ?
+			 AND (expires <= ? OR (serial = '' AND created < ?))`,
+			key.RequestID, key.Created, key.Expires, key.RegistrationID, key.Digest, key.Created, staleBefore)
+		if err != nil {
+			return core.IdempotencyKey{}, err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return core.IdempotencyKey{}, err
+		} else if n == 0 {
+			var stored core.IdempotencyKey
+			err = ssa.dbMap.SelectOne(&stored,
+				"SELECT * FROM idempotencyKeys WHERE registrationID = :regID AND digest = :digest",
+				map[string]interface{}{"regID": key.RegistrationID, "digest": key.Digest})
+			return stored, err
+		}
+	}
+	if err != nil {
+		return core.IdempotencyKey{}, err
+	}
+	return key, nil
+}
+
+// FinalizeIdempotencyKey records the Serial of the certificate issued by the
+// request holding the reservation of key, or, if key has no Serial because
+// issuance failed, removes the reservation so that the request can be
+// retried.
+func (ssa *SQLStorageAuthority) FinalizeIdempotencyKey(ctx context.Context, key core.IdempotencyKey) error {
+	if err := ssa.requireCapability(CapabilityIdempotencyKeys); err != nil {
+		return err
+	}
+	if err := ssa.requireCapability(CapabilityIdempotencyKeyExpiry); err != nil {
+		return err
+	}
+	var result sql.Result
+	var err error
+	if key.Serial == "" {
+		result, err = ssa.dbMap.Exec(
+			`DELETE FROM idempotencyKeys
+			 WHERE registrationID = ? AND digest = ? AND requestID = ? AND serial = ''`,
+			key.RegistrationID, key.Digest, key.RequestID)
+	} else {
+		result, err = ssa.dbMap.Exec(
+			`UPDATE idempotencyKeys SET serial = ?
+			 WHERE registrationID = ? AND digest = ? AND requestID = ? AND serial = ''`,
+			key.Serial, key.RegistrationID, key.Digest, key.RequestID)
+	}
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return berrors.NotFoundError("No reservation of idempotency key %s by request %s", key.Digest, key.RequestID)
+	}
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys deletes at most limit idempotency keys that
+// have expired by now, returning how many it deleted. It isn't part of
+// core.StorageAuthority: the SA runs it itself.
+func (ssa *SQLStorageAuthority) DeleteExpiredIdempotencyKeys(now time.Time, limit int) (int64, error) {
+	if err := ssa.requireCapability(CapabilityIdempotencyKeys); err != nil {
+		return 0, err
+	}
+	if err := ssa.requireCapability(CapabilityIdempotencyKeyExpiry); err != nil {
+		return 0, err
+	}
+	result, err := ssa.dbMap.Exec("DELETE FROM idempotencyKeys WHERE expires <= ? LIMIT ?", now, limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetCAAChecks returns, for each of names that it's recorded for, when CAA
+// last allowed issuance for it.
+func (ssa *SQLStorageAuthority) GetCAAChecks(ctx context.Context, names []string) (map[string]time.Time, error) {
+	if err := ssa.requireCapability(CapabilityCAAChecks); err != nil {
+		return nil, err
+	}
+	checks := make(map[string]time.Time)
+	if len(names) == 0 {
+		return checks, nil
+	}
+	params := make(map[string]interface{})
+	var qmarks []string
+	for i, name := range names {
+		param := fmt.Sprintf("name%d", i)
+		params[param] = name
+		qmarks = append(qmarks, ":"+param)
+	}
+	var rows []struct {
+		Name    string
+		Checked time.Time
+	}
+	_, err := ssa.dbMap.Select(&rows,
+		"SELECT name, checked FROM caaChecks WHERE name IN ("+strings.Join(qmarks, ", ")+")",
+		params)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		checks[row.Name] = row.Checked
+	}
+	return checks, nil
+}
+
+// AddCAAChecks records that CAA allowed issuance for names at checked, unless
+// a later check is recorded already.
+func (ssa *SQLStorageAuthority) AddCAAChecks(ctx context.Context, names []string, checked time.Time) error {
+	if err := ssa.requireCapability(CapabilityCAAChecks); err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	var values []string
+	var args []interface{}
+	for _, name := range names {
+		values = append(values, "(?, ?)")
+		args = append(args, name, checked)
+	}
+	_, err := ssa.dbMap.Exec(
+		`INSERT INTO caaChecks (name, checked) VALUES `+strings.Join(values, ", ")+`
+		 ON DUPLICATE KEY UPDATE checked = GREATEST(checked, VALUES(checked))`,
+		args...)
+	return err
+}
+
+// AddValidationTranscript stores the signed transcript of a successful
+// validation of one of an authorization's challenges.
+func (ssa *SQLStorageAuthority) AddValidationTranscript(ctx context.Context, authzID, challengeType string, signed []byte) error {
+	return ssa.dbMap.Insert(&transcriptModel{
+		AuthzID:       authzID,
+		ChallengeType: challengeType,
+		Transcript:    signed,
+		Created:       ssa.clk.Now(),
+	})
+}
+
+// GetValidationTranscripts returns the signed transcripts of an
+// authorization's validations, oldest first.
+func (ssa *SQLStorageAuthority) GetValidationTranscripts(ctx context.Context, authzID string) ([][]byte, error) {
+	var models []transcriptModel
+	_, err := ssa.dbMap.Select(&models,
+		"SELECT id, authzID, challengeType, transcript, created FROM validationTranscripts WHERE authzID = :authzID ORDER BY id",
+		map[string]interface{}{"authzID": authzID})
+	if err != nil {
+		return nil, err
+	}
+	transcripts := make([][]byte, len(models))
+	for i, m := range models {
+		transcripts[i] = m.Transcript
+	}
+	return transcripts, nil
+}
+
 // CountCertificatesRange returns the number of certificates issued in a specific
 // date range
-func (ssa *SQLStorageAuthority) CountCertificatesRange(start, end time.Time) (count int64, err error) {
+func (ssa *SQLStorageAuthority) CountCertificatesRange(ctx context.Context, start, end time.Time) (count int64, err error) {
 	err = ssa.dbMap.SelectOne(
 		&count,
 		`SELECT COUNT(1) FROM certificates
@@ -778,11 +1949,9 @@ func (ssa *SQLStorageAuthority) CountCertificatesRange(start, end time.Time) (co
 
 // CountPendingAuthorizations returns the number of pending, unexpired
 // authorizations for the give registration.
-func (ssa *SQLStorageAuthority) CountPendingAuthorizations(regID int64) (count int, err error) {
+func (ssa *SQLStorageAuthority) CountPendingAuthorizations(ctx context.Context, regID int64) (count int, err error) {
 	err = ssa.dbMap.SelectOne(&count,
-		`SELECT count(1) FROM pendingAuthorizations
-		 WHERE registrationID = :regID AND
-				expires > :now`,
+		countPendingAuthorizationsQuery,
 		map[string]interface{}{
 			"regID": regID,
 			"now":   ssa.clk.Now(),
@@ -790,6 +1959,16 @@ func (ssa *SQLStorageAuthority) CountPendingAuthorizations(regID int64) (count i
 	return
 }
 
+// GetPendingReviewAuthorizations returns the authorizations held for an
+// operator's review that are unexpired at time now, soonest to expire first.
+// Their challenges aren't loaded.
+func (ssa *SQLStorageAuthority) GetPendingReviewAuthorizations(ctx context.Context, now time.Time) ([]core.Authorization, error) {
+	var authzs []core.Authorization
+	_, err := ssa.dbMap.Select(&authzs, getPendingReviewAuthorizationsQuery,
+		map[string]interface{}{"now": now})
+	return authzs, err
+}
+
 // ErrNoReceipt is a error type for non-existent SCT receipt
 type ErrNoReceipt string
 
@@ -799,36 +1978,193 @@ func (e ErrNoReceipt) Error() string {
 
 // GetSCTReceipt gets a specific SCT receipt for a given certificate serial and
 // CT log ID
-func (ssa *SQLStorageAuthority) GetSCTReceipt(serial string, logID string) (receipt core.SignedCertificateTimestamp, err error) {
+func (ssa *SQLStorageAuthority) GetSCTReceipt(ctx context.Context, serial string, logID string) (receipt core.SignedCertificateTimestamp, err error) {
+	submissions, err := ssa.capable(CapabilityCTSubmissions)
+	if err != nil {
+		return
+	}
+	if !submissions {
+		err = ssa.dbMap.SelectOne(
+			&receipt,
+			getSCTReceiptQuery,
+			map[string]interface{}{
+				"serial": serial,
+				"logID":  logID,
+			},
+		)
+		if err == sql.ErrNoRows {
+			err = ErrNoReceipt(err.Error())
+		}
+		return
+	}
+
+	var submission core.CTSubmission
 	err = ssa.dbMap.SelectOne(
-		&receipt,
-		"SELECT * FROM sctReceipts WHERE certificateSerial = :serial AND logID = :logID",
+		&submission,
+		getCTSubmissionQuery,
 		map[string]interface{}{
 			"serial": serial,
 			"logID":  logID,
 		},
 	)
-
 	if err == sql.ErrNoRows {
 		err = ErrNoReceipt(err.Error())
 		return
 	}
+	if err != nil {
+		return
+	}
+	if submission.Status != core.CTSubmissionSubmitted {
+		err = ErrNoReceipt(fmt.Sprintf("No SCT yet for %s from log %s", serial, logID))
+		return
+	}
 
-	return
+	return submission.SCT(), nil
 }
 
-// ErrDuplicateReceipt is a error type for duplicate SCT receipts
-type ErrDuplicateReceipt string
+// GetCTSubmissions returns the submissions of the certificate with the
+// given serial to each CT log it has been submitted to.
+func (ssa *SQLStorageAuthority) GetCTSubmissions(ctx context.Context, serial string) ([]core.CTSubmission, error) {
+	capable, err := ssa.capable(CapabilityCTSubmissions)
+	if err != nil {
+		return nil, err
+	}
+	if !capable {
+		return ssa.getSCTReceiptSubmissions(serial)
+	}
 
-func (e ErrDuplicateReceipt) Error() string {
-	return string(e)
+	var submissions []core.CTSubmission
+	_, err = ssa.dbMap.Select(
+		&submissions,
+		"SELECT * FROM ctSubmissions WHERE certificateSerial = :serial ORDER BY logID",
+		map[string]interface{}{"serial": serial},
+	)
+	return submissions, err
+}
+
+// getSCTReceiptSubmissions returns the receipts in sctReceipts for the
+// certificate with the given serial as submissions, until ctSubmissions
+// replaces it. Their inclusion in the logs isn't known.
+func (ssa *SQLStorageAuthority) getSCTReceiptSubmissions(serial string) ([]core.CTSubmission, error) {
+	var receipts []core.SignedCertificateTimestamp
+	_, err := ssa.dbMap.Select(
+		&receipts,
+		"SELECT * FROM sctReceipts WHERE certificateSerial = :serial ORDER BY logID",
+		map[string]interface{}{"serial": serial},
+	)
+	if err != nil {
+		return nil, err
+	}
+	submissions := make([]core.CTSubmission, len(receipts))
+	for i, receipt := range receipts {
+		submissions[i] = core.CTSubmission{
+			ID:                int64(receipt.ID),
+			CertificateSerial: receipt.CertificateSerial,
+			LogID:             receipt.LogID,
+			Status:            core.CTSubmissionSubmitted,
+			Attempts:          1,
+			LastAttempt:       time.Unix(0, int64(receipt.Timestamp)*int64(time.Millisecond)).UTC(),
+			SCTVersion:        receipt.SCTVersion,
+			Timestamp:         receipt.Timestamp,
+			Extensions:        receipt.Extensions,
+			Signature:         receipt.Signature,
+		}
+	}
+	return submissions, nil
 }
 
-// AddSCTReceipt adds a new SCT receipt to the (append-only) sctReceipts table
-func (ssa *SQLStorageAuthority) AddSCTReceipt(sct core.SignedCertificateTimestamp) error {
-	err := ssa.dbMap.Insert(&sct)
-	if err != nil && strings.HasPrefix(err.Error(), "Error 1062: Duplicate entry") {
-		err = ErrDuplicateReceipt(err.Error())
+// RecordCTSubmission records an attempt to submit a certificate to a CT log:
+// the SCT obtained, if attempt's Status is CTSubmissionSubmitted, or
+// otherwise the error in its LastError. Attempts are counted, and once a
+// log's SCT is recorded later attempts for it are ignored. Until
+// ctSubmissions replaces sctReceipts only SCTs are recorded.
+func (ssa *SQLStorageAuthority) RecordCTSubmission(ctx context.Context, attempt core.CTSubmission) error {
+	capable, err := ssa.capable(CapabilityCTSubmissions)
+	if err != nil {
+		return err
 	}
-	return err
+	if !capable {
+		if attempt.Status != core.CTSubmissionSubmitted {
+			return nil
+		}
+		receipt := attempt.SCT()
+		err = ssa.dbMap.Insert(&receipt)
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == mysqlDuplicateEntry {
+			return nil
+		}
+		return err
+	}
+
+	tx, err := ssa.dbMap.Begin()
+	if err != nil {
+		return err
+	}
+
+	var submission core.CTSubmission
+	err = tx.SelectOne(
+		&submission,
+		getCTSubmissionQuery,
+		map[string]interface{}{
+			"serial": attempt.CertificateSerial,
+			"logID":  attempt.LogID,
+		},
+	)
+	exists := err == nil
+	if err != nil && err != sql.ErrNoRows {
+		tx.Rollback()
+		return err
+	}
+	if exists && submission.Status == core.CTSubmissionSubmitted {
+		return tx.Commit()
+	}
+
+	attempt.ID = submission.ID
+	attempt.LockCol = submission.LockCol
+	attempt.Attempts = submission.Attempts + 1
+	attempt.LastAttempt = ssa.clk.Now()
+	if attempt.Status == core.CTSubmissionSubmitted {
+		attempt.LastError = ""
+		attempt.InclusionStatus = core.CTInclusionUnverified
+	} else {
+		attempt.Status = core.CTSubmissionPending
+		attempt.InclusionStatus = ""
+	}
+
+	if exists {
+		_, err = tx.Update(&attempt)
+	} else {
+		err = tx.Insert(&attempt)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// RecordCTInclusion records whether the CT log with the given ID has been
+// seen to include the certificate with the given serial, which it must
+// have issued an SCT for.
+func (ssa *SQLStorageAuthority) RecordCTInclusion(ctx context.Context, serial, logID string, status core.CTInclusionStatus) error {
+	switch status {
+	case core.CTInclusionUnverified, core.CTInclusionVerified, core.CTInclusionMissing:
+	default:
+		return berrors.MalformedError("Unknown CT inclusion status %q", status)
+	}
+	if err := ssa.requireCapability(CapabilityCTSubmissions); err != nil {
+		return err
+	}
+	result, err := ssa.dbMap.Exec(
+		`UPDATE ctSubmissions SET inclusionStatus = ?, LockCol = LockCol + 1
+		 WHERE certificateSerial = ? AND logID = ? AND status = ?`,
+		string(status), serial, logID, string(core.CTSubmissionSubmitted))
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return berrors.NotFoundError("No SCT for %s from log %s", serial, logID)
+	}
+	return nil
 }
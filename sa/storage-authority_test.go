@@ -7,11 +7,15 @@ package sa
 
 import (
 	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -22,15 +26,20 @@ import (
 	"time"
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
-	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
 
 	"github.com/letsencrypt/boulder/core"
+	berrors "github.com/letsencrypt/boulder/errors"
+	"github.com/letsencrypt/boulder/identifier"
 	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/probs"
 	"github.com/letsencrypt/boulder/sa/satest"
 	"github.com/letsencrypt/boulder/test"
 	"github.com/letsencrypt/boulder/test/vars"
 )
 
+var ctx = context.Background()
+
 var log = mocks.UseMockLog()
 
 // initSA constructs a SQLStorageAuthority and a clean up function
@@ -73,7 +82,7 @@ func TestAddRegistration(t *testing.T) {
 		t.Fatalf("unable to parse contact link: %s", err)
 	}
 	contacts := []*core.AcmeURL{contact}
-	reg, err := sa.NewRegistration(core.Registration{
+	reg, err := sa.NewRegistration(ctx, core.Registration{
 		Key:       jwk,
 		Contact:   contacts,
 		InitialIP: net.ParseIP("43.34.43.34"),
@@ -84,10 +93,10 @@ func TestAddRegistration(t *testing.T) {
 	test.Assert(t, reg.ID != 0, "ID shouldn't be 0")
 	test.AssertDeepEquals(t, reg.Contact, contacts)
 
-	_, err = sa.GetRegistration(0)
+	_, err = sa.GetRegistration(ctx, 0)
 	test.AssertError(t, err, "Registration object for ID 0 was returned")
 
-	dbReg, err := sa.GetRegistration(reg.ID)
+	dbReg, err := sa.GetRegistration(ctx, reg.ID)
 	test.AssertNotError(t, err, fmt.Sprintf("Couldn't get registration with ID %v", reg.ID))
 
 	expectedReg := core.Registration{
@@ -107,19 +116,21 @@ func TestAddRegistration(t *testing.T) {
 		Contact:   []*core.AcmeURL{u},
 		InitialIP: net.ParseIP("72.72.72.72"),
 		Agreement: "yes",
+		Tier:      core.TierTrustedIntegrator,
 	}
-	err = sa.UpdateRegistration(newReg)
+	err = sa.UpdateRegistration(ctx, newReg)
 	test.AssertNotError(t, err, fmt.Sprintf("Couldn't get registration with ID %v", reg.ID))
-	dbReg, err = sa.GetRegistrationByKey(jwk)
+	dbReg, err = sa.GetRegistrationByKey(ctx, jwk)
 	test.AssertNotError(t, err, "Couldn't get registration by key")
 
 	test.AssertEquals(t, dbReg.ID, newReg.ID)
 	test.AssertEquals(t, dbReg.Agreement, newReg.Agreement)
+	test.AssertEquals(t, dbReg.Tier, core.TierTrustedIntegrator)
 
-	var anotherJWK jose.JsonWebKey
+	var anotherJWK jose.JSONWebKey
 	err = json.Unmarshal([]byte(anotherKey), &anotherJWK)
 	test.AssertNotError(t, err, "couldn't unmarshal anotherJWK")
-	_, err = sa.GetRegistrationByKey(anotherJWK)
+	_, err = sa.GetRegistrationByKey(ctx, anotherJWK)
 	test.AssertError(t, err, "Registration object for invalid key was returned")
 }
 
@@ -127,21 +138,61 @@ func TestNoSuchRegistrationErrors(t *testing.T) {
 	sa, _, cleanUp := initSA(t)
 	defer cleanUp()
 
-	_, err := sa.GetRegistration(100)
+	_, err := sa.GetRegistration(ctx, 100)
 	if _, ok := err.(core.NoSuchRegistrationError); !ok {
 		t.Errorf("GetRegistration: expected NoSuchRegistrationError, got %T type error (%s)", err, err)
 	}
 
 	jwk := satest.GoodJWK()
-	_, err = sa.GetRegistrationByKey(jwk)
+	_, err = sa.GetRegistrationByKey(ctx, jwk)
 	if _, ok := err.(core.NoSuchRegistrationError); !ok {
 		t.Errorf("GetRegistrationByKey: expected a NoSuchRegistrationError, got %T type error (%s)", err, err)
 	}
 
-	err = sa.UpdateRegistration(core.Registration{ID: 100, Key: jwk})
+	err = sa.UpdateRegistration(ctx, core.Registration{ID: 100, Key: jwk})
 	if _, ok := err.(core.NoSuchRegistrationError); !ok {
 		t.Errorf("UpdateRegistration: expected a NoSuchRegistrationError, got %T type error (%v)", err, err)
 	}
+
+	// Nothing is stored for a registration that doesn't exist
+	_, err = sa.NewPendingAuthorization(ctx, core.Authorization{RegistrationID: 100})
+	if _, ok := err.(core.NoSuchRegistrationError); !ok {
+		t.Errorf("NewPendingAuthorization: expected a NoSuchRegistrationError, got %T type error (%v)", err, err)
+	}
+
+	certDER, err := ioutil.ReadFile("www.eff.org.der")
+	test.AssertNotError(t, err, "Couldn't read example cert DER")
+	_, err = sa.AddCertificate(ctx, certDER, 100)
+	if _, ok := err.(core.NoSuchRegistrationError); !ok {
+		t.Errorf("AddCertificate: expected a NoSuchRegistrationError, got %T type error (%v)", err, err)
+	}
+}
+
+func TestNotFoundErrors(t *testing.T) {
+	sa, _, cleanUp := initSA(t)
+	defer cleanUp()
+
+	reg := satest.CreateWorkingRegistration(t, sa)
+	serial := "000000000000000000000000000000021bd4"
+	notFound := map[string]error{}
+
+	_, notFound["GetAuthorization"] = sa.GetAuthorization(ctx, "missing")
+	_, notFound["GetLatestValidAuthorization"] = sa.GetLatestValidAuthorization(ctx, reg.ID,
+		identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: "example.org"})
+	notFound["UpdatePendingAuthorization"] = sa.UpdatePendingAuthorization(ctx,
+		core.Authorization{ID: "missing", Status: core.StatusPending})
+	notFound["FinalizeAuthorization"] = sa.FinalizeAuthorization(ctx,
+		core.Authorization{ID: "missing", Status: core.StatusValid})
+	_, notFound["GetCertificate"] = sa.GetCertificate(ctx, serial)
+	_, notFound["GetCertificateStatus"] = sa.GetCertificateStatus(ctx, serial)
+	notFound["MarkCertificateRevoked"] = sa.MarkCertificateRevoked(ctx, serial, core.RevocationKeyCompromise)
+	notFound["UpdateOCSP"] = sa.UpdateOCSP(ctx, serial, []byte{})
+
+	for method, err := range notFound {
+		if !berrors.Is(err, berrors.NotFound) {
+			t.Errorf("%s: expected a NotFoundError, got %T type error (%v)", method, err, err)
+		}
+	}
 }
 
 func TestCountPendingAuthorizations(t *testing.T) {
@@ -155,18 +206,68 @@ func TestCountPendingAuthorizations(t *testing.T) {
 		Expires:        &expires,
 	}
 
-	pendingAuthz, err := sa.NewPendingAuthorization(pendingAuthz)
+	pendingAuthz, err := sa.NewPendingAuthorization(ctx, pendingAuthz)
+	test.AssertNotError(t, err, "Couldn't create new pending authorization")
+	count, err := sa.CountPendingAuthorizations(ctx, reg.ID)
+	test.AssertNotError(t, err, "Couldn't count pending authorizations")
+	test.AssertEquals(t, count, 1)
+
+	// Authorizations held for review aren't counted
+	_, err = sa.NewPendingAuthorization(ctx, core.Authorization{
+		RegistrationID: reg.ID,
+		Status:         core.StatusPendingReview,
+		Expires:        &expires,
+	})
 	test.AssertNotError(t, err, "Couldn't create new pending authorization")
-	count, err := sa.CountPendingAuthorizations(reg.ID)
+	count, err = sa.CountPendingAuthorizations(ctx, reg.ID)
 	test.AssertNotError(t, err, "Couldn't count pending authorizations")
 	test.AssertEquals(t, count, 1)
 
 	fc.Add(2 * time.Hour)
-	count, err = sa.CountPendingAuthorizations(reg.ID)
+	count, err = sa.CountPendingAuthorizations(ctx, reg.ID)
 	test.AssertNotError(t, err, "Couldn't count pending authorizations")
 	test.AssertEquals(t, count, 0)
 }
 
+func TestNewPendingAuthorizations(t *testing.T) {
+	sa, _, cleanUp := initSA(t)
+	defer cleanUp()
+
+	reg := satest.CreateWorkingRegistration(t, sa)
+	var authzs []core.Authorization
+	for _, name := range []string{"a.example.com", "b.example.com", "c.example.com"} {
+		authzs = append(authzs, core.Authorization{
+			RegistrationID: reg.ID,
+			Identifier:     identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: name},
+			Status:         core.StatusPending,
+			Challenges:     []core.Challenge{core.Challenge{Type: "http-01"}, core.Challenge{Type: "dns-01"}},
+		})
+	}
+
+	stored, err := sa.NewPendingAuthorizations(ctx, authzs)
+	test.AssertNotError(t, err, "Couldn't create new pending authorizations")
+	test.AssertEquals(t, len(stored), len(authzs))
+	challIDs := make(map[int64]bool)
+	for i, authz := range stored {
+		test.Assert(t, authz.ID != "", "ID shouldn't be blank")
+		test.AssertEquals(t, authz.Identifier, authzs[i].Identifier)
+		test.AssertEquals(t, authzs[i].Challenges[0].ID, int64(0))
+		for _, chall := range authz.Challenges {
+			test.Assert(t, chall.ID != 0, "Challenge ID shouldn't be zero")
+			challIDs[chall.ID] = true
+		}
+
+		dbAuthz, err := sa.GetAuthorization(ctx, authz.ID)
+		test.AssertNotError(t, err, "Couldn't get pending authorization with ID "+authz.ID)
+		test.AssertMarshaledEquals(t, authz, dbAuthz)
+	}
+	test.AssertEquals(t, len(challIDs), 6)
+
+	count, err := sa.CountPendingAuthorizations(ctx, reg.ID)
+	test.AssertNotError(t, err, "Couldn't count pending authorizations")
+	test.AssertEquals(t, count, 3)
+}
+
 func TestAddAuthorization(t *testing.T) {
 	sa, _, cleanUp := initSA(t)
 	defer cleanUp()
@@ -174,11 +275,11 @@ func TestAddAuthorization(t *testing.T) {
 	reg := satest.CreateWorkingRegistration(t, sa)
 	PA := core.Authorization{RegistrationID: reg.ID}
 
-	PA, err := sa.NewPendingAuthorization(PA)
+	PA, err := sa.NewPendingAuthorization(ctx, PA)
 	test.AssertNotError(t, err, "Couldn't create new pending authorization")
 	test.Assert(t, PA.ID != "", "ID shouldn't be blank")
 
-	dbPa, err := sa.GetAuthorization(PA.ID)
+	dbPa, err := sa.GetAuthorization(ctx, PA.ID)
 	test.AssertNotError(t, err, "Couldn't get pending authorization with ID "+PA.ID)
 	test.AssertMarshaledEquals(t, PA, dbPa)
 
@@ -189,16 +290,16 @@ func TestAddAuthorization(t *testing.T) {
 	combos[0] = []int{0, 1}
 
 	exp := time.Now().AddDate(0, 0, 1)
-	identifier := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "wut.com"}
+	identifier := identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: "wut.com"}
 	newPa := core.Authorization{ID: PA.ID, Identifier: identifier, RegistrationID: reg.ID, Status: core.StatusPending, Expires: &exp, Combinations: combos}
-	err = sa.UpdatePendingAuthorization(newPa)
+	err = sa.UpdatePendingAuthorization(ctx, newPa)
 	test.AssertNotError(t, err, "Couldn't update pending authorization with ID "+PA.ID)
 
 	newPa.Status = core.StatusValid
-	err = sa.FinalizeAuthorization(newPa)
+	err = sa.FinalizeAuthorization(ctx, newPa)
 	test.AssertNotError(t, err, "Couldn't finalize pending authorization with ID "+PA.ID)
 
-	dbPa, err = sa.GetAuthorization(PA.ID)
+	dbPa, err = sa.GetAuthorization(ctx, PA.ID)
 	test.AssertNotError(t, err, "Couldn't get authorization with ID "+PA.ID)
 }
 
@@ -209,7 +310,7 @@ func CreateDomainAuth(t *testing.T, domainName string, sa *SQLStorageAuthority)
 func CreateDomainAuthWithRegID(t *testing.T, domainName string, sa *SQLStorageAuthority, regID int64) (authz core.Authorization) {
 
 	// create pending auth
-	authz, err := sa.NewPendingAuthorization(core.Authorization{RegistrationID: regID, Challenges: []core.Challenge{core.Challenge{}}})
+	authz, err := sa.NewPendingAuthorization(ctx, core.Authorization{RegistrationID: regID, Challenges: []core.Challenge{core.Challenge{}}})
 	if err != nil {
 		t.Fatalf("Couldn't create new pending authorization: %s", err)
 	}
@@ -223,13 +324,13 @@ func CreateDomainAuthWithRegID(t *testing.T, domainName string, sa *SQLStorageAu
 
 	// validate pending auth
 	authz.Status = core.StatusPending
-	authz.Identifier = core.AcmeIdentifier{Type: core.IdentifierDNS, Value: domainName}
+	authz.Identifier = identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: domainName}
 	authz.Expires = &exp
 	authz.Challenges = []core.Challenge{chall}
 	authz.Combinations = combos
 
 	// save updated auth
-	err = sa.UpdatePendingAuthorization(authz)
+	err = sa.UpdatePendingAuthorization(ctx, authz)
 	test.AssertNotError(t, err, "Couldn't update pending authorization with ID "+authz.ID)
 
 	return
@@ -241,7 +342,7 @@ func TestGetLatestValidAuthorizationBasic(t *testing.T) {
 	defer cleanUp()
 
 	// attempt to get unauthorized domain
-	authz, err := sa.GetLatestValidAuthorization(0, core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "example.org"})
+	authz, err := sa.GetLatestValidAuthorization(ctx, 0, identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: "example.org"})
 	test.AssertError(t, err, "Should not have found a valid auth for example.org")
 
 	reg := satest.CreateWorkingRegistration(t, sa)
@@ -251,15 +352,15 @@ func TestGetLatestValidAuthorizationBasic(t *testing.T) {
 
 	// finalize auth
 	authz.Status = core.StatusValid
-	err = sa.FinalizeAuthorization(authz)
+	err = sa.FinalizeAuthorization(ctx, authz)
 	test.AssertNotError(t, err, "Couldn't finalize pending authorization with ID "+authz.ID)
 
 	// attempt to get authorized domain with wrong RegID
-	authz, err = sa.GetLatestValidAuthorization(0, core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "example.org"})
+	authz, err = sa.GetLatestValidAuthorization(ctx, 0, identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: "example.org"})
 	test.AssertError(t, err, "Should not have found a valid auth for example.org and regID 0")
 
 	// get authorized domain
-	authz, err = sa.GetLatestValidAuthorization(reg.ID, core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "example.org"})
+	authz, err = sa.GetLatestValidAuthorization(ctx, reg.ID, identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: "example.org"})
 	test.AssertNotError(t, err, "Should have found a valid auth for example.org and regID 42")
 	test.AssertEquals(t, authz.Status, core.StatusValid)
 	test.AssertEquals(t, authz.Identifier.Type, core.IdentifierDNS)
@@ -273,7 +374,7 @@ func TestGetLatestValidAuthorizationMultiple(t *testing.T) {
 	defer cleanUp()
 
 	domain := "example.org"
-	ident := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: domain}
+	ident := identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: domain}
 	var err error
 
 	reg := satest.CreateWorkingRegistration(t, sa)
@@ -282,11 +383,11 @@ func TestGetLatestValidAuthorizationMultiple(t *testing.T) {
 	exp := time.Now().AddDate(0, 0, 10) // expire in 10 day
 	authz.Expires = &exp
 	authz.Status = core.StatusInvalid
-	err = sa.FinalizeAuthorization(authz)
+	err = sa.FinalizeAuthorization(ctx, authz)
 	test.AssertNotError(t, err, "Couldn't finalize pending authorization with ID "+authz.ID)
 
 	// should not get the auth
-	authz, err = sa.GetLatestValidAuthorization(reg.ID, ident)
+	authz, err = sa.GetLatestValidAuthorization(ctx, reg.ID, ident)
 	test.AssertError(t, err, "Should not have found a valid auth for "+domain)
 
 	// create valid auth
@@ -294,11 +395,11 @@ func TestGetLatestValidAuthorizationMultiple(t *testing.T) {
 	exp = time.Now().AddDate(0, 0, 1) // expire in 1 day
 	authz.Expires = &exp
 	authz.Status = core.StatusValid
-	err = sa.FinalizeAuthorization(authz)
+	err = sa.FinalizeAuthorization(ctx, authz)
 	test.AssertNotError(t, err, "Couldn't finalize pending authorization with ID "+authz.ID)
 
 	// should get the valid auth even if it's expire date is lower than the invalid one
-	authz, err = sa.GetLatestValidAuthorization(reg.ID, ident)
+	authz, err = sa.GetLatestValidAuthorization(ctx, reg.ID, ident)
 	test.AssertNotError(t, err, "Should have found a valid auth for "+domain)
 	test.AssertEquals(t, authz.Status, core.StatusValid)
 	test.AssertEquals(t, authz.Identifier.Type, ident.Type)
@@ -310,10 +411,10 @@ func TestGetLatestValidAuthorizationMultiple(t *testing.T) {
 	exp = time.Now().AddDate(0, 0, 2) // expire in 2 day
 	newAuthz.Expires = &exp
 	newAuthz.Status = core.StatusValid
-	err = sa.FinalizeAuthorization(newAuthz)
+	err = sa.FinalizeAuthorization(ctx, newAuthz)
 	test.AssertNotError(t, err, "Couldn't finalize pending authorization with ID "+newAuthz.ID)
 
-	authz, err = sa.GetLatestValidAuthorization(reg.ID, ident)
+	authz, err = sa.GetLatestValidAuthorization(ctx, reg.ID, ident)
 	test.AssertNotError(t, err, "Should have found a valid auth for "+domain)
 	test.AssertEquals(t, authz.Status, core.StatusValid)
 	test.AssertEquals(t, authz.Identifier.Type, ident.Type)
@@ -323,6 +424,131 @@ func TestGetLatestValidAuthorizationMultiple(t *testing.T) {
 	test.AssertEquals(t, authz.ID, newAuthz.ID)
 }
 
+func TestDeactivateAuthorization(t *testing.T) {
+	sa, _, cleanUp := initSA(t)
+	defer cleanUp()
+
+	reg := satest.CreateWorkingRegistration(t, sa)
+	ident := identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: "example.org"}
+
+	// A pending authorization becomes a final, deactivated one
+	pending := CreateDomainAuthWithRegID(t, ident.Value, sa, reg.ID)
+	err := sa.DeactivateAuthorization(ctx, pending.ID)
+	test.AssertNotError(t, err, "Couldn't deactivate pending authorization")
+	authz, err := sa.GetAuthorization(ctx, pending.ID)
+	test.AssertNotError(t, err, "Couldn't get deactivated authorization")
+	test.AssertEquals(t, authz.Status, core.StatusDeactivated)
+	count, err := sa.CountPendingAuthorizations(ctx, reg.ID)
+	test.AssertNotError(t, err, "Couldn't count pending authorizations")
+	test.AssertEquals(t, count, 0)
+
+	// A valid authorization can no longer be used for issuance
+	valid := CreateDomainAuthWithRegID(t, ident.Value, sa, reg.ID)
+	valid.Status = core.StatusValid
+	err = sa.FinalizeAuthorization(ctx, valid)
+	test.AssertNotError(t, err, "Couldn't finalize pending authorization")
+	err = sa.DeactivateAuthorization(ctx, valid.ID)
+	test.AssertNotError(t, err, "Couldn't deactivate valid authorization")
+	_, err = sa.GetLatestValidAuthorization(ctx, reg.ID, ident)
+	test.AssertError(t, err, "Found a valid authorization after deactivating it")
+
+	// Deactivated and nonexistent authorizations can't be deactivated
+	err = sa.DeactivateAuthorization(ctx, valid.ID)
+	test.AssertError(t, err, "Deactivated a deactivated authorization")
+	test.Assert(t, berrors.Is(err, berrors.Malformed), "Deactivating a deactivated authorization wasn't Malformed")
+	err = sa.DeactivateAuthorization(ctx, "nonexistent")
+	test.AssertError(t, err, "Deactivated a nonexistent authorization")
+	test.Assert(t, berrors.Is(err, berrors.NotFound), "Deactivating a nonexistent authorization wasn't NotFound")
+}
+
+func TestGetAuthorizations(t *testing.T) {
+	sa, _, cleanUp := initSA(t)
+	defer cleanUp()
+
+	reg := satest.CreateWorkingRegistration(t, sa)
+	now := time.Now()
+
+	// example.org has an invalid authz expiring last and a valid one
+	invalid := CreateDomainAuthWithRegID(t, "example.org", sa, reg.ID)
+	exp := now.AddDate(0, 0, 10)
+	invalid.Expires = &exp
+	invalid.Status = core.StatusInvalid
+	err := sa.FinalizeAuthorization(ctx, invalid)
+	test.AssertNotError(t, err, "Couldn't finalize pending authorization with ID "+invalid.ID)
+
+	valid := CreateDomainAuthWithRegID(t, "example.org", sa, reg.ID)
+	valid.Status = core.StatusValid
+	err = sa.FinalizeAuthorization(ctx, valid)
+	test.AssertNotError(t, err, "Couldn't finalize pending authorization with ID "+valid.ID)
+
+	// example.net only has a pending authz
+	pending := CreateDomainAuthWithRegID(t, "example.net", sa, reg.ID)
+
+	// example.com only has an expired valid authz
+	expired := CreateDomainAuthWithRegID(t, "example.com", sa, reg.ID)
+	exp = now.AddDate(0, 0, -1)
+	expired.Expires = &exp
+	expired.Status = core.StatusValid
+	err = sa.FinalizeAuthorization(ctx, expired)
+	test.AssertNotError(t, err, "Couldn't finalize pending authorization with ID "+expired.ID)
+
+	names := []string{"example.org", "example.net", "example.com", "example.edu"}
+	authzs, err := sa.GetAuthorizations(ctx, reg.ID, names, now)
+	test.AssertNotError(t, err, "Couldn't get authorizations")
+	test.AssertEquals(t, len(authzs), 3)
+	test.AssertEquals(t, authzs["example.org"].ID, valid.ID)
+	test.AssertEquals(t, authzs["example.org"].Status, core.StatusValid)
+	test.AssertEquals(t, authzs["example.net"].ID, pending.ID)
+	test.AssertEquals(t, authzs["example.net"].Status, core.StatusPending)
+	test.AssertEquals(t, authzs["example.com"].ID, expired.ID)
+	_, present := authzs["example.edu"]
+	test.Assert(t, !present, "Should not have found an authorization for example.edu")
+
+	// Authorizations of other registrations are not returned
+	authzs, err = sa.GetAuthorizations(ctx, reg.ID+1, names, now)
+	test.AssertNotError(t, err, "Couldn't get authorizations")
+	test.AssertEquals(t, len(authzs), 0)
+}
+
+func TestGetReusableAuthorizations(t *testing.T) {
+	sa, _, cleanUp := initSA(t)
+	defer cleanUp()
+
+	reg := satest.CreateWorkingRegistration(t, sa)
+	now := time.Now()
+
+	// example.org has a pending authz and a valid one, which wins
+	CreateDomainAuthWithRegID(t, "example.org", sa, reg.ID)
+	valid := CreateDomainAuthWithRegID(t, "example.org", sa, reg.ID)
+	valid.Status = core.StatusValid
+	err := sa.FinalizeAuthorization(ctx, valid)
+	test.AssertNotError(t, err, "Couldn't finalize pending authorization with ID "+valid.ID)
+
+	// example.net only has a pending authz
+	pending := CreateDomainAuthWithRegID(t, "example.net", sa, reg.ID)
+
+	// example.com only has an invalid authz, which isn't reusable
+	invalid := CreateDomainAuthWithRegID(t, "example.com", sa, reg.ID)
+	invalid.Status = core.StatusInvalid
+	err = sa.FinalizeAuthorization(ctx, invalid)
+	test.AssertNotError(t, err, "Couldn't finalize pending authorization with ID "+invalid.ID)
+
+	names := []string{"example.org", "example.net", "example.com", "example.edu"}
+	authzs, err := sa.GetReusableAuthorizations(ctx, reg.ID, names, now)
+	test.AssertNotError(t, err, "Couldn't get reusable authorizations")
+	test.AssertEquals(t, len(authzs), 2)
+	test.AssertEquals(t, authzs["example.org"].ID, valid.ID)
+	test.AssertEquals(t, authzs["example.org"].Status, core.StatusValid)
+	test.AssertEquals(t, len(authzs["example.org"].Challenges), 1)
+	test.AssertEquals(t, authzs["example.net"].ID, pending.ID)
+	test.AssertEquals(t, len(authzs["example.net"].Challenges), 1)
+
+	// Nothing is reusable once it expires
+	authzs, err = sa.GetReusableAuthorizations(ctx, reg.ID, names, now.AddDate(0, 0, 2))
+	test.AssertNotError(t, err, "Couldn't get reusable authorizations")
+	test.AssertEquals(t, len(authzs), 0)
+}
+
 func TestAddCertificate(t *testing.T) {
 	sa, _, cleanUp := initSA(t)
 	defer cleanUp()
@@ -333,41 +559,110 @@ func TestAddCertificate(t *testing.T) {
 	certDER, err := ioutil.ReadFile("www.eff.org.der")
 	test.AssertNotError(t, err, "Couldn't read example cert DER")
 
-	digest, err := sa.AddCertificate(certDER, reg.ID)
+	digest, err := sa.AddCertificate(ctx, certDER, reg.ID)
 	test.AssertNotError(t, err, "Couldn't add www.eff.org.der")
 	test.AssertEquals(t, digest, "qWoItDZmR4P9eFbeYgXXP3SR4ApnkQj8x4LsB_ORKBo")
 
-	retrievedCert, err := sa.GetCertificate("000000000000000000000000000000021bd4")
+	retrievedCert, err := sa.GetCertificate(ctx, "000000000000000000000000000000021bd4")
 	test.AssertNotError(t, err, "Couldn't get www.eff.org.der by full serial")
 	test.AssertByteEquals(t, certDER, retrievedCert.DER)
 
-	certificateStatus, err := sa.GetCertificateStatus("000000000000000000000000000000021bd4")
+	certificateStatus, err := sa.GetCertificateStatus(ctx, "000000000000000000000000000000021bd4")
 	test.AssertNotError(t, err, "Couldn't get status for www.eff.org.der")
 	test.Assert(t, !certificateStatus.SubscriberApproved, "SubscriberApproved should be false")
 	test.Assert(t, certificateStatus.Status == core.OCSPStatusGood, "OCSP Status should be good")
 	test.Assert(t, certificateStatus.OCSPLastUpdated.IsZero(), "OCSPLastUpdated should be nil")
 
+	// The issuer is recorded by the certificate's authority key ID
+	parsed, err := x509.ParseCertificate(certDER)
+	test.AssertNotError(t, err, "Couldn't parse www.eff.org.der")
+	issuerKeyID, err := sa.GetCertificateIssuer(ctx, "000000000000000000000000000000021bd4")
+	test.AssertNotError(t, err, "Couldn't get issuer of www.eff.org.der")
+	test.AssertEquals(t, issuerKeyID, hex.EncodeToString(parsed.AuthorityKeyId))
+
 	// Test cert generated locally by Boulder / CFSSL, names [example.com,
 	// www.example.com, admin.example.com]
 	certDER2, err := ioutil.ReadFile("test-cert.der")
 	test.AssertNotError(t, err, "Couldn't read example cert DER")
 	serial := "ffdd9b8a82126d96f61d378d5ba99a0474f0"
 
-	digest2, err := sa.AddCertificate(certDER2, reg.ID)
+	digest2, err := sa.AddCertificate(ctx, certDER2, reg.ID)
 	test.AssertNotError(t, err, "Couldn't add test-cert.der")
 	test.AssertEquals(t, digest2, "vrlPN5wIPME1D2PPsCy-fGnTWh8dMyyYQcXPRkjHAQI")
 
-	retrievedCert2, err := sa.GetCertificate(serial)
+	retrievedCert2, err := sa.GetCertificate(ctx, serial)
 	test.AssertNotError(t, err, "Couldn't get test-cert.der")
 	test.AssertByteEquals(t, certDER2, retrievedCert2.DER)
 
-	certificateStatus2, err := sa.GetCertificateStatus(serial)
+	certificateStatus2, err := sa.GetCertificateStatus(ctx, serial)
 	test.AssertNotError(t, err, "Couldn't get status for test-cert.der")
 	test.Assert(t, !certificateStatus2.SubscriberApproved, "SubscriberApproved should be false")
 	test.Assert(t, certificateStatus2.Status == core.OCSPStatusGood, "OCSP Status should be good")
 	test.Assert(t, certificateStatus2.OCSPLastUpdated.IsZero(), "OCSPLastUpdated should be nil")
 }
 
+func TestAddShortLivedCertificate(t *testing.T) {
+	sa, fc, cleanUp := initSA(t)
+	defer cleanUp()
+
+	reg := satest.CreateWorkingRegistration(t, sa)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Couldn't generate key")
+	addShortLived := func(serial int64) core.CertificateStatus {
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			NotBefore:    fc.Now(),
+			NotAfter:     fc.Now().Add(core.ShortLivedValidity),
+		}
+		certDER, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+		test.AssertNotError(t, err, "Couldn't create short-lived certificate")
+		_, err = sa.AddCertificate(ctx, certDER, reg.ID)
+		test.AssertNotError(t, err, "Couldn't add short-lived certificate")
+		status, err := sa.GetCertificateStatus(ctx, core.SerialToString(template.SerialNumber))
+		test.AssertNotError(t, err, "Couldn't get short-lived certificate status")
+		return status
+	}
+
+	status := addShortLived(1)
+	test.Assert(t, status.IsShortLived, "Short-lived certificate status isn't marked")
+	test.Assert(t, status.OCSPLastUpdated.IsZero(), "OCSPLastUpdated should be nil")
+
+	// Until the schema has isShortLived, the status counts as updated until
+	// the certificate expires
+	sa.capabilities.set([]string{CapabilityKeyHashes, CapabilityCertificateIssuers})
+	status = addShortLived(2)
+	test.Assert(t, !status.IsShortLived, "Short-lived certificate status marked without isShortLived")
+	test.AssertEquals(t, status.OCSPLastUpdated.Unix(), fc.Now().Add(core.ShortLivedValidity).Unix())
+}
+
+func TestGetCertificatesByRegistration(t *testing.T) {
+	sa, _, cleanUp := initSA(t)
+	defer cleanUp()
+
+	reg := satest.CreateWorkingRegistration(t, sa)
+	certs, err := sa.GetCertificatesByRegistration(ctx, reg.ID, 0, 10)
+	test.AssertNotError(t, err, "Couldn't list certificates")
+	test.AssertEquals(t, len(certs), 0)
+
+	for _, name := range []string{"www.eff.org.der", "test-cert.der"} {
+		certDER, err := ioutil.ReadFile(name)
+		test.AssertNotError(t, err, "Couldn't read "+name)
+		_, err = sa.AddCertificate(ctx, certDER, reg.ID)
+		test.AssertNotError(t, err, "Couldn't add "+name)
+	}
+
+	// Certificates issued at the same time are ordered by serial
+	certs, err = sa.GetCertificatesByRegistration(ctx, reg.ID, 0, 1)
+	test.AssertNotError(t, err, "Couldn't list certificates")
+	test.AssertEquals(t, len(certs), 1)
+	test.AssertEquals(t, certs[0].Serial, "ffdd9b8a82126d96f61d378d5ba99a0474f0")
+
+	certs, err = sa.GetCertificatesByRegistration(ctx, reg.ID, 1, 10)
+	test.AssertNotError(t, err, "Couldn't list certificates")
+	test.AssertEquals(t, len(certs), 1)
+	test.AssertEquals(t, certs[0].Serial, "000000000000000000000000000000021bd4")
+}
+
 func TestCountCertificatesByNames(t *testing.T) {
 	sa, clk, cleanUp := initSA(t)
 	defer cleanUp()
@@ -387,30 +682,30 @@ func TestCountCertificatesByNames(t *testing.T) {
 	tomorrow := clk.Now().Add(24 * time.Hour)
 
 	// Count for a name that doesn't have any certs
-	counts, err := sa.CountCertificatesByNames([]string{"example.com"}, yesterday, now)
+	counts, err := sa.CountCertificatesByNames(ctx, []string{"example.com"}, yesterday, now)
 	test.AssertNotError(t, err, "Error counting certs.")
 	test.AssertEquals(t, len(counts), 1)
 	test.AssertEquals(t, counts["example.com"], 0)
 
 	// Add the test cert and query for its names.
 	reg := satest.CreateWorkingRegistration(t, sa)
-	_, err = sa.AddCertificate(certDER, reg.ID)
+	_, err = sa.AddCertificate(ctx, certDER, reg.ID)
 	test.AssertNotError(t, err, "Couldn't add test-cert.der")
 
 	// Time range including now should find the cert
-	counts, err = sa.CountCertificatesByNames([]string{"example.com"}, yesterday, now)
+	counts, err = sa.CountCertificatesByNames(ctx, []string{"example.com"}, yesterday, now)
 	test.AssertEquals(t, len(counts), 1)
 	test.AssertEquals(t, counts["example.com"], 1)
 
 	// Time range between two days ago and yesterday should not.
-	counts, err = sa.CountCertificatesByNames([]string{"example.com"}, twoDaysAgo, yesterday)
+	counts, err = sa.CountCertificatesByNames(ctx, []string{"example.com"}, twoDaysAgo, yesterday)
 	test.AssertNotError(t, err, "Error counting certs.")
 	test.AssertEquals(t, len(counts), 1)
 	test.AssertEquals(t, counts["example.com"], 0)
 
 	// Time range between now and tomorrow also should not (time ranges are
 	// inclusive at the tail end, but not the beginning end).
-	counts, err = sa.CountCertificatesByNames([]string{"example.com"}, now, tomorrow)
+	counts, err = sa.CountCertificatesByNames(ctx, []string{"example.com"}, now, tomorrow)
 	test.AssertNotError(t, err, "Error counting certs.")
 	test.AssertEquals(t, len(counts), 1)
 	test.AssertEquals(t, counts["example.com"], 0)
@@ -418,9 +713,9 @@ func TestCountCertificatesByNames(t *testing.T) {
 	// Add a second test cert (for example.co.bn) and query for multiple names.
 	certDER2, err := ioutil.ReadFile("test-cert2.der")
 	test.AssertNotError(t, err, "Couldn't read test-cert2.der")
-	_, err = sa.AddCertificate(certDER2, reg.ID)
+	_, err = sa.AddCertificate(ctx, certDER2, reg.ID)
 	test.AssertNotError(t, err, "Couldn't add test-cert2.der")
-	counts, err = sa.CountCertificatesByNames([]string{"example.com", "foo.com", "example.co.bn"}, yesterday, now.Add(10000*time.Hour))
+	counts, err = sa.CountCertificatesByNames(ctx, []string{"example.com", "foo.com", "example.co.bn"}, yesterday, now.Add(10000*time.Hour))
 	test.AssertNotError(t, err, "Error counting certs.")
 	test.AssertEquals(t, len(counts), 3)
 	test.AssertEquals(t, counts["foo.com"], 0)
@@ -428,6 +723,73 @@ func TestCountCertificatesByNames(t *testing.T) {
 	test.AssertEquals(t, counts["example.co.bn"], 1)
 }
 
+func TestIssuedNameDomains(t *testing.T) {
+	cert := &x509.Certificate{
+		DNSNames:       []string{"example.com", "mail.example.com"},
+		EmailAddresses: []string{"alice@mail.example.com", "bob@Example.ORG", "carol@example.org"},
+	}
+	test.AssertDeepEquals(t, issuedNameDomains(cert), []string{"example.com", "mail.example.com", "example.org"})
+}
+
+func TestCountCertificatesByNamesEmail(t *testing.T) {
+	sa, fc, cleanUp := initSA(t)
+	defer cleanUp()
+
+	// Email addresses count against their domain, once per certificate
+	reg := satest.CreateWorkingRegistration(t, sa)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Couldn't generate key")
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(1),
+		NotBefore:      fc.Now(),
+		NotAfter:       fc.Now().Add(90 * 24 * time.Hour),
+		EmailAddresses: []string{"alice@mail.example.org", "bob@mail.example.org"},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	test.AssertNotError(t, err, "Couldn't create email certificate")
+	_, err = sa.AddCertificate(ctx, certDER, reg.ID)
+	test.AssertNotError(t, err, "Couldn't add email certificate")
+
+	counts, err := sa.CountCertificatesByNames(ctx, []string{"example.org", "mail.example.org"}, fc.Now().Add(-time.Hour), fc.Now().Add(time.Hour))
+	test.AssertNotError(t, err, "Error counting certs.")
+	test.AssertEquals(t, counts["example.org"], 1)
+	test.AssertEquals(t, counts["mail.example.org"], 1)
+}
+
+func TestFQDNSets(t *testing.T) {
+	sa, clk, cleanUp := initSA(t)
+	defer cleanUp()
+	// Names [example.com, www.example.com, admin.example.com]
+	certDER, err := ioutil.ReadFile("test-cert.der")
+	test.AssertNotError(t, err, "Couldn't read example cert DER")
+	names := []string{"www.example.com", "Admin.example.com", "example.com"}
+	now := clk.Now()
+	yesterday := now.Add(-24 * time.Hour)
+
+	exists, err := sa.FQDNSetExists(ctx, names)
+	test.AssertNotError(t, err, "FQDNSetExists failed")
+	test.Assert(t, !exists, "Set exists before issuance")
+
+	reg := satest.CreateWorkingRegistration(t, sa)
+	_, err = sa.AddCertificate(ctx, certDER, reg.ID)
+	test.AssertNotError(t, err, "Couldn't add test-cert.der")
+
+	// The set matches in any order or case, but not as a subset
+	exists, err = sa.FQDNSetExists(ctx, names)
+	test.AssertNotError(t, err, "FQDNSetExists failed")
+	test.Assert(t, exists, "Issued set doesn't exist")
+	exists, err = sa.FQDNSetExists(ctx, names[1:])
+	test.AssertNotError(t, err, "FQDNSetExists failed")
+	test.Assert(t, !exists, "Subset of an issued set exists")
+
+	count, err := sa.CountFQDNSets(ctx, names, yesterday, now)
+	test.AssertNotError(t, err, "CountFQDNSets failed")
+	test.AssertEquals(t, count, int64(1))
+	count, err = sa.CountFQDNSets(ctx, names, yesterday.Add(-24*time.Hour), yesterday)
+	test.AssertNotError(t, err, "CountFQDNSets failed")
+	test.AssertEquals(t, count, int64(0))
+}
+
 func TestDeniedCSR(t *testing.T) {
 	key, _ := rsa.GenerateKey(rand.Reader, 512)
 	template := &x509.CertificateRequest{
@@ -440,9 +802,296 @@ func TestDeniedCSR(t *testing.T) {
 	sa, _, cleanUp := initSA(t)
 	defer cleanUp()
 
-	exists, err := sa.AlreadyDeniedCSR(append(csr.DNSNames, csr.Subject.CommonName))
+	exists, err := sa.AlreadyDeniedCSR(ctx, append(csr.DNSNames, csr.Subject.CommonName))
 	test.AssertNotError(t, err, "AlreadyDeniedCSR failed")
 	test.Assert(t, !exists, "Found non-existent CSR")
+
+	err = sa.AddDeniedCSR(ctx, []string{"ReallyBad.com", "badguys.com", "google.com"})
+	test.AssertNotError(t, err, "AddDeniedCSR failed")
+	exists, err = sa.AlreadyDeniedCSR(ctx, append(csr.DNSNames, csr.Subject.CommonName))
+	test.AssertNotError(t, err, "AlreadyDeniedCSR failed")
+	test.Assert(t, exists, "Didn't find denied CSR")
+}
+
+func TestValidationTranscripts(t *testing.T) {
+	sa, _, cleanUp := initSA(t)
+	defer cleanUp()
+
+	transcripts, err := sa.GetValidationTranscripts(ctx, "authz")
+	test.AssertNotError(t, err, "GetValidationTranscripts failed")
+	test.AssertEquals(t, len(transcripts), 0)
+
+	err = sa.AddValidationTranscript(ctx, "authz", core.ChallengeTypeHTTP01, []byte("first"))
+	test.AssertNotError(t, err, "AddValidationTranscript failed")
+	err = sa.AddValidationTranscript(ctx, "authz", core.ChallengeTypeDNS01, []byte("second"))
+	test.AssertNotError(t, err, "AddValidationTranscript failed")
+	err = sa.AddValidationTranscript(ctx, "other", core.ChallengeTypeHTTP01, []byte("other"))
+	test.AssertNotError(t, err, "AddValidationTranscript failed")
+
+	transcripts, err = sa.GetValidationTranscripts(ctx, "authz")
+	test.AssertNotError(t, err, "GetValidationTranscripts failed")
+	test.AssertEquals(t, len(transcripts), 2)
+	test.AssertEquals(t, string(transcripts[0]), "first")
+	test.AssertEquals(t, string(transcripts[1]), "second")
+}
+
+func TestReplacementOrders(t *testing.T) {
+	sa, _, cleanUp := initSA(t)
+	defer cleanUp()
+
+	replaced := "0000000000000000000000000000000000ee"
+	issued, err := sa.ReplacementIssued(ctx, replaced)
+	test.AssertNotError(t, err, "ReplacementIssued failed")
+	test.Assert(t, !issued, "Found replacement that wasn't issued")
+
+	err = sa.AddReplacementOrder(ctx, "0000000000000000000000000000000000ef", replaced)
+	test.AssertNotError(t, err, "AddReplacementOrder failed")
+	issued, err = sa.ReplacementIssued(ctx, replaced)
+	test.AssertNotError(t, err, "ReplacementIssued failed")
+	test.Assert(t, issued, "Didn't find issued replacement")
+
+	// Each certificate replaces at most one other
+	err = sa.AddReplacementOrder(ctx, "0000000000000000000000000000000000ef", "0000000000000000000000000000000000ed")
+	test.AssertError(t, err, "Recorded a certificate as replacing two others")
+
+	// and each is replaced at most once, though recording the same
+	// replacement again is harmless
+	err = sa.AddReplacementOrder(ctx, "0000000000000000000000000000000000f0", replaced)
+	test.Assert(t, berrors.Is(err, berrors.Malformed), "Recorded a certificate as replaced twice")
+	err = sa.AddReplacementOrder(ctx, "0000000000000000000000000000000000ef", replaced)
+	test.AssertNotError(t, err, "Recording the same replacement again failed")
+}
+
+// orderRequest returns a certificate request for example.com.
+func orderRequest(t *testing.T) core.CertificateRequest {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	csrBytes, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{"example.com"}}, key)
+	test.AssertNotError(t, err, "Failed to create CSR")
+	csr, _ := x509.ParseCertificateRequest(csrBytes)
+	return core.CertificateRequest{CSR: csr, Bytes: csrBytes, Profile: "short"}
+}
+
+func TestCertificateOrders(t *testing.T) {
+	sa, fc, cleanUp := initSA(t)
+	defer cleanUp()
+	req := orderRequest(t)
+
+	_, err := sa.NewCertificateOrder(ctx, core.CertificateOrder{RegistrationID: 1, Status: core.StatusValid}, req)
+	test.AssertError(t, err, "Created a certificate order that isn't processing")
+	_, err = sa.NewCertificateOrder(ctx, core.CertificateOrder{RegistrationID: 1, Status: core.StatusProcessing, Created: fc.Now()}, req)
+	test.AssertError(t, err, "Created a certificate order that's already expired")
+
+	issued, err := sa.NewCertificateOrder(ctx, core.CertificateOrder{RegistrationID: 1, Status: core.StatusProcessing, Created: fc.Now(), Expires: fc.Now().Add(24 * time.Hour)}, req)
+	test.AssertNotError(t, err, "NewCertificateOrder failed")
+	test.Assert(t, issued.ID != "", "No certificate order ID assigned")
+	failed, err := sa.NewCertificateOrder(ctx, core.CertificateOrder{RegistrationID: 1, Status: core.StatusProcessing, Created: fc.Now(), Expires: fc.Now().Add(24 * time.Hour)}, req)
+	test.AssertNotError(t, err, "NewCertificateOrder failed")
+
+	order, err := sa.GetCertificateOrder(ctx, issued.ID)
+	test.AssertNotError(t, err, "GetCertificateOrder failed")
+	test.AssertEquals(t, order.Status, core.StatusProcessing)
+	test.AssertEquals(t, order.RegistrationID, int64(1))
+	test.AssertEquals(t, order.Expires, fc.Now().Add(24*time.Hour))
+
+	issued.Status = core.StatusValid
+	issued.Serial = "0000000000000000000000000000000000ee"
+	test.AssertNotError(t, sa.FinalizeCertificateOrder(ctx, issued), "FinalizeCertificateOrder failed")
+	order, err = sa.GetCertificateOrder(ctx, issued.ID)
+	test.AssertNotError(t, err, "GetCertificateOrder failed")
+	test.AssertEquals(t, order.Status, core.StatusValid)
+	test.AssertEquals(t, order.Serial, issued.Serial)
+
+	failed.Status = core.StatusInvalid
+	failed.Error = probs.ServerInternal("Error creating new cert")
+	test.AssertNotError(t, sa.FinalizeCertificateOrder(ctx, failed), "FinalizeCertificateOrder failed")
+	order, err = sa.GetCertificateOrder(ctx, failed.ID)
+	test.AssertNotError(t, err, "GetCertificateOrder failed")
+	test.AssertEquals(t, order.Status, core.StatusInvalid)
+	test.AssertEquals(t, order.Error.Detail, "Error creating new cert")
+
+	// Orders are finalized once
+	err = sa.FinalizeCertificateOrder(ctx, failed)
+	test.AssertError(t, err, "Finalized a certificate order twice")
+
+	_, err = sa.GetCertificateOrder(ctx, "nope")
+	test.AssertError(t, err, "Found a certificate order that doesn't exist")
+	test.Assert(t, berrors.Is(err, berrors.NotFound), "Missing certificate order not a NotFound error")
+}
+
+func TestClaimCertificateOrders(t *testing.T) {
+	sa, fc, cleanUp := initSA(t)
+	defer cleanUp()
+	req := orderRequest(t)
+
+	stale, err := sa.NewCertificateOrder(ctx, core.CertificateOrder{RegistrationID: 1, Status: core.StatusProcessing, Created: fc.Now(), Expires: fc.Now().Add(24 * time.Hour)}, req)
+	test.AssertNotError(t, err, "NewCertificateOrder failed")
+	finalized, err := sa.NewCertificateOrder(ctx, core.CertificateOrder{RegistrationID: 1, Status: core.StatusProcessing, Created: fc.Now(), Expires: fc.Now().Add(24 * time.Hour)}, req)
+	test.AssertNotError(t, err, "NewCertificateOrder failed")
+	finalized.Status = core.StatusInvalid
+	test.AssertNotError(t, sa.FinalizeCertificateOrder(ctx, finalized), "FinalizeCertificateOrder failed")
+	fc.Add(time.Hour)
+	recent, err := sa.NewCertificateOrder(ctx, core.CertificateOrder{RegistrationID: 1, Status: core.StatusProcessing, Created: fc.Now(), Expires: fc.Now().Add(24 * time.Hour)}, req)
+	test.AssertNotError(t, err, "NewCertificateOrder failed")
+
+	// Only processing orders last attempted before staleBefore are
+	// claimed, with their requests
+	claimed, err := sa.ClaimCertificateOrders(ctx, fc.Now().Add(-time.Minute), fc.Now(), 10)
+	test.AssertNotError(t, err, "ClaimCertificateOrders failed")
+	test.AssertEquals(t, len(claimed), 1)
+	test.AssertEquals(t, claimed[0].Order.ID, stale.ID)
+	test.AssertEquals(t, claimed[0].Attempts, 2)
+	test.AssertByteEquals(t, claimed[0].Request.Bytes, req.Bytes)
+	test.AssertEquals(t, claimed[0].Request.Profile, "short")
+
+	// Claimed orders aren't stale again until staleBefore passes their
+	// claim
+	claimed, err = sa.ClaimCertificateOrders(ctx, fc.Now().Add(-time.Minute), fc.Now(), 10)
+	test.AssertNotError(t, err, "ClaimCertificateOrders failed")
+	test.AssertEquals(t, len(claimed), 0)
+
+	// Finalizing deletes the request
+	recent.Status = core.StatusInvalid
+	test.AssertNotError(t, sa.FinalizeCertificateOrder(ctx, recent), "FinalizeCertificateOrder failed")
+	count, err := sa.dbMap.SelectInt("SELECT count(*) FROM certificateOrderRequests WHERE orderID = ?", recent.ID)
+	test.AssertNotError(t, err, "Failed to count order requests")
+	test.AssertEquals(t, count, int64(0))
+
+	// Once stale again, claimed orders are claimed again
+	fc.Add(time.Hour)
+	claimed, err = sa.ClaimCertificateOrders(ctx, fc.Now().Add(-time.Minute), fc.Now(), 1)
+	test.AssertNotError(t, err, "ClaimCertificateOrders failed")
+	test.AssertEquals(t, len(claimed), 1)
+	test.AssertEquals(t, claimed[0].Order.ID, stale.ID)
+	test.AssertEquals(t, claimed[0].Attempts, 3)
+}
+
+func TestCAAChecks(t *testing.T) {
+	sa, fc, cleanUp := initSA(t)
+	defer cleanUp()
+
+	checks, err := sa.GetCAAChecks(ctx, []string{"example.com"})
+	test.AssertNotError(t, err, "GetCAAChecks failed")
+	test.AssertEquals(t, len(checks), 0)
+
+	first := fc.Now()
+	err = sa.AddCAAChecks(ctx, []string{"example.com", "www.example.com"}, first)
+	test.AssertNotError(t, err, "AddCAAChecks failed")
+
+	// A later check replaces an earlier one, but not the other way around
+	later := first.Add(time.Hour)
+	err = sa.AddCAAChecks(ctx, []string{"example.com"}, later)
+	test.AssertNotError(t, err, "AddCAAChecks failed")
+	err = sa.AddCAAChecks(ctx, []string{"www.example.com"}, first.Add(-time.Hour))
+	test.AssertNotError(t, err, "AddCAAChecks failed")
+
+	checks, err = sa.GetCAAChecks(ctx, []string{"example.com", "www.example.com", "other.example.com"})
+	test.AssertNotError(t, err, "GetCAAChecks failed")
+	test.AssertEquals(t, len(checks), 2)
+	test.Assert(t, checks["example.com"].Equal(later), "Later check wasn't recorded")
+	test.Assert(t, checks["www.example.com"].Equal(first), "Earlier check replaced a later one")
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	sa, fc, cleanUp := initSA(t)
+	defer cleanUp()
+
+	first := core.IdempotencyKey{RegistrationID: 1, Digest: "digest", RequestID: "first", Created: fc.Now(), Expires: fc.Now().Add(24 * time.Hour)}
+	stored, err := sa.ReserveIdempotencyKey(ctx, first, fc.Now().Add(-time.Minute))
+	test.AssertNotError(t, err, "ReserveIdempotencyKey failed")
+	test.AssertEquals(t, stored.RequestID, "first")
+
+	// Another request can't take over the reservation until it's stale
+	fc.Add(30 * time.Second)
+	second := core.IdempotencyKey{RegistrationID: 1, Digest: "digest", RequestID: "second", Created: fc.Now(), Expires: fc.Now().Add(24 * time.Hour)}
+	stored, err = sa.ReserveIdempotencyKey(ctx, second, fc.Now().Add(-time.Minute))
+	test.AssertNotError(t, err, "ReserveIdempotencyKey failed")
+	test.AssertEquals(t, stored.RequestID, "first")
+	fc.Add(time.Minute)
+	second.Created, second.Expires = fc.Now(), fc.Now().Add(24*time.Hour)
+	stored, err = sa.ReserveIdempotencyKey(ctx, second, fc.Now().Add(-time.Minute))
+	test.AssertNotError(t, err, "ReserveIdempotencyKey failed")
+	test.AssertEquals(t, stored.RequestID, "second")
+
+	// Only the request holding the reservation can finalize it
+	first.Serial = "0000000000000000000000000000000000ee"
+	err = sa.FinalizeIdempotencyKey(ctx, first)
+	test.AssertError(t, err, "Finalized another request's reservation")
+	second.Serial = "0000000000000000000000000000000000ef"
+	test.AssertNotError(t, sa.FinalizeIdempotencyKey(ctx, second), "FinalizeIdempotencyKey failed")
+
+	// Issued keys are returned from then on
+	fc.Add(time.Hour)
+	third := core.IdempotencyKey{RegistrationID: 1, Digest: "digest", RequestID: "third", Created: fc.Now(), Expires: fc.Now().Add(24 * time.Hour)}
+	stored, err = sa.ReserveIdempotencyKey(ctx, third, fc.Now().Add(-time.Minute))
+	test.AssertNotError(t, err, "ReserveIdempotencyKey failed")
+	test.AssertEquals(t, stored.Serial, second.Serial)
+
+	// Finalizing without a serial releases the reservation
+	other := core.IdempotencyKey{RegistrationID: 2, Digest: "digest", RequestID: "other", Created: fc.Now(), Expires: fc.Now().Add(24 * time.Hour)}
+	_, err = sa.ReserveIdempotencyKey(ctx, other, fc.Now().Add(-time.Minute))
+	test.AssertNotError(t, err, "ReserveIdempotencyKey failed")
+	test.AssertNotError(t, sa.FinalizeIdempotencyKey(ctx, other), "FinalizeIdempotencyKey failed")
+	retry := core.IdempotencyKey{RegistrationID: 2, Digest: "digest", RequestID: "retry", Created: fc.Now(), Expires: fc.Now().Add(24 * time.Hour)}
+	stored, err = sa.ReserveIdempotencyKey(ctx, retry, fc.Now().Add(-time.Minute))
+	test.AssertNotError(t, err, "ReserveIdempotencyKey failed")
+	test.AssertEquals(t, stored.RequestID, "retry")
+
+	// Keys can't be reserved already expired
+	expired := core.IdempotencyKey{RegistrationID: 3, Digest: "digest", RequestID: "expired", Created: fc.Now(), Expires: fc.Now()}
+	_, err = sa.ReserveIdempotencyKey(ctx, expired, fc.Now().Add(-time.Minute))
+	test.AssertError(t, err, "Reserved an expired idempotency key")
+
+	// Once expired, an issued key is taken over by a new request, until
+	// it's deleted
+	fc.Add(24 * time.Hour)
+	fourth := core.IdempotencyKey{RegistrationID: 1, Digest: "digest", RequestID: "fourth", Created: fc.Now(), Expires: fc.Now().Add(24 * time.Hour)}
+	stored, err = sa.ReserveIdempotencyKey(ctx, fourth, fc.Now().Add(-time.Minute))
+	test.AssertNotError(t, err, "ReserveIdempotencyKey failed")
+	test.AssertEquals(t, stored.RequestID, "fourth")
+	test.AssertEquals(t, stored.Serial, "")
+	deleted, err := sa.DeleteExpiredIdempotencyKeys(fc.Now(), 10)
+	test.AssertNotError(t, err, "DeleteExpiredIdempotencyKeys failed")
+	test.AssertEquals(t, deleted, int64(1))
+	deleted, err = sa.DeleteExpiredIdempotencyKeys(fc.Now().Add(24*time.Hour), 10)
+	test.AssertNotError(t, err, "DeleteExpiredIdempotencyKeys failed")
+	test.AssertEquals(t, deleted, int64(1))
+}
+
+func TestKeyHashes(t *testing.T) {
+	sa, fc, cleanUp := initSA(t)
+	defer cleanUp()
+
+	reg := satest.CreateWorkingRegistration(t, sa)
+	certDER, err := ioutil.ReadFile("test-cert.der")
+	test.AssertNotError(t, err, "Couldn't read example cert DER")
+	_, err = sa.AddCertificate(ctx, certDER, reg.ID)
+	test.AssertNotError(t, err, "Couldn't add test-cert.der")
+	cert, err := x509.ParseCertificate(certDER)
+	test.AssertNotError(t, err, "Couldn't parse test-cert.der")
+	keyHash, err := core.KeyDigest(cert.PublicKey)
+	test.AssertNotError(t, err, "Couldn't digest key")
+
+	serials, err := sa.GetSerialsByKeyHash(ctx, keyHash)
+	test.AssertNotError(t, err, "GetSerialsByKeyHash failed")
+	test.AssertEquals(t, len(serials), 1)
+	test.AssertEquals(t, serials[0], "ffdd9b8a82126d96f61d378d5ba99a0474f0")
+
+	// Expired certificates aren't found
+	fc.Set(cert.NotAfter)
+	serials, err = sa.GetSerialsByKeyHash(ctx, keyHash)
+	test.AssertNotError(t, err, "GetSerialsByKeyHash failed")
+	test.AssertEquals(t, len(serials), 0)
+
+	blocked, err := sa.KeyBlocked(ctx, keyHash)
+	test.AssertNotError(t, err, "KeyBlocked failed")
+	test.Assert(t, !blocked, "Key blocked before it was added")
+	err = sa.AddBlockedKey(ctx, keyHash, "root")
+	test.AssertNotError(t, err, "AddBlockedKey failed")
+	err = sa.AddBlockedKey(ctx, keyHash, "admin")
+	test.AssertNotError(t, err, "Blocking a key twice failed")
+	blocked, err = sa.KeyBlocked(ctx, keyHash)
+	test.AssertNotError(t, err, "KeyBlocked failed")
+	test.Assert(t, blocked, "Key not blocked")
 }
 
 const (
@@ -453,48 +1102,73 @@ const (
 	sctCertSerial = "ff000000000000012607e11a78ac01f9"
 )
 
-func TestAddSCTReceipt(t *testing.T) {
+func TestRecordCTSubmission(t *testing.T) {
 	sigBytes, err := base64.StdEncoding.DecodeString(sctSignature)
 	test.AssertNotError(t, err, "Failed to decode SCT signature")
-	sct := core.SignedCertificateTimestamp{
-		SCTVersion:        sctVersion,
-		LogID:             sctLogID,
-		Timestamp:         sctTimestamp,
-		Signature:         sigBytes,
-		CertificateSerial: sctCertSerial,
-	}
-	sa, _, cleanup := initSA(t)
+	sa, fc, cleanup := initSA(t)
 	defer cleanup()
-	err = sa.AddSCTReceipt(sct)
-	test.AssertNotError(t, err, "Failed to add SCT receipt")
-	// Append only and unique on signature and across LogID and CertificateSerial
-	err = sa.AddSCTReceipt(sct)
-	test.AssertError(t, err, "Incorrectly added duplicate SCT receipt")
-	fmt.Println(err)
-}
 
-func TestGetSCTReceipt(t *testing.T) {
-	sigBytes, err := base64.StdEncoding.DecodeString(sctSignature)
-	test.AssertNotError(t, err, "Failed to decode SCT signature")
-	sct := core.SignedCertificateTimestamp{
-		SCTVersion:        sctVersion,
+	// Failed attempts are counted, and don't make an SCT
+	failed := core.CTSubmission{
+		CertificateSerial: sctCertSerial,
+		LogID:             sctLogID,
+		Status:            core.CTSubmissionPending,
+		LastError:         "log unavailable",
+	}
+	err = sa.RecordCTSubmission(ctx, failed)
+	test.AssertNotError(t, err, "Failed to record CT submission")
+	err = sa.RecordCTSubmission(ctx, failed)
+	test.AssertNotError(t, err, "Failed to record CT submission")
+	_, err = sa.GetSCTReceipt(ctx, sctCertSerial, sctLogID)
+	test.AssertError(t, err, "Got an SCT receipt of a failed submission")
+	submissions, err := sa.GetCTSubmissions(ctx, sctCertSerial)
+	test.AssertNotError(t, err, "Failed to get CT submissions")
+	test.AssertEquals(t, len(submissions), 1)
+	test.AssertEquals(t, submissions[0].Status, core.CTSubmissionPending)
+	test.AssertEquals(t, submissions[0].Attempts, 2)
+	test.AssertEquals(t, submissions[0].LastError, "log unavailable")
+
+	fc.Add(time.Hour)
+	sct := core.CTSubmission{
+		CertificateSerial: sctCertSerial,
 		LogID:             sctLogID,
+		Status:            core.CTSubmissionSubmitted,
+		SCTVersion:        sctVersion,
 		Timestamp:         sctTimestamp,
 		Signature:         sigBytes,
-		CertificateSerial: sctCertSerial,
 	}
-	sa, _, cleanup := initSA(t)
-	defer cleanup()
-	err = sa.AddSCTReceipt(sct)
-	test.AssertNotError(t, err, "Failed to add SCT receipt")
+	err = sa.RecordCTSubmission(ctx, sct)
+	test.AssertNotError(t, err, "Failed to record CT submission")
 
-	sqlSCT, err := sa.GetSCTReceipt(sctCertSerial, sctLogID)
+	sqlSCT, err := sa.GetSCTReceipt(ctx, sctCertSerial, sctLogID)
 	test.AssertNotError(t, err, "Failed to get existing SCT receipt")
 	test.Assert(t, sqlSCT.SCTVersion == sct.SCTVersion, "Invalid SCT version")
 	test.Assert(t, sqlSCT.LogID == sct.LogID, "Invalid log ID")
 	test.Assert(t, sqlSCT.Timestamp == sct.Timestamp, "Invalid timestamp")
 	test.Assert(t, bytes.Compare(sqlSCT.Signature, sct.Signature) == 0, "Invalid signature")
 	test.Assert(t, sqlSCT.CertificateSerial == sct.CertificateSerial, "Invalid certificate serial")
+
+	// Once there's an SCT, later attempts are ignored
+	err = sa.RecordCTSubmission(ctx, failed)
+	test.AssertNotError(t, err, "Failed to record CT submission")
+	submissions, err = sa.GetCTSubmissions(ctx, sctCertSerial)
+	test.AssertNotError(t, err, "Failed to get CT submissions")
+	test.AssertEquals(t, len(submissions), 1)
+	test.AssertEquals(t, submissions[0].Status, core.CTSubmissionSubmitted)
+	test.AssertEquals(t, submissions[0].Attempts, 3)
+	test.AssertEquals(t, submissions[0].LastError, "")
+	test.AssertEquals(t, submissions[0].InclusionStatus, core.CTInclusionUnverified)
+	test.AssertEquals(t, submissions[0].LastAttempt, fc.Now())
+
+	err = sa.RecordCTInclusion(ctx, sctCertSerial, sct.LogID, core.CTInclusionVerified)
+	test.AssertNotError(t, err, "Failed to record CT inclusion")
+	submissions, err = sa.GetCTSubmissions(ctx, sctCertSerial)
+	test.AssertNotError(t, err, "Failed to get CT submissions")
+	test.AssertEquals(t, submissions[0].InclusionStatus, core.CTInclusionVerified)
+
+	// Only logs that issued an SCT can include the certificate
+	err = sa.RecordCTInclusion(ctx, sctCertSerial, "other-log", core.CTInclusionVerified)
+	test.Assert(t, berrors.Is(err, berrors.NotFound), "Recorded inclusion without an SCT")
 }
 
 func TestUpdateOCSP(t *testing.T) {
@@ -505,7 +1179,7 @@ func TestUpdateOCSP(t *testing.T) {
 	// Add a cert to the DB to test with.
 	certDER, err := ioutil.ReadFile("www.eff.org.der")
 	test.AssertNotError(t, err, "Couldn't read example cert DER")
-	_, err = sa.AddCertificate(certDER, reg.ID)
+	_, err = sa.AddCertificate(ctx, certDER, reg.ID)
 	test.AssertNotError(t, err, "Couldn't add www.eff.org.der")
 
 	serial := "000000000000000000000000000000021bd4"
@@ -519,7 +1193,7 @@ func TestUpdateOCSP(t *testing.T) {
 
 	fc.Add(1 * time.Hour)
 
-	err = sa.UpdateOCSP(serial, []byte(ocspResponse))
+	err = sa.UpdateOCSP(ctx, serial, []byte(ocspResponse))
 	test.AssertNotError(t, err, "UpdateOCSP failed")
 
 	certificateStatusObj, err = sa.dbMap.Get(core.CertificateStatus{}, serial)
@@ -539,7 +1213,7 @@ func TestMarkCertificateRevoked(t *testing.T) {
 	// Add a cert to the DB to test with.
 	certDER, err := ioutil.ReadFile("www.eff.org.der")
 	test.AssertNotError(t, err, "Couldn't read example cert DER")
-	_, err = sa.AddCertificate(certDER, reg.ID)
+	_, err = sa.AddCertificate(ctx, certDER, reg.ID)
 	test.AssertNotError(t, err, "Couldn't add www.eff.org.der")
 
 	serial := "000000000000000000000000000000021bd4"
@@ -552,7 +1226,7 @@ func TestMarkCertificateRevoked(t *testing.T) {
 	fc.Add(1 * time.Hour)
 
 	code := core.RevocationCode(1)
-	err = sa.MarkCertificateRevoked(serial, code)
+	err = sa.MarkCertificateRevoked(ctx, serial, code)
 	test.AssertNotError(t, err, "MarkCertificateRevoked failed")
 
 	certificateStatusObj, err = sa.dbMap.Get(core.CertificateStatus{}, serial)
@@ -567,12 +1241,50 @@ func TestMarkCertificateRevoked(t *testing.T) {
 	}
 }
 
+func TestReleaseCertificateHold(t *testing.T) {
+	sa, _, cleanUp := initSA(t)
+	defer cleanUp()
+
+	reg := satest.CreateWorkingRegistration(t, sa)
+	certDER, err := ioutil.ReadFile("www.eff.org.der")
+	test.AssertNotError(t, err, "Couldn't read example cert DER")
+	_, err = sa.AddCertificate(ctx, certDER, reg.ID)
+	test.AssertNotError(t, err, "Couldn't add www.eff.org.der")
+	serial := "000000000000000000000000000000021bd4"
+
+	// Only held certificates can be released
+	err = sa.ReleaseCertificateHold(ctx, serial)
+	test.AssertError(t, err, "Released a good certificate")
+
+	err = sa.MarkCertificateRevoked(ctx, serial, core.RevocationCertificateHold)
+	test.AssertNotError(t, err, "MarkCertificateRevoked failed")
+	err = sa.UpdateOCSP(ctx, serial, []byte("revoked response"))
+	test.AssertNotError(t, err, "UpdateOCSP failed")
+
+	err = sa.ReleaseCertificateHold(ctx, serial)
+	test.AssertNotError(t, err, "ReleaseCertificateHold failed")
+	status, err := sa.GetCertificateStatus(ctx, serial)
+	test.AssertNotError(t, err, "Failed to fetch certificate status")
+	test.AssertEquals(t, status.Status, core.OCSPStatusGood)
+	test.AssertEquals(t, status.RevokedReason, core.RevocationCode(0))
+	test.Assert(t, status.RevokedDate.IsZero(), "Revocation date not cleared")
+	test.Assert(t, status.OCSPLastUpdated.IsZero(), "OCSP response not marked stale")
+
+	// A permanently revoked certificate can't be put on hold, or released
+	err = sa.MarkCertificateRevoked(ctx, serial, core.RevocationCode(1))
+	test.AssertNotError(t, err, "MarkCertificateRevoked failed")
+	err = sa.MarkCertificateRevoked(ctx, serial, core.RevocationCertificateHold)
+	test.AssertError(t, err, "Put a revoked certificate on hold")
+	err = sa.ReleaseCertificateHold(ctx, serial)
+	test.AssertError(t, err, "Released a revoked certificate")
+}
+
 func TestCountCertificates(t *testing.T) {
 	sa, fc, cleanUp := initSA(t)
 	defer cleanUp()
 	fc.Add(time.Hour * 24)
 	now := fc.Now()
-	count, err := sa.CountCertificatesRange(now.Add(-24*time.Hour), now)
+	count, err := sa.CountCertificatesRange(ctx, now.Add(-24*time.Hour), now)
 	test.AssertNotError(t, err, "Couldn't get certificate count for the last 24hrs")
 	test.AssertEquals(t, count, int64(0))
 
@@ -580,18 +1292,18 @@ func TestCountCertificates(t *testing.T) {
 	// Add a cert to the DB to test with.
 	certDER, err := ioutil.ReadFile("www.eff.org.der")
 	test.AssertNotError(t, err, "Couldn't read example cert DER")
-	_, err = sa.AddCertificate(certDER, reg.ID)
+	_, err = sa.AddCertificate(ctx, certDER, reg.ID)
 	test.AssertNotError(t, err, "Couldn't add www.eff.org.der")
 
 	fc.Add(2 * time.Hour)
 	now = fc.Now()
-	count, err = sa.CountCertificatesRange(now.Add(-24*time.Hour), now)
+	count, err = sa.CountCertificatesRange(ctx, now.Add(-24*time.Hour), now)
 	test.AssertNotError(t, err, "Couldn't get certificate count for the last 24hrs")
 	test.AssertEquals(t, count, int64(1))
 
 	fc.Add(24 * time.Hour)
 	now = fc.Now()
-	count, err = sa.CountCertificatesRange(now.Add(-24*time.Hour), now)
+	count, err = sa.CountCertificatesRange(ctx, now.Add(-24*time.Hour), now)
 	test.AssertNotError(t, err, "Couldn't get certificate count for the last 24hrs")
 	test.AssertEquals(t, count, int64(0))
 }
@@ -605,20 +1317,20 @@ func TestCountRegistrationsByIP(t *testing.T) {
 		Opaque: "foo@example.com",
 	})
 
-	_, err := sa.NewRegistration(core.Registration{
-		Key:       jose.JsonWebKey{Key: &rsa.PublicKey{N: big.NewInt(1), E: 1}},
+	_, err := sa.NewRegistration(ctx, core.Registration{
+		Key:       jose.JSONWebKey{Key: &rsa.PublicKey{N: big.NewInt(1), E: 1}},
 		Contact:   []*core.AcmeURL{&contact},
 		InitialIP: net.ParseIP("43.34.43.34"),
 	})
 	test.AssertNotError(t, err, "Couldn't insert registration")
-	_, err = sa.NewRegistration(core.Registration{
-		Key:       jose.JsonWebKey{Key: &rsa.PublicKey{N: big.NewInt(2), E: 1}},
+	_, err = sa.NewRegistration(ctx, core.Registration{
+		Key:       jose.JSONWebKey{Key: &rsa.PublicKey{N: big.NewInt(2), E: 1}},
 		Contact:   []*core.AcmeURL{&contact},
 		InitialIP: net.ParseIP("2001:cdba:1234:5678:9101:1121:3257:9652"),
 	})
 	test.AssertNotError(t, err, "Couldn't insert registration")
-	_, err = sa.NewRegistration(core.Registration{
-		Key:       jose.JsonWebKey{Key: &rsa.PublicKey{N: big.NewInt(3), E: 1}},
+	_, err = sa.NewRegistration(ctx, core.Registration{
+		Key:       jose.JSONWebKey{Key: &rsa.PublicKey{N: big.NewInt(3), E: 1}},
 		Contact:   []*core.AcmeURL{&contact},
 		InitialIP: net.ParseIP("2001:cdba:1234:5678:9101:1121:3257:9653"),
 	})
@@ -627,16 +1339,16 @@ func TestCountRegistrationsByIP(t *testing.T) {
 	earliest := fc.Now().Add(-time.Hour * 24)
 	latest := fc.Now()
 
-	count, err := sa.CountRegistrationsByIP(net.ParseIP("1.1.1.1"), earliest, latest)
+	count, err := sa.CountRegistrationsByIP(ctx, net.ParseIP("1.1.1.1"), earliest, latest)
 	test.AssertNotError(t, err, "Failed to count registrations")
 	test.AssertEquals(t, count, 0)
-	count, err = sa.CountRegistrationsByIP(net.ParseIP("43.34.43.34"), earliest, latest)
+	count, err = sa.CountRegistrationsByIP(ctx, net.ParseIP("43.34.43.34"), earliest, latest)
 	test.AssertNotError(t, err, "Failed to count registrations")
 	test.AssertEquals(t, count, 1)
-	count, err = sa.CountRegistrationsByIP(net.ParseIP("2001:cdba:1234:5678:9101:1121:3257:9652"), earliest, latest)
+	count, err = sa.CountRegistrationsByIP(ctx, net.ParseIP("2001:cdba:1234:5678:9101:1121:3257:9652"), earliest, latest)
 	test.AssertNotError(t, err, "Failed to count registrations")
 	test.AssertEquals(t, count, 2)
-	count, err = sa.CountRegistrationsByIP(net.ParseIP("2001:cdba:1234:0000:0000:0000:0000:0000"), earliest, latest)
+	count, err = sa.CountRegistrationsByIP(ctx, net.ParseIP("2001:cdba:1234:0000:0000:0000:0000:0000"), earliest, latest)
 	test.AssertNotError(t, err, "Failed to count registrations")
 	test.AssertEquals(t, count, 2)
 }
@@ -0,0 +1,120 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package sa
+
+import (
+	"context"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+// The streaming methods below read a result set in batches, passing each
+// batch to a callback before reading the next, so that memory use stays
+// bounded however many rows match. Each batch carries on from the last row
+// of the previous one (keyset pagination), so the cost of a batch doesn't
+// grow with how far into the results it is, and rows the callback updates
+// are neither skipped nor repeated. Streaming stops at the first error the
+// callback returns, which is passed back to the caller.
+//
+// Streams can't be carried over RPC, so these methods aren't part of
+// core.StorageAuthority; they're for tools that connect to the database
+// directly, like the expiration mailer.
+
+// StreamExpiringCertificates calls fn with the unrevoked certificates that
+// expire after earliest and no later than latest, that weren't sent an
+// expiration nag within nagCutoff of expiring, and that haven't had a
+// replacement issued, in order of expiry and at most batchSize at a time.
+func (ssa *SQLStorageAuthority) StreamExpiringCertificates(ctx context.Context, earliest, latest time.Time, nagCutoff time.Duration, batchSize int, fn func([]core.Certificate) error) error {
+	afterExpires, afterSerial := earliest, ""
+	for {
+		var certs []core.Certificate
+		_, err := ssa.dbMap.Select(
+			&certs,
+			`SELECT cert.* FROM certificates AS cert
+			 JOIN certificateStatus AS cs
+			 ON cs.serial = cert.serial
+			 AND cert.expires > :earliest
+			 AND cert.expires <= :latest
+			 AND (cert.expires > :afterExpires OR (cert.expires = :afterExpires AND cert.serial > :afterSerial))
+			 AND cs.status != "revoked"
+			 AND COALESCE(TIMESTAMPDIFF(SECOND, cs.lastExpirationNagSent, cert.expires) > :nagCutoff, 1)
+			 AND NOT EXISTS (SELECT 1 FROM replacementOrders AS ro WHERE ro.replacedSerial = cert.serial)
+			 ORDER BY cert.expires ASC, cert.serial ASC
+			 LIMIT :limit`,
+			map[string]interface{}{
+				"earliest":     earliest,
+				"latest":       latest,
+				"afterExpires": afterExpires,
+				"afterSerial":  afterSerial,
+				"nagCutoff":    nagCutoff.Seconds(),
+				"limit":        batchSize,
+			},
+		)
+		if err != nil {
+			return err
+		}
+		if len(certs) == 0 {
+			return nil
+		}
+		if err = fn(certs); err != nil {
+			return err
+		}
+		if len(certs) < batchSize {
+			return nil
+		}
+		last := certs[len(certs)-1]
+		afterExpires, afterSerial = last.Expires, last.Serial
+	}
+}
+
+// StreamRevokedCertificates calls fn with the statuses of the revoked
+// certificates signed by the issuer with the hex subject key ID
+// issuerKeyID, in order of serial and at most batchSize at a time, e.g. to
+// build that issuer's CRL. Issuers are those recorded in the
+// certificateIssuers table, so certificates added before it existed, or
+// without an authority key ID, aren't listed for any issuer. Certificates
+// on hold are listed with the certificateHold reason until they're
+// released, after which they're no longer revoked and drop off the list.
+func (ssa *SQLStorageAuthority) StreamRevokedCertificates(ctx context.Context, issuerKeyID string, batchSize int, fn func([]core.CertificateStatus) error) error {
+	if err := ssa.requireCapability(CapabilityCertificateIssuers); err != nil {
+		return err
+	}
+	afterSerial := ""
+	for {
+		var statuses []core.CertificateStatus
+		_, err := ssa.dbMap.Select(
+			&statuses,
+			`SELECT cs.serial, cs.status, cs.revokedDate, cs.revokedReason FROM certificateStatus AS cs
+			 JOIN certificateIssuers AS ci
+			 ON ci.serial = cs.serial
+			 WHERE ci.issuerKeyID = :issuerKeyID
+			 AND cs.status = :status
+			 AND cs.serial > :afterSerial
+			 ORDER BY cs.serial ASC
+			 LIMIT :limit`,
+			map[string]interface{}{
+				"issuerKeyID": issuerKeyID,
+				"status":      string(core.OCSPStatusRevoked),
+				"afterSerial": afterSerial,
+				"limit":       batchSize,
+			},
+		)
+		if err != nil {
+			return err
+		}
+		if len(statuses) == 0 {
+			return nil
+		}
+		if err = fn(statuses); err != nil {
+			return err
+		}
+		if len(statuses) < batchSize {
+			return nil
+		}
+		afterSerial = statuses[len(statuses)-1].Serial
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package sa
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/sa/satest"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestStreamCertificates(t *testing.T) {
+	sa, _, cleanUp := initSA(t)
+	defer cleanUp()
+
+	reg := satest.CreateWorkingRegistration(t, sa)
+	for _, name := range []string{"www.eff.org.der", "test-cert.der"} {
+		certDER, err := ioutil.ReadFile(name)
+		test.AssertNotError(t, err, "Couldn't read "+name)
+		_, err = sa.AddCertificate(ctx, certDER, reg.ID)
+		test.AssertNotError(t, err, "Couldn't add "+name)
+	}
+	earliest := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+	latest := time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// With a batch size of one, each certificate comes in its own batch, in
+	// order of expiry
+	var batches [][]core.Certificate
+	err := sa.StreamExpiringCertificates(ctx, earliest, latest, time.Hour, 1, func(certs []core.Certificate) error {
+		batches = append(batches, certs)
+		return nil
+	})
+	test.AssertNotError(t, err, "Couldn't stream expiring certificates")
+	test.AssertEquals(t, len(batches), 2)
+	test.AssertEquals(t, len(batches[0]), 1)
+	test.Assert(t, !batches[1][0].Expires.Before(batches[0][0].Expires), "Certificates out of expiry order")
+
+	// Errors from the callback stop the stream
+	stop := errors.New("stop")
+	calls := 0
+	err = sa.StreamExpiringCertificates(ctx, earliest, latest, time.Hour, 1, func(certs []core.Certificate) error {
+		calls++
+		return stop
+	})
+	test.AssertEquals(t, err, stop)
+	test.AssertEquals(t, calls, 1)
+
+	// Revoked certificates aren't expiring, but are streamed as revoked
+	revoked := batches[0][0].Serial
+	err = sa.MarkCertificateRevoked(ctx, revoked, core.RevocationCode(1))
+	test.AssertNotError(t, err, "MarkCertificateRevoked failed")
+
+	var expiring []core.Certificate
+	err = sa.StreamExpiringCertificates(ctx, earliest, latest, time.Hour, 10, func(certs []core.Certificate) error {
+		expiring = append(expiring, certs...)
+		return nil
+	})
+	test.AssertNotError(t, err, "Couldn't stream expiring certificates")
+	test.AssertEquals(t, len(expiring), 1)
+	test.AssertEquals(t, expiring[0].Serial, batches[1][0].Serial)
+
+	// Nor are certificates that have been replaced
+	err = sa.AddReplacementOrder(ctx, "ff00000000000000000000000000000001", expiring[0].Serial)
+	test.AssertNotError(t, err, "AddReplacementOrder failed")
+	expiring = nil
+	err = sa.StreamExpiringCertificates(ctx, earliest, latest, time.Hour, 10, func(certs []core.Certificate) error {
+		expiring = append(expiring, certs...)
+		return nil
+	})
+	test.AssertNotError(t, err, "Couldn't stream expiring certificates")
+	test.AssertEquals(t, len(expiring), 0)
+
+	issuerKeyID, err := sa.GetCertificateIssuer(ctx, revoked)
+	test.AssertNotError(t, err, "GetCertificateIssuer failed")
+	var statuses []core.CertificateStatus
+	err = sa.StreamRevokedCertificates(ctx, issuerKeyID, 1, func(batch []core.CertificateStatus) error {
+		statuses = append(statuses, batch...)
+		return nil
+	})
+	test.AssertNotError(t, err, "Couldn't stream revoked certificates")
+	test.AssertEquals(t, len(statuses), 1)
+	test.AssertEquals(t, statuses[0].Serial, revoked)
+	test.AssertEquals(t, statuses[0].RevokedReason, core.RevocationCode(1))
+
+	// Other issuers' revoked certificates aren't streamed
+	statuses = nil
+	err = sa.StreamRevokedCertificates(ctx, "00", 1, func(batch []core.CertificateStatus) error {
+		statuses = append(statuses, batch...)
+		return nil
+	})
+	test.AssertNotError(t, err, "Couldn't stream revoked certificates")
+	test.AssertEquals(t, len(statuses), 0)
+}
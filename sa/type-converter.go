@@ -10,10 +10,11 @@ import (
 	"errors"
 	"fmt"
 
-	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
 	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
 
 	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/identifier"
 )
 
 // BoulderTypeConverter is used by Gorp for storing objects in DB.
@@ -22,13 +23,13 @@ type BoulderTypeConverter struct{}
 // ToDb converts a Boulder object to one suitable for the DB representation.
 func (tc BoulderTypeConverter) ToDb(val interface{}) (interface{}, error) {
 	switch t := val.(type) {
-	case core.AcmeIdentifier, []core.Challenge, []*core.AcmeURL, [][]int:
+	case identifier.ACMEIdentifier, []core.Challenge, []*core.AcmeURL, [][]int:
 		jsonBytes, err := json.Marshal(t)
 		if err != nil {
 			return nil, err
 		}
 		return string(jsonBytes), nil
-	case jose.JsonWebKey:
+	case jose.JSONWebKey:
 		jsonBytes, err := t.MarshalJSON()
 		if err != nil {
 			return "", err
@@ -46,7 +47,7 @@ func (tc BoulderTypeConverter) ToDb(val interface{}) (interface{}, error) {
 // FromDb converts a DB representation back into a Boulder object.
 func (tc BoulderTypeConverter) FromDb(target interface{}) (gorp.CustomScanner, bool) {
 	switch target.(type) {
-	case *core.AcmeIdentifier, *[]core.Challenge, *[]*core.AcmeURL, *[][]int:
+	case *identifier.ACMEIdentifier, *[]core.Challenge, *[]*core.AcmeURL, *[][]int:
 		binder := func(holder, target interface{}) error {
 			s, ok := holder.(*string)
 			if !ok {
@@ -56,7 +57,7 @@ func (tc BoulderTypeConverter) FromDb(target interface{}) (gorp.CustomScanner, b
 			return json.Unmarshal(b, target)
 		}
 		return gorp.CustomScanner{Holder: new(string), Target: target, Binder: binder}, true
-	case *jose.JsonWebKey:
+	case *jose.JSONWebKey:
 		binder := func(holder, target interface{}) error {
 			s, ok := holder.(*string)
 			if !ok {
@@ -66,9 +67,9 @@ func (tc BoulderTypeConverter) FromDb(target interface{}) (gorp.CustomScanner, b
 				return errors.New("FromDb: Empty JWK field.")
 			}
 			b := []byte(*s)
-			k, ok := target.(*jose.JsonWebKey)
+			k, ok := target.(*jose.JSONWebKey)
 			if !ok {
-				return fmt.Errorf("FromDb: Unable to convert %T to *jose.JsonWebKey", target)
+				return fmt.Errorf("FromDb: Unable to convert %T to *jose.JSONWebKey", target)
 			}
 			return k.UnmarshalJSON(b)
 		}
@@ -10,9 +10,10 @@ import (
 	"testing"
 
 	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/identifier"
 	"github.com/letsencrypt/boulder/test"
 
-	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
 )
 
 const JWK1JSON = `{
@@ -24,8 +25,8 @@ const JWK1JSON = `{
 func TestAcmeIdentifier(t *testing.T) {
 	tc := BoulderTypeConverter{}
 
-	ai := core.AcmeIdentifier{Type: "data1", Value: "data2"}
-	out := core.AcmeIdentifier{}
+	ai := identifier.ACMEIdentifier{Type: "data1", Value: "data2"}
+	out := identifier.ACMEIdentifier{}
 
 	marshaledI, err := tc.ToDb(ai)
 	test.AssertNotError(t, err, "Could not ToDb")
@@ -45,7 +46,7 @@ func TestAcmeIdentifier(t *testing.T) {
 func TestJsonWebKey(t *testing.T) {
 	tc := BoulderTypeConverter{}
 
-	var jwk, out jose.JsonWebKey
+	var jwk, out jose.JSONWebKey
 	json.Unmarshal([]byte(JWK1JSON), &jwk)
 
 	marshaledI, err := tc.ToDb(jwk)
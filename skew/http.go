@@ -0,0 +1,64 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package skew
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Path is where Handler expects to be served:
+//
+//	GET    Path  shows the offset and the skewed time
+//	PUT    Path  sets the offset in the JSON body, e.g. {"offset": "720h"}
+//	DELETE Path  clears the offset
+const Path = "/debug/clock"
+
+type stateJSON struct {
+	Offset string    `json:"offset"`
+	Now    time.Time `json:"now,omitempty"`
+}
+
+// Handler returns the handler of the clock skew API.
+func Handler() http.Handler {
+	return http.HandlerFunc(serveHTTP)
+}
+
+func serveHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stateJSON{
+			Offset: Offset().String(),
+			Now:    time.Now().Add(Offset()),
+		})
+	case "PUT":
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var s stateJSON
+		if err = json.Unmarshal(body, &s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		d, err := time.ParseDuration(s.Offset)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		Set(d)
+		w.WriteHeader(http.StatusNoContent)
+	case "DELETE":
+		Set(0)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package skew shifts the clocks of Boulder's components while it is under
+// test, so that integration tests can check authorization expiry,
+// certificate validity boundaries, OCSP staleness and expiration mail
+// without waiting for the time to come.
+//
+// It does nothing until Enable is called, which only test configurations
+// do. The offset is then set and cleared through Handler, served on a
+// component's debug server, or given when the component starts.
+package skew
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+)
+
+var (
+	enabled int32
+	offset  int64
+)
+
+// Enable turns on clock skew for this process, starting at initial.
+func Enable(initial time.Duration) {
+	atomic.StoreInt64(&offset, int64(initial))
+	atomic.StoreInt32(&enabled, 1)
+}
+
+// Enabled returns whether clock skew is on.
+func Enabled() bool {
+	return atomic.LoadInt32(&enabled) == 1
+}
+
+// Offset returns how far the clocks returned by Clock are ahead of the
+// system clock, or behind it if negative.
+func Offset() time.Duration {
+	return time.Duration(atomic.LoadInt64(&offset))
+}
+
+// Set changes the offset of every clock returned by Clock.
+func Set(d time.Duration) {
+	atomic.StoreInt64(&offset, int64(d))
+}
+
+// skewedClock is the system clock, shifted by the offset at the time it is
+// read.
+type skewedClock struct {
+	clock.Clock
+}
+
+func (c skewedClock) Now() time.Time {
+	return c.Clock.Now().Add(Offset())
+}
+
+// Clock returns a clock that reads base shifted by the offset, including
+// any later change to it.
+func Clock(base clock.Clock) clock.Clock {
+	return skewedClock{base}
+}
@@ -0,0 +1,67 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package skew
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+func request(method, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, "http://localhost"+Path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, req)
+	return w
+}
+
+func TestClock(t *testing.T) {
+	Enable(time.Hour)
+	defer Set(0)
+	test.Assert(t, Enabled(), "Not enabled")
+
+	base := clock.NewFake()
+	clk := Clock(base)
+	test.Assert(t, clk.Now().Equal(base.Now().Add(time.Hour)), "Clock not skewed")
+
+	// Clocks follow changes to the offset
+	Set(-24 * time.Hour)
+	test.Assert(t, clk.Now().Equal(base.Now().Add(-24*time.Hour)), "Clock didn't follow offset")
+}
+
+func TestHandler(t *testing.T) {
+	Enable(0)
+	defer Set(0)
+
+	w := request("PUT", `{"offset": "720h"}`)
+	test.AssertEquals(t, w.Code, http.StatusNoContent)
+	test.AssertEquals(t, Offset(), 720*time.Hour)
+
+	w = request("GET", "")
+	test.AssertEquals(t, w.Code, http.StatusOK)
+	var s stateJSON
+	test.AssertNotError(t, json.Unmarshal(w.Body.Bytes(), &s), "Couldn't parse state")
+	test.AssertEquals(t, s.Offset, (720 * time.Hour).String())
+	test.Assert(t, s.Now.After(time.Now().Add(719*time.Hour)), "Wrong skewed time")
+
+	w = request("DELETE", "")
+	test.AssertEquals(t, w.Code, http.StatusNoContent)
+	test.AssertEquals(t, Offset(), time.Duration(0))
+
+	for _, body := range []string{`{"offset": "soon"}`, `not json`} {
+		w = request("PUT", body)
+		test.AssertEquals(t, w.Code, http.StatusBadRequest)
+	}
+	w = request("POST", "{}")
+	test.AssertEquals(t, w.Code, http.StatusMethodNotAllowed)
+}
@@ -8,7 +8,7 @@ fi
 # The list of segments to run. To run only some of these segments, pre-set the
 # RUN variable with the ones you want (see .travis.yml for an example).
 # Order doesn't matter.
-RUN=${RUN:-vet lint fmt migrations unit integration}
+RUN=${RUN:-vet lint fmt migrations config unit integration}
 
 # The list of segments to hard fail on, as opposed to continuing to the end of
 # the unit tests before failing.  By defuault, we only hard-fail for gofmt,
@@ -217,6 +217,12 @@ if [[ "$RUN" =~ "migrations" ]] ; then
   end_context #"migrations"
 fi
 
+if [[ "$RUN" =~ "config" ]] ; then
+  start_context "config"
+  run_and_comment go run ./cmd/boulder-config-lint/main.go test/boulder-config.json
+  end_context #"config"
+fi
+
 #
 # Unit Tests.
 #
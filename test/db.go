@@ -79,11 +79,11 @@ func deleteEverythingInAllTables(db CleanUpDB) error {
 // allTableNamesInDB returns the names of the tables available to the
 // CleanUpDB passed in. "Tables available" means all tables that can
 // be seen in the MariaDB configuration by the database user except
-// for ones that are configuration only like goose_db_version (for
-// migrations) or the ones describing the internal configuration of
+// for ones that are configuration only like goose_db_version and
+// schemaCapabilities (for migrations) or the ones describing the internal configuration of
 // the server. To be used only in test code.
 func allTableNamesInDB(db CleanUpDB) ([]string, error) {
-	r, err := db.Query("select table_name from information_schema.tables t where t.table_schema = DATABASE() and t.table_name != 'goose_db_version';")
+	r, err := db.Query("select table_name from information_schema.tables t where t.table_schema = DATABASE() and t.table_name not in ('goose_db_version', 'schemaCapabilities');")
 	if err != nil {
 		return nil, err
 	}
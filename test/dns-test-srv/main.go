@@ -140,19 +140,21 @@ func (ts *testSrv) dnsHandler(w dns.ResponseWriter, r *dns.Msg) {
 
 func (ts *testSrv) serveTestResolver() {
 	dns.HandleFunc(".", ts.dnsHandler)
-	dnsServer := &dns.Server{
-		Addr:         "127.0.0.1:8053",
-		Net:          "tcp",
-		ReadTimeout:  time.Millisecond,
-		WriteTimeout: time.Millisecond,
-	}
-	go func() {
-		err := dnsServer.ListenAndServe()
-		if err != nil {
-			fmt.Println(err)
-			return
+	for _, network := range []string{"udp", "tcp"} {
+		dnsServer := &dns.Server{
+			Addr:         "127.0.0.1:8053",
+			Net:          network,
+			ReadTimeout:  time.Millisecond,
+			WriteTimeout: time.Millisecond,
 		}
-	}()
+		go func() {
+			err := dnsServer.ListenAndServe()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+		}()
+	}
 	webServer := &http.Server{
 		Addr:    "localhost:8055",
 		Handler: http.HandlerFunc(ts.setTXT),
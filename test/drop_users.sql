@@ -19,4 +19,11 @@ GRANT USAGE ON *.* TO 'mailer'@'localhost';
 DROP USER 'mailer'@'localhost';
 GRANT USAGE ON *.* TO 'cert_checker'@'localhost';
 DROP USER 'cert_checker'@'localhost';
-
+GRANT USAGE ON *.* TO 'ocsp_verifier'@'localhost';
+DROP USER 'ocsp_verifier'@'localhost';
+GRANT USAGE ON *.* TO 'revocation_stream'@'localhost';
+DROP USER 'revocation_stream'@'localhost';
+GRANT USAGE ON *.* TO 'validation_bundle'@'localhost';
+DROP USER 'validation_bundle'@'localhost';
+GRANT USAGE ON *.* TO 'revoker'@'localhost';
+DROP USER 'revoker'@'localhost';
@@ -20,7 +20,24 @@ ISSUANCE_FAILED = 1
 REVOCATION_FAILED = 2
 
 class ExitStatus:
-    OK, PythonFailure, NodeFailure, Error, OCSPFailure, CTFailure, IncorrectCommandLineArgs = range(7)
+    OK, PythonFailure, NodeFailure, Error, OCSPFailure, CTFailure, IncorrectCommandLineArgs, ChaosFailure = range(8)
+
+# Debug servers of the components whose faults the chaos tests inject. See
+# the chaos package for the management API they serve.
+CHAOS_DEBUG_ADDRS = {
+    "wfe": "localhost:8000",
+    "ca": "localhost:8001",
+    "ra": "localhost:8002",
+    "sa": "localhost:8003",
+    "va": "localhost:8004",
+    "publisher": "localhost:8009",
+}
+
+# Debug servers of the components whose clocks the clock skew helpers shift.
+# See the skew package for the management API they serve.
+CLOCK_DEBUG_ADDRS = dict(CHAOS_DEBUG_ADDRS, **{
+    "ocsp-updater": "localhost:8006",
+})
 
 
 class ProcInfo:
@@ -155,18 +172,22 @@ def verify_ct_submission(expectedSubmissions, url):
         die(ExitStatus.CTFailure)
     return 0
 
-def run_node_test(domain, chall_type, expected_ct_submissions):
-    cert_file = os.path.join(tempdir, "cert.der")
-    cert_file_pem = os.path.join(tempdir, "cert.pem")
-    key_file = os.path.join(tempdir, "key.pem")
-    # Issue the certificate and transform it from DER-encoded to PEM-encoded.
-    if subprocess.Popen('''
+def issue(domain, chall_type, key_file, cert_file, cert_file_pem):
+    """Issue a certificate with the node client, and transform it from
+    DER-encoded to PEM-encoded. Returns whether issuance succeeded."""
+    return subprocess.Popen('''
         node test.js --email foo@letsencrypt.org --agree true \
           --domains %s --new-reg http://localhost:4000/acme/new-reg \
           --certKey %s --cert %s --challType %s && \
         openssl x509 -in %s -out %s -inform der -outform pem
         ''' % (domain, key_file, cert_file, chall_type, cert_file, cert_file_pem),
-        shell=True).wait() != 0:
+        shell=True).wait() == 0
+
+def run_node_test(domain, chall_type, expected_ct_submissions):
+    cert_file = os.path.join(tempdir, "cert.der")
+    cert_file_pem = os.path.join(tempdir, "cert.pem")
+    key_file = os.path.join(tempdir, "key.pem")
+    if not issue(domain, chall_type, key_file, cert_file, cert_file_pem):
         print("\nIssuing failed")
         return ISSUANCE_FAILED
 
@@ -192,6 +213,84 @@ def run_node_test(domain, chall_type, expected_ct_submissions):
     wait_for_ocsp_revoked(cert_file_pem, "../test-ca.pem", ee_ocsp_url)
     return 0
 
+def chaos_request(component, method, point="", fault=None):
+    url = "http://%s/debug/chaos/%s" % (CHAOS_DEBUG_ADDRS[component], point)
+    req = urllib2.Request(url, data=json.dumps(fault) if fault is not None else None)
+    req.get_method = lambda: method
+    return urllib2.urlopen(req).read()
+
+def injected_faults(component, point):
+    state = json.loads(chaos_request(component, "GET"))
+    return state["injected"].get(point, 0)
+
+def reset_faults():
+    for component in CHAOS_DEBUG_ADDRS:
+        chaos_request(component, "DELETE")
+
+def clock_request(component, method, offset=None):
+    url = "http://%s/debug/clock" % CLOCK_DEBUG_ADDRS[component]
+    req = urllib2.Request(url, data=json.dumps({"offset": offset}) if offset is not None else None)
+    req.get_method = lambda: method
+    return urllib2.urlopen(req).read()
+
+def set_clock_offset(offset):
+    """Shift the clocks of all running components by offset, a Go duration
+    such as "2160h", so that expiry can be tested without waiting."""
+    for component in CLOCK_DEBUG_ADDRS:
+        clock_request(component, "PUT", offset)
+
+def reset_clocks():
+    for component in CLOCK_DEBUG_ADDRS:
+        clock_request(component, "DELETE")
+
+def random_domain():
+    return "www." + subprocess.check_output("openssl rand -hex 6", shell=True).strip() + "-chaos.com"
+
+# Each chaos case injects a fault at a point in one component, then tries to
+# issue a certificate: whether issuance should succeed, then whether it
+# should once the fault has cleared itself (faults with a count do), shows
+# that retries, timeouts and fallbacks behave as designed.
+CHAOS_CASES = [
+    # Slow DNS is waited out
+    ("va", "dns.A", {"latency": "2s"}, True, True),
+    # A failed DNS query is retried, as the validation retry policy allows
+    ("va", "dns.A", {"error": "resolver down", "count": 1}, True, True),
+    # DNS that stays down fails validation, and only that validation
+    ("va", "dns.A", {"error": "resolver down"}, False, True),
+    # Failures to submit to CT logs are audit logged but don't stop issuance
+    ("publisher", "publisher.AddChain", {"error": "log down"}, True, True),
+    # A failure to store the certificate fails issuance cleanly
+    ("sa", "sa.AddCertificate", {"error": "database down", "count": 1}, False, True),
+    # A lost request to the RA times out rather than hanging the WFE
+    ("ra", "rpc.server.NewCertificate", {"drop": True, "count": 1}, False, True),
+    # Slow RPCs within the timeout are waited out
+    ("ca", "rpc.server.IssueCertificate", {"latency": "3s"}, True, True),
+]
+
+def run_chaos_tests():
+    """Issue certificates while faults are injected into the components,
+    checking that each failure is survived or fails issuance as designed."""
+    key_file = os.path.join(tempdir, "chaos-key.pem")
+    cert_file = os.path.join(tempdir, "chaos-cert.der")
+    cert_file_pem = os.path.join(tempdir, "chaos-cert.pem")
+    for component, point, fault, during, after in CHAOS_CASES:
+        reset_faults()
+        chaos_request(component, "PUT", point, fault)
+        issued = issue(random_domain(), "http-01", key_file, cert_file, cert_file_pem)
+        if issued != during:
+            print("\nChaos: issuance with %s at %s: expected success %s, got %s" % (fault, point, during, issued))
+            die(ExitStatus.ChaosFailure)
+        if injected_faults(component, point) == 0:
+            print("\nChaos: no fault was injected at %s" % point)
+            die(ExitStatus.ChaosFailure)
+        if fault.get("count") is None:
+            chaos_request(component, "DELETE", point)
+        issued = issue(random_domain(), "http-01", key_file, cert_file, cert_file_pem)
+        if issued != after:
+            print("\nChaos: issuance after %s at %s: expected success %s, got %s" % (fault, point, after, issued))
+            die(ExitStatus.ChaosFailure)
+    reset_faults()
+
 def run_client_tests():
     root = os.environ.get("LETSENCRYPT_PATH")
     assert root is not None, (
@@ -228,21 +327,25 @@ def main():
                         help="run the letsencrypt's (the python client's) integration tests")
     parser.add_argument('--node', dest="run_node", action="store_true",
                         help="run the node client's integration tests")
-    parser.set_defaults(run_all=False, run_letsencrypt=False, run_node=False)
+    parser.add_argument('--chaos', dest="run_chaos", action="store_true",
+                        help="run the node client's integration tests under injected faults")
+    parser.set_defaults(run_all=False, run_letsencrypt=False, run_node=False, run_chaos=False)
     args = parser.parse_args()
 
-    if not (args.run_all or args.run_letsencrypt or args.run_node):
+    if not (args.run_all or args.run_letsencrypt or args.run_node or args.run_chaos):
         print >> sys.stderr, "must run at least one of the letsencrypt or node tests with --all, --letsencrypt, or --node"
         die(ExitStatus.IncorrectCommandLineArgs)
 
     if not startservers.start(race_detection=True):
         die(ExitStatus.Error)
 
-    if args.run_all or args.run_node:
+    if args.run_all or args.run_node or args.run_chaos:
         os.chdir('test/js')
         if subprocess.Popen('npm install', shell=True).wait() != 0:
             print("\n Installing NPM modules failed")
             die(ExitStatus.Error)
+
+    if args.run_all or args.run_node:
         # Pick a random hostname so we don't run into certificate rate limiting.
         domain = "www." + subprocess.check_output("openssl rand -hex 6", shell=True).strip() + "-TEST.com"
         challenge_types = ["http-01", "dns-01"]
@@ -265,6 +368,9 @@ def main():
             print("\nIssused certificate for domain with bad CAA records")
             die(ExitStatus.NodeFailure)
 
+    if args.run_all or args.run_chaos:
+        run_chaos_tests()
+
     # Simulate a disconnection from RabbitMQ to make sure reconnects work.
     startservers.bounce_forward()
 
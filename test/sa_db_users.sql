@@ -21,8 +21,23 @@ GRANT SELECT(id,Lockcol) ON pendingAuthorizations TO 'sa'@'127.0.0.1';
 GRANT SELECT,INSERT ON certificates TO 'sa'@'127.0.0.1';
 GRANT SELECT,INSERT,UPDATE ON certificateStatus TO 'sa'@'127.0.0.1';
 GRANT SELECT,INSERT ON issuedNames TO 'sa'@'127.0.0.1';
-GRANT SELECT,INSERT ON sctReceipts TO 'sa'@'127.0.0.1';
+GRANT SELECT,INSERT ON fqdnSets TO 'sa'@'127.0.0.1';
+GRANT SELECT,INSERT,UPDATE ON ctSubmissions TO 'sa'@'127.0.0.1';
 GRANT SELECT,INSERT ON deniedCSRs TO 'sa'@'127.0.0.1';
+GRANT SELECT,INSERT,DELETE ON rateLimitOverrides TO 'sa'@'127.0.0.1';
+GRANT SELECT,INSERT ON replacementOrders TO 'sa'@'127.0.0.1';
+GRANT SELECT,INSERT,UPDATE ON certificateOrders TO 'sa'@'127.0.0.1';
+GRANT SELECT,INSERT,UPDATE,DELETE ON certificateOrderRequests TO 'sa'@'127.0.0.1';
+GRANT SELECT,INSERT,UPDATE,DELETE ON idempotencyKeys TO 'sa'@'127.0.0.1';
+GRANT SELECT,INSERT,UPDATE ON caaChecks TO 'sa'@'127.0.0.1';
+GRANT SELECT,INSERT ON certificateIssuers TO 'sa'@'127.0.0.1';
+GRANT SELECT ON certificateStatusArchive TO 'sa'@'127.0.0.1';
+GRANT SELECT,INSERT ON validationTranscripts TO 'sa'@'127.0.0.1';
+GRANT SELECT,INSERT ON keyHashToSerial TO 'sa'@'127.0.0.1';
+GRANT SELECT,INSERT ON blockedKeys TO 'sa'@'127.0.0.1';
+GRANT SELECT ON schemaCapabilities TO 'sa'@'127.0.0.1';
+-- To see other users' schema changes in information_schema.PROCESSLIST
+GRANT PROCESS ON *.* TO 'sa'@'127.0.0.1';
 GRANT INSERT ON ocspResponses TO 'sa'@'127.0.0.1';
 GRANT SELECT,INSERT,UPDATE ON registrations TO 'sa'@'127.0.0.1';
 GRANT SELECT,INSERT,UPDATE ON challenges TO 'sa'@'127.0.0.1';
@@ -34,13 +49,9 @@ GRANT SELECT ON ocspResponses TO 'ocsp_resp'@'127.0.0.1';
 -- OCSP Generator Tool (Updater)
 GRANT INSERT ON ocspResponses TO 'ocsp_update'@'127.0.0.1';
 GRANT SELECT ON certificates TO 'ocsp_update'@'127.0.0.1';
-GRANT SELECT,UPDATE ON certificateStatus TO 'ocsp_update'@'127.0.0.1';
-GRANT SELECT ON sctReceipts TO 'ocsp_update'@'127.0.0.1';
-
--- Revoker Tool
-GRANT SELECT ON registrations TO 'revoker'@'127.0.0.1';
-GRANT SELECT ON certificates TO 'revoker'@'127.0.0.1';
-GRANT SELECT,INSERT ON deniedCSRs TO 'revoker'@'127.0.0.1';
+GRANT SELECT,UPDATE,DELETE ON certificateStatus TO 'ocsp_update'@'127.0.0.1';
+GRANT SELECT,INSERT ON certificateStatusArchive TO 'ocsp_update'@'127.0.0.1';
+GRANT SELECT ON ctSubmissions TO 'ocsp_update'@'127.0.0.1';
 
 -- External Cert Importer
 GRANT SELECT,INSERT,UPDATE,DELETE ON identifierData TO 'importer'@'127.0.0.1';
@@ -49,9 +60,26 @@ GRANT SELECT,INSERT,UPDATE,DELETE ON externalCerts TO 'importer'@'127.0.0.1';
 -- Expiration mailer
 GRANT SELECT ON certificates TO 'mailer'@'127.0.0.1';
 GRANT SELECT,UPDATE ON certificateStatus TO 'mailer'@'127.0.0.1';
+GRANT SELECT ON replacementOrders TO 'mailer'@'127.0.0.1';
+GRANT SELECT ON schemaCapabilities TO 'mailer'@'127.0.0.1';
 
 -- Cert checker
 GRANT SELECT ON certificates TO 'cert_checker'@'127.0.0.1';
 
+-- OCSP verifier
+GRANT SELECT ON certificates TO 'ocsp_verifier'@'127.0.0.1';
+GRANT SELECT ON certificateStatus TO 'ocsp_verifier'@'127.0.0.1';
+
+-- Revocation stream
+GRANT SELECT ON certificateStatus TO 'revocation_stream'@'127.0.0.1';
+
+-- Validation bundle
+GRANT SELECT(id,identifier,status,expires) ON authz TO 'validation_bundle'@'127.0.0.1';
+GRANT SELECT(id,identifier,expires) ON pendingAuthorizations TO 'validation_bundle'@'127.0.0.1';
+
+-- Admin revoker, planning bulk revocations
+GRANT SELECT ON certificates TO 'revoker'@'127.0.0.1';
+GRANT SELECT ON certificateStatus TO 'revoker'@'127.0.0.1';
+
 -- Test setup and teardown
 GRANT ALL PRIVILEGES ON * to 'test_setup'@'127.0.0.1';
@@ -0,0 +1,247 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package tsa obtains RFC 3161 timestamp tokens from a time-stamping
+// authority, so that when an event happened can be shown to third parties
+// who don't trust our clocks or logs. A token is the TSA's CMS signature
+// over the SHA-256 hash of the event and the time it saw it; anyone holding
+// the event can check it against the TSA's certificate, e.g. with
+// "openssl ts -verify".
+package tsa
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	oidSHA256     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+)
+
+// The PKIStatus values a TSA grants a request with
+const (
+	statusGranted         = 0
+	statusGrantedWithMods = 1
+)
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+// signedData is the start of a CMS SignedData; the certificates and
+// signer infos that follow aren't needed to read the token.
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo struct {
+		EContentType asn1.ObjectIdentifier
+		EContent     []byte `asn1:"explicit,tag:0"`
+	}
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+	Accuracy       accuracy  `asn1:"optional"`
+	Ordering       bool      `asn1:"optional"`
+	Nonce          *big.Int  `asn1:"optional"`
+}
+
+// Token is a timestamp token granted by a TSA.
+type Token struct {
+	// DER is the token, a CMS SignedData ContentInfo, as the TSA sent it
+	DER []byte
+	// Time is when the TSA says it saw the hash
+	Time time.Time
+	// Serial is the TSA's serial number for the token
+	Serial *big.Int
+}
+
+// Timestamper obtains timestamp tokens over SHA-256 hashes.
+type Timestamper interface {
+	Timestamp(ctx context.Context, digest []byte) (*Token, error)
+}
+
+// Client requests timestamp tokens from the TSA at URL over HTTP.
+type Client struct {
+	URL string
+	// Policy, if set, is the TSA policy tokens are requested under
+	Policy asn1.ObjectIdentifier
+	client *http.Client
+}
+
+// New returns a Client for the TSA at url, whose requests are abandoned
+// after timeout.
+func New(url string, timeout time.Duration) *Client {
+	return &Client{URL: url, client: &http.Client{Timeout: timeout}}
+}
+
+// ParsePolicy parses a dotted OID, as configured for Client.Policy.
+func ParsePolicy(s string) (asn1.ObjectIdentifier, error) {
+	var oid asn1.ObjectIdentifier
+	for _, arc := range strings.Split(s, ".") {
+		var n int
+		if _, err := fmt.Sscanf(arc, "%d", &n); err != nil || n < 0 || fmt.Sprint(n) != arc {
+			return nil, fmt.Errorf("Invalid TSA policy OID %q", s)
+		}
+		oid = append(oid, n)
+	}
+	if len(oid) < 2 {
+		return nil, fmt.Errorf("Invalid TSA policy OID %q", s)
+	}
+	return oid, nil
+}
+
+// Timestamp requests a token over digest, a SHA-256 hash, and checks that
+// the token the TSA returns is for it.
+func (c *Client) Timestamp(ctx context.Context, digest []byte) (*Token, error) {
+	if len(digest) != 32 {
+		return nil, errors.New("Timestamped digests must be SHA-256 hashes")
+	}
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	reqDER, err := asn1.Marshal(timeStampReq{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			HashedMessage: digest,
+		},
+		ReqPolicy: c.Policy,
+		Nonce:     nonce,
+		// The TSA's certificate is included so that the token can be
+		// verified on its own
+		CertReq: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", c.URL, bytes.NewReader(reqDER))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/timestamp-query")
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("TSA returned HTTP status %d", resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return parseResponse(body, digest, nonce)
+}
+
+// parseResponse reads the token from a TimeStampResp, checking that it was
+// granted for digest and, if the request had one, nonce.
+func parseResponse(der, digest []byte, nonce *big.Int) (*Token, error) {
+	var resp timeStampResp
+	if rest, err := asn1.Unmarshal(der, &resp); err != nil {
+		return nil, fmt.Errorf("Malformed TSA response: %s", err)
+	} else if len(rest) != 0 {
+		return nil, errors.New("Trailing data after TSA response")
+	}
+	if s := resp.Status.Status; s != statusGranted && s != statusGrantedWithMods {
+		return nil, fmt.Errorf("TSA refused the request with status %d: %s",
+			s, strings.Join(resp.Status.StatusString, "; "))
+	}
+	if len(resp.TimeStampToken.FullBytes) == 0 {
+		return nil, errors.New("TSA granted the request without a token")
+	}
+
+	info, err := parseToken(resp.TimeStampToken.FullBytes)
+	if err != nil {
+		return nil, err
+	}
+	if !info.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) ||
+		!bytes.Equal(info.MessageImprint.HashedMessage, digest) {
+		return nil, errors.New("TSA token is for a different hash")
+	}
+	if nonce != nil && (info.Nonce == nil || info.Nonce.Cmp(nonce) != 0) {
+		return nil, errors.New("TSA token has the wrong nonce")
+	}
+	return &Token{
+		DER:    resp.TimeStampToken.FullBytes,
+		Time:   info.GenTime,
+		Serial: info.SerialNumber,
+	}, nil
+}
+
+// parseToken reads the TSTInfo signed by a token. It doesn't check the
+// signature, which is for whoever later relies on the token to do against
+// the TSA certificate they trust.
+func parseToken(der []byte) (*tstInfo, error) {
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, fmt.Errorf("Malformed TSA token: %s", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, errors.New("TSA token isn't CMS SignedData")
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("Malformed TSA token: %s", err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return nil, errors.New("TSA token doesn't sign a TSTInfo")
+	}
+	var info tstInfo
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent, &info); err != nil {
+		return nil, fmt.Errorf("Malformed TSA token: %s", err)
+	}
+	return &info, nil
+}
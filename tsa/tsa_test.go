@@ -0,0 +1,124 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tsa
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/asn1"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+var genTime = time.Date(2015, 12, 1, 12, 0, 0, 0, time.UTC)
+
+// token returns the DER of a token, unsigned, whose TSTInfo is info.
+func token(t *testing.T, info tstInfo) []byte {
+	infoDER, err := asn1.Marshal(info)
+	test.AssertNotError(t, err, "Failed to marshal TSTInfo")
+	var sd signedData
+	sd.Version = 3
+	sd.DigestAlgorithms = asn1.RawValue{Tag: asn1.TagSet, IsCompound: true}
+	sd.EncapContentInfo.EContentType = oidTSTInfo
+	sd.EncapContentInfo.EContent = infoDER
+	sdDER, err := asn1.Marshal(sd)
+	test.AssertNotError(t, err, "Failed to marshal SignedData")
+	der, err := asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sdDER},
+	})
+	test.AssertNotError(t, err, "Failed to marshal ContentInfo")
+	return der
+}
+
+// tsaServer grants each request with a token made by modify from the one
+// it would correctly return.
+func tsaServer(t *testing.T, modify func(*tstInfo)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		test.AssertEquals(t, r.Header.Get("Content-Type"), "application/timestamp-query")
+		body, _ := ioutil.ReadAll(r.Body)
+		var req timeStampReq
+		_, err := asn1.Unmarshal(body, &req)
+		test.AssertNotError(t, err, "Failed to unmarshal request")
+		test.Assert(t, req.CertReq, "TSA certificate not requested")
+		info := tstInfo{
+			Version:        1,
+			Policy:         asn1.ObjectIdentifier{1, 2, 3},
+			MessageImprint: req.MessageImprint,
+			SerialNumber:   big.NewInt(7),
+			GenTime:        genTime,
+			Nonce:          req.Nonce,
+		}
+		if modify != nil {
+			modify(&info)
+		}
+		resp, _ := asn1.Marshal(timeStampResp{
+			Status:         pkiStatusInfo{Status: statusGranted},
+			TimeStampToken: asn1.RawValue{FullBytes: token(t, info)},
+		})
+		w.Write(resp)
+	}))
+}
+
+func TestTimestamp(t *testing.T) {
+	srv := tsaServer(t, nil)
+	defer srv.Close()
+	digest := sha256.Sum256([]byte("event"))
+
+	tok, err := New(srv.URL, time.Second).Timestamp(context.Background(), digest[:])
+	test.AssertNotError(t, err, "Timestamp failed")
+	test.Assert(t, tok.Time.Equal(genTime), "Wrong time")
+	test.AssertEquals(t, tok.Serial.Int64(), int64(7))
+	info, err := parseToken(tok.DER)
+	test.AssertNotError(t, err, "Returned token doesn't parse")
+	test.AssertByteEquals(t, info.MessageImprint.HashedMessage, digest[:])
+
+	_, err = New(srv.URL, time.Second).Timestamp(context.Background(), []byte("short"))
+	test.AssertError(t, err, "Timestamped a digest that isn't SHA-256")
+}
+
+func TestTimestampMismatch(t *testing.T) {
+	digest := sha256.Sum256([]byte("event"))
+	for name, modify := range map[string]func(*tstInfo){
+		"hash":  func(info *tstInfo) { info.MessageImprint.HashedMessage = make([]byte, 32) },
+		"nonce": func(info *tstInfo) { info.Nonce = big.NewInt(1) },
+	} {
+		srv := tsaServer(t, modify)
+		_, err := New(srv.URL, time.Second).Timestamp(context.Background(), digest[:])
+		test.AssertError(t, err, "Accepted a token with the wrong "+name)
+		srv.Close()
+	}
+}
+
+func TestTimestampRefused(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, _ := asn1.Marshal(timeStampResp{
+			Status: pkiStatusInfo{Status: 2, StatusString: []string{"unsupported policy"}},
+		})
+		w.Write(resp)
+	}))
+	defer srv.Close()
+	digest := sha256.Sum256([]byte("event"))
+	_, err := New(srv.URL, time.Second).Timestamp(context.Background(), digest[:])
+	test.AssertError(t, err, "Accepted a refusal")
+	test.AssertContains(t, err.Error(), "unsupported policy")
+}
+
+func TestParsePolicy(t *testing.T) {
+	oid, err := ParsePolicy("1.3.6.1.4.1.4146.2.3")
+	test.AssertNotError(t, err, "Failed to parse policy")
+	test.Assert(t, oid.Equal(asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 4146, 2, 3}), "Wrong policy")
+	for _, bad := range []string{"", "1", "1..2", "1.-2", "1.02", "a.b"} {
+		_, err = ParsePolicy(bad)
+		test.AssertError(t, err, "Parsed invalid policy "+bad)
+	}
+}
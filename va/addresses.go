@@ -0,0 +1,114 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"fmt"
+	"net"
+)
+
+// defaultBlockedRanges are the ranges that validation never connects to
+// unless AddressPolicy says otherwise: private, loopback, link-local,
+// documentation, multicast and other reserved ranges (RFC 6890).
+var defaultBlockedRanges = []string{
+	"0.0.0.0/8",       // "This network", RFC 1122
+	"10.0.0.0/8",      // Private, RFC 1918
+	"100.64.0.0/10",   // Shared address space, RFC 6598
+	"127.0.0.0/8",     // Loopback, RFC 1122
+	"169.254.0.0/16",  // Link-local, RFC 3927
+	"172.16.0.0/12",   // Private, RFC 1918
+	"192.0.0.0/24",    // IETF protocol assignments, RFC 6890
+	"192.0.2.0/24",    // Documentation, RFC 5737
+	"192.88.99.0/24",  // 6to4 relay anycast, RFC 3068
+	"192.168.0.0/16",  // Private, RFC 1918
+	"198.18.0.0/15",   // Benchmarking, RFC 2544
+	"198.51.100.0/24", // Documentation, RFC 5737
+	"203.0.113.0/24",  // Documentation, RFC 5737
+	"224.0.0.0/4",     // Multicast, RFC 5771
+	"240.0.0.0/4",     // Reserved and limited broadcast, RFC 1112 and RFC 919
+	"::/128",          // Unspecified, RFC 4291
+	"::1/128",         // Loopback, RFC 4291
+	"64:ff9b::/96",    // IPv4-IPv6 translation, RFC 6052
+	"100::/64",        // Discard-only, RFC 6666
+	"2001::/23",       // IETF protocol assignments, RFC 2928
+	"2001:db8::/32",   // Documentation, RFC 3849
+	"fc00::/7",        // Unique local, RFC 4193
+	"fe80::/10",       // Link-local, RFC 4291
+	"ff00::/8",        // Multicast, RFC 4291
+}
+
+// AddressPolicy decides which of the addresses a name resolves to the VA
+// may connect to during validation, so that crafted DNS can't point it at
+// the CA's own network. Addresses in BlockedRanges, which defaults to
+// private, loopback, link-local and other reserved ranges, are skipped unless
+// they are also in AllowedRanges. Ranges are in CIDR notation. The policy
+// applies to every connection, including those made to follow redirects.
+type AddressPolicy struct {
+	BlockedRanges []string
+	AllowedRanges []string
+}
+
+func (ap AddressPolicy) blockedRanges() []string {
+	if len(ap.BlockedRanges) == 0 {
+		return defaultBlockedRanges
+	}
+	return ap.BlockedRanges
+}
+
+func parseRanges(ranges []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(ranges))
+	for _, r := range ranges {
+		_, n, err := net.ParseCIDR(r)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid address range %q: %s", r, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func inRanges(ip net.IP, nets []*net.IPNet) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns an error if any of the policy's ranges is malformed.
+func (ap AddressPolicy) Check() error {
+	if _, err := parseRanges(ap.blockedRanges()); err != nil {
+		return err
+	}
+	_, err := parseRanges(ap.AllowedRanges)
+	return err
+}
+
+// permits returns whether the VA may connect to ip. A policy that doesn't
+// pass Check permits nothing.
+func (ap AddressPolicy) permits(ip net.IP) bool {
+	blocked, err := parseRanges(ap.blockedRanges())
+	if err != nil {
+		return false
+	}
+	allowed, err := parseRanges(ap.AllowedRanges)
+	if err != nil {
+		return false
+	}
+	return !inRanges(ip, blocked) || inRanges(ip, allowed)
+}
+
+// permitted returns those of addrs that the policy permits, in order.
+func (ap AddressPolicy) permitted(addrs []net.IP) []net.IP {
+	var permitted []net.IP
+	for _, addr := range addrs {
+		if ap.permits(addr) {
+			permitted = append(permitted, addr)
+		}
+	}
+	return permitted
+}
@@ -0,0 +1,63 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"net"
+	"testing"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/probs"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestAddressPolicyDefaults(t *testing.T) {
+	var ap AddressPolicy
+	test.AssertNotError(t, ap.Check(), "Default policy should be valid")
+	for _, blocked := range []string{"10.1.2.3", "127.0.0.1", "169.254.169.254", "172.17.0.1", "192.168.1.1", "::1", "fe80::1", "fd00::1"} {
+		test.Assert(t, !ap.permits(net.ParseIP(blocked)), blocked+" should be blocked")
+	}
+	for _, public := range []string{"64.233.160.1", "8.8.8.8", "2001:4860:4860::8888"} {
+		test.Assert(t, ap.permits(net.ParseIP(public)), public+" should be permitted")
+	}
+}
+
+func TestAddressPolicyRanges(t *testing.T) {
+	ap := AddressPolicy{AllowedRanges: []string{"10.0.0.0/24"}}
+	test.Assert(t, ap.permits(net.ParseIP("10.0.0.5")), "Allowed range should override the defaults")
+	test.Assert(t, !ap.permits(net.ParseIP("10.0.1.5")), "Rest of the blocked range should stay blocked")
+
+	ap = AddressPolicy{BlockedRanges: []string{"8.8.8.0/24"}}
+	test.Assert(t, !ap.permits(net.ParseIP("8.8.8.8")), "Configured range should be blocked")
+	test.Assert(t, ap.permits(net.ParseIP("10.1.2.3")), "Configured ranges should replace the defaults")
+
+	addrs := []net.IP{net.ParseIP("8.8.8.8"), net.ParseIP("8.8.4.4")}
+	permitted := ap.permitted(addrs)
+	test.AssertEquals(t, len(permitted), 1)
+	test.Assert(t, permitted[0].Equal(addrs[1]), "Wrong address permitted")
+
+	ap = AddressPolicy{AllowedRanges: []string{"10.0.0.0/33"}}
+	test.AssertError(t, ap.Check(), "Malformed range should be rejected")
+	test.Assert(t, !ap.permits(net.ParseIP("8.8.8.8")), "Malformed policy should permit nothing")
+}
+
+func TestGetAddrFiltered(t *testing.T) {
+	stats, _ := statsd.NewNoopClient()
+	va := NewValidationAuthorityImpl(&PortConfig{}, nil, stats, clock.Default())
+	va.DNSResolver = &mocks.DNSResolver{}
+
+	// The mock resolves everything to 127.0.0.1
+	_, _, prob := va.getAddr("localhost")
+	test.Assert(t, prob != nil, "Loopback address should be filtered")
+	test.AssertEquals(t, prob.Type, probs.ConnectionProblem)
+
+	va.AddressPolicy = allowLoopback
+	addr, _, prob := va.getAddr("localhost")
+	test.Assert(t, prob == nil, "Allowed loopback address should be used")
+	test.Assert(t, addr.Equal(net.ParseIP("127.0.0.1")), "Wrong address used")
+}
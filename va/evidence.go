@@ -0,0 +1,168 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/identifier"
+)
+
+// RequestEvidence is the audit record of one request the VA made to
+// validate a challenge, and of what it received in response, so that
+// whether and how the CA contacted a server can be settled later.
+type RequestEvidence struct {
+	Identifier string
+	Challenge  string
+	// Request is "METHOD URL" for HTTP requests, or "TLS host:port SNI
+	// name" for TLS handshakes.
+	Request string
+	Address string `json:",omitempty"`
+	Time    time.Time
+	Status  int `json:",omitempty"`
+	// ResponseSHA256 is the hex SHA-256 of the response body bytes read,
+	// or of the DER of the leaf certificate presented.
+	ResponseSHA256 string `json:",omitempty"`
+	Error          string `json:",omitempty"`
+}
+
+// signedRequestEvidence is what's audit logged: the evidence, and a compact
+// JWS of it signed with the VA's TranscriptKey, if it has one.
+type signedRequestEvidence struct {
+	RequestEvidence
+	Signature string `json:",omitempty"`
+}
+
+// VerifyRequestEvidence checks that signature, from an audit log line, was
+// made by key, the public half of a VA's TranscriptKey, and returns the
+// evidence it signs.
+func VerifyRequestEvidence(signature string, key crypto.PublicKey) (RequestEvidence, error) {
+	var ev RequestEvidence
+	jws, err := jose.ParseSigned(signature)
+	if err != nil {
+		return ev, err
+	}
+	payload, err := jws.Verify(key)
+	if err != nil {
+		return ev, err
+	}
+	err = json.Unmarshal(payload, &ev)
+	return ev, err
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// logEvidence audit logs ev, signed if the VA has a TranscriptKey. Failing
+// to sign is logged, but doesn't fail the validation: the unsigned record is
+// still logged.
+func (va *ValidationAuthorityImpl) logEvidence(ev RequestEvidence) {
+	signed := signedRequestEvidence{RequestEvidence: ev}
+	if va.TranscriptKey != nil {
+		sig, err := signEvidence(va.TranscriptKey, ev)
+		if err != nil {
+			va.log.Warning(fmt.Sprintf("Couldn't sign validation request evidence: %s", err))
+			va.stats.Inc("VA.Evidence.SigningFailed", 1, 1.0)
+		}
+		signed.Signature = sig
+	}
+	va.log.AuditObject("Validation request", signed)
+}
+
+func signEvidence(key crypto.Signer, ev RequestEvidence) (string, error) {
+	alg, err := core.SigningAlgorithm(key)
+	if err != nil {
+		return "", err
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: alg, Key: key}, &jose.SignerOptions{EmbedJWK: true})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return "", err
+	}
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+	return jws.CompactSerialize()
+}
+
+// evidenceTransport logs evidence of each request made through it, those
+// following redirects included, once its response body is closed.
+type evidenceTransport struct {
+	va         *ValidationAuthorityImpl
+	rt         http.RoundTripper
+	identifier identifier.ACMEIdentifier
+	challenge  string
+	// address returns the address a request for url was sent to
+	address func(url string) net.IP
+}
+
+func (et *evidenceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ev := RequestEvidence{
+		Identifier: et.identifier.Value,
+		Challenge:  et.challenge,
+		Request:    fmt.Sprintf("%s %s", req.Method, req.URL),
+		Time:       et.va.clk.Now(),
+	}
+	if addr := et.address(req.URL.String()); addr != nil {
+		ev.Address = addr.String()
+	}
+	resp, err := et.rt.RoundTrip(req)
+	if err != nil {
+		ev.Error = err.Error()
+		et.va.logEvidence(ev)
+		return resp, err
+	}
+	ev.Status = resp.StatusCode
+	resp.Body = &hashingBody{
+		ReadCloser: resp.Body,
+		hash:       sha256.New(),
+		done: func(sum []byte) {
+			ev.ResponseSHA256 = hex.EncodeToString(sum)
+			et.va.logEvidence(ev)
+		},
+	}
+	return resp, nil
+}
+
+// hashingBody hashes the bytes read from a response body, passing the sum
+// to done when it's first closed.
+type hashingBody struct {
+	io.ReadCloser
+	hash hash.Hash
+	done func(sum []byte)
+	once sync.Once
+}
+
+func (hb *hashingBody) Read(p []byte) (int, error) {
+	n, err := hb.ReadCloser.Read(p)
+	hb.hash.Write(p[:n])
+	return n, err
+}
+
+func (hb *hashingBody) Close() error {
+	err := hb.ReadCloser.Close()
+	hb.once.Do(func() { hb.done(hb.hash.Sum(nil)) })
+	return err
+}
@@ -0,0 +1,93 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// loggedEvidence returns the request evidence audit logged since the log
+// was last cleared.
+func loggedEvidence(t *testing.T) []signedRequestEvidence {
+	var logged []signedRequestEvidence
+	for _, msg := range log.GetAllMatching(`^\[AUDIT\] Validation request JSON=`) {
+		var ev signedRequestEvidence
+		err := json.Unmarshal([]byte(strings.SplitN(msg.Message, "JSON=", 2)[1]), &ev)
+		test.AssertNotError(t, err, "Failed to unmarshal logged evidence")
+		logged = append(logged, ev)
+	}
+	return logged
+}
+
+func TestRequestEvidence(t *testing.T) {
+	chall := core.HTTPChallenge01(accountKey)
+	err := setChallengeToken(&chall, pathMoved)
+	test.AssertNotError(t, err, "Failed to complete HTTP challenge")
+
+	hs := httpSrv(t, chall.Token)
+	defer hs.Close()
+	port, err := getPort(hs)
+	test.AssertNotError(t, err, "failed to get test server port")
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+
+	stats, _ := statsd.NewNoopClient()
+	va := NewValidationAuthorityImpl(&PortConfig{HTTPPort: port}, nil, stats, clock.Default())
+	va.AddressPolicy = allowLoopback
+	va.DNSResolver = &mocks.DNSResolver{}
+	va.allowNonPublicRedirects = true
+	va.TranscriptKey = key
+
+	// The redirect and the request it leads to are both recorded
+	log.Clear()
+	_, prob := va.validateHTTP01(ident, chall)
+	test.Assert(t, prob == nil, "Validation failed")
+	logged := loggedEvidence(t)
+	test.AssertEquals(t, len(logged), 2)
+	test.Assert(t, strings.HasSuffix(logged[0].Request, "/"+pathMoved), "First request isn't for the challenge path")
+	test.AssertEquals(t, logged[0].Status, 301)
+	test.Assert(t, strings.HasSuffix(logged[1].Request, "/"+pathValid), "Second request isn't for the redirect")
+	test.AssertEquals(t, logged[1].Status, 200)
+	test.AssertEquals(t, logged[1].Address, "127.0.0.1")
+
+	keyAuthz, _ := core.NewKeyAuthorization(pathMoved, accountKey)
+	test.AssertEquals(t, logged[1].ResponseSHA256, sha256Hex([]byte(keyAuthz.String()+"\n \t")))
+
+	for _, ev := range logged {
+		verified, err := VerifyRequestEvidence(ev.Signature, &key.PublicKey)
+		test.AssertNotError(t, err, "Failed to verify evidence")
+		test.AssertEquals(t, verified.Request, ev.Request)
+		test.AssertEquals(t, verified.ResponseSHA256, ev.ResponseSHA256)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	_, err = VerifyRequestEvidence(logged[0].Signature, &other.PublicKey)
+	test.AssertError(t, err, "Evidence verified with the wrong key")
+
+	// Failed connections are recorded too, unsigned without a key
+	va = NewValidationAuthorityImpl(&PortConfig{HTTPPort: port + 1}, nil, stats, clock.Default())
+	va.AddressPolicy = allowLoopback
+	va.DNSResolver = &mocks.DNSResolver{}
+	log.Clear()
+	_, prob = va.validateHTTP01(ident, chall)
+	test.Assert(t, prob != nil, "Validation against a closed port passed")
+	logged = loggedEvidence(t)
+	test.AssertEquals(t, len(logged), 1)
+	test.Assert(t, logged[0].Error != "", "Connection failure wasn't recorded")
+	test.AssertEquals(t, logged[0].Signature, "")
+}
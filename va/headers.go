@@ -0,0 +1,83 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// reservedHeaders are set by the VA or by net/http, so can't be configured
+// as extra headers.
+var reservedHeaders = map[string]bool{
+	"Accept":            true,
+	"Connection":        true,
+	"Content-Length":    true,
+	"Host":              true,
+	"Transfer-Encoding": true,
+	"User-Agent":        true,
+}
+
+// CheckHeaders returns an error if any of headers, to be sent with HTTP
+// validation requests, has a malformed name or value, or is one the VA sets
+// itself.
+func CheckHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		if name == "" || strings.IndexFunc(name, func(r rune) bool {
+			return r <= ' ' || r >= 0x7f || strings.ContainsRune("()<>@,;:\\\"/[]?={}", r)
+		}) >= 0 {
+			return fmt.Errorf("Invalid header name %q", name)
+		}
+		if reservedHeaders[http.CanonicalHeaderKey(name)] {
+			return fmt.Errorf("Header %q is set by the VA and can't be configured", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("Invalid value for header %q", name)
+		}
+	}
+	return nil
+}
+
+// withAccount returns a copy of va whose HTTP validation requests are made
+// for the authorization authzID of the registration regID.
+func (va *ValidationAuthorityImpl) withAccount(regID int64, authzID string) *ValidationAuthorityImpl {
+	scoped := *va
+	scoped.regID, scoped.authzID = regID, authzID
+	return &scoped
+}
+
+// userAgent returns the User-Agent HTTP validation requests are sent with.
+func (va *ValidationAuthorityImpl) userAgent() string {
+	if va.UserAgent == "" || !va.UserAgentIdentifiers || va.regID == 0 {
+		return va.UserAgent
+	}
+	if va.authzID == "" {
+		return fmt.Sprintf("%s (account %d)", va.UserAgent, va.regID)
+	}
+	return fmt.Sprintf("%s (account %d; authorization %s)", va.UserAgent, va.regID, va.authzID)
+}
+
+// setHeaders sets the headers of an HTTP validation request, including one
+// made to follow a redirect.
+func (va *ValidationAuthorityImpl) setHeaders(req *http.Request) {
+	for name, value := range va.Headers {
+		req.Header.Set(name, value)
+	}
+	if ua := va.userAgent(); ua != "" {
+		req.Header["User-Agent"] = []string{ua}
+	}
+	// Some of our users use mod_security. Mod_security sees a lack of Accept
+	// headers as bot behavior and rejects requests. While this is a bug in
+	// mod_security's rules (given that the HTTP specs disagree with that
+	// requirement), we add the Accept header now in order to fix our
+	// mod_security users' mysterious breakages. See
+	// <https://github.com/SpiderLabs/owasp-modsecurity-crs/issues/265> and
+	// <https://github.com/letsencrypt/boulder/issues/1019>. This was done
+	// because it's a one-line fix with no downside. We're not likely to want to
+	// do many more things to satisfy misunderstandings around HTTP.
+	req.Header.Set("Accept", "*/*")
+}
@@ -0,0 +1,89 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestCheckHeaders(t *testing.T) {
+	test.AssertNotError(t, CheckHeaders(nil), "No headers rejected")
+	test.AssertNotError(t, CheckHeaders(map[string]string{"X-Validation-Source": "ca.example"}), "Valid header rejected")
+	test.AssertError(t, CheckHeaders(map[string]string{"user-agent": "other"}), "User-Agent accepted")
+	test.AssertError(t, CheckHeaders(map[string]string{"Host": "example.com"}), "Host accepted")
+	test.AssertError(t, CheckHeaders(map[string]string{"X Space": "a"}), "Malformed name accepted")
+	test.AssertError(t, CheckHeaders(map[string]string{"": "a"}), "Empty name accepted")
+	test.AssertError(t, CheckHeaders(map[string]string{"X-Split": "a\r\nHost: evil"}), "Header injection accepted")
+}
+
+func TestValidationRequestHeaders(t *testing.T) {
+	chall := core.HTTPChallenge01(accountKey)
+	err := setChallengeToken(&chall, core.NewToken())
+	test.AssertNotError(t, err, "Failed to complete HTTP challenge")
+	keyAuthz, _ := core.NewKeyAuthorization(chall.Token, accountKey)
+
+	// The server redirects once, so that the headers of both requests are
+	// seen
+	var mu sync.Mutex
+	var seen []http.Header
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, r.Header)
+		mu.Unlock()
+		if r.URL.Path != "/redirected" {
+			http.Redirect(w, r, "/redirected", 302)
+			return
+		}
+		fmt.Fprint(w, keyAuthz.String())
+	}))
+	defer hs.Close()
+	port, err := getPort(hs)
+	test.AssertNotError(t, err, "failed to get test server port")
+
+	stats, _ := statsd.NewNoopClient()
+	va := NewValidationAuthorityImpl(&PortConfig{HTTPPort: port}, nil, stats, clock.Default())
+	va.AddressPolicy = allowLoopback
+	va.DNSResolver = &mocks.DNSResolver{}
+	va.allowNonPublicRedirects = true
+	va.UserAgent = "test-ca"
+	va.Headers = map[string]string{"X-Validation-Source": "test-ca"}
+
+	_, prob := va.withAccount(42, "abc").validateHTTP01(ident, chall)
+	test.Assert(t, prob == nil, fmt.Sprintf("Validation failed: %s", prob))
+	test.AssertEquals(t, len(seen), 2)
+	for _, h := range seen {
+		test.AssertEquals(t, h.Get("User-Agent"), "test-ca")
+		test.AssertEquals(t, h.Get("X-Validation-Source"), "test-ca")
+		test.AssertEquals(t, h.Get("Accept"), "*/*")
+	}
+
+	seen = nil
+	va.UserAgentIdentifiers = true
+	_, prob = va.withAccount(42, "abc").validateHTTP01(ident, chall)
+	test.Assert(t, prob == nil, fmt.Sprintf("Validation failed: %s", prob))
+	test.AssertEquals(t, len(seen), 2)
+	for _, h := range seen {
+		test.AssertEquals(t, h.Get("User-Agent"), "test-ca (account 42; authorization abc)")
+	}
+
+	// Without an account, as when validating directly, the UserAgent is
+	// sent alone
+	seen = nil
+	_, prob = va.validateHTTP01(ident, chall)
+	test.Assert(t, prob == nil, fmt.Sprintf("Validation failed: %s", prob))
+	test.AssertEquals(t, seen[0].Get("User-Agent"), "test-ca")
+}
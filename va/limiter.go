@@ -0,0 +1,192 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+
+	"github.com/letsencrypt/boulder/probs"
+)
+
+// TargetLimit bounds the validation connections made to one target: at most
+// MaxConcurrent open at once, and on average Rate a second, in bursts of up
+// to Burst (default 1). Zero MaxConcurrent or Rate is unlimited.
+type TargetLimit struct {
+	MaxConcurrent int
+	Rate          float64
+	Burst         int
+}
+
+func (tl TargetLimit) burst() float64 {
+	if tl.Burst < 1 {
+		return 1
+	}
+	return float64(tl.Burst)
+}
+
+// TargetPolicy bounds the validation connections made to each hostname, and
+// to each IP address, so that a burst of authorizations for names at one
+// hosting provider can't be turned into a flood of connections to it. A
+// connection over a limit isn't made, and its validation fails with a
+// rateLimited problem, without being retried.
+type TargetPolicy struct {
+	PerHost TargetLimit
+	PerIP   TargetLimit
+}
+
+// targetState is the use of one target's limit.
+type targetState struct {
+	inFlight int
+	tokens   float64
+	updated  time.Time
+}
+
+// refill adds the tokens earned since the state was last updated.
+func (ts *targetState) refill(limit TargetLimit, now time.Time) {
+	if limit.Rate > 0 {
+		ts.tokens += now.Sub(ts.updated).Seconds() * limit.Rate
+		if ts.tokens > limit.burst() {
+			ts.tokens = limit.burst()
+		}
+	}
+	ts.updated = now
+}
+
+// idle reports whether the state is back where a new one would start, so
+// can be forgotten.
+func (ts *targetState) idle(limit TargetLimit) bool {
+	return ts.inFlight == 0 && (limit.Rate <= 0 || ts.tokens >= limit.burst())
+}
+
+// sweepInterval is how often the states of idle targets are forgotten.
+const sweepInterval = time.Minute
+
+// targetLimiter applies a TargetPolicy to the connections of every
+// validation, so it's shared by all copies of a VA. Its methods do nothing
+// on a nil limiter.
+type targetLimiter struct {
+	clk clock.Clock
+
+	mu        sync.Mutex
+	hosts     map[string]*targetState
+	ips       map[string]*targetState
+	lastSweep time.Time
+}
+
+func newTargetLimiter(clk clock.Clock) *targetLimiter {
+	return &targetLimiter{
+		clk:   clk,
+		hosts: make(map[string]*targetState),
+		ips:   make(map[string]*targetState),
+	}
+}
+
+func (tl *targetLimiter) state(states map[string]*targetState, key string, limit TargetLimit, now time.Time) *targetState {
+	ts, ok := states[key]
+	if !ok {
+		ts = &targetState{tokens: limit.burst(), updated: now}
+		states[key] = ts
+	}
+	ts.refill(limit, now)
+	return ts
+}
+
+func (tl *targetLimiter) sweep(policy TargetPolicy, now time.Time) {
+	for key, ts := range tl.hosts {
+		if ts.refill(policy.PerHost, now); ts.idle(policy.PerHost) {
+			delete(tl.hosts, key)
+		}
+	}
+	for key, ts := range tl.ips {
+		if ts.refill(policy.PerIP, now); ts.idle(policy.PerIP) {
+			delete(tl.ips, key)
+		}
+	}
+	tl.lastSweep = now
+}
+
+// overLimit returns the problem with connecting to target if it's over
+// limit.
+func overLimit(target string, ts *targetState, limit TargetLimit) *probs.ProblemDetails {
+	if limit.MaxConcurrent > 0 && ts.inFlight >= limit.MaxConcurrent {
+		return probs.RateLimited(fmt.Sprintf("Too many validation connections to %s at once; try again later", target))
+	}
+	if limit.Rate > 0 && ts.tokens < 1 {
+		return probs.RateLimited(fmt.Sprintf("Too many validation connections to %s recently; try again later", target))
+	}
+	return nil
+}
+
+// acquire counts a connection to host at ip against policy, returning a
+// function to call once it's closed, or the problem if it's over a limit.
+func (tl *targetLimiter) acquire(policy TargetPolicy, host string, ip net.IP) (func(), *probs.ProblemDetails) {
+	if tl == nil {
+		return func() {}, nil
+	}
+	host = strings.ToLower(host)
+	addr := ip.String()
+
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	now := tl.clk.Now()
+	if now.Sub(tl.lastSweep) >= sweepInterval {
+		tl.sweep(policy, now)
+	}
+	hs := tl.state(tl.hosts, host, policy.PerHost, now)
+	is := tl.state(tl.ips, addr, policy.PerIP, now)
+	if prob := overLimit(host, hs, policy.PerHost); prob != nil {
+		return nil, prob
+	}
+	if prob := overLimit(addr, is, policy.PerIP); prob != nil {
+		return nil, prob
+	}
+	for _, ts := range []*targetState{hs, is} {
+		ts.inFlight++
+		ts.tokens--
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			tl.mu.Lock()
+			defer tl.mu.Unlock()
+			// The states may have been swept while in use, so are
+			// released as held rather than looked up again
+			hs.inFlight--
+			is.inFlight--
+		})
+	}, nil
+}
+
+// limitedConn releases its target's limit when closed.
+type limitedConn struct {
+	net.Conn
+	release func()
+}
+
+func (lc *limitedConn) Close() error {
+	lc.release()
+	return lc.Conn.Close()
+}
+
+// limitProblem returns the problem a dial failed with if it was refused for
+// being over a target limit.
+func limitProblem(err error) *probs.ProblemDetails {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	if prob, ok := err.(*probs.ProblemDetails); ok && prob.Type == probs.RateLimitedProblem {
+		return prob
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/probs"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestTargetLimiterConcurrency(t *testing.T) {
+	tl := newTargetLimiter(clock.NewFake())
+	policy := TargetPolicy{PerHost: TargetLimit{MaxConcurrent: 2}}
+	ip := net.ParseIP("10.0.0.1")
+
+	release1, prob := tl.acquire(policy, "example.com", ip)
+	test.Assert(t, prob == nil, "First connection refused")
+	_, prob = tl.acquire(policy, "EXAMPLE.com", ip)
+	test.Assert(t, prob == nil, "Second connection refused")
+	_, prob = tl.acquire(policy, "example.com", ip)
+	test.Assert(t, prob != nil, "Third concurrent connection allowed")
+	test.AssertEquals(t, prob.Type, probs.RateLimitedProblem)
+
+	// Other hosts have limits of their own
+	_, prob = tl.acquire(policy, "example.net", ip)
+	test.Assert(t, prob == nil, "Connection to another host refused")
+
+	// Releasing twice frees only one connection
+	release1()
+	release1()
+	_, prob = tl.acquire(policy, "example.com", ip)
+	test.Assert(t, prob == nil, "Connection refused after release")
+	_, prob = tl.acquire(policy, "example.com", ip)
+	test.Assert(t, prob != nil, "Double release freed two connections")
+}
+
+func TestTargetLimiterRate(t *testing.T) {
+	fc := clock.NewFake()
+	tl := newTargetLimiter(fc)
+	policy := TargetPolicy{PerIP: TargetLimit{Rate: 1, Burst: 2}}
+	ip := net.ParseIP("10.0.0.1")
+
+	for i, host := range []string{"a.example.com", "b.example.com"} {
+		release, prob := tl.acquire(policy, host, ip)
+		test.Assert(t, prob == nil, "Connection within burst refused")
+		if i == 0 {
+			release()
+		}
+	}
+	// Released connections still count against the rate
+	_, prob := tl.acquire(policy, "c.example.com", ip)
+	test.Assert(t, prob != nil, "Connection over burst allowed")
+	test.AssertEquals(t, prob.Type, probs.RateLimitedProblem)
+
+	// Other addresses have limits of their own
+	_, prob = tl.acquire(policy, "c.example.com", net.ParseIP("10.0.0.2"))
+	test.Assert(t, prob == nil, "Connection to another address refused")
+
+	fc.Add(time.Second)
+	_, prob = tl.acquire(policy, "c.example.com", ip)
+	test.Assert(t, prob == nil, "Connection refused after refill")
+	_, prob = tl.acquire(policy, "c.example.com", ip)
+	test.Assert(t, prob != nil, "Refill exceeded the rate")
+}
+
+func TestTargetLimiterSweep(t *testing.T) {
+	fc := clock.NewFake()
+	tl := newTargetLimiter(fc)
+	policy := TargetPolicy{PerHost: TargetLimit{MaxConcurrent: 1, Rate: 1}}
+	ip := net.ParseIP("10.0.0.1")
+
+	release, prob := tl.acquire(policy, "busy.example.com", ip)
+	test.Assert(t, prob == nil, "Connection refused")
+	done, prob := tl.acquire(policy, "idle.example.com", net.ParseIP("10.0.0.2"))
+	test.Assert(t, prob == nil, "Connection refused")
+	done()
+
+	fc.Add(sweepInterval)
+	_, prob = tl.acquire(policy, "other.example.com", net.ParseIP("10.0.0.3"))
+	test.Assert(t, prob == nil, "Connection refused")
+	_, ok := tl.hosts["idle.example.com"]
+	test.Assert(t, !ok, "Idle host wasn't swept")
+	_, ok = tl.hosts["busy.example.com"]
+	test.Assert(t, ok, "Host in use was swept")
+
+	// A release after a sweep still frees the connection
+	release()
+	_, prob = tl.acquire(policy, "busy.example.com", ip)
+	test.Assert(t, prob == nil, "Connection refused after release")
+
+	var nilLimiter *targetLimiter
+	_, prob = nilLimiter.acquire(policy, "busy.example.com", ip)
+	test.Assert(t, prob == nil, "Nil limiter refused a connection")
+}
+
+func TestValidateHTTPTargetLimited(t *testing.T) {
+	chall := core.HTTPChallenge01(accountKey)
+	err := setChallengeToken(&chall, core.NewToken())
+	test.AssertNotError(t, err, "Failed to complete HTTP challenge")
+
+	hs := httpSrv(t, chall.Token)
+	defer hs.Close()
+	port, err := getPort(hs)
+	test.AssertNotError(t, err, "failed to get test server port")
+	stats, _ := statsd.NewNoopClient()
+	va := NewValidationAuthorityImpl(&PortConfig{HTTPPort: port}, nil, stats, clock.NewFake())
+	va.AddressPolicy = allowLoopback
+	va.DNSResolver = &mocks.DNSResolver{}
+	va.TargetPolicy = TargetPolicy{PerHost: TargetLimit{Rate: 1}}
+
+	_, prob := va.validateHTTP01(ident, chall)
+	test.Assert(t, prob == nil, "First validation failed")
+	_, prob = va.validateHTTP01(ident, chall)
+	test.Assert(t, prob != nil, "Validation over the rate limit passed")
+	test.AssertEquals(t, prob.Type, probs.RateLimitedProblem)
+	test.Assert(t, !prob.Transient, "Rate limited validation would be retried")
+}
@@ -0,0 +1,90 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/metrics"
+)
+
+// vaMetrics are the validation outcome metrics the VA exposes to
+// Prometheus, from which success rates can be tracked by challenge type, so
+// that a change breaking one kind of validation across many sites, such as
+// a CDN refusing http-01 requests, shows up without digging through logs.
+type vaMetrics struct {
+	registry *metrics.Registry
+	// Validations by challenge type, status, problem type, the IP version
+	// of the address connected to and whether redirects were followed
+	validations *metrics.CounterVec
+	latency     *metrics.HistogramVec
+	// Address lookups for the names validation connects to
+	resolutions *metrics.HistogramVec
+}
+
+func newVAMetrics() *vaMetrics {
+	r := metrics.NewRegistry()
+	return &vaMetrics{
+		registry: r,
+		validations: r.NewCounterVec("va_validations_total",
+			`Validations done, by challenge type, status, problem type ("none" if valid), IP version and whether redirects were followed.`,
+			"type", "status", "problem", "ip_version", "redirected"),
+		latency: r.NewHistogramVec("va_validation_duration_seconds",
+			"Time taken to validate challenges, by challenge type and status.",
+			metrics.DefaultLatencyBuckets, "type", "status"),
+		resolutions: r.NewHistogramVec("va_resolution_duration_seconds",
+			`Time taken to look up the addresses of validated names, by result ("ok" or "error").`,
+			metrics.DefaultLatencyBuckets, "result"),
+	}
+}
+
+// MetricsHandler serves the VA's validation metrics in the Prometheus text
+// format.
+func (va *ValidationAuthorityImpl) MetricsHandler() http.Handler {
+	return va.metrics.registry
+}
+
+// observeValidation records the outcome of validating challenge, which took
+// elapsed.
+func (m *vaMetrics) observeValidation(challenge core.Challenge, elapsed time.Duration) {
+	problem := "none"
+	if challenge.Error != nil {
+		problem = string(challenge.Error.Type)
+	}
+	ipVersion, redirected := connectionDimensions(challenge.ValidationRecord)
+	status := string(challenge.Status)
+	m.validations.Inc(challenge.Type, status, problem, ipVersion, redirected)
+	m.latency.Observe(elapsed.Seconds(), challenge.Type, status)
+}
+
+// connectionDimensions returns the IP version of the address last connected
+// to in records ("none" if none was), and whether the last attempt they
+// record followed redirects.
+func connectionDimensions(records []core.ValidationRecord) (ipVersion, redirected string) {
+	ipVersion, redirected = "none", "false"
+	if len(records) == 0 {
+		return
+	}
+	last := records[len(records)-1]
+	if last.AddressUsed != nil {
+		ipVersion = "ipv6"
+		if last.AddressUsed.To4() != nil {
+			ipVersion = "ipv4"
+		}
+	}
+	hops := 0
+	for _, record := range records {
+		if record.Attempt == last.Attempt && record.URL != "" {
+			hops++
+		}
+	}
+	if hops > 1 {
+		redirected = "true"
+	}
+	return
+}
@@ -0,0 +1,66 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/probs"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestConnectionDimensions(t *testing.T) {
+	v4, v6 := net.ParseIP("10.0.0.1"), net.ParseIP("::1")
+	testCases := []struct {
+		records    []core.ValidationRecord
+		ipVersion  string
+		redirected string
+	}{
+		{nil, "none", "false"},
+		{[]core.ValidationRecord{{Hostname: "example.com"}}, "none", "false"},
+		{[]core.ValidationRecord{{URL: "http://example.com/", AddressUsed: v4}}, "ipv4", "false"},
+		{[]core.ValidationRecord{
+			{URL: "http://example.com/", AddressUsed: v4},
+			{URL: "https://www.example.com/", AddressUsed: v6},
+		}, "ipv6", "true"},
+		// Attempts that were retried aren't redirects
+		{[]core.ValidationRecord{
+			{URL: "http://example.com/", AddressUsed: v4, Attempt: 1},
+			{URL: "http://example.com/", AddressUsed: v4, Attempt: 2},
+		}, "ipv4", "false"},
+	}
+	for _, tc := range testCases {
+		ipVersion, redirected := connectionDimensions(tc.records)
+		test.AssertEquals(t, ipVersion, tc.ipVersion)
+		test.AssertEquals(t, redirected, tc.redirected)
+	}
+}
+
+func TestObserveValidation(t *testing.T) {
+	m := newVAMetrics()
+	m.observeValidation(core.Challenge{
+		Type:   core.ChallengeTypeHTTP01,
+		Status: core.StatusInvalid,
+		Error:  probs.Unauthorized("wrong key authorization"),
+		ValidationRecord: []core.ValidationRecord{
+			{URL: "http://example.com/", AddressUsed: net.ParseIP("::1")},
+		},
+	}, time.Second)
+	m.observeValidation(core.Challenge{Type: core.ChallengeTypeDNS01, Status: core.StatusValid}, time.Second)
+
+	test.AssertEquals(t, m.validations.Value(core.ChallengeTypeHTTP01, "invalid", string(probs.UnauthorizedProblem), "ipv6", "false"), float64(1))
+	test.AssertEquals(t, m.validations.Value(core.ChallengeTypeDNS01, "valid", "none", "none", "false"), float64(1))
+	test.AssertEquals(t, m.latency.Count(core.ChallengeTypeDNS01, "valid"), uint64(1))
+
+	recorder := httptest.NewRecorder()
+	m.registry.ServeHTTP(recorder, nil)
+	test.Assert(t, strings.Contains(recorder.Body.String(), "va_validations_total"), "Validation counter not served")
+}
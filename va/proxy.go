@@ -0,0 +1,98 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// ProxyPolicy sends http-01 validation requests, and those made to follow
+// their redirects, through a forward proxy, for deployments where the VA
+// may not connect out directly. URL is the proxy's, such as
+// "http://proxy.internal:3128"; empty means connecting directly. Requests
+// for names in NoProxy, exactly or, for entries starting with a dot, as
+// subdomains, or to addresses in NoProxy's CIDR ranges, are made directly.
+//
+// The VA still resolves each name and applies its AddressPolicy and
+// TargetPolicy before a proxied request, but the proxy resolves the name
+// again and makes the connection itself, so it should enforce an
+// equivalent address policy of its own.
+type ProxyPolicy struct {
+	URL     string
+	NoProxy []string
+}
+
+// proxyURL returns the policy's proxy, or nil if there is none.
+func (pp ProxyPolicy) proxyURL() (*url.URL, error) {
+	if pp.URL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(pp.URL)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid proxy URL %q: %s", pp.URL, err)
+	}
+	if u.Scheme != "http" || u.Host == "" {
+		return nil, fmt.Errorf("Invalid proxy URL %q: must be http://host[:port]", pp.URL)
+	}
+	return u, nil
+}
+
+// Check returns an error if the policy's URL or any of its NoProxy ranges
+// is malformed.
+func (pp ProxyPolicy) Check() error {
+	if _, err := pp.proxyURL(); err != nil {
+		return err
+	}
+	for _, entry := range pp.NoProxy {
+		if strings.Contains(entry, "/") {
+			if _, _, err := net.ParseCIDR(entry); err != nil {
+				return fmt.Errorf("Invalid address range %q: %s", entry, err)
+			}
+		}
+	}
+	return nil
+}
+
+// bypassed returns whether requests for host at addr are made directly.
+func (pp ProxyPolicy) bypassed(host string, addr net.IP) bool {
+	host = strings.ToLower(host)
+	for _, entry := range pp.NoProxy {
+		entry = strings.ToLower(entry)
+		if strings.Contains(entry, "/") {
+			if _, n, err := net.ParseCIDR(entry); err == nil && addr != nil && n.Contains(addr) {
+				return true
+			}
+		} else if strings.HasPrefix(entry, ".") {
+			if strings.HasSuffix(host, entry) {
+				return true
+			}
+		} else if host == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyFor returns the proxy that requests for host at addr go through, or
+// nil if they're made directly.
+func (pp ProxyPolicy) proxyFor(host string, addr net.IP) (*url.URL, error) {
+	u, err := pp.proxyURL()
+	if err != nil || u == nil || pp.bypassed(host, addr) {
+		return nil, err
+	}
+	return u, nil
+}
+
+// proxyHostPort returns the address to dial to reach proxy u.
+func proxyHostPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
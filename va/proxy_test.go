@@ -0,0 +1,105 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestProxyPolicy(t *testing.T) {
+	test.AssertNotError(t, ProxyPolicy{}.Check(), "Empty policy rejected")
+	test.AssertNotError(t, ProxyPolicy{
+		URL:     "http://proxy.internal:3128",
+		NoProxy: []string{"internal.example.com", ".corp.example.com", "10.0.0.0/8"},
+	}.Check(), "Valid policy rejected")
+	test.AssertError(t, ProxyPolicy{URL: "socks5://proxy.internal"}.Check(), "Non-HTTP proxy accepted")
+	test.AssertError(t, ProxyPolicy{URL: "proxy.internal:3128"}.Check(), "Proxy URL without a scheme accepted")
+	test.AssertError(t, ProxyPolicy{URL: "http://proxy.internal", NoProxy: []string{"10.0.0.0/33"}}.Check(), "Malformed range accepted")
+
+	pp := ProxyPolicy{
+		URL:     "http://proxy.internal",
+		NoProxy: []string{"internal.example.com", ".corp.example.com", "10.0.0.0/8"},
+	}
+	public := net.ParseIP("1.2.3.4")
+	for _, tc := range []struct {
+		host    string
+		addr    net.IP
+		proxied bool
+	}{
+		{"example.com", public, true},
+		{"internal.example.com", public, false},
+		{"INTERNAL.example.com", public, false},
+		{"www.internal.example.com", public, true},
+		{"www.corp.example.com", public, false},
+		{"corp.example.com", public, true},
+		{"example.com", net.ParseIP("10.1.2.3"), false},
+	} {
+		proxy, err := pp.proxyFor(tc.host, tc.addr)
+		test.AssertNotError(t, err, "Failed to choose a proxy")
+		test.AssertEquals(t, proxy != nil, tc.proxied)
+	}
+
+	proxy, err := pp.proxyFor("example.com", public)
+	test.AssertNotError(t, err, "Failed to choose a proxy")
+	test.AssertEquals(t, proxyHostPort(proxy), "proxy.internal:80")
+	proxy, err = ProxyPolicy{}.proxyFor("example.com", public)
+	test.AssertNotError(t, err, "Failed to choose no proxy")
+	test.Assert(t, proxy == nil, "Proxied without a proxy URL")
+}
+
+func TestValidateHTTPProxy(t *testing.T) {
+	chall := core.HTTPChallenge01(accountKey)
+	err := setChallengeToken(&chall, core.NewToken())
+	test.AssertNotError(t, err, "Failed to complete HTTP challenge")
+
+	hs := httpSrv(t, chall.Token)
+	defer hs.Close()
+	port, err := getPort(hs)
+	test.AssertNotError(t, err, "failed to get test server port")
+
+	// The proxy answers for the target itself, recording what it was asked
+	var mu sync.Mutex
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		proxied = append(proxied, r.URL.String())
+		mu.Unlock()
+		keyAuthz, _ := core.NewKeyAuthorization(chall.Token, accountKey)
+		fmt.Fprint(w, keyAuthz.String())
+	}))
+	defer proxy.Close()
+
+	stats, _ := statsd.NewNoopClient()
+	va := NewValidationAuthorityImpl(&PortConfig{HTTPPort: port}, nil, stats, clock.Default())
+	va.AddressPolicy = allowLoopback
+	va.DNSResolver = &mocks.DNSResolver{}
+	va.Proxy = ProxyPolicy{URL: proxy.URL}
+
+	_, prob := va.validateHTTP01(ident, chall)
+	test.Assert(t, prob == nil, fmt.Sprintf("Proxied validation failed: %s", prob))
+	test.AssertEquals(t, len(proxied), 1)
+	test.AssertEquals(t, proxied[0], fmt.Sprintf("http://localhost:%d/.well-known/acme-challenge/%s", port, chall.Token))
+
+	// Exceptions connect directly
+	for _, noProxy := range []string{"localhost", "127.0.0.0/8"} {
+		va.Proxy.NoProxy = []string{noProxy}
+		_, prob = va.validateHTTP01(ident, chall)
+		test.Assert(t, prob == nil, fmt.Sprintf("Direct validation failed: %s", prob))
+		test.AssertEquals(t, len(proxied), 1)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/identifier"
+	"github.com/letsencrypt/boulder/probs"
+)
+
+// RetryPolicy lets a validation that fails with a transient network error,
+// such as a refused connection, a timeout or a SERVFAIL, be attempted again
+// so that one dropped packet doesn't fail the challenge. Up to MaxAttempts
+// attempts are made, the wait before each retry starting at Backoff and
+// doubling up to MaxBackoff, with jitter. Zero MaxAttempts means a single
+// attempt.
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+}
+
+func (rp RetryPolicy) maxAttempts() int {
+	if rp.MaxAttempts < 1 {
+		return 1
+	}
+	return rp.MaxAttempts
+}
+
+// backoff returns how long to wait before retrying after the given failed
+// attempt: a random duration between half and all of Backoff doubled for
+// each earlier retry, capped at MaxBackoff.
+func (rp RetryPolicy) backoff(attempt int) time.Duration {
+	wait := rp.Backoff
+	for i := 1; i < attempt && (rp.MaxBackoff <= 0 || wait < rp.MaxBackoff); i++ {
+		wait *= 2
+	}
+	if rp.MaxBackoff > 0 && wait > rp.MaxBackoff {
+		wait = rp.MaxBackoff
+	}
+	if wait <= 1 {
+		return wait
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)))
+}
+
+// isTransientConnError reports whether err, from connecting to the host
+// being validated, is a failure of the network, such as a refused connection
+// or a timeout, rather than of what the host answered.
+func isTransientConnError(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	_, ok := err.(net.Error)
+	return ok && parseHTTPConnError(err) == probs.ConnectionProblem
+}
+
+// validateChallengeWithRetries validates challenge, retrying transient
+// failures as the RetryPolicy allows, though not once ctx's deadline would
+// pass during the wait. When there is more than one attempt, the records of
+// each are returned, numbered, with the problem that ended each failed one.
+func (va *ValidationAuthorityImpl) validateChallengeWithRetries(ctx context.Context, identifier identifier.ACMEIdentifier, challenge core.Challenge) ([]core.ValidationRecord, *probs.ProblemDetails) {
+	var records []core.ValidationRecord
+	maxAttempts := va.RetryPolicy.maxAttempts()
+	for attempt := 1; ; attempt++ {
+		attemptRecords, prob := va.validateChallenge(identifier, challenge)
+		if attempt == 1 && (prob == nil || !prob.Transient || maxAttempts == 1) {
+			return attemptRecords, prob
+		}
+
+		if len(attemptRecords) == 0 && prob != nil {
+			// Record the attempt even if it failed before reaching the host
+			attemptRecords = []core.ValidationRecord{{Hostname: identifier.Value}}
+		}
+		for i := range attemptRecords {
+			attemptRecords[i].Attempt = attempt
+			attemptRecords[i].Error = prob
+		}
+		records = append(records, attemptRecords...)
+
+		if prob == nil || !prob.Transient || attempt >= maxAttempts {
+			return records, prob
+		}
+		wait := va.RetryPolicy.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && va.clk.Now().Add(wait).After(deadline) {
+			return records, prob
+		}
+		va.log.Info(fmt.Sprintf("%s [%s] attempt %d failed, retrying in %s: %s", challenge.Type, identifier, attempt, wait, prob))
+		va.stats.Inc(fmt.Sprintf("VA.Validations.Retries.%s", challenge.Type), 1, 1.0)
+		va.clk.Sleep(wait)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/probs"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// flakyDNSResolver times out the first failures lookups of a host.
+type flakyDNSResolver struct {
+	mocks.DNSResolver
+	failures int
+}
+
+func (r *flakyDNSResolver) LookupHost(hostname string) ([]net.IP, error) {
+	if r.failures > 0 {
+		r.failures--
+		return nil, mocks.TimeoutError()
+	}
+	return r.DNSResolver.LookupHost(hostname)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	rp := RetryPolicy{Backoff: time.Second, MaxBackoff: 3 * time.Second}
+	for attempt, max := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		for i := 0; i < 20; i++ {
+			wait := rp.backoff(attempt + 1)
+			test.Assert(t, wait >= max/2 && wait < max, "Backoff out of range")
+		}
+	}
+	test.AssertEquals(t, RetryPolicy{}.maxAttempts(), 1)
+}
+
+func TestIsTransientConnError(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	test.Assert(t, isTransientConnError(&url.Error{Op: "Get", URL: "http://example.com", Err: refused}), "Refused connection isn't transient")
+	test.Assert(t, isTransientConnError(mocks.TimeoutError()), "Timeout isn't transient")
+
+	unknownHost := &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "example.com"}}
+	test.Assert(t, !isTransientConnError(unknownHost), "Unknown host is transient")
+	test.Assert(t, !isTransientConnError(errors.New("tls: oversized record received")), "Handshake failure is transient")
+}
+
+func TestValidationRetries(t *testing.T) {
+	chall := core.HTTPChallenge01(accountKey)
+	err := setChallengeToken(&chall, core.NewToken())
+	test.AssertNotError(t, err, "Failed to complete HTTP challenge")
+
+	hs := httpSrv(t, chall.Token)
+	defer hs.Close()
+	port, err := getPort(hs)
+	test.AssertNotError(t, err, "failed to get test server port")
+	stats, _ := statsd.NewNoopClient()
+	fc := clock.NewFake()
+	va := NewValidationAuthorityImpl(&PortConfig{HTTPPort: port}, nil, stats, fc)
+	va.AddressPolicy = allowLoopback
+	va.RetryPolicy = RetryPolicy{MaxAttempts: 3, Backoff: time.Second}
+	resolver := &flakyDNSResolver{failures: 2}
+	va.DNSResolver = resolver
+	mockRA := &MockRegistrationAuthority{}
+	va.RA = mockRA
+
+	// Two timeouts are retried, and the third attempt succeeds
+	authz := core.Authorization{
+		ID:             core.NewToken(),
+		RegistrationID: 1,
+		Identifier:     ident,
+		Challenges:     []core.Challenge{chall},
+	}
+	start := fc.Now()
+	va.validate(ctx, authz, 0)
+	result := mockRA.lastAuthz.Challenges[0]
+	test.AssertEquals(t, result.Status, core.StatusValid)
+	records := result.ValidationRecord
+	test.AssertEquals(t, len(records), 3)
+	for i, record := range records {
+		test.AssertEquals(t, record.Attempt, i+1)
+	}
+	test.AssertEquals(t, records[0].Error.Type, probs.ConnectionProblem)
+	test.AssertEquals(t, records[1].Error.Type, probs.ConnectionProblem)
+	test.Assert(t, records[2].Error == nil, "Successful attempt has an error")
+	test.Assert(t, fc.Now().Sub(start) >= time.Second, "Didn't back off between attempts")
+
+	// Running out of attempts fails the challenge
+	resolver.failures = 3
+	authz.Challenges = []core.Challenge{chall}
+	va.validate(ctx, authz, 0)
+	result = mockRA.lastAuthz.Challenges[0]
+	test.AssertEquals(t, result.Status, core.StatusInvalid)
+	test.AssertEquals(t, result.Error.Type, probs.ConnectionProblem)
+	test.AssertEquals(t, len(result.ValidationRecord), 3)
+	test.AssertEquals(t, result.ValidationRecord[2].Attempt, 3)
+
+	// Failures that aren't transient aren't retried
+	resolver.failures = 0
+	token := core.NewToken()
+	setChallengeToken(&chall, token[:len(token)-len(path404)]+path404)
+	authz.Challenges = []core.Challenge{chall}
+	va.validate(ctx, authz, 0)
+	result = mockRA.lastAuthz.Challenges[0]
+	test.AssertEquals(t, result.Status, core.StatusInvalid)
+	test.AssertEquals(t, result.Error.Type, probs.UnauthorizedProblem)
+	test.AssertEquals(t, len(result.ValidationRecord), 1)
+	test.AssertEquals(t, result.ValidationRecord[0].Attempt, 0)
+
+	// Nor are retries whose backoff would outlast the deadline by the VA's
+	// clock. With the deadline 1.4s away, the first retry's wait of under a
+	// second fits, but after it the second's wait of at least one more
+	// doesn't.
+	fc = clock.NewFake()
+	va.clk = fc
+	resolver.failures = 2
+	setChallengeToken(&chall, core.NewToken())
+	start = fc.Now()
+	deadlineCtx, cancel := context.WithDeadline(context.Background(), start.Add(1400*time.Millisecond))
+	defer cancel()
+	records, prob := va.validateChallengeWithRetries(deadlineCtx, ident, chall)
+	test.AssertNotNil(t, prob, "Validation retried past its deadline")
+	test.AssertEquals(t, prob.Type, probs.ConnectionProblem)
+	test.AssertEquals(t, len(records), 2)
+	test.AssertEquals(t, records[1].Attempt, 2)
+	waited := fc.Now().Sub(start)
+	test.Assert(t, waited >= 500*time.Millisecond && waited < time.Second, "Didn't wait only for the first retry")
+	test.AssertEquals(t, resolver.failures, 0)
+}
@@ -0,0 +1,191 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
+
+	"github.com/letsencrypt/boulder/bdns"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/identifier"
+)
+
+// transcriptRecorder collects the DNS queries made and content fetched while
+// validating one challenge. Its methods do nothing on a nil recorder, so
+// that validation code can record unconditionally.
+type transcriptRecorder struct {
+	clk clock.Clock
+
+	mu      sync.Mutex
+	queries []core.TranscriptQuery
+	fetches []core.TranscriptFetch
+}
+
+func (r *transcriptRecorder) query(name, qtype string, answers []string, err error) {
+	if r == nil {
+		return
+	}
+	q := core.TranscriptQuery{
+		Name:    name,
+		Type:    qtype,
+		Time:    r.clk.Now(),
+		Answers: answers,
+	}
+	if err != nil {
+		q.Error = err.Error()
+	}
+	r.mu.Lock()
+	r.queries = append(r.queries, q)
+	r.mu.Unlock()
+}
+
+func (r *transcriptRecorder) fetched(source string, body []byte) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.fetches = append(r.fetches, core.TranscriptFetch{
+		Source: source,
+		Time:   r.clk.Now(),
+		Body:   body,
+	})
+	r.mu.Unlock()
+}
+
+// recordingResolver records the lookups made through it, and their answers.
+type recordingResolver struct {
+	resolver bdns.DNSResolver
+	rec      *transcriptRecorder
+}
+
+func (r *recordingResolver) LookupTXT(hostname string) ([]string, error) {
+	txts, err := r.resolver.LookupTXT(hostname)
+	r.rec.query(hostname, "TXT", txts, err)
+	return txts, err
+}
+
+func (r *recordingResolver) LookupHost(hostname string) ([]net.IP, error) {
+	addrs, err := r.resolver.LookupHost(hostname)
+	answers := make([]string, len(addrs))
+	for i, addr := range addrs {
+		answers[i] = addr.String()
+	}
+	r.rec.query(hostname, "A", answers, err)
+	return addrs, err
+}
+
+func (r *recordingResolver) LookupCAA(hostname string) ([]*dns.CAA, error) {
+	caas, err := r.resolver.LookupCAA(hostname)
+	answers := make([]string, len(caas))
+	for i, caa := range caas {
+		answers[i] = caa.String()
+	}
+	r.rec.query(hostname, "CAA", answers, err)
+	return caas, err
+}
+
+func (r *recordingResolver) LookupMX(hostname string) ([]string, error) {
+	mxs, err := r.resolver.LookupMX(hostname)
+	r.rec.query(hostname, "MX", mxs, err)
+	return mxs, err
+}
+
+// withTranscript returns a copy of va that records the evidence of the
+// validation it's used for.
+func (va *ValidationAuthorityImpl) withTranscript() *ValidationAuthorityImpl {
+	recorded := *va
+	recorded.transcript = &transcriptRecorder{clk: va.clk}
+	recorded.DNSResolver = &recordingResolver{resolver: va.DNSResolver, rec: recorded.transcript}
+	return &recorded
+}
+
+// newTranscript returns the transcript of a validation of challenge by a VA
+// made with withTranscript.
+func (va *ValidationAuthorityImpl) newTranscript(identifier identifier.ACMEIdentifier, challenge core.Challenge, regID int64, started time.Time) *core.ValidationTranscript {
+	t := &core.ValidationTranscript{
+		RegistrationID: regID,
+		Identifier:     identifier,
+		ChallengeType:  challenge.Type,
+		Perspective:    va.Perspective,
+		Started:        started,
+		Finished:       va.clk.Now(),
+		Records:        challenge.ValidationRecord,
+	}
+	if va.transcript != nil {
+		va.transcript.mu.Lock()
+		t.Queries = append(t.Queries, va.transcript.queries...)
+		t.Fetches = append(t.Fetches, va.transcript.fetches...)
+		va.transcript.mu.Unlock()
+	}
+	return t
+}
+
+// signTranscript returns t as a compact JWS signed with key.
+func signTranscript(key crypto.Signer, t *core.ValidationTranscript) ([]byte, error) {
+	alg, err := core.SigningAlgorithm(key)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: alg, Key: key}, &jose.SignerOptions{EmbedJWK: true})
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		return nil, err
+	}
+	compact, err := jws.CompactSerialize()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(compact), nil
+}
+
+// VerifyTranscript checks that signed is a transcript signed by key, the
+// public half of a VA's TranscriptKey, and returns it.
+func VerifyTranscript(signed []byte, key crypto.PublicKey) (core.ValidationTranscript, error) {
+	var t core.ValidationTranscript
+	jws, err := jose.ParseSigned(string(signed))
+	if err != nil {
+		return t, err
+	}
+	payload, err := jws.Verify(key)
+	if err != nil {
+		return t, err
+	}
+	err = json.Unmarshal(payload, &t)
+	return t, err
+}
+
+// recordTranscript signs and stores the transcript of the successful
+// validation of challenge, one of authz's, begun at started and agreed with
+// by remote. It does nothing unless the VA has an SA and a TranscriptKey.
+func (va *ValidationAuthorityImpl) recordTranscript(ctx context.Context, authz core.Authorization, challenge core.Challenge, started time.Time, remote []core.ValidationTranscript) error {
+	if va.SA == nil || va.TranscriptKey == nil {
+		return nil
+	}
+	t := va.newTranscript(authz.Identifier, challenge, authz.RegistrationID, started)
+	t.AuthorizationID = authz.ID
+	t.Remote = remote
+	signed, err := signTranscript(va.TranscriptKey, t)
+	if err != nil {
+		return err
+	}
+	return va.SA.AddValidationTranscript(ctx, authz.ID, challenge.Type, signed)
+}
@@ -0,0 +1,122 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/identifier"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// transcriptSA keeps the transcripts it's given, or fails with err.
+type transcriptSA struct {
+	mocks.StorageAuthority
+	err error
+
+	mu          sync.Mutex
+	authzIDs    []string
+	transcripts [][]byte
+}
+
+func (sa *transcriptSA) AddValidationTranscript(_ context.Context, authzID, _ string, signed []byte) error {
+	if sa.err != nil {
+		return sa.err
+	}
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	sa.authzIDs = append(sa.authzIDs, authzID)
+	sa.transcripts = append(sa.transcripts, signed)
+	return nil
+}
+
+func TestValidationTranscript(t *testing.T) {
+	chall := core.HTTPChallenge01(accountKey)
+	err := setChallengeToken(&chall, core.NewToken())
+	test.AssertNotError(t, err, "Failed to complete HTTP challenge")
+
+	hs := httpSrv(t, chall.Token)
+	defer hs.Close()
+	port, err := getPort(hs)
+	test.AssertNotError(t, err, "failed to get test server port")
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	stats, _ := statsd.NewNoopClient()
+	va := NewValidationAuthorityImpl(&PortConfig{HTTPPort: port}, nil, stats, clock.Default())
+	va.AddressPolicy = allowLoopback
+	va.DNSResolver = &mocks.DNSResolver{}
+	mockRA := &MockRegistrationAuthority{}
+	va.RA = mockRA
+	sa := &transcriptSA{}
+	va.SA = sa
+	va.TranscriptKey = key
+	va.Perspective = "primary"
+	va.RemoteVAs = []core.RemoteValidator{
+		mockRemoteVA{transcript: &core.ValidationTranscript{Perspective: "remote"}},
+	}
+
+	authz := core.Authorization{
+		ID:             core.NewToken(),
+		RegistrationID: 1,
+		Identifier:     identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: "localhost"},
+		Challenges:     []core.Challenge{chall},
+	}
+	va.validate(ctx, authz, 0)
+	test.AssertEquals(t, mockRA.lastAuthz.Challenges[0].Status, core.StatusValid)
+	test.AssertEquals(t, len(sa.transcripts), 1)
+	test.AssertEquals(t, sa.authzIDs[0], authz.ID)
+
+	transcript, err := VerifyTranscript(sa.transcripts[0], &key.PublicKey)
+	test.AssertNotError(t, err, "Failed to verify transcript")
+	test.AssertEquals(t, transcript.AuthorizationID, authz.ID)
+	test.AssertEquals(t, transcript.ChallengeType, core.ChallengeTypeHTTP01)
+	test.AssertEquals(t, transcript.Perspective, "primary")
+	test.Assert(t, len(transcript.Queries) > 0, "No queries recorded")
+	test.AssertEquals(t, transcript.Queries[0].Name, "localhost")
+	test.AssertEquals(t, len(transcript.Fetches), 1)
+	test.AssertEquals(t, transcript.Fetches[0].Source, transcript.Records[0].URL)
+	test.AssertEquals(t, strings.TrimRight(string(transcript.Fetches[0].Body), whitespaceCutset), chall.KeyAuthorization.String())
+	test.AssertEquals(t, len(transcript.Remote), 1)
+	test.AssertEquals(t, transcript.Remote[0].Perspective, "remote")
+
+	// Transcripts only verify with the VA's key
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	_, err = VerifyTranscript(sa.transcripts[0], &other.PublicKey)
+	test.AssertError(t, err, "Verified transcript with the wrong key")
+
+	// A validation whose transcript can't be stored fails
+	va.SA = &transcriptSA{err: errors.New("database on fire")}
+	authz.Challenges = []core.Challenge{chall}
+	va.validate(ctx, authz, 0)
+	result := mockRA.lastAuthz.Challenges[0]
+	test.AssertEquals(t, result.Status, core.StatusInvalid)
+	test.AssertEquals(t, result.Error.Detail, "Couldn't record validation transcript")
+
+	// Remote VAs return their transcripts to the primary
+	resp, err := va.PerformValidation(ctx, &core.PerformValidationRequest{
+		Identifier:     authz.Identifier,
+		Challenge:      chall,
+		RegistrationID: 1,
+	})
+	test.AssertNotError(t, err, "PerformValidation failed")
+	test.Assert(t, resp.Problem == nil, "Remote validation failed")
+	test.AssertNotNil(t, resp.Transcript, "No transcript returned")
+	test.AssertEquals(t, len(resp.Transcript.Fetches), 1)
+}
@@ -6,8 +6,9 @@
 package va
 
 import (
+	"context"
+	"crypto"
 	"crypto/sha256"
-	"crypto/subtle"
 	"crypto/tls"
 	"encoding/hex"
 	"fmt"
@@ -17,24 +18,60 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/net/publicsuffix"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/miekg/dns"
+	"github.com/letsencrypt/boulder/identifier"
 	"github.com/letsencrypt/boulder/probs"
 
 	"github.com/letsencrypt/boulder/bdns"
 	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
+	bmail "github.com/letsencrypt/boulder/mail"
 )
 
-const maxRedirect = 10
 const whitespaceCutset = "\n\t "
 
 var validationTimeout = time.Second * 5
 
+// RedirectPolicy bounds the redirects the VA will follow when fetching an
+// HTTP validation response. Zero values take the defaults: 10 redirects,
+// ports 80 and 443, and the http and https schemes. The ports the VA is
+// configured to validate on are always allowed. Redirects to IP literals or
+// to names that aren't under a public suffix are always refused.
+type RedirectPolicy struct {
+	MaxRedirects int
+	Ports        []int
+	Schemes      []string
+}
+
+func (rp RedirectPolicy) maxRedirects() int {
+	if rp.MaxRedirects <= 0 {
+		return 10
+	}
+	return rp.MaxRedirects
+}
+
+func (rp RedirectPolicy) ports() []int {
+	if len(rp.Ports) == 0 {
+		return []int{80, 443}
+	}
+	return rp.Ports
+}
+
+func (rp RedirectPolicy) schemes() []string {
+	if len(rp.Schemes) == 0 {
+		return []string{"http", "https"}
+	}
+	return rp.Schemes
+}
+
 // ValidationAuthorityImpl represents a VA
 type ValidationAuthorityImpl struct {
 	RA           core.RegistrationAuthority
@@ -47,7 +84,87 @@ type ValidationAuthorityImpl struct {
 	tlsPort      int
 	UserAgent    string
 	stats        statsd.Statter
+	metrics      *vaMetrics
 	clk          clock.Clock
+
+	// AccountURIPrefix, followed by a registration ID, is the account URI
+	// that CAA accounturi parameters name
+	AccountURIPrefix string
+
+	// RemoteVAs repeat each validation from other network perspectives, so
+	// that a BGP hijack or DNS poisoning local to this VA's network can't
+	// pass validation on its own. At least RemoteQuorum of them must
+	// succeed; zero means all of them.
+	RemoteVAs    []core.RemoteValidator
+	RemoteQuorum int
+
+	// RedirectPolicy bounds the redirects followed during HTTP validation
+	RedirectPolicy RedirectPolicy
+
+	// AddressPolicy bounds the addresses that validation connects to
+	AddressPolicy AddressPolicy
+
+	// Source pins validation connections to local source addresses
+	Source bdns.Source
+
+	// RetryPolicy retries validations that fail with transient network
+	// errors
+	RetryPolicy RetryPolicy
+
+	// Challenges configures the probes of each challenge type, keyed by
+	// type; see ChallengeConfig for the defaults
+	Challenges map[string]ChallengeConfig
+
+	// Deadline bounds each validation as a whole: the challenge probe, with
+	// its retries, the CAA check and any remote validations, which all run
+	// concurrently. A validation not done by then fails. Zero means no bound.
+	Deadline time.Duration
+
+	// MailboxTokens derives the half of each email-reply-00 token that the
+	// RA mailed, so that responses can be checked. It must be set if the PA
+	// allows email identifiers.
+	MailboxTokens *bmail.MailboxTokens
+
+	// SA stores a transcript of each successful validation, signed with
+	// TranscriptKey, recording the queries made and content fetched from
+	// this VA's Perspective and those of the remote VAs that agreed. If
+	// either is unset, no transcripts are kept; if they're set, a validation
+	// whose transcript can't be stored fails. TranscriptKey also signs the
+	// audit log's evidence of each request validation makes; see
+	// RequestEvidence.
+	SA            core.StorageAdder
+	TranscriptKey crypto.Signer
+	Perspective   string
+
+	// Proxy sends http-01 validation requests through a forward proxy
+	Proxy ProxyPolicy
+
+	// TargetPolicy bounds the connections made to each validated hostname
+	// and address
+	TargetPolicy TargetPolicy
+	targets      *targetLimiter
+
+	// UserAgentIdentifiers follows the UserAgent of HTTP validation
+	// requests with the account and authorization being validated, so that
+	// site operators can tie requests to them.
+	UserAgentIdentifiers bool
+
+	// Headers are sent with every HTTP validation request, such as a token
+	// that site operators can allowlist; see CheckHeaders
+	Headers map[string]string
+
+	// regID and authzID are of the validation this copy of the VA is used
+	// for; see withAccount
+	regID   int64
+	authzID string
+
+	// transcript records the validation this copy of the VA is used for;
+	// see withTranscript
+	transcript *transcriptRecorder
+
+	// allowNonPublicRedirects lets redirects go to names without a public
+	// suffix, such as localhost. It should *only* be set by tests.
+	allowNonPublicRedirects bool
 }
 
 // PortConfig specifies what ports the VA should call to on the remote
@@ -58,6 +175,48 @@ type PortConfig struct {
 	TLSPort   int
 }
 
+// ChallengeConfig configures the probes of one challenge type. Zero values
+// take the defaults: the port from the VA's PortConfig and 5 seconds for
+// both timeouts.
+type ChallengeConfig struct {
+	// Port is the port probes connect to on the validated host. dns-01 and
+	// dns-account-01 probes go to the VA's resolvers instead, so have no
+	// port.
+	Port int
+	// Timeout bounds each probe as a whole, each retry being a new probe.
+	Timeout time.Duration
+	// ConnectTimeout bounds establishing each of a probe's connections.
+	// dns-01 probes make none of their own.
+	ConnectTimeout time.Duration
+}
+
+// challengeConfig returns the effective configuration of the probes of
+// challengeType, which is empty for types that aren't probed over the
+// network.
+func (va *ValidationAuthorityImpl) challengeConfig(challengeType string) ChallengeConfig {
+	v, ok := ValidatorFor(challengeType)
+	if !ok || !v.Configurable() {
+		return ChallengeConfig{}
+	}
+	defaultPort := v.DefaultPort(va)
+
+	cfg := va.Challenges[challengeType]
+	if defaultPort == 0 {
+		cfg.Port, cfg.ConnectTimeout = 0, 0
+	} else {
+		if cfg.Port == 0 {
+			cfg.Port = defaultPort
+		}
+		if cfg.ConnectTimeout <= 0 {
+			cfg.ConnectTimeout = validationTimeout
+		}
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = validationTimeout
+	}
+	return cfg
+}
+
 // NewValidationAuthorityImpl constructs a new VA
 func NewValidationAuthorityImpl(pc *PortConfig, sbc SafeBrowsing, stats statsd.Statter, clk clock.Clock) *ValidationAuthorityImpl {
 	logger := blog.GetAuditLogger()
@@ -69,7 +228,9 @@ func NewValidationAuthorityImpl(pc *PortConfig, sbc SafeBrowsing, stats statsd.S
 		httpsPort:    pc.HTTPSPort,
 		tlsPort:      pc.TLSPort,
 		stats:        stats,
+		metrics:      newVAMetrics(),
 		clk:          clk,
+		targets:      newTargetLimiter(clk),
 	}
 }
 
@@ -81,15 +242,27 @@ type verificationRequestEvent struct {
 	RequestTime  time.Time      `json:",omitempty"`
 	ResponseTime time.Time      `json:",omitempty"`
 	Error        string         `json:",omitempty"`
+
+	// The effective configuration of the challenge's probe
+	Port           int    `json:",omitempty"`
+	Timeout        string `json:",omitempty"`
+	ConnectTimeout string `json:",omitempty"`
 }
 
 // getAddr will query for all A records associated with hostname and return the
-// prefered address, the first net.IP in the addrs slice, and all addresses resolved.
+// prefered address, the first net.IP in the addrs slice that the AddressPolicy
+// permits, and all addresses resolved.
 // This is the same choice made by the Go internal resolution library used by
 // net/http, except we only send A queries and accept IPv4 addresses.
 // TODO(#593): Add IPv6 support
 func (va ValidationAuthorityImpl) getAddr(hostname string) (addr net.IP, addrs []net.IP, problem *probs.ProblemDetails) {
+	lookupStart := va.clk.Now()
 	addrs, err := va.DNSResolver.LookupHost(hostname)
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	va.metrics.resolutions.Observe(va.clk.Now().Sub(lookupStart).Seconds(), result)
 	if err != nil {
 		problem = bdns.ProblemDetailsFromDNSError(err)
 		va.log.Debug(fmt.Sprintf("%s DNS failure: %s", hostname, err))
@@ -103,28 +276,73 @@ func (va ValidationAuthorityImpl) getAddr(hostname string) (addr net.IP, addrs [
 		}
 		return
 	}
-	addr = addrs[0]
+
+	// The address is only resolved here, and then dialed directly, so a
+	// name can't be rebound to a filtered address between check and use
+	permitted := va.AddressPolicy.permitted(addrs)
+	if filtered := len(addrs) - len(permitted); filtered > 0 {
+		va.log.Info(fmt.Sprintf("Filtered %d of the addresses of %s: %s", filtered, hostname, addrs))
+		va.stats.Inc("VA.FilteredAddresses", int64(filtered), 1.0)
+	}
+	if len(permitted) == 0 {
+		problem = &probs.ProblemDetails{
+			Type:   probs.ConnectionProblem,
+			Detail: fmt.Sprintf("No addresses of %s may be connected to: %s", hostname, addrs),
+		}
+		return
+	}
+	addr = permitted[0]
 	va.log.Info(fmt.Sprintf("Resolved addresses for %s [using %s]: %s", hostname, addr, addrs))
 	return
 }
 
 type dialer struct {
-	record core.ValidationRecord
+	record  core.ValidationRecord
+	source  bdns.Source
+	timeout time.Duration
+	targets *targetLimiter
+	policy  TargetPolicy
+	// proxy, if set, is dialed in place of the validated address
+	proxy *url.URL
 }
 
 func (d *dialer) Dial(_, _ string) (net.Conn, error) {
-	realDialer := net.Dialer{Timeout: validationTimeout}
-	return realDialer.Dial("tcp", net.JoinHostPort(d.record.AddressUsed.String(), d.record.Port))
+	release, prob := d.targets.acquire(d.policy, d.record.Hostname, d.record.AddressUsed)
+	if prob != nil {
+		return nil, prob
+	}
+	remote, hostPort := d.record.AddressUsed, net.JoinHostPort(d.record.AddressUsed.String(), d.record.Port)
+	if d.proxy != nil {
+		remote, hostPort = net.ParseIP(d.proxy.Hostname()), proxyHostPort(d.proxy)
+	}
+	realDialer := d.source.Dialer("tcp", remote, d.timeout)
+	conn, err := realDialer.Dial("tcp", hostPort)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &limitedConn{Conn: conn, release: release}, nil
+}
+
+// Proxy returns the proxy the dialer's requests go through, if any, for
+// use as an http.Transport's Proxy.
+func (d *dialer) Proxy(*http.Request) (*url.URL, error) {
+	return d.proxy, nil
 }
 
 // resolveAndConstructDialer gets the prefered address using va.getAddr and returns
-// the chosen address and dialer for that address and correct port.
-func (va *ValidationAuthorityImpl) resolveAndConstructDialer(name string, port int) (dialer, *probs.ProblemDetails) {
+// the chosen address and dialer for that address and correct port, whose
+// connections time out after connectTimeout.
+func (va *ValidationAuthorityImpl) resolveAndConstructDialer(name string, port int, connectTimeout time.Duration) (dialer, *probs.ProblemDetails) {
 	d := dialer{
 		record: core.ValidationRecord{
 			Hostname: name,
 			Port:     strconv.Itoa(port),
 		},
+		source:  va.Source,
+		timeout: connectTimeout,
+		targets: va.targets,
+		policy:  va.TargetPolicy,
 	}
 
 	addr, allAddrs, err := va.getAddr(name)
@@ -133,17 +351,25 @@ func (va *ValidationAuthorityImpl) resolveAndConstructDialer(name string, port i
 	}
 	d.record.AddressesResolved = allAddrs
 	d.record.AddressUsed = addr
+
+	proxy, perr := va.Proxy.proxyFor(name, addr)
+	if perr != nil {
+		va.log.Warning(fmt.Sprintf("Couldn't choose a proxy for %s: %s", name, perr))
+		return d, probs.ServerInternal("Invalid validation proxy configuration")
+	}
+	d.proxy = proxy
 	return d, nil
 }
 
 // Validation methods
 
-func (va *ValidationAuthorityImpl) fetchHTTP(identifier core.AcmeIdentifier, path string, useTLS bool, input core.Challenge) ([]byte, []core.ValidationRecord, *probs.ProblemDetails) {
+func (va *ValidationAuthorityImpl) fetchHTTP(identifier identifier.ACMEIdentifier, path string, useTLS bool, input core.Challenge) ([]byte, []core.ValidationRecord, *probs.ProblemDetails) {
 	challenge := input
+	cfg := va.challengeConfig(core.ChallengeTypeHTTP01)
 
 	host := identifier.Value
 	scheme := "http"
-	port := va.httpPort
+	port := cfg.Port
 	if useTLS {
 		scheme = "https"
 		port = va.httpsPort
@@ -172,11 +398,9 @@ func (va *ValidationAuthorityImpl) fetchHTTP(identifier core.AcmeIdentifier, pat
 		}
 	}
 
-	if va.UserAgent != "" {
-		httpRequest.Header["User-Agent"] = []string{va.UserAgent}
-	}
+	va.setHeaders(httpRequest)
 
-	dialer, prob := va.resolveAndConstructDialer(host, port)
+	dialer, prob := va.resolveAndConstructDialer(host, port, cfg.ConnectTimeout)
 	dialer.record.URL = url.String()
 	validationRecords := []core.ValidationRecord{dialer.record}
 	if prob != nil {
@@ -191,75 +415,88 @@ func (va *ValidationAuthorityImpl) fetchHTTP(identifier core.AcmeIdentifier, pat
 		// connection immediately.
 		DisableKeepAlives: true,
 		// Intercept Dial in order to connect to the IP address we
-		// select.
-		Dial: dialer.Dial,
+		// select, or the proxy if there is one.
+		Dial:  dialer.Dial,
+		Proxy: dialer.Proxy,
 	}
 
-	// Some of our users use mod_security. Mod_security sees a lack of Accept
-	// headers as bot behavior and rejects requests. While this is a bug in
-	// mod_security's rules (given that the HTTP specs disagree with that
-	// requirement), we add the Accept header now in order to fix our
-	// mod_security users' mysterious breakages. See
-	// <https://github.com/SpiderLabs/owasp-modsecurity-crs/issues/265> and
-	// <https://github.com/letsencrypt/boulder/issues/1019>. This was done
-	// because it's a one-line fix with no downside. We're not likely to want to
-	// do many more things to satisfy misunderstandings around HTTP.
-	httpRequest.Header.Set("Accept", "*/*")
-
+	// redirectProb is set when a redirect is refused, so that the refusal
+	// rather than the resulting connection error is reported
+	var redirectProb *probs.ProblemDetails
 	logRedirect := func(req *http.Request, via []*http.Request) error {
-		if len(validationRecords) >= maxRedirect {
-			return fmt.Errorf("Too many redirects")
-		}
-
-		// Set Accept header for mod_security (see the other place the header is
-		// set)
-		req.Header.Set("Accept", "*/*")
-		if va.UserAgent != "" {
-			req.Header["User-Agent"] = []string{va.UserAgent}
-		}
-
-		reqHost := req.URL.Host
-		var reqPort int
-		if h, p, err := net.SplitHostPort(reqHost); err == nil {
-			reqHost = h
-			reqPort, err = strconv.Atoi(p)
-			if err != nil {
-				return err
-			}
-			if reqPort <= 0 || reqPort > 65535 {
-				return fmt.Errorf("Invalid port number %d in redirect", reqPort)
+		from := via[len(via)-1].URL.String()
+		reqPort, err := va.checkRedirect(req.URL, len(via))
+		if err != nil {
+			validationRecords = append(validationRecords, core.ValidationRecord{
+				URL:      req.URL.String(),
+				Hostname: req.URL.Hostname(),
+				Port:     req.URL.Port(),
+			})
+			// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+			va.log.Audit(fmt.Sprintf("%s [%s] refused redirect from %q to %q: %s", challenge.Type, identifier, from, req.URL.String(), err))
+			redirectProb = &probs.ProblemDetails{
+				Type:   probs.ConnectionProblem,
+				Detail: fmt.Sprintf("Refused redirect from %s to %s: %s", from, req.URL, err),
 			}
-		} else if strings.ToLower(req.URL.Scheme) == "https" {
-			reqPort = 443
-		} else {
-			reqPort = 80
+			return redirectProb
 		}
 
-		dialer, err := va.resolveAndConstructDialer(reqHost, reqPort)
+		va.setHeaders(req)
+
+		dialer, prob := va.resolveAndConstructDialer(req.URL.Hostname(), reqPort, cfg.ConnectTimeout)
 		dialer.record.URL = req.URL.String()
 		validationRecords = append(validationRecords, dialer.record)
-		if err != nil {
-			return err
+		if prob != nil {
+			return prob
 		}
 		tr.Dial = dialer.Dial
-		va.log.Info(fmt.Sprintf("%s [%s] redirect from %q to %q [%s]", challenge.Type, identifier, via[len(via)-1].URL.String(), req.URL.String(), dialer.record.AddressUsed))
+		tr.Proxy = dialer.Proxy
+		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+		va.log.Audit(fmt.Sprintf("%s [%s] redirect from %q to %q [%s]", challenge.Type, identifier, from, req.URL.String(), dialer.record.AddressUsed))
+		return nil
+	}
+	// Each request, redirects included, is sent to the address in the
+	// latest of its validation records
+	addressOf := func(u string) net.IP {
+		for i := len(validationRecords) - 1; i >= 0; i-- {
+			if validationRecords[i].URL == u {
+				return validationRecords[i].AddressUsed
+			}
+		}
 		return nil
 	}
 	client := http.Client{
-		Transport:     tr,
+		Transport: &evidenceTransport{
+			va:         va,
+			rt:         tr,
+			identifier: identifier,
+			challenge:  challenge.Type,
+			address:    addressOf,
+		},
 		CheckRedirect: logRedirect,
-		Timeout:       validationTimeout,
+		Timeout:       cfg.Timeout,
 	}
 	httpResponse, err := client.Do(httpRequest)
 	if err != nil {
 		va.log.Debug(err.Error())
+		if redirectProb != nil {
+			return nil, validationRecords, redirectProb
+		}
+		if prob := limitProblem(err); prob != nil {
+			va.stats.Inc("VA.TargetLimited", 1, 1.0)
+			return nil, validationRecords, prob
+		}
 		return nil, validationRecords, &probs.ProblemDetails{
-			Type:   parseHTTPConnError(err),
-			Detail: fmt.Sprintf("Could not connect to %s", url),
+			Type:      parseHTTPConnError(err),
+			Detail:    fmt.Sprintf("Could not connect to %s", url),
+			Transient: isTransientConnError(err),
 		}
 	}
 	defer httpResponse.Body.Close()
 
+	if httpResponse.StatusCode == http.StatusForbidden {
+		validationRecords[len(validationRecords)-1].Forbidden = true
+	}
 	if httpResponse.StatusCode != 200 {
 		return nil, validationRecords, &probs.ProblemDetails{
 			Type: probs.UnauthorizedProblem,
@@ -275,10 +512,75 @@ func (va *ValidationAuthorityImpl) fetchHTTP(identifier core.AcmeIdentifier, pat
 			Detail: fmt.Sprintf("Error reading HTTP response body: %v", err),
 		}
 	}
+	va.transcript.fetched(validationRecords[len(validationRecords)-1].URL, body)
 	return body, validationRecords, nil
 }
 
-func (va *ValidationAuthorityImpl) validateTLSWithZName(identifier core.AcmeIdentifier, challenge core.Challenge, zName string) ([]core.ValidationRecord, *probs.ProblemDetails) {
+// checkRedirect applies the VA's RedirectPolicy to the redirect that would
+// be the redirects'th followed, returning the port to connect to.
+func (va *ValidationAuthorityImpl) checkRedirect(u *url.URL, redirects int) (int, error) {
+	policy := va.RedirectPolicy
+	if redirects > policy.maxRedirects() {
+		return 0, fmt.Errorf("Too many redirects")
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	schemeAllowed := false
+	for _, s := range policy.schemes() {
+		if strings.ToLower(s) == scheme {
+			schemeAllowed = true
+			break
+		}
+	}
+	if !schemeAllowed {
+		return 0, fmt.Errorf("Redirects to %q URLs aren't allowed", u.Scheme)
+	}
+
+	var port int
+	if p := u.Port(); p != "" {
+		var err error
+		port, err = strconv.Atoi(p)
+		if err != nil || port <= 0 || port > 65535 {
+			return 0, fmt.Errorf("Invalid port number %q in redirect", p)
+		}
+	} else if scheme == "https" {
+		port = 443
+	} else {
+		port = 80
+	}
+	portAllowed := port == va.challengeConfig(core.ChallengeTypeHTTP01).Port || port == va.httpsPort
+	for _, p := range policy.ports() {
+		if p == port {
+			portAllowed = true
+			break
+		}
+	}
+	if !portAllowed {
+		return 0, fmt.Errorf("Redirects to port %d aren't allowed", port)
+	}
+
+	host := u.Hostname()
+	if net.ParseIP(host) != nil {
+		return 0, fmt.Errorf("Redirects to IP addresses aren't allowed")
+	}
+	if !va.allowNonPublicRedirects && !isPublicName(host) {
+		return 0, fmt.Errorf("%q isn't a public domain name", host)
+	}
+	return port, nil
+}
+
+// isPublicName returns whether name is a domain name under, but not equal
+// to, an ICANN public suffix.
+func isPublicName(name string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if _, err := publicsuffix.ICANNTLD(name); err != nil {
+		return false
+	}
+	_, err := publicsuffix.EffectiveTLDPlusOne(name)
+	return err == nil
+}
+
+func (va *ValidationAuthorityImpl) validateTLSWithZName(identifier identifier.ACMEIdentifier, challenge core.Challenge, zName string) ([]core.ValidationRecord, *probs.ProblemDetails) {
 	addr, allAddrs, problem := va.getAddr(identifier.Value)
 	validationRecords := []core.ValidationRecord{
 		core.ValidationRecord{
@@ -292,34 +594,60 @@ func (va *ValidationAuthorityImpl) validateTLSWithZName(identifier core.AcmeIden
 	}
 
 	// Make a connection with SNI = nonceName
-	portString := strconv.Itoa(va.tlsPort)
+	cfg := va.challengeConfig(core.ChallengeTypeTLSSNI01)
+	portString := strconv.Itoa(cfg.Port)
 	hostPort := net.JoinHostPort(addr.String(), portString)
 	validationRecords[0].Port = portString
 	va.log.Notice(fmt.Sprintf("%s [%s] Attempting to validate for %s %s", challenge.Type, identifier, hostPort, zName))
-	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: validationTimeout}, "tcp", hostPort, &tls.Config{
+	release, problem := va.targets.acquire(va.TargetPolicy, identifier.Value, addr)
+	if problem != nil {
+		va.stats.Inc("VA.TargetLimited", 1, 1.0)
+		return validationRecords, problem
+	}
+	defer release()
+	// The connect timeout bounds the TCP connection, and the timeout the
+	// handshake too
+	tlsDialer := va.Source.Dialer("tcp", addr, cfg.ConnectTimeout)
+	tlsDialer.Deadline = time.Now().Add(cfg.Timeout)
+	evidence := RequestEvidence{
+		Identifier: identifier.Value,
+		Challenge:  challenge.Type,
+		Request:    fmt.Sprintf("TLS %s SNI %s", hostPort, zName),
+		Address:    addr.String(),
+		Time:       va.clk.Now(),
+	}
+	conn, err := tls.DialWithDialer(tlsDialer, "tcp", hostPort, &tls.Config{
 		ServerName:         zName,
 		InsecureSkipVerify: true,
 	})
 
 	if err != nil {
+		evidence.Error = err.Error()
+		va.logEvidence(evidence)
 		va.log.Debug(fmt.Sprintf("%s [%s] TLS Connection failure: %s", challenge.Type, identifier, err))
 		return validationRecords, &probs.ProblemDetails{
-			Type:   parseHTTPConnError(err),
-			Detail: "Failed to connect to host for DVSNI challenge",
+			Type:      parseHTTPConnError(err),
+			Detail:    "Failed to connect to host for DVSNI challenge",
+			Transient: isTransientConnError(err),
 		}
 	}
 	defer conn.Close()
 
 	// Check that zName is a dNSName SAN in the server's certificate
 	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) > 0 {
+		evidence.ResponseSHA256 = sha256Hex(certs[0].Raw)
+	}
+	va.logEvidence(evidence)
 	if len(certs) == 0 {
 		return validationRecords, &probs.ProblemDetails{
 			Type:   probs.UnauthorizedProblem,
 			Detail: "No certs presented for TLS SNI challenge",
 		}
 	}
+	va.transcript.fetched(fmt.Sprintf("%s with SNI %s", hostPort, zName), certs[0].Raw)
 	for _, name := range certs[0].DNSNames {
-		if subtle.ConstantTimeCompare([]byte(name), []byte(zName)) == 1 {
+		if core.ConstantTimeEquals(name, zName) {
 			return validationRecords, nil
 		}
 	}
@@ -331,7 +659,7 @@ func (va *ValidationAuthorityImpl) validateTLSWithZName(identifier core.AcmeIden
 	}
 }
 
-func (va *ValidationAuthorityImpl) validateHTTP01(identifier core.AcmeIdentifier, challenge core.Challenge) ([]core.ValidationRecord, *probs.ProblemDetails) {
+func (va *ValidationAuthorityImpl) validateHTTP01(identifier identifier.ACMEIdentifier, challenge core.Challenge) ([]core.ValidationRecord, *probs.ProblemDetails) {
 	if identifier.Type != core.IdentifierDNS {
 		va.log.Debug(fmt.Sprintf("%s [%s] Identifier failure", challenge.Type, identifier))
 		return nil, &probs.ProblemDetails{
@@ -349,20 +677,28 @@ func (va *ValidationAuthorityImpl) validateHTTP01(identifier core.AcmeIdentifier
 
 	payload := strings.TrimRight(string(body), whitespaceCutset)
 
+	// Wrong answers are usually served by a default vhost or at the end of
+	// a misconfigured redirect, so show where they came from and how they
+	// start
+	final := &validationRecords[len(validationRecords)-1]
+
 	// Parse body as a key authorization object
 	serverKeyAuthorization, authErr := core.NewKeyAuthorizationFromString(payload)
 	if authErr != nil {
 		va.log.Debug(authErr.Error())
+		final.ResponseBody = responseExcerpt(body)
 		return validationRecords, &probs.ProblemDetails{
-			Type:   probs.UnauthorizedProblem,
-			Detail: fmt.Sprintf("Error parsing key authorization file: %s", authErr.Error()),
+			Type: probs.UnauthorizedProblem,
+			Detail: fmt.Sprintf("Error parsing key authorization file from %s: %s; response began %q",
+				final.URL, authErr.Error(), final.ResponseBody),
 		}
 	}
 
 	// Check that the account key for this challenge is authorized by this object
 	if !serverKeyAuthorization.Match(challenge.Token, challenge.AccountKey) {
-		errString := fmt.Sprintf("The key authorization file from the server did not match this challenge [%v] != [%v]",
-			challenge.KeyAuthorization.String(), string(body))
+		final.ResponseBody = responseExcerpt(body)
+		errString := fmt.Sprintf("The key authorization file from %s did not match this challenge [%v] != [%v]",
+			final.URL, challenge.KeyAuthorization.String(), final.ResponseBody)
 		va.log.Debug(errString)
 		return validationRecords, &probs.ProblemDetails{
 			Type:   probs.UnauthorizedProblem,
@@ -373,7 +709,26 @@ func (va *ValidationAuthorityImpl) validateHTTP01(identifier core.AcmeIdentifier
 	return validationRecords, nil
 }
 
-func (va *ValidationAuthorityImpl) validateTLSSNI01(identifier core.AcmeIdentifier, challenge core.Challenge) ([]core.ValidationRecord, *probs.ProblemDetails) {
+// maxResponseExcerpt is the most of a wrong HTTP validation response, in
+// bytes, that is shown to the user.
+const maxResponseExcerpt = 256
+
+// responseExcerpt returns the start of body, at most maxResponseExcerpt
+// bytes, with anything that isn't printable UTF-8 replaced by '?', so that
+// it's safe to show in problem details and logs.
+func responseExcerpt(body []byte) string {
+	if len(body) > maxResponseExcerpt {
+		body = body[:maxResponseExcerpt]
+	}
+	return strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || !unicode.IsPrint(r) {
+			return '?'
+		}
+		return r
+	}, string(body))
+}
+
+func (va *ValidationAuthorityImpl) validateTLSSNI01(identifier identifier.ACMEIdentifier, challenge core.Challenge) ([]core.ValidationRecord, *probs.ProblemDetails) {
 	if identifier.Type != "dns" {
 		va.log.Debug(fmt.Sprintf("TLS-SNI [%s] Identifier failure", identifier))
 		return nil, &probs.ProblemDetails{
@@ -413,7 +768,25 @@ func parseHTTPConnError(err error) probs.ProblemType {
 	return probs.ConnectionProblem
 }
 
-func (va *ValidationAuthorityImpl) validateDNS01(identifier core.AcmeIdentifier, challenge core.Challenge) ([]core.ValidationRecord, *probs.ProblemDetails) {
+func (va *ValidationAuthorityImpl) validateDNS01(identifier identifier.ACMEIdentifier, challenge core.Challenge) ([]core.ValidationRecord, *probs.ProblemDetails) {
+	return va.validateDNSRecord(identifier, challenge, fmt.Sprintf("%s.%s", core.DNSPrefix, identifier.Value))
+}
+
+// validateDNSAccount01 validates an experimental dns-account-01 challenge,
+// which is dns-01 with the record under a label scoped to the account being
+// validated for, so that the VA must know the account's URI.
+func (va *ValidationAuthorityImpl) validateDNSAccount01(identifier identifier.ACMEIdentifier, challenge core.Challenge) ([]core.ValidationRecord, *probs.ProblemDetails) {
+	if va.AccountURIPrefix == "" || va.regID == 0 {
+		return nil, probs.ServerInternal("dns-account-01 validation isn't configured")
+	}
+	accountURI := va.AccountURIPrefix + strconv.FormatInt(va.regID, 10)
+	return va.validateDNSRecord(identifier, challenge,
+		fmt.Sprintf("%s.%s.%s", core.DNSAccountLabel(accountURI), core.DNSPrefix, identifier.Value))
+}
+
+// validateDNSRecord looks for the digest of challenge's key authorization
+// among the TXT records of challengeSubdomain.
+func (va *ValidationAuthorityImpl) validateDNSRecord(identifier identifier.ACMEIdentifier, challenge core.Challenge, challengeSubdomain string) ([]core.ValidationRecord, *probs.ProblemDetails) {
 	if identifier.Type != core.IdentifierDNS {
 		va.log.Debug(fmt.Sprintf("DNS [%s] Identifier failure", identifier))
 		return nil, &probs.ProblemDetails{
@@ -428,8 +801,7 @@ func (va *ValidationAuthorityImpl) validateDNS01(identifier core.AcmeIdentifier,
 	authorizedKeysDigest := hex.EncodeToString(h.Sum(nil))
 
 	// Look for the required record in the DNS
-	challengeSubdomain := fmt.Sprintf("%s.%s", core.DNSPrefix, identifier.Value)
-	txts, err := va.DNSResolver.LookupTXT(challengeSubdomain)
+	txts, err := va.lookupTXTWithTimeout(challengeSubdomain, va.challengeConfig(challenge.Type).Timeout)
 
 	if err != nil {
 		va.log.Debug(fmt.Sprintf("%s [%s] DNS failure: %s", challenge.Type, identifier, err))
@@ -437,7 +809,7 @@ func (va *ValidationAuthorityImpl) validateDNS01(identifier core.AcmeIdentifier,
 	}
 
 	for _, element := range txts {
-		if subtle.ConstantTimeCompare([]byte(element), []byte(authorizedKeysDigest)) == 1 {
+		if core.ConstantTimeEquals(element, authorizedKeysDigest) {
 			// Successful challenge validation
 			return nil, nil
 		}
@@ -449,15 +821,54 @@ func (va *ValidationAuthorityImpl) validateDNS01(identifier core.AcmeIdentifier,
 	}
 }
 
-func (va *ValidationAuthorityImpl) checkCAA(identifier core.AcmeIdentifier, regID int64) *probs.ProblemDetails {
+// lookupTXTWithTimeout looks up the TXT records of name, giving up after
+// timeout, whatever the timeouts of the resolver's own queries and retries,
+// if the resolver can be bounded in time.
+func (va *ValidationAuthorityImpl) lookupTXTWithTimeout(name string, timeout time.Duration) ([]string, error) {
+	resolver := va.DNSResolver
+	if deadliner, ok := resolver.(bdns.Deadliner); ok {
+		resolver = deadliner.WithTimeout(timeout)
+	}
+	return resolver.LookupTXT(name)
+}
+
+// validateEmailReply00 checks that the response to an email-reply-00
+// challenge starts with the token that was mailed to the address, which shows
+// that the applicant receives mail there.
+func (va *ValidationAuthorityImpl) validateEmailReply00(identifier identifier.ACMEIdentifier, challenge core.Challenge) ([]core.ValidationRecord, *probs.ProblemDetails) {
+	if identifier.Type != core.IdentifierEmail {
+		va.log.Debug(fmt.Sprintf("%s [%s] Identifier failure", challenge.Type, identifier))
+		return nil, &probs.ProblemDetails{
+			Type:   probs.MalformedProblem,
+			Detail: "Identifier type for email reply validation was not email",
+		}
+	}
+	if va.MailboxTokens == nil {
+		return nil, probs.ServerInternal("Email reply validation isn't configured")
+	}
+
+	expected := va.MailboxTokens.Token(identifier.Value, challenge.Token) + challenge.Token
+	if !core.ConstantTimeEquals(challenge.KeyAuthorization.Token, expected) {
+		return nil, &probs.ProblemDetails{
+			Type:   probs.UnauthorizedProblem,
+			Detail: fmt.Sprintf("Response doesn't contain the token mailed to %s", identifier.Value),
+		}
+	}
+	return nil, nil
+}
+
+func (va *ValidationAuthorityImpl) checkCAA(ctx context.Context, identifier identifier.ACMEIdentifier, regID int64, challengeType string) *probs.ProblemDetails {
 	// Check CAA records for the requested identifier
-	present, valid, err := va.CheckCAARecords(identifier)
+	present, valid, err := va.checkCAARecords(ctx, identifier, &caaRequest{
+		accountURI:       va.AccountURIPrefix + strconv.FormatInt(regID, 10),
+		validationMethod: challengeType,
+	})
 	if err != nil {
 		va.log.Warning(fmt.Sprintf("Problem checking CAA: %s", err))
 		return bdns.ProblemDetailsFromDNSError(err)
 	}
 	// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
-	va.log.Audit(fmt.Sprintf("Checked CAA records for %s, registration ID %d [Present: %t, Valid for issuance: %t]", identifier.Value, regID, present, valid))
+	va.log.WithRequestID(core.RequestID(ctx)).Audit(fmt.Sprintf("Checked CAA records for %s, registration ID %d, challenge type %s [Present: %t, Valid for issuance: %t]", identifier.Value, regID, challengeType, present, valid))
 	if !valid {
 		return &probs.ProblemDetails{
 			Type:   probs.ConnectionProblem,
@@ -469,15 +880,105 @@ func (va *ValidationAuthorityImpl) checkCAA(identifier core.AcmeIdentifier, regI
 
 // Overall validation process
 
-func (va *ValidationAuthorityImpl) validate(authz core.Authorization, challengeIndex int) {
+// detailDeadlineExceeded is the problem detail of validations that don't
+// finish within the VA's Deadline.
+const detailDeadlineExceeded = "Validation did not complete in time"
+
+func deadlineProblem() *probs.ProblemDetails {
+	return &probs.ProblemDetails{
+		Type:   probs.ConnectionProblem,
+		Detail: detailDeadlineExceeded,
+	}
+}
+
+// withDeadline bounds ctx by the VA's Deadline, if it has one.
+func (va *ValidationAuthorityImpl) withDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if va.Deadline <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, va.Deadline)
+}
+
+// withDNSCache returns a copy of va whose DNS lookups are cached for their
+// TTLs, if its resolver can cache, so that one validation's challenges and
+// CAA tree climbing don't repeat the same queries.
+func (va *ValidationAuthorityImpl) withDNSCache() *ValidationAuthorityImpl {
+	cacher, ok := va.DNSResolver.(bdns.Cacher)
+	if !ok {
+		return va
+	}
+	cached := *va
+	cached.DNSResolver = cacher.WithCache()
+	return &cached
+}
+
+// validate validates the challenge at challengeIndex, together with the other
+// challenges of a combination it completes, and reports the outcome to the
+// RA. The challenges are validated in parallel, sharing one deadline and a
+// DNS cache.
+func (va *ValidationAuthorityImpl) validate(ctx context.Context, authz core.Authorization, challengeIndex int) {
+	indexes := authz.RespondedCombination(challengeIndex)
+	if indexes == nil {
+		indexes = []int{challengeIndex}
+	}
+	va = va.withDNSCache()
+
+	validationCtx, cancel := va.withDeadline(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, i := range indexes {
+		wg.Add(1)
+		go func(challenge *core.Challenge) {
+			defer wg.Done()
+			va.validateAuthzChallenge(validationCtx, authz, challenge)
+		}(&authz.Challenges[i])
+	}
+	wg.Wait()
+
+	va.log.Notice(fmt.Sprintf("Validations: %+v", authz))
+
+	va.RA.OnValidationUpdate(ctx, authz)
+}
+
+// validateAuthzChallenge validates challenge, one of authz's, from this VA
+// and any remote VAs, and records the outcome in it, and the transcript of a
+// success with the SA.
+func (va *ValidationAuthorityImpl) validateAuthzChallenge(ctx context.Context, authz core.Authorization, challenge *core.Challenge) {
+	va = va.withTranscript().withAccount(authz.RegistrationID, authz.ID)
+	cfg := va.challengeConfig(challenge.Type)
 	logEvent := verificationRequestEvent{
 		ID:          authz.ID,
 		Requester:   authz.RegistrationID,
 		RequestTime: va.clk.Now(),
+		Port:        cfg.Port,
+	}
+	if cfg.Timeout > 0 {
+		logEvent.Timeout = cfg.Timeout.String()
+	}
+	if cfg.ConnectTimeout > 0 {
+		logEvent.ConnectTimeout = cfg.ConnectTimeout.String()
 	}
-	challenge := &authz.Challenges[challengeIndex]
 	vStart := va.clk.Now()
-	validationRecords, prob := va.validateChallengeAndCAA(authz.Identifier, *challenge, authz.RegistrationID)
+	remoteResult := make(chan remoteValidationResult, 1)
+	// Mail reaches the applicant the same way whatever the VA's network
+	// perspective, so only DNS identifiers are validated remotely
+	remote := len(va.RemoteVAs) > 0 && authz.Identifier.Type == core.IdentifierDNS
+	if remote {
+		go func(chall core.Challenge) {
+			prob, transcripts := va.performRemoteValidation(ctx, authz, chall)
+			remoteResult <- remoteValidationResult{prob, transcripts}
+		}(*challenge)
+	}
+	validationRecords, prob := va.validateChallengeAndCAA(ctx, authz.Identifier, *challenge, authz.RegistrationID)
+	var remoteTranscripts []core.ValidationTranscript
+	if prob == nil && remote {
+		select {
+		case r := <-remoteResult:
+			prob, remoteTranscripts = r.prob, r.transcripts
+		case <-ctx.Done():
+			prob = deadlineProblem()
+		}
+	}
 	va.stats.TimingDuration(fmt.Sprintf("VA.Validations.%s.%s", challenge.Type, challenge.Status), time.Since(vStart), 1.0)
 
 	challenge.ValidationRecord = validationRecords
@@ -485,56 +986,83 @@ func (va *ValidationAuthorityImpl) validate(authz core.Authorization, challengeI
 		challenge.Status = core.StatusInvalid
 		challenge.Error = prob
 		logEvent.Error = prob.Error()
-	} else if !authz.Challenges[challengeIndex].RecordsSane() {
+	} else if !challenge.RecordsSane() {
 		challenge.Status = core.StatusInvalid
 		challenge.Error = &probs.ProblemDetails{Type: probs.ServerInternalProblem,
 			Detail: "Records for validation failed sanity check"}
 		logEvent.Error = challenge.Error.Error()
+	} else if err := va.recordTranscript(ctx, authz, *challenge, vStart, remoteTranscripts); err != nil {
+		va.log.Warning(fmt.Sprintf("Couldn't record validation transcript for %s: %s", authz.ID, err))
+		va.stats.Inc("VA.Transcripts.Failed", 1, 1.0)
+		challenge.Status = core.StatusInvalid
+		challenge.Error = probs.ServerInternal("Couldn't record validation transcript")
+		logEvent.Error = challenge.Error.Error()
 	} else {
 		challenge.Status = core.StatusValid
 	}
 	logEvent.Challenge = *challenge
+	va.metrics.observeValidation(*challenge, va.clk.Now().Sub(vStart))
 
 	// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
-	va.log.AuditObject("Validation result", logEvent)
-
-	va.log.Notice(fmt.Sprintf("Validations: %+v", authz))
-
-	va.RA.OnValidationUpdate(authz)
+	va.log.WithRequestID(core.RequestID(ctx)).AuditObject("Validation result", logEvent)
 }
 
-func (va *ValidationAuthorityImpl) validateChallengeAndCAA(identifier core.AcmeIdentifier, challenge core.Challenge, regID int64) ([]core.ValidationRecord, *probs.ProblemDetails) {
-	ch := make(chan *probs.ProblemDetails, 1)
+// validateChallengeAndCAA probes the challenge and checks CAA concurrently.
+// If ctx is done first, the validation fails with a deadline problem.
+func (va *ValidationAuthorityImpl) validateChallengeAndCAA(ctx context.Context, identifier identifier.ACMEIdentifier, challenge core.Challenge, regID int64) ([]core.ValidationRecord, *probs.ProblemDetails) {
+	// CAA only restricts issuance for DNS names
+	caaCh := make(chan *probs.ProblemDetails, 1)
+	if identifier.Type == core.IdentifierDNS {
+		go func() {
+			caaCh <- va.checkCAA(ctx, identifier, regID, challenge.Type)
+		}()
+	} else {
+		caaCh <- nil
+	}
+
+	type result struct {
+		records []core.ValidationRecord
+		prob    *probs.ProblemDetails
+	}
+	challengeCh := make(chan result, 1)
 	go func() {
-		ch <- va.checkCAA(identifier, regID)
+		records, prob := va.validateChallengeWithRetries(ctx, identifier, challenge)
+		challengeCh <- result{records, prob}
 	}()
 
-	validationRecords, err := va.validateChallenge(identifier, challenge)
-	if err != nil {
-		return validationRecords, err
+	var validationRecords []core.ValidationRecord
+	select {
+	case r := <-challengeCh:
+		if r.prob != nil {
+			return r.records, r.prob
+		}
+		validationRecords = r.records
+	case <-ctx.Done():
+		va.stats.Inc("VA.Validations.DeadlineExceeded", 1, 1.0)
+		return nil, deadlineProblem()
 	}
 
-	caaProblem := <-ch
-	if caaProblem != nil {
-		return validationRecords, caaProblem
+	select {
+	case caaProblem := <-caaCh:
+		if caaProblem != nil {
+			return validationRecords, caaProblem
+		}
+	case <-ctx.Done():
+		va.stats.Inc("VA.Validations.DeadlineExceeded", 1, 1.0)
+		return validationRecords, deadlineProblem()
 	}
 	return validationRecords, nil
 }
 
-func (va *ValidationAuthorityImpl) validateChallenge(identifier core.AcmeIdentifier, challenge core.Challenge) ([]core.ValidationRecord, *probs.ProblemDetails) {
+func (va *ValidationAuthorityImpl) validateChallenge(identifier identifier.ACMEIdentifier, challenge core.Challenge) ([]core.ValidationRecord, *probs.ProblemDetails) {
 	if !challenge.IsSane(true) {
 		return nil, &probs.ProblemDetails{
 			Type:   probs.MalformedProblem,
 			Detail: fmt.Sprintf("Challenge failed sanity check."),
 		}
 	}
-	switch challenge.Type {
-	case core.ChallengeTypeHTTP01:
-		return va.validateHTTP01(identifier, challenge)
-	case core.ChallengeTypeTLSSNI01:
-		return va.validateTLSSNI01(identifier, challenge)
-	case core.ChallengeTypeDNS01:
-		return va.validateDNS01(identifier, challenge)
+	if v, ok := ValidatorFor(challenge.Type); ok {
+		return v.Validate(va, identifier, challenge)
 	}
 	return nil, &probs.ProblemDetails{
 		Type:   probs.MalformedProblem,
@@ -542,9 +1070,101 @@ func (va *ValidationAuthorityImpl) validateChallenge(identifier core.AcmeIdentif
 	}
 }
 
+// remoteQuorum is the number of remote VAs that must agree with this one.
+func (va *ValidationAuthorityImpl) remoteQuorum() int {
+	if va.RemoteQuorum <= 0 || va.RemoteQuorum > len(va.RemoteVAs) {
+		return len(va.RemoteVAs)
+	}
+	return va.RemoteQuorum
+}
+
+// remoteValidationResult is the outcome of performRemoteValidation.
+type remoteValidationResult struct {
+	prob        *probs.ProblemDetails
+	transcripts []core.ValidationTranscript
+}
+
+// performRemoteValidation runs a validation of challenge, one of authz's, on
+// all of the remote VAs at once. It returns nil, with the transcripts of the
+// remote VAs that succeeded, as soon as a quorum of them have, or the first
+// remote problem once too many have failed for the quorum to be met.
+func (va *ValidationAuthorityImpl) performRemoteValidation(ctx context.Context, authz core.Authorization, challenge core.Challenge) (*probs.ProblemDetails, []core.ValidationTranscript) {
+	identifier := authz.Identifier
+	req := &core.PerformValidationRequest{
+		Identifier:      identifier,
+		Challenge:       challenge,
+		RegistrationID:  authz.RegistrationID,
+		AuthorizationID: authz.ID,
+	}
+	// Buffered so that stragglers don't block once the outcome is known
+	results := make(chan *core.PerformValidationResponse, len(va.RemoteVAs))
+	for _, remote := range va.RemoteVAs {
+		go func(remote core.RemoteValidator) {
+			resp, err := remote.PerformValidation(ctx, req)
+			if err != nil {
+				va.log.Warning(fmt.Sprintf("Remote validation of %s failed: %s", identifier.Value, err))
+				resp = &core.PerformValidationResponse{Problem: probs.ServerInternal("Remote validation failed")}
+			}
+			results <- resp
+		}(remote)
+	}
+
+	quorum := va.remoteQuorum()
+	var passed, failed int
+	var firstProb *probs.ProblemDetails
+	var transcripts []core.ValidationTranscript
+	for range va.RemoteVAs {
+		resp := <-results
+		prob := resp.Problem
+		if prob == nil {
+			passed++
+			if resp.Transcript != nil {
+				transcripts = append(transcripts, *resp.Transcript)
+			}
+		} else {
+			failed++
+			if firstProb == nil {
+				firstProb = prob
+			}
+		}
+		if passed >= quorum {
+			va.stats.Inc("VA.RemoteValidations.Passed", 1, 1.0)
+			return nil, transcripts
+		}
+		if failed > len(va.RemoteVAs)-quorum {
+			break
+		}
+	}
+	va.stats.Inc("VA.RemoteValidations.Failed", 1, 1.0)
+	return &probs.ProblemDetails{
+		Type:   firstProb.Type,
+		Detail: fmt.Sprintf("During secondary validation: %s", firstProb.Detail),
+	}, nil
+}
+
+// PerformValidation validates a challenge and checks CAA on behalf of a
+// primary VA, from this VA's network perspective. The transcript of a
+// success is returned for the primary VA to include in its own.
+func (va *ValidationAuthorityImpl) PerformValidation(ctx context.Context, req *core.PerformValidationRequest) (*core.PerformValidationResponse, error) {
+	validationCtx, cancel := va.withDeadline(ctx)
+	recorded := va.withDNSCache().withTranscript().withAccount(req.RegistrationID, req.AuthorizationID)
+	started := va.clk.Now()
+	records, prob := recorded.validateChallengeAndCAA(validationCtx, req.Identifier, req.Challenge, req.RegistrationID)
+	cancel()
+	// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+	va.log.WithRequestID(core.RequestID(ctx)).Audit(fmt.Sprintf("Performed remote validation of %s for registration ID %d, challenge type %s [Problem: %v]", req.Identifier.Value, req.RegistrationID, req.Challenge.Type, prob))
+	resp := &core.PerformValidationResponse{Records: records, Problem: prob}
+	if prob == nil {
+		challenge := req.Challenge
+		challenge.ValidationRecord = records
+		resp.Transcript = recorded.newTranscript(req.Identifier, challenge, req.RegistrationID, started)
+	}
+	return resp, nil
+}
+
 // UpdateValidations runs the validate() method asynchronously using goroutines.
-func (va *ValidationAuthorityImpl) UpdateValidations(authz core.Authorization, challengeIndex int) error {
-	go va.validate(authz, challengeIndex)
+func (va *ValidationAuthorityImpl) UpdateValidations(ctx context.Context, authz core.Authorization, challengeIndex int) error {
+	go va.validate(ctx, authz, challengeIndex)
 	return nil
 }
 
@@ -616,9 +1236,92 @@ func (va *ValidationAuthorityImpl) getCAASet(hostname string) (*CAASet, error) {
 	return nil, nil
 }
 
+// caaRequest is the account and challenge type that an issuance is bound to,
+// for checking against the accounturi and validationmethods parameters of
+// CAA issue properties (RFC 8657).
+type caaRequest struct {
+	accountURI       string
+	validationMethod string
+}
+
+// parseCAAIssueValue splits the value of an issue or issuewild property into
+// the issuer domain and its parameters, following the grammar of RFC 8659
+// section 4.2.
+func parseCAAIssueValue(value string) (string, map[string]string, error) {
+	parts := strings.Split(value, ";")
+	domain := strings.Trim(parts[0], whitespaceCutset)
+	params := make(map[string]string)
+	for _, part := range parts[1:] {
+		part = strings.Trim(part, whitespaceCutset)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return "", nil, fmt.Errorf("CAA parameter %q has no value", part)
+		}
+		key := strings.Trim(kv[0], whitespaceCutset)
+		if key == "" {
+			return "", nil, fmt.Errorf("CAA parameter %q has no name", part)
+		}
+		if _, ok := params[key]; ok {
+			return "", nil, fmt.Errorf("CAA parameter %q given twice", key)
+		}
+		params[key] = strings.Trim(kv[1], whitespaceCutset)
+	}
+	return domain, params, nil
+}
+
+// caaAuthorizes reports whether an issue or issuewild property value
+// authorizes this CA to issue for req. A value naming this CA may further
+// restrict issuance to one account, with accounturi, or to some challenge
+// types, with a comma-separated validationmethods. Without a req, such
+// restricted values authorize nothing. Other parameters are ignored.
+func (va *ValidationAuthorityImpl) caaAuthorizes(value string, req *caaRequest) bool {
+	domain, params, err := parseCAAIssueValue(value)
+	if err != nil || domain != va.IssuerDomain {
+		return false
+	}
+	if accountURI, ok := params["accounturi"]; ok {
+		if req == nil || accountURI != req.accountURI {
+			return false
+		}
+	}
+	if methods, ok := params["validationmethods"]; ok {
+		if req == nil {
+			return false
+		}
+		allowed := false
+		for _, method := range strings.Split(methods, ",") {
+			if strings.Trim(method, whitespaceCutset) == req.validationMethod {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
 // CheckCAARecords verifies that, if the indicated subscriber domain has any CAA
-// records, they authorize the configured CA domain to issue a certificate
-func (va *ValidationAuthorityImpl) CheckCAARecords(identifier core.AcmeIdentifier) (present, valid bool, err error) {
+// records, they authorize the configured CA domain to issue a certificate to
+// registration regID, whose authorization for it was validated with a
+// challenge of challengeType. Records that bind issuance to an account or
+// challenge type don't count if regID is 0.
+func (va *ValidationAuthorityImpl) CheckCAARecords(ctx context.Context, identifier identifier.ACMEIdentifier, regID int64, challengeType string) (present, valid bool, err error) {
+	var req *caaRequest
+	if regID != 0 {
+		req = &caaRequest{
+			accountURI:       va.AccountURIPrefix + strconv.FormatInt(regID, 10),
+			validationMethod: challengeType,
+		}
+	}
+	return va.checkCAARecords(ctx, identifier, req)
+}
+
+func (va *ValidationAuthorityImpl) checkCAARecords(ctx context.Context, identifier identifier.ACMEIdentifier, req *caaRequest) (present, valid bool, err error) {
 	hostname := strings.ToLower(identifier.Value)
 	caaSet, err := va.getCAASet(hostname)
 	if err != nil {
@@ -642,7 +1345,7 @@ func (va *ValidationAuthorityImpl) CheckCAARecords(identifier core.AcmeIdentifie
 			checkSet = caaSet.Issue
 		}
 		for _, caa := range checkSet {
-			if caa.Value == va.IssuerDomain {
+			if va.caaAuthorizes(caa.Value, req) {
 				valid = true
 				return
 			} else if caa.Flag > 0 {
@@ -6,6 +6,7 @@
 package va
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -14,6 +15,7 @@ import (
 	"crypto/x509/pkix"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/big"
 	"net"
@@ -22,21 +24,26 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
-	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
 	"github.com/letsencrypt/boulder/bdns"
+	"github.com/letsencrypt/boulder/identifier"
 	"github.com/letsencrypt/boulder/metrics"
 	"github.com/letsencrypt/boulder/probs"
 
 	"github.com/letsencrypt/boulder/core"
+	bmail "github.com/letsencrypt/boulder/mail"
 	"github.com/letsencrypt/boulder/mocks"
 	"github.com/letsencrypt/boulder/test"
 )
 
+var ctx = context.Background()
+
 func bigIntFromB64(b64 string) *big.Int {
 	bytes, _ := base64.URLEncoding.DecodeString(b64)
 	x := big.NewInt(0)
@@ -60,9 +67,12 @@ var TheKey = rsa.PrivateKey{
 	Primes:    []*big.Int{p, q},
 }
 
-var accountKey = &jose.JsonWebKey{Key: TheKey.Public()}
+var accountKey = &jose.JSONWebKey{Key: TheKey.Public()}
+
+var ident = identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: "localhost"}
 
-var ident = core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "localhost"}
+// allowLoopback lets tests validate against servers on localhost
+var allowLoopback = AddressPolicy{AllowedRanges: []string{"127.0.0.0/8"}}
 
 var log = mocks.UseMockLog()
 
@@ -70,6 +80,7 @@ var log = mocks.UseMockLog()
 const expectedToken = "LoqXcYV8q5ONbJQxbmR7SCTNo3tiAXDfowyjxAjEuX0"
 const pathWrongToken = "i6lNAC4lOOLYCl-A08VJt9z_tKYvVk63Dumo8icsBjQ"
 const path404 = "404"
+const path403 = "403"
 const pathFound = "GBq8SwWq3JsbREFdCamk5IX3KLsxW5ULeGs98Ajl_UM"
 const pathMoved = "5J4FIMrWNfmvHZo-QpKZngmuhqZGwRm21-oEgUDstJM"
 const pathRedirectPort = "port-redirect"
@@ -95,6 +106,9 @@ func httpSrv(t *testing.T, token string) *httptest.Server {
 		if strings.HasSuffix(r.URL.Path, path404) {
 			t.Logf("HTTPSRV: Got a 404 req\n")
 			http.NotFound(w, r)
+		} else if strings.HasSuffix(r.URL.Path, path403) {
+			t.Logf("HTTPSRV: Got a 403 req\n")
+			http.Error(w, "Forbidden", http.StatusForbidden)
 		} else if strings.HasSuffix(r.URL.Path, pathMoved) {
 			t.Logf("HTTPSRV: Got a 301 redirect req\n")
 			if currentToken == defaultToken {
@@ -221,6 +235,7 @@ func TestHTTP(t *testing.T) {
 	}
 	stats, _ := statsd.NewNoopClient()
 	va := NewValidationAuthorityImpl(&PortConfig{HTTPPort: badPort}, nil, stats, clock.Default())
+	va.AddressPolicy = allowLoopback
 	va.DNSResolver = &mocks.DNSResolver{}
 
 	_, prob := va.validateHTTP01(ident, chall)
@@ -230,7 +245,9 @@ func TestHTTP(t *testing.T) {
 	test.AssertEquals(t, prob.Type, probs.ConnectionProblem)
 
 	va = NewValidationAuthorityImpl(&PortConfig{HTTPPort: goodPort}, nil, stats, clock.Default())
+	va.AddressPolicy = allowLoopback
 	va.DNSResolver = &mocks.DNSResolver{}
+	va.allowNonPublicRedirects = true
 
 	log.Clear()
 	t.Logf("Trying to validate: %+v\n", chall)
@@ -238,27 +255,43 @@ func TestHTTP(t *testing.T) {
 	if prob != nil {
 		t.Errorf("Unexpected failure in HTTP validation: %s", prob)
 	}
-	test.AssertEquals(t, len(log.GetAllMatching(`^\[AUDIT\] `)), 1)
+	test.AssertEquals(t, len(log.GetAllMatching(`^\[AUDIT\] Attempting to validate`)), 1)
+	test.AssertEquals(t, len(log.GetAllMatching(`^\[AUDIT\] Validation request JSON=`)), 1)
 
 	log.Clear()
 	setChallengeToken(&chall, path404)
-	_, prob = va.validateHTTP01(ident, chall)
+	records, prob := va.validateHTTP01(ident, chall)
 	if prob == nil {
 		t.Fatalf("Should have found a 404 for the challenge.")
 	}
 	test.AssertEquals(t, prob.Type, probs.UnauthorizedProblem)
-	test.AssertEquals(t, len(log.GetAllMatching(`^\[AUDIT\] `)), 1)
+	test.AssertEquals(t, len(log.GetAllMatching(`^\[AUDIT\] Attempting to validate`)), 1)
+	test.AssertEquals(t, len(log.GetAllMatching(`^\[AUDIT\] Validation request JSON=`)), 1)
+	test.Assert(t, !records[0].Forbidden, "404 response was flagged as forbidden")
+
+	setChallengeToken(&chall, path403)
+	records, prob = va.validateHTTP01(ident, chall)
+	if prob == nil {
+		t.Fatalf("Should have found a 403 for the challenge.")
+	}
+	test.AssertEquals(t, prob.Type, probs.UnauthorizedProblem)
+	test.Assert(t, records[len(records)-1].Forbidden, "403 response wasn't flagged as forbidden")
 
 	log.Clear()
 	setChallengeToken(&chall, pathWrongToken)
 	// The "wrong token" will actually be the expectedToken.  It's wrong
 	// because it doesn't match pathWrongToken.
-	_, prob = va.validateHTTP01(ident, chall)
+	records, prob = va.validateHTTP01(ident, chall)
 	if prob == nil {
 		t.Fatalf("Should have found the wrong token value.")
 	}
 	test.AssertEquals(t, prob.Type, probs.UnauthorizedProblem)
-	test.AssertEquals(t, len(log.GetAllMatching(`^\[AUDIT\] `)), 1)
+	test.AssertEquals(t, len(log.GetAllMatching(`^\[AUDIT\] Attempting to validate`)), 1)
+	test.AssertEquals(t, len(log.GetAllMatching(`^\[AUDIT\] Validation request JSON=`)), 1)
+	wrongKeyAuthz, _ := core.NewKeyAuthorization(expectedToken, accountKey)
+	final := records[len(records)-1]
+	test.AssertEquals(t, final.ResponseBody, wrongKeyAuthz.String()+"? ?")
+	test.Assert(t, strings.Contains(prob.Detail, final.URL), "Problem doesn't name the URL")
 
 	log.Clear()
 	setChallengeToken(&chall, pathMoved)
@@ -277,14 +310,14 @@ func TestHTTP(t *testing.T) {
 	test.AssertEquals(t, len(log.GetAllMatching(`redirect from ".*/`+pathFound+`" to ".*/`+pathMoved+`"`)), 1)
 	test.AssertEquals(t, len(log.GetAllMatching(`redirect from ".*/`+pathMoved+`" to ".*/`+pathValid+`"`)), 1)
 
-	ipIdentifier := core.AcmeIdentifier{Type: core.IdentifierType("ip"), Value: "127.0.0.1"}
+	ipIdentifier := identifier.ACMEIdentifier{Type: identifier.Type("ip"), Value: "127.0.0.1"}
 	_, prob = va.validateHTTP01(ipIdentifier, chall)
 	if prob == nil {
 		t.Fatalf("IdentifierType IP shouldn't have worked.")
 	}
 	test.AssertEquals(t, prob.Type, probs.MalformedProblem)
 
-	_, prob = va.validateHTTP01(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "always.invalid"}, chall)
+	_, prob = va.validateHTTP01(identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: "always.invalid"}, chall)
 	if prob == nil {
 		t.Fatalf("Domain name is invalid.")
 	}
@@ -314,7 +347,9 @@ func TestHTTPRedirectLookup(t *testing.T) {
 	test.AssertNotError(t, err, "failed to get test server port")
 	stats, _ := statsd.NewNoopClient()
 	va := NewValidationAuthorityImpl(&PortConfig{HTTPPort: port}, nil, stats, clock.Default())
+	va.AddressPolicy = allowLoopback
 	va.DNSResolver = &mocks.DNSResolver{}
+	va.allowNonPublicRedirects = true
 
 	log.Clear()
 	setChallengeToken(&chall, pathMoved)
@@ -356,9 +391,58 @@ func TestHTTPRedirectLookup(t *testing.T) {
 	setChallengeToken(&chall, pathRedirectPort)
 	_, err = va.validateHTTP01(ident, chall)
 	test.AssertError(t, err, chall.Token)
-	test.AssertEquals(t, len(log.GetAllMatching(`redirect from ".*/port-redirect" to ".*other.valid:8080/path"`)), 1)
+	test.AssertEquals(t, len(log.GetAllMatching(`refused redirect from ".*/port-redirect" to ".*other.valid:8080/path"`)), 1)
 	test.AssertEquals(t, len(log.GetAllMatching(`Resolved addresses for localhost \[using 127.0.0.1\]: \[127.0.0.1\]`)), 1)
-	test.AssertEquals(t, len(log.GetAllMatching(`Resolved addresses for other.valid \[using 127.0.0.1\]: \[127.0.0.1\]`)), 1)
+	test.AssertEquals(t, len(log.GetAllMatching(`Resolved addresses for other.valid`)), 0)
+}
+
+func TestRedirectPolicy(t *testing.T) {
+	stats, _ := statsd.NewNoopClient()
+	va := NewValidationAuthorityImpl(&PortConfig{HTTPPort: 5002, HTTPSPort: 5001}, nil, stats, clock.Default())
+
+	testCases := []struct {
+		url     string
+		allowed bool
+	}{
+		{"http://example.com/path", true},
+		{"https://www.example.co.uk/path", true},
+		{"http://example.com:443/path", true},
+		{"http://example.com:5002/path", true},
+		{"https://example.com:5001/path", true},
+		{"http://example.com:8080/path", false},
+		{"http://example.com:0/path", false},
+		{"ftp://example.com/path", false},
+		{"file:///etc/passwd", false},
+		{"http://127.0.0.1/path", false},
+		{"http://[::1]/path", false},
+		{"http://localhost/path", false},
+		{"http://other.valid/path", false},
+		{"http://co.uk/path", false},
+	}
+	for _, tc := range testCases {
+		u, err := url.Parse(tc.url)
+		test.AssertNotError(t, err, "Bad test URL")
+		_, err = va.checkRedirect(u, 1)
+		if tc.allowed {
+			test.AssertNotError(t, err, "Redirect to "+tc.url+" refused")
+		} else {
+			test.AssertError(t, err, "Redirect to "+tc.url+" allowed")
+		}
+	}
+
+	u, _ := url.Parse("http://example.com/path")
+	_, err := va.checkRedirect(u, 11)
+	test.AssertError(t, err, "Eleventh redirect allowed")
+
+	va.RedirectPolicy = RedirectPolicy{MaxRedirects: 2, Ports: []int{8080}, Schemes: []string{"https"}}
+	_, err = va.checkRedirect(u, 1)
+	test.AssertError(t, err, "http redirect allowed with only https configured")
+	u, _ = url.Parse("https://example.com:8080/path")
+	port, err := va.checkRedirect(u, 2)
+	test.AssertNotError(t, err, "Redirect allowed by policy refused")
+	test.AssertEquals(t, port, 8080)
+	_, err = va.checkRedirect(u, 3)
+	test.AssertError(t, err, "Third redirect allowed with MaxRedirects 2")
 }
 
 func TestHTTPRedirectLoop(t *testing.T) {
@@ -373,6 +457,7 @@ func TestHTTPRedirectLoop(t *testing.T) {
 	stats, _ := statsd.NewNoopClient()
 	va := NewValidationAuthorityImpl(&PortConfig{HTTPPort: port}, nil, stats, clock.Default())
 	va.DNSResolver = &mocks.DNSResolver{}
+	va.allowNonPublicRedirects = true
 
 	log.Clear()
 	_, prob := va.validateHTTP01(ident, chall)
@@ -393,6 +478,7 @@ func TestHTTPRedirectUserAgent(t *testing.T) {
 	stats, _ := statsd.NewNoopClient()
 	va := NewValidationAuthorityImpl(&PortConfig{HTTPPort: port}, nil, stats, clock.Default())
 	va.DNSResolver = &mocks.DNSResolver{}
+	va.allowNonPublicRedirects = true
 	va.UserAgent = rejectUserAgent
 
 	setChallengeToken(&chall, pathMoved)
@@ -424,6 +510,13 @@ func getPort(hs *httptest.Server) (int, error) {
 	return int(port), nil
 }
 
+func TestResponseExcerpt(t *testing.T) {
+	test.AssertEquals(t, responseExcerpt([]byte("<html>default vhost</html>")), "<html>default vhost</html>")
+	test.AssertEquals(t, responseExcerpt([]byte("a\x00b\xffc\x1b[31m")), "a?b?c?[31m")
+	long := responseExcerpt([]byte(strings.Repeat("x", maxResponseExcerpt*2)))
+	test.AssertEquals(t, len(long), maxResponseExcerpt)
+}
+
 func TestTLSSNI(t *testing.T) {
 	chall := createChallenge(core.ChallengeTypeTLSSNI01)
 
@@ -433,6 +526,7 @@ func TestTLSSNI(t *testing.T) {
 
 	stats, _ := statsd.NewNoopClient()
 	va := NewValidationAuthorityImpl(&PortConfig{TLSPort: port}, nil, stats, clock.Default())
+	va.AddressPolicy = allowLoopback
 
 	va.DNSResolver = &mocks.DNSResolver{}
 
@@ -444,8 +538,8 @@ func TestTLSSNI(t *testing.T) {
 	test.AssertEquals(t, len(log.GetAllMatching(`Resolved addresses for localhost \[using 127.0.0.1\]: \[127.0.0.1\]`)), 1)
 
 	log.Clear()
-	_, prob = va.validateTLSSNI01(core.AcmeIdentifier{
-		Type:  core.IdentifierType("ip"),
+	_, prob = va.validateTLSSNI01(identifier.ACMEIdentifier{
+		Type:  identifier.Type("ip"),
 		Value: net.JoinHostPort("127.0.0.1", fmt.Sprintf("%d", port)),
 	}, chall)
 	if prob == nil {
@@ -454,7 +548,7 @@ func TestTLSSNI(t *testing.T) {
 	test.AssertEquals(t, prob.Type, probs.MalformedProblem)
 
 	log.Clear()
-	_, prob = va.validateTLSSNI01(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "always.invalid"}, chall)
+	_, prob = va.validateTLSSNI01(identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: "always.invalid"}, chall)
 	if prob == nil {
 		t.Fatalf("Domain name was supposed to be invalid.")
 	}
@@ -506,6 +600,7 @@ func TestTLSError(t *testing.T) {
 	test.AssertNotError(t, err, "failed to get test server port")
 	stats, _ := statsd.NewNoopClient()
 	va := NewValidationAuthorityImpl(&PortConfig{TLSPort: port}, nil, stats, clock.Default())
+	va.AddressPolicy = allowLoopback
 	va.DNSResolver = &mocks.DNSResolver{}
 
 	_, prob := va.validateTLSSNI01(ident, chall)
@@ -525,6 +620,7 @@ func TestValidateHTTP(t *testing.T) {
 	test.AssertNotError(t, err, "failed to get test server port")
 	stats, _ := statsd.NewNoopClient()
 	va := NewValidationAuthorityImpl(&PortConfig{HTTPPort: port}, nil, stats, clock.Default())
+	va.AddressPolicy = allowLoopback
 	va.DNSResolver = &mocks.DNSResolver{}
 	mockRA := &MockRegistrationAuthority{}
 	va.RA = mockRA
@@ -537,9 +633,12 @@ func TestValidateHTTP(t *testing.T) {
 		Identifier:     ident,
 		Challenges:     []core.Challenge{chall},
 	}
-	va.validate(authz, 0)
+	va.validate(ctx, authz, 0)
 
 	test.AssertEquals(t, core.StatusValid, mockRA.lastAuthz.Challenges[0].Status)
+	test.AssertEquals(t, va.metrics.validations.Value(core.ChallengeTypeHTTP01, "valid", "none", "ipv4", "false"), float64(1))
+	test.AssertEquals(t, va.metrics.latency.Count(core.ChallengeTypeHTTP01, "valid"), uint64(1))
+	test.AssertEquals(t, va.metrics.resolutions.Count("ok"), uint64(1))
 }
 
 // challengeType == "tls-sni-00" or "dns-00", since they're the same
@@ -582,6 +681,7 @@ func TestValidateTLSSNI01(t *testing.T) {
 
 	stats, _ := statsd.NewNoopClient()
 	va := NewValidationAuthorityImpl(&PortConfig{TLSPort: port}, nil, stats, clock.Default())
+	va.AddressPolicy = allowLoopback
 	va.DNSResolver = &mocks.DNSResolver{}
 	mockRA := &MockRegistrationAuthority{}
 	va.RA = mockRA
@@ -592,7 +692,7 @@ func TestValidateTLSSNI01(t *testing.T) {
 		Identifier:     ident,
 		Challenges:     []core.Challenge{chall},
 	}
-	va.validate(authz, 0)
+	va.validate(ctx, authz, 0)
 
 	test.AssertEquals(t, core.StatusValid, mockRA.lastAuthz.Challenges[0].Status)
 }
@@ -614,7 +714,7 @@ func TestValidateTLSSNINotSane(t *testing.T) {
 		Identifier:     ident,
 		Challenges:     []core.Challenge{chall},
 	}
-	va.validate(authz, 0)
+	va.validate(ctx, authz, 0)
 
 	test.AssertEquals(t, core.StatusInvalid, mockRA.lastAuthz.Challenges[0].Status)
 }
@@ -639,7 +739,7 @@ func TestUpdateValidations(t *testing.T) {
 	}
 
 	started := time.Now()
-	va.UpdateValidations(authz, 0)
+	va.UpdateValidations(ctx, authz, 0)
 	took := time.Since(started)
 
 	// Check that the call to va.UpdateValidations didn't block for 3 seconds
@@ -651,7 +751,7 @@ func TestCAATimeout(t *testing.T) {
 	va := NewValidationAuthorityImpl(&PortConfig{}, nil, stats, clock.Default())
 	va.DNSResolver = &mocks.DNSResolver{}
 	va.IssuerDomain = "letsencrypt.org"
-	err := va.checkCAA(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "caa-timeout.com"}, 101)
+	err := va.checkCAA(ctx, identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: "caa-timeout.com"}, 101, core.ChallengeTypeHTTP01)
 	if err.Type != probs.ConnectionProblem {
 		t.Errorf("Expected timeout error type %s, got %s", probs.ConnectionProblem, err.Type)
 	}
@@ -685,7 +785,7 @@ func TestCAAChecking(t *testing.T) {
 	va.DNSResolver = &mocks.DNSResolver{}
 	va.IssuerDomain = "letsencrypt.org"
 	for _, caaTest := range tests {
-		present, valid, err := va.CheckCAARecords(core.AcmeIdentifier{Type: "dns", Value: caaTest.Domain})
+		present, valid, err := va.CheckCAARecords(ctx, identifier.ACMEIdentifier{Type: "dns", Value: caaTest.Domain}, 0, "")
 		if err != nil {
 			t.Errorf("CheckCAARecords error for %s: %s", caaTest.Domain, err)
 		}
@@ -698,17 +798,87 @@ func TestCAAChecking(t *testing.T) {
 		}
 	}
 
-	present, valid, err := va.CheckCAARecords(core.AcmeIdentifier{Type: "dns", Value: "servfail.com"})
+	present, valid, err := va.CheckCAARecords(ctx, identifier.ACMEIdentifier{Type: "dns", Value: "servfail.com"}, 0, "")
 	test.AssertError(t, err, "servfail.com")
 	test.Assert(t, !present, "Present should be false")
 	test.Assert(t, !valid, "Valid should be false")
 
-	_, _, err = va.CheckCAARecords(core.AcmeIdentifier{Type: "dns", Value: "servfail.com"})
+	_, _, err = va.CheckCAARecords(ctx, identifier.ACMEIdentifier{Type: "dns", Value: "servfail.com"}, 0, "")
 	if err == nil {
 		t.Errorf("Should have returned error on CAA lookup, but did not: %s", "servfail.com")
 	}
 }
 
+func TestParseCAAIssueValue(t *testing.T) {
+	domain, params, err := parseCAAIssueValue(" letsencrypt.org ; accounturi = https://example.com/acme/reg/1;validationmethods=dns-01 ;")
+	test.AssertNotError(t, err, "Failed to parse CAA value")
+	test.AssertEquals(t, domain, "letsencrypt.org")
+	test.AssertEquals(t, len(params), 2)
+	test.AssertEquals(t, params["accounturi"], "https://example.com/acme/reg/1")
+	test.AssertEquals(t, params["validationmethods"], "dns-01")
+
+	domain, params, err = parseCAAIssueValue(";")
+	test.AssertNotError(t, err, "Failed to parse CAA value forbidding issuance")
+	test.AssertEquals(t, domain, "")
+	test.AssertEquals(t, len(params), 0)
+
+	for _, bad := range []string{"letsencrypt.org; accounturi", "letsencrypt.org; =x", "letsencrypt.org; a=1; a=2"} {
+		_, _, err = parseCAAIssueValue(bad)
+		test.AssertError(t, err, fmt.Sprintf("Parsed malformed CAA value %q", bad))
+	}
+}
+
+func TestCAAParameters(t *testing.T) {
+	stats, _ := statsd.NewNoopClient()
+	va := NewValidationAuthorityImpl(&PortConfig{}, nil, stats, clock.Default())
+	va.DNSResolver = &mocks.DNSResolver{}
+	va.IssuerDomain = "letsencrypt.org"
+	va.AccountURIPrefix = "https://letsencrypt.org/acme/reg/"
+
+	testCases := []struct {
+		domain        string
+		regID         int64
+		challengeType string
+		valid         bool
+	}{
+		// accounturi binds issuance to registration 123
+		{"accounturi.com", 123, core.ChallengeTypeHTTP01, true},
+		{"accounturi.com", 124, core.ChallengeTypeHTTP01, false},
+		// validationmethods binds issuance to DNS and TLS-SNI challenges
+		{"validationmethods.com", 1, core.ChallengeTypeDNS01, true},
+		{"validationmethods.com", 1, core.ChallengeTypeTLSSNI01, true},
+		{"validationmethods.com", 1, core.ChallengeTypeHTTP01, false},
+		// Records without parameters are unaffected
+		{"present.com", 1, core.ChallengeTypeHTTP01, true},
+	}
+	for _, tc := range testCases {
+		prob := va.checkCAA(ctx, identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: tc.domain}, tc.regID, tc.challengeType)
+		if tc.valid && prob != nil {
+			t.Errorf("checkCAA rejected %s for registration %d with %s: %s", tc.domain, tc.regID, tc.challengeType, prob)
+		} else if !tc.valid && prob == nil {
+			t.Errorf("checkCAA accepted %s for registration %d with %s", tc.domain, tc.regID, tc.challengeType)
+		}
+	}
+
+	// CheckCAARecords, used to recheck CAA at issuance, binds its check to
+	// the registration and challenge type given
+	for _, tc := range testCases {
+		present, valid, err := va.CheckCAARecords(ctx, identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: tc.domain}, tc.regID, tc.challengeType)
+		test.AssertNotError(t, err, "CheckCAARecords failed")
+		test.Assert(t, present, "CAA records not found")
+		test.AssertEquals(t, valid, tc.valid)
+	}
+
+	// Without an account or challenge to check against, restricted records
+	// authorize nothing
+	for _, domain := range []string{"accounturi.com", "validationmethods.com"} {
+		present, valid, err := va.CheckCAARecords(ctx, identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: domain}, 0, "")
+		test.AssertNotError(t, err, "CheckCAARecords failed")
+		test.Assert(t, present, "CAA records not found")
+		test.Assert(t, !valid, fmt.Sprintf("Unbound check accepted %s", domain))
+	}
+}
+
 func TestDNSValidationFailure(t *testing.T) {
 	stats, _ := statsd.NewNoopClient()
 	va := NewValidationAuthorityImpl(&PortConfig{}, nil, stats, clock.Default())
@@ -724,7 +894,7 @@ func TestDNSValidationFailure(t *testing.T) {
 		Identifier:     ident,
 		Challenges:     []core.Challenge{chalDNS},
 	}
-	va.validate(authz, 0)
+	va.validate(ctx, authz, 0)
 
 	t.Logf("Resulting Authz: %+v", authz)
 	test.AssertNotNil(t, mockRA.lastAuthz, "Should have gotten an authorization")
@@ -732,9 +902,114 @@ func TestDNSValidationFailure(t *testing.T) {
 	test.AssertEquals(t, authz.Challenges[0].Error.Type, probs.UnauthorizedProblem)
 }
 
+// slowTXTResolver answers TXT lookups after delay, or times out if that's
+// past its timeout.
+type slowTXTResolver struct {
+	mocks.DNSResolver
+	delay   time.Duration
+	timeout time.Duration
+}
+
+func (r *slowTXTResolver) WithTimeout(timeout time.Duration) bdns.DNSResolver {
+	return &slowTXTResolver{delay: r.delay, timeout: timeout}
+}
+
+func (r *slowTXTResolver) LookupTXT(hostname string) ([]string, error) {
+	if r.timeout > 0 && r.delay > r.timeout {
+		time.Sleep(r.timeout)
+		return nil, mocks.TimeoutError()
+	}
+	time.Sleep(r.delay)
+	return r.DNSResolver.LookupTXT(hostname)
+}
+
+func TestDNSValidationTimeout(t *testing.T) {
+	stats, _ := statsd.NewNoopClient()
+	va := NewValidationAuthorityImpl(&PortConfig{}, nil, stats, clock.Default())
+	va.DNSResolver = &slowTXTResolver{delay: time.Second}
+	va.Challenges = map[string]ChallengeConfig{
+		core.ChallengeTypeDNS01: {Timeout: 20 * time.Millisecond},
+	}
+
+	chalDNS := createChallenge(core.ChallengeTypeDNS01)
+	_, prob := va.validateDNS01(ident, chalDNS)
+	test.AssertNotNil(t, prob, "Validation outlasting its timeout succeeded")
+	test.AssertEquals(t, prob.Type, probs.ConnectionProblem)
+	test.AssertEquals(t, prob.Detail, "DNS query timed out")
+}
+
+// accountTXTResolver answers TXT lookups of name with txts.
+type accountTXTResolver struct {
+	mocks.DNSResolver
+	name string
+	txts []string
+}
+
+func (r *accountTXTResolver) LookupTXT(hostname string) ([]string, error) {
+	if hostname == r.name {
+		return r.txts, nil
+	}
+	return r.DNSResolver.LookupTXT(hostname)
+}
+
+func TestDNSAccountValidation(t *testing.T) {
+	stats, _ := statsd.NewNoopClient()
+	va := NewValidationAuthorityImpl(&PortConfig{}, nil, stats, clock.Default())
+	chall := createChallenge(core.ChallengeTypeDNSAccount01)
+	h := sha256.Sum256([]byte(chall.KeyAuthorization.String()))
+	digest := hex.EncodeToString(h[:])
+
+	// The VA needs the account's URI
+	_, prob := va.withAccount(1, "abc").validateDNSAccount01(ident, chall)
+	test.AssertNotNil(t, prob, "Validated without an account URI prefix")
+	test.AssertEquals(t, prob.Type, probs.ServerInternalProblem)
+
+	va.AccountURIPrefix = "https://example.com/acme/reg/"
+	va.DNSResolver = &accountTXTResolver{
+		name: "_kjre2ghbcq._acme-challenge." + ident.Value,
+		txts: []string{digest},
+	}
+	_, prob = va.withAccount(1, "abc").validateDNSAccount01(ident, chall)
+	test.Assert(t, prob == nil, fmt.Sprintf("Validation failed: %v", prob))
+
+	// Another account's record doesn't validate
+	_, prob = va.withAccount(2, "abc").validateDNSAccount01(ident, chall)
+	test.AssertNotNil(t, prob, "Validated with another account's record")
+	test.AssertEquals(t, prob.Type, probs.UnauthorizedProblem)
+}
+
+func TestChallengeConfig(t *testing.T) {
+	stats, _ := statsd.NewNoopClient()
+	va := NewValidationAuthorityImpl(&PortConfig{HTTPPort: 5002, TLSPort: 5001}, nil, stats, clock.Default())
+
+	// Unset values take the defaults
+	test.AssertEquals(t, va.challengeConfig(core.ChallengeTypeHTTP01), ChallengeConfig{
+		Port: 5002, Timeout: validationTimeout, ConnectTimeout: validationTimeout,
+	})
+	test.AssertEquals(t, va.challengeConfig(core.ChallengeTypeTLSSNI01), ChallengeConfig{
+		Port: 5001, Timeout: validationTimeout, ConnectTimeout: validationTimeout,
+	})
+	test.AssertEquals(t, va.challengeConfig(core.ChallengeTypeDNS01), ChallengeConfig{Timeout: validationTimeout})
+
+	va.Challenges = map[string]ChallengeConfig{
+		core.ChallengeTypeHTTP01:   {Port: 8080, Timeout: time.Second},
+		core.ChallengeTypeTLSSNI01: {ConnectTimeout: time.Second},
+		core.ChallengeTypeDNS01:    {Port: 53, Timeout: time.Second, ConnectTimeout: time.Second},
+	}
+	test.AssertEquals(t, va.challengeConfig(core.ChallengeTypeHTTP01), ChallengeConfig{
+		Port: 8080, Timeout: time.Second, ConnectTimeout: validationTimeout,
+	})
+	test.AssertEquals(t, va.challengeConfig(core.ChallengeTypeTLSSNI01), ChallengeConfig{
+		Port: 5001, Timeout: validationTimeout, ConnectTimeout: time.Second,
+	})
+	// dns-01 probes have no port or connections of their own
+	test.AssertEquals(t, va.challengeConfig(core.ChallengeTypeDNS01), ChallengeConfig{Timeout: time.Second})
+	test.AssertEquals(t, va.challengeConfig(core.ChallengeTypeEmailReply00), ChallengeConfig{})
+}
+
 func TestDNSValidationInvalid(t *testing.T) {
-	var notDNS = core.AcmeIdentifier{
-		Type:  core.IdentifierType("iris"),
+	var notDNS = identifier.ACMEIdentifier{
+		Type:  identifier.Type("iris"),
 		Value: "790DB180-A274-47A4-855F-31C428CB1072",
 	}
 
@@ -753,7 +1028,7 @@ func TestDNSValidationInvalid(t *testing.T) {
 	mockRA := &MockRegistrationAuthority{}
 	va.RA = mockRA
 
-	va.validate(authz, 0)
+	va.validate(ctx, authz, 0)
 
 	test.AssertNotNil(t, mockRA.lastAuthz, "Should have gotten an authorization")
 	test.Assert(t, authz.Challenges[0].Status == core.StatusInvalid, "Should be invalid.")
@@ -781,7 +1056,7 @@ func TestDNSValidationNotSane(t *testing.T) {
 	}
 
 	for i := 0; i < len(authz.Challenges); i++ {
-		va.validate(authz, i)
+		va.validate(ctx, authz, i)
 		test.AssertEquals(t, authz.Challenges[i].Status, core.StatusInvalid)
 		test.AssertEquals(t, authz.Challenges[i].Error.Type, probs.MalformedProblem)
 	}
@@ -796,7 +1071,7 @@ func TestDNSValidationServFail(t *testing.T) {
 
 	chalDNS := createChallenge(core.ChallengeTypeDNS01)
 
-	badIdent := core.AcmeIdentifier{
+	badIdent := identifier.ACMEIdentifier{
 		Type:  core.IdentifierDNS,
 		Value: "servfail.com",
 	}
@@ -806,7 +1081,7 @@ func TestDNSValidationServFail(t *testing.T) {
 		Identifier:     badIdent,
 		Challenges:     []core.Challenge{chalDNS},
 	}
-	va.validate(authz, 0)
+	va.validate(ctx, authz, 0)
 
 	test.AssertNotNil(t, mockRA.lastAuthz, "Should have gotten an authorization")
 	test.Assert(t, authz.Challenges[0].Status == core.StatusInvalid, "Should be invalid.")
@@ -829,7 +1104,7 @@ func TestDNSValidationNoServer(t *testing.T) {
 		Identifier:     ident,
 		Challenges:     []core.Challenge{chalDNS},
 	}
-	va.validate(authz, 0)
+	va.validate(ctx, authz, 0)
 
 	test.AssertNotNil(t, mockRA.lastAuthz, "Should have gotten an authorization")
 	test.Assert(t, authz.Challenges[0].Status == core.StatusInvalid, "Should be invalid.")
@@ -850,13 +1125,13 @@ func TestDNSValidationLive(t *testing.T) {
 	// This token is set at _acme-challenge.good.bin.coffee
 	goodChalDNS.Token = "yfCBb-bRTLz8Wd1C0lTUQK3qlKj3-t2tYGwx5Hj7r_w"
 
-	var goodIdent = core.AcmeIdentifier{
+	var goodIdent = identifier.ACMEIdentifier{
 		Type:  core.IdentifierDNS,
 		Value: "good.bin.coffee",
 	}
 
-	var badIdent = core.AcmeIdentifier{
-		Type:  core.IdentifierType("dns"),
+	var badIdent = identifier.ACMEIdentifier{
+		Type:  identifier.Type("dns"),
 		Value: "bad.bin.coffee",
 	}
 
@@ -867,7 +1142,7 @@ func TestDNSValidationLive(t *testing.T) {
 		Challenges:     []core.Challenge{goodChalDNS},
 	}
 
-	va.validate(authzGood, 0)
+	va.validate(ctx, authzGood, 0)
 
 	if authzGood.Challenges[0].Status != core.StatusValid {
 		t.Logf("TestDNSValidationLive on Good did not succeed.")
@@ -884,7 +1159,7 @@ func TestDNSValidationLive(t *testing.T) {
 		Challenges:     []core.Challenge{badChalDNS},
 	}
 
-	va.validate(authzBad, 0)
+	va.validate(ctx, authzBad, 0)
 	if authzBad.Challenges[0].Status != core.StatusInvalid {
 		t.Logf("TestDNSValidationLive on Bad did succeed inappropriately.")
 	}
@@ -911,44 +1186,353 @@ func TestCAAFailure(t *testing.T) {
 		Identifier:     ident,
 		Challenges:     []core.Challenge{chall},
 	}
-	va.validate(authz, 0)
+	va.validate(ctx, authz, 0)
 
 	test.AssertEquals(t, core.StatusInvalid, mockRA.lastAuthz.Challenges[0].Status)
 }
 
+// mockRemoteVA answers every validation with prob and transcript, or fails
+// with err.
+type mockRemoteVA struct {
+	prob       *probs.ProblemDetails
+	transcript *core.ValidationTranscript
+	err        error
+}
+
+func (m mockRemoteVA) PerformValidation(ctx context.Context, req *core.PerformValidationRequest) (*core.PerformValidationResponse, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &core.PerformValidationResponse{Problem: m.prob, Transcript: m.transcript}, nil
+}
+
+func TestRemoteValidation(t *testing.T) {
+	chall := core.HTTPChallenge01(accountKey)
+	err := setChallengeToken(&chall, core.NewToken())
+	test.AssertNotError(t, err, "Failed to complete HTTP challenge")
+
+	hs := httpSrv(t, chall.Token)
+	defer hs.Close()
+	port, err := getPort(hs)
+	test.AssertNotError(t, err, "failed to get test server port")
+
+	stats, _ := statsd.NewNoopClient()
+	va := NewValidationAuthorityImpl(&PortConfig{HTTPPort: port}, nil, stats, clock.Default())
+	va.AddressPolicy = allowLoopback
+	va.DNSResolver = &mocks.DNSResolver{}
+	mockRA := &MockRegistrationAuthority{}
+	va.RA = mockRA
+
+	good := mockRemoteVA{}
+	hijacked := mockRemoteVA{prob: probs.Unauthorized("Invalid response")}
+	unreachable := mockRemoteVA{err: errors.New("RPC timed out")}
+	testCases := []struct {
+		remotes []core.RemoteValidator
+		quorum  int
+		valid   bool
+	}{
+		{[]core.RemoteValidator{good, good}, 0, true},
+		{[]core.RemoteValidator{good, hijacked}, 0, false},
+		{[]core.RemoteValidator{good, hijacked}, 1, true},
+		{[]core.RemoteValidator{good, good, unreachable}, 2, true},
+		{[]core.RemoteValidator{good, unreachable, hijacked}, 2, false},
+		{[]core.RemoteValidator{hijacked}, 5, false},
+	}
+	for i, tc := range testCases {
+		va.RemoteVAs = tc.remotes
+		va.RemoteQuorum = tc.quorum
+		authz := core.Authorization{
+			ID:             core.NewToken(),
+			RegistrationID: 1,
+			Identifier:     identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: "localhost"},
+			Challenges:     []core.Challenge{chall},
+		}
+		va.validate(ctx, authz, 0)
+		result := mockRA.lastAuthz.Challenges[0]
+		if !tc.valid {
+			test.AssertEquals(t, result.Status, core.StatusInvalid)
+			test.Assert(t, strings.HasPrefix(result.Error.Detail, "During secondary validation: "),
+				fmt.Sprintf("case %d: wrong problem detail %q", i, result.Error.Detail))
+			continue
+		}
+		test.AssertEquals(t, result.Status, core.StatusValid)
+	}
+}
+
+// stalledRemoteVA never answers before ctx is done.
+type stalledRemoteVA struct{}
+
+func (stalledRemoteVA) PerformValidation(ctx context.Context, req *core.PerformValidationRequest) (*core.PerformValidationResponse, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestValidationDeadline(t *testing.T) {
+	chall := core.HTTPChallenge01(accountKey)
+	err := setChallengeToken(&chall, core.NewToken())
+	test.AssertNotError(t, err, "Failed to complete HTTP challenge")
+
+	hs := httpSrv(t, chall.Token)
+	defer hs.Close()
+	port, err := getPort(hs)
+	test.AssertNotError(t, err, "failed to get test server port")
+
+	stats, _ := statsd.NewNoopClient()
+	va := NewValidationAuthorityImpl(&PortConfig{HTTPPort: port}, nil, stats, clock.Default())
+	va.AddressPolicy = allowLoopback
+	va.DNSResolver = &mocks.DNSResolver{}
+	mockRA := &MockRegistrationAuthority{}
+	va.RA = mockRA
+	va.RemoteVAs = []core.RemoteValidator{stalledRemoteVA{}}
+	va.Deadline = 50 * time.Millisecond
+
+	authz := core.Authorization{
+		ID:             core.NewToken(),
+		RegistrationID: 1,
+		Identifier:     ident,
+		Challenges:     []core.Challenge{chall},
+	}
+	va.validate(ctx, authz, 0)
+	result := mockRA.lastAuthz.Challenges[0]
+	test.AssertEquals(t, result.Status, core.StatusInvalid)
+	test.AssertEquals(t, result.Error.Detail, detailDeadlineExceeded)
+}
+
+// cachingDNSResolver counts the caches started from it, each of which
+// answers as it does.
+type cachingDNSResolver struct {
+	mocks.DNSResolver
+	caches int32
+}
+
+func (r *cachingDNSResolver) WithCache() bdns.DNSResolver {
+	atomic.AddInt32(&r.caches, 1)
+	return &mocks.DNSResolver{}
+}
+
+func TestValidationDNSCache(t *testing.T) {
+	chall := core.HTTPChallenge01(accountKey)
+	err := setChallengeToken(&chall, core.NewToken())
+	test.AssertNotError(t, err, "Failed to complete HTTP challenge")
+
+	hs := httpSrv(t, chall.Token)
+	defer hs.Close()
+	port, err := getPort(hs)
+	test.AssertNotError(t, err, "failed to get test server port")
+
+	stats, _ := statsd.NewNoopClient()
+	va := NewValidationAuthorityImpl(&PortConfig{HTTPPort: port}, nil, stats, clock.Default())
+	va.AddressPolicy = allowLoopback
+	resolver := &cachingDNSResolver{}
+	va.DNSResolver = resolver
+	mockRA := &MockRegistrationAuthority{}
+	va.RA = mockRA
+
+	authz := core.Authorization{
+		ID:             core.NewToken(),
+		RegistrationID: 1,
+		Identifier:     ident,
+		Challenges:     []core.Challenge{chall, chall},
+		Combinations:   [][]int{{0, 1}},
+	}
+
+	// The challenges validated together share one cache, which is dropped
+	// with the validation
+	va.validate(ctx, authz, 0)
+	test.AssertEquals(t, mockRA.lastAuthz.Challenges[0].Status, core.StatusValid)
+	test.AssertEquals(t, atomic.LoadInt32(&resolver.caches), int32(1))
+	test.AssertEquals(t, va.DNSResolver, bdns.DNSResolver(resolver))
+
+	va.validate(ctx, authz, 0)
+	test.AssertEquals(t, atomic.LoadInt32(&resolver.caches), int32(2))
+}
+
+func TestValidateCombination(t *testing.T) {
+	chall := core.HTTPChallenge01(accountKey)
+	err := setChallengeToken(&chall, core.NewToken())
+	test.AssertNotError(t, err, "Failed to complete HTTP challenge")
+
+	hs := httpSrv(t, chall.Token)
+	defer hs.Close()
+	port, err := getPort(hs)
+	test.AssertNotError(t, err, "failed to get test server port")
+
+	stats, _ := statsd.NewNoopClient()
+	va := NewValidationAuthorityImpl(&PortConfig{HTTPPort: port}, nil, stats, clock.Default())
+	va.AddressPolicy = allowLoopback
+	va.DNSResolver = &mocks.DNSResolver{}
+	mockRA := &MockRegistrationAuthority{}
+	va.RA = mockRA
+
+	unanswered := core.HTTPChallenge01(accountKey)
+	unanswered.Token = core.NewToken()
+	authz := core.Authorization{
+		ID:             core.NewToken(),
+		RegistrationID: 1,
+		Identifier:     ident,
+		Challenges:     []core.Challenge{chall, chall, unanswered},
+		Combinations:   [][]int{{0, 1}, {2}},
+	}
+
+	// Responding to one challenge of a combination validates the others
+	// that have been responded to along with it
+	va.validate(ctx, authz, 0)
+	test.AssertEquals(t, mockRA.lastAuthz.Challenges[0].Status, core.StatusValid)
+	test.AssertEquals(t, mockRA.lastAuthz.Challenges[1].Status, core.StatusValid)
+	test.AssertEquals(t, mockRA.lastAuthz.Challenges[2].Status, core.StatusPending)
+}
+
+func TestPerformValidation(t *testing.T) {
+	stats, _ := statsd.NewNoopClient()
+	va := NewValidationAuthorityImpl(&PortConfig{}, nil, stats, clock.Default())
+	va.DNSResolver = &mocks.DNSResolver{}
+
+	// Failures are reported in the response, for the primary VA to count
+	resp, err := va.PerformValidation(ctx, &core.PerformValidationRequest{
+		Identifier:     identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: "localhost"},
+		Challenge:      createChallenge(core.ChallengeTypeDNS01),
+		RegistrationID: 1,
+	})
+	test.AssertNotError(t, err, "PerformValidation failed")
+	test.AssertNotNil(t, resp.Problem, "Should have gotten a problem")
+	test.AssertEquals(t, resp.Problem.Type, probs.UnauthorizedProblem)
+}
+
 type MockRegistrationAuthority struct {
 	lastAuthz *core.Authorization
 }
 
-func (ra *MockRegistrationAuthority) NewRegistration(reg core.Registration) (core.Registration, error) {
+func (ra *MockRegistrationAuthority) NewRegistration(ctx context.Context, reg core.Registration) (core.Registration, error) {
 	return reg, nil
 }
 
-func (ra *MockRegistrationAuthority) NewAuthorization(authz core.Authorization, regID int64) (core.Authorization, error) {
+func (ra *MockRegistrationAuthority) NewAuthorization(ctx context.Context, authz core.Authorization, regID int64) (core.Authorization, error) {
 	return authz, nil
 }
 
-func (ra *MockRegistrationAuthority) NewCertificate(req core.CertificateRequest, regID int64) (core.Certificate, error) {
+func (ra *MockRegistrationAuthority) NewAuthorizations(ctx context.Context, authzs []core.Authorization, regID int64) ([]core.Authorization, error) {
+	return authzs, nil
+}
+
+func (ra *MockRegistrationAuthority) NewCertificate(ctx context.Context, req core.CertificateRequest, regID int64) (core.Certificate, error) {
 	return core.Certificate{}, nil
 }
 
-func (ra *MockRegistrationAuthority) UpdateRegistration(reg core.Registration, updated core.Registration) (core.Registration, error) {
+func (ra *MockRegistrationAuthority) NewCertificateOrder(ctx context.Context, req core.CertificateRequest, regID int64) (core.CertificateOrder, error) {
+	return core.CertificateOrder{ID: "processing", RegistrationID: regID, Status: core.StatusProcessing}, nil
+}
+
+func (ra *MockRegistrationAuthority) UpdateRegistration(ctx context.Context, reg core.Registration, updated core.Registration) (core.Registration, error) {
 	return reg, nil
 }
 
-func (ra *MockRegistrationAuthority) UpdateAuthorization(authz core.Authorization, foo int, challenge core.Challenge) (core.Authorization, error) {
+func (ra *MockRegistrationAuthority) UpdateAuthorization(ctx context.Context, authz core.Authorization, foo int, challenge core.Challenge) (core.Authorization, error) {
 	return authz, nil
 }
 
-func (ra *MockRegistrationAuthority) RevokeCertificateWithReg(cert x509.Certificate, reason core.RevocationCode, reg int64) error {
+func (ra *MockRegistrationAuthority) RevokeCertificateWithReg(ctx context.Context, cert x509.Certificate, reason core.RevocationCode, reg int64) error {
+	return nil
+}
+
+func (ra *MockRegistrationAuthority) AdministrativelyRevokeCertificate(ctx context.Context, cert x509.Certificate, reason core.RevocationCode, user string) error {
+	return nil
+}
+
+func (ra *MockRegistrationAuthority) AdministrativelyReleaseCertificateHold(ctx context.Context, cert x509.Certificate, user string) error {
+	return nil
+}
+
+func (ra *MockRegistrationAuthority) AdministrativelyRevokeCertificatesByKey(ctx context.Context, keyHash string, user string) error {
+	return nil
+}
+
+func (ra *MockRegistrationAuthority) AdministrativelyBlockKey(ctx context.Context, keyHash string, user string) error {
+	return nil
+}
+
+func (ra *MockRegistrationAuthority) AdministrativelyDenyNames(ctx context.Context, names []string, user string) error {
+	return nil
+}
+
+func (ra *MockRegistrationAuthority) AdministrativelySetAccountTier(ctx context.Context, regID int64, tier core.AccountTier, user string) error {
+	return nil
+}
+
+func (ra *MockRegistrationAuthority) AdministrativelySetRateLimitOverride(ctx context.Context, override core.RateLimitOverride, user string) error {
+	return nil
+}
+
+func (ra *MockRegistrationAuthority) AdministrativelyRemoveRateLimitOverride(ctx context.Context, limit, key string, regID int64, user string) error {
+	return nil
+}
+
+func (ra *MockRegistrationAuthority) AdministrativelyReviewAuthorization(ctx context.Context, authzID string, approve bool, user string) error {
+	return nil
+}
+
+func (ra *MockRegistrationAuthority) DeactivateAuthorization(ctx context.Context, authz core.Authorization) error {
 	return nil
 }
 
-func (ra *MockRegistrationAuthority) AdministrativelyRevokeCertificate(cert x509.Certificate, reason core.RevocationCode, user string) error {
+func (ra *MockRegistrationAuthority) VerifyContact(ctx context.Context, regID int64, contact string) error {
 	return nil
 }
 
-func (ra *MockRegistrationAuthority) OnValidationUpdate(authz core.Authorization) error {
+func (ra *MockRegistrationAuthority) OnValidationUpdate(ctx context.Context, authz core.Authorization) error {
 	ra.lastAuthz = &authz
 	return nil
 }
+
+func TestEmailReplyValidation(t *testing.T) {
+	stats, _ := statsd.NewNoopClient()
+	va := NewValidationAuthorityImpl(&PortConfig{}, nil, stats, clock.Default())
+	va.DNSResolver = &mocks.DNSResolver{}
+	mockRA := &MockRegistrationAuthority{}
+	va.RA = mockRA
+	mailboxTokens, err := bmail.NewMailboxTokens([]byte("0123456789abcdef"))
+	test.AssertNotError(t, err, "Failed to create mailbox tokens")
+	va.MailboxTokens = mailboxTokens
+
+	address := identifier.ACMEIdentifier{Type: core.IdentifierEmail, Value: "alice@example.com"}
+	// respond answers an email-reply-00 challenge, prefixing its token with
+	// the one mailed(token) returns
+	respond := func(mailed func(token string) string) core.Authorization {
+		chall := core.EmailReplyChallenge00(accountKey)
+		ka, err := core.NewKeyAuthorization(mailed(chall.Token)+chall.Token, accountKey)
+		test.AssertNotError(t, err, "Failed to make key authorization")
+		chall.KeyAuthorization = &ka
+		return core.Authorization{
+			ID:             core.NewToken(),
+			RegistrationID: 1,
+			Identifier:     address,
+			Challenges:     []core.Challenge{chall},
+		}
+	}
+	mailedToAlice := func(token string) string { return mailboxTokens.Token(address.Value, token) }
+	random := func(string) string { return core.NewToken() }
+
+	// A response with the mailed token validates
+	authz := respond(mailedToAlice)
+	va.validate(ctx, authz, 0)
+	test.AssertEquals(t, authz.Challenges[0].Status, core.StatusValid)
+
+	// A response with any other token doesn't
+	authz = respond(random)
+	va.validate(ctx, authz, 0)
+	test.AssertEquals(t, authz.Challenges[0].Status, core.StatusInvalid)
+	test.AssertEquals(t, authz.Challenges[0].Error.Type, probs.UnauthorizedProblem)
+
+	// Nor does a token mailed to another address
+	authz = respond(mailedToAlice)
+	authz.Identifier = identifier.ACMEIdentifier{Type: core.IdentifierEmail, Value: "bob@example.com"}
+	va.validate(ctx, authz, 0)
+	test.AssertEquals(t, authz.Challenges[0].Status, core.StatusInvalid)
+	test.AssertEquals(t, authz.Challenges[0].Error.Type, probs.UnauthorizedProblem)
+
+	// DNS identifiers can't be validated by email
+	authz = respond(random)
+	authz.Identifier = ident
+	va.validate(ctx, authz, 0)
+	test.AssertEquals(t, authz.Challenges[0].Status, core.StatusInvalid)
+	test.AssertEquals(t, authz.Challenges[0].Error.Type, probs.MalformedProblem)
+}
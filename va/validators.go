@@ -0,0 +1,110 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/identifier"
+	"github.com/letsencrypt/boulder/probs"
+)
+
+// Validator validates the challenges of one of the challenge types
+// registered with core.RegisterChallengeType. Validators are registered with
+// RegisterValidator under the name of their type, and the VA validates each
+// challenge with the validator of its type.
+type Validator interface {
+	// Validate validates challenge, one for identifier, returning the
+	// records of the attempts it made.
+	Validate(va *ValidationAuthorityImpl, identifier identifier.ACMEIdentifier, challenge core.Challenge) ([]core.ValidationRecord, *probs.ProblemDetails)
+	// DefaultPort returns the port of the validated host that va's probes
+	// of the type connect to unless configured otherwise, or zero if they
+	// make no connections of their own, as for those that query the VA's
+	// resolvers. Only the timeout of those can be configured.
+	DefaultPort(va *ValidationAuthorityImpl) int
+	// Configurable reports whether the type's probes can be configured
+	// with a ChallengeConfig at all.
+	Configurable() bool
+}
+
+var validators = struct {
+	sync.RWMutex
+	byName map[string]Validator
+}{byName: make(map[string]Validator)}
+
+// RegisterValidator registers v as the validator of the challenge type
+// named challengeType. It panics if the type isn't registered with core, or
+// already has a validator.
+func RegisterValidator(challengeType string, v Validator) {
+	if !core.ValidChallenge(challengeType) {
+		panic(fmt.Sprintf("Validator registered for unknown challenge type %q", challengeType))
+	}
+	validators.Lock()
+	defer validators.Unlock()
+	if _, ok := validators.byName[challengeType]; ok {
+		panic(fmt.Sprintf("Validator for challenge type %q registered twice", challengeType))
+	}
+	validators.byName[challengeType] = v
+}
+
+// ValidatorFor returns the validator registered for the challenge type
+// named challengeType, if there is one.
+func ValidatorFor(challengeType string) (Validator, bool) {
+	validators.RLock()
+	defer validators.RUnlock()
+	v, ok := validators.byName[challengeType]
+	return v, ok
+}
+
+// builtinValidator is the validator of one of the challenge types the VA
+// implements itself.
+type builtinValidator struct {
+	validate     func(*ValidationAuthorityImpl, identifier.ACMEIdentifier, core.Challenge) ([]core.ValidationRecord, *probs.ProblemDetails)
+	defaultPort  func(*ValidationAuthorityImpl) int // Nil if it makes no connections
+	configurable bool
+}
+
+func (bv builtinValidator) Validate(va *ValidationAuthorityImpl, identifier identifier.ACMEIdentifier, challenge core.Challenge) ([]core.ValidationRecord, *probs.ProblemDetails) {
+	return bv.validate(va, identifier, challenge)
+}
+
+func (bv builtinValidator) DefaultPort(va *ValidationAuthorityImpl) int {
+	if bv.defaultPort == nil {
+		return 0
+	}
+	return bv.defaultPort(va)
+}
+
+func (bv builtinValidator) Configurable() bool {
+	return bv.configurable
+}
+
+func init() {
+	RegisterValidator(core.ChallengeTypeHTTP01, builtinValidator{
+		validate:     (*ValidationAuthorityImpl).validateHTTP01,
+		defaultPort:  func(va *ValidationAuthorityImpl) int { return va.httpPort },
+		configurable: true,
+	})
+	RegisterValidator(core.ChallengeTypeTLSSNI01, builtinValidator{
+		validate:     (*ValidationAuthorityImpl).validateTLSSNI01,
+		defaultPort:  func(va *ValidationAuthorityImpl) int { return va.tlsPort },
+		configurable: true,
+	})
+	RegisterValidator(core.ChallengeTypeDNS01, builtinValidator{
+		validate:     (*ValidationAuthorityImpl).validateDNS01,
+		configurable: true,
+	})
+	RegisterValidator(core.ChallengeTypeDNSAccount01, builtinValidator{
+		validate:     (*ValidationAuthorityImpl).validateDNSAccount01,
+		configurable: true,
+	})
+	// Replies to email-reply-00 challenges arrive when they arrive
+	RegisterValidator(core.ChallengeTypeEmailReply00, builtinValidator{
+		validate: (*ValidationAuthorityImpl).validateEmailReply00,
+	})
+}
@@ -0,0 +1,72 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"testing"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/identifier"
+	"github.com/letsencrypt/boulder/probs"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// testChallenge is a challenge type that any DNS identifier's key
+// authorization validates.
+type testChallenge struct{}
+
+func (testChallenge) Name() string                                     { return "test-validator-00" }
+func (testChallenge) Offers(id identifier.ACMEIdentifier) bool         { return id.Type == core.IdentifierDNS }
+func (testChallenge) RecordsSane(records []core.ValidationRecord) bool { return true }
+func (testChallenge) ResponseToken(ch core.Challenge) (string, bool)   { return ch.Token, true }
+
+// testValidator validates testChallenges by connecting to port 7000.
+type testValidator struct {
+	validated []string
+}
+
+func (tv *testValidator) Validate(va *ValidationAuthorityImpl, identifier identifier.ACMEIdentifier, challenge core.Challenge) ([]core.ValidationRecord, *probs.ProblemDetails) {
+	tv.validated = append(tv.validated, identifier.Value)
+	return []core.ValidationRecord{{Hostname: identifier.Value}}, nil
+}
+
+func (tv *testValidator) DefaultPort(va *ValidationAuthorityImpl) int { return 7000 }
+func (tv *testValidator) Configurable() bool                          { return true }
+
+func TestRegisterValidator(t *testing.T) {
+	// Every built in challenge type has a validator
+	for _, ct := range core.ChallengeTypes() {
+		_, ok := ValidatorFor(ct.Name())
+		test.Assert(t, ok, "No validator for "+ct.Name())
+	}
+
+	func() {
+		defer func() {
+			test.Assert(t, recover() != nil, "Registered a validator for an unknown challenge type")
+		}()
+		RegisterValidator("test-validator-00", &testValidator{})
+	}()
+	core.RegisterChallengeType(testChallenge{})
+	tv := &testValidator{}
+	RegisterValidator("test-validator-00", tv)
+
+	stats, _ := statsd.NewNoopClient()
+	va := NewValidationAuthorityImpl(&PortConfig{}, nil, stats, clock.Default())
+	test.AssertEquals(t, va.challengeConfig("test-validator-00"), ChallengeConfig{
+		Port: 7000, Timeout: validationTimeout, ConnectTimeout: validationTimeout,
+	})
+
+	chall := core.NewChallenge("test-validator-00", accountKey)
+	ka, err := core.NewKeyAuthorization(chall.Token, accountKey)
+	test.AssertNotError(t, err, "Failed to make key authorization")
+	chall.KeyAuthorization = &ka
+	records, prob := va.validateChallenge(identifier.ACMEIdentifier{Type: core.IdentifierDNS, Value: "example.com"}, chall)
+	test.Assert(t, prob == nil, "Failed to validate with a registered validator")
+	test.AssertEquals(t, len(records), 1)
+	test.AssertDeepEquals(t, tv.validated, []string{"example.com"})
+}
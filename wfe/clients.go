@@ -0,0 +1,288 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package wfe
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/letsencrypt/boulder/probs"
+)
+
+// Defaults of the ClientPolicy fields left zero.
+const (
+	defaultClientWindow        = time.Hour
+	defaultClientMinRequests   = 100
+	defaultClientMaxErrorRatio = 0.5
+)
+
+// maxTrackedClients bounds how many client versions are counted apart, in
+// the tracker and as metric labels. The first seen keep their own names for
+// as long as the WFE runs, whatever window they're counted in, so that the
+// metric labels stay bounded; requests from any others are counted under
+// otherClient.
+const maxTrackedClients = 500
+
+const (
+	// noClient is counted for requests without a User-Agent
+	noClient = "none"
+	// otherClient is counted for client versions past maxTrackedClients
+	otherClient = "other"
+)
+
+// ClientPolicy decides which client versions are misbehaving: those that,
+// within a Window, make at least MinRequests requests of which more than
+// MaxErrorRatio get badNonce or malformed problems. Zero values take the
+// defaults of one hour, 100 requests and a half.
+type ClientPolicy struct {
+	Window        time.Duration
+	MinRequests   int
+	MaxErrorRatio float64
+}
+
+func (p ClientPolicy) window() time.Duration {
+	if p.Window <= 0 {
+		return defaultClientWindow
+	}
+	return p.Window
+}
+
+func (p ClientPolicy) misbehaving(c *clientCount) bool {
+	minRequests, maxRatio := p.MinRequests, p.MaxErrorRatio
+	if minRequests <= 0 {
+		minRequests = defaultClientMinRequests
+	}
+	if maxRatio <= 0 {
+		maxRatio = defaultClientMaxErrorRatio
+	}
+	return c.Requests >= minRequests && c.errorRatio() > maxRatio
+}
+
+// clientName normalizes a User-Agent to the name and version of the client
+// that sent it, taken from its first product token and lowercased, e.g.
+// "LetsEncryptPythonClient/0.1.0 (Ubuntu 14.04)" is
+// "letsencryptpythonclient/0.1.0". Anything but letters, digits, ".", "-" and "_"
+// is dropped, and each part is cut short, so that clients can't make
+// arbitrarily many or long names.
+func clientName(userAgent string) string {
+	fields := strings.Fields(userAgent)
+	if len(fields) == 0 {
+		return noClient
+	}
+	product := fields[0]
+	var name, version string
+	if i := strings.Index(product, "/"); i >= 0 {
+		name, version = product[:i], product[i+1:]
+	} else {
+		name = product
+	}
+	name, version = clientToken(name), clientToken(version)
+	if name == "" {
+		return noClient
+	}
+	if version == "" {
+		return name
+	}
+	return name + "/" + version
+}
+
+// clientToken lowercases s and keeps at most 32 of its letters, digits,
+// ".", "-" and "_".
+func clientToken(s string) string {
+	var token []byte
+	for _, c := range []byte(strings.ToLower(s)) {
+		if len(token) == 32 {
+			break
+		}
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '.' || c == '-' || c == '_' {
+			token = append(token, c)
+		}
+	}
+	return string(token)
+}
+
+// clientCount counts the requests of one client version since Since, and
+// those answered with the problems misbehaving clients are known by.
+type clientCount struct {
+	Client      string    `json:"client"`
+	Since       time.Time `json:"since"`
+	Requests    int       `json:"requests"`
+	BadNonce    int       `json:"badNonce"`
+	Malformed   int       `json:"malformed"`
+	Misbehaving bool      `json:"misbehaving"`
+}
+
+func (c *clientCount) errors() int {
+	return c.BadNonce + c.Malformed
+}
+
+func (c *clientCount) errorRatio() float64 {
+	if c.Requests == 0 {
+		return 0
+	}
+	return float64(c.errors()) / float64(c.Requests)
+}
+
+// clientTracker counts requests and problems per client version over the
+// ClientPolicy's window. Like the poll counts, they're kept by each WFE
+// instance. named holds the client versions counted under their own names,
+// which it keeps from window to window.
+type clientTracker struct {
+	mu      sync.Mutex
+	start   time.Time
+	clients map[string]*clientCount
+	named   map[string]bool
+}
+
+func newClientTracker() *clientTracker {
+	return &clientTracker{
+		clients: make(map[string]*clientCount),
+		named:   make(map[string]bool),
+	}
+}
+
+// count returns the count of client, starting a new window of counts if
+// the current one has run its course. It must be called with mu held.
+func (ct *clientTracker) count(policy ClientPolicy, now time.Time, client string) *clientCount {
+	if now.Sub(ct.start) >= policy.window() {
+		ct.clients = make(map[string]*clientCount)
+		ct.start = now
+	}
+	if !ct.named[client] {
+		if len(ct.named) >= maxTrackedClients {
+			client = otherClient
+		} else {
+			ct.named[client] = true
+		}
+	}
+	c := ct.clients[client]
+	if c == nil {
+		c = &clientCount{Client: client, Since: now}
+		ct.clients[client] = c
+	}
+	return c
+}
+
+// request counts a request by client at now, returning the name it was
+// counted under.
+func (ct *clientTracker) request(policy ClientPolicy, now time.Time, client string) string {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	c := ct.count(policy, now, client)
+	c.Requests++
+	return c.Client
+}
+
+// problem counts a problem of problemType sent to client at now. It returns
+// the name it was counted under and whether the client has just become
+// misbehaving, so that it is only reported once a window.
+func (ct *clientTracker) problem(policy ClientPolicy, now time.Time, client string, problemType probs.ProblemType) (string, bool) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	c := ct.count(policy, now, client)
+	switch problemType {
+	case probs.BadNonceProblem:
+		c.BadNonce++
+	case probs.MalformedProblem:
+		c.Malformed++
+	default:
+		return c.Client, false
+	}
+	if c.Misbehaving || !policy.misbehaving(c) {
+		return c.Client, false
+	}
+	c.Misbehaving = true
+	return c.Client, true
+}
+
+// report returns copies of the counts of the limit client versions with
+// the most errors in the current window, misbehaving ones first.
+func (ct *clientTracker) report(limit int) []clientCount {
+	ct.mu.Lock()
+	counts := make([]clientCount, 0, len(ct.clients))
+	for _, c := range ct.clients {
+		counts = append(counts, *c)
+	}
+	ct.mu.Unlock()
+
+	sort.Sort(byOffense(counts))
+	if limit > 0 && len(counts) > limit {
+		counts = counts[:limit]
+	}
+	return counts
+}
+
+// byOffense sorts client counts misbehaving first, then by errors, most
+// first, then by name.
+type byOffense []clientCount
+
+func (b byOffense) Len() int      { return len(b) }
+func (b byOffense) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byOffense) Less(i, j int) bool {
+	if b[i].Misbehaving != b[j].Misbehaving {
+		return b[i].Misbehaving
+	}
+	if b[i].errors() != b[j].errors() {
+		return b[i].errors() > b[j].errors()
+	}
+	return b[i].Client < b[j].Client
+}
+
+// defaultClientReportSize is how many client versions ClientReportHandler
+// lists unless asked for another number with ?limit=.
+const defaultClientReportSize = 20
+
+// ClientReportHandler serves operators, as JSON, the client versions
+// sending the most requests that get badNonce or malformed problems in the
+// current window, and which of them are misbehaving under the
+// ClientPolicy.
+func (wfe *WebFrontEndImpl) ClientReportHandler() http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		limit := defaultClientReportSize
+		if l := request.URL.Query().Get("limit"); l != "" {
+			var err error
+			if limit, err = strconv.Atoi(l); err != nil || limit < 0 {
+				http.Error(response, fmt.Sprintf("Invalid limit %q", l), http.StatusBadRequest)
+				return
+			}
+		}
+		body, err := json.MarshalIndent(wfe.clients.report(limit), "", "  ")
+		if err != nil {
+			http.Error(response, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response.Header().Set("Content-Type", "application/json")
+		response.Write(body)
+	})
+}
+
+// countClientRequest counts a request against the client version that sent
+// it.
+func (wfe *WebFrontEndImpl) countClientRequest(logEvent *requestEvent) {
+	client := wfe.clients.request(wfe.ClientPolicy, wfe.clk.Now(), clientName(logEvent.UserAgent))
+	wfe.metrics.clientRequests.Inc(client)
+}
+
+// countClientProblem counts prob, sent in answer to logEvent's request,
+// against the client version that sent it, and logs the client version
+// when it becomes misbehaving.
+func (wfe *WebFrontEndImpl) countClientProblem(logEvent *requestEvent, prob *probs.ProblemDetails) {
+	if prob.Type != probs.BadNonceProblem && prob.Type != probs.MalformedProblem {
+		return
+	}
+	client, misbehaving := wfe.clients.problem(wfe.ClientPolicy, wfe.clk.Now(), clientName(logEvent.UserAgent), prob.Type)
+	wfe.metrics.clientProblems.Inc(client, string(prob.Type))
+	if misbehaving {
+		wfe.metrics.misbehavingClients.Inc(client)
+		wfe.log.Warning(fmt.Sprintf("Client %s is misbehaving: too many of its requests get badNonce or malformed problems", client))
+	}
+}
@@ -1,6 +1,8 @@
 package wfe
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"net/http"
 	"time"
@@ -16,6 +18,7 @@ type requestEvent struct {
 	ClientAddr   string    `json:",omitempty"`
 	Endpoint     string    `json:",omitempty"`
 	Method       string    `json:",omitempty"`
+	UserAgent    string    `json:",omitempty"`
 	RequestTime  time.Time `json:",omitempty"`
 	ResponseTime time.Time `json:",omitempty"`
 	Errors       []string
@@ -51,6 +54,7 @@ func (th *topHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		RealIP:      r.Header.Get("X-Real-IP"),
 		ClientAddr:  getClientAddr(r),
 		Method:      r.Method,
+		UserAgent:   r.Header.Get("User-Agent"),
 		RequestTime: time.Now(),
 		Extra:       make(map[string]interface{}, 0),
 	}
@@ -59,6 +63,11 @@ func (th *topHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	defer th.logEvent(logEvent)
 
+	// Hand the request ID to the client and to every component the request
+	// reaches, so that an operator can follow it through all of their logs.
+	w.Header().Set(core.RequestIDHeader, logEvent.ID)
+	r = r.WithContext(core.WithRequestID(r.Context(), logEvent.ID))
+
 	th.wfe.ServeHTTP(logEvent, w, r)
 }
 
@@ -83,3 +92,81 @@ func getClientAddr(r *http.Request) string {
 	}
 	return r.RemoteAddr
 }
+
+// bufferedResponseWriter holds a response in memory so that it can be
+// abandoned if the handler producing it runs out of time.
+type bufferedResponseWriter struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponseWriter) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponseWriter) WriteHeader(code int) {
+	if b.code == 0 {
+		b.code = code
+	}
+}
+
+func (b *bufferedResponseWriter) Write(buf []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(buf)
+}
+
+// timeoutHandler runs a handler against a buffered response and sends that
+// response if the handler finishes within timeout. Otherwise the request's
+// context is cancelled, stopping the handler's RPCs, onTimeout writes the
+// response instead, and anything the handler writes later is discarded. The
+// handler is waited for either way, so that timed out requests can't pile
+// up behind the server.
+type timeoutHandler struct {
+	handler   http.Handler
+	timeout   time.Duration
+	onTimeout func(http.ResponseWriter, *http.Request)
+}
+
+func (th *timeoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), th.timeout)
+	defer cancel()
+	r = r.WithContext(ctx)
+	buffered := &bufferedResponseWriter{header: make(http.Header)}
+	done := make(chan struct{})
+	panicked := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				panicked <- p
+			}
+		}()
+		th.handler.ServeHTTP(buffered, r)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		for k, v := range buffered.header {
+			w.Header()[k] = v
+		}
+		if buffered.code != 0 {
+			w.WriteHeader(buffered.code)
+		}
+		w.Write(buffered.body.Bytes())
+	case p := <-panicked:
+		// Re-panic on the serving goroutine so net/http can recover it
+		panic(p)
+	case <-ctx.Done():
+		cancel()
+		th.onTimeout(w, r)
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		select {
+		case <-done:
+		case p := <-panicked:
+			panic(p)
+		}
+	}
+}
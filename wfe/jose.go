@@ -1,18 +1,33 @@
 package wfe
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"strings"
 
-	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/crypto/ed25519"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
 	"github.com/letsencrypt/boulder/core"
 )
 
-func algorithmForKey(key *jose.JsonWebKey) (string, error) {
-	// TODO(https://github.com/letsencrypt/boulder/issues/792): Support EC.
-	switch key.Key.(type) {
+func algorithmForKey(key *jose.JSONWebKey) (string, error) {
+	switch k := key.Key.(type) {
 	case *rsa.PublicKey:
 		return string(jose.RS256), nil
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return string(jose.ES256), nil
+		case elliptic.P384():
+			return string(jose.ES384), nil
+		}
+	case ed25519.PublicKey:
+		return string(jose.EdDSA), nil
 	}
 	return "", core.SignatureValidationError("no signature algorithms suitable for given key type")
 }
@@ -28,7 +43,7 @@ const (
 // that algorithm, and (3) the Algorithm field on the JWK is present and matches
 // that algorithm. Precondition: parsedJws must have exactly one signature on
 // it. Returns stat name to increment if err is non-nil.
-func checkAlgorithm(key *jose.JsonWebKey, parsedJws *jose.JsonWebSignature) (string, error) {
+func checkAlgorithm(key *jose.JSONWebKey, parsedJws *jose.JSONWebSignature) (string, error) {
 	algorithm, err := algorithmForKey(key)
 	if err != nil {
 		return noAlgorithmForKey, err
@@ -46,3 +61,115 @@ func checkAlgorithm(key *jose.JsonWebKey, parsedJws *jose.JsonWebSignature) (str
 	}
 	return "", nil
 }
+
+const (
+	malformedJWSHeader  = "WFE.Errors.MalformedJWSHeader"
+	duplicateJWSHeader  = "WFE.Errors.DuplicateJWSHeader"
+	unprotectedJWSParam = "WFE.Errors.UnprotectedJWSHeader"
+	missingJWSURL       = "WFE.Errors.MissingJWSURL"
+	mismatchedJWSURL    = "WFE.Errors.MismatchedJWSURL"
+)
+
+// mustBeProtected are the header parameters that must be covered by the
+// signature, so that they can't be altered or spliced in by a third party.
+var mustBeProtected = []string{"alg", "nonce", "url"}
+
+// headerMembers decodes a JSON object and returns its members, failing if any
+// member name appears more than once. encoding/json would otherwise silently
+// keep the last of them, which need not be the one a client's library (or
+// go-jose) acted on.
+func headerMembers(raw []byte) (map[string]json.RawMessage, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("header is not a JSON object")
+	}
+	members := make(map[string]json.RawMessage)
+	for dec.More() {
+		tok, err = dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		name, ok := tok.(string)
+		if !ok {
+			return nil, fmt.Errorf("header member name is not a string")
+		}
+		var value json.RawMessage
+		if err = dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		if _, present := members[name]; present {
+			return nil, fmt.Errorf("duplicate %q in JWS header", name)
+		}
+		members[name] = value
+	}
+	return members, nil
+}
+
+// checkJWSHeaders checks the protected and unprotected headers of the JWS in
+// body: no parameter may be given twice, whether within one header or across
+// both; the "alg", "nonce" and "url" parameters must be protected; and "url"
+// must be expectedURL, so that a signed request can't be replayed against
+// another endpoint. Precondition: body must have parsed as a JWS with exactly
+// one signature. Returns stat name to increment if err is non-nil.
+func checkJWSHeaders(body []byte, expectedURL string) (string, error) {
+	var jws struct {
+		Protected  string          `json:"protected"`
+		Header     json.RawMessage `json:"header"`
+		Signatures []struct {
+			Protected string          `json:"protected"`
+			Header    json.RawMessage `json:"header"`
+		} `json:"signatures"`
+	}
+	if err := json.Unmarshal(body, &jws); err != nil {
+		return malformedJWSHeader, fmt.Errorf("JWS is not in the JSON serialization")
+	}
+	if len(jws.Signatures) == 1 {
+		jws.Protected, jws.Header = jws.Signatures[0].Protected, jws.Signatures[0].Header
+	}
+
+	protected := map[string]json.RawMessage{}
+	if jws.Protected != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(jws.Protected, "="))
+		if err != nil {
+			return malformedJWSHeader, fmt.Errorf("JWS protected header is not base64url encoded")
+		}
+		if protected, err = headerMembers(raw); err != nil {
+			return duplicateJWSHeader, fmt.Errorf("JWS protected header: %s", err)
+		}
+	}
+	unprotected := map[string]json.RawMessage{}
+	if len(jws.Header) > 0 {
+		var err error
+		if unprotected, err = headerMembers(jws.Header); err != nil {
+			return duplicateJWSHeader, fmt.Errorf("JWS unprotected header: %s", err)
+		}
+	}
+
+	for name := range unprotected {
+		if _, ok := protected[name]; ok {
+			return duplicateJWSHeader, fmt.Errorf("%q appears in both the protected and unprotected JWS headers", name)
+		}
+	}
+	for _, name := range mustBeProtected {
+		if _, ok := unprotected[name]; ok {
+			return unprotectedJWSParam, fmt.Errorf("%q must be in the protected JWS header", name)
+		}
+	}
+
+	rawURL, ok := protected["url"]
+	if !ok {
+		return missingJWSURL, fmt.Errorf("JWS header has no \"url\"")
+	}
+	var headerURL string
+	if err := json.Unmarshal(rawURL, &headerURL); err != nil {
+		return malformedJWSHeader, fmt.Errorf("JWS header \"url\" is not a string")
+	}
+	if headerURL != expectedURL {
+		return mismatchedJWSURL, fmt.Errorf("JWS header \"url\" %q does not match the request URL %q", headerURL, expectedURL)
+	}
+	return "", nil
+}
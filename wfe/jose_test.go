@@ -1,11 +1,18 @@
 package wfe
 
 import (
+	"context"
 	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/rsa"
+	"encoding/base64"
 	"testing"
 
-	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/probs"
+	"github.com/letsencrypt/boulder/test"
 )
 
 func TestRejectsNone(t *testing.T) {
@@ -59,36 +66,36 @@ func TestRejectsHS256(t *testing.T) {
 
 func TestCheckAlgorithm(t *testing.T) {
 	testCases := []struct {
-		key          jose.JsonWebKey
-		jws          jose.JsonWebSignature
+		key          jose.JSONWebKey
+		jws          jose.JSONWebSignature
 		expectedErr  string
 		expectedStat string
 	}{
 		{
-			jose.JsonWebKey{
+			jose.JSONWebKey{
 				Algorithm: "ES256",
 				Key:       &ecdsa.PublicKey{},
 			},
-			jose.JsonWebSignature{},
+			jose.JSONWebSignature{},
 			"no signature algorithms suitable for given key type",
 			"WFE.Errors.NoAlgorithmForKey",
 		},
 		{
-			jose.JsonWebKey{
+			jose.JSONWebKey{
 				Algorithm: "HS256",
 			},
-			jose.JsonWebSignature{},
+			jose.JSONWebSignature{},
 			"no signature algorithms suitable for given key type",
 			"WFE.Errors.NoAlgorithmForKey",
 		},
 		{
-			jose.JsonWebKey{
+			jose.JSONWebKey{
 				Key: &rsa.PublicKey{},
 			},
-			jose.JsonWebSignature{
+			jose.JSONWebSignature{
 				Signatures: []jose.Signature{
 					jose.Signature{
-						Header: jose.JoseHeader{
+						Header: jose.Header{
 							Algorithm: "HS256",
 						},
 					},
@@ -98,14 +105,14 @@ func TestCheckAlgorithm(t *testing.T) {
 			"WFE.Errors.InvalidJWSAlgorithm",
 		},
 		{
-			jose.JsonWebKey{
+			jose.JSONWebKey{
 				Algorithm: "HS256",
 				Key:       &rsa.PublicKey{},
 			},
-			jose.JsonWebSignature{
+			jose.JSONWebSignature{
 				Signatures: []jose.Signature{
 					jose.Signature{
-						Header: jose.JoseHeader{
+						Header: jose.Header{
 							Algorithm: "HS256",
 						},
 					},
@@ -115,14 +122,14 @@ func TestCheckAlgorithm(t *testing.T) {
 			"WFE.Errors.InvalidJWSAlgorithm",
 		},
 		{
-			jose.JsonWebKey{
+			jose.JSONWebKey{
 				Algorithm: "HS256",
 				Key:       &rsa.PublicKey{},
 			},
-			jose.JsonWebSignature{
+			jose.JSONWebSignature{
 				Signatures: []jose.Signature{
 					jose.Signature{
-						Header: jose.JoseHeader{
+						Header: jose.Header{
 							Algorithm: "RS256",
 						},
 					},
@@ -131,6 +138,63 @@ func TestCheckAlgorithm(t *testing.T) {
 			"algorithm 'HS256' on JWK is unacceptable",
 			"WFE.Errors.InvalidAlgorithmOnKey",
 		},
+		{
+			jose.JSONWebKey{
+				Key: &ecdsa.PublicKey{Curve: elliptic.P256()},
+			},
+			jose.JSONWebSignature{
+				Signatures: []jose.Signature{
+					jose.Signature{
+						Header: jose.Header{
+							Algorithm: "ES384",
+						},
+					},
+				},
+			},
+			"algorithm 'ES384' in JWS header not acceptable",
+			"WFE.Errors.InvalidJWSAlgorithm",
+		},
+		{
+			jose.JSONWebKey{
+				Key: &ecdsa.PublicKey{Curve: elliptic.P384()},
+			},
+			jose.JSONWebSignature{
+				Signatures: []jose.Signature{
+					jose.Signature{
+						Header: jose.Header{
+							Algorithm: "RS256",
+						},
+					},
+				},
+			},
+			"algorithm 'RS256' in JWS header not acceptable",
+			"WFE.Errors.InvalidJWSAlgorithm",
+		},
+		{
+			jose.JSONWebKey{
+				Algorithm: "ES384",
+				Key:       &ecdsa.PublicKey{Curve: elliptic.P256()},
+			},
+			jose.JSONWebSignature{
+				Signatures: []jose.Signature{
+					jose.Signature{
+						Header: jose.Header{
+							Algorithm: "ES256",
+						},
+					},
+				},
+			},
+			"algorithm 'ES384' on JWK is unacceptable",
+			"WFE.Errors.InvalidAlgorithmOnKey",
+		},
+		{
+			jose.JSONWebKey{
+				Key: &ecdsa.PublicKey{Curve: elliptic.P521()},
+			},
+			jose.JSONWebSignature{},
+			"no signature algorithms suitable for given key type",
+			"WFE.Errors.NoAlgorithmForKey",
+		},
 	}
 	for i, tc := range testCases {
 		stat, err := checkAlgorithm(&tc.key, &tc.jws)
@@ -144,13 +208,13 @@ func TestCheckAlgorithm(t *testing.T) {
 }
 
 func TestCheckAlgorithmSuccess(t *testing.T) {
-	_, err := checkAlgorithm(&jose.JsonWebKey{
+	_, err := checkAlgorithm(&jose.JSONWebKey{
 		Algorithm: "RS256",
 		Key:       &rsa.PublicKey{},
-	}, &jose.JsonWebSignature{
+	}, &jose.JSONWebSignature{
 		Signatures: []jose.Signature{
 			jose.Signature{
-				Header: jose.JoseHeader{
+				Header: jose.Header{
 					Algorithm: "RS256",
 				},
 			},
@@ -159,12 +223,12 @@ func TestCheckAlgorithmSuccess(t *testing.T) {
 	if err != nil {
 		t.Errorf("RS256 key: Expected nil error, got '%s'", err)
 	}
-	_, err = checkAlgorithm(&jose.JsonWebKey{
+	_, err = checkAlgorithm(&jose.JSONWebKey{
 		Key: &rsa.PublicKey{},
-	}, &jose.JsonWebSignature{
+	}, &jose.JSONWebSignature{
 		Signatures: []jose.Signature{
 			jose.Signature{
-				Header: jose.JoseHeader{
+				Header: jose.Header{
 					Algorithm: "RS256",
 				},
 			},
@@ -174,3 +238,161 @@ func TestCheckAlgorithmSuccess(t *testing.T) {
 		t.Errorf("RS256 key: Expected nil error, got '%s'", err)
 	}
 }
+
+func TestCheckAlgorithmECDSASuccess(t *testing.T) {
+	for curve, alg := range map[elliptic.Curve]string{elliptic.P256(): "ES256", elliptic.P384(): "ES384"} {
+		_, err := checkAlgorithm(&jose.JSONWebKey{
+			Key: &ecdsa.PublicKey{Curve: curve},
+		}, &jose.JSONWebSignature{
+			Signatures: []jose.Signature{
+				jose.Signature{
+					Header: jose.Header{
+						Algorithm: alg,
+					},
+				},
+			},
+		})
+		if err != nil {
+			t.Errorf("%s key: Expected nil error, got '%s'", alg, err)
+		}
+	}
+}
+
+// unregisteredSA knows no registrations, so verifyPOST has to check the
+// submitted key itself.
+type unregisteredSA struct {
+	core.StorageGetter
+}
+
+func (unregisteredSA) GetRegistrationByKey(context.Context, jose.JSONWebKey) (core.Registration, error) {
+	return core.Registration{}, core.NoSuchRegistrationError("reg not found")
+}
+
+func TestVerifyPOSTECDSA(t *testing.T) {
+	wfe, _ := setupWFE(t)
+	wfe.SA = unregisteredSA{wfe.SA}
+	for curve, alg := range map[elliptic.Curve]jose.SignatureAlgorithm{elliptic.P256(): jose.ES256, elliptic.P384(): jose.ES384} {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatalf("Failed to generate %s key: %s", alg, err)
+		}
+		signer := newSigner(t, alg, key, wfe.nonceService)
+		result, err := signer.Sign([]byte(`{"resource":"new-reg"}`))
+		if err != nil {
+			t.Fatalf("Failed to sign with %s: %s", alg, err)
+		}
+
+		payload, jwk, _, prob := wfe.verifyPOST(newRequestEvent(), makePostRequest(result.FullSerialize()), false, "new-reg")
+		if prob != nil {
+			t.Fatalf("%s: verifyPOST rejected valid request: %s", alg, prob)
+		}
+		if string(payload) != `{"resource":"new-reg"}` {
+			t.Errorf("%s: unexpected payload %q", alg, payload)
+		}
+		if _, ok := jwk.Key.(*ecdsa.PublicKey); !ok {
+			t.Errorf("%s: expected an ECDSA key, got %T", alg, jwk.Key)
+		}
+	}
+}
+
+func TestCheckJWSHeaders(t *testing.T) {
+	const reqURL = "https://example.com/acme/new-reg"
+	protect := func(header string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(header))
+	}
+	testCases := []struct {
+		body         string
+		expectedErr  string
+		expectedStat string
+	}{
+		{
+			`{"protected":"` + protect(`{"alg":"RS256","nonce":"n","url":"`+reqURL+`"}`) + `","header":{"jwk":{}}}`,
+			"",
+			"",
+		},
+		{
+			`{"signatures":[{"protected":"` + protect(`{"alg":"RS256","nonce":"n","url":"`+reqURL+`"}`) + `"}]}`,
+			"",
+			"",
+		},
+		{
+			`{"protected":"` + protect(`{"alg":"RS256","nonce":"n"}`) + `"}`,
+			`JWS header has no "url"`,
+			"WFE.Errors.MissingJWSURL",
+		},
+		{
+			`{"protected":"` + protect(`{"alg":"RS256","url":"https://example.com/acme/revoke-cert"}`) + `"}`,
+			`JWS header "url" "https://example.com/acme/revoke-cert" does not match the request URL "` + reqURL + `"`,
+			"WFE.Errors.MismatchedJWSURL",
+		},
+		{
+			`{"protected":"` + protect(`{"alg":"RS256","url":7}`) + `"}`,
+			`JWS header "url" is not a string`,
+			"WFE.Errors.MalformedJWSHeader",
+		},
+		{
+			`{"protected":"` + protect(`{"alg":"RS256"}`) + `","header":{"url":"` + reqURL + `"}}`,
+			`"url" must be in the protected JWS header`,
+			"WFE.Errors.UnprotectedJWSHeader",
+		},
+		{
+			`{"protected":"` + protect(`{"url":"`+reqURL+`"}`) + `","header":{"alg":"RS256"}}`,
+			`"alg" must be in the protected JWS header`,
+			"WFE.Errors.UnprotectedJWSHeader",
+		},
+		{
+			`{"protected":"` + protect(`{"alg":"RS256","url":"`+reqURL+`"}`) + `","header":{"alg":"none"}}`,
+			`"alg" appears in both the protected and unprotected JWS headers`,
+			"WFE.Errors.DuplicateJWSHeader",
+		},
+		{
+			`{"protected":"` + protect(`{"alg":"RS256","nonce":"a","nonce":"b","url":"`+reqURL+`"}`) + `"}`,
+			`JWS protected header: duplicate "nonce" in JWS header`,
+			"WFE.Errors.DuplicateJWSHeader",
+		},
+		{
+			`{"protected":"` + protect(`{"alg":"RS256","url":"`+reqURL+`"}`) + `","header":{"kid":"a","kid":"b"}}`,
+			`JWS unprotected header: duplicate "kid" in JWS header`,
+			"WFE.Errors.DuplicateJWSHeader",
+		},
+		{
+			`{"protected":"!!!"}`,
+			"JWS protected header is not base64url encoded",
+			"WFE.Errors.MalformedJWSHeader",
+		},
+	}
+	for i, tc := range testCases {
+		stat, err := checkJWSHeaders([]byte(tc.body), reqURL)
+		if tc.expectedErr == "" {
+			if err != nil {
+				t.Errorf("TestCheckJWSHeaders %d: Expected nil error, got '%s'", i, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tc.expectedErr {
+			t.Errorf("TestCheckJWSHeaders %d: Expected '%s', got '%v'", i, tc.expectedErr, err)
+		}
+		if stat != tc.expectedStat {
+			t.Errorf("TestCheckJWSHeaders %d: Expected stat '%s', got '%s'", i, tc.expectedStat, stat)
+		}
+	}
+}
+
+func TestEnforceJWSHeaders(t *testing.T) {
+	wfe, _ := setupWFE(t)
+	wfe.BaseURL = "https://example.com"
+
+	// signRequest's JWS has no "url", which is only logged until enforcement
+	// is turned on
+	body := signRequest(t, `{"resource":"foo"}`, wfe.nonceService)
+	event := newRequestEvent()
+	_, _, _, prob := wfe.verifyPOST(event, makePostRequestWithPath("/acme/foo", body), true, "foo")
+	test.Assert(t, prob == nil, "Rejected a JWS header problem without enforcement")
+	test.AssertEquals(t, event.Extra["JWSHeaderProblem"], `JWS header has no "url"`)
+
+	wfe.EnforceJWSHeaders = true
+	body = signRequest(t, `{"resource":"foo"}`, wfe.nonceService)
+	_, _, _, prob = wfe.verifyPOST(newRequestEvent(), makePostRequestWithPath("/acme/foo", body), true, "foo")
+	test.AssertEquals(t, prob.Type, probs.MalformedProblem)
+	test.AssertEquals(t, prob.Detail, `JWS header has no "url"`)
+}
@@ -0,0 +1,165 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package wfe
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/letsencrypt/boulder/metrics"
+)
+
+// wfeMetrics are the per-endpoint metrics the WFE exposes to Prometheus.
+type wfeMetrics struct {
+	registry *metrics.Registry
+	requests *metrics.CounterVec
+	latency  *metrics.HistogramVec
+	problems *metrics.CounterVec
+	// New-cert requests refused by checkNames
+	rejectedNames *metrics.CounterVec
+	// Polls refused by the PollPolicy
+	limitedPolls *metrics.CounterVec
+	// Requests and badNonce or malformed problems by client version, and
+	// the times a version was found misbehaving by the ClientPolicy
+	clientRequests     *metrics.CounterVec
+	clientProblems     *metrics.CounterVec
+	misbehavingClients *metrics.CounterVec
+	// Nonce redemptions by where the nonce was issued, from which the rate
+	// of nonces redeemed by an instance other than the one that issued
+	// them can be followed
+	nonceRedemptions *metrics.CounterVec
+	nonceLatency     *metrics.HistogramVec
+}
+
+func newWFEMetrics() *wfeMetrics {
+	r := metrics.NewRegistry()
+	return &wfeMetrics{
+		registry: r,
+		requests: r.NewCounterVec("wfe_http_requests_total",
+			"Requests served, by endpoint, method and response code.",
+			"endpoint", "method", "code"),
+		latency: r.NewHistogramVec("wfe_http_request_duration_seconds",
+			"Time taken to serve requests, by endpoint and method.",
+			metrics.DefaultLatencyBuckets, "endpoint", "method"),
+		problems: r.NewCounterVec("wfe_problems_total",
+			"Problem documents sent, by problem type.",
+			"type"),
+		rejectedNames: r.NewCounterVec("wfe_rejected_cert_requests_total",
+			"New-cert requests rejected for their names, by reason.",
+			"reason"),
+		limitedPolls: r.NewCounterVec("wfe_rate_limited_polls_total",
+			"Authorization and challenge polls refused for polling too often, by endpoint.",
+			"endpoint"),
+		clientRequests: r.NewCounterVec("wfe_client_requests_total",
+			"Requests received, by client name and version from the User-Agent.",
+			"client"),
+		clientProblems: r.NewCounterVec("wfe_client_problems_total",
+			"BadNonce and malformed problems sent, by client name and version and problem type.",
+			"client", "type"),
+		misbehavingClients: r.NewCounterVec("wfe_misbehaving_clients_total",
+			"Windows in which a client version was found misbehaving, by client name and version.",
+			"client"),
+		nonceRedemptions: r.NewCounterVec("wfe_nonce_redemptions_total",
+			`Nonces redeemed, by the prefix of the instance that issued them, whether that's this instance ("local"), a peer or unknown, and result ("valid", "invalid" or "error").`,
+			"issuer", "origin", "result"),
+		nonceLatency: r.NewHistogramVec("wfe_nonce_redemption_duration_seconds",
+			`Time taken to redeem nonces, by whether they were issued by this instance ("local") or a peer.`,
+			metrics.DefaultLatencyBuckets, "origin"),
+	}
+}
+
+// MetricsHandler serves the WFE's metrics in the Prometheus text format.
+func (wfe *WebFrontEndImpl) MetricsHandler() http.Handler {
+	return wfe.metrics.registry
+}
+
+// Where a nonce being redeemed was issued
+const (
+	nonceOriginLocal   = "local"
+	nonceOriginPeer    = "peer"
+	nonceOriginUnknown = "unknown"
+)
+
+// observeNonceRedemption records the redemption of a nonce issued by the
+// instance with prefix, which took elapsed, and logs it if it's sampled.
+// Redemptions of nonces from unknown prefixes are counted under "unknown",
+// so that clients can't create new label values.
+func (wfe *WebFrontEndImpl) observeNonceRedemption(prefix, origin string, valid bool, err error, elapsed time.Duration) {
+	issuer := prefix
+	if origin == nonceOriginUnknown {
+		issuer = nonceOriginUnknown
+	} else if issuer == "" {
+		issuer = "none"
+	}
+	result := "invalid"
+	if err != nil {
+		result = "error"
+	} else if valid {
+		result = "valid"
+	}
+	wfe.metrics.nonceRedemptions.Inc(issuer, origin, result)
+	if origin != nonceOriginUnknown {
+		wfe.metrics.nonceLatency.Observe(elapsed.Seconds(), origin)
+	}
+
+	if wfe.NonceAuditSampleRate <= 0 || rand.Float64() >= wfe.NonceAuditSampleRate {
+		return
+	}
+	msg := fmt.Sprintf("Nonce redemption: issuer=[%s] redeemer=[%s] origin=[%s] result=[%s] latency=[%s]",
+		prefix, wfe.nonceService.Prefix(), origin, result, elapsed)
+	if err != nil {
+		msg += fmt.Sprintf(" err=[%s]", err)
+	}
+	wfe.log.Info(msg)
+}
+
+// statusRecorder remembers the response code sent through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.code == 0 {
+		s.code = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(buf []byte) (int, error) {
+	if s.code == 0 {
+		s.code = http.StatusOK
+	}
+	return s.ResponseWriter.Write(buf)
+}
+
+// metricsMethod keeps arbitrary client-supplied methods from creating new
+// label values.
+func metricsMethod(method string) string {
+	switch method {
+	case "GET", "HEAD", "POST", "OPTIONS":
+		return method
+	}
+	return "other"
+}
+
+// instrument counts and times the requests h serves for the endpoint pattern.
+func (wfe *WebFrontEndImpl) instrument(pattern string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		begin := wfe.clk.Now()
+		recorder := &statusRecorder{ResponseWriter: response}
+		h.ServeHTTP(recorder, request)
+		if recorder.code == 0 {
+			recorder.code = http.StatusOK
+		}
+		method := metricsMethod(request.Method)
+		wfe.metrics.requests.Inc(pattern, method, strconv.Itoa(recorder.code))
+		wfe.metrics.latency.Observe(wfe.clk.Now().Sub(begin).Seconds(), pattern, method)
+	})
+}
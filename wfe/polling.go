@@ -0,0 +1,240 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package wfe
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/probs"
+)
+
+// pollAttemptHeader tells a client polling a validation in progress how many
+// times it has polled that authorization.
+const pollAttemptHeader = "Boulder-Poll-Attempt"
+
+// defaultPollWindow is the PollPolicy.Window used when none is configured.
+const defaultPollWindow = time.Minute
+
+// defaultMaxRetryAfter is the PollPolicy.MaxRetryAfter used when none is
+// configured.
+const defaultMaxRetryAfter = 5 * time.Minute
+
+// PollPolicy paces clients polling authorizations and challenges whose
+// validation is in progress, and certificate orders being issued. Each such
+// poll is answered with a Retry-After of ValidationLatency, doubling with
+// every further poll of the same authorization or order by the same client
+// up to MaxRetryAfter (default 5 minutes); zero ValidationLatency sends no
+// Retry-After. Each client's polls of an account's authorizations,
+// challenges and orders are limited to MaxPolls per Window, or the
+// account's entry in AccountOverrides; zero MaxPolls means no limit, as
+// does a negative override. Polls aren't authenticated, so clients are told
+// apart by their IP address, and polls of an account's resources by anyone
+// else don't count against the account's own client.
+type PollPolicy struct {
+	ValidationLatency time.Duration
+	MaxRetryAfter     time.Duration
+	Window            time.Duration
+	MaxPolls          int
+	AccountOverrides  map[int64]int
+}
+
+func (p PollPolicy) window() time.Duration {
+	if p.Window <= 0 {
+		return defaultPollWindow
+	}
+	return p.Window
+}
+
+func (p PollPolicy) maxRetryAfter() time.Duration {
+	if p.MaxRetryAfter <= 0 {
+		return defaultMaxRetryAfter
+	}
+	return p.MaxRetryAfter
+}
+
+// limited reports whether regID has gone over its limit with count polls.
+func (p PollPolicy) limited(regID int64, count int) bool {
+	if p.MaxPolls <= 0 {
+		return false
+	}
+	max := p.MaxPolls
+	if override, ok := p.AccountOverrides[regID]; ok {
+		max = override
+	}
+	return max >= 0 && count > max
+}
+
+// retryAfter is how long a client should wait before its next poll, after
+// polling a validation in progress attempt times.
+func (p PollPolicy) retryAfter(attempt int) time.Duration {
+	max := p.maxRetryAfter()
+	wait := p.ValidationLatency
+	for i := 1; i < attempt && wait < max; i++ {
+		wait *= 2
+	}
+	if wait > max {
+		wait = max
+	}
+	return wait
+}
+
+// pollCount counts polls since start.
+type pollCount struct {
+	start time.Time
+	count int
+}
+
+// accountPoller is a client polling an account's resources.
+type accountPoller struct {
+	regID  int64
+	client string
+}
+
+// authzPoller is a client polling an authorization or order.
+type authzPoller struct {
+	authzID string
+	client  string
+}
+
+// pollTracker counts polls per account and client, and per authorization
+// whose validation is in progress and client. Counts are kept by each WFE
+// instance, so with several WFEs behind a load balancer the limits apply to
+// each of them.
+type pollTracker struct {
+	mu        sync.Mutex
+	accounts  map[accountPoller]*pollCount
+	attempts  map[authzPoller]*pollCount
+	lastSweep time.Time
+}
+
+func newPollTracker() *pollTracker {
+	return &pollTracker{
+		accounts: make(map[accountPoller]*pollCount),
+		attempts: make(map[authzPoller]*pollCount),
+	}
+}
+
+// poll counts a poll by client of authzID, owned by regID, at now. It
+// returns how many times client has polled authzID while inProgress, and,
+// if client is over the account's limit, how long until it may poll again.
+func (pt *pollTracker) poll(policy PollPolicy, now time.Time, regID int64, authzID, client string, inProgress bool) (attempt int, limitedFor time.Duration) {
+	window := policy.window()
+
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	// Drop counts that have run their course, at most once a window
+	if now.Sub(pt.lastSweep) >= window {
+		for id, c := range pt.accounts {
+			if now.Sub(c.start) >= window {
+				delete(pt.accounts, id)
+			}
+		}
+		for id, c := range pt.attempts {
+			if now.Sub(c.start) >= window+policy.maxRetryAfter() {
+				delete(pt.attempts, id)
+			}
+		}
+		pt.lastSweep = now
+	}
+
+	accountKey := accountPoller{regID: regID, client: client}
+	account := pt.accounts[accountKey]
+	if account == nil || now.Sub(account.start) >= window {
+		account = &pollCount{start: now}
+		pt.accounts[accountKey] = account
+	}
+	account.count++
+	if policy.limited(regID, account.count) {
+		return 0, account.start.Add(window).Sub(now)
+	}
+
+	authzKey := authzPoller{authzID: authzID, client: client}
+	if !inProgress {
+		delete(pt.attempts, authzKey)
+		return 0, 0
+	}
+	authz := pt.attempts[authzKey]
+	if authz == nil {
+		authz = &pollCount{}
+		pt.attempts[authzKey] = authz
+	}
+	// Each poll keeps the count alive until the sweep after next
+	authz.start = now
+	authz.count++
+	return authz.count, 0
+}
+
+// challengeInProgress returns whether the server has the next action on a
+// challenge, i.e. a response has been submitted and is being validated.
+func challengeInProgress(challenge core.Challenge) bool {
+	return challenge.Status == core.StatusProcessing ||
+		(challenge.Status == core.StatusPending && challenge.KeyAuthorization != nil)
+}
+
+// authorizationInProgress returns whether any challenge of a pending
+// authorization is being validated.
+func authorizationInProgress(authz core.Authorization) bool {
+	if authz.Status != core.StatusPending && authz.Status != core.StatusProcessing {
+		return false
+	}
+	for _, challenge := range authz.Challenges {
+		if challengeInProgress(challenge) {
+			return true
+		}
+	}
+	return false
+}
+
+// pollClient returns the address of the client making request: the
+// X-Real-IP set by the proxy in front of the WFE, or else the remote end of
+// the connection.
+func pollClient(request *http.Request) string {
+	if ip := net.ParseIP(request.Header.Get("X-Real-IP")); ip != nil {
+		return ip.String()
+	}
+	if host, _, err := net.SplitHostPort(request.RemoteAddr); err == nil {
+		return host
+	}
+	return request.RemoteAddr
+}
+
+// pacePoll counts a GET of the authorization or certificate order with id,
+// or of one of the authorization's challenges, against the polling limits.
+// It sends a rateLimited problem and returns false if the client making
+// request is polling the resources of regID, the owning account, too often.
+// Otherwise, if validation or issuance is still in progress, it sets
+// Retry-After and the attempt count on the response.
+func (wfe *WebFrontEndImpl) pacePoll(response http.ResponseWriter, request *http.Request, logEvent *requestEvent, endpoint string, regID int64, id string, inProgress bool) bool {
+	attempt, limitedFor := wfe.polls.poll(wfe.PollPolicy, wfe.clk.Now(), regID, id, pollClient(request), inProgress)
+	if limitedFor > 0 {
+		wfe.metrics.limitedPolls.Inc(endpoint)
+		response.Header().Set("Retry-After", retryAfterSeconds(limitedFor))
+		wfe.sendError(response, logEvent, probs.RateLimited(fmt.Sprintf(
+			"Too many polls of this account's resources, retry after %s seconds", retryAfterSeconds(limitedFor))), nil)
+		return false
+	}
+	if attempt > 0 {
+		logEvent.Extra["PollAttempt"] = attempt
+		response.Header().Set(pollAttemptHeader, strconv.Itoa(attempt))
+		if wait := wfe.PollPolicy.retryAfter(attempt); wait > 0 {
+			response.Header().Set("Retry-After", retryAfterSeconds(wait))
+		}
+	}
+	return true
+}
+
+// retryAfterSeconds formats d as a Retry-After delay, in whole seconds
+// rounded up.
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64((d+time.Second-1)/time.Second), 10)
+}
@@ -7,28 +7,37 @@ package wfe
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
-	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
 	"github.com/letsencrypt/boulder/core"
+	berrors "github.com/letsencrypt/boulder/errors"
+	"github.com/letsencrypt/boulder/identifier"
 	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/mail"
 	"github.com/letsencrypt/boulder/probs"
 )
 
 // Paths are the ACME-spec identified URL path-segments for various methods
 const (
 	DirectoryPath  = "/directory"
+	NewNoncePath   = "/acme/new-nonce"
 	NewRegPath     = "/acme/new-reg"
 	RegPath        = "/acme/reg/"
 	NewAuthzPath   = "/acme/new-authz"
@@ -36,12 +45,39 @@ const (
 	ChallengePath  = "/acme/challenge/"
 	NewCertPath    = "/acme/new-cert"
 	CertPath       = "/acme/cert/"
+	OrderPath      = "/acme/order/"
 	RevokeCertPath = "/acme/revoke-cert"
+	FetchCertPath  = "/acme/fetch-cert"
 	TermsPath      = "/terms"
 	IssuerPath     = "/acme/issuer-cert"
 	BuildIDPath    = "/build"
+	StatusPath     = "/status"
+
+	ValidationInfoPath = "/acme/validation-info"
+
+	VerifyContactPath = mail.VerificationPath
+
+	// OrdersSuffix follows a registration URL to list its orders
+	OrdersSuffix = "/orders"
 )
 
+// defaultOrdersPageSize is the number of orders listed per page unless
+// OrdersPageSize says otherwise.
+const defaultOrdersPageSize = 100
+
+// maxIdempotencyKeyLength is the longest idempotency key new-cert requests
+// may have.
+const maxIdempotencyKeyLength = 255
+
+// CertificateProfile describes a certificate profile that clients may select
+// in new-cert requests, as published in the directory's meta object.
+type CertificateProfile struct {
+	Description string `json:"description,omitempty"`
+	// Validity is the lifetime, in seconds, of certificates issued under the
+	// profile
+	Validity int64 `json:"validity"`
+}
+
 // WebFrontEndImpl provides all the logic for Boulder's web-facing interface,
 // i.e., ACME.  Its members configure the paths for various ACME functions,
 // plus a few other data items used in ACME.  Its methods are primarily handlers
@@ -62,6 +98,7 @@ type WebFrontEndImpl struct {
 	ChallengeBase string
 	NewCert       string
 	CertBase      string
+	OrderBase     string
 
 	// JSON encoded endpoint directory
 	DirectoryJSON []byte
@@ -69,24 +106,113 @@ type WebFrontEndImpl struct {
 	// Issuer certificate (DER) for /acme/issuer-cert
 	IssuerCert []byte
 
+	// The certificates (DER) of the CA's further issuers, served at
+	// /acme/issuer-cert/ followed by their hex subject key IDs, and linked
+	// from the certificates they issued
+	FurtherIssuerCerts [][]byte
+
 	// URL to the current subscriber agreement (should contain some version identifier)
 	SubscriberAgreementURL string
 
+	// The User-Agents and source IP ranges (in CIDR notation) of the VA's
+	// validation requests, published at ValidationInfoPath
+	ValidationUserAgents   []string
+	ValidationSourceRanges []string
+
 	// Register of anti-replay nonces
 	nonceService *core.NonceService
 
+	// Peer WFE instances, keyed by nonce prefix, that can redeem nonces this
+	// instance did not issue
+	NoncePeers map[string]core.NonceRedeemer
+
+	// NonceAuditSampleRate is the fraction, from 0 to 1, of nonce
+	// redemptions logged with where the nonce was issued and how long
+	// redeeming it took
+	NonceAuditSampleRate float64
+
 	// Cache settings
 	CertCacheDuration           time.Duration
 	CertNoCacheExpirationWindow time.Duration
+	DirectoryCacheDuration      time.Duration
 	IndexCacheDuration          time.Duration
 	IssuerCacheDuration         time.Duration
 
-	// CORS settings
-	AllowOrigins []string
+	// Last-Modified times of the directory and issuer certificate, set by
+	// Handler
+	directoryModified time.Time
+	issuerModified    time.Time
+
+	// The further issuers by hex subject key ID, and the default issuer's
+	// key ID, set by Handler
+	furtherIssuers     map[string]issuerCert
+	defaultIssuerKeyID string
+
+	// CORS settings. EndpointAllowOrigins, keyed by path (e.g.
+	// "/directory"), gives those endpoints their own origin allowlist in
+	// place of AllowOrigins.
+	AllowOrigins         []string
+	EndpointAllowOrigins map[string][]string
 
 	// Graceful shutdown settings
 	ShutdownStopTimeout time.Duration
 	ShutdownKillTimeout time.Duration
+
+	// RequestTimeout bounds how long any endpoint may take to respond, unless
+	// EndpointRequestTimeouts, keyed by path (e.g. "/acme/new-cert"), gives
+	// that endpoint its own bound. Zero means no bound. Both must be set
+	// before calling Handler.
+	RequestTimeout          time.Duration
+	EndpointRequestTimeouts map[string]time.Duration
+
+	// MaxRequestBodySize is the largest POST body, in bytes, that will be
+	// read. Zero means no limit.
+	MaxRequestBodySize int64
+
+	// MaxNames is the most identifiers a new-cert request may name. Zero
+	// means no limit.
+	MaxNames int
+
+	// OrdersPageSize is the number of orders listed per page at a
+	// registration's orders URL
+	OrdersPageSize int
+
+	// Profiles, keyed by name, are the certificate profiles clients may
+	// select. They must be set before calling Handler.
+	Profiles map[string]CertificateProfile
+
+	// EnforceJWSHeaders rejects POSTs whose JWS headers give a parameter
+	// twice, leave "alg", "nonce" or "url" unprotected, or name a "url"
+	// other than the one requested. While false, such POSTs are only counted
+	// and logged.
+	EnforceJWSHeaders bool
+
+	// Ed25519AccountKeys accepts Ed25519 keys, signing with EdDSA, for new
+	// registrations. Certificate keys can't be Ed25519.
+	Ed25519AccountKeys bool
+
+	// AsyncIssuance answers new-cert requests with a certificate order, at
+	// OrderBase, once the RA has accepted them, rather than waiting for the
+	// certificate to be issued
+	AsyncIssuance bool
+
+	// PollPolicy paces GETs of authorizations and challenges being
+	// validated, and of certificate orders being issued
+	PollPolicy PollPolicy
+	polls      *pollTracker
+
+	// ClientPolicy decides which client versions are misbehaving, by the
+	// badNonce and malformed problems their requests get
+	ClientPolicy ClientPolicy
+	clients      *clientTracker
+
+	// Per-endpoint metrics, served by MetricsHandler
+	metrics *wfeMetrics
+
+	// ContactVerifier checks the links mailed to registration contacts. If
+	// nil, contact verification is disabled and VerifyContactPath isn't
+	// served.
+	ContactVerifier *mail.ContactVerifier
 }
 
 // NewWebFrontEndImpl constructs a web service for Boulder
@@ -104,9 +230,63 @@ func NewWebFrontEndImpl(stats statsd.Statter, clk clock.Clock) (WebFrontEndImpl,
 		clk:          clk,
 		nonceService: nonceService,
 		stats:        stats,
+		metrics:      newWFEMetrics(),
+		polls:        newPollTracker(),
+		clients:      newClientTracker(),
+
+		OrdersPageSize: defaultOrdersPageSize,
 	}, nil
 }
 
+// SetNoncePrefix replaces the WFE's nonce service with one whose nonces carry
+// the given prefix, so that peer instances can route them back here for
+// redemption. It must be called before the WFE starts serving requests.
+func (wfe *WebFrontEndImpl) SetNoncePrefix(prefix string) error {
+	nonceService, err := core.NewPrefixedNonceService(prefix)
+	if err != nil {
+		return err
+	}
+	wfe.nonceService = nonceService
+	return nil
+}
+
+// NonceService returns the WFE's local nonce service, for exposure to peer
+// instances over RPC.
+func (wfe *WebFrontEndImpl) NonceService() core.NonceRedeemer {
+	return wfe.nonceService
+}
+
+// validNonce redeems a nonce, either locally or, if it was issued by a peer
+// instance, by asking that peer over RPC.
+func (wfe *WebFrontEndImpl) validNonce(nonce string) bool {
+	prefix, ok := core.NoncePrefix(nonce)
+	if !ok {
+		return false
+	}
+	begin := wfe.clk.Now()
+	if prefix == wfe.nonceService.Prefix() {
+		valid := wfe.nonceService.Valid(nonce)
+		wfe.observeNonceRedemption(prefix, nonceOriginLocal, valid, nil, wfe.clk.Now().Sub(begin))
+		return valid
+	}
+
+	peer, ok := wfe.NoncePeers[prefix]
+	if !ok {
+		wfe.stats.Inc("WFE.Nonces.UnknownPrefix", 1, 1.0)
+		wfe.observeNonceRedemption(prefix, nonceOriginUnknown, false, nil, 0)
+		return false
+	}
+	valid, err := peer.Redeem(nonce)
+	wfe.observeNonceRedemption(prefix, nonceOriginPeer, valid, err, wfe.clk.Now().Sub(begin))
+	if err != nil {
+		wfe.stats.Inc("WFE.Nonces.RemoteRedeemErrors", 1, 1.0)
+		wfe.log.Warning(fmt.Sprintf("Failed to redeem nonce with peer %q: %s", prefix, err))
+		return false
+	}
+	wfe.stats.Inc("WFE.Nonces.RemoteRedeemed", 1, 1.0)
+	return valid
+}
+
 // BodylessResponseWriter wraps http.ResponseWriter, discarding
 // anything written to the body.
 type BodylessResponseWriter struct {
@@ -133,6 +313,13 @@ func (mrw BodylessResponseWriter) Write(buf []byte) (int, error) {
 // * Never send a body in response to a HEAD request. Anything
 // written by the handler will be discarded if the method is HEAD.
 // Also, all handlers that accept GET automatically accept HEAD.
+//
+// * Respond http.StatusServiceUnavailable if the handler does not
+// finish within the endpoint's request timeout.
+//
+// * Count and time requests in the metrics served by MetricsHandler.
+//
+// * Recover panics in the handler, answering with an internal error.
 func (wfe *WebFrontEndImpl) HandleFunc(mux *http.ServeMux, pattern string, h wfeHandlerFunc, methods ...string) {
 	methodsMap := make(map[string]bool)
 	for _, m := range methods {
@@ -144,16 +331,15 @@ func (wfe *WebFrontEndImpl) HandleFunc(mux *http.ServeMux, pattern string, h wfe
 		methodsMap["HEAD"] = true
 	}
 	methodsStr := strings.Join(methods, ", ")
-	mux.Handle(pattern, &topHandler{
+	var handler http.Handler = &topHandler{
 		log: wfe.log,
 		clk: clock.Default(),
 		wfe: wfeHandlerFunc(func(logEvent *requestEvent, response http.ResponseWriter, request *http.Request) {
-			// We do not propagate errors here, because (1) they should be
-			// transient, and (2) they fail closed.
-			nonce, err := wfe.nonceService.Nonce()
-			if err == nil {
-				response.Header().Set("Replay-Nonce", nonce)
-			}
+			defer wfe.log.RecoverPanic("WFE", func(p interface{}) {
+				wfe.sendError(response, logEvent, probs.ServerInternal("Internal error"), fmt.Errorf("panic: %v", p))
+			})
+			wfe.setNonceHeader(response)
+			wfe.countClientRequest(logEvent)
 
 			switch request.Method {
 			case "HEAD":
@@ -162,7 +348,7 @@ func (wfe *WebFrontEndImpl) HandleFunc(mux *http.ServeMux, pattern string, h wfe
 				// sending a body.
 				response = BodylessResponseWriter{response}
 			case "OPTIONS":
-				wfe.Options(response, request, methodsStr, methodsMap)
+				wfe.Options(response, request, methodsStr, methodsMap, wfe.allowOrigins(pattern))
 				return
 			}
 
@@ -172,12 +358,47 @@ func (wfe *WebFrontEndImpl) HandleFunc(mux *http.ServeMux, pattern string, h wfe
 				return
 			}
 
-			wfe.setCORSHeaders(response, request, "")
+			wfe.setCORSHeaders(response, request, wfe.allowOrigins(pattern), "")
 
 			// Call the wrapped handler.
 			h(logEvent, response, request)
 		}),
-	})
+	}
+	mux.Handle(pattern, wfe.instrument(pattern, wfe.withTimeout(pattern, handler)))
+}
+
+// setNonceHeader gives a response a fresh Replay-Nonce header. Every
+// response carries one, so that clients rarely need to ask for a nonce
+// before their next POST.
+func (wfe *WebFrontEndImpl) setNonceHeader(response http.ResponseWriter) {
+	// We do not propagate errors here, because (1) they should be
+	// transient, and (2) they fail closed.
+	nonce, err := wfe.nonceService.Nonce()
+	if err == nil {
+		response.Header().Set("Replay-Nonce", nonce)
+	}
+}
+
+// withTimeout bounds the time h may take to respond according to the
+// request timeout configured for pattern.
+func (wfe *WebFrontEndImpl) withTimeout(pattern string, h http.Handler) http.Handler {
+	timeout, ok := wfe.EndpointRequestTimeouts[pattern]
+	if !ok {
+		timeout = wfe.RequestTimeout
+	}
+	if timeout <= 0 {
+		return h
+	}
+	return &timeoutHandler{
+		handler: h,
+		timeout: timeout,
+		onTimeout: func(response http.ResponseWriter, request *http.Request) {
+			wfe.stats.Inc("WFE.HTTP.Timeouts", 1, 1.0)
+			logEvent := &requestEvent{Endpoint: pattern, Method: request.Method}
+			wfe.setNonceHeader(response)
+			wfe.sendError(response, logEvent, probs.Timeout("Request timed out"), nil)
+		},
+	}
 }
 
 // Handler returns an http.Handler that uses various functions for
@@ -190,41 +411,81 @@ func (wfe *WebFrontEndImpl) Handler() (http.Handler, error) {
 	wfe.ChallengeBase = wfe.BaseURL + ChallengePath
 	wfe.NewCert = wfe.BaseURL + NewCertPath
 	wfe.CertBase = wfe.BaseURL + CertPath
+	wfe.OrderBase = wfe.BaseURL + OrderPath
 
 	// Only generate directory once
-	directory := map[string]string{
+	directory := map[string]interface{}{
+		"new-nonce":   wfe.BaseURL + NewNoncePath,
 		"new-reg":     wfe.NewReg,
 		"new-authz":   wfe.NewAuthz,
 		"new-cert":    wfe.NewCert,
 		"revoke-cert": wfe.BaseURL + RevokeCertPath,
+		"fetch-cert":  wfe.BaseURL + FetchCertPath,
+	}
+	meta := map[string]interface{}{}
+	if len(wfe.Profiles) > 0 {
+		meta["profiles"] = wfe.Profiles
+	}
+	if wfe.MaxNames > 0 {
+		meta["maxNames"] = wfe.MaxNames
+	}
+	if len(meta) > 0 {
+		directory["meta"] = meta
 	}
 	directoryJSON, err := json.Marshal(directory)
 	if err != nil {
 		return nil, err
 	}
 	wfe.DirectoryJSON = directoryJSON
+	wfe.directoryModified = wfe.clk.Now()
+	wfe.issuerModified = wfe.clk.Now()
+	if issuer, err := x509.ParseCertificate(wfe.IssuerCert); err == nil {
+		wfe.issuerModified = issuer.NotBefore
+		wfe.defaultIssuerKeyID = hex.EncodeToString(issuer.SubjectKeyId)
+	}
+	wfe.furtherIssuers = make(map[string]issuerCert, len(wfe.FurtherIssuerCerts))
+	for _, der := range wfe.FurtherIssuerCerts {
+		issuer, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse further issuer certificate: %s", err)
+		}
+		wfe.furtherIssuers[hex.EncodeToString(issuer.SubjectKeyId)] = issuerCert{der: der, modified: issuer.NotBefore}
+	}
 
 	m := http.NewServeMux()
 	wfe.HandleFunc(m, DirectoryPath, wfe.Directory, "GET")
+	wfe.HandleFunc(m, NewNoncePath, wfe.NewNonce, "GET")
 	wfe.HandleFunc(m, NewRegPath, wfe.NewRegistration, "POST")
 	wfe.HandleFunc(m, NewAuthzPath, wfe.NewAuthorization, "POST")
 	wfe.HandleFunc(m, NewCertPath, wfe.NewCertificate, "POST")
-	wfe.HandleFunc(m, RegPath, wfe.Registration, "POST")
-	wfe.HandleFunc(m, AuthzPath, wfe.Authorization, "GET")
+	wfe.HandleFunc(m, RegPath, wfe.Registration, "GET", "POST")
+	wfe.HandleFunc(m, AuthzPath, wfe.Authorization, "GET", "POST")
 	wfe.HandleFunc(m, ChallengePath, wfe.Challenge, "GET", "POST")
 	wfe.HandleFunc(m, CertPath, wfe.Certificate, "GET")
+	wfe.HandleFunc(m, OrderPath, wfe.Order, "GET")
 	wfe.HandleFunc(m, RevokeCertPath, wfe.RevokeCertificate, "POST")
+	wfe.HandleFunc(m, FetchCertPath, wfe.FetchCertificate, "POST")
 	wfe.HandleFunc(m, TermsPath, wfe.Terms, "GET")
 	wfe.HandleFunc(m, IssuerPath, wfe.Issuer, "GET")
+	wfe.HandleFunc(m, IssuerPath+"/", wfe.Issuer, "GET")
 	wfe.HandleFunc(m, BuildIDPath, wfe.BuildID, "GET")
+	wfe.HandleFunc(m, StatusPath, wfe.Status, "GET")
+	wfe.HandleFunc(m, ValidationInfoPath, wfe.ValidationInfo, "GET")
+	if wfe.ContactVerifier != nil {
+		wfe.HandleFunc(m, VerifyContactPath, wfe.VerifyContact, "GET")
+	}
 	// We don't use our special HandleFunc for "/" because it matches everything,
 	// meaning we can wind up returning 405 when we mean to return 404. See
 	// https://github.com/letsencrypt/boulder/issues/717
-	m.Handle("/", &topHandler{
+	m.Handle("/", wfe.instrument("/", &topHandler{
 		log: wfe.log,
 		clk: clock.Default(),
-		wfe: wfeHandlerFunc(wfe.Index),
-	})
+		wfe: wfeHandlerFunc(func(logEvent *requestEvent, response http.ResponseWriter, request *http.Request) {
+			wfe.setNonceHeader(response)
+			wfe.countClientRequest(logEvent)
+			wfe.Index(logEvent, response, request)
+		}),
+	}))
 	return m, nil
 }
 
@@ -254,10 +515,14 @@ func (wfe *WebFrontEndImpl) Index(logEvent *requestEvent, response http.Response
 		<body>
 			This is an <a href="https://github.com/letsencrypt/acme-spec/">ACME</a>
 			Certificate Authority running <a href="https://github.com/letsencrypt/boulder">Boulder</a>.
-			JSON directory is available at <a href="%s">%s</a>.
+			<ul>
+				<li>JSON directory: <a href="%s">%s</a></li>
+				<li>Terms of service: <a href="%s">%s</a></li>
+				<li>Build and feature status: <a href="%s">%s</a></li>
+			</ul>
 		</body>
 	</html>
-	`, DirectoryPath, DirectoryPath)))
+	`, DirectoryPath, DirectoryPath, TermsPath, TermsPath, StatusPath, StatusPath)))
 	addCacheHeader(response, wfe.IndexCacheDuration.Seconds())
 }
 
@@ -269,11 +534,34 @@ func addCacheHeader(w http.ResponseWriter, age float64) {
 	w.Header().Add("Cache-Control", fmt.Sprintf("public, max-age=%.f", age))
 }
 
+// serveCacheable writes body with an ETag derived from its contents and with
+// modified as its Last-Modified time, unless the request's If-None-Match or
+// If-Modified-Since headers show that the client's copy is current, in which
+// case it responds 304 Not Modified. A zero modified is not sent.
+func serveCacheable(response http.ResponseWriter, request *http.Request, body []byte, modified time.Time) {
+	digest := sha256.Sum256(body)
+	response.Header().Set("ETag", fmt.Sprintf(`"%s"`, hex.EncodeToString(digest[:])))
+	http.ServeContent(response, request, "", modified, bytes.NewReader(body))
+}
+
 // Directory is an HTTP request handler that simply provides the directory
 // object stored in the WFE's DirectoryJSON member.
 func (wfe *WebFrontEndImpl) Directory(logEvent *requestEvent, response http.ResponseWriter, request *http.Request) {
+	if wfe.DirectoryCacheDuration > 0 {
+		addCacheHeader(response, wfe.DirectoryCacheDuration.Seconds())
+	}
 	response.Header().Set("Content-Type", "application/json")
-	response.Write(wfe.DirectoryJSON)
+	serveCacheable(response, request, wfe.DirectoryJSON, wfe.directoryModified)
+}
+
+// NewNonce is an HTTP request handler for clients that need a nonce and
+// have no other request to make. The nonce itself is added to the response
+// by HandleFunc, as it is to every response.
+func (wfe *WebFrontEndImpl) NewNonce(logEvent *requestEvent, response http.ResponseWriter, request *http.Request) {
+	response.Header().Set("Cache-Control", "no-store")
+	if request.Method == "GET" {
+		response.WriteHeader(http.StatusNoContent)
+	}
 }
 
 // The ID is always the last slash-separated token in the path
@@ -286,6 +574,14 @@ const (
 	unknownKey = "No registration exists matching provided key"
 )
 
+// bodyTooLarge records and returns the problem for a POST body over
+// MaxRequestBodySize.
+func (wfe *WebFrontEndImpl) bodyTooLarge(logEvent *requestEvent) *probs.ProblemDetails {
+	wfe.stats.Inc("WFE.HTTP.ClientErrors.RequestEntityTooLarge", 1, 1.0)
+	logEvent.AddError("POST body larger than %d bytes", wfe.MaxRequestBodySize)
+	return probs.RequestEntityTooLarge(fmt.Sprintf("Request body larger than %d bytes", wfe.MaxRequestBodySize))
+}
+
 // verifyPOST reads and parses the request body, looks up the Registration
 // corresponding to its JWK, verifies the JWS signature, checks that the
 // resource field is present and correct in the JWS protected header, and
@@ -298,7 +594,7 @@ const (
 // the key itself.  verifyPOST also appends its errors to requestEvent.Errors so
 // code calling it does not need to if they imediately return a response to the
 // user.
-func (wfe *WebFrontEndImpl) verifyPOST(logEvent *requestEvent, request *http.Request, regCheck bool, resource core.AcmeResource) ([]byte, *jose.JsonWebKey, core.Registration, *probs.ProblemDetails) {
+func (wfe *WebFrontEndImpl) verifyPOST(logEvent *requestEvent, request *http.Request, regCheck bool, resource core.AcmeResource) ([]byte, *jose.JSONWebKey, core.Registration, *probs.ProblemDetails) {
 	// TODO: We should return a pointer to a registration, which can be nil,
 	// rather the a registration value with a sentinel value.
 	// https://github.com/letsencrypt/boulder/issues/877
@@ -317,12 +613,24 @@ func (wfe *WebFrontEndImpl) verifyPOST(logEvent *requestEvent, request *http.Req
 		return nil, nil, reg, probs.Malformed("No body on POST")
 	}
 
-	bodyBytes, err := ioutil.ReadAll(request.Body)
+	var bodyReader io.Reader = request.Body
+	if wfe.MaxRequestBodySize > 0 {
+		if request.ContentLength > wfe.MaxRequestBodySize {
+			return nil, nil, reg, wfe.bodyTooLarge(logEvent)
+		}
+		// Read one byte past the limit to tell a body of exactly the maximum
+		// size from a larger one.
+		bodyReader = io.LimitReader(request.Body, wfe.MaxRequestBodySize+1)
+	}
+	bodyBytes, err := ioutil.ReadAll(bodyReader)
 	if err != nil {
 		wfe.stats.Inc("WFE.Errors.UnableToReadRequestBody", 1, 1.0)
 		logEvent.AddError("unable to read request body")
 		return nil, nil, reg, probs.ServerInternal("unable to read request body")
 	}
+	if wfe.MaxRequestBodySize > 0 && int64(len(bodyBytes)) > wfe.MaxRequestBodySize {
+		return nil, nil, reg, wfe.bodyTooLarge(logEvent)
+	}
 
 	body := string(bodyBytes)
 	// Parse as JWS
@@ -350,15 +658,27 @@ func (wfe *WebFrontEndImpl) verifyPOST(logEvent *requestEvent, request *http.Req
 		return nil, nil, reg, probs.Malformed("POST JWS not signed")
 	}
 
-	submittedKey := parsedJws.Signatures[0].Header.JsonWebKey
+	if statName, err := checkJWSHeaders(bodyBytes, wfe.requestURL(request)); err != nil {
+		if wfe.EnforceJWSHeaders {
+			wfe.stats.Inc(statName, 1, 1.0)
+			logEvent.AddError("JWS header check failed: %s", err)
+			return nil, nil, reg, probs.Malformed(err.Error())
+		}
+		// Until enforcement is turned on, only count the requests that would
+		// be refused, to see which clients still need updating
+		wfe.stats.Inc(statName+".Unenforced", 1, 1.0)
+		logEvent.Extra["JWSHeaderProblem"] = err.Error()
+	}
+
+	submittedKey := parsedJws.Signatures[0].Header.JSONWebKey
 	if submittedKey == nil {
 		wfe.stats.Inc("WFE.Errors.NoJWKInJWSSignatureHeader", 1, 1.0)
 		logEvent.AddError("no JWK in JWS signature header in POST body")
 		return nil, nil, reg, probs.Malformed("No JWK in JWS header")
 	}
 
-	var key *jose.JsonWebKey
-	reg, err = wfe.SA.GetRegistrationByKey(*submittedKey)
+	var key *jose.JSONWebKey
+	reg, err = wfe.SA.GetRegistrationByKey(request.Context(), *submittedKey)
 	// Special case: If no registration was found, but regCheck is false, use an
 	// empty registration and the submitted key. The caller is expected to do some
 	// validation on the returned key.
@@ -366,7 +686,7 @@ func (wfe *WebFrontEndImpl) verifyPOST(logEvent *requestEvent, request *http.Req
 		// When looking up keys from the registrations DB, we can be confident they
 		// are "good". But when we are verifying against any submitted key, we want
 		// to check its quality before doing the verify.
-		if err = core.GoodKey(submittedKey.Key); err != nil {
+		if err = core.GoodAccountKey(submittedKey.Key, wfe.Ed25519AccountKeys); err != nil {
 			wfe.stats.Inc("WFE.Errors.JWKRejectedByGoodKey", 1, 1.0)
 			logEvent.AddError("JWK in request was rejected by GoodKey: %s", err)
 			return nil, nil, reg, probs.Malformed(err.Error())
@@ -410,7 +730,7 @@ func (wfe *WebFrontEndImpl) verifyPOST(logEvent *requestEvent, request *http.Req
 		wfe.stats.Inc("WFE.Errors.JWSMissingNonce", 1, 1.0)
 		logEvent.AddError("JWS is missing an anti-replay nonce")
 		return nil, nil, reg, probs.BadNonce("JWS has no anti-replay nonce")
-	} else if !wfe.nonceService.Valid(nonce) {
+	} else if !wfe.validNonce(nonce) {
 		wfe.stats.Inc("WFE.Errors.JWSInvalidNonce", 1, 1.0)
 		logEvent.AddError("JWS has an invalid anti-replay nonce")
 		return nil, nil, reg, probs.BadNonce("JWS has invalid anti-replay nonce")
@@ -439,6 +759,16 @@ func (wfe *WebFrontEndImpl) verifyPOST(logEvent *requestEvent, request *http.Req
 	return []byte(payload), key, reg, nil
 }
 
+// lookupProblem returns a NotFound problem with detail notFound if err from an
+// SA lookup says there's no such object, and a ServerInternal problem with
+// detail internal if the lookup itself failed.
+func lookupProblem(err error, notFound, internal string) *probs.ProblemDetails {
+	if _, ok := err.(core.NoSuchRegistrationError); ok || berrors.Is(err, berrors.NotFound) {
+		return probs.NotFound(notFound)
+	}
+	return probs.ServerInternal(internal)
+}
+
 // sendError sends an error response represented by the given ProblemDetails,
 // and, if the ProblemDetails.Type is ServerInternalProblem, audit logs the
 // internal ierr.
@@ -452,13 +782,13 @@ func (wfe *WebFrontEndImpl) sendError(response http.ResponseWriter, logEvent *re
 	// auditable events.
 	if prob.Type == probs.ServerInternalProblem {
 		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-		wfe.log.Audit(fmt.Sprintf("Internal error - %s - %s", prob.Detail, ierr))
+		wfe.log.WithRequestID(logEvent.ID).Audit(fmt.Sprintf("Internal error - %s - %s", prob.Detail, ierr))
 	}
 
 	problemDoc, err := json.Marshal(prob)
 	if err != nil {
 		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-		wfe.log.Audit(fmt.Sprintf("Could not marshal error message: %s - %+v", err, prob))
+		wfe.log.WithRequestID(logEvent.ID).Audit(fmt.Sprintf("Could not marshal error message: %s - %+v", err, prob))
 		problemDoc = []byte("{\"detail\": \"Problem marshalling error message.\"}")
 	}
 
@@ -468,11 +798,25 @@ func (wfe *WebFrontEndImpl) sendError(response http.ResponseWriter, logEvent *re
 	response.WriteHeader(code)
 	response.Write(problemDoc)
 
-	wfe.stats.Inc(fmt.Sprintf("WFE.HTTP.ErrorCodes.%d", code), 1, 1.0)
-	problemSegments := strings.Split(string(prob.Type), ":")
-	if len(problemSegments) > 0 {
-		wfe.stats.Inc(fmt.Sprintf("WFE.HTTP.ProblemTypes.%s", problemSegments[len(problemSegments)-1]), 1, 1.0)
+	wfe.metrics.problems.Inc(string(prob.Type))
+	wfe.countClientProblem(logEvent, prob)
+}
+
+// requestURL reconstructs the URL a client addressed its request to, for
+// comparison with the "url" in a JWS header.
+func (wfe *WebFrontEndImpl) requestURL(request *http.Request) string {
+	var path string
+	if request.URL != nil {
+		path = request.URL.Path
 	}
+	if wfe.BaseURL != "" {
+		return wfe.BaseURL + path
+	}
+	scheme := "http"
+	if request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + request.Host + path
 }
 
 func link(url, relation string) string {
@@ -489,7 +833,7 @@ func (wfe *WebFrontEndImpl) NewRegistration(logEvent *requestEvent, response htt
 		return
 	}
 
-	if existingReg, err := wfe.SA.GetRegistrationByKey(*key); err == nil {
+	if existingReg, err := wfe.SA.GetRegistrationByKey(request.Context(), *key); err == nil {
 		response.Header().Set("Location", fmt.Sprintf("%s%d", wfe.RegBase, existingReg.ID))
 		// TODO(#595): check for missing registration err
 		wfe.sendError(response, logEvent, probs.Conflict("Registration key is already in use"), err)
@@ -520,7 +864,7 @@ func (wfe *WebFrontEndImpl) NewRegistration(logEvent *requestEvent, response htt
 		}
 	}
 
-	reg, err := wfe.RA.NewRegistration(init)
+	reg, err := wfe.RA.NewRegistration(request.Context(), init)
 	if err != nil {
 		logEvent.AddError("unable to create new registration: %s", err)
 		wfe.sendError(response, logEvent, core.ProblemDetailsForError(err, "Error creating new registration"), err)
@@ -532,6 +876,7 @@ func (wfe *WebFrontEndImpl) NewRegistration(logEvent *requestEvent, response htt
 	// Use an explicitly typed variable. Otherwise `go vet' incorrectly complains
 	// that reg.ID is a string being passed to %d.
 	regURL := fmt.Sprintf("%s%d", wfe.RegBase, reg.ID)
+	reg.Orders = regURL + OrdersSuffix
 	responseBody, err := json.Marshal(reg)
 	if err != nil {
 		// ServerInternal because we just created this registration, and it
@@ -574,10 +919,20 @@ func (wfe *WebFrontEndImpl) NewAuthorization(logEvent *requestEvent, response ht
 		wfe.sendError(response, logEvent, probs.Malformed("Error unmarshaling JSON"), err)
 		return
 	}
+	var batch authorizationBatch
+	if err := json.Unmarshal(body, &batch); err != nil {
+		logEvent.AddError("unable to JSON unmarshal Authorization: %s", err)
+		wfe.sendError(response, logEvent, probs.Malformed("Error unmarshaling JSON"), err)
+		return
+	}
+	if len(batch.Identifiers) > 0 {
+		wfe.newAuthorizations(logEvent, response, request, batch.Identifiers, currReg.ID)
+		return
+	}
 	logEvent.Extra["Identifier"] = init.Identifier
 
 	// Create new authz and return
-	authz, err := wfe.RA.NewAuthorization(init, currReg.ID)
+	authz, err := wfe.RA.NewAuthorization(request.Context(), init, currReg.ID)
 	if err != nil {
 		logEvent.AddError("unable to create new authz: %s", err)
 		wfe.sendError(response, logEvent, core.ProblemDetailsForError(err, "Error creating new authz"), err)
@@ -605,6 +960,53 @@ func (wfe *WebFrontEndImpl) NewAuthorization(logEvent *requestEvent, response ht
 	}
 }
 
+// authorizationBatch is a new-authz request for several identifiers at
+// once, and the response to it: the URLs of their authorizations, in the
+// order of the identifiers.
+type authorizationBatch struct {
+	Identifiers    []identifier.ACMEIdentifier `json:"identifiers,omitempty"`
+	Authorizations []string                    `json:"authorizations,omitempty"`
+}
+
+// newAuthorizations creates authorizations for each of identifiers with one
+// request to the RA, for clients that need many names authorized, and
+// responds with their URLs.
+func (wfe *WebFrontEndImpl) newAuthorizations(logEvent *requestEvent, response http.ResponseWriter, request *http.Request, identifiers []identifier.ACMEIdentifier, regID int64) {
+	logEvent.Extra["Identifiers"] = identifiers
+	inits := make([]core.Authorization, len(identifiers))
+	for i, id := range identifiers {
+		inits[i] = core.Authorization{Identifier: id}
+	}
+	authzs, err := wfe.RA.NewAuthorizations(request.Context(), inits, regID)
+	if err != nil {
+		logEvent.AddError("unable to create new authzs: %s", err)
+		wfe.sendError(response, logEvent, core.ProblemDetailsForError(err, "Error creating new authz"), err)
+		return
+	}
+
+	var created authorizationBatch
+	ids := make([]string, len(authzs))
+	for i, authz := range authzs {
+		ids[i] = authz.ID
+		created.Authorizations = append(created.Authorizations, wfe.AuthzBase+authz.ID)
+	}
+	logEvent.Extra["AuthzIDs"] = ids
+	responseBody, err := json.Marshal(created)
+	if err != nil {
+		// ServerInternal because we generated the URLs, they should be OK
+		wfe.sendError(response, logEvent, probs.ServerInternal("Error marshaling authzs"), err)
+		return
+	}
+
+	response.Header().Add("Link", link(wfe.NewCert, "next"))
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(http.StatusCreated)
+	if _, err = response.Write(responseBody); err != nil {
+		logEvent.AddError("unable to write response: %s", err)
+		wfe.log.Warning(fmt.Sprintf("Could not write response: %s", err))
+	}
+}
+
 // RevokeCertificate is used by clients to request the revocation of a cert.
 func (wfe *WebFrontEndImpl) RevokeCertificate(logEvent *requestEvent, response http.ResponseWriter, request *http.Request) {
 
@@ -635,10 +1037,13 @@ func (wfe *WebFrontEndImpl) RevokeCertificate(logEvent *requestEvent, response h
 
 	serial := core.SerialToString(providedCert.SerialNumber)
 	logEvent.Extra["ProvidedCertificateSerial"] = serial
-	cert, err := wfe.SA.GetCertificate(serial)
-	// TODO(#991): handle db errors better
-	if err != nil || !bytes.Equal(cert.DER, revokeRequest.CertificateDER) {
-		wfe.sendError(response, logEvent, probs.NotFound("No such certificate"), err)
+	cert, err := wfe.SA.GetCertificate(request.Context(), serial)
+	if err != nil {
+		wfe.sendError(response, logEvent, lookupProblem(err, "No such certificate", "Unable to look up certificate"), err)
+		return
+	}
+	if !bytes.Equal(cert.DER, revokeRequest.CertificateDER) {
+		wfe.sendError(response, logEvent, probs.NotFound("No such certificate"), nil)
 		return
 	}
 	parsedCertificate, err := x509.ParseCertificate(cert.DER)
@@ -652,11 +1057,10 @@ func (wfe *WebFrontEndImpl) RevokeCertificate(logEvent *requestEvent, response h
 	logEvent.Extra["RetrievedCertificateEmailAddresses"] = parsedCertificate.EmailAddresses
 	logEvent.Extra["RetrievedCertificateIPAddresses"] = parsedCertificate.IPAddresses
 
-	certStatus, err := wfe.SA.GetCertificateStatus(serial)
+	certStatus, err := wfe.SA.GetCertificateStatus(request.Context(), serial)
 	if err != nil {
 		logEvent.AddError("unable to get certificate status: %s", err)
-		// TODO(#991): handle db errors
-		wfe.sendError(response, logEvent, probs.NotFound("Certificate status not yet available"), err)
+		wfe.sendError(response, logEvent, lookupProblem(err, "Certificate status not yet available", "Unable to look up certificate status"), err)
 		return
 	}
 	logEvent.Extra["CertificateStatus"] = certStatus.Status
@@ -668,8 +1072,11 @@ func (wfe *WebFrontEndImpl) RevokeCertificate(logEvent *requestEvent, response h
 	}
 
 	// TODO: Implement method of revocation by authorizations on account.
-	if !(core.KeyDigestEquals(requestKey, parsedCertificate.PublicKey) ||
-		registration.ID == cert.RegistrationID) {
+	if keyMatchesCertificate(requestKey, parsedCertificate) {
+		logEvent.Extra["RevocationAuthorizedBy"] = "certificate key"
+	} else if registration.ID == cert.RegistrationID {
+		logEvent.Extra["RevocationAuthorizedBy"] = "account key"
+	} else {
 		wfe.sendError(response, logEvent,
 			probs.Unauthorized("Revocation request must be signed by private key of cert to be revoked, or by the account key of the account that issued it."),
 			nil)
@@ -677,7 +1084,7 @@ func (wfe *WebFrontEndImpl) RevokeCertificate(logEvent *requestEvent, response h
 	}
 
 	// Use revocation code 0, meaning "unspecified"
-	err = wfe.RA.RevokeCertificateWithReg(*parsedCertificate, 0, registration.ID)
+	err = wfe.RA.RevokeCertificateWithReg(request.Context(), *parsedCertificate, 0, registration.ID)
 	if err != nil {
 		logEvent.AddError("failed to revoke certificate: %s", err)
 		wfe.sendError(response, logEvent, core.ProblemDetailsForError(err, "Failed to revoke certificate"), err)
@@ -687,6 +1094,84 @@ func (wfe *WebFrontEndImpl) RevokeCertificate(logEvent *requestEvent, response h
 	}
 }
 
+// FetchCertificate returns the certificate with the serial a signed request
+// names, so that a client that lost its URL can recover it. Like revocation,
+// the request must be signed by the account key of the account that was
+// issued the certificate, or by the certificate's own key.
+func (wfe *WebFrontEndImpl) FetchCertificate(logEvent *requestEvent, response http.ResponseWriter, request *http.Request) {
+	// As with revocation, there needn't be a registration for the key
+	body, requestKey, registration, prob := wfe.verifyPOST(logEvent, request, false, core.ResourceFetchCert)
+	if prob != nil {
+		// verifyPOST handles its own setting of logEvent.Errors
+		wfe.sendError(response, logEvent, prob, nil)
+		return
+	}
+
+	var fetchRequest struct {
+		Serial string `json:"serial"`
+	}
+	if err := json.Unmarshal(body, &fetchRequest); err != nil {
+		logEvent.AddError("unable to JSON parse fetch-cert request: %s", err)
+		wfe.sendError(response, logEvent, probs.Malformed("Unable to JSON parse fetch-cert request"), err)
+		return
+	}
+	serial := strings.ToLower(fetchRequest.Serial)
+	if serial == "" || !core.ValidSerial(serial) {
+		logEvent.AddError("certificate serial provided was not valid: %s", fetchRequest.Serial)
+		wfe.sendError(response, logEvent, probs.Malformed("Invalid certificate serial"), nil)
+		return
+	}
+	logEvent.Extra["RequestedSerial"] = serial
+
+	cert, err := wfe.SA.GetCertificate(request.Context(), serial)
+	if err != nil {
+		logEvent.AddError("unable to get certificate by serial id %#v: %s", serial, err)
+		wfe.sendError(response, logEvent, lookupProblem(err, "Certificate not found", "Unable to look up certificate"), err)
+		return
+	}
+	parsedCertificate, err := x509.ParseCertificate(cert.DER)
+	if err != nil {
+		// InternalServerError because this is a failure to decode from our DB.
+		wfe.sendError(response, logEvent, probs.ServerInternal("invalid parse of stored certificate"), err)
+		return
+	}
+
+	if keyMatchesCertificate(requestKey, parsedCertificate) {
+		logEvent.Extra["FetchAuthorizedBy"] = "certificate key"
+	} else if registration.ID != 0 && registration.ID == cert.RegistrationID {
+		logEvent.Extra["FetchAuthorizedBy"] = "account key"
+	} else {
+		wfe.sendError(response, logEvent,
+			probs.Unauthorized("Request must be signed by the private key of the certificate, or by the account key of the account that issued it."),
+			nil)
+		return
+	}
+
+	// TODO Content negotiation
+	response.Header().Set("Content-Type", "application/pkix-cert")
+	response.Header().Set("Location", wfe.CertBase+serial)
+	response.Header().Add("Link", link(wfe.BaseURL+wfe.issuerPath(request.Context(), serial, parsedCertificate), "up"))
+	response.WriteHeader(http.StatusOK)
+	if _, err = response.Write(cert.DER); err != nil {
+		logEvent.AddError(err.Error())
+		wfe.log.Warning(fmt.Sprintf("Could not write response: %s", err))
+	}
+}
+
+// keyMatchesCertificate returns true if key is the public key certified by
+// cert, i.e. if a request signed by key was signed with the certificate's
+// private key.
+func keyMatchesCertificate(key *jose.JSONWebKey, cert *x509.Certificate) bool {
+	if key == nil {
+		return false
+	}
+	spki, err := x509.MarshalPKIXPublicKey(key.Key)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(spki, cert.RawSubjectPublicKeyInfo)
+}
+
 func (wfe *WebFrontEndImpl) logCsr(request *http.Request, cr core.CertificateRequest, registration core.Registration) {
 	var csrLog = struct {
 		ClientAddr   string
@@ -697,7 +1182,7 @@ func (wfe *WebFrontEndImpl) logCsr(request *http.Request, cr core.CertificateReq
 		CsrBase64:    cr.Bytes,
 		Registration: registration,
 	}
-	wfe.log.AuditObject("Certificate request", csrLog)
+	wfe.log.WithRequestID(core.RequestID(request.Context())).AuditObject("Certificate request", csrLog)
 }
 
 // NewCertificate is used by clients to request the issuance of a cert for an
@@ -724,6 +1209,27 @@ func (wfe *WebFrontEndImpl) NewCertificate(logEvent *requestEvent, response http
 		return
 	}
 	wfe.logCsr(request, certificateRequest, reg)
+	if profile := certificateRequest.Profile; profile != "" {
+		if _, ok := wfe.Profiles[profile]; !ok {
+			logEvent.AddError("unknown certificate profile %q", profile)
+			wfe.sendError(response, logEvent, probs.Malformed("Unknown certificate profile %q", profile), nil)
+			return
+		}
+		logEvent.Extra["Profile"] = profile
+	}
+	if key := certificateRequest.IdempotencyKey; key != "" {
+		if len(key) > maxIdempotencyKeyLength {
+			logEvent.AddError("idempotency key of %d bytes", len(key))
+			wfe.sendError(response, logEvent, probs.Malformed("Idempotency key longer than %d bytes", maxIdempotencyKeyLength), nil)
+			return
+		}
+		logEvent.Extra["IdempotencyKey"] = key
+	}
+	if prob := wfe.checkNames(certificateRequest.CSR); prob != nil {
+		logEvent.AddError("bad names in CSR: %s", prob.Detail)
+		wfe.sendError(response, logEvent, prob, nil)
+		return
+	}
 	// Check that the key in the CSR is good. This will also be checked in the CA
 	// component, but we want to discard CSRs with bad keys as early as possible
 	// because (a) it's an easy check and we can save unnecessary requests and
@@ -732,7 +1238,14 @@ func (wfe *WebFrontEndImpl) NewCertificate(logEvent *requestEvent, response http
 	// be audited.
 	if err := core.GoodKey(certificateRequest.CSR.PublicKey); err != nil {
 		logEvent.AddError("CSR public key failed GoodKey: %s", err)
-		wfe.sendError(response, logEvent, probs.Malformed("Invalid key in certificate request :: %s", err), err)
+		wfe.sendError(response, logEvent, probs.BadPublicKey("Invalid key in certificate request :: %s", err), err)
+		return
+	}
+	// The RA makes the same check, but there's no need to send it requests
+	// that are bound to fail
+	if prob := core.CheckCSRKeyNotAccountKey(certificateRequest.CSR, reg.Key); prob != nil {
+		logEvent.AddError("CSR public key is the account key")
+		wfe.sendError(response, logEvent, prob, nil)
 		return
 	}
 	logEvent.Extra["CSRDNSNames"] = certificateRequest.CSR.DNSNames
@@ -745,7 +1258,10 @@ func (wfe *WebFrontEndImpl) NewCertificate(logEvent *requestEvent, response http
 	// authorized for target site, they could cause issuance for that site by
 	// lying to the RA. We should probably pass a copy of the whole rquest to the
 	// RA for secondary validation.
-	cert, err := wfe.RA.NewCertificate(certificateRequest, reg.ID)
+	if wfe.AsyncIssuance && wfe.newCertificateOrder(logEvent, response, request, certificateRequest, reg.ID) {
+		return
+	}
+	cert, err := wfe.RA.NewCertificate(request.Context(), certificateRequest, reg.ID)
 	if err != nil {
 		logEvent.AddError("unable to create new cert: %s", err)
 		wfe.sendError(response, logEvent, core.ProblemDetailsForError(err, "Error creating new cert"), err)
@@ -767,7 +1283,7 @@ func (wfe *WebFrontEndImpl) NewCertificate(logEvent *requestEvent, response http
 
 	// TODO Content negotiation
 	response.Header().Add("Location", certURL)
-	response.Header().Add("Link", link(wfe.BaseURL+IssuerPath, "up"))
+	response.Header().Add("Link", link(wfe.BaseURL+wfe.issuerPath(request.Context(), core.SerialToString(serial), parsedCertificate), "up"))
 	response.Header().Set("Content-Type", "application/pkix-cert")
 	response.WriteHeader(http.StatusCreated)
 	if _, err = response.Write(cert.DER); err != nil {
@@ -776,6 +1292,147 @@ func (wfe *WebFrontEndImpl) NewCertificate(logEvent *requestEvent, response http
 	}
 }
 
+// certificateOrder is a certificate order as clients see it: the URL of its
+// certificate once issued, why issuance failed, or until then when it
+// expires.
+type certificateOrder struct {
+	Status      core.AcmeStatus       `json:"status"`
+	Certificate string                `json:"certificate,omitempty"`
+	Error       *probs.ProblemDetails `json:"error,omitempty"`
+	Expires     *time.Time            `json:"expires,omitempty"`
+}
+
+// writeCertificateOrder sends order with code, pointing a valid order at its
+// certificate, and telling when a processing order expires.
+func (wfe *WebFrontEndImpl) writeCertificateOrder(logEvent *requestEvent, response http.ResponseWriter, order core.CertificateOrder, code int) {
+	display := certificateOrder{Status: order.Status, Error: order.Error}
+	if order.Status == core.StatusProcessing && !order.Expires.IsZero() {
+		display.Expires = &order.Expires
+	}
+	if order.Status == core.StatusValid {
+		display.Certificate = wfe.CertBase + order.Serial
+		response.Header().Add("Link", link(display.Certificate, "certificate"))
+	}
+	jsonReply, err := json.Marshal(display)
+	if err != nil {
+		logEvent.AddError("Failed to JSON marshal certificate order: %s", err)
+		wfe.sendError(response, logEvent, probs.ServerInternal("Failed to JSON marshal certificate order"), err)
+		return
+	}
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(code)
+	if _, err = response.Write(jsonReply); err != nil {
+		logEvent.AddError("%s", err)
+		wfe.log.Warning(fmt.Sprintf("Could not write response: %s", err))
+	}
+}
+
+// newCertificateOrder has the RA accept a new-cert request, sending the
+// client the order to poll for its certificate. It returns false, having
+// sent nothing, if certificate orders aren't supported yet because the
+// database schema lacks them, so that the certificate is issued at once.
+func (wfe *WebFrontEndImpl) newCertificateOrder(logEvent *requestEvent, response http.ResponseWriter, request *http.Request, certificateRequest core.CertificateRequest, regID int64) bool {
+	order, err := wfe.RA.NewCertificateOrder(request.Context(), certificateRequest, regID)
+	if _, ok := err.(core.NotSupportedError); ok {
+		logEvent.Extra["CertificateOrdersUnsupported"] = true
+		return false
+	}
+	if err != nil {
+		logEvent.AddError("unable to create new certificate order: %s", err)
+		wfe.sendError(response, logEvent, core.ProblemDetailsForError(err, "Error creating new cert"), err)
+		return true
+	}
+	logEvent.Extra["CertificateOrderID"] = order.ID
+
+	response.Header().Set("Location", wfe.OrderBase+order.ID)
+	if wait := wfe.PollPolicy.retryAfter(1); wait > 0 {
+		response.Header().Set("Retry-After", retryAfterSeconds(wait))
+	}
+	wfe.writeCertificateOrder(logEvent, response, order, http.StatusAccepted)
+	return true
+}
+
+// Order is polled by clients for the outcome of a certificate order.
+func (wfe *WebFrontEndImpl) Order(logEvent *requestEvent, response http.ResponseWriter, request *http.Request) {
+	id := parseIDFromPath(request.URL.Path)
+	order, err := wfe.SA.GetCertificateOrder(request.Context(), id)
+	if err != nil {
+		logEvent.AddError("No such certificate order at id %s", id)
+		prob := lookupProblem(err, "Unable to find certificate order", "Unable to get certificate order")
+		if _, ok := err.(core.NotSupportedError); ok {
+			// An SA without certificate orders has none to find
+			prob = probs.NotFound("Unable to find certificate order")
+		}
+		wfe.sendError(response, logEvent, prob, err)
+		return
+	}
+	logEvent.Extra["CertificateOrderID"] = order.ID
+	logEvent.Extra["CertificateOrderStatus"] = order.Status
+
+	if !wfe.pacePoll(response, request, logEvent, "order", order.RegistrationID, order.ID, order.Status == core.StatusProcessing) {
+		return
+	}
+	wfe.writeCertificateOrder(logEvent, response, order, http.StatusOK)
+}
+
+// checkNames rejects CSRs naming more than MaxNames unique identifiers, and CSRs
+// that repeat an identifier or name one alongside a wildcard covering it,
+// before the request costs the RA or SA any work.
+func (wfe *WebFrontEndImpl) checkNames(csr *x509.CertificateRequest) *probs.ProblemDetails {
+	names := csr.DNSNames
+	if cn := csr.Subject.CommonName; cn != "" {
+		found := false
+		for _, name := range names {
+			if strings.EqualFold(name, cn) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			names = append([]string{cn}, names...)
+		}
+	}
+
+	// Names are counted as the RA and CA count them, once each
+	if count := len(identifier.FromCSR(csr)); wfe.MaxNames > 0 && count > wfe.MaxNames {
+		wfe.metrics.rejectedNames.Inc("too_many")
+		return probs.Malformed("Certificate request has %d names, maximum is %d", count, wfe.MaxNames)
+	}
+
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		seen[strings.ToLower(name)] = true
+	}
+	var badNames []string
+	var subProblems []probs.SubProblemDetails
+	reported := make(map[string]bool)
+	for _, name := range names {
+		name = strings.ToLower(name)
+		var detail string
+		if reported[name] {
+			detail = fmt.Sprintf("%s is named more than once", name)
+		} else if dot := strings.Index(name, "."); dot > 0 && !strings.HasPrefix(name, "*.") && seen["*"+name[dot:]] {
+			detail = fmt.Sprintf("%s is already covered by *%s", name, name[dot:])
+		}
+		reported[name] = true
+		if detail == "" {
+			continue
+		}
+		badNames = append(badNames, name)
+		subProblems = append(subProblems, probs.SubProblemDetails{
+			ProblemDetails: *probs.Malformed(detail),
+			Identifier:     probs.Identifier{Type: string(core.IdentifierDNS), Value: name},
+		})
+	}
+	if len(badNames) > 0 {
+		wfe.metrics.rejectedNames.Inc("duplicate")
+		prob := probs.Malformed("Certificate request has duplicate or overlapping names: %s", strings.Join(badNames, ", "))
+		prob.SubProblems = subProblems
+		return prob
+	}
+	return nil
+}
+
 // Challenge handles POST requests to challenge URLs.  Such requests are clients'
 // responses to the server's challenges.
 func (wfe *WebFrontEndImpl) Challenge(
@@ -804,10 +1461,9 @@ func (wfe *WebFrontEndImpl) Challenge(
 	logEvent.Extra["AuthorizationID"] = authorizationID
 	logEvent.Extra["ChallengeID"] = challengeID
 
-	authz, err := wfe.SA.GetAuthorization(authorizationID)
+	authz, err := wfe.SA.GetAuthorization(request.Context(), authorizationID)
 	if err != nil {
-		// TODO(#1198): handle db errors etc
-		notFound()
+		wfe.sendError(response, logEvent, lookupProblem(err, "No such challenge", "Unable to look up authorization"), err)
 		return
 	}
 
@@ -834,6 +1490,9 @@ func (wfe *WebFrontEndImpl) Challenge(
 
 	switch request.Method {
 	case "GET", "HEAD":
+		if !wfe.pacePoll(response, request, logEvent, "challenge", authz.RegistrationID, authz.ID, challengeInProgress(challenge)) {
+			return
+		}
 		wfe.getChallenge(response, request, authz, &challenge, logEvent)
 
 	case "POST":
@@ -934,7 +1593,7 @@ func (wfe *WebFrontEndImpl) postChallenge(
 	}
 
 	// Ask the RA to update this authorization
-	updatedAuthorization, err := wfe.RA.UpdateAuthorization(authz, challengeIndex, challengeUpdate)
+	updatedAuthorization, err := wfe.RA.UpdateAuthorization(request.Context(), authz, challengeIndex, challengeUpdate)
 	if err != nil {
 		logEvent.AddError("unable to update challenge: %s", err)
 		wfe.sendError(response, logEvent, core.ProblemDetailsForError(err, "Unable to update challenge"), err)
@@ -965,7 +1624,17 @@ func (wfe *WebFrontEndImpl) postChallenge(
 }
 
 // Registration is used by a client to submit an update to their registration.
+// GET requests are only allowed for a registration's orders list.
 func (wfe *WebFrontEndImpl) Registration(logEvent *requestEvent, response http.ResponseWriter, request *http.Request) {
+	if strings.HasSuffix(request.URL.Path, OrdersSuffix) {
+		wfe.Orders(logEvent, response, request)
+		return
+	}
+	if request.Method != "POST" {
+		response.Header().Set("Allow", "POST")
+		wfe.sendError(response, logEvent, probs.MethodNotAllowed(), nil)
+		return
+	}
 
 	body, _, currReg, prob := wfe.verifyPOST(logEvent, request, true, core.ResourceRegistration)
 	if prob != nil {
@@ -1015,13 +1684,14 @@ func (wfe *WebFrontEndImpl) Registration(logEvent *requestEvent, response http.R
 	update.Key = currReg.Key
 
 	// Ask the RA to update this authorization.
-	updatedReg, err := wfe.RA.UpdateRegistration(currReg, update)
+	updatedReg, err := wfe.RA.UpdateRegistration(request.Context(), currReg, update)
 	if err != nil {
 		logEvent.AddError("unable to update registration: %s", err)
 		wfe.sendError(response, logEvent, core.ProblemDetailsForError(err, "Unable to update registration"), err)
 		return
 	}
 
+	updatedReg.Orders = fmt.Sprintf("%s%d%s", wfe.RegBase, updatedReg.ID, OrdersSuffix)
 	jsonReply, err := json.Marshal(updatedReg)
 	if err != nil {
 		// ServerInternal because we just generated the reg, it should be OK
@@ -1038,16 +1708,105 @@ func (wfe *WebFrontEndImpl) Registration(logEvent *requestEvent, response http.R
 	response.Write(jsonReply)
 }
 
+// order describes a certificate issued to a registration in its orders list.
+type order struct {
+	Status      core.AcmeStatus             `json:"status"`
+	Identifiers []identifier.ACMEIdentifier `json:"identifiers"`
+	Expires     time.Time                   `json:"expires"`
+	Certificate string                      `json:"certificate"`
+}
+
+// Orders lists, a page at a time and newest first, the orders of the
+// registration whose URL precedes OrdersSuffix in the request path. The
+// "cursor" query parameter selects the page; a Link header with rel="next"
+// points to the following one, if there is one.
+func (wfe *WebFrontEndImpl) Orders(logEvent *requestEvent, response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" && request.Method != "HEAD" {
+		response.Header().Set("Allow", "GET, HEAD")
+		wfe.sendError(response, logEvent, probs.MethodNotAllowed(), nil)
+		return
+	}
+
+	idStr := parseIDFromPath(strings.TrimSuffix(request.URL.Path, OrdersSuffix))
+	regID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || regID <= 0 {
+		logEvent.AddError("invalid registration ID %#v", idStr)
+		wfe.sendError(response, logEvent, probs.NotFound("No such registration"), err)
+		return
+	}
+	if _, err = wfe.SA.GetRegistration(request.Context(), regID); err != nil {
+		logEvent.AddError("unable to find registration %d: %s", regID, err)
+		wfe.sendError(response, logEvent, lookupProblem(err, "No such registration", "Unable to look up registration"), err)
+		return
+	}
+
+	cursor := 0
+	if c := request.URL.Query().Get("cursor"); c != "" {
+		cursor, err = strconv.Atoi(c)
+		if err != nil || cursor < 0 {
+			logEvent.AddError("invalid orders cursor %#v", c)
+			wfe.sendError(response, logEvent, probs.Malformed("Invalid cursor"), err)
+			return
+		}
+	}
+
+	// Ask for one more than a page, to learn whether there's a next page
+	pageSize := wfe.OrdersPageSize
+	certs, err := wfe.SA.GetCertificatesByRegistration(request.Context(), regID, cursor, pageSize+1)
+	if err != nil {
+		logEvent.AddError("unable to list certificates of registration %d: %s", regID, err)
+		wfe.sendError(response, logEvent, probs.ServerInternal("Unable to list orders"), err)
+		return
+	}
+	more := len(certs) > pageSize
+	if more {
+		certs = certs[:pageSize]
+	}
+
+	orders := []order{}
+	for _, cert := range certs {
+		parsed, err := x509.ParseCertificate(cert.DER)
+		if err != nil {
+			logEvent.AddError("unable to parse certificate %s: %s", cert.Serial, err)
+			wfe.sendError(response, logEvent, probs.ServerInternal("Unable to list orders"), err)
+			return
+		}
+		o := order{
+			Status:      core.StatusValid,
+			Identifiers: []identifier.ACMEIdentifier{},
+			Expires:     parsed.NotAfter,
+			Certificate: wfe.CertBase + cert.Serial,
+		}
+		o.Identifiers = append(o.Identifiers, identifier.FromCert(parsed)...)
+		orders = append(orders, o)
+	}
+
+	jsonReply, err := json.Marshal(struct {
+		Orders []order `json:"orders"`
+	}{orders})
+	if err != nil {
+		logEvent.AddError("unable to marshal orders: %s", err)
+		wfe.sendError(response, logEvent, probs.ServerInternal("Unable to list orders"), err)
+		return
+	}
+	if more {
+		next := fmt.Sprintf("%s%d%s?cursor=%d", wfe.RegBase, regID, OrdersSuffix, cursor+pageSize)
+		response.Header().Add("Link", link(next, "next"))
+	}
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(http.StatusOK)
+	response.Write(jsonReply)
+}
+
 // Authorization is used by clients to submit an update to one of their
 // authorizations.
 func (wfe *WebFrontEndImpl) Authorization(logEvent *requestEvent, response http.ResponseWriter, request *http.Request) {
 	// Requests to this handler should have a path that leads to a known authz
 	id := parseIDFromPath(request.URL.Path)
-	authz, err := wfe.SA.GetAuthorization(id)
+	authz, err := wfe.SA.GetAuthorization(request.Context(), id)
 	if err != nil {
 		logEvent.AddError("No such authorization at id %s", id)
-		// TODO(#1199): handle db errors
-		wfe.sendError(response, logEvent, probs.NotFound("Unable to find authorization"), err)
+		wfe.sendError(response, logEvent, lookupProblem(err, "Unable to find authorization", "Unable to look up authorization"), err)
 		return
 	}
 	logEvent.Extra["AuthorizationID"] = authz.ID
@@ -1064,6 +1823,14 @@ func (wfe *WebFrontEndImpl) Authorization(logEvent *requestEvent, response http.
 		return
 	}
 
+	if request.Method == "POST" {
+		if !wfe.deactivateAuthorization(response, request, &authz, logEvent) {
+			return
+		}
+	} else if !wfe.pacePoll(response, request, logEvent, "authz", authz.RegistrationID, authz.ID, authorizationInProgress(authz)) {
+		return
+	}
+
 	wfe.prepAuthorizationForDisplay(&authz)
 
 	jsonReply, err := json.Marshal(authz)
@@ -1082,6 +1849,55 @@ func (wfe *WebFrontEndImpl) Authorization(logEvent *requestEvent, response http.
 	}
 }
 
+// deactivateAuthorization handles a POST of {"status":"deactivated"} to an
+// authorization by the account that owns it. It returns false if it sent an
+// error response.
+func (wfe *WebFrontEndImpl) deactivateAuthorization(
+	response http.ResponseWriter,
+	request *http.Request,
+	authz *core.Authorization,
+	logEvent *requestEvent) bool {
+	body, _, currReg, prob := wfe.verifyPOST(logEvent, request, true, core.ResourceAuthz)
+	if prob != nil {
+		// verifyPOST handles its own setting of logEvent.Errors
+		wfe.sendError(response, logEvent, prob, nil)
+		return false
+	}
+
+	if currReg.ID != authz.RegistrationID {
+		logEvent.AddError("User registration id: %d != Authorization registration id: %v", currReg.ID, authz.RegistrationID)
+		wfe.sendError(response,
+			logEvent,
+			probs.Unauthorized("User registration ID doesn't match registration ID in authorization"),
+			nil,
+		)
+		return false
+	}
+
+	var update struct {
+		Status core.AcmeStatus `json:"status"`
+	}
+	if err := json.Unmarshal(body, &update); err != nil {
+		logEvent.AddError("error JSON unmarshalling authorization update: %s", err)
+		wfe.sendError(response, logEvent, probs.Malformed("Error unmarshaling authorization update"), err)
+		return false
+	}
+	if update.Status != core.StatusDeactivated {
+		logEvent.AddError("invalid authorization update status: %s", update.Status)
+		wfe.sendError(response, logEvent, probs.Malformed("Invalid status value"), nil)
+		return false
+	}
+
+	if err := wfe.RA.DeactivateAuthorization(request.Context(), *authz); err != nil {
+		logEvent.AddError("unable to deactivate authorization: %s", err)
+		wfe.sendError(response, logEvent, core.ProblemDetailsForError(err, "Unable to deactivate authorization"), err)
+		return false
+	}
+	authz.Status = core.StatusDeactivated
+	logEvent.Extra["AuthorizationStatus"] = authz.Status
+	return true
+}
+
 var allHex = regexp.MustCompile("^[0-9a-f]+$")
 
 // Certificate is used by clients to request a copy of their current certificate, or to
@@ -1106,29 +1922,24 @@ func (wfe *WebFrontEndImpl) Certificate(logEvent *requestEvent, response http.Re
 	}
 	logEvent.Extra["RequestedSerial"] = serial
 
-	cert, err := wfe.SA.GetCertificate(serial)
-	// TODO(#991): handle db errors
+	cert, err := wfe.SA.GetCertificate(request.Context(), serial)
 	if err != nil {
 		logEvent.AddError("unable to get certificate by serial id %#v: %s", serial, err)
-		if strings.HasPrefix(err.Error(), "gorp: multiple rows returned") {
-			wfe.sendError(response, logEvent, probs.Conflict("Multiple certificates with same short serial"), err)
-		} else {
-			addNoCacheHeader(response)
-			wfe.sendError(response, logEvent, probs.NotFound("Certificate not found"), err)
-		}
+		addNoCacheHeader(response)
+		wfe.sendError(response, logEvent, lookupProblem(err, "Certificate not found", "Unable to look up certificate"), err)
 		return
 	}
 
 	addCacheHeader(response, wfe.CertCacheDuration.Seconds())
 
+	// A certificate that won't parse is still served, linked to the default
+	// issuer
+	parsedCertificate, _ := x509.ParseCertificate(cert.DER)
+
 	// TODO Content negotiation
 	response.Header().Set("Content-Type", "application/pkix-cert")
-	response.Header().Add("Link", link(IssuerPath, "up"))
-	response.WriteHeader(http.StatusOK)
-	if _, err = response.Write(cert.DER); err != nil {
-		logEvent.AddError(err.Error())
-		wfe.log.Warning(fmt.Sprintf("Could not write response: %s", err))
-	}
+	response.Header().Add("Link", link(wfe.issuerPath(request.Context(), serial, parsedCertificate), "up"))
+	serveCacheable(response, request, cert.DER, cert.Issued)
 	return
 }
 
@@ -1138,17 +1949,58 @@ func (wfe *WebFrontEndImpl) Terms(logEvent *requestEvent, response http.Response
 	http.Redirect(response, request, wfe.SubscriberAgreementURL, http.StatusFound)
 }
 
-// Issuer obtains the issuer certificate used by this instance of Boulder.
+// issuerCert is the certificate of one of the CA's further issuers.
+type issuerCert struct {
+	der      []byte
+	modified time.Time
+}
+
+// issuerPath returns the path of the issuer certificate of the certificate
+// with serial, cert: IssuerPath for the default issuer, or IssuerPath/ and the
+// key ID of a further issuer. The issuer is the one the SA recorded for the
+// certificate, or, for certificates added before issuers were recorded, the
+// one the certificate names by its authority key ID.
+func (wfe *WebFrontEndImpl) issuerPath(ctx context.Context, serial string, cert *x509.Certificate) string {
+	if len(wfe.furtherIssuers) == 0 {
+		return IssuerPath
+	}
+	keyID, err := wfe.SA.GetCertificateIssuer(ctx, serial)
+	if err != nil {
+		if !berrors.Is(err, berrors.NotFound) {
+			if _, ok := err.(core.NotSupportedError); !ok {
+				wfe.log.Warning(fmt.Sprintf("Unable to look up issuer of %s: %s", serial, err))
+			}
+		}
+		keyID = ""
+		if cert != nil {
+			keyID = hex.EncodeToString(cert.AuthorityKeyId)
+		}
+	}
+	if _, ok := wfe.furtherIssuers[keyID]; !ok || keyID == wfe.defaultIssuerKeyID {
+		return IssuerPath
+	}
+	return IssuerPath + "/" + keyID
+}
+
+// Issuer obtains the issuer certificate used by this instance of Boulder, or
+// at IssuerPath/ and a hex subject key ID, that of one of its further
+// issuers.
 func (wfe *WebFrontEndImpl) Issuer(logEvent *requestEvent, response http.ResponseWriter, request *http.Request) {
+	der, modified := wfe.IssuerCert, wfe.issuerModified
+	if keyID := strings.TrimPrefix(request.URL.Path, IssuerPath+"/"); keyID != request.URL.Path && keyID != wfe.defaultIssuerKeyID {
+		issuer, ok := wfe.furtherIssuers[keyID]
+		if !ok {
+			logEvent.AddError("unknown issuer key ID %q", keyID)
+			wfe.sendError(response, logEvent, probs.NotFound("Issuer not found"), nil)
+			return
+		}
+		der, modified = issuer.der, issuer.modified
+	}
 	addCacheHeader(response, wfe.IssuerCacheDuration.Seconds())
 
 	// TODO Content negotiation
 	response.Header().Set("Content-Type", "application/pkix-cert")
-	response.WriteHeader(http.StatusOK)
-	if _, err := response.Write(wfe.IssuerCert); err != nil {
-		logEvent.AddError("unable to write issuer certificate response: %s", err)
-		wfe.log.Warning(fmt.Sprintf("Could not write response: %s", err))
-	}
+	serveCacheable(response, request, der, modified)
 }
 
 // BuildID tells the requestor what build we're running.
@@ -1162,8 +2014,99 @@ func (wfe *WebFrontEndImpl) BuildID(logEvent *requestEvent, response http.Respon
 	}
 }
 
+// Status reports the build that is running and which optional features are
+// enabled, as JSON for dashboards and for checking connectivity. It is not
+// part of the ACME spec.
+func (wfe *WebFrontEndImpl) Status(logEvent *requestEvent, response http.ResponseWriter, request *http.Request) {
+	status := struct {
+		BuildID   string          `json:"buildID"`
+		BuildTime string          `json:"buildTime"`
+		BuildHost string          `json:"buildHost"`
+		GoVersion string          `json:"goVersion"`
+		Features  map[string]bool `json:"features"`
+	}{
+		BuildID:   core.GetBuildID(),
+		BuildTime: core.GetBuildTime(),
+		BuildHost: core.GetBuildHost(),
+		GoVersion: runtime.Version(),
+		Features: map[string]bool{
+			"contactVerification": wfe.ContactVerifier != nil,
+			"certificateProfiles": len(wfe.Profiles) > 0,
+			"enforceJWSHeaders":   wfe.EnforceJWSHeaders,
+			"ed25519AccountKeys":  wfe.Ed25519AccountKeys,
+			"noncePeers":          len(wfe.NoncePeers) > 0,
+			"pollLimits":          wfe.PollPolicy.MaxPolls > 0,
+		},
+	}
+	statusJSON, err := json.Marshal(status)
+	if err != nil {
+		logEvent.AddError("unable to marshal status: %s", err)
+		wfe.sendError(response, logEvent, probs.ServerInternal("Failed to marshal status"), err)
+		return
+	}
+	addNoCacheHeader(response)
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(http.StatusOK)
+	response.Write(statusJSON)
+}
+
+// ValidationInfo tells site operators how to recognise the VA's validation
+// requests. It is not part of the ACME spec.
+func (wfe *WebFrontEndImpl) ValidationInfo(logEvent *requestEvent, response http.ResponseWriter, request *http.Request) {
+	info := struct {
+		UserAgents   []string `json:"userAgents"`
+		SourceRanges []string `json:"sourceRanges"`
+	}{
+		UserAgents:   wfe.ValidationUserAgents,
+		SourceRanges: wfe.ValidationSourceRanges,
+	}
+	if info.UserAgents == nil {
+		info.UserAgents = []string{}
+	}
+	if info.SourceRanges == nil {
+		info.SourceRanges = []string{}
+	}
+	infoJSON, err := json.Marshal(info)
+	if err != nil {
+		logEvent.AddError("unable to marshal validation info: %s", err)
+		wfe.sendError(response, logEvent, probs.ServerInternal("Failed to marshal validation info"), err)
+		return
+	}
+	addCacheHeader(response, wfe.IndexCacheDuration.Seconds())
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(http.StatusOK)
+	response.Write(infoJSON)
+}
+
+// VerifyContact marks a registration contact as verified when the contact
+// follows the link they were mailed. It is not part of the ACME spec.
+func (wfe *WebFrontEndImpl) VerifyContact(logEvent *requestEvent, response http.ResponseWriter, request *http.Request) {
+	regID, contact, err := wfe.ContactVerifier.Verify(request.URL.Query())
+	if err == mail.ErrExpiredVerificationLink {
+		wfe.sendError(response, logEvent, probs.Unauthorized("Verification link has expired; update your registration's contacts to get a new one"), err)
+		return
+	} else if err != nil {
+		wfe.sendError(response, logEvent, probs.Malformed("Invalid verification link"), err)
+		return
+	}
+	logEvent.Requester = regID
+	logEvent.Extra["Contact"] = contact
+
+	if err = wfe.RA.VerifyContact(request.Context(), regID, contact); err != nil {
+		wfe.sendError(response, logEvent, core.ProblemDetailsForError(err, "Unable to verify contact"), err)
+		return
+	}
+
+	response.Header().Set("Content-Type", "text/plain")
+	response.WriteHeader(http.StatusOK)
+	if _, err = fmt.Fprintln(response, "Contact verified"); err != nil {
+		logEvent.AddError("unable to write contact verification response: %s", err)
+		wfe.log.Warning(fmt.Sprintf("Could not write response: %s", err))
+	}
+}
+
 // Options responds to an HTTP OPTIONS request.
-func (wfe *WebFrontEndImpl) Options(response http.ResponseWriter, request *http.Request, methodsStr string, methodsMap map[string]bool) {
+func (wfe *WebFrontEndImpl) Options(response http.ResponseWriter, request *http.Request, methodsStr string, methodsMap map[string]bool, allowOrigins []string) {
 	// Every OPTIONS request gets an Allow header with a list of supported methods.
 	response.Header().Set("Allow", methodsStr)
 
@@ -1174,15 +2117,23 @@ func (wfe *WebFrontEndImpl) Options(response http.ResponseWriter, request *http.
 		reqMethod = "GET"
 	}
 	if methodsMap[reqMethod] {
-		wfe.setCORSHeaders(response, request, methodsStr)
+		wfe.setCORSHeaders(response, request, allowOrigins, methodsStr)
 	}
 }
 
+// allowOrigins returns the CORS origin allowlist for the endpoint pattern.
+func (wfe *WebFrontEndImpl) allowOrigins(pattern string) []string {
+	if origins, ok := wfe.EndpointAllowOrigins[pattern]; ok {
+		return origins
+	}
+	return wfe.AllowOrigins
+}
+
 // setCORSHeaders() tells the client that CORS is acceptable for this
-// request. If allowMethods == "" the request is assumed to be a CORS
-// actual request and no Access-Control-Allow-Methods header will be
-// sent.
-func (wfe *WebFrontEndImpl) setCORSHeaders(response http.ResponseWriter, request *http.Request, allowMethods string) {
+// request, if its origin is in allowOrigins. If allowMethods == "" the
+// request is assumed to be a CORS actual request and no
+// Access-Control-Allow-Methods header will be sent.
+func (wfe *WebFrontEndImpl) setCORSHeaders(response http.ResponseWriter, request *http.Request, allowOrigins []string, allowMethods string) {
 	reqOrigin := request.Header.Get("Origin")
 	if reqOrigin == "" {
 		// This is not a CORS request.
@@ -1193,7 +2144,7 @@ func (wfe *WebFrontEndImpl) setCORSHeaders(response http.ResponseWriter, request
 	// allowed origin in config. Otherwise, disallow by returning
 	// without setting any CORS headers.
 	allow := false
-	for _, ao := range wfe.AllowOrigins {
+	for _, ao := range allowOrigins {
 		if ao == "*" {
 			response.Header().Set("Access-Control-Allow-Origin", "*")
 			allow = true
@@ -1206,13 +2157,19 @@ func (wfe *WebFrontEndImpl) setCORSHeaders(response http.ResponseWriter, request
 		}
 	}
 	if !allow {
+		if len(allowOrigins) > 0 {
+			// Another origin would get a different response
+			response.Header().Set("Vary", "Origin")
+		}
 		return
 	}
 
 	if allowMethods != "" {
-		// For an OPTIONS request: allow all methods handled at this URL.
+		// For an OPTIONS request: allow all methods handled at this URL,
+		// and the Content-Type that ACME POSTs carry.
 		response.Header().Set("Access-Control-Allow-Methods", allowMethods)
+		response.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 	}
-	response.Header().Set("Access-Control-Expose-Headers", "Link, Replay-Nonce")
+	response.Header().Set("Access-Control-Expose-Headers", "Link, Replay-Nonce, Retry-After, "+pollAttemptHeader)
 	response.Header().Set("Access-Control-Max-Age", "86400")
 }
@@ -7,10 +7,16 @@ package wfe
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/hex"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -25,16 +31,21 @@ import (
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/jmhodges/clock"
-	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/letsencrypt/go-jose"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/golang.org/x/crypto/ed25519"
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/square/go-jose.v2"
+	"github.com/letsencrypt/boulder/identifier"
 	"github.com/letsencrypt/boulder/probs"
 
 	"github.com/letsencrypt/boulder/cmd"
 	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/mail"
 	"github.com/letsencrypt/boulder/mocks"
 	"github.com/letsencrypt/boulder/ra"
 	"github.com/letsencrypt/boulder/test"
 )
 
+var ctx = context.Background()
+
 const (
 	agreementURL = "http://example.invalid/terms"
 
@@ -114,43 +125,95 @@ wk6Oiadty3eQqSBJv0HnpmiEdQVffIK5Pg4M8Dd+aOBnEkbopAJOuA==
 
 type MockRegistrationAuthority struct{}
 
-func (ra *MockRegistrationAuthority) NewRegistration(reg core.Registration) (core.Registration, error) {
+func (ra *MockRegistrationAuthority) NewRegistration(ctx context.Context, reg core.Registration) (core.Registration, error) {
 	return reg, nil
 }
 
-func (ra *MockRegistrationAuthority) NewAuthorization(authz core.Authorization, regID int64) (core.Authorization, error) {
+func (ra *MockRegistrationAuthority) NewAuthorization(ctx context.Context, authz core.Authorization, regID int64) (core.Authorization, error) {
 	authz.RegistrationID = regID
 	authz.ID = "bkrPh2u0JUf18-rVBZtOOWWb3GuIiliypL-hBM9Ak1Q"
 	return authz, nil
 }
 
-func (ra *MockRegistrationAuthority) NewCertificate(req core.CertificateRequest, regID int64) (core.Certificate, error) {
+func (ra *MockRegistrationAuthority) NewAuthorizations(ctx context.Context, authzs []core.Authorization, regID int64) ([]core.Authorization, error) {
+	for i := range authzs {
+		authzs[i].RegistrationID = regID
+		authzs[i].ID = authzs[i].Identifier.Value
+	}
+	return authzs, nil
+}
+
+func (ra *MockRegistrationAuthority) NewCertificate(ctx context.Context, req core.CertificateRequest, regID int64) (core.Certificate, error) {
 	return core.Certificate{}, nil
 }
 
-func (ra *MockRegistrationAuthority) UpdateRegistration(reg core.Registration, updated core.Registration) (core.Registration, error) {
+func (ra *MockRegistrationAuthority) NewCertificateOrder(ctx context.Context, req core.CertificateRequest, regID int64) (core.CertificateOrder, error) {
+	return core.CertificateOrder{ID: "processing", RegistrationID: regID, Status: core.StatusProcessing}, nil
+}
+
+func (ra *MockRegistrationAuthority) UpdateRegistration(ctx context.Context, reg core.Registration, updated core.Registration) (core.Registration, error) {
 	return reg, nil
 }
 
-func (ra *MockRegistrationAuthority) UpdateAuthorization(authz core.Authorization, foo int, challenge core.Challenge) (core.Authorization, error) {
+func (ra *MockRegistrationAuthority) UpdateAuthorization(ctx context.Context, authz core.Authorization, foo int, challenge core.Challenge) (core.Authorization, error) {
 	return authz, nil
 }
 
-func (ra *MockRegistrationAuthority) RevokeCertificateWithReg(cert x509.Certificate, reason core.RevocationCode, reg int64) error {
+func (ra *MockRegistrationAuthority) RevokeCertificateWithReg(ctx context.Context, cert x509.Certificate, reason core.RevocationCode, reg int64) error {
+	return nil
+}
+
+func (ra *MockRegistrationAuthority) AdministrativelyRevokeCertificate(ctx context.Context, cert x509.Certificate, reason core.RevocationCode, user string) error {
+	return nil
+}
+
+func (ra *MockRegistrationAuthority) AdministrativelyReleaseCertificateHold(ctx context.Context, cert x509.Certificate, user string) error {
+	return nil
+}
+
+func (ra *MockRegistrationAuthority) AdministrativelyRevokeCertificatesByKey(ctx context.Context, keyHash string, user string) error {
+	return nil
+}
+
+func (ra *MockRegistrationAuthority) AdministrativelyBlockKey(ctx context.Context, keyHash string, user string) error {
+	return nil
+}
+
+func (ra *MockRegistrationAuthority) AdministrativelyDenyNames(ctx context.Context, names []string, user string) error {
+	return nil
+}
+
+func (ra *MockRegistrationAuthority) AdministrativelySetAccountTier(ctx context.Context, regID int64, tier core.AccountTier, user string) error {
+	return nil
+}
+
+func (ra *MockRegistrationAuthority) AdministrativelySetRateLimitOverride(ctx context.Context, override core.RateLimitOverride, user string) error {
+	return nil
+}
+
+func (ra *MockRegistrationAuthority) AdministrativelyRemoveRateLimitOverride(ctx context.Context, limit, key string, regID int64, user string) error {
+	return nil
+}
+
+func (ra *MockRegistrationAuthority) AdministrativelyReviewAuthorization(ctx context.Context, authzID string, approve bool, user string) error {
+	return nil
+}
+
+func (ra *MockRegistrationAuthority) DeactivateAuthorization(ctx context.Context, authz core.Authorization) error {
 	return nil
 }
 
-func (ra *MockRegistrationAuthority) AdministrativelyRevokeCertificate(cert x509.Certificate, reason core.RevocationCode, user string) error {
+func (ra *MockRegistrationAuthority) VerifyContact(ctx context.Context, regID int64, contact string) error {
 	return nil
 }
 
-func (ra *MockRegistrationAuthority) OnValidationUpdate(authz core.Authorization) error {
+func (ra *MockRegistrationAuthority) OnValidationUpdate(ctx context.Context, authz core.Authorization) error {
 	return nil
 }
 
 type MockCA struct{}
 
-func (ca *MockCA) IssueCertificate(csr x509.CertificateRequest, regID int64) (core.Certificate, error) {
+func (ca *MockCA) IssueCertificate(ctx context.Context, csr x509.CertificateRequest, regID int64, profile string, validity core.Validity) (core.Certificate, error) {
 	// Return a basic certificate so NewCertificate can continue
 	certPtr, err := core.LoadCert("test/not-an-example.com.crt")
 	if err != nil {
@@ -161,35 +224,49 @@ func (ca *MockCA) IssueCertificate(csr x509.CertificateRequest, regID int64) (co
 	}, nil
 }
 
-func (ca *MockCA) GenerateOCSP(xferObj core.OCSPSigningRequest) (ocsp []byte, err error) {
+func (ca *MockCA) GenerateOCSP(ctx context.Context, xferObj core.OCSPSigningRequest) (ocsp []byte, err error) {
 	return
 }
 
-func (ca *MockCA) RevokeCertificate(serial string, reasonCode core.RevocationCode) (err error) {
+func (ca *MockCA) RevokeCertificate(ctx context.Context, serial string, reasonCode core.RevocationCode) (err error) {
 	return
 }
 
 type MockPA struct{}
 
-func (pa *MockPA) ChallengesFor(identifier core.AcmeIdentifier, key *jose.JsonWebKey) (challenges []core.Challenge, combinations [][]int, err error) {
+func (pa *MockPA) ChallengesFor(identifier identifier.ACMEIdentifier, key *jose.JSONWebKey) (challenges []core.Challenge, combinations [][]int, err error) {
 	return
 }
 
-func (pa *MockPA) WillingToIssue(id core.AcmeIdentifier, regID int64) error {
+func (pa *MockPA) WillingToIssue(id identifier.ACMEIdentifier, regID int64) error {
 	return nil
 }
 
+func (pa *MockPA) HighRisk(id identifier.ACMEIdentifier) bool {
+	return false
+}
+
 func makeBody(s string) io.ReadCloser {
 	return ioutil.NopCloser(strings.NewReader(s))
 }
 
+// newSigner makes a signer for key that embeds its JWK in each JWS, as ACME
+// requests do, and includes a nonce from nonceService unless it's nil.
+func newSigner(t *testing.T, alg jose.SignatureAlgorithm, key interface{}, nonceService *core.NonceService) jose.Signer {
+	opts := &jose.SignerOptions{EmbedJWK: true}
+	if nonceService != nil {
+		opts.NonceSource = nonceService
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: alg, Key: key}, opts)
+	test.AssertNotError(t, err, "Failed to make signer")
+	return signer
+}
+
 func signRequest(t *testing.T, req string, nonceService *core.NonceService) string {
-	accountKey, err := jose.LoadPrivateKey([]byte(test1KeyPrivatePEM))
+	accountKey, err := core.LoadPrivateKey([]byte(test1KeyPrivatePEM))
 	test.AssertNotError(t, err, "Failed to load key")
 
-	signer, err := jose.NewSigner("RS256", accountKey)
-	test.AssertNotError(t, err, "Failed to make signer")
-	signer.SetNonceSource(nonceService)
+	signer := newSigner(t, "RS256", accountKey, nonceService)
 	result, err := signer.Sign([]byte(req))
 	test.AssertNotError(t, err, "Failed to sign req")
 	ret := result.FullSerialize()
@@ -353,7 +430,7 @@ func TestHandleFunc(t *testing.T) {
 	test.AssertEquals(t, rw.Code, http.StatusOK)
 	test.AssertEquals(t, rw.Header().Get("Access-Control-Allow-Methods"), "")
 	test.AssertEquals(t, rw.Header().Get("Access-Control-Allow-Origin"), "*")
-	test.AssertEquals(t, sortHeader(rw.Header().Get("Access-Control-Expose-Headers")), "Link, Replay-Nonce")
+	test.AssertEquals(t, sortHeader(rw.Header().Get("Access-Control-Expose-Headers")), "Boulder-Poll-Attempt, Link, Replay-Nonce, Retry-After")
 
 	// CORS preflight request for disallowed method
 	runWrappedHandler(&http.Request{
@@ -381,7 +458,8 @@ func TestHandleFunc(t *testing.T) {
 	test.AssertEquals(t, rw.Header().Get("Access-Control-Allow-Origin"), "*")
 	test.AssertEquals(t, rw.Header().Get("Access-Control-Max-Age"), "86400")
 	test.AssertEquals(t, sortHeader(rw.Header().Get("Access-Control-Allow-Methods")), "GET, HEAD, POST")
-	test.AssertEquals(t, sortHeader(rw.Header().Get("Access-Control-Expose-Headers")), "Link, Replay-Nonce")
+	test.AssertEquals(t, rw.Header().Get("Access-Control-Allow-Headers"), "Content-Type")
+	test.AssertEquals(t, sortHeader(rw.Header().Get("Access-Control-Expose-Headers")), "Boulder-Poll-Attempt, Link, Replay-Nonce, Retry-After")
 
 	// OPTIONS request without an Origin header (i.e., not a CORS
 	// preflight request)
@@ -456,6 +534,30 @@ func TestHandleFunc(t *testing.T) {
 		// http://www.w3.org/TR/cors/ section 6.4:
 		test.AssertEquals(t, rw.Header().Get("Vary"), "Origin")
 	}
+
+	// An endpoint's own allowlist takes the place of AllowOrigins
+	corsRequest := func() *http.Request {
+		return &http.Request{
+			Method: "GET",
+			Header: map[string][]string{
+				"Origin": {testOrigin},
+			},
+		}
+	}
+	wfe.AllowOrigins = []string{}
+	wfe.EndpointAllowOrigins = map[string][]string{"/test": {testOrigin}}
+	runWrappedHandler(corsRequest(), "GET")
+	test.AssertEquals(t, rw.Header().Get("Access-Control-Allow-Origin"), testOrigin)
+
+	wfe.AllowOrigins = []string{"*"}
+	wfe.EndpointAllowOrigins = map[string][]string{"/test": {"https://other.example"}}
+	runWrappedHandler(corsRequest(), "GET")
+	test.AssertEquals(t, rw.Header().Get("Access-Control-Allow-Origin"), "")
+	test.AssertEquals(t, rw.Header().Get("Vary"), "Origin")
+
+	wfe.EndpointAllowOrigins = map[string][]string{"/other": {}}
+	runWrappedHandler(corsRequest(), "GET")
+	test.AssertEquals(t, rw.Header().Get("Access-Control-Allow-Origin"), "*")
 }
 
 func TestIndexPOST(t *testing.T) {
@@ -495,6 +597,10 @@ func TestIndex(t *testing.T) {
 	test.AssertNotEquals(t, responseWriter.Body.String(), "404 page not found\n")
 	test.Assert(t, strings.Contains(responseWriter.Body.String(), DirectoryPath),
 		"directory path not found")
+	test.Assert(t, strings.Contains(responseWriter.Body.String(), TermsPath),
+		"terms path not found")
+	test.Assert(t, strings.Contains(responseWriter.Body.String(), StatusPath),
+		"status path not found")
 	test.AssertEquals(t, responseWriter.Header().Get("Cache-Control"), "public, max-age=10")
 
 	responseWriter.Body.Reset()
@@ -508,6 +614,31 @@ func TestIndex(t *testing.T) {
 	test.AssertEquals(t, responseWriter.Header().Get("Cache-Control"), "")
 }
 
+func TestStatus(t *testing.T) {
+	wfe, _ := setupWFE(t)
+	wfe.EnforceJWSHeaders = true
+	mux, err := wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+
+	responseWriter := httptest.NewRecorder()
+	mux.ServeHTTP(responseWriter, &http.Request{
+		Method: "GET",
+		URL:    mustParseURL(StatusPath),
+	})
+	test.AssertEquals(t, responseWriter.Code, http.StatusOK)
+	test.AssertEquals(t, responseWriter.Header().Get("Content-Type"), "application/json")
+
+	var status struct {
+		BuildID  string
+		Features map[string]bool
+	}
+	err = json.Unmarshal(responseWriter.Body.Bytes(), &status)
+	test.AssertNotError(t, err, "Failed to unmarshal status")
+	test.AssertEquals(t, status.BuildID, core.GetBuildID())
+	test.Assert(t, status.Features["enforceJWSHeaders"], "Enabled feature not reported")
+	test.Assert(t, !status.Features["contactVerification"], "Disabled feature reported")
+}
+
 func TestDirectory(t *testing.T) {
 	wfe, _ := setupWFE(t)
 	wfe.BaseURL = "http://localhost:4300"
@@ -523,7 +654,156 @@ func TestDirectory(t *testing.T) {
 	})
 	test.AssertEquals(t, responseWriter.Header().Get("Content-Type"), "application/json")
 	test.AssertEquals(t, responseWriter.Code, http.StatusOK)
-	test.AssertEquals(t, responseWriter.Body.String(), `{"new-authz":"http://localhost:4300/acme/new-authz","new-cert":"http://localhost:4300/acme/new-cert","new-reg":"http://localhost:4300/acme/new-reg","revoke-cert":"http://localhost:4300/acme/revoke-cert"}`)
+	test.AssertEquals(t, responseWriter.Body.String(), `{"fetch-cert":"http://localhost:4300/acme/fetch-cert","new-authz":"http://localhost:4300/acme/new-authz","new-cert":"http://localhost:4300/acme/new-cert","new-nonce":"http://localhost:4300/acme/new-nonce","new-reg":"http://localhost:4300/acme/new-reg","revoke-cert":"http://localhost:4300/acme/revoke-cert"}`)
+}
+
+func TestDirectoryProfiles(t *testing.T) {
+	wfe, _ := setupWFE(t)
+	wfe.BaseURL = "http://localhost:4300"
+	wfe.Profiles = map[string]CertificateProfile{
+		"ee":    {Description: "Standard", Validity: 7776000},
+		"short": {Validity: 604800},
+	}
+	mux, err := wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+
+	responseWriter := httptest.NewRecorder()
+	mux.ServeHTTP(responseWriter, &http.Request{
+		Method: "GET",
+		URL:    mustParseURL(DirectoryPath),
+	})
+	test.AssertEquals(t, responseWriter.Code, http.StatusOK)
+	test.AssertContains(t, responseWriter.Body.String(), `"meta":{"profiles":{"ee":{"description":"Standard","validity":7776000},"short":{"validity":604800}}}`)
+}
+
+func TestDirectoryMaxNames(t *testing.T) {
+	wfe, _ := setupWFE(t)
+	wfe.BaseURL = "http://localhost:4300"
+	wfe.MaxNames = 100
+	mux, err := wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+
+	responseWriter := httptest.NewRecorder()
+	mux.ServeHTTP(responseWriter, &http.Request{
+		Method: "GET",
+		URL:    mustParseURL(DirectoryPath),
+	})
+	test.AssertEquals(t, responseWriter.Code, http.StatusOK)
+	test.AssertContains(t, responseWriter.Body.String(), `"meta":{"maxNames":100}`)
+}
+
+func TestNewNonce(t *testing.T) {
+	wfe, _ := setupWFE(t)
+	mux, err := wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+
+	testCases := []struct {
+		method string
+		code   int
+	}{
+		{"HEAD", http.StatusOK},
+		{"GET", http.StatusNoContent},
+		{"POST", http.StatusMethodNotAllowed},
+	}
+	for _, tc := range testCases {
+		rw := httptest.NewRecorder()
+		mux.ServeHTTP(rw, &http.Request{Method: tc.method, URL: mustParseURL(NewNoncePath)})
+		test.AssertEquals(t, rw.Code, tc.code)
+		nonce := rw.Header().Get("Replay-Nonce")
+		test.Assert(t, nonce != "", "Nonce header missing for "+tc.method)
+		test.Assert(t, wfe.nonceService.Valid(nonce), "Nonce invalid for "+tc.method)
+		if tc.code != http.StatusMethodNotAllowed {
+			test.AssertEquals(t, rw.Header().Get("Cache-Control"), "no-store")
+			test.AssertEquals(t, rw.Body.String(), "")
+		}
+	}
+}
+
+func TestNonceOnEveryResponse(t *testing.T) {
+	wfe, _ := setupWFE(t)
+	mux, err := wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+
+	requests := []*http.Request{
+		&http.Request{Method: "GET", URL: mustParseURL("/")},
+		&http.Request{Method: "GET", URL: mustParseURL("/no-such-path")},
+		&http.Request{Method: "GET", URL: mustParseURL(DirectoryPath)},
+		&http.Request{Method: "GET", URL: mustParseURL(NewRegPath)},
+		&http.Request{Method: "OPTIONS", URL: mustParseURL(NewRegPath)},
+		makePostRequestWithPath(NewRegPath, "not JWS"),
+	}
+	for _, request := range requests {
+		rw := httptest.NewRecorder()
+		mux.ServeHTTP(rw, request)
+		test.Assert(t, rw.Header().Get("Replay-Nonce") != "",
+			fmt.Sprintf("Nonce header missing for %s %s (%d)", request.Method, request.URL.Path, rw.Code))
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	wfe, _ := setupWFE(t)
+	mux, err := wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+
+	seen := make(map[string]bool)
+	for _, path := range []string{DirectoryPath, DirectoryPath, "/no-such-path"} {
+		rw := httptest.NewRecorder()
+		mux.ServeHTTP(rw, &http.Request{Method: "GET", URL: mustParseURL(path)})
+		id := rw.Header().Get(core.RequestIDHeader)
+		test.Assert(t, id != "", fmt.Sprintf("No request ID in response to %s", path))
+		test.Assert(t, !seen[id], fmt.Sprintf("Request ID %s was reused", id))
+		seen[id] = true
+	}
+}
+
+func TestValidationInfo(t *testing.T) {
+	wfe, _ := setupWFE(t)
+	mux, err := wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, &http.Request{Method: "GET", URL: mustParseURL(ValidationInfoPath)})
+	test.AssertEquals(t, rw.Code, http.StatusOK)
+	test.AssertEquals(t, rw.Body.String(), `{"userAgents":[],"sourceRanges":[]}`)
+
+	wfe.ValidationUserAgents = []string{"boulder-va"}
+	wfe.ValidationSourceRanges = []string{"192.0.2.0/24", "2001:db8::/32"}
+	rw = httptest.NewRecorder()
+	mux.ServeHTTP(rw, &http.Request{Method: "GET", URL: mustParseURL(ValidationInfoPath)})
+	test.AssertEquals(t, rw.Code, http.StatusOK)
+	test.AssertEquals(t, rw.Header().Get("Content-Type"), "application/json")
+	test.AssertEquals(t, rw.Body.String(),
+		`{"userAgents":["boulder-va"],"sourceRanges":["192.0.2.0/24","2001:db8::/32"]}`)
+}
+
+func TestEndpointMetrics(t *testing.T) {
+	wfe, _ := setupWFE(t)
+	mux, err := wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+
+	requests := []*http.Request{
+		&http.Request{Method: "GET", URL: mustParseURL(DirectoryPath)},
+		&http.Request{Method: "GET", URL: mustParseURL(DirectoryPath)},
+		&http.Request{Method: "GET", URL: mustParseURL(NewRegPath)},
+		&http.Request{Method: "BREW", URL: mustParseURL(NewRegPath)},
+		&http.Request{Method: "GET", URL: mustParseURL("/no-such-path")},
+	}
+	for _, request := range requests {
+		mux.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	m := wfe.metrics
+	test.AssertEquals(t, m.requests.Value(DirectoryPath, "GET", "200"), float64(2))
+	test.AssertEquals(t, m.requests.Value(NewRegPath, "GET", "405"), float64(1))
+	test.AssertEquals(t, m.requests.Value(NewRegPath, "other", "405"), float64(1))
+	test.AssertEquals(t, m.requests.Value("/", "GET", "404"), float64(1))
+	test.AssertEquals(t, m.latency.Count(DirectoryPath, "GET"), uint64(2))
+	test.AssertEquals(t, m.problems.Value(string(probs.MalformedProblem)), float64(2))
+
+	rw := httptest.NewRecorder()
+	wfe.MetricsHandler().ServeHTTP(rw, &http.Request{Method: "GET", URL: mustParseURL("/metrics")})
+	test.AssertEquals(t, rw.Code, http.StatusOK)
+	test.AssertContains(t, rw.Body.String(),
+		`wfe_http_requests_total{endpoint="/directory",method="GET",code="200"} 2`)
 }
 
 // TODO: Write additional test cases for:
@@ -620,6 +900,30 @@ func TestIssueCertificate(t *testing.T) {
 		responseWriter.Body.String(),
 		`{"type":"urn:acme:error:unauthorized","detail":"Error creating new cert :: Invalid signature on CSR","status":403}`)
 
+	// Valid CSR, but a profile that isn't offered
+	responseWriter.Body.Reset()
+	wfe.NewCertificate(newRequestEvent(), responseWriter,
+		makePostRequest(signRequest(t, `{
+			"resource":"new-cert",
+			"profile":"long",
+			"csr": "MIICWDCCAUACAQAwEzERMA8GA1UEAwwIbWVlcC5jb20wggEiMA0GCSqGSIb3DQEBAQUAA4IBDwAwggEKAoIBAQCaqzue57mgXEoGTZZoVkkCZraebWgXI8irX2BgQB1A3iZa9onxGPMcWQMxhSuUisbEJi4UkMcVST12HX01rUwhj41UuBxJvI1w4wvdstssTAaa9c9tsQ5-UED2bFRL1MsyBdbmCF_-pu3i-ZIYqWgiKbjVBe3nlAVbo77zizwp3Y4Tp1_TBOwTAuFkHePmkNT63uPm9My_hNzsSm1o-Q519Cf7ry-JQmOVgz_jIgFVGFYJ17EV3KUIpUuDShuyCFATBQspgJSN2DoXRUlQjXXkNTj23OxxdT_cVLcLJjytyG6e5izME2R2aCkDBWIc1a4_sRJ0R396auPXG6KhJ7o_AgMBAAGgADANBgkqhkiG9w0BAQsFAAOCAQEALu046p76aKgvoAEHFINkMTgKokPXf9mZ4IZx_BKz-qs1MPMxVtPIrQDVweBH6tYT7Hfj2naLry6SpZ3vUNP_FYeTFWgW1V03LiqacX-QQgbEYtn99Dt3ScGyzb7EH833ztb3vDJ_-ha_CJplIrg-kHBBrlLFWXhh-I9K1qLRTNpbhZ18ooFde4Sbhkw9o9fKivGhx9aYr7ZbjRsNtKit_DsG1nwEXz53TMJ2vB9IQY29coJv_n5NFLkvBfzbG5faRNiFcimPYBO2jFdaA2mWzfxltLtwMF_dBwzTXDpMo3TVT9zEdV8YpsWqr63igqGDZVpKenlkqvRTeGJVayVuMA"
+		}`, wfe.nonceService)))
+	test.AssertEquals(t,
+		responseWriter.Body.String(),
+		`{"type":"urn:acme:error:malformed","detail":"Unknown certificate profile \"long\"","status":400}`)
+
+	// Valid CSR, but an idempotency key that's too long
+	responseWriter.Body.Reset()
+	wfe.NewCertificate(newRequestEvent(), responseWriter,
+		makePostRequest(signRequest(t, `{
+			"resource":"new-cert",
+			"idempotencyKey":"`+strings.Repeat("k", maxIdempotencyKeyLength+1)+`",
+			"csr": "MIICWDCCAUACAQAwEzERMA8GA1UEAwwIbWVlcC5jb20wggEiMA0GCSqGSIb3DQEBAQUAA4IBDwAwggEKAoIBAQCaqzue57mgXEoGTZZoVkkCZraebWgXI8irX2BgQB1A3iZa9onxGPMcWQMxhSuUisbEJi4UkMcVST12HX01rUwhj41UuBxJvI1w4wvdstssTAaa9c9tsQ5-UED2bFRL1MsyBdbmCF_-pu3i-ZIYqWgiKbjVBe3nlAVbo77zizwp3Y4Tp1_TBOwTAuFkHePmkNT63uPm9My_hNzsSm1o-Q519Cf7ry-JQmOVgz_jIgFVGFYJ17EV3KUIpUuDShuyCFATBQspgJSN2DoXRUlQjXXkNTj23OxxdT_cVLcLJjytyG6e5izME2R2aCkDBWIc1a4_sRJ0R396auPXG6KhJ7o_AgMBAAGgADANBgkqhkiG9w0BAQsFAAOCAQEALu046p76aKgvoAEHFINkMTgKokPXf9mZ4IZx_BKz-qs1MPMxVtPIrQDVweBH6tYT7Hfj2naLry6SpZ3vUNP_FYeTFWgW1V03LiqacX-QQgbEYtn99Dt3ScGyzb7EH833ztb3vDJ_-ha_CJplIrg-kHBBrlLFWXhh-I9K1qLRTNpbhZ18ooFde4Sbhkw9o9fKivGhx9aYr7ZbjRsNtKit_DsG1nwEXz53TMJ2vB9IQY29coJv_n5NFLkvBfzbG5faRNiFcimPYBO2jFdaA2mWzfxltLtwMF_dBwzTXDpMo3TVT9zEdV8YpsWqr63igqGDZVpKenlkqvRTeGJVayVuMA"
+		}`, wfe.nonceService)))
+	test.AssertEquals(t,
+		responseWriter.Body.String(),
+		`{"type":"urn:acme:error:malformed","detail":"Idempotency key longer than 255 bytes","status":400}`)
+
 	// Valid, signed JWS body, payload has a valid CSR but no authorizations:
 	// openssl req -outform der -new -nodes -key wfe/test/178.key -subj /CN=meep.com | b64url
 	mockLog.Clear()
@@ -631,7 +935,7 @@ func TestIssueCertificate(t *testing.T) {
 		}`, wfe.nonceService)))
 	test.AssertEquals(t,
 		responseWriter.Body.String(),
-		`{"type":"urn:acme:error:unauthorized","detail":"Error creating new cert :: Authorizations for these names not found or expired: meep.com","status":403}`)
+		`{"type":"urn:acme:error:unauthorized","detail":"Authorizations for these names not found or expired: meep.com","status":403,"subproblems":[{"type":"urn:acme:error:unauthorized","detail":"No authorization found for meep.com","status":403,"identifier":{"type":"dns","value":"meep.com"}}]}`)
 	assertCsrLogged(t, mockLog)
 
 	mockLog.Clear()
@@ -664,6 +968,177 @@ func TestIssueCertificate(t *testing.T) {
 	test.AssertContains(t, reqlogs[0].Message, `"CommonName":"not-an-example.com",`)
 }
 
+// orderRecordingSA passes on the certificate orders the RA finalizes.
+type orderRecordingSA struct {
+	*mocks.StorageAuthority
+	finalized chan core.CertificateOrder
+}
+
+func (sa orderRecordingSA) FinalizeCertificateOrder(ctx context.Context, order core.CertificateOrder) error {
+	sa.finalized <- order
+	return nil
+}
+
+func TestAsyncIssueCertificate(t *testing.T) {
+	wfe, fc := setupWFE(t)
+	wfe.AsyncIssuance = true
+	wfe.PollPolicy.ValidationLatency = 2 * time.Second
+	_, err := wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+	mockLog := wfe.log.SyslogWriter.(*mocks.SyslogWriter)
+
+	// As in TestIssueCertificate, match the mock CA's certificate
+	testTime := time.Date(2015, 9, 9, 22, 56, 0, 0, time.UTC)
+	fc.Add(fc.Now().Sub(testTime))
+
+	stats, _ := statsd.NewNoopClient(nil)
+	ra := ra.NewRegistrationAuthorityImpl(fc, wfe.log, stats, nil, cmd.RateLimitConfig{}, 0)
+	sa := orderRecordingSA{mocks.NewStorageAuthority(fc), make(chan core.CertificateOrder, 1)}
+	ra.SA = sa
+	ra.CA = &MockCA{}
+	ra.PA = &MockPA{}
+	wfe.RA = ra
+
+	// Requests that fail the RA's checks are refused at once
+	responseWriter := httptest.NewRecorder()
+	wfe.NewCertificate(newRequestEvent(), responseWriter,
+		makePostRequest(signRequest(t, `{
+			"resource":"new-cert",
+			"csr": "MIICWDCCAUACAQAwEzERMA8GA1UEAwwIbWVlcC5jb20wggEiMA0GCSqGSIb3DQEBAQUAA4IBDwAwggEKAoIBAQCaqzue57mgXEoGTZZoVkkCZraebWgXI8irX2BgQB1A3iZa9onxGPMcWQMxhSuUisbEJi4UkMcVST12HX01rUwhj41UuBxJvI1w4wvdstssTAaa9c9tsQ5-UED2bFRL1MsyBdbmCF_-pu3i-ZIYqWgiKbjVBe3nlAVbo77zizwp3Y4Tp1_TBOwTAuFkHePmkNT63uPm9My_hNzsSm1o-Q519Cf7ry-JQmOVgz_jIgFVGFYJ17EV3KUIpUuDShuyCFATBQspgJSN2DoXRUlQjXXkNTj23OxxdT_cVLcLJjytyG6e5izME2R2aCkDBWIc1a4_sRJ0R396auPXG6KhJ7o_AgMBAAGgADANBgkqhkiG9w0BAQsFAAOCAQEALu046p76aKgvoAEHFINkMTgKokPXf9mZ4IZx_BKz-qs1MPMxVtPIrQDVweBH6tYT7Hfj2naLry6SpZ3vUNP_FYeTFWgW1V03LiqacX-QQgbEYtn99Dt3ScGyzb7EH833ztb3vDJ_-ha_CJplIrg-kHBBrlLFWXhh-I9K1qLRTNpbhZ18ooFde4Sbhkw9o9fKivGhx9aYr7ZbjRsNtKit_DsG1nwEXz53TMJ2vB9IQY29coJv_n5NFLkvBfzbG5faRNiFcimPYBO2jFdaA2mWzfxltLtwMF_dBwzTXDpMo3TVT9zEdV8YpsWqr63igqGDZVpKenlkqvRTeGJVayVuMA"
+		}`, wfe.nonceService)))
+	test.AssertEquals(t, responseWriter.Code, http.StatusForbidden)
+	test.AssertContains(t, responseWriter.Body.String(), "Authorizations for these names not found or expired: meep.com")
+
+	// Others get an order to poll, and are issued in the background
+	mockLog.Clear()
+	responseWriter = httptest.NewRecorder()
+	wfe.NewCertificate(newRequestEvent(), responseWriter,
+		makePostRequest(signRequest(t, `{
+			"resource":"new-cert",
+			"csr": "MIICYjCCAUoCAQAwHTEbMBkGA1UEAwwSbm90LWFuLWV4YW1wbGUuY29tMIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAmqs7nue5oFxKBk2WaFZJAma2nm1oFyPIq19gYEAdQN4mWvaJ8RjzHFkDMYUrlIrGxCYuFJDHFUk9dh19Na1MIY-NVLgcSbyNcOML3bLbLEwGmvXPbbEOflBA9mxUS9TLMgXW5ghf_qbt4vmSGKloIim41QXt55QFW6O-84s8Kd2OE6df0wTsEwLhZB3j5pDU-t7j5vTMv4Tc7EptaPkOdfQn-68viUJjlYM_4yIBVRhWCdexFdylCKVLg0obsghQEwULKYCUjdg6F0VJUI115DU49tzscXU_3FS3CyY8rchunuYszBNkdmgpAwViHNWuP7ESdEd_emrj1xuioSe6PwIDAQABoAAwDQYJKoZIhvcNAQELBQADggEBAE_T1nWU38XVYL28hNVSXU0rW5IBUKtbvr0qAkD4kda4HmQRTYkt-LNSuvxoZCC9lxijjgtJi-OJe_DCTdZZpYzewlVvcKToWSYHYQ6Wm1-fxxD_XzphvZOujpmBySchdiz7QSVWJmVZu34XD5RJbIcrmj_cjRt42J1hiTFjNMzQu9U6_HwIMmliDL-soFY2RTvvZf-dAFvOUQ-Wbxt97eM1PbbmxJNWRhbAmgEpe9PWDPTpqV5AK56VAa991cQ1P8ZVmPss5hvwGWhOtpnpTZVHN3toGNYFKqxWPboirqushQlfKiFqT9rpRgM3-mFjOHidGqsKEkTdmfSVlVEk3oo="
+		}`, wfe.nonceService)))
+	test.AssertEquals(t, responseWriter.Code, http.StatusAccepted)
+	test.AssertEquals(t, responseWriter.Header().Get("Location"), "/acme/order/processing")
+	test.AssertEquals(t, responseWriter.Header().Get("Retry-After"), "2")
+	test.AssertEquals(t, responseWriter.Body.String(),
+		fmt.Sprintf(`{"status":"processing","expires":"%s"}`, fc.Now().Add(24*time.Hour).Format(time.RFC3339)))
+
+	order := <-sa.finalized
+	test.AssertEquals(t, order.ID, "processing")
+	test.AssertEquals(t, order.Status, core.StatusValid)
+	test.AssertEquals(t, order.Serial, "0000ff0000000000000e4b4f67d86e818c46")
+	reqlogs := mockLog.GetAllMatching(`Certificate request - successful`)
+	test.AssertEquals(t, len(reqlogs), 1)
+	test.AssertContains(t, reqlogs[0].Message, `"CommonName":"not-an-example.com",`)
+}
+
+// ordersUnsupportedSA has a database schema without certificate orders.
+type ordersUnsupportedSA struct {
+	*mocks.StorageAuthority
+}
+
+func (sa ordersUnsupportedSA) NewCertificateOrder(ctx context.Context, order core.CertificateOrder, req core.CertificateRequest) (core.CertificateOrder, error) {
+	return core.CertificateOrder{}, core.NotSupportedError("Database schema lacks certificateOrders")
+}
+
+func TestAsyncIssueCertificateUnsupported(t *testing.T) {
+	wfe, fc := setupWFE(t)
+	wfe.AsyncIssuance = true
+	_, err := wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+
+	testTime := time.Date(2015, 9, 9, 22, 56, 0, 0, time.UTC)
+	fc.Add(fc.Now().Sub(testTime))
+
+	stats, _ := statsd.NewNoopClient(nil)
+	ra := ra.NewRegistrationAuthorityImpl(fc, wfe.log, stats, nil, cmd.RateLimitConfig{}, 0)
+	ra.SA = ordersUnsupportedSA{mocks.NewStorageAuthority(fc)}
+	ra.CA = &MockCA{}
+	ra.PA = &MockPA{}
+	wfe.RA = ra
+
+	// Until the migration adding certificate orders is run, certificates are
+	// issued at once
+	responseWriter := httptest.NewRecorder()
+	wfe.NewCertificate(newRequestEvent(), responseWriter,
+		makePostRequest(signRequest(t, `{
+			"resource":"new-cert",
+			"csr": "MIICYjCCAUoCAQAwHTEbMBkGA1UEAwwSbm90LWFuLWV4YW1wbGUuY29tMIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAmqs7nue5oFxKBk2WaFZJAma2nm1oFyPIq19gYEAdQN4mWvaJ8RjzHFkDMYUrlIrGxCYuFJDHFUk9dh19Na1MIY-NVLgcSbyNcOML3bLbLEwGmvXPbbEOflBA9mxUS9TLMgXW5ghf_qbt4vmSGKloIim41QXt55QFW6O-84s8Kd2OE6df0wTsEwLhZB3j5pDU-t7j5vTMv4Tc7EptaPkOdfQn-68viUJjlYM_4yIBVRhWCdexFdylCKVLg0obsghQEwULKYCUjdg6F0VJUI115DU49tzscXU_3FS3CyY8rchunuYszBNkdmgpAwViHNWuP7ESdEd_emrj1xuioSe6PwIDAQABoAAwDQYJKoZIhvcNAQELBQADggEBAE_T1nWU38XVYL28hNVSXU0rW5IBUKtbvr0qAkD4kda4HmQRTYkt-LNSuvxoZCC9lxijjgtJi-OJe_DCTdZZpYzewlVvcKToWSYHYQ6Wm1-fxxD_XzphvZOujpmBySchdiz7QSVWJmVZu34XD5RJbIcrmj_cjRt42J1hiTFjNMzQu9U6_HwIMmliDL-soFY2RTvvZf-dAFvOUQ-Wbxt97eM1PbbmxJNWRhbAmgEpe9PWDPTpqV5AK56VAa991cQ1P8ZVmPss5hvwGWhOtpnpTZVHN3toGNYFKqxWPboirqushQlfKiFqT9rpRgM3-mFjOHidGqsKEkTdmfSVlVEk3oo="
+		}`, wfe.nonceService)))
+	test.AssertEquals(t, responseWriter.Code, http.StatusCreated)
+	test.AssertEquals(t, responseWriter.Header().Get("Location"), "/acme/cert/0000ff0000000000000e4b4f67d86e818c46")
+}
+
+func TestOrder(t *testing.T) {
+	wfe, _ := setupWFE(t)
+	wfe.PollPolicy.ValidationLatency = 2 * time.Second
+	_, err := wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+	get := func(id string) *httptest.ResponseRecorder {
+		responseWriter := httptest.NewRecorder()
+		wfe.Order(newRequestEvent(), responseWriter, &http.Request{Method: "GET", URL: mustParseURL(OrderPath + id)})
+		return responseWriter
+	}
+
+	responseWriter := get("processing")
+	test.AssertEquals(t, responseWriter.Code, http.StatusOK)
+	test.AssertEquals(t, responseWriter.Header().Get("Retry-After"), "2")
+	test.AssertEquals(t, responseWriter.Body.String(), `{"status":"processing","expires":"1970-01-02T00:00:00Z"}`)
+	// Polls back off like those of validations
+	responseWriter = get("processing")
+	test.AssertEquals(t, responseWriter.Header().Get("Retry-After"), "4")
+
+	responseWriter = get("valid")
+	test.AssertEquals(t, responseWriter.Code, http.StatusOK)
+	test.AssertEquals(t, responseWriter.Header().Get("Retry-After"), "")
+	test.AssertEquals(t, responseWriter.Header().Get("Link"), `</acme/cert/0000000000000000000000000000000000ee>;rel="certificate"`)
+	test.AssertEquals(t, responseWriter.Body.String(), `{"status":"valid","certificate":"/acme/cert/0000000000000000000000000000000000ee"}`)
+
+	responseWriter = get("invalid")
+	test.AssertEquals(t, responseWriter.Code, http.StatusOK)
+	test.AssertEquals(t, responseWriter.Body.String(),
+		`{"status":"invalid","error":{"type":"urn:acme:error:serverInternal","detail":"Error creating new cert","status":500}}`)
+
+	responseWriter = get("nope")
+	test.AssertEquals(t, responseWriter.Code, http.StatusNotFound)
+}
+
+func TestCheckNames(t *testing.T) {
+	wfe, _ := setupWFE(t)
+	wfe.MaxNames = 3
+
+	csr := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "example.com"},
+		DNSNames: []string{"example.com", "www.example.com", "mail.example.com"},
+	}
+	test.Assert(t, wfe.checkNames(csr) == nil, "Rejected an acceptable CSR")
+
+	// The CN counts towards the limit when it isn't also a SAN
+	csr.Subject.CommonName = "other.example.com"
+	prob := wfe.checkNames(csr)
+	test.Assert(t, prob != nil, "Accepted a CSR with too many names")
+	test.AssertEquals(t, prob.Type, probs.MalformedProblem)
+	test.AssertEquals(t, prob.Detail, "Certificate request has 4 names, maximum is 3")
+	test.AssertEquals(t, wfe.metrics.rejectedNames.Value("too_many"), float64(1))
+
+	wfe.MaxNames = 0
+	test.Assert(t, wfe.checkNames(csr) == nil, "Limited names when MaxNames is zero")
+
+	csr = &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "example.com"},
+		DNSNames: []string{"example.com", "Example.COM", "*.example.net", "www.example.net"},
+	}
+	prob = wfe.checkNames(csr)
+	test.Assert(t, prob != nil, "Accepted a CSR with duplicate names")
+	test.AssertEquals(t, prob.Detail, "Certificate request has duplicate or overlapping names: example.com, www.example.net")
+	test.AssertEquals(t, len(prob.SubProblems), 2)
+	test.AssertEquals(t, prob.SubProblems[0].Identifier, probs.Identifier{Type: "dns", Value: "example.com"})
+	test.AssertEquals(t, prob.SubProblems[0].Detail, "example.com is named more than once")
+	test.AssertEquals(t, prob.SubProblems[1].Identifier, probs.Identifier{Type: "dns", Value: "www.example.net"})
+	test.AssertEquals(t, prob.SubProblems[1].Detail, "www.example.net is already covered by *.example.net")
+	test.AssertEquals(t, wfe.metrics.rejectedNames.Value("duplicate"), float64(1))
+}
+
 func TestGetChallenge(t *testing.T) {
 	wfe, _ := setupWFE(t)
 
@@ -699,11 +1174,186 @@ func TestGetChallenge(t *testing.T) {
 	}
 }
 
+func TestPollPacing(t *testing.T) {
+	wfe, fc := setupWFE(t)
+	wfe.PollPolicy = PollPolicy{
+		ValidationLatency: 2 * time.Second,
+		MaxRetryAfter:     5 * time.Second,
+		Window:            time.Minute,
+		MaxPolls:          4,
+	}
+	getFrom := func(addr, path string, handler func(*requestEvent, http.ResponseWriter, *http.Request)) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		handler(newRequestEvent(), resp, &http.Request{Method: "GET", URL: mustParseURL(path), RemoteAddr: addr})
+		return resp
+	}
+	get := func(path string, handler func(*requestEvent, http.ResponseWriter, *http.Request)) *httptest.ResponseRecorder {
+		return getFrom("1.1.1.1:7882", path, handler)
+	}
+
+	// Validations in progress get a Retry-After that backs off with each poll
+	for i, expected := range []string{"2", "4", "5"} {
+		resp := get("/acme/challenge/processing/23", wfe.Challenge)
+		test.AssertEquals(t, resp.Code, http.StatusAccepted)
+		test.AssertEquals(t, resp.Header().Get("Retry-After"), expected)
+		test.AssertEquals(t, resp.Header().Get("Boulder-Poll-Attempt"), fmt.Sprint(i+1))
+	}
+
+	// Finished validations don't
+	resp := get("/acme/authz/valid", wfe.Authorization)
+	test.AssertEquals(t, resp.Code, http.StatusOK)
+	test.AssertEquals(t, resp.Header().Get("Retry-After"), "")
+	test.AssertEquals(t, resp.Header().Get("Boulder-Poll-Attempt"), "")
+
+	// The account has used up its polls for the window
+	resp = get("/acme/authz/processing", wfe.Authorization)
+	test.AssertEquals(t, resp.Code, 429)
+	test.AssertEquals(t, resp.Header().Get("Retry-After"), "60")
+	var prob probs.ProblemDetails
+	err := json.Unmarshal(resp.Body.Bytes(), &prob)
+	test.AssertNotError(t, err, "Couldn't unmarshal problem")
+	test.AssertEquals(t, prob.Type, probs.RateLimitedProblem)
+
+	// Polls by anyone else who knows the URLs are counted apart, and don't
+	// use up the account's polls or back off its Retry-After
+	for i := 0; i < 4; i++ {
+		resp = getFrom("2.2.2.2:7882", "/acme/authz/processing", wfe.Authorization)
+		test.AssertEquals(t, resp.Code, http.StatusOK)
+		test.AssertEquals(t, resp.Header().Get("Boulder-Poll-Attempt"), fmt.Sprint(i+1))
+	}
+	resp = getFrom("2.2.2.2:7882", "/acme/authz/processing", wfe.Authorization)
+	test.AssertEquals(t, resp.Code, 429)
+
+	fc.Add(time.Minute)
+	resp = get("/acme/authz/processing", wfe.Authorization)
+	test.AssertEquals(t, resp.Code, http.StatusOK)
+	test.AssertEquals(t, resp.Header().Get("Boulder-Poll-Attempt"), "4")
+}
+
+func TestClientName(t *testing.T) {
+	for ua, expected := range map[string]string{
+		"":    noClient,
+		"   ": noClient,
+		"LetsEncryptPythonClient/0.1.0 (Ubuntu 14.04) requests/2.8": "letsencryptpythonclient/0.1.0",
+		"lego":                   "lego",
+		"Go-http-client/1.1":     "go-http-client/1.1",
+		"evil<script>/1.0\"":     "evilscript/1.0",
+		"/1.0":                   noClient,
+		strings.Repeat("a", 100): strings.Repeat("a", 32),
+	} {
+		test.AssertEquals(t, clientName(ua), expected)
+	}
+}
+
+func TestMisbehavingClients(t *testing.T) {
+	wfe, fc := setupWFE(t)
+	wfe.ClientPolicy = ClientPolicy{Window: time.Hour, MinRequests: 4, MaxErrorRatio: 0.5}
+	mux, err := wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+	send := func(ua, method string) {
+		mux.ServeHTTP(httptest.NewRecorder(), &http.Request{
+			Method: method,
+			URL:    mustParseURL(DirectoryPath),
+			Header: http.Header{"User-Agent": {ua}},
+		})
+	}
+
+	// A well-behaved client, and one whose requests are mostly malformed
+	for i := 0; i < 4; i++ {
+		send("good/1.0", "GET")
+		send("bad/2.0 (linux)", "POST")
+	}
+	send("bad/2.0", "GET")
+	m := wfe.metrics
+	test.AssertEquals(t, m.clientRequests.Value("good/1.0"), float64(4))
+	test.AssertEquals(t, m.clientRequests.Value("bad/2.0"), float64(5))
+	test.AssertEquals(t, m.clientProblems.Value("bad/2.0", string(probs.MalformedProblem)), float64(4))
+	// Found misbehaving once in the window, however many problems follow
+	test.AssertEquals(t, m.misbehavingClients.Value("bad/2.0"), float64(1))
+	test.AssertEquals(t, m.misbehavingClients.Value("good/1.0"), float64(0))
+	mockLog := wfe.log.SyslogWriter.(*mocks.SyslogWriter)
+	test.AssertEquals(t, len(mockLog.GetAllMatching(`Client bad/2.0 is misbehaving`)), 1)
+
+	report := func(query string) (int, []clientCount) {
+		rw := httptest.NewRecorder()
+		wfe.ClientReportHandler().ServeHTTP(rw, &http.Request{Method: "GET", URL: mustParseURL("/clients" + query)})
+		var counts []clientCount
+		if rw.Code == http.StatusOK {
+			test.AssertNotError(t, json.Unmarshal(rw.Body.Bytes(), &counts), "Failed to unmarshal report")
+		}
+		return rw.Code, counts
+	}
+	code, counts := report("")
+	test.AssertEquals(t, code, http.StatusOK)
+	test.AssertEquals(t, len(counts), 2)
+	test.AssertEquals(t, counts[0].Client, "bad/2.0")
+	test.Assert(t, counts[0].Misbehaving, "Misbehaving client not reported as such")
+	test.AssertEquals(t, counts[0].Malformed, 4)
+	test.Assert(t, !counts[1].Misbehaving, "Well-behaved client reported as misbehaving")
+	_, counts = report("?limit=1")
+	test.AssertEquals(t, len(counts), 1)
+	code, _ = report("?limit=many")
+	test.AssertEquals(t, code, http.StatusBadRequest)
+
+	// Counts start over with each window
+	fc.Add(time.Hour)
+	send("good/1.0", "GET")
+	_, counts = report("")
+	test.AssertEquals(t, len(counts), 1)
+	test.AssertEquals(t, counts[0].Requests, 1)
+}
+
+func TestTrackedClientsBounded(t *testing.T) {
+	ct := newClientTracker()
+	now := time.Now()
+	for i := 0; i < maxTrackedClients+10; i++ {
+		ct.request(ClientPolicy{}, now, fmt.Sprintf("client/%d", i))
+	}
+	test.AssertEquals(t, len(ct.clients), maxTrackedClients+1)
+	test.AssertEquals(t, ct.clients[otherClient].Requests, 10)
+	test.AssertEquals(t, ct.request(ClientPolicy{}, now, "client/1"), "client/1")
+
+	// Client versions first seen once all names are taken stay folded
+	// into otherClient in later windows, keeping the metric labels bounded
+	now = now.Add(defaultClientWindow)
+	test.AssertEquals(t, ct.request(ClientPolicy{}, now, fmt.Sprintf("client/%d", maxTrackedClients)), otherClient)
+	test.AssertEquals(t, ct.request(ClientPolicy{}, now, "new/1.0"), otherClient)
+	test.AssertEquals(t, ct.request(ClientPolicy{}, now, "client/2"), "client/2")
+	test.AssertEquals(t, len(ct.clients), 2)
+}
+
+func TestPollLimitOverrides(t *testing.T) {
+	policy := PollPolicy{
+		MaxPolls:         4,
+		AccountOverrides: map[int64]int{1: 10, 2: -1},
+	}
+	test.Assert(t, policy.limited(3, 5), "Default limit not applied")
+	test.Assert(t, !policy.limited(1, 5), "Override not applied")
+	test.Assert(t, policy.limited(1, 11), "Override not applied")
+	test.Assert(t, !policy.limited(2, 1000), "Unlimited account limited")
+
+	policy.MaxPolls = 0
+	test.Assert(t, !policy.limited(3, 1000), "Polls limited without a limit")
+}
+
+func TestPollRetryAfter(t *testing.T) {
+	policy := PollPolicy{ValidationLatency: 2 * time.Second, MaxRetryAfter: 5 * time.Second}
+	test.AssertEquals(t, policy.retryAfter(1), 2*time.Second)
+	test.AssertEquals(t, policy.retryAfter(2), 4*time.Second)
+	test.AssertEquals(t, policy.retryAfter(3), 5*time.Second)
+
+	// Without a maximum, the wait doubles up to the default rather than
+	// overflowing
+	policy.MaxRetryAfter = 0
+	test.AssertEquals(t, policy.retryAfter(8), 256*time.Second)
+	test.AssertEquals(t, policy.retryAfter(100), defaultMaxRetryAfter)
+}
+
 func TestChallenge(t *testing.T) {
 	wfe, _ := setupWFE(t)
 	responseWriter := httptest.NewRecorder()
 
-	var key jose.JsonWebKey
+	var key jose.JSONWebKey
 	err := json.Unmarshal([]byte(`
 		{
 			"e": "AQAB",
@@ -743,12 +1393,11 @@ func TestChallenge(t *testing.T) {
 func TestBadNonce(t *testing.T) {
 	wfe, _ := setupWFE(t)
 
-	key, err := jose.LoadPrivateKey([]byte(test2KeyPrivatePEM))
+	key, err := core.LoadPrivateKey([]byte(test2KeyPrivatePEM))
 	test.AssertNotError(t, err, "Failed to load key")
 	rsaKey, ok := key.(*rsa.PrivateKey)
 	test.Assert(t, ok, "Couldn't load RSA key")
-	signer, err := jose.NewSigner("RS256", rsaKey)
-	test.AssertNotError(t, err, "Failed to make signer")
+	signer := newSigner(t, "RS256", rsaKey, nil)
 
 	responseWriter := httptest.NewRecorder()
 	result, err := signer.Sign([]byte(`{"resource":"new-reg","contact":["tel:123456789"],"agreement":"` + agreementURL + `"}`))
@@ -758,18 +1407,143 @@ func TestBadNonce(t *testing.T) {
 	test.AssertEquals(t, responseWriter.Body.String(), `{"type":"urn:acme:error:badNonce","detail":"JWS has no anti-replay nonce","status":400}`)
 }
 
+func TestPeerNonce(t *testing.T) {
+	wfe, _ := setupWFE(t)
+	err := wfe.SetNoncePrefix("wfe1")
+	test.AssertNotError(t, err, "Failed to set nonce prefix")
+
+	peer, err := core.NewPrefixedNonceService("wfe2")
+	test.AssertNotError(t, err, "Failed to create peer nonce service")
+	stranger, err := core.NewPrefixedNonceService("wfe3")
+	test.AssertNotError(t, err, "Failed to create stranger nonce service")
+	wfe.NoncePeers = map[string]core.NonceRedeemer{"wfe2": peer}
+
+	// A nonce issued by a peer instance is redeemed by that peer
+	_, _, _, prob := wfe.verifyPOST(newRequestEvent(), makePostRequest(signRequest(t, `{"resource":"foo"}`, peer)), true, "foo")
+	test.Assert(t, prob == nil, "Rejected a nonce issued by a peer")
+
+	// ...but only once
+	nonce, err := peer.Nonce()
+	test.AssertNotError(t, err, "Failed to make peer nonce")
+	test.Assert(t, wfe.validNonce(nonce), "Rejected fresh peer nonce")
+	test.Assert(t, !wfe.validNonce(nonce), "Accepted a replayed peer nonce")
+
+	// Nonces with an unknown prefix are rejected
+	_, _, _, prob = wfe.verifyPOST(newRequestEvent(), makePostRequest(signRequest(t, `{"resource":"foo"}`, stranger)), true, "foo")
+	test.AssertEquals(t, prob.Type, probs.BadNonceProblem)
+
+	// Locally issued nonces still work
+	_, _, _, prob = wfe.verifyPOST(newRequestEvent(), makePostRequest(signRequest(t, `{"resource":"foo"}`, wfe.nonceService)), true, "foo")
+	test.Assert(t, prob == nil, "Rejected a locally issued nonce")
+
+	// Redemptions are counted by where the nonce was issued
+	m := wfe.metrics
+	test.AssertEquals(t, m.nonceRedemptions.Value("wfe2", "peer", "valid"), float64(2))
+	test.AssertEquals(t, m.nonceRedemptions.Value("wfe2", "peer", "invalid"), float64(1))
+	test.AssertEquals(t, m.nonceRedemptions.Value("unknown", "unknown", "invalid"), float64(1))
+	test.AssertEquals(t, m.nonceRedemptions.Value("wfe1", "local", "valid"), float64(1))
+	mockLog := wfe.log.SyslogWriter.(*mocks.SyslogWriter)
+	test.AssertEquals(t, len(mockLog.GetAllMatching(`Nonce redemption:`)), 0)
+}
+
+func TestNonceAuditSampling(t *testing.T) {
+	wfe, _ := setupWFE(t)
+	err := wfe.SetNoncePrefix("wfe1")
+	test.AssertNotError(t, err, "Failed to set nonce prefix")
+	peer, err := core.NewPrefixedNonceService("wfe2")
+	test.AssertNotError(t, err, "Failed to create peer nonce service")
+	wfe.NoncePeers = map[string]core.NonceRedeemer{"wfe2": peer}
+	wfe.NonceAuditSampleRate = 1
+
+	nonce, err := peer.Nonce()
+	test.AssertNotError(t, err, "Failed to make peer nonce")
+	test.Assert(t, wfe.validNonce(nonce), "Rejected fresh peer nonce")
+	nonce, err = wfe.nonceService.Nonce()
+	test.AssertNotError(t, err, "Failed to make nonce")
+	test.Assert(t, wfe.validNonce(nonce), "Rejected fresh nonce")
+
+	mockLog := wfe.log.SyslogWriter.(*mocks.SyslogWriter)
+	test.AssertEquals(t, len(mockLog.GetAllMatching(`Nonce redemption: issuer=\[wfe2\] redeemer=\[wfe1\] origin=\[peer\] result=\[valid\]`)), 1)
+	test.AssertEquals(t, len(mockLog.GetAllMatching(`Nonce redemption: issuer=\[wfe1\] redeemer=\[wfe1\] origin=\[local\] result=\[valid\]`)), 1)
+}
+
+func TestMaxRequestBodySize(t *testing.T) {
+	wfe, _ := setupWFE(t)
+	body := signRequest(t, `{"resource":"foo"}`, wfe.nonceService)
+
+	wfe.MaxRequestBodySize = int64(len(body))
+	_, _, _, prob := wfe.verifyPOST(newRequestEvent(), makePostRequest(body), true, "foo")
+	test.Assert(t, prob == nil, "Rejected a body of exactly the maximum size")
+
+	wfe.MaxRequestBodySize = int64(len(body)) - 1
+	_, _, _, prob = wfe.verifyPOST(newRequestEvent(), makePostRequest(body), true, "foo")
+	test.AssertEquals(t, prob.HTTPStatus, http.StatusRequestEntityTooLarge)
+
+	// A declared Content-Length over the limit is rejected without reading
+	request := makePostRequest(body)
+	request.ContentLength = int64(len(body))
+	_, _, _, prob = wfe.verifyPOST(newRequestEvent(), request, true, "foo")
+	test.AssertEquals(t, prob.HTTPStatus, http.StatusRequestEntityTooLarge)
+}
+
+func TestRequestTimeout(t *testing.T) {
+	wfe, _ := setupWFE(t)
+	wfe.RequestTimeout = time.Hour
+	wfe.EndpointRequestTimeouts = map[string]time.Duration{"/slow": time.Millisecond}
+
+	// The slow handler is cancelled, and waited for
+	var slowErr error
+	mux := http.NewServeMux()
+	wfe.HandleFunc(mux, "/slow", func(_ *requestEvent, response http.ResponseWriter, request *http.Request) {
+		<-request.Context().Done()
+		slowErr = request.Context().Err()
+		response.Write([]byte("too late"))
+	}, "GET")
+	wfe.HandleFunc(mux, "/fast", func(_ *requestEvent, response http.ResponseWriter, _ *http.Request) {
+		response.Header().Set("Content-Type", "text/plain")
+		response.WriteHeader(http.StatusAccepted)
+		response.Write([]byte("in time"))
+	}, "GET")
+
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, &http.Request{Method: "GET", URL: mustParseURL("/slow")})
+	test.AssertEquals(t, rw.Code, http.StatusServiceUnavailable)
+	test.AssertEquals(t, rw.Header().Get("Content-Type"), "application/problem+json")
+	test.AssertEquals(t, rw.Body.String(), `{"type":"urn:acme:error:serverInternal","detail":"Request timed out","status":503}`)
+	test.Assert(t, rw.Header().Get("Replay-Nonce") != "", "Nonce header missing")
+	test.AssertEquals(t, slowErr, context.DeadlineExceeded)
+
+	rw = httptest.NewRecorder()
+	mux.ServeHTTP(rw, &http.Request{Method: "GET", URL: mustParseURL("/fast")})
+	test.AssertEquals(t, rw.Code, http.StatusAccepted)
+	test.AssertEquals(t, rw.Header().Get("Content-Type"), "text/plain")
+	test.Assert(t, rw.Header().Get("Replay-Nonce") != "", "Nonce header missing")
+	test.AssertEquals(t, rw.Body.String(), "in time")
+}
+
+func TestHandlerPanic(t *testing.T) {
+	wfe, _ := setupWFE(t)
+	mux := http.NewServeMux()
+	wfe.HandleFunc(mux, "/panic", func(*requestEvent, http.ResponseWriter, *http.Request) {
+		panic("handler bug")
+	}, "GET")
+
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, &http.Request{Method: "GET", URL: mustParseURL("/panic")})
+	test.AssertEquals(t, rw.Code, http.StatusInternalServerError)
+	test.AssertEquals(t, rw.Body.String(), `{"type":"urn:acme:error:serverInternal","detail":"Internal error","status":500}`)
+}
+
 func TestNewRegistration(t *testing.T) {
 	wfe, _ := setupWFE(t)
 	mux, err := wfe.Handler()
 	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
 
-	key, err := jose.LoadPrivateKey([]byte(test2KeyPrivatePEM))
+	key, err := core.LoadPrivateKey([]byte(test2KeyPrivatePEM))
 	test.AssertNotError(t, err, "Failed to load key")
 	rsaKey, ok := key.(*rsa.PrivateKey)
 	test.Assert(t, ok, "Couldn't load RSA key")
-	signer, err := jose.NewSigner("RS256", rsaKey)
-	test.AssertNotError(t, err, "Failed to make signer")
-	signer.SetNonceSource(wfe.nonceService)
+	signer := newSigner(t, "RS256", rsaKey, wfe.nonceService)
 	fooBody, err := signer.Sign([]byte("foo"))
 	test.AssertNotError(t, err, "Unable to sign")
 
@@ -860,6 +1634,7 @@ func TestNewRegistration(t *testing.T) {
 	test.AssertEquals(
 		t, responseWriter.Header().Get("Location"),
 		"/acme/reg/0")
+	test.AssertEquals(t, reg.Orders, "/acme/reg/0/orders")
 	links := responseWriter.Header()["Link"]
 	test.AssertEquals(t, contains(links, "</acme/new-authz>;rel=\"next\""), true)
 	test.AssertEquals(t, contains(links, "<"+agreementURL+">;rel=\"terms-of-service\""), true)
@@ -868,13 +1643,11 @@ func TestNewRegistration(t *testing.T) {
 		t, responseWriter.Header().Get("Link"),
 		`</acme/new-authz>;rel="next"`)
 
-	key, err = jose.LoadPrivateKey([]byte(test1KeyPrivatePEM))
+	key, err = core.LoadPrivateKey([]byte(test1KeyPrivatePEM))
 	test.AssertNotError(t, err, "Failed to load key")
 	rsaKey, ok = key.(*rsa.PrivateKey)
 	test.Assert(t, ok, "Couldn't load RSA key")
-	signer, err = jose.NewSigner("RS256", rsaKey)
-	test.AssertNotError(t, err, "Failed to make signer")
-	signer.SetNonceSource(wfe.nonceService)
+	signer = newSigner(t, "RS256", rsaKey, wfe.nonceService)
 
 	// Reset the body and status code
 	responseWriter = httptest.NewRecorder()
@@ -892,6 +1665,43 @@ func TestNewRegistration(t *testing.T) {
 	test.AssertEquals(t, responseWriter.Code, 409)
 }
 
+// unknownKeysSA has no registrations, so every key is a new one.
+type unknownKeysSA struct {
+	*mocks.StorageAuthority
+}
+
+func (sa unknownKeysSA) GetRegistrationByKey(ctx context.Context, jwk jose.JSONWebKey) (core.Registration, error) {
+	return core.Registration{}, core.NoSuchRegistrationError("reg not found")
+}
+
+func TestNewRegistrationEd25519(t *testing.T) {
+	wfe, fc := setupWFE(t)
+	wfe.SA = unknownKeysSA{mocks.NewStorageAuthority(fc)}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	signer := newSigner(t, jose.EdDSA, key, wfe.nonceService)
+	newReg := func() *httptest.ResponseRecorder {
+		result, err := signer.Sign([]byte(`{"resource":"new-reg","agreement":"` + agreementURL + `"}`))
+		test.AssertNotError(t, err, "Unable to sign")
+		responseWriter := httptest.NewRecorder()
+		wfe.NewRegistration(newRequestEvent(), responseWriter, makePostRequest(result.FullSerialize()))
+		return responseWriter
+	}
+
+	// Until the feature is enabled, Ed25519 keys are refused
+	responseWriter := newReg()
+	test.AssertEquals(t, responseWriter.Body.String(), `{"type":"urn:acme:error:malformed","detail":"Ed25519 account keys are not supported","status":400}`)
+
+	wfe.Ed25519AccountKeys = true
+	responseWriter = newReg()
+	test.AssertEquals(t, responseWriter.Code, http.StatusCreated)
+	var reg core.Registration
+	err = json.Unmarshal(responseWriter.Body.Bytes(), &reg)
+	test.AssertNotError(t, err, "Couldn't unmarshal returned registration object")
+	test.Assert(t, core.KeyDigestEquals(reg.Key, key.Public()), "Registration doesn't have the Ed25519 key")
+}
+
 func makeRevokeRequestJSON() ([]byte, error) {
 	certPemBytes, err := ioutil.ReadFile("test/238.crt")
 	if err != nil {
@@ -923,7 +1733,7 @@ type mockSANoSuchRegistration struct {
 	core.StorageGetter
 }
 
-func (msa mockSANoSuchRegistration) GetRegistrationByKey(jwk jose.JsonWebKey) (core.Registration, error) {
+func (msa mockSANoSuchRegistration) GetRegistrationByKey(ctx context.Context, jwk jose.JSONWebKey) (core.Registration, error) {
 	return core.Registration{}, core.NoSuchRegistrationError("reg not found")
 }
 
@@ -932,12 +1742,10 @@ func (msa mockSANoSuchRegistration) GetRegistrationByKey(jwk jose.JsonWebKey) (c
 func TestRevokeCertificateCertKey(t *testing.T) {
 	keyPemBytes, err := ioutil.ReadFile("test/238.key")
 	test.AssertNotError(t, err, "Failed to load key")
-	key, err := jose.LoadPrivateKey(keyPemBytes)
+	key, err := core.LoadPrivateKey(keyPemBytes)
 	test.AssertNotError(t, err, "Failed to load key")
 	rsaKey, ok := key.(*rsa.PrivateKey)
 	test.Assert(t, ok, "Couldn't load RSA key")
-	signer, err := jose.NewSigner("RS256", rsaKey)
-	test.AssertNotError(t, err, "Failed to make signer")
 
 	revokeRequestJSON, err := makeRevokeRequestJSON()
 	test.AssertNotError(t, err, "Failed to make revokeRequestJSON")
@@ -946,12 +1754,14 @@ func TestRevokeCertificateCertKey(t *testing.T) {
 	wfe.SA = &mockSANoSuchRegistration{mocks.NewStorageAuthority(fc)}
 	responseWriter := httptest.NewRecorder()
 
-	signer.SetNonceSource(wfe.nonceService)
+	signer := newSigner(t, "RS256", rsaKey, wfe.nonceService)
 	result, _ := signer.Sign(revokeRequestJSON)
-	wfe.RevokeCertificate(newRequestEvent(), responseWriter,
+	logEvent := newRequestEvent()
+	wfe.RevokeCertificate(logEvent, responseWriter,
 		makePostRequest(result.FullSerialize()))
 	test.AssertEquals(t, responseWriter.Code, 200)
 	test.AssertEquals(t, responseWriter.Body.String(), "")
+	test.AssertEquals(t, logEvent.Extra["RevocationAuthorizedBy"], "certificate key")
 }
 
 // Valid revocation request for existing, non-revoked cert, signed with account
@@ -963,31 +1773,51 @@ func TestRevokeCertificateAccountKey(t *testing.T) {
 	wfe, _ := setupWFE(t)
 	responseWriter := httptest.NewRecorder()
 
-	test1JWK, err := jose.LoadPrivateKey([]byte(test1KeyPrivatePEM))
+	test1JWK, err := core.LoadPrivateKey([]byte(test1KeyPrivatePEM))
 	test.AssertNotError(t, err, "Failed to load key")
 	test1Key, ok := test1JWK.(*rsa.PrivateKey)
 	test.Assert(t, ok, "Couldn't load RSA key")
-	accountKeySigner, err := jose.NewSigner("RS256", test1Key)
-	test.AssertNotError(t, err, "Failed to make signer")
-	accountKeySigner.SetNonceSource(wfe.nonceService)
+	accountKeySigner := newSigner(t, "RS256", test1Key, wfe.nonceService)
 	result, _ := accountKeySigner.Sign(revokeRequestJSON)
-	wfe.RevokeCertificate(newRequestEvent(), responseWriter,
+	logEvent := newRequestEvent()
+	wfe.RevokeCertificate(logEvent, responseWriter,
 		makePostRequest(result.FullSerialize()))
 	test.AssertEquals(t, responseWriter.Code, 200)
 	test.AssertEquals(t, responseWriter.Body.String(), "")
+	test.AssertEquals(t, logEvent.Extra["RevocationAuthorizedBy"], "account key")
+}
+
+func TestKeyMatchesCertificate(t *testing.T) {
+	certPemBytes, err := ioutil.ReadFile("test/238.crt")
+	test.AssertNotError(t, err, "Failed to load cert")
+	certBlock, _ := pem.Decode(certPemBytes)
+	test.Assert(t, certBlock != nil, "Failed to decode PEM")
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	test.AssertNotError(t, err, "Failed to parse cert")
+
+	keyPemBytes, err := ioutil.ReadFile("test/238.key")
+	test.AssertNotError(t, err, "Failed to load key")
+	certKey, err := core.LoadPrivateKey(keyPemBytes)
+	test.AssertNotError(t, err, "Failed to load key")
+	test.Assert(t, keyMatchesCertificate(&jose.JSONWebKey{Key: &certKey.(*rsa.PrivateKey).PublicKey}, cert),
+		"Certificate key didn't match certificate")
+
+	var accountKey jose.JSONWebKey
+	err = json.Unmarshal([]byte(test1KeyPublicJSON), &accountKey)
+	test.AssertNotError(t, err, "Failed to unmarshal key")
+	test.Assert(t, !keyMatchesCertificate(&accountKey, cert), "Account key matched certificate")
+	test.Assert(t, !keyMatchesCertificate(nil, cert), "Nil key matched certificate")
 }
 
 // A revocation request signed by an unauthorized key.
 func TestRevokeCertificateWrongKey(t *testing.T) {
 	wfe, _ := setupWFE(t)
 	responseWriter := httptest.NewRecorder()
-	test2JWK, err := jose.LoadPrivateKey([]byte(test2KeyPrivatePEM))
+	test2JWK, err := core.LoadPrivateKey([]byte(test2KeyPrivatePEM))
 	test.AssertNotError(t, err, "Failed to load key")
 	test2Key, ok := test2JWK.(*rsa.PrivateKey)
 	test.Assert(t, ok, "Couldn't load RSA key")
-	accountKeySigner2, err := jose.NewSigner("RS256", test2Key)
-	test.AssertNotError(t, err, "Failed to make signer")
-	accountKeySigner2.SetNonceSource(wfe.nonceService)
+	accountKeySigner2 := newSigner(t, "RS256", test2Key, wfe.nonceService)
 	revokeRequestJSON, err := makeRevokeRequestJSON()
 	test.AssertNotError(t, err, "Unable to create revoke request")
 
@@ -999,16 +1829,68 @@ func TestRevokeCertificateWrongKey(t *testing.T) {
 		`{"type":"urn:acme:error:unauthorized","detail":"Revocation request must be signed by private key of cert to be revoked, or by the account key of the account that issued it.","status":403}`)
 }
 
+func TestFetchCertificate(t *testing.T) {
+	certPemBytes, err := ioutil.ReadFile("test/238.crt")
+	test.AssertNotError(t, err, "Failed to load cert")
+	certBlock, _ := pem.Decode(certPemBytes)
+	keyPemBytes, err := ioutil.ReadFile("test/238.key")
+	test.AssertNotError(t, err, "Failed to load key")
+	certKey, err := core.LoadPrivateKey(keyPemBytes)
+	test.AssertNotError(t, err, "Failed to load key")
+	test1JWK, err := core.LoadPrivateKey([]byte(test1KeyPrivatePEM))
+	test.AssertNotError(t, err, "Failed to load key")
+	test2JWK, err := core.LoadPrivateKey([]byte(test2KeyPrivatePEM))
+	test.AssertNotError(t, err, "Failed to load key")
+
+	wfe, fc := setupWFE(t)
+	wfe.CertBase = "https://example.com/acme/cert/"
+	fetch := func(key interface{}, serial string) (*httptest.ResponseRecorder, *requestEvent) {
+		signer := newSigner(t, "RS256", key, wfe.nonceService)
+		result, err := signer.Sign([]byte(`{"resource":"fetch-cert","serial":"` + serial + `"}`))
+		test.AssertNotError(t, err, "Failed to sign request")
+		responseWriter := httptest.NewRecorder()
+		logEvent := newRequestEvent()
+		wfe.FetchCertificate(logEvent, responseWriter, makePostRequest(result.FullSerialize()))
+		return responseWriter, logEvent
+	}
+	serial := "0000000000000000000000000000000000EE"
+
+	// The account that was issued the certificate may fetch it
+	responseWriter, logEvent := fetch(test1JWK, serial)
+	test.AssertEquals(t, responseWriter.Code, 200)
+	test.AssertByteEquals(t, responseWriter.Body.Bytes(), certBlock.Bytes)
+	test.AssertEquals(t, responseWriter.Header().Get("Content-Type"), "application/pkix-cert")
+	test.AssertEquals(t, responseWriter.Header().Get("Location"), "https://example.com/acme/cert/0000000000000000000000000000000000ee")
+	test.AssertEquals(t, logEvent.Extra["FetchAuthorizedBy"], "account key")
+
+	// So may the holder of the certificate's key, without an account
+	wfe.SA = &mockSANoSuchRegistration{mocks.NewStorageAuthority(fc)}
+	responseWriter, logEvent = fetch(certKey, serial)
+	test.AssertEquals(t, responseWriter.Code, 200)
+	test.AssertByteEquals(t, responseWriter.Body.Bytes(), certBlock.Bytes)
+	test.AssertEquals(t, logEvent.Extra["FetchAuthorizedBy"], "certificate key")
+
+	// Anyone else may not
+	wfe.SA = mocks.NewStorageAuthority(fc)
+	responseWriter, _ = fetch(test2JWK, serial)
+	test.AssertEquals(t, responseWriter.Code, 403)
+	test.AssertEquals(t, responseWriter.Body.String(),
+		`{"type":"urn:acme:error:unauthorized","detail":"Request must be signed by the private key of the certificate, or by the account key of the account that issued it.","status":403}`)
+
+	responseWriter, _ = fetch(test1JWK, "0000000000000000000000000000000000ff")
+	test.AssertEquals(t, responseWriter.Code, 404)
+	responseWriter, _ = fetch(test1JWK, "not hex")
+	test.AssertEquals(t, responseWriter.Code, 400)
+}
+
 // Valid revocation request for already-revoked cert
 func TestRevokeCertificateAlreadyRevoked(t *testing.T) {
 	keyPemBytes, err := ioutil.ReadFile("test/178.key")
 	test.AssertNotError(t, err, "Failed to load key")
-	key, err := jose.LoadPrivateKey(keyPemBytes)
+	key, err := core.LoadPrivateKey(keyPemBytes)
 	test.AssertNotError(t, err, "Failed to load key")
 	rsaKey, ok := key.(*rsa.PrivateKey)
 	test.Assert(t, ok, "Couldn't load RSA key")
-	signer, err := jose.NewSigner("RS256", rsaKey)
-	test.AssertNotError(t, err, "Failed to make signer")
 
 	certPemBytes, err := ioutil.ReadFile("test/178.crt")
 	test.AssertNotError(t, err, "Failed to load cert")
@@ -1031,7 +1913,7 @@ func TestRevokeCertificateAlreadyRevoked(t *testing.T) {
 	wfe.stats, _ = statsd.NewNoopClient()
 	responseWriter := httptest.NewRecorder()
 	responseWriter.Body.Reset()
-	signer.SetNonceSource(wfe.nonceService)
+	signer := newSigner(t, "RS256", rsaKey, wfe.nonceService)
 	result, _ := signer.Sign(revokeRequestJSON)
 	wfe.RevokeCertificate(newRequestEvent(), responseWriter,
 		makePostRequest(result.FullSerialize()))
@@ -1115,6 +1997,14 @@ func TestAuthorization(t *testing.T) {
 	err = json.Unmarshal([]byte(responseWriter.Body.String()), &authz)
 	test.AssertNotError(t, err, "Couldn't unmarshal returned authorization object")
 
+	// Several identifiers at once get an authorization each
+	responseWriter = httptest.NewRecorder()
+	wfe.NewAuthorization(newRequestEvent(), responseWriter,
+		makePostRequest(signRequest(t, `{"resource":"new-authz","identifiers":[{"type":"dns","value":"a.com"},{"type":"dns","value":"b.com"}]}`, wfe.nonceService)))
+	test.AssertEquals(t, responseWriter.Code, http.StatusCreated)
+	test.AssertEquals(t, responseWriter.Header().Get("Link"), `</acme/new-cert>;rel="next"`)
+	test.AssertEquals(t, responseWriter.Body.String(), `{"authorizations":["/acme/authz/a.com","/acme/authz/b.com"]}`)
+
 	// Expired authorizations should be inaccessible
 	authzURL := "/acme/authz/expired"
 	responseWriter = httptest.NewRecorder()
@@ -1127,6 +2017,110 @@ func TestAuthorization(t *testing.T) {
 		`{"type":"urn:acme:error:malformed","detail":"Expired authorization","status":404}`)
 }
 
+// An SA mock that finds every key registered to an account other than the one
+// that owns the mock authorizations.
+type mockSAOtherRegistration struct {
+	core.StorageGetter
+}
+
+func (msa mockSAOtherRegistration) GetRegistrationByKey(ctx context.Context, jwk jose.JSONWebKey) (core.Registration, error) {
+	return core.Registration{ID: 5, Key: jwk, Agreement: agreementURL}, nil
+}
+
+func TestDeactivateAuthorization(t *testing.T) {
+	wfe, fc := setupWFE(t)
+	authzURL := "/acme/authz/valid"
+
+	responseWriter := httptest.NewRecorder()
+	logEvent := newRequestEvent()
+	wfe.Authorization(logEvent, responseWriter,
+		makePostRequestWithPath(authzURL,
+			signRequest(t, `{"resource":"authz","status":"deactivated"}`, wfe.nonceService)))
+	test.AssertEquals(t, responseWriter.Code, http.StatusOK)
+	var authz core.Authorization
+	err := json.Unmarshal(responseWriter.Body.Bytes(), &authz)
+	test.AssertNotError(t, err, "Couldn't unmarshal returned authorization object")
+	test.AssertEquals(t, authz.Status, core.StatusDeactivated)
+	test.AssertEquals(t, logEvent.Extra["AuthorizationStatus"], core.StatusDeactivated)
+
+	// Only deactivation is allowed
+	responseWriter = httptest.NewRecorder()
+	wfe.Authorization(newRequestEvent(), responseWriter,
+		makePostRequestWithPath(authzURL,
+			signRequest(t, `{"resource":"authz","status":"valid"}`, wfe.nonceService)))
+	test.AssertEquals(t, responseWriter.Body.String(),
+		`{"type":"urn:acme:error:malformed","detail":"Invalid status value","status":400}`)
+
+	// The request must be for the authz resource
+	responseWriter = httptest.NewRecorder()
+	wfe.Authorization(newRequestEvent(), responseWriter,
+		makePostRequestWithPath(authzURL,
+			signRequest(t, `{"resource":"challenge","status":"deactivated"}`, wfe.nonceService)))
+	test.AssertEquals(t, responseWriter.Code, http.StatusBadRequest)
+
+	// Other accounts can't deactivate the authorization
+	wfe.SA = &mockSAOtherRegistration{mocks.NewStorageAuthority(fc)}
+	responseWriter = httptest.NewRecorder()
+	wfe.Authorization(newRequestEvent(), responseWriter,
+		makePostRequestWithPath(authzURL,
+			signRequest(t, `{"resource":"authz","status":"deactivated"}`, wfe.nonceService)))
+	test.AssertEquals(t, responseWriter.Body.String(),
+		`{"type":"urn:acme:error:unauthorized","detail":"User registration ID doesn't match registration ID in authorization","status":403}`)
+}
+
+// An RA mock that records the contacts it's asked to verify.
+type mockRAVerifyContact struct {
+	MockRegistrationAuthority
+	regID     int64
+	contact   string
+	requestID string
+}
+
+func (ra *mockRAVerifyContact) VerifyContact(ctx context.Context, regID int64, contact string) error {
+	ra.regID = regID
+	ra.contact = contact
+	ra.requestID = core.RequestID(ctx)
+	return nil
+}
+
+func TestVerifyContact(t *testing.T) {
+	wfe, fc := setupWFE(t)
+	mux, err := wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, &http.Request{Method: "GET", URL: mustParseURL(VerifyContactPath)})
+	test.AssertEquals(t, rw.Code, http.StatusNotFound)
+
+	mockRA := &mockRAVerifyContact{}
+	wfe.RA = mockRA
+	wfe.ContactVerifier, err = mail.NewContactVerifier([]byte("0123456789abcdef"), "", time.Hour, fc)
+	test.AssertNotError(t, err, "Failed to create verifier")
+	mux, err = wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+
+	link := wfe.ContactVerifier.Link(1, "mailto:person@example.com")
+	rw = httptest.NewRecorder()
+	mux.ServeHTTP(rw, &http.Request{Method: "GET", URL: mustParseURL(link)})
+	test.AssertEquals(t, rw.Code, http.StatusOK)
+	test.AssertEquals(t, rw.Body.String(), "Contact verified\n")
+	test.AssertEquals(t, mockRA.regID, int64(1))
+	test.AssertEquals(t, mockRA.contact, "mailto:person@example.com")
+	// The RA is called with the ID the client was given
+	test.Assert(t, mockRA.requestID != "", "RA was not given a request ID")
+	test.AssertEquals(t, mockRA.requestID, rw.Header().Get(core.RequestIDHeader))
+
+	rw = httptest.NewRecorder()
+	mux.ServeHTTP(rw, &http.Request{Method: "GET", URL: mustParseURL(link + "1")})
+	test.AssertEquals(t, rw.Code, http.StatusBadRequest)
+	test.AssertEquals(t, rw.Body.String(),
+		`{"type":"urn:acme:error:malformed","detail":"Invalid verification link","status":400}`)
+
+	fc.Add(2 * time.Hour)
+	rw = httptest.NewRecorder()
+	mux.ServeHTTP(rw, &http.Request{Method: "GET", URL: mustParseURL(link)})
+	test.AssertEquals(t, rw.Code, http.StatusForbidden)
+}
+
 func contains(s []string, e string) bool {
 	for _, a := range s {
 		if a == e {
@@ -1170,15 +2164,13 @@ func TestRegistration(t *testing.T) {
 		`{"type":"urn:acme:error:malformed","detail":"Parse error reading JWS","status":400}`)
 	responseWriter.Body.Reset()
 
-	key, err := jose.LoadPrivateKey([]byte(test2KeyPrivatePEM))
+	key, err := core.LoadPrivateKey([]byte(test2KeyPrivatePEM))
 	test.AssertNotError(t, err, "Failed to load key")
 	rsaKey, ok := key.(*rsa.PrivateKey)
 	test.Assert(t, ok, "Couldn't load RSA key")
-	signer, err := jose.NewSigner("RS256", rsaKey)
-	test.AssertNotError(t, err, "Failed to make signer")
 
 	// Test POST valid JSON but key is not registered
-	signer.SetNonceSource(wfe.nonceService)
+	signer := newSigner(t, "RS256", rsaKey, wfe.nonceService)
 	result, err := signer.Sign([]byte(`{"resource":"reg","agreement":"` + agreementURL + `"}`))
 	test.AssertNotError(t, err, "Unable to sign")
 	wfe.Registration(newRequestEvent(), responseWriter,
@@ -1188,15 +2180,13 @@ func TestRegistration(t *testing.T) {
 		`{"type":"urn:acme:error:unauthorized","detail":"No registration exists matching provided key","status":403}`)
 	responseWriter.Body.Reset()
 
-	key, err = jose.LoadPrivateKey([]byte(test1KeyPrivatePEM))
+	key, err = core.LoadPrivateKey([]byte(test1KeyPrivatePEM))
 	test.AssertNotError(t, err, "Failed to load key")
 	rsaKey, ok = key.(*rsa.PrivateKey)
 	test.Assert(t, ok, "Couldn't load RSA key")
-	signer, err = jose.NewSigner("RS256", rsaKey)
-	test.AssertNotError(t, err, "Failed to make signer")
 
 	// Test POST valid JSON with registration up in the mock (with incorrect agreement URL)
-	signer.SetNonceSource(wfe.nonceService)
+	signer = newSigner(t, "RS256", rsaKey, wfe.nonceService)
 	result, err = signer.Sign([]byte(`{"resource":"reg","agreement":"https://letsencrypt.org/im-bad"}`))
 
 	// Test POST valid JSON with registration up in the mock
@@ -1220,6 +2210,61 @@ func TestRegistration(t *testing.T) {
 	responseWriter.Body.Reset()
 }
 
+func TestOrders(t *testing.T) {
+	wfe, _ := setupWFE(t)
+	wfe.OrdersPageSize = 1
+	mux, err := wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+
+	type orders struct {
+		Orders []order
+	}
+	responseWriter := httptest.NewRecorder()
+	mux.ServeHTTP(responseWriter, &http.Request{
+		Method: "GET",
+		URL:    mustParseURL(RegPath + "1" + OrdersSuffix),
+	})
+	test.AssertEquals(t, responseWriter.Code, http.StatusOK)
+	var page orders
+	err = json.Unmarshal(responseWriter.Body.Bytes(), &page)
+	test.AssertNotError(t, err, "Couldn't unmarshal orders")
+	test.AssertEquals(t, len(page.Orders), 1)
+	test.AssertEquals(t, page.Orders[0].Status, core.StatusValid)
+	test.AssertEquals(t, page.Orders[0].Certificate, "/acme/cert/0000000000000000000000000000000000ee")
+	test.Assert(t, len(page.Orders[0].Identifiers) > 0, "Order has no identifiers")
+	test.AssertEquals(t, responseWriter.Header().Get("Link"), `</acme/reg/1/orders?cursor=1>;rel="next"`)
+
+	// The last page has no next link
+	responseWriter = httptest.NewRecorder()
+	mux.ServeHTTP(responseWriter, &http.Request{
+		Method: "GET",
+		URL:    mustParseURL(RegPath + "1" + OrdersSuffix + "?cursor=1"),
+	})
+	test.AssertEquals(t, responseWriter.Code, http.StatusOK)
+	err = json.Unmarshal(responseWriter.Body.Bytes(), &page)
+	test.AssertNotError(t, err, "Couldn't unmarshal orders")
+	test.AssertEquals(t, len(page.Orders), 1)
+	test.AssertEquals(t, page.Orders[0].Certificate, "/acme/cert/0000000000000000000000000000000000b2")
+	test.AssertEquals(t, responseWriter.Header().Get("Link"), "")
+
+	// A registration with no certificates has an empty list
+	responseWriter = httptest.NewRecorder()
+	mux.ServeHTTP(responseWriter, &http.Request{
+		Method: "GET",
+		URL:    mustParseURL(RegPath + "2" + OrdersSuffix),
+	})
+	test.AssertEquals(t, responseWriter.Body.String(), `{"orders":[]}`)
+
+	for _, path := range []string{"100" + OrdersSuffix, "x" + OrdersSuffix, "1" + OrdersSuffix + "?cursor=-1"} {
+		responseWriter = httptest.NewRecorder()
+		mux.ServeHTTP(responseWriter, &http.Request{
+			Method: "GET",
+			URL:    mustParseURL(RegPath + path),
+		})
+		test.Assert(t, responseWriter.Code >= 400, "Accepted bad orders request "+path)
+	}
+}
+
 func TestTermsRedirect(t *testing.T) {
 	wfe, _ := setupWFE(t)
 	responseWriter := httptest.NewRecorder()
@@ -1244,12 +2289,74 @@ func TestIssuer(t *testing.T) {
 
 	wfe.Issuer(newRequestEvent(), responseWriter, &http.Request{
 		Method: "GET",
+		URL:    &url.URL{Path: IssuerPath},
 	})
 	test.AssertEquals(t, responseWriter.Code, http.StatusOK)
 	test.Assert(t, bytes.Compare(responseWriter.Body.Bytes(), wfe.IssuerCert) == 0, "Incorrect bytes returned")
 	test.AssertEquals(t, responseWriter.Header().Get("Cache-Control"), "public, max-age=10")
 }
 
+// mockSAWithIssuers records the issuer key IDs of certificates in issuers.
+type mockSAWithIssuers struct {
+	*mocks.StorageAuthority
+	issuers map[string]string
+}
+
+func (sa *mockSAWithIssuers) GetCertificateIssuer(ctx context.Context, serial string) (string, error) {
+	if keyID, ok := sa.issuers[serial]; ok {
+		return keyID, nil
+	}
+	return sa.StorageAuthority.GetCertificateIssuer(ctx, serial)
+}
+
+func TestFurtherIssuers(t *testing.T) {
+	wfe, fc := setupWFE(t)
+	loadDER := func(filename string) []byte {
+		pemBytes, err := ioutil.ReadFile(filename)
+		test.AssertNotError(t, err, "Failed to read "+filename)
+		block, _ := pem.Decode(pemBytes)
+		return block.Bytes
+	}
+	wfe.IssuerCert = loadDER("../test/test-ca.pem")
+	rootDER := loadDER("../test/test-root.pem")
+	root, err := x509.ParseCertificate(rootDER)
+	test.AssertNotError(t, err, "Failed to parse test root")
+	rootKeyID := hex.EncodeToString(root.SubjectKeyId)
+	wfe.FurtherIssuerCerts = [][]byte{rootDER}
+	wfe.SA = &mockSAWithIssuers{
+		StorageAuthority: mocks.NewStorageAuthority(fc),
+		issuers:          map[string]string{"0000000000000000000000000000000000b2": rootKeyID},
+	}
+	mux, err := wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+	get := func(path string) *httptest.ResponseRecorder {
+		responseWriter := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		mux.ServeHTTP(responseWriter, req)
+		return responseWriter
+	}
+
+	// A certificate is linked to the issuer recorded for it, which is
+	// served by its key ID
+	responseWriter := get("/acme/cert/0000000000000000000000000000000000b2")
+	test.AssertEquals(t, responseWriter.Code, http.StatusOK)
+	test.AssertEquals(t, responseWriter.Header().Get("Link"), `<`+IssuerPath+"/"+rootKeyID+`>;rel="up"`)
+	responseWriter = get(IssuerPath + "/" + rootKeyID)
+	test.AssertEquals(t, responseWriter.Code, http.StatusOK)
+	test.AssertByteEquals(t, responseWriter.Body.Bytes(), rootDER)
+
+	// Certificates without a recorded issuer are linked to the default one
+	responseWriter = get("/acme/cert/0000000000000000000000000000000000ee")
+	test.AssertEquals(t, responseWriter.Code, http.StatusOK)
+	test.AssertEquals(t, responseWriter.Header().Get("Link"), `<`+IssuerPath+`>;rel="up"`)
+	responseWriter = get(IssuerPath)
+	test.AssertByteEquals(t, responseWriter.Body.Bytes(), wfe.IssuerCert)
+
+	// Unknown issuers aren't found
+	responseWriter = get(IssuerPath + "/00")
+	test.AssertEquals(t, responseWriter.Code, http.StatusNotFound)
+}
+
 func TestGetCertificate(t *testing.T) {
 	wfe, _ := setupWFE(t)
 	mux, err := wfe.Handler()
@@ -1314,6 +2421,93 @@ func TestGetCertificate(t *testing.T) {
 	test.AssertEquals(t, responseWriter.Body.String(), `{"type":"urn:acme:error:malformed","detail":"Certificate not found","status":404}`)
 }
 
+// mockSAUnavailable fails authorization and certificate lookups the way an
+// SA whose database is down does.
+type mockSAUnavailable struct {
+	*mocks.StorageAuthority
+}
+
+func (sa *mockSAUnavailable) GetAuthorization(ctx context.Context, id string) (core.Authorization, error) {
+	return core.Authorization{}, errors.New("database unavailable")
+}
+
+func (sa *mockSAUnavailable) GetCertificate(ctx context.Context, serial string) (core.Certificate, error) {
+	return core.Certificate{}, errors.New("database unavailable")
+}
+
+func TestLookupFailures(t *testing.T) {
+	wfe, fc := setupWFE(t)
+	mux, err := wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		mux.ServeHTTP(rw, req)
+		return rw
+	}
+
+	// Objects the SA doesn't have are missing
+	for _, path := range []string{"/acme/authz/missing", "/acme/cert/0000000000000000000000000000000000ff"} {
+		rw := get(path)
+		test.AssertEquals(t, rw.Code, http.StatusNotFound)
+	}
+
+	// But a failing SA isn't taken to mean they're missing
+	wfe.SA = &mockSAUnavailable{mocks.NewStorageAuthority(fc)}
+	rw := get("/acme/authz/valid")
+	test.AssertEquals(t, rw.Code, http.StatusInternalServerError)
+	test.AssertEquals(t, rw.Body.String(), `{"type":"urn:acme:error:serverInternal","detail":"Unable to look up authorization","status":500}`)
+	rw = get("/acme/cert/0000000000000000000000000000000000b2")
+	test.AssertEquals(t, rw.Code, http.StatusInternalServerError)
+	test.AssertEquals(t, rw.Body.String(), `{"type":"urn:acme:error:serverInternal","detail":"Unable to look up certificate","status":500}`)
+}
+
+func TestConditionalGET(t *testing.T) {
+	wfe, fc := setupWFE(t)
+	fc.Add(24 * time.Hour)
+	wfe.DirectoryCacheDuration = time.Hour
+	wfe.IssuerCert = []byte{0, 0, 1}
+	mux, err := wfe.Handler()
+	test.AssertNotError(t, err, "Problem setting up HTTP handlers")
+
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		mux.ServeHTTP(rw, req)
+		return rw
+	}
+
+	for _, path := range []string{DirectoryPath, IssuerPath, "/acme/cert/0000000000000000000000000000000000b2"} {
+		rw := get(path, nil)
+		test.AssertEquals(t, rw.Code, http.StatusOK)
+		etag := rw.Header().Get("ETag")
+		test.Assert(t, etag != "", fmt.Sprintf("No ETag for %s", path))
+
+		// A client holding the current copy is told it's still good
+		rw = get(path, http.Header{"If-None-Match": {etag}})
+		test.AssertEquals(t, rw.Code, http.StatusNotModified)
+		test.AssertEquals(t, rw.Body.Len(), 0)
+
+		// A stale copy is replaced
+		rw = get(path, http.Header{"If-None-Match": {`"stale"`}})
+		test.AssertEquals(t, rw.Code, http.StatusOK)
+		test.AssertEquals(t, rw.Header().Get("ETag"), etag)
+	}
+
+	rw := get(DirectoryPath, nil)
+	test.AssertEquals(t, rw.Header().Get("Cache-Control"), "public, max-age=3600")
+	lastModified := rw.Header().Get("Last-Modified")
+	test.AssertEquals(t, lastModified, fc.Now().UTC().Format(http.TimeFormat))
+	rw = get(DirectoryPath, http.Header{"If-Modified-Since": {lastModified}})
+	test.AssertEquals(t, rw.Code, http.StatusNotModified)
+	rw = get(DirectoryPath, http.Header{"If-Modified-Since": {fc.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)}})
+	test.AssertEquals(t, rw.Code, http.StatusOK)
+}
+
 func assertCsrLogged(t *testing.T, mockLog *mocks.SyslogWriter) {
 	matches := mockLog.GetAllMatching("^\\[AUDIT\\] Certificate request JSON=")
 	test.Assert(t, len(matches) == 1,
@@ -1332,7 +2526,7 @@ func TestLogCsrPem(t *testing.T) {
 	test.AssertNotError(t, err, "Unable to parse certificateRequest")
 
 	mockSA := mocks.NewStorageAuthority(fc)
-	reg, err := mockSA.GetRegistration(789)
+	reg, err := mockSA.GetRegistration(ctx, 789)
 	test.AssertNotError(t, err, "Unable to get registration")
 
 	req, err := http.NewRequest("GET", "http://[::1]/", nil)
@@ -1363,9 +2557,9 @@ type mockSADifferentStoredKey struct {
 	core.StorageGetter
 }
 
-func (sa mockSADifferentStoredKey) GetRegistrationByKey(jwk jose.JsonWebKey) (core.Registration, error) {
+func (sa mockSADifferentStoredKey) GetRegistrationByKey(ctx context.Context, jwk jose.JSONWebKey) (core.Registration, error) {
 	keyJSON := []byte(test2KeyPublicJSON)
-	var parsedKey jose.JsonWebKey
+	var parsedKey jose.JSONWebKey
 	parsedKey.UnmarshalJSON(keyJSON)
 
 	return core.Registration{
@@ -1397,9 +2591,33 @@ func TestBadKeyCSR(t *testing.T) {
 
 	test.AssertEquals(t,
 		responseWriter.Body.String(),
-		`{"type":"urn:acme:error:malformed","detail":"Invalid key in certificate request :: Key too small: 512","status":400}`)
+		`{"type":"urn:acme:error:badPublicKey","detail":"Invalid key in certificate request :: Key too small: 512","status":400}`)
 }
 
 func newRequestEvent() *requestEvent {
 	return &requestEvent{Extra: make(map[string]interface{})}
 }
+
+func TestAccountKeyCSR(t *testing.T) {
+	wfe, _ := setupWFE(t)
+	responseWriter := httptest.NewRecorder()
+
+	// A CSR for the key that signs the request
+	accountKey, err := core.LoadPrivateKey([]byte(test1KeyPrivatePEM))
+	test.AssertNotError(t, err, "Failed to load key")
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "not-an-example.com"},
+		DNSNames: []string{"not-an-example.com"},
+	}, accountKey)
+	test.AssertNotError(t, err, "Failed to create CSR")
+
+	wfe.NewCertificate(newRequestEvent(), responseWriter,
+		makePostRequest(signRequest(t, `{
+			"resource":"new-cert",
+			"csr": "`+base64.RawURLEncoding.EncodeToString(csrDER)+`"
+		}`, wfe.nonceService)))
+
+	test.AssertEquals(t,
+		responseWriter.Body.String(),
+		`{"type":"urn:acme:error:badCSR","detail":"Certificate public key must be different than account key, so that a compromised certificate key can't be used to control the account","status":400}`)
+}